@@ -12,6 +12,7 @@ import (
 
 	"github.com/supergiant/control/pkg/controlplane"
 	"github.com/supergiant/control/pkg/proxy"
+	"github.com/supergiant/control/pkg/storage/etcd"
 )
 
 var (
@@ -19,7 +20,7 @@ var (
 	addr          = flag.String("address", "0.0.0.0", "network interface to attach server to")
 	port          = flag.Int("port", 8080, "tcp port to listen for incoming requests")
 	storageMode   = flag.String("storage-mode", "file", "storage type either file(default), memory or etcd")
-	storageURI    = flag.String("storage-uri", "supertiant.db", "uri of storage depends on selected storage type, for memory storage type this is empty")
+	storageURI    = flag.String("storage-uri", "supertiant.db", "uri of storage depends on selected storage type, for memory storage type this is empty, for etcd it is a comma separated list of endpoints")
 	templatesDir  = flag.String("templates", "/etc/supergiant/templates/", "supergiant will load script templates from the specified directory on start")
 	logLevel      = flag.String("log-level", "INFO", "logging level, e.g. info, warning, debug, error, fatal")
 	logFormat     = flag.String("log-format", "txt", "logging format [txt json]")
@@ -29,6 +30,74 @@ var (
 	ProxiesPortRangeTo   = flag.Int("proxies-port-to", 60250, "last tcp port in a range of binding reverse proxies for service apps")
 	pprofListenStr       = flag.String("pprofListenStr", "",
 		"pprof listen str host:port")
+	etcdMaintenanceInterval = flag.Int("etcd-maintenance-interval", 24,
+		"interval in hours between etcd compaction and defragmentation on managed clusters, 0 disables it")
+	meshSyncInterval = flag.Int("mesh-sync-interval", 60,
+		"interval in minutes between adding new nodes to wireguard meshes and rotating expired keys, 0 disables it")
+	meshKeyTTL = flag.Int("mesh-key-ttl", 30,
+		"time in days wireguard keys of mesh nodes are used before rotation, 0 disables rotation")
+	rightSizingInterval = flag.Int("right-sizing-interval", 6,
+		"interval in hours between resource usage analysis on managed clusters, 0 disables it")
+	rightSizingWindow = flag.Int("right-sizing-window", 24,
+		"time range in hours resource usage is averaged over")
+	healthCheckInterval = flag.Int("health-check-interval", 60,
+		"interval in seconds between checks of api servers and nodes of managed clusters, 0 disables it")
+	fleetMetricsInterval = flag.Int("fleet-metrics-interval", 0,
+		"interval in minutes between scrapes of managed clusters' prometheus for fleet series on /metrics, 0 disables it")
+	metricsToken = flag.String("metrics-token", os.Getenv("METRICS_TOKEN"),
+		"bearer token scrapers present to /metrics, the endpoint is disabled if it is empty, defaults to METRICS_TOKEN env variable")
+	releaseCheckInterval = flag.Int("release-check-interval", 5,
+		"interval in minutes between helm release status checks on managed clusters, 0 disables it")
+	releasePendingThreshold = flag.Int("release-pending-threshold", 15,
+		"time in minutes a release may stay pending before notification is sent")
+	notificationWebhook = flag.String("notification-webhook", "",
+		"url that receives events as json, events are logged if it is empty")
+	autoUpgradeInterval = flag.Int("auto-upgrade-interval", 15,
+		"interval in minutes between patch upgrades of clusters that have opted in to them, 0 disables it")
+	gitopsSyncInterval = flag.Int("gitops-sync-interval", 5,
+		"interval in minutes between syncs of clusters with bound git repositories, 0 disables it")
+	gitopsWorkdir = flag.String("gitops-workdir", "",
+		"directory for working copies of bound git repositories, temp directory is used if empty")
+	etcdCertFile = flag.String("etcd-cert-file", "",
+		"client certificate for the etcd storage")
+	etcdKeyFile = flag.String("etcd-key-file", "",
+		"client certificate key for the etcd storage")
+	etcdCAFile = flag.String("etcd-ca-file", "",
+		"ca certificate to verify etcd storage endpoints")
+	etcdUsername = flag.String("etcd-username", "",
+		"user name for the etcd storage authentication")
+	etcdPassword = flag.String("etcd-password", os.Getenv("ETCD_PASSWORD"),
+		"password for the etcd storage authentication, defaults to ETCD_PASSWORD env variable")
+	taskPruneInterval = flag.Int("task-prune-interval", 60,
+		"interval in minutes between applying the task retention policy, 0 disables it")
+	featureReloadInterval = flag.Int("feature-reload-interval", 30,
+		"interval in seconds between reloading feature flags from storage, 0 disables it")
+	runtimeConfigFile = flag.String("runtime-config", "",
+		"yaml file with settings applied without restart, they are read from storage if it is empty")
+	runtimeConfigInterval = flag.Int("runtime-config-interval", 10,
+		"interval in seconds between checks of runtime settings for changes, 0 disables it")
+	advertiseURL = flag.String("advertise-url", "",
+		"url other control replicas forward requests to when this one is the leader, defaults to http://<hostname>:<port>")
+	leaseDuration = flag.Int("leader-lease-duration", 15,
+		"time in seconds the leader keeps its role without renewal, another replica takes over after it")
+	workerSlots = flag.Int("worker-slots", 4,
+		"number of queued tasks this replica runs at once, 0 leaves them to other replicas")
+	taskLease = flag.Int("task-lease", 30,
+		"time in seconds a worker holds a task without a heartbeat, another worker resumes the task after it")
+	cloudAPIBudget = flag.Int("cloud-api-budget", 0,
+		"cloud API calls per minute an account may make before background jobs are slowed down, 0 disables it")
+	sshAgentSocket = flag.String("ssh-agent-socket", "",
+		"path to the ssh-agent socket machines imported without a private key are reached with, e.g. $SSH_AUTH_SOCK")
+	agentPort = flag.Int("agent-port", 0,
+		"tcp port node agents connect to with mutual TLS, 0 disables the endpoint")
+	agentCertTTL = flag.Int("agent-cert-ttl", 24,
+		"time in hours certificates of node agents are valid, agents renew them before they expire")
+	shutdownTimeout = flag.Int("shutdown-timeout", 300,
+		"time in seconds running tasks are given to finish their current steps on shutdown")
+	maxRequestSize = flag.Int64("max-request-size", 1<<20,
+		"max size of api request bodies in bytes, bigger requests are refused with 413")
+	maxUploadSize = flag.Int64("max-upload-size", 32<<20,
+		"max size in bytes of request bodies carrying big payloads, e.g. chart values files")
 )
 
 func main() {
@@ -47,10 +116,48 @@ func main() {
 		IdleTimeout:   time.Second * 120,
 		SpawnInterval: time.Second * time.Duration(*spawnInterval),
 
+		MaxRequestSize: *maxRequestSize,
+		MaxUploadSize:  *maxUploadSize,
+
+		EtcdConfig: etcd.Config{
+			CertFile: *etcdCertFile,
+			KeyFile:  *etcdKeyFile,
+			CAFile:   *etcdCAFile,
+			Username: *etcdUsername,
+			Password: *etcdPassword,
+		},
+
 		PprofListenStr: *pprofListenStr,
 
-		ProxiesPortRange: proxy.PortRange{int32(*ProxiesPortRangeFrom), int32(*ProxiesPortRangeTo)},
-		Version:          version,
+		ProxiesPortRange:        proxy.PortRange{int32(*ProxiesPortRangeFrom), int32(*ProxiesPortRangeTo)},
+		EtcdMaintenanceInterval: time.Hour * time.Duration(*etcdMaintenanceInterval),
+		MeshSyncInterval:        time.Minute * time.Duration(*meshSyncInterval),
+		MeshKeyTTL:              24 * time.Hour * time.Duration(*meshKeyTTL),
+		RightSizingInterval:     time.Hour * time.Duration(*rightSizingInterval),
+		RightSizingWindow:       time.Hour * time.Duration(*rightSizingWindow),
+		HealthCheckInterval:     time.Second * time.Duration(*healthCheckInterval),
+		FleetMetricsInterval:    time.Minute * time.Duration(*fleetMetricsInterval),
+		MetricsToken:            *metricsToken,
+		ReleaseCheckInterval:    time.Minute * time.Duration(*releaseCheckInterval),
+		ReleasePendingThreshold: time.Minute * time.Duration(*releasePendingThreshold),
+		NotificationWebhookURL:  *notificationWebhook,
+		AutoUpgradeInterval:     time.Minute * time.Duration(*autoUpgradeInterval),
+		GitOpsSyncInterval:      time.Minute * time.Duration(*gitopsSyncInterval),
+		GitOpsWorkdir:           *gitopsWorkdir,
+		TaskPruneInterval:       time.Minute * time.Duration(*taskPruneInterval),
+		FeatureReloadInterval:   time.Second * time.Duration(*featureReloadInterval),
+		RuntimeConfigFile:       *runtimeConfigFile,
+		RuntimeConfigInterval:   time.Second * time.Duration(*runtimeConfigInterval),
+		AdvertiseURL:            *advertiseURL,
+		LeaseDuration:           time.Second * time.Duration(*leaseDuration),
+		WorkerSlots:             *workerSlots,
+		TaskLease:               time.Second * time.Duration(*taskLease),
+		CloudAPIBudget:          *cloudAPIBudget,
+		SSHAgentSocket:          *sshAgentSocket,
+		AgentPort:               *agentPort,
+		AgentCertTTL:            time.Hour * time.Duration(*agentCertTTL),
+		ShutdownTimeout:         time.Second * time.Duration(*shutdownTimeout),
+		Version:                 version,
 	}
 
 	server, err := controlplane.New(cfg)
@@ -62,14 +169,18 @@ func main() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	stopped := make(chan struct{})
 	go func() {
 		<-sigs
 		logrus.Info("shutting down...")
 		server.Shutdown()
+		close(stopped)
 	}()
 
 	logrus.Infof("supergiant is starting on port %d", *port)
 	server.Start()
+	// running tasks are handed over before the process exits
+	<-stopped
 }
 
 // TODO: create sglog package
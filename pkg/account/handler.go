@@ -17,6 +17,9 @@ import (
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
+// ErrNegativeLimit is returned for accounts with a provisioning limit below zero.
+var ErrNegativeLimit = errors.New("provisioning limit can't be negative")
+
 // Handler is a http controller for account entity
 type Handler struct {
 	validator util.CloudAccountValidator
@@ -55,6 +58,10 @@ func (h *Handler) Create(rw http.ResponseWriter, r *http.Request) {
 		message.SendValidationFailed(rw, err)
 		return
 	}
+	if account.ProvisioningLimit < 0 {
+		message.SendValidationFailed(rw, ErrNegativeLimit)
+		return
+	}
 
 	// Check account data for validity
 	if err := h.validator.ValidateCredentials(account); err != nil {
@@ -136,6 +143,10 @@ func (h *Handler) Update(rw http.ResponseWriter, r *http.Request) {
 		message.SendValidationFailed(rw, err)
 		return
 	}
+	if account.ProvisioningLimit < 0 {
+		message.SendValidationFailed(rw, ErrNegativeLimit)
+		return
+	}
 	if err := h.service.Update(r.Context(), account); err != nil {
 		logrus.Errorf("account handler: update: %v", err)
 		message.SendUnknownError(rw, err)
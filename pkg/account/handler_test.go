@@ -176,6 +176,26 @@ func TestEndpoint_InvalidAccount(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
 }
 
+func TestEndpoint_NegativeLimit(t *testing.T) {
+	e, _ := fixtures()
+
+	account, _ := json.Marshal(model.CloudAccount{
+		Name:              "ff",
+		Provider:          clouds.DigitalOcean,
+		Credentials:       map[string]string{},
+		ProvisioningLimit: -1,
+	})
+
+	for _, handler := range []http.HandlerFunc{e.Create, e.Update} {
+		req, _ := http.NewRequest(http.MethodPost, "/cloud_accounts", bytes.NewReader(account))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), ErrNegativeLimit.Error())
+	}
+}
+
 func TestEndpoint_Delete(t *testing.T) {
 	e, m := fixtures()
 	m.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -0,0 +1,19 @@
+package account
+
+import (
+	"github.com/supergiant/control/pkg/migration"
+)
+
+// Migrator upgrades stored cloud accounts to the latest schema version.
+var Migrator = migration.New("name",
+	migration.Migration{
+		From:        0,
+		Description: "replace null credentials with an empty map",
+		Apply: func(r migration.Record) error {
+			if _, ok := r["credentials"].(map[string]interface{}); !ok {
+				r["credentials"] = map[string]interface{}{}
+			}
+			return nil
+		},
+	},
+)
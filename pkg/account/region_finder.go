@@ -15,6 +15,7 @@ import (
 	compute "google.golang.org/api/compute/v1"
 
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 	"github.com/supergiant/control/pkg/clouds/digitaloceansdk"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/util"
@@ -238,7 +239,7 @@ func NewAWSFinder(acc *model.CloudAccount, config *steps.Config) (*AWSFinder, er
 		return nil, errors.Wrap(err, "aws authentication: ")
 	}
 
-	client := ec2.New(sess)
+	client := ec2.New(apicalls.InstrumentAWS(sess))
 
 	return &AWSFinder{
 		defaultClient: client,
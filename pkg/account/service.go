@@ -37,6 +37,11 @@ func (s *Service) GetAll(ctx context.Context) ([]model.CloudAccount, error) {
 		return accounts, err
 	}
 	for _, v := range res {
+		if v, _, err = Migrator.Upgrade(v); err != nil {
+			logrus.Warningf("failed to migrate stored cloud account: %v", err)
+			continue
+		}
+
 		ca := new(model.CloudAccount)
 		err = json.NewDecoder(bytes.NewReader(v)).Decode(ca)
 		if err != nil {
@@ -60,6 +65,10 @@ func (s *Service) Get(ctx context.Context, accountName string) (*model.CloudAcco
 		return nil, sgerrors.ErrNotFound
 	}
 
+	if res, _, err = Migrator.Upgrade(res); err != nil {
+		return nil, errors.Wrapf(err, "migrate cloud account %s", accountName)
+	}
+
 	ca := &model.CloudAccount{}
 	err = json.NewDecoder(bytes.NewReader(res)).Decode(ca)
 	if err != nil {
@@ -74,6 +83,16 @@ func (s *Service) Get(ctx context.Context, accountName string) (*model.CloudAcco
 	return ca, nil
 }
 
+// ProvisioningLimit returns how many clusters may be provisioned with the account at once.
+func (s *Service) ProvisioningLimit(ctx context.Context, accountName string) (int, error) {
+	acc, err := s.Get(ctx, accountName)
+	if err != nil {
+		return 0, err
+	}
+
+	return acc.ProvisioningLimit, nil
+}
+
 // Create stores user in the underlying storage
 func (s *Service) Create(ctx context.Context, account *model.CloudAccount) error {
 	// Check if account with that name already exists
@@ -86,6 +105,7 @@ func (s *Service) Create(ctx context.Context, account *model.CloudAccount) error
 		return sgerrors.ErrAlreadyExists
 	}
 
+	account.SchemaVersion = Migrator.Version()
 	rawJSON, err := json.Marshal(account)
 	if err != nil {
 		return err
@@ -96,6 +116,7 @@ func (s *Service) Create(ctx context.Context, account *model.CloudAccount) error
 
 // Update cloud account
 func (s *Service) Update(ctx context.Context, account *model.CloudAccount) error {
+	account.SchemaVersion = Migrator.Version()
 	rawJSON, err := json.Marshal(account)
 	if err != nil {
 		return errors.WithStack(err)
@@ -0,0 +1,398 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/workflows"
+)
+
+const DefaultStoragePrefix = "/supergiant/activity/"
+
+const (
+	// SourceAudit events are changes requested through the api
+	SourceAudit = "audit"
+	// SourceTask events are workflows run on the cluster
+	SourceTask = "task"
+	// SourceHelm events are finished release operations
+	SourceHelm = "helm"
+	// SourceSecurity events are refused logins and requests, they belong
+	// to the installation rather than a cluster.
+	SourceSecurity = "security"
+)
+
+const (
+	EventClusterCreated        = "cluster.created"
+	EventClusterDeleted        = "cluster.deleted"
+	EventClusterChanged        = "cluster.changed"
+	EventNodeAdded             = "node.added"
+	EventNodeRemoved           = "node.removed"
+	EventNodeImported          = "node.imported"
+	EventNodePatched           = "node.patched"
+	EventKubeletUpdated        = "kubelet.updated"
+	EventEtcdMaintained        = "etcd.maintained"
+	EventProvisioningRestarted = "provisioning.restarted"
+	EventReleaseInstalled      = "release.installed"
+	EventReleaseUpgraded       = "release.upgraded"
+	EventReleaseDeleted        = "release.deleted"
+	EventTaskFinished          = "task.finished"
+	EventConsoleSession        = "console.session"
+	EventNodeExec              = "node.exec"
+	EventFilesDistributed      = "files.distributed"
+	EventKubeConfigIssued      = "kubeconfig.issued"
+
+	EventLoginFailed    = "login.failed"
+	EventLoginLocked    = "login.locked"
+	EventAddressRefused = "address.refused"
+)
+
+// taskEvents maps workflows to events of the timeline.
+var taskEvents = map[string]string{
+	workflows.PostProvision:        EventClusterCreated,
+	workflows.ProvisionMaster:      EventNodeAdded,
+	workflows.ProvisionNode:        EventNodeAdded,
+	workflows.ImportMaster:         EventNodeImported,
+	workflows.ImportNode:           EventNodeImported,
+	workflows.DeleteNode:           EventNodeRemoved,
+	workflows.DeleteOrphan:         EventNodeRemoved,
+	workflows.DeleteCluster:        EventClusterDeleted,
+	workflows.UpdateKubelet:        EventKubeletUpdated,
+	workflows.PatchNode:            EventNodePatched,
+	workflows.EtcdMaintenance:      EventEtcdMaintained,
+	workflows.DistributeFiles:      EventFilesDistributed,
+	workflows.DistributeFilesAgent: EventFilesDistributed,
+}
+
+// helmEvents maps release operations to events of the timeline.
+var helmEvents = map[string]string{
+	kube.HelmOpInstall: EventReleaseInstalled,
+	kube.HelmOpUpgrade: EventReleaseUpgraded,
+	kube.HelmOpDelete:  EventReleaseDeleted,
+}
+
+// Event is a change of a cluster.
+type Event struct {
+	ID      string `json:"id"`
+	KubeID  string `json:"kubeId"`
+	Type    string `json:"type"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+	// User is empty for changes made by supergiant itself
+	User      string            `json:"user,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Filter narrows down the timeline, empty fields match everything.
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Types []string
+	Limit int
+}
+
+func (f Filter) match(e Event) bool {
+	if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.CreatedAt.After(f.Until) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+// Service records changes of clusters and assembles them with tasks
+// into a timeline. Events are stored outside of tenants, they are recorded
+// by background jobs without one, access is checked with the kube instead.
+type Service struct {
+	prefix   string
+	storage  storage.Interface
+	taskRepo storage.Interface
+	kubes    kubeGetter
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface, taskRepo storage.Interface, kubes kubeGetter) *Service {
+	return &Service{
+		prefix:   prefix,
+		storage:  s,
+		taskRepo: taskRepo,
+		kubes:    kubes,
+	}
+}
+
+// Record saves the event to the timeline of its cluster.
+func (s *Service) Record(ctx context.Context, e *Event) error {
+	if e.KubeID == "" {
+		return errors.New("kube id of the event is required")
+	}
+	e.ID = uuid.New()[:8]
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "encode event %s", e.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.kubePrefix(e.KubeID), e.ID, data),
+		"save event %s", e.ID)
+}
+
+// OnHelmOperation records finished release operations, it is subscribed
+// to the kube service.
+func (s *Service) OnHelmOperation(op kube.HelmOperation) {
+	eventType, ok := helmEvents[op.Type]
+	if !ok {
+		return
+	}
+
+	e := &Event{
+		KubeID:    op.KubeID,
+		Type:      eventType,
+		Source:    SourceHelm,
+		Message:   fmt.Sprintf("%s release %s: %s", op.Type, op.Release, op.Status),
+		Status:    op.Status,
+		CreatedAt: op.FinishedAt,
+		Details: map[string]string{
+			"release": op.Release,
+		},
+	}
+	if op.Error != "" {
+		e.Details["error"] = op.Error
+	}
+	if op.Result != nil {
+		e.Details["chart"] = op.Result.Chart
+		e.Details["chartVersion"] = op.Result.ChartVersion
+	}
+
+	if err := s.Record(context.Background(), e); err != nil {
+		logrus.Warnf("activity: cluster %s: %v", op.KubeID, err)
+	}
+}
+
+// OnConsoleSession records shells opened on nodes, it is subscribed to
+// the console handler.
+func (s *Service) OnConsoleSession(cs kube.ConsoleSession) {
+	e := &Event{
+		KubeID:  cs.KubeID,
+		Type:    EventConsoleSession,
+		Source:  SourceAudit,
+		Message: fmt.Sprintf("console of node %s exited with code %d", cs.Node, cs.ExitCode),
+		User:    cs.User,
+		Details: map[string]string{
+			"node":    cs.Node,
+			"session": cs.ID,
+		},
+	}
+	if cs.FinishedAt != nil {
+		e.CreatedAt = *cs.FinishedAt
+		e.Details["duration"] = cs.FinishedAt.Sub(cs.StartedAt).Round(time.Second).String()
+	}
+	if cs.Error != "" {
+		e.Details["error"] = cs.Error
+	}
+
+	if err := s.Record(context.Background(), e); err != nil {
+		logrus.Warnf("activity: cluster %s: %v", cs.KubeID, err)
+	}
+}
+
+// OnNodeExec records commands run across nodes, it is subscribed to the
+// node executor.
+func (s *Service) OnNodeExec(r kube.NodeExecReport) {
+	nodes := make([]string, 0, len(r.Results))
+	for _, result := range r.Results {
+		nodes = append(nodes, result.Node)
+	}
+
+	e := &Event{
+		KubeID:    r.KubeID,
+		Type:      EventNodeExec,
+		Source:    SourceAudit,
+		Message:   fmt.Sprintf("command has failed on %d of %d nodes", r.Failed, len(r.Results)),
+		User:      r.User,
+		CreatedAt: r.FinishedAt,
+		Details: map[string]string{
+			"exec":  r.ID,
+			"nodes": strings.Join(nodes, ","),
+		},
+	}
+	if r.Command != "" {
+		e.Details["command"] = r.Command
+	} else {
+		e.Details["scriptSha256"] = r.ScriptSHA256
+	}
+
+	if err := s.Record(context.Background(), e); err != nil {
+		logrus.Warnf("activity: cluster %s: %v", r.KubeID, err)
+	}
+}
+
+// Timeline returns events of the cluster, the latest go first.
+func (s *Service) Timeline(ctx context.Context, kubeID string, filter Filter) ([]Event, error) {
+	// the kube is looked up within the tenant of the request
+	if _, err := s.kubes.Get(ctx, kubeID); err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	raw, err := s.storage.GetAll(ctx, s.kubePrefix(kubeID))
+	if err != nil {
+		return nil, errors.Wrap(err, "list events")
+	}
+
+	events := make([]Event, 0, len(raw))
+	for _, data := range raw {
+		e := Event{}
+		if err = json.Unmarshal(data, &e); err != nil {
+			logrus.Warnf("activity: skip corrupted event: %v", err)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	tasks, err := s.taskEvents(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, tasks...)
+
+	return filter.apply(events), nil
+}
+
+// RecordSecurity saves the event to the security log of the installation.
+func (s *Service) RecordSecurity(ctx context.Context, e *Event) error {
+	e.ID = uuid.New()[:8]
+	e.Source = SourceSecurity
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "encode event %s", e.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.securityPrefix(), e.ID, data),
+		"save event %s", e.ID)
+}
+
+// SecurityEvents returns the security log, the latest go first.
+func (s *Service) SecurityEvents(ctx context.Context, filter Filter) ([]Event, error) {
+	raw, err := s.storage.GetAll(ctx, s.securityPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "list events")
+	}
+
+	events := make([]Event, 0, len(raw))
+	for _, data := range raw {
+		e := Event{}
+		if err = json.Unmarshal(data, &e); err != nil {
+			logrus.Warnf("activity: skip corrupted event: %v", err)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return filter.apply(events), nil
+}
+
+// apply returns matching events, the latest go first.
+func (f Filter) apply(events []Event) []Event {
+	out := make([]Event, 0, len(events))
+	for _, e := range events {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+
+	return out
+}
+
+// taskEvents converts tasks of the cluster into events, tasks removed
+// by the retention policy are not shown.
+func (s *Service) taskEvents(ctx context.Context, kubeID string) ([]Event, error) {
+	raw, err := s.taskRepo.GetAll(ctx, workflows.Prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list tasks")
+	}
+
+	events := make([]Event, 0)
+	for _, data := range raw {
+		t := &workflows.Task{}
+		if err = json.Unmarshal(data, t); err != nil {
+			continue
+		}
+		if t.Config == nil || t.Config.ClusterID != kubeID {
+			continue
+		}
+
+		eventType, ok := taskEvents[t.Type]
+		if !ok {
+			eventType = EventTaskFinished
+		}
+
+		e := Event{
+			ID:        t.ID,
+			KubeID:    kubeID,
+			Type:      eventType,
+			Source:    SourceTask,
+			Message:   fmt.Sprintf("%s %s", t.Type, strings.ToLower(string(t.Status))),
+			Status:    string(t.Status),
+			CreatedAt: t.FinishedAt,
+			Details: map[string]string{
+				"task": t.ID,
+			},
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = t.CreatedAt
+		}
+		if t.Config.Node.Name != "" {
+			e.Details["node"] = t.Config.Node.Name
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+func (s *Service) kubePrefix(kubeID string) string {
+	return s.prefix + kubeID + "/"
+}
+
+// securityPrefix keeps events apart from clusters, ids of clusters have no underscores.
+func (s *Service) securityPrefix() string {
+	return s.prefix + "_security/"
+}
@@ -0,0 +1,225 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, kubeID string) (*model.Kube, error) {
+	k, ok := f[kubeID]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+func putTask(t *testing.T, repo *memory.InMemoryRepository, id, taskType, kubeID string, finished time.Time) {
+	cfg := &steps.Config{ClusterID: kubeID}
+	cfg.Node.Name = "node-" + id
+	data, err := json.Marshal(&workflows.Task{
+		ID:         id,
+		Type:       taskType,
+		Config:     cfg,
+		Status:     statuses.Success,
+		CreatedAt:  finished.Add(-time.Minute),
+		FinishedAt: finished,
+	})
+	require.NoError(t, err)
+	require.NoError(t, repo.Put(context.Background(), workflows.Prefix, id, data))
+}
+
+func TestService_Timeline(t *testing.T) {
+	day := time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC)
+
+	repo := memory.NewInMemoryRepository()
+	putTask(t, repo, "1", workflows.PostProvision, "kube", day)
+	putTask(t, repo, "2", workflows.ProvisionNode, "kube", day.Add(2*time.Hour))
+	putTask(t, repo, "3", workflows.ProvisionNode, "other", day.Add(2*time.Hour))
+
+	svc := NewService(DefaultStoragePrefix, repo, repo, fakeKubes{
+		"kube":  {ID: "kube"},
+		"other": {ID: "other"},
+	})
+
+	require.NoError(t, svc.Record(context.Background(), &Event{
+		KubeID:    "kube",
+		Type:      EventNodeRemoved,
+		Source:    SourceAudit,
+		User:      "admin",
+		CreatedAt: day.Add(time.Hour),
+	}))
+	svc.OnHelmOperation(kube.HelmOperation{
+		KubeID:     "kube",
+		Type:       kube.HelmOpInstall,
+		Release:    "ingress",
+		Status:     kube.HelmOpSucceeded,
+		FinishedAt: day.Add(3 * time.Hour),
+		Result:     &model.ReleaseInfo{Chart: "nginx-ingress", ChartVersion: "1.6.0"},
+	})
+	require.Error(t, svc.Record(context.Background(), &Event{}))
+
+	for _, tc := range []struct {
+		name          string
+		kubeID        string
+		filter        Filter
+		expectedTypes []string
+		expectedErr   error
+	}{
+		{
+			name:        "unknown kube",
+			kubeID:      "missing",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:   "all",
+			kubeID: "kube",
+			expectedTypes: []string{
+				EventReleaseInstalled,
+				EventNodeAdded,
+				EventNodeRemoved,
+				EventClusterCreated,
+			},
+		},
+		{
+			name:          "time range",
+			kubeID:        "kube",
+			filter:        Filter{Since: day.Add(time.Minute), Until: day.Add(2 * time.Hour)},
+			expectedTypes: []string{EventNodeAdded, EventNodeRemoved},
+		},
+		{
+			name:          "types",
+			kubeID:        "kube",
+			filter:        Filter{Types: []string{EventNodeAdded, EventNodeRemoved}, Limit: 1},
+			expectedTypes: []string{EventNodeAdded},
+		},
+		{
+			name:          "other kube",
+			kubeID:        "other",
+			expectedTypes: []string{EventNodeAdded},
+		},
+	} {
+		events, err := svc.Timeline(context.Background(), tc.kubeID, tc.filter)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		types := make([]string, 0, len(events))
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		require.Equal(t, tc.expectedTypes, types, "TC: %s", tc.name)
+	}
+
+	events, err := svc.Timeline(context.Background(), "kube", Filter{Types: []string{EventReleaseInstalled}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, SourceHelm, events[0].Source)
+	require.Equal(t, "1.6.0", events[0].Details["chartVersion"])
+}
+
+func TestService_OnConsoleSession(t *testing.T) {
+	started := time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+
+	repo := memory.NewInMemoryRepository()
+	svc := NewService(DefaultStoragePrefix, repo, repo, fakeKubes{"kube": {ID: "kube"}})
+	svc.OnConsoleSession(kube.ConsoleSession{
+		ID:         "session",
+		KubeID:     "kube",
+		Node:       "master",
+		User:       "alice",
+		StartedAt:  started,
+		FinishedAt: &finished,
+		ExitCode:   130,
+	})
+
+	events, err := svc.Timeline(context.Background(), "kube", Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, EventConsoleSession, events[0].Type)
+	require.Equal(t, "alice", events[0].User)
+	require.Equal(t, finished, events[0].CreatedAt)
+	require.Equal(t, map[string]string{
+		"node":     "master",
+		"session":  "session",
+		"duration": "1m30s",
+	}, events[0].Details)
+}
+
+func TestService_OnNodeExec(t *testing.T) {
+	finished := time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC)
+
+	repo := memory.NewInMemoryRepository()
+	svc := NewService(DefaultStoragePrefix, repo, repo, fakeKubes{"kube": {ID: "kube"}})
+	svc.OnNodeExec(kube.NodeExecReport{
+		ID:           "exec",
+		KubeID:       "kube",
+		User:         "alice",
+		ScriptSHA256: "sha",
+		FinishedAt:   finished,
+		Results: []kube.NodeExecResult{
+			{Node: "master"},
+			{Node: "node", ExitCode: 1},
+		},
+		Failed: 1,
+	})
+
+	events, err := svc.Timeline(context.Background(), "kube", Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, EventNodeExec, events[0].Type)
+	require.Equal(t, "alice", events[0].User)
+	require.Equal(t, finished, events[0].CreatedAt)
+	require.Equal(t, "command has failed on 1 of 2 nodes", events[0].Message)
+	require.Equal(t, map[string]string{
+		"exec":         "exec",
+		"nodes":        "master,node",
+		"scriptSha256": "sha",
+	}, events[0].Details)
+}
+
+func TestService_SecurityEvents(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	svc := NewService(DefaultStoragePrefix, repo, repo, fakeKubes{"kube": {ID: "kube"}})
+	day := time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC)
+
+	for i, eventType := range []string{EventLoginFailed, EventLoginFailed, EventLoginLocked} {
+		require.NoError(t, svc.RecordSecurity(context.Background(), &Event{
+			Type:      eventType,
+			User:      "admin",
+			CreatedAt: day.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	events, err := svc.SecurityEvents(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, EventLoginLocked, events[0].Type)
+	require.Equal(t, SourceSecurity, events[0].Source)
+
+	events, err = svc.SecurityEvents(context.Background(), Filter{Types: []string{EventLoginFailed}, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, day.Add(time.Minute), events[0].CreatedAt)
+
+	// security events are not shown on timelines of clusters
+	events, err = svc.Timeline(context.Background(), "kube", Filter{})
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
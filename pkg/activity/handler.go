@@ -0,0 +1,230 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const kubeRoute = "/kubes/{kubeID}"
+
+// auditEvents maps cluster api calls to events of the timeline,
+// other changes are recorded as EventClusterChanged.
+var auditEvents = map[string]string{
+	http.MethodDelete + " ":                          EventClusterDeleted,
+	http.MethodPost + " /nodes":                      EventNodeAdded,
+	http.MethodPost + " /machines":                   EventNodeAdded,
+	http.MethodDelete + " /nodes/{nodename}":         EventNodeRemoved,
+	http.MethodDelete + " /machines/{nodename}":      EventNodeRemoved,
+	http.MethodPost + " /releases":                   EventReleaseInstalled,
+	http.MethodDelete + " /releases/{releaseName}":   EventReleaseDeleted,
+	http.MethodPost + " /kubelet":                    EventKubeletUpdated,
+	http.MethodPost + " /patch":                      EventNodePatched,
+	http.MethodPost + " /files":                      EventFilesDistributed,
+	http.MethodPost + " /users/{uname}/kubeconfig":   EventKubeConfigIssued,
+	http.MethodPost + " /restart":                    EventProvisioningRestarted,
+	http.MethodDelete + " /orphans/nodes/{nodename}": EventNodeRemoved,
+}
+
+// Servicer is an interface of the activity service.
+type Servicer interface {
+	Record(ctx context.Context, e *Event) error
+	Timeline(ctx context.Context, kubeID string, filter Filter) ([]Event, error)
+	SecurityEvents(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// Handler is a http handler for cluster timelines.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds activity handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/activity", h.getTimeline).Methods(http.MethodGet)
+	r.HandleFunc("/activity/security", h.getSecurityEvents).Methods(http.MethodGet)
+}
+
+// getTimeline answers what has changed on a cluster:
+// GET /kubes/{kubeID}/activity?since=2019-05-07T00:00:00Z&until=...&type=node.added,node.removed&limit=100
+func (h *Handler) getTimeline(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	events, err := h.svc.Timeline(r.Context(), kubeID, filter)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		logrus.Errorf("activity: cluster %s: %v", kubeID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(events); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// getSecurityEvents returns refused logins and requests of the installation,
+// they are shown to users of the default tenant only:
+// GET /activity/security?since=...&type=login.failed&limit=100
+func (h *Handler) getSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID {
+		http.Error(w, "security events are shown to the default tenant", http.StatusForbidden)
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	events, err := h.svc.SecurityEvents(r.Context(), filter)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(events); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// Audit records successful changes of clusters made through the api
+// along with the user who made them.
+func (h *Handler) Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kubeID := mux.Vars(r)["kubeID"]
+		if kubeID == "" || !isChange(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status >= http.StatusBadRequest {
+			return
+		}
+
+		e := auditEvent(r, kubeID)
+		if err := h.svc.Record(r.Context(), e); err != nil {
+			logrus.Warnf("activity: cluster %s: %v", kubeID, err)
+		}
+	})
+}
+
+func auditEvent(r *http.Request, kubeID string) *Event {
+	vars := mux.Vars(r)
+
+	action := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			action = tpl
+		}
+	}
+	if i := strings.Index(action, kubeRoute); i >= 0 {
+		action = action[i+len(kubeRoute):]
+	}
+
+	eventType, ok := auditEvents[r.Method+" "+action]
+	if !ok {
+		eventType = EventClusterChanged
+	}
+
+	e := &Event{
+		KubeID:  kubeID,
+		Type:    eventType,
+		Source:  SourceAudit,
+		Message: fmt.Sprintf("%s %s", r.Method, r.URL.Path),
+		User:    api.UserFromContext(r.Context()),
+		Details: make(map[string]string),
+	}
+	for k, v := range vars {
+		if k != "kubeID" {
+			e.Details[k] = v
+		}
+	}
+	// reasons of deletions typed by users
+	if reason := r.URL.Query().Get("reason"); reason != "" {
+		e.Details["reason"] = reason
+	}
+
+	return e
+}
+
+func isChange(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	filter := Filter{}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.Wrap(err, "since")
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.Wrap(err, "until")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return filter, errors.Errorf("invalid limit %q", v)
+		}
+	}
+	for _, types := range q["type"] {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// statusWriter remembers the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,118 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func TestHandler_getTimeline(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(),
+		memory.NewInMemoryRepository(), fakeKubes{"kube": {ID: "kube"}})
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	for _, tc := range []struct {
+		url          string
+		expectedCode int
+	}{
+		{"/kubes/kube/activity", http.StatusOK},
+		{"/kubes/kube/activity?since=2019-05-07T00:00:00Z&type=node.added,node.removed&limit=10", http.StatusOK},
+		{"/kubes/kube/activity?since=yesterday", http.StatusBadRequest},
+		{"/kubes/kube/activity?limit=-1", http.StatusBadRequest},
+		{"/kubes/missing/activity", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, tc.url)
+	}
+}
+
+func TestHandler_Audit(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(),
+		memory.NewInMemoryRepository(), fakeKubes{"kube": {ID: "kube"}})
+	h := NewHandler(svc)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.HandleFunc("/kubes/{kubeID}", ok).Methods(http.MethodDelete, http.MethodGet)
+	router.HandleFunc("/kubes/{kubeID}/machines/{nodename}", ok).Methods(http.MethodDelete)
+	router.HandleFunc("/kubes/{kubeID}/releases", ok).Methods(http.MethodPost)
+	router.HandleFunc("/kubes/{kubeID}/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/kubes/{kubeID}/certs", ok).Methods(http.MethodPost)
+	router.HandleFunc("/kubes", ok).Methods(http.MethodPost)
+	router.Use(h.Audit)
+
+	for _, tc := range []struct {
+		method       string
+		url          string
+		expectedType string
+	}{
+		{http.MethodGet, "/kubes/kube", ""},
+		{http.MethodPost, "/kubes", ""},
+		{http.MethodPost, "/kubes/kube/users", ""},
+		{http.MethodDelete, "/kubes/kube?name=kube&reason=decommission", EventClusterDeleted},
+		{http.MethodDelete, "/kubes/kube/machines/node-1", EventNodeRemoved},
+		{http.MethodPost, "/kubes/kube/releases", EventReleaseInstalled},
+		{http.MethodPost, "/kubes/kube/certs", EventClusterChanged},
+	} {
+		since := time.Now()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.url, nil))
+
+		events, err := svc.Timeline(context.Background(), "kube", Filter{Since: since})
+		require.NoError(t, err)
+		if tc.expectedType == "" {
+			require.Empty(t, events, "%s %s", tc.method, tc.url)
+			continue
+		}
+		require.Len(t, events, 1, "%s %s", tc.method, tc.url)
+		require.Equal(t, tc.expectedType, events[0].Type, "%s %s", tc.method, tc.url)
+		require.Equal(t, SourceAudit, events[0].Source)
+		if tc.expectedType == EventClusterDeleted {
+			require.Equal(t, "decommission", events[0].Details["reason"])
+		}
+	}
+}
+
+func TestHandler_getSecurityEvents(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(),
+		memory.NewInMemoryRepository(), fakeKubes{})
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+	require.NoError(t, svc.RecordSecurity(context.Background(), &Event{Type: EventLoginFailed}))
+
+	for _, tc := range []struct {
+		tenantID     string
+		url          string
+		expectedCode int
+	}{
+		{tenant.DefaultID, "/activity/security?type=login.failed", http.StatusOK},
+		{tenant.DefaultID, "/activity/security?limit=-1", http.StatusBadRequest},
+		{"acme", "/activity/security", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		req = req.WithContext(tenant.WithID(req.Context(), tc.tenantID))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, tc.url)
+		if tc.expectedCode == http.StatusOK {
+			events := make([]Event, 0)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&events))
+			require.Len(t, events, 1)
+		}
+	}
+}
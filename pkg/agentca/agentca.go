@@ -0,0 +1,275 @@
+package agentca
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/agentca/"
+	// DefaultCertTTL is how long certificates of agents are valid,
+	// agents renew them after two thirds of it.
+	DefaultCertTTL = 24 * time.Hour
+
+	caKey       = "ca"
+	agentPrefix = "agent:"
+	serverName  = "supergiant-control"
+)
+
+var ErrNotAgent = errors.New("certificate is not issued to a node agent")
+
+type kubeGetter interface {
+	Get(ctx context.Context, name string) (*model.Kube, error)
+}
+
+// Certificate is a client certificate of a node agent.
+type Certificate struct {
+	KubeID     string    `json:"kubeId"`
+	NodeName   string    `json:"nodeName"`
+	Cert       []byte    `json:"cert"`
+	Key        []byte    `json:"key"`
+	CA         []byte    `json:"ca"`
+	NotAfter   time.Time `json:"notAfter"`
+	RenewAfter time.Time `json:"renewAfter"`
+}
+
+// Identity is a node an agent runs on, it is taken from the certificate
+// the agent presents.
+type Identity struct {
+	TenantID string
+	KubeID   string
+	NodeName string
+}
+
+// Service is a built-in CA that issues certificates of node agents and
+// of the endpoint they connect to, so agent traffic is mutually authenticated.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	kubes   kubeGetter
+	ttl     time.Duration
+
+	m  sync.Mutex
+	ca *pki.PairPEM
+}
+
+// NewService constructs a Service, the CA is created on the first use
+// and shared by replicas through the storage.
+func NewService(prefix string, s storage.Interface, kubes kubeGetter, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = DefaultCertTTL
+	}
+
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		kubes:   kubes,
+		ttl:     ttl,
+	}
+}
+
+// CA returns the certificate authority, it is created if it doesn't exist.
+func (s *Service) CA(ctx context.Context) (*pki.PairPEM, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.ca != nil {
+		return s.ca, nil
+	}
+
+	ca, err := s.loadCA(ctx)
+	if sgerrors.IsNotFound(err) {
+		ca, err = s.createCA(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.ca = ca
+	return ca, nil
+}
+
+func (s *Service) loadCA(ctx context.Context) (*pki.PairPEM, error) {
+	raw, err := s.storage.Get(ctx, s.prefix, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ca := &pki.PairPEM{}
+	if err = json.Unmarshal(raw, ca); err != nil {
+		return nil, errors.Wrap(err, "unmarshal ca")
+	}
+	return ca, nil
+}
+
+func (s *Service) createCA(ctx context.Context) (*pki.PairPEM, error) {
+	ca, err := pki.NewAgentCAPair()
+	if err != nil {
+		return nil, errors.Wrap(err, "create ca")
+	}
+	raw, err := json.Marshal(ca)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal ca")
+	}
+
+	swapper, ok := s.storage.(storage.Swapper)
+	if !ok {
+		return ca, errors.Wrap(s.storage.Put(ctx, s.prefix, caKey, raw), "storage: put")
+	}
+
+	// another replica may have created the CA meanwhile
+	created, err := swapper.CompareAndSwap(ctx, s.prefix, caKey, nil, raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: compare and swap")
+	}
+	if !created {
+		return s.loadCA(ctx)
+	}
+	return ca, nil
+}
+
+// Issue creates a certificate of the agent running on the node of the cluster.
+func (s *Service) Issue(ctx context.Context, kubeID, nodeName string) (*Certificate, error) {
+	k, err := s.kubes.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+	if k.Masters[nodeName] == nil && k.Nodes[nodeName] == nil {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "node %s", nodeName)
+	}
+
+	ca, err := s.CA(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := certutil.Config{
+		CommonName: agentPrefix + kubeID + ":" + nodeName,
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if id := tenant.FromContext(ctx); id != tenant.DefaultID {
+		cfg.Organization = []string{id}
+	}
+
+	pair, err := pki.NewShortLivedPair(cfg, s.ttl, ca)
+	if err != nil {
+		return nil, errors.Wrapf(err, "issue certificate of %s", nodeName)
+	}
+
+	now := time.Now()
+	return &Certificate{
+		KubeID:     kubeID,
+		NodeName:   nodeName,
+		Cert:       pair.Cert,
+		Key:        pair.Key,
+		CA:         ca.Cert,
+		NotAfter:   now.Add(s.ttl),
+		RenewAfter: now.Add(s.renewPeriod()),
+	}, nil
+}
+
+// Renew issues another certificate to the agent that presented a valid one,
+// agents of nodes that have been removed from the cluster can't renew.
+func (s *Service) Renew(ctx context.Context, id Identity) (*Certificate, error) {
+	return s.Issue(tenant.WithID(ctx, id.TenantID), id.KubeID, id.NodeName)
+}
+
+// TLSConfig requires clients to present certificates issued by the CA, the
+// certificate of the endpoint is renewed before it expires.
+func (s *Service) TLSConfig(ctx context.Context, hosts []string) (*tls.Config, error) {
+	ca, err := s.CA(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca.Cert) {
+		return nil, errors.Wrap(pki.ErrInvalidCA, "append ca")
+	}
+
+	cfg := certutil.Config{
+		CommonName: serverName,
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			cfg.AltNames.IPs = append(cfg.AltNames.IPs, ip)
+		} else {
+			cfg.AltNames.DNSNames = append(cfg.AltNames.DNSNames, h)
+		}
+	}
+
+	var (
+		m       sync.Mutex
+		current *tls.Certificate
+		renewAt time.Time
+	)
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		if current != nil && time.Now().Before(renewAt) {
+			return current, nil
+		}
+
+		pair, err := pki.NewShortLivedPair(cfg, s.ttl, ca)
+		if err != nil {
+			return nil, errors.Wrap(err, "issue server certificate")
+		}
+		cert, err := tls.X509KeyPair(pair.Cert, pair.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "server certificate")
+		}
+
+		current, renewAt = &cert, time.Now().Add(s.renewPeriod())
+		return current, nil
+	}
+
+	return &tls.Config{
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+		GetCertificate: getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+func (s *Service) renewPeriod() time.Duration {
+	return s.ttl * 2 / 3
+}
+
+// IdentityOf returns the node of a verified agent certificate.
+func IdentityOf(cert *x509.Certificate) (*Identity, error) {
+	if !strings.HasPrefix(cert.Subject.CommonName, agentPrefix) {
+		return nil, ErrNotAgent
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(cert.Subject.CommonName, agentPrefix), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrNotAgent
+	}
+
+	id := &Identity{
+		KubeID:   parts[0],
+		NodeName: parts[1],
+	}
+	if len(cert.Subject.Organization) > 0 {
+		id.TenantID = cert.Subject.Organization[0]
+	}
+
+	return id, nil
+}
@@ -0,0 +1,154 @@
+package agentca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, name string) (*model.Kube, error) {
+	k, ok := f[tenant.FromContext(ctx)+"/"+name]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+func testKubes() fakeKubes {
+	return fakeKubes{
+		"acme/kube": {
+			ID:      "kube",
+			Masters: map[string]*model.Machine{"master-1": {Name: "master-1"}},
+			Nodes:   map[string]*model.Machine{"node-1": {Name: "node-1"}},
+		},
+	}
+}
+
+func parseCert(t *testing.T, raw []byte) *x509.Certificate {
+	block, _ := pem.Decode(raw)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestService_CA(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+
+	first, err := NewService(DefaultStoragePrefix, repo, testKubes(), 0).CA(context.Background())
+	require.NoError(t, err)
+
+	// replicas share the CA through the storage
+	second, err := NewService(DefaultStoragePrefix, repo, testKubes(), 0).CA(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.True(t, parseCert(t, first.Cert).IsCA)
+}
+
+func TestService_Issue(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	for _, tc := range []struct {
+		name        string
+		ctx         context.Context
+		kubeID      string
+		nodeName    string
+		expectedErr bool
+	}{
+		{
+			name:     "node",
+			ctx:      ctx,
+			kubeID:   "kube",
+			nodeName: "node-1",
+		},
+		{
+			name:     "master",
+			ctx:      ctx,
+			kubeID:   "kube",
+			nodeName: "master-1",
+		},
+		{
+			name:        "unknown node",
+			ctx:         ctx,
+			kubeID:      "kube",
+			nodeName:    "node-2",
+			expectedErr: true,
+		},
+		{
+			name:        "other tenant",
+			ctx:         context.Background(),
+			kubeID:      "kube",
+			nodeName:    "node-1",
+			expectedErr: true,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), testKubes(), time.Hour)
+
+		cert, err := svc.Issue(tc.ctx, tc.kubeID, tc.nodeName)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		if tc.expectedErr {
+			require.True(t, sgerrors.IsNotFound(err), "TC: %s", tc.name)
+			continue
+		}
+
+		ca, err := svc.CA(tc.ctx)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, ca.Cert, cert.CA, "TC: %s", tc.name)
+		require.True(t, cert.RenewAfter.Before(cert.NotAfter), "TC: %s", tc.name)
+
+		x509Cert := parseCert(t, cert.Cert)
+		require.NoError(t, x509Cert.CheckSignatureFrom(parseCert(t, ca.Cert)), "TC: %s", tc.name)
+		require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, x509Cert.ExtKeyUsage, "TC: %s", tc.name)
+
+		id, err := IdentityOf(x509Cert)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, Identity{TenantID: "acme", KubeID: tc.kubeID, NodeName: tc.nodeName}, *id, "TC: %s", tc.name)
+
+		renewed, err := svc.Renew(context.Background(), *id)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.NotEqual(t, cert.Key, renewed.Key, "TC: %s", tc.name)
+	}
+}
+
+func TestIdentityOf(t *testing.T) {
+	for _, tc := range []struct {
+		commonName  string
+		expected    *Identity
+		expectedErr bool
+	}{
+		{
+			commonName: "agent:kube:node-1",
+			expected:   &Identity{KubeID: "kube", NodeName: "node-1"},
+		},
+		{
+			commonName:  "kubernetes-admin",
+			expectedErr: true,
+		},
+		{
+			commonName:  "agent:kube",
+			expectedErr: true,
+		},
+		{
+			commonName:  "agent::node-1",
+			expectedErr: true,
+		},
+	} {
+		cert := &x509.Certificate{}
+		cert.Subject.CommonName = tc.commonName
+
+		id, err := IdentityOf(cert)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s", tc.commonName)
+		require.Equal(t, tc.expected, id, "TC: %s", tc.commonName)
+	}
+}
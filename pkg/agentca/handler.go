@@ -0,0 +1,130 @@
+package agentca
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+type identityKey struct{}
+
+// IdentityFromContext returns the node of the agent that made the request.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+type Servicer interface {
+	CA(ctx context.Context) (*pki.PairPEM, error)
+	Issue(ctx context.Context, kubeID, nodeName string) (*Certificate, error)
+	Renew(ctx context.Context, id Identity) (*Certificate, error)
+}
+
+// Handler issues certificates of agents through the api and renews
+// them through the endpoint of agents.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds handlers of the api to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/agentca", h.getCA).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}/agentcert", h.issue).Methods(http.MethodPost)
+}
+
+// RegisterAgent adds handlers of the agent endpoint to a router, the router
+// must be served with the TLS config of the service.
+func (h *Handler) RegisterAgent(r *mux.Router) {
+	r.Use(Authenticate)
+	r.HandleFunc("/agent/certificate", h.renew).Methods(http.MethodPost)
+}
+
+// Authenticate passes requests of agents that presented a certificate issued
+// by the CA and puts the node of the agent to the request context.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			http.Error(w, "client certificate is required", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := IdentityOf(r.TLS.VerifiedChains[0][0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// getCA returns the certificate agents verify the endpoint with.
+func (h *Handler) getCA(w http.ResponseWriter, r *http.Request) {
+	ca, err := h.svc.CA(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	if _, err = w.Write(ca.Cert); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// issue creates the first certificate of an agent, it is put on the node
+// when the agent is installed.
+func (h *Handler) issue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	cert, err := h.svc.Issue(r.Context(), vars["kubeID"], vars["nodename"])
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, vars["nodename"], err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(cert); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) renew(w http.ResponseWriter, r *http.Request) {
+	id, ok := IdentityFromContext(r.Context())
+	if !ok {
+		message.SendUnknownError(w, errors.New("agent identity is missing"))
+		return
+	}
+
+	cert, err := h.svc.Renew(r.Context(), *id)
+	if err != nil {
+		// the node has been removed from the cluster
+		if sgerrors.IsNotFound(err) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(cert); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,115 @@
+package agentca
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func TestHandler_issue(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), testKubes(), time.Hour)
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	for _, tc := range []struct {
+		name         string
+		url          string
+		expectedCode int
+	}{
+		{
+			name:         "node",
+			url:          "/kubes/kube/nodes/node-1/agentcert",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unknown node",
+			url:          "/kubes/kube/nodes/node-2/agentcert",
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.url, nil)
+		req = req.WithContext(tenant.WithID(req.Context(), "acme"))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+
+		if tc.expectedCode == http.StatusOK {
+			cert := Certificate{}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&cert), "TC: %s", tc.name)
+			require.Equal(t, "node-1", cert.NodeName, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_renew(t *testing.T) {
+	kubes := testKubes()
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes, time.Hour)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	tlsConfig, err := svc.TLSConfig(ctx, []string{"localhost"})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	NewHandler(svc).RegisterAgent(router)
+	srv := httptest.NewUnstartedServer(router)
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	ca, err := svc.CA(ctx)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(ca.Cert))
+
+	issued, err := svc.Issue(ctx, "kube", "node-1")
+	require.NoError(t, err)
+	agentCert, err := tls.X509KeyPair(issued.Cert, issued.Key)
+	require.NoError(t, err)
+
+	post := func(certs []tls.Certificate) (int, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+			// test servers have their own certificate that is served without sni
+			ServerName: "localhost",
+		}}}
+		resp, err := client.Post(srv.URL+"/agent/certificate", "application/json", nil)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			renewed := Certificate{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&renewed))
+			require.Equal(t, "kube", renewed.KubeID)
+			require.Equal(t, "node-1", renewed.NodeName)
+		}
+		return resp.StatusCode, nil
+	}
+
+	code, err := post([]tls.Certificate{agentCert})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	// the handshake fails without a client certificate
+	_, err = post(nil)
+	require.Error(t, err)
+
+	// agents of removed nodes can't renew
+	delete(kubes["acme/kube"].Nodes, "node-1")
+	code, err = post([]tls.Certificate{agentCert})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, code)
+}
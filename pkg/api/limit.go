@@ -0,0 +1,108 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	DefaultMaxRequestSize int64 = 1 << 20
+	DefaultMaxUploadSize  int64 = 32 << 20
+)
+
+// BodyLimit refuses requests with bodies bigger than the limit, routes that
+// accept big payloads, e.g. chart values, have a separate limit.
+type BodyLimit struct {
+	max       int64
+	maxUpload int64
+	// uploads are suffixes of route templates, e.g. /kubes/{kubeID}/releases
+	uploads []string
+}
+
+// NewBodyLimit constructs a BodyLimit, zero limits are replaced with defaults.
+func NewBodyLimit(max, maxUpload int64, uploads ...string) *BodyLimit {
+	if max <= 0 {
+		max = DefaultMaxRequestSize
+	}
+	if maxUpload <= 0 {
+		maxUpload = DefaultMaxUploadSize
+	}
+	return &BodyLimit{
+		max:       max,
+		maxUpload: maxUpload,
+		uploads:   uploads,
+	}
+}
+
+// Limit answers requests that declare a bigger body with 413 right away, bodies
+// of unknown length are cut at the limit and fail to decode with ErrRequestTooLarge.
+func (l *BodyLimit) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		max := l.limit(r)
+		if r.ContentLength > max {
+			message.SendRequestTooLarge(w, errors.Wrapf(sgerrors.ErrRequestTooLarge,
+				"%d bytes, the limit is %d", r.ContentLength, max))
+			return
+		}
+
+		r.Body = &limitedBody{
+			ReadCloser: r.Body,
+			max:        max,
+			left:       max,
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *BodyLimit) limit(r *http.Request) int64 {
+	tpl := route(r)
+	for _, suffix := range l.uploads {
+		if strings.HasSuffix(tpl, suffix) {
+			return l.maxUpload
+		}
+	}
+	return l.max
+}
+
+// limitedBody is like http.MaxBytesReader, but its error can be told apart
+// from broken payloads.
+type limitedBody struct {
+	io.ReadCloser
+	max  int64
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, b.err()
+	}
+	// one extra byte tells a body of exactly max bytes from a bigger one
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.left {
+		b.left -= int64(n)
+		return n, err
+	}
+
+	n = int(b.left)
+	b.left = -1
+	return n, b.err()
+}
+
+func (b *limitedBody) err() error {
+	return errors.Wrapf(sgerrors.ErrRequestTooLarge, "the limit is %d bytes", b.max)
+}
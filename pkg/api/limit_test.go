@@ -0,0 +1,78 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/message"
+)
+
+func TestBodyLimit(t *testing.T) {
+	read := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	router := mux.NewRouter()
+	router.Use(NewBodyLimit(8, 16, "/kubes/{kubeID}/releases").Limit)
+	router.HandleFunc("/kubes", read)
+	router.HandleFunc("/kubes/{kubeID}/releases", read)
+
+	for _, tc := range []struct {
+		name          string
+		url           string
+		body          string
+		unknownLength bool
+		expectedCode  int
+	}{
+		{
+			name:         "small",
+			url:          "/kubes",
+			body:         "12345678",
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "declared length",
+			url:          "/kubes",
+			body:         "123456789",
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "unknown length",
+			url:           "/kubes",
+			body:          "123456789",
+			unknownLength: true,
+			expectedCode:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "upload",
+			url:          "/kubes/test/releases",
+			body:         strings.Repeat("1", 16),
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:          "big upload",
+			url:           "/kubes/test/releases",
+			body:          strings.Repeat("1", 17),
+			unknownLength: true,
+			expectedCode:  http.StatusRequestEntityTooLarge,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+		if tc.unknownLength {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
@@ -1,20 +1,74 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
 
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
 )
 
+// SessionCookie keeps a token of pages that are served by control, e.g. cluster
+// dashboards, the cookie is limited to their paths.
+const SessionCookie = "sg_session"
+
+// sessionPath matches paths of pages that accept SessionCookie, the cookie is
+// ignored on other routes, so pages of clusters can't call the api with it.
+var sessionPath = regexp.MustCompile(`/kubes/[^/]+/dashboard(/|$)`)
+
 type TokenValidater interface {
 	Validate(string) (jwt.MapClaims, error)
 }
 
+// SessionChecker refuses tokens of sessions that are revoked or expired.
+type SessionChecker interface {
+	Check(ctx context.Context, sessionID string) error
+}
+
+// RoleResolver returns permissions of token accesses.
+type RoleResolver interface {
+	Resolve(ctx context.Context, accesses []string) (permission.Set, error)
+}
+
+type userKey struct{}
+
+type sessionKey struct{}
+
+// AdminAccess is an access of tokens issued to admins.
+const AdminAccess = "admin"
+
+// UserFromContext returns an id of the authenticated user of the request.
+func UserFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// IsAdmin reports whether the request token is an admin one, tokens issued
+// before accesses were checked are not limited and are admin ones too.
+func IsAdmin(ctx context.Context) bool {
+	return permission.IsAdmin(ctx)
+}
+
+// SessionFromContext returns an id of the session of the request token,
+// it is empty for tokens issued without a session.
+func SessionFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
 type Middleware struct {
 	TokenService TokenValidater
+	// Sessions checks tokens of sessions when it is set, tokens issued
+	// without a session are valid until they expire.
+	Sessions SessionChecker
+	// Roles resolves roles of tokens, built-in roles are used when it is not set.
+	Roles RoleResolver
 }
 
 func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
@@ -26,6 +80,10 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 		if authHeader == "" {
 			// this is for websocket
 			tokenString = r.URL.Query().Get("token")
+			if cookie, err := r.Cookie(SessionCookie); tokenString == "" && err == nil &&
+				sessionPath.MatchString(r.URL.Path) {
+				tokenString = cookie.Value
+			}
 		} else {
 			if ts := strings.Split(authHeader, " "); len(ts) <= 1 {
 				http.Error(w, sgerrors.ErrInvalidCredentials.Error(), http.StatusForbidden)
@@ -53,10 +111,78 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// tokens issued before tenants were introduced belong to the default one
+		tenantId, _ := claims["tenant_id"].(string)
+		if err := tenant.ValidateID(tenantId); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey{}, userId)
+		if sessionId, _ := claims["session_id"].(string); sessionId != "" && m.Sessions != nil {
+			if err := m.Sessions.Check(r.Context(), sessionId); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			ctx = context.WithValue(ctx, sessionKey{}, sessionId)
+		}
+
+		set, err := m.permissions(r.Context(), claims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if required := permission.Required(r.Method, route(r)); !set.Allows(required) {
+			http.Error(w, "token has no permission "+required, http.StatusForbidden)
+			return
+		}
+		ctx = permission.WithSet(ctx, set)
+		ctx = permission.WithAdmin(ctx, isAdmin(claims))
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(ctx, tenantId)))
 	})
 }
 
+// permissions returns permissions of the token, tokens are always issued
+// with accesses, so ones without them are allowed nothing.
+func (m *Middleware) permissions(ctx context.Context, claims jwt.MapClaims) (permission.Set, error) {
+	raw, ok := claims["accesses"].([]interface{})
+	if !ok {
+		return permission.Set{}, nil
+	}
+
+	accesses := make([]string, 0, len(raw))
+	for _, a := range raw {
+		if s, ok := a.(string); ok {
+			accesses = append(accesses, s)
+		}
+	}
+	if m.Roles == nil {
+		return permission.Builtin(accesses), nil
+	}
+	return m.Roles.Resolve(ctx, accesses)
+}
+
+func isAdmin(claims jwt.MapClaims) bool {
+	raw, _ := claims["accesses"].([]interface{})
+	for _, a := range raw {
+		if a == AdminAccess {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns a template of the matched route, e.g. /v1/api/kubes/{kubeID}.
+func route(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tpl, err := current.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
 func ContentTypeJSON(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
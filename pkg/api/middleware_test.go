@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -21,6 +23,8 @@ func TestAuthMiddleware(t *testing.T) {
 		expectedCode int
 		authHeader   string
 		query        string
+		path         string
+		cookie       bool
 		userId       string
 		issuer       func(string) (string, error)
 	}{
@@ -32,7 +36,7 @@ func TestAuthMiddleware(t *testing.T) {
 			userId:       "login",
 			issuer: func(userId string) (string, error) {
 				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-					"accesses":   []string{"edit", "view"},
+					"accesses":   []string{"admin", "edit", "view"},
 					"user_id":    userId,
 					"issued_at":  time.Now().Unix(),
 					"expires_at": time.Now().Unix() + 600,
@@ -55,7 +59,7 @@ func TestAuthMiddleware(t *testing.T) {
 			query:        "/url?token=%s",
 			issuer: func(userId string) (string, error) {
 				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-					"accesses":   []string{"edit", "view"},
+					"accesses":   []string{"admin", "edit", "view"},
 					"user_id":    userId,
 					"issued_at":  time.Now().Unix(),
 					"expires_at": time.Now().Unix() + 600,
@@ -70,6 +74,42 @@ func TestAuthMiddleware(t *testing.T) {
 				return tokenString, nil
 			},
 		},
+		{
+			description:  "token from cookie",
+			err:          nil,
+			expectedCode: http.StatusOK,
+			userId:       "login",
+			path:         "/v1/api/kubes/kube/dashboard/",
+			cookie:       true,
+			issuer: func(userId string) (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+					"accesses":   []string{"admin", "edit", "view"},
+					"user_id":    userId,
+					"issued_at":  time.Now().Unix(),
+					"expires_at": time.Now().Unix() + 600,
+				})
+
+				return token.SignedString([]byte("secret"))
+			},
+		},
+		{
+			description:  "token from cookie of other routes",
+			err:          nil,
+			expectedCode: http.StatusForbidden,
+			userId:       "login",
+			path:         "/v1/api/kubes/kube",
+			cookie:       true,
+			issuer: func(userId string) (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+					"accesses":   []string{"admin", "edit", "view"},
+					"user_id":    userId,
+					"issued_at":  time.Now().Unix(),
+					"expires_at": time.Now().Unix() + 600,
+				})
+
+				return token.SignedString([]byte("secret"))
+			},
+		},
 		{
 			description:  "token expired",
 			err:          nil,
@@ -78,7 +118,7 @@ func TestAuthMiddleware(t *testing.T) {
 			userId:       "",
 			issuer: func(userId string) (string, error) {
 				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-					"accesses":   []string{"edit", "view"},
+					"accesses":   []string{"admin", "edit", "view"},
 					"user_id":    userId,
 					"issued_at":  time.Now().Unix() - 2,
 					"expires_at": time.Now().Unix() - 1,
@@ -100,7 +140,7 @@ func TestAuthMiddleware(t *testing.T) {
 			authHeader:   "Bearer %s",
 			issuer: func(userId string) (string, error) {
 				token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-					"accesses":   []string{"edit", "view"},
+					"accesses":   []string{"admin", "edit", "view"},
 					"user_id":    userId,
 					"issued_at":  time.Now().Unix(),
 					"expires_at": time.Now().Unix() + 60,
@@ -162,7 +202,7 @@ func TestAuthMiddleware(t *testing.T) {
 		t.Log(testCase.description)
 		tokenString, _ := testCase.issuer(testCase.userId)
 
-		url := ""
+		url := testCase.path
 
 		if testCase.query != "" {
 			url = fmt.Sprintf(testCase.query, tokenString)
@@ -176,6 +216,10 @@ func TestAuthMiddleware(t *testing.T) {
 				fmt.Sprintf(testCase.authHeader, tokenString))
 		}
 
+		if testCase.cookie {
+			req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tokenString})
+		}
+
 		if err != nil {
 			t.Error(err)
 		}
@@ -185,6 +229,9 @@ func TestAuthMiddleware(t *testing.T) {
 		}
 
 		md.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := UserFromContext(r.Context()); user != testCase.userId {
+				t.Errorf("Wrong user expected %s actual %s", testCase.userId, user)
+			}
 			w.WriteHeader(http.StatusOK)
 		})).ServeHTTP(rec, req)
 
@@ -195,6 +242,166 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestAuthMiddlewareAccesses(t *testing.T) {
+	ts := sgjwt.NewTokenService(60, []byte("secret"))
+	viewer, _ := ts.IssueWithAccesses("viewer", "", []string{"view"})
+	editor, _ := ts.IssueWithTenant("editor", "")
+	noAccesses, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"user_id":    "admin",
+		"issued_at":  time.Now().Unix(),
+		"expires_at": time.Now().Unix() + 600,
+	}).SignedString([]byte("secret"))
+
+	for _, testCase := range []struct {
+		token        string
+		method       string
+		expectedCode int
+	}{
+		{viewer, http.MethodGet, http.StatusOK},
+		{viewer, http.MethodPost, http.StatusForbidden},
+		{viewer, http.MethodDelete, http.StatusForbidden},
+		{editor, http.MethodDelete, http.StatusOK},
+		{noAccesses, http.MethodGet, http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(testCase.method, "/kubes", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.token)
+
+		md := Middleware{
+			TokenService: ts,
+		}
+		md.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rec, req)
+
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("Wrong response code of %s expected %d actual %d",
+				testCase.method, testCase.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewarePermissions(t *testing.T) {
+	ts := sgjwt.NewTokenService(60, []byte("secret"))
+	deployer, _ := ts.IssueWithAccesses("ci", "", []string{"kube:read", "release:install"})
+	viewer, _ := ts.IssueWithAccesses("viewer", "", []string{"view"})
+
+	router := mux.NewRouter()
+	md := Middleware{
+		TokenService: ts,
+	}
+	router.Use(md.AuthMiddleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/v1/api/kubes/{kubeID}", ok).Methods(http.MethodGet, http.MethodDelete)
+	router.HandleFunc("/v1/api/kubes/{kubeID}/releases", ok).Methods(http.MethodPost)
+	router.HandleFunc("/v1/api/kubes/{kubeID}/users/{uname}/kubeconfig", ok).Methods(http.MethodGet)
+
+	for _, testCase := range []struct {
+		token        string
+		method       string
+		url          string
+		expectedCode int
+	}{
+		{deployer, http.MethodGet, "/v1/api/kubes/test", http.StatusOK},
+		{deployer, http.MethodPost, "/v1/api/kubes/test/releases", http.StatusOK},
+		{deployer, http.MethodDelete, "/v1/api/kubes/test", http.StatusForbidden},
+		{deployer, http.MethodGet, "/v1/api/kubes/test/users/admin/kubeconfig", http.StatusForbidden},
+		{viewer, http.MethodGet, "/v1/api/kubes/test/users/admin/kubeconfig", http.StatusForbidden},
+		{viewer, http.MethodGet, "/v1/api/kubes/test", http.StatusOK},
+		{viewer, http.MethodPost, "/v1/api/kubes/test/releases", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(testCase.method, testCase.url, nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.token)
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("Wrong response code of %s %s expected %d actual %d",
+				testCase.method, testCase.url, testCase.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareAdmin(t *testing.T) {
+	ts := sgjwt.NewTokenService(60, []byte("secret"))
+	admin, _ := ts.IssueWithAccesses("admin", "", []string{"admin", "edit", "view"})
+	editor, _ := ts.IssueWithAccesses("editor", "", []string{"edit", "view"})
+	noAccesses, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"user_id":    "admin",
+		"issued_at":  time.Now().Unix(),
+		"expires_at": time.Now().Unix() + 600,
+	}).SignedString([]byte("secret"))
+
+	for _, testCase := range []struct {
+		token    string
+		expected bool
+	}{
+		{admin, true},
+		{editor, false},
+		{noAccesses, false},
+	} {
+		var actual bool
+		md := Middleware{
+			TokenService: ts,
+		}
+		req := httptest.NewRequest(http.MethodGet, "/kubes", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.token)
+		md.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = IsAdmin(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		if actual != testCase.expected {
+			t.Errorf("Wrong admin of token expected %v actual %v", testCase.expected, actual)
+		}
+	}
+}
+
+type fakeSessions map[string]bool
+
+func (f fakeSessions) Check(ctx context.Context, sessionID string) error {
+	if !f[sessionID] {
+		return errors.New("session is revoked")
+	}
+	return nil
+}
+
+func TestAuthMiddlewareSessions(t *testing.T) {
+	ts := sgjwt.NewTokenService(60, []byte("secret"))
+	active, _ := ts.IssueForSession("user", "", "active", []string{"edit", "view"}, time.Now().Add(time.Hour))
+	revoked, _ := ts.IssueForSession("user", "", "revoked", []string{"edit", "view"}, time.Now().Add(time.Hour))
+	legacy, _ := ts.IssueWithTenant("user", "")
+
+	for _, testCase := range []struct {
+		token           string
+		expectedCode    int
+		expectedSession string
+	}{
+		{active, http.StatusOK, "active"},
+		{revoked, http.StatusForbidden, ""},
+		{legacy, http.StatusOK, ""},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/kubes", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.token)
+
+		md := Middleware{
+			TokenService: ts,
+			Sessions:     fakeSessions{"active": true},
+		}
+		md.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := SessionFromContext(r.Context()); id != testCase.expectedSession {
+				t.Errorf("Wrong session expected %s actual %s", testCase.expectedSession, id)
+			}
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rec, req)
+
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("Wrong response code of session %s expected %d actual %d",
+				testCase.expectedSession, testCase.expectedCode, rec.Code)
+		}
+	}
+}
+
 type testHandler struct {
 	called bool
 }
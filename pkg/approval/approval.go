@@ -0,0 +1,292 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const DefaultStoragePrefix = "/supergiant/approvals/"
+
+const (
+	policyPrefix = "/supergiant/approvalpolicy/"
+	policyKey    = "policy"
+)
+
+const (
+	// ActionDeleteCluster is a deletion of the whole cluster
+	ActionDeleteCluster = "cluster.delete"
+	// ActionDownscale is a deletion of a node that leaves the cluster
+	// with less than Policy.MinNodes nodes
+	ActionDownscale = "node.delete"
+	// ActionPurgeRelease is a deletion of a release along with its history
+	ActionPurgeRelease = "release.purge"
+)
+
+const (
+	StatePending  = "pending"
+	StateApproved = "approved"
+	StateRejected = "rejected"
+	StateExecuted = "executed"
+	StateFailed   = "failed"
+)
+
+var (
+	ErrSelfApproval = errors.New("operation must be approved by another user")
+	ErrDecided      = errors.New("approval has already been decided")
+	ErrUnknown      = errors.New("unknown action")
+)
+
+var actions = map[string]bool{
+	ActionDeleteCluster: true,
+	ActionDownscale:     true,
+	ActionPurgeRelease:  true,
+}
+
+// Policy configures which operations of the tenant require approval.
+type Policy struct {
+	Enabled bool     `json:"enabled"`
+	Actions []string `json:"actions"`
+	// MinNodes is a number of worker nodes the cluster can be downscaled
+	// to without approval.
+	MinNodes int `json:"minNodes"`
+}
+
+// Requires reports whether the action must be approved.
+func (p Policy) Requires(action string) bool {
+	if !p.Enabled {
+		return false
+	}
+	for _, a := range p.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) validate() error {
+	for _, a := range p.Actions {
+		if !actions[a] {
+			return errors.Wrap(ErrUnknown, a)
+		}
+	}
+	if p.MinNodes < 0 {
+		return errors.New("min nodes must not be negative")
+	}
+	return nil
+}
+
+// Approval is a destructive operation held until another user approves it,
+// the api call is replayed on behalf of the approver then.
+type Approval struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	KubeID string `json:"kubeId"`
+	Target string `json:"target,omitempty"`
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+
+	Method string `json:"method"`
+	URI    string `json:"uri"`
+	Body   []byte `json:"body,omitempty"`
+
+	RequestedBy string    `json:"requestedBy"`
+	DecidedBy   string    `json:"decidedBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	DecidedAt   time.Time `json:"decidedAt,omitempty"`
+	// Code is a status code of the replayed api call
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Service keeps approval policies and pending operations of tenants.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	// operations are decided on the leader only
+	m sync.Mutex
+}
+
+// NewService constructs a Service, the storage must be a tenant one.
+func NewService(prefix string, s storage.Interface) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+	}
+}
+
+// Policy returns an approval policy of the tenant, approvals are disabled
+// unless configured.
+func (s *Service) Policy(ctx context.Context) (*Policy, error) {
+	data, err := s.storage.Get(ctx, policyPrefix, policyKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return &Policy{}, nil
+		}
+		return nil, errors.Wrap(err, "get approval policy")
+	}
+
+	p := new(Policy)
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, errors.Wrap(err, "decode approval policy")
+	}
+
+	return p, nil
+}
+
+// SetPolicy replaces the approval policy of the tenant.
+func (s *Service) SetPolicy(ctx context.Context, p *Policy) error {
+	if err := p.validate(); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "encode approval policy")
+	}
+
+	return errors.Wrap(s.storage.Put(ctx, policyPrefix, policyKey, data), "save approval policy")
+}
+
+// Request holds the operation until it is approved, a pending approval of
+// the same operation is returned instead of a new one.
+func (s *Service) Request(ctx context.Context, a *Approval) (*Approval, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	list, err := s.List(ctx, a.KubeID, StatePending)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Action == a.Action && list[i].Target == a.Target {
+			return &list[i], nil
+		}
+	}
+
+	a.ID = uuid.New()[:8]
+	a.State = StatePending
+	a.CreatedAt = time.Now()
+	if err = s.save(ctx, a); err != nil {
+		return nil, err
+	}
+	logrus.Infof("approval: %s %s of cluster %s requested by %s",
+		a.ID, a.Action, a.KubeID, a.RequestedBy)
+
+	return a, nil
+}
+
+// Get returns the approval.
+func (s *Service) Get(ctx context.Context, id string) (*Approval, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get approval %s", id)
+	}
+
+	a := new(Approval)
+	if err = json.Unmarshal(data, a); err != nil {
+		return nil, errors.Wrapf(err, "decode approval %s", id)
+	}
+
+	return a, nil
+}
+
+// List returns approvals of the cluster in the state, the latest go first.
+// Empty arguments match any.
+func (s *Service) List(ctx context.Context, kubeID, state string) ([]Approval, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list approvals")
+	}
+
+	list := make([]Approval, 0, len(raw))
+	for _, data := range raw {
+		a := Approval{}
+		if err = json.Unmarshal(data, &a); err != nil {
+			logrus.Warnf("approval: skip corrupted record: %v", err)
+			continue
+		}
+		if kubeID != "" && a.KubeID != kubeID || state != "" && a.State != state {
+			continue
+		}
+		list = append(list, a)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// Approve marks the pending operation approved, the caller executes it
+// and reports the result with Done.
+func (s *Service) Approve(ctx context.Context, id, user string) (*Approval, error) {
+	return s.decide(ctx, id, user, StateApproved, "")
+}
+
+// Reject cancels the pending operation.
+func (s *Service) Reject(ctx context.Context, id, user, reason string) (*Approval, error) {
+	return s.decide(ctx, id, user, StateRejected, reason)
+}
+
+// Done records a status code of the executed operation.
+func (s *Service) Done(ctx context.Context, a *Approval, code int, errMsg string) error {
+	a.Code = code
+	a.State = StateExecuted
+	if code >= 400 {
+		a.State = StateFailed
+		a.Error = errMsg
+	}
+
+	return s.save(ctx, a)
+}
+
+func (s *Service) decide(ctx context.Context, id, user, state, reason string) (*Approval, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	a, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a.State != StatePending {
+		return nil, errors.Wrapf(ErrDecided, "approval %s is %s", id, a.State)
+	}
+	// requesters may withdraw their operations but not approve them
+	if state == StateApproved && a.RequestedBy == user {
+		return nil, ErrSelfApproval
+	}
+
+	a.State = state
+	a.Reason = reason
+	a.DecidedBy = user
+	a.DecidedAt = time.Now()
+	if err = s.save(ctx, a); err != nil {
+		return nil, err
+	}
+	logrus.Infof("approval: %s %s of cluster %s %s by %s",
+		a.ID, a.Action, a.KubeID, state, user)
+
+	return a, nil
+}
+
+func (s *Service) save(ctx context.Context, a *Approval) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrapf(err, "encode approval %s", a.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, a.ID, data), "save approval %s", a.ID)
+}
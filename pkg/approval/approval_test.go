@@ -0,0 +1,107 @@
+package approval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func TestPolicy_Requires(t *testing.T) {
+	p := Policy{Actions: []string{ActionDeleteCluster}}
+	require.False(t, p.Requires(ActionDeleteCluster), "disabled policy")
+
+	p.Enabled = true
+	require.True(t, p.Requires(ActionDeleteCluster))
+	require.False(t, p.Requires(ActionPurgeRelease))
+}
+
+func TestService_SetPolicy(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	p, err := svc.Policy(context.Background())
+	require.NoError(t, err)
+	require.False(t, p.Enabled)
+
+	err = svc.SetPolicy(context.Background(), &Policy{Enabled: true, Actions: []string{"cluster.scale"}})
+	require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err))
+	err = svc.SetPolicy(context.Background(), &Policy{Enabled: true, MinNodes: -1})
+	require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err))
+
+	require.NoError(t, svc.SetPolicy(context.Background(), &Policy{
+		Enabled:  true,
+		Actions:  []string{ActionDownscale},
+		MinNodes: 3,
+	}))
+	p, err = svc.Policy(context.Background())
+	require.NoError(t, err)
+	require.True(t, p.Requires(ActionDownscale))
+	require.Equal(t, 3, p.MinNodes)
+}
+
+func TestService_Decide(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	ctx := context.Background()
+
+	a, err := svc.Request(ctx, &Approval{
+		Action:      ActionDeleteCluster,
+		KubeID:      "kube",
+		Target:      "kube",
+		RequestedBy: "alice",
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatePending, a.State)
+
+	same, err := svc.Request(ctx, &Approval{
+		Action:      ActionDeleteCluster,
+		KubeID:      "kube",
+		Target:      "kube",
+		RequestedBy: "bob",
+	})
+	require.NoError(t, err)
+	require.Equal(t, a.ID, same.ID, "pending approvals must not be duplicated")
+
+	other, err := svc.Request(ctx, &Approval{
+		Action:      ActionPurgeRelease,
+		KubeID:      "kube",
+		Target:      "ingress",
+		RequestedBy: "alice",
+	})
+	require.NoError(t, err)
+
+	list, err := svc.List(ctx, "kube", StatePending)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	_, err = svc.Approve(ctx, a.ID, "alice")
+	require.Equal(t, ErrSelfApproval, errors.Cause(err))
+
+	approved, err := svc.Approve(ctx, a.ID, "bob")
+	require.NoError(t, err)
+	require.Equal(t, StateApproved, approved.State)
+	require.Equal(t, "bob", approved.DecidedBy)
+
+	_, err = svc.Reject(ctx, a.ID, "bob", "")
+	require.Equal(t, ErrDecided, errors.Cause(err))
+
+	require.NoError(t, svc.Done(ctx, approved, 409, "busy"))
+	got, err := svc.Get(ctx, a.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, got.State)
+	require.Equal(t, "busy", got.Error)
+
+	rejected, err := svc.Reject(ctx, other.ID, "alice", "wrong release")
+	require.NoError(t, err, "requesters can withdraw operations")
+	require.Equal(t, StateRejected, rejected.State)
+
+	list, err = svc.List(ctx, "", StatePending)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	_, err = svc.Approve(ctx, "missing", "bob")
+	require.True(t, sgerrors.IsNotFound(err))
+}
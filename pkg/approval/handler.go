@@ -0,0 +1,336 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const kubeRoute = "/kubes/{kubeID}"
+
+// approvedKey marks replayed calls, they can't be forged with http requests.
+type approvedKey struct{}
+
+// Servicer is an interface of the approval service.
+type Servicer interface {
+	Policy(ctx context.Context) (*Policy, error)
+	SetPolicy(ctx context.Context, p *Policy) error
+	Request(ctx context.Context, a *Approval) (*Approval, error)
+	Get(ctx context.Context, id string) (*Approval, error)
+	List(ctx context.Context, kubeID, state string) ([]Approval, error)
+	Approve(ctx context.Context, id, user string) (*Approval, error)
+	Reject(ctx context.Context, id, user, reason string) (*Approval, error)
+	Done(ctx context.Context, a *Approval, code int, errMsg string) error
+}
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+// RejectRequest explains why the operation is rejected.
+type RejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Handler holds destructive api calls until they are approved and replays
+// them through the api router afterwards.
+type Handler struct {
+	svc   Servicer
+	kubes kubeGetter
+	api   http.Handler
+}
+
+// NewHandler constructs a Handler, approved calls are replayed with apiRouter.
+func NewHandler(svc Servicer, kubes kubeGetter, apiRouter http.Handler) *Handler {
+	return &Handler{
+		svc:   svc,
+		kubes: kubes,
+		api:   apiRouter,
+	}
+}
+
+// Register adds approval handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/approvals/policy", h.getPolicy).Methods(http.MethodGet)
+	r.HandleFunc("/approvals/policy", h.setPolicy).Methods(http.MethodPut)
+	r.HandleFunc("/approvals", h.listApprovals).Methods(http.MethodGet)
+	r.HandleFunc("/approvals/{id}", h.getApproval).Methods(http.MethodGet)
+	r.HandleFunc("/approvals/{id}/approve", h.approve).Methods(http.MethodPost)
+	r.HandleFunc("/approvals/{id}/reject", h.reject).Methods(http.MethodPost)
+}
+
+// Gate answers destructive calls that the policy of the tenant requires
+// to be approved with 202 and a pending approval.
+func (h *Handler) Gate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(approvedKey{}) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action, target := destructiveAction(r)
+		if action == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		policy, err := h.svc.Policy(r.Context())
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+		if !policy.Requires(action) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		kubeID := mux.Vars(r)["kubeID"]
+		if action == ActionDownscale && !h.downscales(r.Context(), kubeID, target, policy.MinNodes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+
+		a, err := h.svc.Request(r.Context(), &Approval{
+			Action:      action,
+			KubeID:      kubeID,
+			Target:      target,
+			Method:      r.Method,
+			URI:         r.URL.RequestURI(),
+			Body:        body,
+			RequestedBy: api.UserFromContext(r.Context()),
+		})
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if err = json.NewEncoder(w).Encode(a); err != nil {
+			logrus.Errorf("approval: write response: %v", err)
+		}
+	})
+}
+
+// downscales reports whether deletion of the node leaves the cluster with
+// less than min nodes, unknown clusters and nodes are left to the api.
+func (h *Handler) downscales(ctx context.Context, kubeID, node string, min int) bool {
+	k, err := h.kubes.Get(ctx, kubeID)
+	if err != nil {
+		return false
+	}
+	if _, ok := k.Nodes[node]; !ok {
+		return false
+	}
+	return len(k.Nodes)-1 < min
+}
+
+func destructiveAction(r *http.Request) (string, string) {
+	if r.Method != http.MethodDelete {
+		return "", ""
+	}
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", ""
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return "", ""
+	}
+	i := strings.Index(tpl, kubeRoute)
+	if i < 0 {
+		return "", ""
+	}
+
+	vars := mux.Vars(r)
+	switch tpl[i+len(kubeRoute):] {
+	case "":
+		return ActionDeleteCluster, vars["kubeID"]
+	case "/nodes/{nodename}", "/machines/{nodename}":
+		return ActionDownscale, vars["nodename"]
+	case "/releases/{releaseName}":
+		if purge, _ := strconv.ParseBool(r.URL.Query().Get("purge")); purge {
+			return ActionPurgeRelease, vars["releaseName"]
+		}
+	}
+
+	return "", ""
+}
+
+func (h *Handler) getPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := h.svc.Policy(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// setPolicy changes the policy of the tenant, it is not gated itself, so
+// it is left to admins.
+func (h *Handler) setPolicy(w http.ResponseWriter, r *http.Request) {
+	if !api.IsAdmin(r.Context()) {
+		http.Error(w, "approval policy is managed by admins", http.StatusForbidden)
+		return
+	}
+
+	p := new(Policy)
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetPolicy(r.Context(), p); err != nil {
+		sendError(w, "policy", err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// listApprovals returns approvals of the tenant, e.g. pending ones of a cluster:
+// GET /approvals?kubeID=kube&state=pending
+func (h *Handler) listApprovals(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context(), r.URL.Query().Get("kubeID"), r.URL.Query().Get("state"))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getApproval(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	a, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		sendError(w, id, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(a); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// approve executes the held operation on behalf of the approver and
+// returns the approval with a status code of the operation.
+func (h *Handler) approve(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	a, err := h.svc.Approve(r.Context(), id, api.UserFromContext(r.Context()))
+	if err != nil {
+		sendError(w, id, err)
+		return
+	}
+
+	code, errMsg := h.replay(r, a)
+	if err = h.svc.Done(r.Context(), a, code, errMsg); err != nil {
+		logrus.Errorf("approval: %s: %v", id, err)
+	}
+
+	if err = json.NewEncoder(w).Encode(a); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	req := RejectRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+	}
+
+	a, err := h.svc.Reject(r.Context(), id, api.UserFromContext(r.Context()), req.Reason)
+	if err != nil {
+		sendError(w, id, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(a); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// replay runs the held api call with credentials of the approver.
+func (h *Handler) replay(r *http.Request, a *Approval) (int, string) {
+	ctx := context.WithValue(r.Context(), approvedKey{}, a.ID)
+	req, err := http.NewRequest(a.Method, a.URI, bytes.NewReader(a.Body))
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+	rec := &recorder{header: make(http.Header), code: http.StatusOK}
+	h.api.ServeHTTP(rec, req)
+	if rec.code >= http.StatusBadRequest {
+		logrus.Warnf("approval: %s: %s %s: %d %s", a.ID, a.Method, a.URI, rec.code, rec.body.String())
+	}
+
+	return rec.code, strings.TrimSpace(rec.body.String())
+}
+
+// recorder keeps a response of the replayed call.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.code = code
+}
+
+func sendError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case sgerrors.IsNotFound(err):
+		message.SendNotFound(w, id, err)
+	case errors.Cause(err) == ErrSelfApproval:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Cause(err) == ErrDecided:
+		message.SendAlreadyExists(w, id, err)
+	case errors.Cause(err) == sgerrors.ErrInvalidJson:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,186 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+// userTokens treats tokens as user ids, the editor isn't an admin.
+type userTokens struct{}
+
+func (userTokens) Validate(token string) (jwt.MapClaims, error) {
+	if token == "editor" {
+		return jwt.MapClaims{"user_id": token, "accesses": []interface{}{"edit", "view"}}, nil
+	}
+	return jwt.MapClaims{"user_id": token, "accesses": []interface{}{"admin", "edit", "view"}}, nil
+}
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, kubeID string) (*model.Kube, error) {
+	k, ok := f[kubeID]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+func do(router http.Handler, method, url, user string) *httptest.ResponseRecorder {
+	return doWithBody(router, method, url, user, "")
+}
+
+func doWithBody(router http.Handler, method, url, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+user)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Gate(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	require.NoError(t, svc.SetPolicy(context.Background(), &Policy{
+		Enabled:  true,
+		Actions:  []string{ActionDeleteCluster, ActionDownscale, ActionPurgeRelease},
+		MinNodes: 2,
+	}))
+
+	deleted := map[string]int{}
+	deleteFn := func(w http.ResponseWriter, r *http.Request) {
+		deleted[r.URL.Path]++
+	}
+
+	router := mux.NewRouter()
+	apiRouter := router.PathPrefix("/v1/api").Subrouter()
+	h := NewHandler(svc, fakeKubes{
+		"kube": {
+			ID: "kube",
+			Nodes: map[string]*model.Machine{
+				"node-1": {}, "node-2": {}, "node-3": {},
+			},
+		},
+	}, apiRouter)
+	h.Register(apiRouter)
+	apiRouter.HandleFunc("/kubes/{kubeID}", deleteFn).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/kubes/{kubeID}/nodes/{nodename}", deleteFn).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/kubes/{kubeID}/releases/{releaseName}", deleteFn).Methods(http.MethodDelete)
+	auth := api.Middleware{TokenService: userTokens{}}
+	apiRouter.Use(auth.AuthMiddleware, h.Gate)
+
+	for _, tc := range []struct {
+		url          string
+		expectedCode int
+	}{
+		{"/v1/api/kubes/kube/nodes/node-1", http.StatusOK},
+		{"/v1/api/kubes/kube/nodes/unknown", http.StatusOK},
+		{"/v1/api/kubes/kube/releases/ingress", http.StatusOK},
+		{"/v1/api/kubes/kube/releases/ingress?purge=true", http.StatusAccepted},
+		{"/v1/api/kubes/kube", http.StatusAccepted},
+	} {
+		rec := do(router, http.MethodDelete, tc.url, "alice")
+		require.Equal(t, tc.expectedCode, rec.Code, tc.url)
+	}
+	require.Zero(t, deleted["/v1/api/kubes/kube"])
+
+	rec := do(router, http.MethodGet, "/v1/api/approvals?kubeID=kube&state=pending", "bob")
+	require.Equal(t, http.StatusOK, rec.Code)
+	pending := []Approval{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&pending))
+	require.Len(t, pending, 2)
+
+	var clusterApproval, releaseApproval string
+	for _, a := range pending {
+		switch a.Action {
+		case ActionDeleteCluster:
+			clusterApproval = a.ID
+		case ActionPurgeRelease:
+			releaseApproval = a.ID
+		}
+	}
+
+	rec = do(router, http.MethodPost, "/v1/api/approvals/"+clusterApproval+"/approve", "alice")
+	require.Equal(t, http.StatusForbidden, rec.Code, "self approval")
+
+	rec = do(router, http.MethodPost, "/v1/api/approvals/"+clusterApproval+"/approve", "bob")
+	require.Equal(t, http.StatusOK, rec.Code)
+	a := Approval{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&a))
+	require.Equal(t, StateExecuted, a.State)
+	require.Equal(t, http.StatusOK, a.Code)
+	require.Equal(t, 1, deleted["/v1/api/kubes/kube"], "approved call must be replayed")
+
+	rec = do(router, http.MethodPost, "/v1/api/approvals/"+clusterApproval+"/approve", "carol")
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(router, http.MethodPost, "/v1/api/approvals/"+releaseApproval+"/reject", "bob")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, 1, deleted["/v1/api/kubes/kube/releases/ingress"], "rejected call must not be replayed")
+
+	rec = do(router, http.MethodGet, "/v1/api/approvals/missing", "bob")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_Gate_Downscale(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	require.NoError(t, svc.SetPolicy(context.Background(), &Policy{
+		Enabled:  true,
+		Actions:  []string{ActionDownscale},
+		MinNodes: 2,
+	}))
+
+	router := mux.NewRouter()
+	h := NewHandler(svc, fakeKubes{
+		"kube": {
+			ID:    "kube",
+			Nodes: map[string]*model.Machine{"node-1": {}, "node-2": {}},
+		},
+	}, router)
+	router.HandleFunc("/kubes/{kubeID}/machines/{nodename}", func(w http.ResponseWriter, r *http.Request) {}).
+		Methods(http.MethodDelete)
+	router.HandleFunc("/kubes/{kubeID}", func(w http.ResponseWriter, r *http.Request) {}).
+		Methods(http.MethodDelete)
+	auth := api.Middleware{TokenService: userTokens{}}
+	router.Use(auth.AuthMiddleware, h.Gate)
+
+	rec := do(router, http.MethodDelete, "/kubes/kube/machines/node-1", "alice")
+	require.Equal(t, http.StatusAccepted, rec.Code, "cluster is left with 1 node")
+
+	rec = do(router, http.MethodDelete, "/kubes/kube", "alice")
+	require.Equal(t, http.StatusOK, rec.Code, "cluster deletion is not gated")
+}
+
+func TestHandler_setPolicy(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	router := mux.NewRouter()
+	apiRouter := router.PathPrefix("/v1/api").Subrouter()
+	h := NewHandler(svc, fakeKubes{}, apiRouter)
+	h.Register(apiRouter)
+	auth := api.Middleware{TokenService: userTokens{}}
+	apiRouter.Use(auth.AuthMiddleware, h.Gate)
+
+	body := `{"enabled":true,"actions":["` + ActionDeleteCluster + `"]}`
+	rec := doWithBody(router, http.MethodPut, "/v1/api/approvals/policy", "editor", body)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	p, err := svc.Policy(context.Background())
+	require.NoError(t, err)
+	require.False(t, p.Enabled)
+
+	rec = doWithBody(router, http.MethodPut, "/v1/api/approvals/policy", "alice", body)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	p, err = svc.Policy(context.Background())
+	require.NoError(t, err)
+	require.True(t, p.Enabled)
+}
@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ChecksumPrefix names the hash of checksums of archives.
+	ChecksumPrefix = "sha256:"
+
+	magic       = "SGB1"
+	keySize     = 32
+	prefixSize  = 8
+	chunkSize   = 64 * 1024
+	maxKeyIDLen = 255
+)
+
+var (
+	ErrChecksum   = errors.New("checksum of the restored archive doesn't match")
+	ErrUnknownKey = errors.New("archive is encrypted with an unknown key")
+	ErrCorrupted  = errors.New("archive is corrupted or has been changed")
+)
+
+// Keys encrypt backup archives before they leave control, archives are
+// encrypted with the primary key. Other keys decrypt archives made
+// before the primary key was rotated.
+type Keys struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// ParseKeys returns keys by id, keys are 32 bytes encoded with base64.
+func ParseKeys(primary string, encoded map[string]string) (*Keys, error) {
+	k := &Keys{
+		primary: primary,
+		keys:    make(map[string][]byte, len(encoded)),
+	}
+	for id, value := range encoded {
+		if id == "" || len(id) > maxKeyIDLen {
+			return nil, errors.Errorf("key id %q must be 1-%d bytes", id, maxKeyIDLen)
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode key %s", id)
+		}
+		if len(key) != keySize {
+			return nil, errors.Errorf("key %s must be %d bytes", id, keySize)
+		}
+		k.keys[id] = key
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, errors.Errorf("primary key %s is not found", primary)
+	}
+	return k, nil
+}
+
+// GenerateKey returns a random key encoded with base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.Wrap(err, "generate key")
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Seal encrypts the archive from src to dst and returns the checksum of
+// the archive, it is kept with the backup and verified on restore.
+//
+// Archives are split into chunks, every chunk is authenticated along with
+// its position and whether it is the last one, so chunks can't be
+// reordered, replaced or cut off.
+func (k *Keys) Seal(dst io.Writer, src io.Reader) (string, error) {
+	header := make([]byte, 0, len(magic)+1+len(k.primary)+prefixSize)
+	header = append(header, magic...)
+	header = append(header, byte(len(k.primary)))
+	header = append(header, k.primary...)
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", errors.Wrap(err, "generate nonce")
+	}
+	header = append(header, prefix...)
+
+	aead, err := newAEAD(k.keys[k.primary])
+	if err != nil {
+		return "", err
+	}
+	if _, err = dst.Write(header); err != nil {
+		return "", errors.Wrap(err, "write header")
+	}
+
+	sum := sha256.New()
+	r := bufio.NewReaderSize(src, chunkSize)
+	buf := make([]byte, chunkSize)
+	length := make([]byte, 4)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", errors.Wrap(err, "read archive")
+		}
+		// the chunk is the last one when nothing follows it
+		_, err = r.Peek(1)
+		if err != nil && err != io.EOF {
+			return "", errors.Wrap(err, "read archive")
+		}
+		last := err == io.EOF
+
+		sum.Write(buf[:n])
+		sealed := aead.Seal(nil, nonce(prefix, counter), buf[:n], aad(header, last))
+		binary.BigEndian.PutUint32(length, uint32(len(sealed)))
+		if _, err = dst.Write(append(length, sealed...)); err != nil {
+			return "", errors.Wrap(err, "write archive")
+		}
+		if last {
+			break
+		}
+	}
+
+	return checksum(sum), nil
+}
+
+// Open decrypts the archive from src to dst and verifies its checksum,
+// the checksum isn't checked when it is empty. Chunks are written when
+// they are authenticated, dst must be discarded when an error is returned.
+func (k *Keys) Open(dst io.Writer, src io.Reader, expected string) error {
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(src, head); err != nil || string(head[:len(magic)]) != magic {
+		return ErrCorrupted
+	}
+	rest := make([]byte, int(head[len(magic)])+prefixSize)
+	if _, err := io.ReadFull(src, rest); err != nil {
+		return ErrCorrupted
+	}
+	header := append(head, rest...)
+	keyID := string(rest[:len(rest)-prefixSize])
+	prefix := rest[len(rest)-prefixSize:]
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return errors.Wrap(ErrUnknownKey, keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.New()
+	length := make([]byte, 4)
+	for counter := uint32(0); ; counter++ {
+		if _, err = io.ReadFull(src, length); err != nil {
+			// the last chunk hasn't been read
+			return ErrCorrupted
+		}
+		size := binary.BigEndian.Uint32(length)
+		if size < uint32(aead.Overhead()) || size > chunkSize+uint32(aead.Overhead()) {
+			return ErrCorrupted
+		}
+		sealed := make([]byte, size)
+		if _, err = io.ReadFull(src, sealed); err != nil {
+			return ErrCorrupted
+		}
+
+		last := false
+		chunk, err := aead.Open(nil, nonce(prefix, counter), sealed, aad(header, false))
+		if err != nil {
+			if chunk, err = aead.Open(nil, nonce(prefix, counter), sealed, aad(header, true)); err != nil {
+				return ErrCorrupted
+			}
+			last = true
+		}
+
+		sum.Write(chunk)
+		if _, err = dst.Write(chunk); err != nil {
+			return errors.Wrap(err, "write archive")
+		}
+		if last {
+			break
+		}
+	}
+
+	if _, err = io.ReadFull(src, make([]byte, 1)); err == nil {
+		// data follows the last chunk
+		return ErrCorrupted
+	}
+	if expected != "" && checksum(sum) != expected {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Checksum returns the checksum of an archive that isn't encrypted.
+func Checksum(src io.Reader) (string, error) {
+	sum := sha256.New()
+	if _, err := io.Copy(sum, src); err != nil {
+		return "", errors.Wrap(err, "read archive")
+	}
+	return checksum(sum), nil
+}
+
+// Verify checks an archive that isn't encrypted against its checksum.
+func Verify(src io.Reader, expected string) error {
+	actual, err := Checksum(src)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, counter uint32) []byte {
+	n := make([]byte, prefixSize+4)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], counter)
+	return n
+}
+
+func aad(header []byte, last bool) []byte {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	return append(append([]byte{}, header...), flag)
+}
+
+func checksum(h hash.Hash) string {
+	return ChecksumPrefix + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// minLeakSize is the length of plaintext that is not expected in ciphertext by chance.
+const minLeakSize = 32
+
+func newTestKeys(t *testing.T, primary string, ids ...string) *Keys {
+	encoded := make(map[string]string)
+	for _, id := range ids {
+		key, err := GenerateKey()
+		require.NoError(t, err)
+		encoded[id] = key
+	}
+	k, err := ParseKeys(primary, encoded)
+	require.NoError(t, err)
+	return k
+}
+
+func TestKeys_SealOpen(t *testing.T) {
+	k := newTestKeys(t, "2019-05", "2019-05")
+
+	// plaintext is fixed, short archives are skipped by the leak check since
+	// a few bytes can show up in any ciphertext
+	line := []byte("etcd snapshot of the supergiant control plane\n")
+	plaintext := bytes.Repeat(line, (3*chunkSize+100)/len(line)+1)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 100} {
+		archive := plaintext[:size]
+
+		sealed := &bytes.Buffer{}
+		sum, err := k.Seal(sealed, bytes.NewReader(archive))
+		require.NoError(t, err, "TC: %d", size)
+		require.True(t, strings.HasPrefix(sum, ChecksumPrefix), "TC: %d", size)
+		if size >= minLeakSize {
+			require.False(t, bytes.Contains(sealed.Bytes(), archive[:minLeakSize]), "TC: %d", size)
+		}
+
+		expected, err := Checksum(bytes.NewReader(archive))
+		require.NoError(t, err)
+		require.Equal(t, expected, sum, "TC: %d", size)
+
+		opened := &bytes.Buffer{}
+		require.NoError(t, k.Open(opened, bytes.NewReader(sealed.Bytes()), sum), "TC: %d", size)
+		require.True(t, bytes.Equal(archive, opened.Bytes()), "TC: %d", size)
+	}
+}
+
+func TestKeys_Rotation(t *testing.T) {
+	old := newTestKeys(t, "old", "old")
+	sealed := &bytes.Buffer{}
+	sum, err := old.Seal(sealed, strings.NewReader("etcd snapshot"))
+	require.NoError(t, err)
+
+	// archives made with rotated keys are opened while the key is kept
+	rotated, err := ParseKeys("new", map[string]string{
+		"old": encodedKey(old, "old"),
+		"new": encodedKey(newTestKeys(t, "new", "new"), "new"),
+	})
+	require.NoError(t, err)
+	opened := &bytes.Buffer{}
+	require.NoError(t, rotated.Open(opened, bytes.NewReader(sealed.Bytes()), sum))
+	require.Equal(t, "etcd snapshot", opened.String())
+
+	other := newTestKeys(t, "new", "new")
+	require.Equal(t, ErrUnknownKey, errors.Cause(other.Open(&bytes.Buffer{}, bytes.NewReader(sealed.Bytes()), sum)))
+}
+
+func TestKeys_OpenTampered(t *testing.T) {
+	k := newTestKeys(t, "key", "key")
+	archive := make([]byte, 2*chunkSize+10)
+	sealed := &bytes.Buffer{}
+	sum, err := k.Seal(sealed, bytes.NewReader(archive))
+	require.NoError(t, err)
+	data := sealed.Bytes()
+	header := len(magic) + 1 + len("key") + prefixSize
+	chunk := 4 + chunkSize + 16
+
+	for _, tc := range []struct {
+		name        string
+		archive     []byte
+		checksum    string
+		expectedErr error
+	}{
+		{
+			name:        "flipped bit",
+			archive:     flip(data, header+10),
+			checksum:    sum,
+			expectedErr: ErrCorrupted,
+		},
+		{
+			name:        "changed key id",
+			archive:     flip(data, len(magic)+1),
+			checksum:    sum,
+			expectedErr: ErrUnknownKey,
+		},
+		{
+			name:        "cut off",
+			archive:     data[:header+2*chunk],
+			checksum:    sum,
+			expectedErr: ErrCorrupted,
+		},
+		{
+			name:        "reordered",
+			archive:     concat(data[:header], data[header+chunk:header+2*chunk], data[header:header+chunk], data[header+2*chunk:]),
+			checksum:    sum,
+			expectedErr: ErrCorrupted,
+		},
+		{
+			name:        "appended",
+			archive:     concat(data, []byte{0}),
+			checksum:    sum,
+			expectedErr: ErrCorrupted,
+		},
+		{
+			name:        "not an archive",
+			archive:     []byte("tar"),
+			expectedErr: ErrCorrupted,
+		},
+		{
+			name:        "other archive",
+			archive:     data,
+			checksum:    ChecksumPrefix + "00",
+			expectedErr: ErrChecksum,
+		},
+		{
+			name:    "no checksum",
+			archive: data,
+		},
+	} {
+		err := k.Open(&bytes.Buffer{}, bytes.NewReader(tc.archive), tc.checksum)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		primary     string
+		keys        map[string]string
+		expectedErr bool
+	}{
+		{"valid", "a", map[string]string{"a": key}, false},
+		{"no primary", "b", map[string]string{"a": key}, true},
+		{"short key", "a", map[string]string{"a": "c2hvcnQ="}, true},
+		{"not base64", "a", map[string]string{"a": "!"}, true},
+		{"empty id", "", map[string]string{"": key}, true},
+	} {
+		_, err := ParseKeys(tc.primary, tc.keys)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s", tc.name)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	sum, err := Checksum(strings.NewReader("state"))
+	require.NoError(t, err)
+
+	require.NoError(t, Verify(strings.NewReader("state"), sum))
+	require.Equal(t, ErrChecksum, Verify(strings.NewReader("other"), sum))
+}
+
+func encodedKey(k *Keys, id string) string {
+	return base64.StdEncoding.EncodeToString(k.keys[id])
+}
+
+func flip(data []byte, i int) []byte {
+	out := append([]byte{}, data...)
+	out[i] ^= 1
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	out := make([]byte, 0)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
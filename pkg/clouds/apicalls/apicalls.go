@@ -0,0 +1,322 @@
+package apicalls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultWindow is a period budgets are counted over.
+	DefaultWindow = time.Minute
+	// DefaultNearLimit is a share of the budget after which
+	// non-urgent callers are slowed down.
+	DefaultNearLimit = 0.8
+)
+
+type contextKey string
+
+const (
+	accountKey contextKey = "apicalls-account"
+	stepKey    contextKey = "apicalls-step"
+)
+
+// Default records calls made by cloud clients of the process.
+var Default = NewRecorder(DefaultWindow)
+
+// WithAccount labels cloud calls made with ctx by the cloud account name.
+func WithAccount(ctx context.Context, account string) context.Context {
+	return context.WithValue(ctx, accountKey, account)
+}
+
+// WithStep labels cloud calls made with ctx by the workflow step name.
+func WithStep(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, stepKey, step)
+}
+
+func labels(ctx context.Context) (string, string) {
+	account, _ := ctx.Value(accountKey).(string)
+	step, _ := ctx.Value(stepKey).(string)
+	return account, step
+}
+
+// Stats are counters of calls with the same account and step.
+type Stats struct {
+	Account    string        `json:"account"`
+	Step       string        `json:"step"`
+	Calls      int64         `json:"calls"`
+	Errors     int64         `json:"errors"`
+	Latency    time.Duration `json:"latency"`
+	MaxLatency time.Duration `json:"maxLatency"`
+}
+
+type statsKey struct {
+	account string
+	step    string
+}
+
+type usage struct {
+	start time.Time
+	calls int
+}
+
+// Recorder counts cloud calls and keeps soft budgets of accounts, a budget
+// is a number of calls an account may make in a window.
+type Recorder struct {
+	m       sync.Mutex
+	stats   map[statsKey]*Stats
+	windows map[string]*usage
+
+	window        time.Duration
+	nearLimit     float64
+	defaultBudget int
+	budgets       map[string]int
+
+	now func() time.Time
+}
+
+// NewRecorder constructs a Recorder with budgets counted over window.
+func NewRecorder(window time.Duration) *Recorder {
+	return &Recorder{
+		stats:     make(map[statsKey]*Stats),
+		windows:   make(map[string]*usage),
+		window:    window,
+		nearLimit: DefaultNearLimit,
+		budgets:   make(map[string]int),
+		now:       time.Now,
+	}
+}
+
+// SetDefaultBudget sets a budget of accounts without their own one,
+// zero disables budgets.
+func (r *Recorder) SetDefaultBudget(calls int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.defaultBudget = calls
+}
+
+// SetBudget sets a budget of the account, zero falls back to the default.
+func (r *Recorder) SetBudget(account string, calls int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if calls == 0 {
+		delete(r.budgets, account)
+		return
+	}
+	r.budgets[account] = calls
+}
+
+// Observe records a call made on behalf of the account by the step.
+func (r *Recorder) Observe(account, step string, latency time.Duration, failed bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	key := statsKey{account, step}
+	s, ok := r.stats[key]
+	if !ok {
+		s = &Stats{Account: account, Step: step}
+		r.stats[key] = s
+	}
+	s.Calls++
+	if failed {
+		s.Errors++
+	}
+	s.Latency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+
+	r.current(account).calls++
+}
+
+// current returns usage of the account in the current window, r.m must be held.
+func (r *Recorder) current(account string) *usage {
+	now := r.now()
+	u, ok := r.windows[account]
+	if !ok || now.Sub(u.start) >= r.window {
+		u = &usage{start: now}
+		r.windows[account] = u
+	}
+	return u
+}
+
+// Stats returns counters sorted by account and step.
+func (r *Recorder) Stats() []Stats {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	stats := make([]Stats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Account != stats[j].Account {
+			return stats[i].Account < stats[j].Account
+		}
+		return stats[i].Step < stats[j].Step
+	})
+
+	return stats
+}
+
+// Usage returns a share of the account budget spent in the current window,
+// zero is returned for accounts without a budget.
+func (r *Recorder) Usage(account string) float64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	spent, _ := r.spent(account)
+	return spent
+}
+
+// spent returns a share of the budget and the end of the window, r.m must be held.
+func (r *Recorder) spent(account string) (float64, time.Time) {
+	budget, ok := r.budgets[account]
+	if !ok {
+		budget = r.defaultBudget
+	}
+	if budget <= 0 {
+		return 0, time.Time{}
+	}
+
+	u := r.current(account)
+	return float64(u.calls) / float64(budget), u.start.Add(r.window)
+}
+
+// Wait blocks non-urgent callers until the next window if the account is near
+// its budget, calls are never rejected so provisioning is not affected.
+func (r *Recorder) Wait(ctx context.Context, account string) error {
+	r.m.Lock()
+	spent, reset := r.spent(account)
+	now := r.now()
+	r.m.Unlock()
+
+	if spent < r.nearLimit || !reset.After(now) {
+		return nil
+	}
+
+	timer := time.NewTimer(reset.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WriteMetrics writes counters in prometheus text format.
+func (r *Recorder) WriteMetrics(w io.Writer) error {
+	stats := r.Stats()
+
+	metrics := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(Stats) string
+	}{
+		{
+			name:  "supergiant_cloud_api_calls_total",
+			help:  "Number of cloud API calls.",
+			kind:  "counter",
+			value: func(s Stats) string { return fmt.Sprint(s.Calls) },
+		},
+		{
+			name:  "supergiant_cloud_api_errors_total",
+			help:  "Number of failed cloud API calls.",
+			kind:  "counter",
+			value: func(s Stats) string { return fmt.Sprint(s.Errors) },
+		},
+		{
+			name:  "supergiant_cloud_api_latency_seconds_total",
+			help:  "Total time spent in cloud API calls.",
+			kind:  "counter",
+			value: func(s Stats) string { return fmt.Sprint(s.Latency.Seconds()) },
+		},
+		{
+			name:  "supergiant_cloud_api_latency_seconds_max",
+			help:  "Longest cloud API call.",
+			kind:  "gauge",
+			value: func(s Stats) string { return fmt.Sprint(s.MaxLatency.Seconds()) },
+		},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s{account=%q,step=%q} %s\n", m.name, s.Account, s.Step, m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP exposes counters to prometheus.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := r.WriteMetrics(w); err != nil {
+		logrus.Errorf("write cloud api metrics: %v", err)
+	}
+}
+
+// Transport records calls sent through the base transport,
+// calls are labeled by the request context.
+type Transport struct {
+	Base     http.RoundTripper
+	Recorder *Recorder
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+
+	account, step := labels(req.Context())
+	failed := err != nil || resp.StatusCode >= http.StatusBadRequest
+	t.Recorder.Observe(account, step, time.Since(start), failed)
+
+	return resp, err
+}
+
+// Client returns an http client for cloud SDKs that records calls to Default.
+func Client() *http.Client {
+	return &http.Client{
+		Transport: &Transport{
+			Recorder: Default,
+		},
+	}
+}
+
+// ClientContext returns ctx for oauth2 clients, calls made by them are
+// recorded to Default.
+func ClientContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, Client())
+}
+
+// InstrumentAWS records calls of clients built from the session to Default,
+// the aws sdk refuses custom http clients when a CA bundle is configured.
+func InstrumentAWS(sess *session.Session) *session.Session {
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		account, step := labels(r.Context())
+		Default.Observe(account, step, time.Since(r.Time), r.Error != nil)
+	})
+	return sess
+}
@@ -0,0 +1,113 @@
+package apicalls
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	r := NewRecorder(time.Minute)
+	client := &http.Client{
+		Transport: &Transport{Recorder: r},
+	}
+
+	ctx := WithStep(WithAccount(context.Background(), "aws"), "create_vpc")
+	for _, path := range []string{"/ok", "/fail"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	stats := r.Stats()
+	require.Len(t, stats, 1)
+	require.Equal(t, "aws", stats[0].Account)
+	require.Equal(t, "create_vpc", stats[0].Step)
+	require.Equal(t, int64(2), stats[0].Calls)
+	require.Equal(t, int64(1), stats[0].Errors)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.WriteMetrics(buf))
+	require.Contains(t, buf.String(), `supergiant_cloud_api_calls_total{account="aws",step="create_vpc"} 2`)
+	require.Contains(t, buf.String(), `supergiant_cloud_api_errors_total{account="aws",step="create_vpc"} 1`)
+}
+
+func TestRecorder_Wait(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		defaultBudget int
+		budget        int
+		calls         int
+		expectedUsage float64
+		expectedWait  bool
+	}{
+		{
+			name:  "no budget",
+			calls: 100,
+		},
+		{
+			name:          "below the limit",
+			defaultBudget: 10,
+			calls:         7,
+			expectedUsage: 0.7,
+		},
+		{
+			name:          "near the limit",
+			defaultBudget: 10,
+			calls:         8,
+			expectedUsage: 0.8,
+			expectedWait:  true,
+		},
+		{
+			name:          "account budget",
+			defaultBudget: 10,
+			budget:        100,
+			calls:         8,
+			expectedUsage: 0.08,
+		},
+	} {
+		r := NewRecorder(time.Hour)
+		r.SetDefaultBudget(tc.defaultBudget)
+		r.SetBudget("aws", tc.budget)
+		for i := 0; i < tc.calls; i++ {
+			r.Observe("aws", "", time.Millisecond, false)
+		}
+
+		require.InDelta(t, tc.expectedUsage, r.Usage("aws"), 0.001, "TC: %s", tc.name)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := r.Wait(ctx, "aws")
+		cancel()
+		require.Equal(t, tc.expectedWait, err == context.DeadlineExceeded, "TC: %s", tc.name)
+	}
+}
+
+func TestRecorder_WindowReset(t *testing.T) {
+	now := time.Now()
+	r := NewRecorder(time.Minute)
+	r.now = func() time.Time {
+		return now
+	}
+	r.SetDefaultBudget(1)
+
+	r.Observe("aws", "", time.Millisecond, false)
+	require.Equal(t, 1.0, r.Usage("aws"))
+
+	now = now.Add(time.Minute)
+	require.Equal(t, 0.0, r.Usage("aws"), "usage must be reset in the next window")
+	require.NoError(t, r.Wait(context.Background(), "aws"))
+}
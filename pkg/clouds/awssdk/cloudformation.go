@@ -0,0 +1,201 @@
+package awssdk
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+)
+
+const (
+	cloudFormationAPIVersion = "2010-05-15"
+
+	StackCreateComplete = "CREATE_COMPLETE"
+	StackDeleteComplete = "DELETE_COMPLETE"
+)
+
+var ErrStackNotFound = errors.New("stack not found")
+
+// CloudFormation is a client of the part of cloudformation api that
+// creates and deletes stacks, the service is not a part of the vendored sdk.
+type CloudFormation struct {
+	Endpoint string
+
+	region string
+	client *http.Client
+	signer *v4.Signer
+}
+
+// Stack is a state of a cloudformation stack.
+type Stack struct {
+	ID     string
+	Name   string
+	Status string
+	Reason string
+	// Outputs are values exported by the template
+	Outputs map[string]string
+}
+
+// InProgress tells whether the stack is being created, updated or deleted.
+func (s Stack) InProgress() bool {
+	return strings.HasSuffix(s.Status, "_IN_PROGRESS")
+}
+
+// NewCloudFormation creates a CloudFormation client of the region with
+// static credentials.
+func NewCloudFormation(keyID, secret, token, region string) (*CloudFormation, error) {
+	if keyID == "" || secret == "" {
+		return nil, ErrInvalidCreds
+	}
+	if region == "" {
+		return nil, ErrEmptyRegion
+	}
+
+	return &CloudFormation{
+		Endpoint: fmt.Sprintf("https://cloudformation.%s.amazonaws.com", region),
+		region:   region,
+		client:   apicalls.Client(),
+		signer:   v4.NewSigner(credentials.NewStaticCredentials(keyID, secret, token)),
+	}, nil
+}
+
+type stackOutput struct {
+	Key   string `xml:"OutputKey"`
+	Value string `xml:"OutputValue"`
+}
+
+type stackMember struct {
+	ID      string        `xml:"StackId"`
+	Name    string        `xml:"StackName"`
+	Status  string        `xml:"StackStatus"`
+	Reason  string        `xml:"StackStatusReason"`
+	Outputs []stackOutput `xml:"Outputs>member"`
+}
+
+type createStackResponse struct {
+	ID string `xml:"CreateStackResult>StackId"`
+}
+
+type describeStacksResponse struct {
+	Stacks []stackMember `xml:"DescribeStacksResult>Stacks>member"`
+}
+
+// CreateStack starts creation of the stack, a failed creation is rolled
+// back by deleting everything that was created.
+func (c *CloudFormation) CreateStack(ctx context.Context, name, template string, tags map[string]string) (string, error) {
+	params := url.Values{}
+	params.Set("StackName", name)
+	params.Set("TemplateBody", template)
+	params.Set("OnFailure", "DELETE")
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		params.Set(fmt.Sprintf("Tags.member.%d.Key", i+1), k)
+		params.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), tags[k])
+	}
+
+	resp := createStackResponse{}
+	if err := c.do(ctx, "CreateStack", params, &resp); err != nil {
+		return "", errors.Wrapf(err, "create stack %s", name)
+	}
+
+	return resp.ID, nil
+}
+
+// DescribeStack returns the state of the stack, ErrStackNotFound is
+// returned for stacks that don't exist.
+func (c *CloudFormation) DescribeStack(ctx context.Context, name string) (*Stack, error) {
+	params := url.Values{}
+	params.Set("StackName", name)
+
+	resp := describeStacksResponse{}
+	if err := c.do(ctx, "DescribeStacks", params, &resp); err != nil {
+		// the api has no distinct code for missing stacks
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, errors.Wrap(ErrStackNotFound, name)
+		}
+		return nil, errors.Wrapf(err, "describe stack %s", name)
+	}
+	if len(resp.Stacks) == 0 {
+		return nil, errors.Wrap(ErrStackNotFound, name)
+	}
+
+	m := resp.Stacks[0]
+	stack := &Stack{
+		ID:      m.ID,
+		Name:    m.Name,
+		Status:  m.Status,
+		Reason:  m.Reason,
+		Outputs: make(map[string]string, len(m.Outputs)),
+	}
+	for _, o := range m.Outputs {
+		stack.Outputs[o.Key] = o.Value
+	}
+
+	return stack, nil
+}
+
+// DeleteStack starts deletion of the stack with all its resources, a missing
+// stack is not an error.
+func (c *CloudFormation) DeleteStack(ctx context.Context, name string) error {
+	params := url.Values{}
+	params.Set("StackName", name)
+
+	return errors.Wrapf(c.do(ctx, "DeleteStack", params, nil), "delete stack %s", name)
+}
+
+func (c *CloudFormation) do(ctx context.Context, action string, params url.Values, out interface{}) error {
+	params.Set("Action", action)
+	params.Set("Version", cloudFormationAPIVersion)
+	body := strings.NewReader(params.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+"/", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	if _, err = c.signer.Sign(req, body, "cloudformation", c.region, time.Now()); err != nil {
+		return errors.Wrap(err, "sign request")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := errorResponse{}
+		if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+			return errors.Errorf("cloudformation: %s", resp.Status)
+		}
+		return errors.Errorf("cloudformation: %s: %s", e.Code, e.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, out)
+}
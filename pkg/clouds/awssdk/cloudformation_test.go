@@ -0,0 +1,115 @@
+package awssdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCloudFormation(t *testing.T) {
+	_, err := NewCloudFormation("", "secret", "", "us-east-1")
+	require.Equal(t, ErrInvalidCreds, err)
+
+	_, err = NewCloudFormation("key", "secret", "", "")
+	require.Equal(t, ErrEmptyRegion, err)
+
+	cf, err := NewCloudFormation("key", "secret", "", "eu-west-1")
+	require.Nil(t, err)
+	require.Equal(t, "https://cloudformation.eu-west-1.amazonaws.com", cf.Endpoint)
+}
+
+func TestCloudFormation_CreateStack(t *testing.T) {
+	var action, name, template, tagKey, tagValue string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.NotEmpty(t, r.Header.Get("Authorization"))
+		action, name, template = r.Form.Get("Action"), r.Form.Get("StackName"), r.Form.Get("TemplateBody")
+		tagKey, tagValue = r.Form.Get("Tags.member.1.Key"), r.Form.Get("Tags.member.1.Value")
+		w.Write([]byte(`<CreateStackResponse><CreateStackResult>
+<StackId>arn:aws:cloudformation:us-east-1:1:stack/kube/1</StackId></CreateStackResult></CreateStackResponse>`))
+	}))
+	defer srv.Close()
+
+	cf, err := NewCloudFormation("key", "secret", "", "us-east-1")
+	require.Nil(t, err)
+	cf.Endpoint = srv.URL
+
+	id, err := cf.CreateStack(context.Background(), "kube", "{}", map[string]string{"owner": "sg"})
+	require.Nil(t, err)
+	require.Equal(t, "arn:aws:cloudformation:us-east-1:1:stack/kube/1", id)
+	require.Equal(t, "CreateStack", action)
+	require.Equal(t, "kube", name)
+	require.Equal(t, "{}", template)
+	require.Equal(t, "owner", tagKey)
+	require.Equal(t, "sg", tagValue)
+}
+
+func TestCloudFormation_DescribeStack(t *testing.T) {
+	testCases := []struct {
+		description string
+		code        int
+		resp        string
+		status      string
+		outputs     map[string]string
+		err         error
+		errMsg      string
+	}{
+		{
+			description: "missing stack",
+			code:        http.StatusBadRequest,
+			resp: `<ErrorResponse><Error><Code>ValidationError</Code>
+<Message>Stack with id kube does not exist</Message></Error></ErrorResponse>`,
+			err: ErrStackNotFound,
+		},
+		{
+			description: "api error",
+			code:        http.StatusForbidden,
+			resp: `<ErrorResponse><Error><Code>AccessDenied</Code>
+<Message>denied</Message></Error></ErrorResponse>`,
+			errMsg: "AccessDenied",
+		},
+		{
+			description: "success",
+			code:        http.StatusOK,
+			resp: `<DescribeStacksResponse><DescribeStacksResult><Stacks><member>
+<StackName>kube</StackName><StackStatus>CREATE_COMPLETE</StackStatus>
+<Outputs><member><OutputKey>VPCID</OutputKey><OutputValue>vpc-1</OutputValue></member></Outputs>
+</member></Stacks></DescribeStacksResult></DescribeStacksResponse>`,
+			status:  StackCreateComplete,
+			outputs: map[string]string{"VPCID": "vpc-1"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(testCase.code)
+			w.Write([]byte(testCase.resp))
+		}))
+
+		cf, err := NewCloudFormation("key", "secret", "", "us-east-1")
+		require.Nil(t, err)
+		cf.Endpoint = srv.URL
+
+		stack, err := cf.DescribeStack(context.Background(), "kube")
+		srv.Close()
+
+		switch {
+		case testCase.err != nil:
+			require.Equal(t, testCase.err, errors.Cause(err))
+		case testCase.errMsg != "":
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), testCase.errMsg)
+		default:
+			require.Nil(t, err)
+			require.Equal(t, testCase.status, stack.Status)
+			require.False(t, stack.InProgress())
+			require.Equal(t, testCase.outputs, stack.Outputs)
+		}
+	}
+}
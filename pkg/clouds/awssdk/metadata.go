@@ -0,0 +1,172 @@
+package awssdk
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+)
+
+const (
+	MetadataTokensRequired = "required"
+	MetadataTokensOptional = "optional"
+)
+
+// InstanceMetadata sends ec2 actions that are newer than the vendored sdk,
+// they are built and signed by the ec2 client.
+type InstanceMetadata struct {
+	client *client.Client
+}
+
+// MetadataOptions describe access to the metadata service of an instance.
+type MetadataOptions struct {
+	HTTPTokens string
+	// HopLimit is a number of network hops token responses travel,
+	// 1 keeps them on the instance.
+	HopLimit int64
+}
+
+// InstanceSecurity is what ec2 reports about metadata access, volumes and
+// the instance profile of an instance.
+type InstanceSecurity struct {
+	ID                 string
+	Tags               map[string]string
+	InstanceProfileARN string
+	VolumeIDs          []string
+	Metadata           MetadataOptions
+}
+
+// NewInstanceMetadata uses the client of the ec2 service, e.g. ec2.New(sess).Client.
+func NewInstanceMetadata(c *client.Client) *InstanceMetadata {
+	return &InstanceMetadata{
+		client: c,
+	}
+}
+
+type modifyMetadataOptionsInput struct {
+	InstanceID *string `queryName:"InstanceId" type:"string"`
+	HTTPTokens *string `queryName:"HttpTokens" type:"string"`
+	HopLimit   *int64  `queryName:"HttpPutResponseHopLimit" type:"integer"`
+}
+
+type modifyMetadataOptionsOutput struct {
+	InstanceID *string `locationName:"instanceId" type:"string"`
+}
+
+// ModifyMetadataOptions changes metadata access of the instance, running
+// instances take the options without a restart.
+func (m *InstanceMetadata) ModifyMetadataOptions(ctx context.Context, id string, opts MetadataOptions) error {
+	in := &modifyMetadataOptionsInput{
+		InstanceID: aws.String(id),
+		HTTPTokens: aws.String(opts.HTTPTokens),
+	}
+	if opts.HopLimit > 0 {
+		in.HopLimit = aws.Int64(opts.HopLimit)
+	}
+
+	req := m.client.NewRequest(&request.Operation{
+		Name:       "ModifyInstanceMetadataOptions",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, in, &modifyMetadataOptionsOutput{})
+	req.SetContext(ctx)
+
+	return errors.Wrapf(req.Send(), "modify metadata options of %s", id)
+}
+
+type securityTag struct {
+	Key   *string `locationName:"key" type:"string"`
+	Value *string `locationName:"value" type:"string"`
+}
+
+type securityInstance struct {
+	InstanceID         *string `locationName:"instanceId" type:"string"`
+	IamInstanceProfile *struct {
+		Arn *string `locationName:"arn" type:"string"`
+	} `locationName:"iamInstanceProfile" type:"structure"`
+	BlockDeviceMappings []*struct {
+		Ebs *struct {
+			VolumeID *string `locationName:"volumeId" type:"string"`
+		} `locationName:"ebs" type:"structure"`
+	} `locationName:"blockDeviceMapping" locationNameList:"item" type:"list"`
+	MetadataOptions *struct {
+		HTTPTokens *string `locationName:"httpTokens" type:"string"`
+		HopLimit   *int64  `locationName:"httpPutResponseHopLimit" type:"integer"`
+	} `locationName:"metadataOptions" type:"structure"`
+	Tags []*securityTag `locationName:"tagSet" locationNameList:"item" type:"list"`
+}
+
+type describeSecurityOutput struct {
+	NextToken    *string `locationName:"nextToken" type:"string"`
+	Reservations []*struct {
+		Instances []*securityInstance `locationName:"instancesSet" locationNameList:"item" type:"list"`
+	} `locationName:"reservationSet" locationNameList:"item" type:"list"`
+}
+
+// DescribeSecurity describes instances that match the input with their
+// metadata options, the options are missing in ec2.Instance of the vendored sdk.
+func (m *InstanceMetadata) DescribeSecurity(ctx context.Context, in *ec2.DescribeInstancesInput) ([]InstanceSecurity, error) {
+	params := *in
+	params.NextToken = nil
+
+	instances := make([]InstanceSecurity, 0)
+	for {
+		out := &describeSecurityOutput{}
+		req := m.client.NewRequest(&request.Operation{
+			Name:       "DescribeInstances",
+			HTTPMethod: "POST",
+			HTTPPath:   "/",
+		}, &params, out)
+		req.SetContext(ctx)
+		if err := req.Send(); err != nil {
+			return nil, errors.Wrap(err, "describe instances")
+		}
+
+		for _, r := range out.Reservations {
+			for _, i := range r.Instances {
+				instances = append(instances, instanceSecurity(i))
+			}
+		}
+
+		if aws.StringValue(out.NextToken) == "" {
+			break
+		}
+		params.NextToken = out.NextToken
+	}
+
+	return instances, nil
+}
+
+func instanceSecurity(i *securityInstance) InstanceSecurity {
+	s := InstanceSecurity{
+		ID:        aws.StringValue(i.InstanceID),
+		Tags:      make(map[string]string, len(i.Tags)),
+		VolumeIDs: make([]string, 0, len(i.BlockDeviceMappings)),
+		// instances created without options serve both versions of the api
+		Metadata: MetadataOptions{
+			HTTPTokens: MetadataTokensOptional,
+		},
+	}
+	for _, tag := range i.Tags {
+		s.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	if i.IamInstanceProfile != nil {
+		s.InstanceProfileARN = aws.StringValue(i.IamInstanceProfile.Arn)
+	}
+	for _, b := range i.BlockDeviceMappings {
+		if b.Ebs != nil && b.Ebs.VolumeID != nil {
+			s.VolumeIDs = append(s.VolumeIDs, *b.Ebs.VolumeID)
+		}
+	}
+	if o := i.MetadataOptions; o != nil {
+		if o.HTTPTokens != nil {
+			s.Metadata.HTTPTokens = *o.HTTPTokens
+		}
+		s.Metadata.HopLimit = aws.Int64Value(o.HopLimit)
+	}
+
+	return s
+}
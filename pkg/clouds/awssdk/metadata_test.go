@@ -0,0 +1,112 @@
+package awssdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMetadata(t *testing.T, url string) *InstanceMetadata {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(url),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.Nil(t, err)
+
+	return NewInstanceMetadata(ec2.New(sess).Client)
+}
+
+func TestInstanceMetadata_ModifyMetadataOptions(t *testing.T) {
+	var action, id, tokens, hops string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.NotEmpty(t, r.Header.Get("Authorization"))
+		action, id = r.Form.Get("Action"), r.Form.Get("InstanceId")
+		tokens, hops = r.Form.Get("HttpTokens"), r.Form.Get("HttpPutResponseHopLimit")
+		w.Write([]byte(`<ModifyInstanceMetadataOptionsResponse><instanceId>i-1</instanceId>
+</ModifyInstanceMetadataOptionsResponse>`))
+	}))
+	defer srv.Close()
+
+	m := newTestMetadata(t, srv.URL)
+	err := m.ModifyMetadataOptions(context.Background(), "i-1", MetadataOptions{
+		HTTPTokens: MetadataTokensRequired,
+		HopLimit:   1,
+	})
+	require.Nil(t, err)
+	require.Equal(t, "ModifyInstanceMetadataOptions", action)
+	require.Equal(t, "i-1", id)
+	require.Equal(t, "required", tokens)
+	require.Equal(t, "1", hops)
+}
+
+func TestInstanceMetadata_ModifyMetadataOptionsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code>
+<Message>not found</Message></Error></Errors></Response>`))
+	}))
+	defer srv.Close()
+
+	m := newTestMetadata(t, srv.URL)
+	err := m.ModifyMetadataOptions(context.Background(), "i-1", MetadataOptions{HTTPTokens: MetadataTokensRequired})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "InvalidInstanceID.NotFound")
+}
+
+func TestInstanceMetadata_DescribeSecurity(t *testing.T) {
+	pages := []string{
+		`<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-1</instanceId>
+<iamInstanceProfile><arn>arn:aws:iam::1:instance-profile/kubernetes-node</arn></iamInstanceProfile>
+<blockDeviceMapping><item><deviceName>/dev/xvda</deviceName><ebs><volumeId>vol-1</volumeId></ebs></item></blockDeviceMapping>
+<metadataOptions><httpTokens>required</httpTokens><httpPutResponseHopLimit>1</httpPutResponseHopLimit></metadataOptions>
+<tagSet><item><key>Role</key><value>node</value></item></tagSet>
+</item></instancesSet></item></reservationSet><nextToken>page2</nextToken></DescribeInstancesResponse>`,
+		`<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-2</instanceId>
+</item></instancesSet></item></reservationSet></DescribeInstancesResponse>`,
+	}
+
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "DescribeInstances", r.Form.Get("Action"))
+		require.Equal(t, "tag:KubernetesCluster", r.Form.Get("Filter.1.Name"))
+		tokens = append(tokens, r.Form.Get("NextToken"))
+		w.Write([]byte(pages[len(tokens)-1]))
+	}))
+	defer srv.Close()
+
+	in := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("tag:KubernetesCluster"),
+			Values: aws.StringSlice([]string{"kube"}),
+		}},
+	}
+	instances, err := newTestMetadata(t, srv.URL).DescribeSecurity(context.Background(), in)
+	require.Nil(t, err)
+	require.Equal(t, []string{"", "page2"}, tokens)
+	require.Nil(t, in.NextToken)
+
+	require.Len(t, instances, 2)
+	require.Equal(t, InstanceSecurity{
+		ID:                 "i-1",
+		Tags:               map[string]string{"Role": "node"},
+		InstanceProfileARN: "arn:aws:iam::1:instance-profile/kubernetes-node",
+		VolumeIDs:          []string{"vol-1"},
+		Metadata:           MetadataOptions{HTTPTokens: MetadataTokensRequired, HopLimit: 1},
+	}, instances[0])
+	require.Equal(t, "i-2", instances[1].ID)
+	require.Equal(t, MetadataTokensOptional, instances[1].Metadata.HTTPTokens)
+	require.Empty(t, instances[1].VolumeIDs)
+}
@@ -0,0 +1,183 @@
+package awssdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+)
+
+const (
+	route53Endpoint   = "https://route53.amazonaws.com"
+	route53APIVersion = "2013-04-01"
+	// route53 is a global service signed for us-east-1
+	route53Region = "us-east-1"
+)
+
+// Route53 is a client of the part of route53 api that manages
+// A records, the service is not a part of the vendored sdk.
+type Route53 struct {
+	Endpoint string
+
+	client *http.Client
+	signer *v4.Signer
+}
+
+// NewRoute53 creates a Route53 client with static credentials.
+func NewRoute53(keyID, secret, token string) (*Route53, error) {
+	if keyID == "" || secret == "" {
+		return nil, ErrInvalidCreds
+	}
+
+	return &Route53{
+		Endpoint: route53Endpoint,
+		client:   apicalls.Client(),
+		signer:   v4.NewSigner(credentials.NewStaticCredentials(keyID, secret, token)),
+	}, nil
+}
+
+type resourceRecord struct {
+	Value string `xml:"Value"`
+}
+
+type resourceRecordSet struct {
+	Name            string           `xml:"Name"`
+	Type            string           `xml:"Type"`
+	TTL             int64            `xml:"TTL"`
+	ResourceRecords []resourceRecord `xml:"ResourceRecords>ResourceRecord"`
+}
+
+type change struct {
+	Action            string            `xml:"Action"`
+	ResourceRecordSet resourceRecordSet `xml:"ResourceRecordSet"`
+}
+
+type changeRequest struct {
+	XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type listResponse struct {
+	RecordSets []resourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// UpsertA points the name to the addresses.
+func (r *Route53) UpsertA(ctx context.Context, zoneID, name string, ttl int64, addrs []string) error {
+	set := resourceRecordSet{
+		Name: fqdn(name),
+		Type: "A",
+		TTL:  ttl,
+	}
+	for _, addr := range addrs {
+		set.ResourceRecords = append(set.ResourceRecords, resourceRecord{Value: addr})
+	}
+
+	return r.change(ctx, zoneID, change{Action: "UPSERT", ResourceRecordSet: set})
+}
+
+// DeleteA removes the record, a missing one is not an error.
+func (r *Route53) DeleteA(ctx context.Context, zoneID, name string) error {
+	set, err := r.getA(ctx, zoneID, name)
+	if err != nil || set == nil {
+		return err
+	}
+
+	// deletion requires the current values of the record
+	return r.change(ctx, zoneID, change{Action: "DELETE", ResourceRecordSet: *set})
+}
+
+func (r *Route53) getA(ctx context.Context, zoneID, name string) (*resourceRecordSet, error) {
+	q := url.Values{}
+	q.Set("name", fqdn(name))
+	q.Set("type", "A")
+	q.Set("maxitems", "1")
+
+	resp := listResponse{}
+	if err := r.do(ctx, http.MethodGet, zonePath(zoneID)+"?"+q.Encode(), nil, &resp); err != nil {
+		return nil, errors.Wrapf(err, "get record %s", name)
+	}
+
+	for _, set := range resp.RecordSets {
+		// records are listed starting with the name
+		if strings.EqualFold(set.Name, fqdn(name)) && set.Type == "A" {
+			return &set, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *Route53) change(ctx context.Context, zoneID string, c change) error {
+	body, err := xml.Marshal(changeRequest{Changes: []change{c}})
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(r.do(ctx, http.MethodPost, zonePath(zoneID), body, nil),
+		"%s record %s", strings.ToLower(c.Action), c.ResourceRecordSet.Name)
+}
+
+func (r *Route53) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, r.Endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+
+	if _, err = r.signer.Sign(req, bytes.NewReader(body), "route53", route53Region, time.Now()); err != nil {
+		return errors.Wrap(err, "sign request")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := errorResponse{}
+		if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+			return errors.Errorf("route53: %s", resp.Status)
+		}
+		return errors.Errorf("route53: %s: %s", e.Code, e.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, out)
+}
+
+func zonePath(zoneID string) string {
+	// ids are returned by the api with the prefix
+	zoneID = strings.TrimPrefix(zoneID, "/hostedzone/")
+	return fmt.Sprintf("/%s/hostedzone/%s/rrset", route53APIVersion, url.PathEscape(zoneID))
+}
+
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
@@ -0,0 +1,104 @@
+package awssdk
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute53_UpsertA(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		require.NotEmpty(t, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	r53, err := NewRoute53("key", "secret", "")
+	require.Nil(t, err)
+	r53.Endpoint = srv.URL
+
+	err = r53.UpsertA(context.Background(), "/hostedzone/Z1", "kube.example.com", 60, []string{"1.1.1.1", "2.2.2.2"})
+	require.Nil(t, err)
+	require.Equal(t, http.MethodPost, method)
+	require.Equal(t, "/2013-04-01/hostedzone/Z1/rrset", path)
+	require.Contains(t, body, "<Action>UPSERT</Action>")
+	require.Contains(t, body, "<Name>kube.example.com.</Name>")
+	require.Contains(t, body, "<Value>2.2.2.2</Value>")
+}
+
+func TestRoute53_DeleteA(t *testing.T) {
+	testCases := []struct {
+		description string
+		list        string
+		changeCode  int
+		deleted     bool
+		errMsg      string
+	}{
+		{
+			description: "missing record",
+			list:        `<ListResourceRecordSetsResponse><ResourceRecordSets></ResourceRecordSets></ListResourceRecordSetsResponse>`,
+		},
+		{
+			description: "another name",
+			list: `<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>
+<Name>other.example.com.</Name><Type>A</Type></ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`,
+		},
+		{
+			description: "change error",
+			list: `<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>
+<Name>kube.example.com.</Name><Type>A</Type><TTL>60</TTL></ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`,
+			changeCode: http.StatusBadRequest,
+			deleted:    true,
+			errMsg:     "InvalidChangeBatch",
+		},
+		{
+			description: "success",
+			list: `<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>
+<Name>kube.example.com.</Name><Type>A</Type><TTL>60</TTL></ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`,
+			changeCode: http.StatusOK,
+			deleted:    true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		deleted := false
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				w.Write([]byte(testCase.list))
+				return
+			}
+
+			data, _ := ioutil.ReadAll(r.Body)
+			deleted = strings.Contains(string(data), "<Action>DELETE</Action>")
+			w.WriteHeader(testCase.changeCode)
+			if testCase.changeCode >= http.StatusBadRequest {
+				w.Write([]byte(`<ErrorResponse><Error><Code>InvalidChangeBatch</Code><Message>bad</Message></Error></ErrorResponse>`))
+			}
+		}))
+
+		r53, err := NewRoute53("key", "secret", "")
+		require.Nil(t, err)
+		r53.Endpoint = srv.URL
+
+		err = r53.DeleteA(context.Background(), "Z1", "kube.example.com")
+		srv.Close()
+
+		require.Equal(t, testCase.deleted, deleted, testCase.description)
+		if testCase.errMsg == "" {
+			require.Nil(t, err, testCase.description)
+		} else {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+		}
+	}
+}
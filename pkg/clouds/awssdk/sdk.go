@@ -5,6 +5,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 )
 
 //SDK is a wrapper around aws client library handling concerns like authentication
@@ -36,6 +38,6 @@ func New(region string, keyID, secret, token string) (*SDK, error) {
 		return nil, err
 	}
 
-	sdk.EC2 = ec2.New(sess)
+	sdk.EC2 = ec2.New(apicalls.InstrumentAWS(sess))
 	return sdk, nil
 }
@@ -0,0 +1,192 @@
+package azuresdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/pkg/errors"
+)
+
+const (
+	managementBaseURI = "https://management.azure.com"
+	budgetsAPIVersion = "2019-10-01"
+)
+
+// Budget is a monthly cost budget of a resource group.
+type Budget struct {
+	Name   string
+	Amount float64
+	// Thresholds are percents of the amount alerts are sent at
+	Thresholds    []float64
+	ContactEmails []string
+
+	// CurrentSpend is actual cost of the current month, it's
+	// returned by the api only.
+	CurrentSpend float64
+	Currency     string
+}
+
+// BudgetsClient manages budgets of resource groups, the consumption
+// api is not a part of the vendored sdk.
+type BudgetsClient struct {
+	autorest.Client
+	BaseURI        string
+	SubscriptionID string
+}
+
+func (s *SDK) BudgetsClient() (BudgetsClient, error) {
+	a, err := s.Authorizer()
+	if err != nil {
+		return BudgetsClient{}, err
+	}
+
+	client := autorest.NewClientWithUserAgent("supergiant")
+	client.Authorizer = a
+
+	return BudgetsClient{
+		Client:         client,
+		BaseURI:        managementBaseURI,
+		SubscriptionID: s.SubscriptionID,
+	}, nil
+}
+
+type budgetNotification struct {
+	Enabled       bool     `json:"enabled"`
+	Operator      string   `json:"operator"`
+	Threshold     float64  `json:"threshold"`
+	ContactEmails []string `json:"contactEmails,omitempty"`
+	ContactRoles  []string `json:"contactRoles,omitempty"`
+}
+
+type budgetSpend struct {
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit"`
+}
+
+type budgetProperties struct {
+	Category   string  `json:"category"`
+	Amount     float64 `json:"amount"`
+	TimeGrain  string  `json:"timeGrain"`
+	TimePeriod struct {
+		StartDate string `json:"startDate"`
+	} `json:"timePeriod"`
+	Notifications map[string]budgetNotification `json:"notifications,omitempty"`
+	CurrentSpend  *budgetSpend                  `json:"currentSpend,omitempty"`
+}
+
+type budgetResource struct {
+	Name       string           `json:"name,omitempty"`
+	Properties budgetProperties `json:"properties"`
+}
+
+// CreateOrUpdate sets the budget of the resource group, the budget period
+// starts with the current month.
+func (c BudgetsClient) CreateOrUpdate(ctx context.Context, group string, b Budget) error {
+	body := budgetResource{
+		Properties: budgetProperties{
+			Category:      "Cost",
+			Amount:        b.Amount,
+			TimeGrain:     "Monthly",
+			Notifications: make(map[string]budgetNotification, len(b.Thresholds)),
+		},
+	}
+	now := time.Now().UTC()
+	body.Properties.TimePeriod.StartDate = time.Date(now.Year(), now.Month(), 1,
+		0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	for _, t := range b.Thresholds {
+		n := budgetNotification{
+			Enabled:       true,
+			Operator:      "GreaterThan",
+			Threshold:     t,
+			ContactEmails: b.ContactEmails,
+		}
+		// alerts need at least one recipient
+		if len(n.ContactEmails) == 0 {
+			n.ContactRoles = []string{"Owner"}
+		}
+		body.Properties.Notifications[fmt.Sprintf("Actual_GreaterThan_%g_Percent", t)] = n
+	}
+
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(c.BaseURI),
+		autorest.WithPathParameters(budgetPath, c.pathParameters(group, b.Name)),
+		autorest.WithJSON(body),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": budgetsAPIVersion}))
+	if err != nil {
+		return errors.Wrapf(err, "prepare budget %s", b.Name)
+	}
+
+	resp, err := autorest.SendWithSender(c, req, azure.DoRetryWithRegistration(c.Client))
+	if err != nil {
+		return errors.Wrapf(err, "create budget %s", b.Name)
+	}
+
+	return errors.Wrapf(autorest.Respond(resp,
+		c.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+		autorest.ByClosing()), "create budget %s", b.Name)
+}
+
+// Get returns the budget of the resource group with the current spend.
+func (c BudgetsClient) Get(ctx context.Context, group, name string) (*Budget, error) {
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(c.BaseURI),
+		autorest.WithPathParameters(budgetPath, c.pathParameters(group, name)),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": budgetsAPIVersion}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "prepare budget %s", name)
+	}
+
+	resp, err := autorest.SendWithSender(c, req, azure.DoRetryWithRegistration(c.Client))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get budget %s", name)
+	}
+
+	out := budgetResource{}
+	err = autorest.Respond(resp,
+		c.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&out),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, errors.Wrapf(err, "get budget %s", name)
+	}
+
+	b := &Budget{
+		Name:   name,
+		Amount: out.Properties.Amount,
+	}
+	for _, n := range out.Properties.Notifications {
+		b.Thresholds = append(b.Thresholds, n.Threshold)
+		if len(b.ContactEmails) == 0 {
+			b.ContactEmails = n.ContactEmails
+		}
+	}
+	sort.Float64s(b.Thresholds)
+	if spend := out.Properties.CurrentSpend; spend != nil {
+		b.CurrentSpend = spend.Amount
+		b.Currency = spend.Unit
+	}
+
+	return b, nil
+}
+
+const budgetPath = "/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}" +
+	"/providers/Microsoft.Consumption/budgets/{budgetName}"
+
+func (c BudgetsClient) pathParameters(group, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"subscriptionId":    autorest.Encode("path", c.SubscriptionID),
+		"resourceGroupName": autorest.Encode("path", group),
+		"budgetName":        autorest.Encode("path", name),
+	}
+}
@@ -113,3 +113,39 @@ func (s *SDK) GroupsClient() (resources.GroupsClient, error) {
 		BaseClient: bc,
 	}, nil
 }
+
+func (s *SDK) PeeringsClient() (network.VirtualNetworkPeeringsClient, error) {
+	a, err := s.Authorizer()
+	if err != nil {
+		return network.VirtualNetworkPeeringsClient{}, err
+	}
+
+	peeringsClient := network.NewVirtualNetworkPeeringsClient(s.SubscriptionID)
+	peeringsClient.Authorizer = a
+
+	return peeringsClient, nil
+}
+
+func (s *SDK) SecurityGroupsClient() (network.SecurityGroupsClient, error) {
+	a, err := s.Authorizer()
+	if err != nil {
+		return network.SecurityGroupsClient{}, err
+	}
+
+	sgClient := network.NewSecurityGroupsClient(s.SubscriptionID)
+	sgClient.Authorizer = a
+
+	return sgClient, nil
+}
+
+func (s *SDK) AvailabilitySetsClient() (compute.AvailabilitySetsClient, error) {
+	a, err := s.Authorizer()
+	if err != nil {
+		return compute.AvailabilitySetsClient{}, err
+	}
+
+	setsClient := compute.NewAvailabilitySetsClient(s.SubscriptionID)
+	setsClient.Authorizer = a
+
+	return setsClient, nil
+}
@@ -41,10 +41,14 @@ const (
 	GCEClientEmail = "client_email"
 	GCETokenURI    = "token_uri"
 
+	GCEMastersPlacementPolicy = "gce_masters_placement_policy"
+
 	ClusterIDTag = "supergiant.io/cluster-id"
 
 	AWSAccessKeyID              = "access_key"
 	AWSSecretKey                = "secret_key"
+	AWSProvisioning             = "provisioning"
+	AWSProvisioningStack        = "cloudformation"
 	AwsAZ                       = "aws_az"
 	AwsVpcCIDR                  = "aws_vpc_cidr"
 	AwsVpcID                    = "aws_vpc_id"
@@ -59,6 +63,12 @@ const (
 	AwsMasterInstanceProfile    = "aws_master_instance_profile"
 	AwsNodeInstanceProfile      = "aws_node_instance_profile"
 	AwsImageID                  = "aws_image_id"
+	AwsNATGatewayID             = "aws_nat_gateway_id"
+	AwsNATSubnetID              = "aws_nat_subnet_id"
+	AwsNATRouteTableID          = "aws_nat_route_table_id"
+	AwsEgressAllocationID       = "aws_egress_allocation_id"
+	AwsStackName                = "aws_stack_name"
+	AwsMastersPlacementGroup    = "aws_masters_placement_group"
 
 	// Use client credentials auth model for azure.
 	// https://github.com/Azure/azure-sdk-for-go#more-authentication-details
@@ -67,4 +77,8 @@ const (
 	AzureClientID       = "clientId"
 	AzureClientSecret   = "clientSecret"
 	AzureVNetName       = "azure_vnet_name"
+	AzureResourceGroup  = "azure_resource_group"
+	AzureSecurityGroup  = "azure_security_group"
+
+	AzureMastersAvailabilitySet = "azure_masters_availability_set"
 )
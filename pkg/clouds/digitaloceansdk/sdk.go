@@ -5,6 +5,7 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/sgerrors"
 )
@@ -49,6 +50,6 @@ func (s *SDK) GetClient() *godo.Client {
 	token := &TokenSource{
 		AccessToken: s.accessToken,
 	}
-	oauthClient := oauth2.NewClient(oauth2.NoContext, token)
+	oauthClient := oauth2.NewClient(apicalls.ClientContext(oauth2.NoContext), token)
 	return godo.NewClient(oauthClient)
 }
@@ -2,76 +2,144 @@ package controlplane
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"github.com/supergiant/control/pkg/workflows/steps/azure"
+	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/rakyll/statik/fs"
 	"github.com/sirupsen/logrus"
 	"k8s.io/helm/pkg/repo"
 
 	"github.com/supergiant/control/pkg/account"
+	"github.com/supergiant/control/pkg/activity"
+	"github.com/supergiant/control/pkg/agentca"
 	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/approval"
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/federation"
+	"github.com/supergiant/control/pkg/gitops"
+	"github.com/supergiant/control/pkg/guard"
+	"github.com/supergiant/control/pkg/idempotency"
+	"github.com/supergiant/control/pkg/ipam"
 	"github.com/supergiant/control/pkg/jwt"
 	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/ldap"
+	"github.com/supergiant/control/pkg/leader"
+	"github.com/supergiant/control/pkg/mesh"
+	"github.com/supergiant/control/pkg/migration"
+	"github.com/supergiant/control/pkg/notification"
+	"github.com/supergiant/control/pkg/onboarding"
+	"github.com/supergiant/control/pkg/peering"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/portal"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/provisioner"
 	"github.com/supergiant/control/pkg/proxy"
+	"github.com/supergiant/control/pkg/replacement"
 	sshRunner "github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/runtimeconfig"
+	"github.com/supergiant/control/pkg/saml"
+	"github.com/supergiant/control/pkg/session"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/sghelm"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/storage/etcd"
 	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/user"
+	"github.com/supergiant/control/pkg/versions"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps/amazon"
 	"github.com/supergiant/control/pkg/workflows/steps/authorizedKeys"
+	"github.com/supergiant/control/pkg/workflows/steps/bootstraptoken"
 	"github.com/supergiant/control/pkg/workflows/steps/certificates"
 	"github.com/supergiant/control/pkg/workflows/steps/clustercheck"
 	"github.com/supergiant/control/pkg/workflows/steps/cni"
+	"github.com/supergiant/control/pkg/workflows/steps/dashboardaddon"
+	"github.com/supergiant/control/pkg/workflows/steps/datavolumes"
 	"github.com/supergiant/control/pkg/workflows/steps/digitalocean"
 	"github.com/supergiant/control/pkg/workflows/steps/docker"
 	"github.com/supergiant/control/pkg/workflows/steps/downloadk8sbinary"
 	"github.com/supergiant/control/pkg/workflows/steps/drain"
+	"github.com/supergiant/control/pkg/workflows/steps/etcdmaintenance"
+	"github.com/supergiant/control/pkg/workflows/steps/files"
 	"github.com/supergiant/control/pkg/workflows/steps/gce"
+	"github.com/supergiant/control/pkg/workflows/steps/gitopsaddon"
 	"github.com/supergiant/control/pkg/workflows/steps/kubeadm"
 	"github.com/supergiant/control/pkg/workflows/steps/kubelet"
 	"github.com/supergiant/control/pkg/workflows/steps/network"
+	"github.com/supergiant/control/pkg/workflows/steps/patch"
 	"github.com/supergiant/control/pkg/workflows/steps/poststart"
 	"github.com/supergiant/control/pkg/workflows/steps/prometheus"
+	"github.com/supergiant/control/pkg/workflows/steps/snapshotaddon"
 	"github.com/supergiant/control/pkg/workflows/steps/ssh"
 	"github.com/supergiant/control/pkg/workflows/steps/storageclass"
+	"github.com/supergiant/control/pkg/workflows/steps/submariner"
 	"github.com/supergiant/control/pkg/workflows/steps/tiller"
+	"github.com/supergiant/control/pkg/workflows/steps/uncordon"
+	"github.com/supergiant/control/pkg/workflows/steps/upgrade"
+	"github.com/supergiant/control/pkg/workflows/steps/wireguard"
 	_ "github.com/supergiant/control/statik"
 )
 
+// DefaultShutdownTimeout is used when Config.ShutdownTimeout is not set.
+const DefaultShutdownTimeout = 5 * time.Minute
+
 type Server struct {
 	server http.Server
 	cfg    *Config
+
+	// stop cancels background jobs, jobs holding state
+	// in storage are waited for on shutdown.
+	stop context.CancelFunc
+	jobs *sync.WaitGroup
 }
 
 func (srv *Server) Start() {
 	err := srv.server.ListenAndServe()
-	if err != nil {
-		logrus.Error(err)
+	if err != nil && err != http.ErrServerClosed {
+		logrus.Fatal(err)
 	}
 }
 
+// Shutdown stops accepting requests and lets running tasks finish their
+// current steps, the rest of the steps is resumed by another replica.
 func (srv *Server) Shutdown() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*1)
+	timeout := srv.cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	err := srv.server.Shutdown(ctx)
 
 	if err != nil {
 		logrus.Error(err)
 	}
+
+	workflows.Drain()
+	if err = workflows.WaitStopped(ctx); err != nil {
+		logrus.Errorf("tasks haven't stopped in %v: %v", timeout, err)
+	}
+
+	// queued tasks and the leader lease are released for other replicas
+	if srv.stop != nil {
+		srv.stop()
+		srv.jobs.Wait()
+	}
 }
 
 // Config is the server configuration
@@ -83,14 +151,116 @@ type Config struct {
 	TemplatesDir  string
 	SpawnInterval time.Duration
 
+	// EtcdConfig holds tls and auth settings of the etcd storage,
+	// endpoints are taken from StorageURI.
+	EtcdConfig etcd.Config
+
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 
+	// MaxRequestSize limits bodies of api requests in bytes, MaxUploadSize
+	// limits requests carrying big payloads, e.g. chart values files.
+	MaxRequestSize int64
+	MaxUploadSize  int64
+
 	PprofListenStr string
 
 	ProxiesPortRange proxy.PortRange
 
+	// EtcdMaintenanceInterval is a period of etcd compaction and
+	// defragmentation on managed clusters, zero disables it.
+	EtcdMaintenanceInterval time.Duration
+
+	// MeshSyncInterval is a period of adding new nodes of clusters to
+	// wireguard meshes and rotating expired keys, zero disables it.
+	MeshSyncInterval time.Duration
+	// MeshKeyTTL is how long wireguard keys of mesh nodes are used.
+	MeshKeyTTL time.Duration
+
+	// RightSizingInterval is a period of resource usage analysis
+	// on managed clusters, zero disables it.
+	RightSizingInterval time.Duration
+	// RightSizingWindow is a time range usage is averaged over.
+	RightSizingWindow time.Duration
+
+	// HealthCheckInterval is a period of checking api servers and nodes
+	// of managed clusters for uptime monitors, zero disables it.
+	HealthCheckInterval time.Duration
+
+	// FleetMetricsInterval is a period of scraping prometheus of managed
+	// clusters for fleet series exposed on /metrics, zero disables it.
+	FleetMetricsInterval time.Duration
+	// MetricsToken is a bearer token scrapers present to /metrics,
+	// empty disables the endpoint.
+	MetricsToken string
+
+	// ReleaseCheckInterval is a period of helm release status checks
+	// on managed clusters, zero disables it.
+	ReleaseCheckInterval time.Duration
+	// ReleasePendingThreshold is how long a release may stay pending
+	// before the notification is sent.
+	ReleasePendingThreshold time.Duration
+	// NotificationWebhookURL receives events as json, events are
+	// written to the log when it is empty.
+	NotificationWebhookURL string
+
+	// AutoUpgradeInterval is a period of looking for patch upgrades of
+	// clusters that have opted in to them, zero disables it.
+	AutoUpgradeInterval time.Duration
+
+	// GitOpsSyncInterval is a period of reconciling clusters with
+	// bound git repositories, zero disables periodic sync.
+	GitOpsSyncInterval time.Duration
+	// GitOpsWorkdir keeps working copies of bound repositories.
+	GitOpsWorkdir string
+
+	// TaskPruneInterval is a period of applying the task retention
+	// policy, zero disables periodic pruning.
+	TaskPruneInterval time.Duration
+	// FeatureReloadInterval is a period of reloading feature flags
+	// changed by other instances, zero disables reloading.
+	FeatureReloadInterval time.Duration
+
+	// RuntimeConfigFile holds settings applied without restart, they are
+	// read from storage when it is empty.
+	RuntimeConfigFile string
+	// RuntimeConfigInterval is a period of checking runtime settings
+	// for changes, zero disables reloading.
+	RuntimeConfigInterval time.Duration
+
+	// AdvertiseURL is an address other replicas forward requests to when
+	// this one leads, http://<hostname>:<port> is used if it is empty.
+	AdvertiseURL string
+	// LeaseDuration is how long the leader keeps its role without renewal,
+	// another replica takes over when it expires.
+	LeaseDuration time.Duration
+
+	// WorkerSlots is a number of queued tasks this replica runs at once,
+	// zero leaves queued tasks to other replicas.
+	WorkerSlots int
+	// TaskLease is how long a worker holds a task without a heartbeat,
+	// another worker resumes the task when it expires.
+	TaskLease time.Duration
+
+	// CloudAPIBudget is a number of cloud API calls per minute an account
+	// may make before background jobs are slowed down, zero disables it.
+	CloudAPIBudget int
+
+	// SSHAgentSocket is a path to the ssh-agent imported machines are
+	// reached with, empty disables the agent.
+	SSHAgentSocket string
+
+	// AgentPort is a tcp port node agents connect to with mutual TLS,
+	// zero disables the endpoint.
+	AgentPort int
+	// AgentCertTTL is how long certificates of node agents are valid.
+	AgentCertTTL time.Duration
+
+	// ShutdownTimeout limits how long running tasks are waited for
+	// to finish their current steps on shutdown.
+	ShutdownTimeout time.Duration
+
 	Version string
 }
 
@@ -99,12 +269,17 @@ func New(cfg *Config) (*Server, error) {
 		return nil, err
 	}
 
-	r, err := configureApplication(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := &sync.WaitGroup{}
+	r, err := configureApplication(ctx, cfg, jobs)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	s := NewServer(r, cfg)
+	s.stop = cancel
+	s.jobs = jobs
 
 	return s, nil
 }
@@ -151,26 +326,76 @@ func validate(cfg *Config) error {
 	return nil
 }
 
-func configureApplication(cfg *Config) (*mux.Router, error) {
+func configureApplication(ctx context.Context, cfg *Config, jobs *sync.WaitGroup) (*mux.Router, error) {
 	//TODO will work for now, but we should revisit ETCD configuration later
 	router := mux.NewRouter()
 
 	protectedAPI := router.PathPrefix("/v1/api").Subrouter()
-	repository, err := storage.GetStorage(cfg.StorageMode, cfg.StorageURI)
+
+	apicalls.Default.SetDefaultBudget(cfg.CloudAPIBudget)
+	repository, err := storage.GetStorage(cfg.StorageMode, cfg.StorageURI, cfg.EtcdConfig)
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "get storage type %s uri %s",
 			cfg.StorageMode, cfg.StorageURI)
 	}
 
-	accountService := account.NewService(account.DefaultStoragePrefix, repository)
+	if err = migrate(context.Background(), repository); err != nil {
+		return nil, errors.Wrap(err, "migrate storage")
+	}
+
+	elector, err := newElector(cfg, repository)
+	if err != nil {
+		return nil, errors.Wrap(err, "leader election")
+	}
+	leaderHandler := leader.NewHandler(elector)
+	leaderHandler.Register(protectedAPI)
+
+	featureService := featureflag.NewService(featureflag.DefaultStoragePrefix, repository)
+	if err = featureService.Reload(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "load feature flags")
+	}
+	if cfg.FeatureReloadInterval > 0 {
+		go featureService.Run(ctx, cfg.FeatureReloadInterval)
+	}
+	featureHandler := featureflag.NewHandler(featureService)
+	featureHandler.Register(protectedAPI)
+
+	// clusters, cloud accounts, profiles and records that belong to them are
+	// isolated by tenant of the request. Services built on the repository
+	// itself isolate tenants in other ways or aren't owned by tenants:
+	//   - users are kept under prefixes of their tenants by the user service;
+	//   - sessions, roles, directories, feature flags, the version catalog,
+	//     runtime config, the allow list and helm repositories are settings
+	//     of control itself changed by admins of the default tenant;
+	//   - tasks, replacements, portals and gitops bindings carry a tenant id
+	//     that requests are checked against and jobs run them with;
+	//   - activity, console sessions, health, right-sizing history and agent
+	//     certificates are keyed by clusters and read after the cluster is got
+	//     within the tenant, health tokens are looked up before the tenant
+	//     is known;
+	//   - idempotency keys are scoped to tenants and users, network ranges
+	//     are allocated from pools of the tenant that must not overlap.
+	tenantRepository := tenant.NewStorage(repository)
+
+	accountService := account.NewService(account.DefaultStoragePrefix, tenantRepository)
 	accountHandler := account.NewHandler(accountService)
 	accountHandler.Register(protectedAPI)
 
 	//TODO Add generation of jwt token
 	jwtService := jwt.NewTokenService(86400, []byte("test"))
+	// tokens of logins belong to sessions that may be revoked
+	sessionService := session.NewService(session.DefaultStoragePrefix, repository, jwtService)
+	roleService := permission.NewService(permission.DefaultStoragePrefix, repository)
+	permission.NewHandler(roleService).Register(protectedAPI)
+	session.NewHandler(sessionService, roleService).Register(protectedAPI)
+	elector.OnElected(func(ctx context.Context) {
+		sessionService.Run(ctx, session.DefaultPruneInterval)
+	})
+
 	userService := user.NewService(user.DefaultStoragePrefix, repository)
-	userHandler := user.NewHandler(userService, jwtService)
+	userHandler := user.NewHandler(userService, sessionService)
+	userHandler.SetRoles(roleService)
 
 	router.HandleFunc("/version", NewVersionHandler(cfg.Version))
 	router.HandleFunc("/auth", userHandler.Authenticate).Methods(http.MethodPost)
@@ -178,7 +403,17 @@ func configureApplication(cfg *Config) (*mux.Router, error) {
 	router.HandleFunc("/coldstart", userHandler.IsColdStart).Methods(http.MethodGet)
 	protectedAPI.HandleFunc("/users", userHandler.Create).Methods(http.MethodPost)
 
-	profileService := profile.NewService(profile.DefaultKubeProfilePreifx, repository)
+	ldapService := ldap.NewService(ldap.DefaultStoragePrefix, repository, userService)
+	userHandler.SetDirectory(ldapService)
+	elector.OnElected(ldapService.Run)
+	ldap.NewHandler(ldapService).Register(protectedAPI)
+
+	samlHandler := saml.NewHandler(saml.NewService(saml.DefaultStoragePrefix, repository),
+		userService, sessionService)
+	samlHandler.Register(router)
+	samlHandler.RegisterConfig(protectedAPI)
+
+	profileService := profile.NewService(profile.DefaultKubeProfilePreifx, tenantRepository)
 	kubeProfileHandler := profile.NewHandler(profileService)
 	kubeProfileHandler.Register(protectedAPI)
 
@@ -191,6 +426,7 @@ func configureApplication(cfg *Config) (*mux.Router, error) {
 	certificates.Init()
 	authorizedKeys.Init()
 	cni.Init()
+	datavolumes.Init()
 	docker.Init()
 	downloadk8sbinary.Init()
 	kubelet.Init()
@@ -200,10 +436,21 @@ func configureApplication(cfg *Config) (*mux.Router, error) {
 	network.Init()
 	clustercheck.Init()
 	prometheus.Init()
+	gitopsaddon.Init()
+	dashboardaddon.Init()
+	snapshotaddon.Init()
 	gce.Init()
 	storageclass.Init()
 	drain.Init()
+	etcdmaintenance.Init()
+	wireguard.Init()
+	submariner.Init()
+	uncordon.Init()
+	patch.Init()
+	files.Init()
+	upgrade.Init()
 	kubeadm.Init()
+	bootstraptoken.Init()
 	azure.Init()
 
 	amazon.InitFindAMI(amazon.GetEC2)
@@ -226,10 +473,30 @@ func configureApplication(cfg *Config) (*mux.Router, error) {
 	amazon.InitDeleteRouteTable(amazon.GetEC2)
 	amazon.InitDeleteInternetGateWay(amazon.GetEC2)
 	amazon.InitDeleteKeyPair(amazon.GetEC2)
+	amazon.InitCreateVPCPeering(amazon.GetEC2, amazon.GetAccountID)
+	amazon.InitCreatePeeringRoutes(amazon.GetEC2)
+	amazon.InitDeleteVPCPeering(amazon.GetEC2)
+	amazon.InitAllowWireGuard(amazon.GetEC2)
+	amazon.InitUpdateDNS(amazon.GetRoute53)
+	amazon.InitCreateNATGateway(amazon.GetEC2)
+	amazon.InitDeleteNATGateway(amazon.GetEC2)
+	amazon.InitUpdateFirewall(amazon.GetEC2)
+	amazon.InitRestrictAPIServer(amazon.GetEC2)
+	amazon.InitDeleteVolumes(amazon.GetEC2)
+	amazon.InitCreateStack(amazon.GetCloudFormation, accountService)
+	amazon.InitDeleteStack(amazon.GetCloudFormation)
+	amazon.InitCreatePlacementGroup(amazon.GetEC2)
+	amazon.InitDeletePlacementGroup(amazon.GetEC2)
 	workflows.Init()
 
 	taskHandler := workflows.NewTaskHandler(repository, sshRunner.NewRunner, accountService)
 	taskHandler.Register(protectedAPI)
+	if cfg.TaskPruneInterval > 0 {
+		pruner := workflows.NewPruner(repository)
+		elector.OnElected(func(ctx context.Context) {
+			pruner.Run(ctx, cfg.TaskPruneInterval)
+		})
+	}
 
 	helmService, err := sghelm.NewService(repository)
 	if err != nil {
@@ -245,26 +512,254 @@ func configureApplication(cfg *Config) (*mux.Router, error) {
 	helmHandler.Register(protectedAPI)
 
 	kubeService := kube.NewService(kube.DefaultStoragePrefix,
-		repository, helmService)
+		tenantRepository, helmService)
+
+	agentService := agentca.NewService(agentca.DefaultStoragePrefix, repository,
+		kubeService, cfg.AgentCertTTL)
+	agentHandler := agentca.NewHandler(agentService)
+	agentHandler.Register(protectedAPI)
+	if cfg.AgentPort > 0 {
+		if err = serveAgents(ctx, cfg, agentService, agentHandler); err != nil {
+			return nil, errors.Wrap(err, "agent endpoint")
+		}
+	}
 
 	taskProvisioner := provisioner.NewProvisioner(repository,
 		kubeService,
 		cfg.SpawnInterval)
+	lease := cfg.TaskLease
+	if lease == 0 {
+		lease = workflows.DefaultTaskLease
+	}
+	queue, err := workflows.NewQueue(repository)
+	if err != nil {
+		logrus.Warnf("node tasks run by the control process itself: %v", err)
+		queue = nil
+	} else {
+		queue.SetLimits(accountService)
+		taskProvisioner.UseQueue(queue)
+		if cfg.WorkerSlots > 0 {
+			worker := workflows.NewWorker(elector.ID(), queue, repository,
+				cfg.WorkerSlots, lease, taskProvisioner.ExecuteTask)
+			jobs.Add(1)
+			go func() {
+				defer jobs.Done()
+				worker.Run(ctx)
+			}()
+		}
+	}
+	elector.OnElected(func(ctx context.Context) {
+		resumeInterrupted(ctx, repository, queue, taskProvisioner, lease)
+	})
 	provisionHandler := provisioner.NewHandler(kubeService, accountService,
-		profileService, taskProvisioner)
+		profileService, taskProvisioner, featureService)
 	provisionHandler.Register(protectedAPI)
+
+	versionService := versions.NewService(versions.DefaultStoragePrefix, repository)
+	provisionHandler.UseVersions(versionService)
+	if cfg.SSHAgentSocket != "" {
+		provisionHandler.UseSSHAgent(cfg.SSHAgentSocket)
+	}
+	versions.NewHandler(versionService).Register(protectedAPI)
+
+	ipamService, err := ipam.NewService(ipam.DefaultStoragePrefix, repository,
+		kubeService, ipam.DefaultPools)
+	if err != nil {
+		logrus.Warnf("network ranges of clusters are not managed: %v", err)
+	} else {
+		provisionHandler.UseIPAM(ipamService)
+		ipam.NewHandler(ipamService).Register(protectedAPI)
+	}
+
+	peeringService := peering.NewService(peering.DefaultStoragePrefix,
+		tenantRepository, kubeService, accountService, repository)
+	peering.NewHandler(peeringService).Register(protectedAPI)
+
+	meshService := mesh.NewService(mesh.DefaultStoragePrefix, tenantRepository,
+		kubeService, accountService, repository, cfg.MeshKeyTTL)
+	mesh.NewHandler(meshService).Register(protectedAPI)
+
+	onboarding.NewHandler().Register(protectedAPI)
+
+	if cfg.MeshSyncInterval > 0 {
+		elector.OnElected(func(ctx context.Context) {
+			meshService.Run(ctx, cfg.MeshSyncInterval)
+		})
+	}
+
+	federationService := federation.NewService(federation.DefaultStoragePrefix,
+		tenantRepository, kubeService, accountService, repository)
+	federation.NewHandler(federationService).Register(protectedAPI)
+
+	replacementService := replacement.NewService(replacement.DefaultStoragePrefix, repository,
+		kubeService, profileService, accountService, taskProvisioner, repository)
+	replacement.NewHandler(replacementService).Register(protectedAPI)
+	elector.OnElected(func(ctx context.Context) {
+		replacementService.Run(ctx, replacement.DefaultInterval)
+	})
+
 	apiProxy := proxy.NewReverseProxyContainer(cfg.ProxiesPortRange,
 		logrus.New().WithField("component", "proxy"))
 
 	kubeHandler := kube.NewHandler(kubeService, accountService,
 		profileService, taskProvisioner, taskProvisioner,
 		repository, apiProxy)
+	kubeHandler.UseVersions(versionService)
 	kubeHandler.Register(protectedAPI)
 
+	activityService := activity.NewService(activity.DefaultStoragePrefix,
+		repository, repository, kubeService)
+	kubeService.OnHelmOperationDone(activityService.OnHelmOperation)
+	activityHandler := activity.NewHandler(activityService)
+	activityHandler.Register(protectedAPI)
+
+	consoleHandler := kube.NewConsoleHandler(kubeService, repository)
+	consoleHandler.OnSession(activityService.OnConsoleSession)
+	consoleHandler.Register(protectedAPI)
+
+	nodeExecutor := kube.NewNodeExecutor(kubeService)
+	nodeExecutor.OnExec(activityService.OnNodeExec)
+	nodeExecutor.Register(protectedAPI)
+
+	fileDistributor := kube.NewFileDistributor(kubeService, accountService, repository)
+	fileDistributor.Register(protectedAPI)
+
+	// the allow list protects the api and logins, the ui is served to anyone
+	guardService := guard.NewService(guard.DefaultStoragePrefix, repository, activityService)
+	guardHandler := guard.NewHandler(guardService, "/v1/api", "/auth", "/root", "/coldstart", "/saml/", "/webhooks/", "/health/")
+	guardHandler.Register(protectedAPI)
+	userHandler.SetLimiter(guardService)
+	router.Use(guardHandler.AllowList)
+	elector.OnElected(func(ctx context.Context) {
+		guardService.Run(ctx, guard.DefaultPruneInterval)
+	})
+
+	idempotencyService := idempotency.NewService(idempotency.DefaultStoragePrefix,
+		repository, idempotency.DefaultTTL)
+	idempotencyHandler := idempotency.NewHandler(idempotencyService)
+	elector.OnElected(func(ctx context.Context) {
+		idempotencyService.Run(ctx, idempotency.DefaultPruneInterval)
+	})
+
+	approvalService := approval.NewService(approval.DefaultStoragePrefix, tenantRepository)
+	approvalHandler := approval.NewHandler(approvalService, kubeService, protectedAPI)
+	approvalHandler.Register(protectedAPI)
+	replacementService.SetApprovals(approvalService)
+
+	if cfg.EtcdMaintenanceInterval > 0 {
+		etcdMaintainer := kube.NewEtcdMaintainer(kubeService, accountService,
+			repository, cfg.EtcdMaintenanceInterval)
+		elector.OnElected(etcdMaintainer.Run)
+	}
+
+	rightSizer := kube.NewRightSizer(kubeService, repository,
+		cfg.RightSizingWindow, cfg.RightSizingInterval)
+	rightSizingHandler := kube.NewRightSizingHandler(kubeService, rightSizer)
+	rightSizingHandler.Register(protectedAPI)
+	if cfg.RightSizingInterval > 0 {
+		elector.OnElected(rightSizer.Run)
+	}
+
+	// uptime monitors read health of clusters with tokens, tokens are
+	// looked up before the tenant is known
+	healthMonitor := kube.NewHealthMonitor(kubeService, repository, cfg.HealthCheckInterval)
+	healthHandler := kube.NewHealthHandler(kubeService, healthMonitor)
+	healthHandler.Register(protectedAPI)
+	healthHandler.RegisterPublic(router)
+	if cfg.HealthCheckInterval > 0 {
+		elector.OnElected(healthMonitor.Run)
+	}
+
+	metrics := []metricsWriter{apicalls.Default}
+	if cfg.FleetMetricsInterval > 0 {
+		fleetMetrics := kube.NewFleetMetrics(kubeService, cfg.FleetMetricsInterval)
+		elector.OnElected(fleetMetrics.Run)
+		metrics = append(metrics, fleetMetrics)
+	}
+	// series name clusters of all tenants, they are shown only to scrapers
+	if cfg.MetricsToken != "" {
+		router.Handle("/metrics", metricsHandler(cfg.MetricsToken, metrics...)).Methods(http.MethodGet)
+	}
+
+	webhook := notification.NewWebhook(cfg.NotificationWebhookURL)
+	if cfg.ReleaseCheckInterval > 0 {
+		publishers := notification.Multi{notification.LogPublisher{}, webhook}
+		releaseWatcher := kube.NewReleaseWatcher(kubeService, publishers,
+			cfg.ReleaseCheckInterval, cfg.ReleasePendingThreshold)
+		elector.OnElected(releaseWatcher.Run)
+	}
+	if cfg.AutoUpgradeInterval > 0 {
+		autoUpgrader := kube.NewAutoUpgrader(kubeService, accountService, repository,
+			versionService, notification.Multi{notification.LogPublisher{}, webhook},
+			cfg.AutoUpgradeInterval)
+		elector.OnElected(autoUpgrader.Run)
+	}
+
+	gitopsService := gitops.NewService(gitops.DefaultStoragePrefix, repository,
+		kubeService, cfg.GitOpsWorkdir)
+	gitopsHandler := gitops.NewHandler(gitopsService)
+	gitopsHandler.Register(protectedAPI)
+	if cfg.GitOpsSyncInterval > 0 {
+		elector.OnElected(func(ctx context.Context) {
+			gitopsService.Run(ctx, cfg.GitOpsSyncInterval)
+		})
+	}
+
+	// portals provision clusters with signed webhooks, clusters are
+	// started by the leader like ones requested through the api
+	portalService := portal.NewService(portal.DefaultStoragePrefix, repository, kubeService)
+	portalHandler := portal.NewHandler(portalService, http.HandlerFunc(provisionHandler.Provision))
+	portalHandler.RegisterConfig(protectedAPI)
+	webhooks := router.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(leaderHandler.Forward)
+	portalHandler.Register(webhooks)
+	elector.OnElected(func(ctx context.Context) {
+		portalService.Run(ctx, portal.DefaultInterval)
+	})
+
+	configSource := runtimeconfig.StorageSource(repository,
+		runtimeconfig.DefaultStoragePrefix, runtimeconfig.DefaultStorageKey)
+	if cfg.RuntimeConfigFile != "" {
+		configSource = runtimeconfig.FileSource(cfg.RuntimeConfigFile)
+	}
+	configWatcher := runtimeconfig.NewWatcher(configSource, runtimeconfig.Settings{
+		LogLevel:               logrus.GetLevel().String(),
+		SpawnInterval:          cfg.SpawnInterval.String(),
+		NotificationWebhookURL: cfg.NotificationWebhookURL,
+	})
+	configWatcher.OnChange(func(settings runtimeconfig.Settings) error {
+		// settings are validated before they are applied
+		level, _ := logrus.ParseLevel(settings.LogLevel)
+		logrus.SetLevel(level)
+		taskProvisioner.SetSpawnInterval(settings.SpawnDuration())
+		kubeService.SetFleetConcurrency(settings.FleetConcurrency)
+		webhook.SetURL(settings.NotificationWebhookURL)
+		return nil
+	})
+	if _, err = configWatcher.Reload(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "load runtime config")
+	}
+	if cfg.RuntimeConfigInterval > 0 {
+		go configWatcher.Run(ctx, cfg.RuntimeConfigInterval)
+	}
+
 	authMiddleware := api.Middleware{
 		TokenService: jwtService,
+		Sessions:     sessionService,
+		Roles:        roleService,
 	}
-	protectedAPI.Use(authMiddleware.AuthMiddleware, api.ContentTypeJSON)
+	// bodies are limited before any middleware reads them
+	bodyLimit := api.NewBodyLimit(cfg.MaxRequestSize, cfg.MaxUploadSize,
+		"/kubes/{kubeID}/releases", "/kubes/{kubeID}/releases/{releaseName}", "/gitops")
+	protectedAPI.Use(bodyLimit.Limit, authMiddleware.AuthMiddleware, api.ContentTypeJSON,
+		leaderHandler.Forward, kubeHandler.MaintenanceGate, idempotencyHandler.Dedupe,
+		approvalHandler.Gate, activityHandler.Audit)
+	// all background jobs have been registered
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		elector.Run(ctx)
+	}()
 
 	if cfg.PprofListenStr != "" {
 		go func() {
@@ -308,6 +803,134 @@ func ensureHelmRepositories(svc sghelm.Servicer) {
 
 }
 
+// resumeInterrupted picks up tasks stopped by shutdown of a replica, they are
+// put to the queue or run by the leader when the storage has no queue.
+func resumeInterrupted(ctx context.Context, repository storage.Interface,
+	queue *workflows.Queue, tp *provisioner.TaskProvisioner, interval time.Duration) {
+	resumed := make(map[string]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tasks, err := workflows.Interrupted(ctx, repository)
+		if err != nil {
+			logrus.Errorf("list interrupted tasks: %v", err)
+		}
+
+		for _, t := range tasks {
+			if resumed[t.ID] {
+				continue
+			}
+
+			if queue != nil {
+				err = queue.Resume(ctx, t)
+				if err != nil && !sgerrors.IsAlreadyExists(err) {
+					logrus.Errorf("resume task %s: %v", t.ID, err)
+					continue
+				}
+			} else {
+				go func(t *workflows.Task) {
+					taskCtx := tenant.WithID(ctx, t.TenantID)
+					if err := tp.ExecuteTask(taskCtx, t); err != nil {
+						logrus.Errorf("resumed task %s: %v", t.ID, err)
+					}
+				}(t)
+			}
+			logrus.Infof("interrupted task %s has been resumed", t.ID)
+			resumed[t.ID] = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveAgents listens for node agents with mutual TLS until ctx is done.
+func serveAgents(ctx context.Context, cfg *Config, svc *agentca.Service, h *agentca.Handler) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return errors.Wrap(err, "get hostname")
+	}
+	hosts := []string{hostname}
+	if u, err := url.Parse(cfg.AdvertiseURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	tlsConfig, err := svc.TLSConfig(ctx, hosts)
+	if err != nil {
+		return err
+	}
+
+	router := mux.NewRouter()
+	h.RegisterAgent(router)
+	srv := &http.Server{
+		Handler:      handlers.RecoveryHandler()(router),
+		Addr:         fmt.Sprintf("%s:%d", cfg.Addr, cfg.AgentPort),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		logrus.Infof("agent endpoint listens on %s", srv.Addr)
+		if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("agent endpoint: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// newElector constructs an elector of the replica, replicas are told apart
+// by the hostname and a random suffix so restarted ones don't reuse a lease.
+func newElector(cfg *Config, repository storage.Interface) (*leader.Elector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "get hostname")
+	}
+
+	address := cfg.AdvertiseURL
+	if address == "" {
+		address = fmt.Sprintf("http://%s:%d", hostname, cfg.Port)
+	}
+
+	duration := cfg.LeaseDuration
+	if duration == 0 {
+		duration = leader.DefaultLeaseDuration
+	}
+
+	return leader.NewElector(fmt.Sprintf("%s-%s", hostname, uuid.New()[:8]),
+		address, repository, duration), nil
+}
+
+// migrate upgrades stored records to the latest schema versions, services
+// also upgrade records on read, e.g. ones restored from a backup.
+func migrate(ctx context.Context, repository storage.Interface) error {
+	for _, m := range []struct {
+		prefix   string
+		migrator *migration.Migrator
+	}{
+		{account.DefaultStoragePrefix, account.Migrator},
+		{kube.DefaultStoragePrefix, kube.Migrator},
+		{workflows.Prefix, workflows.Migrator},
+		{user.DefaultStoragePrefix, user.Migrator},
+	} {
+		if _, err := m.migrator.Run(ctx, repository, m.prefix); err != nil {
+			return errors.Wrapf(err, "migrate %s", m.prefix)
+		}
+	}
+
+	return nil
+}
+
 func serveUI(cfg *Config, router *mux.Router) error {
 	statikFS, err := fs.New()
 	if err != nil {
@@ -344,6 +967,30 @@ func trimPrefix(h http.Handler) http.Handler {
 	})
 }
 
+type metricsWriter interface {
+	WriteMetrics(w io.Writer) error
+}
+
+// metricsHandler exposes series of all writers on a single prometheus endpoint
+// to callers that present the token.
+func metricsHandler(token string, writers ...metricsWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, mw := range writers {
+			if err := mw.WriteMetrics(w); err != nil {
+				logrus.Errorf("write metrics: %v", err)
+				return
+			}
+		}
+	})
+}
+
 func NewVersionHandler(version string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, version)
@@ -1,6 +1,7 @@
 package controlplane
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -136,3 +137,55 @@ func TestNewVersionHandler(t *testing.T) {
 			rec.Body.String(), version)
 	}
 }
+
+type fakeMetrics string
+
+func (m fakeMetrics) WriteMetrics(w io.Writer) error {
+	_, err := io.WriteString(w, string(m))
+	return err
+}
+
+func TestMetricsHandler(t *testing.T) {
+	h := metricsHandler("token", fakeMetrics("calls 1\n"), fakeMetrics("nodes 3\n"))
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		{
+			name:         "no token",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			authorization: "Bearer wrong",
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "scraper",
+			authorization: "Bearer token",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "calls 1\nnodes 3\n",
+		},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tc.expectedCode {
+			t.Errorf("TC: %s: wrong response code expected %d actual %d",
+				tc.name, tc.expectedCode, rec.Code)
+		}
+
+		if rec.Body.String() != tc.expectedBody {
+			t.Errorf("TC: %s: wrong series expected %q actual %q",
+				tc.name, tc.expectedBody, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package featureflag
+
+import (
+	"sort"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+// Known flags, experimental capabilities check them before they are used.
+const (
+	AllowEOLVersions  = "allow-eol-versions"
+	Helm3Backend      = "helm3-backend"
+	IPAM              = "ipam"
+	ParallelWorkflows = "parallel-workflows"
+	ProviderAzure     = "provider-azure"
+)
+
+// Flag gates a capability for the whole installation, Tenants override
+// the installation wide value for particular tenants.
+type Flag struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Enabled     bool            `json:"enabled"`
+	Tenants     map[string]bool `json:"tenants,omitempty"`
+}
+
+// enabledFor returns the value of the flag for the tenant.
+func (f Flag) enabledFor(tenantID string) bool {
+	if enabled, ok := f.Tenants[tenantID]; ok {
+		return enabled
+	}
+	return f.Enabled
+}
+
+// defaults are values of known flags that haven't been configured.
+var defaults = []Flag{
+	{
+		Name:        AllowEOLVersions,
+		Description: "provision kubernetes versions past their end of life",
+	},
+	{
+		Name:        Helm3Backend,
+		Description: "manage releases with helm 3 instead of tiller",
+	},
+	{
+		Name:        IPAM,
+		Description: "assign network ranges of new clusters that don't overlap with other clusters",
+	},
+	{
+		Name:        ParallelWorkflows,
+		Description: "run independent workflow steps concurrently",
+	},
+	{
+		Name:        ProviderAzure,
+		Description: "provision clusters on azure",
+	},
+}
+
+// providerFlags gate providers that are not ready for general use.
+var providerFlags = map[clouds.Name]string{
+	clouds.Azure: ProviderAzure,
+}
+
+// ProviderFlag returns a flag that gates the provider, ok is false
+// if the provider is generally available.
+func ProviderFlag(provider clouds.Name) (string, bool) {
+	name, ok := providerFlags[provider]
+	return name, ok
+}
+
+func defaultFlags() map[string]Flag {
+	flags := make(map[string]Flag, len(defaults))
+	for _, f := range defaults {
+		flags[f.Name] = f
+	}
+	return flags
+}
+
+func sorted(flags map[string]Flag) []Flag {
+	out := make([]Flag, 0, len(flags))
+	for _, f := range flags {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
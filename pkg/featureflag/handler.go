@@ -0,0 +1,122 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// Servicer is an interface of the feature flag service.
+type Servicer interface {
+	Enabled(ctx context.Context, name string) bool
+	List(ctx context.Context) []Flag
+	Get(ctx context.Context, name string) (*Flag, error)
+	Set(ctx context.Context, f Flag) (*Flag, error)
+}
+
+// Handler is a http handler for feature flags.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds feature flag handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/features", h.listFlags).Methods(http.MethodGet)
+	r.HandleFunc("/features/{name}", h.getFlag).Methods(http.MethodGet)
+	r.HandleFunc("/features/{name}", h.setFlag).Methods(http.MethodPut)
+}
+
+// listFlags returns flags, tenants see only values that apply to them.
+func (h *Handler) listFlags(w http.ResponseWriter, r *http.Request) {
+	flags := h.svc.List(r.Context())
+	for i := range flags {
+		flags[i] = h.view(r.Context(), flags[i])
+	}
+
+	if err := json.NewEncoder(w).Encode(flags); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getFlag(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	f, err := h.svc.Get(r.Context(), name)
+	if err != nil {
+		sendError(w, name, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(h.view(r.Context(), *f)); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// setFlag changes a flag for the installation and tenants, it's allowed
+// to admins of the default tenant only.
+func (h *Handler) setFlag(w http.ResponseWriter, r *http.Request) {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "feature flags are managed by admins of the default tenant", http.StatusForbidden)
+		return
+	}
+
+	f := Flag{}
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	f.Name = mux.Vars(r)["name"]
+
+	updated, err := h.svc.Set(r.Context(), f)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			sendError(w, f.Name, err)
+			return
+		}
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	logrus.Infof("featureflag: %s has been set to %v, tenants %v", updated.Name, updated.Enabled, updated.Tenants)
+	if err = json.NewEncoder(w).Encode(updated); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// view hides overrides of other tenants from tenant users.
+func (h *Handler) view(ctx context.Context, f Flag) Flag {
+	id := tenant.FromContext(ctx)
+	if id == tenant.DefaultID {
+		return f
+	}
+
+	return Flag{
+		Name:        f.Name,
+		Description: f.Description,
+		Enabled:     f.enabledFor(id),
+	}
+}
+
+func sendError(w http.ResponseWriter, name string, err error) {
+	if sgerrors.IsNotFound(err) {
+		message.SendNotFound(w, name, err)
+		return
+	}
+	logrus.Errorf("featureflag: %s: %v", name, err)
+	message.SendUnknownError(w, err)
+}
@@ -0,0 +1,157 @@
+package featureflag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func newTestHandler(t *testing.T) (*mux.Router, *Service) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	_, err := svc.Set(context.Background(), Flag{
+		Name:    ProviderAzure,
+		Tenants: map[string]bool{"acme": true, "other": false},
+	})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	return router, svc
+}
+
+func TestHandler_ListFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		tenantID        string
+		expectedEnabled bool
+		expectedTenants bool
+	}{
+		{
+			name:            "default tenant",
+			tenantID:        tenant.DefaultID,
+			expectedTenants: true,
+		},
+		{
+			name:            "tenant",
+			tenantID:        "acme",
+			expectedEnabled: true,
+		},
+	} {
+		router, _ := newTestHandler(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/features", nil)
+		req = req.WithContext(tenant.WithID(req.Context(), tc.tenantID))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, "TC: %s", tc.name)
+
+		flags := make([]Flag, 0)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&flags), "TC: %s", tc.name)
+		require.Len(t, flags, len(defaults), "TC: %s", tc.name)
+
+		for _, f := range flags {
+			if f.Name != ProviderAzure {
+				continue
+			}
+			require.Equal(t, tc.expectedEnabled, f.Enabled, "TC: %s", tc.name)
+			require.Equal(t, tc.expectedTenants, len(f.Tenants) > 0, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_GetFlag(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		flag         string
+		expectedCode int
+	}{
+		{
+			name:         "found",
+			flag:         ProviderAzure,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "not found",
+			flag:         "unknown",
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		router, _ := newTestHandler(t)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/features/"+tc.flag, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_SetFlag(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		tenantID        string
+		editor          bool
+		flag            string
+		body            string
+		expectedCode    int
+		expectedEnabled bool
+	}{
+		{
+			name:         "tenant is forbidden",
+			tenantID:     "acme",
+			flag:         Helm3Backend,
+			body:         `{"enabled":true}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "editor is forbidden",
+			editor:       true,
+			flag:         Helm3Backend,
+			body:         `{"enabled":true}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid json",
+			flag:         Helm3Backend,
+			body:         `{`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			flag:         "unknown",
+			body:         `{"enabled":true}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "invalid tenant",
+			flag:         Helm3Backend,
+			body:         `{"tenants":{"Acme":true}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:            "enabled",
+			flag:            Helm3Backend,
+			body:            `{"enabled":true}`,
+			expectedCode:    http.StatusOK,
+			expectedEnabled: true,
+		},
+	} {
+		router, svc := newTestHandler(t)
+
+		req := httptest.NewRequest(http.MethodPut, "/features/"+tc.flag, bytes.NewBufferString(tc.body))
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), tc.tenantID), !tc.editor))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedEnabled, svc.Enabled(context.Background(), Helm3Backend), "TC: %s", tc.name)
+	}
+}
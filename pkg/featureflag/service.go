@@ -0,0 +1,147 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const DefaultStoragePrefix = "/supergiant/features/"
+
+// Service keeps feature flags in storage and serves them from memory,
+// so checking a flag never hits the storage.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	m     sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewService constructs a Service with default values of known flags,
+// call Reload to load configured values.
+func NewService(prefix string, s storage.Interface) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		flags:   defaultFlags(),
+	}
+}
+
+// Enabled reports whether the flag is enabled for the tenant of ctx,
+// unknown flags are disabled.
+func (s *Service) Enabled(ctx context.Context, name string) bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.flags[name].enabledFor(tenant.FromContext(ctx))
+}
+
+// List returns all known flags.
+func (s *Service) List(ctx context.Context) []Flag {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return sorted(s.flags)
+}
+
+// Get returns a known flag.
+func (s *Service) Get(ctx context.Context, name string) (*Flag, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	f, ok := s.flags[name]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+
+	return &f, nil
+}
+
+// Set stores values of a known flag, the description can't be changed.
+func (s *Service) Set(ctx context.Context, f Flag) (*Flag, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	current, ok := s.flags[f.Name]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	for id := range f.Tenants {
+		if id == tenant.DefaultID {
+			return nil, errors.New("use enabled for the default tenant")
+		}
+		if err := tenant.ValidateID(id); err != nil {
+			return nil, err
+		}
+	}
+	f.Description = current.Description
+
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+	if err = s.storage.Put(ctx, s.prefix, f.Name, raw); err != nil {
+		return nil, errors.Wrap(err, "storage: put")
+	}
+
+	s.flags[f.Name] = f
+	return &f, nil
+}
+
+// Reload reads configured values of flags from storage, flags that were removed
+// from storage get default values back.
+func (s *Service) Reload(ctx context.Context) error {
+	rawFlags, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return errors.Wrap(err, "storage: get all")
+	}
+
+	flags := defaultFlags()
+	for _, raw := range rawFlags {
+		f := Flag{}
+		if err = json.Unmarshal(raw, &f); err != nil {
+			return errors.Wrap(err, "unmarshal")
+		}
+
+		// flags of removed capabilities are left in storage
+		current, ok := flags[f.Name]
+		if !ok {
+			continue
+		}
+		f.Description = current.Description
+		flags[f.Name] = f
+	}
+
+	s.m.Lock()
+	s.flags = flags
+	s.m.Unlock()
+
+	return nil
+}
+
+// Run blocks and reloads flags every interval until ctx is cancelled, so changes
+// made by other control instances are picked up.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil {
+				logrus.Errorf("featureflag: reload: %v", err)
+			}
+		}
+	}
+}
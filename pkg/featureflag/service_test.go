@@ -0,0 +1,115 @@
+package featureflag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func TestService_Enabled(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	acme := tenant.WithID(context.Background(), "acme")
+
+	require.False(t, svc.Enabled(context.Background(), ProviderAzure))
+	require.False(t, svc.Enabled(context.Background(), "unknown"))
+
+	_, err := svc.Set(context.Background(), Flag{
+		Name:    ProviderAzure,
+		Tenants: map[string]bool{"acme": true},
+	})
+	require.NoError(t, err)
+	require.False(t, svc.Enabled(context.Background(), ProviderAzure))
+	require.True(t, svc.Enabled(acme, ProviderAzure))
+
+	_, err = svc.Set(context.Background(), Flag{
+		Name:    ProviderAzure,
+		Enabled: true,
+		Tenants: map[string]bool{"acme": false},
+	})
+	require.NoError(t, err)
+	require.True(t, svc.Enabled(context.Background(), ProviderAzure))
+	require.False(t, svc.Enabled(acme, ProviderAzure))
+}
+
+func TestService_Set(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		flag        Flag
+		expectedErr bool
+	}{
+		{
+			name:        "unknown flag",
+			flag:        Flag{Name: "unknown", Enabled: true},
+			expectedErr: true,
+		},
+		{
+			name:        "default tenant override",
+			flag:        Flag{Name: Helm3Backend, Tenants: map[string]bool{tenant.DefaultID: true}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid tenant",
+			flag:        Flag{Name: Helm3Backend, Tenants: map[string]bool{"../acme": true}},
+			expectedErr: true,
+		},
+		{
+			name: "description is kept",
+			flag: Flag{Name: Helm3Backend, Description: "changed", Enabled: true},
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+		f, err := svc.Set(context.Background(), tc.flag)
+		if tc.expectedErr {
+			require.Error(t, err, "TC: %s", tc.name)
+			continue
+		}
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.NotEqual(t, tc.flag.Description, f.Description, "TC: %s", tc.name)
+		require.True(t, f.Enabled, "TC: %s", tc.name)
+	}
+
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	_, err := svc.Set(context.Background(), Flag{Name: "unknown"})
+	require.True(t, sgerrors.IsNotFound(err))
+}
+
+func TestService_Reload(t *testing.T) {
+	repository := memory.NewInMemoryRepository()
+	svc := NewService(DefaultStoragePrefix, repository)
+	other := NewService(DefaultStoragePrefix, repository)
+
+	_, err := other.Set(context.Background(), Flag{Name: ParallelWorkflows, Enabled: true})
+	require.NoError(t, err)
+	require.NoError(t, repository.Put(context.Background(), DefaultStoragePrefix,
+		"removed", []byte(`{"name":"removed","enabled":true}`)))
+
+	require.False(t, svc.Enabled(context.Background(), ParallelWorkflows))
+	require.NoError(t, svc.Reload(context.Background()))
+	require.True(t, svc.Enabled(context.Background(), ParallelWorkflows))
+	require.False(t, svc.Enabled(context.Background(), "removed"))
+	require.Len(t, svc.List(context.Background()), len(defaults))
+
+	require.NoError(t, repository.Delete(context.Background(), DefaultStoragePrefix, ParallelWorkflows))
+	require.NoError(t, svc.Reload(context.Background()))
+	require.False(t, svc.Enabled(context.Background(), ParallelWorkflows))
+
+	require.NoError(t, repository.Put(context.Background(), DefaultStoragePrefix,
+		"broken", []byte("{")))
+	require.Error(t, svc.Reload(context.Background()))
+}
+
+func TestProviderFlag(t *testing.T) {
+	name, ok := ProviderFlag(clouds.Azure)
+	require.True(t, ok)
+	require.Equal(t, ProviderAzure, name)
+
+	_, ok = ProviderFlag(clouds.AWS)
+	require.False(t, ok)
+}
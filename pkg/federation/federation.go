@@ -0,0 +1,575 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/submariner"
+)
+
+const DefaultStoragePrefix = "/supergiant/federations/"
+
+type State string
+
+const (
+	StateInstalling State = "installing"
+	StateReady      State = "ready"
+	StateFailed     State = "failed"
+	StateDeleting   State = "deleting"
+)
+
+type MemberState string
+
+const (
+	MemberJoining MemberState = "joining"
+	MemberJoined  MemberState = "joined"
+	MemberFailed  MemberState = "failed"
+)
+
+var (
+	// ErrBusy is returned while clusters of the federation are being configured.
+	ErrBusy = errors.New("federation is being updated")
+	// ErrMember is returned for a cluster that is a member of another federation.
+	ErrMember = errors.New("cluster is a member of another federation")
+	// ErrOverlap is returned for a cluster whose ranges overlap with members
+	// of a federation created without globalnet.
+	ErrOverlap = errors.New("cluster ranges overlap with ranges of the federation")
+)
+
+// Member is a cluster that discovers services of other members.
+type Member struct {
+	ClusterID string      `json:"clusterId"`
+	State     MemberState `json:"state"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Federation is a set of clusters joined to a submariner broker, services
+// exported in one cluster are reachable from the others.
+type Federation struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	BrokerClusterID string `json:"brokerClusterId"`
+	Version         string `json:"version"`
+	CableDriver     string `json:"cableDriver"`
+	// Globalnet is enabled when pod or service ranges of members overlap
+	Globalnet  bool      `json:"globalnet"`
+	BrokerInfo string    `json:"brokerInfo,omitempty"`
+	Members    []Member  `json:"members"`
+	State      State     `json:"state"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Redacted returns a copy of the federation without broker credentials.
+func (f Federation) Redacted() Federation {
+	f.BrokerInfo = ""
+	return f
+}
+
+func (f *Federation) member(clusterID string) *Member {
+	for i := range f.Members {
+		if f.Members[i].ClusterID == clusterID {
+			return &f.Members[i]
+		}
+	}
+	return nil
+}
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+type accountGetter interface {
+	Get(ctx context.Context, accountName string) (*model.CloudAccount, error)
+}
+
+// runFn runs the workflow and waits for the result.
+type runFn func(ctx context.Context, workflow string, cfg *steps.Config) error
+
+// Service installs submariner on clusters of federations.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	kubes    kubeGetter
+	accounts accountGetter
+	run      runFn
+
+	m    sync.Mutex
+	busy map[string]bool
+}
+
+// NewService constructs a Service, tasks are saved to the taskRepo.
+func NewService(prefix string, s storage.Interface, kubes kubeGetter,
+	accounts accountGetter, taskRepo storage.Interface) *Service {
+	return &Service{
+		prefix:   prefix,
+		storage:  s,
+		kubes:    kubes,
+		accounts: accounts,
+		run:      taskRunner(taskRepo),
+		busy:     make(map[string]bool),
+	}
+}
+
+// Create validates the federation and saves it, clusters join it with Install.
+func (s *Service) Create(ctx context.Context, f *Federation, clusterIDs []string) error {
+	if f.Name == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "federation name is required")
+	}
+	if f.Version == "" {
+		f.Version = submariner.DefaultVersion
+	}
+	if f.CableDriver == "" {
+		f.CableDriver = submariner.CableDriverWireGuard
+	}
+	if f.CableDriver != submariner.CableDriverWireGuard && f.CableDriver != submariner.CableDriverVXLAN {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown cable driver %s", f.CableDriver)
+	}
+
+	clusterIDs = unique(clusterIDs)
+	if len(clusterIDs) < 2 {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "federation requires at least two clusters")
+	}
+	if f.BrokerClusterID == "" {
+		f.BrokerClusterID = clusterIDs[0]
+	}
+	if !contains(clusterIDs, f.BrokerClusterID) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "broker cluster %s is not a member", f.BrokerClusterID)
+	}
+
+	kubes := make([]*model.Kube, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		k, err := s.validCluster(ctx, id)
+		if err != nil {
+			return err
+		}
+		kubes = append(kubes, k)
+	}
+
+	f.ID = uuid.New()[:8]
+	f.Globalnet = overlap(kubes)
+	f.BrokerInfo = ""
+	f.Members = make([]Member, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		f.Members = append(f.Members, Member{ClusterID: id, State: MemberJoining})
+	}
+	f.State = StateInstalling
+	f.CreatedAt = time.Now()
+
+	return s.save(ctx, f)
+}
+
+// AddCluster adds a member to the federation, it joins the broker with Install.
+func (s *Service) AddCluster(ctx context.Context, id, clusterID string) (*Federation, error) {
+	if !s.lock(id) {
+		return nil, errors.Wrapf(ErrBusy, "federation %s", id)
+	}
+	defer s.unlock(id)
+
+	f, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if f.State == StateDeleting {
+		return nil, errors.Wrapf(ErrBusy, "federation %s is being deleted", id)
+	}
+	if f.member(clusterID) != nil {
+		return nil, errors.Wrapf(sgerrors.ErrAlreadyExists, "cluster %s", clusterID)
+	}
+
+	k, err := s.validCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	// globalnet can't be enabled for clusters that have joined already
+	if !f.Globalnet {
+		kubes := []*model.Kube{k}
+		for _, m := range f.Members {
+			member, err := s.kubes.Get(ctx, m.ClusterID)
+			if err != nil {
+				continue
+			}
+			kubes = append(kubes, member)
+		}
+		if overlap(kubes) {
+			return nil, errors.Wrapf(ErrOverlap, "cluster %s", clusterID)
+		}
+	}
+
+	f.Members = append(f.Members, Member{ClusterID: clusterID, State: MemberJoining})
+	f.State = StateInstalling
+
+	return f, s.save(ctx, f)
+}
+
+// Install deploys the broker if it has not been deployed and joins
+// clusters that are not members yet, it is safe to call it again after a failure.
+func (s *Service) Install(ctx context.Context, id string) error {
+	if !s.lock(id) {
+		return errors.Wrapf(ErrBusy, "federation %s", id)
+	}
+	defer s.unlock(id)
+
+	f, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if f.State == StateDeleting {
+		return errors.Wrapf(ErrBusy, "federation %s is being deleted", id)
+	}
+	f.State = StateInstalling
+	if err = s.save(ctx, f); err != nil {
+		return err
+	}
+
+	if f.BrokerInfo == "" {
+		cfg, err := s.clusterConfig(ctx, f, f.BrokerClusterID)
+		if err == nil {
+			err = s.run(ctx, workflows.SubmarinerBroker, cfg)
+		}
+		if err != nil {
+			logrus.Errorf("federation %s: deploy broker: %v", f.ID, err)
+			if broker := f.member(f.BrokerClusterID); broker != nil {
+				broker.State = MemberFailed
+				broker.Error = err.Error()
+			}
+			f.State = StateFailed
+			return s.save(ctx, f)
+		}
+		f.BrokerInfo = cfg.SubmarinerConfig.BrokerInfo
+		if err = s.save(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	errs := make([]error, len(f.Members))
+	wg := sync.WaitGroup{}
+	for i := range f.Members {
+		if f.Members[i].State == MemberJoined {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			cfg, err := s.clusterConfig(ctx, f, f.Members[i].ClusterID)
+			if err == nil {
+				err = s.run(ctx, workflows.SubmarinerJoin, cfg)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	f.State = StateReady
+	for i, err := range errs {
+		if f.Members[i].State == MemberJoined {
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("federation %s: join cluster %s: %v", f.ID, f.Members[i].ClusterID, err)
+			f.Members[i].State = MemberFailed
+			f.Members[i].Error = err.Error()
+			f.State = StateFailed
+			continue
+		}
+		f.Members[i].State = MemberJoined
+		f.Members[i].Error = ""
+	}
+
+	return s.save(ctx, f)
+}
+
+// Delete removes submariner from all members and the federation itself,
+// the federation stays in the deleting state when some clusters were not cleaned.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if !s.lock(id) {
+		return errors.Wrapf(ErrBusy, "federation %s", id)
+	}
+	defer s.unlock(id)
+
+	f, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	f.State = StateDeleting
+	if err = s.save(ctx, f); err != nil {
+		return err
+	}
+
+	errs := make([]error, len(f.Members))
+	wg := sync.WaitGroup{}
+	for i := range f.Members {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			cfg, err := s.clusterConfig(ctx, f, f.Members[i].ClusterID)
+			if sgerrors.IsNotFound(errors.Cause(err)) {
+				// nothing to clean up in deleted clusters
+				return
+			}
+			if err == nil {
+				err = s.run(ctx, workflows.SubmarinerLeave, cfg)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	failed := false
+	for i, err := range errs {
+		if err != nil {
+			logrus.Errorf("federation %s: remove from cluster %s: %v", f.ID, f.Members[i].ClusterID, err)
+			f.Members[i].State = MemberFailed
+			f.Members[i].Error = err.Error()
+			failed = true
+		}
+	}
+	if failed {
+		if err = s.save(ctx, f); err != nil {
+			return err
+		}
+		return errors.Errorf("federation %s: some clusters were not cleaned up", id)
+	}
+
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, id), "delete federation %s", id)
+}
+
+// Get returns a federation by its id.
+func (s *Service) Get(ctx context.Context, id string) (*Federation, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get federation %s", id)
+	}
+
+	f := new(Federation)
+	if err = json.Unmarshal(data, f); err != nil {
+		return nil, errors.Wrapf(err, "decode federation %s", id)
+	}
+
+	return f, nil
+}
+
+// List returns all federations.
+func (s *Service) List(ctx context.Context) ([]Federation, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list federations")
+	}
+
+	list := make([]Federation, 0, len(raw))
+	for _, data := range raw {
+		f := Federation{}
+		if err = json.Unmarshal(data, &f); err != nil {
+			logrus.Warnf("federation: skip corrupted record: %v", err)
+			continue
+		}
+		list = append(list, f)
+	}
+
+	return list, nil
+}
+
+// validCluster returns the kube if it can join a federation.
+func (s *Service) validCluster(ctx context.Context, id string) (*model.Kube, error) {
+	k, err := s.kubes.Get(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", id)
+	}
+	if k.State != model.StateOperational {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s is %s", k.ID, k.State)
+	}
+	if len(activeMasters(k)) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s has no active masters", k.ID)
+	}
+
+	// a cluster may be joined to a single broker
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		if f.member(id) != nil {
+			return nil, errors.Wrapf(ErrMember, "kube %s is a member of %s", id, f.Name)
+		}
+	}
+
+	return k, nil
+}
+
+// clusterConfig returns a config of a master node of the cluster.
+func (s *Service) clusterConfig(ctx context.Context, f *Federation, clusterID string) (*steps.Config, error) {
+	k, err := s.kubes.Get(ctx, clusterID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", clusterID)
+	}
+	masters := activeMasters(k)
+	if len(masters) == 0 {
+		return nil, errors.Errorf("kube %s has no active masters", clusterID)
+	}
+
+	cfg := &steps.Config{
+		Provider:         k.Provider,
+		IsMaster:         true,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Node:             *masters[0],
+		SubmarinerConfig: steps.SubmarinerConfig{
+			Version:     f.Version,
+			ClusterID:   submarinerID(k.ID),
+			CableDriver: f.CableDriver,
+			Globalnet:   f.Globalnet,
+			BrokerInfo:  f.BrokerInfo,
+		},
+		WireGuardConfig: steps.WireGuardConfig{
+			ListenPort: submariner.NATTPort,
+		},
+	}
+
+	if k.ExternallyManaged {
+		// firewalls of imported clusters are not managed
+		cfg.Kube = *k
+		return cfg, nil
+	}
+
+	acc, err := s.accounts.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+	if err = util.FillCloudAccountCredentials(ctx, acc, cfg); err != nil {
+		return nil, errors.Wrapf(err, "cloud account %s", k.AccountName)
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (s *Service) save(ctx context.Context, f *Federation) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrapf(err, "encode federation %s", f.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, f.ID, data), "save federation %s", f.ID)
+}
+
+func (s *Service) lock(id string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+func (s *Service) unlock(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.busy, id)
+}
+
+// submarinerID is a cluster id in the broker, it must be a dns label.
+func submarinerID(kubeID string) string {
+	return fmt.Sprintf("sg-%s", kubeID)
+}
+
+// overlap reports whether pod or service ranges of the clusters overlap.
+func overlap(kubes []*model.Kube) bool {
+	networks := make([]*net.IPNet, 0, 2*len(kubes))
+	for _, k := range kubes {
+		for _, cidr := range []string{k.Networking.CIDR, k.ServicesCIDR} {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				continue
+			}
+			for _, other := range networks {
+				if other.Contains(network.IP) || network.Contains(other.IP) {
+					return true
+				}
+			}
+			networks = append(networks, network)
+		}
+	}
+	return false
+}
+
+func activeMasters(k *model.Kube) []*model.Machine {
+	out := make([]*model.Machine, 0, len(k.Masters))
+	for _, m := range k.Masters {
+		if m != nil && m.State == model.MachineStateActive {
+			out = append(out, m)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func taskRunner(repo storage.Interface) runFn {
+	return func(ctx context.Context, workflow string, cfg *steps.Config) error {
+		t, err := workflows.NewTask(workflow, repo)
+		if err != nil {
+			return err
+		}
+		writer, err := util.GetWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return err
+		}
+
+		err = <-t.Run(tenant.Detach(ctx), *cfg, writer)
+		// steps fill in the config of the task
+		if t.Config != nil {
+			cfg.SubmarinerConfig = t.Config.SubmarinerConfig
+		}
+		return err
+	}
+}
@@ -0,0 +1,348 @@
+package federation
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/submariner"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, id string) (*model.Kube, error) {
+	k, ok := f[id]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+type fakeAccounts struct{}
+
+func (fakeAccounts) Get(ctx context.Context, name string) (*model.CloudAccount, error) {
+	return &model.CloudAccount{
+		Name:     name,
+		Provider: clouds.Name(name),
+	}, nil
+}
+
+// fakeRunner records submariner configs of clusters per workflow and fails
+// on clusters from failOn.
+type fakeRunner struct {
+	m       sync.Mutex
+	configs map[string]map[string]steps.SubmarinerConfig
+	failOn  map[string]bool
+}
+
+func (f *fakeRunner) run(ctx context.Context, workflow string, cfg *steps.Config) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if cfg.WireGuardConfig.ListenPort != submariner.NATTPort {
+		return errors.Errorf("unexpected port %d", cfg.WireGuardConfig.ListenPort)
+	}
+	if f.failOn[cfg.ClusterID] {
+		return errors.New("ssh: connection refused")
+	}
+	if workflow == workflows.SubmarinerBroker {
+		cfg.SubmarinerConfig.BrokerInfo = "broker-info"
+	}
+	if f.configs[workflow] == nil {
+		f.configs[workflow] = make(map[string]steps.SubmarinerConfig)
+	}
+	f.configs[workflow][cfg.ClusterID] = cfg.SubmarinerConfig
+	return nil
+}
+
+func kubeFixture(id string, provider clouds.Name, cidr string) *model.Kube {
+	return &model.Kube{
+		ID:          id,
+		Provider:    provider,
+		AccountName: string(provider),
+		State:       model.StateOperational,
+		Networking:  model.Networking{CIDR: cidr},
+		Masters: map[string]*model.Machine{
+			id + "-master": {
+				Name:     id + "-master",
+				State:    model.MachineStateActive,
+				PublicIp: "1.1.1.1",
+			},
+		},
+		Nodes: map[string]*model.Machine{},
+	}
+}
+
+func newTestService(kubes fakeKubes) (*Service, *fakeRunner) {
+	r := &fakeRunner{
+		configs: make(map[string]map[string]steps.SubmarinerConfig),
+		failOn:  make(map[string]bool),
+	}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes, fakeAccounts{}, nil)
+	svc.run = r.run
+	return svc, r
+}
+
+func TestService_Create(t *testing.T) {
+	provisioning := kubeFixture("provisioning", clouds.AWS, "10.10.0.0/16")
+	provisioning.State = model.StateProvisioning
+	noMasters := kubeFixture("nomasters", clouds.AWS, "10.11.0.0/16")
+	noMasters.Masters = map[string]*model.Machine{}
+
+	kubes := fakeKubes{
+		"aws":          kubeFixture("aws", clouds.AWS, "10.0.0.0/16"),
+		"do":           kubeFixture("do", clouds.DigitalOcean, "10.1.0.0/16"),
+		"provisioning": provisioning,
+		"nomasters":    noMasters,
+	}
+
+	for _, tc := range []struct {
+		name        string
+		federation  Federation
+		clusterIDs  []string
+		expectedErr error
+	}{
+		{
+			name:        "no name",
+			clusterIDs:  []string{"aws", "do"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown cable driver",
+			federation:  Federation{Name: "f", CableDriver: "ipsec"},
+			clusterIDs:  []string{"aws", "do"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "single cluster",
+			federation:  Federation{Name: "f"},
+			clusterIDs:  []string{"aws", "aws"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "broker is not a member",
+			federation:  Federation{Name: "f", BrokerClusterID: "other"},
+			clusterIDs:  []string{"aws", "do"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "not found",
+			federation:  Federation{Name: "f"},
+			clusterIDs:  []string{"aws", "missing"},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "not operational",
+			federation:  Federation{Name: "f"},
+			clusterIDs:  []string{"aws", "provisioning"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "no masters",
+			federation:  Federation{Name: "f"},
+			clusterIDs:  []string{"aws", "nomasters"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:       "success",
+			federation: Federation{Name: "f"},
+			clusterIDs: []string{"aws", "do"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, _ := newTestService(kubes)
+
+			f := tc.federation
+			err := svc.Create(context.Background(), &f, tc.clusterIDs)
+			if tc.expectedErr != nil {
+				require.Equal(t, tc.expectedErr, errors.Cause(err))
+				return
+			}
+			require.NoError(t, err)
+
+			require.NotEmpty(t, f.ID)
+			require.Equal(t, "aws", f.BrokerClusterID)
+			require.Equal(t, submariner.DefaultVersion, f.Version)
+			require.Equal(t, submariner.CableDriverWireGuard, f.CableDriver)
+			require.False(t, f.Globalnet)
+			require.Equal(t, StateInstalling, f.State)
+			require.Len(t, f.Members, 2)
+
+			stored, err := svc.Get(context.Background(), f.ID)
+			require.NoError(t, err)
+			require.Equal(t, f.Name, stored.Name)
+		})
+	}
+}
+
+func TestService_CreateGlobalnet(t *testing.T) {
+	services := kubeFixture("services", clouds.DigitalOcean, "10.2.0.0/16")
+	services.ServicesCIDR = "10.0.128.0/17"
+
+	svc, _ := newTestService(fakeKubes{
+		"a":        kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b":        kubeFixture("b", clouds.DigitalOcean, "10.0.0.0/16"),
+		"c":        kubeFixture("c", clouds.DigitalOcean, "10.1.0.0/16"),
+		"services": services,
+	})
+
+	f := &Federation{Name: "f"}
+	require.NoError(t, svc.Create(context.Background(), f, []string{"a", "b"}))
+	require.True(t, f.Globalnet)
+
+	g := &Federation{Name: "g"}
+	require.NoError(t, svc.Create(context.Background(), g, []string{"c", "services"}))
+	require.False(t, g.Globalnet)
+}
+
+func TestService_CreateMember(t *testing.T) {
+	svc, _ := newTestService(fakeKubes{
+		"a": kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b": kubeFixture("b", clouds.DigitalOcean, "10.1.0.0/16"),
+		"c": kubeFixture("c", clouds.DigitalOcean, "10.2.0.0/16"),
+	})
+
+	require.NoError(t, svc.Create(context.Background(), &Federation{Name: "f"}, []string{"a", "b"}))
+
+	err := svc.Create(context.Background(), &Federation{Name: "g"}, []string{"b", "c"})
+	require.Equal(t, ErrMember, errors.Cause(err))
+}
+
+func TestService_Install(t *testing.T) {
+	kubes := fakeKubes{
+		"a": kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b": kubeFixture("b", clouds.DigitalOcean, "10.1.0.0/16"),
+	}
+	svc, r := newTestService(kubes)
+
+	f := &Federation{Name: "f", CableDriver: submariner.CableDriverVXLAN}
+	require.NoError(t, svc.Create(context.Background(), f, []string{"a", "b"}))
+
+	r.failOn["b"] = true
+	require.NoError(t, svc.Install(context.Background(), f.ID))
+
+	f, err := svc.Get(context.Background(), f.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, f.State)
+	require.Equal(t, "broker-info", f.BrokerInfo)
+	require.Equal(t, MemberJoined, f.member("a").State)
+	require.Equal(t, MemberFailed, f.member("b").State)
+	require.NotEmpty(t, f.member("b").Error)
+	require.Equal(t, "sg-a", r.configs[workflows.SubmarinerBroker]["a"].ClusterID)
+
+	// retry joins the failed cluster only
+	r.failOn["b"] = false
+	delete(r.configs, workflows.SubmarinerJoin)
+	require.NoError(t, svc.Install(context.Background(), f.ID))
+
+	f, err = svc.Get(context.Background(), f.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateReady, f.State)
+	require.Equal(t, MemberJoined, f.member("b").State)
+	require.Empty(t, f.member("b").Error)
+
+	joined := r.configs[workflows.SubmarinerJoin]
+	require.Len(t, joined, 1)
+	require.Equal(t, "broker-info", joined["b"].BrokerInfo)
+	require.Equal(t, submariner.CableDriverVXLAN, joined["b"].CableDriver)
+}
+
+func TestService_InstallBrokerFailed(t *testing.T) {
+	svc, r := newTestService(fakeKubes{
+		"a": kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b": kubeFixture("b", clouds.DigitalOcean, "10.1.0.0/16"),
+	})
+
+	f := &Federation{Name: "f"}
+	require.NoError(t, svc.Create(context.Background(), f, []string{"a", "b"}))
+
+	r.failOn["a"] = true
+	require.NoError(t, svc.Install(context.Background(), f.ID))
+
+	f, err := svc.Get(context.Background(), f.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, f.State)
+	require.Empty(t, f.BrokerInfo)
+	require.Equal(t, MemberFailed, f.member("a").State)
+	require.Empty(t, r.configs[workflows.SubmarinerJoin])
+}
+
+func TestService_AddCluster(t *testing.T) {
+	kubes := fakeKubes{
+		"a":       kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b":       kubeFixture("b", clouds.DigitalOcean, "10.1.0.0/16"),
+		"c":       kubeFixture("c", clouds.DigitalOcean, "10.2.0.0/16"),
+		"overlap": kubeFixture("overlap", clouds.DigitalOcean, "10.1.0.0/16"),
+	}
+	svc, _ := newTestService(kubes)
+
+	f := &Federation{Name: "f"}
+	require.NoError(t, svc.Create(context.Background(), f, []string{"a", "b"}))
+
+	_, err := svc.AddCluster(context.Background(), f.ID, "b")
+	require.True(t, sgerrors.IsAlreadyExists(errors.Cause(err)))
+
+	_, err = svc.AddCluster(context.Background(), f.ID, "overlap")
+	require.Equal(t, ErrOverlap, errors.Cause(err))
+
+	_, err = svc.AddCluster(context.Background(), "missing", "c")
+	require.True(t, sgerrors.IsNotFound(errors.Cause(err)))
+
+	f, err = svc.AddCluster(context.Background(), f.ID, "c")
+	require.NoError(t, err)
+	require.Len(t, f.Members, 3)
+	require.Equal(t, MemberJoining, f.member("c").State)
+}
+
+func TestService_Delete(t *testing.T) {
+	kubes := fakeKubes{
+		"a": kubeFixture("a", clouds.AWS, "10.0.0.0/16"),
+		"b": kubeFixture("b", clouds.DigitalOcean, "10.1.0.0/16"),
+	}
+	svc, r := newTestService(kubes)
+
+	f := &Federation{Name: "f"}
+	require.NoError(t, svc.Create(context.Background(), f, []string{"a", "b"}))
+
+	r.failOn["b"] = true
+	require.Error(t, svc.Delete(context.Background(), f.ID))
+
+	stored, err := svc.Get(context.Background(), f.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateDeleting, stored.State)
+	require.Equal(t, MemberFailed, stored.member("b").State)
+
+	// deleted clusters are skipped
+	delete(kubes, "b")
+	require.NoError(t, svc.Delete(context.Background(), f.ID))
+	require.Contains(t, r.configs[workflows.SubmarinerLeave], "a")
+
+	_, err = svc.Get(context.Background(), f.ID)
+	require.True(t, sgerrors.IsNotFound(errors.Cause(err)))
+}
+
+func TestService_Busy(t *testing.T) {
+	svc, _ := newTestService(fakeKubes{})
+
+	require.True(t, svc.lock("f"))
+	require.Equal(t, ErrBusy, errors.Cause(svc.Install(context.Background(), "f")))
+	require.Equal(t, ErrBusy, errors.Cause(svc.Delete(context.Background(), "f")))
+	svc.unlock("f")
+
+	require.True(t, sgerrors.IsNotFound(errors.Cause(svc.Install(context.Background(), "f"))))
+}
+
+func TestFederation_Redacted(t *testing.T) {
+	f := Federation{ID: "f", BrokerInfo: "secret"}
+	require.Empty(t, f.Redacted().BrokerInfo)
+	require.Equal(t, "secret", f.BrokerInfo)
+}
@@ -0,0 +1,200 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// Servicer is an interface of the federation service.
+type Servicer interface {
+	Create(ctx context.Context, f *Federation, clusterIDs []string) error
+	Get(ctx context.Context, id string) (*Federation, error)
+	List(ctx context.Context) ([]Federation, error)
+	AddCluster(ctx context.Context, id, clusterID string) (*Federation, error)
+	Install(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+}
+
+// CreateRequest describes a federation of clusters.
+type CreateRequest struct {
+	Name            string   `json:"name"`
+	BrokerClusterID string   `json:"brokerClusterId"`
+	ClusterIDs      []string `json:"clusterIds"`
+	Version         string   `json:"version"`
+	CableDriver     string   `json:"cableDriver"`
+}
+
+// AddClusterRequest names a cluster that joins a federation.
+type AddClusterRequest struct {
+	ClusterID string `json:"clusterId"`
+}
+
+// Handler is a http handler for federations of clusters, submariner is
+// installed in the background and the state of the federation reflects the progress.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds federation handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/federations", h.createFederation).Methods(http.MethodPost)
+	r.HandleFunc("/federations", h.listFederations).Methods(http.MethodGet)
+	r.HandleFunc("/federations/{id}", h.getFederation).Methods(http.MethodGet)
+	r.HandleFunc("/federations/{id}", h.deleteFederation).Methods(http.MethodDelete)
+	r.HandleFunc("/federations/{id}/clusters", h.addCluster).Methods(http.MethodPost)
+	r.HandleFunc("/federations/{id}/install", h.installFederation).Methods(http.MethodPost)
+}
+
+func (h *Handler) createFederation(w http.ResponseWriter, r *http.Request) {
+	req := &CreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	f := &Federation{
+		Name:            req.Name,
+		BrokerClusterID: req.BrokerClusterID,
+		Version:         req.Version,
+		CableDriver:     req.CableDriver,
+	}
+	if err := h.svc.Create(r.Context(), f, req.ClusterIDs); err != nil {
+		logrus.Errorf("federation: create %s: %v", req.Name, err)
+		sendError(w, err)
+		return
+	}
+
+	h.install(r.Context(), f.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(f.Redacted()); err != nil {
+		logrus.Errorf("federation: encode %s: %v", f.ID, err)
+	}
+}
+
+func (h *Handler) listFederations(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		logrus.Errorf("federation: list: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	for i := range list {
+		list[i] = list[i].Redacted()
+	}
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getFederation(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(f.Redacted()); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) deleteFederation(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	ctx := tenant.Detach(r.Context())
+	go func() {
+		if err := h.svc.Delete(ctx, f.ID); err != nil {
+			logrus.Errorf("federation %s: delete: %v", f.ID, err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) addCluster(w http.ResponseWriter, r *http.Request) {
+	req := &AddClusterRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if req.ClusterID == "" {
+		message.SendValidationFailed(w, errors.New("clusterId is required"))
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	f, err := h.svc.AddCluster(r.Context(), id, req.ClusterID)
+	if err != nil {
+		logrus.Errorf("federation %s: add cluster %s: %v", id, req.ClusterID, err)
+		sendError(w, err)
+		return
+	}
+
+	h.install(r.Context(), f.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(f.Redacted()); err != nil {
+		logrus.Errorf("federation: encode %s: %v", f.ID, err)
+	}
+}
+
+// installFederation retries joining clusters that have failed.
+func (h *Handler) installFederation(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if f.State == StateDeleting {
+		sendError(w, errors.Wrapf(ErrBusy, "federation %s is being deleted", f.ID))
+		return
+	}
+
+	h.install(r.Context(), f.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) install(ctx context.Context, id string) {
+	ctx = tenant.Detach(ctx)
+	go func() {
+		if err := h.svc.Install(ctx, id); err != nil {
+			logrus.Errorf("federation %s: install: %v", id, err)
+		}
+	}()
+}
+
+func sendError(w http.ResponseWriter, err error) {
+	switch cause := errors.Cause(err); {
+	case sgerrors.IsNotFound(err):
+		message.SendNotFound(w, "federation", err)
+	case cause == ErrBusy || cause == ErrMember || sgerrors.IsAlreadyExists(err):
+		message.SendAlreadyExists(w, "federation", err)
+	case cause == sgerrors.ErrInvalidJson || cause == ErrOverlap:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,109 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestHandler(t *testing.T) {
+	svc, _ := newTestService(fakeKubes{
+		"aws": kubeFixture("aws", clouds.AWS, "10.0.0.0/16"),
+		"do":  kubeFixture("do", clouds.DigitalOcean, "10.1.0.0/16"),
+		"gce": kubeFixture("gce", clouds.DigitalOcean, "10.2.0.0/16"),
+	})
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "single cluster",
+			body:         `{"name":"f","clusterIds":["aws"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			body:         `{"name":"f","clusterIds":["aws","missing"]}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "accepted",
+			body:         `{"name":"f","clusterIds":["aws","do"]}`,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "member of another federation",
+			body:         `{"name":"g","clusterIds":["aws","gce"]}`,
+			expectedCode: http.StatusConflict,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/federations", bytes.NewBufferString(tc.body)))
+
+			require.Equal(t, tc.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+
+	list, err := svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	id := list[0].ID
+
+	waitReady := func() {
+		var f *Federation
+		for i := 0; i < 100; i++ {
+			if f, err = svc.Get(context.Background(), id); err == nil && f.State == StateReady {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.Equal(t, StateReady, f.State)
+	}
+	waitReady()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/federations/"+id, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	f := &Federation{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(f))
+	require.Len(t, f.Members, 2)
+	require.Empty(t, f.BrokerInfo, "broker credentials must not be exposed")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/federations/"+id+"/clusters",
+		bytes.NewBufferString(`{"clusterId":"gce"}`)))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	waitReady()
+
+	f, err = svc.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, MemberJoined, f.member("gce").State)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/federations/missing/install", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/federations/"+id+"/clusters",
+		bytes.NewBufferString(`{}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,106 @@
+package gitops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/supergiant/control/pkg/kube"
+)
+
+const (
+	StateSyncing = "syncing"
+	StateSynced  = "synced"
+	StateFailed  = "failed"
+
+	ActionInstalled = "installed"
+	ActionUpgraded  = "upgraded"
+	ActionUnchanged = "unchanged"
+	ActionFailed    = "failed"
+
+	DefaultBranch = "master"
+)
+
+// Binding ties a cluster or a namespace to a directory of a git repository
+// with helm release definitions.
+type Binding struct {
+	ID     string `json:"id"`
+	KubeID string `json:"kubeId" valid:"required"`
+	// TenantID is a tenant of the cluster, it is set on creation.
+	TenantID string `json:"tenantId"`
+	// Namespace restricts releases to a single namespace when set,
+	// it's also used for releases without a namespace.
+	Namespace string `json:"namespace"`
+
+	RepoURL string `json:"repoUrl" valid:"required"`
+	Branch  string `json:"branch"`
+	// Path is a directory inside the repository with release files,
+	// relative to the root of the repository.
+	Path string `json:"path"`
+
+	Status Status `json:"status"`
+}
+
+// Status is a result of the last reconciliation.
+type Status struct {
+	State    string          `json:"state"`
+	Revision string          `json:"revision"`
+	Message  string          `json:"message,omitempty"`
+	SyncedAt time.Time       `json:"syncedAt,omitempty"`
+	Releases []ReleaseStatus `json:"releases"`
+}
+
+// ReleaseStatus shows what has been done with a release on the last sync.
+type ReleaseStatus struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Error    string `json:"error,omitempty"`
+	Checksum string `json:"checksum"`
+}
+
+// ReleaseSpec is a release definition stored in the repository, e.g.
+//
+//	name: ingress
+//	namespace: kube-system
+//	repoName: stable
+//	chartName: nginx-ingress
+//	chartVersion: 0.31.0
+//	values:
+//	  controller:
+//	    replicaCount: 2
+type ReleaseSpec struct {
+	Name         string                 `json:"name"`
+	Namespace    string                 `json:"namespace"`
+	RepoName     string                 `json:"repoName"`
+	ChartName    string                 `json:"chartName"`
+	ChartVersion string                 `json:"chartVersion"`
+	Values       map[string]interface{} `json:"values"`
+}
+
+func (s ReleaseSpec) toInput() (*kube.ReleaseInput, error) {
+	values := []byte{}
+	if len(s.Values) > 0 {
+		var err error
+		if values, err = yaml.Marshal(s.Values); err != nil {
+			return nil, err
+		}
+	}
+
+	return &kube.ReleaseInput{
+		Name:         s.Name,
+		Namespace:    s.Namespace,
+		RepoName:     s.RepoName,
+		ChartName:    s.ChartName,
+		ChartVersion: s.ChartVersion,
+		Values:       string(values),
+	}, nil
+}
+
+// checksum changes whenever anything in the spec changes.
+func (s ReleaseSpec) checksum() string {
+	raw, _ := yaml.Marshal(s)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidRepoURL = errors.New("repository url must be an https or ssh url")
+	ErrInvalidBranch  = errors.New("branch must not start with a dash or contain spaces")
+	ErrInvalidPath    = errors.New("path must be a relative path inside the repository")
+
+	// scpRegexp matches ssh urls of the scp form, e.g. git@github.com:org/repo.git
+	scpRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^:/-]`)
+
+	// defaultProtocols are the only transports repositories are fetched with
+	defaultProtocols = []string{"https", "ssh"}
+)
+
+// ValidateSource checks the repository can be fetched by the fetcher, local
+// paths, other transports and values git reads as options are rejected.
+func ValidateSource(repoURL, branch string) error {
+	return validateSource(repoURL, branch, defaultProtocols)
+}
+
+func validateSource(repoURL, branch string, protocols []string) error {
+	if strings.HasPrefix(branch, "-") || strings.ContainsAny(branch, " \t\r\n") {
+		return ErrInvalidBranch
+	}
+	if strings.HasPrefix(repoURL, "-") || strings.ContainsAny(repoURL, " \t\r\n") {
+		return ErrInvalidRepoURL
+	}
+
+	scheme := "ssh"
+	if !scpRegexp.MatchString(repoURL) {
+		u, err := url.Parse(repoURL)
+		if err != nil || u.Host == "" && u.Scheme != "file" {
+			return ErrInvalidRepoURL
+		}
+		scheme = u.Scheme
+	}
+
+	for _, p := range protocols {
+		if scheme == p {
+			return nil
+		}
+	}
+	return ErrInvalidRepoURL
+}
+
+// ValidatePath checks the path of release files stays inside the repository.
+func ValidatePath(path string) error {
+	clean := filepath.Clean(path)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return ErrInvalidPath
+	}
+	return nil
+}
+
+// Fetcher brings a working copy of the repository branch into the dir.
+type Fetcher interface {
+	Fetch(ctx context.Context, repoURL, branch, dir string) (revision string, err error)
+}
+
+// GitFetcher uses git binary, it keeps shallow clones between fetches.
+type GitFetcher struct {
+	binary    string
+	protocols []string
+}
+
+// NewGitFetcher constructs a GitFetcher.
+func NewGitFetcher() *GitFetcher {
+	return &GitFetcher{
+		binary:    "git",
+		protocols: defaultProtocols,
+	}
+}
+
+func (f *GitFetcher) Fetch(ctx context.Context, repoURL, branch, dir string) (string, error) {
+	// bindings are validated on creation, ones stored before are checked here
+	if err := validateSource(repoURL, branch, f.protocols); err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return "", errors.Wrap(err, "create workdir")
+		}
+		if _, err := f.git(ctx, "", "clone", "--depth", "1", "--branch", branch, "--", repoURL, dir); err != nil {
+			return "", errors.Wrap(err, "clone")
+		}
+	} else {
+		if _, err := f.git(ctx, dir, "remote", "set-url", "--", "origin", repoURL); err != nil {
+			return "", errors.Wrap(err, "set remote")
+		}
+		if _, err := f.git(ctx, dir, "fetch", "--depth", "1", "--", "origin", branch); err != nil {
+			return "", errors.Wrap(err, "fetch")
+		}
+		if _, err := f.git(ctx, dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", errors.Wrap(err, "reset")
+		}
+	}
+
+	revision, err := f.git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "get revision")
+	}
+
+	return revision, nil
+}
+
+func (f *GitFetcher) git(ctx context.Context, dir string, args ...string) (string, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	cmd := exec.CommandContext(ctx, f.binary, args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// never wait for credentials on the terminal, submodules and redirects
+	// can't bring in transports other than the allowed ones
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL="+strings.Join(f.protocols, ":"))
+
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
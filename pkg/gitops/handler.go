@@ -0,0 +1,158 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/asaskevich/govalidator.v8"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+// Servicer is an interface of the gitops service.
+type Servicer interface {
+	Create(ctx context.Context, b *Binding) error
+	Get(ctx context.Context, id string) (*Binding, error)
+	ListAll(ctx context.Context, kubeID string) ([]Binding, error)
+	Delete(ctx context.Context, id string) error
+	Sync(ctx context.Context, id string) (*Binding, error)
+}
+
+// Handler is a http handler for gitops bindings.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds gitops handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/gitops", h.createBinding).Methods(http.MethodPost)
+	r.HandleFunc("/gitops", h.listBindings).Methods(http.MethodGet)
+	r.HandleFunc("/gitops/{bindingID}", h.getBinding).Methods(http.MethodGet)
+	r.HandleFunc("/gitops/{bindingID}", h.deleteBinding).Methods(http.MethodDelete)
+	r.HandleFunc("/gitops/{bindingID}/sync", h.syncBinding).Methods(http.MethodPost)
+}
+
+func (h *Handler) createBinding(w http.ResponseWriter, r *http.Request) {
+	b := &Binding{}
+	if err := json.NewDecoder(r.Body).Decode(b); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if ok, err := govalidator.ValidateStruct(b); !ok {
+		message.SendValidationFailed(w, err)
+		return
+	}
+	if err := ValidateSource(b.RepoURL, b.Branch); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+	if err := ValidatePath(b.Path); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	// id, tenant and status are managed by control
+	b.ID = ""
+	b.TenantID = ""
+	b.Status = Status{}
+
+	if err := h.svc.Create(r.Context(), b); err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, b.KubeID, err)
+			return
+		}
+		logrus.Errorf("gitops: create binding: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		logrus.Errorf("gitops: create binding: write response: %v", err)
+	}
+}
+
+// listBindings returns bindings, use kubeID query parameter to get bindings of a cluster.
+func (h *Handler) listBindings(w http.ResponseWriter, r *http.Request) {
+	bindings, err := h.svc.ListAll(r.Context(), r.URL.Query().Get("kubeID"))
+	if err != nil {
+		logrus.Errorf("gitops: list bindings: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(bindings); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getBinding(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["bindingID"]
+
+	b, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		sendError(w, id, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(b); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) deleteBinding(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["bindingID"]
+
+	if _, err := h.svc.Get(r.Context(), id); err != nil {
+		sendError(w, id, err)
+		return
+	}
+
+	if err := h.svc.Delete(r.Context(), id); err != nil {
+		logrus.Errorf("gitops: delete binding %s: %v", id, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// syncBinding reconciles the binding immediately, the binding with an updated status
+// is returned even if some releases have failed.
+func (h *Handler) syncBinding(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["bindingID"]
+
+	b, err := h.svc.Sync(r.Context(), id)
+	if b == nil {
+		sendError(w, id, err)
+		return
+	}
+	if err != nil {
+		logrus.Warnf("gitops: sync binding %s: %v", id, err)
+	}
+
+	if err = json.NewEncoder(w).Encode(b); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func sendError(w http.ResponseWriter, id string, err error) {
+	if sgerrors.IsNotFound(err) {
+		message.SendNotFound(w, id, err)
+		return
+	}
+	logrus.Errorf("gitops: binding %s: %v", id, err)
+	message.SendUnknownError(w, err)
+}
@@ -0,0 +1,233 @@
+package gitops
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) Create(ctx context.Context, b *Binding) error {
+	args := m.Called(ctx, b)
+	return args.Error(0)
+}
+
+func (m *mockService) Get(ctx context.Context, id string) (*Binding, error) {
+	args := m.Called(ctx, id)
+	val, ok := args.Get(0).(*Binding)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *mockService) ListAll(ctx context.Context, kubeID string) ([]Binding, error) {
+	args := m.Called(ctx, kubeID)
+	val, ok := args.Get(0).([]Binding)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *mockService) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockService) Sync(ctx context.Context, id string) (*Binding, error) {
+	args := m.Called(ctx, id)
+	val, ok := args.Get(0).(*Binding)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func serve(h *Handler, method, url, body string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	h.Register(router)
+
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestHandler_createBinding(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		createErr    error
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "validation failed",
+			body:         `{"kubeId":"kube"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "local repository",
+			body:         `{"kubeId":"kube","repoUrl":"file:///etc"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "option as branch",
+			body:         `{"kubeId":"kube","repoUrl":"https://example.com/repo.git","branch":"--upload-pack=sh"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "path outside of repository",
+			body:         `{"kubeId":"kube","repoUrl":"https://example.com/repo.git","path":"../../etc"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "kube not found",
+			body:         `{"kubeId":"kube","repoUrl":"https://example.com/repo.git"}`,
+			createErr:    sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "create error",
+			body:         `{"kubeId":"kube","repoUrl":"https://example.com/repo.git"}`,
+			createErr:    errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			body:         `{"id":"custom","tenantId":"other","kubeId":"kube","repoUrl":"git@example.com:repo.git"}`,
+			expectedCode: http.StatusCreated,
+		},
+	} {
+		svc := new(mockService)
+		svc.On("Create", mock.Anything, mock.MatchedBy(func(b *Binding) bool {
+			return b.ID == "" && b.TenantID == ""
+		})).Return(tc.createErr)
+
+		rec := serve(NewHandler(svc), http.MethodPost, "/gitops", tc.body)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_listBindings(t *testing.T) {
+	svc := new(mockService)
+	svc.On("ListAll", mock.Anything, "kube").Return([]Binding{{ID: "id"}}, nil)
+
+	rec := serve(NewHandler(svc), http.MethodGet, "/gitops?kubeID=kube", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	svc = new(mockService)
+	svc.On("ListAll", mock.Anything, "").Return(nil, errFake)
+
+	rec = serve(NewHandler(svc), http.MethodGet, "/gitops", "")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandler_getBinding(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		getErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			getErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			getErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(mockService)
+		svc.On("Get", mock.Anything, "id").Return(&Binding{ID: "id"}, tc.getErr)
+
+		rec := serve(NewHandler(svc), http.MethodGet, "/gitops/id", "")
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_deleteBinding(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		getErr       error
+		deleteErr    error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			getErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "delete error",
+			deleteErr:    errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		svc := new(mockService)
+		svc.On("Get", mock.Anything, "id").Return(&Binding{ID: "id"}, tc.getErr)
+		svc.On("Delete", mock.Anything, "id").Return(tc.deleteErr)
+
+		rec := serve(NewHandler(svc), http.MethodDelete, "/gitops/id", "")
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_syncBinding(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		binding      *Binding
+		syncErr      error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			syncErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "sync failed",
+			binding:      &Binding{ID: "id", Status: Status{State: StateFailed}},
+			syncErr:      errFake,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "success",
+			binding:      &Binding{ID: "id", Status: Status{State: StateSynced}},
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(mockService)
+		svc.On("Sync", mock.Anything, "id").Return(tc.binding, tc.syncErr)
+
+		rec := serve(NewHandler(svc), http.MethodPost, "/gitops/id/sync", "")
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,434 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const DefaultStoragePrefix = "/supergiant/gitops/"
+
+// ReleaseManager is a part of kube service that manages helm releases,
+// clusters are got to skip ones in maintenance.
+type ReleaseManager interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+	ListReleases(ctx context.Context, kname, ns, offset string, limit int) ([]*model.ReleaseInfo, error)
+	InstallRelease(ctx context.Context, kname string, rls *kube.ReleaseInput) (*release.Release, error)
+	UpgradeRelease(ctx context.Context, kname, rlsName string, rls *kube.ReleaseInput) (*release.Release, error)
+}
+
+// Service stores bindings and reconciles clusters with their repositories.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	releases ReleaseManager
+	fetcher  Fetcher
+	workdir  string
+
+	// sync of the same binding must not run concurrently
+	m     sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewService constructs a Service, repositories are cloned into the workdir.
+func NewService(prefix string, s storage.Interface, releases ReleaseManager, workdir string) *Service {
+	if workdir == "" {
+		workdir = filepath.Join(os.TempDir(), "supergiant-gitops")
+	}
+
+	return &Service{
+		prefix:   prefix,
+		storage:  s,
+		releases: releases,
+		fetcher:  NewGitFetcher(),
+		workdir:  workdir,
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// Create stores a new binding of a cluster of the tenant, it's reconciled
+// on the next sync.
+func (s *Service) Create(ctx context.Context, b *Binding) error {
+	if b == nil {
+		return errors.Wrap(sgerrors.ErrNilEntity, "binding")
+	}
+	if err := ValidateSource(b.RepoURL, b.Branch); err != nil {
+		return err
+	}
+	if err := ValidatePath(b.Path); err != nil {
+		return err
+	}
+	// the kube is looked up within the tenant of the request
+	if _, err := s.releases.Get(ctx, b.KubeID); err != nil {
+		return errors.Wrapf(err, "get kube %s", b.KubeID)
+	}
+	b.TenantID = tenant.FromContext(ctx)
+
+	if b.ID == "" {
+		b.ID = uuid.New()[:8]
+	}
+	if b.Branch == "" {
+		b.Branch = DefaultBranch
+	}
+	if b.Status.Releases == nil {
+		b.Status.Releases = make([]ReleaseStatus, 0)
+	}
+
+	return s.put(ctx, b)
+}
+
+// Get returns a binding of the tenant by id.
+func (s *Service) Get(ctx context.Context, id string) (*Binding, error) {
+	raw, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get")
+	}
+	if raw == nil {
+		return nil, sgerrors.ErrNotFound
+	}
+
+	b := &Binding{}
+	if err = json.Unmarshal(raw, b); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+	if b.TenantID != tenant.FromContext(ctx) {
+		return nil, sgerrors.ErrNotFound
+	}
+
+	return b, nil
+}
+
+// ListAll returns bindings of the tenant and the cluster, all bindings of the
+// tenant are returned if kubeID is empty.
+func (s *Service) ListAll(ctx context.Context, kubeID string) ([]Binding, error) {
+	all, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]Binding, 0, len(all))
+	for _, b := range all {
+		if b.TenantID != tenant.FromContext(ctx) || kubeID != "" && b.KubeID != kubeID {
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+
+	return bindings, nil
+}
+
+// listAll returns bindings of all tenants.
+func (s *Service) listAll(ctx context.Context) ([]Binding, error) {
+	rawBindings, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	bindings := make([]Binding, 0, len(rawBindings))
+	for _, raw := range rawBindings {
+		b := Binding{}
+		if err = json.Unmarshal(raw, &b); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		bindings = append(bindings, b)
+	}
+
+	return bindings, nil
+}
+
+// Delete removes the binding of the tenant and its working copy, releases
+// are left untouched.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(ctx, s.prefix, id); err != nil {
+		return errors.Wrap(err, "storage: delete")
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.workdir, id)); err != nil {
+		logrus.Warnf("gitops: binding %s: remove working copy: %v", id, err)
+	}
+
+	return nil
+}
+
+// Run blocks and syncs all bindings every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncAll(ctx)
+		}
+	}
+}
+
+func (s *Service) syncAll(ctx context.Context) {
+	bindings, err := s.listAll(ctx)
+	if err != nil {
+		logrus.Errorf("gitops: list bindings: %v", err)
+		return
+	}
+
+	for _, b := range bindings {
+		// bindings are synced within tenants of their clusters
+		tenantCtx := tenant.WithID(ctx, b.TenantID)
+		if k, err := s.releases.Get(tenantCtx, b.KubeID); err == nil && k.InMaintenance() {
+			continue
+		}
+		if _, err := s.Sync(tenantCtx, b.ID); err != nil {
+			logrus.Errorf("gitops: binding %s: %v", b.ID, err)
+		}
+	}
+}
+
+// Sync fetches the repository and installs or upgrades releases that have changed
+// since the last sync. The result is saved to the binding status, bindings of
+// other tenants are not found.
+func (s *Service) Sync(ctx context.Context, id string) (*Binding, error) {
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status, syncErr := s.reconcile(ctx, b)
+	b.Status = status
+	if err := s.put(ctx, b); err != nil {
+		return nil, err
+	}
+
+	return b, syncErr
+}
+
+func (s *Service) reconcile(ctx context.Context, b *Binding) (Status, error) {
+	status := Status{
+		State:    StateSynced,
+		Revision: b.Status.Revision,
+		SyncedAt: time.Now(),
+		Releases: make([]ReleaseStatus, 0),
+	}
+	fail := func(err error) (Status, error) {
+		status.State = StateFailed
+		status.Message = err.Error()
+		status.Releases = b.Status.Releases
+		return status, err
+	}
+
+	dir := filepath.Join(s.workdir, b.ID)
+	revision, err := s.fetcher.Fetch(ctx, b.RepoURL, b.Branch, dir)
+	if err != nil {
+		return fail(errors.Wrap(err, "fetch repository"))
+	}
+	status.Revision = revision
+
+	specs, err := loadSpecs(dir, b.Path)
+	if err != nil {
+		return fail(errors.Wrap(err, "load releases"))
+	}
+
+	current, err := s.releases.ListReleases(ctx, b.KubeID, b.Namespace, "", 0)
+	if err != nil {
+		return fail(errors.Wrap(err, "list releases"))
+	}
+	installed := make(map[string]*model.ReleaseInfo, len(current))
+	for _, rls := range current {
+		installed[rls.Name] = rls
+	}
+
+	applied := make(map[string]string, len(b.Status.Releases))
+	for _, rls := range b.Status.Releases {
+		if rls.Action != ActionFailed {
+			applied[rls.Name] = rls.Checksum
+		}
+	}
+
+	failed := 0
+	for _, spec := range specs {
+		if b.Namespace != "" {
+			if spec.Namespace != "" && spec.Namespace != b.Namespace {
+				status.Releases = append(status.Releases, ReleaseStatus{
+					Name:   spec.Name,
+					Action: ActionFailed,
+					Error:  fmt.Sprintf("namespace %s is outside of the binding", spec.Namespace),
+				})
+				failed++
+				continue
+			}
+			spec.Namespace = b.Namespace
+		}
+
+		rlsStatus := s.apply(ctx, b.KubeID, spec, installed[spec.Name], applied[spec.Name])
+		if rlsStatus.Action == ActionFailed {
+			failed++
+		}
+		status.Releases = append(status.Releases, rlsStatus)
+	}
+
+	if failed > 0 {
+		status.State = StateFailed
+		status.Message = fmt.Sprintf("failed to apply %d release(s)", failed)
+	}
+
+	return status, nil
+}
+
+// apply installs a missing release or upgrades it when the spec has changed.
+func (s *Service) apply(ctx context.Context, kubeID string, spec ReleaseSpec,
+	current *model.ReleaseInfo, appliedChecksum string) ReleaseStatus {
+	res := ReleaseStatus{
+		Name:     spec.Name,
+		Checksum: spec.checksum(),
+	}
+
+	inp, err := spec.toInput()
+	if err != nil {
+		res.Action = ActionFailed
+		res.Error = errors.Wrap(err, "marshal values").Error()
+		return res
+	}
+
+	switch {
+	case current == nil:
+		_, err = s.releases.InstallRelease(ctx, kubeID, inp)
+		res.Action = ActionInstalled
+	case current.ChartVersion != spec.ChartVersion && spec.ChartVersion != "",
+		res.Checksum != appliedChecksum:
+		_, err = s.releases.UpgradeRelease(ctx, kubeID, spec.Name, inp)
+		res.Action = ActionUpgraded
+	default:
+		res.Action = ActionUnchanged
+	}
+
+	if err != nil {
+		res.Action = ActionFailed
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+func (s *Service) put(ctx context.Context, b *Binding) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	if err = s.storage.Put(ctx, s.prefix, b.ID, raw); err != nil {
+		return errors.Wrap(err, "storage: put")
+	}
+
+	return nil
+}
+
+func (s *Service) lock(id string) *sync.Mutex {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.locks[id] == nil {
+		s.locks[id] = &sync.Mutex{}
+	}
+
+	return s.locks[id]
+}
+
+// loadSpecs reads release definitions from yaml files of the path of
+// the working copy, symlinks must not lead outside of it.
+func loadSpecs(root, path string) ([]ReleaseSpec, error) {
+	if err := ValidatePath(path); err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := resolveInside(root, filepath.Join(root, path))
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]ReleaseSpec, 0, len(files))
+	names := make(map[string]string, len(files))
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		file, err := resolveInside(root, filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		spec := ReleaseSpec{}
+		if err = yaml.Unmarshal(raw, &spec); err != nil {
+			return nil, errors.Wrap(err, f.Name())
+		}
+		if spec.Name == "" || spec.ChartName == "" || spec.RepoName == "" {
+			return nil, errors.Errorf("%s: name, repoName and chartName are required", f.Name())
+		}
+		if prev, ok := names[spec.Name]; ok {
+			return nil, errors.Errorf("%s: release %s is already defined in %s", f.Name(), spec.Name, prev)
+		}
+		names[spec.Name] = f.Name()
+
+		specs = append(specs, spec)
+	}
+
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+
+	return specs, nil
+}
+
+// resolveInside follows symlinks of the path and checks the result is
+// inside of the root, root must be resolved already.
+func resolveInside(root, path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || ValidatePath(rel) != nil {
+		rel, _ = filepath.Rel(root, path)
+		return "", errors.Errorf("%s: %v", rel, ErrInvalidPath)
+	}
+	return resolved, nil
+}
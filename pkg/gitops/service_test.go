@@ -0,0 +1,488 @@
+package gitops
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+var errFake = errors.New("fake")
+
+const repoURL = "https://example.com/repo.git"
+
+type mapStorage map[string][]byte
+
+func (s mapStorage) Put(ctx context.Context, prefix string, key string, value []byte) error {
+	s[prefix+key] = value
+	return nil
+}
+
+func (s mapStorage) Get(ctx context.Context, prefix string, key string) ([]byte, error) {
+	return s[prefix+key], nil
+}
+
+func (s mapStorage) GetAll(ctx context.Context, prefix string) ([][]byte, error) {
+	out := make([][]byte, 0, len(s))
+	for _, v := range s {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (s mapStorage) Delete(ctx context.Context, prefix string, key string) error {
+	delete(s, prefix+key)
+	return nil
+}
+
+type fakeFetcher struct {
+	files map[string]string
+	// links are symlinks of the working copy to their targets
+	links    map[string]string
+	revision string
+	err      error
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, repoURL, branch, dir string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	for name, content := range f.files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return "", err
+		}
+	}
+	for name, target := range f.links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			return "", err
+		}
+	}
+
+	return f.revision, nil
+}
+
+type fakeReleases struct {
+	// kubes belong to the tenant, they aren't found by other ones
+	tenant     string
+	kube       *model.Kube
+	current    []*model.ReleaseInfo
+	listErr    error
+	installErr error
+
+	installed []*kube.ReleaseInput
+	upgraded  []*kube.ReleaseInput
+}
+
+func (f *fakeReleases) Get(ctx context.Context, kubeID string) (*model.Kube, error) {
+	if tenant.FromContext(ctx) != f.tenant {
+		return nil, sgerrors.ErrNotFound
+	}
+	if f.kube == nil {
+		return &model.Kube{ID: kubeID}, nil
+	}
+	return f.kube, nil
+}
+
+func (f *fakeReleases) ListReleases(ctx context.Context, kname, ns, offset string, limit int) ([]*model.ReleaseInfo, error) {
+	if tenant.FromContext(ctx) != f.tenant {
+		return nil, sgerrors.ErrNotFound
+	}
+	return f.current, f.listErr
+}
+
+func (f *fakeReleases) InstallRelease(ctx context.Context, kname string, rls *kube.ReleaseInput) (*release.Release, error) {
+	f.installed = append(f.installed, rls)
+	return nil, f.installErr
+}
+
+func (f *fakeReleases) UpgradeRelease(ctx context.Context, kname, rlsName string, rls *kube.ReleaseInput) (*release.Release, error) {
+	f.upgraded = append(f.upgraded, rls)
+	return nil, nil
+}
+
+const (
+	ingressSpec = `
+name: ingress
+repoName: stable
+chartName: nginx-ingress
+chartVersion: 1.0.0
+values:
+  controller:
+    replicaCount: 2
+`
+	redisSpec = `
+name: redis
+namespace: cache
+repoName: stable
+chartName: redis
+`
+)
+
+func newTestService(t *testing.T, fetcher Fetcher, releases ReleaseManager) (*Service, func()) {
+	workdir, err := ioutil.TempDir("", "gitops")
+	require.NoError(t, err)
+
+	svc := NewService(DefaultStoragePrefix, mapStorage{}, releases, workdir)
+	svc.fetcher = fetcher
+
+	return svc, func() { os.RemoveAll(workdir) }
+}
+
+func TestService_Create(t *testing.T) {
+	svc, cleanup := newTestService(t, &fakeFetcher{}, &fakeReleases{})
+	defer cleanup()
+
+	require.Equal(t, sgerrors.ErrNilEntity, errors.Cause(svc.Create(context.Background(), nil)))
+
+	b := &Binding{KubeID: "kube", RepoURL: "https://example.com/repo.git"}
+	require.NoError(t, svc.Create(context.Background(), b))
+	require.NotEmpty(t, b.ID)
+	require.Equal(t, DefaultBranch, b.Branch)
+
+	got, err := svc.Get(context.Background(), b.ID)
+	require.NoError(t, err)
+	require.Equal(t, b.RepoURL, got.RepoURL)
+
+	require.NoError(t, svc.Create(context.Background(), &Binding{KubeID: "other", RepoURL: repoURL}))
+	bindings, err := svc.ListAll(context.Background(), "kube")
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+
+	require.NoError(t, svc.Delete(context.Background(), b.ID))
+	_, err = svc.Get(context.Background(), b.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+}
+
+func TestService_CreatePath(t *testing.T) {
+	svc, cleanup := newTestService(t, &fakeFetcher{}, &fakeReleases{})
+	defer cleanup()
+
+	for _, path := range []string{"", "releases", "./releases/prod", "releases/../prod"} {
+		require.NoError(t, svc.Create(context.Background(), &Binding{KubeID: "kube", RepoURL: repoURL, Path: path}),
+			"path %s", path)
+	}
+	for _, path := range []string{"..", "../../../etc", "releases/../../etc", "/etc"} {
+		err := svc.Create(context.Background(), &Binding{KubeID: "kube", RepoURL: repoURL, Path: path})
+		require.Equal(t, ErrInvalidPath, err, "path %s", path)
+	}
+}
+
+func TestService_Tenants(t *testing.T) {
+	fetcher := &fakeFetcher{
+		files:    map[string]string{"ingress.yaml": ingressSpec},
+		revision: "rev1",
+	}
+	releases := &fakeReleases{tenant: "acme"}
+	svc, cleanup := newTestService(t, fetcher, releases)
+	defer cleanup()
+	acme := tenant.WithID(context.Background(), "acme")
+
+	// kubes of other tenants can't be bound
+	err := svc.Create(context.Background(), &Binding{KubeID: "kube", RepoURL: repoURL})
+	require.True(t, sgerrors.IsNotFound(err))
+	require.Equal(t, ErrInvalidRepoURL, svc.Create(acme, &Binding{KubeID: "kube", RepoURL: "/etc"}))
+
+	b := &Binding{KubeID: "kube", RepoURL: repoURL}
+	require.NoError(t, svc.Create(acme, b))
+	require.Equal(t, "acme", b.TenantID)
+
+	_, err = svc.Get(context.Background(), b.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+	_, err = svc.Sync(context.Background(), b.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+	require.True(t, sgerrors.IsNotFound(svc.Delete(context.Background(), b.ID)))
+	bindings, err := svc.ListAll(context.Background(), "")
+	require.NoError(t, err)
+	require.Empty(t, bindings)
+
+	// bindings are synced within their tenants
+	svc.syncAll(context.Background())
+	require.Len(t, releases.installed, 1)
+
+	bindings, err = svc.ListAll(acme, "")
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	require.Equal(t, StateSynced, bindings[0].Status.State)
+}
+
+func TestValidateSource(t *testing.T) {
+	for _, source := range [][2]string{
+		{"https://github.com/org/repo.git", ""},
+		{"ssh://git@github.com/org/repo.git", "main"},
+		{"git@github.com:org/repo.git", "release-1.0"},
+	} {
+		require.NoError(t, ValidateSource(source[0], source[1]), source[0])
+	}
+
+	for _, repo := range []string{"", "/etc", "../repo", "file:///etc", "http://example.com/repo.git",
+		"ext::sh -c touch% /tmp/pwned", "--upload-pack=touch /tmp/pwned", "-u.sh", "git@host:-oProxyCommand=sh"} {
+		require.Equal(t, ErrInvalidRepoURL, ValidateSource(repo, ""), repo)
+	}
+	require.Equal(t, ErrInvalidBranch, ValidateSource("https://github.com/org/repo.git", "--upload-pack=sh"))
+}
+
+func TestService_syncAllMaintenance(t *testing.T) {
+	fetcher := &fakeFetcher{
+		files:    map[string]string{"ingress.yaml": ingressSpec},
+		revision: "rev1",
+	}
+	releases := &fakeReleases{
+		kube: &model.Kube{ID: "kube", Maintenance: model.Maintenance{Enabled: true}},
+	}
+	svc, cleanup := newTestService(t, fetcher, releases)
+	defer cleanup()
+
+	b := &Binding{KubeID: "kube", RepoURL: repoURL}
+	require.NoError(t, svc.Create(context.Background(), b))
+
+	svc.syncAll(context.Background())
+	require.Empty(t, releases.installed)
+
+	releases.kube.Maintenance = model.Maintenance{}
+	svc.syncAll(context.Background())
+	require.Len(t, releases.installed, 1)
+}
+
+func TestService_Sync(t *testing.T) {
+	fetcher := &fakeFetcher{
+		files: map[string]string{
+			"ingress.yaml": ingressSpec,
+			"redis.yml":    redisSpec,
+			"README.md":    "not a release",
+		},
+		revision: "rev1",
+	}
+	releases := &fakeReleases{}
+	svc, cleanup := newTestService(t, fetcher, releases)
+	defer cleanup()
+
+	b := &Binding{KubeID: "kube", RepoURL: repoURL}
+	require.NoError(t, svc.Create(context.Background(), b))
+
+	b, err := svc.Sync(context.Background(), b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateSynced, b.Status.State)
+	require.Equal(t, "rev1", b.Status.Revision)
+	require.Len(t, releases.installed, 2)
+	require.Equal(t, "ingress", releases.installed[0].Name)
+	require.Contains(t, releases.installed[0].Values, "replicaCount: 2")
+	require.Equal(t, "cache", releases.installed[1].Namespace)
+
+	// nothing changed
+	releases.current = []*model.ReleaseInfo{
+		{Name: "ingress", ChartVersion: "1.0.0"},
+		{Name: "redis", ChartVersion: "3.0.0"},
+	}
+	b, err = svc.Sync(context.Background(), b.ID)
+	require.NoError(t, err)
+	require.Len(t, releases.installed, 2)
+	require.Empty(t, releases.upgraded)
+	for _, rls := range b.Status.Releases {
+		require.Equal(t, ActionUnchanged, rls.Action)
+	}
+
+	// values changed
+	fetcher.revision = "rev2"
+	fetcher.files["ingress.yaml"] = ingressSpec + "    image: custom\n"
+	b, err = svc.Sync(context.Background(), b.ID)
+	require.NoError(t, err)
+	require.Len(t, releases.upgraded, 1)
+	require.Equal(t, "ingress", releases.upgraded[0].Name)
+	require.Equal(t, ActionUpgraded, b.Status.Releases[0].Action)
+	require.Equal(t, "rev2", b.Status.Revision)
+}
+
+func TestService_SyncFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		fetcher       *fakeFetcher
+		releases      *fakeReleases
+		namespace     string
+		expectedErr   bool
+		expectedState string
+	}{
+		{
+			name:          "fetch error",
+			fetcher:       &fakeFetcher{err: errFake},
+			releases:      &fakeReleases{},
+			expectedErr:   true,
+			expectedState: StateFailed,
+		},
+		{
+			name: "invalid spec",
+			fetcher: &fakeFetcher{
+				files: map[string]string{"broken.yaml": "name: broken"},
+			},
+			releases:      &fakeReleases{},
+			expectedErr:   true,
+			expectedState: StateFailed,
+		},
+		{
+			name: "list releases error",
+			fetcher: &fakeFetcher{
+				files: map[string]string{"ingress.yaml": ingressSpec},
+			},
+			releases:      &fakeReleases{listErr: errFake},
+			expectedErr:   true,
+			expectedState: StateFailed,
+		},
+		{
+			name: "install error",
+			fetcher: &fakeFetcher{
+				files: map[string]string{"ingress.yaml": ingressSpec},
+			},
+			releases:      &fakeReleases{installErr: errFake},
+			expectedState: StateFailed,
+		},
+		{
+			name: "namespace outside of binding",
+			fetcher: &fakeFetcher{
+				files: map[string]string{"redis.yaml": redisSpec},
+			},
+			releases:      &fakeReleases{},
+			namespace:     "default",
+			expectedState: StateFailed,
+		},
+	} {
+		svc, cleanup := newTestService(t, tc.fetcher, tc.releases)
+
+		b := &Binding{KubeID: "kube", RepoURL: repoURL, Namespace: tc.namespace}
+		require.NoError(t, svc.Create(context.Background(), b), "TC: %s", tc.name)
+
+		b, err := svc.Sync(context.Background(), b.ID)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedState, b.Status.State, "TC: %s", tc.name)
+		require.NotEmpty(t, b.Status.Message, "TC: %s", tc.name)
+
+		cleanup()
+	}
+}
+
+func TestService_SyncSymlinks(t *testing.T) {
+	outside, err := ioutil.TempDir("", "gitops-outside")
+	require.NoError(t, err)
+	defer os.RemoveAll(outside)
+	secret := filepath.Join(outside, "secret.yaml")
+	require.NoError(t, ioutil.WriteFile(secret, []byte(ingressSpec), 0644))
+
+	for _, tc := range []struct {
+		name      string
+		links     map[string]string
+		path      string
+		installed int
+		err       bool
+	}{
+		{
+			name:      "link inside of the repository",
+			links:     map[string]string{"prod.yaml": "ingress.yaml.tpl"},
+			installed: 1,
+		},
+		{
+			name:  "file outside of the repository",
+			links: map[string]string{"secret.yaml": secret},
+			err:   true,
+		},
+		{
+			name:  "directory outside of the repository",
+			links: map[string]string{"releases": outside},
+			path:  "releases",
+			err:   true,
+		},
+		{
+			name:  "relative link outside of the repository",
+			links: map[string]string{"up": "../../"},
+			path:  "up",
+			err:   true,
+		},
+	} {
+		fetcher := &fakeFetcher{
+			files: map[string]string{"ingress.yaml.tpl": ingressSpec},
+			links: tc.links,
+		}
+		releases := &fakeReleases{}
+		svc, cleanup := newTestService(t, fetcher, releases)
+
+		b := &Binding{KubeID: "kube", RepoURL: repoURL, Path: tc.path}
+		require.NoError(t, svc.Create(context.Background(), b), "TC: %s", tc.name)
+
+		b, err := svc.Sync(context.Background(), b.ID)
+		require.Equal(t, tc.err, err != nil, "TC: %s: %v", tc.name, err)
+		require.Len(t, releases.installed, tc.installed, "TC: %s", tc.name)
+		if tc.err {
+			require.Contains(t, b.Status.Message, ErrInvalidPath.Error(), "TC: %s", tc.name)
+		}
+
+		cleanup()
+	}
+}
+
+func TestGitFetcher_Fetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "gitops")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	origin := filepath.Join(tmp, "origin")
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = origin
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	commit := func(content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(origin, "ingress.yaml"), []byte(content), 0644))
+		run("add", "-A")
+		run("commit", "-m", "update")
+	}
+
+	require.NoError(t, os.MkdirAll(origin, 0755))
+	run("init")
+	run("checkout", "-b", "master")
+	commit(ingressSpec)
+
+	f := NewGitFetcher()
+	_, err = f.Fetch(context.Background(), "file://"+origin, "master", filepath.Join(tmp, "local"))
+	require.Equal(t, ErrInvalidRepoURL, err)
+
+	// the origin is local to the test
+	f.protocols = []string{"file"}
+	dir := filepath.Join(tmp, "copy")
+
+	first, err := f.Fetch(context.Background(), "file://"+origin, "master", dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+
+	commit(redisSpec)
+	second, err := f.Fetch(context.Background(), "file://"+origin, "master", dir)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "ingress.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, redisSpec, string(content))
+
+	_, err = f.Fetch(context.Background(), "file://"+origin, "unknown", filepath.Join(tmp, "other"))
+	require.Error(t, err)
+}
@@ -0,0 +1,531 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/activity"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/guard/"
+	configPrefix         = "/supergiant/guard-config/"
+	configKey            = "config"
+
+	DefaultMaxFailures        = 5
+	DefaultMaxAddressFailures = 20
+	DefaultWindow             = 15 * time.Minute
+	DefaultLockout            = 15 * time.Minute
+	DefaultPruneInterval      = time.Hour
+
+	// configTTL is how long replicas use the config before it is read again.
+	configTTL = 10 * time.Second
+	// refusedInterval limits events of refused addresses, scanners make lots of requests.
+	refusedInterval = time.Minute
+
+	loginKey   = "login:"
+	addressKey = "address:"
+)
+
+var ErrLocked = errors.New("too many failed logins, try again later")
+
+// Config protects the api, durations are e.g. 15m.
+type Config struct {
+	// AllowedCIDRs limit addresses of api clients, e.g. 10.0.0.0/8,
+	// any address is allowed when it is empty.
+	AllowedCIDRs []string `json:"allowedCidrs,omitempty"`
+	// TrustedProxies are CIDRs of proxies in front of control, addresses
+	// of clients are taken from X-Forwarded-For of their requests.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	// MaxFailures of a login within the window lock it out.
+	MaxFailures int `json:"maxFailures,omitempty"`
+	// MaxAddressFailures of an address within the window lock it out,
+	// it stops guessing passwords of many logins.
+	MaxAddressFailures int    `json:"maxAddressFailures,omitempty"`
+	Window             string `json:"window,omitempty"`
+	Lockout            string `json:"lockout,omitempty"`
+}
+
+type policy struct {
+	allowed            []*net.IPNet
+	trusted            []*net.IPNet
+	maxFailures        int
+	maxAddressFailures int
+	window             time.Duration
+	lockout            time.Duration
+}
+
+func (c *Config) policy() (*policy, error) {
+	p := &policy{
+		maxFailures:        DefaultMaxFailures,
+		maxAddressFailures: DefaultMaxAddressFailures,
+		window:             DefaultWindow,
+		lockout:            DefaultLockout,
+	}
+
+	var err error
+	if p.allowed, err = parseCIDRs(c.AllowedCIDRs); err != nil {
+		return nil, err
+	}
+	if p.trusted, err = parseCIDRs(c.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	if c.MaxFailures < 0 || c.MaxAddressFailures < 0 {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, "max failures can't be negative")
+	}
+	if c.MaxFailures > 0 {
+		p.maxFailures = c.MaxFailures
+	}
+	if c.MaxAddressFailures > 0 {
+		p.maxAddressFailures = c.MaxAddressFailures
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"window", c.Window, &p.window},
+		{"lockout", c.Lockout, &p.lockout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < time.Second {
+			return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "%s %s must be at least 1s", d.name, d.value)
+		}
+		*d.to = parsed
+	}
+	return p, nil
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, cidr := range list {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "cidr %s", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the client address may use the api.
+func (p *policy) allows(address string) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && contains(p.allowed, ip)
+}
+
+// clientAddress returns an address of the client, addresses added to
+// X-Forwarded-For by trusted proxies are used.
+func (p *policy) clientAddress(r *http.Request) string {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		address = host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(address)
+		if ip == nil || !contains(p.trusted, ip) {
+			break
+		}
+		if next := strings.TrimSpace(forwarded[i]); next != "" {
+			address = next
+		}
+	}
+	return address
+}
+
+// Lockout is a login or an address locked out after failed logins.
+type Lockout struct {
+	Key         string      `json:"key"`
+	Failures    []time.Time `json:"failures,omitempty"`
+	LockedUntil time.Time   `json:"lockedUntil,omitempty"`
+}
+
+type recorder interface {
+	RecordSecurity(ctx context.Context, e *activity.Event) error
+}
+
+// Service refuses api clients with addresses that are not allowed and
+// locks out logins and addresses after repeated failed logins. Failures are
+// kept in the storage, so they count on all replicas.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	events  recorder
+	now     func() time.Time
+
+	mu       sync.Mutex
+	cached   *policy
+	loadedAt time.Time
+	refused  map[string]time.Time
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface, events recorder) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		events:  events,
+		now:     time.Now,
+		refused: make(map[string]time.Time),
+	}
+}
+
+// Config returns the protection of the api.
+func (s *Service) Config(ctx context.Context) (*Config, error) {
+	data, err := s.storage.Get(ctx, configPrefix, configKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return &Config{}, nil
+		}
+		return nil, errors.Wrap(err, "get guard config")
+	}
+
+	c := new(Config)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal guard config")
+	}
+	return c, nil
+}
+
+// SetConfig validates and stores the config, allow lists that refuse the
+// address of the request that changes them are refused.
+func (s *Service) SetConfig(ctx context.Context, c *Config) error {
+	p, err := c.policy()
+	if err != nil {
+		return err
+	}
+	if address := AddressFromContext(ctx); address != "" && !p.allows(address) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "allowed cidrs refuse the address %s of the request", address)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal guard config")
+	}
+	if err = s.storage.Put(ctx, configPrefix, configKey, data); err != nil {
+		return errors.Wrap(err, "put guard config")
+	}
+
+	s.mu.Lock()
+	s.cached, s.loadedAt = p, s.now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) policy(ctx context.Context) (*policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil && s.now().Sub(s.loadedAt) < configTTL {
+		return s.cached, nil
+	}
+
+	c, err := s.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.cached, err = c.policy(); err != nil {
+		return nil, err
+	}
+	s.loadedAt = s.now()
+	return s.cached, nil
+}
+
+// Check returns the address of the client and whether it may use the api.
+func (s *Service) Check(ctx context.Context, r *http.Request) (string, bool, error) {
+	p, err := s.policy(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	address := p.clientAddress(r)
+	if p.allows(address) {
+		return address, true, nil
+	}
+
+	if s.shouldRecord(address) {
+		s.record(ctx, &activity.Event{
+			Type:    activity.EventAddressRefused,
+			Message: "address " + address + " is not allowed",
+			Details: map[string]string{
+				"address": address,
+				"path":    r.URL.Path,
+			},
+		})
+	}
+	return address, false, nil
+}
+
+func (s *Service) shouldRecord(address string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if last, ok := s.refused[address]; ok && now.Sub(last) < refusedInterval {
+		return false
+	}
+	for a, last := range s.refused {
+		if now.Sub(last) >= refusedInterval {
+			delete(s.refused, a)
+		}
+	}
+	s.refused[address] = now
+	return true
+}
+
+// Allow refuses logins that are locked out, the address of the client
+// is taken from the context.
+func (s *Service) Allow(ctx context.Context, login string) error {
+	now := s.now()
+	for _, key := range keys(ctx, login) {
+		l, err := s.get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if l != nil && now.Before(l.LockedUntil) {
+			return ErrLocked
+		}
+	}
+	return nil
+}
+
+// Failed counts a failed login, the login or the address is locked out
+// when there are too many failures within the window.
+func (s *Service) Failed(ctx context.Context, login string) {
+	p, err := s.policy(ctx)
+	if err != nil {
+		logrus.Errorf("guard: %v", err)
+		return
+	}
+
+	address := AddressFromContext(ctx)
+	s.record(ctx, &activity.Event{
+		Type:    activity.EventLoginFailed,
+		Message: "failed login of " + login,
+		User:    login,
+		Details: map[string]string{
+			"address": address,
+		},
+	})
+
+	now := s.now()
+	for _, key := range keys(ctx, login) {
+		max := p.maxFailures
+		if strings.HasPrefix(key, addressKey) {
+			max = p.maxAddressFailures
+		}
+
+		l, err := s.get(ctx, key)
+		if err != nil {
+			logrus.Errorf("guard: %v", err)
+			continue
+		}
+		if l == nil {
+			l = &Lockout{Key: key}
+		}
+
+		failures := make([]time.Time, 0, len(l.Failures)+1)
+		for _, f := range l.Failures {
+			if now.Sub(f) < p.window {
+				failures = append(failures, f)
+			}
+		}
+		l.Failures = append(failures, now)
+
+		if len(l.Failures) >= max {
+			l.Failures = nil
+			l.LockedUntil = now.Add(p.lockout)
+			s.record(ctx, &activity.Event{
+				Type:    activity.EventLoginLocked,
+				Message: key + " is locked out until " + l.LockedUntil.Format(time.RFC3339),
+				User:    login,
+				Details: map[string]string{
+					"key":     key,
+					"address": address,
+				},
+			})
+		}
+
+		if err = s.put(ctx, l); err != nil {
+			logrus.Errorf("guard: %v", err)
+		}
+	}
+}
+
+// Succeeded forgets failures of the login, failures of the address are
+// kept to stop guessing passwords of many logins.
+func (s *Service) Succeeded(ctx context.Context, login string) {
+	if err := s.storage.Delete(ctx, s.prefix, loginKey+login); err != nil && !sgerrors.IsNotFound(err) {
+		logrus.Errorf("guard: forget failures of %s: %v", login, err)
+	}
+}
+
+// Lockouts returns logins and addresses that are locked out.
+func (s *Service) Lockouts(ctx context.Context) ([]*Lockout, error) {
+	list, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	locked := make([]*Lockout, 0)
+	for _, l := range list {
+		if now.Before(l.LockedUntil) {
+			locked = append(locked, l)
+		}
+	}
+	return locked, nil
+}
+
+// Unlock removes the lockout of a key, e.g. login:admin or address:10.0.0.1.
+func (s *Service) Unlock(ctx context.Context, key string) error {
+	if _, err := s.storage.Get(ctx, s.prefix, key); err != nil {
+		return err
+	}
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, key), "delete lockout %s", key)
+}
+
+// Prune removes failures outside of the window and expired lockouts.
+func (s *Service) Prune(ctx context.Context) (int, error) {
+	p, err := s.policy(ctx)
+	if err != nil {
+		return 0, err
+	}
+	list, err := s.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	pruned := 0
+	for _, l := range list {
+		if now.Before(l.LockedUntil) {
+			continue
+		}
+		if n := len(l.Failures); n > 0 && now.Sub(l.Failures[n-1]) < p.window {
+			continue
+		}
+		if err = s.storage.Delete(ctx, s.prefix, l.Key); err != nil {
+			return pruned, errors.Wrapf(err, "delete lockout %s", l.Key)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// Run prunes failures with the interval.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Prune(ctx); err != nil {
+				logrus.Errorf("guard: prune: %v", err)
+			}
+		}
+	}
+}
+
+func keys(ctx context.Context, login string) []string {
+	keys := []string{loginKey + login}
+	if address := AddressFromContext(ctx); address != "" {
+		keys = append(keys, addressKey+address)
+	}
+	return keys
+}
+
+func (s *Service) get(ctx context.Context, key string) (*Lockout, error) {
+	data, err := s.storage.Get(ctx, s.prefix, key)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get lockout %s", key)
+	}
+
+	l := new(Lockout)
+	if err = json.Unmarshal(data, l); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal lockout %s", key)
+	}
+	return l, nil
+}
+
+func (s *Service) put(ctx context.Context, l *Lockout) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "marshal lockout")
+	}
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, l.Key, data), "put lockout %s", l.Key)
+}
+
+func (s *Service) list(ctx context.Context) ([]*Lockout, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "get lockouts")
+	}
+
+	list := make([]*Lockout, 0, len(raw))
+	for _, data := range raw {
+		l := new(Lockout)
+		if err = json.Unmarshal(data, l); err != nil {
+			logrus.Warnf("guard: skip corrupted lockout: %v", err)
+			continue
+		}
+		list = append(list, l)
+	}
+	return list, nil
+}
+
+func (s *Service) record(ctx context.Context, e *activity.Event) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.RecordSecurity(ctx, e); err != nil {
+		logrus.Warnf("guard: record %s: %v", e.Type, err)
+	}
+}
+
+type addressKeyType struct{}
+
+// WithAddress returns a context with the address of the client.
+func WithAddress(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, addressKeyType{}, address)
+}
+
+// AddressFromContext returns the address of the client checked by the allow list.
+func AddressFromContext(ctx context.Context) string {
+	address, _ := ctx.Value(addressKeyType{}).(string)
+	return address
+}
@@ -0,0 +1,210 @@
+package guard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/activity"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+type fakeEvents []*activity.Event
+
+func (f *fakeEvents) RecordSecurity(ctx context.Context, e *activity.Event) error {
+	*f = append(*f, e)
+	return nil
+}
+
+func (f fakeEvents) types() []string {
+	types := make([]string, 0, len(f))
+	for _, e := range f {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestService(t *testing.T, c *Config) (*Service, *fakeEvents, *clock) {
+	events := &fakeEvents{}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), events)
+	clk := &clock{now: time.Now()}
+	svc.now = clk.Now
+
+	if c != nil {
+		require.NoError(t, svc.SetConfig(context.Background(), c))
+	}
+	return svc, events, clk
+}
+
+func TestConfig_policy(t *testing.T) {
+	for _, tc := range []struct {
+		config      Config
+		expectedErr bool
+	}{
+		{config: Config{}},
+		{config: Config{AllowedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}, Window: "5m", Lockout: "1h"}},
+		{config: Config{AllowedCIDRs: []string{"10.0.0.1"}}, expectedErr: true},
+		{config: Config{TrustedProxies: []string{"proxy"}}, expectedErr: true},
+		{config: Config{MaxFailures: -1}, expectedErr: true},
+		{config: Config{Lockout: "15"}, expectedErr: true},
+	} {
+		_, err := tc.config.policy()
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %+v", tc.config)
+		if err != nil {
+			require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err), "TC: %+v", tc.config)
+		}
+	}
+}
+
+func TestPolicy_clientAddress(t *testing.T) {
+	p, err := (&Config{TrustedProxies: []string{"10.0.0.0/24"}}).policy()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		{"192.168.1.1:4000", "", "192.168.1.1"},
+		// only trusted proxies forward addresses
+		{"192.168.1.1:4000", "1.1.1.1", "192.168.1.1"},
+		{"10.0.0.5:4000", "1.1.1.1", "1.1.1.1"},
+		{"10.0.0.5:4000", "1.1.1.1, 10.0.0.6", "1.1.1.1"},
+		// addresses added by clients are not used
+		{"10.0.0.5:4000", "10.0.0.1, 2.2.2.2, 10.0.0.6", "2.2.2.2"},
+		{"[2001:db8::1]:4000", "", "2001:db8::1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		require.Equal(t, tc.expected, p.clientAddress(r), "TC: %s %s", tc.remote, tc.forwarded)
+	}
+}
+
+func TestService_Check(t *testing.T) {
+	svc, events, clk := newTestService(t, &Config{AllowedCIDRs: []string{"10.0.0.0/8"}})
+
+	for _, tc := range []struct {
+		remote          string
+		expectedAllowed bool
+	}{
+		{"10.1.2.3:4000", true},
+		{"192.168.1.1:4000", false},
+		{"192.168.1.1:4001", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/api/kubes", nil)
+		r.RemoteAddr = tc.remote
+
+		_, allowed, err := svc.Check(context.Background(), r)
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedAllowed, allowed, "TC: %s", tc.remote)
+	}
+	// refused requests of an address are recorded once a minute
+	require.Equal(t, []string{activity.EventAddressRefused}, events.types())
+	require.Equal(t, "192.168.1.1", (*events)[0].Details["address"])
+
+	clk.now = clk.now.Add(refusedInterval)
+	r := httptest.NewRequest(http.MethodGet, "/v1/api/kubes", nil)
+	r.RemoteAddr = "192.168.1.1:4000"
+	_, _, err := svc.Check(context.Background(), r)
+	require.NoError(t, err)
+	require.Len(t, *events, 2)
+}
+
+func TestService_SetConfig(t *testing.T) {
+	svc, _, _ := newTestService(t, nil)
+	ctx := WithAddress(context.Background(), "192.168.1.1")
+
+	err := svc.SetConfig(ctx, &Config{AllowedCIDRs: []string{"10.0.0.0/8"}})
+	require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err))
+	require.NoError(t, svc.SetConfig(ctx, &Config{AllowedCIDRs: []string{"10.0.0.0/8", "192.168.1.0/24"}}))
+
+	c, err := svc.Config(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/8", "192.168.1.0/24"}, c.AllowedCIDRs)
+}
+
+func TestService_Lockout(t *testing.T) {
+	svc, events, clk := newTestService(t, &Config{MaxFailures: 3, MaxAddressFailures: 4, Lockout: "10m"})
+	ctx := WithAddress(context.Background(), "1.1.1.1")
+	start := clk.now
+
+	// failures outside of the window are not counted
+	svc.Failed(ctx, "admin")
+	clk.now = start.Add(DefaultWindow)
+	svc.Failed(ctx, "admin")
+	svc.Failed(ctx, "admin")
+	require.NoError(t, svc.Allow(ctx, "admin"))
+
+	svc.Failed(ctx, "admin")
+	require.Equal(t, ErrLocked, svc.Allow(ctx, "admin"))
+	require.NoError(t, svc.Allow(context.Background(), "user"))
+	require.Equal(t, activity.EventLoginLocked, (*events)[len(*events)-1].Type)
+	require.Equal(t, "login:admin", (*events)[len(*events)-1].Details["key"])
+
+	// the address has guessed too many passwords
+	svc.Failed(ctx, "user")
+	require.Equal(t, ErrLocked, svc.Allow(ctx, "user"))
+	require.NoError(t, svc.Allow(WithAddress(context.Background(), "2.2.2.2"), "user"))
+
+	lockouts, err := svc.Lockouts(ctx)
+	require.NoError(t, err)
+	require.Len(t, lockouts, 2)
+
+	clk.now = clk.now.Add(10 * time.Minute)
+	require.NoError(t, svc.Allow(ctx, "admin"))
+	lockouts, err = svc.Lockouts(ctx)
+	require.NoError(t, err)
+	require.Empty(t, lockouts)
+}
+
+func TestService_Succeeded(t *testing.T) {
+	svc, _, _ := newTestService(t, &Config{MaxFailures: 2})
+	ctx := context.Background()
+
+	svc.Failed(ctx, "admin")
+	svc.Succeeded(ctx, "admin")
+	svc.Failed(ctx, "admin")
+	require.NoError(t, svc.Allow(ctx, "admin"))
+
+	svc.Failed(ctx, "admin")
+	require.Equal(t, ErrLocked, svc.Allow(ctx, "admin"))
+	require.NoError(t, svc.Unlock(ctx, "login:admin"))
+	require.NoError(t, svc.Allow(ctx, "admin"))
+	require.True(t, sgerrors.IsNotFound(svc.Unlock(ctx, "login:admin")))
+}
+
+func TestService_Prune(t *testing.T) {
+	svc, _, clk := newTestService(t, &Config{MaxFailures: 2, Lockout: "1h"})
+	ctx := context.Background()
+
+	svc.Failed(ctx, "user")
+	svc.Failed(ctx, "admin")
+	svc.Failed(ctx, "admin")
+
+	clk.now = clk.now.Add(DefaultWindow)
+	pruned, err := svc.Prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+
+	clk.now = clk.now.Add(time.Hour)
+	pruned, err = svc.Prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+}
@@ -0,0 +1,165 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type Servicer interface {
+	Config(ctx context.Context) (*Config, error)
+	SetConfig(ctx context.Context, c *Config) error
+	Check(ctx context.Context, r *http.Request) (string, bool, error)
+	Lockouts(ctx context.Context) ([]*Lockout, error)
+	Unlock(ctx context.Context, key string) error
+}
+
+// Handler configures protection of the api, it is managed by users of
+// the default tenant.
+type Handler struct {
+	svc Servicer
+	// paths are prefixes of requests checked by the allow list.
+	paths []string
+}
+
+// NewHandler constructs a Handler, the allow list applies to requests
+// with the path prefixes or to all requests when there are none.
+func NewHandler(svc Servicer, paths ...string) *Handler {
+	return &Handler{
+		svc:   svc,
+		paths: paths,
+	}
+}
+
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/guard/config", h.getConfig).Methods(http.MethodGet)
+	r.HandleFunc("/guard/config", h.setConfig).Methods(http.MethodPut)
+	r.HandleFunc("/guard/lockouts", h.listLockouts).Methods(http.MethodGet)
+	r.HandleFunc("/guard/lockouts/{key}", h.unlock).Methods(http.MethodDelete)
+}
+
+// AllowList refuses clients with addresses that are not allowed, the
+// address is added to the context of other requests.
+func (h *Handler) AllowList(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.guarded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		address, allowed, err := h.svc.Check(r.Context(), r)
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+		if !allowed {
+			http.Error(w, "address "+address+" is not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithAddress(r.Context(), address)))
+	})
+}
+
+func (h *Handler) guarded(path string) bool {
+	if len(h.paths) == 0 {
+		return true
+	}
+	for _, p := range h.paths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "api protection is managed by admins of the default tenant", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c, err := h.svc.Config(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) setConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c := new(Config)
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetConfig(r.Context(), c); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) listLockouts(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	list, err := h.svc.Lockouts(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// unlock lets a login or an address in again: DELETE /guard/lockouts/login:admin
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	if err := h.svc.Unlock(r.Context(), key); err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, key, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
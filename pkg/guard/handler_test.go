@@ -0,0 +1,101 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func TestHandler_AllowList(t *testing.T) {
+	svc, _, _ := newTestService(t, &Config{AllowedCIDRs: []string{"10.0.0.0/8"}})
+	h := NewHandler(svc, "/v1/api", "/auth")
+
+	router := mux.NewRouter()
+	router.Use(h.AllowList)
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(AddressFromContext(r.Context())))
+	})
+
+	for _, tc := range []struct {
+		remote          string
+		url             string
+		expectedCode    int
+		expectedAddress string
+	}{
+		{"10.0.0.1:4000", "/v1/api/kubes", http.StatusOK, "10.0.0.1"},
+		{"192.168.1.1:4000", "/v1/api/kubes", http.StatusForbidden, ""},
+		{"192.168.1.1:4000", "/auth", http.StatusForbidden, ""},
+		{"192.168.1.1:4000", "/index.html", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		req.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s %s", tc.remote, tc.url)
+		if tc.expectedCode == http.StatusOK {
+			require.Equal(t, tc.expectedAddress, rec.Body.String(), "TC: %s %s", tc.remote, tc.url)
+		}
+	}
+}
+
+func TestHandler_config(t *testing.T) {
+	svc, _, _ := newTestService(t, nil)
+	h := NewHandler(svc)
+	router := mux.NewRouter()
+	h.Register(router)
+
+	serve := func(tenantID string, admin bool, method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		ctx := WithAddress(tenant.WithID(req.Context(), tenantID), "10.0.0.1")
+		ctx = permission.WithAdmin(ctx, admin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name         string
+		tenantID     string
+		method       string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{"tenant", "acme", http.MethodPut, "/guard/config", `{"maxFailures":3}`, http.StatusForbidden},
+		{"tenant get", "acme", http.MethodGet, "/guard/config", "", http.StatusForbidden},
+		{"own address", tenant.DefaultID, http.MethodPut, "/guard/config",
+			`{"allowedCidrs":["192.168.0.0/16"]}`, http.StatusBadRequest},
+		{"set", tenant.DefaultID, http.MethodPut, "/guard/config",
+			`{"allowedCidrs":["10.0.0.0/8"],"maxFailures":1}`, http.StatusOK},
+		{"get", tenant.DefaultID, http.MethodGet, "/guard/config", "", http.StatusOK},
+		{"unlock unknown", tenant.DefaultID, http.MethodDelete, "/guard/lockouts/login:admin", "", http.StatusNotFound},
+	} {
+		rec := serve(tc.tenantID, true, tc.method, tc.url, tc.body)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+	require.Equal(t, http.StatusForbidden,
+		serve(tenant.DefaultID, false, http.MethodPut, "/guard/config", `{"maxFailures":3}`).Code)
+
+	svc.Failed(WithAddress(context.Background(), "10.0.0.1"), "admin")
+	rec := serve(tenant.DefaultID, true, http.MethodGet, "/guard/lockouts", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	lockouts := make([]*Lockout, 0)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&lockouts))
+	require.Len(t, lockouts, 1)
+	require.Equal(t, "login:admin", lockouts[0].Key)
+
+	require.Equal(t, http.StatusForbidden,
+		serve("acme", true, http.MethodDelete, "/guard/lockouts/login:admin", "").Code)
+	require.Equal(t, http.StatusAccepted,
+		serve(tenant.DefaultID, true, http.MethodDelete, "/guard/lockouts/login:admin", "").Code)
+}
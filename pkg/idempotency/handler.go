@@ -0,0 +1,180 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	// HeaderKey is a request header with a token generated by the client,
+	// retries of the request must carry the same token.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed marks responses returned to retries.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// routes create clusters or start provisioning tasks.
+var routes = []string{
+	"/provision",
+	"/kubes",
+	"/kubes/spec",
+	"/kubes/import",
+	"/kubes/{kubeID}/nodes",
+	"/kubes/{kubeID}/machines",
+	"/kubes/{kubeID}/restart",
+	"/tasks/{id}/restart",
+}
+
+// Servicer is an interface of the idempotency service.
+type Servicer interface {
+	Begin(ctx context.Context, user, key, fingerprint string) (*Record, error)
+	Finish(ctx context.Context, user, key string, code int, contentType, location string, body []byte) error
+}
+
+// Handler makes retries of requests that create clusters and tasks safe,
+// a retry with the same key gets the response of the first request.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Dedupe handles the first request with an idempotency key and replays
+// its response to the following ones, requests without a key are passed through.
+func (h *Handler) Dedupe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" || !creates(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			message.SendValidationFailed(w, errors.Errorf("%s must not be longer than %d characters",
+				HeaderKey, maxKeyLength))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		user := api.UserFromContext(r.Context())
+		rec, err := h.svc.Begin(r.Context(), user, key, fingerprint(r, body))
+		switch errors.Cause(err) {
+		case nil:
+		case ErrInProgress:
+			message.SendMessage(w, message.New("Request is in progress", err.Error(),
+				sgerrors.AlreadyExists, ""), http.StatusConflict)
+			return
+		case ErrMismatch:
+			message.SendMessage(w, message.New("Idempotency key has been reused", err.Error(),
+				sgerrors.ValidationFailed, ""), http.StatusUnprocessableEntity)
+			return
+		default:
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		if rec != nil {
+			replay(w, rec)
+			return
+		}
+
+		resp := &recorder{ResponseWriter: w}
+		next.ServeHTTP(resp, r)
+
+		if resp.code == 0 {
+			resp.code = http.StatusOK
+		}
+		if err = h.svc.Finish(r.Context(), user, key, resp.code, w.Header().Get("Content-Type"),
+			w.Header().Get("Location"), resp.body.Bytes()); err != nil {
+			logrus.Errorf("idempotency: finish %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	if rec.Location != "" {
+		w.Header().Set("Location", rec.Location)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(rec.Code)
+	if _, err := w.Write(rec.Body); err != nil {
+		logrus.Errorf("idempotency: write response: %v", err)
+	}
+}
+
+func creates(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	for _, suffix := range routes {
+		if strings.HasSuffix(tpl, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder keeps a copy of the response written to the client.
+type recorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
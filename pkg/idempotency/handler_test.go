@@ -0,0 +1,134 @@
+package idempotency
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_Dedupe(t *testing.T) {
+	svc, _ := newTestService()
+	calls := 0
+	created := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", fmt.Sprintf("/kubes/%d", calls))
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"id":"%d"}`, calls)
+	}
+	failed := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "cloud is down", http.StatusInternalServerError)
+	}
+
+	router := mux.NewRouter()
+	router.Use(NewHandler(svc).Dedupe)
+	router.HandleFunc("/v1/api/provision", created).Methods(http.MethodPost)
+	router.HandleFunc("/v1/api/kubes/{kubeID}/nodes", failed).Methods(http.MethodPost)
+	router.HandleFunc("/v1/api/kubes/{kubeID}/snapshots", created).Methods(http.MethodPost)
+
+	serve := func(url, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(HeaderKey, key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name          string
+		url           string
+		key           string
+		body          string
+		expectedCode  int
+		expectedCalls int
+		expectedBody  string
+		location      string
+		replayed      bool
+	}{
+		{
+			name:          "first request",
+			url:           "/v1/api/provision",
+			key:           "token",
+			body:          `{"clusterName":"test"}`,
+			expectedCode:  http.StatusAccepted,
+			expectedCalls: 1,
+			expectedBody:  `{"id":"1"}`,
+			location:      "/kubes/1",
+		},
+		{
+			name:          "retry",
+			url:           "/v1/api/provision",
+			key:           "token",
+			body:          `{"clusterName":"test"}`,
+			expectedCode:  http.StatusAccepted,
+			expectedCalls: 1,
+			expectedBody:  `{"id":"1"}`,
+			location:      "/kubes/1",
+			replayed:      true,
+		},
+		{
+			name:          "key is reused",
+			url:           "/v1/api/provision",
+			key:           "token",
+			body:          `{"clusterName":"other"}`,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedCalls: 1,
+		},
+		{
+			name:          "no key",
+			url:           "/v1/api/provision",
+			body:          `{"clusterName":"test"}`,
+			expectedCode:  http.StatusAccepted,
+			expectedCalls: 2,
+			expectedBody:  `{"id":"2"}`,
+			location:      "/kubes/2",
+		},
+		{
+			name:          "long key",
+			url:           "/v1/api/provision",
+			key:           strings.Repeat("k", maxKeyLength+1),
+			expectedCode:  http.StatusBadRequest,
+			expectedCalls: 2,
+		},
+		{
+			name:          "failed request",
+			url:           "/v1/api/kubes/test/nodes",
+			key:           "nodes",
+			expectedCode:  http.StatusInternalServerError,
+			expectedCalls: 3,
+		},
+		{
+			name:          "failed request is retried",
+			url:           "/v1/api/kubes/test/nodes",
+			key:           "nodes",
+			expectedCode:  http.StatusInternalServerError,
+			expectedCalls: 4,
+		},
+		{
+			name:          "other route",
+			url:           "/v1/api/kubes/test/snapshots",
+			key:           "token",
+			expectedCode:  http.StatusAccepted,
+			expectedCalls: 5,
+			expectedBody:  `{"id":"5"}`,
+			location:      "/kubes/5",
+		},
+	} {
+		rec := serve(tc.url, tc.key, tc.body)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		require.Equal(t, tc.expectedCalls, calls, "TC: %s", tc.name)
+		require.Equal(t, tc.replayed, rec.Header().Get(HeaderReplayed) == "true", "TC: %s", tc.name)
+		if tc.expectedBody != "" {
+			require.Equal(t, tc.expectedBody, rec.Body.String(), "TC: %s", tc.name)
+			require.Equal(t, tc.location, rec.Header().Get("Location"), "TC: %s", tc.name)
+		}
+	}
+}
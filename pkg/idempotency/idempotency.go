@@ -0,0 +1,226 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/idempotency/"
+	DefaultTTL           = 24 * time.Hour
+	DefaultPruneInterval = time.Hour
+
+	// pendingTimeout is how long a request is considered to be in progress,
+	// records of requests that never finished, e.g. because of a restart,
+	// don't block retries longer than that.
+	pendingTimeout = 10 * time.Minute
+)
+
+const (
+	StatePending = "pending"
+	StateDone    = "done"
+)
+
+var (
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+	ErrMismatch   = errors.New("idempotency key has been used for another request")
+)
+
+// Record is a response to the first request with an idempotency key,
+// it is returned to retries of the request until it expires.
+type Record struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantId,omitempty"`
+	User     string `json:"user"`
+	// Fingerprint is a hash of the method, uri and body of the request,
+	// the key can't be reused for a different request.
+	Fingerprint string `json:"fingerprint"`
+	State       string `json:"state"`
+
+	Code        int    `json:"code,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service keeps responses of requests made with idempotency keys.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	ttl     time.Duration
+	now     func() time.Time
+
+	// requests are deduplicated on the leader, write calls are forwarded to it
+	m sync.Mutex
+}
+
+// NewService constructs a Service, records of all tenants are kept
+// in the storage, so they can be pruned at once.
+func NewService(prefix string, s storage.Interface, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Begin returns a finished record of the key to be replayed, nil is returned
+// if the request is the first one and must be handled, Finish saves its response.
+func (s *Service) Begin(ctx context.Context, user, key, fingerprint string) (*Record, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	id := recordID(tenant.FromContext(ctx), user, key)
+	r, err := s.get(ctx, id)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	now := s.now()
+	if r != nil && now.Before(r.ExpiresAt) {
+		if r.Fingerprint != fingerprint {
+			return nil, ErrMismatch
+		}
+		if r.State == StateDone {
+			return r, nil
+		}
+		if now.Sub(r.CreatedAt) < pendingTimeout {
+			return nil, ErrInProgress
+		}
+		logrus.Warnf("idempotency: request %s hasn't finished in %v, run it again", id, pendingTimeout)
+	}
+
+	r = &Record{
+		ID:          id,
+		TenantID:    tenant.FromContext(ctx),
+		User:        user,
+		Fingerprint: fingerprint,
+		State:       StatePending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	return nil, s.save(ctx, r)
+}
+
+// Finish saves the response of the request, failed requests that can be
+// retried, i.e. server errors, release the key instead.
+func (s *Service) Finish(ctx context.Context, user, key string, code int, contentType, location string, body []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	id := recordID(tenant.FromContext(ctx), user, key)
+	r, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if code >= 500 {
+		return errors.Wrapf(s.storage.Delete(ctx, s.prefix, id), "delete record %s", id)
+	}
+
+	r.State = StateDone
+	r.Code = code
+	r.ContentType = contentType
+	r.Location = location
+	r.Body = body
+
+	return s.save(ctx, r)
+}
+
+// Prune removes expired records and returns a number of them.
+func (s *Service) Prune(ctx context.Context) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	rawRecords, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "storage: get all")
+	}
+
+	now := s.now()
+	pruned := 0
+	for _, raw := range rawRecords {
+		r := &Record{}
+		if err = json.Unmarshal(raw, r); err != nil {
+			logrus.Warnf("idempotency: skip broken record: %v", err)
+			continue
+		}
+		if now.Before(r.ExpiresAt) {
+			continue
+		}
+		if err = s.storage.Delete(ctx, s.prefix, r.ID); err != nil {
+			return pruned, errors.Wrapf(err, "delete record %s", r.ID)
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// Run blocks and prunes expired records every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Prune(ctx); err != nil {
+				logrus.Errorf("idempotency: prune: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Service) get(ctx context.Context, id string) (*Record, error) {
+	raw, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "storage: get record %s", id)
+	}
+	if len(raw) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "record %s", id)
+	}
+
+	r := &Record{}
+	if err = json.Unmarshal(raw, r); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal record %s", id)
+	}
+
+	return r, nil
+}
+
+func (s *Service) save(ctx context.Context, r *Record) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, r.ID, raw), "storage: put record %s", r.ID)
+}
+
+// recordID scopes keys to users, clients don't share keys with each other.
+func recordID(tenantID, user, key string) string {
+	sum := sha256.Sum256([]byte(tenantID + "\x00" + user + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
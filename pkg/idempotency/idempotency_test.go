@@ -0,0 +1,153 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestService() (*Service, *clock) {
+	c := &clock{t: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), time.Hour)
+	svc.now = c.now
+	return svc, c
+}
+
+func TestService_Begin(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name        string
+		prepare     func(svc *Service, c *clock)
+		fingerprint string
+		expectedErr error
+		replayed    bool
+	}{
+		{
+			name:        "first request",
+			prepare:     func(*Service, *clock) {},
+			fingerprint: "a",
+		},
+		{
+			name: "in progress",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+			},
+			fingerprint: "a",
+			expectedErr: ErrInProgress,
+		},
+		{
+			name: "abandoned",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+				c.t = c.t.Add(pendingTimeout)
+			},
+			fingerprint: "a",
+		},
+		{
+			name: "replayed",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+				require.NoError(t, svc.Finish(ctx, "user", "key", http.StatusAccepted, "", "", []byte("{}")))
+			},
+			fingerprint: "a",
+			replayed:    true,
+		},
+		{
+			name: "another request",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+				require.NoError(t, svc.Finish(ctx, "user", "key", http.StatusAccepted, "", "", nil))
+			},
+			fingerprint: "b",
+			expectedErr: ErrMismatch,
+		},
+		{
+			name: "server error",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+				require.NoError(t, svc.Finish(ctx, "user", "key", http.StatusInternalServerError, "", "", nil))
+			},
+			fingerprint: "a",
+		},
+		{
+			name: "expired",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "user", "key", "a")
+				require.NoError(t, err)
+				require.NoError(t, svc.Finish(ctx, "user", "key", http.StatusAccepted, "", "", nil))
+				c.t = c.t.Add(time.Hour)
+			},
+			fingerprint: "b",
+		},
+		{
+			name: "another user",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(ctx, "admin", "key", "a")
+				require.NoError(t, err)
+			},
+			fingerprint: "b",
+		},
+		{
+			name: "another tenant",
+			prepare: func(svc *Service, c *clock) {
+				_, err := svc.Begin(tenant.WithID(ctx, "acme"), "user", "key", "a")
+				require.NoError(t, err)
+			},
+			fingerprint: "b",
+		},
+	} {
+		svc, c := newTestService()
+		tc.prepare(svc, c)
+
+		rec, err := svc.Begin(ctx, "user", "key", tc.fingerprint)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.replayed, rec != nil, "TC: %s", tc.name)
+		if tc.replayed {
+			require.Equal(t, http.StatusAccepted, rec.Code, "TC: %s", tc.name)
+			require.Equal(t, []byte("{}"), rec.Body, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestService_Prune(t *testing.T) {
+	ctx := context.Background()
+	svc, c := newTestService()
+
+	_, err := svc.Begin(ctx, "user", "old", "a")
+	require.NoError(t, err)
+	c.t = c.t.Add(30 * time.Minute)
+	_, err = svc.Begin(tenant.WithID(ctx, "acme"), "user", "new", "a")
+	require.NoError(t, err)
+	c.t = c.t.Add(30 * time.Minute)
+
+	pruned, err := svc.Prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+
+	// the old key can be used for another request
+	_, err = svc.Begin(ctx, "user", "old", "b")
+	require.NoError(t, err)
+	_, err = svc.Begin(tenant.WithID(ctx, "acme"), "user", "new", "b")
+	require.Equal(t, ErrMismatch, err)
+}
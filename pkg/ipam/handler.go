@@ -0,0 +1,63 @@
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+)
+
+// Servicer is an interface of the ipam service.
+type Servicer interface {
+	List(ctx context.Context) ([]Allocation, error)
+	Release(ctx context.Context, clusterName string) error
+}
+
+// Handler is a http handler for network ranges of clusters.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds ipam handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/ipam/allocations", h.listAllocations).Methods(http.MethodGet)
+	r.HandleFunc("/ipam/allocations/{clusterName}", h.releaseAllocation).Methods(http.MethodDelete)
+}
+
+func (h *Handler) listAllocations(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		logrus.Errorf("ipam: list allocations: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// releaseAllocation frees a reservation before it expires, ranges of
+// existing clusters are used until the clusters are deleted.
+func (h *Handler) releaseAllocation(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["clusterName"]
+
+	if err := h.svc.Release(r.Context(), name); err != nil {
+		logrus.Errorf("ipam: release %s: %v", name, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func TestHandler(t *testing.T) {
+	svc, err := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{}, DefaultPools)
+	require.NoError(t, err)
+	require.NoError(t, svc.Allocate(context.Background(), &Allocation{ClusterName: "new"}, true))
+
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipam/allocations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	list := make([]Allocation, 0)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list, 1)
+	require.Equal(t, "172.16.0.0/16", list[0].VPC)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/ipam/allocations/new", nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	list, err = svc.List(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, list)
+}
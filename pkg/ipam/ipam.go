@@ -0,0 +1,339 @@
+package ipam
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const DefaultStoragePrefix = "/supergiant/ipam/"
+
+// DefaultReservation is how long ranges of a cluster that has not been
+// created are kept, failed provisioning requests free their ranges after it.
+const DefaultReservation = time.Hour
+
+// defaultKey is a record key of the default tenant, tenant ids can't start with an underscore.
+const defaultKey = "_default"
+
+var (
+	// ErrOverlap is returned when a requested range is used by another cluster.
+	ErrOverlap = errors.New("cidr overlaps with a range of another cluster")
+	// ErrExhausted is returned when a pool has no free ranges left.
+	ErrExhausted = errors.New("no free ranges left in the pool")
+)
+
+// Pool is a network that ranges of one kind are allocated from.
+type Pool struct {
+	CIDR      string `json:"cidr"`
+	PrefixLen int    `json:"prefixLen"`
+}
+
+// Pools are disjoint, so ranges of different kinds never overlap.
+type Pools struct {
+	VPC      Pool `json:"vpc"`
+	Pods     Pool `json:"pods"`
+	Services Pool `json:"services"`
+}
+
+// DefaultPools leave 10.0.0.0/8 to kubernetes and 172.16.0.0/12 to cloud networks.
+var DefaultPools = Pools{
+	VPC:      Pool{CIDR: "172.16.0.0/12", PrefixLen: 16},
+	Pods:     Pool{CIDR: "10.0.0.0/9", PrefixLen: 16},
+	Services: Pool{CIDR: "10.128.0.0/9", PrefixLen: 16},
+}
+
+// Allocation is a set of ranges used by a cluster.
+type Allocation struct {
+	ClusterName string    `json:"clusterName"`
+	ClusterID   string    `json:"clusterId,omitempty"`
+	VPC         string    `json:"vpc,omitempty"`
+	Pods        string    `json:"pods,omitempty"`
+	Services    string    `json:"services,omitempty"`
+	AllocatedAt time.Time `json:"allocatedAt"`
+}
+
+func (a Allocation) cidrs() []string {
+	return []string{a.VPC, a.Pods, a.Services}
+}
+
+// allocations is a stored record of a tenant, keyed by cluster name.
+type allocations struct {
+	Clusters map[string]Allocation `json:"clusters"`
+}
+
+type kubeLister interface {
+	ListAll(ctx context.Context) ([]model.Kube, error)
+}
+
+// Service assigns non-overlapping ranges to clusters of a tenant, clusters
+// created before the service are taken into account by their stored ranges.
+type Service struct {
+	prefix      string
+	storage     storage.Interface
+	swapper     storage.Swapper
+	kubes       kubeLister
+	pools       Pools
+	reservation time.Duration
+	now         func() time.Time
+}
+
+// NewService constructs a Service, the storage must be able to swap values
+// atomically since several control replicas allocate ranges.
+func NewService(prefix string, s storage.Interface, kubes kubeLister, pools Pools) (*Service, error) {
+	swapper, ok := s.(storage.Swapper)
+	if !ok {
+		return nil, errors.New("storage can't swap values")
+	}
+
+	for _, p := range []Pool{pools.VPC, pools.Pods, pools.Services} {
+		if _, _, err := net.ParseCIDR(p.CIDR); err != nil {
+			return nil, errors.Wrapf(err, "pool %s", p.CIDR)
+		}
+	}
+
+	return &Service{
+		prefix:      prefix,
+		storage:     s,
+		swapper:     swapper,
+		kubes:       kubes,
+		pools:       pools,
+		reservation: DefaultReservation,
+		now:         time.Now,
+	}, nil
+}
+
+// Allocate fills empty ranges of a and reserves all of them for the cluster,
+// VPC range is allocated only when a network is created for the cluster.
+func (s *Service) Allocate(ctx context.Context, a *Allocation, vpc bool) error {
+	kubes, err := s.kubes.ListAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "list kubes")
+	}
+
+	return s.update(ctx, func(record *allocations) error {
+		s.expire(record, kubes)
+
+		used := make([]*net.IPNet, 0)
+		for _, other := range s.list(record, kubes) {
+			if other.ClusterName == a.ClusterName {
+				continue
+			}
+			used = append(used, parseAll(other.cidrs())...)
+		}
+
+		for _, cidr := range a.cidrs() {
+			if n := parse(cidr); n != nil && overlapsAny(n, used) {
+				return errors.Wrapf(ErrOverlap, "%s", cidr)
+			}
+		}
+
+		requests := []struct {
+			cidr *string
+			pool Pool
+		}{
+			{&a.Pods, s.pools.Pods},
+			{&a.Services, s.pools.Services},
+		}
+		if vpc {
+			requests = append(requests, struct {
+				cidr *string
+				pool Pool
+			}{&a.VPC, s.pools.VPC})
+		}
+		for _, r := range requests {
+			if *r.cidr != "" {
+				continue
+			}
+			n, err := next(r.pool, append(used, parseAll(a.cidrs())...))
+			if err != nil {
+				return err
+			}
+			*r.cidr = n.String()
+		}
+
+		a.AllocatedAt = s.now()
+		record.Clusters[a.ClusterName] = *a
+		return nil
+	})
+}
+
+// Release frees ranges of the cluster.
+func (s *Service) Release(ctx context.Context, clusterName string) error {
+	return s.update(ctx, func(record *allocations) error {
+		delete(record.Clusters, clusterName)
+		return nil
+	})
+}
+
+// List returns ranges of all clusters of the tenant sorted by cluster name.
+func (s *Service) List(ctx context.Context) ([]Allocation, error) {
+	kubes, err := s.kubes.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	record, _, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.expire(record, kubes)
+
+	return s.list(record, kubes), nil
+}
+
+// list joins stored allocations with ranges of existing kubes.
+func (s *Service) list(record *allocations, kubes []model.Kube) []Allocation {
+	byName := make(map[string]Allocation, len(record.Clusters)+len(kubes))
+	for name, a := range record.Clusters {
+		byName[name] = a
+	}
+	for _, k := range kubes {
+		byName[k.Name] = Allocation{
+			ClusterName: k.Name,
+			ClusterID:   k.ID,
+			VPC:         k.CloudSpec[clouds.AwsVpcCIDR],
+			Pods:        k.Networking.CIDR,
+			Services:    k.ServicesCIDR,
+			AllocatedAt: byName[k.Name].AllocatedAt,
+		}
+	}
+
+	list := make([]Allocation, 0, len(byName))
+	for _, a := range byName {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ClusterName < list[j].ClusterName
+	})
+
+	return list
+}
+
+// expire drops reservations of clusters that have never been created.
+func (s *Service) expire(record *allocations, kubes []model.Kube) {
+	exist := make(map[string]bool, len(kubes))
+	for _, k := range kubes {
+		exist[k.Name] = true
+	}
+	for name, a := range record.Clusters {
+		if !exist[name] && s.now().Sub(a.AllocatedAt) > s.reservation {
+			delete(record.Clusters, name)
+		}
+	}
+}
+
+func (s *Service) get(ctx context.Context) (*allocations, []byte, error) {
+	raw, err := s.storage.Get(ctx, s.prefix, recordKey(ctx))
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return nil, nil, errors.Wrap(err, "storage: get")
+	}
+
+	record := &allocations{}
+	if raw != nil {
+		if err = json.Unmarshal(raw, record); err != nil {
+			return nil, nil, errors.Wrap(err, "unmarshal")
+		}
+	}
+	if record.Clusters == nil {
+		record.Clusters = make(map[string]Allocation)
+	}
+
+	return record, raw, nil
+}
+
+// update applies the change to the record of the tenant, the record
+// is swapped again if it has been changed by another replica.
+func (s *Service) update(ctx context.Context, change func(*allocations) error) error {
+	for {
+		record, old, err := s.get(ctx)
+		if err != nil {
+			return err
+		}
+		if err = change(record); err != nil {
+			return err
+		}
+
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return errors.Wrap(err, "marshal")
+		}
+
+		ok, err := s.swapper.CompareAndSwap(ctx, s.prefix, recordKey(ctx), old, raw)
+		if err != nil {
+			return errors.Wrap(err, "storage: compare and swap")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+func recordKey(ctx context.Context) string {
+	if id := tenant.FromContext(ctx); id != tenant.DefaultID {
+		return id
+	}
+	return defaultKey
+}
+
+// next returns the first range of the pool that doesn't overlap with used ones.
+func next(p Pool, used []*net.IPNet) (*net.IPNet, error) {
+	_, pool, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pool %s", p.CIDR)
+	}
+	ones, bits := pool.Mask.Size()
+	if bits != 32 || p.PrefixLen < ones || p.PrefixLen > bits {
+		return nil, errors.Errorf("pool %s can't be split to /%d ranges", p.CIDR, p.PrefixLen)
+	}
+
+	start := binary.BigEndian.Uint32(pool.IP.To4())
+	size := uint64(1) << uint(bits-p.PrefixLen)
+	for offset := uint64(0); offset < uint64(1)<<uint(bits-ones); offset += size {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, start+uint32(offset))
+		candidate := &net.IPNet{IP: ip, Mask: net.CIDRMask(p.PrefixLen, bits)}
+		if !overlapsAny(candidate, used) {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrExhausted, "%s", p.CIDR)
+}
+
+func overlapsAny(n *net.IPNet, nets []*net.IPNet) bool {
+	for _, other := range nets {
+		if n.Contains(other.IP) || other.Contains(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+func parseAll(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if n := parse(cidr); n != nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
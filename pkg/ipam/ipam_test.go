@@ -0,0 +1,195 @@
+package ipam
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type fakeKubes []model.Kube
+
+func (f fakeKubes) ListAll(ctx context.Context) ([]model.Kube, error) {
+	return f, nil
+}
+
+func TestService_Allocate(t *testing.T) {
+	existing := fakeKubes{
+		{
+			ID:           "1",
+			Name:         "existing",
+			ServicesCIDR: "10.128.0.0/16",
+			Networking:   model.Networking{CIDR: "10.0.0.0/16"},
+			CloudSpec:    map[string]string{clouds.AwsVpcCIDR: "172.16.0.0/16"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		allocation Allocation
+		vpc        bool
+
+		expectedErr error
+		expected    Allocation
+	}{
+		{
+			name:       "empty ranges",
+			allocation: Allocation{ClusterName: "new"},
+			vpc:        true,
+			expected: Allocation{
+				ClusterName: "new",
+				VPC:         "172.17.0.0/16",
+				Pods:        "10.1.0.0/16",
+				Services:    "10.129.0.0/16",
+			},
+		},
+		{
+			name:       "without vpc",
+			allocation: Allocation{ClusterName: "new"},
+			expected: Allocation{
+				ClusterName: "new",
+				Pods:        "10.1.0.0/16",
+				Services:    "10.129.0.0/16",
+			},
+		},
+		{
+			name: "requested ranges are kept",
+			allocation: Allocation{
+				ClusterName: "new",
+				Pods:        "10.1.0.0/16",
+				Services:    "10.3.0.0/16",
+			},
+			expected: Allocation{
+				ClusterName: "new",
+				Pods:        "10.1.0.0/16",
+				Services:    "10.3.0.0/16",
+			},
+		},
+		{
+			name: "free ranges skip requested ones",
+			allocation: Allocation{
+				ClusterName: "new",
+				Services:    "10.1.0.0/16",
+			},
+			expected: Allocation{
+				ClusterName: "new",
+				Pods:        "10.2.0.0/16",
+				Services:    "10.1.0.0/16",
+			},
+		},
+		{
+			name: "overlap",
+			allocation: Allocation{
+				ClusterName: "new",
+				Pods:        "10.0.128.0/17",
+			},
+			expectedErr: ErrOverlap,
+		},
+		{
+			name: "ranges of the same cluster",
+			allocation: Allocation{
+				ClusterName: "existing",
+				Pods:        "10.0.0.0/16",
+			},
+			expected: Allocation{
+				ClusterName: "existing",
+				Pods:        "10.0.0.0/16",
+				Services:    "10.128.0.0/16",
+			},
+		},
+	} {
+		svc, err := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), existing, DefaultPools)
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		a := tc.allocation
+		err = svc.Allocate(context.Background(), &a, tc.vpc)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if tc.expectedErr != nil {
+			continue
+		}
+
+		a.AllocatedAt = time.Time{}
+		require.Equal(t, tc.expected, a, "TC: %s", tc.name)
+	}
+}
+
+func TestService_AllocateSequential(t *testing.T) {
+	now := time.Now()
+	svc, err := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{}, DefaultPools)
+	require.NoError(t, err)
+	svc.now = func() time.Time {
+		return now
+	}
+
+	first := &Allocation{ClusterName: "first"}
+	require.NoError(t, svc.Allocate(context.Background(), first, false))
+	second := &Allocation{ClusterName: "second"}
+	require.NoError(t, svc.Allocate(context.Background(), second, false))
+	require.NotEqual(t, first.Pods, second.Pods, "reserved ranges must not be assigned twice")
+
+	// tenants have their own ranges
+	other := &Allocation{ClusterName: "first"}
+	require.NoError(t, svc.Allocate(tenant.WithID(context.Background(), "acme"), other, false))
+	require.Equal(t, first.Pods, other.Pods)
+
+	list, err := svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "first", list[0].ClusterName)
+
+	require.NoError(t, svc.Release(context.Background(), "first"))
+	list, err = svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	now = now.Add(DefaultReservation + time.Second)
+	list, err = svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 0, "reservations of clusters that have not been created must expire")
+}
+
+func TestNext(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pool     Pool
+		used     []string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "empty pool",
+			pool:     Pool{CIDR: "10.0.0.0/8", PrefixLen: 16},
+			expected: "10.0.0.0/16",
+		},
+		{
+			name:     "used range inside a block",
+			pool:     Pool{CIDR: "10.0.0.0/8", PrefixLen: 16},
+			used:     []string{"10.0.3.0/24"},
+			expected: "10.1.0.0/16",
+		},
+		{
+			name: "exhausted",
+			pool: Pool{CIDR: "10.0.0.0/15", PrefixLen: 16},
+			used: []string{"10.0.0.0/8"},
+			err:  true,
+		},
+		{
+			name: "wrong prefix",
+			pool: Pool{CIDR: "10.0.0.0/16", PrefixLen: 8},
+			err:  true,
+		},
+	} {
+		n, err := next(tc.pool, parseAll(tc.used))
+		require.Equal(t, tc.err, err != nil, "TC: %s: %v", tc.name, err)
+		if !tc.err {
+			require.Equal(t, tc.expected, n.String(), "TC: %s", tc.name)
+		}
+	}
+}
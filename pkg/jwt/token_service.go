@@ -23,13 +23,41 @@ func NewTokenService(tokenTTL int64, secret []byte) *TokenService {
 }
 
 func (ts TokenService) Issue(userId string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		// TODO(stgleb): Pass list of access here
-		"accesses":   []string{"edit", "view"},
+	return ts.IssueWithTenant(userId, "")
+}
+
+// IssueWithTenant issues a token of the user that belongs to the tenant.
+func (ts TokenService) IssueWithTenant(userId, tenantId string) (string, error) {
+	return ts.IssueWithAccesses(userId, tenantId, []string{"edit", "view"})
+}
+
+// IssueWithAccesses issues a token of the user limited to the accesses,
+// e.g. tokens without the edit access can't change anything.
+func (ts TokenService) IssueWithAccesses(userId, tenantId string, accesses []string) (string, error) {
+	return ts.issue(jwt.MapClaims{
+		"accesses":   accesses,
 		"user_id":    userId,
+		"tenant_id":  tenantId,
 		"issued_at":  time.Now().Unix(),
 		"expires_at": time.Now().Unix() + ts.tokenTTL,
 	})
+}
+
+// IssueForSession issues a token of the session that expires with it,
+// the token is accepted only while the session is not revoked.
+func (ts TokenService) IssueForSession(userId, tenantId, sessionId string, accesses []string, expiresAt time.Time) (string, error) {
+	return ts.issue(jwt.MapClaims{
+		"accesses":   accesses,
+		"user_id":    userId,
+		"tenant_id":  tenantId,
+		"session_id": sessionId,
+		"issued_at":  time.Now().Unix(),
+		"expires_at": expiresAt.Unix(),
+	})
+}
+
+func (ts TokenService) issue(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
 
 	tokenString, err := token.SignedString(ts.secretKey)
 
@@ -99,3 +99,51 @@ func TestTokenService_ValidateExpired(t *testing.T) {
 		t.Error("Claims must be nil")
 	}
 }
+
+func TestTokenService_IssueWithAccesses(t *testing.T) {
+	ts := NewTokenService(60, []byte("secret key"))
+
+	tokenString, err := ts.IssueWithAccesses("user", "acme", []string{"view"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ts.Validate(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accesses, ok := claims["accesses"].([]interface{})
+	if !ok || len(accesses) != 1 || accesses[0] != "view" {
+		t.Errorf("Wrong accesses expected [view] actual %v", claims["accesses"])
+	}
+	if claims["tenant_id"] != "acme" {
+		t.Errorf("Wrong tenant expected acme actual %v", claims["tenant_id"])
+	}
+}
+
+func TestTokenService_IssueForSession(t *testing.T) {
+	ts := NewTokenService(60, []byte("secret key"))
+
+	tokenString, err := ts.IssueForSession("user", "acme", "session", []string{"view"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ts.Validate(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["session_id"] != "session" {
+		t.Errorf("Wrong session expected session actual %v", claims["session_id"])
+	}
+
+	// the session lifetime is used instead of the ttl of the service
+	tokenString, err = ts.IssueForSession("user", "acme", "session", []string{"view"}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ts.Validate(tokenString); err != sgerrors.ErrTokenExpired {
+		t.Errorf("Wrong error expected %v actual %v", sgerrors.ErrTokenExpired, err)
+	}
+}
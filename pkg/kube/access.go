@@ -0,0 +1,380 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	clientcmddapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	DefaultAccessRole = "edit"
+
+	// service accounts of grants live in kube-system, users
+	// of the namespaces can't read their tokens
+	accessNamespace  = metav1.NamespaceSystem
+	accessGrantLabel = "supergiant.io/access-grant"
+	roleBindings     = "rolebindings"
+)
+
+// accessTokenTimeout is how long the token controller is waited for.
+var accessTokenTimeout = time.Minute
+
+// AccessRequest describes an external user, e.g. a contractor or a ci job,
+// that is let to the namespaces with the cluster role, edit by default.
+type AccessRequest struct {
+	Name        string   `json:"name"`
+	Namespaces  []string `json:"namespaces"`
+	ClusterRole string   `json:"clusterRole"`
+}
+
+func (r *AccessRequest) validate() error {
+	if r.ClusterRole == "" {
+		r.ClusterRole = DefaultAccessRole
+	}
+	if r.Name == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "name is required")
+	}
+	if len(r.Namespaces) == 0 {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "namespaces are required")
+	}
+	for _, ns := range r.Namespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "namespace %q: %v", ns, errs)
+		}
+	}
+
+	return nil
+}
+
+// GrantAccess creates a service account for the user and binds it to the
+// cluster role in the namespaces, the grant is tracked in the kube.
+func (s Service) GrantAccess(ctx context.Context, kname, user string, req *AccessRequest) (*model.AccessGrant, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := model.AccessGrant{
+		ID:          uuid.New()[:8],
+		Name:        req.Name,
+		Namespaces:  req.Namespaces,
+		ClusterRole: req.ClusterRole,
+		CreatedBy:   user,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err = s.createAccessObjects(k, grant); err != nil {
+		if rmErr := s.deleteAccessObjects(k, grant); rmErr != nil {
+			logrus.Warnf("kube %s: clean up access grant %s: %v", k.ID, grant.ID, rmErr)
+		}
+		return nil, err
+	}
+
+	k.AccessGrants = append(k.AccessGrants, grant)
+	if err = s.Create(ctx, k); err != nil {
+		return nil, errors.Wrapf(err, "update kube %s", k.ID)
+	}
+
+	return &grant, nil
+}
+
+// AccessKubeConfig returns a kubeconfig with a token of the service account of the grant.
+func (s Service) AccessKubeConfig(ctx context.Context, kname, grantID string) ([]byte, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return nil, err
+	}
+	grant, ok := findGrant(k, grantID)
+	if !ok {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "access grant %s", grantID)
+	}
+
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, err
+	}
+
+	var token []byte
+	// the token is filled by the token controller of the cluster
+	err = wait.PollImmediate(time.Second, accessTokenTimeout, func() (bool, error) {
+		secret, err := kclient.Secrets(accessNamespace).Get(accessAccountName(grant), metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		token = secret.Data[corev1.ServiceAccountTokenKey]
+		return len(token) > 0, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get token of access grant %s", grantID)
+	}
+
+	kubeconfig, err := adminKubeConfig(k)
+	if err != nil {
+		return nil, err
+	}
+
+	userContext := grant.Name + "@" + k.Name
+	kubeconfig.AuthInfos = map[string]*clientcmddapi.AuthInfo{
+		userContext: {
+			Token: string(token),
+		},
+	}
+	kubeconfig.Contexts = map[string]*clientcmddapi.Context{
+		userContext: {
+			AuthInfo:  userContext,
+			Cluster:   k.Name,
+			Namespace: grant.Namespaces[0],
+		},
+	}
+	kubeconfig.CurrentContext = userContext
+
+	return encodeKubeConfig(kubeconfig)
+}
+
+// RevokeAccess deletes the service account of the grant and its bindings,
+// tokens of the account are invalidated with it.
+func (s Service) RevokeAccess(ctx context.Context, kname, grantID string) error {
+	if s.corev1ClientFn == nil {
+		return errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return err
+	}
+	grant, ok := findGrant(k, grantID)
+	if !ok {
+		return errors.Wrapf(sgerrors.ErrNotFound, "access grant %s", grantID)
+	}
+
+	if err = s.deleteAccessObjects(k, grant); err != nil {
+		return err
+	}
+
+	grants := make([]model.AccessGrant, 0, len(k.AccessGrants))
+	for _, g := range k.AccessGrants {
+		if g.ID != grantID {
+			grants = append(grants, g)
+		}
+	}
+	k.AccessGrants = grants
+
+	return errors.Wrapf(s.Create(ctx, k), "update kube %s", k.ID)
+}
+
+func (s Service) createAccessObjects(k *model.Kube, grant model.AccessGrant) error {
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return err
+	}
+	rbac, err := s.clientForGroupFn(k, rbacv1.SchemeGroupVersion)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	name := accessAccountName(grant)
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: accessNamespace,
+		Labels:    map[string]string{accessGrantLabel: grant.ID},
+	}
+
+	if _, err = kclient.ServiceAccounts(accessNamespace).Create(&corev1.ServiceAccount{ObjectMeta: meta}); err != nil {
+		return errors.Wrapf(err, "create service account %s", name)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: *meta.DeepCopy(),
+		Type:       corev1.SecretTypeServiceAccountToken,
+	}
+	secret.Annotations = map[string]string{corev1.ServiceAccountNameKey: name}
+	if _, err = kclient.Secrets(accessNamespace).Create(secret); err != nil {
+		return errors.Wrapf(err, "create token of service account %s", name)
+	}
+
+	for _, ns := range grant.Namespaces {
+		binding := rbacv1.RoleBinding{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+				Kind:       "RoleBinding",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    meta.Labels,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     grant.ClusterRole,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      name,
+					Namespace: accessNamespace,
+				},
+			},
+		}
+		if err = create(rbac, ns, roleBindings, &binding); err != nil {
+			return errors.Wrapf(err, "bind %s role in namespace %s", grant.ClusterRole, ns)
+		}
+	}
+
+	return nil
+}
+
+// deleteAccessObjects removes objects of the grant, missing ones are skipped.
+func (s Service) deleteAccessObjects(k *model.Kube, grant model.AccessGrant) error {
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return err
+	}
+	rbac, err := s.clientForGroupFn(k, rbacv1.SchemeGroupVersion)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	name := accessAccountName(grant)
+	for _, ns := range grant.Namespaces {
+		if err = ignoreNotFound(deleteObject(rbac, ns, roleBindings, name)); err != nil {
+			return errors.Wrapf(err, "delete role binding in namespace %s", ns)
+		}
+	}
+	if err = ignoreNotFound(kclient.Secrets(accessNamespace).Delete(name, &metav1.DeleteOptions{})); err != nil {
+		return errors.Wrapf(err, "delete token of service account %s", name)
+	}
+	if err = ignoreNotFound(kclient.ServiceAccounts(accessNamespace).Delete(name, &metav1.DeleteOptions{})); err != nil {
+		return errors.Wrapf(err, "delete service account %s", name)
+	}
+
+	return nil
+}
+
+func findGrant(k *model.Kube, id string) (model.AccessGrant, bool) {
+	for _, g := range k.AccessGrants {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return model.AccessGrant{}, false
+}
+
+func accessAccountName(grant model.AccessGrant) string {
+	return "sg-access-" + grant.ID
+}
+
+func deleteObject(client rest.Interface, ns, resource, name string) error {
+	return inNamespace(client.Delete(), ns).Resource(resource).Name(name).Do().Error()
+}
+
+func ignoreNotFound(err error) error {
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (h *Handler) listAccessGrants(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	grants := k.AccessGrants
+	if grants == nil {
+		grants = make([]model.AccessGrant, 0)
+	}
+	if err := json.NewEncoder(w).Encode(grants); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) grantAccess(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := &AccessRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	grant, err := h.svc.GrantAccess(r.Context(), kubeID, api.UserFromContext(r.Context()), req)
+	if err != nil {
+		sendAccessError(w, kubeID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(grant); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// getAccessKubeConfig returns a kubeconfig of the grant, e.g. for a ci job:
+// GET /kubes/{kubeID}/access/{grantID}/kubeconfig
+func (h *Handler) getAccessKubeConfig(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	data, err := h.svc.AccessKubeConfig(r.Context(), vars["kubeID"], vars["grantID"])
+	if err != nil {
+		sendAccessError(w, vars["grantID"], err)
+		return
+	}
+
+	if _, err = w.Write(data); err != nil {
+		logrus.Errorf("kubes: %s cluster: get access kubeconfig: write response: %s", vars["kubeID"], err)
+	}
+}
+
+func (h *Handler) revokeAccess(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.svc.RevokeAccess(r.Context(), vars["kubeID"], vars["grantID"]); err != nil {
+		sendAccessError(w, vars["grantID"], err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sendAccessError(w http.ResponseWriter, id string, err error) {
+	switch errors.Cause(err) {
+	case sgerrors.ErrNotFound:
+		message.SendNotFound(w, id, err)
+	case sgerrors.ErrInvalidJson:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
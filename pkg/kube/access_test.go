@@ -0,0 +1,243 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+)
+
+func fakeAccessClient(actions *[]string, token string) func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+	return func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		cl := &fakev1client.FakeCoreV1{
+			Fake: &kubetesting.Fake{},
+		}
+		cl.AddReactor("*", "*", func(action kubetesting.Action) (bool, runtime.Object, error) {
+			*actions = append(*actions, action.GetVerb()+" "+action.GetResource().Resource)
+			if action.GetVerb() == "get" {
+				return true, &corev1.Secret{
+					Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte(token)},
+				}, nil
+			}
+			return true, nil, nil
+		})
+		return cl, nil
+	}
+}
+
+func TestService_GrantAccess(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		req         AccessRequest
+		expectedErr error
+	}{
+		{
+			name:        "no namespaces",
+			req:         AccessRequest{Name: "ci"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid namespace",
+			req:         AccessRequest{Name: "ci", Namespaces: []string{"Apps"}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "ok",
+			req:  AccessRequest{Name: "ci", Namespaces: []string{"apps", "jobs"}},
+		},
+	} {
+		k := &model.Kube{ID: "kube"}
+		data, _ := json.Marshal(k)
+		repo := new(testutils.MockStorage)
+		repo.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(data, nil)
+		repo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		rbac := newFakeAPIServer(t, map[string]string{})
+		actions := make([]string, 0)
+		svc := Service{
+			storage:          repo,
+			corev1ClientFn:   fakeAccessClient(&actions, ""),
+			clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": rbac}),
+		}
+
+		grant, err := svc.GrantAccess(context.Background(), "kube", "alice", &tc.req)
+		rbac.Close()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Equal(t, DefaultAccessRole, grant.ClusterRole, "TC: %s", tc.name)
+		require.Equal(t, "alice", grant.CreatedBy, "TC: %s", tc.name)
+		require.Equal(t, []string{"create serviceaccounts", "create secrets"}, actions, "TC: %s", tc.name)
+		for _, ns := range tc.req.Namespaces {
+			binding := rbac.objects["/apis/rbac.authorization.k8s.io/v1/namespaces/"+ns+"/rolebindings/sg-access-"+grant.ID]
+			require.Contains(t, binding, `"name":"edit"`, "TC: %s", tc.name)
+			require.Contains(t, binding, `"namespace":"kube-system"`, "TC: %s", tc.name)
+		}
+		repo.AssertCalled(t, "Put", mock.Anything, mock.Anything, "kube", mock.Anything)
+	}
+}
+
+func TestService_AccessKubeConfig(t *testing.T) {
+	k := &model.Kube{
+		ID:      "kube",
+		Name:    "prod",
+		Masters: map[string]*model.Machine{"master": {PublicIp: "10.0.0.1"}},
+		AccessGrants: []model.AccessGrant{
+			{ID: "grant", Name: "ci", Namespaces: []string{"apps"}},
+		},
+	}
+	data, _ := json.Marshal(k)
+	repo := new(testutils.MockStorage)
+	repo.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(data, nil)
+
+	actions := make([]string, 0)
+	svc := Service{
+		storage:        repo,
+		corev1ClientFn: fakeAccessClient(&actions, "secret-token"),
+	}
+
+	_, err := svc.AccessKubeConfig(context.Background(), "kube", "unknown")
+	require.Equal(t, sgerrors.ErrNotFound, errors.Cause(err))
+
+	kubeconfig, err := svc.AccessKubeConfig(context.Background(), "kube", "grant")
+	require.NoError(t, err)
+	require.Contains(t, string(kubeconfig), "secret-token")
+	require.Contains(t, string(kubeconfig), `"namespace":"apps"`)
+	require.Contains(t, string(kubeconfig), `"current-context":"ci@prod"`)
+	require.NotContains(t, string(kubeconfig), "client-certificate-data")
+}
+
+func TestService_RevokeAccess(t *testing.T) {
+	k := &model.Kube{
+		ID: "kube",
+		AccessGrants: []model.AccessGrant{
+			{ID: "grant", Name: "ci", Namespaces: []string{"apps"}},
+			{ID: "other", Name: "contractor", Namespaces: []string{"web"}},
+		},
+	}
+	data, _ := json.Marshal(k)
+	repo := new(testutils.MockStorage)
+	repo.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(data, nil)
+	repo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	rbac := newFakeAPIServer(t, map[string]string{})
+	defer rbac.Close()
+	actions := make([]string, 0)
+	svc := Service{
+		storage:          repo,
+		corev1ClientFn:   fakeAccessClient(&actions, ""),
+		clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": rbac}),
+	}
+
+	err := svc.RevokeAccess(context.Background(), "kube", "unknown")
+	require.Equal(t, sgerrors.ErrNotFound, errors.Cause(err))
+
+	require.NoError(t, svc.RevokeAccess(context.Background(), "kube", "grant"))
+	require.Equal(t, []string{"delete secrets", "delete serviceaccounts"}, actions)
+
+	saved := &model.Kube{}
+	stored := repo.Calls[len(repo.Calls)-1].Arguments.Get(3).([]byte)
+	require.NoError(t, json.Unmarshal(stored, saved))
+	require.Len(t, saved.AccessGrants, 1)
+	require.Equal(t, "other", saved.AccessGrants[0].ID)
+}
+
+func TestHandler_grantAccess(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "validation failed",
+			body:         `{"name": "ci"}`,
+			svcErr:       sgerrors.ErrInvalidJson,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "kube not found",
+			body:         `{"name": "ci", "namespaces": ["apps"]}`,
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "created",
+			body:         `{"name": "ci", "namespaces": ["apps"]}`,
+			expectedCode: http.StatusCreated,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("GrantAccess", mock.Anything, "kube", mock.Anything, mock.Anything).
+			Return(&model.AccessGrant{ID: "grant"}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/access", strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
+
+func TestHandler_revokeAccess(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "revoked",
+			expectedCode: http.StatusNoContent,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("RevokeAccess", mock.Anything, "kube", "grant").Return(tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodDelete, "/kubes/kube/access/grant", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
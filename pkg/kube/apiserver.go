@@ -0,0 +1,167 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// APIServerAccess is an allow-list of clients of the api server, an empty
+// list exposes the api server to any address.
+type APIServerAccess struct {
+	AllowedCIDRs []string `json:"allowedCidrs"`
+}
+
+func validateCIDRs(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid cidr %s", cidr)
+		}
+	}
+	return nil
+}
+
+// getAPIServerAccess returns the allow-list of the api server of the cluster.
+func (h *Handler) getAPIServerAccess(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	access := APIServerAccess{AllowedCIDRs: k.APIServerAllowedCIDRs}
+	if access.AllowedCIDRs == nil {
+		access.AllowedCIDRs = []string{}
+	}
+	if err = json.NewEncoder(w).Encode(access); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// updateAPIServerAccess replaces the allow-list of the api server in the cloud
+// firewall of masters, the list is recorded once the task has applied it.
+func (h *Handler) updateAPIServerAccess(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := APIServerAccess{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if err := validateCIDRs(req.AllowedCIDRs); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, k.AccountName, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	config := &steps.Config{
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Masters:          steps.NewMap(k.Masters),
+		Nodes:            steps.NewMap(k.Nodes),
+		APIServerAccess: steps.APIServerAccess{
+			AllowedCIDRs: req.AllowedCIDRs,
+			Applied:      k.APIServerAllowedCIDRs,
+		},
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if err = util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	t, err := workflows.NewTask(workflows.UpdateAPIServerAccess, h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	writer, err := h.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	k.Tasks[workflows.APIServerTask] = append(k.Tasks[workflows.APIServerTask], t.ID)
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	ctx := tenant.Detach(r.Context())
+	errChan := t.Run(ctx, *config, writer)
+	go h.recordAPIServerAccess(ctx, kubeID, t, req.AllowedCIDRs, errChan)
+
+	workflows.SendAccepted(w, t.ID, t.ID)
+}
+
+func (h *Handler) recordAPIServerAccess(ctx context.Context, kubeID string, t *workflows.Task,
+	cidrs []string, errChan chan error) {
+	if err := <-errChan; err != nil {
+		logrus.Errorf("update api server access of cluster %s caused %v", kubeID, err)
+		return
+	}
+
+	k, err := h.svc.Get(ctx, kubeID)
+	if err != nil {
+		logrus.Errorf("update api server access of cluster %s: get kube: %v", kubeID, err)
+		return
+	}
+
+	k.APIServerAllowedCIDRs = cidrs
+	// azure security group is created by the first allow-list
+	if t.Config != nil && t.Config.AzureConfig.SecurityGroupName != "" {
+		if k.CloudSpec == nil {
+			k.CloudSpec = make(map[string]string)
+		}
+		k.CloudSpec[clouds.AzureSecurityGroup] = t.Config.AzureConfig.SecurityGroupName
+	}
+	if err = h.svc.Create(ctx, k); err != nil {
+		logrus.Errorf("update api server access of cluster %s: save kube: %v", kubeID, err)
+	}
+}
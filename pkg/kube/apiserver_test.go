@@ -0,0 +1,204 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestHandler_getAPIServerAccess(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		kube    *model.Kube
+		kubeErr error
+
+		expectedCode  int
+		expectedCIDRs []string
+	}{
+		{
+			name:         "not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:          "open",
+			kube:          &model.Kube{ID: "kube"},
+			expectedCode:  http.StatusOK,
+			expectedCIDRs: []string{},
+		},
+		{
+			name:          "allow-list",
+			kube:          &model.Kube{ID: "kube", APIServerAllowedCIDRs: []string{"203.0.113.0/24"}},
+			expectedCode:  http.StatusOK,
+			expectedCIDRs: []string{"203.0.113.0/24"},
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, tc.kubeErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/apiserver/access", h.getAPIServerAccess)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/apiserver/access", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		access := APIServerAccess{}
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&access))
+		require.Equal(t, tc.expectedCIDRs, access.AllowedCIDRs, tc.name)
+	}
+}
+
+func TestHandler_updateAPIServerAccess(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cidrs   []string
+		kube    *model.Kube
+		kubeErr error
+		accErr  error
+
+		expectedCode int
+	}{
+		{
+			name:         "invalid cidr",
+			cidrs:        []string{"203.0.113.1"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			cidrs:        []string{"203.0.113.0/24"},
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "account error",
+			cidrs:        []string{"203.0.113.0/24"},
+			kube:         &model.Kube{ID: "kube", Provider: clouds.AWS},
+			accErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "accepted",
+			cidrs:        []string{"203.0.113.0/24"},
+			kube:         &model.Kube{ID: "kube", Provider: clouds.AWS},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "open",
+			kube:         &model.Kube{ID: "kube", Provider: clouds.AWS, APIServerAllowedCIDRs: []string{"203.0.113.0/24"}},
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.UpdateAPIServerAccess, []steps.Step{})
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, tc.kubeErr)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(&model.CloudAccount{Provider: clouds.AWS}, tc.accErr)
+
+		mockRepo := new(testutils.MockStorage)
+		mockRepo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+
+		h := Handler{
+			svc:            svc,
+			accountService: accService,
+			repo:           mockRepo,
+			getWriter: func(string) (io.WriteCloser, error) {
+				return &bufferCloser{}, nil
+			},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/apiserver/access", h.updateAPIServerAccess)
+
+		body, _ := json.Marshal(APIServerAccess{AllowedCIDRs: tc.cidrs})
+		req := httptest.NewRequest(http.MethodPut, "/kubes/kube/apiserver/access", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusAccepted {
+			continue
+		}
+
+		var taskID string
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&taskID))
+		require.Equal(t, []string{taskID}, tc.kube.Tasks[workflows.APIServerTask])
+	}
+}
+
+func TestHandler_recordAPIServerAccess(t *testing.T) {
+	cidrs := []string{"203.0.113.0/24"}
+
+	for _, tc := range []struct {
+		name          string
+		taskErr       error
+		securityGroup string
+		saved         bool
+	}{
+		{
+			name:    "task failed",
+			taskErr: errors.New("denied"),
+		},
+		{
+			name:  "applied",
+			saved: true,
+		},
+		{
+			name:          "azure security group",
+			securityGroup: "sg-kube-apiserver",
+			saved:         true,
+		},
+	} {
+		k := &model.Kube{ID: "kube"}
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		errChan := make(chan error, 1)
+		errChan <- tc.taskErr
+
+		task := &workflows.Task{
+			Config: &steps.Config{
+				AzureConfig: steps.AzureConfig{SecurityGroupName: tc.securityGroup},
+			},
+		}
+
+		h := Handler{svc: svc}
+		h.recordAPIServerAccess(context.Background(), "kube", task, cidrs, errChan)
+
+		if !tc.saved {
+			svc.AssertNotCalled(t, serviceCreate, mock.Anything, mock.Anything)
+			continue
+		}
+		require.Equal(t, cidrs, k.APIServerAllowedCIDRs, tc.name)
+		require.Equal(t, tc.securityGroup, k.CloudSpec[clouds.AzureSecurityGroup], tc.name)
+		svc.AssertCalled(t, serviceCreate, mock.Anything, k)
+	}
+}
@@ -0,0 +1,299 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/notification"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// AutoUpgradeRequest opts a cluster in or out of automatic patch upgrades,
+// it resumes paused upgrades as well.
+type AutoUpgradeRequest struct {
+	Enabled bool                    `json:"enabled"`
+	Window  model.MaintenanceWindow `json:"window"`
+}
+
+func (r AutoUpgradeRequest) validate() error {
+	if r.Window.StartHour < 0 || r.Window.StartHour > 23 {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "start hour %d", r.Window.StartHour)
+	}
+	if r.Window.Hours < 1 || r.Window.Hours > 24 {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "window of %d hours", r.Window.Hours)
+	}
+	for _, d := range r.Window.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "day %d", d)
+		}
+	}
+	return nil
+}
+
+// setAutoUpgrade changes automatic upgrades of the cluster:
+// PUT /kubes/{kubeID}/autoupgrade {"enabled": true, "window": {"days": [6], "startHour": 2, "hours": 4}}
+func (h *Handler) setAutoUpgrade(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := AutoUpgradeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if k.AutoUpgrade.Paused {
+		logrus.Infof("kube %s: automatic upgrades have been resumed", kubeID)
+	}
+	k.AutoUpgrade.Enabled = req.Enabled
+	k.AutoUpgrade.Window = req.Window
+	k.AutoUpgrade.Paused = false
+	k.AutoUpgrade.PauseReason = ""
+
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(k); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// AutoUpgrader applies patch releases the release channels offer to
+// clusters that have opted in, within their maintenance windows. A failed
+// upgrade pauses upgrades of the cluster until users resume them.
+type AutoUpgrader struct {
+	svc            Interface
+	accountService accountGetter
+	repo           storage.Interface
+	versions       versionCatalog
+	publisher      notification.Publisher
+
+	interval time.Duration
+
+	nowFn     func() time.Time
+	getWriter func(string) (io.WriteCloser, error)
+}
+
+// NewAutoUpgrader constructs an AutoUpgrader that looks for upgrades every interval.
+func NewAutoUpgrader(svc Interface, accountService accountGetter, repo storage.Interface,
+	catalog versionCatalog, publisher notification.Publisher, interval time.Duration) *AutoUpgrader {
+	return &AutoUpgrader{
+		svc:            svc,
+		accountService: accountService,
+		repo:           repo,
+		versions:       catalog,
+		publisher:      publisher,
+		interval:       interval,
+		nowFn:          time.Now,
+		getWriter:      util.GetWriter,
+	}
+}
+
+// Run blocks and upgrades clusters of all tenants every interval until ctx is
+// cancelled.
+func (u *AutoUpgrader) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.upgradeAll(ctx)
+		}
+	}
+}
+
+func (u *AutoUpgrader) upgradeAll(ctx context.Context) {
+	c, err := catalogOf(ctx, u.versions)
+	if err != nil {
+		logrus.Errorf("auto upgrade: get version catalog: %v", err)
+		return
+	}
+	kubes, err := u.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("auto upgrade: list kubes: %v", err)
+		return
+	}
+
+	for i := range kubes {
+		k := &kubes[i]
+		if !u.due(k) {
+			continue
+		}
+		ctx := tenant.WithID(ctx, k.TenantID)
+		v, ok := c.Upgrade(k.Provider, channelOf(k), k.K8SVersion)
+		if !ok {
+			continue
+		}
+
+		logrus.Infof("auto upgrade: cluster %s: upgrade kubernetes from %s to %s",
+			k.ID, k.K8SVersion, v.Version)
+		if err := u.Upgrade(ctx, k, v.Version); err != nil {
+			logrus.Errorf("auto upgrade: cluster %s: %v", k.ID, err)
+			u.pause(ctx, k, v.Version, err)
+			continue
+		}
+		u.complete(ctx, k, v.Version)
+	}
+}
+
+// due tells whether the cluster may be upgraded now.
+func (u *AutoUpgrader) due(k *model.Kube) bool {
+	return k.State == model.StateOperational && !k.InMaintenance() &&
+		k.AutoUpgrade.Enabled && !k.AutoUpgrade.Paused &&
+		k.AutoUpgrade.Window.Contains(u.nowFn())
+}
+
+// Upgrade upgrades masters and then nodes one at a time, the first master
+// upgrades the control plane. It stops on the first failed machine.
+func (u *AutoUpgrader) Upgrade(ctx context.Context, k *model.Kube, version string) error {
+	acc, err := u.accountService.Get(ctx, k.AccountName)
+	if err != nil {
+		return errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+
+	if err := u.update(ctx, k.ID, func(k *model.Kube) {
+		k.AutoUpgrade.LastVersion = version
+		k.AutoUpgrade.LastAttempt = u.nowFn()
+	}); err != nil {
+		return errors.Wrap(err, "update kube")
+	}
+
+	for i, m := range rolloutOrder(k) {
+		workflow := workflows.UpgradeNode
+		if m.Role == model.RoleMaster {
+			workflow = workflows.UpgradeMaster
+		}
+
+		t, err := workflows.NewTask(workflow, u.repo)
+		if err != nil {
+			return errors.Wrap(err, "new task")
+		}
+
+		config := &steps.Config{
+			Kube:             *k,
+			Provider:         k.Provider,
+			IsMaster:         m.Role == model.RoleMaster,
+			ClusterID:        k.ID,
+			ClusterName:      k.Name,
+			CloudAccountName: k.AccountName,
+			Node:             *m,
+			Masters:          steps.NewMap(k.Masters),
+			DrainConfig: steps.DrainConfig{
+				PrivateIP: m.PrivateIp,
+			},
+			UpgradeConfig: steps.UpgradeConfig{
+				K8SVersion: version,
+				// rollout order starts with masters
+				Apply: i == 0 && m.Role == model.RoleMaster,
+			},
+		}
+
+		if err := util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+			return errors.Wrap(err, "fill cloud account credentials")
+		}
+
+		if err := u.update(ctx, k.ID, func(k *model.Kube) {
+			if k.Tasks == nil {
+				k.Tasks = make(map[string][]string)
+			}
+			k.Tasks[workflows.UpgradeTask] = append(k.Tasks[workflows.UpgradeTask], t.ID)
+		}); err != nil {
+			logrus.Warnf("auto upgrade: cluster %s: record task %s: %v", k.ID, t.ID, err)
+		}
+
+		writer, err := u.getWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return errors.Wrap(err, "get writer")
+		}
+
+		if err := <-t.Run(ctx, *config, writer); err != nil {
+			return errors.Wrapf(err, "machine %s", m.Name)
+		}
+	}
+
+	return nil
+}
+
+func (u *AutoUpgrader) pause(ctx context.Context, k *model.Kube, version string, upgradeErr error) {
+	reason := fmt.Sprintf("upgrade to %s has failed: %v", version, upgradeErr)
+	if err := u.update(ctx, k.ID, func(k *model.Kube) {
+		k.AutoUpgrade.Paused = true
+		k.AutoUpgrade.PauseReason = reason
+	}); err != nil {
+		logrus.Errorf("auto upgrade: cluster %s: pause: %v", k.ID, err)
+	}
+
+	u.publish(ctx, k, notification.EventUpgradeFailed, version,
+		fmt.Sprintf("automatic upgrades of cluster %s are paused: %s", k.Name, reason))
+}
+
+func (u *AutoUpgrader) complete(ctx context.Context, k *model.Kube, version string) {
+	if err := u.update(ctx, k.ID, func(k *model.Kube) {
+		k.K8SVersion = version
+	}); err != nil {
+		logrus.Errorf("auto upgrade: cluster %s: set version %s: %v", k.ID, version, err)
+	}
+
+	u.publish(ctx, k, notification.EventUpgradeCompleted, version,
+		fmt.Sprintf("cluster %s has been upgraded from %s to %s", k.Name, k.K8SVersion, version))
+}
+
+// update changes the latest version of the kube object.
+func (u *AutoUpgrader) update(ctx context.Context, kubeID string, change func(*model.Kube)) error {
+	k, err := u.svc.Get(ctx, kubeID)
+	if err != nil {
+		return err
+	}
+	change(k)
+	return u.svc.Create(ctx, k)
+}
+
+func (u *AutoUpgrader) publish(ctx context.Context, k *model.Kube, eventType, version, msg string) {
+	err := u.publisher.Publish(ctx, notification.Event{
+		Type:     eventType,
+		KubeID:   k.ID,
+		KubeName: k.Name,
+		Message:  msg,
+		Details: map[string]string{
+			"from": k.K8SVersion,
+			"to":   version,
+		},
+		CreatedAt: u.nowFn(),
+	})
+	if err != nil {
+		logrus.Errorf("auto upgrade: cluster %s: publish %s: %v", k.ID, eventType, err)
+	}
+}
@@ -0,0 +1,210 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/notification"
+	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/versions"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type failingStep struct {
+	fakeStep
+}
+
+func (failingStep) Run(context.Context, io.Writer, *steps.Config) error { return errFake }
+
+func TestHandler_setAutoUpgrade(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         `{`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "start hour",
+			body:         `{"enabled":true,"window":{"startHour":24,"hours":4}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "empty window",
+			body:         `{"enabled":true,"window":{"startHour":2}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "day",
+			body:         `{"enabled":true,"window":{"days":[7],"startHour":2,"hours":4}}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "resume",
+			body:         `{"enabled":true,"window":{"days":[6],"startHour":2,"hours":4}}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{
+			ID: "kube",
+			AutoUpgrade: model.AutoUpgrade{
+				Paused:      true,
+				PauseReason: "upgrade to 1.15.3 has failed",
+			},
+		}, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kubes/kube/autoupgrade", bytes.NewBufferString(tc.body)))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		k := &model.Kube{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(k), "TC: %s", tc.name)
+		require.Equal(t, model.AutoUpgrade{
+			Enabled: true,
+			Window: model.MaintenanceWindow{
+				Days:      []time.Weekday{time.Saturday},
+				StartHour: 2,
+				Hours:     4,
+			},
+		}, k.AutoUpgrade, "TC: %s", tc.name)
+	}
+}
+
+func TestAutoUpgrader_upgradeAll(t *testing.T) {
+	// saturday
+	now := time.Date(2019, time.October, 5, 3, 0, 0, 0, time.UTC)
+	catalog := versions.Catalog{
+		Versions: []versions.Version{
+			{Version: "1.15.3"},
+		},
+	}
+	newKube := func(autoUpgrade model.AutoUpgrade) *model.Kube {
+		return &model.Kube{
+			ID:          "kube",
+			TenantID:    "acme",
+			Name:        "prod",
+			State:       model.StateOperational,
+			K8SVersion:  "1.15.1",
+			AutoUpgrade: autoUpgrade,
+			Masters: map[string]*model.Machine{
+				"master-1": {Name: "master-1", Role: model.RoleMaster, State: model.MachineStateActive},
+			},
+			Nodes: map[string]*model.Machine{
+				"node-1": {Name: "node-1", Role: model.RoleNode, State: model.MachineStateActive},
+			},
+		}
+	}
+	window := model.MaintenanceWindow{Days: []time.Weekday{time.Saturday}, StartHour: 2, Hours: 4}
+
+	for _, tc := range []struct {
+		name     string
+		kube     *model.Kube
+		nodeStep steps.Step
+
+		expectedVersion string
+		expectedTasks   int
+		expectedPaused  bool
+		expectedEvents  []string
+	}{
+		{
+			name:            "not opted in",
+			kube:            newKube(model.AutoUpgrade{Window: window}),
+			expectedVersion: "1.15.1",
+		},
+		{
+			name:            "paused",
+			kube:            newKube(model.AutoUpgrade{Enabled: true, Window: window, Paused: true}),
+			expectedVersion: "1.15.1",
+			expectedPaused:  true,
+		},
+		{
+			name: "out of the window",
+			kube: newKube(model.AutoUpgrade{Enabled: true, Window: model.MaintenanceWindow{
+				Days: []time.Weekday{time.Sunday}, StartHour: 2, Hours: 4,
+			}}),
+			expectedVersion: "1.15.1",
+		},
+		{
+			name:            "upgraded",
+			kube:            newKube(model.AutoUpgrade{Enabled: true, Window: window}),
+			expectedVersion: "1.15.3",
+			expectedTasks:   2,
+			expectedEvents:  []string{notification.EventUpgradeCompleted},
+		},
+		{
+			name:            "failed node",
+			kube:            newKube(model.AutoUpgrade{Enabled: true, Window: window}),
+			nodeStep:        failingStep{},
+			expectedVersion: "1.15.1",
+			expectedTasks:   2,
+			expectedPaused:  true,
+			expectedEvents:  []string{notification.EventUpgradeFailed},
+		},
+	} {
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.UpgradeMaster, []steps.Step{fakeStep{}})
+		nodeStep := tc.nodeStep
+		if nodeStep == nil {
+			nodeStep = fakeStep{}
+		}
+		workflows.RegisterWorkFlow(workflows.UpgradeNode, []steps.Step{nodeStep})
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{*tc.kube}, nil)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(&model.CloudAccount{Provider: clouds.DigitalOcean}, nil)
+
+		mockRepo := new(testutils.MockStorage)
+		mockRepo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+
+		publisher := &fakePublisher{}
+		u := NewAutoUpgrader(svc, accService, mockRepo, fakeCatalog{catalog: catalog}, publisher, time.Minute)
+		u.nowFn = func() time.Time {
+			return now
+		}
+		u.getWriter = func(string) (io.WriteCloser, error) {
+			return &bufferCloser{}, nil
+		}
+
+		u.upgradeAll(context.Background())
+
+		require.Equal(t, tc.expectedVersion, tc.kube.K8SVersion, "TC: %s", tc.name)
+		require.Len(t, tc.kube.Tasks[workflows.UpgradeTask], tc.expectedTasks, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedPaused, tc.kube.AutoUpgrade.Paused, "TC: %s", tc.name)
+		require.Len(t, publisher.events, len(tc.expectedEvents), "TC: %s", tc.name)
+		for i, e := range tc.expectedEvents {
+			require.Equal(t, e, publisher.events[i].Type, "TC: %s", tc.name)
+			require.Equal(t, "acme", publisher.tenants[i], "TC: %s", tc.name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	BackstageAPIVersion = "backstage.io/v1alpha1"
+	BackstageResource   = "Resource"
+	BackstageComponent  = "Component"
+
+	// annotations of catalog entities, backstage plugins may look clusters up with them
+	AnnotationKubeID     = "supergiant.io/kube-id"
+	AnnotationProvider   = "supergiant.io/provider"
+	AnnotationRegion     = "supergiant.io/region"
+	AnnotationK8SVersion = "supergiant.io/kubernetes-version"
+	AnnotationOwner      = "supergiant.io/owner"
+	AnnotationState      = "supergiant.io/state"
+
+	backstageClusterType      = "kubernetes-cluster"
+	backstageDefaultOwner     = "supergiant"
+	backstageDefaultLifecycle = "production"
+	backstageMaxName          = 63
+)
+
+var backstageInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// BackstageEntity is a catalog entity of a cluster, see
+// https://backstage.io/docs/features/software-catalog/descriptor-format
+type BackstageEntity struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   BackstageMetadata `json:"metadata"`
+	Spec       BackstageSpec     `json:"spec"`
+}
+
+type BackstageMetadata struct {
+	Name        string            `json:"name"`
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Annotations map[string]string `json:"annotations"`
+	Links       []BackstageLink   `json:"links,omitempty"`
+}
+
+type BackstageLink struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+type BackstageSpec struct {
+	Type  string `json:"type"`
+	Owner string `json:"owner"`
+	// Lifecycle is required for components only.
+	Lifecycle string `json:"lifecycle,omitempty"`
+	System    string `json:"system,omitempty"`
+}
+
+// BackstageOptions are set by platform teams in the location url, Owner
+// is used for clusters that have none.
+type BackstageOptions struct {
+	Kind   string
+	Owner  string
+	System string
+}
+
+// backstageName turns the cluster name into a valid entity name.
+func backstageName(name string) string {
+	name = strings.Trim(backstageInvalidChars.ReplaceAllString(name, "-"), "-_.")
+	if len(name) > backstageMaxName {
+		name = strings.TrimRight(name[:backstageMaxName], "-_.")
+	}
+	return name
+}
+
+func backstageEntity(k *model.Kube, opts BackstageOptions) BackstageEntity {
+	owner := k.Metadata.Owner
+	if owner == "" {
+		owner = opts.Owner
+	}
+	description := k.Metadata.Description
+	if description == "" {
+		description = fmt.Sprintf("Kubernetes %s cluster on %s in %s", k.K8SVersion, k.Provider, k.Region)
+	}
+
+	e := BackstageEntity{
+		APIVersion: BackstageAPIVersion,
+		Kind:       opts.Kind,
+		Metadata: BackstageMetadata{
+			Name:        backstageName(k.Name),
+			Title:       k.Title(),
+			Description: description,
+			Annotations: map[string]string{
+				AnnotationKubeID:     k.ID,
+				AnnotationProvider:   string(k.Provider),
+				AnnotationRegion:     k.Region,
+				AnnotationK8SVersion: k.K8SVersion,
+				AnnotationOwner:      owner,
+				AnnotationState:      string(k.State),
+			},
+		},
+		Spec: BackstageSpec{
+			Type:   backstageClusterType,
+			Owner:  owner,
+			System: opts.System,
+		},
+	}
+	if opts.Kind == BackstageComponent {
+		e.Spec.Lifecycle = backstageDefaultLifecycle
+	}
+	for _, l := range k.Metadata.Links {
+		e.Metadata.Links = append(e.Metadata.Links, BackstageLink{URL: l.URL, Title: l.Title})
+	}
+	return e
+}
+
+// backstageCatalog returns an entity of every cluster that isn't being
+// deleted, names that collide after cleaning get the cluster id appended.
+func (h *Handler) backstageCatalog(ctx context.Context, opts BackstageOptions) ([]BackstageEntity, error) {
+	kubes, err := h.svc.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+	sort.Slice(kubes, func(i, j int) bool {
+		return kubes[i].Name < kubes[j].Name
+	})
+
+	entities := make([]BackstageEntity, 0, len(kubes))
+	names := make(map[string]bool, len(kubes))
+	for i := range kubes {
+		k := &kubes[i]
+		if k.State == model.StateDeleting {
+			continue
+		}
+
+		e := backstageEntity(k, opts)
+		if e.Metadata.Name == "" || names[e.Metadata.Name] {
+			base := e.Metadata.Name
+			if max := backstageMaxName - len(k.ID) - 1; len(base) > max {
+				base = base[:max]
+			}
+			e.Metadata.Name = backstageName(base + "-" + k.ID)
+		}
+		names[e.Metadata.Name] = true
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
+
+// getBackstageCatalog returns clusters as a multi document yaml for a
+// backstage url location, backstage refreshes locations on its own:
+// GET /kubes/catalog?kind=Resource&owner=group:platform&system=infrastructure&token=<token>
+func (h *Handler) getBackstageCatalog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := BackstageOptions{
+		Kind:   q.Get("kind"),
+		Owner:  q.Get("owner"),
+		System: q.Get("system"),
+	}
+	if opts.Kind == "" {
+		opts.Kind = BackstageResource
+	}
+	if opts.Kind != BackstageResource && opts.Kind != BackstageComponent {
+		message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "kind %q must be %s or %s",
+			opts.Kind, BackstageResource, BackstageComponent))
+		return
+	}
+	if opts.Owner == "" {
+		opts.Owner = backstageDefaultOwner
+	}
+
+	entities, err := h.backstageCatalog(r.Context(), opts)
+	if err != nil {
+		logrus.Errorf("kube: backstage catalog: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	for _, e := range entities {
+		raw, err := yaml.Marshal(e)
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+		buf.WriteString("---\n")
+		buf.Write(raw)
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logrus.Errorf("kube: backstage catalog: write response: %v", err)
+	}
+}
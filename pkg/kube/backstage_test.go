@@ -0,0 +1,161 @@
+package kube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+)
+
+func TestBackstageName(t *testing.T) {
+	for in, expected := range map[string]string{
+		"prod":                         "prod",
+		"Prod Cluster (eu)":            "Prod-Cluster-eu",
+		"--edge--":                     "edge",
+		strings.Repeat("a", 70):        strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + "-b": strings.Repeat("a", 62),
+	} {
+		require.Equal(t, expected, backstageName(in), in)
+	}
+}
+
+func TestHandler_getBackstageCatalog(t *testing.T) {
+	kubes := []model.Kube{
+		{
+			ID:          "1234",
+			Name:        "prod",
+			DisplayName: "Production",
+			Provider:    clouds.AWS,
+			Region:      "us-west-2",
+			K8SVersion:  "1.15.3",
+			State:       model.StateOperational,
+			Metadata: model.KubeMetadata{
+				Owner: "group:analytics",
+				Links: []model.KubeLink{{Title: "Runbook", URL: "https://wiki.example.com/prod"}},
+			},
+		},
+		{
+			ID:         "5678",
+			Name:       "prod",
+			Provider:   clouds.GCE,
+			Region:     "europe-west1",
+			K8SVersion: "1.14.1",
+			State:      model.StateProvisioning,
+		},
+		{
+			ID:    "9012",
+			Name:  "old",
+			State: model.StateDeleting,
+		},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		err   error
+
+		expectedCode     int
+		expectedEntities []BackstageEntity
+	}{
+		{
+			name:         "kind",
+			query:        "kind=System",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "list error",
+			err:          errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "components",
+			query:        "kind=Component&owner=group:platform&system=infrastructure",
+			expectedCode: http.StatusOK,
+			expectedEntities: []BackstageEntity{
+				{
+					APIVersion: BackstageAPIVersion,
+					Kind:       BackstageComponent,
+					Metadata: BackstageMetadata{
+						Name:        "prod",
+						Title:       "Production",
+						Description: "Kubernetes 1.15.3 cluster on aws in us-west-2",
+						Annotations: map[string]string{
+							AnnotationKubeID:     "1234",
+							AnnotationProvider:   "aws",
+							AnnotationRegion:     "us-west-2",
+							AnnotationK8SVersion: "1.15.3",
+							AnnotationOwner:      "group:analytics",
+							AnnotationState:      "operational",
+						},
+						Links: []BackstageLink{{Title: "Runbook", URL: "https://wiki.example.com/prod"}},
+					},
+					Spec: BackstageSpec{
+						Type:      backstageClusterType,
+						Owner:     "group:analytics",
+						Lifecycle: backstageDefaultLifecycle,
+						System:    "infrastructure",
+					},
+				},
+				{
+					APIVersion: BackstageAPIVersion,
+					Kind:       BackstageComponent,
+					Metadata: BackstageMetadata{
+						Name:        "prod-5678",
+						Title:       "prod",
+						Description: "Kubernetes 1.14.1 cluster on gce in europe-west1",
+						Annotations: map[string]string{
+							AnnotationKubeID:     "5678",
+							AnnotationProvider:   "gce",
+							AnnotationRegion:     "europe-west1",
+							AnnotationK8SVersion: "1.14.1",
+							AnnotationOwner:      "group:platform",
+							AnnotationState:      "provisioning",
+						},
+					},
+					Spec: BackstageSpec{
+						Type:      backstageClusterType,
+						Owner:     "group:platform",
+						Lifecycle: backstageDefaultLifecycle,
+						System:    "infrastructure",
+					},
+				},
+			},
+		},
+	} {
+		list := make([]model.Kube, len(kubes))
+		copy(list, kubes)
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceListAll, mock.Anything).Return(list, tc.err)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/catalog?"+tc.query, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		require.Equal(t, "application/x-yaml", rec.Header().Get("Content-Type"), "TC: %s", tc.name)
+
+		docs := strings.Split(strings.TrimPrefix(rec.Body.String(), "---\n"), "---\n")
+		entities := make([]BackstageEntity, 0, len(docs))
+		for _, doc := range docs {
+			e := BackstageEntity{}
+			require.NoError(t, yaml.Unmarshal([]byte(doc), &e), "TC: %s", tc.name)
+			entities = append(entities, e)
+		}
+		require.Equal(t, tc.expectedEntities, entities, "TC: %s", tc.name)
+	}
+}
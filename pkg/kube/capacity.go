@@ -0,0 +1,259 @@
+package kube
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps/kubelet"
+)
+
+// DefaultUtilizationThreshold is a percentage of allocatable resources
+// requested by pods that marks a cluster as running out of capacity.
+const DefaultUtilizationThreshold = 80
+
+// ResourceCapacity shows how much of allocatable resource is requested by pods.
+// CPU values are in millicores, memory values are in bytes.
+type ResourceCapacity struct {
+	Allocatable int64   `json:"allocatable"`
+	Requested   int64   `json:"requested"`
+	Utilization float64 `json:"utilization"`
+}
+
+// Capacity aggregates cpu and memory capacity.
+type Capacity struct {
+	CPU    ResourceCapacity `json:"cpu"`
+	Memory ResourceCapacity `json:"memory"`
+}
+
+// NodeCapacity is a capacity of a single node.
+type NodeCapacity struct {
+	Name string `json:"name"`
+	Pool string `json:"pool"`
+	Capacity
+}
+
+// PoolCapacity is a capacity of nodes with the same role and size.
+type PoolCapacity struct {
+	Name  string `json:"name"`
+	Nodes int    `json:"nodes"`
+	Capacity
+}
+
+// CapacityReport represents allocatable vs requested resources of a cluster.
+type CapacityReport struct {
+	KubeID   string `json:"kubeId"`
+	KubeName string `json:"kubeName"`
+	Capacity
+
+	Pools []PoolCapacity `json:"pools"`
+	Nodes []NodeCapacity `json:"nodes"`
+
+	Threshold     float64 `json:"threshold"`
+	OverThreshold bool    `json:"overThreshold"`
+}
+
+// Capacity builds a capacity report of the cluster from its node and pod specs.
+func (s Service) Capacity(ctx context.Context, kubeID string, threshold float64) (*CapacityReport, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeList, err := kclient.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list nodes")
+	}
+
+	podList, err := kclient.Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods")
+	}
+
+	return buildCapacityReport(k, nodeList.Items, podList.Items, threshold), nil
+}
+
+func buildCapacityReport(k *model.Kube, nodes []corev1.Node, pods []corev1.Pod, threshold float64) *CapacityReport {
+	if threshold <= 0 {
+		threshold = DefaultUtilizationThreshold
+	}
+
+	requested := make(map[string]corev1.ResourceList, len(nodes))
+	for _, pod := range pods {
+		// terminated and pending pods do not hold node resources
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded ||
+			pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		if requested[pod.Spec.NodeName] == nil {
+			requested[pod.Spec.NodeName] = corev1.ResourceList{}
+		}
+		addResources(requested[pod.Spec.NodeName], podRequests(pod))
+	}
+
+	report := &CapacityReport{
+		KubeID:    k.ID,
+		KubeName:  k.Name,
+		Threshold: threshold,
+		Pools:     make([]PoolCapacity, 0),
+		Nodes:     make([]NodeCapacity, 0, len(nodes)),
+	}
+	pools := make(map[string]*PoolCapacity)
+
+	for _, node := range nodes {
+		nodeCapacity := NodeCapacity{
+			Name: node.Name,
+			Pool: nodePool(k, node),
+			Capacity: Capacity{
+				CPU: ResourceCapacity{
+					Allocatable: node.Status.Allocatable.Cpu().MilliValue(),
+					Requested:   requestedValue(requested[node.Name], corev1.ResourceCPU),
+				},
+				Memory: ResourceCapacity{
+					Allocatable: node.Status.Allocatable.Memory().Value(),
+					Requested:   requestedValue(requested[node.Name], corev1.ResourceMemory),
+				},
+			},
+		}
+		nodeCapacity.calcUtilization()
+		report.Nodes = append(report.Nodes, nodeCapacity)
+
+		pool := pools[nodeCapacity.Pool]
+		if pool == nil {
+			pool = &PoolCapacity{Name: nodeCapacity.Pool}
+			pools[nodeCapacity.Pool] = pool
+		}
+		pool.Nodes++
+		pool.add(nodeCapacity.Capacity)
+		report.add(nodeCapacity.Capacity)
+	}
+
+	for _, pool := range pools {
+		pool.calcUtilization()
+		report.Pools = append(report.Pools, *pool)
+	}
+	sort.Slice(report.Pools, func(i, j int) bool {
+		return report.Pools[i].Name < report.Pools[j].Name
+	})
+
+	report.calcUtilization()
+	report.OverThreshold = report.CPU.Utilization >= threshold ||
+		report.Memory.Utilization >= threshold
+
+	return report
+}
+
+func (c *Capacity) add(in Capacity) {
+	c.CPU.Allocatable += in.CPU.Allocatable
+	c.CPU.Requested += in.CPU.Requested
+	c.Memory.Allocatable += in.Memory.Allocatable
+	c.Memory.Requested += in.Memory.Requested
+}
+
+func (c *Capacity) calcUtilization() {
+	c.CPU.Utilization = utilization(c.CPU)
+	c.Memory.Utilization = utilization(c.Memory)
+}
+
+func utilization(r ResourceCapacity) float64 {
+	if r.Allocatable == 0 {
+		return 0
+	}
+	return float64(r.Requested) * 100 / float64(r.Allocatable)
+}
+
+// podRequests follows the scheduler rules: pod requests are the max of
+// sum of its containers requests and any of init containers requests.
+func podRequests(pod corev1.Pod) corev1.ResourceList {
+	reqs := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		addResources(reqs, c.Resources.Requests)
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if cur, ok := reqs[name]; !ok || q.Cmp(cur) > 0 {
+				reqs[name] = q.DeepCopy()
+			}
+		}
+	}
+
+	return reqs
+}
+
+func addResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		cur := dst[name]
+		cur.Add(q)
+		dst[name] = cur
+	}
+}
+
+func requestedValue(reqs corev1.ResourceList, name corev1.ResourceName) int64 {
+	q, ok := reqs[name]
+	if !ok {
+		return 0
+	}
+
+	if name == corev1.ResourceCPU {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
+
+// nodePool groups nodes by role and machine size, nodes that are not managed
+// by supergiant are grouped by the role label.
+func nodePool(k *model.Kube, node corev1.Node) string {
+	if m := findMachine(k, node); m != nil && m.Size != "" {
+		return machinePool(m)
+	}
+
+	if role := node.Labels[kubelet.LabelNodeRole]; role != "" {
+		return role
+	}
+
+	return "unknown"
+}
+
+// machinePool is a pool of the machine provisioned by supergiant.
+func machinePool(m *model.Machine) string {
+	return string(m.Role) + "/" + m.Size
+}
+
+func findMachine(k *model.Kube, node corev1.Node) *model.Machine {
+	for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for _, m := range machines {
+			if m == nil {
+				continue
+			}
+
+			if strings.EqualFold(m.Name, node.Name) {
+				return m
+			}
+
+			for _, addr := range node.Status.Addresses {
+				if addr.Type == corev1.NodeInternalIP && addr.Address == m.PrivateIp {
+					return m
+				}
+			}
+		}
+	}
+
+	return nil
+}
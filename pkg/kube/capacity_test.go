@@ -0,0 +1,262 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+)
+
+func capacityNode(name, cpu, mem string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"kubernetes.io/role": "node",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(mem),
+			},
+		},
+	}
+}
+
+func capacityPod(node string, phase corev1.PodPhase, cpu, mem string) corev1.Pod {
+	return corev1.Pod{
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse(cpu),
+							corev1.ResourceMemory: resource.MustParse(mem),
+						},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func TestBuildCapacityReport(t *testing.T) {
+	k := &model.Kube{
+		ID: "kube",
+		Nodes: map[string]*model.Machine{
+			"node-1": {
+				Name: "node-1",
+				Role: model.RoleNode,
+				Size: "m4.large",
+			},
+		},
+	}
+	nodes := []corev1.Node{
+		capacityNode("node-1", "2", "4Gi"),
+		capacityNode("node-2", "2", "4Gi"),
+	}
+	initPod := capacityPod("node-2", corev1.PodRunning, "100m", "128Mi")
+	initPod.Spec.InitContainers = []corev1.Container{
+		{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("1"),
+				},
+			},
+		},
+	}
+	pods := []corev1.Pod{
+		capacityPod("node-1", corev1.PodRunning, "1", "1Gi"),
+		capacityPod("node-1", corev1.PodRunning, "500m", "1Gi"),
+		capacityPod("node-1", corev1.PodSucceeded, "2", "2Gi"),
+		capacityPod("", corev1.PodPending, "2", "2Gi"),
+		initPod,
+	}
+
+	report := buildCapacityReport(k, nodes, pods, 0)
+
+	require.Equal(t, float64(DefaultUtilizationThreshold), report.Threshold)
+	require.Len(t, report.Nodes, 2)
+	require.Equal(t, int64(1500), report.Nodes[0].CPU.Requested)
+	require.Equal(t, float64(75), report.Nodes[0].CPU.Utilization)
+	require.Equal(t, "node/m4.large", report.Nodes[0].Pool)
+	// init container request is greater than containers sum
+	require.Equal(t, int64(1000), report.Nodes[1].CPU.Requested)
+	require.Equal(t, "node", report.Nodes[1].Pool)
+
+	require.Len(t, report.Pools, 2)
+	require.Equal(t, int64(4000), report.CPU.Allocatable)
+	require.Equal(t, int64(2500), report.CPU.Requested)
+	require.False(t, report.OverThreshold)
+
+	report = buildCapacityReport(k, nodes, pods, 60)
+	require.True(t, report.OverThreshold)
+}
+
+func TestService_Capacity(t *testing.T) {
+	kubeData, _ := json.Marshal(&model.Kube{ID: "kube"})
+
+	for _, tc := range []struct {
+		name           string
+		getErr         error
+		corev1ClientFn func(k *model.Kube) (corev1client.CoreV1Interface, error)
+		expectedErr    error
+	}{
+		{
+			name:        "invalid corev1 client builder",
+			expectedErr: sgerrors.ErrNilEntity,
+		},
+		{
+			name:   "get kube error",
+			getErr: errFake,
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				return nil, nil
+			},
+			expectedErr: errFake,
+		},
+		{
+			name: "list pods error",
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				cl := &fakev1client.FakeCoreV1{
+					Fake: &kubetesting.Fake{},
+				}
+				cl.AddReactor("list", "pods",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						return true, nil, errFake
+					})
+				return cl, nil
+			},
+			expectedErr: errFake,
+		},
+		{
+			name: "success",
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				cl := &fakev1client.FakeCoreV1{
+					Fake: &kubetesting.Fake{},
+				}
+				cl.AddReactor("list", "nodes",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						return true, &corev1.NodeList{
+							Items: []corev1.Node{capacityNode("node", "1", "1Gi")},
+						}, nil
+					})
+				cl.AddReactor("list", "pods",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						return true, &corev1.PodList{
+							Items: []corev1.Pod{capacityPod("node", corev1.PodRunning, "900m", "1Mi")},
+						}, nil
+					})
+				return cl, nil
+			},
+		},
+	} {
+		repo := new(testutils.MockStorage)
+		repo.On("Get", mock.Anything, mock.Anything, mock.Anything).
+			Return(kubeData, tc.getErr)
+
+		svc := Service{
+			storage:        repo,
+			corev1ClientFn: tc.corev1ClientFn,
+		}
+
+		report, err := svc.Capacity(context.Background(), "kube", 80)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err == nil {
+			require.True(t, report.OverThreshold, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_getCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		query        string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "invalid threshold",
+			query:        "?threshold=abc",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			query:        "?threshold=90",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceCapacity, mock.Anything, "kube", mock.Anything).
+			Return(&CapacityReport{KubeID: "kube"}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/capacity"+tc.query, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_listCapacity(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAll, mock.Anything).Return([]model.Kube{
+		{ID: "a", State: model.StateOperational},
+		{ID: "b", State: model.StateOperational},
+		{ID: "c", State: model.StateProvisioning},
+	}, nil)
+	svc.On(serviceCapacity, mock.Anything, "a", mock.Anything).
+		Return(&CapacityReport{KubeID: "a"}, nil)
+	svc.On(serviceCapacity, mock.Anything, "b", mock.Anything).
+		Return(&CapacityReport{KubeID: "b", OverThreshold: true}, nil)
+
+	h := Handler{svc: svc}
+	router := mux.NewRouter()
+	h.Register(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/kubes/capacity", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	reports := make([]*CapacityReport, 0)
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&reports))
+	require.Len(t, reports, 2)
+	require.Equal(t, "b", reports[0].KubeID)
+}
@@ -0,0 +1,209 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+// Compliance violations:
+const (
+	ViolationMetadataTokens     = "metadataTokensOptional"
+	ViolationUnencryptedVolumes = "unencryptedVolumes"
+	ViolationInstanceProfile    = "unrestrictedInstanceProfile"
+)
+
+// InstanceCompliance describes security settings an instance of the cluster has.
+type InstanceCompliance struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role,omitempty"`
+	// MetadataTokens is required when IMDSv2 is enforced
+	MetadataTokens     string   `json:"metadataTokens"`
+	InstanceProfile    string   `json:"instanceProfile,omitempty"`
+	UnencryptedVolumes []string `json:"unencryptedVolumes"`
+	// Violations are settings of the cluster the instance doesn't follow.
+	Violations []string `json:"violations"`
+}
+
+// ComplianceReport checks instances of the cluster against its hardening settings.
+type ComplianceReport struct {
+	KubeID    string                    `json:"kubeId"`
+	CreatedAt time.Time                 `json:"createdAt"`
+	Hardening profile.HardeningSettings `json:"hardening"`
+	Instances []InstanceCompliance      `json:"instances"`
+	Compliant bool                      `json:"compliant"`
+}
+
+type complianceChecker interface {
+	ClusterCompliance(ctx context.Context, k *model.Kube) ([]InstanceCompliance, error)
+}
+
+type clusterComplianceFn func(ctx context.Context, config *steps.Config, clusterID string) ([]InstanceCompliance, error)
+
+// ClusterCompliance returns security settings of running instances of the cluster,
+// sgerrors.ErrUnsupportedProvider is returned for clouds that can't be queried.
+func (c *CloudInstances) ClusterCompliance(ctx context.Context, k *model.Kube) ([]InstanceCompliance, error) {
+	var check clusterComplianceFn
+	if k.Provider == clouds.AWS {
+		check = c.awsCompliance
+	}
+	if check == nil || k.ExternallyManaged {
+		return nil, sgerrors.ErrUnsupportedProvider
+	}
+
+	config, err := c.config(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := check(ctx, config, k.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check %s instances", k.Provider)
+	}
+
+	return instances, nil
+}
+
+// BuildComplianceReport lists violations of settings the cluster is hardened with,
+// machines created before the settings were enabled are reported as well.
+func BuildComplianceReport(k *model.Kube, instances []InstanceCompliance) *ComplianceReport {
+	report := &ComplianceReport{
+		KubeID:    k.ID,
+		CreatedAt: time.Now(),
+		Hardening: k.Hardening,
+		Instances: make([]InstanceCompliance, 0, len(instances)),
+		Compliant: true,
+	}
+
+	for _, inst := range instances {
+		inst.Violations = make([]string, 0)
+		if k.Hardening.MetadataTokensRequired && inst.MetadataTokens != awssdk.MetadataTokensRequired {
+			inst.Violations = append(inst.Violations, ViolationMetadataTokens)
+		}
+		if k.Hardening.EncryptVolumes && len(inst.UnencryptedVolumes) > 0 {
+			inst.Violations = append(inst.Violations, ViolationUnencryptedVolumes)
+		}
+		if k.Hardening.RestrictedInstanceProfiles && inst.Role != string(model.RoleMaster) &&
+			inst.InstanceProfile != amazon.RestrictedNodeInstanceProfile {
+			inst.Violations = append(inst.Violations, ViolationInstanceProfile)
+		}
+
+		if len(inst.Violations) > 0 {
+			report.Compliant = false
+		}
+		report.Instances = append(report.Instances, inst)
+	}
+
+	return report
+}
+
+func awsClusterCompliance(ctx context.Context, config *steps.Config, clusterID string) ([]InstanceCompliance, error) {
+	metadata, err := amazon.GetInstanceMetadata(config.AWSConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "get instance metadata client")
+	}
+
+	found, err := metadata.DescribeSecurity(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String(fmt.Sprintf("tag:%s", clouds.ClusterIDTag)),
+				Values: aws.StringSlice([]string{clusterID}),
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{
+					ec2.InstanceStateNamePending,
+					ec2.InstanceStateNameRunning,
+				}),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	volumeIDs := make([]string, 0)
+	for _, i := range found {
+		volumeIDs = append(volumeIDs, i.VolumeIDs...)
+	}
+
+	encrypted := make(map[string]bool, len(volumeIDs))
+	if len(volumeIDs) > 0 {
+		client, err := amazon.GetEC2(config.AWSConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "get ec2 client")
+		}
+
+		err = client.DescribeVolumesPagesWithContext(ctx, &ec2.DescribeVolumesInput{
+			VolumeIds: aws.StringSlice(volumeIDs),
+		}, func(out *ec2.DescribeVolumesOutput, _ bool) bool {
+			for _, v := range out.Volumes {
+				encrypted[aws.StringValue(v.VolumeId)] = aws.BoolValue(v.Encrypted)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "describe volumes")
+		}
+	}
+
+	instances := make([]InstanceCompliance, 0, len(found))
+	for _, i := range found {
+		inst := InstanceCompliance{
+			ID:                 i.ID,
+			Name:               i.Tags["Name"],
+			Role:               i.Tags["Role"],
+			MetadataTokens:     i.Metadata.HTTPTokens,
+			InstanceProfile:    i.InstanceProfileARN[strings.LastIndex(i.InstanceProfileARN, "/")+1:],
+			UnencryptedVolumes: make([]string, 0),
+		}
+		for _, id := range i.VolumeIDs {
+			if !encrypted[id] {
+				inst.UnencryptedVolumes = append(inst.UnencryptedVolumes, id)
+			}
+		}
+		instances = append(instances, inst)
+	}
+
+	return instances, nil
+}
+
+// getCompliance checks instances of the cluster against its hardening settings.
+func (h *Handler) getCompliance(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	instances, err := h.compliance.ClusterCompliance(r.Context(), k)
+	if err != nil {
+		if sgerrors.IsUnsupportedProvider(err) {
+			message.SendMessage(w, message.New("compliance can't be checked for "+string(k.Provider)+" clusters",
+				err.Error(), sgerrors.UnsupportedProvider, ""), http.StatusBadRequest)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(BuildComplianceReport(k, instances)); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
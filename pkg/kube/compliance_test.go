@@ -0,0 +1,228 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+type fakeCompliance struct {
+	instances []InstanceCompliance
+	err       error
+}
+
+func (f *fakeCompliance) ClusterCompliance(ctx context.Context, k *model.Kube) ([]InstanceCompliance, error) {
+	return f.instances, f.err
+}
+
+func TestBuildComplianceReport(t *testing.T) {
+	instances := []InstanceCompliance{
+		{
+			ID:                 "i-1",
+			Role:               "master",
+			MetadataTokens:     "required",
+			InstanceProfile:    "kubernetes-master",
+			UnencryptedVolumes: []string{},
+		},
+		{
+			ID:                 "i-2",
+			Role:               "node",
+			MetadataTokens:     "optional",
+			InstanceProfile:    "kubernetes-node",
+			UnencryptedVolumes: []string{"vol-1"},
+		},
+		{
+			ID:                 "i-3",
+			Role:               "node",
+			MetadataTokens:     "required",
+			InstanceProfile:    amazon.RestrictedNodeInstanceProfile,
+			UnencryptedVolumes: []string{},
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		hardening profile.HardeningSettings
+
+		expectedViolations [][]string
+		expectedCompliant  bool
+	}{
+		{
+			name:               "not hardened",
+			expectedViolations: [][]string{{}, {}, {}},
+			expectedCompliant:  true,
+		},
+		{
+			name: "hardened",
+			hardening: profile.HardeningSettings{
+				MetadataTokensRequired:     true,
+				EncryptVolumes:             true,
+				RestrictedInstanceProfiles: true,
+			},
+			expectedViolations: [][]string{
+				{},
+				{ViolationMetadataTokens, ViolationUnencryptedVolumes, ViolationInstanceProfile},
+				{},
+			},
+		},
+	} {
+		k := &model.Kube{ID: "kube", Hardening: tc.hardening}
+		report := BuildComplianceReport(k, instances)
+
+		require.Equal(t, "kube", report.KubeID, "TC: %s", tc.name)
+		require.Equal(t, tc.hardening, report.Hardening, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedCompliant, report.Compliant, "TC: %s", tc.name)
+		require.Len(t, report.Instances, len(instances), "TC: %s", tc.name)
+		for i, inst := range report.Instances {
+			require.Equal(t, tc.expectedViolations[i], inst.Violations, "TC: %s %s", tc.name, inst.ID)
+		}
+	}
+}
+
+func TestCloudInstances_ClusterCompliance(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		provider          clouds.Name
+		externallyManaged bool
+		checkErr          error
+
+		expectedErr error
+		expectedLen int
+	}{
+		{
+			name:        "unsupported provider",
+			provider:    clouds.GCE,
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:              "externally managed",
+			provider:          clouds.AWS,
+			externallyManaged: true,
+			expectedErr:       sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "check error",
+			provider:    clouds.AWS,
+			checkErr:    errFake,
+			expectedErr: errFake,
+		},
+		{
+			name:        "aws",
+			provider:    clouds.AWS,
+			expectedLen: 1,
+		},
+	} {
+		accounts := new(accServiceMock)
+		accounts.On("Get", mock.Anything, "aws").Return(&model.CloudAccount{
+			Name:     "aws",
+			Provider: clouds.AWS,
+			Credentials: map[string]string{
+				"access_key": "key",
+				"secret_key": "secret",
+			},
+		}, nil)
+
+		c := NewCloudInstances(accounts)
+		c.awsCompliance = func(ctx context.Context, config *steps.Config, clusterID string) ([]InstanceCompliance, error) {
+			require.Equal(t, "kube", clusterID, "TC: %s", tc.name)
+			require.Equal(t, "us-west-1", config.AWSConfig.Region, "TC: %s", tc.name)
+			return []InstanceCompliance{{ID: "i-1"}}, tc.checkErr
+		}
+
+		instances, err := c.ClusterCompliance(context.Background(), &model.Kube{
+			ID:                "kube",
+			Provider:          tc.provider,
+			AccountName:       "aws",
+			Region:            "us-west-1",
+			ExternallyManaged: tc.externallyManaged,
+		})
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		require.Len(t, instances, tc.expectedLen, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getCompliance(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		kubeErr error
+		checker *fakeCompliance
+
+		expectedCode      int
+		expectedCompliant bool
+	}{
+		{
+			name:         "not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			checker:      &fakeCompliance{},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unsupported provider",
+			checker:      &fakeCompliance{err: sgerrors.ErrUnsupportedProvider},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "check error",
+			checker:      &fakeCompliance{err: errFake},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name: "violations",
+			checker: &fakeCompliance{instances: []InstanceCompliance{
+				{ID: "i-1", Role: "node", MetadataTokens: "optional"},
+			}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "compliant",
+			checker: &fakeCompliance{instances: []InstanceCompliance{
+				{ID: "i-1", Role: "node", MetadataTokens: "required"},
+			}},
+			expectedCode:      http.StatusOK,
+			expectedCompliant: true,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{
+			ID:       "kube",
+			Provider: clouds.AWS,
+			Hardening: profile.HardeningSettings{
+				MetadataTokensRequired: true,
+			},
+		}, tc.kubeErr)
+
+		h := Handler{
+			svc:        svc,
+			compliance: tc.checker,
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/compliance", h.getCompliance)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/compliance", nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		report := &ComplianceReport{}
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(report))
+		require.Equal(t, tc.expectedCompliant, report.Compliant, tc.name)
+		require.True(t, report.Hardening.MetadataTokensRequired, tc.name)
+	}
+}
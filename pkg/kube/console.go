@@ -0,0 +1,503 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/util"
+)
+
+const (
+	DefaultConsolePrefix = "/supergiant/consoles/"
+
+	consoleTerm           = "xterm-256color"
+	consoleDialTimeout    = 10
+	defaultConsoleWidth   = 80
+	defaultConsoleHeight  = 24
+	maxConsoleRecordBytes = 64 << 20
+)
+
+// ConsoleSession is a shell opened on a node through the api, everything
+// typed and shown in its terminal is recorded.
+type ConsoleSession struct {
+	ID        string    `json:"id"`
+	KubeID    string    `json:"kubeId"`
+	Node      string    `json:"node"`
+	User      string    `json:"user"`
+	StartedAt time.Time `json:"startedAt"`
+	// FinishedAt is empty while the session is open.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExitCode   int        `json:"exitCode"`
+	Error      string     `json:"error,omitempty"`
+	// Truncated is set when the recording has reached its size limit,
+	// the rest of the session isn't recorded.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ConsoleHandler opens ssh shells on nodes with the key of the cluster, so
+// operators debug nodes without keys of their own. Recordings are files of
+// the replica that has served the session like logs of tasks.
+type ConsoleHandler struct {
+	svc    Interface
+	repo   storage.Interface
+	prefix string
+
+	dial      func(ctx context.Context, cfg ssh.Config) (*cryptossh.Client, error)
+	getWriter func(name string) (io.WriteCloser, error)
+	getReader func(name string) (io.ReadCloser, error)
+	now       func() time.Time
+
+	m         sync.RWMutex
+	listeners []func(ConsoleSession)
+}
+
+// NewConsoleHandler constructs a ConsoleHandler, sessions are kept in repo
+// outside of tenants and are read with access to their cluster.
+func NewConsoleHandler(svc Interface, repo storage.Interface) *ConsoleHandler {
+	return &ConsoleHandler{
+		svc:       svc,
+		repo:      repo,
+		prefix:    DefaultConsolePrefix,
+		dial:      ssh.Dial,
+		getWriter: util.GetWriter,
+		getReader: func(name string) (io.ReadCloser, error) {
+			return os.Open(path.Join("/tmp", name))
+		},
+		now: time.Now,
+	}
+}
+
+// OnSession subscribes fn to sessions that have ended.
+func (h *ConsoleHandler) OnSession(fn func(ConsoleSession)) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Register adds console handlers to a router.
+func (h *ConsoleHandler) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}/console", h.openConsole).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/consoles", h.listSessions).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/consoles/{sessionID}/recording", h.getRecording).Methods(http.MethodGet)
+}
+
+// nodeSSHConfig returns ssh settings of the node, nodes behind a bastion
+// are reached at their private addresses.
+func nodeSSHConfig(k *model.Kube, nodeName string) (ssh.Config, error) {
+	m := k.Masters[nodeName]
+	if m == nil {
+		m = k.Nodes[nodeName]
+	}
+	if m == nil {
+		return ssh.Config{}, errors.Wrapf(sgerrors.ErrNotFound, "node %s", nodeName)
+	}
+
+	key := k.SSHConfig.BootstrapPrivateKey
+	if key == "" {
+		key = k.CloudSpec[clouds.AwsSshBootstrapPrivateKey]
+	}
+	if key == "" && k.SSHConfig.AgentSocket == "" {
+		return ssh.Config{}, errors.Wrapf(sgerrors.ErrNotFound, "ssh key of kube %s", k.ID)
+	}
+
+	host := m.PublicIp
+	if k.SSHConfig.Bastion != "" && m.PrivateIp != "" {
+		host = m.PrivateIp
+	}
+	if host == "" {
+		return ssh.Config{}, errors.Wrapf(sgerrors.ErrNotFound, "address of node %s", nodeName)
+	}
+
+	timeout := k.SSHConfig.Timeout
+	if timeout == 0 {
+		timeout = consoleDialTimeout
+	}
+	return ssh.Config{
+		Host:        host,
+		Port:        k.SSHConfig.Port,
+		User:        k.SSHConfig.User,
+		Timeout:     timeout,
+		Key:         []byte(key),
+		Bastion:     k.SSHConfig.Bastion,
+		Passphrase:  k.SSHConfig.Passphrase,
+		AgentSocket: k.SSHConfig.AgentSocket,
+	}, nil
+}
+
+// consoleSize reads the initial size of the terminal: ?width=80&height=24
+func consoleSize(q url.Values) (TerminalSize, error) {
+	size := TerminalSize{Width: defaultConsoleWidth, Height: defaultConsoleHeight}
+	for name, v := range map[string]*uint16{
+		"width":  &size.Width,
+		"height": &size.Height,
+	} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.ParseUint(s, 10, 16)
+			if err != nil || n == 0 {
+				return size, errors.Wrapf(sgerrors.ErrInvalidJson, "%s %q", name, s)
+			}
+			*v = uint16(n)
+		}
+	}
+	return size, nil
+}
+
+func consoleRecordingName(sessionID string) string {
+	return "console-" + sessionID + ".cast"
+}
+
+// openConsole opens a login shell on the node and connects it to a websocket:
+// GET /kubes/{kubeID}/nodes/{nodename}/console?width=80&height=24
+// messages are framed as the ones of pod exec, the socket is closed when
+// the shell exits.
+func (h *ConsoleHandler) openConsole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, nodeName := vars["kubeID"], vars["nodename"]
+
+	size, err := consoleSize(r.URL.Query())
+	if err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+	cfg, err := nodeSSHConfig(k, nodeName)
+	if err != nil {
+		sendResourceError(w, nodeName, err)
+		return
+	}
+
+	session := &ConsoleSession{
+		ID:        uuid.New(),
+		KubeID:    k.ID,
+		Node:      nodeName,
+		User:      api.UserFromContext(r.Context()),
+		StartedAt: h.now(),
+	}
+	// sessions aren't opened unless they are recorded
+	out, err := h.getWriter(consoleRecordingName(session.ID))
+	if err != nil {
+		message.SendUnknownError(w, errors.Wrap(err, "create recording"))
+		return
+	}
+	defer out.Close()
+	rec := &consoleRecorder{w: out, now: h.now}
+	if err = rec.header(size, k.Name+"/"+nodeName); err != nil {
+		message.SendUnknownError(w, errors.Wrap(err, "write recording"))
+		return
+	}
+	if err = h.save(session); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	c, err := execUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("kube %s: console of %s: upgrade connection: %v", kubeID, nodeName, err)
+		h.finish(session, rec, err)
+		return
+	}
+	defer c.Close()
+	conn := &execConn{c: c}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stdin, stdinWriter := io.Pipe()
+	resize := make(chan TerminalSize, 1)
+	go func() {
+		defer cancel()
+		defer stdinWriter.Close()
+		defer close(resize)
+		readExecInput(ctx, c, io.MultiWriter(recordWriter{rec, "i"}, stdinWriter), resize)
+	}()
+
+	streams := ExecStreams{
+		Stdin:  stdin,
+		Stdout: io.MultiWriter(execWriter{conn: conn, channel: execChannelStdout}, recordWriter{rec, "o"}),
+		Resize: resize,
+	}
+	err = h.shell(ctx, cfg, size, streams, rec)
+	stdin.Close()
+
+	if _, ok := errors.Cause(err).(*ExitError); err != nil && !ok {
+		logrus.Warnf("kube %s: console of %s: %v", kubeID, nodeName, err)
+	}
+	conn.close(execResult(err), "session has ended")
+	h.finish(session, rec, err)
+}
+
+// shell runs a login shell in a pty of the node until it exits or ctx
+// is done, a non-zero exit code is returned as *ExitError.
+func (h *ConsoleHandler) shell(ctx context.Context, cfg ssh.Config, size TerminalSize,
+	streams ExecStreams, rec *consoleRecorder) error {
+	client, err := h.dial(ctx, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "connect to %s", cfg.Host)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return errors.Wrap(err, "open session")
+	}
+	defer session.Close()
+
+	modes := cryptossh.TerminalModes{
+		cryptossh.ECHO:          1,
+		cryptossh.TTY_OP_ISPEED: 14400,
+		cryptossh.TTY_OP_OSPEED: 14400,
+	}
+	if err = session.RequestPty(consoleTerm, int(size.Height), int(size.Width), modes); err != nil {
+		return errors.Wrap(err, "request pty")
+	}
+	// a pty has a single output
+	session.Stdout = streams.Stdout
+	session.Stderr = streams.Stdout
+	// Wait doesn't return until stdin set to the session is closed
+	in, err := session.StdinPipe()
+	if err != nil {
+		return errors.Wrap(err, "open stdin")
+	}
+	go func() {
+		io.Copy(in, streams.Stdin)
+		in.Close()
+	}()
+
+	if err = session.Shell(); err != nil {
+		return errors.Wrap(err, "start shell")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		resize := streams.Resize
+		for {
+			select {
+			case size, ok := <-resize:
+				if !ok {
+					resize = nil
+					continue
+				}
+				rec.event("r", fmt.Sprintf("%dx%d", size.Width, size.Height))
+				session.WindowChange(int(size.Height), int(size.Width))
+			case <-ctx.Done():
+				// the shell is hung up with the connection
+				client.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = session.Wait()
+	if exitErr, ok := err.(*cryptossh.ExitError); ok {
+		return &ExitError{Code: exitErr.ExitStatus()}
+	}
+	return err
+}
+
+func (h *ConsoleHandler) save(s *ConsoleSession) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "marshal console session %s", s.ID)
+	}
+	// the session is saved when the request has been cancelled
+	return errors.Wrapf(h.repo.Put(context.Background(), h.kubePrefix(s.KubeID), s.ID, data),
+		"save console session %s", s.ID)
+}
+
+func (h *ConsoleHandler) finish(s *ConsoleSession, rec *consoleRecorder, err error) {
+	finishedAt := h.now()
+	s.FinishedAt = &finishedAt
+	s.Truncated = rec.truncated()
+	result := execResult(err)
+	s.ExitCode = result.ExitCode
+	if _, ok := errors.Cause(err).(*ExitError); err != nil && !ok {
+		s.Error = result.Message
+	}
+	if err := h.save(s); err != nil {
+		logrus.Warnf("kube %s: console of %s: %v", s.KubeID, s.Node, err)
+	}
+
+	h.m.RLock()
+	defer h.m.RUnlock()
+	for _, fn := range h.listeners {
+		fn(*s)
+	}
+}
+
+// listSessions returns console sessions of the cluster, the latest go first:
+// GET /kubes/{kubeID}/consoles
+func (h *ConsoleHandler) listSessions(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+	// the kube is looked up within the tenant of the request
+	if _, err := h.svc.Get(r.Context(), kubeID); err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	raw, err := h.repo.GetAll(r.Context(), h.kubePrefix(kubeID))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	sessions := make([]ConsoleSession, 0, len(raw))
+	for _, data := range raw {
+		s := ConsoleSession{}
+		if err = json.Unmarshal(data, &s); err != nil {
+			logrus.Warnf("kube %s: skip corrupted console session: %v", kubeID, err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.After(sessions[j].StartedAt)
+	})
+
+	if err = json.NewEncoder(w).Encode(sessions); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// getRecording returns the recording of a session in the asciicast v2 format:
+// GET /kubes/{kubeID}/consoles/{sessionID}/recording
+func (h *ConsoleHandler) getRecording(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, sessionID := vars["kubeID"], vars["sessionID"]
+	if _, err := h.svc.Get(r.Context(), kubeID); err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+	if _, err := h.repo.Get(r.Context(), h.kubePrefix(kubeID), sessionID); err != nil {
+		sendResourceError(w, sessionID, err)
+		return
+	}
+
+	recording, err := h.getReader(consoleRecordingName(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the session has been served by another replica
+			message.SendNotFound(w, sessionID, errors.Wrap(sgerrors.ErrNotFound, "recording"))
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	defer recording.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	io.Copy(w, recording)
+}
+
+func (h *ConsoleHandler) kubePrefix(kubeID string) string {
+	return h.prefix + kubeID + "/"
+}
+
+// consoleRecorder writes a session in the asciicast v2 format, see
+// https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+// Input is recorded along with output, so typed commands can be audited.
+type consoleRecorder struct {
+	w   io.Writer
+	now func() time.Time
+
+	mu      sync.Mutex
+	start   time.Time
+	written int
+	cut     bool
+}
+
+func (r *consoleRecorder) header(size TerminalSize, title string) error {
+	r.start = r.now()
+	data, err := json.Marshal(struct {
+		Version   int               `json:"version"`
+		Width     uint16            `json:"width"`
+		Height    uint16            `json:"height"`
+		Timestamp int64             `json:"timestamp"`
+		Title     string            `json:"title"`
+		Env       map[string]string `json:"env"`
+	}{
+		Version:   2,
+		Width:     size.Width,
+		Height:    size.Height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": consoleTerm},
+	})
+	if err != nil {
+		return err
+	}
+	return r.write(data)
+}
+
+// event records data of the kind: "o" for output, "i" for input and
+// "r" for resizes, events past the size limit are dropped.
+func (r *consoleRecorder) event(kind, data string) {
+	elapsed := r.now().Sub(r.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err != nil {
+		return
+	}
+	if err = r.write(line); err != nil {
+		logrus.Debugf("console: record %s event: %v", kind, err)
+	}
+}
+
+func (r *consoleRecorder) write(line []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cut || r.written+len(line)+1 > maxConsoleRecordBytes {
+		r.cut = true
+		return nil
+	}
+	n, err := r.w.Write(append(line, '\n'))
+	r.written += n
+	return err
+}
+
+func (r *consoleRecorder) truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cut
+}
+
+// recordWriter records writes as events of the kind, it never fails, so
+// the terminal isn't broken by the recording.
+type recordWriter struct {
+	r    *consoleRecorder
+	kind string
+}
+
+func (w recordWriter) Write(b []byte) (int, error) {
+	w.r.event(w.kind, string(b))
+	return len(b), nil
+}
@@ -0,0 +1,333 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func consoleKey(t *testing.T) (string, cryptossh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	signer, err := cryptossh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), signer
+}
+
+// fakeNode runs shells that echo their input and exit with code 3 on
+// "exit", sizes of terminals are sent to sizes.
+func fakeNode(t *testing.T, client cryptossh.PublicKey, sizes chan<- TerminalSize) net.Listener {
+	_, host := consoleKey(t)
+	cfg := &cryptossh.ServerConfig{
+		PublicKeyCallback: func(conn cryptossh.ConnMetadata, key cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), client.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(host)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveShell(nc, cfg, sizes)
+		}
+	}()
+	return l
+}
+
+func serveShell(nc net.Conn, cfg *cryptossh.ServerConfig, sizes chan<- TerminalSize) {
+	_, chans, reqs, err := cryptossh.NewServerConn(nc, cfg)
+	if err != nil {
+		return
+	}
+	go cryptossh.DiscardRequests(reqs)
+
+	for nch := range chans {
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				switch req.Type {
+				case "pty-req", "window-change":
+					payload := req.Payload
+					if req.Type == "pty-req" {
+						// the payload starts with the TERM
+						payload = payload[4+len(consoleTerm):]
+					}
+					size := struct{ Columns, Rows, Width, Height uint32 }{}
+					cryptossh.Unmarshal(payload[:16], &size)
+					sizes <- TerminalSize{Width: uint16(size.Columns), Height: uint16(size.Rows)}
+					req.Reply(true, nil)
+				case "shell":
+					req.Reply(true, nil)
+					go func() {
+						buf := make([]byte, 64)
+						for {
+							n, err := ch.Read(buf)
+							if err != nil {
+								return
+							}
+							ch.Write(buf[:n])
+							if string(buf[:n]) == "exit" {
+								ch.SendRequest("exit-status", false, cryptossh.Marshal(struct{ Status uint32 }{3}))
+								ch.Close()
+								return
+							}
+						}
+					}()
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+func TestNodeSSHConfig(t *testing.T) {
+	masters := map[string]*model.Machine{"master": {PublicIp: "1.1.1.1", PrivateIp: "10.0.0.1"}}
+	nodes := map[string]*model.Machine{"node": {PrivateIp: "10.0.0.2"}}
+
+	for _, tc := range []struct {
+		name           string
+		kube           *model.Kube
+		node           string
+		expectedErr    error
+		expectedConfig ssh.Config
+	}{
+		{
+			name:        "node not found",
+			kube:        &model.Kube{Masters: masters, SSHConfig: model.SSHConfig{BootstrapPrivateKey: "key"}},
+			node:        "lost",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no key",
+			kube:        &model.Kube{Masters: masters},
+			node:        "master",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no public address",
+			kube:        &model.Kube{Nodes: nodes, SSHConfig: model.SSHConfig{BootstrapPrivateKey: "key"}},
+			node:        "node",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name: "aws key",
+			kube: &model.Kube{
+				Masters:   masters,
+				SSHConfig: model.SSHConfig{User: "ubuntu", Port: "22", Timeout: 30},
+				CloudSpec: profile.CloudSpecificSettings{clouds.AwsSshBootstrapPrivateKey: "key"},
+			},
+			node: "master",
+			expectedConfig: ssh.Config{
+				Host:    "1.1.1.1",
+				Port:    "22",
+				User:    "ubuntu",
+				Timeout: 30,
+				Key:     []byte("key"),
+			},
+		},
+		{
+			name: "bastion",
+			kube: &model.Kube{
+				Nodes:     nodes,
+				SSHConfig: model.SSHConfig{User: "root", BootstrapPrivateKey: "key", Bastion: "jump:2222"},
+			},
+			node: "node",
+			expectedConfig: ssh.Config{
+				Host:    "10.0.0.2",
+				User:    "root",
+				Timeout: consoleDialTimeout,
+				Key:     []byte("key"),
+				Bastion: "jump:2222",
+			},
+		},
+	} {
+		cfg, err := nodeSSHConfig(tc.kube, tc.node)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedConfig, cfg, "TC: %s", tc.name)
+	}
+}
+
+func TestConsoleHandler_openConsole(t *testing.T) {
+	key, signer := consoleKey(t)
+	sizes := make(chan TerminalSize, 1)
+	node := fakeNode(t, signer.PublicKey(), sizes)
+	defer node.Close()
+	_, port, err := net.SplitHostPort(node.Addr().String())
+	require.NoError(t, err)
+
+	k := &model.Kube{
+		ID:        "kube",
+		Name:      "prod",
+		Masters:   map[string]*model.Machine{"master": {PublicIp: "127.0.0.1"}},
+		SSHConfig: model.SSHConfig{User: "root", Port: port, BootstrapPrivateKey: key},
+	}
+	svc := new(kubeServiceMock)
+	svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+	svc.On(serviceGet, mock.Anything, mock.Anything).Return(nil, sgerrors.ErrNotFound)
+
+	recording := &bufferCloser{}
+	repo := memory.NewInMemoryRepository()
+	h := NewConsoleHandler(svc, repo)
+	h.getWriter = func(string) (io.WriteCloser, error) {
+		return recording, nil
+	}
+	sessions := make(chan ConsoleSession, 1)
+	h.OnSession(func(s ConsoleSession) {
+		sessions <- s
+	})
+
+	router := mux.NewRouter()
+	h.Register(router)
+	auth := api.Middleware{TokenService: userTokens{}}
+	router.Use(auth.AuthMiddleware)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	headers := http.Header{"Authorization": {"Bearer alice"}}
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/kubes/kube/nodes/"
+	for path, code := range map[string]int{
+		"lost/console":                http.StatusNotFound,
+		"master/console?width=wide":   http.StatusBadRequest,
+		"master/console?height=65536": http.StatusBadRequest,
+	} {
+		_, resp, err := websocket.DefaultDialer.Dial(u+path, headers)
+		require.Error(t, err, path)
+		require.Equal(t, code, resp.StatusCode, path)
+	}
+
+	c, _, err := websocket.DefaultDialer.Dial(u+"master/console?width=100&height=30", headers)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, TerminalSize{Width: 100, Height: 30}, <-sizes)
+
+	require.NoError(t, c.WriteMessage(websocket.BinaryMessage, []byte{execChannelStdin, 'l', 's'}))
+	_, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, []byte{execChannelStdout, 'l', 's'}, msg)
+
+	require.NoError(t, c.WriteMessage(websocket.BinaryMessage,
+		append([]byte{execChannelResize}, `{"width":120,"height":40}`...)))
+	require.Equal(t, TerminalSize{Width: 120, Height: 40}, <-sizes)
+
+	require.NoError(t, c.WriteMessage(websocket.BinaryMessage, append([]byte{execChannelStdin}, "exit"...)))
+	_, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{execChannelStdout}, "exit"...), msg)
+	_, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	result := ExecResult{}
+	require.NoError(t, json.Unmarshal(msg[1:], &result))
+	require.Equal(t, ExecResult{ExitCode: 3, Message: "command terminated with exit code 3"}, result)
+
+	session := <-sessions
+	require.Equal(t, "alice", session.User)
+	require.Equal(t, "master", session.Node)
+	require.Equal(t, 3, session.ExitCode)
+	require.NotNil(t, session.FinishedAt)
+	require.Empty(t, session.Error)
+
+	saved, err := repo.Get(context.Background(), DefaultConsolePrefix+"kube/", session.ID)
+	require.NoError(t, err)
+	require.Contains(t, string(saved), `"exitCode":3`)
+
+	lines := strings.Split(strings.TrimSpace(recording.String()), "\n")
+	require.Contains(t, lines[0], `"version":2,"width":100,"height":30`)
+	require.Contains(t, lines[0], `"title":"prod/master"`)
+	events := make([]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		event := make([]interface{}, 0, 3)
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event[1].(string)+" "+event[2].(string))
+	}
+	require.Equal(t, []string{"i ls", "o ls", "r 120x40", "i exit", "o exit"}, events)
+}
+
+func TestConsoleHandler_getRecording(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{ID: "kube"}, nil)
+	svc.On(serviceGet, mock.Anything, mock.Anything).Return(nil, sgerrors.ErrNotFound)
+
+	repo := memory.NewInMemoryRepository()
+	h := NewConsoleHandler(svc, repo)
+	for id, startedAt := range map[string]int64{"old": 100, "new": 200, "lost": 50} {
+		require.NoError(t, h.save(&ConsoleSession{ID: id, KubeID: "kube", StartedAt: time.Unix(startedAt, 0)}))
+	}
+	h.getReader = func(name string) (io.ReadCloser, error) {
+		if name != consoleRecordingName("new") {
+			return nil, os.ErrNotExist
+		}
+		return ioutil.NopCloser(strings.NewReader(`{"version":2}`)), nil
+	}
+
+	router := mux.NewRouter()
+	h.Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/consoles", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	sessions := make([]ConsoleSession, 0)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&sessions))
+	require.Len(t, sessions, 3)
+	require.Equal(t, "new", sessions[0].ID)
+
+	for _, tc := range []struct {
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"/kubes/other/consoles", http.StatusNotFound, ""},
+		{"/kubes/kube/consoles/unknown/recording", http.StatusNotFound, ""},
+		{"/kubes/kube/consoles/lost/recording", http.StatusNotFound, ""},
+		{"/kubes/kube/consoles/new/recording", http.StatusOK, `{"version":2}`},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, tc.path)
+		if tc.expectedBody != "" {
+			require.Equal(t, tc.expectedBody, rec.Body.String(), tc.path)
+		}
+	}
+}
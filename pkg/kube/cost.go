@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// BudgetStatus is actual cost of the cluster in the current month
+// compared with its budget.
+type BudgetStatus struct {
+	Name         string    `json:"name"`
+	Amount       float64   `json:"amount"`
+	CurrentSpend float64   `json:"currentSpend"`
+	Currency     string    `json:"currency,omitempty"`
+	Thresholds   []float64 `json:"thresholds"`
+	// Exceeded are thresholds alerts have been sent for.
+	Exceeded []float64 `json:"exceeded"`
+}
+
+// CostReport describes how spending of the cluster is attributed.
+type CostReport struct {
+	KubeID   string            `json:"kubeId"`
+	Provider clouds.Name       `json:"provider"`
+	Tags     map[string]string `json:"tags"`
+	// Budget is empty for clusters without one.
+	Budget *BudgetStatus `json:"budget,omitempty"`
+	// BudgetUnavailable is set when the budget can't be read from the cloud.
+	BudgetUnavailable bool `json:"budgetUnavailable,omitempty"`
+}
+
+type budgetGetter interface {
+	ClusterBudget(ctx context.Context, k *model.Kube) (*BudgetStatus, error)
+}
+
+type clusterBudgetFn func(ctx context.Context, config *steps.Config, group string) (*BudgetStatus, error)
+
+// ClusterBudget returns the budget of the cluster, nil is returned when it
+// has none. sgerrors.ErrUnsupportedProvider is returned for clouds without budgets.
+func (c *CloudInstances) ClusterBudget(ctx context.Context, k *model.Kube) (*BudgetStatus, error) {
+	var get clusterBudgetFn
+	if k.Provider == clouds.Azure {
+		get = c.azureBudget
+	}
+	if get == nil || k.ExternallyManaged {
+		return nil, sgerrors.ErrUnsupportedProvider
+	}
+	if k.Cost.Budget.Amount == 0 {
+		return nil, nil
+	}
+
+	config, err := c.config(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	budget, err := get(ctx, config, k.CloudSpec[clouds.AzureResourceGroup])
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s budget", k.Provider)
+	}
+
+	return budget, nil
+}
+
+// NewBudgetStatus lists thresholds the current spend has crossed.
+func NewBudgetStatus(name string, amount, spend float64, currency string, thresholds []float64) *BudgetStatus {
+	status := &BudgetStatus{
+		Name:         name,
+		Amount:       amount,
+		CurrentSpend: spend,
+		Currency:     currency,
+		Thresholds:   thresholds,
+		Exceeded:     make([]float64, 0),
+	}
+	if amount <= 0 {
+		return status
+	}
+
+	for _, t := range thresholds {
+		if spend*100/amount > t {
+			status.Exceeded = append(status.Exceeded, t)
+		}
+	}
+
+	return status
+}
+
+// azureClusterBudget reads the budget of the resource group, it is named
+// after the group.
+func azureClusterBudget(ctx context.Context, config *steps.Config, group string) (*BudgetStatus, error) {
+	client, err := azuresdk.New(config.AzureConfig).BudgetsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "get budgets client")
+	}
+
+	b, err := client.Get(ctx, group, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBudgetStatus(b.Name, b.Amount, b.CurrentSpend, b.Currency, b.Thresholds), nil
+}
+
+// getCost returns cost center tags of the cluster and the status of its budget.
+func (h *Handler) getCost(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	report := &CostReport{
+		KubeID:   k.ID,
+		Provider: k.Provider,
+		Tags:     k.Cost.Tags,
+	}
+	if report.Tags == nil {
+		report.Tags = make(map[string]string)
+	}
+
+	budget, err := h.budgets.ClusterBudget(r.Context(), k)
+	switch {
+	case err == nil:
+		report.Budget = budget
+	case sgerrors.IsUnsupportedProvider(err):
+	default:
+		// spending is reported with a delay, the rest of the report is still useful
+		logrus.Warnf("kube %s: %v", k.ID, err)
+		report.BudgetUnavailable = true
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
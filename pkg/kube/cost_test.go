@@ -0,0 +1,171 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeBudgets struct {
+	budget *BudgetStatus
+	err    error
+}
+
+func (f *fakeBudgets) ClusterBudget(ctx context.Context, k *model.Kube) (*BudgetStatus, error) {
+	return f.budget, f.err
+}
+
+func TestNewBudgetStatus(t *testing.T) {
+	status := NewBudgetStatus("sg", 200, 170, "USD", []float64{50, 80, 100})
+	require.Equal(t, []float64{50, 80}, status.Exceeded)
+
+	status = NewBudgetStatus("sg", 0, 170, "USD", []float64{50})
+	require.Empty(t, status.Exceeded)
+}
+
+func TestCloudInstances_ClusterBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider clouds.Name
+		amount   float64
+		getErr   error
+
+		expectedErr    error
+		expectedBudget bool
+	}{
+		{
+			name:        "unsupported provider",
+			provider:    clouds.AWS,
+			amount:      100,
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:     "no budget",
+			provider: clouds.Azure,
+		},
+		{
+			name:        "get error",
+			provider:    clouds.Azure,
+			amount:      100,
+			getErr:      sgerrors.ErrInvalidCredentials,
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+		{
+			name:           "azure",
+			provider:       clouds.Azure,
+			amount:         100,
+			expectedBudget: true,
+		},
+	} {
+		k := &model.Kube{
+			Provider:    tc.provider,
+			AccountName: "azure",
+			CloudSpec:   map[string]string{clouds.AzureResourceGroup: "sg-kube-1234"},
+			Cost: profile.CostSettings{
+				Budget: profile.BudgetSettings{Amount: tc.amount},
+			},
+		}
+
+		accounts := new(accServiceMock)
+		accounts.On("Get", mock.Anything, "azure").Return(&model.CloudAccount{
+			Name:     "azure",
+			Provider: clouds.Azure,
+			Credentials: map[string]string{
+				clouds.AzureSubscriptionID: "sub",
+			},
+		}, nil)
+
+		c := NewCloudInstances(accounts)
+		c.azureBudget = func(ctx context.Context, config *steps.Config, group string) (*BudgetStatus, error) {
+			require.Equal(t, "sub", config.AzureConfig.SubscriptionID, "TC: %s", tc.name)
+			require.Equal(t, "sg-kube-1234", group, "TC: %s", tc.name)
+			return &BudgetStatus{Name: group}, tc.getErr
+		}
+
+		budget, err := c.ClusterBudget(context.Background(), k)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedBudget, budget != nil, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getCost(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		kubeErr   error
+		budget    *BudgetStatus
+		budgetErr error
+
+		expectedCode        int
+		expectedBudget      bool
+		expectedUnavailable bool
+	}{
+		{
+			name:         "not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unsupported provider",
+			budgetErr:    sgerrors.ErrUnsupportedProvider,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:                "budget error",
+			budgetErr:           errFake,
+			expectedCode:        http.StatusOK,
+			expectedUnavailable: true,
+		},
+		{
+			name:           "ok",
+			budget:         NewBudgetStatus("sg", 100, 90, "USD", []float64{80}),
+			expectedCode:   http.StatusOK,
+			expectedBudget: true,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{
+			ID:       "kube",
+			Provider: clouds.Azure,
+			Cost: profile.CostSettings{
+				Tags: map[string]string{"costCenter": "ml"},
+			},
+		}, tc.kubeErr)
+
+		h := Handler{
+			svc:     svc,
+			budgets: &fakeBudgets{budget: tc.budget, err: tc.budgetErr},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/cost", h.getCost)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/cost", nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		report := &CostReport{}
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(report))
+		require.Equal(t, "ml", report.Tags["costCenter"], tc.name)
+		require.Equal(t, tc.expectedBudget, report.Budget != nil, tc.name)
+		require.Equal(t, tc.expectedUnavailable, report.BudgetUnavailable, tc.name)
+		if tc.expectedBudget {
+			require.Equal(t, []float64{80}, report.Budget.Exceeded, tc.name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// dashboardCSP is a content security policy of proxied dashboard pages.
+const dashboardCSP = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; font-src 'self' data:; connect-src 'self'; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'; frame-ancestors 'self'"
+
+// apiServerTransport returns an address of the api server of the cluster
+// and a transport with admin credentials.
+func apiServerTransport(k *model.Kube) (*url.URL, http.RoundTripper, error) {
+	cfg, err := NewConfigFor(k)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parse api server host")
+	}
+	tr, err := rest.TransportFor(cfg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "build transport")
+	}
+
+	return u, tr, nil
+}
+
+// dashboard serves the dashboard of the cluster through the service proxy of
+// the api server, only authenticated users of control reach it. The UI opens
+// /kubes/{kubeID}/dashboard/?token=<jwt>, the token is kept in a cookie of
+// the dashboard path, so the dashboard loads its assets without it.
+func (h *Handler) dashboard(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	suffix := "/kubes/" + kubeID + "/dashboard"
+	i := strings.Index(r.URL.Path, suffix)
+	if i < 0 {
+		message.SendNotFound(w, r.URL.Path, sgerrors.ErrNotFound)
+		return
+	}
+	prefix := r.URL.Path[:i+len(suffix)] + "/"
+
+	if token := r.URL.Query().Get("token"); token != "" || !strings.HasPrefix(r.URL.Path, prefix) {
+		if token != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     api.SessionCookie,
+				Value:    token,
+				Path:     prefix,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		// the token is removed from the address bar and history
+		q := r.URL.Query()
+		q.Del("token")
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		if !strings.HasPrefix(u.Path, prefix) {
+			u.Path = prefix
+		}
+		http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	dashboard := steps.NewDashboardConfig(k.Dashboard)
+	if dashboard.Service == "" {
+		message.SendNotFound(w, "dashboard", errors.Wrapf(sgerrors.ErrNotFound, "dashboard of %s", kubeID))
+		return
+	}
+
+	target, tr, err := h.apiServerTransport(k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = strings.TrimSuffix(target.Path, "/") + dashboard.ProxyPath() +
+				strings.TrimPrefix(req.URL.Path, prefix)
+			req.URL.RawPath = ""
+			req.Host = target.Host
+
+			// credentials of control users are not passed to the cluster
+			req.Header.Del("Authorization")
+			req.Header.Del("Cookie")
+		},
+		Transport: tr,
+		ModifyResponse: func(resp *http.Response) error {
+			// the dashboard shares the origin of control, so it is not allowed
+			// to load or embed anything from elsewhere
+			resp.Header.Set("Content-Security-Policy", dashboardCSP)
+			resp.Header.Set("X-Content-Type-Options", "nosniff")
+			resp.Header.Set("X-Frame-Options", "SAMEORIGIN")
+			return nil
+		},
+	}
+
+	// the content type is set by the dashboard
+	w.Header().Del("Content-Type")
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestHandler_dashboard(t *testing.T) {
+	var upstream *http.Request
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("dashboard"))
+	}))
+	defer apiServer.Close()
+
+	withDashboard := &model.Kube{
+		ID:        "kube",
+		Dashboard: profile.DashboardSettings{Tool: steps.DashboardKubernetes},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		url     string
+		kube    *model.Kube
+		kubeErr error
+
+		expectedCode     int
+		expectedLocation string
+		expectedCookie   bool
+		expectedPath     string
+	}{
+		{
+			name:             "token",
+			url:              "/v1/api/kubes/kube/dashboard/?token=jwt&lang=en",
+			expectedCode:     http.StatusFound,
+			expectedLocation: "/v1/api/kubes/kube/dashboard/?lang=en",
+			expectedCookie:   true,
+		},
+		{
+			name:             "no trailing slash",
+			url:              "/v1/api/kubes/kube/dashboard",
+			expectedCode:     http.StatusFound,
+			expectedLocation: "/v1/api/kubes/kube/dashboard/",
+		},
+		{
+			name:         "not found",
+			url:          "/v1/api/kubes/kube/dashboard/",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "no dashboard",
+			url:          "/v1/api/kubes/kube/dashboard/",
+			kube:         &model.Kube{ID: "kube"},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "proxy",
+			url:          "/v1/api/kubes/kube/dashboard/assets/app.js",
+			kube:         withDashboard,
+			expectedCode: http.StatusOK,
+			expectedPath: "/api/v1/namespaces/kubernetes-dashboard/services/https:kubernetes-dashboard:443/proxy/assets/app.js",
+		},
+	} {
+		upstream = nil
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, tc.kubeErr)
+
+		h := Handler{
+			svc: svc,
+			apiServerTransport: func(*model.Kube) (*url.URL, http.RoundTripper, error) {
+				u, err := url.Parse(apiServer.URL)
+				return u, http.DefaultTransport, err
+			},
+		}
+		router := mux.NewRouter()
+		router.PathPrefix("/v1/api/kubes/{kubeID}/dashboard").HandlerFunc(h.dashboard)
+
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		req.Header.Set("Authorization", "Bearer jwt")
+		req.AddCookie(&http.Cookie{Name: api.SessionCookie, Value: "jwt"})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if tc.expectedLocation != "" {
+			require.Equal(t, tc.expectedLocation, rec.Header().Get("Location"), tc.name)
+		}
+
+		cookies := rec.Result().Cookies()
+		require.Equal(t, tc.expectedCookie, len(cookies) == 1, tc.name)
+		if tc.expectedCookie {
+			require.Equal(t, "jwt", cookies[0].Value, tc.name)
+			require.Equal(t, "/v1/api/kubes/kube/dashboard/", cookies[0].Path, tc.name)
+			require.True(t, cookies[0].HttpOnly, tc.name)
+		}
+
+		if tc.expectedPath == "" {
+			require.Nil(t, upstream, tc.name)
+			continue
+		}
+		require.NotNil(t, upstream, tc.name)
+		require.Equal(t, tc.expectedPath, upstream.URL.Path, tc.name)
+		require.Empty(t, upstream.Header.Get("Authorization"), tc.name)
+		require.Empty(t, upstream.Header.Get("Cookie"), tc.name)
+		require.Equal(t, "text/html", rec.Header().Get("Content-Type"), tc.name)
+		require.Equal(t, dashboardCSP, rec.Header().Get("Content-Security-Policy"), tc.name)
+		require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"), tc.name)
+	}
+}
@@ -0,0 +1,334 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/releaseutil"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	SourceCluster = "cluster"
+	SourceRelease = "release"
+
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// RemovedAPI is an api version of a kind that is not served starting from
+// the RemovedIn kubernetes version.
+type RemovedAPI struct {
+	GroupVersion string `json:"groupVersion"`
+	Kind         string `json:"kind"`
+	RemovedIn    string `json:"removedIn"`
+	Replacement  string `json:"replacement,omitempty"`
+}
+
+// RemovedAPIs lists api versions removed from kubernetes.
+var RemovedAPIs = []RemovedAPI{
+	{"extensions/v1beta1", "DaemonSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "Deployment", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.16", "policy/v1beta1"},
+	{"apps/v1beta1", "Deployment", "1.16", "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "Deployment", "1.16", "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", "1.16", "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "Ingress", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", "1.22", "networking.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.22", "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "1.22", "apiregistration.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.22", "storage.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", "1.22", "coordination.k8s.io/v1"},
+	{"batch/v1beta1", "CronJob", "1.25", "batch/v1"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.25", ""},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "1.25", "discovery.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "1.25", "autoscaling/v2"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "1.26", "autoscaling/v2"},
+}
+
+// UpgradeFinding is an object that uses an api version removed in the target version.
+type UpgradeFinding struct {
+	RemovedAPI
+	Source    string `json:"source"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Release   string `json:"release,omitempty"`
+}
+
+// UpgradeReport lists blockers of an upgrade of a cluster to the target version.
+type UpgradeReport struct {
+	KubeID         string `json:"kubeId"`
+	CurrentVersion string `json:"currentVersion"`
+	TargetVersion  string `json:"targetVersion"`
+
+	// Served are removed apis the cluster still serves
+	Served   []RemovedAPI     `json:"served"`
+	Blockers []UpgradeFinding `json:"blockers"`
+	// Errors are sources that could not be checked
+	Errors []string `json:"errors,omitempty"`
+	Ready  bool     `json:"ready"`
+}
+
+// UpgradeCheck scans objects of the cluster and manifests of helm releases
+// for apis removed in the target kubernetes version.
+func (s Service) UpgradeCheck(ctx context.Context, kubeID, targetVersion string) (*UpgradeReport, error) {
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := removedBetween(k.K8SVersion, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UpgradeReport{
+		KubeID:         k.ID,
+		CurrentVersion: k.K8SVersion,
+		TargetVersion:  targetVersion,
+		Served:         make([]RemovedAPI, 0),
+		Blockers:       make([]UpgradeFinding, 0),
+	}
+
+	served, findings, err := s.clusterFindings(k, removed)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", SourceCluster, err))
+	}
+	report.Served = append(report.Served, served...)
+	report.Blockers = append(report.Blockers, findings...)
+
+	findings, err = s.releaseFindings(k, removed)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", SourceRelease, err))
+	}
+	report.Blockers = append(report.Blockers, findings...)
+
+	sort.Slice(report.Blockers, func(i, j int) bool {
+		a, b := report.Blockers[i], report.Blockers[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	report.Ready = len(report.Blockers) == 0 && len(report.Errors) == 0
+
+	return report, nil
+}
+
+// clusterFindings returns removed apis served by the cluster and objects that
+// were last applied with them. Objects created with other tools can't be
+// told apart, the api server returns them in any served version.
+func (s Service) clusterFindings(k *model.Kube, removed map[string]RemovedAPI) ([]RemovedAPI, []UpgradeFinding, error) {
+	if s.discoveryClientFn == nil || s.clientForGroupFn == nil {
+		return nil, nil, errors.Wrap(sgerrors.ErrNilEntity, "kubernetes client builder")
+	}
+
+	client, err := s.discoveryClientFn(k)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get discovery client")
+	}
+	resourceLists, err := client.ServerResources()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get resources")
+	}
+
+	served := make([]RemovedAPI, 0)
+	findings := make([]UpgradeFinding, 0)
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, res := range list.APIResources {
+			api, ok := removed[apiKey(list.GroupVersion, res.Kind)]
+			// skip subresources, e.g. deployments/scale
+			if !ok || strings.Contains(res.Name, "/") {
+				continue
+			}
+			served = append(served, api)
+
+			objects, err := s.appliedObjects(k, gv, res.Name)
+			if err != nil {
+				return served, findings, errors.Wrapf(err, "list %s", res.Name)
+			}
+			for _, obj := range objects {
+				if obj.apiVersion != list.GroupVersion {
+					continue
+				}
+				findings = append(findings, UpgradeFinding{
+					RemovedAPI: api,
+					Source:     SourceCluster,
+					Namespace:  obj.Namespace,
+					Name:       obj.Name,
+				})
+			}
+		}
+	}
+
+	return served, findings, nil
+}
+
+type appliedObject struct {
+	metav1.ObjectMeta
+	apiVersion string
+}
+
+// appliedObjects lists objects of the resource with an api version they were applied with.
+func (s Service) appliedObjects(k *model.Kube, gv schema.GroupVersion, resource string) ([]appliedObject, error) {
+	client, err := s.clientForGroupFn(k, gv)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube client")
+	}
+
+	raw, err := client.Get().Resource(resource).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	list := struct {
+		Items []struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		} `json:"items"`
+	}{}
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.Wrap(err, "decode list")
+	}
+
+	out := make([]appliedObject, 0, len(list.Items))
+	for _, item := range list.Items {
+		applied, ok := item.Metadata.Annotations[lastAppliedAnnotation]
+		if !ok {
+			continue
+		}
+		typeMeta := metav1.TypeMeta{}
+		if err = json.Unmarshal([]byte(applied), &typeMeta); err != nil {
+			continue
+		}
+		out = append(out, appliedObject{
+			ObjectMeta: item.Metadata,
+			apiVersion: typeMeta.APIVersion,
+		})
+	}
+
+	return out, nil
+}
+
+// releaseFindings returns objects of deployed helm releases that use removed apis,
+// such releases fail to upgrade after the cluster has been upgraded.
+func (s Service) releaseFindings(k *model.Kube, removed map[string]RemovedAPI) ([]UpgradeFinding, error) {
+	kprx, err := s.helmClient(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build helm proxy")
+	}
+
+	res, err := kprx.ListReleases(helm.ReleaseListStatuses([]release.Status_Code{
+		release.Status_DEPLOYED,
+		release.Status_FAILED,
+	}))
+	if err != nil {
+		return nil, errors.Wrap(err, "list releases")
+	}
+
+	findings := make([]UpgradeFinding, 0)
+	for _, rls := range res.GetReleases() {
+		if rls == nil {
+			continue
+		}
+		findings = append(findings, manifestFindings(rls.GetName(), rls.GetNamespace(), rls.GetManifest(), removed)...)
+	}
+
+	return findings, nil
+}
+
+func manifestFindings(rlsName, namespace, manifest string, removed map[string]RemovedAPI) []UpgradeFinding {
+	findings := make([]UpgradeFinding, 0)
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		obj := struct {
+			metav1.TypeMeta `json:",inline"`
+			Metadata        metav1.ObjectMeta `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			continue
+		}
+
+		api, ok := removed[apiKey(obj.APIVersion, obj.Kind)]
+		if !ok {
+			continue
+		}
+		ns := obj.Metadata.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		findings = append(findings, UpgradeFinding{
+			RemovedAPI: api,
+			Source:     SourceRelease,
+			Namespace:  ns,
+			Name:       obj.Metadata.Name,
+			Release:    rlsName,
+		})
+	}
+
+	return findings
+}
+
+// removedBetween returns apis removed after the current version up to the target one.
+func removedBetween(current, target string) (map[string]RemovedAPI, error) {
+	to, err := semver.NewVersion(target)
+	if err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "target version %q", target)
+	}
+	from, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "current version %q", current)
+	}
+	if to.LessThan(from) {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "downgrade from %s to %s", current, target)
+	}
+
+	removed := make(map[string]RemovedAPI)
+	for _, api := range RemovedAPIs {
+		v, err := semver.NewVersion(api.RemovedIn)
+		if err != nil {
+			continue
+		}
+		if !from.LessThan(v) || to.LessThan(v) {
+			continue
+		}
+		removed[apiKey(api.GroupVersion, api.Kind)] = api
+	}
+
+	return removed, nil
+}
+
+func apiKey(groupVersion, kind string) string {
+	return groupVersion + "/" + kind
+}
@@ -0,0 +1,299 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+	"github.com/supergiant/control/pkg/testutils"
+)
+
+const deprecatedManifest = `---
+# Source: web/templates/deployment.yaml
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+  namespace: public
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func TestRemovedBetween(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		current     string
+		target      string
+		expected    []string
+		unexpected  []string
+		expectedErr error
+	}{
+		{
+			name:        "invalid target",
+			current:     "1.15.3",
+			target:      "latest",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "downgrade",
+			current:     "1.16.1",
+			target:      "1.15.3",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:       "patch upgrade",
+			current:    "1.15.1",
+			target:     "1.15.3",
+			unexpected: []string{"extensions/v1beta1/Deployment"},
+		},
+		{
+			name:       "minor upgrade",
+			current:    "1.15.1",
+			target:     "1.16.0",
+			expected:   []string{"extensions/v1beta1/Deployment", "apps/v1beta2/StatefulSet"},
+			unexpected: []string{"extensions/v1beta1/Ingress"},
+		},
+		{
+			name:       "removed before current",
+			current:    "1.21.2",
+			target:     "1.22.0",
+			expected:   []string{"extensions/v1beta1/Ingress"},
+			unexpected: []string{"extensions/v1beta1/Deployment", "batch/v1beta1/CronJob"},
+		},
+	} {
+		removed, err := removedBetween(tc.current, tc.target)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+
+		for _, key := range tc.expected {
+			require.Contains(t, removed, key, "TC: %s", tc.name)
+		}
+		for _, key := range tc.unexpected {
+			require.NotContains(t, removed, key, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestManifestFindings(t *testing.T) {
+	removed, err := removedBetween("1.15.0", "1.22.0")
+	require.NoError(t, err)
+
+	findings := manifestFindings("web", "default", deprecatedManifest, removed)
+	require.Len(t, findings, 2)
+
+	byKind := map[string]UpgradeFinding{}
+	for _, f := range findings {
+		byKind[f.Kind] = f
+	}
+	require.Equal(t, "default", byKind["Deployment"].Namespace)
+	require.Equal(t, "apps/v1", byKind["Deployment"].Replacement)
+	require.Equal(t, "public", byKind["Ingress"].Namespace)
+	require.Equal(t, "web", byKind["Ingress"].Release)
+	require.Equal(t, SourceRelease, byKind["Ingress"].Source)
+}
+
+// fakeGroupClient serves a list of deployments, one of them applied with
+// a removed api version.
+func fakeGroupClient(t *testing.T) (func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error), func()) {
+	applied := func(apiVersion string) string {
+		raw, _ := json.Marshal(map[string]string{"apiVersion": apiVersion, "kind": "Deployment"})
+		return string(raw)
+	}
+	items := []map[string]interface{}{
+		{"metadata": metav1.ObjectMeta{Name: "old", Namespace: "default",
+			Annotations: map[string]string{lastAppliedAnnotation: applied("extensions/v1beta1")}}},
+		{"metadata": metav1.ObjectMeta{Name: "new", Namespace: "default",
+			Annotations: map[string]string{lastAppliedAnnotation: applied("apps/v1")}}},
+		{"metadata": metav1.ObjectMeta{Name: "unknown", Namespace: "default"}},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/extensions/v1beta1/deployments" {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"items": items}))
+	}))
+
+	return func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error) {
+		cfg := &rest.Config{
+			Host: srv.URL,
+			ContentConfig: rest.ContentConfig{
+				NegotiatedSerializer: serializer.DirectCodecFactory{CodecFactory: scheme.Codecs},
+			},
+		}
+		setGroupDefaults(cfg, gv)
+		return rest.RESTClientFor(cfg)
+	}, srv.Close
+}
+
+func TestService_UpgradeCheck(t *testing.T) {
+	kubeData, _ := json.Marshal(&model.Kube{ID: "kube", K8SVersion: "1.15.3"})
+	clientForGroupFn, closeFn := fakeGroupClient(t)
+	defer closeFn()
+
+	discovery := &mockServerResourceGetter{
+		resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "extensions/v1beta1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", Kind: "Deployment"},
+					{Name: "deployments/scale", Kind: "Scale"},
+				},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", Kind: "Deployment"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name             string
+		version          string
+		helmErr          error
+		expectedErr      error
+		expectedBlockers int
+		expectedErrors   int
+	}{
+		{
+			name:        "invalid version",
+			version:     "1.x",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:             "no removed apis",
+			version:          "1.15.9",
+			expectedBlockers: 0,
+		},
+		{
+			name:             "blockers",
+			version:          "1.16.0",
+			expectedBlockers: 2,
+		},
+		{
+			name:             "helm error",
+			version:          "1.16.0",
+			helmErr:          errFake,
+			expectedBlockers: 1,
+			expectedErrors:   1,
+		},
+	} {
+		repo := new(testutils.MockStorage)
+		repo.On("Get", mock.Anything, mock.Anything, mock.Anything).
+			Return(kubeData, nil)
+
+		svc := Service{
+			storage: repo,
+			discoveryClientFn: func(k *model.Kube) (ServerResourceGetter, error) {
+				return discovery, nil
+			},
+			clientForGroupFn: clientForGroupFn,
+			newHelmProxyFn: func(k *model.Kube) (proxy.Interface, error) {
+				return &fakeHelmProxy{
+					err: tc.helmErr,
+					listReleaseResp: &services.ListReleasesResponse{
+						Releases: []*release.Release{
+							{Name: "web", Namespace: "default", Manifest: deprecatedManifest},
+						},
+					},
+				}, nil
+			},
+		}
+
+		report, err := svc.UpgradeCheck(context.Background(), "kube", tc.version)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Len(t, report.Blockers, tc.expectedBlockers, "TC: %s", tc.name)
+		require.Len(t, report.Errors, tc.expectedErrors, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedBlockers == 0 && tc.expectedErrors == 0, report.Ready, "TC: %s", tc.name)
+		if tc.expectedBlockers > 0 {
+			require.Len(t, report.Served, 1, "TC: %s", tc.name)
+			require.Equal(t, SourceCluster, report.Blockers[0].Source, "TC: %s", tc.name)
+			require.Equal(t, "old", report.Blockers[0].Name, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_checkUpgrade(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		query        string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "no version",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid version",
+			query:        "?version=abc",
+			svcErr:       errors.Wrap(sgerrors.ErrInvalidJson, "target version"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			query:        "?version=1.16.0",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			query:        "?version=1.16.0",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			query:        "?version=1.16.0",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceUpgradeCheck, mock.Anything, "kube", mock.Anything).
+			Return(&UpgradeReport{KubeID: "kube"}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/kubes/kube/upgrade/check%s", tc.query), nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
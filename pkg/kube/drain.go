@@ -0,0 +1,300 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+var (
+	// drainTimeout is how long a drain waits for evictions when the
+	// request doesn't set its own timeout.
+	drainTimeout = 5 * time.Minute
+	// evictions refused by a PodDisruptionBudget are retried with this interval.
+	drainRetryInterval = 5 * time.Second
+)
+
+// DrainOptions tell which pods may be evicted from a node, daemonset and
+// mirror pods are always left on it.
+type DrainOptions struct {
+	// Force evicts pods that aren't managed by a controller,
+	// they won't be recreated.
+	Force bool `json:"force"`
+	// DeleteLocalData evicts pods with emptyDir volumes, the data is lost.
+	DeleteLocalData bool `json:"deleteLocalData"`
+	// GracePeriodSeconds overrides the termination grace period of pods.
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	TimeoutSeconds     int64  `json:"timeoutSeconds"`
+}
+
+// DrainReport lists pods of a drained node as namespace/name.
+type DrainReport struct {
+	Node    string   `json:"node"`
+	Evicted []string `json:"evicted"`
+	Skipped []string `json:"skipped"`
+}
+
+// CordonNode marks the node unschedulable, pods running on it are kept.
+func (s Service) CordonNode(ctx context.Context, kubeID, node string) error {
+	kclient, err := s.nodeClient(ctx, kubeID)
+	if err != nil {
+		return err
+	}
+	return setUnschedulable(kclient, node, true)
+}
+
+// UncordonNode makes the node schedulable again.
+func (s Service) UncordonNode(ctx context.Context, kubeID, node string) error {
+	kclient, err := s.nodeClient(ctx, kubeID)
+	if err != nil {
+		return err
+	}
+	return setUnschedulable(kclient, node, false)
+}
+
+// DrainNode cordons the node and evicts its pods through the eviction api,
+// so PodDisruptionBudgets are respected: evictions they refuse are retried
+// until the timeout. Nothing is evicted when some pods can't be evicted
+// with the options, the node stays cordoned either way.
+func (s Service) DrainNode(ctx context.Context, kubeID, node string, opts DrainOptions) (*DrainReport, error) {
+	if opts.TimeoutSeconds < 0 {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "timeout %d", opts.TimeoutSeconds)
+	}
+	timeout := drainTimeout
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+
+	kclient, err := s.nodeClient(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = setUnschedulable(kclient, node, true); err != nil {
+		return nil, err
+	}
+
+	podList, err := kclient.Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String(),
+	})
+	if err != nil {
+		return nil, resourceError(err, "list pods of node %s", node)
+	}
+
+	report := &DrainReport{
+		Node:    node,
+		Evicted: make([]string, 0),
+		Skipped: make([]string, 0),
+	}
+	pods := make([]corev1.Pod, 0, len(podList.Items))
+	blocked := make([]string, 0)
+	for _, pod := range podList.Items {
+		name := pod.Namespace + "/" + pod.Name
+		if reason := drainBlocker(pod, opts); reason != "" {
+			blocked = append(blocked, fmt.Sprintf("%s (%s)", name, reason))
+			continue
+		}
+		if skipDrain(pod) {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if len(blocked) > 0 {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "pods can't be evicted: %s",
+			strings.Join(blocked, ", "))
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, pod := range pods {
+		if err = evictPod(ctx, kclient, pod, opts.GracePeriodSeconds, time.Until(deadline)); err != nil {
+			return report, err
+		}
+		report.Evicted = append(report.Evicted, pod.Namespace+"/"+pod.Name)
+	}
+
+	for _, pod := range pods {
+		if err = waitPodDeleted(ctx, kclient, pod, time.Until(deadline)); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (s Service) nodeClient(ctx context.Context, kubeID string) (corev1client.CoreV1Interface, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube")
+	}
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube client")
+	}
+	return kclient, nil
+}
+
+func setUnschedulable(kclient corev1client.CoreV1Interface, node string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err := kclient.Nodes().Patch(node, types.StrategicMergePatchType, []byte(patch)); err != nil {
+		return resourceError(err, "patch node %s", node)
+	}
+	return nil
+}
+
+// skipDrain tells whether the pod would be recreated on the node anyway.
+func skipDrain(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return true
+	}
+	owner := metav1.GetControllerOf(&pod)
+	return owner != nil && owner.Kind == "DaemonSet"
+}
+
+// drainBlocker returns why the pod can't be evicted with the options,
+// finished pods are evicted without checks.
+func drainBlocker(pod corev1.Pod, opts DrainOptions) string {
+	if skipDrain(pod) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return ""
+	}
+	if !opts.Force && metav1.GetControllerOf(&pod) == nil {
+		return "not managed by a controller"
+	}
+	if !opts.DeleteLocalData {
+		for _, v := range pod.Spec.Volumes {
+			if v.EmptyDir != nil {
+				return "uses local data"
+			}
+		}
+	}
+	return ""
+}
+
+func evictPod(ctx context.Context, kclient corev1client.CoreV1Interface, pod corev1.Pod,
+	gracePeriod *int64, timeout time.Duration) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			GracePeriodSeconds: gracePeriod,
+		},
+	}
+
+	err := wait.PollImmediate(drainRetryInterval, timeout, func() (bool, error) {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		err := kclient.Pods(pod.Namespace).Evict(eviction)
+		switch {
+		case err == nil, k8serrors.IsNotFound(err):
+			return true, nil
+		case k8serrors.IsTooManyRequests(err):
+			// the disruption budget doesn't allow it yet
+			return false, nil
+		}
+		return false, err
+	})
+	if err == wait.ErrWaitTimeout {
+		err = sgerrors.ErrTimeoutExceeded
+	}
+	if err != nil {
+		return resourceError(err, "evict pod %s/%s", pod.Namespace, pod.Name)
+	}
+	return nil
+}
+
+// waitPodDeleted waits until the pod is deleted, a pod recreated with
+// the same name by a statefulset has another uid.
+func waitPodDeleted(ctx context.Context, kclient corev1client.CoreV1Interface, pod corev1.Pod, timeout time.Duration) error {
+	err := wait.PollImmediate(drainRetryInterval, timeout, func() (bool, error) {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		p, err := kclient.Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return p.UID != pod.UID, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = sgerrors.ErrTimeoutExceeded
+	}
+	if err != nil {
+		return errors.Wrapf(err, "wait for pod %s/%s", pod.Namespace, pod.Name)
+	}
+	return nil
+}
+
+// cordonNode marks the node unschedulable:
+// POST /kubes/{kubeID}/nodes/{nodename}/cordon
+func (h *Handler) cordonNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.svc.CordonNode(r.Context(), vars["kubeID"], vars["nodename"]); err != nil {
+		sendResourceError(w, vars["nodename"], err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uncordonNode makes the node schedulable:
+// POST /kubes/{kubeID}/nodes/{nodename}/uncordon
+func (h *Handler) uncordonNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.svc.UncordonNode(r.Context(), vars["kubeID"], vars["nodename"]); err != nil {
+		sendResourceError(w, vars["nodename"], err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// drainNode evicts pods of the node, the body with DrainOptions is optional:
+// POST /kubes/{kubeID}/nodes/{nodename}/drain
+func (h *Handler) drainNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	opts := DrainOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	report, err := h.svc.DrainNode(r.Context(), vars["kubeID"], vars["nodename"], opts)
+	if err != nil {
+		if sgerrors.IsTimeoutExceeded(err) {
+			message.SendMessage(w, message.New("Pods haven't been evicted in time",
+				err.Error(), sgerrors.TimeoutExceeded, ""), http.StatusGatewayTimeout)
+			return
+		}
+		sendResourceError(w, vars["nodename"], err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,302 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func drainPod(ns, name, ownerKind string) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+			UID:       types.UID(ns + "/" + name),
+		},
+	}
+	if ownerKind != "" {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: name, Controller: &controller}}
+	}
+	return pod
+}
+
+// fakeDrainClient serves pods of the node, the first eviction of a pod in
+// the "budgeted" namespace is refused as a PodDisruptionBudget would do,
+// pods in the "blocked" one are never evicted.
+func fakeDrainClient(pods []corev1.Pod, actions *[]string) func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+	m := sync.Mutex{}
+	evicted := map[string]bool{}
+	refused := map[string]bool{}
+	podsResource := schema.GroupResource{Resource: "pods"}
+
+	return func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		cl := &fakev1client.FakeCoreV1{
+			Fake: &kubetesting.Fake{},
+		}
+		cl.AddReactor("patch", "nodes", func(action kubetesting.Action) (bool, runtime.Object, error) {
+			patch := action.(kubetesting.PatchAction)
+			if patch.GetName() != "node" {
+				return true, nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, patch.GetName())
+			}
+			*actions = append(*actions, "patch "+string(patch.GetPatch()))
+			return true, &corev1.Node{}, nil
+		})
+		cl.AddReactor("list", "pods", func(action kubetesting.Action) (bool, runtime.Object, error) {
+			return true, &corev1.PodList{Items: pods}, nil
+		})
+		cl.AddReactor("create", "pods", func(action kubetesting.Action) (bool, runtime.Object, error) {
+			m.Lock()
+			defer m.Unlock()
+			eviction := action.(kubetesting.CreateAction).GetObject().(*policyv1beta1.Eviction)
+			name := eviction.Namespace + "/" + eviction.Name
+			if eviction.Namespace == "blocked" || (eviction.Namespace == "budgeted" && !refused[name]) {
+				refused[name] = true
+				return true, nil, k8serrors.NewTooManyRequests("disruption budget", 0)
+			}
+			if !evicted[name] {
+				*actions = append(*actions, "evict "+name)
+			}
+			evicted[name] = true
+			return true, nil, nil
+		})
+		cl.AddReactor("get", "pods", func(action kubetesting.Action) (bool, runtime.Object, error) {
+			m.Lock()
+			defer m.Unlock()
+			get := action.(kubetesting.GetAction)
+			if evicted[get.GetNamespace()+"/"+get.GetName()] {
+				return true, nil, k8serrors.NewNotFound(podsResource, get.GetName())
+			}
+			pod := drainPod(get.GetNamespace(), get.GetName(), "")
+			return true, &pod, nil
+		})
+		return cl, nil
+	}
+}
+
+func TestService_CordonNode(t *testing.T) {
+	actions := make([]string, 0)
+	svc := Service{
+		storage:        kubeStorage(&model.Kube{ID: "kube"}),
+		corev1ClientFn: fakeDrainClient(nil, &actions),
+	}
+
+	require.True(t, sgerrors.IsNotFound(svc.CordonNode(context.Background(), "unknown", "node")))
+	require.True(t, sgerrors.IsNotFound(svc.CordonNode(context.Background(), "kube", "lost")))
+	require.NoError(t, svc.CordonNode(context.Background(), "kube", "node"))
+	require.NoError(t, svc.UncordonNode(context.Background(), "kube", "node"))
+	require.Equal(t, []string{
+		`patch {"spec":{"unschedulable":true}}`,
+		`patch {"spec":{"unschedulable":false}}`,
+	}, actions)
+}
+
+func TestService_DrainNode(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		drainTimeout, drainRetryInterval = timeout, interval
+	}(drainTimeout, drainRetryInterval)
+	drainTimeout, drainRetryInterval = 200*time.Millisecond, time.Millisecond
+
+	daemon := drainPod("kube-system", "proxy", "DaemonSet")
+	mirror := drainPod("kube-system", "apiserver", "")
+	mirror.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	finished := drainPod("default", "job", "")
+	finished.Status.Phase = corev1.PodSucceeded
+	cache := drainPod("default", "cache", "ReplicaSet")
+	cache.Spec.Volumes = []corev1.Volume{{
+		Name:         "tmp",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}}
+
+	for _, tc := range []struct {
+		name            string
+		node            string
+		pods            []corev1.Pod
+		opts            DrainOptions
+		expectedErr     error
+		expectedReport  *DrainReport
+		expectedActions []string
+	}{
+		{
+			name:        "invalid timeout",
+			node:        "node",
+			opts:        DrainOptions{TimeoutSeconds: -1},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "node not found",
+			node:        "lost",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:            "unmanaged pod",
+			node:            "node",
+			pods:            []corev1.Pod{drainPod("default", "web", "ReplicaSet"), drainPod("default", "debug", "")},
+			expectedErr:     sgerrors.ErrInvalidJson,
+			expectedActions: []string{`patch {"spec":{"unschedulable":true}}`},
+		},
+		{
+			name:            "local data",
+			node:            "node",
+			pods:            []corev1.Pod{cache},
+			expectedErr:     sgerrors.ErrInvalidJson,
+			expectedActions: []string{`patch {"spec":{"unschedulable":true}}`},
+		},
+		{
+			name:        "disruption budget",
+			node:        "node",
+			pods:        []corev1.Pod{drainPod("blocked", "db", "StatefulSet")},
+			expectedErr: sgerrors.ErrTimeoutExceeded,
+			expectedReport: &DrainReport{
+				Node:    "node",
+				Evicted: []string{},
+				Skipped: []string{},
+			},
+			expectedActions: []string{`patch {"spec":{"unschedulable":true}}`},
+		},
+		{
+			name: "ok",
+			node: "node",
+			pods: []corev1.Pod{daemon, mirror, finished, cache, drainPod("budgeted", "web", "ReplicaSet"), drainPod("default", "debug", "")},
+			opts: DrainOptions{Force: true, DeleteLocalData: true},
+			expectedReport: &DrainReport{
+				Node:    "node",
+				Evicted: []string{"default/job", "default/cache", "budgeted/web", "default/debug"},
+				Skipped: []string{"kube-system/proxy", "kube-system/apiserver"},
+			},
+			expectedActions: []string{
+				`patch {"spec":{"unschedulable":true}}`,
+				"evict default/job",
+				"evict default/cache",
+				"evict budgeted/web",
+				"evict default/debug",
+			},
+		},
+	} {
+		actions := make([]string, 0)
+		svc := Service{
+			storage:        kubeStorage(&model.Kube{ID: "kube"}),
+			corev1ClientFn: fakeDrainClient(tc.pods, &actions),
+		}
+
+		report, err := svc.DrainNode(context.Background(), "kube", tc.node, tc.opts)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedReport, report, "TC: %s", tc.name)
+		if tc.expectedActions == nil {
+			tc.expectedActions = []string{}
+		}
+		require.Equal(t, tc.expectedActions, actions, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_drainNode(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		drainErr     error
+		expectedOpts DrainOptions
+		expectedCode int
+	}{
+		{
+			name:         "invalid body",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			drainErr:     errors.Wrap(sgerrors.ErrNotFound, "patch node"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "blocked",
+			drainErr:     errors.Wrap(sgerrors.ErrInvalidJson, "pods can't be evicted"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "timeout",
+			body:         `{"timeoutSeconds":10}`,
+			drainErr:     errors.Wrap(sgerrors.ErrTimeoutExceeded, "evict"),
+			expectedOpts: DrainOptions{TimeoutSeconds: 10},
+			expectedCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:         "ok",
+			body:         `{"force":true}`,
+			expectedOpts: DrainOptions{Force: true},
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceDrainNode, mock.Anything, "kube", "node", tc.expectedOpts).Return(&DrainReport{Node: "node"}, tc.drainErr)
+
+		router := mux.NewRouter()
+		(&Handler{svc: svc}).Register(router)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kubes/kube/nodes/node/drain", strings.NewReader(tc.body)))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_cordonNode(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		path         string
+		method       string
+		err          error
+		expectedCode int
+	}{
+		{
+			name:         "cordon not found",
+			path:         "/kubes/kube/nodes/node/cordon",
+			method:       serviceCordonNode,
+			err:          errors.Wrap(sgerrors.ErrNotFound, "get kube"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "cordon",
+			path:         "/kubes/kube/nodes/node/cordon",
+			method:       serviceCordonNode,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "uncordon",
+			path:         "/kubes/kube/nodes/node/uncordon",
+			method:       serviceUncordonNode,
+			expectedCode: http.StatusNoContent,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(tc.method, mock.Anything, "kube", "node").Return(tc.err)
+
+		router := mux.NewRouter()
+		(&Handler{svc: svc}).Register(router)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		svc.AssertExpectations(t)
+	}
+}
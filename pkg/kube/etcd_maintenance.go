@@ -0,0 +1,151 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/etcdmaintenance"
+)
+
+// EtcdMaintainer periodically compacts and defragments etcd members
+// of operational clusters to keep database size below the quota.
+type EtcdMaintainer struct {
+	svc            Interface
+	accountService accountGetter
+	repo           storage.Interface
+
+	interval       time.Duration
+	quotaBytes     int64
+	alertThreshold int
+
+	getWriter func(string) (io.WriteCloser, error)
+}
+
+// NewEtcdMaintainer constructs an EtcdMaintainer that runs maintenance every interval.
+func NewEtcdMaintainer(svc Interface, accountService accountGetter,
+	repo storage.Interface, interval time.Duration) *EtcdMaintainer {
+	return &EtcdMaintainer{
+		svc:            svc,
+		accountService: accountService,
+		repo:           repo,
+		interval:       interval,
+		quotaBytes:     etcdmaintenance.DefaultQuotaBytes,
+		alertThreshold: etcdmaintenance.DefaultAlertThreshold,
+		getWriter:      util.GetWriter,
+	}
+}
+
+// Run blocks and maintains operational clusters of all tenants every
+// interval until ctx is cancelled.
+func (m *EtcdMaintainer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.maintainAll(ctx)
+		}
+	}
+}
+
+func (m *EtcdMaintainer) maintainAll(ctx context.Context) {
+	kubes, err := m.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("etcd maintenance: list kubes: %v", err)
+		return
+	}
+
+	for i := range kubes {
+		if kubes[i].State != model.StateOperational || kubes[i].InMaintenance() {
+			continue
+		}
+		ctx := tenant.WithID(ctx, kubes[i].TenantID)
+
+		// maintenance can wait while the account is close to throttling
+		if err := apicalls.Default.Wait(ctx, kubes[i].AccountName); err != nil {
+			return
+		}
+
+		if err := m.Maintain(ctx, &kubes[i]); err != nil {
+			logrus.Errorf("etcd maintenance: cluster %s: %v", kubes[i].ID, err)
+		}
+	}
+}
+
+// Maintain runs etcd maintenance on master nodes one at a time, it stops
+// on the first failed member to keep the rest of the quorum untouched.
+func (m *EtcdMaintainer) Maintain(ctx context.Context, k *model.Kube) error {
+	acc, err := m.accountService.Get(ctx, k.AccountName)
+	if err != nil {
+		return errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+
+	for _, master := range activeMachines(k.Masters) {
+		t, err := workflows.NewTask(workflows.EtcdMaintenance, m.repo)
+		if err != nil {
+			return errors.Wrap(err, "new task")
+		}
+
+		config := &steps.Config{
+			Kube:             *k,
+			Provider:         k.Provider,
+			IsMaster:         true,
+			ClusterID:        k.ID,
+			ClusterName:      k.Name,
+			CloudAccountName: k.AccountName,
+			Node:             *master,
+			EtcdMaintenanceConfig: steps.EtcdMaintenanceConfig{
+				QuotaBytes:     m.quotaBytes,
+				AlertThreshold: m.alertThreshold,
+			},
+		}
+
+		if err := util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+			return errors.Wrap(err, "fill cloud account credentials")
+		}
+
+		if err := m.recordTask(ctx, k.ID, t.ID); err != nil {
+			logrus.Warnf("etcd maintenance: cluster %s: record task %s: %v", k.ID, t.ID, err)
+		}
+
+		writer, err := m.getWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return errors.Wrap(err, "get writer")
+		}
+
+		if err := <-t.Run(ctx, *config, writer); err != nil {
+			return errors.Wrapf(err, "master %s", master.Name)
+		}
+	}
+
+	return nil
+}
+
+// recordTask adds task id to the latest version of kube object.
+func (m *EtcdMaintainer) recordTask(ctx context.Context, kubeID, taskID string) error {
+	k, err := m.svc.Get(ctx, kubeID)
+	if err != nil {
+		return err
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	k.Tasks[workflows.MaintenanceTask] = append(k.Tasks[workflows.MaintenanceTask], taskID)
+
+	return m.svc.Create(ctx, k)
+}
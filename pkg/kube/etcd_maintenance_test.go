@@ -0,0 +1,117 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeStep struct{}
+
+func (fakeStep) Run(context.Context, io.Writer, *steps.Config) error      { return nil }
+func (fakeStep) Rollback(context.Context, io.Writer, *steps.Config) error { return nil }
+func (fakeStep) Name() string                                             { return "fake" }
+func (fakeStep) Description() string                                      { return "" }
+func (fakeStep) Depends() []string                                        { return nil }
+
+func TestEtcdMaintainer_Maintain(t *testing.T) {
+	testCases := []struct {
+		description string
+
+		kube       *model.Kube
+		account    *model.CloudAccount
+		accountErr error
+
+		expectedErr   bool
+		expectedTasks int
+	}{
+		{
+			description: "account error",
+			kube:        &model.Kube{ID: "kube"},
+			accountErr:  errFake,
+			expectedErr: true,
+		},
+		{
+			description: "success",
+			kube: &model.Kube{
+				ID: "kube",
+				Masters: map[string]*model.Machine{
+					"master-1": {
+						Name:  "master-1",
+						State: model.MachineStateActive,
+					},
+					"master-2": {
+						Name:  "master-2",
+						State: model.MachineStateActive,
+					},
+					"master-3": {
+						Name:  "master-3",
+						State: model.MachineStateError,
+					},
+				},
+			},
+			account: &model.CloudAccount{
+				Provider: clouds.DigitalOcean,
+			},
+			expectedTasks: 2,
+		},
+	}
+
+	workflows.Init()
+	workflows.RegisterWorkFlow(workflows.EtcdMaintenance, []steps.Step{fakeStep{}})
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, mock.Anything).
+			Return(tc.kube, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).
+			Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(tc.account, tc.accountErr)
+
+		mockRepo := new(testutils.MockStorage)
+		mockRepo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+
+		m := NewEtcdMaintainer(svc, accService, mockRepo, 0)
+		m.getWriter = func(string) (io.WriteCloser, error) {
+			return &bufferCloser{}, nil
+		}
+
+		err := m.Maintain(context.Background(), tc.kube)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.description, err)
+		require.Len(t, tc.kube.Tasks[workflows.MaintenanceTask], tc.expectedTasks)
+	}
+}
+
+func TestEtcdMaintainer_maintainAll(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{
+		{ID: "kube", TenantID: "acme", State: model.StateOperational},
+		{ID: "provisioning", State: model.StateProvisioning},
+	}, nil)
+
+	accService := new(accServiceMock)
+	accService.On("Get", mock.MatchedBy(func(ctx context.Context) bool {
+		return tenant.FromContext(ctx) == "acme"
+	}), mock.Anything).Return(nil, errFake).Once()
+
+	m := NewEtcdMaintainer(svc, accService, new(testutils.MockStorage), 0)
+	m.maintainAll(context.Background())
+
+	accService.AssertExpectations(t)
+}
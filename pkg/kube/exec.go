@@ -0,0 +1,425 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	// execProtocol is the remotecommand protocol of kubelets, it reports
+	// exit codes of commands and supports terminal resizing.
+	execProtocol = "v4.channel.k8s.io"
+
+	execNonZeroExitCode metav1.StatusReason = "NonZeroExitCode"
+	execExitCodeCause   metav1.CauseType    = "ExitCode"
+
+	// channels of exec websocket messages, the first byte of a message
+	// is its channel as in the channel.k8s.io protocol of api servers
+	execChannelStdin  = 0
+	execChannelStdout = 1
+	execChannelStderr = 2
+	execChannelError  = 3
+	execChannelResize = 4
+
+	execWriteTimeout = 10 * time.Second
+)
+
+// ExecOptions select a command to run in a container, a command run in
+// a TTY has its stderr merged into stdout.
+type ExecOptions struct {
+	Container string
+	Command   []string
+	TTY       bool
+}
+
+// TerminalSize is a size of the terminal of a command run in a TTY.
+type TerminalSize struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+// ExecStreams are connected to the command, nil streams aren't opened,
+// Resize is only used with a TTY.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	Resize <-chan TerminalSize
+}
+
+// ExitError is returned when the command exits with a non-zero code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d", e.Code)
+}
+
+// ExecResult is sent on the error channel of an exec websocket when the
+// command is done, Message is empty if it has succeeded.
+type ExecResult struct {
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message,omitempty"`
+}
+
+func spdyDialer(k *model.Kube, u *url.URL) (httpstream.Dialer, error) {
+	cfg, err := NewConfigFor(k)
+	if err != nil {
+		return nil, err
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "build spdy round tripper")
+	}
+	return spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u), nil
+}
+
+// ExecInPod runs the command in a container of the pod and blocks until it
+// exits or ctx is done, a non-zero exit code is returned as *ExitError.
+func (s Service) ExecInPod(ctx context.Context, kubeID, ns, pod string, opts ExecOptions, streams ExecStreams) error {
+	if s.corev1ClientFn == nil || s.execDialerFn == nil {
+		return errors.Wrap(sgerrors.ErrNilEntity, "exec client builder")
+	}
+	if len(opts.Command) == 0 {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "command is empty")
+	}
+
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return errors.Wrap(err, "get kube")
+	}
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	execOpts := &corev1.PodExecOptions{
+		Container: opts.Container,
+		Command:   opts.Command,
+		Stdin:     streams.Stdin != nil,
+		Stdout:    streams.Stdout != nil,
+		Stderr:    streams.Stderr != nil && !opts.TTY,
+		TTY:       opts.TTY,
+	}
+	u := kclient.RESTClient().Post().Resource("pods").Namespace(ns).Name(pod).SubResource("exec").
+		VersionedParams(execOpts, scheme.ParameterCodec).URL()
+
+	dialer, err := s.execDialerFn(k, u)
+	if err != nil {
+		return errors.Wrap(err, "get exec dialer")
+	}
+	conn, _, err := dialer.Dial(execProtocol)
+	if err != nil {
+		return resourceError(err, "exec in %s/%s", ns, pod)
+	}
+	defer conn.Close()
+
+	// the kubelet doesn't notice a cancelled request of a hijacked connection
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	return execStreams(conn, execOpts, streams)
+}
+
+// execStreams opens streams of the command in the order kubelets expect
+// them and returns the status reported on the error stream.
+func execStreams(conn httpstream.Connection, opts *corev1.PodExecOptions, streams ExecStreams) error {
+	create := func(streamType string) (httpstream.Stream, error) {
+		headers := http.Header{}
+		headers.Set(corev1.StreamType, streamType)
+		stream, err := conn.CreateStream(headers)
+		return stream, errors.Wrapf(err, "create %s stream", streamType)
+	}
+
+	errStream, err := create(corev1.StreamTypeError)
+	if err != nil {
+		return err
+	}
+	// nothing is sent on the error stream
+	errStream.Close()
+	status := make(chan error, 1)
+	go func() {
+		status <- execStatus(errStream)
+	}()
+
+	if opts.Stdin {
+		stdin, err := create(corev1.StreamTypeStdin)
+		if err != nil {
+			return err
+		}
+		go func() {
+			io.Copy(stdin, streams.Stdin)
+			// the command gets EOF on its stdin
+			stdin.Close()
+		}()
+	}
+
+	wg := sync.WaitGroup{}
+	for _, out := range []struct {
+		streamType string
+		enabled    bool
+		w          io.Writer
+	}{
+		{corev1.StreamTypeStdout, opts.Stdout, streams.Stdout},
+		{corev1.StreamTypeStderr, opts.Stderr, streams.Stderr},
+	} {
+		if !out.enabled {
+			continue
+		}
+		stream, err := create(out.streamType)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			io.Copy(w, stream)
+		}(out.w)
+	}
+
+	if opts.TTY {
+		resize, err := create(corev1.StreamTypeResize)
+		if err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			defer resize.Close()
+			enc := json.NewEncoder(resize)
+			for {
+				select {
+				case size, ok := <-streams.Resize:
+					if !ok {
+						return
+					}
+					if err := enc.Encode(size); err != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return <-status
+}
+
+// execStatus reads the status of the exited command.
+func execStatus(errStream io.Reader) error {
+	raw, err := ioutil.ReadAll(errStream)
+	if err != nil {
+		return errors.Wrap(err, "read error stream")
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	status := metav1.Status{}
+	if err = json.Unmarshal(raw, &status); err != nil {
+		return errors.Wrapf(err, "unmarshal status %q", raw)
+	}
+	if status.Status == metav1.StatusSuccess {
+		return nil
+	}
+	if status.Reason == execNonZeroExitCode && status.Details != nil {
+		for _, cause := range status.Details.Causes {
+			if cause.Type != execExitCodeCause {
+				continue
+			}
+			code, err := strconv.Atoi(cause.Message)
+			if err != nil {
+				return errors.Wrapf(err, "exit code %q", cause.Message)
+			}
+			return &ExitError{Code: code}
+		}
+	}
+	return errors.New(status.Message)
+}
+
+// execConn writes output of the command to a websocket, every write is
+// a message on the channel.
+type execConn struct {
+	mu sync.Mutex
+	c  *websocket.Conn
+}
+
+func (e *execConn) send(channel byte, b []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.c.SetWriteDeadline(time.Now().Add(execWriteTimeout))
+	return e.c.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, b...))
+}
+
+type execWriter struct {
+	conn    *execConn
+	channel byte
+}
+
+func (w execWriter) Write(b []byte) (int, error) {
+	if err := w.conn.send(w.channel, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// execInPod runs a command in a container and connects it to a websocket:
+// GET /kubes/{kubeID}/pods/{namespace}/{pod}/exec?container=app&command=sh&tty=true
+// binary messages start with a channel byte: 0 stdin, 1 stdout, 2 stderr,
+// 3 ExecResult json and 4 TerminalSize json, the socket is closed when the
+// command exits.
+func (h *Handler) execInPod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, ns, pod := vars["kubeID"], vars["namespace"], vars["pod"]
+
+	q := r.URL.Query()
+	opts := ExecOptions{
+		Container: q.Get("container"),
+		Command:   q["command"],
+	}
+	if len(opts.Command) == 0 {
+		message.SendValidationFailed(w, errors.Wrap(sgerrors.ErrInvalidJson, "command is empty"))
+		return
+	}
+	if s := q.Get("tty"); s != "" {
+		tty, err := strconv.ParseBool(s)
+		if err != nil {
+			message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "tty %q", s))
+			return
+		}
+		opts.TTY = tty
+	}
+
+	c, err := execUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("kube %s: exec in %s/%s: upgrade connection: %v", kubeID, ns, pod, err)
+		return
+	}
+	defer c.Close()
+	conn := &execConn{c: c}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stdin, stdinWriter := io.Pipe()
+	resize := make(chan TerminalSize, 1)
+	go func() {
+		defer cancel()
+		defer stdinWriter.Close()
+		defer close(resize)
+		readExecInput(ctx, c, stdinWriter, resize)
+	}()
+
+	streams := ExecStreams{
+		Stdin:  stdin,
+		Stdout: execWriter{conn: conn, channel: execChannelStdout},
+		Stderr: execWriter{conn: conn, channel: execChannelStderr},
+		Resize: resize,
+	}
+	err = h.svc.ExecInPod(ctx, kubeID, ns, pod, opts, streams)
+	// the stdin copy is blocked on the pipe until it's closed
+	stdin.Close()
+
+	if _, ok := errors.Cause(err).(*ExitError); err != nil && !ok {
+		logrus.Warnf("kube %s: exec in %s/%s: %v", kubeID, ns, pod, err)
+	}
+	conn.close(execResult(err), "command has exited")
+}
+
+var execUpgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// readExecInput copies stdin messages of the websocket to stdin and sends
+// resize messages to resize until the socket is closed or ctx is done.
+func readExecInput(ctx context.Context, c *websocket.Conn, stdin io.Writer, resize chan<- TerminalSize) {
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case execChannelStdin:
+			if _, err = stdin.Write(msg[1:]); err != nil {
+				return
+			}
+		case execChannelResize:
+			size := TerminalSize{}
+			if err = json.Unmarshal(msg[1:], &size); err != nil {
+				logrus.Debugf("exec: resize %q: %v", msg[1:], err)
+				continue
+			}
+			select {
+			case resize <- size:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// execResult reports err of a command, errors other than exit codes
+// have the exit code 1.
+func execResult(err error) ExecResult {
+	result := ExecResult{}
+	if err != nil {
+		result.ExitCode, result.Message = 1, err.Error()
+		if exitErr, ok := errors.Cause(err).(*ExitError); ok {
+			result.ExitCode = exitErr.Code
+		}
+	}
+	return result
+}
+
+// close sends the result on the error channel and closes the socket.
+func (e *execConn) close(result ExecResult, reason string) {
+	raw, _ := json.Marshal(result)
+	if err := e.send(execChannelError, raw); err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.c.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+		time.Now().Add(execWriteTimeout))
+}
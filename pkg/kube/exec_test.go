@@ -0,0 +1,276 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	spdystream "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+// fakeKubelet runs commands of the web pod, stdin is echoed to stdout with
+// the terminal size, "fail" is written to stderr and exits with code 3.
+func fakeKubelet(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/pods/web/exec" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			require.NoError(t, json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			}))
+			return
+		}
+
+		q := r.URL.Query()
+		expected := 1
+		for _, opt := range []string{"stdin", "stdout", "stderr", "tty"} {
+			if q.Get(opt) == "true" {
+				expected++
+			}
+		}
+
+		_, err := httpstream.Handshake(r, w, []string{execProtocol})
+		require.NoError(t, err)
+		created := make(chan httpstream.Stream, expected)
+		conn := spdystream.NewResponseUpgrader().UpgradeResponse(w, r,
+			func(s httpstream.Stream, replySent <-chan struct{}) error {
+				created <- s
+				return nil
+			})
+		require.NotNil(t, conn)
+		defer conn.Close()
+
+		streams := make(map[string]httpstream.Stream, expected)
+		for i := 0; i < expected; i++ {
+			s := <-created
+			streams[s.Headers().Get(corev1.StreamType)] = s
+		}
+
+		out := &bytes.Buffer{}
+		if resize, ok := streams[corev1.StreamTypeResize]; ok {
+			size := TerminalSize{}
+			require.NoError(t, json.NewDecoder(resize).Decode(&size))
+			out.WriteString(strconv.Itoa(int(size.Width)) + "x" + strconv.Itoa(int(size.Height)) + " ")
+		}
+		stdin, err := ioutil.ReadAll(streams[corev1.StreamTypeStdin])
+		require.NoError(t, err)
+		out.Write(stdin)
+		streams[corev1.StreamTypeStdout].Write(out.Bytes())
+
+		status := metav1.Status{Status: metav1.StatusSuccess}
+		if string(stdin) == "fail" {
+			streams[corev1.StreamTypeStderr].Write([]byte("failed"))
+			status = metav1.Status{
+				Status: metav1.StatusFailure,
+				Reason: execNonZeroExitCode,
+				Details: &metav1.StatusDetails{
+					Causes: []metav1.StatusCause{{Type: execExitCodeCause, Message: "3"}},
+				},
+			}
+		}
+		raw, err := json.Marshal(status)
+		require.NoError(t, err)
+		streams[corev1.StreamTypeError].Write(raw)
+
+		for _, s := range streams {
+			s.Close()
+		}
+		select {
+		case <-conn.CloseChan():
+		case <-time.After(time.Second):
+		}
+	}))
+}
+
+func TestService_ExecInPod(t *testing.T) {
+	srv := fakeKubelet(t)
+	defer srv.Close()
+
+	clients := fakeClusterClients(map[string]*fakeAPIServer{"kube": {Server: srv}})
+	svc := Service{
+		storage: kubeStorage(&model.Kube{ID: "kube"}),
+		corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+			restClient, err := clients(k, schema.GroupVersion{Version: "v1"})
+			if err != nil {
+				return nil, err
+			}
+			return corev1client.New(restClient), nil
+		},
+		execDialerFn: func(k *model.Kube, u *url.URL) (httpstream.Dialer, error) {
+			transport, upgrader, err := spdy.RoundTripperFor(&rest.Config{Host: srv.URL})
+			if err != nil {
+				return nil, err
+			}
+			return spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u), nil
+		},
+	}
+
+	for _, tc := range []struct {
+		name           string
+		pod            string
+		command        []string
+		tty            bool
+		stdin          string
+		expectedErr    error
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:        "no command",
+			pod:         "web",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "pod not found",
+			pod:         "db",
+			command:     []string{"cat"},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:           "ok",
+			pod:            "web",
+			command:        []string{"cat"},
+			stdin:          "hello",
+			expectedStdout: "hello",
+		},
+		{
+			name:           "exit code",
+			pod:            "web",
+			command:        []string{"cat"},
+			stdin:          "fail",
+			expectedErr:    &ExitError{Code: 3},
+			expectedStdout: "fail",
+			expectedStderr: "failed",
+		},
+		{
+			name:           "tty",
+			pod:            "web",
+			command:        []string{"sh"},
+			tty:            true,
+			stdin:          "ls",
+			expectedStdout: "80x24 ls",
+		},
+	} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		resize := make(chan TerminalSize, 1)
+		resize <- TerminalSize{Width: 80, Height: 24}
+
+		err := svc.ExecInPod(context.Background(), "kube", "default", tc.pod,
+			ExecOptions{Command: tc.command, TTY: tc.tty},
+			ExecStreams{
+				Stdin:  strings.NewReader(tc.stdin),
+				Stdout: stdout,
+				Stderr: stderr,
+				Resize: resize,
+			})
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedStdout, stdout.String(), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedStderr, stderr.String(), "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_execInPod(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		query          string
+		execErr        error
+		expectedCode   int
+		expectedResult ExecResult
+	}{
+		{
+			name:         "no command",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid tty",
+			query:        "command=sh&tty=maybe",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:           "exit code",
+			query:          "command=sh&tty=true",
+			execErr:        &ExitError{Code: 2},
+			expectedCode:   http.StatusSwitchingProtocols,
+			expectedResult: ExecResult{ExitCode: 2, Message: "command terminated with exit code 2"},
+		},
+		{
+			name:           "failed",
+			query:          "command=sh",
+			execErr:        sgerrors.ErrNotFound,
+			expectedCode:   http.StatusSwitchingProtocols,
+			expectedResult: ExecResult{ExitCode: 1, Message: sgerrors.ErrNotFound.Error()},
+		},
+		{
+			name:         "ok",
+			query:        "container=app&command=sh&command=-c&command=ls",
+			expectedCode: http.StatusSwitchingProtocols,
+		},
+	} {
+		svc := &kubeServiceMock{
+			exec: func(streams ExecStreams) {
+				stdin := make([]byte, 2)
+				_, err := streams.Stdin.Read(stdin)
+				require.NoError(t, err)
+				streams.Stdout.Write(stdin)
+			},
+		}
+		svc.On(serviceExecInPod, mock.Anything, "kube", "default", "web", mock.Anything).Return(tc.execErr)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+		srv := httptest.NewServer(router)
+
+		u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/kubes/kube/pods/default/web/exec?" + tc.query
+		c, resp, err := websocket.DefaultDialer.Dial(u, nil)
+		require.Equal(t, tc.expectedCode, resp.StatusCode, "TC: %s", tc.name)
+		if err != nil {
+			srv.Close()
+			continue
+		}
+
+		require.NoError(t, c.WriteMessage(websocket.BinaryMessage, []byte{execChannelStdin, 'l', 's'}), "TC: %s", tc.name)
+		_, msg, err := c.ReadMessage()
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, []byte{execChannelStdout, 'l', 's'}, msg, "TC: %s", tc.name)
+
+		_, msg, err = c.ReadMessage()
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, byte(execChannelError), msg[0], "TC: %s", tc.name)
+		result := ExecResult{}
+		require.NoError(t, json.Unmarshal(msg[1:], &result), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedResult, result, "TC: %s", tc.name)
+
+		_, _, err = c.ReadMessage()
+		require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "TC: %s", tc.name)
+
+		c.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/provider"
+)
+
+func validateFirewallRules(rules []model.FirewallRule) error {
+	for i, rule := range rules {
+		switch rule.Role {
+		case "", model.RoleMaster, model.RoleNode:
+		default:
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "rule %d: unknown role %s", i, rule.Role)
+		}
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "rule %d: protocol must be tcp or udp", i)
+		}
+		if rule.FromPort < 1 || rule.ToPort > 65535 || rule.FromPort > rule.ToPort {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "rule %d: invalid port range %d-%d",
+				i, rule.FromPort, rule.ToPort)
+		}
+		if len(rule.CIDRs) == 0 {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "rule %d: cidrs are required", i)
+		}
+		for _, cidr := range rule.CIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return errors.Wrapf(sgerrors.ErrInvalidJson, "rule %d: invalid cidr %s", i, cidr)
+			}
+		}
+	}
+	return nil
+}
+
+// getFirewall returns firewall rules applied to the cluster.
+func (h *Handler) getFirewall(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	rules := k.FirewallRules
+	if rules == nil {
+		rules = []model.FirewallRule{}
+	}
+	if err = json.NewEncoder(w).Encode(rules); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// updateFirewall replaces firewall rules of the cluster, e.g. opens a node port
+// range or the api server to a list of cidrs. Rules are recorded on the cluster
+// once the task has applied them.
+func (h *Handler) updateFirewall(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	rules := make([]model.FirewallRule, 0)
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if err := validateFirewallRules(rules); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	if !provider.FirewallSupported(k.Provider) {
+		message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrUnsupportedProvider,
+			"firewall of %s clusters", k.Provider))
+		return
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, k.AccountName, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	config := &steps.Config{
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		FirewallConfig: steps.FirewallConfig{
+			Rules:   rules,
+			Applied: k.FirewallRules,
+		},
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if err = util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	t, err := workflows.NewTask(workflows.UpdateFirewall, h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	writer, err := h.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	k.Tasks[workflows.FirewallTask] = append(k.Tasks[workflows.FirewallTask], t.ID)
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	ctx := tenant.Detach(r.Context())
+	errChan := t.Run(ctx, *config, writer)
+	go h.recordFirewall(ctx, kubeID, rules, errChan)
+
+	workflows.SendAccepted(w, t.ID, t.ID)
+}
+
+func (h *Handler) recordFirewall(ctx context.Context, kubeID string, rules []model.FirewallRule, errChan chan error) {
+	if err := <-errChan; err != nil {
+		logrus.Errorf("update firewall of cluster %s caused %v", kubeID, err)
+		return
+	}
+
+	k, err := h.svc.Get(ctx, kubeID)
+	if err != nil {
+		logrus.Errorf("update firewall of cluster %s: get kube: %v", kubeID, err)
+		return
+	}
+
+	k.FirewallRules = rules
+	if err = h.svc.Create(ctx, k); err != nil {
+		logrus.Errorf("update firewall of cluster %s: save kube: %v", kubeID, err)
+	}
+}
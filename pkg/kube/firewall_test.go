@@ -0,0 +1,204 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestValidateFirewallRules(t *testing.T) {
+	valid := model.FirewallRule{
+		Protocol: "tcp",
+		FromPort: 30000,
+		ToPort:   32767,
+		CIDRs:    []string{"10.0.0.0/8"},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(*model.FirewallRule)
+		hasErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(*model.FirewallRule) {},
+		},
+		{
+			name:   "unknown role",
+			modify: func(r *model.FirewallRule) { r.Role = "etcd" },
+			hasErr: true,
+		},
+		{
+			name:   "unknown protocol",
+			modify: func(r *model.FirewallRule) { r.Protocol = "-1" },
+			hasErr: true,
+		},
+		{
+			name:   "reversed ports",
+			modify: func(r *model.FirewallRule) { r.FromPort, r.ToPort = 443, 80 },
+			hasErr: true,
+		},
+		{
+			name:   "no cidrs",
+			modify: func(r *model.FirewallRule) { r.CIDRs = nil },
+			hasErr: true,
+		},
+		{
+			name:   "invalid cidr",
+			modify: func(r *model.FirewallRule) { r.CIDRs = []string{"10.0.0.1"} },
+			hasErr: true,
+		},
+	} {
+		rule := valid
+		tc.modify(&rule)
+
+		err := validateFirewallRules([]model.FirewallRule{rule})
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+	}
+}
+
+func TestHandler_updateFirewall(t *testing.T) {
+	rules := []model.FirewallRule{
+		{
+			Role:     model.RoleMaster,
+			Protocol: "tcp",
+			FromPort: 443,
+			ToPort:   443,
+			CIDRs:    []string{"203.0.113.0/24"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		rules   []model.FirewallRule
+		kube    *model.Kube
+		kubeErr error
+		accErr  error
+
+		expectedCode int
+	}{
+		{
+			name:         "invalid rules",
+			rules:        []model.FirewallRule{{Protocol: "tcp"}},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			rules:        rules,
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unsupported provider",
+			rules:        rules,
+			kube:         &model.Kube{ID: "kube", Provider: clouds.DigitalOcean},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "account error",
+			rules:        rules,
+			kube:         &model.Kube{ID: "kube", Provider: clouds.AWS},
+			accErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "accepted",
+			rules:        rules,
+			kube:         &model.Kube{ID: "kube", Provider: clouds.AWS},
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.UpdateFirewall, []steps.Step{})
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, tc.kubeErr)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(&model.CloudAccount{Provider: clouds.AWS}, tc.accErr)
+
+		mockRepo := new(testutils.MockStorage)
+		mockRepo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+
+		h := Handler{
+			svc:            svc,
+			accountService: accService,
+			repo:           mockRepo,
+			getWriter: func(string) (io.WriteCloser, error) {
+				return &bufferCloser{}, nil
+			},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/firewall", h.updateFirewall)
+
+		body, _ := json.Marshal(tc.rules)
+		req := httptest.NewRequest(http.MethodPut, "/kubes/kube/firewall", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusAccepted {
+			continue
+		}
+
+		var taskID string
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&taskID))
+		require.Equal(t, []string{taskID}, tc.kube.Tasks[workflows.FirewallTask])
+	}
+}
+
+func TestHandler_recordFirewall(t *testing.T) {
+	rules := []model.FirewallRule{{Protocol: "udp", FromPort: 53, ToPort: 53, CIDRs: []string{"0.0.0.0/0"}}}
+
+	for _, tc := range []struct {
+		name    string
+		taskErr error
+		saved   bool
+	}{
+		{
+			name:    "task failed",
+			taskErr: errors.New("denied"),
+		},
+		{
+			name:  "applied",
+			saved: true,
+		},
+	} {
+		k := &model.Kube{ID: "kube"}
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		errChan := make(chan error, 1)
+		errChan <- tc.taskErr
+
+		h := Handler{svc: svc}
+		h.recordFirewall(context.Background(), "kube", rules, errChan)
+
+		if tc.saved {
+			require.Equal(t, rules, k.FirewallRules, tc.name)
+			svc.AssertCalled(t, serviceCreate, mock.Anything, k)
+		} else {
+			svc.AssertNotCalled(t, serviceCreate, mock.Anything, mock.Anything)
+		}
+	}
+}
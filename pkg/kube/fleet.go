@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+)
+
+// default number of clusters queried at the same time
+const defaultFleetConcurrency = 8
+
+// ReleaseFilter narrows down the fleet release listing,
+// empty fields match everything.
+type ReleaseFilter struct {
+	KubeIDs      []string
+	Namespace    string
+	Chart        string
+	ChartVersion string
+}
+
+// ClusterReleases are releases of a single cluster. Error is set
+// when the cluster couldn't be queried, it doesn't fail the whole listing.
+type ClusterReleases struct {
+	KubeID   string               `json:"kubeId"`
+	KubeName string               `json:"kubeName"`
+	Releases []*model.ReleaseInfo `json:"releases"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// SetFleetConcurrency changes the number of clusters queried at the same time,
+// zero restores the default.
+func (s *Service) SetFleetConcurrency(n int) {
+	if s.fleetConcurrency != nil {
+		atomic.StoreInt32(s.fleetConcurrency, int32(n))
+	}
+}
+
+// FleetConcurrency returns the number of clusters queried at the same time.
+func (s Service) FleetConcurrency() int {
+	if s.fleetConcurrency != nil {
+		if n := atomic.LoadInt32(s.fleetConcurrency); n > 0 {
+			return int(n)
+		}
+	}
+	return defaultFleetConcurrency
+}
+
+// ListFleetReleases lists releases of all operational clusters concurrently.
+func (s Service) ListFleetReleases(ctx context.Context, filter ReleaseFilter) ([]ClusterReleases, error) {
+	kubes, err := s.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	wanted := make(map[string]bool, len(filter.KubeIDs))
+	for _, id := range filter.KubeIDs {
+		wanted[id] = true
+	}
+
+	selected := make([]model.Kube, 0, len(kubes))
+	for _, k := range kubes {
+		if k.State != model.StateOperational {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[k.ID] {
+			continue
+		}
+		selected = append(selected, k)
+	}
+
+	out := make([]ClusterReleases, len(selected))
+	sem := make(chan struct{}, s.FleetConcurrency())
+	wg := sync.WaitGroup{}
+
+	for i := range selected {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out[i] = s.clusterReleases(ctx, selected[i], filter)
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].KubeName < out[j].KubeName
+	})
+
+	return out, nil
+}
+
+func (s Service) clusterReleases(ctx context.Context, k model.Kube, filter ReleaseFilter) ClusterReleases {
+	res := ClusterReleases{
+		KubeID:   k.ID,
+		KubeName: k.Name,
+		Releases: make([]*model.ReleaseInfo, 0),
+	}
+
+	kprx, err := s.helmClient(&k)
+	if err != nil {
+		res.Error = errors.Wrap(err, "build helm proxy").Error()
+		return res
+	}
+
+	releases, err := listReleases(kprx, filter.Namespace, "", 0)
+	if err != nil {
+		logrus.Warnf("helm: list releases: %s cluster: %v", k.ID, err)
+		res.Error = err.Error()
+		return res
+	}
+
+	for _, rls := range releases {
+		if filter.Chart != "" && rls.Chart != filter.Chart {
+			continue
+		}
+		if filter.ChartVersion != "" && rls.ChartVersion != filter.ChartVersion {
+			continue
+		}
+		res.Releases = append(res.Releases, rls)
+	}
+
+	return res
+}
+
+// listFleetReleases answers where a chart is installed across clusters:
+// GET /kubes/releases?kubeID=a,b&chart=nginx&version=1.0.0&namespace=default
+func (h *Handler) listFleetReleases(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := ReleaseFilter{
+		Namespace:    q.Get("namespace"),
+		Chart:        q.Get("chart"),
+		ChartVersion: q.Get("version"),
+	}
+	for _, ids := range q["kubeID"] {
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				filter.KubeIDs = append(filter.KubeIDs, id)
+			}
+		}
+	}
+
+	releases, err := h.svc.ListFleetReleases(r.Context(), filter)
+	if err != nil {
+		logrus.Errorf("helm: list fleet releases: %s", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(releases); err != nil {
+		logrus.Errorf("helm: list fleet releases: write response: %s", err)
+		message.SendUnknownError(w, err)
+	}
+}
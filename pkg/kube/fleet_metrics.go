@@ -0,0 +1,284 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/util"
+)
+
+const (
+	fleetNodesQuery = `count(kube_node_info)`
+	fleetPodsQuery  = `count(kube_pod_info)`
+	// apiservers older than 1.14 count requests in apiserver_request_count
+	fleetAPIErrorsQuery = `sum(rate(apiserver_request_total{code=~"5.."}[5m])) / sum(rate(apiserver_request_total[5m]))` +
+		` or sum(rate(apiserver_request_count{code=~"5.."}[5m])) / sum(rate(apiserver_request_count[5m]))`
+)
+
+// ClusterMetrics are key series of a cluster scraped from its prometheus,
+// values are zero when Up is false.
+type ClusterMetrics struct {
+	KubeID   string
+	KubeName string
+	Provider string
+	Region   string
+
+	Up bool
+	// Nodes and Pods are counted by kube-state-metrics.
+	Nodes float64
+	Pods  float64
+	// APIErrorRate is a share of apiserver requests that failed with 5xx
+	// over the last 5 minutes.
+	APIErrorRate float64
+	ScrapedAt    time.Time
+}
+
+// FleetMetrics periodically queries prometheus of operational clusters of all
+// tenants and exposes fleet-level series in prometheus text format.
+type FleetMetrics struct {
+	svc      Interface
+	interval time.Duration
+
+	getMetrics func(string, *model.Kube) (*MetricResponse, error)
+	now        func() time.Time
+
+	m        sync.RWMutex
+	clusters []ClusterMetrics
+}
+
+// NewFleetMetrics constructs FleetMetrics that scrape clusters every interval.
+func NewFleetMetrics(svc Interface, interval time.Duration) *FleetMetrics {
+	return &FleetMetrics{
+		svc:        svc,
+		interval:   interval,
+		getMetrics: queryMetrics,
+		now:        time.Now,
+	}
+}
+
+// Run blocks and scrapes clusters every interval until ctx is cancelled,
+// series are dropped when it returns so that only one replica exposes them.
+func (f *FleetMetrics) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	defer f.set(nil)
+
+	f.scrapeAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.scrapeAll(ctx)
+		}
+	}
+}
+
+func (f *FleetMetrics) scrapeAll(ctx context.Context) {
+	kubes, err := f.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("fleet metrics: list kubes: %v", err)
+		return
+	}
+
+	selected := make([]model.Kube, 0, len(kubes))
+	for _, k := range kubes {
+		if k.State == model.StateOperational {
+			selected = append(selected, k)
+		}
+	}
+
+	clusters := make([]ClusterMetrics, len(selected))
+	sem := make(chan struct{}, defaultFleetConcurrency)
+	wg := sync.WaitGroup{}
+	for i := range selected {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			clusters[i] = f.scrape(&selected[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// clusters of different tenants may share a name
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].KubeName != clusters[j].KubeName {
+			return clusters[i].KubeName < clusters[j].KubeName
+		}
+		return clusters[i].KubeID < clusters[j].KubeID
+	})
+	f.set(clusters)
+}
+
+// scrape queries prometheus of the cluster, the cluster is down if any
+// of the queries fails.
+func (f *FleetMetrics) scrape(k *model.Kube) ClusterMetrics {
+	cm := ClusterMetrics{
+		KubeID:    k.ID,
+		KubeName:  k.Name,
+		Provider:  string(k.Provider),
+		Region:    k.Region,
+		ScrapedAt: f.now(),
+	}
+
+	master := util.GetRandomNode(k.Masters)
+	if master == nil {
+		logrus.Warnf("fleet metrics: cluster %s: %v", k.ID, errors.Wrap(sgerrors.ErrNotFound, "master"))
+		return cm
+	}
+
+	for _, q := range []struct {
+		query string
+		value *float64
+	}{
+		{fleetNodesQuery, &cm.Nodes},
+		{fleetPodsQuery, &cm.Pods},
+		{fleetAPIErrorsQuery, &cm.APIErrorRate},
+	} {
+		uri := fmt.Sprintf("https://%s/%s/api/v1/query?query=%s",
+			master.PublicIp, prometheusProxyPath, url.QueryEscape(q.query))
+		resp, err := f.getMetrics(uri, k)
+		if err != nil {
+			logrus.Warnf("fleet metrics: cluster %s: query %s: %v", k.ID, q.query, err)
+			cm.Nodes, cm.Pods, cm.APIErrorRate = 0, 0, 0
+			return cm
+		}
+		*q.value = scalarValue(resp)
+	}
+
+	cm.Up = true
+	return cm
+}
+
+// scalarValue returns the value of the first series of an instant query,
+// a query without series, e.g. a rate of zero requests, is zero.
+func scalarValue(resp *MetricResponse) float64 {
+	if resp == nil || len(resp.Data.Result) == 0 || len(resp.Data.Result[0].Value) < 2 {
+		return 0
+	}
+	raw, ok := resp.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func (f *FleetMetrics) set(clusters []ClusterMetrics) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.clusters = clusters
+}
+
+// Clusters returns the latest metrics of clusters sorted by name.
+func (f *FleetMetrics) Clusters() []ClusterMetrics {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	clusters := make([]ClusterMetrics, len(f.clusters))
+	copy(clusters, f.clusters)
+	return clusters
+}
+
+// WriteMetrics writes series of clusters and their fleet totals in
+// prometheus text format, nothing is written before the first scrape.
+func (f *FleetMetrics) WriteMetrics(w io.Writer) error {
+	clusters := f.Clusters()
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	var up, nodes, pods float64
+	for _, c := range clusters {
+		if c.Up {
+			up++
+			nodes += c.Nodes
+			pods += c.Pods
+		}
+	}
+
+	for _, m := range []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"supergiant_fleet_clusters", "Number of operational clusters.", float64(len(clusters))},
+		{"supergiant_fleet_clusters_up", "Number of clusters whose prometheus has been scraped.", up},
+		{"supergiant_fleet_nodes", "Number of nodes of scraped clusters.", nodes},
+		{"supergiant_fleet_pods", "Number of pods of scraped clusters.", pods},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n",
+			m.name, m.help, m.name, m.name, formatValue(m.value)); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range []struct {
+		name  string
+		help  string
+		value func(ClusterMetrics) float64
+	}{
+		{
+			name: "supergiant_cluster_up",
+			help: "Whether prometheus of the cluster has been scraped.",
+			value: func(c ClusterMetrics) float64 {
+				if c.Up {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			name:  "supergiant_cluster_nodes",
+			help:  "Number of nodes of the cluster.",
+			value: func(c ClusterMetrics) float64 { return c.Nodes },
+		},
+		{
+			name:  "supergiant_cluster_pods",
+			help:  "Number of pods of the cluster.",
+			value: func(c ClusterMetrics) float64 { return c.Pods },
+		},
+		{
+			name:  "supergiant_cluster_apiserver_error_ratio",
+			help:  "Share of apiserver requests of the cluster that failed with 5xx over 5 minutes.",
+			value: func(c ClusterMetrics) float64 { return c.APIErrorRate },
+		},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for _, c := range clusters {
+			// series of clusters that are down would be mistaken for zeros
+			if !c.Up && m.name != "supergiant_cluster_up" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s{kube_id=%q,kube_name=%q,provider=%q,region=%q} %s\n",
+				m.name, c.KubeID, c.KubeName, c.Provider, c.Region, formatValue(m.value(c))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
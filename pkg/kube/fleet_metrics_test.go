@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+)
+
+func scalarResponse(v string) *MetricResponse {
+	resp := &MetricResponse{}
+	resp.Data.Result = append(resp.Data.Result, struct {
+		Metric map[string]string `json:"metric"`
+		Value  []interface{}     `json:"value"`
+	}{
+		Metric: map[string]string{},
+		Value:  []interface{}{1.0, v},
+	})
+	return resp
+}
+
+func TestFleetMetrics_scrapeAll(t *testing.T) {
+	masters := map[string]*model.Machine{"master": {PublicIp: "10.0.0.1"}}
+	kubes := []model.Kube{
+		{ID: "b", Name: "prod", Provider: clouds.AWS, Region: "us-east-1", State: model.StateOperational, Masters: masters},
+		{ID: "a", Name: "dev", Provider: clouds.GCE, Region: "europe-west1", State: model.StateOperational, Masters: masters},
+		{ID: "e", TenantID: "acme", Name: "dev", State: model.StateOperational},
+		{ID: "c", Name: "new", State: model.StateProvisioning, Masters: masters},
+		{ID: "d", Name: "broken", State: model.StateOperational},
+	}
+
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return(kubes, nil)
+
+	fm := NewFleetMetrics(svc, time.Minute)
+	fm.now = func() time.Time { return time.Unix(100, 0) }
+	fm.getMetrics = func(uri string, k *model.Kube) (*MetricResponse, error) {
+		if k.ID == "a" {
+			return nil, errFake
+		}
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		switch u.Query().Get("query") {
+		case fleetNodesQuery:
+			return scalarResponse("3"), nil
+		case fleetPodsQuery:
+			return scalarResponse("42"), nil
+		}
+		return &MetricResponse{}, nil
+	}
+
+	require.Empty(t, fm.Clusters())
+	buf := &bytes.Buffer{}
+	require.NoError(t, fm.WriteMetrics(buf))
+	require.Empty(t, buf.String())
+
+	fm.scrapeAll(context.Background())
+
+	require.Equal(t, []ClusterMetrics{
+		{KubeID: "d", KubeName: "broken", ScrapedAt: time.Unix(100, 0)},
+		{KubeID: "a", KubeName: "dev", Provider: string(clouds.GCE), Region: "europe-west1", ScrapedAt: time.Unix(100, 0)},
+		{KubeID: "e", KubeName: "dev", ScrapedAt: time.Unix(100, 0)},
+		{KubeID: "b", KubeName: "prod", Provider: string(clouds.AWS), Region: "us-east-1",
+			Up: true, Nodes: 3, Pods: 42, ScrapedAt: time.Unix(100, 0)},
+	}, fm.Clusters())
+
+	require.NoError(t, fm.WriteMetrics(buf))
+	out := buf.String()
+	for _, line := range []string{
+		"supergiant_fleet_clusters 4\n",
+		"supergiant_fleet_clusters_up 1\n",
+		"supergiant_fleet_nodes 3\n",
+		"supergiant_fleet_pods 42\n",
+		`supergiant_cluster_up{kube_id="a",kube_name="dev",provider="gce",region="europe-west1"} 0` + "\n",
+		`supergiant_cluster_up{kube_id="b",kube_name="prod",provider="aws",region="us-east-1"} 1` + "\n",
+		`supergiant_cluster_pods{kube_id="b",kube_name="prod",provider="aws",region="us-east-1"} 42` + "\n",
+		`supergiant_cluster_apiserver_error_ratio{kube_id="b",kube_name="prod",provider="aws",region="us-east-1"} 0` + "\n",
+	} {
+		require.Contains(t, out, line)
+	}
+	require.False(t, strings.Contains(out, `supergiant_cluster_nodes{kube_id="a"`), "series of clusters that are down")
+}
+
+func TestFleetMetrics_Run(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{
+		{ID: "a", Name: "dev", State: model.StateOperational},
+	}, nil)
+
+	fm := NewFleetMetrics(svc, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fm.Run(ctx)
+		close(done)
+	}()
+
+	// the first scrape is done on start
+	for i := 0; i < 100 && len(fm.Clusters()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Len(t, fm.Clusters(), 1)
+
+	cancel()
+	<-done
+	require.Empty(t, fm.Clusters(), "series are dropped when leadership is lost")
+}
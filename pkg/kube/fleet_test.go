@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+	"github.com/supergiant/control/pkg/testutils/storage"
+)
+
+func chartRelease(name, chrt, version string) *release.Release {
+	return &release.Release{
+		Name: name,
+		Info: fakeRls.Info,
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Name:    chrt,
+				Version: version,
+			},
+		},
+	}
+}
+
+func TestService_ListFleetReleases(t *testing.T) {
+	var items [][]byte
+	for _, k := range []model.Kube{
+		{ID: "a", Name: "a", State: model.StateOperational},
+		{ID: "b", Name: "b", State: model.StateOperational},
+		{ID: "c", Name: "c", State: model.StateOperational},
+		{ID: "d", Name: "d", State: model.StateProvisioning},
+	} {
+		raw, _ := json.Marshal(k)
+		items = append(items, raw)
+	}
+
+	svc := Service{
+		storage: &storage.Fake{Items: items},
+		newHelmProxyFn: func(k *model.Kube) (proxy.Interface, error) {
+			switch k.ID {
+			case "a":
+				return &fakeHelmProxy{
+					listReleaseResp: &services.ListReleasesResponse{
+						Releases: []*release.Release{
+							chartRelease("web", "nginx", "1.0.0"),
+							chartRelease("db", "postgres", "2.0.0"),
+						},
+					},
+				}, nil
+			case "b":
+				return &fakeHelmProxy{err: errFake}, nil
+			}
+			return &fakeHelmProxy{
+				listReleaseResp: &services.ListReleasesResponse{
+					Releases: []*release.Release{
+						chartRelease("web", "nginx", "1.1.0"),
+					},
+				},
+			}, nil
+		},
+	}
+
+	res, err := svc.ListFleetReleases(context.Background(), ReleaseFilter{Chart: "nginx"})
+	require.NoError(t, err)
+	require.Len(t, res, 3, "not operational clusters must be skipped")
+
+	require.Equal(t, "a", res[0].KubeID)
+	require.Len(t, res[0].Releases, 1)
+	require.Equal(t, "1.0.0", res[0].Releases[0].ChartVersion)
+
+	require.Equal(t, "b", res[1].KubeID)
+	require.NotEmpty(t, res[1].Error, "cluster error must be reported")
+	require.Empty(t, res[1].Releases)
+
+	require.Equal(t, "c", res[2].KubeID)
+	require.Equal(t, "1.1.0", res[2].Releases[0].ChartVersion)
+
+	res, err = svc.ListFleetReleases(context.Background(), ReleaseFilter{
+		KubeIDs:      []string{"a", "c"},
+		Chart:        "nginx",
+		ChartVersion: "1.1.0",
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Empty(t, res[0].Releases)
+	require.Len(t, res[1].Releases, 1)
+
+	_, err = Service{storage: &storage.Fake{ListErr: errFake}}.
+		ListFleetReleases(context.Background(), ReleaseFilter{})
+	require.Equal(t, errFake, errors.Cause(err))
+}
+
+func TestService_SetFleetConcurrency(t *testing.T) {
+	require.Equal(t, defaultFleetConcurrency, Service{}.FleetConcurrency())
+
+	svc := NewService("", nil, nil)
+	svc.SetFleetConcurrency(2)
+	require.Equal(t, 2, svc.FleetConcurrency())
+
+	svc.SetFleetConcurrency(0)
+	require.Equal(t, defaultFleetConcurrency, svc.FleetConcurrency())
+}
+
+func TestHandler_listFleetReleases(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		query        string
+		filter       ReleaseFilter
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "unknown error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:  "success",
+			query: "?kubeID=a,b&kubeID=c&chart=nginx&version=1.0.0&namespace=default",
+			filter: ReleaseFilter{
+				KubeIDs:      []string{"a", "b", "c"},
+				Namespace:    "default",
+				Chart:        "nginx",
+				ChartVersion: "1.0.0",
+			},
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceFleetReleases, mock.Anything, tc.filter).
+			Return([]ClusterReleases{{KubeID: "a"}}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/releases"+tc.query, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
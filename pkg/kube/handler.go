@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -21,10 +26,12 @@ import (
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/message"
 	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/proxy"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/statuses"
@@ -45,11 +52,19 @@ type profileGetter interface {
 
 type nodeProvisioner interface {
 	ProvisionNodes(context.Context, []profile.NodeProfile, *model.Kube,
-		*steps.Config) ([]string, error)
+		*steps.Config) ([]*workflows.Task, error)
 	// Method that cancels newly added nodes to working cluster
 	Cancel(string) error
 }
 
+type nodeAdder interface {
+	AddNodes(ctx context.Context, kubeID string, profiles []profile.NodeProfile) ([]*workflows.Task, error)
+}
+
+type nodeDeleter interface {
+	DeleteNodeAsync(ctx context.Context, kubeID, nodeName string) (*workflows.Task, error)
+}
+
 type kubeProvisioner interface {
 	RestartClusterProvisioning(ctx context.Context,
 		clusterProfile *profile.Profile,
@@ -81,15 +96,27 @@ type Handler struct {
 	svc             Interface
 	accountService  accountGetter
 	nodeProvisioner nodeProvisioner
+	nodeAdder       nodeAdder
+	nodeDeleter     nodeDeleter
 	kubeProvisioner kubeProvisioner
 	profileSvc      profileGetter
 
-	repo    storage.Interface
-	proxies proxy.Container
+	repo      storage.Interface
+	proxies   proxy.Container
+	instances instanceLister
+	disks     diskLister
+	budgets   budgetGetter
+
+	compliance complianceChecker
+	versions   versionCatalog
 
 	getWriter       func(string) (io.WriteCloser, error)
 	getMetrics      func(string, *model.Kube) (*MetricResponse, error)
 	listK8sServices func(*model.Kube, string) (*corev1.ServiceList, error)
+	deleteK8sNode   func(*model.Kube, string) error
+	listK8sVolumes  func(*model.Kube) ([]corev1.PersistentVolume, error)
+
+	apiServerTransport func(*model.Kube) (*url.URL, http.RoundTripper, error)
 }
 
 // NewHandler constructs a Handler for kubes.
@@ -102,37 +129,24 @@ func NewHandler(
 	repo storage.Interface,
 	proxies proxy.Container,
 ) *Handler {
+	instances := NewCloudInstances(accountService)
 	return &Handler{
 		svc:             svc,
 		accountService:  accountService,
 		nodeProvisioner: provisioner,
+		nodeAdder:       NewNodeAdder(svc, accountService, provisioner),
+		nodeDeleter:     NewNodeDeleter(svc, accountService, repo),
 		kubeProvisioner: kubeProvisioner,
 		profileSvc:      profileSvc,
 		repo:            repo,
+		instances:       instances,
+		disks:           instances,
+		budgets:         instances,
+		compliance:      instances,
 		getWriter:       util.GetWriter,
-		getMetrics: func(metricURI string, k *model.Kube) (*MetricResponse, error) {
-			cfg, err := NewConfigFor(k)
-			if err != nil {
-				return nil, errors.Wrap(err, "build kubernetes rest config")
-			}
-			kclient, err := rest.UnversionedRESTClientFor(cfg)
-			if err != nil {
-				return nil, errors.Wrap(err, "build kubernetes client")
-			}
-
-			raw, err := kclient.Get().RequestURI(metricURI).Do().Raw()
-			if err != nil {
-				return nil, errors.Wrap(err, "retrieve metrics")
-			}
-
-			metricResponse := &MetricResponse{}
-			err = json.Unmarshal(raw, metricResponse)
-			if err != nil {
-				return nil, errors.Wrap(err, "unmarshal")
-			}
+		getMetrics:      queryMetrics,
 
-			return metricResponse, nil
-		},
+		apiServerTransport: apiServerTransport,
 		listK8sServices: func(k *model.Kube, selector string) (*corev1.ServiceList, error) {
 			cfg, err := NewConfigFor(k)
 			if err != nil {
@@ -146,26 +160,84 @@ func NewHandler(
 				LabelSelector: selector,
 			})
 		},
-		proxies: proxies,
+		deleteK8sNode:  deleteK8sNode,
+		listK8sVolumes: listK8sVolumes,
+		proxies:        proxies,
+	}
+}
+
+// queryMetrics sends a query to prometheus running in the cluster.
+func queryMetrics(metricURI string, k *model.Kube) (*MetricResponse, error) {
+	cfg, err := NewConfigFor(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes rest config")
+	}
+	kclient, err := rest.UnversionedRESTClientFor(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes client")
+	}
+
+	raw, err := kclient.Get().RequestURI(metricURI).Do().Raw()
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieve metrics")
+	}
+
+	metricResponse := &MetricResponse{}
+	err = json.Unmarshal(raw, metricResponse)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
 	}
+
+	return metricResponse, nil
 }
 
 // Register adds kube handlers to a router.
 func (h *Handler) Register(r *mux.Router) {
 	r.HandleFunc("/kubes", h.createKube).Methods(http.MethodPost)
 	r.HandleFunc("/kubes", h.listKubes).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/capacity", h.listCapacity).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/releases", h.listFleetReleases).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/upgrades", h.listUpgrades).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/inventory", h.listFleetInventory).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/catalog", h.getBackstageCatalog).Methods(http.MethodGet)
+	r.HandleFunc("/summary", h.getSummary).Methods(http.MethodGet)
+	r.HandleFunc("/search", h.searchFleet).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}", h.getKube).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}", h.deleteKube).Methods(http.MethodDelete)
+	r.HandleFunc("/kubes/{kubeID}", h.updateKube).Methods(http.MethodPatch)
+	r.HandleFunc("/kubes/{kubeID}/protection", h.setProtection).Methods(http.MethodPut)
+	r.HandleFunc("/kubes/{kubeID}/maintenance", h.setMaintenance).Methods(http.MethodPut)
+	r.HandleFunc("/kubes/{kubeID}/firewall", h.getFirewall).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/firewall", h.updateFirewall).Methods(http.MethodPut)
+	r.HandleFunc("/kubes/{kubeID}/apiserver/access", h.getAPIServerAccess).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/apiserver/access", h.updateAPIServerAccess).Methods(http.MethodPut)
+	r.PathPrefix("/kubes/{kubeID}/dashboard").HandlerFunc(h.dashboard)
 
 	r.HandleFunc("/kubes/{kubeID}/users/{uname}/kubeconfig", h.getKubeconfig).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/users/{uname}/kubeconfig", h.issueKubeconfig).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/access", h.listAccessGrants).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/access", h.grantAccess).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/access/{grantID}/kubeconfig", h.getAccessKubeConfig).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/access/{grantID}", h.revokeAccess).Methods(http.MethodDelete)
 
 	r.HandleFunc("/kubes/{kubeID}/resources", h.listResources).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}/resources/{resource}", h.getResource).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/resources/{resource}", h.createResource).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/resources/{resource}/watch", h.watchResources).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/resources/{resource}/{name}", h.patchResource).Methods(http.MethodPatch)
+	r.HandleFunc("/kubes/{kubeID}/resources/{resource}/{name}", h.deleteResource).Methods(http.MethodDelete)
 
 	r.HandleFunc("/kubes/{kubeID}/releases", h.installRelease).Methods(http.MethodPost)
 	r.HandleFunc("/kubes/{kubeID}/releases", h.listReleases).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/releases/migrate", h.migrateReleases).Methods(http.MethodPost)
 	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}", h.getRelease).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}", h.upgradeRelease).Methods(http.MethodPut)
 	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}", h.deleteReleases).Methods(http.MethodDelete)
+	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}/history", h.getReleaseHistory).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}/rollback", h.rollbackRelease).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/releases/{releaseName}/resources", h.getReleaseResources).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/helm/operations", h.listHelmOperations).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/helm/operations/{operationID}", h.getHelmOperation).Methods(http.MethodGet)
 
 	r.HandleFunc("/kubes/{kubeID}/certs/{cname}", h.getCerts).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}/tasks", h.getTasks).Methods(http.MethodGet)
@@ -176,14 +248,37 @@ func (h *Handler) Register(r *mux.Router) {
 	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}", h.deleteMachine).Methods(http.MethodDelete)
 
 	r.HandleFunc("/kubes/{kubeID}/nodes", h.listNodes).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}/cordon", h.cordonNode).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}/uncordon", h.uncordonNode).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/nodes/{nodename}/drain", h.drainNode).Methods(http.MethodPost)
 
 	r.HandleFunc("/kubes/{kubeID}/machines", h.addMachine).Methods(http.MethodPost)
 	r.HandleFunc("/kubes/{kubeID}/machines/{nodename}", h.deleteMachine).Methods(http.MethodDelete)
 
 	r.HandleFunc("/kubes/{kubeID}/nodes/metrics", h.getNodesMetrics).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/pods/{namespace}/{pod}/logs", h.getPodLogs).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/pods/{namespace}/{pod}/exec", h.execInPod).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/orphans", h.getOrphans).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/orphans/instances/{instanceID}", h.deleteUnjoinedInstance).Methods(http.MethodDelete)
+	r.HandleFunc("/kubes/{kubeID}/orphans/nodes/{nodename}", h.deleteLostNode).Methods(http.MethodDelete)
+	r.HandleFunc("/kubes/{kubeID}/volumes", h.getVolumes).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/volumes/cleanup", h.cleanupVolumes).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/cost", h.getCost).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/compliance", h.getCompliance).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/snapshots", h.listSnapshots).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/snapshots", h.createSnapshots).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/snapshots/{namespace}/{name}/restore", h.restoreSnapshot).Methods(http.MethodPost)
 	r.HandleFunc("/kubes/{kubeID}/metrics", h.getClusterMetrics).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}/services", h.getServices).Methods(http.MethodGet)
 	r.HandleFunc("/kubes/{kubeID}/restart", h.restartKubeProvisioning).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/kubelet", h.updateKubelet).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/patch", h.patchNodes).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/capacity", h.getCapacity).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/usage", h.getUsage).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/upgrade/check", h.checkUpgrade).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/channel", h.setChannel).Methods(http.MethodPut)
+	r.HandleFunc("/kubes/{kubeID}/autoupgrade", h.setAutoUpgrade).Methods(http.MethodPut)
+	r.HandleFunc("/kubes/{kubeID}/inventory", h.getInventory).Methods(http.MethodGet)
 }
 
 func (h *Handler) getTasks(w http.ResponseWriter, r *http.Request) {
@@ -305,10 +400,6 @@ func (h *Handler) deleteKube(w http.ResponseWriter, r *http.Request) {
 	kubeID := vars["kubeID"]
 	logrus.Debugf("Delete kube %s", kubeID)
 
-	if err := h.nodeProvisioner.Cancel(kubeID); err != nil {
-		logrus.Debugf("cancel kube tasks error %v", err)
-	}
-
 	k, err := h.svc.Get(r.Context(), kubeID)
 	if err != nil {
 		if sgerrors.IsNotFound(err) {
@@ -319,6 +410,29 @@ func (h *Handler) deleteKube(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = confirmDeletion(r, k); err != nil {
+		sendProtectionError(w, err)
+		return
+	}
+
+	if err := h.nodeProvisioner.Cancel(kubeID); err != nil {
+		logrus.Debugf("cancel kube tasks error %v", err)
+	}
+
+	// Machines of imported clusters are managed outside of supergiant,
+	// so the cluster is only forgotten.
+	if k.ExternallyManaged {
+		if err := h.svc.Delete(r.Context(), kubeID); err != nil {
+			logrus.Errorf("delete kube %s caused %v", kubeID, err)
+			message.SendUnknownError(w, err)
+			return
+		}
+		h.deleteClusterTasks(tenant.Detach(r.Context()), kubeID)
+
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
 	acc, err := h.accountService.Get(r.Context(), k.AccountName)
 
 	if err != nil {
@@ -379,12 +493,12 @@ func (h *Handler) deleteKube(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	errChan := t.Run(context.Background(), *config, writer)
+	errChan := t.Run(tenant.Detach(r.Context()), *config, writer)
 
 	go func(t *workflows.Task) {
 		// Update kube with deleting state
 		k.State = model.StateDeleting
-		err = h.svc.Create(context.Background(), k)
+		err = h.svc.Create(tenant.Detach(r.Context()), k)
 
 		if err != nil {
 			logrus.Errorf("update cluster %s caused %v", kubeID, err)
@@ -396,15 +510,15 @@ func (h *Handler) deleteKube(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Finally delete cluster record from etcd
-		if err := h.svc.Delete(context.Background(), kubeID); err != nil {
+		if err := h.svc.Delete(tenant.Detach(r.Context()), kubeID); err != nil {
 			logrus.Errorf("delete kube %s caused %v", kubeID, err)
 			return
 		}
 
-		h.deleteClusterTasks(context.Background(), kubeID)
+		h.deleteClusterTasks(tenant.Detach(r.Context()), kubeID)
 	}(t)
 
-	w.WriteHeader(http.StatusAccepted)
+	workflows.SendAccepted(w, t.ID, workflows.TaskResponse{ID: t.ID})
 }
 
 func (h *Handler) getKubeconfig(w http.ResponseWriter, r *http.Request) {
@@ -457,13 +571,15 @@ func (h *Handler) getResource(w http.ResponseWriter, r *http.Request) {
 	ns := r.URL.Query().Get("namespace")
 	name := r.URL.Query().Get("name")
 
-	rawResources, err := h.svc.GetKubeResources(r.Context(), kubeID, rs, ns, name)
+	opts, err := listOptions(r.URL.Query())
 	if err != nil {
-		if sgerrors.IsNotFound(err) {
-			message.SendNotFound(w, kubeID, err)
-			return
-		}
-		message.SendUnknownError(w, err)
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	rawResources, err := h.svc.GetKubeResources(r.Context(), kubeID, rs, ns, name, opts)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
 		return
 	}
 
@@ -514,135 +630,66 @@ func (h *Handler) listNodes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = json.NewEncoder(w).Encode(nodes); err != nil {
+	// nodes are listed with the stored machine data when the cloud can't be queried
+	instances, err := h.instances.Instances(r.Context(), k)
+	if err != nil {
+		logrus.Warnf("kube %s: list instances: %v", k.ID, err)
+	}
+
+	if err = json.NewEncoder(w).Encode(JoinInstances(k, nodes, instances)); err != nil {
 		message.SendUnknownError(w, err)
 	}
 }
 
 // Add node to working kube
 func (h *Handler) addMachine(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	kubeID := vars["kubeID"]
-	k, err := h.svc.Get(r.Context(), kubeID)
-
-	// TODO(stgleb): This method contains a lot of specific stuff, implement provision node
-	// method for nodeProvisioner to do all things related to provisioning and saving cluster state
-	if sgerrors.IsNotFound(err) {
-		http.NotFound(w, r)
-		return
-	}
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	nodeProfiles := make([]profile.NodeProfile, 0)
-	err = json.NewDecoder(r.Body).Decode(&nodeProfiles)
+	err := json.NewDecoder(r.Body).Decode(&nodeProfiles)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	acc, err := h.accountService.Get(r.Context(), k.AccountName)
-
-	if sgerrors.IsNotFound(err) {
-		http.NotFound(w, r)
-		return
-	}
-
+	// node workflows outlive the request
+	timeout := time.Minute * 10
+	ctx, cancel := context.WithTimeout(tenant.Detach(r.Context()), timeout)
+	time.AfterFunc(timeout, cancel)
+	tasks, err := h.nodeAdder.AddNodes(ctx, mux.Vars(r)["kubeID"], nodeProfiles)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	kubeProfile := profile.Profile{
-		Provider:        acc.Provider,
-		Region:          k.Region,
-		Zone:            k.Zone,
-		Arch:            k.Arch,
-		OperatingSystem: k.OperatingSystem,
-		UbuntuVersion:   k.OperatingSystemVersion,
-		DockerVersion:   k.DockerVersion,
-		K8SVersion:      k.K8SVersion,
-		K8SServicesCIDR: k.ServicesCIDR,
-		HelmVersion:     k.HelmVersion,
-		User:            k.User,
-		Password:        k.Password,
-
-		NetworkType:           k.Networking.Type,
-		CIDR:                  k.Networking.CIDR,
-		FlannelVersion:        k.Networking.Version,
-		CloudSpecificSettings: k.CloudSpec,
-
-		NodesProfiles: []profile.NodeProfile{
-			{},
-		},
-
-		RBACEnabled: k.RBACEnabled,
+		cancel()
 	}
 
-	config, err := steps.NewConfig(k.Name, k.AccountName, kubeProfile)
-
-	if err != nil {
-		logrus.Errorf("New config %v", err.Error())
-		message.SendUnknownError(w, err)
+	if sgerrors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	config.ClusterID = k.ID
-	config.CertificatesConfig.CAKey = k.Auth.CAKey
-	config.CertificatesConfig.CACert = k.Auth.CACert
-	config.CertificatesConfig.AdminCert = k.Auth.AdminCert
-	config.CertificatesConfig.AdminKey = k.Auth.AdminKey
-
-	if len(k.Masters) != 0 {
-		config.AddMaster(util.GetRandomNode(k.Masters))
-	} else {
-		http.Error(w, "no master found", http.StatusNotFound)
+	if errors.Cause(err) == sgerrors.ErrInvalidJson {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get cloud account fill appropriate config structure
-	// with cloud account credentials
-	err = util.FillCloudAccountCredentials(r.Context(), acc, config)
-
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Minute*10)
-	tasks, err := h.nodeProvisioner.ProvisionNodes(ctx, nodeProfiles,
-		k, config)
-
-	if err != nil && sgerrors.IsNotFound(err) {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	}
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	taskIDs := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		taskIDs = append(taskIDs, t.ID)
 	}
 
-	// Add tasks ids to kube object
-	k.Tasks[workflows.NodeTask] = append(k.Tasks[workflows.NodeTask], tasks...)
-
-	if err := h.svc.Create(ctx, k); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Respond to client side that request has been accepted,
+	// node tasks share a group task
+	if len(tasks) == 0 || tasks[0].ParentID == "" {
+		w.WriteHeader(http.StatusAccepted)
+		if err = json.NewEncoder(w).Encode(taskIDs); err != nil {
+			logrus.Error(errors.Wrap(err, "marshal json"))
+		}
 		return
 	}
-
-	// Respond to client side that request has been accepted
-	w.WriteHeader(http.StatusAccepted)
-	err = json.NewEncoder(w).Encode(tasks)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logrus.Error(errors.Wrap(err, "marshal json"))
-	}
+	workflows.SendAccepted(w, tasks[0].ParentID, taskIDs)
 }
 
 // TODO(stgleb): cover with unit tests
@@ -654,124 +701,23 @@ func (h *Handler) deleteMachine(w http.ResponseWriter, r *http.Request) {
 
 	logrus.Debugf("Delete node %s from kube %s",
 		nodeName, kubeID)
-	k, err := h.svc.Get(r.Context(), kubeID)
-	if err != nil {
-		if sgerrors.IsNotFound(err) {
-			message.SendNotFound(w, kubeID, err)
-			return
-		}
-		message.SendUnknownError(w, err)
-		return
-	}
 
 	// TODO(stgleb): check whether we will have quorum of master nodes if node is deleted.
-	if _, ok := k.Masters[nodeName]; ok {
-		http.Error(w, "delete master node not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var n *model.Machine
-
-	if n = k.Nodes[nodeName]; n == nil {
-		http.NotFound(w, r)
-		return
-	}
-
-	acc, err := h.accountService.Get(r.Context(), k.AccountName)
-
-	if err != nil {
-		if sgerrors.IsNotFound(err) {
-			http.NotFound(w, r)
-			return
-		}
-
-		message.SendUnknownError(w, err)
-		return
-	}
-
-	t, err := workflows.NewTask(workflows.DeleteNode, h.repo)
+	t, err := h.nodeDeleter.DeleteNodeAsync(r.Context(), kubeID, nodeName)
 	if err != nil {
-		if sgerrors.IsNotFound(err) {
-			http.NotFound(w, r)
+		if errors.Cause(err) == ErrMasterNode {
+			http.Error(w, "delete master node not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-
-		message.SendUnknownError(w, err)
-		return
-	}
-
-	config := &steps.Config{
-		Kube:     *k,
-		Provider: k.Provider,
-		DrainConfig: steps.DrainConfig{
-			PrivateIP: n.PrivateIp,
-		},
-		ClusterID:        k.ID,
-		ClusterName:      k.Name,
-		CloudAccountName: k.AccountName,
-		Node:             *n,
-		Masters:          steps.NewMap(k.Masters),
-	}
-
-	err = util.FillCloudAccountCredentials(r.Context(), acc, config)
-
-	if err != nil {
 		if sgerrors.IsNotFound(err) {
-			http.NotFound(w, r)
+			message.SendNotFound(w, nodeName, err)
 			return
 		}
 		message.SendUnknownError(w, err)
 		return
 	}
 
-	err = util.LoadCloudSpecificDataFromKube(k, config)
-
-	if err != nil {
-		message.SendUnknownError(w, err)
-		return
-	}
-
-	writer, err := h.getWriter(util.MakeFileName(t.ID))
-
-	if err != nil {
-		message.SendUnknownError(w, err)
-		return
-	}
-
-	// Update cluster state when deletion completes
-	go func() {
-		// Set node to deleting state
-		nodeToDelete, ok := k.Nodes[nodeName]
-
-		if !ok {
-			logrus.Errorf("Node %s not found", nodeName)
-			return
-		}
-		nodeToDelete.State = model.MachineStateDeleting
-		k.Nodes[nodeName] = nodeToDelete
-		err := h.svc.Create(context.Background(), k)
-
-		if err != nil {
-			logrus.Errorf("update cluster %s caused %v", kubeID, err)
-		}
-
-		err = <-t.Run(context.Background(), *config, writer)
-
-		if err != nil {
-			logrus.Errorf("delete node %s from cluster %s caused %v", nodeName, kubeID, err)
-		}
-
-		// Delete node from cluster object
-		delete(k.Nodes, nodeName)
-		// Save cluster object to etcd
-		logrus.Infof("delete node %s from cluster %s", nodeName, kubeID)
-		err = h.svc.Create(context.Background(), k)
-
-		if err != nil {
-			logrus.Errorf("update cluster %s caused %v", kubeID, err)
-		}
-	}()
-	w.WriteHeader(http.StatusAccepted)
+	workflows.SendAccepted(w, t.ID, workflows.TaskResponse{ID: t.ID})
 }
 
 // TODO(stgleb): Create separte task service to manage task object lifecycle
@@ -782,6 +728,10 @@ func (h *Handler) getKubeTasks(ctx context.Context, kubeID string) ([]*workflows
 		return nil, err
 	}
 
+	return h.tasksOf(ctx, k)
+}
+
+func (h *Handler) tasksOf(ctx context.Context, k *model.Kube) ([]*workflows.Task, error) {
 	tasks := make([]*workflows.Task, 0, len(k.Tasks))
 
 	for _, taskSet := range k.Tasks {
@@ -827,11 +777,55 @@ func (h *Handler) deleteClusterTasks(ctx context.Context, kubeID string) error {
 	return nil
 }
 
+// decodeReleaseInput reads a json release or a multipart form with the release
+// in the "release" part and a values file in the "values" part, parts are read
+// as they arrive, so values don't have to be escaped into json by clients.
+func decodeReleaseInput(r *http.Request, inp *ReleaseInput) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return json.NewDecoder(r.Body).Decode(inp)
+	}
+
+	form, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	var values *strings.Builder
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "read form")
+		}
+
+		switch part.FormName() {
+		case "release":
+			err = errors.Wrap(json.NewDecoder(part).Decode(inp), "decode release")
+		case "values":
+			values = &strings.Builder{}
+			_, err = io.Copy(values, part)
+			err = errors.Wrap(err, "read values")
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if values != nil {
+		inp.Values = values.String()
+	}
+	return nil
+}
+
 func (h *Handler) installRelease(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	inp := &ReleaseInput{}
-	err := json.NewDecoder(r.Body).Decode(inp)
+	err := decodeReleaseInput(r, inp)
 	if err != nil {
 		logrus.Errorf("helm: install release: decode: %s", err)
 		message.SendInvalidJSON(w, err)
@@ -843,8 +837,27 @@ func (h *Handler) installRelease(w http.ResponseWriter, r *http.Request) {
 		message.SendValidationFailed(w, err)
 		return
 	}
+	if _, err = inp.timeout(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
 
 	kubeID := vars["kubeID"]
+
+	// slow charts don't fit into gateway timeouts, so release is installed
+	// in background unless the client asks to wait for it, dry runs return
+	// rendered manifests right away
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); !wait && !inp.DryRun {
+		op, err := h.svc.InstallReleaseAsync(r.Context(), kubeID, inp)
+		if err != nil {
+			logrus.Errorf("helm: install release: %s cluster: %s (%+v)", kubeID, err, inp)
+			sendHelmError(w, kubeID, err)
+			return
+		}
+		sendHelmOperation(w, op)
+		return
+	}
+
 	rls, err := h.svc.InstallRelease(r.Context(), kubeID, inp)
 	if err != nil {
 		logrus.Errorf("helm: install release: %s cluster: %s (%+v)", kubeID, err, inp)
@@ -859,32 +872,112 @@ func (h *Handler) installRelease(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) getRelease(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) upgradeRelease(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
+	inp := &ReleaseInput{}
+	err := decodeReleaseInput(r, inp)
+	if err != nil {
+		logrus.Errorf("helm: upgrade release: decode: %s", err)
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	ok, err := govalidator.ValidateStruct(inp)
+	if !ok {
+		logrus.Errorf("helm: upgrade release: validation: %s", err)
+		message.SendValidationFailed(w, err)
+		return
+	}
+	if _, err = inp.timeout(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
 	kubeID := vars["kubeID"]
 	rlsName := vars["releaseName"]
 
-	rls, err := h.svc.ReleaseDetails(r.Context(), kubeID, rlsName)
+	// upgrades are as slow as installations, so they are run in background
+	// unless the client asks to wait for them
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); !wait {
+		op, err := h.svc.UpgradeReleaseAsync(r.Context(), kubeID, rlsName, inp)
+		if err != nil {
+			logrus.Errorf("helm: upgrade %s release: %s cluster: %s (%+v)", rlsName, kubeID, err, inp)
+			sendHelmError(w, rlsName, err)
+			return
+		}
+		sendHelmOperation(w, op)
+		return
+	}
+
+	rls, err := h.svc.UpgradeRelease(r.Context(), kubeID, rlsName, inp)
 	if err != nil {
-		logrus.Errorf("helm: get %s release: %s cluster: %s", rlsName, kubeID, err)
-		message.SendUnknownError(w, err)
+		logrus.Errorf("helm: upgrade %s release: %s cluster: %s (%+v)", rlsName, kubeID, err, inp)
+		sendHelmError(w, rlsName, err)
 		return
 	}
 
 	if err = json.NewEncoder(w).Encode(rls); err != nil {
-		logrus.Errorf("helm: get %s release: %s cluster: write response: %s", rlsName, kubeID, err)
+		logrus.Errorf("helm: upgrade %s release: %s cluster: write response: %s", rlsName, kubeID, err)
 		message.SendUnknownError(w, err)
 	}
 }
 
-func (h *Handler) listReleases(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) getRelease(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	kubeID := vars["kubeID"]
-	// TODO: use a struct for input parameters
-	rlsList, err := h.svc.ListReleases(r.Context(), kubeID, "", "", 0)
-	if err != nil {
+	rlsName := vars["releaseName"]
+
+	rls, err := h.svc.ReleaseDetails(r.Context(), kubeID, rlsName)
+	if err != nil {
+		logrus.Errorf("helm: get %s release: %s cluster: %s", rlsName, kubeID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(rls); err != nil {
+		logrus.Errorf("helm: get %s release: %s cluster: write response: %s", rlsName, kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
+
+// getReleaseHistory lists revisions of the release, the latest first:
+// GET /kubes/{kubeID}/releases/{releaseName}/history?max=10
+func (h *Handler) getReleaseHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	kubeID := vars["kubeID"]
+	rlsName := vars["releaseName"]
+
+	var max int
+	if v := r.URL.Query().Get("max"); v != "" {
+		var err error
+		if max, err = strconv.Atoi(v); err != nil || max < 0 {
+			message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "max %q", v))
+			return
+		}
+	}
+
+	history, err := h.svc.ReleaseHistory(r.Context(), kubeID, rlsName, max)
+	if err != nil {
+		logrus.Errorf("helm: get %s release history: %s cluster: %s", rlsName, kubeID, err)
+		sendHelmError(w, rlsName, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(history); err != nil {
+		logrus.Errorf("helm: get %s release history: %s cluster: write response: %s", rlsName, kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) listReleases(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	kubeID := vars["kubeID"]
+	// TODO: use a struct for input parameters
+	rlsList, err := h.svc.ListReleases(r.Context(), kubeID, "", "", 0)
+	if err != nil {
 		logrus.Errorf("helm: list releases: %s cluster: %s", kubeID, err)
 		message.SendUnknownError(w, err)
 		return
@@ -903,6 +996,17 @@ func (h *Handler) deleteReleases(w http.ResponseWriter, r *http.Request) {
 	rlsName := vars["releaseName"]
 	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
 
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); !wait {
+		op, err := h.svc.DeleteReleaseAsync(r.Context(), kubeID, rlsName, purge)
+		if err != nil {
+			logrus.Errorf("helm: delete release: %s cluster: release %s: %s", kubeID, rlsName, err)
+			sendHelmError(w, kubeID, err)
+			return
+		}
+		sendHelmOperation(w, op)
+		return
+	}
+
 	rls, err := h.svc.DeleteRelease(r.Context(), kubeID, rlsName, purge)
 	if err != nil {
 		logrus.Errorf("helm: delete release: %s cluster: release %s: %s", kubeID, rlsName, err)
@@ -916,6 +1020,93 @@ func (h *Handler) deleteReleases(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rollbackRelease reverts the release to the revision from the query, the
+// previous revision is used if it's not set.
+func (h *Handler) rollbackRelease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	kubeID := vars["kubeID"]
+	rlsName := vars["releaseName"]
+
+	var revision int64
+	if v := r.URL.Query().Get("revision"); v != "" {
+		var err error
+		if revision, err = strconv.ParseInt(v, 10, 32); err != nil || revision < 0 {
+			message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "revision %q", v))
+			return
+		}
+	}
+
+	rls, err := h.svc.RollbackRelease(r.Context(), kubeID, rlsName, int32(revision))
+	if err != nil {
+		logrus.Errorf("helm: rollback release: %s cluster: release %s: %s", kubeID, rlsName, err)
+		sendHelmError(w, rlsName, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(rls); err != nil {
+		logrus.Errorf("helm: rollback release: %s cluster: write response: %s", kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
+
+// listHelmOperations shows queued and recently finished release operations of the cluster.
+func (h *Handler) listHelmOperations(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	ops, err := h.svc.HelmOperations(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		logrus.Errorf("helm: list operations: %s cluster: %s", kubeID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(ops); err != nil {
+		logrus.Errorf("helm: list operations: %s cluster: write response: %s", kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getHelmOperation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID := vars["kubeID"]
+	opID := vars["operationID"]
+
+	op, err := h.svc.HelmOperation(r.Context(), kubeID, opID)
+	if err != nil {
+		sendHelmError(w, opID, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(op); err != nil {
+		logrus.Errorf("helm: get operation %s: %s cluster: write response: %s", opID, kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
+
+// sendHelmOperation points the client to the queued operation, it is polled
+// until it has succeeded or failed.
+func sendHelmOperation(w http.ResponseWriter, op *HelmOperation) {
+	w.Header().Set("Location", path.Join(permission.APIPrefix, "kubes", op.KubeID, "helm", "operations", op.ID))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(op); err != nil {
+		logrus.Errorf("helm: %s release %s: %s cluster: write response: %s",
+			op.Type, op.Release, op.KubeID, err)
+	}
+}
+
+func sendHelmError(w http.ResponseWriter, entity string, err error) {
+	if sgerrors.IsNotFound(err) {
+		message.SendNotFound(w, entity, err)
+		return
+	}
+	message.SendUnknownError(w, err)
+}
+
 func (h *Handler) getClusterMetrics(w http.ResponseWriter, r *http.Request) {
 	var (
 		metricsRelUrls = map[string]string{
@@ -1206,5 +1397,371 @@ func (h *Handler) restartKubeProvisioning(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the rest of provisioning tasks are sub-tasks of the cluster task
+	if ids := k.Tasks[workflows.ClusterTask]; len(ids) > 0 {
+		workflows.SendAccepted(w, ids[0], nil)
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// updateKubelet regenerates kubelet configuration of all cluster machines
+// from the current kube profile and restarts kubelets one machine at a time.
+func (h *Handler) updateKubelet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID := vars["kubeID"]
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	kubeProfile, err := h.profileSvc.Get(r.Context(), k.ProfileID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, k.ProfileID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	// profiles stored before kubelet settings were validated
+	if err = kubeProfile.Kubelet.Validate(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, k.AccountName, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	machines := rolloutOrder(k)
+	tasks := make([]*workflows.Task, 0, len(machines))
+	configs := make([]*steps.Config, 0, len(machines))
+	taskIDs := make([]string, 0, len(machines))
+
+	group, err := workflows.NewTaskGroup(h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	for _, m := range machines {
+		t, err := newRolloutTask(workflows.UpdateKubelet, group, tasks, h.repo)
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		config := &steps.Config{
+			Kube:             *k,
+			Provider:         k.Provider,
+			IsMaster:         m.Role == model.RoleMaster,
+			ClusterID:        k.ID,
+			ClusterName:      k.Name,
+			CloudAccountName: k.AccountName,
+			Node:             *m,
+			KubeletConfig:    steps.NewKubeletConfig(kubeProfile.Kubelet),
+		}
+
+		if err := util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		tasks = append(tasks, t)
+		configs = append(configs, config)
+		taskIDs = append(taskIDs, t.ID)
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	k.Tasks[workflows.KubeletTask] = append(k.Tasks[workflows.KubeletTask], taskIDs...)
+
+	if err := h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	// Restart kubelets one by one, so only a single machine is affected
+	// at a time.
+	go h.rollOut(kubeID, workflows.UpdateKubelet, tasks, configs)
+
+	workflows.SendAccepted(w, group.ID, taskIDs)
+}
+
+// patchNodes applies OS and container runtime updates to cluster nodes
+// one at a time, each node is drained before patching and uncordoned after.
+func (h *Handler) patchNodes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID := vars["kubeID"]
+
+	patchConfig := steps.PatchConfig{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&patchConfig); err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, k.AccountName, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	// NOTE: masters are not patched, drain runs kubectl on a master
+	// and draining the only master makes cluster unmanageable.
+	nodes := activeMachines(k.Nodes)
+	tasks := make([]*workflows.Task, 0, len(nodes))
+	configs := make([]*steps.Config, 0, len(nodes))
+	nodeTasks := make(map[string]string, len(nodes))
+
+	group, err := workflows.NewTaskGroup(h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	for _, n := range nodes {
+		t, err := newRolloutTask(workflows.PatchNode, group, tasks, h.repo)
+		if err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		config := &steps.Config{
+			Kube:             *k,
+			Provider:         k.Provider,
+			ClusterID:        k.ID,
+			ClusterName:      k.Name,
+			CloudAccountName: k.AccountName,
+			Node:             *n,
+			Masters:          steps.NewMap(k.Masters),
+			DrainConfig: steps.DrainConfig{
+				PrivateIP: n.PrivateIp,
+			},
+			PatchConfig: patchConfig,
+		}
+
+		if err := util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		tasks = append(tasks, t)
+		configs = append(configs, config)
+		nodeTasks[n.Name] = t.ID
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	for _, t := range tasks {
+		k.Tasks[workflows.PatchTask] = append(k.Tasks[workflows.PatchTask], t.ID)
+	}
+
+	if err := h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	go h.rollOut(kubeID, workflows.PatchNode, tasks, configs)
+
+	workflows.SendAccepted(w, group.ID, nodeTasks)
+}
+
+// newRolloutTask creates a task of the rollout group that depends on the task
+// of the previous machine, so machines are changed one after another.
+func newRolloutTask(workflow string, group *workflows.Task, prev []*workflows.Task,
+	repo storage.Interface) (*workflows.Task, error) {
+	if len(prev) == 0 {
+		return workflows.NewSubTask(workflow, group, repo)
+	}
+	return workflows.NewSubTask(workflow, group, repo, prev[len(prev)-1])
+}
+
+func (h *Handler) rollOut(kubeID, workflow string, tasks []*workflows.Task, configs []*steps.Config) {
+	rollOut(h.getWriter, kubeID, workflow, tasks, configs)
+}
+
+// rollOut runs tasks one after another, tasks after the first failure fail
+// without changing their machines, results of each machine can be tracked
+// by its task status and of the whole rollout by the status of the group.
+func rollOut(getWriter func(string) (io.WriteCloser, error), kubeID, workflow string,
+	tasks []*workflows.Task, configs []*steps.Config) {
+	failed := false
+	for i, t := range tasks {
+		writer, err := getWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			logrus.Errorf("%s on cluster %s: get writer: %v", workflow, kubeID, err)
+			return
+		}
+
+		if err = <-t.Run(context.Background(), *configs[i], writer); err != nil {
+			logrus.Errorf("%s on machine %s of cluster %s caused %v",
+				workflow, configs[i].Node.Name, kubeID, err)
+			failed = true
+		}
+	}
+	if failed {
+		return
+	}
+	logrus.Infof("%s on cluster %s has finished", workflow, kubeID)
+}
+
+func (h *Handler) getCapacity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID := vars["kubeID"]
+
+	threshold, err := parseThreshold(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.svc.Capacity(r.Context(), kubeID, threshold)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// checkUpgrade reports objects that use apis removed in the kubernetes version
+// from the query, the cluster should not be upgraded until they are migrated.
+func (h *Handler) checkUpgrade(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		message.SendValidationFailed(w, errors.New("version is required"))
+		return
+	}
+
+	report, err := h.svc.UpgradeCheck(r.Context(), kubeID, version)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// listCapacity returns capacity reports of all operational clusters,
+// clusters above the threshold go first.
+func (h *Handler) listCapacity(w http.ResponseWriter, r *http.Request) {
+	threshold, err := parseThreshold(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kubes, err := h.svc.ListAll(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	reports := make([]*CapacityReport, 0, len(kubes))
+	for _, k := range kubes {
+		if k.State != model.StateOperational {
+			continue
+		}
+
+		report, err := h.svc.Capacity(r.Context(), k.ID, threshold)
+		if err != nil {
+			logrus.Warnf("get capacity of cluster %s: %v", k.ID, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].OverThreshold && !reports[j].OverThreshold
+	})
+
+	if err = json.NewEncoder(w).Encode(reports); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func parseThreshold(r *http.Request) (float64, error) {
+	raw := r.URL.Query().Get("threshold")
+	if raw == "" {
+		return DefaultUtilizationThreshold, nil
+	}
+
+	threshold, err := strconv.ParseFloat(raw, 64)
+	if err != nil || threshold <= 0 || threshold > 100 {
+		return 0, errors.Errorf("invalid threshold %q, must be in (0, 100]", raw)
+	}
+
+	return threshold, nil
+}
+
+// rolloutOrder returns active cluster machines, masters go first.
+func rolloutOrder(k *model.Kube) []*model.Machine {
+	masters := activeMachines(k.Masters)
+	nodes := activeMachines(k.Nodes)
+
+	return append(masters, nodes...)
+}
+
+func activeMachines(machines map[string]*model.Machine) []*model.Machine {
+	out := make([]*model.Machine, 0, len(machines))
+	for _, m := range machines {
+		if m != nil && m.State == model.MachineStateActive {
+			out = append(out, m)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
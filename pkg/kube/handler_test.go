@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/proto/hapi/release"
 
@@ -26,6 +28,7 @@ import (
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/proxy"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
 	"github.com/supergiant/control/pkg/testutils"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps"
@@ -71,6 +74,9 @@ type kubeServiceMock struct {
 	rlsInfo     *model.ReleaseInfo
 	rlsInfoList []*model.ReleaseInfo
 	rlsErr      error
+	// exec is run with streams of ExecInPod, they aren't passed to the
+	// mock as it prints arguments while the handler is using them
+	exec func(streams ExecStreams)
 }
 
 type accServiceMock struct {
@@ -123,20 +129,42 @@ func (b *bufferCloser) Close() error {
 }
 
 const (
-	serviceCreate            = "Create"
-	serviceGet               = "Get"
-	serviceListAll           = "ListAll"
-	serviceDelete            = "Delete"
-	serviceListKubeResources = "ListKubeResources"
-	serviceListNodes         = "ListNodes"
-	serviceKubeConfigFor     = "KubeConfigFor"
-	serviceGetKubeResources  = "GetKubeResources"
-	serviceGetCerts          = "GetCerts"
+	serviceCreate             = "Create"
+	serviceGet                = "Get"
+	serviceUpdate             = "Update"
+	serviceListAll            = "ListAll"
+	serviceListAllTenants     = "ListAllTenants"
+	serviceDelete             = "Delete"
+	serviceListKubeResources  = "ListKubeResources"
+	serviceListNodes          = "ListNodes"
+	serviceCordonNode         = "CordonNode"
+	serviceUncordonNode       = "UncordonNode"
+	serviceDrainNode          = "DrainNode"
+	serviceKubeConfigFor      = "KubeConfigFor"
+	serviceGetKubeResources   = "GetKubeResources"
+	serviceWatchKubeResources = "WatchKubeResources"
+	servicePodLogs            = "PodLogs"
+	serviceExecInPod          = "ExecInPod"
+	servicePostKubeResource   = "PostKubeResource"
+	servicePatchKubeResource  = "PatchKubeResource"
+	serviceDeleteKubeResource = "DeleteKubeResource"
+	serviceGetCerts           = "GetCerts"
+	serviceCapacity           = "Capacity"
+	serviceUpgradeCheck       = "UpgradeCheck"
+	serviceInventory          = "Inventory"
+	serviceFleetInventory     = "FleetInventory"
+	serviceHelmOperations     = "HelmOperations"
+	serviceHelmOperation      = "HelmOperation"
+	serviceInstallAsync       = "InstallReleaseAsync"
+	serviceUpgradeAsync       = "UpgradeReleaseAsync"
+	serviceDeleteAsync        = "DeleteReleaseAsync"
+	serviceFleetReleases      = "ListFleetReleases"
+	serviceMigrateReleases    = "MigrateReleases"
 )
 
-func (m *mockNodeProvisioner) ProvisionNodes(ctx context.Context, nodeProfile []profile.NodeProfile, kube *model.Kube, config *steps.Config) ([]string, error) {
+func (m *mockNodeProvisioner) ProvisionNodes(ctx context.Context, nodeProfile []profile.NodeProfile, kube *model.Kube, config *steps.Config) ([]*workflows.Task, error) {
 	args := m.Called(ctx, nodeProfile, kube, config)
-	val, ok := args.Get(0).([]string)
+	val, ok := args.Get(0).([]*workflows.Task)
 	if !ok {
 		return nil, args.Error(1)
 	}
@@ -168,6 +196,17 @@ func (m *kubeServiceMock) Get(ctx context.Context, name string) (*model.Kube, er
 	}
 	return val, args.Error(1)
 }
+func (m *kubeServiceMock) Update(ctx context.Context, name string, change func(*model.Kube) error) (*model.Kube, error) {
+	args := m.Called(ctx, name)
+	val, ok := args.Get(0).(*model.Kube)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	if err := change(val); err != nil {
+		return nil, err
+	}
+	return val, args.Error(1)
+}
 func (m *kubeServiceMock) KubeConfigFor(ctx context.Context, kname, user string) ([]byte, error) {
 	args := m.Called(ctx, kname, user)
 	val, ok := args.Get(0).([]byte)
@@ -176,6 +215,14 @@ func (m *kubeServiceMock) KubeConfigFor(ctx context.Context, kname, user string)
 	}
 	return val, args.Error(1)
 }
+func (m *kubeServiceMock) IssueKubeConfig(ctx context.Context, kubeID, user string, req UserKubeConfigRequest) ([]byte, error) {
+	args := m.Called(ctx, kubeID, user, req)
+	val, ok := args.Get(0).([]byte)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
 func (m *kubeServiceMock) ListAll(ctx context.Context) ([]model.Kube, error) {
 	args := m.Called(ctx)
 	val, ok := args.Get(0).([]model.Kube)
@@ -184,6 +231,14 @@ func (m *kubeServiceMock) ListAll(ctx context.Context) ([]model.Kube, error) {
 	}
 	return val, args.Error(1)
 }
+func (m *kubeServiceMock) ListAllTenants(ctx context.Context) ([]model.Kube, error) {
+	args := m.Called(ctx)
+	val, ok := args.Get(0).([]model.Kube)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
 
 func (m *kubeServiceMock) Delete(ctx context.Context, name string) error {
 	args := m.Called(ctx, name)
@@ -208,8 +263,68 @@ func (m *kubeServiceMock) ListKubeResources(ctx context.Context, kname string) (
 	return val, args.Error(1)
 }
 
-func (m *kubeServiceMock) GetKubeResources(ctx context.Context, kname, resource, ns, name string) ([]byte, error) {
-	args := m.Called(ctx, kname, resource, ns, name)
+func (m *kubeServiceMock) WatchKubeResources(ctx context.Context, kubeID, resource, ns string, opts metav1.ListOptions) (<-chan WatchEvent, error) {
+	args := m.Called(ctx, kubeID, resource, ns, opts)
+	val, ok := args.Get(0).(chan WatchEvent)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) CordonNode(ctx context.Context, kubeID, node string) error {
+	args := m.Called(ctx, kubeID, node)
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) UncordonNode(ctx context.Context, kubeID, node string) error {
+	args := m.Called(ctx, kubeID, node)
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) DrainNode(ctx context.Context, kubeID, node string, opts DrainOptions) (*DrainReport, error) {
+	args := m.Called(ctx, kubeID, node, opts)
+	val, ok := args.Get(0).(*DrainReport)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) ExecInPod(ctx context.Context, kubeID, ns, pod string, opts ExecOptions, streams ExecStreams) error {
+	args := m.Called(ctx, kubeID, ns, pod, opts)
+	if m.exec != nil {
+		m.exec(streams)
+	}
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) PodLogs(ctx context.Context, kubeID, ns, pod, container string, opts LogOptions, w io.Writer) error {
+	args := m.Called(ctx, kubeID, ns, pod, container, opts, w)
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) GetKubeResources(ctx context.Context, kname, resource, ns, name string, opts metav1.ListOptions) ([]byte, error) {
+	args := m.Called(ctx, kname, resource, ns, name, opts)
+	val, ok := args.Get(0).([]byte)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) PostKubeResource(ctx context.Context, kname, resource, ns string, manifest []byte) ([]byte, error) {
+	args := m.Called(ctx, kname, resource, ns, manifest)
+	val, ok := args.Get(0).([]byte)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) PatchKubeResource(ctx context.Context, kname, resource, ns, name string,
+	patchType types.PatchType, patch []byte) ([]byte, error) {
+	args := m.Called(ctx, kname, resource, ns, name, patchType, patch)
 	val, ok := args.Get(0).([]byte)
 	if !ok {
 		return nil, args.Error(1)
@@ -217,6 +332,11 @@ func (m *kubeServiceMock) GetKubeResources(ctx context.Context, kname, resource,
 	return val, args.Error(1)
 }
 
+func (m *kubeServiceMock) DeleteKubeResource(ctx context.Context, kname, resource, ns, name string) error {
+	args := m.Called(ctx, kname, resource, ns, name)
+	return args.Error(0)
+}
+
 func (m *kubeServiceMock) GetCerts(ctx context.Context, kname, cname string) (*Bundle, error) {
 	args := m.Called(ctx, kname, cname)
 	val, ok := args.Get(0).(*Bundle)
@@ -229,10 +349,18 @@ func (m *kubeServiceMock) InstallRelease(ctx context.Context,
 	kname string, rls *ReleaseInput) (*release.Release, error) {
 	return m.rls, m.rlsErr
 }
+func (m *kubeServiceMock) UpgradeRelease(ctx context.Context,
+	kname, rlsName string, rls *ReleaseInput) (*release.Release, error) {
+	return m.rls, m.rlsErr
+}
 func (m *kubeServiceMock) ReleaseDetails(ctx context.Context,
 	kname string, rlsName string) (*release.Release, error) {
 	return m.rls, m.rlsErr
 }
+func (m *kubeServiceMock) ReleaseHistory(ctx context.Context,
+	kname, rlsName string, max int) ([]*model.ReleaseInfo, error) {
+	return m.rlsInfoList, m.rlsErr
+}
 func (m *kubeServiceMock) ListReleases(ctx context.Context,
 	kname, ns, offset string, limit int) ([]*model.ReleaseInfo, error) {
 	return m.rlsInfoList, m.rlsErr
@@ -241,6 +369,176 @@ func (m *kubeServiceMock) DeleteRelease(ctx context.Context,
 	kname, rlsName string, purge bool) (*model.ReleaseInfo, error) {
 	return m.rlsInfo, m.rlsErr
 }
+func (m *kubeServiceMock) RollbackRelease(ctx context.Context,
+	kname, rlsName string, revision int32) (*model.ReleaseInfo, error) {
+	return m.rlsInfo, m.rlsErr
+}
+
+func (m *kubeServiceMock) Capacity(ctx context.Context, kname string, threshold float64) (*CapacityReport, error) {
+	args := m.Called(ctx, kname, threshold)
+	val, ok := args.Get(0).(*CapacityReport)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) UpgradeCheck(ctx context.Context, kname, version string) (*UpgradeReport, error) {
+	args := m.Called(ctx, kname, version)
+	val, ok := args.Get(0).(*UpgradeReport)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) Inventory(ctx context.Context, kname string) (*ClusterInventory, error) {
+	args := m.Called(ctx, kname)
+	val, ok := args.Get(0).(*ClusterInventory)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) FleetInventory(ctx context.Context, filter InventoryFilter) ([]ClusterInventory, error) {
+	args := m.Called(ctx, filter)
+	val, ok := args.Get(0).([]ClusterInventory)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) HelmOperations(ctx context.Context, kname string) ([]HelmOperation, error) {
+	args := m.Called(ctx, kname)
+	val, ok := args.Get(0).([]HelmOperation)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) CreateSnapshots(ctx context.Context, kname string, req *SnapshotRequest) ([]VolumeSnapshot, error) {
+	args := m.Called(ctx, kname, req)
+	val, ok := args.Get(0).([]VolumeSnapshot)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) ListSnapshots(ctx context.Context, kname, ns string) ([]VolumeSnapshot, error) {
+	args := m.Called(ctx, kname, ns)
+	val, ok := args.Get(0).([]VolumeSnapshot)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) RestoreSnapshot(ctx context.Context, kname, ns, name string, req *RestoreRequest) error {
+	args := m.Called(ctx, kname, ns, name, req)
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) Metrics(ctx context.Context, kname string) (*ClusterUsage, error) {
+	args := m.Called(ctx, kname)
+	val, ok := args.Get(0).(*ClusterUsage)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) ReleaseResources(ctx context.Context, kname, rlsName string) (*ReleaseResourceReport, error) {
+	args := m.Called(ctx, kname, rlsName)
+	val, ok := args.Get(0).(*ReleaseResourceReport)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) GrantAccess(ctx context.Context, kname, user string, req *AccessRequest) (*model.AccessGrant, error) {
+	args := m.Called(ctx, kname, user, req)
+	val, ok := args.Get(0).(*model.AccessGrant)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) AccessKubeConfig(ctx context.Context, kname, grantID string) ([]byte, error) {
+	args := m.Called(ctx, kname, grantID)
+	val, ok := args.Get(0).([]byte)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) RevokeAccess(ctx context.Context, kname, grantID string) error {
+	args := m.Called(ctx, kname, grantID)
+	return args.Error(0)
+}
+
+func (m *kubeServiceMock) HelmOperation(ctx context.Context, kname, opID string) (*HelmOperation, error) {
+	args := m.Called(ctx, kname, opID)
+	val, ok := args.Get(0).(*HelmOperation)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) InstallReleaseAsync(ctx context.Context,
+	kname string, rls *ReleaseInput) (*HelmOperation, error) {
+	args := m.Called(ctx, kname, rls)
+	val, ok := args.Get(0).(*HelmOperation)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) UpgradeReleaseAsync(ctx context.Context,
+	kname, rlsName string, rls *ReleaseInput) (*HelmOperation, error) {
+	args := m.Called(ctx, kname, rlsName, rls)
+	val, ok := args.Get(0).(*HelmOperation)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) DeleteReleaseAsync(ctx context.Context,
+	kname, rlsName string, purge bool) (*HelmOperation, error) {
+	args := m.Called(ctx, kname, rlsName, purge)
+	val, ok := args.Get(0).(*HelmOperation)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) ListFleetReleases(ctx context.Context, filter ReleaseFilter) ([]ClusterReleases, error) {
+	args := m.Called(ctx, filter)
+	val, ok := args.Get(0).([]ClusterReleases)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
+func (m *kubeServiceMock) MigrateReleases(ctx context.Context, kname string, req *MigrationRequest) (*MigrationReport, error) {
+	args := m.Called(ctx, kname, req)
+	val, ok := args.Get(0).(*MigrationReport)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
 
 type mockContainter struct {
 	mock.Mock
@@ -566,6 +864,27 @@ func TestHandler_deleteKube(t *testing.T) {
 			deleteKubeError: nil,
 			expectedStatus:  http.StatusAccepted,
 		},
+		{
+			description:     "externally managed",
+			kubeName:        "imported",
+			accountName:     "test",
+			getAccountError: sgerrors.ErrNotFound,
+			kube: &model.Kube{
+				Name:              "imported",
+				ExternallyManaged: true,
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			description: "externally managed delete error",
+			kubeName:    "imported",
+			kube: &model.Kube{
+				Name:              "imported",
+				ExternallyManaged: true,
+			},
+			deleteKubeError: errors.New("error"),
+			expectedStatus:  http.StatusInternalServerError,
+		},
 	}
 
 	for i, tc := range tcs {
@@ -726,7 +1045,7 @@ func TestHandler_getResources(t *testing.T) {
 		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/kubes/%s/resources/%s", tc.kubeName, tc.resourceName), nil)
 		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
 
-		svc.On(serviceGetKubeResources, mock.Anything, tc.kubeName, mock.Anything, mock.Anything, mock.Anything).
+		svc.On(serviceGetKubeResources, mock.Anything, tc.kubeName, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(tc.serviceResources, tc.serviceError)
 		rr := httptest.NewRecorder()
 
@@ -917,8 +1236,8 @@ func TestAddNodeToKube(t *testing.T) {
 		svc := new(kubeServiceMock)
 		svc.On(serviceGet, mock.Anything, mock.Anything).
 			Return(testCase.kube, testCase.kubeServiceErr)
-		svc.On(serviceCreate, mock.Anything, mock.Anything).
-			Return(nil)
+		svc.On(serviceUpdate, mock.Anything, mock.Anything).
+			Return(testCase.kube, nil)
 
 		accService := new(accServiceMock)
 		accService.On("Get", mock.Anything, mock.Anything).
@@ -927,7 +1246,7 @@ func TestAddNodeToKube(t *testing.T) {
 		mockProvisioner := new(mockNodeProvisioner)
 		mockProvisioner.On("ProvisionNodes",
 			mock.Anything, nodeProfile, testCase.kube, mock.Anything).
-			Return(mock.Anything, testCase.provisionErr)
+			Return([]*workflows.Task{{ID: "node", ParentID: "group"}}, testCase.provisionErr)
 		mockProvisioner.On("Cancel", mock.Anything).
 			Return(nil)
 		h := NewHandler(svc, accService, nil,
@@ -950,6 +1269,10 @@ func TestAddNodeToKube(t *testing.T) {
 			t.Errorf("Wrong error code expected %d actual %d",
 				testCase.expectedCode, rec.Code)
 		}
+
+		if rec.Code == http.StatusAccepted {
+			require.Equal(t, workflows.TaskLocation("group"), rec.Header().Get("Location"))
+		}
 	}
 }
 
@@ -1104,8 +1427,10 @@ func TestDeleteNodeFromKube(t *testing.T) {
 		svc := new(kubeServiceMock)
 		svc.On(serviceGet, mock.Anything, mock.Anything).
 			Return(testCase.kube, testCase.kubeServiceErr)
-		svc.On(serviceCreate, mock.Anything, testCase.kube).
-			Return(mock.Anything)
+		svc.On(serviceUpdate, mock.Anything, mock.Anything).
+			Return(testCase.kube, nil)
+		svc.On(serviceDrainNode, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, sgerrors.ErrNotFound)
 
 		accService := new(accServiceMock)
 		accService.On("Get", mock.Anything, mock.Anything).
@@ -1118,11 +1443,21 @@ func TestDeleteNodeFromKube(t *testing.T) {
 		mockRepo.On("Delete", mock.Anything, mock.Anything, mock.Anything).
 			Return(nil)
 
+		deleted := make(chan struct{})
 		handler := Handler{
-			svc:            svc,
-			accountService: accService,
-			getWriter:      testCase.getWriter,
-			repo:           mockRepo,
+			svc: svc,
+			nodeDeleter: &NodeDeleter{
+				svc:            svc,
+				accountService: accService,
+				repo:           mockRepo,
+				deleteK8sNode: func(*model.Kube, string) error {
+					return nil
+				},
+				getWriter: func(name string) (io.WriteCloser, error) {
+					defer close(deleted)
+					return testCase.getWriter(name)
+				},
+			},
 		}
 
 		router := mux.NewRouter()
@@ -1136,6 +1471,9 @@ func TestDeleteNodeFromKube(t *testing.T) {
 		if rec.Code != testCase.expectedCode {
 			t.Errorf("Wrong response code expected %d actual %d", testCase.expectedCode, rec.Code)
 		}
+		if rec.Code == http.StatusAccepted {
+			<-deleted
+		}
 	}
 }
 
@@ -1428,6 +1766,7 @@ func TestGetTasks(t *testing.T) {
 func TestHandler_installRelease(t *testing.T) {
 	tcs := []struct {
 		rlsInp string
+		noWait bool
 
 		kubeSvc *kubeServiceMock
 
@@ -1451,6 +1790,14 @@ func TestHandler_installRelease(t *testing.T) {
 			expectedStatus:  http.StatusBadRequest,
 			expectedErrCode: sgerrors.ValidationFailed,
 		},
+		{
+			rlsInp: `{"chartName":"nginx","namespace":"default","repoName":"fake","timeout":3600}`,
+			kubeSvc: &kubeServiceMock{
+				rls: deployedRelease,
+			},
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.ValidationFailed,
+		},
 		{
 			rlsInp: deployedReleaseInput,
 			kubeSvc: &kubeServiceMock{
@@ -1467,6 +1814,15 @@ func TestHandler_installRelease(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedRls:    deployedRelease,
 		},
+		{
+			rlsInp: `{"chartName":"nginx","namespace":"default","repoName":"fake","dryRun":true}`,
+			noWait: true,
+			kubeSvc: &kubeServiceMock{
+				rls: deployedRelease,
+			},
+			expectedStatus: http.StatusOK,
+			expectedRls:    deployedRelease,
+		},
 	}
 
 	for i, tc := range tcs {
@@ -1477,9 +1833,13 @@ func TestHandler_installRelease(t *testing.T) {
 		h.Register(router)
 
 		// prepare
+		url := "/kubes/fake/releases?wait=true"
+		if tc.noWait {
+			url = "/kubes/fake/releases"
+		}
 		req, err := http.NewRequest(
 			http.MethodPost,
-			"/kubes/fake/releases",
+			url,
 			strings.NewReader(tc.rlsInp))
 		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
 
@@ -1505,8 +1865,10 @@ func TestHandler_installRelease(t *testing.T) {
 	}
 }
 
-func TestHandler_getRelease(t *testing.T) {
+func TestHandler_upgradeRelease(t *testing.T) {
 	tcs := []struct {
+		rlsInp string
+
 		kubeSvc *kubeServiceMock
 
 		expectedRls     *release.Release
@@ -1514,6 +1876,27 @@ func TestHandler_getRelease(t *testing.T) {
 		expectedErrCode sgerrors.ErrorCode
 	}{
 		{
+			rlsInp:          "{{}",
+			kubeSvc:         &kubeServiceMock{},
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.InvalidJSON,
+		},
+		{
+			rlsInp:          "{}",
+			kubeSvc:         &kubeServiceMock{},
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.ValidationFailed,
+		},
+		{
+			rlsInp: deployedReleaseInput,
+			kubeSvc: &kubeServiceMock{
+				rlsErr: sgerrors.ErrNotFound,
+			},
+			expectedStatus:  http.StatusNotFound,
+			expectedErrCode: sgerrors.NotFound,
+		},
+		{
+			rlsInp: deployedReleaseInput,
 			kubeSvc: &kubeServiceMock{
 				rlsErr: errFake,
 			},
@@ -1521,6 +1904,7 @@ func TestHandler_getRelease(t *testing.T) {
 			expectedErrCode: sgerrors.UnknownError,
 		},
 		{
+			rlsInp: deployedReleaseInput,
 			kubeSvc: &kubeServiceMock{
 				rls: deployedRelease,
 			},
@@ -1530,30 +1914,25 @@ func TestHandler_getRelease(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		// setup handler
 		h := &Handler{svc: tc.kubeSvc}
 
 		router := mux.NewRouter()
 		h.Register(router)
 
-		// prepare
 		req, err := http.NewRequest(
-			http.MethodGet,
-			"/kubes/fake/releases/releaseName",
-			nil)
+			http.MethodPut,
+			"/kubes/fake/releases/fake?wait=true",
+			strings.NewReader(tc.rlsInp))
 		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
 
 		w := httptest.NewRecorder()
-
-		// run
 		router.ServeHTTP(w, req)
 
-		// check
 		require.Equalf(t, tc.expectedStatus, w.Code, "TC#%d: check status code", i+1)
 
 		if w.Code == http.StatusOK {
 			rlsInfo := &release.Release{}
-			require.Nilf(t, json.NewDecoder(w.Body).Decode(rlsInfo), "TC#%d: decode chart", i+1)
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(rlsInfo), "TC#%d: decode release", i+1)
 
 			require.Equalf(t, tc.expectedRls, rlsInfo, "TC#%d: check release", i+1)
 		} else {
@@ -1565,10 +1944,151 @@ func TestHandler_getRelease(t *testing.T) {
 	}
 }
 
-func TestHandler_listReleases(t *testing.T) {
-	tcs := []struct {
-		kubeSvc *kubeServiceMock
-
+func TestHandler_upgradeReleaseAsync(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		op             *HelmOperation
+		err            error
+		expectedStatus int
+	}{
+		{
+			name:           "not found",
+			err:            sgerrors.ErrNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "error",
+			err:            errFake,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "accepted",
+			op: &HelmOperation{
+				ID:      "op",
+				KubeID:  "fake",
+				Type:    HelmOpUpgrade,
+				Release: "fake",
+				Status:  HelmOpQueued,
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceUpgradeAsync, mock.Anything, "fake", "fake", mock.Anything).
+			Return(tc.op, tc.err)
+		h := &Handler{svc: svc}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodPut, "/kubes/fake/releases/fake",
+			strings.NewReader(deployedReleaseInput))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, tc.expectedStatus, w.Code, "TC: %s", tc.name)
+		if w.Code != http.StatusAccepted {
+			continue
+		}
+		require.Equal(t, "/v1/api/kubes/fake/helm/operations/op", w.Header().Get("Location"), "TC: %s", tc.name)
+
+		op := &HelmOperation{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(op), "TC: %s", tc.name)
+		require.Equal(t, tc.op, op, "TC: %s", tc.name)
+	}
+}
+
+func TestDecodeReleaseInput(t *testing.T) {
+	values := "replicaCount: 2\nimage:\n  tag: \"1.15\"\n"
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	valuesPart, err := form.CreateFormFile("values", "values.yaml")
+	require.NoError(t, err)
+	_, err = valuesPart.Write([]byte(values))
+	require.NoError(t, err)
+	require.NoError(t, form.WriteField("release", deployedReleaseInput))
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/kubes/fake/releases", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	inp := &ReleaseInput{}
+	require.NoError(t, decodeReleaseInput(req, inp))
+	require.Equal(t, "nginx", inp.ChartName)
+	require.Equal(t, "fake", inp.RepoName)
+	require.Equal(t, values, inp.Values)
+
+	req = httptest.NewRequest(http.MethodPost, "/kubes/fake/releases", strings.NewReader(`{"values":"a: b"}`))
+	inp = &ReleaseInput{}
+	require.NoError(t, decodeReleaseInput(req, inp))
+	require.Equal(t, "a: b", inp.Values)
+}
+
+func TestHandler_getRelease(t *testing.T) {
+	tcs := []struct {
+		kubeSvc *kubeServiceMock
+
+		expectedRls     *release.Release
+		expectedStatus  int
+		expectedErrCode sgerrors.ErrorCode
+	}{
+		{
+			kubeSvc: &kubeServiceMock{
+				rlsErr: errFake,
+			},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedErrCode: sgerrors.UnknownError,
+		},
+		{
+			kubeSvc: &kubeServiceMock{
+				rls: deployedRelease,
+			},
+			expectedStatus: http.StatusOK,
+			expectedRls:    deployedRelease,
+		},
+	}
+
+	for i, tc := range tcs {
+		// setup handler
+		h := &Handler{svc: tc.kubeSvc}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		// prepare
+		req, err := http.NewRequest(
+			http.MethodGet,
+			"/kubes/fake/releases/releaseName",
+			nil)
+		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
+
+		w := httptest.NewRecorder()
+
+		// run
+		router.ServeHTTP(w, req)
+
+		// check
+		require.Equalf(t, tc.expectedStatus, w.Code, "TC#%d: check status code", i+1)
+
+		if w.Code == http.StatusOK {
+			rlsInfo := &release.Release{}
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(rlsInfo), "TC#%d: decode chart", i+1)
+
+			require.Equalf(t, tc.expectedRls, rlsInfo, "TC#%d: check release", i+1)
+		} else {
+			apiErr := &message.Message{}
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(apiErr), "TC#%d: decode message", i+1)
+
+			require.Equalf(t, tc.expectedErrCode, apiErr.ErrorCode, "TC#%d: check error code", i+1)
+		}
+	}
+}
+
+func TestHandler_listReleases(t *testing.T) {
+	tcs := []struct {
+		kubeSvc *kubeServiceMock
+
 		expectedRlsInfoList []*model.ReleaseInfo
 		expectedStatus      int
 		expectedErrCode     sgerrors.ErrorCode
@@ -1731,7 +2251,7 @@ func TestHandler_deleteRelease(t *testing.T) {
 		// prepare
 		req, err := http.NewRequest(
 			http.MethodDelete,
-			"/kubes/fake/releases/releaseName",
+			"/kubes/fake/releases/releaseName?wait=true",
 			nil)
 		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
 
@@ -1757,6 +2277,148 @@ func TestHandler_deleteRelease(t *testing.T) {
 	}
 }
 
+func TestHandler_getReleaseHistory(t *testing.T) {
+	tcs := []struct {
+		max     string
+		kubeSvc *kubeServiceMock
+
+		expectedHistory []*model.ReleaseInfo
+		expectedStatus  int
+		expectedErrCode sgerrors.ErrorCode
+	}{
+		{
+			max:             "many",
+			kubeSvc:         &kubeServiceMock{},
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.ValidationFailed,
+		},
+		{
+			kubeSvc: &kubeServiceMock{
+				rlsErr: sgerrors.ErrNotFound,
+			},
+			expectedStatus:  http.StatusNotFound,
+			expectedErrCode: sgerrors.NotFound,
+		},
+		{
+			max: "10",
+			kubeSvc: &kubeServiceMock{
+				rlsErr: errFake,
+			},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedErrCode: sgerrors.UnknownError,
+		},
+		{
+			max: "10",
+			kubeSvc: &kubeServiceMock{
+				rlsInfoList: []*model.ReleaseInfo{deletedReleaseInfo},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHistory: []*model.ReleaseInfo{deletedReleaseInfo},
+		},
+	}
+
+	for i, tc := range tcs {
+		h := &Handler{svc: tc.kubeSvc}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req, err := http.NewRequest(
+			http.MethodGet,
+			"/kubes/fake/releases/releaseName/history?max="+tc.max,
+			nil)
+		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equalf(t, tc.expectedStatus, w.Code, "TC#%d: check status code", i+1)
+
+		if w.Code == http.StatusOK {
+			history := make([]*model.ReleaseInfo, 0)
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(&history), "TC#%d: decode history", i+1)
+
+			require.Equalf(t, tc.expectedHistory, history, "TC#%d: check history", i+1)
+		} else {
+			apiErr := &message.Message{}
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(apiErr), "TC#%d: decode message", i+1)
+
+			require.Equalf(t, tc.expectedErrCode, apiErr.ErrorCode, "TC#%d: check error code", i+1)
+		}
+	}
+}
+
+func TestHandler_rollbackRelease(t *testing.T) {
+	tcs := []struct {
+		revision string
+		kubeSvc  *kubeServiceMock
+
+		expectedRlsInfo *model.ReleaseInfo
+		expectedStatus  int
+		expectedErrCode sgerrors.ErrorCode
+	}{
+		{
+			revision:        "-1",
+			kubeSvc:         &kubeServiceMock{},
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.ValidationFailed,
+		},
+		{
+			revision: "2",
+			kubeSvc: &kubeServiceMock{
+				rlsErr: sgerrors.ErrNotFound,
+			},
+			expectedStatus:  http.StatusNotFound,
+			expectedErrCode: sgerrors.NotFound,
+		},
+		{
+			kubeSvc: &kubeServiceMock{
+				rlsErr: errFake,
+			},
+			expectedStatus:  http.StatusInternalServerError,
+			expectedErrCode: sgerrors.UnknownError,
+		},
+		{
+			revision: "2",
+			kubeSvc: &kubeServiceMock{
+				rlsInfo: deletedReleaseInfo,
+			},
+			expectedStatus:  http.StatusOK,
+			expectedRlsInfo: deletedReleaseInfo,
+		},
+	}
+
+	for i, tc := range tcs {
+		h := &Handler{svc: tc.kubeSvc}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/kubes/fake/releases/releaseName/rollback?revision="+tc.revision,
+			nil)
+		require.Equalf(t, nil, err, "TC#%d: create request: %v", i+1, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equalf(t, tc.expectedStatus, w.Code, "TC#%d: check status code", i+1)
+
+		if w.Code == http.StatusOK {
+			rlsInfo := &model.ReleaseInfo{}
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(rlsInfo), "TC#%d: decode release info", i+1)
+
+			require.Equalf(t, tc.expectedRlsInfo, rlsInfo, "TC#%d: check release", i+1)
+		} else {
+			apiErr := &message.Message{}
+			require.Nilf(t, json.NewDecoder(w.Body).Decode(apiErr), "TC#%d: decode message", i+1)
+
+			require.Equalf(t, tc.expectedErrCode, apiErr.ErrorCode, "TC#%d: check error code", i+1)
+		}
+	}
+}
+
 func TestGetClusterMetrics(t *testing.T) {
 	testCases := []struct {
 		kubeServiceGetResp  *model.Kube
@@ -2346,3 +3008,261 @@ func TestGetServices(t *testing.T) {
 		}
 	}
 }
+
+func TestHandler_updateKubelet(t *testing.T) {
+	testCases := []struct {
+		description string
+
+		kube    *model.Kube
+		kubeErr error
+
+		profile    *profile.Profile
+		profileErr error
+
+		account    *model.CloudAccount
+		accountErr error
+
+		expectedCode  int
+		expectedTasks int
+	}{
+		{
+			description:  "kube not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "kube unknown error",
+			kubeErr:      errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			description:  "profile not found",
+			kube:         &model.Kube{ProfileID: "profile"},
+			profileErr:   sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description: "invalid kubelet settings",
+			kube:        &model.Kube{ProfileID: "profile"},
+			profile: &profile.Profile{
+				Kubelet: profile.KubeletSettings{
+					EvictionHard: `memory.available<1Gi" && reboot "`,
+				},
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "account error",
+			kube:         &model.Kube{ProfileID: "profile"},
+			profile:      &profile.Profile{},
+			accountErr:   errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			description: "success",
+			kube: &model.Kube{
+				ID:        "kube",
+				ProfileID: "profile",
+				Masters: map[string]*model.Machine{
+					"master-1": {
+						Name:  "master-1",
+						Role:  model.RoleMaster,
+						State: model.MachineStateActive,
+					},
+				},
+				Nodes: map[string]*model.Machine{
+					"node-1": {
+						Name:  "node-1",
+						Role:  model.RoleNode,
+						State: model.MachineStateActive,
+					},
+					"node-2": {
+						Name:  "node-2",
+						Role:  model.RoleNode,
+						State: model.MachineStateError,
+					},
+				},
+			},
+			profile: &profile.Profile{
+				Kubelet: profile.KubeletSettings{
+					MaxPods: 64,
+				},
+			},
+			account: &model.CloudAccount{
+				Provider: clouds.DigitalOcean,
+			},
+			expectedCode:  http.StatusAccepted,
+			expectedTasks: 2,
+		},
+	}
+
+	workflows.Init()
+	workflows.RegisterWorkFlow(workflows.UpdateKubelet, []steps.Step{})
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, mock.Anything).
+			Return(tc.kube, tc.kubeErr)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).
+			Return(nil)
+
+		profileSvc := new(mockProfileGetter)
+		profileSvc.On("Get", mock.Anything, mock.Anything).
+			Return(tc.profile, tc.profileErr)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(tc.account, tc.accountErr)
+
+		// rollout tasks look up their group and the tasks they depend on
+		repo := memory.NewInMemoryRepository()
+
+		h := Handler{
+			svc:            svc,
+			profileSvc:     profileSvc,
+			accountService: accService,
+			repo:           repo,
+			getWriter: func(string) (io.WriteCloser, error) {
+				return &bufferCloser{}, nil
+			},
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/kubelet", h.updateKubelet)
+
+		req, _ := http.NewRequest(http.MethodPost, "/kubes/kube/kubelet", nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.description)
+
+		if rec.Code != http.StatusAccepted {
+			continue
+		}
+		require.Contains(t, rec.Header().Get("Location"), "/status", "TC: %s", tc.description)
+
+		taskIDs := make([]string, 0)
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&taskIDs))
+		require.Len(t, taskIDs, tc.expectedTasks)
+		require.Equal(t, taskIDs, tc.kube.Tasks[workflows.KubeletTask])
+	}
+}
+
+func TestHandler_patchNodes(t *testing.T) {
+	testCases := []struct {
+		description string
+		body        string
+
+		kube    *model.Kube
+		kubeErr error
+
+		account    *model.CloudAccount
+		accountErr error
+
+		expectedCode  int
+		expectedNodes []string
+	}{
+		{
+			description:  "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "kube not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "account not found",
+			kube:         &model.Kube{AccountName: "acc"},
+			accountErr:   sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description: "success",
+			body:        `{"upgradeRuntime":true}`,
+			kube: &model.Kube{
+				ID: "kube",
+				Masters: map[string]*model.Machine{
+					"master-1": {
+						Name:  "master-1",
+						Role:  model.RoleMaster,
+						State: model.MachineStateActive,
+					},
+				},
+				Nodes: map[string]*model.Machine{
+					"node-1": {
+						Name:      "node-1",
+						PrivateIp: "10.0.0.1",
+						State:     model.MachineStateActive,
+					},
+					"node-2": {
+						Name:      "node-2",
+						PrivateIp: "10.0.0.2",
+						State:     model.MachineStateActive,
+					},
+				},
+			},
+			account: &model.CloudAccount{
+				Provider: clouds.DigitalOcean,
+			},
+			expectedCode:  http.StatusAccepted,
+			expectedNodes: []string{"node-1", "node-2"},
+		},
+	}
+
+	workflows.Init()
+	workflows.RegisterWorkFlow(workflows.PatchNode, []steps.Step{})
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, mock.Anything).
+			Return(tc.kube, tc.kubeErr)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).
+			Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(tc.account, tc.accountErr)
+
+		// rollout tasks look up their group and the tasks they depend on
+		repo := memory.NewInMemoryRepository()
+
+		h := Handler{
+			svc:            svc,
+			accountService: accService,
+			repo:           repo,
+			getWriter: func(string) (io.WriteCloser, error) {
+				return &bufferCloser{}, nil
+			},
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/patch", h.patchNodes)
+
+		req, _ := http.NewRequest(http.MethodPost, "/kubes/kube/patch",
+			strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.description)
+
+		if rec.Code != http.StatusAccepted {
+			continue
+		}
+		require.Contains(t, rec.Header().Get("Location"), "/status", "TC: %s", tc.description)
+
+		nodeTasks := make(map[string]string)
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&nodeTasks))
+		require.Len(t, nodeTasks, len(tc.expectedNodes))
+		for _, name := range tc.expectedNodes {
+			require.Contains(t, tc.kube.Tasks[workflows.PatchTask], nodeTasks[name])
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package kube
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	DefaultHealthPrefix = "/supergiant/health/"
+
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+	// HealthUnknown is reported until the monitor has checked the cluster.
+	HealthUnknown = "unknown"
+
+	healthStatusPrefix = "status/"
+	healthTokenPrefix  = "tokens/"
+	healthTokenSize    = 32
+)
+
+// ClusterHealth is a result of the latest check of a cluster.
+type ClusterHealth struct {
+	KubeID             string    `json:"kubeId"`
+	KubeName           string    `json:"kubeName"`
+	Status             string    `json:"status"`
+	APIServerReachable bool      `json:"apiserverReachable"`
+	NodesReady         int       `json:"nodesReady"`
+	NodesTotal         int       `json:"nodesTotal"`
+	Error              string    `json:"error,omitempty"`
+	CheckedAt          time.Time `json:"checkedAt"`
+}
+
+// HealthToken lets external uptime monitors read the health of a cluster
+// without credentials, only a hash of the token is stored.
+type HealthToken struct {
+	ID        string    `json:"id"`
+	KubeID    string    `json:"kubeId"`
+	TenantID  string    `json:"tenantId"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NewHealthToken is returned once when the token is created.
+type NewHealthToken struct {
+	HealthToken
+	Token string `json:"token"`
+	// Path is relative to the address of the control plane.
+	Path string `json:"path"`
+}
+
+// HealthMonitor periodically checks api servers and nodes of operational
+// clusters, results are kept in the storage so that every replica serves them.
+type HealthMonitor struct {
+	svc      Interface
+	repo     storage.Interface
+	prefix   string
+	interval time.Duration
+
+	corev1ClientFn func(k *model.Kube) (corev1client.CoreV1Interface, error)
+	now            func() time.Time
+}
+
+// NewHealthMonitor constructs a HealthMonitor that checks clusters every
+// interval, repo must not be namespaced by tenants as tokens are looked up
+// before the tenant is known.
+func NewHealthMonitor(svc Interface, repo storage.Interface, interval time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		svc:            svc,
+		repo:           repo,
+		prefix:         DefaultHealthPrefix,
+		interval:       interval,
+		corev1ClientFn: corev1Client,
+		now:            time.Now,
+	}
+}
+
+// Run blocks and checks operational clusters of all tenants every interval
+// until ctx is cancelled.
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkAll(ctx)
+		}
+	}
+}
+
+func (m *HealthMonitor) checkAll(ctx context.Context) {
+	kubes, err := m.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("health: list kubes: %v", err)
+		return
+	}
+
+	for i := range kubes {
+		if kubes[i].State != model.StateOperational {
+			continue
+		}
+		if _, err := m.Check(ctx, &kubes[i]); err != nil {
+			logrus.Errorf("health: cluster %s: %v", kubes[i].ID, err)
+		}
+	}
+}
+
+// Check reports the cluster down when its api server can't be reached and
+// degraded when some of its nodes aren't ready, the result is saved.
+func (m *HealthMonitor) Check(ctx context.Context, k *model.Kube) (*ClusterHealth, error) {
+	h := &ClusterHealth{
+		KubeID:    k.ID,
+		KubeName:  k.Name,
+		Status:    HealthDown,
+		CheckedAt: m.now(),
+	}
+
+	if err := m.checkNodes(k, h); err != nil {
+		h.Error = err.Error()
+	}
+
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+	if err = m.repo.Put(ctx, m.prefix+healthStatusPrefix, k.ID, raw); err != nil {
+		return nil, errors.Wrap(err, "storage: put")
+	}
+
+	return h, nil
+}
+
+func (m *HealthMonitor) checkNodes(k *model.Kube, h *ClusterHealth) error {
+	kclient, err := m.corev1ClientFn(k)
+	if err != nil {
+		return errors.Wrap(err, "build kubernetes client")
+	}
+
+	nodes, err := kclient.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "list nodes")
+	}
+	h.APIServerReachable = true
+	h.NodesTotal = len(nodes.Items)
+	for _, n := range nodes.Items {
+		if nodeReady(n) {
+			h.NodesReady++
+		}
+	}
+
+	h.Status = HealthUp
+	if h.NodesReady < h.NodesTotal {
+		h.Status = HealthDegraded
+	}
+	return nil
+}
+
+func nodeReady(n corev1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Get returns the latest health of the cluster, it is unknown until
+// the cluster has been checked.
+func (m *HealthMonitor) Get(ctx context.Context, k *model.Kube) (*ClusterHealth, error) {
+	raw, err := m.repo.Get(ctx, m.prefix+healthStatusPrefix, k.ID)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "storage: get")
+	}
+	if len(raw) == 0 {
+		return &ClusterHealth{KubeID: k.ID, KubeName: k.Name, Status: HealthUnknown}, nil
+	}
+
+	h := &ClusterHealth{}
+	if err = json.Unmarshal(raw, h); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+	return h, nil
+}
+
+func hashHealthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken issues a token of the cluster for the tenant of ctx.
+func (m *HealthMonitor) CreateToken(ctx context.Context, kubeID string) (*NewHealthToken, error) {
+	secret := make([]byte, healthTokenSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "generate token")
+	}
+	token := hex.EncodeToString(secret)
+
+	t := HealthToken{
+		ID:        uuid.New()[:8],
+		KubeID:    kubeID,
+		TenantID:  tenant.FromContext(ctx),
+		Hash:      hashHealthToken(token),
+		CreatedAt: m.now(),
+	}
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+	if err = m.repo.Put(ctx, m.prefix+healthTokenPrefix, t.Hash, raw); err != nil {
+		return nil, errors.Wrap(err, "storage: put")
+	}
+
+	t.Hash = ""
+	return &NewHealthToken{
+		HealthToken: t,
+		Token:       token,
+		Path:        "/health/" + token,
+	}, nil
+}
+
+// ListTokens returns tokens of the cluster without their hashes.
+func (m *HealthMonitor) ListTokens(ctx context.Context, kubeID string) ([]HealthToken, error) {
+	tokens, err := m.tokens(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		tokens[i].Hash = ""
+	}
+	return tokens, nil
+}
+
+// DeleteToken revokes a token of the cluster.
+func (m *HealthMonitor) DeleteToken(ctx context.Context, kubeID, id string) error {
+	tokens, err := m.tokens(ctx, kubeID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.ID != id {
+			continue
+		}
+		if err = m.repo.Delete(ctx, m.prefix+healthTokenPrefix, t.Hash); err != nil {
+			return errors.Wrap(err, "storage: delete")
+		}
+		return nil
+	}
+	return errors.Wrapf(sgerrors.ErrNotFound, "token %s", id)
+}
+
+// tokens returns tokens of the cluster that belong to the tenant of ctx.
+func (m *HealthMonitor) tokens(ctx context.Context, kubeID string) ([]HealthToken, error) {
+	raws, err := m.repo.GetAll(ctx, m.prefix+healthTokenPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	tokens := make([]HealthToken, 0)
+	for _, raw := range raws {
+		t := HealthToken{}
+		if err = json.Unmarshal(raw, &t); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		if t.KubeID == kubeID && t.TenantID == tenant.FromContext(ctx) {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// HealthByToken returns the health of the cluster the token was issued for.
+func (m *HealthMonitor) HealthByToken(ctx context.Context, token string) (*ClusterHealth, error) {
+	raw, err := m.repo.Get(ctx, m.prefix+healthTokenPrefix, hashHealthToken(token))
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get")
+	}
+	if raw == nil {
+		return nil, errors.Wrap(sgerrors.ErrNotFound, "token")
+	}
+	t := HealthToken{}
+	if err = json.Unmarshal(raw, &t); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	// the cluster may have been deleted since the token was issued
+	k, err := m.svc.Get(tenant.WithID(ctx, t.TenantID), t.KubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube")
+	}
+	return m.Get(ctx, k)
+}
+
+// HealthHandler exposes health of clusters to users and uptime monitors.
+type HealthHandler struct {
+	svc     Interface
+	monitor *HealthMonitor
+}
+
+// NewHealthHandler constructs a HealthHandler.
+func NewHealthHandler(svc Interface, m *HealthMonitor) *HealthHandler {
+	return &HealthHandler{
+		svc:     svc,
+		monitor: m,
+	}
+}
+
+// Register adds handlers of health and its tokens to the api router.
+func (h *HealthHandler) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/health", h.getHealth).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/health", h.checkHealth).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/health/tokens", h.createToken).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/health/tokens", h.listTokens).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/health/tokens/{tokenID}", h.deleteToken).Methods(http.MethodDelete)
+}
+
+// RegisterPublic adds the endpoint of uptime monitors to a router that
+// doesn't require credentials, the token in the path authenticates them.
+func (h *HealthHandler) RegisterPublic(r *mux.Router) {
+	r.HandleFunc("/health/{token}", h.getHealthByToken).Methods(http.MethodGet, http.MethodHead)
+}
+
+// kube returns the cluster of the request, errors have been sent when it fails.
+func (h *HealthHandler) kube(w http.ResponseWriter, r *http.Request) (*model.Kube, bool) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return nil, false
+		}
+		message.SendUnknownError(w, err)
+		return nil, false
+	}
+	return k, true
+}
+
+func (h *HealthHandler) getHealth(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.kube(w, r)
+	if !ok {
+		return
+	}
+
+	health, err := h.monitor.Get(r.Context(), k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(health); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// checkHealth checks the cluster immediately instead of waiting for the next run.
+func (h *HealthHandler) checkHealth(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.kube(w, r)
+	if !ok {
+		return
+	}
+
+	health, err := h.monitor.Check(r.Context(), k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(health); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// createToken returns a new token of the cluster, the token isn't shown again.
+func (h *HealthHandler) createToken(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.kube(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := h.monitor.CreateToken(r.Context(), k.ID)
+	if err != nil {
+		logrus.Errorf("health: cluster %s: create token: %v", k.ID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(t); err != nil {
+		logrus.Errorf("health: cluster %s: write response: %v", k.ID, err)
+	}
+}
+
+func (h *HealthHandler) listTokens(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.kube(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.monitor.ListTokens(r.Context(), k.ID)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(tokens); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *HealthHandler) deleteToken(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.kube(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["tokenID"]
+
+	if err := h.monitor.DeleteToken(r.Context(), k.ID, id); err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, id, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getHealthByToken answers uptime monitors with 503 when the cluster is down:
+// GET /health/{token}
+func (h *HealthHandler) getHealthByToken(w http.ResponseWriter, r *http.Request) {
+	health, err := h.monitor.HealthByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			// tokens of deleted clusters look the same as unknown ones
+			http.NotFound(w, r)
+			return
+		}
+		logrus.Errorf("health: get by token: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if health.Status == HealthDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err = json.NewEncoder(w).Encode(health); err != nil {
+		logrus.Errorf("health: write response: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func healthNode(name string, ready corev1.ConditionStatus) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+func healthClient(nodes []corev1.Node, err error) func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+	return func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		cl := &fakev1client.FakeCoreV1{
+			Fake: &kubetesting.Fake{},
+		}
+		cl.AddReactor("list", "nodes",
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				return true, &corev1.NodeList{Items: nodes}, err
+			})
+		return cl, nil
+	}
+}
+
+func TestHealthMonitor_Check(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		nodes          []corev1.Node
+		listErr        error
+		expectedHealth ClusterHealth
+	}{
+		{
+			name:    "unreachable",
+			listErr: errFake,
+			expectedHealth: ClusterHealth{
+				Status: HealthDown,
+				Error:  "list nodes: " + errFake.Error(),
+			},
+		},
+		{
+			name:  "degraded",
+			nodes: []corev1.Node{healthNode("master", corev1.ConditionTrue), healthNode("node", corev1.ConditionUnknown)},
+			expectedHealth: ClusterHealth{
+				Status:             HealthDegraded,
+				APIServerReachable: true,
+				NodesReady:         1,
+				NodesTotal:         2,
+			},
+		},
+		{
+			name:  "up",
+			nodes: []corev1.Node{healthNode("master", corev1.ConditionTrue), healthNode("node", corev1.ConditionTrue)},
+			expectedHealth: ClusterHealth{
+				Status:             HealthUp,
+				APIServerReachable: true,
+				NodesReady:         2,
+				NodesTotal:         2,
+			},
+		},
+	} {
+		k := &model.Kube{ID: "kube", Name: "prod"}
+		m := NewHealthMonitor(new(kubeServiceMock), memory.NewInMemoryRepository(), time.Minute)
+		m.corev1ClientFn = healthClient(tc.nodes, tc.listErr)
+		m.now = func() time.Time { return time.Unix(100, 0) }
+
+		before, err := m.Get(context.Background(), k)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, HealthUnknown, before.Status, "TC: %s", tc.name)
+
+		health, err := m.Check(context.Background(), k)
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		tc.expectedHealth.KubeID, tc.expectedHealth.KubeName = "kube", "prod"
+		tc.expectedHealth.CheckedAt = time.Unix(100, 0)
+		require.Equal(t, tc.expectedHealth, *health, "TC: %s", tc.name)
+
+		saved, err := m.Get(context.Background(), k)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedHealth.Status, saved.Status, "TC: %s", tc.name)
+	}
+}
+
+func TestHealthMonitor_checkAll(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{
+		{ID: "default", State: model.StateOperational},
+		{ID: "acme", TenantID: "acme", State: model.StateOperational},
+		{ID: "provisioning", TenantID: "acme", State: model.StateProvisioning},
+	}, nil)
+	m := NewHealthMonitor(svc, memory.NewInMemoryRepository(), time.Minute)
+	m.corev1ClientFn = healthClient([]corev1.Node{healthNode("master", corev1.ConditionTrue)}, nil)
+
+	m.checkAll(context.Background())
+
+	for id, expected := range map[string]string{
+		"default":      HealthUp,
+		"acme":         HealthUp,
+		"provisioning": HealthUnknown,
+	} {
+		h, err := m.Get(context.Background(), &model.Kube{ID: id})
+		require.NoError(t, err)
+		require.Equal(t, expected, h.Status, id)
+	}
+}
+
+func TestHealthMonitor_Tokens(t *testing.T) {
+	k := &model.Kube{ID: "kube", Name: "prod", TenantID: "acme"}
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	svc := new(kubeServiceMock)
+	svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+	m := NewHealthMonitor(svc, memory.NewInMemoryRepository(), time.Minute)
+	m.corev1ClientFn = healthClient(nil, errFake)
+	m.now = func() time.Time { return time.Unix(100, 0).UTC() }
+
+	created, err := m.CreateToken(ctx, "kube")
+	require.NoError(t, err)
+	require.Empty(t, created.Hash)
+	require.Equal(t, "/health/"+created.Token, created.Path)
+
+	_, err = m.HealthByToken(context.Background(), "unknown")
+	require.True(t, sgerrors.IsNotFound(err))
+
+	health, err := m.HealthByToken(context.Background(), created.Token)
+	require.NoError(t, err)
+	require.Equal(t, HealthUnknown, health.Status)
+
+	_, err = m.Check(ctx, k)
+	require.NoError(t, err)
+	health, err = m.HealthByToken(context.Background(), created.Token)
+	require.NoError(t, err)
+	require.Equal(t, HealthDown, health.Status)
+
+	tokens, err := m.ListTokens(context.Background(), "kube")
+	require.NoError(t, err)
+	require.Empty(t, tokens, "tokens of other tenants")
+	tokens, err = m.ListTokens(ctx, "kube")
+	require.NoError(t, err)
+	require.Equal(t, []HealthToken{created.HealthToken}, tokens)
+
+	require.True(t, sgerrors.IsNotFound(m.DeleteToken(ctx, "kube", "unknown")))
+	require.NoError(t, m.DeleteToken(ctx, "kube", created.ID))
+	_, err = m.HealthByToken(context.Background(), created.Token)
+	require.True(t, sgerrors.IsNotFound(err))
+}
+
+func TestHealthHandler_getHealthByToken(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		kubeErr        error
+		nodes          []corev1.Node
+		listErr        error
+		token          string
+		expectedCode   int
+		expectedStatus string
+	}{
+		{
+			name:         "unknown token",
+			token:        "unknown",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "deleted cluster",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:           "down",
+			listErr:        errFake,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: HealthDown,
+		},
+		{
+			name:           "degraded",
+			nodes:          []corev1.Node{healthNode("node", corev1.ConditionFalse)},
+			expectedCode:   http.StatusOK,
+			expectedStatus: HealthDegraded,
+		},
+	} {
+		k := &model.Kube{ID: "kube", Name: "prod"}
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(k, tc.kubeErr)
+
+		m := NewHealthMonitor(svc, memory.NewInMemoryRepository(), time.Minute)
+		m.corev1ClientFn = healthClient(tc.nodes, tc.listErr)
+		created, err := m.CreateToken(context.Background(), "kube")
+		require.NoError(t, err, "TC: %s", tc.name)
+		_, err = m.Check(context.Background(), k)
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		token := tc.token
+		if token == "" {
+			token = created.Token
+		}
+
+		router := mux.NewRouter()
+		NewHealthHandler(svc, m).RegisterPublic(router)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/"+token, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if tc.expectedStatus == "" {
+			continue
+		}
+		health := ClusterHealth{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&health), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedStatus, health.Status, "TC: %s", tc.name)
+	}
+}
+
+func TestHealthHandler_createToken(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		kubeErr      error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			kubeErr:      errors.Wrap(sgerrors.ErrNotFound, "kube"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "ok",
+			expectedCode: http.StatusCreated,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{ID: "kube"}, tc.kubeErr)
+
+		router := mux.NewRouter()
+		NewHealthHandler(svc, NewHealthMonitor(svc, memory.NewInMemoryRepository(), time.Minute)).Register(router)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kubes/kube/health/tokens", nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusCreated {
+			continue
+		}
+		created := NewHealthToken{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&created), "TC: %s", tc.name)
+		require.Len(t, created.Token, 2*healthTokenSize, "TC: %s", tc.name)
+	}
+}
@@ -1,28 +1,187 @@
 package kube
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/sghelm/proxy"
 )
 
+const (
+	// idle timeout must be longer than maxReleaseTimeout,
+	// otherwise a tunnel could be closed under a running install.
+	helmProxyIdleTimeout       = time.Minute * 10
+	helmProxyHealthCheckPeriod = time.Second * 30
+)
+
 func helmProxyFrom(kube *model.Kube) (proxy.Interface, error) {
+	coreV1Client, restConf, err := helmProxyClients(kube)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxy.New(coreV1Client, restConf, "")
+}
+
+func persistentHelmProxyFrom(kube *model.Kube) (closableHelmProxy, error) {
+	coreV1Client, restConf, err := helmProxyClients(kube)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxy.NewPersistent(coreV1Client, restConf, "")
+}
+
+func helmProxyClients(kube *model.Kube) (corev1.CoreV1Interface, *rest.Config, error) {
 	if kube == nil {
-		return nil, errors.Wrap(sgerrors.ErrNilEntity, "kube model")
+		return nil, nil, errors.Wrap(sgerrors.ErrNilEntity, "kube model")
 	}
 
 	restConf, err := NewConfigFor(kube)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	coreV1Client, err := corev1.NewForConfig(restConf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return coreV1Client, restConf, nil
+}
+
+type closableHelmProxy interface {
+	proxy.Interface
+	Close()
+}
+
+type helmProxyEntry struct {
+	proxy       closableHelmProxy
+	lastUsed    time.Time
+	lastChecked time.Time
+}
+
+// helmProxyPool keeps tiller tunnels open per cluster, so sequential calls
+// don't set up port forwarding each time.
+type helmProxyPool struct {
+	m       sync.Mutex
+	proxies map[string]*helmProxyEntry
+
+	idleTimeout       time.Duration
+	healthCheckPeriod time.Duration
+
+	newProxyFn func(kube *model.Kube) (closableHelmProxy, error)
+}
+
+func newHelmProxyPool() *helmProxyPool {
+	return &helmProxyPool{
+		proxies:           make(map[string]*helmProxyEntry),
+		idleTimeout:       helmProxyIdleTimeout,
+		healthCheckPeriod: helmProxyHealthCheckPeriod,
+		newProxyFn:        persistentHelmProxyFrom,
+	}
+}
+
+// get returns a cached proxy of the cluster, proxies that haven't been used
+// for a while are pinged first and replaced if tiller doesn't respond.
+func (p *helmProxyPool) get(kube *model.Kube) (proxy.Interface, error) {
+	if kube == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "kube model")
+	}
+
+	now := time.Now()
+
+	var lastChecked time.Time
+	p.m.Lock()
+	entry, ok := p.proxies[kube.ID]
+	if ok {
+		entry.lastUsed = now
+		lastChecked = entry.lastChecked
+	}
+	p.m.Unlock()
+
+	if ok {
+		if now.Sub(lastChecked) < p.healthCheckPeriod {
+			return entry.proxy, nil
+		}
+
+		err := entry.proxy.PingTiller()
+		if err == nil {
+			p.m.Lock()
+			entry.lastChecked = now
+			p.m.Unlock()
+			return entry.proxy, nil
+		}
+
+		logrus.Debugf("helm proxy: %s cluster: health check: %v", kube.ID, err)
+		p.remove(kube.ID, entry)
+	}
+
+	prx, err := p.newProxyFn(kube)
 	if err != nil {
 		return nil, err
 	}
 
-	return proxy.New(coreV1Client, restConf, "")
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// other request could have created a proxy in the meantime
+	if existing, ok := p.proxies[kube.ID]; ok {
+		prx.Close()
+		return existing.proxy, nil
+	}
+
+	p.proxies[kube.ID] = &helmProxyEntry{
+		proxy:       prx,
+		lastUsed:    now,
+		lastChecked: now,
+	}
+
+	return prx, nil
+}
+
+func (p *helmProxyPool) remove(kubeID string, entry *helmProxyEntry) {
+	p.m.Lock()
+	if p.proxies[kubeID] == entry {
+		delete(p.proxies, kubeID)
+	}
+	p.m.Unlock()
+
+	entry.proxy.Close()
+}
+
+// expire closes proxies that have been idle longer than idleTimeout.
+func (p *helmProxyPool) expire(now time.Time) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for kubeID, entry := range p.proxies {
+		if now.Sub(entry.lastUsed) > p.idleTimeout {
+			entry.proxy.Close()
+			delete(p.proxies, kubeID)
+		}
+	}
+}
+
+// run expires idle proxies until ctx is cancelled.
+func (p *helmProxyPool) run(ctx context.Context) {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.expire(now)
+		}
+	}
 }
@@ -3,9 +3,14 @@ package kube
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
 
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
 )
 
 func TestHelmProxyFrom(t *testing.T) {
@@ -52,3 +57,96 @@ func TestHelmProxyFrom(t *testing.T) {
 		}
 	}
 }
+
+type fakePooledProxy struct {
+	proxy.Interface
+
+	pingErr error
+	pings   int
+	closed  bool
+}
+
+func (p *fakePooledProxy) PingTiller() error {
+	p.pings++
+	return p.pingErr
+}
+
+func (p *fakePooledProxy) Close() {
+	p.closed = true
+}
+
+func TestHelmProxyPool_Get(t *testing.T) {
+	var created []*fakePooledProxy
+	pool := newHelmProxyPool()
+	pool.newProxyFn = func(kube *model.Kube) (closableHelmProxy, error) {
+		prx := &fakePooledProxy{}
+		created = append(created, prx)
+		return prx, nil
+	}
+
+	_, err := pool.get(nil)
+	require.True(t, sgerrors.ErrNilEntity == errors.Cause(err))
+
+	k := &model.Kube{ID: "kube"}
+
+	first, err := pool.get(k)
+	require.NoError(t, err)
+	second, err := pool.get(k)
+	require.NoError(t, err)
+	require.True(t, first == second, "proxy must be reused")
+	require.Len(t, created, 1)
+	require.Equal(t, 0, created[0].pings, "fresh proxy must not be pinged")
+
+	// healthy proxy is kept after the check
+	pool.healthCheckPeriod = 0
+	third, err := pool.get(k)
+	require.NoError(t, err)
+	require.True(t, first == third)
+	require.Equal(t, 1, created[0].pings)
+
+	// broken proxy is replaced
+	created[0].pingErr = errFake
+	fourth, err := pool.get(k)
+	require.NoError(t, err)
+	require.False(t, first == fourth)
+	require.True(t, created[0].closed)
+	require.Len(t, created, 2)
+
+	other, err := pool.get(&model.Kube{ID: "other"})
+	require.NoError(t, err)
+	require.False(t, fourth == other)
+}
+
+func TestHelmProxyPool_GetError(t *testing.T) {
+	pool := newHelmProxyPool()
+	pool.newProxyFn = func(kube *model.Kube) (closableHelmProxy, error) {
+		return nil, errFake
+	}
+
+	_, err := pool.get(&model.Kube{ID: "kube"})
+	require.Equal(t, errFake, err)
+	require.Empty(t, pool.proxies)
+}
+
+func TestHelmProxyPool_Expire(t *testing.T) {
+	pool := newHelmProxyPool()
+	now := time.Now()
+
+	idle := &fakePooledProxy{}
+	active := &fakePooledProxy{}
+	pool.proxies["idle"] = &helmProxyEntry{
+		proxy:    idle,
+		lastUsed: now.Add(-helmProxyIdleTimeout * 2),
+	}
+	pool.proxies["active"] = &helmProxyEntry{
+		proxy:    active,
+		lastUsed: now,
+	}
+
+	pool.expire(now)
+
+	require.True(t, idle.closed)
+	require.False(t, active.closed)
+	require.Len(t, pool.proxies, 1)
+	require.NotNil(t, pool.proxies["active"])
+}
@@ -0,0 +1,218 @@
+package kube
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+)
+
+const (
+	HelmOpInstall  = "install"
+	HelmOpUpgrade  = "upgrade"
+	HelmOpDelete   = "delete"
+	HelmOpRollback = "rollback"
+
+	HelmOpQueued    = "queued"
+	HelmOpRunning   = "running"
+	HelmOpSucceeded = "succeeded"
+	HelmOpFailed    = "failed"
+
+	// number of finished operations kept per cluster
+	helmOpsHistory = 20
+)
+
+// HelmOperation is a release operation queued against a cluster.
+type HelmOperation struct {
+	ID         string    `json:"id"`
+	KubeID     string    `json:"kubeId"`
+	Type       string    `json:"type"`
+	Release    string    `json:"release"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+
+	// Result is a release info of the finished operation
+	Result *model.ReleaseInfo `json:"result,omitempty"`
+}
+
+// helmQueue serializes helm operations per cluster, tiller doesn't handle
+// concurrent changes of releases well.
+type helmQueue struct {
+	m     sync.Mutex
+	locks map[string]chan struct{}
+	ops   map[string][]*HelmOperation
+
+	subscribers []func(HelmOperation)
+}
+
+func newHelmQueue() *helmQueue {
+	return &helmQueue{
+		locks: make(map[string]chan struct{}),
+		ops:   make(map[string][]*HelmOperation),
+	}
+}
+
+// do waits for the previous operations on the cluster to finish and runs fn.
+func (q *helmQueue) do(ctx context.Context, kubeID, opType, rlsName string, fn func() error) error {
+	if q == nil {
+		return fn()
+	}
+
+	op, lock := q.enqueue(kubeID, opType, rlsName)
+
+	return q.run(ctx, op, lock, func() (*model.ReleaseInfo, error) {
+		return nil, fn()
+	})
+}
+
+// submit queues fn and returns immediately, operation status
+// can be polled by its id.
+func (q *helmQueue) submit(kubeID, opType, rlsName string, fn func() (*model.ReleaseInfo, error)) HelmOperation {
+	op, lock := q.enqueue(kubeID, opType, rlsName)
+	out := *op
+
+	go func() {
+		if err := q.run(context.Background(), op, lock, fn); err != nil {
+			logrus.Errorf("helm: %s release %s: %s cluster: %v", opType, rlsName, kubeID, err)
+		}
+	}()
+
+	return out
+}
+
+func (q *helmQueue) run(ctx context.Context, op *HelmOperation, lock chan struct{},
+	fn func() (*model.ReleaseInfo, error)) error {
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		q.finish(op, nil, ctx.Err())
+		return ctx.Err()
+	}
+	defer func() { <-lock }()
+
+	q.m.Lock()
+	op.Status = HelmOpRunning
+	op.StartedAt = time.Now()
+	q.m.Unlock()
+
+	res, err := fn()
+	q.finish(op, res, err)
+
+	return err
+}
+
+// subscribe registers fn to be called on every finished operation.
+func (q *helmQueue) subscribe(fn func(HelmOperation)) {
+	q.m.Lock()
+	q.subscribers = append(q.subscribers, fn)
+	q.m.Unlock()
+}
+
+func (q *helmQueue) enqueue(kubeID, opType, rlsName string) (*HelmOperation, chan struct{}) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	lock, ok := q.locks[kubeID]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		q.locks[kubeID] = lock
+	}
+
+	op := &HelmOperation{
+		ID:        uuid.New()[:8],
+		KubeID:    kubeID,
+		Type:      opType,
+		Release:   rlsName,
+		Status:    HelmOpQueued,
+		CreatedAt: time.Now(),
+	}
+	q.ops[kubeID] = append(q.ops[kubeID], op)
+
+	return op, lock
+}
+
+func (q *helmQueue) finish(op *HelmOperation, res *model.ReleaseInfo, err error) {
+	q.m.Lock()
+	op.FinishedAt = time.Now()
+	op.Status = HelmOpSucceeded
+	op.Result = res
+	if err != nil {
+		op.Status = HelmOpFailed
+		op.Error = err.Error()
+	}
+	q.trim(op.KubeID)
+
+	done := *op
+	subscribers := append([]func(HelmOperation){}, q.subscribers...)
+	q.m.Unlock()
+
+	for _, fn := range subscribers {
+		fn(done)
+	}
+}
+
+// trim drops the oldest finished operations above the history limit.
+func (q *helmQueue) trim(kubeID string) {
+	ops := q.ops[kubeID]
+
+	finished := 0
+	for _, op := range ops {
+		if op.Status == HelmOpSucceeded || op.Status == HelmOpFailed {
+			finished++
+		}
+	}
+
+	out := ops[:0]
+	for _, op := range ops {
+		done := op.Status == HelmOpSucceeded || op.Status == HelmOpFailed
+		if done && finished > helmOpsHistory {
+			finished--
+			continue
+		}
+		out = append(out, op)
+	}
+	q.ops[kubeID] = out
+}
+
+// get returns a copy of the operation.
+func (q *helmQueue) get(kubeID, opID string) (*HelmOperation, bool) {
+	if q == nil {
+		return nil, false
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for _, op := range q.ops[kubeID] {
+		if op.ID == opID {
+			out := *op
+			return &out, true
+		}
+	}
+
+	return nil, false
+}
+
+// list returns copies of the cluster operations, the oldest go first.
+func (q *helmQueue) list(kubeID string) []HelmOperation {
+	out := make([]HelmOperation, 0)
+	if q == nil {
+		return out
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for _, op := range q.ops[kubeID] {
+		out = append(out, *op)
+	}
+
+	return out
+}
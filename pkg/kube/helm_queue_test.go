@@ -0,0 +1,267 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHelmQueue_Serializes(t *testing.T) {
+	q := newHelmQueue()
+
+	var (
+		wg      sync.WaitGroup
+		m       sync.Mutex
+		running int
+		maxSeen int
+	)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.do(context.Background(), "kube", HelmOpInstall, "rls", func() error {
+				m.Lock()
+				running++
+				if running > maxSeen {
+					maxSeen = running
+				}
+				m.Unlock()
+
+				time.Sleep(time.Millisecond * 5)
+
+				m.Lock()
+				running--
+				m.Unlock()
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, maxSeen)
+
+	ops := q.list("kube")
+	require.Len(t, ops, 5)
+	for _, op := range ops {
+		require.Equal(t, HelmOpSucceeded, op.Status)
+	}
+	require.Empty(t, q.list("other"))
+}
+
+func TestHelmQueue_Status(t *testing.T) {
+	q := newHelmQueue()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go q.do(context.Background(), "kube", HelmOpInstall, "first", func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.do(ctx, "kube", HelmOpDelete, "second", func() error {
+			return nil
+		})
+	}()
+
+	waitFor(t, func() bool {
+		return len(q.list("kube")) == 2
+	})
+
+	ops := q.list("kube")
+	require.Equal(t, HelmOpRunning, ops[0].Status)
+	require.Equal(t, HelmOpQueued, ops[1].Status)
+
+	// queued operation gives up when request is cancelled
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+	require.Equal(t, HelmOpFailed, q.list("kube")[1].Status)
+
+	close(release)
+	waitFor(t, func() bool {
+		return q.list("kube")[0].Status == HelmOpSucceeded
+	})
+}
+
+func TestHelmQueue_Trim(t *testing.T) {
+	q := newHelmQueue()
+
+	for i := 0; i < helmOpsHistory+5; i++ {
+		err := q.do(context.Background(), "kube", HelmOpInstall, "rls", func() error {
+			return errFake
+		})
+		require.Equal(t, errFake, err)
+	}
+
+	ops := q.list("kube")
+	require.Len(t, ops, helmOpsHistory)
+	require.Equal(t, errFake.Error(), ops[0].Error)
+}
+
+func TestHelmQueue_Nil(t *testing.T) {
+	var q *helmQueue
+
+	called := false
+	err := q.do(context.Background(), "kube", HelmOpInstall, "rls", func() error {
+		called = true
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.True(t, called)
+	require.Empty(t, q.list("kube"))
+}
+
+func TestHandler_listHelmOperations(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceHelmOperations, mock.Anything, "kube").
+			Return([]HelmOperation{{ID: "op"}}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/helm/operations", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_installReleaseAsync(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "accepted",
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceInstallAsync, mock.Anything, "kube", mock.Anything).
+			Return(&HelmOperation{ID: "op", Status: HelmOpQueued}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/releases", strings.NewReader(deployedReleaseInput))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code == http.StatusAccepted {
+			op := &HelmOperation{}
+			require.Nil(t, json.NewDecoder(rec.Body).Decode(op), "TC: %s", tc.name)
+			require.Equal(t, "op", op.ID, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_deleteReleaseAsync(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceDeleteAsync, mock.Anything, "kube", "rls", true).
+		Return(&HelmOperation{ID: "op", Status: HelmOpQueued}, nil)
+
+	h := Handler{svc: svc}
+	router := mux.NewRouter()
+	h.Register(router)
+
+	req := httptest.NewRequest(http.MethodDelete, "/kubes/kube/releases/rls?purge=true", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+}
+
+func TestHandler_getHelmOperation(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "success",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceHelmOperation, mock.Anything, "kube", "op").
+			Return(&HelmOperation{ID: "op"}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/helm/operations/op", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,372 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/digitalocean/godo"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/digitaloceansdk"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+// Instance lifecycles:
+const (
+	LifecycleOnDemand = "on-demand"
+	LifecycleSpot     = "spot"
+)
+
+// Instance is cloud side metadata of a node.
+type Instance struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name,omitempty"`
+	Type             string    `json:"type,omitempty"`
+	AvailabilityZone string    `json:"availabilityZone,omitempty"`
+	Lifecycle        string    `json:"lifecycle,omitempty"`
+	PrivateIP        string    `json:"privateIp,omitempty"`
+	PublicIP         string    `json:"publicIp,omitempty"`
+	LaunchTime       time.Time `json:"launchTime,omitempty"`
+}
+
+// NodeInfo is a kubernetes node joined with the cloud instance it runs on.
+type NodeInfo struct {
+	corev1.Node
+	Instance *Instance `json:"instance,omitempty"`
+}
+
+type instanceLister interface {
+	Instances(ctx context.Context, k *model.Kube) (map[string]Instance, error)
+	ClusterInstances(ctx context.Context, k *model.Kube) ([]Instance, error)
+}
+
+type instancesFn func(ctx context.Context, config *steps.Config, ids []string) ([]Instance, error)
+
+type clusterInstancesFn func(ctx context.Context, config *steps.Config, clusterID string) ([]Instance, error)
+
+// CloudInstances looks up instances of kube machines in the cloud.
+type CloudInstances struct {
+	accounts     accountGetter
+	aws          instancesFn
+	digitalOcean instancesFn
+
+	awsCluster          clusterInstancesFn
+	digitalOceanCluster clusterInstancesFn
+
+	awsDisks clusterDisksFn
+
+	azureBudget clusterBudgetFn
+
+	awsCompliance clusterComplianceFn
+}
+
+// NewCloudInstances constructs CloudInstances that use credentials of kube accounts.
+func NewCloudInstances(accounts accountGetter) *CloudInstances {
+	return &CloudInstances{
+		accounts:            accounts,
+		aws:                 awsInstances,
+		digitalOcean:        digitalOceanInstances,
+		awsCluster:          awsClusterInstances,
+		digitalOceanCluster: digitalOceanClusterInstances,
+		awsDisks:            awsClusterDisks,
+		azureBudget:         azureClusterBudget,
+		awsCompliance:       awsClusterCompliance,
+	}
+}
+
+// Instances returns instances of kube machines by machine id, machines of clouds
+// that can't be queried are described by the stored model.
+func (c *CloudInstances) Instances(ctx context.Context, k *model.Kube) (map[string]Instance, error) {
+	machines := kubeMachines(k)
+	instances := make(map[string]Instance, len(machines))
+	if len(machines) == 0 {
+		return instances, nil
+	}
+
+	ids := make([]string, 0, len(machines))
+	for _, m := range machines {
+		instances[m.ID] = machineInstance(m)
+		ids = append(ids, m.ID)
+	}
+
+	var describe instancesFn
+	switch k.Provider {
+	case clouds.AWS:
+		describe = c.aws
+	case clouds.DigitalOcean:
+		describe = c.digitalOcean
+	}
+	if describe == nil || k.ExternallyManaged {
+		return instances, nil
+	}
+
+	config, err := c.config(ctx, k)
+	if err != nil {
+		return instances, err
+	}
+
+	found, err := describe(ctx, config, ids)
+	if err != nil {
+		return instances, errors.Wrapf(err, "describe %s instances", k.Provider)
+	}
+	for _, inst := range found {
+		instances[inst.ID] = inst
+	}
+
+	return instances, nil
+}
+
+// ClusterInstances returns running instances tagged with the kube id,
+// sgerrors.ErrUnsupportedProvider is returned for clouds that can't be queried.
+func (c *CloudInstances) ClusterInstances(ctx context.Context, k *model.Kube) ([]Instance, error) {
+	var list clusterInstancesFn
+	switch k.Provider {
+	case clouds.AWS:
+		list = c.awsCluster
+	case clouds.DigitalOcean:
+		list = c.digitalOceanCluster
+	}
+	if list == nil || k.ExternallyManaged {
+		return nil, sgerrors.ErrUnsupportedProvider
+	}
+
+	config, err := c.config(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := list(ctx, config, k.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %s instances", k.Provider)
+	}
+
+	return instances, nil
+}
+
+func (c *CloudInstances) config(ctx context.Context, k *model.Kube) (*steps.Config, error) {
+	acc, err := c.accounts.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+
+	config := &steps.Config{}
+	if err = util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+		return nil, errors.Wrap(err, "fill cloud account credentials")
+	}
+	config.AWSConfig.Region = k.Region
+
+	return config, nil
+}
+
+// JoinInstances matches nodes with instances of kube machines by name or private ip.
+func JoinInstances(k *model.Kube, nodes []corev1.Node, instances map[string]Instance) []NodeInfo {
+	byName := make(map[string]string)
+	byIP := make(map[string]string)
+	for _, m := range kubeMachines(k) {
+		byName[m.Name] = m.ID
+		if m.PrivateIp != "" {
+			byIP[m.PrivateIp] = m.ID
+		}
+	}
+
+	infos := make([]NodeInfo, 0, len(nodes))
+	for _, n := range nodes {
+		info := NodeInfo{Node: n}
+
+		id, ok := byName[n.Name]
+		for _, addr := range n.Status.Addresses {
+			if !ok && addr.Type == corev1.NodeInternalIP {
+				id, ok = byIP[addr.Address]
+			}
+		}
+		if inst, found := instances[id]; ok && found {
+			info.Instance = &inst
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+func kubeMachines(k *model.Kube) []*model.Machine {
+	machines := make([]*model.Machine, 0, len(k.Masters)+len(k.Nodes))
+	for _, m := range k.Masters {
+		if m != nil && m.ID != "" {
+			machines = append(machines, m)
+		}
+	}
+	for _, m := range k.Nodes {
+		if m != nil && m.ID != "" {
+			machines = append(machines, m)
+		}
+	}
+
+	return machines
+}
+
+func machineInstance(m *model.Machine) Instance {
+	inst := Instance{
+		ID:        m.ID,
+		Type:      m.Size,
+		PrivateIP: m.PrivateIp,
+		PublicIP:  m.PublicIp,
+	}
+	if m.CreatedAt > 0 {
+		inst.LaunchTime = time.Unix(m.CreatedAt, 0).UTC()
+	}
+
+	return inst
+}
+
+func awsInstances(ctx context.Context, config *steps.Config, ids []string) ([]Instance, error) {
+	client, err := amazon.GetEC2(config.AWSConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "get ec2 client")
+	}
+
+	out, err := client.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2Instances(out.Reservations), nil
+}
+
+func awsClusterInstances(ctx context.Context, config *steps.Config, clusterID string) ([]Instance, error) {
+	client, err := amazon.GetEC2(config.AWSConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "get ec2 client")
+	}
+
+	instances := make([]Instance, 0)
+	err = client.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String(fmt.Sprintf("tag:%s", clouds.ClusterIDTag)),
+				Values: aws.StringSlice([]string{clusterID}),
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{
+					ec2.InstanceStateNamePending,
+					ec2.InstanceStateNameRunning,
+				}),
+			},
+		},
+	}, func(out *ec2.DescribeInstancesOutput, _ bool) bool {
+		instances = append(instances, ec2Instances(out.Reservations)...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+func ec2Instances(reservations []*ec2.Reservation) []Instance {
+	instances := make([]Instance, 0)
+	for _, r := range reservations {
+		for _, i := range r.Instances {
+			inst := Instance{
+				ID:         aws.StringValue(i.InstanceId),
+				Type:       aws.StringValue(i.InstanceType),
+				Lifecycle:  LifecycleOnDemand,
+				PrivateIP:  aws.StringValue(i.PrivateIpAddress),
+				PublicIP:   aws.StringValue(i.PublicIpAddress),
+				LaunchTime: aws.TimeValue(i.LaunchTime),
+			}
+			for _, tag := range i.Tags {
+				if aws.StringValue(tag.Key) == "Name" {
+					inst.Name = aws.StringValue(tag.Value)
+				}
+			}
+			if i.Placement != nil {
+				inst.AvailabilityZone = aws.StringValue(i.Placement.AvailabilityZone)
+			}
+			if aws.StringValue(i.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot {
+				inst.Lifecycle = LifecycleSpot
+			}
+			instances = append(instances, inst)
+		}
+	}
+
+	return instances
+}
+
+func digitalOceanInstances(ctx context.Context, config *steps.Config, ids []string) ([]Instance, error) {
+	client := digitaloceansdk.New(config.DigitalOceanConfig.AccessToken).GetClient()
+
+	instances := make([]Instance, 0, len(ids))
+	for _, id := range ids {
+		dropletID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+
+		d, _, err := client.Droplets.Get(ctx, dropletID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get droplet %s", id)
+		}
+		instances = append(instances, dropletInstance(d))
+	}
+
+	return instances, nil
+}
+
+func digitalOceanClusterInstances(ctx context.Context, config *steps.Config, clusterID string) ([]Instance, error) {
+	client := digitaloceansdk.New(config.DigitalOceanConfig.AccessToken).GetClient()
+
+	instances := make([]Instance, 0)
+	opts := &godo.ListOptions{PerPage: 200}
+	for {
+		droplets, resp, err := client.Droplets.ListByTag(ctx, clusterID, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "list droplets")
+		}
+		for i := range droplets {
+			instances = append(instances, dropletInstance(&droplets[i]))
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, errors.Wrap(err, "list droplets")
+		}
+		opts.Page = page + 1
+	}
+
+	return instances, nil
+}
+
+func dropletInstance(d *godo.Droplet) Instance {
+	inst := Instance{
+		ID:        strconv.Itoa(d.ID),
+		Name:      d.Name,
+		Type:      d.SizeSlug,
+		Lifecycle: LifecycleOnDemand,
+	}
+	if d.Region != nil {
+		inst.AvailabilityZone = d.Region.Slug
+	}
+	inst.PrivateIP, _ = d.PrivateIPv4()
+	inst.PublicIP, _ = d.PublicIPv4()
+	inst.LaunchTime, _ = time.Parse(time.RFC3339, d.Created)
+
+	return inst
+}
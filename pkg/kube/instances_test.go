@@ -0,0 +1,165 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func testInstancesKube() *model.Kube {
+	return &model.Kube{
+		Provider:    clouds.AWS,
+		AccountName: "aws",
+		Region:      "us-east-1",
+		Masters: map[string]*model.Machine{
+			"master": {ID: "i-1", Name: "master", Size: "m4.large", PrivateIp: "10.0.0.1", CreatedAt: 1500000000},
+		},
+		Nodes: map[string]*model.Machine{
+			"node":    {ID: "i-2", Name: "node", PrivateIp: "10.0.0.2"},
+			"planned": {Name: "planned"},
+		},
+	}
+}
+
+func TestCloudInstances_Instances(t *testing.T) {
+	launched := time.Now().UTC()
+
+	for _, tc := range []struct {
+		name        string
+		provider    clouds.Name
+		accountErr  error
+		describeErr error
+
+		expectedErr  bool
+		expectedType string
+		expectedSpot bool
+	}{
+		{
+			name:         "unsupported provider",
+			provider:     clouds.GCE,
+			expectedType: "m4.large",
+		},
+		{
+			name:         "account error",
+			provider:     clouds.AWS,
+			accountErr:   sgerrors.ErrNotFound,
+			expectedErr:  true,
+			expectedType: "m4.large",
+		},
+		{
+			name:         "describe error",
+			provider:     clouds.AWS,
+			describeErr:  sgerrors.ErrInvalidCredentials,
+			expectedErr:  true,
+			expectedType: "m4.large",
+		},
+		{
+			name:         "aws",
+			provider:     clouds.AWS,
+			expectedType: "m5.large",
+			expectedSpot: true,
+		},
+	} {
+		k := testInstancesKube()
+		k.Provider = tc.provider
+
+		accounts := new(accServiceMock)
+		accounts.On("Get", mock.Anything, "aws").Return(&model.CloudAccount{
+			Name:     "aws",
+			Provider: clouds.AWS,
+			Credentials: map[string]string{
+				"access_key": "key",
+				"secret_key": "secret",
+			},
+		}, tc.accountErr)
+
+		c := NewCloudInstances(accounts)
+		c.aws = func(ctx context.Context, config *steps.Config, ids []string) ([]Instance, error) {
+			require.Equal(t, "us-east-1", config.AWSConfig.Region, "TC: %s", tc.name)
+			require.ElementsMatch(t, []string{"i-1", "i-2"}, ids, "TC: %s", tc.name)
+			return []Instance{{
+				ID:         "i-1",
+				Type:       "m5.large",
+				Lifecycle:  LifecycleSpot,
+				LaunchTime: launched,
+			}}, tc.describeErr
+		}
+
+		instances, err := c.Instances(context.Background(), k)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Len(t, instances, 2, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedType, instances["i-1"].Type, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedSpot, instances["i-1"].Lifecycle == LifecycleSpot, "TC: %s", tc.name)
+		require.Equal(t, "10.0.0.2", instances["i-2"].PrivateIP, "TC: %s", tc.name)
+	}
+}
+
+func TestJoinInstances(t *testing.T) {
+	k := testInstancesKube()
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "master"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-0-2"},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeHostName, Address: "ip-10-0-0-2"},
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+				},
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unknown"}},
+	}
+	instances := map[string]Instance{
+		"i-1": {ID: "i-1"},
+		"i-2": {ID: "i-2"},
+	}
+
+	infos := JoinInstances(k, nodes, instances)
+	require.Len(t, infos, 3)
+	require.Equal(t, "i-1", infos[0].Instance.ID, "nodes must be matched by name")
+	require.Equal(t, "i-2", infos[1].Instance.ID, "nodes must be matched by private ip")
+	require.Nil(t, infos[2].Instance)
+	require.Equal(t, "unknown", infos[2].Name)
+
+	raw, err := json.Marshal(infos[0])
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"metadata":{"name":"master"`, "node fields must stay at the top level")
+	require.Contains(t, string(raw), `"instance":{"id":"i-1"`)
+}
+
+func TestDropletInstance(t *testing.T) {
+	inst := dropletInstance(&godo.Droplet{
+		ID:       42,
+		SizeSlug: "s-2vcpu-4gb",
+		Region:   &godo.Region{Slug: "fra1"},
+		Created:  "2019-01-02T03:04:05Z",
+		Networks: &godo.Networks{
+			V4: []godo.NetworkV4{
+				{IPAddress: "10.1.0.2", Type: "private"},
+				{IPAddress: "1.2.3.4", Type: "public"},
+			},
+		},
+	})
+
+	require.Equal(t, Instance{
+		ID:               "42",
+		Type:             "s-2vcpu-4gb",
+		AvailabilityZone: "fra1",
+		Lifecycle:        LifecycleOnDemand,
+		PrivateIP:        "10.1.0.2",
+		PublicIP:         "1.2.3.4",
+		LaunchTime:       time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, inst)
+}
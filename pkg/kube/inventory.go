@@ -0,0 +1,430 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	ComponentKubelet   = "kubelet"
+	ComponentAPIServer = "kube-apiserver"
+	ComponentEtcd      = "etcd"
+	ComponentCNI       = "cni"
+	ComponentCoreDNS   = "coredns"
+)
+
+const (
+	VersionSourceNode    = "node"
+	VersionSourcePod     = "pod"
+	VersionSourceProfile = "profile"
+)
+
+// componentImages maps image repositories of kube-system pods to components.
+var componentImages = map[string]string{
+	"kube-apiserver":        ComponentAPIServer,
+	"etcd":                  ComponentEtcd,
+	"coredns":               ComponentCoreDNS,
+	"coreos/flannel":        ComponentCNI,
+	"calico/node":           ComponentCNI,
+	"weaveworks/weave-kube": ComponentCNI,
+	"cilium/cilium":         ComponentCNI,
+}
+
+// ComponentVersion is a version of a component run by Count nodes or pods.
+type ComponentVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Image   string `json:"image,omitempty"`
+	Source  string `json:"source"`
+	Count   int    `json:"count"`
+}
+
+// AddonVersion is a chart version of a deployed helm release.
+type AddonVersion struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	Chart     string `json:"chart"`
+	Version   string `json:"version"`
+}
+
+// ClusterInventory lists versions of cluster components and addons. Error is set
+// when some of them couldn't be queried.
+type ClusterInventory struct {
+	KubeID     string             `json:"kubeId"`
+	KubeName   string             `json:"kubeName"`
+	Components []ComponentVersion `json:"components"`
+	Addons     []AddonVersion     `json:"addons"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// InventoryFilter narrows down the fleet inventory, empty fields match everything.
+// Component is a name of a component or a chart of an addon, clusters that run
+// it with a version lower than Below are returned.
+type InventoryFilter struct {
+	KubeIDs   []string
+	Component string
+	Below     string
+}
+
+// Inventory returns versions of components and addons of the cluster.
+func (s Service) Inventory(ctx context.Context, kubeID string) (*ClusterInventory, error) {
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := s.clusterInventory(*k)
+	return &inv, nil
+}
+
+// FleetInventory returns inventories of all operational clusters that match the filter.
+func (s Service) FleetInventory(ctx context.Context, filter InventoryFilter) ([]ClusterInventory, error) {
+	var below *semver.Version
+	if filter.Below != "" {
+		if filter.Component == "" {
+			return nil, errors.Wrap(sgerrors.ErrInvalidJson, "component is required to compare versions")
+		}
+		v, err := semver.NewVersion(filter.Below)
+		if err != nil {
+			return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "version %q", filter.Below)
+		}
+		below = v
+	}
+
+	kubes, err := s.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	wanted := make(map[string]bool, len(filter.KubeIDs))
+	for _, id := range filter.KubeIDs {
+		wanted[id] = true
+	}
+
+	selected := make([]model.Kube, 0, len(kubes))
+	for _, k := range kubes {
+		if k.State != model.StateOperational {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[k.ID] {
+			continue
+		}
+		selected = append(selected, k)
+	}
+
+	inventories := make([]ClusterInventory, len(selected))
+	sem := make(chan struct{}, s.FleetConcurrency())
+	wg := sync.WaitGroup{}
+
+	for i := range selected {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			inventories[i] = s.clusterInventory(selected[i])
+		}(i)
+	}
+	wg.Wait()
+
+	out := make([]ClusterInventory, 0, len(inventories))
+	for _, inv := range inventories {
+		if filter.Component != "" && !inv.runs(filter.Component, below) {
+			continue
+		}
+		out = append(out, inv)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].KubeName < out[j].KubeName
+	})
+
+	return out, nil
+}
+
+func (s Service) clusterInventory(k model.Kube) ClusterInventory {
+	inv := ClusterInventory{
+		KubeID:     k.ID,
+		KubeName:   k.Name,
+		Components: make([]ComponentVersion, 0),
+		Addons:     make([]AddonVersion, 0),
+	}
+	var errs []string
+
+	components, err := s.componentVersions(&k)
+	if err != nil {
+		logrus.Warnf("inventory: cluster %s: %v", k.ID, err)
+		errs = append(errs, err.Error())
+	}
+	inv.Components = append(inv.Components, components...)
+	inv.Components = append(inv.Components, profileVersions(&k, inv.Components)...)
+
+	addons, err := s.addonVersions(&k)
+	if err != nil {
+		logrus.Warnf("inventory: cluster %s: %v", k.ID, err)
+		errs = append(errs, err.Error())
+	}
+	inv.Addons = append(inv.Addons, addons...)
+
+	sort.Slice(inv.Components, func(i, j int) bool {
+		a, b := inv.Components[i], inv.Components[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	inv.Error = strings.Join(errs, "; ")
+
+	return inv
+}
+
+// componentVersions returns kubelet versions of nodes and versions of
+// kube-system pods images.
+func (s Service) componentVersions(k *model.Kube) ([]ComponentVersion, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes client")
+	}
+
+	nodeList, err := kclient.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list nodes")
+	}
+	podList, err := kclient.Pods(metav1.NamespaceSystem).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods")
+	}
+
+	return countVersions(nodeList.Items, podList.Items), nil
+}
+
+func countVersions(nodes []corev1.Node, pods []corev1.Pod) []ComponentVersion {
+	counts := make(map[ComponentVersion]int)
+	for _, node := range nodes {
+		v := node.Status.NodeInfo.KubeletVersion
+		if v == "" {
+			continue
+		}
+		counts[ComponentVersion{
+			Name:    ComponentKubelet,
+			Version: strings.TrimPrefix(v, "v"),
+			Source:  VersionSourceNode,
+		}]++
+	}
+
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			name, version := imageComponent(c.Image)
+			if name == "" {
+				continue
+			}
+			counts[ComponentVersion{
+				Name:    name,
+				Version: version,
+				Image:   c.Image,
+				Source:  VersionSourcePod,
+			}]++
+		}
+	}
+
+	out := make([]ComponentVersion, 0, len(counts))
+	for c, n := range counts {
+		c.Count = n
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// imageComponent returns a component and its version for an image
+// like k8s.gcr.io/kube-apiserver:v1.14.1.
+func imageComponent(image string) (string, string) {
+	repo, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repo, tag = image[:i], image[i+1:]
+	}
+	if tag == "" {
+		return "", ""
+	}
+
+	for suffix, name := range componentImages {
+		if repo == suffix || strings.HasSuffix(repo, "/"+suffix) {
+			return name, strings.TrimPrefix(tag, "v")
+		}
+	}
+
+	return "", ""
+}
+
+// profileVersions returns versions the cluster was provisioned with for
+// components that don't run in pods, e.g. etcd installed on masters.
+func profileVersions(k *model.Kube, found []ComponentVersion) []ComponentVersion {
+	seen := make(map[string]bool, len(found))
+	for _, c := range found {
+		seen[c.Name] = true
+	}
+
+	out := make([]ComponentVersion, 0)
+	if !seen[ComponentAPIServer] && k.K8SVersion != "" {
+		out = append(out, ComponentVersion{
+			Name:    ComponentAPIServer,
+			Version: strings.TrimPrefix(k.K8SVersion, "v"),
+			Source:  VersionSourceProfile,
+			Count:   len(k.Masters),
+		})
+	}
+	if !seen[ComponentCNI] && k.Networking.Version != "" {
+		out = append(out, ComponentVersion{
+			Name:    ComponentCNI,
+			Version: strings.TrimPrefix(k.Networking.Version, "v"),
+			Image:   k.Networking.Manager,
+			Source:  VersionSourceProfile,
+			Count:   len(k.Masters) + len(k.Nodes),
+		})
+	}
+
+	return out
+}
+
+func (s Service) addonVersions(k *model.Kube) ([]AddonVersion, error) {
+	kprx, err := s.helmClient(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build helm proxy")
+	}
+
+	releases, err := listReleases(kprx, "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]AddonVersion, 0, len(releases))
+	for _, rls := range releases {
+		if rls.Status != release.Status_DEPLOYED.String() {
+			continue
+		}
+		out = append(out, AddonVersion{
+			Release:   rls.Name,
+			Namespace: rls.Namespace,
+			Chart:     rls.Chart,
+			Version:   rls.ChartVersion,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Release < out[j].Release
+	})
+
+	return out, nil
+}
+
+// runs reports whether the cluster runs the component or an addon
+// with such chart, a version lower than below when it is set.
+func (inv ClusterInventory) runs(component string, below *semver.Version) bool {
+	versions := make([]string, 0)
+	for _, c := range inv.Components {
+		if c.Name == component {
+			versions = append(versions, c.Version)
+		}
+	}
+	for _, a := range inv.Addons {
+		if a.Chart == component {
+			versions = append(versions, a.Version)
+		}
+	}
+
+	for _, v := range versions {
+		if below == nil || versionLess(v, below) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// versionLess compares release versions, suffixes like -amd64 are ignored.
+func versionLess(version string, than *semver.Version) bool {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch()))
+	if err != nil {
+		return false
+	}
+
+	return release.LessThan(than)
+}
+
+func (h *Handler) getInventory(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	inv, err := h.svc.Inventory(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(inv); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// listFleetInventory answers which clusters run a component below a version:
+// GET /kubes/inventory?kubeID=a,b&component=coredns&below=1.8
+func (h *Handler) listFleetInventory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := InventoryFilter{
+		Component: q.Get("component"),
+		Below:     q.Get("below"),
+	}
+	for _, ids := range q["kubeID"] {
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				filter.KubeIDs = append(filter.KubeIDs, id)
+			}
+		}
+	}
+
+	inventories, err := h.svc.FleetInventory(r.Context(), filter)
+	if err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		logrus.Errorf("inventory: list fleet inventory: %s", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(inventories); err != nil {
+		logrus.Errorf("inventory: list fleet inventory: write response: %s", err)
+		message.SendUnknownError(w, err)
+	}
+}
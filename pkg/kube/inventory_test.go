@@ -0,0 +1,287 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+	"github.com/supergiant/control/pkg/testutils/storage"
+)
+
+func inventoryNode(name, kubelet string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubelet},
+		},
+	}
+}
+
+func inventoryPod(images ...string) corev1.Pod {
+	pod := corev1.Pod{}
+	for _, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Image: image})
+	}
+	return pod
+}
+
+func addonRelease(name, chrt, version string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "kube-system",
+		Info: &release.Info{
+			FirstDeployed: &timestamp.Timestamp{},
+			LastDeployed:  &timestamp.Timestamp{},
+			Status:        &release.Status{Code: release.Status_DEPLOYED},
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: chrt, Version: version},
+		},
+	}
+}
+
+func inventoryClient(coreDNS string) func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+	return func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		cl := &fakev1client.FakeCoreV1{
+			Fake: &kubetesting.Fake{},
+		}
+		cl.AddReactor("list", "nodes",
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				return true, &corev1.NodeList{
+					Items: []corev1.Node{
+						inventoryNode("master", "v1.14.1"),
+						inventoryNode("node-1", "v1.14.1"),
+						inventoryNode("node-2", "v1.13.5"),
+					},
+				}, nil
+			})
+		cl.AddReactor("list", "pods",
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				return true, &corev1.PodList{
+					Items: []corev1.Pod{
+						inventoryPod("k8s.gcr.io/kube-apiserver:v1.14.1"),
+						inventoryPod("k8s.gcr.io/coredns:" + coreDNS),
+						inventoryPod("k8s.gcr.io/coredns:" + coreDNS),
+						inventoryPod("quay.io/coreos/flannel:v0.10.0-amd64"),
+						inventoryPod("k8s.gcr.io/kube-proxy:v1.14.1"),
+					},
+				}, nil
+			})
+		return cl, nil
+	}
+}
+
+func TestImageComponent(t *testing.T) {
+	for _, tc := range []struct {
+		image           string
+		expectedName    string
+		expectedVersion string
+	}{
+		{"k8s.gcr.io/kube-apiserver:v1.14.1", ComponentAPIServer, "1.14.1"},
+		{"k8s.gcr.io/etcd:3.3.10", ComponentEtcd, "3.3.10"},
+		{"coredns/coredns:1.7.0", ComponentCoreDNS, "1.7.0"},
+		{"calico/node:v3.3.2", ComponentCNI, "3.3.2"},
+		{"docker.io/weaveworks/weave-kube:2.5.1", ComponentCNI, "2.5.1"},
+		{"localhost:5000/etcd", "", ""},
+		{"k8s.gcr.io/kube-proxy:v1.14.1", "", ""},
+		{"my-etcd-operator:1.0.0", "", ""},
+	} {
+		name, version := imageComponent(tc.image)
+		require.Equal(t, tc.expectedName, name, tc.image)
+		require.Equal(t, tc.expectedVersion, version, tc.image)
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	below, _ := semver.NewVersion("1.8")
+
+	require.True(t, versionLess("1.7.0", below))
+	require.False(t, versionLess("1.8.0", below))
+	require.False(t, versionLess("1.8.0-amd64", below), "suffixes must be ignored")
+	require.False(t, versionLess("latest", below))
+}
+
+func TestService_Inventory(t *testing.T) {
+	kubeData, _ := json.Marshal(&model.Kube{
+		ID:         "kube",
+		K8SVersion: "1.14.1",
+		Masters:    map[string]*model.Machine{"master": {}},
+	})
+
+	svc := Service{
+		storage:        &storage.Fake{Item: kubeData},
+		corev1ClientFn: inventoryClient("1.3.1"),
+		newHelmProxyFn: func(k *model.Kube) (proxy.Interface, error) {
+			return &fakeHelmProxy{
+				listReleaseResp: &services.ListReleasesResponse{
+					Releases: []*release.Release{
+						addonRelease("ingress", "nginx-ingress", "1.6.0"),
+						chartRelease("old", "nginx-ingress", "1.0.0"),
+					},
+				},
+			}, nil
+		},
+	}
+
+	inv, err := svc.Inventory(context.Background(), "kube")
+	require.NoError(t, err)
+	require.Empty(t, inv.Error)
+
+	versions := map[string][]ComponentVersion{}
+	for _, c := range inv.Components {
+		versions[c.Name] = append(versions[c.Name], c)
+	}
+	require.Len(t, versions[ComponentKubelet], 2)
+	require.Equal(t, "1.13.5", versions[ComponentKubelet][0].Version)
+	require.Equal(t, 2, versions[ComponentKubelet][1].Count)
+	require.Equal(t, "1.3.1", versions[ComponentCoreDNS][0].Version)
+	require.Equal(t, 2, versions[ComponentCoreDNS][0].Count)
+	require.Equal(t, "0.10.0-amd64", versions[ComponentCNI][0].Version)
+	require.Equal(t, VersionSourcePod, versions[ComponentAPIServer][0].Source)
+	require.Empty(t, versions[ComponentEtcd], "etcd runs outside of pods")
+
+	require.Len(t, inv.Addons, 1, "only deployed releases are addons")
+	require.Equal(t, "1.6.0", inv.Addons[0].Version)
+
+	svc.corev1ClientFn = nil
+	inv, err = svc.Inventory(context.Background(), "kube")
+	require.NoError(t, err)
+	require.NotEmpty(t, inv.Error)
+	require.Len(t, inv.Components, 1)
+	require.Equal(t, VersionSourceProfile, inv.Components[0].Source)
+}
+
+func TestService_FleetInventory(t *testing.T) {
+	var items [][]byte
+	for _, k := range []model.Kube{
+		{ID: "a", Name: "a", State: model.StateOperational},
+		{ID: "b", Name: "b", State: model.StateOperational},
+		{ID: "c", Name: "c", State: model.StateProvisioning},
+	} {
+		raw, _ := json.Marshal(k)
+		items = append(items, raw)
+	}
+
+	svc := Service{
+		storage: &storage.Fake{Items: items},
+		corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+			if k.ID == "a" {
+				return inventoryClient("1.7.0")(k)
+			}
+			return inventoryClient("1.8.3")(k)
+		},
+		newHelmProxyFn: func(k *model.Kube) (proxy.Interface, error) {
+			return &fakeHelmProxy{
+				listReleaseResp: &services.ListReleasesResponse{
+					Releases: []*release.Release{
+						addonRelease("ingress", "nginx-ingress", "1.6.0"),
+					},
+				},
+			}, nil
+		},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		filter      InventoryFilter
+		expectedIDs []string
+		expectedErr error
+	}{
+		{
+			name:        "all",
+			expectedIDs: []string{"a", "b"},
+		},
+		{
+			name:        "version without component",
+			filter:      InventoryFilter{Below: "1.8"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid version",
+			filter:      InventoryFilter{Component: ComponentCoreDNS, Below: "new"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "old coredns",
+			filter:      InventoryFilter{Component: ComponentCoreDNS, Below: "1.8"},
+			expectedIDs: []string{"a"},
+		},
+		{
+			name:        "addon",
+			filter:      InventoryFilter{Component: "nginx-ingress", Below: "2.0.0"},
+			expectedIDs: []string{"a", "b"},
+		},
+		{
+			name:        "selected clusters",
+			filter:      InventoryFilter{KubeIDs: []string{"b"}, Component: ComponentEtcd},
+			expectedIDs: []string{},
+		},
+	} {
+		res, err := svc.FleetInventory(context.Background(), tc.filter)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		ids := make([]string, 0, len(res))
+		for _, inv := range res {
+			ids = append(ids, inv.KubeID)
+		}
+		require.Equal(t, tc.expectedIDs, ids, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_inventory(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceInventory, mock.Anything, "kube").
+		Return(&ClusterInventory{KubeID: "kube"}, nil)
+	svc.On(serviceInventory, mock.Anything, "missing").
+		Return(nil, sgerrors.ErrNotFound)
+	svc.On(serviceFleetInventory, mock.Anything, InventoryFilter{
+		KubeIDs:   []string{"a", "b"},
+		Component: ComponentCoreDNS,
+		Below:     "1.8",
+	}).Return([]ClusterInventory{{KubeID: "a"}}, nil)
+	svc.On(serviceFleetInventory, mock.Anything, InventoryFilter{Below: "1.8"}).
+		Return(nil, errors.Wrap(sgerrors.ErrInvalidJson, "component is required"))
+
+	h := Handler{svc: svc}
+	router := mux.NewRouter()
+	h.Register(router)
+
+	for _, tc := range []struct {
+		url          string
+		expectedCode int
+	}{
+		{"/kubes/kube/inventory", http.StatusOK},
+		{"/kubes/missing/inventory", http.StatusNotFound},
+		{"/kubes/inventory?kubeID=a,b&component=coredns&below=1.8", http.StatusOK},
+		{"/kubes/inventory?below=1.8", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, tc.url)
+	}
+}
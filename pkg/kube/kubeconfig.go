@@ -72,14 +72,18 @@ func adminKubeConfig(k *model.Kube) (clientcmddapi.Config, error) {
 		// TODO: use another base error, not ErrNotFound
 		return clientcmddapi.Config{}, errors.Wrap(sgerrors.ErrNotFound, "master nodes")
 	}
-	m := util.GetRandomNode(k.Masters)
+	// the dns name follows replaced masters
+	host := k.APIHost
+	if host == "" {
+		host = util.GetRandomNode(k.Masters).PublicIp
+	}
 
 	var apiAddr string
 	if k.APIPort != "" {
-		apiAddr = fmt.Sprintf("https://%s:%s", m.PublicIp, k.APIPort)
+		apiAddr = fmt.Sprintf("https://%s:%s", host, k.APIPort)
 	} else {
 		// TODO: apiPort has been hardcoded in provisioner, use 443 by default
-		apiAddr = fmt.Sprintf("https://%s", m.PublicIp)
+		apiAddr = fmt.Sprintf("https://%s", host)
 	}
 
 	// TODO: add validation
@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+// LogOptions select lines of a pod log, zero TailLines and SinceSeconds
+// return the whole log.
+type LogOptions struct {
+	Follow       bool  `json:"follow"`
+	Previous     bool  `json:"previous"`
+	Timestamps   bool  `json:"timestamps"`
+	TailLines    int64 `json:"tailLines"`
+	SinceSeconds int64 `json:"sinceSeconds"`
+}
+
+func (o LogOptions) podLogOptions(container string) *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     o.Follow,
+		Previous:   o.Previous,
+		Timestamps: o.Timestamps,
+	}
+	if o.TailLines > 0 {
+		opts.TailLines = &o.TailLines
+	}
+	if o.SinceSeconds > 0 {
+		opts.SinceSeconds = &o.SinceSeconds
+	}
+	return opts
+}
+
+// logOptions reads log options from the query:
+// ?follow=true&tailLines=100&sinceSeconds=3600&previous=false&timestamps=true
+func logOptions(q url.Values) (LogOptions, error) {
+	opts := LogOptions{}
+	for name, v := range map[string]*bool{
+		"follow":     &opts.Follow,
+		"previous":   &opts.Previous,
+		"timestamps": &opts.Timestamps,
+	} {
+		if s := q.Get(name); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return opts, errors.Wrapf(sgerrors.ErrInvalidJson, "%s %q", name, s)
+			}
+			*v = b
+		}
+	}
+	for name, v := range map[string]*int64{
+		"tailLines":    &opts.TailLines,
+		"sinceSeconds": &opts.SinceSeconds,
+	} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n <= 0 {
+				return opts, errors.Wrapf(sgerrors.ErrInvalidJson, "%s %q", name, s)
+			}
+			*v = n
+		}
+	}
+	return opts, nil
+}
+
+// PodLogs copies the log of the pod container to w, a followed log is
+// copied until the container stops or ctx is done.
+func (s Service) PodLogs(ctx context.Context, kubeID, ns, pod, container string, opts LogOptions, w io.Writer) error {
+	if s.corev1ClientFn == nil {
+		return errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return errors.Wrap(err, "get kube")
+	}
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	stream, err := kclient.Pods(ns).GetLogs(pod, opts.podLogOptions(container)).Context(ctx).Stream()
+	if err != nil {
+		return resourceError(err, "get logs of %s/%s", ns, pod)
+	}
+	defer stream.Close()
+
+	if _, err = io.Copy(w, stream); err != nil && ctx.Err() == nil {
+		return errors.Wrapf(err, "copy logs of %s/%s", ns, pod)
+	}
+	return nil
+}
+
+// flushWriter sends every write to the client at once, so followed logs
+// aren't held in buffers of the server.
+type flushWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (f *flushWriter) Write(b []byte) (int, error) {
+	f.written = true
+	n, err := f.w.Write(b)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// getPodLogs streams the log of a pod as plain text:
+// GET /kubes/{kubeID}/pods/{namespace}/{pod}/logs?container=app&follow=true&tailLines=100
+func (h *Handler) getPodLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, ns, pod := vars["kubeID"], vars["namespace"], vars["pod"]
+
+	opts, err := logOptions(r.URL.Query())
+	if err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fw := &flushWriter{w: w}
+	err = h.svc.PodLogs(r.Context(), kubeID, ns, pod, r.URL.Query().Get("container"), opts, fw)
+	if err != nil {
+		// the status has been sent with the first line
+		if fw.written {
+			logrus.Warnf("kube %s: logs of %s/%s: %v", kubeID, ns, pod, err)
+			return
+		}
+		sendResourceError(w, pod, err)
+	}
+}
@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestLogOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		query        string
+		expectedOpts LogOptions
+		expectedErr  error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:         "all",
+			query:        "follow=true&previous=1&timestamps=true&tailLines=100&sinceSeconds=60",
+			expectedOpts: LogOptions{Follow: true, Previous: true, Timestamps: true, TailLines: 100, SinceSeconds: 60},
+		},
+		{
+			name:        "invalid follow",
+			query:       "follow=yes",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "negative tail",
+			query:       "tailLines=-1",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+	} {
+		q, err := url.ParseQuery(tc.query)
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		opts, err := logOptions(q)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err == nil {
+			require.Equal(t, tc.expectedOpts, opts, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestService_PodLogs(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/pods/web/log" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		_, _ = io.WriteString(w, "line 1\nline 2\n")
+	}))
+	defer srv.Close()
+
+	clients := fakeClusterClients(map[string]*fakeAPIServer{"kube": {Server: srv}})
+	svc := Service{
+		storage: kubeStorage(&model.Kube{ID: "kube"}),
+		corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+			restClient, err := clients(k, schema.GroupVersion{Version: "v1"})
+			if err != nil {
+				return nil, err
+			}
+			return corev1client.New(restClient), nil
+		},
+	}
+
+	for _, tc := range []struct {
+		name          string
+		kubeID        string
+		pod           string
+		expectedErr   error
+		expectedLogs  string
+		expectedQuery url.Values
+	}{
+		{
+			name:        "kube not found",
+			kubeID:      "unknown",
+			pod:         "web",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "pod not found",
+			kubeID:      "kube",
+			pod:         "db",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:         "ok",
+			kubeID:       "kube",
+			pod:          "web",
+			expectedLogs: "line 1\nline 2\n",
+			expectedQuery: url.Values{
+				"container":  {"app"},
+				"follow":     {"true"},
+				"tailLines":  {"10"},
+				"timestamps": {"true"},
+			},
+		},
+	} {
+		query = nil
+		buf := &bytes.Buffer{}
+		opts := LogOptions{Follow: true, Timestamps: true, TailLines: 10}
+
+		err := svc.PodLogs(context.Background(), tc.kubeID, "default", tc.pod, "app", opts, buf)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+		require.Equal(t, tc.expectedLogs, buf.String(), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedQuery, query, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getPodLogs(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		query        string
+		logs         string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "invalid options",
+			query:        "tailLines=all",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			err:          sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "failed after the first line",
+			logs:         "line 1\n",
+			err:          errFake,
+			expectedCode: http.StatusOK,
+			expectedBody: "line 1\n",
+		},
+		{
+			name:         "ok",
+			query:        "container=app&tailLines=2",
+			logs:         "line 1\nline 2\n",
+			expectedCode: http.StatusOK,
+			expectedBody: "line 1\nline 2\n",
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(servicePodLogs, mock.Anything, "kube", "default", "web", mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				if tc.logs != "" {
+					_, _ = io.WriteString(args.Get(6).(io.Writer), tc.logs)
+				}
+			}).
+			Return(tc.err)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/pods/default/web/logs?"+tc.query, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code == http.StatusOK {
+			require.Equal(t, tc.expectedBody, rec.Body.String(), "TC: %s", tc.name)
+		}
+	}
+}
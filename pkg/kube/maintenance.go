@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+var ErrMaintenance = errors.New("the cluster is in maintenance, only admins may change it")
+
+// MaintenanceRequest enables or ends maintenance of a cluster.
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// setMaintenance enables or ends maintenance of the cluster, background jobs
+// skip clusters in maintenance, so operators can work on them manually.
+func (h *Handler) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	if !api.IsAdmin(r.Context()) {
+		http.Error(w, "maintenance is managed by admins", http.StatusForbidden)
+		return
+	}
+
+	req := MaintenanceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if req.Enabled && strings.TrimSpace(req.Reason) == "" {
+		message.SendValidationFailed(w, errors.Wrap(sgerrors.ErrInvalidJson, "reason is required"))
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	user := api.UserFromContext(r.Context())
+	if req.Enabled {
+		if !k.Maintenance.Enabled {
+			k.Maintenance.Since = time.Now()
+		}
+		k.Maintenance.Enabled = true
+		k.Maintenance.Reason = strings.TrimSpace(req.Reason)
+		k.Maintenance.By = user
+		logrus.Infof("kube %s is in maintenance by %s: %s", kubeID, user, k.Maintenance.Reason)
+	} else {
+		k.Maintenance = model.Maintenance{}
+		logrus.Infof("maintenance of kube %s has been ended by %s", kubeID, user)
+	}
+
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(k); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// MaintenanceGate refuses changes of clusters in maintenance unless they are
+// made by admins, clusters are read as usual.
+func (h *Handler) MaintenanceGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kubeID := mux.Vars(r)["kubeID"]
+		if kubeID == "" || api.IsAdmin(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// unknown clusters are left to the api
+		k, err := h.svc.Get(r.Context(), kubeID)
+		if err != nil || !k.InMaintenance() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.Error(w, ErrMaintenance.Error(), http.StatusLocked)
+	})
+}
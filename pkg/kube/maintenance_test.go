@@ -0,0 +1,142 @@
+package kube
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/model"
+)
+
+// roleTokens treats tokens as users with the access of the same name.
+type roleTokens struct{}
+
+func (roleTokens) Validate(token string) (jwt.MapClaims, error) {
+	return jwt.MapClaims{"user_id": token, "accesses": []interface{}{token}}, nil
+}
+
+func maintenanceRouter(svc Interface) *mux.Router {
+	h := NewHandler(svc, nil, nil, nil, nil, nil, nil)
+	router := mux.NewRouter()
+	h.Register(router)
+	auth := api.Middleware{TokenService: roleTokens{}}
+	router.Use(auth.AuthMiddleware, h.MaintenanceGate)
+
+	return router
+}
+
+func TestHandler_setMaintenance(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		user         string
+		body         string
+		kube         *model.Kube
+		expectedCode int
+		expected     *model.Maintenance
+	}{
+		{
+			name:         "not an admin",
+			user:         "edit",
+			body:         `{"enabled":true,"reason":"etcd restore"}`,
+			kube:         &model.Kube{ID: "kube"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "without reason",
+			user:         "admin",
+			body:         `{"enabled":true}`,
+			kube:         &model.Kube{ID: "kube"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "enable",
+			user:         "admin",
+			body:         `{"enabled":true,"reason":"etcd restore"}`,
+			kube:         &model.Kube{ID: "kube"},
+			expectedCode: http.StatusOK,
+			expected:     &model.Maintenance{Enabled: true, Reason: "etcd restore", By: "admin"},
+		},
+		{
+			name:         "end",
+			user:         "admin",
+			body:         `{"enabled":false}`,
+			kube:         &model.Kube{ID: "kube", Maintenance: model.Maintenance{Enabled: true, Reason: "etcd restore"}},
+			expectedCode: http.StatusOK,
+			expected:     &model.Maintenance{},
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		req := httptest.NewRequest(http.MethodPut, "/kubes/kube/maintenance", bytes.NewReader([]byte(tc.body)))
+		req.Header.Set("Authorization", "Bearer "+tc.user)
+		rec := httptest.NewRecorder()
+		maintenanceRouter(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if tc.expected == nil {
+			svc.AssertNotCalled(t, serviceCreate, mock.Anything, mock.Anything)
+			continue
+		}
+		tc.kube.Maintenance.Since = tc.expected.Since
+		require.Equal(t, *tc.expected, tc.kube.Maintenance, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_MaintenanceGate(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		user         string
+		method       string
+		maintenance  bool
+		expectedCode int
+	}{
+		{
+			name:         "change of a cluster",
+			user:         "edit",
+			method:       http.MethodPatch,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "read in maintenance",
+			user:         "edit",
+			method:       http.MethodGet,
+			maintenance:  true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "change in maintenance",
+			user:         "edit",
+			method:       http.MethodPatch,
+			maintenance:  true,
+			expectedCode: http.StatusLocked,
+		},
+		{
+			name:         "change by admin in maintenance",
+			user:         "admin",
+			method:       http.MethodPatch,
+			maintenance:  true,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		k := &model.Kube{ID: "kube", Name: "prod", Maintenance: model.Maintenance{Enabled: tc.maintenance}}
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+		svc.On(serviceUpdate, mock.Anything, "kube").Return(k, nil)
+
+		req := httptest.NewRequest(tc.method, "/kubes/kube", bytes.NewReader([]byte(`{"owner":"team"}`)))
+		req.Header.Set("Authorization", "Bearer "+tc.user)
+		rec := httptest.NewRecorder()
+		maintenanceRouter(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
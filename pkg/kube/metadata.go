@@ -0,0 +1,126 @@
+package kube
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const maxDisplayNameLength = 100
+
+// UpdateRequest renames a cluster and edits its metadata, fields that are
+// not set are left as they are. An empty display name restores the name,
+// an empty bastion makes consoles connect to nodes directly.
+type UpdateRequest struct {
+	DisplayName *string           `json:"displayName"`
+	Description *string           `json:"description"`
+	Owner       *string           `json:"owner"`
+	Links       *[]model.KubeLink `json:"links"`
+	Bastion     *string           `json:"bastion"`
+}
+
+func (req UpdateRequest) validate() error {
+	if req.DisplayName != nil && len(*req.DisplayName) > maxDisplayNameLength {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "display name is longer than %d characters", maxDisplayNameLength)
+	}
+	if req.Bastion != nil && *req.Bastion != "" {
+		host := *req.Bastion
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" || strings.ContainsAny(host, " /@") {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "bastion %q must be host[:port]", *req.Bastion)
+		}
+	}
+	if req.Links == nil {
+		return nil
+	}
+
+	for _, l := range *req.Links {
+		if strings.TrimSpace(l.Title) == "" {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "title of link %s is empty", l.URL)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "link %q must be an http url", l.URL)
+		}
+	}
+	return nil
+}
+
+// updateKube renames the cluster and edits its metadata, the id and the name
+// of the cluster are kept, so storage keys and cloud tags don't change.
+func (h *Handler) updateKube(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := UpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	// display names are unique, they are checked against other clusters
+	var kubes []model.Kube
+	if req.DisplayName != nil && strings.TrimSpace(*req.DisplayName) != "" {
+		var err error
+		if kubes, err = h.svc.ListAll(r.Context()); err != nil {
+			message.SendUnknownError(w, err)
+			return
+		}
+	}
+
+	k, err := h.svc.Update(r.Context(), kubeID, func(k *model.Kube) error {
+		if req.DisplayName != nil {
+			name := strings.TrimSpace(*req.DisplayName)
+			if name != "" && name != k.Title() {
+				for i := range kubes {
+					if kubes[i].ID != k.ID && (kubes[i].Name == name || kubes[i].DisplayName == name) {
+						return errors.Wrap(sgerrors.ErrAlreadyExists, name)
+					}
+				}
+			}
+			k.DisplayName = name
+		}
+		if req.Description != nil {
+			k.Metadata.Description = strings.TrimSpace(*req.Description)
+		}
+		if req.Owner != nil {
+			k.Metadata.Owner = strings.TrimSpace(*req.Owner)
+		}
+		if req.Links != nil {
+			k.Metadata.Links = *req.Links
+		}
+		if req.Bastion != nil {
+			k.SSHConfig.Bastion = strings.TrimSpace(*req.Bastion)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case sgerrors.IsNotFound(err):
+			message.SendNotFound(w, kubeID, err)
+		case sgerrors.IsAlreadyExists(err):
+			message.SendAlreadyExists(w, strings.TrimSpace(*req.DisplayName), err)
+		default:
+			message.SendUnknownError(w, err)
+		}
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(k); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
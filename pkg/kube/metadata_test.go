@@ -0,0 +1,114 @@
+package kube
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+)
+
+func TestHandler_updateKube(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		kube         *model.Kube
+		expectedCode int
+		expectedKube *model.Kube
+	}{
+		{
+			name:         "invalid json",
+			body:         `{`,
+			kube:         &model.Kube{ID: "kube", Name: "prod"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid link",
+			body:         `{"links":[{"title":"runbook","url":"wiki/prod"}]}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "name of another cluster",
+			body:         `{"displayName":"staging"}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod"},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "rename",
+			body:         `{"displayName":" Production "}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod", Metadata: model.KubeMetadata{Owner: "team"}},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{
+				ID:          "kube",
+				Name:        "prod",
+				DisplayName: "Production",
+				Metadata:    model.KubeMetadata{Owner: "team"},
+			},
+		},
+		{
+			name:         "restore the name",
+			body:         `{"displayName":""}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod", DisplayName: "Production"},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{ID: "kube", Name: "prod"},
+		},
+		{
+			name:         "metadata",
+			body:         `{"description":"payments","owner":"team","links":[{"title":"runbook","url":"https://wiki/prod"}]}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod", DisplayName: "Production"},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{
+				ID:          "kube",
+				Name:        "prod",
+				DisplayName: "Production",
+				Metadata: model.KubeMetadata{
+					Description: "payments",
+					Owner:       "team",
+					Links:       []model.KubeLink{{Title: "runbook", URL: "https://wiki/prod"}},
+				},
+			},
+		},
+		{
+			name:         "invalid bastion",
+			body:         `{"bastion":"ops@jump.example.com"}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "bastion",
+			body:         `{"bastion":"jump.example.com:2222"}`,
+			kube:         &model.Kube{ID: "kube", Name: "prod"},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{
+				ID:        "kube",
+				Name:      "prod",
+				SSHConfig: model.SSHConfig{Bastion: "jump.example.com:2222"},
+			},
+		},
+	} {
+		original := *tc.kube
+		svc := new(kubeServiceMock)
+		svc.On(serviceUpdate, mock.Anything, "kube").Return(tc.kube, nil)
+		svc.On(serviceListAll, mock.Anything).Return([]model.Kube{
+			*tc.kube,
+			{ID: "other", Name: "staging"},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodPatch, "/kubes/kube", bytes.NewReader([]byte(tc.body)))
+		req.Header.Set("Authorization", "Bearer alice")
+		rec := httptest.NewRecorder()
+		protectionRouter(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if tc.expectedKube == nil {
+			require.Equal(t, &original, tc.kube, "TC: %s", tc.name)
+			continue
+		}
+		require.Equal(t, tc.expectedKube, tc.kube, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,309 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	// MetricsSourceMetricsServer is a source of usage when the cluster runs metrics-server.
+	MetricsSourceMetricsServer = "metrics-server"
+	// MetricsSourceKubelet is a source of usage read from summary api of kubelets.
+	MetricsSourceKubelet = "kubelet"
+)
+
+// ResourceUtilization is a live usage of an allocatable resource.
+// CPU values are in millicores, memory values are in bytes.
+type ResourceUtilization struct {
+	Allocatable int64   `json:"allocatable"`
+	Used        int64   `json:"used"`
+	Utilization float64 `json:"utilization"`
+}
+
+// NodeMetrics is a resource usage of a node.
+type NodeMetrics struct {
+	Name   string              `json:"name"`
+	Pool   string              `json:"pool"`
+	CPU    ResourceUtilization `json:"cpu"`
+	Memory ResourceUtilization `json:"memory"`
+}
+
+// PodMetrics is a resource usage of a pod.
+type PodMetrics struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node,omitempty"`
+	CPU       int64  `json:"cpu"`
+	Memory    int64  `json:"memory"`
+}
+
+// ClusterUsage is a live resource usage of nodes and pods of a cluster.
+type ClusterUsage struct {
+	KubeID    string    `json:"kubeId"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	CPU    ResourceUtilization `json:"cpu"`
+	Memory ResourceUtilization `json:"memory"`
+	Nodes  []NodeMetrics       `json:"nodes"`
+	Pods   []PodMetrics        `json:"pods"`
+}
+
+type nodeMetricsList struct {
+	Items []struct {
+		Metadata metav1.ObjectMeta   `json:"metadata"`
+		Usage    corev1.ResourceList `json:"usage"`
+	} `json:"items"`
+}
+
+// kubeletSummary is a part of the kubelet summary api response.
+type kubeletSummary struct {
+	Node struct {
+		CPU    kubeletCPUStats    `json:"cpu"`
+		Memory kubeletMemoryStats `json:"memory"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU    kubeletCPUStats    `json:"cpu"`
+		Memory kubeletMemoryStats `json:"memory"`
+	} `json:"pods"`
+}
+
+type kubeletCPUStats struct {
+	UsageNanoCores int64 `json:"usageNanoCores"`
+}
+
+type kubeletMemoryStats struct {
+	WorkingSetBytes int64 `json:"workingSetBytes"`
+}
+
+// Metrics returns cpu and memory usage of nodes and pods of the cluster.
+// Usage is taken from metrics-server, summary api of kubelets is queried
+// when the cluster runs none.
+func (s Service) Metrics(ctx context.Context, kubeID string) (*ClusterUsage, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+	if s.clientForGroupFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "group client builder")
+	}
+
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeList, err := kclient.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list nodes")
+	}
+
+	usage, err := s.metricsServerUsage(k)
+	if err != nil {
+		logrus.Debugf("metrics of cluster %s: metrics server: %v", kubeID, err)
+
+		usage, err = s.kubeletUsage(k, nodeList.Items)
+		if err != nil {
+			return nil, err
+		}
+		return buildClusterUsage(k, nodeList.Items, usage), nil
+	}
+
+	// pods metrics of metrics-server are not bound to nodes
+	podList, err := kclient.Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods")
+	}
+	podNodes := make(map[string]string, len(podList.Items))
+	for _, pod := range podList.Items {
+		podNodes[pod.Namespace+"/"+pod.Name] = pod.Spec.NodeName
+	}
+	for i := range usage.Pods {
+		usage.Pods[i].Node = podNodes[usage.Pods[i].Namespace+"/"+usage.Pods[i].Name]
+	}
+
+	return buildClusterUsage(k, nodeList.Items, usage), nil
+}
+
+func (s Service) metricsServerUsage(k *model.Kube) (*ClusterUsage, error) {
+	client, err := s.clientForGroupFn(k, metricsGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := client.Get().Resource("nodes").DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "get node metrics")
+	}
+	nodes := nodeMetricsList{}
+	if err = json.Unmarshal(raw, &nodes); err != nil {
+		return nil, errors.Wrap(err, "decode node metrics")
+	}
+
+	raw, err = client.Get().Resource("pods").DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "get pod metrics")
+	}
+	pods := podMetricsList{}
+	if err = json.Unmarshal(raw, &pods); err != nil {
+		return nil, errors.Wrap(err, "decode pod metrics")
+	}
+
+	usage := &ClusterUsage{
+		Source: MetricsSourceMetricsServer,
+		Nodes:  make([]NodeMetrics, 0, len(nodes.Items)),
+		Pods:   make([]PodMetrics, 0, len(pods.Items)),
+	}
+	for _, item := range nodes.Items {
+		usage.Nodes = append(usage.Nodes, NodeMetrics{
+			Name:   item.Metadata.Name,
+			CPU:    ResourceUtilization{Used: requestedValue(item.Usage, corev1.ResourceCPU)},
+			Memory: ResourceUtilization{Used: requestedValue(item.Usage, corev1.ResourceMemory)},
+		})
+	}
+	for _, item := range pods.Items {
+		total := corev1.ResourceList{}
+		for _, c := range item.Containers {
+			addResources(total, c.Usage)
+		}
+		usage.Pods = append(usage.Pods, PodMetrics{
+			Name:      item.Metadata.Name,
+			Namespace: item.Metadata.Namespace,
+			CPU:       requestedValue(total, corev1.ResourceCPU),
+			Memory:    requestedValue(total, corev1.ResourceMemory),
+		})
+	}
+
+	return usage, nil
+}
+
+// kubeletUsage reads summaries of nodes through the apiserver proxy, nodes
+// which kubelets don't respond are left out.
+func (s Service) kubeletUsage(k *model.Kube, nodes []corev1.Node) (*ClusterUsage, error) {
+	client, err := s.clientForGroupFn(k, schema.GroupVersion{Version: "v1"})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &ClusterUsage{
+		Source: MetricsSourceKubelet,
+		Nodes:  make([]NodeMetrics, 0, len(nodes)),
+		Pods:   make([]PodMetrics, 0),
+	}
+	for _, node := range nodes {
+		raw, err := client.Get().Resource("nodes").Name(node.Name).
+			SubResource("proxy").Suffix("stats/summary").DoRaw()
+		if err != nil {
+			logrus.Debugf("metrics of cluster %s: kubelet of node %s: %v", k.ID, node.Name, err)
+			continue
+		}
+		summary := kubeletSummary{}
+		if err = json.Unmarshal(raw, &summary); err != nil {
+			logrus.Debugf("metrics of cluster %s: decode summary of node %s: %v", k.ID, node.Name, err)
+			continue
+		}
+
+		usage.Nodes = append(usage.Nodes, NodeMetrics{
+			Name:   node.Name,
+			CPU:    ResourceUtilization{Used: summary.Node.CPU.UsageNanoCores / 1e6},
+			Memory: ResourceUtilization{Used: summary.Node.Memory.WorkingSetBytes},
+		})
+		for _, pod := range summary.Pods {
+			usage.Pods = append(usage.Pods, PodMetrics{
+				Name:      pod.PodRef.Name,
+				Namespace: pod.PodRef.Namespace,
+				Node:      node.Name,
+				CPU:       pod.CPU.UsageNanoCores / 1e6,
+				Memory:    pod.Memory.WorkingSetBytes,
+			})
+		}
+	}
+
+	if len(nodes) > 0 && len(usage.Nodes) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "metrics of cluster %s", k.ID)
+	}
+	return usage, nil
+}
+
+// buildClusterUsage sets allocatable resources and pools of nodes to the usage
+// and sums it up.
+func buildClusterUsage(k *model.Kube, nodes []corev1.Node, usage *ClusterUsage) *ClusterUsage {
+	usage.KubeID = k.ID
+	usage.CreatedAt = time.Now()
+
+	byName := make(map[string]corev1.Node, len(nodes))
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+
+	for i := range usage.Nodes {
+		n := &usage.Nodes[i]
+		if node, ok := byName[n.Name]; ok {
+			n.Pool = nodePool(k, node)
+			n.CPU.Allocatable = node.Status.Allocatable.Cpu().MilliValue()
+			n.Memory.Allocatable = node.Status.Allocatable.Memory().Value()
+		}
+		n.CPU.calcUtilization()
+		n.Memory.calcUtilization()
+
+		usage.CPU.Allocatable += n.CPU.Allocatable
+		usage.CPU.Used += n.CPU.Used
+		usage.Memory.Allocatable += n.Memory.Allocatable
+		usage.Memory.Used += n.Memory.Used
+	}
+	usage.CPU.calcUtilization()
+	usage.Memory.calcUtilization()
+
+	sort.Slice(usage.Nodes, func(i, j int) bool {
+		return usage.Nodes[i].Name < usage.Nodes[j].Name
+	})
+	sort.Slice(usage.Pods, func(i, j int) bool {
+		if usage.Pods[i].Namespace != usage.Pods[j].Namespace {
+			return usage.Pods[i].Namespace < usage.Pods[j].Namespace
+		}
+		return usage.Pods[i].Name < usage.Pods[j].Name
+	})
+
+	return usage
+}
+
+func (r *ResourceUtilization) calcUtilization() {
+	r.Utilization = utilization(ResourceCapacity{Allocatable: r.Allocatable, Requested: r.Used})
+}
+
+// getUsage returns live usage of nodes and pods of the cluster:
+// GET /kubes/{kubeID}/usage
+func (h *Handler) getUsage(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	usage, err := h.svc.Metrics(r.Context(), kubeID)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(usage); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,184 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestService_Metrics(t *testing.T) {
+	metricsServer := newFakeAPIServer(t, map[string]string{
+		"/apis/metrics.k8s.io/v1beta1/nodes": `{"items": [
+			{"metadata": {"name": "node-1"}, "usage": {"cpu": "500m", "memory": "1Gi"}},
+			{"metadata": {"name": "node-2"}, "usage": {"cpu": "1", "memory": "1Gi"}}
+		]}`,
+		"/apis/metrics.k8s.io/v1beta1/pods": `{"items": [
+			{"metadata": {"name": "web", "namespace": "apps"}, "containers": [{"usage": {"cpu": "10m", "memory": "1Mi"}},
+				{"usage": {"cpu": "5m", "memory": "1Mi"}}]},
+			{"metadata": {"name": "dns", "namespace": "kube-system"}, "containers": [{"usage": {"cpu": "1m", "memory": "1Mi"}}]}
+		]}`,
+	})
+	defer metricsServer.Close()
+	kubelets := newFakeAPIServer(t, map[string]string{
+		"/api/v1/nodes/node-1/proxy/stats/summary": `{
+			"node": {"cpu": {"usageNanoCores": 250000000}, "memory": {"workingSetBytes": 1073741824}},
+			"pods": [{"podRef": {"name": "web", "namespace": "apps"},
+				"cpu": {"usageNanoCores": 20000000}, "memory": {"workingSetBytes": 2097152}}]
+		}`,
+	})
+	defer kubelets.Close()
+	noMetrics := newFakeAPIServer(t, map[string]string{})
+	defer noMetrics.Close()
+
+	for _, tc := range []struct {
+		name    string
+		kubeID  string
+		metrics *fakeAPIServer
+
+		expectedErr    error
+		expectedSource string
+		expectedCPU    ResourceUtilization
+		expectedNodes  []string
+		expectedPods   []PodMetrics
+	}{
+		{
+			name:        "kube not found",
+			kubeID:      "lost",
+			metrics:     metricsServer,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:           "metrics server",
+			kubeID:         "kube",
+			metrics:        metricsServer,
+			expectedSource: MetricsSourceMetricsServer,
+			expectedCPU:    ResourceUtilization{Allocatable: 4000, Used: 1500, Utilization: 37.5},
+			expectedNodes:  []string{"node-1", "node-2"},
+			expectedPods: []PodMetrics{
+				{Name: "web", Namespace: "apps", Node: "node-1", CPU: 15, Memory: 2 << 20},
+				{Name: "dns", Namespace: "kube-system", Node: "node-2", CPU: 1, Memory: 1 << 20},
+			},
+		},
+		{
+			name:           "kubelet summary",
+			kubeID:         "kube",
+			metrics:        kubelets,
+			expectedSource: MetricsSourceKubelet,
+			expectedCPU:    ResourceUtilization{Allocatable: 2000, Used: 250, Utilization: 12.5},
+			expectedNodes:  []string{"node-1"},
+			expectedPods: []PodMetrics{
+				{Name: "web", Namespace: "apps", Node: "node-1", CPU: 20, Memory: 2 << 20},
+			},
+		},
+		{
+			name:        "no metrics",
+			kubeID:      "kube",
+			metrics:     noMetrics,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+	} {
+		svc := Service{
+			storage: kubeStorage(&model.Kube{ID: "kube"}),
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				cl := &fakev1client.FakeCoreV1{
+					Fake: &kubetesting.Fake{},
+				}
+				cl.AddReactor("list", "nodes",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						return true, &corev1.NodeList{
+							Items: []corev1.Node{
+								capacityNode("node-1", "2", "4Gi"),
+								capacityNode("node-2", "2", "4Gi"),
+							},
+						}, nil
+					})
+				cl.AddReactor("list", "pods",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						web := capacityPod("node-1", corev1.PodRunning, "100m", "64Mi")
+						web.Name, web.Namespace = "web", "apps"
+						dns := capacityPod("node-2", corev1.PodRunning, "100m", "64Mi")
+						dns.Name, dns.Namespace = "dns", "kube-system"
+						return true, &corev1.PodList{Items: []corev1.Pod{web, dns}}, nil
+					})
+				return cl, nil
+			},
+			clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": tc.metrics}),
+		}
+
+		usage, err := svc.Metrics(context.Background(), tc.kubeID)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		nodes := make([]string, 0, len(usage.Nodes))
+		for _, n := range usage.Nodes {
+			nodes = append(nodes, n.Name)
+			require.Equal(t, "node", n.Pool, "TC: %s", tc.name)
+		}
+		require.Equal(t, "kube", usage.KubeID, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedSource, usage.Source, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedCPU, usage.CPU, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedNodes, nodes, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedPods, usage.Pods, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "ok",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("Metrics", mock.Anything, "kube").
+			Return(&ClusterUsage{KubeID: "kube", Source: MetricsSourceKubelet}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/usage", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		usage := &ClusterUsage{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(usage))
+		require.Equal(t, MetricsSourceKubelet, usage.Source)
+	}
+}
@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/migration"
+	"github.com/supergiant/control/pkg/model"
+)
+
+// Migrator upgrades stored kubes to the latest schema version.
+var Migrator = migration.New("id",
+	migration.Migration{
+		From:        0,
+		Description: "move deprecated ssh settings to sshConfig",
+		Apply:       moveSSHSettings,
+	},
+	migration.Migration{
+		From:        1,
+		Description: "build cloud resources from the cloud spec and machines",
+		Apply:       buildCloudResources,
+	},
+)
+
+// deprecatedSSHFields maps deprecated kube fields to sshConfig ones,
+// byte slices of deprecated fields are encoded as base64 strings.
+var deprecatedSSHFields = []struct {
+	from    string
+	to      string
+	encoded bool
+}{
+	{from: "sshUser", to: "user"},
+	{from: "sshKey", to: "publicKey", encoded: true},
+	{from: "bootstrapPublicKey", to: "bootstrapPublicKey", encoded: true},
+	{from: "bootstrapPrivateKey", to: "bootstrapPrivateKey", encoded: true},
+}
+
+func moveSSHSettings(r migration.Record) error {
+	sshConfig, ok := r["sshConfig"].(map[string]interface{})
+	if !ok {
+		sshConfig = make(map[string]interface{})
+	}
+
+	for _, f := range deprecatedSSHFields {
+		value, _ := r[f.from].(string)
+		delete(r, f.from)
+
+		if value == "" {
+			continue
+		}
+		if current, _ := sshConfig[f.to].(string); current != "" {
+			continue
+		}
+
+		if f.encoded {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return errors.Wrapf(err, "decode %s", f.from)
+			}
+			value = string(decoded)
+		}
+		sshConfig[f.to] = value
+	}
+
+	r["sshConfig"] = sshConfig
+	return nil
+}
+
+func buildCloudResources(r migration.Record) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	k := &model.Kube{}
+	if err = json.Unmarshal(raw, k); err != nil {
+		return errors.Wrap(err, "unmarshal kube")
+	}
+	k.UpdateCloudResources()
+
+	if raw, err = json.Marshal(k.CloudResources); err != nil {
+		return err
+	}
+	resources := make(map[string]interface{})
+	if err = json.Unmarshal(raw, &resources); err != nil {
+		return err
+	}
+
+	r["cloudResources"] = resources
+	return nil
+}
@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+)
+
+func TestMigrator_moveSSHSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		raw         string
+		expectedErr bool
+		expected    model.SSHConfig
+	}{
+		{
+			name:        "invalid encoding",
+			raw:         `{"id":"1","sshKey":"not base64!"}`,
+			expectedErr: true,
+		},
+		{
+			name: "deprecated fields",
+			// "ssh-rsa key", "public", "private"
+			raw: `{"id":"1","sshUser":"root","sshKey":"c3NoLXJzYSBrZXk=",
+				"bootstrapPublicKey":"cHVibGlj","bootstrapPrivateKey":"cHJpdmF0ZQ=="}`,
+			expected: model.SSHConfig{
+				User:                "root",
+				PublicKey:           "ssh-rsa key",
+				BootstrapPublicKey:  "public",
+				BootstrapPrivateKey: "private",
+			},
+		},
+		{
+			name: "sshConfig is preferred",
+			raw:  `{"id":"1","sshUser":"root","sshConfig":{"user":"ubuntu","port":"22"}}`,
+			expected: model.SSHConfig{
+				User: "ubuntu",
+				Port: "22",
+			},
+		},
+	} {
+		raw, _, err := Migrator.Upgrade([]byte(tc.raw))
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		if err != nil {
+			continue
+		}
+
+		k := &model.Kube{}
+		require.NoError(t, json.Unmarshal(raw, k), "TC: %s", tc.name)
+		require.Equal(t, Migrator.Version(), k.SchemaVersion, "TC: %s", tc.name)
+		require.Equal(t, tc.expected, k.SSHConfig, "TC: %s", tc.name)
+		require.Empty(t, k.SshUser, "TC: %s", tc.name)
+		require.Empty(t, k.BootstrapPrivateKey, "TC: %s", tc.name)
+	}
+}
+
+func TestMigrator_buildCloudResources(t *testing.T) {
+	raw, _, err := Migrator.Upgrade([]byte(`{"id":"1","schemaVersion":1,"provider":"aws",
+		"cloudSpec":{"aws_vpc_id":"vpc-1"},"subnets":{"us-east-1a":"subnet-1"},
+		"masters":{"master-1":{"id":"i-1"}}}`))
+	require.NoError(t, err)
+
+	k := &model.Kube{}
+	require.NoError(t, json.Unmarshal(raw, k))
+	require.Equal(t, Migrator.Version(), k.SchemaVersion)
+	require.Equal(t, model.CloudResources{
+		VPCID:     "vpc-1",
+		SubnetIDs: []string{"subnet-1"},
+		Instances: map[string]string{"master-1": "i-1"},
+	}, k.CloudResources)
+}
@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// NodeAdder scales running clusters with additional worker nodes.
+type NodeAdder struct {
+	svc            Interface
+	accountService accountGetter
+	provisioner    nodeProvisioner
+}
+
+// NewNodeAdder constructs a NodeAdder, nodes are provisioned by the provisioner.
+func NewNodeAdder(svc Interface, accountService accountGetter, provisioner nodeProvisioner) *NodeAdder {
+	return &NodeAdder{
+		svc:            svc,
+		accountService: accountService,
+		provisioner:    provisioner,
+	}
+}
+
+// AddNodes starts a node workflow for each of the profiles, the workflows
+// create instances and join them to the cluster. Machines are saved to the
+// kube as soon as their instances are created, the tasks are recorded
+// within the kube before they are returned.
+func (a *NodeAdder) AddNodes(ctx context.Context, kubeID string, profiles []profile.NodeProfile) ([]*workflows.Task, error) {
+	if len(profiles) == 0 {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, "no node profiles")
+	}
+
+	k, err := a.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+	if len(k.Masters) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "master node of kube %s", kubeID)
+	}
+
+	acc, err := a.accountService.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+
+	config, err := steps.NewConfig(k.Name, k.AccountName, nodeKubeProfile(k, acc))
+	if err != nil {
+		return nil, errors.Wrap(err, "new config")
+	}
+
+	config.ClusterID = k.ID
+	config.CertificatesConfig.CAKey = k.Auth.CAKey
+	config.CertificatesConfig.CACert = k.Auth.CACert
+	config.CertificatesConfig.AdminCert = k.Auth.AdminCert
+	config.CertificatesConfig.AdminKey = k.Auth.AdminKey
+	config.AddMaster(util.GetRandomNode(k.Masters))
+
+	// Get cloud account fill appropriate config structure
+	// with cloud account credentials
+	if err = util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+		return nil, errors.Wrap(err, "fill cloud account credentials")
+	}
+
+	tasks, err := a.provisioner.ProvisionNodes(ctx, profiles, k, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "provision nodes")
+	}
+
+	taskIDs := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		taskIDs = append(taskIDs, t.ID)
+	}
+
+	_, err = a.svc.Update(ctx, kubeID, func(k *model.Kube) error {
+		if k.Tasks == nil {
+			k.Tasks = make(map[string][]string)
+		}
+		k.Tasks[workflows.NodeTask] = append(k.Tasks[workflows.NodeTask], taskIDs...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "update kube %s", kubeID)
+	}
+
+	return tasks, nil
+}
+
+// nodeKubeProfile is the profile the kube has been provisioned with, it is
+// used to configure nodes the same way as the existing ones.
+func nodeKubeProfile(k *model.Kube, acc *model.CloudAccount) profile.Profile {
+	return profile.Profile{
+		Provider:        acc.Provider,
+		Region:          k.Region,
+		Zone:            k.Zone,
+		Arch:            k.Arch,
+		OperatingSystem: k.OperatingSystem,
+		UbuntuVersion:   k.OperatingSystemVersion,
+		DockerVersion:   k.DockerVersion,
+		K8SVersion:      k.K8SVersion,
+		K8SServicesCIDR: k.ServicesCIDR,
+		HelmVersion:     k.HelmVersion,
+		User:            k.User,
+		Password:        k.Password,
+
+		NetworkType:           k.Networking.Type,
+		CIDR:                  k.Networking.CIDR,
+		FlannelVersion:        k.Networking.Version,
+		CloudSpecificSettings: k.CloudSpec,
+
+		NodesProfiles: []profile.NodeProfile{
+			{},
+		},
+
+		RBACEnabled: k.RBACEnabled,
+	}
+}
@@ -0,0 +1,112 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestNodeAdder_AddNodes(t *testing.T) {
+	nodeProfiles := []profile.NodeProfile{
+		{"size": "s-2vcpu-4gb", "image": "ubuntu-18-04-x64"},
+		{"size": "s-4vcpu-8gb", "image": "ubuntu-18-04-x64"},
+	}
+
+	for _, tc := range []struct {
+		name         string
+		profiles     []profile.NodeProfile
+		masters      map[string]*model.Machine
+		accountErr   error
+		provisionErr error
+
+		expectedErr   error
+		expectedTasks []string
+	}{
+		{
+			name:          "no profiles",
+			masters:       map[string]*model.Machine{"master": {Name: "master"}},
+			expectedErr:   sgerrors.ErrInvalidJson,
+			expectedTasks: []string{"master"},
+		},
+		{
+			name:          "no masters",
+			profiles:      nodeProfiles,
+			expectedErr:   sgerrors.ErrNotFound,
+			expectedTasks: []string{"master"},
+		},
+		{
+			name:          "account not found",
+			profiles:      nodeProfiles,
+			masters:       map[string]*model.Machine{"master": {Name: "master"}},
+			accountErr:    sgerrors.ErrNotFound,
+			expectedErr:   sgerrors.ErrNotFound,
+			expectedTasks: []string{"master"},
+		},
+		{
+			name:          "provision error",
+			profiles:      nodeProfiles,
+			masters:       map[string]*model.Machine{"master": {Name: "master"}},
+			provisionErr:  errFake,
+			expectedErr:   errFake,
+			expectedTasks: []string{"master"},
+		},
+		{
+			name:          "success",
+			profiles:      nodeProfiles,
+			masters:       map[string]*model.Machine{"master": {Name: "master"}},
+			expectedTasks: []string{"master", "node-1", "node-2"},
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), &model.Kube{
+			ID:          "kube",
+			Name:        "prod",
+			AccountName: "do",
+			Region:      "fra1",
+			Masters:     tc.masters,
+			Tasks:       map[string][]string{workflows.NodeTask: {"master"}},
+		}), "TC: %s", tc.name)
+
+		accService := new(accServiceMock)
+		accService.On(serviceGet, mock.Anything, "do").Return(&model.CloudAccount{
+			Name:        "do",
+			Provider:    clouds.DigitalOcean,
+			Credentials: map[string]string{"accessToken": "token"},
+		}, tc.accountErr)
+
+		var config *steps.Config
+		provisioner := new(mockNodeProvisioner)
+		provisioner.On("ProvisionNodes", mock.Anything, tc.profiles, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				config = args.Get(3).(*steps.Config)
+			}).
+			Return([]*workflows.Task{{ID: "node-1"}, {ID: "node-2"}}, tc.provisionErr)
+
+		a := NewNodeAdder(svc, accService, provisioner)
+		tasks, err := a.AddNodes(context.Background(), "kube", tc.profiles)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+
+		k, err := svc.Get(context.Background(), "kube")
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedTasks, k.Tasks[workflows.NodeTask], "TC: %s", tc.name)
+
+		if tc.expectedErr == nil {
+			require.Len(t, tasks, 2, "TC: %s", tc.name)
+			require.Equal(t, "kube", config.ClusterID, "TC: %s", tc.name)
+			require.Equal(t, "fra1", config.DigitalOceanConfig.Region, "TC: %s", tc.name)
+			require.Equal(t, "token", config.DigitalOceanConfig.AccessToken, "TC: %s", tc.name)
+			require.Contains(t, config.GetMasters(), "master", "TC: %s", tc.name)
+		}
+	}
+}
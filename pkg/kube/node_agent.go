@@ -0,0 +1,300 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/runner"
+)
+
+// Ways nodes of a cluster are reached:
+const (
+	NodeAccessSSH   = "ssh"
+	NodeAccessAgent = "agent"
+)
+
+const (
+	nodeAgentNamespace    = "kube-system"
+	nodeAgentImage        = "busybox:1.30"
+	nodeAgentLabel        = "supergiant.io/node-agent"
+	nodeAgentExitMarker   = "SG_AGENT_EXIT="
+	nodeAgentPollInterval = 2 * time.Second
+)
+
+// nodeAccess tells how the nodes are reached: over ssh when the cluster key
+// and addresses of all of them are known, through the node agent otherwise.
+// The latter is the case of imported clusters.
+func nodeAccess(k *model.Kube, nodes []string) string {
+	for _, name := range nodes {
+		if _, err := nodeSSHConfig(k, name); err != nil {
+			return NodeAccessAgent
+		}
+	}
+	return NodeAccessSSH
+}
+
+// nodeScriptRunner runs a script on nodes of a cluster as root, results
+// follow the order of the nodes.
+type nodeScriptRunner interface {
+	RunScript(ctx context.Context, k *model.Kube, nodes []string, script string, timeout time.Duration, limit int) []NodeExecResult
+}
+
+// nodeAgent runs scripts through a privileged daemonset that lives as long
+// as the script does. Pods of the daemonset enter the root of their hosts,
+// run the script there and print its exit code to their logs, so stderr is
+// reported within stdout.
+type nodeAgent struct {
+	clientForGroupFn func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error)
+
+	image        string
+	pollInterval time.Duration
+}
+
+func newNodeAgent() *nodeAgent {
+	return &nodeAgent{
+		clientForGroupFn: restClientForGroupVersion,
+		image:            nodeAgentImage,
+		pollInterval:     nodeAgentPollInterval,
+	}
+}
+
+// RunScript creates the daemonset for the nodes, waits for the exit codes of
+// all of them and removes it.
+func (a *nodeAgent) RunScript(ctx context.Context, k *model.Kube, nodes []string, script string, timeout time.Duration, limit int) []NodeExecResult {
+	results := make([]NodeExecResult, len(nodes))
+	index := make(map[string]int, len(nodes))
+	for i, name := range nodes {
+		results[i] = NodeExecResult{Node: name, ExitCode: -1}
+		index[name] = i
+	}
+	fail := func(err error) []NodeExecResult {
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	apps, err := a.clientForGroupFn(k, appsv1.SchemeGroupVersion)
+	if err != nil {
+		return fail(errors.Wrap(err, "get apps client"))
+	}
+	core, err := a.clientForGroupFn(k, corev1.SchemeGroupVersion)
+	if err != nil {
+		return fail(errors.Wrap(err, "get core client"))
+	}
+
+	ds := agentDaemonSet("sg-agent-"+uuid.New()[:8], a.image, nodes, script)
+	err = apps.Post().
+		Namespace(nodeAgentNamespace).
+		Resource("daemonsets").
+		Body(ds).
+		Context(ctx).
+		Do().
+		Error()
+	if err != nil {
+		return fail(errors.Wrapf(err, "create daemonset %s", ds.Name))
+	}
+	defer a.cleanup(apps, k, ds.Name)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(a.pollInterval)
+	defer ticker.Stop()
+
+	done := 0
+	for {
+		pods := &corev1.PodList{}
+		err = core.Get().
+			Namespace(nodeAgentNamespace).
+			Resource("pods").
+			Param("labelSelector", nodeAgentLabel+"="+ds.Name).
+			Context(ctx).
+			Do().
+			Into(pods)
+		if err == nil {
+			for _, pod := range pods.Items {
+				i, ok := index[pod.Spec.NodeName]
+				if !ok || results[i].ExitCode != -1 {
+					continue
+				}
+				if reason := agentPodFailure(pod); reason != "" {
+					results[i].Error = reason
+					continue
+				}
+				if pod.Status.Phase != corev1.PodRunning {
+					continue
+				}
+
+				logs, err := core.Get().
+					Namespace(nodeAgentNamespace).
+					Resource("pods").
+					Name(pod.Name).
+					SubResource("log").
+					Context(ctx).
+					DoRaw()
+				if err != nil {
+					continue
+				}
+				if out, code, ok := agentExitCode(string(logs)); ok {
+					results[i].ExitCode, results[i].Error = code, ""
+					if len(out) > limit {
+						out, results[i].Truncated = out[:limit], true
+					}
+					results[i].Stdout = out
+					done++
+				}
+			}
+		}
+		if done == len(nodes) {
+			return results
+		}
+
+		select {
+		case <-ctx.Done():
+			for i := range results {
+				if results[i].ExitCode == -1 && results[i].Error == "" {
+					results[i].Error = fmt.Sprintf("timed out after %s", timeout)
+				}
+			}
+			return results
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanup removes the daemonset with its pods, it's done even when the
+// script has been cancelled.
+func (a *nodeAgent) cleanup(apps rest.Interface, k *model.Kube, name string) {
+	propagation := metav1.DeletePropagationBackground
+	err := apps.Delete().
+		Namespace(nodeAgentNamespace).
+		Resource("daemonsets").
+		Name(name).
+		Body(&metav1.DeleteOptions{PropagationPolicy: &propagation}).
+		Do().
+		Error()
+	if err != nil {
+		logrus.Warnf("kube %s: remove node agent %s: %v", k.ID, name, err)
+	}
+}
+
+// agentDaemonSet schedules a privileged pod on each of the nodes, taints
+// of the nodes are tolerated. The script is passed in the environment to
+// keep it out of quoting.
+func agentDaemonSet(name, image string, nodes []string, script string) *appsv1.DaemonSet {
+	labels := map[string]string{nodeAgentLabel: name}
+	privileged := true
+	gracePeriod := int64(0)
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: nodeAgentNamespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					HostPID:                       true,
+					HostNetwork:                   true,
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Affinity: &corev1.Affinity{
+						NodeAffinity: &corev1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+								NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+									MatchFields: []corev1.NodeSelectorRequirement{{
+										Key:      "metadata.name",
+										Operator: corev1.NodeSelectorOpIn,
+										Values:   nodes,
+									}},
+								}},
+							},
+						},
+					},
+					Containers: []corev1.Container{{
+						Name:  "agent",
+						Image: image,
+						Command: []string{"sh", "-c",
+							`chroot /host sh -c "$SG_SCRIPT" 2>&1; echo "` + nodeAgentExitMarker + `$?"; exec sleep 86400`},
+						Env:             []corev1.EnvVar{{Name: "SG_SCRIPT", Value: script}},
+						SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+						VolumeMounts:    []corev1.VolumeMount{{Name: "host", MountPath: "/host"}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "host",
+						VolumeSource: corev1.VolumeSource{
+							HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// agentExitCode splits the log of an agent pod to the output of the script
+// and its exit code, ok is false until the script has exited.
+func agentExitCode(logs string) (string, int, bool) {
+	i := strings.LastIndex(logs, nodeAgentExitMarker)
+	if i < 0 || (i > 0 && logs[i-1] != '\n') {
+		return "", 0, false
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(logs[i+len(nodeAgentExitMarker):]))
+	if err != nil {
+		return "", 0, false
+	}
+	return logs[:i], code, true
+}
+
+// agentPodFailure returns why the agent container can't start, the pod
+// is still waited for as the reason may go away.
+func agentPodFailure(pod corev1.Pod) string {
+	for _, s := range pod.Status.ContainerStatuses {
+		if w := s.State.Waiting; w != nil {
+			switch w.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "CrashLoopBackOff", "CreateContainerConfigError":
+				return strings.TrimSpace(w.Reason + ": " + w.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// agentNodeRunner runs commands on a single node through the agent, it lets
+// workflow steps reach nodes without ssh.
+type agentNodeRunner struct {
+	agent nodeScriptRunner
+	kube  *model.Kube
+	node  string
+}
+
+func (r *agentNodeRunner) Run(cmd *runner.Command) error {
+	result := r.agent.RunScript(cmd.Ctx, r.kube, []string{r.node}, cmd.Script, defaultNodeExecTimeout, maxNodeFileSize)[0]
+	if _, err := cmd.Out.Write([]byte(result.Stdout)); err != nil {
+		return errors.Wrap(err, "write output")
+	}
+	if result.Error != "" {
+		return errors.Errorf("node %s: %s", r.node, result.Error)
+	}
+	if result.ExitCode != 0 {
+		return errors.Errorf("node %s: exit status %d", r.node, result.ExitCode)
+	}
+	return nil
+}
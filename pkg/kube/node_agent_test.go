@@ -0,0 +1,211 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/runner"
+)
+
+// fakeAgent answers scripts with results of fn and remembers them.
+type fakeAgent struct {
+	m       sync.Mutex
+	scripts []string
+	fn      func(node, script string) NodeExecResult
+}
+
+func (a *fakeAgent) RunScript(ctx context.Context, k *model.Kube, nodes []string, script string,
+	timeout time.Duration, limit int) []NodeExecResult {
+	a.m.Lock()
+	a.scripts = append(a.scripts, script)
+	a.m.Unlock()
+
+	results := make([]NodeExecResult, 0, len(nodes))
+	for _, n := range nodes {
+		results = append(results, a.fn(n, script))
+	}
+	return results
+}
+
+func TestNodeAccess(t *testing.T) {
+	k := execKube()
+	require.Equal(t, NodeAccessSSH, nodeAccess(k, []string{"master", "node-1"}))
+
+	k.Nodes["node-1"].PublicIp = ""
+	require.Equal(t, NodeAccessAgent, nodeAccess(k, []string{"master", "node-1"}))
+	require.Equal(t, NodeAccessSSH, nodeAccess(k, []string{"master"}))
+
+	k.SSHConfig.BootstrapPrivateKey = ""
+	require.Equal(t, NodeAccessAgent, nodeAccess(k, []string{"master"}))
+}
+
+func TestAgentExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		logs string
+
+		expectedOut  string
+		expectedCode int
+		expectedOk   bool
+	}{
+		{logs: ""},
+		{logs: "running"},
+		{logs: "echo " + nodeAgentExitMarker + "0"},
+		{logs: nodeAgentExitMarker + "x"},
+		{
+			logs:       nodeAgentExitMarker + "0\n",
+			expectedOk: true,
+		},
+		{
+			logs:         "a\nb\n" + nodeAgentExitMarker + "2\n",
+			expectedOut:  "a\nb\n",
+			expectedCode: 2,
+			expectedOk:   true,
+		},
+	} {
+		out, code, ok := agentExitCode(tc.logs)
+		require.Equal(t, tc.expectedOk, ok, tc.logs)
+		require.Equal(t, tc.expectedOut, out, tc.logs)
+		require.Equal(t, tc.expectedCode, code, tc.logs)
+	}
+}
+
+func TestAgentDaemonSet(t *testing.T) {
+	ds := agentDaemonSet("sg-agent-1", nodeAgentImage, []string{"node-1", "node-2"}, "uptime")
+
+	pod := ds.Spec.Template.Spec
+	require.Equal(t, ds.Spec.Selector.MatchLabels, ds.Spec.Template.Labels)
+	require.True(t, pod.HostPID)
+	require.True(t, *pod.Containers[0].SecurityContext.Privileged)
+	require.Equal(t, "uptime", pod.Containers[0].Env[0].Value)
+	require.Equal(t, "/", pod.Volumes[0].HostPath.Path)
+	require.Equal(t, []string{"node-1", "node-2"},
+		pod.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields[0].Values)
+}
+
+func TestNodeAgent_RunScript(t *testing.T) {
+	server := newFakeAPIServer(t, map[string]string{
+		"/api/v1/namespaces/kube-system/pods": `{"items": [
+			{"metadata": {"name": "agent-1"}, "spec": {"nodeName": "node-1"}, "status": {"phase": "Running"}},
+			{"metadata": {"name": "agent-2"}, "spec": {"nodeName": "node-2"}, "status": {"phase": "Pending",
+				"containerStatuses": [{"state": {"waiting": {"reason": "ImagePullBackOff", "message": "no busybox"}}}]}},
+			{"metadata": {"name": "other"}, "spec": {"nodeName": "node-9"}, "status": {"phase": "Running"}}
+		]}`,
+		"/api/v1/namespaces/kube-system/pods/agent-1/log": "load average: 0.1\n" + nodeAgentExitMarker + "3\n",
+	})
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name     string
+		nodes    []string
+		limit    int
+		clientFn func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error)
+
+		expectedResults []NodeExecResult
+	}{
+		{
+			name:  "client error",
+			nodes: []string{"node-1"},
+			clientFn: func(*model.Kube, schema.GroupVersion) (rest.Interface, error) {
+				return nil, errFake
+			},
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", ExitCode: -1, Error: "get apps client: " + errFake.Error()},
+			},
+		},
+		{
+			name:  "exited",
+			nodes: []string{"node-1"},
+			limit: maxNodeExecOutput,
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", ExitCode: 3, Stdout: "load average: 0.1\n"},
+			},
+		},
+		{
+			name:  "truncated",
+			nodes: []string{"node-1"},
+			limit: 4,
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", ExitCode: 3, Stdout: "load", Truncated: true},
+			},
+		},
+		{
+			name:  "not started",
+			nodes: []string{"node-1", "node-2", "node-3"},
+			limit: maxNodeExecOutput,
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", ExitCode: 3, Stdout: "load average: 0.1\n"},
+				{Node: "node-2", ExitCode: -1, Error: "ImagePullBackOff: no busybox"},
+				{Node: "node-3", ExitCode: -1, Error: "timed out after 50ms"},
+			},
+		},
+	} {
+		a := newNodeAgent()
+		a.pollInterval = 5 * time.Millisecond
+		a.clientForGroupFn = fakeClusterClients(map[string]*fakeAPIServer{"kube": server})
+		if tc.clientFn != nil {
+			a.clientForGroupFn = tc.clientFn
+		}
+
+		results := a.RunScript(context.Background(), &model.Kube{ID: "kube"}, tc.nodes, "uptime", 50*time.Millisecond, tc.limit)
+		require.Equal(t, tc.expectedResults, results, "TC: %s", tc.name)
+	}
+
+	created := 0
+	for path := range server.objects {
+		if strings.HasPrefix(path, "/apis/apps/v1/namespaces/kube-system/daemonsets/sg-agent-") {
+			created++
+		}
+	}
+	require.Equal(t, 3, created)
+}
+
+func TestAgentNodeRunner_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		result NodeExecResult
+
+		expectedErr string
+	}{
+		{
+			name:   "ok",
+			result: NodeExecResult{Stdout: "done"},
+		},
+		{
+			name:        "exit code",
+			result:      NodeExecResult{ExitCode: 1, Stdout: "done"},
+			expectedErr: "exit status 1",
+		},
+		{
+			name:        "error",
+			result:      NodeExecResult{ExitCode: -1, Stdout: "done", Error: "timed out"},
+			expectedErr: "timed out",
+		},
+	} {
+		agent := &fakeAgent{fn: func(node, script string) NodeExecResult {
+			r := tc.result
+			r.Node = node
+			return r
+		}}
+		r := &agentNodeRunner{agent: agent, kube: execKube(), node: "node-1"}
+
+		out := &bytes.Buffer{}
+		err := r.Run(&runner.Command{Ctx: context.Background(), Script: "install", Out: out})
+		if tc.expectedErr == "" {
+			require.NoError(t, err, "TC: %s", tc.name)
+		} else {
+			require.Contains(t, errors.Cause(err).Error(), tc.expectedErr, "TC: %s", tc.name)
+		}
+		require.Equal(t, "done", out.String(), "TC: %s", tc.name)
+		require.Equal(t, []string{"install"}, agent.scripts, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,183 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	kubeBenchImage   = "aquasec/kube-bench:0.0.34"
+	kubeBenchTimeout = 10 * time.Minute
+	maxKubeBenchSize = 4 << 20
+
+	benchStatusFail = "FAIL"
+)
+
+// kubeBenchScript runs kube-bench installed on the node or its image,
+// the target is either master or node.
+const kubeBenchScript = `if command -v kube-bench >/dev/null 2>&1; then
+  sudo kube-bench %[1]s --json
+else
+  sudo docker run --rm --pid=host -v /etc:/etc:ro -v /var:/var:ro %[2]s %[1]s --json
+fi`
+
+// BenchCheck is a failed check of the CIS benchmark.
+type BenchCheck struct {
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// NodeBench sums up results of kube-bench on a node.
+type NodeBench struct {
+	Node   string       `json:"node"`
+	Role   model.Role   `json:"role"`
+	Pass   int          `json:"pass"`
+	Fail   int          `json:"fail"`
+	Warn   int          `json:"warn"`
+	Info   int          `json:"info"`
+	Failed []BenchCheck `json:"failed"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// BenchReport is an outcome of the CIS kubernetes benchmark on active
+// machines of a cluster, masters and nodes are checked against their parts.
+type BenchReport struct {
+	KubeID    string      `json:"kubeId"`
+	Access    string      `json:"access"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Nodes     []NodeBench `json:"nodes"`
+	Fail      int         `json:"fail"`
+}
+
+// kubeBenchControls is a part of the json output of kube-bench.
+type kubeBenchControls struct {
+	Groups []struct {
+		Checks []struct {
+			ID          string `json:"test_number"`
+			Text        string `json:"test_desc"`
+			Remediation string `json:"remediation"`
+			Status      string `json:"status"`
+		} `json:"results"`
+	} `json:"tests"`
+	Pass int `json:"total_pass"`
+	Fail int `json:"total_fail"`
+	Warn int `json:"total_warn"`
+	Info int `json:"total_info"`
+}
+
+// Bench runs kube-bench on all active machines of the cluster and blocks
+// until it has finished.
+func (e *NodeExecutor) Bench(ctx context.Context, kubeID string) (*BenchReport, error) {
+	k, err := e.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	report := &BenchReport{
+		KubeID:    k.ID,
+		CreatedAt: e.now(),
+		Nodes:     make([]NodeBench, 0),
+	}
+
+	for _, role := range []model.Role{model.RoleMaster, model.RoleNode} {
+		nodes, err := selectExecNodes(k, NodeExecRequest{Role: role})
+		if errors.Cause(err) == sgerrors.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		script := fmt.Sprintf(kubeBenchScript, role, kubeBenchImage)
+		access, results := e.runScript(ctx, k, nodes, script, kubeBenchTimeout,
+			defaultNodeExecConcurrency, maxKubeBenchSize)
+		// the agent is reported when any of the roles has needed it
+		if report.Access != NodeAccessAgent {
+			report.Access = access
+		}
+		for _, r := range results {
+			bench := parseKubeBench(r)
+			bench.Role = role
+			report.Fail += bench.Fail
+			report.Nodes = append(report.Nodes, bench)
+		}
+	}
+	if len(report.Nodes) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "active nodes of kube %s", k.ID)
+	}
+
+	return report, nil
+}
+
+// parseKubeBench sums up controls kube-bench has printed for the node, they
+// are printed one per line. Other lines are skipped as the agent reports
+// stderr within stdout.
+func parseKubeBench(r NodeExecResult) NodeBench {
+	bench := NodeBench{Node: r.Node, Failed: make([]BenchCheck, 0), Error: r.Error}
+	if bench.Error != "" {
+		return bench
+	}
+	if r.ExitCode != 0 || r.Truncated {
+		bench.Error = fmt.Sprintf("kube-bench exit status %d: %s", r.ExitCode, strings.TrimSpace(r.Stdout+"\n"+r.Stderr))
+		return bench
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(r.Stdout))
+	scanner.Buffer(nil, maxKubeBenchSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		controls := kubeBenchControls{}
+		if err := json.Unmarshal([]byte(line), &controls); err != nil {
+			bench.Error = fmt.Sprintf("read kube-bench output: %v", err)
+			return bench
+		}
+
+		bench.Pass += controls.Pass
+		bench.Fail += controls.Fail
+		bench.Warn += controls.Warn
+		bench.Info += controls.Info
+		for _, g := range controls.Groups {
+			for _, c := range g.Checks {
+				if c.Status == benchStatusFail {
+					bench.Failed = append(bench.Failed, BenchCheck{ID: c.ID, Text: c.Text, Remediation: c.Remediation})
+				}
+			}
+		}
+	}
+
+	return bench
+}
+
+// bench runs the CIS kubernetes benchmark on machines of the cluster:
+// POST /kubes/{kubeID}/bench
+func (e *NodeExecutor) bench(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	report, err := e.Bench(r.Context(), kubeID)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+const kubeBenchOutput = `{"id":"2","text":"Worker Node Security Configuration","node_type":"node","tests":[` +
+	`{"section":"2.1","results":[{"test_number":"2.1.1","test_desc":"Ensure that the --anonymous-auth argument is set to false",` +
+	`"remediation":"Edit the kubelet service file","status":"FAIL"},{"test_number":"2.1.2","status":"PASS"}]}],` +
+	`"total_pass":1,"total_fail":1,"total_warn":2,"total_info":0}`
+
+func TestParseKubeBench(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		result NodeExecResult
+
+		expected NodeBench
+	}{
+		{
+			name:     "not run",
+			result:   NodeExecResult{Node: "node-1", ExitCode: -1, Error: "timed out after 10m0s"},
+			expected: NodeBench{Node: "node-1", Failed: []BenchCheck{}, Error: "timed out after 10m0s"},
+		},
+		{
+			name:     "failed",
+			result:   NodeExecResult{Node: "node-1", ExitCode: 127, Stderr: "docker: command not found"},
+			expected: NodeBench{Node: "node-1", Failed: []BenchCheck{}, Error: "kube-bench exit status 127: docker: command not found"},
+		},
+		{
+			name:     "invalid output",
+			result:   NodeExecResult{Node: "node-1", Stdout: "{\n"},
+			expected: NodeBench{Node: "node-1", Failed: []BenchCheck{}, Error: "read kube-bench output: unexpected end of JSON input"},
+		},
+		{
+			name:   "ok",
+			result: NodeExecResult{Node: "node-1", Stdout: "Unable to find image locally\n" + kubeBenchOutput + "\n" + kubeBenchOutput + "\n"},
+			expected: NodeBench{
+				Node: "node-1",
+				Pass: 2,
+				Fail: 2,
+				Warn: 4,
+				Failed: []BenchCheck{
+					{ID: "2.1.1", Text: "Ensure that the --anonymous-auth argument is set to false", Remediation: "Edit the kubelet service file"},
+					{ID: "2.1.1", Text: "Ensure that the --anonymous-auth argument is set to false", Remediation: "Edit the kubelet service file"},
+				},
+			},
+		},
+	} {
+		require.Equal(t, tc.expected, parseKubeBench(tc.result), "TC: %s", tc.name)
+	}
+}
+
+func TestNodeExecutor_Bench(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		kubeID string
+		kube   *model.Kube
+
+		expectedErr    error
+		expectedAccess string
+		expectedNodes  []string
+	}{
+		{
+			name:        "kube not found",
+			kubeID:      "lost",
+			kube:        execKube(),
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no active machines",
+			kubeID:      "kube",
+			kube:        &model.Kube{ID: "kube"},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:           "ok",
+			kubeID:         "kube",
+			kube:           execKube(),
+			expectedAccess: NodeAccessAgent,
+			expectedNodes:  []string{"master", "node-1", "node-2"},
+		},
+	} {
+		tc.kube.SSHConfig.BootstrapPrivateKey = ""
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), tc.kube), "TC: %s", tc.name)
+
+		e := NewNodeExecutor(svc)
+		agent := &fakeAgent{fn: func(node, script string) NodeExecResult {
+			return NodeExecResult{Node: node, Stdout: kubeBenchOutput}
+		}}
+		e.agent = agent
+
+		report, err := e.Bench(context.Background(), tc.kubeID)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		nodes := make([]string, 0)
+		for _, n := range report.Nodes {
+			nodes = append(nodes, n.Node)
+		}
+		require.Equal(t, tc.expectedNodes, nodes, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedAccess, report.Access, "TC: %s", tc.name)
+		require.Equal(t, len(tc.expectedNodes), report.Fail, "TC: %s", tc.name)
+		require.Equal(t, model.RoleMaster, report.Nodes[0].Role, "TC: %s", tc.name)
+
+		require.Len(t, agent.scripts, 2, "TC: %s", tc.name)
+		require.True(t, strings.Contains(agent.scripts[0], "kube-bench master --json"), "TC: %s", tc.name)
+		require.True(t, strings.Contains(agent.scripts[1], kubeBenchImage+" node --json"), "TC: %s", tc.name)
+	}
+}
+
+func TestNodeExecutor_bench(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	e := NewNodeExecutor(svc)
+
+	router := mux.NewRouter()
+	e.Register(router)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/kubes/lost/bench", nil)
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	k := execKube()
+	k.SSHConfig.BootstrapPrivateKey = ""
+	require.NoError(t, svc.Create(context.Background(), k))
+	e.agent = &fakeAgent{fn: func(node, script string) NodeExecResult {
+		return NodeExecResult{Node: node, Stdout: kubeBenchOutput}
+	}}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/kubes/kube/bench", nil)
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	report := BenchReport{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	require.Equal(t, 3, report.Fail)
+}
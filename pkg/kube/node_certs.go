@@ -0,0 +1,162 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+)
+
+const (
+	nodeCertsTimeout = 2 * time.Minute
+	maxNodeCertsSize = 512 << 10
+
+	nodeCertPathPrefix = "==> "
+)
+
+// nodeCertsScript prints certificates of kubernetes components and kubelets,
+// private keys kept in the same files are left out.
+const nodeCertsScript = `sudo find /etc/kubernetes/pki /var/lib/kubelet/pki -type f \( -name '*.crt' -o -name '*.pem' \) 2>/dev/null | sort |
+while read -r f; do
+  echo "` + nodeCertPathPrefix + `$f"
+  sudo sed -n '/-----BEGIN CERTIFICATE-----/,/-----END CERTIFICATE-----/p' "$f"
+done`
+
+// NodeCert is a certificate found on a node.
+type NodeCert struct {
+	Path      string    `json:"path"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotAfter  time.Time `json:"notAfter"`
+	ExpiresIn int       `json:"expiresInDays"`
+}
+
+// NodeCerts are certificates of a node, Error tells why they couldn't be read.
+type NodeCerts struct {
+	Node  string     `json:"node"`
+	Certs []NodeCert `json:"certs"`
+	Error string     `json:"error,omitempty"`
+}
+
+// NodeCertsReport lists certificates kept on active machines of a cluster.
+type NodeCertsReport struct {
+	KubeID    string      `json:"kubeId"`
+	Access    string      `json:"access"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Nodes     []NodeCerts `json:"nodes"`
+	// Expiring is a number of certificates expiring within 30 days.
+	Expiring int `json:"expiring"`
+}
+
+// InspectCerts reads certificates from the disks of all active machines of
+// the cluster, imported clusters are inspected through the node agent.
+func (e *NodeExecutor) InspectCerts(ctx context.Context, kubeID string) (*NodeCertsReport, error) {
+	k, err := e.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	nodes, err := selectExecNodes(k, NodeExecRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &NodeCertsReport{
+		KubeID:    k.ID,
+		CreatedAt: e.now(),
+		Nodes:     make([]NodeCerts, 0, len(nodes)),
+	}
+
+	var results []NodeExecResult
+	report.Access, results = e.runScript(ctx, k, nodes, nodeCertsScript, nodeCertsTimeout,
+		defaultNodeExecConcurrency, maxNodeCertsSize)
+	for _, r := range results {
+		certs := NodeCerts{Node: r.Node, Certs: make([]NodeCert, 0), Error: r.Error}
+		if r.Error == "" && r.ExitCode != 0 {
+			certs.Error = strings.TrimSpace(r.Stdout + "\n" + r.Stderr)
+		}
+		if certs.Error == "" {
+			certs.Certs = parseNodeCerts(r.Stdout, report.CreatedAt)
+		}
+
+		for _, c := range certs.Certs {
+			if c.ExpiresIn < defaultCertWindowDays {
+				report.Expiring++
+			}
+		}
+		report.Nodes = append(report.Nodes, certs)
+	}
+
+	return report, nil
+}
+
+// parseNodeCerts reads output of nodeCertsScript, files are preceded by
+// their paths.
+func parseNodeCerts(out string, now time.Time) []NodeCert {
+	certs := make([]NodeCert, 0)
+
+	var path string
+	data := make(map[string][]byte)
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, nodeCertPathPrefix) {
+			path = strings.TrimPrefix(line, nodeCertPathPrefix)
+			paths = append(paths, path)
+			continue
+		}
+		data[path] = append(data[path], line+"\n"...)
+	}
+
+	for _, path := range paths {
+		rest := data[path]
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+
+			certs = append(certs, NodeCert{
+				Path:      path,
+				Subject:   cert.Subject.CommonName,
+				Issuer:    cert.Issuer.CommonName,
+				NotAfter:  cert.NotAfter,
+				ExpiresIn: int(cert.NotAfter.Sub(now).Hours() / 24),
+			})
+		}
+	}
+
+	return certs
+}
+
+// getNodeCerts lists certificates kept on machines of the cluster:
+// GET /kubes/{kubeID}/certs
+func (e *NodeExecutor) getNodeCerts(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	report, err := e.InspectCerts(r.Context(), kubeID)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
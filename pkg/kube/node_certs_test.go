@@ -0,0 +1,148 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func TestParseNodeCerts(t *testing.T) {
+	ca, err := pki.NewAgentCAPair()
+	require.NoError(t, err)
+	kubelet, err := pki.NewShortLivedPair(certutil.Config{CommonName: "system:node:node-1"}, 48*time.Hour, ca)
+	require.NoError(t, err)
+
+	now := time.Now()
+	certs := parseNodeCerts(
+		nodeCertPathPrefix+"/etc/kubernetes/pki/ca.crt\n"+string(ca.Cert)+
+			nodeCertPathPrefix+"/etc/kubernetes/pki/empty.crt\n"+
+			nodeCertPathPrefix+"/var/lib/kubelet/pki/kubelet-client.pem\n"+string(kubelet.Cert)+string(ca.Cert),
+		now)
+
+	require.Len(t, certs, 3)
+	require.Equal(t, "/etc/kubernetes/pki/ca.crt", certs[0].Path)
+	require.True(t, certs[0].ExpiresIn > defaultCertWindowDays)
+	require.Equal(t, "/var/lib/kubelet/pki/kubelet-client.pem", certs[1].Path)
+	require.Equal(t, "system:node:node-1", certs[1].Subject)
+	require.Equal(t, certs[0].Subject, certs[1].Issuer)
+	require.Equal(t, 1, certs[1].ExpiresIn)
+	require.Equal(t, "/var/lib/kubelet/pki/kubelet-client.pem", certs[2].Path)
+}
+
+func TestNodeExecutor_InspectCerts(t *testing.T) {
+	ca, err := pki.NewAgentCAPair()
+	require.NoError(t, err)
+	kubelet, err := pki.NewShortLivedPair(certutil.Config{CommonName: "kubelet"}, 48*time.Hour, ca)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		kubeID string
+
+		expectedErr      error
+		expectedCerts    map[string]int
+		expectedErrors   map[string]string
+		expectedExpiring int
+	}{
+		{
+			name:        "kube not found",
+			kubeID:      "lost",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:             "ok",
+			kubeID:           "kube",
+			expectedCerts:    map[string]int{"master": 2, "node-1": 2, "node-2": 0},
+			expectedErrors:   map[string]string{"node-2": "sudo: a password is required"},
+			expectedExpiring: 2,
+		},
+	} {
+		k := execKube()
+		k.SSHConfig.BootstrapPrivateKey = ""
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), k), "TC: %s", tc.name)
+
+		e := NewNodeExecutor(svc)
+		e.agent = &fakeAgent{fn: func(node, script string) NodeExecResult {
+			if node == "node-2" {
+				return NodeExecResult{Node: node, ExitCode: 1, Stdout: "sudo: a password is required\n"}
+			}
+			return NodeExecResult{
+				Node:   node,
+				Stdout: nodeCertPathPrefix + "/etc/kubernetes/pki/ca.crt\n" + string(ca.Cert) + string(kubelet.Cert),
+			}
+		}}
+
+		report, err := e.InspectCerts(context.Background(), tc.kubeID)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Equal(t, NodeAccessAgent, report.Access, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedExpiring, report.Expiring, "TC: %s", tc.name)
+		require.Len(t, report.Nodes, len(tc.expectedCerts), "TC: %s", tc.name)
+		for _, n := range report.Nodes {
+			require.Len(t, n.Certs, tc.expectedCerts[n.Node], "TC: %s %s", tc.name, n.Node)
+			require.Equal(t, tc.expectedErrors[n.Node], n.Error, "TC: %s %s", tc.name, n.Node)
+		}
+	}
+}
+
+func TestNodeExecutor_getNodeCerts(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		kubeID       string
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			kubeID:       "lost",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "ok",
+			kubeID:       "kube",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), execKube()), "TC: %s", tc.name)
+
+		e := NewNodeExecutor(svc)
+		e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+			return hostRunner{host: cfg.Host, fn: func(string, *runner.Command) error {
+				return nil
+			}}, nil
+		}
+
+		router := mux.NewRouter()
+		e.Register(router)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/kubes/"+tc.kubeID+"/certs", nil)
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+
+		if tc.expectedCode == http.StatusOK {
+			report := NodeCertsReport{}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&report), "TC: %s", tc.name)
+			require.Equal(t, NodeAccessSSH, report.Access, "TC: %s", tc.name)
+			require.Len(t, report.Nodes, 3, "TC: %s", tc.name)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package kube
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// ErrMasterNode is returned on deletion of master nodes, they are kept
+// to preserve the etcd quorum.
+var ErrMasterNode = errors.New("master nodes can't be deleted")
+
+// NodeDeleter removes worker nodes from clusters together with their instances.
+type NodeDeleter struct {
+	svc            Interface
+	accountService accountGetter
+	repo           storage.Interface
+
+	deleteK8sNode func(k *model.Kube, name string) error
+	getWriter     func(string) (io.WriteCloser, error)
+}
+
+// NewNodeDeleter constructs a NodeDeleter, tasks are stored in the repo.
+func NewNodeDeleter(svc Interface, accountService accountGetter, repo storage.Interface) *NodeDeleter {
+	return &NodeDeleter{
+		svc:            svc,
+		accountService: accountService,
+		repo:           repo,
+		deleteK8sNode:  deleteK8sNode,
+		getWriter:      util.GetWriter,
+	}
+}
+
+// DeleteNode drains the node through the eviction api, removes it from
+// kubernetes and deletes its instance with the workflow of the provider.
+// The node is dropped from the kube once the instance is gone, it is left
+// in the error state if any of that fails.
+func (d *NodeDeleter) DeleteNode(ctx context.Context, kubeID, nodeName string) error {
+	t, config, err := d.prepare(ctx, kubeID, nodeName)
+	if err != nil {
+		return err
+	}
+
+	return d.run(ctx, nodeName, t, config)
+}
+
+// DeleteNodeAsync marks the node as deleting and deletes it in background,
+// the returned task deletes the instance after the node has been drained.
+func (d *NodeDeleter) DeleteNodeAsync(ctx context.Context, kubeID, nodeName string) (*workflows.Task, error) {
+	t, config, err := d.prepare(ctx, kubeID, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := d.run(tenant.Detach(ctx), nodeName, t, config); err != nil {
+			logrus.Errorf("delete node %s from cluster %s: %v", nodeName, kubeID, err)
+		}
+	}()
+
+	return t, nil
+}
+
+// prepare checks the node can be deleted and marks it as deleting.
+func (d *NodeDeleter) prepare(ctx context.Context, kubeID, nodeName string) (*workflows.Task, *steps.Config, error) {
+	k, err := d.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	if _, ok := k.Masters[nodeName]; ok {
+		return nil, nil, errors.Wrapf(ErrMasterNode, "node %s", nodeName)
+	}
+	n := k.Nodes[nodeName]
+	if n == nil {
+		return nil, nil, errors.Wrapf(sgerrors.ErrNotFound, "node %s", nodeName)
+	}
+
+	config := &steps.Config{
+		Kube:             *k,
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Node:             *n,
+		Masters:          steps.NewMap(k.Masters),
+	}
+
+	// instances of externally managed machines are kept, cloud credentials are not needed
+	if !n.ExternallyManaged {
+		acc, err := d.accountService.Get(ctx, k.AccountName)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+		}
+		if err = util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+			return nil, nil, errors.Wrap(err, "fill cloud account credentials")
+		}
+	}
+
+	if err = util.LoadCloudSpecificDataFromKube(k, config); err != nil {
+		return nil, nil, errors.Wrap(err, "load cloud specific data")
+	}
+
+	t, err := workflows.NewTask(workflows.DeleteNode, d.repo)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "new task")
+	}
+
+	_, err = d.svc.Update(ctx, kubeID, func(k *model.Kube) error {
+		n := k.Nodes[nodeName]
+		if n == nil {
+			return errors.Wrapf(sgerrors.ErrNotFound, "node %s", nodeName)
+		}
+		n.State = model.MachineStateDeleting
+
+		if k.Tasks == nil {
+			k.Tasks = make(map[string][]string)
+		}
+		k.Tasks[workflows.NodeTask] = append(k.Tasks[workflows.NodeTask], t.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "update kube %s", kubeID)
+	}
+
+	return t, config, nil
+}
+
+func (d *NodeDeleter) run(ctx context.Context, nodeName string, t *workflows.Task, config *steps.Config) error {
+	kubeID := config.ClusterID
+
+	if err := d.remove(ctx, nodeName, t, config); err != nil {
+		_, updateErr := d.svc.Update(ctx, kubeID, func(k *model.Kube) error {
+			if n := k.Nodes[nodeName]; n != nil {
+				n.State = model.MachineStateError
+			}
+			return nil
+		})
+		if updateErr != nil {
+			logrus.Warnf("delete node %s: update kube %s: %v", nodeName, kubeID, updateErr)
+		}
+		return err
+	}
+
+	_, err := d.svc.Update(ctx, kubeID, func(k *model.Kube) error {
+		delete(k.Nodes, nodeName)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "update kube %s", kubeID)
+	}
+
+	return nil
+}
+
+// remove drains and deletes the node, nodes that have never registered
+// in kubernetes only have their instances deleted.
+func (d *NodeDeleter) remove(ctx context.Context, nodeName string, t *workflows.Task, config *steps.Config) error {
+	opts := DrainOptions{Force: true, DeleteLocalData: true}
+	if _, err := d.svc.DrainNode(ctx, config.ClusterID, nodeName, opts); err != nil && !sgerrors.IsNotFound(err) {
+		return errors.Wrapf(err, "drain node %s", nodeName)
+	}
+
+	if err := d.deleteK8sNode(&config.Kube, nodeName); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "delete node %s from kubernetes", nodeName)
+	}
+
+	writer, err := d.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		return errors.Wrap(err, "get writer")
+	}
+
+	if err = <-t.Run(ctx, *config, writer); err != nil {
+		return errors.Wrapf(err, "delete machine %s", nodeName)
+	}
+
+	return nil
+}
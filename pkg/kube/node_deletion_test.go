@@ -0,0 +1,151 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// drainedKubes stores kubes in memory and drains nodes with the error.
+type drainedKubes struct {
+	*Service
+	drainErr error
+}
+
+func (s drainedKubes) DrainNode(ctx context.Context, kubeID, node string, opts DrainOptions) (*DrainReport, error) {
+	return &DrainReport{Node: node}, s.drainErr
+}
+
+func TestNodeDeleter_DeleteNode(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		node       string
+		drainErr   error
+		deleteErr  error
+		step       steps.Step
+		accountErr error
+
+		expectedErr   error
+		expectedState model.MachineState
+		expectedNodes []string
+	}{
+		{
+			name:          "master",
+			node:          "master",
+			expectedErr:   ErrMasterNode,
+			expectedState: model.MachineStateActive,
+			expectedNodes: []string{"node", "other"},
+		},
+		{
+			name:          "unknown node",
+			node:          "lost",
+			expectedErr:   sgerrors.ErrNotFound,
+			expectedState: model.MachineStateActive,
+			expectedNodes: []string{"node", "other"},
+		},
+		{
+			name:          "account not found",
+			node:          "node",
+			accountErr:    sgerrors.ErrNotFound,
+			expectedErr:   sgerrors.ErrNotFound,
+			expectedState: model.MachineStateActive,
+			expectedNodes: []string{"node", "other"},
+		},
+		{
+			name:          "drain error",
+			node:          "node",
+			drainErr:      sgerrors.ErrTimeoutExceeded,
+			expectedErr:   sgerrors.ErrTimeoutExceeded,
+			expectedState: model.MachineStateError,
+			expectedNodes: []string{"node", "other"},
+		},
+		{
+			name:          "delete machine error",
+			node:          "node",
+			step:          failingStep{},
+			expectedErr:   errFake,
+			expectedState: model.MachineStateError,
+			expectedNodes: []string{"node", "other"},
+		},
+		{
+			name:          "not registered",
+			node:          "node",
+			drainErr:      sgerrors.ErrNotFound,
+			deleteErr:     apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node"),
+			expectedNodes: []string{"other"},
+		},
+		{
+			name:          "success",
+			node:          "node",
+			expectedNodes: []string{"other"},
+		},
+	} {
+		step := tc.step
+		if step == nil {
+			step = fakeStep{}
+		}
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.DeleteNode, []steps.Step{step})
+
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), &model.Kube{
+			ID:          "kube",
+			Provider:    clouds.DigitalOcean,
+			AccountName: "do",
+			Masters:     map[string]*model.Machine{"master": {Name: "master", State: model.MachineStateActive}},
+			Nodes: map[string]*model.Machine{
+				"node":  {Name: "node", State: model.MachineStateActive},
+				"other": {Name: "other", State: model.MachineStateActive},
+			},
+		}), "TC: %s", tc.name)
+
+		accService := new(accServiceMock)
+		accService.On(serviceGet, mock.Anything, "do").Return(&model.CloudAccount{
+			Name:        "do",
+			Provider:    clouds.DigitalOcean,
+			Credentials: map[string]string{"accessToken": "token"},
+		}, tc.accountErr)
+
+		deletedNodes := make([]string, 0)
+		d := NewNodeDeleter(drainedKubes{svc, tc.drainErr}, accService, memory.NewInMemoryRepository())
+		d.deleteK8sNode = func(k *model.Kube, name string) error {
+			deletedNodes = append(deletedNodes, name)
+			return tc.deleteErr
+		}
+		d.getWriter = func(string) (io.WriteCloser, error) {
+			return &bufferCloser{}, nil
+		}
+
+		err := d.DeleteNode(context.Background(), "kube", tc.node)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+
+		k, err := svc.Get(context.Background(), "kube")
+		require.NoError(t, err, "TC: %s", tc.name)
+		nodes := make([]string, 0, len(k.Nodes))
+		for name := range k.Nodes {
+			nodes = append(nodes, name)
+		}
+		require.ElementsMatch(t, tc.expectedNodes, nodes, "TC: %s", tc.name)
+		if n := k.Nodes["node"]; n != nil {
+			require.Equal(t, tc.expectedState, n.State, "TC: %s", tc.name)
+		}
+
+		if tc.expectedErr == nil {
+			require.Len(t, k.Tasks[workflows.NodeTask], 1, "TC: %s", tc.name)
+			require.Equal(t, []string{tc.node}, deletedNodes, "TC: %s", tc.name)
+		}
+	}
+}
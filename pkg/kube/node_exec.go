@@ -0,0 +1,386 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	defaultNodeExecConcurrency = 5
+	maxNodeExecConcurrency     = 50
+	defaultNodeExecTimeout     = 5 * time.Minute
+	maxNodeExecTimeout         = time.Hour
+	maxNodeExecOutput          = 64 << 10
+)
+
+// NodeExecRequest is a command or a script to be run on nodes of a cluster.
+// Nodes are selected by names, role or pool, all active nodes are selected
+// when none of them is set.
+type NodeExecRequest struct {
+	Command string `json:"command,omitempty"`
+	// Script is uploaded to a temporary file and run with sh.
+	Script string `json:"script,omitempty"`
+
+	Nodes []string   `json:"nodes,omitempty"`
+	Role  model.Role `json:"role,omitempty"`
+	// Pool is a role/size pair like node/m5.large.
+	Pool string `json:"pool,omitempty"`
+
+	Concurrency    int   `json:"concurrency,omitempty"`
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+func (r NodeExecRequest) validate() error {
+	command, script := strings.TrimSpace(r.Command) != "", strings.TrimSpace(r.Script) != ""
+	if command == script {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "either command or script is required")
+	}
+	if r.Role != "" && r.Role != model.RoleMaster && r.Role != model.RoleNode {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown role %s", r.Role)
+	}
+	if r.Concurrency < 0 || r.Concurrency > maxNodeExecConcurrency {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "concurrency must be between 1 and %d", maxNodeExecConcurrency)
+	}
+	if r.TimeoutSeconds < 0 || time.Duration(r.TimeoutSeconds)*time.Second > maxNodeExecTimeout {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "timeout must not exceed %s", maxNodeExecTimeout)
+	}
+	return nil
+}
+
+func (r NodeExecRequest) timeout() time.Duration {
+	if r.TimeoutSeconds == 0 {
+		return defaultNodeExecTimeout
+	}
+	return time.Duration(r.TimeoutSeconds) * time.Second
+}
+
+func (r NodeExecRequest) concurrency() int {
+	if r.Concurrency == 0 {
+		return defaultNodeExecConcurrency
+	}
+	return r.Concurrency
+}
+
+// NodeExecResult is an outcome of the command on a node.
+type NodeExecResult struct {
+	Node string `json:"node"`
+	// ExitCode is -1 when the command hasn't exited, Error tells why.
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	// Truncated is set when the output has exceeded its limit.
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NodeExecReport collects results of the command on all selected nodes.
+type NodeExecReport struct {
+	ID     string `json:"id"`
+	KubeID string `json:"kubeId"`
+	User   string `json:"user"`
+	// Access is either ssh or agent, see nodeAccess.
+	Access string `json:"access"`
+	// Command is empty for scripts, they are identified by their digest.
+	Command      string           `json:"command,omitempty"`
+	ScriptSHA256 string           `json:"scriptSha256,omitempty"`
+	StartedAt    time.Time        `json:"startedAt"`
+	FinishedAt   time.Time        `json:"finishedAt"`
+	Results      []NodeExecResult `json:"results"`
+	Failed       int              `json:"failed"`
+}
+
+// NodeExecutor runs ad-hoc commands on nodes over ssh with the key of
+// the cluster, it is meant for emergency fixes of the whole fleet. Nodes
+// of clusters without ssh access are reached through the node agent.
+type NodeExecutor struct {
+	svc Interface
+
+	getRunner func(cfg ssh.Config) (runner.Runner, error)
+	agent     nodeScriptRunner
+	now       func() time.Time
+
+	m         sync.RWMutex
+	listeners []func(NodeExecReport)
+}
+
+// NewNodeExecutor constructs a NodeExecutor for clusters of the service.
+func NewNodeExecutor(svc Interface) *NodeExecutor {
+	return &NodeExecutor{
+		svc:       svc,
+		getRunner: ssh.NewRunner,
+		agent:     newNodeAgent(),
+		now:       time.Now,
+	}
+}
+
+// OnExec subscribes fn to reports of finished commands.
+func (e *NodeExecutor) OnExec(fn func(NodeExecReport)) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+// Register adds the exec handler to a router.
+func (e *NodeExecutor) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/exec", e.exec).Methods(http.MethodPost)
+	r.HandleFunc("/kubes/{kubeID}/certs", e.getNodeCerts).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/bench", e.bench).Methods(http.MethodPost)
+}
+
+// Exec runs the command on the selected nodes, at most req.Concurrency of
+// them at once, and blocks until all of them are done. Failures of single
+// nodes are reported within the results.
+func (e *NodeExecutor) Exec(ctx context.Context, kubeID string, req NodeExecRequest) (*NodeExecReport, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	k, err := e.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	nodes, err := selectExecNodes(k, req)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &NodeExecReport{
+		ID:        uuid.New(),
+		KubeID:    k.ID,
+		User:      api.UserFromContext(ctx),
+		StartedAt: e.now(),
+	}
+
+	script := req.Command
+	if req.Script != "" {
+		digest := sha256.Sum256([]byte(req.Script))
+		report.ScriptSHA256 = hex.EncodeToString(digest[:])
+		script = uploadScript(req.Script, report.ID)
+	} else {
+		report.Command = req.Command
+	}
+
+	report.Access, report.Results = e.runScript(ctx, k, nodes, script, req.timeout(), req.concurrency(), maxNodeExecOutput)
+	report.FinishedAt = e.now()
+	for _, r := range report.Results {
+		if r.ExitCode != 0 {
+			report.Failed++
+		}
+	}
+
+	e.m.RLock()
+	for _, fn := range e.listeners {
+		fn(*report)
+	}
+	e.m.RUnlock()
+
+	return report, nil
+}
+
+// runScript runs the script on the nodes over ssh, at most concurrency of
+// them at once, or through the agent on all of them when ssh is unavailable.
+func (e *NodeExecutor) runScript(ctx context.Context, k *model.Kube, nodes []string, script string,
+	timeout time.Duration, concurrency, limit int) (string, []NodeExecResult) {
+	if nodeAccess(k, nodes) == NodeAccessAgent {
+		return NodeAccessAgent, e.agent.RunScript(ctx, k, nodes, script, timeout, limit)
+	}
+
+	results := make([]NodeExecResult, len(nodes))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = e.run(ctx, k, nodes[i], script, timeout, limit)
+		}(i)
+	}
+	wg.Wait()
+
+	return NodeAccessSSH, results
+}
+
+func (e *NodeExecutor) run(ctx context.Context, k *model.Kube, node, script string, timeout time.Duration, limit int) NodeExecResult {
+	result := NodeExecResult{Node: node, ExitCode: -1}
+
+	cfg, err := nodeSSHConfig(k, node)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	r, err := e.getRunner(cfg)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// the ssh runner kills sessions only when they are cancelled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(timeout, cancel)
+	defer timer.Stop()
+
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+	err = r.Run(&runner.Command{Ctx: ctx, Script: script, Out: stdout, Err: stderr})
+
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	result.Truncated = stdout.truncated() || stderr.truncated()
+
+	if err != nil && !timer.Stop() {
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+		return result
+	}
+	if exitErr, ok := errors.Cause(err).(exitStatuser); ok && exitErr.Signal() == "" {
+		result.ExitCode = exitErr.ExitStatus()
+		return result
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ExitCode = 0
+	return result
+}
+
+// exitStatuser is implemented by *ssh.ExitError of commands that have
+// exited with a non-zero code or have been killed by a signal.
+type exitStatuser interface {
+	ExitStatus() int
+	Signal() string
+}
+
+// selectExecNodes returns names of active machines matching the request.
+func selectExecNodes(k *model.Kube, req NodeExecRequest) ([]string, error) {
+	machines := make(map[string]*model.Machine, len(k.Masters)+len(k.Nodes))
+	for _, group := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for name, m := range group {
+			if m != nil {
+				machines[name] = m
+			}
+		}
+	}
+
+	names := req.Nodes
+	if len(names) == 0 {
+		for name := range machines {
+			names = append(names, name)
+		}
+	}
+
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		m := machines[name]
+		if m == nil {
+			return nil, errors.Wrapf(sgerrors.ErrNotFound, "node %s", name)
+		}
+		if m.State != model.MachineStateActive {
+			continue
+		}
+		if req.Role != "" && m.Role != req.Role {
+			continue
+		}
+		if req.Pool != "" && machinePool(m) != req.Pool {
+			continue
+		}
+		selected = append(selected, name)
+	}
+	if len(selected) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "active nodes of kube %s", k.ID)
+	}
+
+	sort.Strings(selected)
+	return selected, nil
+}
+
+// uploadScript wraps the script to a command that writes it to a temporary
+// file, runs it and removes it. The heredoc delimiter is unique per run so
+// it can't be closed by the script.
+func uploadScript(script, id string) string {
+	delim := "SG_SCRIPT_" + strings.Replace(id, "-", "", -1)
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	return fmt.Sprintf("f=$(mktemp) && cat > $f <<'%s'\n%s%s\nsh $f; code=$?; rm -f $f; exit $code", delim, script, delim)
+}
+
+// exec runs a command on nodes of the cluster:
+// POST /kubes/{kubeID}/exec
+func (e *NodeExecutor) exec(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := NodeExecRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	report, err := e.Exec(r.Context(), kubeID, req)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it, the rest is
+// discarded without an error to let the command finish.
+type limitedBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+	cut   bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if left := b.limit - b.buf.Len(); len(p) > left {
+		b.cut = true
+		b.buf.Write(p[:left])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *limitedBuffer) truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cut
+}
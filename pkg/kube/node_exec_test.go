@@ -0,0 +1,343 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+// hostRunner runs commands of the host with fn.
+type hostRunner struct {
+	host string
+	fn   func(host string, cmd *runner.Command) error
+}
+
+func (r hostRunner) Run(cmd *runner.Command) error {
+	return r.fn(r.host, cmd)
+}
+
+// execExitError is an exit status of a command that has failed.
+type execExitError struct {
+	code int
+}
+
+func (e *execExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *execExitError) ExitStatus() int { return e.code }
+
+func (e *execExitError) Signal() string { return "" }
+
+func execKube() *model.Kube {
+	return &model.Kube{
+		ID:        "kube",
+		SSHConfig: model.SSHConfig{User: "root", BootstrapPrivateKey: "key"},
+		Masters: map[string]*model.Machine{
+			"master": {Name: "master", Role: model.RoleMaster, Size: "s-2", PublicIp: "10.0.0.1", State: model.MachineStateActive},
+		},
+		Nodes: map[string]*model.Machine{
+			"node-1":  {Name: "node-1", Role: model.RoleNode, Size: "s-2", PublicIp: "10.0.0.2", State: model.MachineStateActive},
+			"node-2":  {Name: "node-2", Role: model.RoleNode, Size: "s-4", PublicIp: "10.0.0.3", State: model.MachineStateActive},
+			"pending": {Name: "pending", Role: model.RoleNode, Size: "s-2", PublicIp: "10.0.0.4", State: model.MachineStatePlanned},
+		},
+	}
+}
+
+func TestNodeExecRequest_validate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		req         NodeExecRequest
+		expectedErr error
+	}{
+		{
+			name:        "nothing to run",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "command and script",
+			req:         NodeExecRequest{Command: "uptime", Script: "uptime"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown role",
+			req:         NodeExecRequest{Command: "uptime", Role: "etcd"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "concurrency",
+			req:         NodeExecRequest{Command: "uptime", Concurrency: maxNodeExecConcurrency + 1},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "timeout",
+			req:         NodeExecRequest{Command: "uptime", TimeoutSeconds: 7200},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "ok",
+			req:  NodeExecRequest{Script: "uptime", Role: model.RoleNode, Concurrency: 10, TimeoutSeconds: 60},
+		},
+	} {
+		err := tc.req.validate()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+	}
+}
+
+func TestNodeExecutor_Exec(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  NodeExecRequest
+
+		expectedErr     error
+		expectedResults []NodeExecResult
+		expectedFailed  int
+	}{
+		{
+			name:        "unknown node",
+			req:         NodeExecRequest{Command: "uptime", Nodes: []string{"lost"}},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no active nodes",
+			req:         NodeExecRequest{Command: "uptime", Nodes: []string{"pending"}},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name: "all nodes",
+			req:  NodeExecRequest{Command: "uptime"},
+			expectedResults: []NodeExecResult{
+				{Node: "master", Stdout: "10.0.0.1: uptime"},
+				{Node: "node-1", Stdout: "10.0.0.2: uptime"},
+				{Node: "node-2", Stdout: "10.0.0.3: uptime"},
+			},
+		},
+		{
+			name: "pool",
+			req:  NodeExecRequest{Command: "uptime", Pool: "node/s-2"},
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", Stdout: "10.0.0.2: uptime"},
+			},
+		},
+		{
+			name: "role",
+			req:  NodeExecRequest{Command: "exit 3", Role: model.RoleNode},
+			expectedResults: []NodeExecResult{
+				{Node: "node-1", ExitCode: 3, Stdout: "10.0.0.2: exit 3"},
+				{Node: "node-2", ExitCode: 3, Stdout: "10.0.0.3: exit 3"},
+			},
+			expectedFailed: 2,
+		},
+		{
+			name: "connection error",
+			req:  NodeExecRequest{Command: "fail", Nodes: []string{"master"}},
+			expectedResults: []NodeExecResult{
+				{Node: "master", ExitCode: -1, Stdout: "10.0.0.1: fail", Error: errFake.Error()},
+			},
+			expectedFailed: 1,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), execKube()), "TC: %s", tc.name)
+
+		reports := make([]NodeExecReport, 0)
+		e := NewNodeExecutor(svc)
+		e.OnExec(func(r NodeExecReport) {
+			reports = append(reports, r)
+		})
+		e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+			return hostRunner{host: cfg.Host, fn: func(host string, cmd *runner.Command) error {
+				fmt.Fprintf(cmd.Out, "%s: %s", host, cmd.Script)
+				switch cmd.Script {
+				case "fail":
+					return errFake
+				case "exit 3":
+					return &execExitError{3}
+				}
+				return nil
+			}}, nil
+		}
+
+		report, err := e.Exec(context.Background(), "kube", tc.req)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if tc.expectedErr != nil {
+			require.Empty(t, reports, "TC: %s", tc.name)
+			continue
+		}
+
+		require.Equal(t, tc.expectedResults, report.Results, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedFailed, report.Failed, "TC: %s", tc.name)
+		require.Equal(t, tc.req.Command, report.Command, "TC: %s", tc.name)
+		require.Equal(t, NodeAccessSSH, report.Access, "TC: %s", tc.name)
+		require.Equal(t, []NodeExecReport{*report}, reports, "TC: %s", tc.name)
+	}
+}
+
+func TestNodeExecutor_ExecScript(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	require.NoError(t, svc.Create(context.Background(), execKube()))
+
+	scripts := make(map[string]string)
+	running, maxRunning := 0, 0
+	mu := sync.Mutex{}
+
+	e := NewNodeExecutor(svc)
+	e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+		return hostRunner{host: cfg.Host, fn: func(host string, cmd *runner.Command) error {
+			mu.Lock()
+			scripts[host] = cmd.Script
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+			io.WriteString(cmd.Out, strings.Repeat("x", maxNodeExecOutput+1))
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		}}, nil
+	}
+
+	report, err := e.Exec(context.Background(), "kube", NodeExecRequest{
+		Script:      "echo mirror > /etc/docker/daemon.json",
+		Concurrency: 1,
+	})
+	require.NoError(t, err)
+	require.Empty(t, report.Command)
+	require.Len(t, report.ScriptSHA256, 64)
+	require.Equal(t, 1, maxRunning)
+	require.Len(t, scripts, 3)
+
+	for _, r := range report.Results {
+		require.True(t, r.Truncated, r.Node)
+		require.Len(t, r.Stdout, maxNodeExecOutput, r.Node)
+	}
+	for _, script := range scripts {
+		require.Contains(t, script, "\necho mirror > /etc/docker/daemon.json\n")
+		require.True(t, strings.HasPrefix(script, "f=$(mktemp)"), script)
+	}
+}
+
+func TestNodeExecutor_ExecTimeout(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	require.NoError(t, svc.Create(context.Background(), execKube()))
+
+	e := NewNodeExecutor(svc)
+	e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+		return hostRunner{host: cfg.Host, fn: func(host string, cmd *runner.Command) error {
+			<-cmd.Ctx.Done()
+			return cmd.Ctx.Err()
+		}}, nil
+	}
+
+	report, err := e.Exec(context.Background(), "kube", NodeExecRequest{
+		Command:        "sleep 3600",
+		Nodes:          []string{"master"},
+		TimeoutSeconds: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, -1, report.Results[0].ExitCode)
+	require.Contains(t, report.Results[0].Error, "timed out")
+}
+
+func TestNodeExecutor_exec(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "validation failed",
+			body:         `{}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown node",
+			body:         `{"command":"uptime","nodes":["lost"]}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "ok",
+			body:         `{"command":"uptime"}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), execKube()), "TC: %s", tc.name)
+
+		e := NewNodeExecutor(svc)
+		e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+			return hostRunner{host: cfg.Host, fn: func(string, *runner.Command) error {
+				return nil
+			}}, nil
+		}
+
+		router := mux.NewRouter()
+		e.Register(router)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/exec", bytes.NewBufferString(tc.body))
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+
+		if tc.expectedCode == http.StatusOK {
+			report := NodeExecReport{}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&report), "TC: %s", tc.name)
+			require.Len(t, report.Results, 3, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestNodeExecutor_ExecAgent(t *testing.T) {
+	k := execKube()
+	k.SSHConfig.BootstrapPrivateKey = ""
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	require.NoError(t, svc.Create(context.Background(), k))
+
+	e := NewNodeExecutor(svc)
+	e.getRunner = func(cfg ssh.Config) (runner.Runner, error) {
+		t.Fatal("ssh must not be used without the key")
+		return nil, nil
+	}
+	agent := &fakeAgent{fn: func(node, script string) NodeExecResult {
+		return NodeExecResult{Node: node, Stdout: node + ": " + script}
+	}}
+	e.agent = agent
+
+	report, err := e.Exec(context.Background(), "kube", NodeExecRequest{Command: "uptime", Role: model.RoleNode})
+	require.NoError(t, err)
+	require.Equal(t, NodeAccessAgent, report.Access)
+	require.Equal(t, []NodeExecResult{
+		{Node: "node-1", Stdout: "node-1: uptime"},
+		{Node: "node-2", Stdout: "node-2: uptime"},
+	}, report.Results)
+	require.Equal(t, []string{"uptime"}, agent.scripts)
+}
@@ -0,0 +1,245 @@
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	defaultNodeFileMode = "0644"
+	maxNodeFileSize     = 1 << 20
+)
+
+var (
+	// file paths and units are put into shell scripts as they are
+	nodeFilePathRe = regexp.MustCompile(`^/[A-Za-z0-9._/@:+-]+$`)
+	nodeFileModeRe = regexp.MustCompile(`^0?[0-7]{3}$`)
+	systemdUnitRe  = regexp.MustCompile(`^[A-Za-z0-9@._-]+$`)
+)
+
+// FileDistribution is a set of files written to machines of a cluster,
+// all active machines get them unless Role is set.
+type FileDistribution struct {
+	Files []steps.NodeFile `json:"files"`
+	Role  model.Role       `json:"role,omitempty"`
+	// Restart are systemd units restarted on machines where any of the
+	// files has changed.
+	Restart []string `json:"restart,omitempty"`
+}
+
+func (d *FileDistribution) validate() error {
+	if len(d.Files) == 0 {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "no files")
+	}
+	if d.Role != "" && d.Role != model.RoleMaster && d.Role != model.RoleNode {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown role %s", d.Role)
+	}
+
+	paths := make(map[string]bool, len(d.Files))
+	for i := range d.Files {
+		f := &d.Files[i]
+		if !nodeFilePathRe.MatchString(f.Path) || path.Clean(f.Path) != f.Path {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid path %q", f.Path)
+		}
+		if paths[f.Path] {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "duplicate path %s", f.Path)
+		}
+		paths[f.Path] = true
+
+		if f.Mode == "" {
+			f.Mode = defaultNodeFileMode
+		}
+		if !nodeFileModeRe.MatchString(f.Mode) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid mode %q of %s", f.Mode, f.Path)
+		}
+
+		content, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "content of %s: %v", f.Path, err)
+		}
+		if len(content) > maxNodeFileSize {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "%s is larger than %d bytes", f.Path, maxNodeFileSize)
+		}
+
+		digest := sha256.Sum256(content)
+		checksum := hex.EncodeToString(digest[:])
+		if f.SHA256 != "" && !strings.EqualFold(f.SHA256, checksum) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "checksum of %s does not match", f.Path)
+		}
+		f.SHA256 = checksum
+	}
+
+	for _, unit := range d.Restart {
+		if !systemdUnitRe.MatchString(unit) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid unit %q", unit)
+		}
+	}
+
+	return nil
+}
+
+// FileDistributor pushes configuration files like registry certificates or
+// sysctl settings to machines of clusters. Machines without ssh access get
+// them through the node agent.
+type FileDistributor struct {
+	svc            Interface
+	accountService accountGetter
+	repo           storage.Interface
+	agent          nodeScriptRunner
+
+	getWriter func(string) (io.WriteCloser, error)
+	now       func() time.Time
+}
+
+// NewFileDistributor constructs a FileDistributor, tasks are stored in the repo.
+func NewFileDistributor(svc Interface, accountService accountGetter, repo storage.Interface) *FileDistributor {
+	return &FileDistributor{
+		svc:            svc,
+		accountService: accountService,
+		repo:           repo,
+		agent:          newNodeAgent(),
+		getWriter:      util.GetWriter,
+		now:            time.Now,
+	}
+}
+
+// Register adds the file distribution handler to a router.
+func (d *FileDistributor) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/files", d.distributeFiles).Methods(http.MethodPost)
+}
+
+// Distribute writes the files to machines one at a time in background,
+// masters go first. Every machine has its task within the returned group,
+// the rollout stops on the first failed machine.
+func (d *FileDistributor) Distribute(ctx context.Context, kubeID string, req *FileDistribution) (*workflows.Task, map[string]string, error) {
+	if err := req.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	k, err := d.svc.Get(ctx, kubeID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	machines := make([]*model.Machine, 0)
+	names := make([]string, 0)
+	for _, m := range rolloutOrder(k) {
+		if req.Role == "" || m.Role == req.Role {
+			machines = append(machines, m)
+			names = append(names, m.Name)
+		}
+	}
+	if len(machines) == 0 {
+		return nil, nil, errors.Wrapf(sgerrors.ErrNotFound, "active machines of kube %s", kubeID)
+	}
+
+	workflow := workflows.DistributeFiles
+	if nodeAccess(k, names) == NodeAccessAgent {
+		workflow = workflows.DistributeFilesAgent
+	}
+
+	acc, err := d.accountService.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+
+	filesConfig := steps.FilesConfig{
+		Files:        req.Files,
+		BackupSuffix: ".sg-backup-" + d.now().UTC().Format("20060102150405"),
+		Restart:      req.Restart,
+	}
+
+	group, err := workflows.NewTaskGroup(d.repo)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "new task group")
+	}
+
+	tasks := make([]*workflows.Task, 0, len(machines))
+	configs := make([]*steps.Config, 0, len(machines))
+	machineTasks := make(map[string]string, len(machines))
+	for _, m := range machines {
+		t, err := newRolloutTask(workflow, group, tasks, d.repo)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "new task")
+		}
+
+		config := &steps.Config{
+			Kube:             *k,
+			Provider:         k.Provider,
+			IsMaster:         m.Role == model.RoleMaster,
+			ClusterID:        k.ID,
+			ClusterName:      k.Name,
+			CloudAccountName: k.AccountName,
+			Node:             *m,
+			Masters:          steps.NewMap(k.Masters),
+			FilesConfig:      filesConfig,
+		}
+		if err := util.FillCloudAccountCredentials(ctx, acc, config); err != nil {
+			return nil, nil, errors.Wrap(err, "fill cloud account credentials")
+		}
+		if workflow == workflows.DistributeFilesAgent {
+			config.Runner = &agentNodeRunner{agent: d.agent, kube: k, node: m.Name}
+		}
+
+		tasks = append(tasks, t)
+		configs = append(configs, config)
+		machineTasks[m.Name] = t.ID
+	}
+
+	_, err = d.svc.Update(ctx, kubeID, func(k *model.Kube) error {
+		if k.Tasks == nil {
+			k.Tasks = make(map[string][]string)
+		}
+		for _, t := range tasks {
+			k.Tasks[workflows.FilesTask] = append(k.Tasks[workflows.FilesTask], t.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "update kube %s", kubeID)
+	}
+
+	go rollOut(d.getWriter, kubeID, workflow, tasks, configs)
+
+	return group, machineTasks, nil
+}
+
+// distributeFiles writes files to machines of the cluster:
+// POST /kubes/{kubeID}/files
+func (d *FileDistributor) distributeFiles(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := &FileDistribution{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	group, machineTasks, err := d.Distribute(r.Context(), kubeID, req)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	workflows.SendAccepted(w, group.ID, machineTasks)
+}
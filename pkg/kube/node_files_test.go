@@ -0,0 +1,282 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// filesStep sends configs of machines it has run for.
+type filesStep struct {
+	fakeStep
+	configs chan steps.Config
+}
+
+func (s filesStep) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	s.configs <- *config
+	return nil
+}
+
+// daemonJSON is {}\n encoded with its checksum.
+const (
+	daemonJSON       = "e30K"
+	daemonJSONSHA256 = "ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356"
+)
+
+func TestFileDistribution_validate(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		distribution FileDistribution
+		expectedErr  error
+	}{
+		{
+			name:        "no files",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "relative path",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "etc/docker/daemon.json", Content: daemonJSON},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "quoted path",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/'$(reboot)'", Content: daemonJSON},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "unclean path",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/../shadow", Content: daemonJSON},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "duplicate path",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/daemon.json", Content: daemonJSON},
+				{Path: "/etc/docker/daemon.json", Content: daemonJSON},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "mode",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/daemon.json", Content: daemonJSON, Mode: "rw-r--r--"},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "content",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/daemon.json", Content: "{}"},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "checksum",
+			distribution: FileDistribution{Files: []steps.NodeFile{
+				{Path: "/etc/docker/daemon.json", Content: daemonJSON, SHA256: "e3b0c442"},
+			}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "unit",
+			distribution: FileDistribution{
+				Files:   []steps.NodeFile{{Path: "/etc/docker/daemon.json", Content: daemonJSON}},
+				Restart: []string{"docker; reboot"},
+			},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "ok",
+			distribution: FileDistribution{
+				Files: []steps.NodeFile{
+					{Path: "/etc/docker/daemon.json", Content: daemonJSON, SHA256: strings.ToUpper(daemonJSONSHA256)},
+					{Path: "/etc/docker/certs.d/registry:5000/ca.crt", Content: daemonJSON, Mode: "600"},
+				},
+				Restart: []string{"docker.service"},
+			},
+		},
+	} {
+		err := tc.distribution.validate()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range tc.distribution.Files {
+			require.Equal(t, daemonJSONSHA256, strings.ToLower(f.SHA256), "TC: %s", tc.name)
+		}
+		require.Equal(t, defaultNodeFileMode, tc.distribution.Files[0].Mode, "TC: %s", tc.name)
+	}
+}
+
+func TestFileDistributor_Distribute(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		role       model.Role
+		noSSHKey   bool
+		accountErr error
+
+		expectedErr      error
+		expectedMachines []string
+	}{
+		{
+			name:        "account not found",
+			accountErr:  sgerrors.ErrNotFound,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no machines of the role",
+			role:        model.RoleMaster,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:             "all machines",
+			expectedMachines: []string{"node-1", "node-2"},
+		},
+		{
+			name:             "nodes",
+			role:             model.RoleNode,
+			expectedMachines: []string{"node-1", "node-2"},
+		},
+		{
+			name:             "agent",
+			noSSHKey:         true,
+			expectedMachines: []string{"node-1", "node-2"},
+		},
+	} {
+		configs := make(chan steps.Config, 2)
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.DistributeFiles, []steps.Step{filesStep{configs: configs}})
+		workflows.RegisterWorkFlow(workflows.DistributeFilesAgent, []steps.Step{filesStep{configs: configs}})
+
+		sshKey := "key"
+		if tc.noSSHKey {
+			sshKey = ""
+		}
+
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		require.NoError(t, svc.Create(context.Background(), &model.Kube{
+			ID:          "kube",
+			AccountName: "do",
+			SSHConfig:   model.SSHConfig{BootstrapPrivateKey: sshKey},
+			Masters: map[string]*model.Machine{
+				"master": {Name: "master", Role: model.RoleMaster, State: model.MachineStatePlanned},
+			},
+			Nodes: map[string]*model.Machine{
+				"node-1": {Name: "node-1", Role: model.RoleNode, PublicIp: "10.0.0.2", State: model.MachineStateActive},
+				"node-2": {Name: "node-2", Role: model.RoleNode, PublicIp: "10.0.0.3", State: model.MachineStateActive},
+			},
+		}), "TC: %s", tc.name)
+
+		accService := new(accServiceMock)
+		accService.On(serviceGet, mock.Anything, "do").Return(&model.CloudAccount{
+			Name:        "do",
+			Provider:    clouds.DigitalOcean,
+			Credentials: map[string]string{"accessToken": "token"},
+		}, tc.accountErr)
+
+		d := NewFileDistributor(svc, accService, memory.NewInMemoryRepository())
+		d.getWriter = func(string) (io.WriteCloser, error) {
+			return &bufferCloser{}, nil
+		}
+		d.now = func() time.Time {
+			return time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC)
+		}
+
+		group, machineTasks, err := d.Distribute(context.Background(), "kube", &FileDistribution{
+			Files:   []steps.NodeFile{{Path: "/etc/docker/daemon.json", Content: daemonJSON}},
+			Role:    tc.role,
+			Restart: []string{"docker"},
+		})
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+		require.NotEmpty(t, group.ID, "TC: %s", tc.name)
+		require.Len(t, machineTasks, len(tc.expectedMachines), "TC: %s", tc.name)
+
+		k, err := svc.Get(context.Background(), "kube")
+		require.NoError(t, err, "TC: %s", tc.name)
+		for _, name := range tc.expectedMachines {
+			require.Contains(t, k.Tasks[workflows.FilesTask], machineTasks[name], "TC: %s", tc.name)
+		}
+
+		// machines are changed one after another
+		for _, name := range tc.expectedMachines {
+			config := <-configs
+			require.Equal(t, name, config.Node.Name, "TC: %s", tc.name)
+			if tc.noSSHKey {
+				r, ok := config.Runner.(*agentNodeRunner)
+				require.True(t, ok, "TC: %s", tc.name)
+				require.Equal(t, name, r.node, "TC: %s", tc.name)
+			} else {
+				require.Nil(t, config.Runner, "TC: %s", tc.name)
+			}
+			require.Equal(t, ".sg-backup-20190507000000", config.FilesConfig.BackupSuffix, "TC: %s", tc.name)
+			require.Equal(t, []string{"docker"}, config.FilesConfig.Restart, "TC: %s", tc.name)
+			require.Equal(t, []steps.NodeFile{{
+				Path:    "/etc/docker/daemon.json",
+				Content: daemonJSON,
+				Mode:    defaultNodeFileMode,
+				SHA256:  daemonJSONSHA256,
+			}}, config.FilesConfig.Files, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestFileDistributor_distributeFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "validation failed",
+			body:         `{"files":[]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "kube not found",
+			body:         `{"files":[{"path":"/etc/docker/daemon.json","content":"e30K"}]}`,
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+		d := NewFileDistributor(svc, new(accServiceMock), memory.NewInMemoryRepository())
+
+		router := mux.NewRouter()
+		d.Register(router)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/files", strings.NewReader(tc.body))
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
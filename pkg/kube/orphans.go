@@ -0,0 +1,281 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// OrphanReport compares kubernetes nodes of a cluster with cloud instances
+// tagged for it.
+type OrphanReport struct {
+	KubeID    string    `json:"kubeId"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UnjoinedInstances run in the cloud, but there are no node objects
+	// for them, usually they have failed to join the cluster.
+	UnjoinedInstances []Instance `json:"unjoinedInstances"`
+	// LostNodes are names of node objects whose instances are gone.
+	LostNodes []string `json:"lostNodes"`
+}
+
+// FindOrphans builds the report, instances of machines that are still
+// being provisioned are not expected to have joined yet.
+func FindOrphans(k *model.Kube, nodes []corev1.Node, instances []Instance) *OrphanReport {
+	report := &OrphanReport{
+		KubeID:            k.ID,
+		CreatedAt:         time.Now(),
+		UnjoinedInstances: make([]Instance, 0),
+		LostNodes:         make([]string, 0),
+	}
+
+	provisioning := make(map[string]bool)
+	for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for _, m := range machines {
+			if m == nil {
+				continue
+			}
+			switch m.State {
+			case model.MachineStatePlanned, model.MachineStateBuilding, model.MachineStateProvisioning:
+				provisioning[m.Name] = true
+			}
+		}
+	}
+
+	joined := make(map[string]bool, len(instances))
+	for _, n := range nodes {
+		found := false
+		for _, inst := range instances {
+			if nodeRunsOn(n, inst) {
+				joined[inst.ID] = true
+				found = true
+			}
+		}
+		if !found {
+			report.LostNodes = append(report.LostNodes, n.Name)
+		}
+	}
+
+	for _, inst := range instances {
+		if !joined[inst.ID] && !provisioning[inst.Name] {
+			report.UnjoinedInstances = append(report.UnjoinedInstances, inst)
+		}
+	}
+
+	return report
+}
+
+// nodeRunsOn matches a node by the provider id, private ip or name.
+func nodeRunsOn(n corev1.Node, inst Instance) bool {
+	if n.Spec.ProviderID != "" {
+		return n.Spec.ProviderID[strings.LastIndex(n.Spec.ProviderID, "/")+1:] == inst.ID
+	}
+	for _, addr := range n.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP && addr.Address == inst.PrivateIP && inst.PrivateIP != "" {
+			return true
+		}
+	}
+
+	return n.Name == inst.Name && inst.Name != ""
+}
+
+func (h *Handler) orphanReport(r *http.Request, k *model.Kube) (*OrphanReport, error) {
+	nodes, err := h.svc.ListNodes(r.Context(), k, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "list nodes")
+	}
+
+	instances, err := h.instances.ClusterInstances(r.Context(), k)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindOrphans(k, nodes, instances), nil
+}
+
+func (h *Handler) getOrphans(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.orphanReport(r, k)
+	if err != nil {
+		sendOrphanError(w, k, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// deleteUnjoinedInstance runs a workflow that deletes the instance from the cloud.
+func (h *Handler) deleteUnjoinedInstance(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+	instanceID := mux.Vars(r)["instanceID"]
+
+	report, err := h.orphanReport(r, k)
+	if err != nil {
+		sendOrphanError(w, k, err)
+		return
+	}
+
+	var inst *Instance
+	for i := range report.UnjoinedInstances {
+		if report.UnjoinedInstances[i].ID == instanceID {
+			inst = &report.UnjoinedInstances[i]
+		}
+	}
+	// only orphans are deleted, nodes are removed with their drain workflow
+	if inst == nil {
+		message.SendNotFound(w, instanceID, errors.Wrapf(sgerrors.ErrNotFound, "unjoined instance %s", instanceID))
+		return
+	}
+
+	config := &steps.Config{
+		Kube:             *k,
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Node: model.Machine{
+			ID:       inst.ID,
+			Name:     inst.Name,
+			Provider: k.Provider,
+			Region:   k.Region,
+		},
+		Masters: steps.NewMap(k.Masters),
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		message.SendUnknownError(w, errors.Wrapf(err, "get cloud account %s", k.AccountName))
+		return
+	}
+	if err = util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	t, err := workflows.NewTask(workflows.DeleteOrphan, h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	writer, err := h.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	go func() {
+		if err := <-t.Run(tenant.Detach(r.Context()), *config, writer); err != nil {
+			logrus.Errorf("delete unjoined instance %s of cluster %s: %v", inst.ID, k.ID, err)
+		}
+	}()
+
+	workflows.SendAccepted(w, t.ID, t)
+}
+
+// deleteLostNode removes the node object and the machine of a gone instance.
+func (h *Handler) deleteLostNode(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+	nodeName := mux.Vars(r)["nodename"]
+
+	report, err := h.orphanReport(r, k)
+	if err != nil {
+		sendOrphanError(w, k, err)
+		return
+	}
+
+	lost := false
+	for _, name := range report.LostNodes {
+		lost = lost || name == nodeName
+	}
+	if !lost {
+		message.SendNotFound(w, nodeName, errors.Wrapf(sgerrors.ErrNotFound, "lost node %s", nodeName))
+		return
+	}
+
+	if err = h.deleteK8sNode(k, nodeName); err != nil {
+		message.SendUnknownError(w, errors.Wrapf(err, "delete node %s", nodeName))
+		return
+	}
+
+	for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for key, m := range machines {
+			if key == nodeName || (m != nil && m.Name == nodeName) {
+				delete(machines, key)
+			}
+		}
+	}
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, errors.Wrapf(err, "update kube %s", k.ID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getKubeForRequest(w http.ResponseWriter, r *http.Request) (*model.Kube, bool) {
+	kubeID := mux.Vars(r)["kubeID"]
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return nil, false
+		}
+		message.SendUnknownError(w, err)
+		return nil, false
+	}
+
+	return k, true
+}
+
+func sendOrphanError(w http.ResponseWriter, k *model.Kube, err error) {
+	if sgerrors.IsUnsupportedProvider(err) {
+		message.SendMessage(w, message.New("orphans can't be found for "+string(k.Provider)+" clusters",
+			err.Error(), sgerrors.UnsupportedProvider, ""), http.StatusBadRequest)
+		return
+	}
+	message.SendUnknownError(w, err)
+}
+
+func deleteK8sNode(k *model.Kube, name string) error {
+	cfg, err := NewConfigFor(k)
+	if err != nil {
+		return errors.Wrap(err, "build kubernetes rest config")
+	}
+	c, err := clientcorev1.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "build kubernetes client")
+	}
+
+	return c.Nodes().Delete(name, &metav1.DeleteOptions{})
+}
@@ -0,0 +1,213 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+type fakeInstances struct {
+	instances []Instance
+	err       error
+}
+
+func (f *fakeInstances) Instances(ctx context.Context, k *model.Kube) (map[string]Instance, error) {
+	return map[string]Instance{}, nil
+}
+
+func (f *fakeInstances) ClusterInstances(ctx context.Context, k *model.Kube) ([]Instance, error) {
+	return f.instances, f.err
+}
+
+func TestFindOrphans(t *testing.T) {
+	k := &model.Kube{
+		ID: "kube",
+		Nodes: map[string]*model.Machine{
+			"building": {Name: "building", State: model.MachineStateBuilding},
+			"failed":   {Name: "failed", State: model.MachineStateError},
+		},
+	}
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "by-provider-id"},
+			Spec:       corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-0-2"},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+				},
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "by-name"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "lost"},
+			Spec:       corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-gone"},
+		},
+	}
+	instances := []Instance{
+		{ID: "i-1"},
+		{ID: "i-2", PrivateIP: "10.0.0.2"},
+		{ID: "i-3", Name: "by-name"},
+		{ID: "i-4", Name: "building"},
+		{ID: "i-5", Name: "failed"},
+	}
+
+	report := FindOrphans(k, nodes, instances)
+	require.Equal(t, "kube", report.KubeID)
+	require.Equal(t, []string{"lost"}, report.LostNodes)
+	require.Len(t, report.UnjoinedInstances, 1, "instances of building machines must be skipped")
+	require.Equal(t, "i-5", report.UnjoinedInstances[0].ID)
+}
+
+func TestHandler_getOrphans(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcGetErr    error
+		instances    []Instance
+		instancesErr error
+
+		expectedStatus  int
+		expectedErrCode sgerrors.ErrorCode
+		expectedOrphans int
+	}{
+		{
+			name:            "kube not found",
+			svcGetErr:       sgerrors.ErrNotFound,
+			expectedStatus:  http.StatusNotFound,
+			expectedErrCode: sgerrors.NotFound,
+		},
+		{
+			name:            "unsupported provider",
+			instancesErr:    sgerrors.ErrUnsupportedProvider,
+			expectedStatus:  http.StatusBadRequest,
+			expectedErrCode: sgerrors.UnsupportedProvider,
+		},
+		{
+			name:            "list instances error",
+			instancesErr:    sgerrors.ErrInvalidCredentials,
+			expectedStatus:  http.StatusInternalServerError,
+			expectedErrCode: sgerrors.UnknownError,
+		},
+		{
+			name:            "ok",
+			instances:       []Instance{{ID: "i-1"}},
+			expectedStatus:  http.StatusOK,
+			expectedOrphans: 1,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, mock.Anything).Return(&model.Kube{
+			ID:       "kube",
+			Provider: clouds.AWS,
+		}, tc.svcGetErr)
+		svc.On(serviceListNodes, mock.Anything, mock.Anything, mock.Anything).Return([]corev1.Node{}, nil)
+
+		h := NewHandler(svc, nil, nil, nil, nil, nil, nil)
+		h.instances = &fakeInstances{instances: tc.instances, err: tc.instancesErr}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req, err := http.NewRequest(http.MethodGet, "/kubes/kube/orphans", nil)
+		require.NoError(t, err, "TC: %s", tc.name)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, tc.expectedStatus, rr.Code, "TC: %s", tc.name)
+		if tc.expectedErrCode != sgerrors.ErrorCode(0) {
+			m := new(message.Message)
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(m), "TC: %s", tc.name)
+			require.Equal(t, tc.expectedErrCode, m.ErrorCode, "TC: %s", tc.name)
+			continue
+		}
+
+		report := &OrphanReport{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(report), "TC: %s", tc.name)
+		require.Len(t, report.UnjoinedInstances, tc.expectedOrphans, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_deleteLostNode(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		nodeName  string
+		deleteErr error
+
+		expectedStatus  int
+		expectedDeleted bool
+	}{
+		{
+			name:           "node is not lost",
+			nodeName:       "alive",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "delete node error",
+			nodeName:       "lost",
+			deleteErr:      sgerrors.ErrNilEntity,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:            "ok",
+			nodeName:        "lost",
+			expectedStatus:  http.StatusNoContent,
+			expectedDeleted: true,
+		},
+	} {
+		k := &model.Kube{
+			ID:       "kube",
+			Provider: clouds.AWS,
+			Nodes: map[string]*model.Machine{
+				"alive": {ID: "i-1", Name: "alive"},
+				"lost":  {ID: "i-2", Name: "lost"},
+			},
+		}
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, mock.Anything).Return(k, nil)
+		svc.On(serviceListNodes, mock.Anything, mock.Anything, mock.Anything).Return([]corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "alive"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "lost"}},
+		}, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		h := NewHandler(svc, nil, nil, nil, nil, nil, nil)
+		h.instances = &fakeInstances{instances: []Instance{{ID: "i-1", Name: "alive"}}}
+		deleted := ""
+		h.deleteK8sNode = func(k *model.Kube, name string) error {
+			deleted = name
+			return tc.deleteErr
+		}
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/kubes/kube/orphans/nodes/%s", tc.nodeName), nil)
+		require.NoError(t, err, "TC: %s", tc.name)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, tc.expectedStatus, rr.Code, "TC: %s", tc.name)
+		if tc.expectedDeleted {
+			require.Equal(t, "lost", deleted, "TC: %s", tc.name)
+			require.NotContains(t, k.Nodes, "lost", "TC: %s", tc.name)
+			svc.AssertCalled(t, serviceCreate, mock.Anything, k)
+		}
+	}
+}
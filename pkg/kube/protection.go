@@ -0,0 +1,130 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+var (
+	ErrDeletionProtected = errors.New("deletion protection of the cluster is enabled")
+	ErrSameUser          = errors.New("deletion protection has been cleared by the same user")
+
+	errClearedByAdmins = errors.New("deletion protection is cleared by admins")
+)
+
+// ProtectionRequest enables or clears deletion protection of a cluster,
+// clearing it requires the exact name of the cluster and a reason.
+type ProtectionRequest struct {
+	Enabled bool   `json:"enabled"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+}
+
+// confirmation checks the typed name of the cluster and the reason,
+// renamed clusters are confirmed with either of their names.
+func confirmation(k *model.Kube, name, reason string) error {
+	if name != k.Name && name != k.Title() {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "name %q does not match the cluster", name)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "reason is required")
+	}
+	return nil
+}
+
+// confirmDeletion blocks deletion of protected clusters. Clusters which
+// protection has been cleared are deleted by another user, who types
+// the name of the cluster and a reason: DELETE /kubes/{kubeID}?name=prod&reason=...
+func confirmDeletion(r *http.Request, k *model.Kube) error {
+	if k.DeletionProtection {
+		return ErrDeletionProtected
+	}
+	if k.ProtectionClearedBy == "" {
+		return nil
+	}
+
+	q := r.URL.Query()
+	if err := confirmation(k, q.Get("name"), q.Get("reason")); err != nil {
+		return err
+	}
+	if api.UserFromContext(r.Context()) == k.ProtectionClearedBy {
+		return ErrSameUser
+	}
+
+	return nil
+}
+
+func sendProtectionError(w http.ResponseWriter, err error) {
+	switch errors.Cause(err) {
+	case ErrDeletionProtected, ErrSameUser:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		message.SendValidationFailed(w, err)
+	}
+}
+
+// setProtection enables or clears deletion protection of the cluster.
+func (h *Handler) setProtection(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := ProtectionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	user := api.UserFromContext(r.Context())
+	cleared := false
+	k, err := h.svc.Update(r.Context(), kubeID, func(k *model.Kube) error {
+		cleared = false
+		if req.Enabled {
+			k.DeletionProtection = true
+			k.ProtectionClearedBy = ""
+			return nil
+		}
+		if !k.DeletionProtection {
+			return nil
+		}
+		if !api.IsAdmin(r.Context()) {
+			return errClearedByAdmins
+		}
+		if err := confirmation(k, req.Name, req.Reason); err != nil {
+			return err
+		}
+		k.DeletionProtection = false
+		k.ProtectionClearedBy = user
+		cleared = true
+		return nil
+	})
+	if err != nil {
+		switch {
+		case sgerrors.IsNotFound(err):
+			message.SendNotFound(w, kubeID, err)
+		case errors.Cause(err) == errClearedByAdmins:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Cause(err) == sgerrors.ErrInvalidJson:
+			message.SendValidationFailed(w, err)
+		default:
+			message.SendUnknownError(w, err)
+		}
+		return
+	}
+	if cleared {
+		logrus.Infof("deletion protection of kube %s has been cleared by %s: %s",
+			kubeID, user, req.Reason)
+	}
+
+	if err = json.NewEncoder(w).Encode(k); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,213 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+// userTokens treats tokens as user ids, the editor token has the edit role
+// and others are admin ones.
+type userTokens struct{}
+
+func (userTokens) Validate(token string) (jwt.MapClaims, error) {
+	if token == "editor" {
+		return jwt.MapClaims{"user_id": token, "accesses": []interface{}{"edit"}}, nil
+	}
+	return jwt.MapClaims{"user_id": token, "accesses": []interface{}{"admin", "edit", "view"}}, nil
+}
+
+func protectionRouter(svc Interface) *mux.Router {
+	mockProvisioner := new(mockNodeProvisioner)
+	mockProvisioner.On("Cancel", mock.Anything).Return(nil)
+
+	h := NewHandler(svc, nil, nil, mockProvisioner, nil, nil, nil)
+	router := mux.NewRouter()
+	h.Register(router)
+	auth := api.Middleware{TokenService: userTokens{}}
+	router.Use(auth.AuthMiddleware)
+
+	return router
+}
+
+func TestHandler_setProtection(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		token        string
+		kube         *model.Kube
+		req          ProtectionRequest
+		expectedCode int
+		expectedKube *model.Kube
+	}{
+		{
+			name:         "enable",
+			kube:         &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "bob"},
+			req:          ProtectionRequest{Enabled: true},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+		},
+		{
+			name:         "clear without name",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+			req:          ProtectionRequest{Reason: "decommission"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "clear without reason",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+			req:          ProtectionRequest{Name: "prod", Reason: " "},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "clear",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+			req:          ProtectionRequest{Name: "prod", Reason: "decommission"},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "alice"},
+		},
+		{
+			name:         "clear by editor",
+			token:        "editor",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+			req:          ProtectionRequest{Name: "prod", Reason: "decommission"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "clear renamed",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DisplayName: "Production", DeletionProtection: true},
+			req:          ProtectionRequest{Name: "Production", Reason: "decommission"},
+			expectedCode: http.StatusOK,
+			expectedKube: &model.Kube{ID: "kube", Name: "prod", DisplayName: "Production", ProtectionClearedBy: "alice"},
+		},
+	} {
+		original := *tc.kube
+		svc := new(kubeServiceMock)
+		svc.On(serviceUpdate, mock.Anything, "kube").Return(tc.kube, nil)
+
+		body, _ := json.Marshal(tc.req)
+		req := httptest.NewRequest(http.MethodPut, "/kubes/kube/protection", bytes.NewReader(body))
+		if tc.token == "" {
+			tc.token = "alice"
+		}
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rec := httptest.NewRecorder()
+		protectionRouter(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if tc.expectedKube == nil {
+			require.Equal(t, &original, tc.kube, "TC: %s", tc.name)
+			continue
+		}
+		require.Equal(t, tc.expectedKube, tc.kube, "TC: %s", tc.name)
+	}
+}
+
+// racingStorage saves the kube changed by a running task right after
+// the kube is read by a request.
+type racingStorage struct {
+	*memory.InMemoryRepository
+	race func()
+}
+
+func (s *racingStorage) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	raw, err := s.InMemoryRepository.Get(ctx, prefix, key)
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return raw, err
+}
+
+func TestHandler_setProtectionConcurrentChange(t *testing.T) {
+	repository := &racingStorage{InMemoryRepository: memory.NewInMemoryRepository()}
+	svc := NewService(DefaultStoragePrefix, repository, nil)
+	require.NoError(t, svc.Create(context.Background(), &model.Kube{ID: "kube", Name: "prod"}))
+
+	repository.race = func() {
+		k, err := svc.Get(context.Background(), "kube")
+		require.NoError(t, err)
+		k.Nodes = map[string]*model.Machine{"node-1": {Name: "node-1"}}
+		require.NoError(t, svc.Create(context.Background(), k))
+	}
+
+	body, _ := json.Marshal(ProtectionRequest{Enabled: true})
+	req := httptest.NewRequest(http.MethodPut, "/kubes/kube/protection", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer alice")
+	rec := httptest.NewRecorder()
+	protectionRouter(svc).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	k, err := svc.Get(context.Background(), "kube")
+	require.NoError(t, err)
+	require.True(t, k.DeletionProtection, "protection must not be lost")
+	require.Contains(t, k.Nodes, "node-1", "the change of the task must not be lost")
+}
+
+func TestHandler_deleteProtectedKube(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		kube         *model.Kube
+		url          string
+		user         string
+		expectedCode int
+	}{
+		{
+			name:         "protected",
+			kube:         &model.Kube{ID: "kube", Name: "prod", DeletionProtection: true},
+			url:          "/kubes/kube?name=prod&reason=decommission",
+			user:         "bob",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "name mismatch",
+			kube:         &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "alice"},
+			url:          "/kubes/kube?name=staging&reason=decommission",
+			user:         "bob",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "no reason",
+			kube:         &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "alice"},
+			url:          "/kubes/kube?name=prod",
+			user:         "bob",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "same user",
+			kube:         &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "alice"},
+			url:          "/kubes/kube?name=prod&reason=decommission",
+			user:         "alice",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "confirmed",
+			kube:         &model.Kube{ID: "kube", Name: "prod", ProtectionClearedBy: "alice", ExternallyManaged: true},
+			url:          "/kubes/kube?name=prod&reason=decommission",
+			user:         "bob",
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(tc.kube, nil)
+		svc.On(serviceDelete, mock.Anything, "kube").Return(nil)
+
+		req := httptest.NewRequest(http.MethodDelete, tc.url, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.user)
+		rec := httptest.NewRecorder()
+		protectionRouter(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,342 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/asaskevich/govalidator.v8"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/timeconv"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+)
+
+// Outcomes of migrated releases.
+const (
+	MigrationInstalled = "installed"
+	MigrationFailed    = "failed"
+	MigrationSkipped   = "skipped"
+	MigrationExists    = "exists"
+)
+
+var ErrMigrationTarget = errors.New("releases are migrated to another operational cluster")
+
+// MigrationRequest replays deployed releases of a cluster onto the target one.
+// Empty Namespaces and Releases select all deployed releases.
+type MigrationRequest struct {
+	TargetID   string   `json:"targetId" valid:"required"`
+	Namespaces []string `json:"namespaces"`
+	Releases   []string `json:"releases"`
+	// DependsOn lists releases installed and ready before a release,
+	// releases providing crds are installed first anyway.
+	DependsOn map[string][]string `json:"dependsOn"`
+}
+
+// ReleaseOutcome is the result of migration of a single release.
+type ReleaseOutcome struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chartVersion"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
+// MigrationReport lists outcomes of releases in the order they were installed.
+type MigrationReport struct {
+	SourceID string           `json:"sourceId"`
+	TargetID string           `json:"targetId"`
+	Releases []ReleaseOutcome `json:"releases"`
+}
+
+// MigrateReleases captures charts and values of deployed releases of the
+// source cluster and installs them with the same names on the target cluster.
+// A failed release doesn't stop the migration, releases depending on it are skipped.
+func (s Service) MigrateReleases(ctx context.Context, kubeID string, req *MigrationRequest) (*MigrationReport, error) {
+	if req == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "migration request")
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+	if req.TargetID == kubeID {
+		return nil, ErrMigrationTarget
+	}
+
+	source, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get source kube")
+	}
+	target, err := s.Get(ctx, req.TargetID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get target kube")
+	}
+	if target.State != model.StateOperational {
+		return nil, errors.Wrapf(ErrMigrationTarget, "kube %s is %s", target.ID, target.State)
+	}
+
+	sourceProxy, err := s.helmClient(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "build source helm proxy")
+	}
+	targetProxy, err := s.helmClient(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "build target helm proxy")
+	}
+
+	captured, err := captureReleases(sourceProxy, req)
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := orderReleases(captured, req.DependsOn)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := listReleases(targetProxy, "", "", 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "list target releases")
+	}
+	installed := make(map[string]bool, len(existing))
+	for _, rls := range existing {
+		installed[rls.Name] = true
+	}
+
+	// releases others depend on are waited for to become ready
+	awaited := make(map[string]bool)
+	for _, deps := range req.DependsOn {
+		for _, dep := range deps {
+			awaited[dep] = true
+		}
+	}
+
+	report := &MigrationReport{
+		SourceID: source.ID,
+		TargetID: target.ID,
+		Releases: make([]ReleaseOutcome, 0, len(ordered)),
+	}
+	for _, rls := range ordered {
+		out := ReleaseOutcome{
+			Name:         rls.GetName(),
+			Namespace:    rls.GetNamespace(),
+			Chart:        rls.GetChart().GetMetadata().GetName(),
+			ChartVersion: rls.GetChart().GetMetadata().GetVersion(),
+		}
+
+		if installed[out.Name] {
+			out.Status = MigrationExists
+			report.Releases = append(report.Releases, out)
+			continue
+		}
+		if dep := missingDependency(req.DependsOn[out.Name], installed); dep != "" {
+			out.Status = MigrationSkipped
+			out.Error = "dependency " + dep + " is not installed"
+			report.Releases = append(report.Releases, out)
+			continue
+		}
+
+		wait := awaited[out.Name] || providesCRDs(rls)
+		err = s.helmOps.do(ctx, target.ID, HelmOpInstall, out.Name, func() error {
+			_, installErr := targetProxy.InstallReleaseFromChart(
+				rls.GetChart(),
+				out.Namespace,
+				helm.ReleaseName(out.Name),
+				helm.ValueOverrides([]byte(rls.GetConfig().GetRaw())),
+				helm.InstallWait(wait),
+				helm.InstallTimeout(releaseInstallTimeout),
+			)
+			return installErr
+		})
+		if err != nil {
+			logrus.Warnf("helm: migrate release %s from %s to %s: %v", out.Name, source.ID, target.ID, err)
+			out.Status = MigrationFailed
+			out.Error = err.Error()
+		} else {
+			out.Status = MigrationInstalled
+			installed[out.Name] = true
+		}
+		report.Releases = append(report.Releases, out)
+	}
+
+	return report, nil
+}
+
+// captureReleases returns content of deployed releases selected by the request.
+func captureReleases(kprx proxy.Interface, req *MigrationRequest) ([]*release.Release, error) {
+	res, err := kprx.ListReleases(helm.ReleaseListStatuses([]release.Status_Code{release.Status_DEPLOYED}))
+	if err != nil {
+		return nil, errors.Wrap(err, "list source releases")
+	}
+
+	namespaces := toSet(req.Namespaces)
+	names := toSet(req.Releases)
+	found := make(map[string]bool, len(names))
+	out := make([]*release.Release, 0, len(res.GetReleases()))
+	for _, rls := range res.GetReleases() {
+		if rls == nil {
+			continue
+		}
+		if len(namespaces) > 0 && !namespaces[rls.GetNamespace()] {
+			continue
+		}
+		if len(names) > 0 && !names[rls.GetName()] {
+			continue
+		}
+		found[rls.GetName()] = true
+
+		content, err := kprx.ReleaseContent(rls.GetName())
+		if err != nil {
+			return nil, errors.Wrapf(err, "get release %s", rls.GetName())
+		}
+		if content.GetRelease().GetChart() == nil {
+			return nil, errors.Errorf("release %s has no chart", rls.GetName())
+		}
+		out = append(out, content.GetRelease())
+	}
+
+	for _, name := range req.Releases {
+		if !found[name] {
+			return nil, errors.Wrapf(sgerrors.ErrNotFound, "deployed release %s", name)
+		}
+	}
+
+	return out, nil
+}
+
+// orderReleases sorts releases so dependencies come first, otherwise releases
+// providing crds go first and the rest keep the order they were deployed in.
+func orderReleases(releases []*release.Release, dependsOn map[string][]string) ([]*release.Release, error) {
+	sorted := make([]*release.Release, len(releases))
+	copy(sorted, releases)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ci, cj := providesCRDs(sorted[i]), providesCRDs(sorted[j])
+		if ci != cj {
+			return ci
+		}
+		ti := timeconv.Time(sorted[i].GetInfo().GetFirstDeployed())
+		tj := timeconv.Time(sorted[j].GetInfo().GetFirstDeployed())
+		return ti.Before(tj)
+	})
+
+	byName := make(map[string]*release.Release, len(sorted))
+	for _, rls := range sorted {
+		byName[rls.GetName()] = rls
+	}
+	for name, deps := range dependsOn {
+		if byName[name] == nil {
+			continue
+		}
+		for _, dep := range deps {
+			if byName[dep] == nil {
+				return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "release %s depends on %s that isn't migrated", name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(sorted))
+	out := make([]*release.Release, 0, len(sorted))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "dependency cycle %s",
+				strings.Join(append(path, name), " -> "))
+		}
+		state[name] = visiting
+		for _, dep := range dependsOn[name] {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		out = append(out, byName[name])
+		return nil
+	}
+
+	for _, rls := range sorted {
+		if err := visit(rls.GetName(), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// providesCRDs checks whether the release defines custom resources
+// other releases may use.
+func providesCRDs(rls *release.Release) bool {
+	for _, h := range rls.GetHooks() {
+		for _, e := range h.GetEvents() {
+			if e == release.Hook_CRD_INSTALL {
+				return true
+			}
+		}
+	}
+	return strings.Contains(rls.GetManifest(), "kind: CustomResourceDefinition")
+}
+
+func missingDependency(deps []string, installed map[string]bool) string {
+	for _, dep := range deps {
+		if !installed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+func toSet(items []string) map[string]bool {
+	out := make(map[string]bool, len(items))
+	for _, item := range items {
+		out[item] = true
+	}
+	return out
+}
+
+// migrateReleases replays releases of the cluster onto another one:
+// POST /kubes/{kubeID}/releases/migrate {"targetId":"new","dependsOn":{"app":["db"]}}
+func (h *Handler) migrateReleases(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := &MigrationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	report, err := h.svc.MigrateReleases(r.Context(), kubeID, req)
+	if err != nil {
+		switch errors.Cause(err) {
+		case sgerrors.ErrNotFound:
+			message.SendNotFound(w, kubeID, err)
+		case sgerrors.ErrInvalidJson, ErrMigrationTarget:
+			message.SendValidationFailed(w, err)
+		default:
+			logrus.Errorf("helm: migrate releases of %s: %s", kubeID, err)
+			message.SendUnknownError(w, err)
+		}
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logrus.Errorf("helm: migrate releases of %s: write response: %s", kubeID, err)
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,276 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+	"k8s.io/helm/pkg/timeconv"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+// migrationProxy keeps releases of a cluster and records installed charts.
+type migrationProxy struct {
+	proxy.Interface
+
+	releases  []*release.Release
+	installed []string
+	fail      map[string]bool
+}
+
+func (p *migrationProxy) ListReleases(opts ...helm.ReleaseListOption) (*services.ListReleasesResponse, error) {
+	return &services.ListReleasesResponse{Releases: p.releases}, nil
+}
+
+func (p *migrationProxy) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*services.GetReleaseContentResponse, error) {
+	for _, rls := range p.releases {
+		if rls.Name == rlsName {
+			return &services.GetReleaseContentResponse{Release: rls}, nil
+		}
+	}
+	return nil, errors.New("release not found")
+}
+
+func (p *migrationProxy) InstallReleaseFromChart(chrt *chart.Chart, namespace string, opts ...helm.InstallOption) (*services.InstallReleaseResponse, error) {
+	if p.fail[chrt.Metadata.Name] {
+		return nil, errors.New("install failed")
+	}
+	p.installed = append(p.installed, chrt.Metadata.Name)
+	return &services.InstallReleaseResponse{}, nil
+}
+
+// migratedRelease is named after its chart, so installations can be told apart.
+func migratedRelease(name string, deployed int, manifest string) *release.Release {
+	rls := chartRelease(name, name, "1.0.0")
+	rls.Namespace = "default"
+	rls.Manifest = manifest
+	rls.Config = &chart.Config{Raw: "replicas: 2"}
+	at := timeconv.Timestamp(time.Date(2019, 1, deployed, 0, 0, 0, 0, time.UTC))
+	rls.Info = &release.Info{
+		Status:        &release.Status{Code: release.Status_DEPLOYED},
+		FirstDeployed: at,
+		LastDeployed:  at,
+	}
+	return rls
+}
+
+func newMigrationService(t *testing.T, source, target *migrationProxy, targetState model.KubeState) Service {
+	repo := memory.NewInMemoryRepository()
+	for _, k := range []model.Kube{
+		{ID: "old", Name: "old", State: model.StateOperational},
+		{ID: "new", Name: "new", State: targetState},
+	} {
+		raw, err := json.Marshal(k)
+		require.NoError(t, err)
+		require.NoError(t, repo.Put(context.Background(), DefaultStoragePrefix, k.ID, raw))
+	}
+
+	return Service{
+		prefix:  DefaultStoragePrefix,
+		storage: repo,
+		helmOps: newHelmQueue(),
+		newHelmProxyFn: func(k *model.Kube) (proxy.Interface, error) {
+			if k.ID == "old" {
+				return source, nil
+			}
+			return target, nil
+		},
+	}
+}
+
+func TestService_MigrateReleases(t *testing.T) {
+	crd := "apiVersion: apiextensions.k8s.io/v1beta1\nkind: CustomResourceDefinition\n"
+
+	for _, tc := range []struct {
+		name             string
+		req              *MigrationRequest
+		targetState      model.KubeState
+		existing         []string
+		fail             map[string]bool
+		expectedErr      error
+		expectedInstalls []string
+		expectedStatuses map[string]string
+	}{
+		{
+			name:             "deployment order",
+			req:              &MigrationRequest{TargetID: "new"},
+			targetState:      model.StateOperational,
+			expectedInstalls: []string{"operator", "db", "app", "web"},
+		},
+		{
+			name: "dependencies",
+			req: &MigrationRequest{
+				TargetID:  "new",
+				DependsOn: map[string][]string{"db": {"web"}, "app": {"db"}},
+			},
+			targetState:      model.StateOperational,
+			expectedInstalls: []string{"operator", "web", "db", "app"},
+		},
+		{
+			name: "failed dependency",
+			req: &MigrationRequest{
+				TargetID:  "new",
+				DependsOn: map[string][]string{"app": {"db"}},
+			},
+			targetState:      model.StateOperational,
+			fail:             map[string]bool{"db": true},
+			expectedInstalls: []string{"operator", "web"},
+			expectedStatuses: map[string]string{
+				"operator": MigrationInstalled,
+				"db":       MigrationFailed,
+				"app":      MigrationSkipped,
+				"web":      MigrationInstalled,
+			},
+		},
+		{
+			name:             "existing releases",
+			req:              &MigrationRequest{TargetID: "new", Releases: []string{"db", "app"}},
+			targetState:      model.StateOperational,
+			existing:         []string{"db"},
+			expectedInstalls: []string{"app"},
+			expectedStatuses: map[string]string{
+				"db":  MigrationExists,
+				"app": MigrationInstalled,
+			},
+		},
+		{
+			name:        "unknown release",
+			req:         &MigrationRequest{TargetID: "new", Releases: []string{"cache"}},
+			targetState: model.StateOperational,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name: "dependency cycle",
+			req: &MigrationRequest{
+				TargetID:  "new",
+				DependsOn: map[string][]string{"db": {"app"}, "app": {"db"}},
+			},
+			targetState: model.StateOperational,
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "dependency isn't migrated",
+			req: &MigrationRequest{
+				TargetID:  "new",
+				Releases:  []string{"app"},
+				DependsOn: map[string][]string{"app": {"db"}},
+			},
+			targetState: model.StateOperational,
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "no target",
+			req:         &MigrationRequest{},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "same cluster",
+			req:         &MigrationRequest{TargetID: "old"},
+			expectedErr: ErrMigrationTarget,
+		},
+		{
+			name:        "target isn't operational",
+			req:         &MigrationRequest{TargetID: "new"},
+			targetState: model.StateProvisioning,
+			expectedErr: ErrMigrationTarget,
+		},
+	} {
+		source := &migrationProxy{
+			releases: []*release.Release{
+				migratedRelease("db", 2, ""),
+				migratedRelease("app", 3, ""),
+				migratedRelease("operator", 4, crd),
+				migratedRelease("web", 5, ""),
+			},
+		}
+		target := &migrationProxy{fail: tc.fail}
+		for _, name := range tc.existing {
+			target.releases = append(target.releases, migratedRelease(name, 1, ""))
+		}
+		svc := newMigrationService(t, source, target, tc.targetState)
+
+		report, err := svc.MigrateReleases(context.Background(), "old", tc.req)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if tc.expectedErr != nil {
+			continue
+		}
+
+		require.Equal(t, tc.expectedInstalls, target.installed, "TC: %s", tc.name)
+		for _, out := range report.Releases {
+			if expected, ok := tc.expectedStatuses[out.Name]; ok {
+				require.Equal(t, expected, out.Status, "TC: %s: %s", tc.name, out.Name)
+			}
+			require.Equal(t, "1.0.0", out.ChartVersion, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_migrateReleases(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid target",
+			body:         `{"targetId":"old"}`,
+			svcErr:       ErrMigrationTarget,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			body:         `{"targetId":"new"}`,
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "unknown error",
+			body:         `{"targetId":"new"}`,
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			body:         `{"targetId":"new"}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceMigrateReleases, mock.Anything, "old", &MigrationRequest{TargetID: "new"}).
+			Return(&MigrationReport{SourceID: "old", TargetID: "new"}, tc.svcErr)
+		svc.On(serviceMigrateReleases, mock.Anything, "old", &MigrationRequest{TargetID: "old"}).
+			Return(nil, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodPost, "/kubes/old/releases/migrate", bytes.NewBufferString(tc.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,219 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const reasonCrashLoopBackOff = "CrashLoopBackOff"
+
+// pods of releases are labeled by conventions of helm 2 and recommended labels
+var releaseLabels = []string{"release", "app.kubernetes.io/instance"}
+
+var metricsGroupVersion = schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+
+// PodResources is a resource usage of a pod of a release.
+type PodResources struct {
+	Name         string        `json:"name"`
+	Node         string        `json:"node,omitempty"`
+	Phase        string        `json:"phase"`
+	CPU          ResourceUsage `json:"cpu"`
+	Memory       ResourceUsage `json:"memory"`
+	Restarts     int32         `json:"restarts"`
+	CrashLooping bool          `json:"crashLooping"`
+}
+
+// ReleaseResourceReport sums requests and live usage of pods of a release.
+type ReleaseResourceReport struct {
+	KubeID    string    `json:"kubeId"`
+	Release   string    `json:"release"`
+	Namespace string    `json:"namespace"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	CPU    ResourceUsage  `json:"cpu"`
+	Memory ResourceUsage  `json:"memory"`
+	Pods   []PodResources `json:"pods"`
+	// CrashLoopingPods are names of pods which containers are restarted in a loop.
+	CrashLoopingPods []string `json:"crashLoopingPods"`
+	// UsageUnavailable is set when the cluster runs no metrics server,
+	// only requests are reported then.
+	UsageUnavailable bool `json:"usageUnavailable,omitempty"`
+}
+
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Containers []struct {
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// ReleaseResources builds a resource report of pods of the release, live
+// usage is taken from the metrics server of the cluster.
+func (s Service) ReleaseResources(ctx context.Context, kname, rlsName string) (*ReleaseResourceReport, error) {
+	if s.corev1ClientFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "corev1client builder")
+	}
+
+	rls, err := s.ReleaseDetails(ctx, kname, rlsName)
+	if err != nil {
+		return nil, err
+	}
+	if rls == nil {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "release %s", rlsName)
+	}
+
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return nil, err
+	}
+	kclient, err := s.corev1ClientFn(k)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]corev1.Pod, 0)
+	seen := make(map[string]bool)
+	for _, label := range releaseLabels {
+		list, err := kclient.Pods(rls.Namespace).List(metav1.ListOptions{
+			LabelSelector: label + "=" + rlsName,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "list pods")
+		}
+		for _, pod := range list.Items {
+			if !seen[pod.Name] {
+				seen[pod.Name] = true
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	usage, err := s.podUsage(k, rls.Namespace)
+	if err != nil {
+		logrus.Debugf("release %s of cluster %s: pod metrics: %v", rlsName, kname, err)
+	}
+
+	report := buildReleaseResources(k, rlsName, rls.Namespace, pods, usage)
+	report.UsageUnavailable = err != nil
+
+	return report, nil
+}
+
+// podUsage returns usage of pods of the namespace by pod name.
+func (s Service) podUsage(k *model.Kube, ns string) (map[string]corev1.ResourceList, error) {
+	if s.clientForGroupFn == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "group client builder")
+	}
+	client, err := s.clientForGroupFn(k, metricsGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := client.Get().Namespace(ns).Resource("pods").DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	list := podMetricsList{}
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.Wrap(err, "decode pod metrics")
+	}
+
+	usage := make(map[string]corev1.ResourceList, len(list.Items))
+	for _, item := range list.Items {
+		total := corev1.ResourceList{}
+		for _, c := range item.Containers {
+			addResources(total, c.Usage)
+		}
+		usage[item.Metadata.Name] = total
+	}
+
+	return usage, nil
+}
+
+func buildReleaseResources(k *model.Kube, rlsName, ns string, pods []corev1.Pod, usage map[string]corev1.ResourceList) *ReleaseResourceReport {
+	report := &ReleaseResourceReport{
+		KubeID:           k.ID,
+		Release:          rlsName,
+		Namespace:        ns,
+		CreatedAt:        time.Now(),
+		Pods:             make([]PodResources, 0, len(pods)),
+		CrashLoopingPods: make([]string, 0),
+	}
+
+	for _, pod := range pods {
+		reqs := podRequests(pod)
+		info := PodResources{
+			Name:  pod.Name,
+			Node:  pod.Spec.NodeName,
+			Phase: string(pod.Status.Phase),
+			CPU: ResourceUsage{
+				Requested: requestedValue(reqs, corev1.ResourceCPU),
+				Used:      requestedValue(usage[pod.Name], corev1.ResourceCPU),
+			},
+			Memory: ResourceUsage{
+				Requested: requestedValue(reqs, corev1.ResourceMemory),
+				Used:      requestedValue(usage[pod.Name], corev1.ResourceMemory),
+			},
+		}
+		for _, st := range pod.Status.ContainerStatuses {
+			info.Restarts += st.RestartCount
+			if st.State.Waiting != nil && st.State.Waiting.Reason == reasonCrashLoopBackOff {
+				info.CrashLooping = true
+			}
+		}
+		if info.CrashLooping {
+			report.CrashLoopingPods = append(report.CrashLoopingPods, pod.Name)
+		}
+
+		report.CPU.Requested += info.CPU.Requested
+		report.CPU.Used += info.CPU.Used
+		report.Memory.Requested += info.Memory.Requested
+		report.Memory.Used += info.Memory.Used
+		report.Pods = append(report.Pods, info)
+	}
+
+	sort.Slice(report.Pods, func(i, j int) bool {
+		return report.Pods[i].Name < report.Pods[j].Name
+	})
+	sort.Strings(report.CrashLoopingPods)
+
+	return report
+}
+
+func (h *Handler) getReleaseResources(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID := vars["kubeID"]
+	rlsName := vars["releaseName"]
+
+	report, err := h.svc.ReleaseResources(r.Context(), kubeID, rlsName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, rlsName, err)
+			return
+		}
+		logrus.Errorf("helm: get %s release resources: %s cluster: %s", rlsName, kubeID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
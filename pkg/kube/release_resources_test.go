@@ -0,0 +1,177 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/sghelm/proxy"
+)
+
+func releasePod(name string, restarts int32, waiting string) corev1.Pod {
+	pod := capacityPod("node", corev1.PodRunning, "100m", "64Mi")
+	pod.Name = name
+	pod.Labels = map[string]string{"release": "web"}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{RestartCount: restarts}}
+	if waiting != "" {
+		pod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{Reason: waiting}
+	}
+	return pod
+}
+
+func TestBuildReleaseResources(t *testing.T) {
+	pods := []corev1.Pod{
+		releasePod("web-2", 7, reasonCrashLoopBackOff),
+		releasePod("web-1", 0, ""),
+	}
+	usage := map[string]corev1.ResourceList{
+		"web-1": capacityPod("", "", "20m", "32Mi").Spec.Containers[0].Resources.Requests,
+	}
+
+	report := buildReleaseResources(&model.Kube{ID: "kube"}, "web", "default", pods, usage)
+
+	require.Equal(t, "web", report.Release)
+	require.Equal(t, ResourceUsage{Requested: 200, Used: 20}, report.CPU)
+	require.Equal(t, ResourceUsage{Requested: 128 << 20, Used: 32 << 20}, report.Memory)
+	require.Len(t, report.Pods, 2)
+	require.Equal(t, "web-1", report.Pods[0].Name)
+	require.Equal(t, int32(7), report.Pods[1].Restarts)
+	require.Equal(t, []string{"web-2"}, report.CrashLoopingPods)
+}
+
+func TestService_ReleaseResources(t *testing.T) {
+	metrics := newFakeAPIServer(t, map[string]string{
+		"/apis/metrics.k8s.io/v1beta1/namespaces/apps/pods": `{"items": [
+			{"metadata": {"name": "web-1"}, "containers": [{"usage": {"cpu": "10m", "memory": "1Mi"}},
+				{"usage": {"cpu": "5m", "memory": "1Mi"}}]}
+		]}`,
+	})
+	defer metrics.Close()
+	noMetrics := newFakeAPIServer(t, map[string]string{})
+	defer noMetrics.Close()
+
+	for _, tc := range []struct {
+		name    string
+		helmErr error
+		metrics *fakeAPIServer
+
+		expectedErr         error
+		expectedUsed        int64
+		expectedUnavailable bool
+	}{
+		{
+			name:        "helm error",
+			helmErr:     errFake,
+			expectedErr: errFake,
+		},
+		{
+			name:         "usage",
+			metrics:      metrics,
+			expectedUsed: 15,
+		},
+		{
+			name:                "no metrics server",
+			metrics:             noMetrics,
+			expectedUnavailable: true,
+		},
+	} {
+		selectors := make([]string, 0)
+		svc := Service{
+			storage: kubeStorage(&model.Kube{ID: "kube"}),
+			newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+				return &fakeHelmProxy{
+					err: tc.helmErr,
+					getReleaseResp: &services.GetReleaseContentResponse{
+						Release: &release.Release{Name: "web", Namespace: "apps"},
+					},
+				}, nil
+			},
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				cl := &fakev1client.FakeCoreV1{
+					Fake: &kubetesting.Fake{},
+				}
+				cl.AddReactor("list", "pods",
+					func(action kubetesting.Action) (bool, runtime.Object, error) {
+						selectors = append(selectors, action.(kubetesting.ListAction).GetListRestrictions().Labels.String())
+						return true, &corev1.PodList{
+							Items: []corev1.Pod{releasePod("web-1", 0, "")},
+						}, nil
+					})
+				return cl, nil
+			},
+			clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": tc.metrics}),
+		}
+
+		report, err := svc.ReleaseResources(context.Background(), "kube", "web")
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Equal(t, []string{"release=web", "app.kubernetes.io/instance=web"}, selectors, "TC: %s", tc.name)
+		require.Equal(t, "apps", report.Namespace, "TC: %s", tc.name)
+		require.Len(t, report.Pods, 1, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedUsed, report.CPU.Used, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedUnavailable, report.UsageUnavailable, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getReleaseResources(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "ok",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("ReleaseResources", mock.Anything, "kube", "web").
+			Return(&ReleaseResourceReport{Release: "web"}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/releases/web/resources", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		report := &ReleaseResourceReport{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(report))
+		require.Equal(t, "web", report.Release)
+	}
+}
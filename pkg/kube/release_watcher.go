@@ -0,0 +1,175 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/notification"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// DefaultPendingThreshold is how long a release may stay pending before it's reported.
+const DefaultPendingThreshold = time.Minute * 15
+
+type releaseState struct {
+	status   string
+	since    time.Time
+	notified bool
+}
+
+// ReleaseWatcher periodically reconciles release statuses of operational clusters
+// of all tenants and publishes events when a release fails or is stuck in a pending state.
+type ReleaseWatcher struct {
+	svc       Interface
+	publisher notification.Publisher
+
+	interval         time.Duration
+	pendingThreshold time.Duration
+
+	// release states by kube id and release name
+	states map[string]map[string]*releaseState
+	nowFn  func() time.Time
+}
+
+// NewReleaseWatcher constructs a ReleaseWatcher.
+func NewReleaseWatcher(svc Interface, publisher notification.Publisher,
+	interval, pendingThreshold time.Duration) *ReleaseWatcher {
+	if pendingThreshold <= 0 {
+		pendingThreshold = DefaultPendingThreshold
+	}
+
+	return &ReleaseWatcher{
+		svc:              svc,
+		publisher:        publisher,
+		interval:         interval,
+		pendingThreshold: pendingThreshold,
+		states:           make(map[string]map[string]*releaseState),
+		nowFn:            time.Now,
+	}
+}
+
+// Run blocks and checks releases every interval until ctx is cancelled.
+func (w *ReleaseWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.reconcile(ctx)
+		}
+	}
+}
+
+func (w *ReleaseWatcher) reconcile(ctx context.Context) {
+	kubes, err := w.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("release watcher: list kubes: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool, len(kubes))
+	for _, k := range kubes {
+		ctx := tenant.WithID(ctx, k.TenantID)
+		if k.State != model.StateOperational {
+			continue
+		}
+		seen[k.ID] = true
+		// states are kept, so releases aren't reported as changed afterwards
+		if k.InMaintenance() {
+			continue
+		}
+
+		releases, err := w.svc.ListReleases(ctx, k.ID, "", "", 0)
+		if err != nil {
+			// keep the previous states, tiller may be temporary unavailable
+			logrus.Warnf("release watcher: cluster %s: %v", k.ID, err)
+			continue
+		}
+
+		w.check(ctx, k, releases)
+	}
+
+	for kubeID := range w.states {
+		if !seen[kubeID] {
+			delete(w.states, kubeID)
+		}
+	}
+}
+
+func (w *ReleaseWatcher) check(ctx context.Context, k model.Kube, releases []*model.ReleaseInfo) {
+	now := w.nowFn()
+	prev := w.states[k.ID]
+	states := make(map[string]*releaseState, len(releases))
+
+	for _, rls := range releases {
+		state := prev[rls.Name]
+		if state == nil || state.status != rls.Status {
+			if state != nil && state.notified && rls.Status == release.Status_DEPLOYED.String() {
+				w.publish(ctx, k, rls, notification.EventReleaseRecovered,
+					fmt.Sprintf("release %s is deployed again", rls.Name))
+			}
+			state = &releaseState{
+				status: rls.Status,
+				since:  now,
+			}
+		}
+		states[rls.Name] = state
+
+		if state.notified {
+			continue
+		}
+
+		switch {
+		case rls.Status == release.Status_FAILED.String():
+			w.publish(ctx, k, rls, notification.EventReleaseFailed,
+				fmt.Sprintf("release %s has failed", rls.Name))
+			state.notified = true
+		case isPending(rls.Status) && now.Sub(state.since) >= w.pendingThreshold:
+			w.publish(ctx, k, rls, notification.EventReleasePending,
+				fmt.Sprintf("release %s is %s for %s", rls.Name,
+					strings.ToLower(rls.Status), now.Sub(state.since).Round(time.Second)))
+			state.notified = true
+		}
+	}
+
+	w.states[k.ID] = states
+}
+
+func (w *ReleaseWatcher) publish(ctx context.Context, k model.Kube, rls *model.ReleaseInfo, eventType, msg string) {
+	err := w.publisher.Publish(ctx, notification.Event{
+		Type:     eventType,
+		KubeID:   k.ID,
+		KubeName: k.Name,
+		Message:  msg,
+		Details: map[string]string{
+			"release":      rls.Name,
+			"namespace":    rls.Namespace,
+			"chart":        rls.Chart,
+			"chartVersion": rls.ChartVersion,
+			"status":       rls.Status,
+		},
+		CreatedAt: w.nowFn(),
+	})
+	if err != nil {
+		logrus.Errorf("release watcher: cluster %s: publish %s: %v", k.ID, eventType, err)
+	}
+}
+
+func isPending(status string) bool {
+	switch status {
+	case release.Status_PENDING_INSTALL.String(),
+		release.Status_PENDING_UPGRADE.String(),
+		release.Status_PENDING_ROLLBACK.String():
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/notification"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type fakePublisher struct {
+	events  []notification.Event
+	tenants []string
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, e notification.Event) error {
+	f.events = append(f.events, e)
+	f.tenants = append(f.tenants, tenant.FromContext(ctx))
+	return nil
+}
+
+func TestReleaseWatcher_Reconcile(t *testing.T) {
+	now := time.Now()
+	releases := []*model.ReleaseInfo{
+		{Name: "web", Status: "DEPLOYED"},
+		{Name: "db", Status: "FAILED"},
+		{Name: "cache", Status: "PENDING_INSTALL"},
+	}
+
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{
+		{ID: "kube", TenantID: "acme", State: model.StateOperational},
+		{ID: "new", State: model.StateProvisioning},
+	}, nil)
+	svc.rlsInfoList = releases
+
+	publisher := &fakePublisher{}
+	w := NewReleaseWatcher(svc, publisher, time.Minute, time.Minute*10)
+	w.nowFn = func() time.Time { return now }
+
+	w.reconcile(context.Background())
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, notification.EventReleaseFailed, publisher.events[0].Type)
+	require.Equal(t, "db", publisher.events[0].Details["release"])
+	require.Equal(t, []string{"acme"}, publisher.tenants)
+
+	// failed release is reported once, pending one is below the threshold
+	now = now.Add(time.Minute * 5)
+	w.reconcile(context.Background())
+	require.Len(t, publisher.events, 1)
+
+	now = now.Add(time.Minute * 5)
+	w.reconcile(context.Background())
+	require.Len(t, publisher.events, 2)
+	require.Equal(t, notification.EventReleasePending, publisher.events[1].Type)
+	require.Equal(t, "cache", publisher.events[1].Details["release"])
+
+	releases[1].Status = "DEPLOYED"
+	w.reconcile(context.Background())
+	require.Len(t, publisher.events, 3)
+	require.Equal(t, notification.EventReleaseRecovered, publisher.events[2].Type)
+	require.Equal(t, "db", publisher.events[2].Details["release"])
+
+	// listing error keeps the states
+	svc.rlsErr = errFake
+	w.reconcile(context.Background())
+	require.Len(t, w.states["kube"], 3)
+	require.Len(t, publisher.events, 3)
+}
+
+func TestReleaseWatcher_ForgetsDeletedClusters(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{}, nil)
+
+	w := NewReleaseWatcher(svc, &fakePublisher{}, time.Minute, 0)
+	w.states["deleted"] = map[string]*releaseState{"web": {status: "FAILED"}}
+
+	w.reconcile(context.Background())
+
+	require.Empty(t, w.states)
+	require.Equal(t, DefaultPendingThreshold, w.pendingThreshold)
+}
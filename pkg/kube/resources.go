@@ -0,0 +1,253 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+var patchTypes = map[types.PatchType]bool{
+	types.JSONPatchType:           true,
+	types.MergePatchType:          true,
+	types.StrategicMergePatchType: true,
+}
+
+// resourceClient returns a client of the api group the resource is served by.
+func (s Service) resourceClient(ctx context.Context, kubeID, resource string) (rest.Interface, error) {
+	kube, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube")
+	}
+
+	resourcesInfo, err := s.resourcesGroupInfo(kube)
+	if err != nil {
+		return nil, err
+	}
+
+	gv, ok := resourcesInfo[resource]
+	if !ok {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "resource %s", resource)
+	}
+
+	client, err := s.clientForGroupFn(kube, gv)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube client")
+	}
+	return client, nil
+}
+
+// PostKubeResource creates an object of the resource from a json or yaml
+// manifest, the namespace of the manifest is used when ns is empty.
+func (s Service) PostKubeResource(ctx context.Context, kubeID, resource, ns string, manifest []byte) ([]byte, error) {
+	body, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "manifest: %v", err)
+	}
+	obj := struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}{}
+	if err = json.Unmarshal(body, &obj); err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "manifest: %v", err)
+	}
+	if ns == "" {
+		ns = obj.Metadata.Namespace
+	}
+
+	client, err := s.resourceClient(ctx, kubeID, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := inNamespace(client.Post(), ns).Resource(resource).Body(body).DoRaw()
+	if err != nil {
+		return nil, resourceError(err, "create %s", resource)
+	}
+	return raw, nil
+}
+
+// PatchKubeResource applies a json, merge or strategic merge patch to the
+// object, the patch may be written in yaml.
+func (s Service) PatchKubeResource(ctx context.Context, kubeID, resource, ns, name string,
+	patchType types.PatchType, patch []byte) ([]byte, error) {
+	if !patchTypes[patchType] {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "patch type %q", patchType)
+	}
+	body, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "patch: %v", err)
+	}
+
+	client, err := s.resourceClient(ctx, kubeID, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := inNamespace(client.Patch(patchType), ns).Resource(resource).Name(name).Body(body).DoRaw()
+	if err != nil {
+		return nil, resourceError(err, "patch %s %s", resource, name)
+	}
+	return raw, nil
+}
+
+// DeleteKubeResource deletes the object, dependents are deleted in background.
+func (s Service) DeleteKubeResource(ctx context.Context, kubeID, resource, ns, name string) error {
+	client, err := s.resourceClient(ctx, kubeID, resource)
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	body, err := json.Marshal(&metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return errors.Wrap(err, "marshal delete options")
+	}
+
+	_, err = inNamespace(client.Delete(), ns).Resource(resource).Name(name).Body(body).DoRaw()
+	if err != nil {
+		return resourceError(err, "delete %s %s", resource, name)
+	}
+	return nil
+}
+
+// resourceError turns api server responses into errors handlers tell apart.
+// isGone tells whether the continue token of a list has expired, raw
+// responses don't carry the reason so the status code is checked.
+func isGone(err error) bool {
+	s, ok := err.(k8serrors.APIStatus)
+	return ok && s.Status().Code == http.StatusGone
+}
+
+func resourceError(err error, format string, args ...interface{}) error {
+	switch {
+	case k8serrors.IsNotFound(err):
+		err = errors.Wrap(sgerrors.ErrNotFound, err.Error())
+	case k8serrors.IsAlreadyExists(err), k8serrors.IsConflict(err):
+		err = errors.Wrap(sgerrors.ErrAlreadyExists, err.Error())
+	case k8serrors.IsInvalid(err), k8serrors.IsBadRequest(err), isGone(err):
+		err = errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// listOptions reads selectors and paging of a collection from the query:
+// ?labelSelector=app=web&fieldSelector=status.phase=Running&limit=100&continue=<token>
+func listOptions(q url.Values) (metav1.ListOptions, error) {
+	opts := metav1.ListOptions{
+		LabelSelector: q.Get("labelSelector"),
+		FieldSelector: q.Get("fieldSelector"),
+		Continue:      q.Get("continue"),
+	}
+	if _, err := labels.Parse(opts.LabelSelector); err != nil {
+		return opts, errors.Wrapf(sgerrors.ErrInvalidJson, "label selector: %v", err)
+	}
+	if _, err := fields.ParseSelector(opts.FieldSelector); err != nil {
+		return opts, errors.Wrapf(sgerrors.ErrInvalidJson, "field selector: %v", err)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return opts, errors.Wrapf(sgerrors.ErrInvalidJson, "limit %q", v)
+		}
+		opts.Limit = n
+	}
+	return opts, nil
+}
+
+func sendResourceError(w http.ResponseWriter, entity string, err error) {
+	switch errors.Cause(err) {
+	case sgerrors.ErrNotFound:
+		message.SendNotFound(w, entity, err)
+	case sgerrors.ErrAlreadyExists:
+		message.SendAlreadyExists(w, entity, err)
+	case sgerrors.ErrInvalidJson:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
+
+// createResource creates an object from the manifest of the body:
+// POST /kubes/{kubeID}/resources/{resource}?namespace=default
+func (h *Handler) createResource(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, rs := vars["kubeID"], vars["resource"]
+
+	manifest, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	raw, err := h.svc.PostKubeResource(r.Context(), kubeID, rs, r.URL.Query().Get("namespace"), manifest)
+	if err != nil {
+		logrus.Errorf("kube %s: create %s: %v", kubeID, rs, err)
+		sendResourceError(w, rs, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if _, err = w.Write(raw); err != nil {
+		logrus.Errorf("kube %s: create %s: write response: %v", kubeID, rs, err)
+	}
+}
+
+// patchResource patches the object, the patch type is taken from the content type:
+// PATCH /kubes/{kubeID}/resources/{resource}/{name}?namespace=default
+func (h *Handler) patchResource(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, rs, name := vars["kubeID"], vars["resource"], vars["name"]
+
+	patchType := types.PatchType(r.Header.Get("Content-Type"))
+	if !patchTypes[patchType] {
+		patchType = types.MergePatchType
+	}
+
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	raw, err := h.svc.PatchKubeResource(r.Context(), kubeID, rs, r.URL.Query().Get("namespace"), name, patchType, patch)
+	if err != nil {
+		logrus.Errorf("kube %s: patch %s %s: %v", kubeID, rs, name, err)
+		sendResourceError(w, name, err)
+		return
+	}
+
+	if _, err = w.Write(raw); err != nil {
+		logrus.Errorf("kube %s: patch %s %s: write response: %v", kubeID, rs, name, err)
+	}
+}
+
+// deleteResource deletes the object:
+// DELETE /kubes/{kubeID}/resources/{resource}/{name}?namespace=default
+func (h *Handler) deleteResource(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, rs, name := vars["kubeID"], vars["resource"], vars["name"]
+
+	if err := h.svc.DeleteKubeResource(r.Context(), kubeID, rs, r.URL.Query().Get("namespace"), name); err != nil {
+		logrus.Errorf("kube %s: delete %s %s: %v", kubeID, rs, name, err)
+		sendResourceError(w, name, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,379 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const configMapsPath = "/api/v1/namespaces/default/configmaps"
+
+// fakeResourceServer keeps config maps of the default namespace by name.
+func fakeResourceServer(t *testing.T, objects map[string]string) *fakeAPIServer {
+	f := &fakeAPIServer{objects: objects}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := func(code int, reason metav1.StatusReason) {
+			w.WriteHeader(code)
+			require.NoError(t, json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   reason,
+				Code:     int32(code),
+			}))
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		switch r.Method {
+		case http.MethodGet:
+			// collections echo the list options they have been requested with
+			if r.URL.Query().Get("continue") == "expired" {
+				status(http.StatusGone, metav1.StatusReasonExpired)
+				return
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(r.URL.Query()))
+		case http.MethodPost:
+			obj := struct {
+				Metadata metav1.ObjectMeta `json:"metadata"`
+			}{}
+			require.NoError(t, json.Unmarshal(body, &obj))
+			path := r.URL.Path + "/" + obj.Metadata.Name
+			if _, ok := f.objects[path]; ok {
+				status(http.StatusConflict, metav1.StatusReasonAlreadyExists)
+				return
+			}
+			f.objects[path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+		case http.MethodPatch:
+			if _, ok := f.objects[r.URL.Path]; !ok {
+				status(http.StatusNotFound, metav1.StatusReasonNotFound)
+				return
+			}
+			require.Equal(t, string(types.StrategicMergePatchType), r.Header.Get("Content-Type"))
+			f.objects[r.URL.Path] = string(body)
+			_, _ = w.Write(body)
+		case http.MethodDelete:
+			if _, ok := f.objects[r.URL.Path]; !ok {
+				status(http.StatusNotFound, metav1.StatusReasonNotFound)
+				return
+			}
+			delete(f.objects, r.URL.Path)
+			_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+		}
+	}))
+
+	return f
+}
+
+func resourceService(t *testing.T) (Service, *fakeAPIServer) {
+	srv := fakeResourceServer(t, map[string]string{
+		configMapsPath + "/existing": `{"metadata":{"name":"existing","namespace":"default"}}`,
+	})
+	return Service{
+		storage: kubeStorage(&model.Kube{ID: "kube"}),
+		discoveryClientFn: func(k *model.Kube) (ServerResourceGetter, error) {
+			return &mockServerResourceGetter{
+				resources: []*metav1.APIResourceList{
+					{
+						GroupVersion: "v1",
+						APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap"}},
+					},
+				},
+			}, nil
+		},
+		clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": srv}),
+	}, srv
+}
+
+func TestService_PostKubeResource(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		resource    string
+		manifest    string
+		expectedErr error
+	}{
+		{
+			name:        "invalid manifest",
+			resource:    "configmaps",
+			manifest:    "data: [",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown resource",
+			resource:    "widgets",
+			manifest:    `{"metadata":{"name":"new"}}`,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "exists",
+			resource:    "configmaps",
+			manifest:    `{"metadata":{"name":"existing","namespace":"default"}}`,
+			expectedErr: sgerrors.ErrAlreadyExists,
+		},
+		{
+			name:     "yaml",
+			resource: "configmaps",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\n  namespace: default\ndata:\n  key: value\n",
+		},
+	} {
+		svc, srv := resourceService(t)
+
+		raw, err := svc.PostKubeResource(context.Background(), "kube", tc.resource, "", []byte(tc.manifest))
+		srv.Close()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.JSONEq(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"new","namespace":"default"},"data":{"key":"value"}}`,
+			string(raw), "TC: %s", tc.name)
+		require.Contains(t, srv.objects, configMapsPath+"/new", "TC: %s", tc.name)
+	}
+}
+
+func TestService_PatchKubeResource(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		objName     string
+		patchType   types.PatchType
+		expectedErr error
+	}{
+		{
+			name:        "patch type",
+			objName:     "existing",
+			patchType:   "text/plain",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "not found",
+			objName:     "missing",
+			patchType:   types.StrategicMergePatchType,
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:      "ok",
+			objName:   "existing",
+			patchType: types.StrategicMergePatchType,
+		},
+	} {
+		svc, srv := resourceService(t)
+
+		raw, err := svc.PatchKubeResource(context.Background(), "kube", "configmaps", "default", tc.objName,
+			tc.patchType, []byte("data:\n  key: value\n"))
+		srv.Close()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err == nil {
+			require.JSONEq(t, `{"data":{"key":"value"}}`, string(raw), "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestService_DeleteKubeResource(t *testing.T) {
+	svc, srv := resourceService(t)
+	defer srv.Close()
+
+	err := svc.DeleteKubeResource(context.Background(), "kube", "configmaps", "default", "missing")
+	require.Equal(t, sgerrors.ErrNotFound, errors.Cause(err))
+
+	require.NoError(t, svc.DeleteKubeResource(context.Background(), "kube", "configmaps", "default", "existing"))
+	require.NotContains(t, srv.objects, configMapsPath+"/existing")
+
+	svc.storage = storage.Interface(kubeStorage())
+	err = svc.DeleteKubeResource(context.Background(), "kube", "configmaps", "default", "existing")
+	require.Equal(t, sgerrors.ErrNotFound, errors.Cause(err))
+}
+
+func TestService_GetKubeResources_listOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		opts        metav1.ListOptions
+		expectedErr error
+		expected    string
+	}{
+		{
+			name: "selectors",
+			opts: metav1.ListOptions{
+				LabelSelector: "app=web",
+				FieldSelector: "metadata.name!=existing",
+				Limit:         10,
+				Continue:      "token",
+			},
+			expected: `{"labelSelector":["app=web"],"fieldSelector":["metadata.name!=existing"],"limit":["10"],"continue":["token"]}`,
+		},
+		{
+			name:     "none",
+			expected: `{}`,
+		},
+		{
+			name:        "expired token",
+			opts:        metav1.ListOptions{Continue: "expired"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+	} {
+		svc, srv := resourceService(t)
+
+		raw, err := svc.GetKubeResources(context.Background(), "kube", "configmaps", "default", "", tc.opts)
+		srv.Close()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err == nil {
+			require.JSONEq(t, tc.expected, string(raw), "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_getResourceListOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+
+		expectedOpts metav1.ListOptions
+		expectedCode int
+	}{
+		{
+			name:         "label selector",
+			query:        "labelSelector=app%20in%20(web",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "field selector",
+			query:        "fieldSelector=status.phase",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "limit",
+			query:        "limit=-1",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:  "ok",
+			query: "namespace=default&labelSelector=app%3Dweb&fieldSelector=status.phase%3DRunning&limit=50&continue=token",
+			expectedOpts: metav1.ListOptions{
+				LabelSelector: "app=web",
+				FieldSelector: "status.phase=Running",
+				Limit:         50,
+				Continue:      "token",
+			},
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGetKubeResources, mock.Anything, "kube", "pods", mock.Anything, "", tc.expectedOpts).
+			Return([]byte("{}"), nil)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/resources/pods?"+tc.query, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_resources(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		method string
+		url    string
+		header string
+		setup  func(svc *kubeServiceMock)
+
+		expectedCode int
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			url:    "/kubes/kube/resources/configmaps?namespace=default",
+			setup: func(svc *kubeServiceMock) {
+				svc.On(servicePostKubeResource, mock.Anything, "kube", "configmaps", "default", []byte("manifest")).
+					Return([]byte("{}"), nil)
+			},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:   "create exists",
+			method: http.MethodPost,
+			url:    "/kubes/kube/resources/configmaps",
+			setup: func(svc *kubeServiceMock) {
+				svc.On(servicePostKubeResource, mock.Anything, "kube", "configmaps", "", []byte("manifest")).
+					Return(nil, errors.Wrap(sgerrors.ErrAlreadyExists, "create configmaps"))
+			},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:   "patch",
+			method: http.MethodPatch,
+			url:    "/kubes/kube/resources/configmaps/existing?namespace=default",
+			header: string(types.JSONPatchType),
+			setup: func(svc *kubeServiceMock) {
+				svc.On(servicePatchKubeResource, mock.Anything, "kube", "configmaps", "default", "existing",
+					types.JSONPatchType, []byte("manifest")).Return([]byte("{}"), nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "patch invalid",
+			method: http.MethodPatch,
+			url:    "/kubes/kube/resources/configmaps/existing",
+			setup: func(svc *kubeServiceMock) {
+				svc.On(servicePatchKubeResource, mock.Anything, "kube", "configmaps", "", "existing",
+					types.MergePatchType, []byte("manifest")).
+					Return(nil, errors.Wrap(sgerrors.ErrInvalidJson, "patch"))
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			url:    "/kubes/kube/resources/configmaps/existing?namespace=default",
+			setup: func(svc *kubeServiceMock) {
+				svc.On(serviceDeleteKubeResource, mock.Anything, "kube", "configmaps", "default", "existing").
+					Return(nil)
+			},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:   "delete not found",
+			method: http.MethodDelete,
+			url:    "/kubes/kube/resources/configmaps/missing",
+			setup: func(svc *kubeServiceMock) {
+				svc.On(serviceDeleteKubeResource, mock.Anything, "kube", "configmaps", "", "missing").
+					Return(errors.Wrap(sgerrors.ErrNotFound, "delete"))
+			},
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		tc.setup(svc)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(tc.method, tc.url, bytes.NewBufferString("manifest"))
+		if tc.header != "" {
+			req.Header.Set("Content-Type", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
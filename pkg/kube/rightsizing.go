@@ -0,0 +1,412 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+)
+
+const (
+	DefaultRightSizingPrefix = "/supergiant/rightsizing/"
+	DefaultRightSizingWindow = time.Hour * 24
+
+	prometheusProxyPath = "api/v1/namespaces/default/services/prometheus-operated:9090/proxy"
+
+	// namespace is overprovisioned when it uses less than this percentage of requests
+	overprovisionedThreshold = 50
+	// recommended requests leave this percentage of headroom above usage
+	recommendationHeadroom = 20
+	// node is idle when pods request less than this percentage of its resources
+	idleNodeThreshold = 20
+)
+
+const (
+	RecommendationNamespace = "namespace"
+	RecommendationNode      = "node"
+)
+
+// ResourceUsage compares requested resource to the actual usage.
+// CPU values are in millicores, memory values are in bytes.
+type ResourceUsage struct {
+	Requested int64 `json:"requested"`
+	Used      int64 `json:"used"`
+}
+
+// NamespaceUsage is a resource usage of all pods in a namespace.
+type NamespaceUsage struct {
+	Namespace string        `json:"namespace"`
+	CPU       ResourceUsage `json:"cpu"`
+	Memory    ResourceUsage `json:"memory"`
+}
+
+// Recommendation describes an action that reduces unused capacity.
+type Recommendation struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+
+	// Suggested requests for overprovisioned namespace
+	CPU    int64 `json:"cpu,omitempty"`
+	Memory int64 `json:"memory,omitempty"`
+}
+
+// RightSizingReport is a result of cluster resource usage analysis.
+type RightSizingReport struct {
+	KubeID    string    `json:"kubeId"`
+	CreatedAt time.Time `json:"createdAt"`
+	Window    string    `json:"window"`
+
+	Namespaces      []NamespaceUsage `json:"namespaces"`
+	IdleNodes       []string         `json:"idleNodes"`
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+// RightSizer periodically compares pod requests to the actual usage
+// reported by prometheus and stores right-sizing recommendations.
+type RightSizer struct {
+	svc      Interface
+	repo     storage.Interface
+	prefix   string
+	window   time.Duration
+	interval time.Duration
+
+	corev1ClientFn func(k *model.Kube) (corev1client.CoreV1Interface, error)
+	getMetrics     func(string, *model.Kube) (*MetricResponse, error)
+}
+
+// NewRightSizer constructs a RightSizer that analyzes usage over the window every interval.
+func NewRightSizer(svc Interface, repo storage.Interface, window, interval time.Duration) *RightSizer {
+	if window <= 0 {
+		window = DefaultRightSizingWindow
+	}
+
+	return &RightSizer{
+		svc:            svc,
+		repo:           repo,
+		prefix:         DefaultRightSizingPrefix,
+		window:         window,
+		interval:       interval,
+		corev1ClientFn: corev1Client,
+		getMetrics:     queryMetrics,
+	}
+}
+
+// Run blocks and analyzes operational clusters of all tenants every interval
+// until ctx is cancelled.
+func (rs *RightSizer) Run(ctx context.Context) {
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rs.analyzeAll(ctx)
+		}
+	}
+}
+
+func (rs *RightSizer) analyzeAll(ctx context.Context) {
+	kubes, err := rs.svc.ListAllTenants(ctx)
+	if err != nil {
+		logrus.Errorf("right-sizing: list kubes: %v", err)
+		return
+	}
+
+	for i := range kubes {
+		if kubes[i].State != model.StateOperational || kubes[i].InMaintenance() {
+			continue
+		}
+
+		ctx := tenant.WithID(ctx, kubes[i].TenantID)
+		if _, err := rs.Analyze(ctx, &kubes[i]); err != nil {
+			logrus.Errorf("right-sizing: cluster %s: %v", kubes[i].ID, err)
+		}
+	}
+}
+
+// Analyze builds a right-sizing report for the cluster and saves it.
+func (rs *RightSizer) Analyze(ctx context.Context, k *model.Kube) (*RightSizingReport, error) {
+	kclient, err := rs.corev1ClientFn(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes client")
+	}
+
+	podList, err := kclient.Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list pods")
+	}
+
+	usage := namespaceRequests(podList.Items)
+	if err := rs.namespaceUsage(k, usage); err != nil {
+		return nil, errors.Wrap(err, "get usage")
+	}
+
+	capacity, err := rs.svc.Capacity(ctx, k.ID, DefaultUtilizationThreshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "get capacity")
+	}
+
+	report := &RightSizingReport{
+		KubeID:          k.ID,
+		CreatedAt:       time.Now(),
+		Window:          promDuration(rs.window),
+		Namespaces:      make([]NamespaceUsage, 0, len(usage)),
+		IdleNodes:       make([]string, 0),
+		Recommendations: make([]Recommendation, 0),
+	}
+
+	for _, ns := range usage {
+		report.Namespaces = append(report.Namespaces, *ns)
+		if rec := namespaceRecommendation(*ns); rec != nil {
+			report.Recommendations = append(report.Recommendations, *rec)
+		}
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+
+	for _, node := range capacity.Nodes {
+		if _, isMaster := k.Masters[node.Name]; isMaster {
+			continue
+		}
+
+		if node.CPU.Utilization < idleNodeThreshold && node.Memory.Utilization < idleNodeThreshold {
+			report.IdleNodes = append(report.IdleNodes, node.Name)
+			report.Recommendations = append(report.Recommendations, Recommendation{
+				Kind: RecommendationNode,
+				Name: node.Name,
+				Reason: fmt.Sprintf("pods request %.1f%% cpu and %.1f%% memory, consider removing the node",
+					node.CPU.Utilization, node.Memory.Utilization),
+			})
+		}
+	}
+
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+
+	if err := rs.repo.Put(ctx, rs.prefix, k.ID, raw); err != nil {
+		return nil, errors.Wrap(err, "storage: put")
+	}
+
+	return report, nil
+}
+
+// Get returns the latest right-sizing report of the cluster.
+func (rs *RightSizer) Get(ctx context.Context, kubeID string) (*RightSizingReport, error) {
+	raw, err := rs.repo.Get(ctx, rs.prefix, kubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get")
+	}
+	if raw == nil {
+		return nil, sgerrors.ErrNotFound
+	}
+
+	report := &RightSizingReport{}
+	if err = json.Unmarshal(raw, report); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	return report, nil
+}
+
+// namespaceUsage fills average usage over the window from prometheus recording rules.
+func (rs *RightSizer) namespaceUsage(k *model.Kube, usage map[string]*NamespaceUsage) error {
+	master := util.GetRandomNode(k.Masters)
+	if master == nil {
+		return errors.Wrap(sgerrors.ErrNotFound, "master")
+	}
+
+	window := promDuration(rs.window)
+	queries := map[string]string{
+		"cpu":    fmt.Sprintf("avg_over_time(namespace:container_cpu_usage_seconds_total:sum_rate[%s])", window),
+		"memory": fmt.Sprintf("avg_over_time(namespace:container_memory_usage_bytes:sum[%s])", window),
+	}
+
+	for metricType, query := range queries {
+		uri := fmt.Sprintf("https://%s/%s/api/v1/query?query=%s",
+			master.PublicIp, prometheusProxyPath, url.QueryEscape(query))
+		resp, err := rs.getMetrics(uri, k)
+		if err != nil {
+			return errors.Wrapf(err, "query %s", metricType)
+		}
+
+		for _, result := range resp.Data.Result {
+			ns := result.Metric["namespace"]
+			if ns == "" || len(result.Value) < 2 {
+				continue
+			}
+
+			raw, ok := result.Value[1].(string)
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+
+			if usage[ns] == nil {
+				usage[ns] = &NamespaceUsage{Namespace: ns}
+			}
+
+			if metricType == "cpu" {
+				usage[ns].CPU.Used = int64(value * 1000)
+			} else {
+				usage[ns].Memory.Used = int64(value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func namespaceRequests(pods []corev1.Pod) map[string]*NamespaceUsage {
+	usage := make(map[string]*NamespaceUsage)
+
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		ns := usage[pod.Namespace]
+		if ns == nil {
+			ns = &NamespaceUsage{Namespace: pod.Namespace}
+			usage[pod.Namespace] = ns
+		}
+
+		reqs := podRequests(pod)
+		ns.CPU.Requested += requestedValue(reqs, corev1.ResourceCPU)
+		ns.Memory.Requested += requestedValue(reqs, corev1.ResourceMemory)
+	}
+
+	return usage
+}
+
+func namespaceRecommendation(ns NamespaceUsage) *Recommendation {
+	cpuOver := isOverprovisioned(ns.CPU)
+	memOver := isOverprovisioned(ns.Memory)
+	if !cpuOver && !memOver {
+		return nil
+	}
+
+	rec := &Recommendation{
+		Kind: RecommendationNamespace,
+		Name: ns.Namespace,
+	}
+
+	if cpuOver {
+		rec.CPU = withHeadroom(ns.CPU.Used)
+	}
+	if memOver {
+		rec.Memory = withHeadroom(ns.Memory.Used)
+	}
+	rec.Reason = fmt.Sprintf("pods use %dm of %dm cpu and %d of %d bytes memory requested",
+		ns.CPU.Used, ns.CPU.Requested, ns.Memory.Used, ns.Memory.Requested)
+
+	return rec
+}
+
+func isOverprovisioned(u ResourceUsage) bool {
+	return u.Requested > 0 && u.Used*100 < u.Requested*overprovisionedThreshold
+}
+
+func withHeadroom(v int64) int64 {
+	return v * (100 + recommendationHeadroom) / 100
+}
+
+// promDuration formats duration the way prometheus range selectors expect.
+func promDuration(d time.Duration) string {
+	if d%(time.Hour*24) == 0 {
+		return fmt.Sprintf("%dd", d/(time.Hour*24))
+	}
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// RightSizingHandler exposes right-sizing reports.
+type RightSizingHandler struct {
+	svc        Interface
+	rightSizer *RightSizer
+}
+
+// NewRightSizingHandler constructs a RightSizingHandler.
+func NewRightSizingHandler(svc Interface, rs *RightSizer) *RightSizingHandler {
+	return &RightSizingHandler{
+		svc:        svc,
+		rightSizer: rs,
+	}
+}
+
+// Register adds right-sizing handlers to a router.
+func (h *RightSizingHandler) Register(r *mux.Router) {
+	r.HandleFunc("/kubes/{kubeID}/recommendations", h.getReport).Methods(http.MethodGet)
+	r.HandleFunc("/kubes/{kubeID}/recommendations", h.analyze).Methods(http.MethodPost)
+}
+
+func (h *RightSizingHandler) getReport(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	report, err := h.rightSizer.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// analyze runs the analysis immediately instead of waiting for the next run.
+func (h *RightSizingHandler) analyze(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	report, err := h.rightSizer.Analyze(r.Context(), k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,289 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	fakev1client "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/testutils"
+)
+
+func usageResponse(values map[string]string) *MetricResponse {
+	resp := &MetricResponse{}
+	for ns, v := range values {
+		resp.Data.Result = append(resp.Data.Result, struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}{
+			Metric: map[string]string{"namespace": ns},
+			Value:  []interface{}{1.0, v},
+		})
+	}
+	return resp
+}
+
+func TestNamespaceRecommendation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		usage    NamespaceUsage
+		expected *Recommendation
+	}{
+		{
+			name: "no requests",
+			usage: NamespaceUsage{
+				Namespace: "default",
+				CPU:       ResourceUsage{Used: 100},
+			},
+		},
+		{
+			name: "well sized",
+			usage: NamespaceUsage{
+				Namespace: "default",
+				CPU:       ResourceUsage{Requested: 1000, Used: 800},
+				Memory:    ResourceUsage{Requested: 1000, Used: 500},
+			},
+		},
+		{
+			name: "overprovisioned cpu",
+			usage: NamespaceUsage{
+				Namespace: "default",
+				CPU:       ResourceUsage{Requested: 1000, Used: 100},
+				Memory:    ResourceUsage{Requested: 1000, Used: 900},
+			},
+			expected: &Recommendation{
+				Kind: RecommendationNamespace,
+				Name: "default",
+				CPU:  120,
+			},
+		},
+	} {
+		rec := namespaceRecommendation(tc.usage)
+		if tc.expected == nil {
+			require.Nil(t, rec, "TC: %s", tc.name)
+			continue
+		}
+
+		require.NotNil(t, rec, "TC: %s", tc.name)
+		require.Equal(t, tc.expected.Kind, rec.Kind, "TC: %s", tc.name)
+		require.Equal(t, tc.expected.Name, rec.Name, "TC: %s", tc.name)
+		require.Equal(t, tc.expected.CPU, rec.CPU, "TC: %s", tc.name)
+		require.Equal(t, tc.expected.Memory, rec.Memory, "TC: %s", tc.name)
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	require.Equal(t, "1d", promDuration(time.Hour*24))
+	require.Equal(t, "6h", promDuration(time.Hour*6))
+	require.Equal(t, "90m", promDuration(time.Minute*90))
+}
+
+func TestRightSizer_Analyze(t *testing.T) {
+	k := &model.Kube{
+		ID: "kube",
+		Masters: map[string]*model.Machine{
+			"master": {Name: "master", PublicIp: "10.0.0.1"},
+		},
+	}
+
+	fakeClient := func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		cl := &fakev1client.FakeCoreV1{
+			Fake: &kubetesting.Fake{},
+		}
+		cl.AddReactor("list", "pods",
+			func(action kubetesting.Action) (bool, runtime.Object, error) {
+				pod := capacityPod("node", corev1.PodRunning, "1", "1Gi")
+				pod.Namespace = "default"
+				return true, &corev1.PodList{Items: []corev1.Pod{pod}}, nil
+			})
+		return cl, nil
+	}
+
+	for _, tc := range []struct {
+		name           string
+		corev1ClientFn func(k *model.Kube) (corev1client.CoreV1Interface, error)
+		metricsErr     error
+		capacityErr    error
+		putErr         error
+		expectedErr    error
+	}{
+		{
+			name: "client error",
+			corev1ClientFn: func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+				return nil, errFake
+			},
+			expectedErr: errFake,
+		},
+		{
+			name:           "metrics error",
+			corev1ClientFn: fakeClient,
+			metricsErr:     errFake,
+			expectedErr:    errFake,
+		},
+		{
+			name:           "capacity error",
+			corev1ClientFn: fakeClient,
+			capacityErr:    errFake,
+			expectedErr:    errFake,
+		},
+		{
+			name:           "storage error",
+			corev1ClientFn: fakeClient,
+			putErr:         errFake,
+			expectedErr:    errFake,
+		},
+		{
+			name:           "success",
+			corev1ClientFn: fakeClient,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceCapacity, mock.Anything, "kube", mock.Anything).
+			Return(&CapacityReport{
+				Nodes: []NodeCapacity{
+					{
+						Name: "master",
+					},
+					{
+						Name: "node",
+						Capacity: Capacity{
+							CPU:    ResourceCapacity{Utilization: 5},
+							Memory: ResourceCapacity{Utilization: 10},
+						},
+					},
+				},
+			}, tc.capacityErr)
+
+		repo := new(testutils.MockStorage)
+		repo.On(testutils.StoragePut, mock.Anything, DefaultRightSizingPrefix, "kube", mock.Anything).
+			Return(tc.putErr)
+
+		rs := NewRightSizer(svc, repo, 0, time.Hour)
+		rs.corev1ClientFn = tc.corev1ClientFn
+		rs.getMetrics = func(uri string, k *model.Kube) (*MetricResponse, error) {
+			if tc.metricsErr != nil {
+				return nil, tc.metricsErr
+			}
+			if strings.Contains(uri, "cpu") {
+				return usageResponse(map[string]string{"default": "0.1"}), nil
+			}
+			return usageResponse(map[string]string{"default": "1073741824"}), nil
+		}
+
+		report, err := rs.Analyze(context.Background(), k)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Equal(t, "1d", report.Window, "TC: %s", tc.name)
+		require.Len(t, report.Namespaces, 1, "TC: %s", tc.name)
+		require.Equal(t, int64(1000), report.Namespaces[0].CPU.Requested, "TC: %s", tc.name)
+		require.Equal(t, int64(100), report.Namespaces[0].CPU.Used, "TC: %s", tc.name)
+		require.Equal(t, []string{"node"}, report.IdleNodes, "TC: %s", tc.name)
+		require.Len(t, report.Recommendations, 2, "TC: %s", tc.name)
+		require.Equal(t, int64(120), report.Recommendations[0].CPU, "TC: %s", tc.name)
+	}
+}
+
+func TestRightSizer_analyzeAll(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceListAllTenants, mock.Anything).Return([]model.Kube{
+		{
+			ID:       "kube",
+			TenantID: "acme",
+			State:    model.StateOperational,
+			Masters: map[string]*model.Machine{
+				"master": {Name: "master", PublicIp: "10.0.0.1"},
+			},
+		},
+		{ID: "provisioning", State: model.StateProvisioning},
+	}, nil)
+	svc.On(serviceCapacity, mock.MatchedBy(func(ctx context.Context) bool {
+		return tenant.FromContext(ctx) == "acme"
+	}), "kube", mock.Anything).Return(nil, errFake).Once()
+
+	rs := NewRightSizer(svc, new(testutils.MockStorage), 0, time.Hour)
+	rs.corev1ClientFn = func(k *model.Kube) (corev1client.CoreV1Interface, error) {
+		return &fakev1client.FakeCoreV1{Fake: &kubetesting.Fake{}}, nil
+	}
+	rs.getMetrics = func(uri string, k *model.Kube) (*MetricResponse, error) {
+		return usageResponse(nil), nil
+	}
+
+	rs.analyzeAll(context.Background())
+
+	svc.AssertExpectations(t)
+}
+
+func TestRightSizingHandler_getReport(t *testing.T) {
+	reportData, _ := json.Marshal(&RightSizingReport{KubeID: "kube"})
+
+	for _, tc := range []struct {
+		name         string
+		data         []byte
+		getErr       error
+		expectedCode int
+	}{
+		{
+			name:         "no report",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "storage error",
+			getErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			data:         reportData,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		repo := new(testutils.MockStorage)
+		repo.On(testutils.StorageGet, mock.Anything, DefaultRightSizingPrefix, "kube").
+			Return(tc.data, tc.getErr)
+
+		svc := new(kubeServiceMock)
+		h := NewRightSizingHandler(svc, NewRightSizer(svc, repo, time.Hour, time.Hour))
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/recommendations", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
+
+func TestRightSizingHandler_analyze(t *testing.T) {
+	svc := new(kubeServiceMock)
+	svc.On(serviceGet, mock.Anything, "kube").Return(nil, sgerrors.ErrNotFound)
+
+	h := NewRightSizingHandler(svc, NewRightSizer(svc, nil, time.Hour, time.Hour))
+	router := mux.NewRouter()
+	h.Register(router)
+
+	req := httptest.NewRequest(http.MethodPost, "/kubes/kube/recommendations", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,221 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	SearchKube     = "kube"
+	SearchNodePool = "nodePool"
+	SearchNode     = "node"
+	SearchRelease  = "release"
+
+	defaultSearchLimit = 100
+)
+
+var searchTypes = map[string]bool{
+	SearchKube:     true,
+	SearchNodePool: true,
+	SearchNode:     true,
+	SearchRelease:  true,
+}
+
+// SearchResult is an entity of the fleet that matches the query,
+// Field is the attribute the query has been found in.
+type SearchResult struct {
+	Type     string `json:"type"`
+	KubeID   string `json:"kubeId"`
+	KubeName string `json:"kubeName"`
+	Name     string `json:"name"`
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+}
+
+// SearchQuery is a case insensitive substring of names, labels, addresses
+// and charts, labels are matched as key=value.
+type SearchQuery struct {
+	Text  string
+	Types []string
+	Limit int
+}
+
+func (q SearchQuery) wants(kind string) bool {
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type searchResults struct {
+	text string
+	out  []SearchResult
+}
+
+// match adds a result for the first field the text is found in.
+func (r *searchResults) match(kind string, k *model.Kube, name string, fields ...string) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" && strings.Contains(strings.ToLower(fields[i+1]), r.text) {
+			r.out = append(r.out, SearchResult{
+				Type:     kind,
+				KubeID:   k.ID,
+				KubeName: k.Title(),
+				Name:     name,
+				Field:    fields[i],
+				Value:    fields[i+1],
+			})
+			return
+		}
+	}
+}
+
+// search looks the query up in clusters, their node pools and machines and
+// in releases of operational clusters, releases are queried from tiller.
+func (h *Handler) search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	kubes, err := h.svc.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	res := &searchResults{
+		text: strings.ToLower(strings.TrimSpace(q.Text)),
+		out:  make([]SearchResult, 0),
+	}
+
+	for i := range kubes {
+		k := &kubes[i]
+		if q.wants(SearchKube) {
+			fields := []string{"name", k.Name, "displayName", k.DisplayName, "id", k.ID,
+				"owner", k.Metadata.Owner, "apiHost", k.APIHost}
+			labels := make([]string, 0, len(k.Cost.Tags))
+			for key, value := range k.Cost.Tags {
+				labels = append(labels, key+"="+value)
+			}
+			// the first matching label is reported
+			sort.Strings(labels)
+			for _, l := range labels {
+				fields = append(fields, "label", l)
+			}
+			res.match(SearchKube, k, k.Title(), fields...)
+		}
+
+		pools := make(map[string]bool)
+		for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+			for _, m := range machines {
+				if m == nil {
+					continue
+				}
+				if q.wants(SearchNodePool) && m.Size != "" {
+					pools[string(m.Role)+"/"+m.Size] = true
+				}
+				if q.wants(SearchNode) {
+					res.match(SearchNode, k, m.Name, "name", m.Name, "id", m.ID,
+						"publicIp", m.PublicIp, "privateIp", m.PrivateIp)
+				}
+			}
+		}
+		for pool := range pools {
+			res.match(SearchNodePool, k, pool, "name", pool)
+		}
+	}
+
+	if q.wants(SearchRelease) {
+		clusters, err := h.svc.ListFleetReleases(ctx, ReleaseFilter{})
+		if err != nil {
+			return nil, errors.Wrap(err, "list releases")
+		}
+
+		names := make(map[string]*model.Kube, len(kubes))
+		for i := range kubes {
+			names[kubes[i].ID] = &kubes[i]
+		}
+		for _, c := range clusters {
+			k := names[c.KubeID]
+			if k == nil {
+				continue
+			}
+			if c.Error != "" {
+				logrus.Debugf("kube %s: search releases: %s", c.KubeID, c.Error)
+			}
+			for _, rls := range c.Releases {
+				res.match(SearchRelease, k, rls.Name, "name", rls.Name, "chart", rls.Chart,
+					"namespace", rls.Namespace)
+			}
+		}
+	}
+
+	sort.Slice(res.out, func(i, j int) bool {
+		a, b := res.out[i], res.out[j]
+		if a.KubeName != b.KubeName {
+			return a.KubeName < b.KubeName
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+
+	if len(res.out) > q.Limit {
+		res.out = res.out[:q.Limit]
+	}
+	return res.out, nil
+}
+
+// searchFleet is the global search of the ui:
+// GET /search?q=10.0.1&type=node,release&limit=50
+func (h *Handler) searchFleet(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := SearchQuery{
+		Text:  params.Get("q"),
+		Limit: defaultSearchLimit,
+	}
+	if strings.TrimSpace(q.Text) == "" {
+		message.SendValidationFailed(w, errors.Wrap(sgerrors.ErrInvalidJson, "query is empty"))
+		return
+	}
+	if v := params.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !searchTypes[t] {
+				message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "unknown type %q", t))
+				return
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "limit %q", v))
+			return
+		}
+		q.Limit = n
+	}
+
+	results, err := h.search(r.Context(), q)
+	if err != nil {
+		logrus.Errorf("kube: search %q: %v", q.Text, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(results); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
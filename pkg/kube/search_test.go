@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+)
+
+func TestHandler_searchFleet(t *testing.T) {
+	kubes := []model.Kube{
+		{
+			ID:          "1234",
+			Name:        "prod",
+			DisplayName: "Production",
+			Cost: profile.CostSettings{
+				Tags: map[string]string{"team": "analytics"},
+			},
+			Masters: map[string]*model.Machine{
+				"prod-master-1": {Name: "prod-master-1", Role: model.RoleMaster, Size: "m5.large", PrivateIp: "10.0.1.10"},
+			},
+			Nodes: map[string]*model.Machine{
+				"prod-node-1": {Name: "prod-node-1", Role: model.RoleNode, Size: "m5.xlarge", PrivateIp: "10.0.2.11"},
+				"prod-node-2": {Name: "prod-node-2", Role: model.RoleNode, Size: "m5.xlarge", PrivateIp: "10.0.2.12"},
+			},
+		},
+		{
+			ID:   "5678",
+			Name: "dev",
+		},
+	}
+	releases := []ClusterReleases{
+		{
+			KubeID: "1234",
+			Releases: []*model.ReleaseInfo{
+				{Name: "ingress", Chart: "nginx-ingress", Namespace: "kube-system"},
+			},
+		},
+		{
+			KubeID: "5678",
+			Error:  "tiller is unavailable",
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		query   string
+		listErr error
+
+		expectedCode    int
+		expectedResults []SearchResult
+	}{
+		{
+			name:         "empty query",
+			query:        "q=%20",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown type",
+			query:        "q=prod&type=pod",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid limit",
+			query:        "q=prod&limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "list error",
+			query:        "q=prod",
+			listErr:      errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "label",
+			query:        "q=team=analytics",
+			expectedCode: http.StatusOK,
+			expectedResults: []SearchResult{
+				{Type: SearchKube, KubeID: "1234", KubeName: "Production", Name: "Production", Field: "label", Value: "team=analytics"},
+			},
+		},
+		{
+			name:         "ip",
+			query:        "q=10.0.2&type=node",
+			expectedCode: http.StatusOK,
+			expectedResults: []SearchResult{
+				{Type: SearchNode, KubeID: "1234", KubeName: "Production", Name: "prod-node-1", Field: "privateIp", Value: "10.0.2.11"},
+				{Type: SearchNode, KubeID: "1234", KubeName: "Production", Name: "prod-node-2", Field: "privateIp", Value: "10.0.2.12"},
+			},
+		},
+		{
+			name:         "node pool",
+			query:        "q=XLARGE&type=nodePool",
+			expectedCode: http.StatusOK,
+			expectedResults: []SearchResult{
+				{Type: SearchNodePool, KubeID: "1234", KubeName: "Production", Name: "node/m5.xlarge", Field: "name", Value: "node/m5.xlarge"},
+			},
+		},
+		{
+			name:         "chart",
+			query:        "q=nginx",
+			expectedCode: http.StatusOK,
+			expectedResults: []SearchResult{
+				{Type: SearchRelease, KubeID: "1234", KubeName: "Production", Name: "ingress", Field: "chart", Value: "nginx-ingress"},
+			},
+		},
+		{
+			name:         "limit",
+			query:        "q=prod&type=kube,node&limit=2",
+			expectedCode: http.StatusOK,
+			expectedResults: []SearchResult{
+				{Type: SearchKube, KubeID: "1234", KubeName: "Production", Name: "Production", Field: "name", Value: "prod"},
+				{Type: SearchNode, KubeID: "1234", KubeName: "Production", Name: "prod-master-1", Field: "name", Value: "prod-master-1"},
+			},
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceListAll, mock.Anything).Return(kubes, tc.listErr)
+		svc.On(serviceFleetReleases, mock.Anything, ReleaseFilter{}).Return(releases, nil)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?"+tc.query, nil))
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		results := make([]SearchResult, 0)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&results), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedResults, results, "TC: %s", tc.name)
+	}
+}
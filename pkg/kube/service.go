@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/pborman/uuid"
@@ -15,12 +18,17 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubejson "k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/apimachinery/pkg/runtime/serializer/versioning"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	clientcmddapi "k8s.io/client-go/tools/clientcmd/api"
 	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
 	"k8s.io/helm/pkg/timeconv"
 
 	"github.com/supergiant/control/pkg/model"
@@ -28,6 +36,7 @@ import (
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/sghelm/proxy"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/workflows/steps/kubelet"
 )
 
@@ -37,6 +46,9 @@ const (
 	DefaultStoragePrefix = "/supergiant/kubes/"
 
 	releaseInstallTimeout = 300
+	maxReleaseTimeout     = 540
+	// the same number of revisions helm history shows
+	defaultReleaseHistory = 256
 )
 
 var (
@@ -49,17 +61,51 @@ var (
 type Interface interface {
 	Create(ctx context.Context, k *model.Kube) error
 	Get(ctx context.Context, name string) (*model.Kube, error)
+	Update(ctx context.Context, name string, change func(*model.Kube) error) (*model.Kube, error)
 	ListAll(ctx context.Context) ([]model.Kube, error)
+	ListAllTenants(ctx context.Context) ([]model.Kube, error)
 	Delete(ctx context.Context, name string) error
 	KubeConfigFor(ctx context.Context, kname, user string) ([]byte, error)
+	IssueKubeConfig(ctx context.Context, kubeID, user string, req UserKubeConfigRequest) ([]byte, error)
 	ListKubeResources(ctx context.Context, kname string) ([]byte, error)
-	GetKubeResources(ctx context.Context, kname, resource, ns, name string) ([]byte, error)
+	GetKubeResources(ctx context.Context, kname, resource, ns, name string, opts metav1.ListOptions) ([]byte, error)
+	WatchKubeResources(ctx context.Context, kubeID, resource, ns string, opts metav1.ListOptions) (<-chan WatchEvent, error)
+	PodLogs(ctx context.Context, kubeID, ns, pod, container string, opts LogOptions, w io.Writer) error
+	ExecInPod(ctx context.Context, kubeID, ns, pod string, opts ExecOptions, streams ExecStreams) error
+	PostKubeResource(ctx context.Context, kname, resource, ns string, manifest []byte) ([]byte, error)
+	PatchKubeResource(ctx context.Context, kname, resource, ns, name string, patchType types.PatchType, patch []byte) ([]byte, error)
+	DeleteKubeResource(ctx context.Context, kname, resource, ns, name string) error
 	ListNodes(ctx context.Context, k *model.Kube, role string) ([]corev1.Node, error)
+	CordonNode(ctx context.Context, kname, node string) error
+	UncordonNode(ctx context.Context, kname, node string) error
+	DrainNode(ctx context.Context, kname, node string, opts DrainOptions) (*DrainReport, error)
 	GetCerts(ctx context.Context, kname, cname string) (*Bundle, error)
 	InstallRelease(ctx context.Context, kname string, rls *ReleaseInput) (*release.Release, error)
+	UpgradeRelease(ctx context.Context, kname, rlsName string, rls *ReleaseInput) (*release.Release, error)
 	ListReleases(ctx context.Context, kname, ns, offset string, limit int) ([]*model.ReleaseInfo, error)
+	ListFleetReleases(ctx context.Context, filter ReleaseFilter) ([]ClusterReleases, error)
+	MigrateReleases(ctx context.Context, kname string, req *MigrationRequest) (*MigrationReport, error)
 	ReleaseDetails(ctx context.Context, kname, rlsName string) (*release.Release, error)
+	ReleaseHistory(ctx context.Context, kname, rlsName string, max int) ([]*model.ReleaseInfo, error)
 	DeleteRelease(ctx context.Context, kname, rlsName string, purge bool) (*model.ReleaseInfo, error)
+	RollbackRelease(ctx context.Context, kname, rlsName string, revision int32) (*model.ReleaseInfo, error)
+	InstallReleaseAsync(ctx context.Context, kname string, rls *ReleaseInput) (*HelmOperation, error)
+	UpgradeReleaseAsync(ctx context.Context, kname, rlsName string, rls *ReleaseInput) (*HelmOperation, error)
+	DeleteReleaseAsync(ctx context.Context, kname, rlsName string, purge bool) (*HelmOperation, error)
+	HelmOperation(ctx context.Context, kname, opID string) (*HelmOperation, error)
+	Capacity(ctx context.Context, kname string, threshold float64) (*CapacityReport, error)
+	Metrics(ctx context.Context, kname string) (*ClusterUsage, error)
+	UpgradeCheck(ctx context.Context, kname, version string) (*UpgradeReport, error)
+	Inventory(ctx context.Context, kname string) (*ClusterInventory, error)
+	FleetInventory(ctx context.Context, filter InventoryFilter) ([]ClusterInventory, error)
+	HelmOperations(ctx context.Context, kname string) ([]HelmOperation, error)
+	CreateSnapshots(ctx context.Context, kname string, req *SnapshotRequest) ([]VolumeSnapshot, error)
+	ListSnapshots(ctx context.Context, kname, ns string) ([]VolumeSnapshot, error)
+	RestoreSnapshot(ctx context.Context, kname, ns, name string, req *RestoreRequest) error
+	ReleaseResources(ctx context.Context, kname, rlsName string) (*ReleaseResourceReport, error)
+	GrantAccess(ctx context.Context, kname, user string, req *AccessRequest) (*model.AccessGrant, error)
+	AccessKubeConfig(ctx context.Context, kname, grantID string) ([]byte, error)
+	RevokeAccess(ctx context.Context, kname, grantID string) error
 }
 
 // ChartGetter interface is a wrapper for GetChart function.
@@ -76,31 +122,58 @@ type Service struct {
 	discoveryClientFn func(k *model.Kube) (ServerResourceGetter, error)
 	corev1ClientFn    func(k *model.Kube) (corev1client.CoreV1Interface, error)
 	clientForGroupFn  func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error)
+	execDialerFn      func(k *model.Kube, u *url.URL) (httpstream.Dialer, error)
 
 	prefix  string
 	storage storage.Interface
 
 	newHelmProxyFn func(kube *model.Kube) (proxy.Interface, error)
 	chrtGetter     ChartGetter
+	helmOps        *helmQueue
+
+	// number of clusters queried at the same time, it can be changed at runtime
+	fleetConcurrency *int32
 }
 
 // NewService constructs a Service.
 func NewService(prefix string, s storage.Interface, chrtGetter ChartGetter) *Service {
+	proxies := newHelmProxyPool()
+	go proxies.run(context.Background())
+
 	return &Service{
+		discoveryClientFn: func(k *model.Kube) (ServerResourceGetter, error) {
+			return discoveryClient(k)
+		},
 		clientForGroupFn: restClientForGroupVersion,
 		corev1ClientFn:   corev1Client,
-		newHelmProxyFn:   helmProxyFrom,
+		execDialerFn:     spdyDialer,
+		newHelmProxyFn:   proxies.get,
 		chrtGetter:       chrtGetter,
+		helmOps:          newHelmQueue(),
+		fleetConcurrency: new(int32),
 		prefix:           prefix,
 		storage:          s,
 	}
 }
 
-// Create and stores a kube in the provided storage.
+// Create and stores a kube in the provided storage. The kube is stored
+// within its tenant, requests of other tenants can't update it.
 func (s Service) Create(ctx context.Context, k *model.Kube) error {
 	if k.ID == "" {
 		k.ID = uuid.New()[:8]
 	}
+	k.SchemaVersion = Migrator.Version()
+	k.UpdateCloudResources()
+
+	if id := tenant.FromContext(ctx); id != tenant.DefaultID {
+		if k.TenantID != tenant.DefaultID && k.TenantID != id {
+			return errors.Wrapf(sgerrors.ErrNotFound, "kube %s", k.ID)
+		}
+		k.TenantID = id
+	} else if k.TenantID != tenant.DefaultID {
+		// background updates of tenant kubes
+		ctx = tenant.WithID(ctx, k.TenantID)
+	}
 
 	raw, err := json.Marshal(k)
 	if err != nil {
@@ -117,20 +190,73 @@ func (s Service) Create(ctx context.Context, k *model.Kube) error {
 
 // Get returns a kube with a specified name.
 func (s Service) Get(ctx context.Context, kubeID string) (*model.Kube, error) {
-	raw, err := s.storage.Get(ctx, s.prefix, kubeID)
+	k, _, err := s.get(ctx, kubeID)
+	return k, err
+}
+
+// Update applies the change to the stored kube and saves it, the change is
+// applied again to the latest version if the kube has been saved meanwhile.
+func (s Service) Update(ctx context.Context, kubeID string, change func(*model.Kube) error) (*model.Kube, error) {
+	swapper, canSwap := s.storage.(storage.Swapper)
+
+	for {
+		k, old, err := s.get(ctx, kubeID)
+		if err != nil {
+			return nil, err
+		}
+		if err = change(k); err != nil {
+			return nil, err
+		}
+		k.SchemaVersion = Migrator.Version()
+		k.UpdateCloudResources()
+
+		raw, err := json.Marshal(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal")
+		}
+
+		if !canSwap {
+			if err = s.storage.Put(ctx, s.prefix, kubeID, raw); err != nil {
+				return nil, errors.Wrap(err, "storage: put")
+			}
+			return k, nil
+		}
+
+		swapped, err := swapper.CompareAndSwap(ctx, s.prefix, kubeID, old, raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "storage: compare and swap")
+		}
+		if swapped {
+			return k, nil
+		}
+	}
+}
+
+// get returns the kube together with its stored representation.
+func (s Service) get(ctx context.Context, kubeID string) (*model.Kube, []byte, error) {
+	stored, err := s.storage.Get(ctx, s.prefix, kubeID)
 	if err != nil {
-		return nil, errors.Wrap(err, "storage: get")
+		return nil, nil, errors.Wrap(err, "storage: get")
+	}
+	if stored == nil {
+		return nil, nil, sgerrors.ErrNotFound
 	}
-	if raw == nil {
-		return nil, sgerrors.ErrNotFound
+
+	raw, _, err := Migrator.Upgrade(stored)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "migrate kube %s", kubeID)
 	}
 
 	k := &model.Kube{}
 	if err = json.Unmarshal(raw, k); err != nil {
-		return nil, errors.Wrap(err, "unmarshal")
+		return nil, nil, errors.Wrap(err, "unmarshal")
+	}
+
+	if k.TenantID != tenant.FromContext(ctx) {
+		return nil, nil, sgerrors.ErrNotFound
 	}
 
-	return k, nil
+	return k, stored, nil
 }
 
 // ListAll returns all kubes.
@@ -140,13 +266,40 @@ func (s Service) ListAll(ctx context.Context) ([]model.Kube, error) {
 		return nil, errors.Wrap(err, "storage: getAll")
 	}
 
-	kubes := make([]model.Kube, len(rawKubes))
-	for i, v := range rawKubes {
+	kubes := make([]model.Kube, 0, len(rawKubes))
+	for _, v := range rawKubes {
+		if v, _, err = Migrator.Upgrade(v); err != nil {
+			return nil, errors.Wrap(err, "migrate")
+		}
+
 		k := model.Kube{}
 		if err = json.Unmarshal(v, &k); err != nil {
 			return nil, errors.Wrap(err, "unmarshal")
 		}
-		kubes[i] = k
+		if k.TenantID != tenant.FromContext(ctx) {
+			continue
+		}
+		kubes = append(kubes, k)
+	}
+
+	return kubes, nil
+}
+
+// ListAllTenants returns kubes of all tenants, background jobs handle
+// every kube with a context of its tenant.
+func (s Service) ListAllTenants(ctx context.Context) ([]model.Kube, error) {
+	ids, err := tenant.All(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	kubes := make([]model.Kube, 0)
+	for _, id := range ids {
+		tenantKubes, err := s.ListAll(tenant.WithID(ctx, id))
+		if err != nil {
+			return nil, errors.Wrapf(err, "tenant %s", id)
+		}
+		kubes = append(kubes, tenantKubes...)
 	}
 
 	return kubes, nil
@@ -177,35 +330,23 @@ func (s Service) ListKubeResources(ctx context.Context, kubeID string) ([]byte,
 	return raw, nil
 }
 
-// GetKubeResources returns raw representation of the kubernetes resources.
-func (s Service) GetKubeResources(ctx context.Context, kubeID, resource, ns, name string) ([]byte, error) {
-	kube, err := s.Get(ctx, kubeID)
-	if err != nil {
-		return nil, errors.Wrap(err, "get kube")
-	}
-
-	resourcesInfo, err := s.resourcesGroupInfo(kube)
+// GetKubeResources returns raw representation of the kubernetes resources,
+// list options filter and page collections and are ignored for a named object.
+func (s Service) GetKubeResources(ctx context.Context, kubeID, resource, ns, name string, opts metav1.ListOptions) ([]byte, error) {
+	client, err := s.resourceClient(ctx, kubeID, resource)
 	if err != nil {
 		return nil, err
 	}
 
-	gv, ok := resourcesInfo[resource]
-	if !ok {
-		return nil, sgerrors.ErrNotFound
-	}
-
-	client, err := s.clientForGroupFn(kube, gv)
-	if err != nil {
-		return nil, errors.Wrap(err, "get kube client")
-	}
-
 	req := client.Get().Resource(resource).Namespace(ns)
 	if name != "" {
 		req.Name(name)
+	} else {
+		req.VersionedParams(&opts, scheme.ParameterCodec)
 	}
 	raw, err := req.DoRaw()
 	if err != nil {
-		return nil, errors.Wrap(err, "get resources")
+		return nil, resourceError(err, "get resources")
 	}
 
 	return raw, nil
@@ -229,7 +370,8 @@ func (s Service) ListNodes(ctx context.Context, kube *model.Kube, role string) (
 }
 
 func (s Service) KubeConfigFor(ctx context.Context, kubeID, user string) ([]byte, error) {
-	// there are certificates only for the cluster-admin user
+	// there are certificates only for the cluster-admin user, the ones of
+	// other users aren't stored, see IssueKubeConfig
 	if user != KubernetesAdminUser {
 		return nil, errors.Wrapf(sgerrors.ErrNotFound, "%q user", user)
 	}
@@ -244,6 +386,10 @@ func (s Service) KubeConfigFor(ctx context.Context, kubeID, user string) ([]byte
 		return nil, err
 	}
 
+	return encodeKubeConfig(kubeconfig)
+}
+
+func encodeKubeConfig(kubeconfig clientcmddapi.Config) ([]byte, error) {
 	serializer := kubejson.NewSerializer(kubejson.DefaultMetaFactory, clientcmdlatest.Scheme, clientcmdlatest.Scheme, false)
 	codec := versioning.NewDefaultingCodecForScheme(
 		clientcmdlatest.Scheme,
@@ -286,34 +432,160 @@ func (s Service) GetCerts(ctx context.Context, kname, cname string) (*Bundle, er
 }
 
 func (s Service) InstallRelease(ctx context.Context, kubeID string, rls *ReleaseInput) (*release.Release, error) {
+	rlsName, install, err := s.releaseInstaller(ctx, kubeID, rls)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is changed in the cluster, so dry runs aren't queued
+	if rls.DryRun {
+		return install()
+	}
+
+	var rr *release.Release
+	err = s.helmOps.do(ctx, kubeID, HelmOpInstall, rlsName, func() error {
+		var installErr error
+		rr, installErr = install()
+		return installErr
+	})
+
+	return rr, err
+}
+
+// InstallReleaseAsync queues release installation and returns without waiting
+// for tiller, the operation can be polled with HelmOperation.
+func (s Service) InstallReleaseAsync(ctx context.Context, kubeID string, rls *ReleaseInput) (*HelmOperation, error) {
+	rlsName, install, err := s.releaseInstaller(ctx, kubeID, rls)
+	if err != nil {
+		return nil, err
+	}
+
+	op := s.helmOps.submit(kubeID, HelmOpInstall, rlsName, func() (*model.ReleaseInfo, error) {
+		rr, err := install()
+		return toReleaseInfo(rr), err
+	})
+
+	return &op, nil
+}
+
+// releaseInstaller fetches everything the installation needs, so the input errors
+// are returned before the operation is queued.
+func (s Service) releaseInstaller(ctx context.Context, kubeID string,
+	rls *ReleaseInput) (string, func() (*release.Release, error), error) {
 	if rls == nil {
-		return nil, errors.Wrap(sgerrors.ErrNilEntity, "release input")
+		return "", nil, errors.Wrap(sgerrors.ErrNilEntity, "release input")
+	}
+	timeout, err := rls.timeout()
+	if err != nil {
+		return "", nil, err
 	}
 
 	chrt, err := s.chrtGetter.GetChart(ctx, rls.RepoName, rls.ChartName, rls.ChartVersion)
 	if err != nil {
-		return nil, errors.Wrap(err, "get chart")
+		return "", nil, errors.Wrap(err, "get chart")
 	}
 
 	kube, err := s.Get(ctx, kubeID)
 	if err != nil {
-		return nil, errors.Wrap(err, "get kube")
+		return "", nil, errors.Wrap(err, "get kube")
 	}
 	kprx, err := s.helmClient(kube)
 	if err != nil {
-		return nil, errors.Wrap(err, "build helm proxy")
+		return "", nil, errors.Wrap(err, "build helm proxy")
 	}
 
-	rr, err := kprx.InstallReleaseFromChart(
-		chrt,
-		rls.Namespace,
-		helm.ReleaseName(ensureReleaseName(rls.Name)),
-		helm.ValueOverrides([]byte(rls.Values)),
-		helm.InstallWait(false),
-		helm.InstallTimeout(releaseInstallTimeout),
-	)
+	rlsName := ensureReleaseName(rls.Name)
+
+	return rlsName, func() (*release.Release, error) {
+		rr, err := kprx.InstallReleaseFromChart(
+			chrt,
+			rls.Namespace,
+			helm.ReleaseName(rlsName),
+			helm.ValueOverrides([]byte(rls.Values)),
+			helm.InstallWait(rls.Wait),
+			helm.InstallTimeout(timeout),
+			helm.InstallDryRun(rls.DryRun),
+		)
+		return rr.GetRelease(), err
+	}, nil
+}
+
+// UpgradeRelease updates the release to the chart version with new values,
+// the release keeps its history, so it can be rolled back.
+func (s Service) UpgradeRelease(ctx context.Context, kubeID, rlsName string, rls *ReleaseInput) (*release.Release, error) {
+	upgrade, err := s.releaseUpgrader(ctx, kubeID, rlsName, rls)
+	if err != nil {
+		return nil, err
+	}
+
+	var rr *release.Release
+	err = s.helmOps.do(ctx, kubeID, HelmOpUpgrade, rlsName, func() error {
+		var upgradeErr error
+		rr, upgradeErr = upgrade()
+		return upgradeErr
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "upgrade release")
+	}
+
+	return rr, nil
+}
+
+// UpgradeReleaseAsync queues release upgrade and returns without waiting
+// for tiller, the operation can be polled with HelmOperation.
+func (s Service) UpgradeReleaseAsync(ctx context.Context, kubeID, rlsName string, rls *ReleaseInput) (*HelmOperation, error) {
+	upgrade, err := s.releaseUpgrader(ctx, kubeID, rlsName, rls)
+	if err != nil {
+		return nil, err
+	}
 
-	return rr.GetRelease(), err
+	op := s.helmOps.submit(kubeID, HelmOpUpgrade, rlsName, func() (*model.ReleaseInfo, error) {
+		rr, err := upgrade()
+		if err != nil {
+			return nil, errors.Wrap(err, "upgrade release")
+		}
+		return toReleaseInfo(rr), nil
+	})
+
+	return &op, nil
+}
+
+// releaseUpgrader fetches the chart and the helm client before the upgrade
+// is queued, so the input errors are returned right away.
+func (s Service) releaseUpgrader(ctx context.Context, kubeID, rlsName string,
+	rls *ReleaseInput) (func() (*release.Release, error), error) {
+	if rls == nil {
+		return nil, errors.Wrap(sgerrors.ErrNilEntity, "release input")
+	}
+	timeout, err := rls.timeout()
+	if err != nil {
+		return nil, err
+	}
+
+	chrt, err := s.chrtGetter.GetChart(ctx, rls.RepoName, rls.ChartName, rls.ChartVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "get chart")
+	}
+
+	kprx, err := s.kubeHelmClient(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (*release.Release, error) {
+		rr, err := kprx.UpdateReleaseFromChart(
+			rlsName,
+			chrt,
+			helm.UpdateValueOverrides([]byte(rls.Values)),
+			helm.ReuseValues(rls.ReuseValues),
+			helm.UpgradeWait(rls.Wait),
+			helm.UpgradeTimeout(timeout),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return rr.GetRelease(), nil
+	}, nil
 }
 
 func (s Service) ReleaseDetails(ctx context.Context, kubeID, rlsName string) (*release.Release, error) {
@@ -334,6 +606,35 @@ func (s Service) ReleaseDetails(ctx context.Context, kubeID, rlsName string) (*r
 	return rr.GetRelease(), nil
 }
 
+// ReleaseHistory returns up to max revisions of the release, the latest first.
+func (s Service) ReleaseHistory(ctx context.Context, kubeID, rlsName string, max int) ([]*model.ReleaseInfo, error) {
+	if max <= 0 {
+		max = defaultReleaseHistory
+	}
+
+	kprx, err := s.kubeHelmClient(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := kprx.ReleaseHistory(rlsName, helm.WithMaxHistory(int32(max)))
+	if err != nil {
+		return nil, errors.Wrap(err, "get release history")
+	}
+
+	out := make([]*model.ReleaseInfo, 0, len(res.GetReleases()))
+	for _, rls := range res.GetReleases() {
+		if rls != nil {
+			out = append(out, toReleaseInfo(rls))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Version > out[j].Version
+	})
+
+	return out, nil
+}
+
 func (s Service) ListReleases(ctx context.Context, kubeID, namespace, offset string, limit int) ([]*model.ReleaseInfo, error) {
 	kube, err := s.Get(ctx, kubeID)
 	if err != nil {
@@ -344,6 +645,10 @@ func (s Service) ListReleases(ctx context.Context, kubeID, namespace, offset str
 		return nil, errors.Wrap(err, "build helm proxy")
 	}
 
+	return listReleases(kprx, namespace, offset, limit)
+}
+
+func listReleases(kprx proxy.Interface, namespace, offset string, limit int) ([]*model.ReleaseInfo, error) {
 	res, err := kprx.ListReleases(
 		helm.ReleaseListNamespace(namespace),
 		helm.ReleaseListOffset(offset),
@@ -364,26 +669,117 @@ func (s Service) ListReleases(ctx context.Context, kubeID, namespace, offset str
 }
 
 func (s Service) DeleteRelease(ctx context.Context, kubeID, rlsName string, purge bool) (*model.ReleaseInfo, error) {
-	kube, err := s.Get(ctx, kubeID)
+	kprx, err := s.kubeHelmClient(ctx, kubeID)
 	if err != nil {
-		return nil, errors.Wrap(err, "get kube")
+		return nil, err
 	}
-	kprx, err := s.helmClient(kube)
+
+	var res *services.UninstallReleaseResponse
+	err = s.helmOps.do(ctx, kubeID, HelmOpDelete, rlsName, func() error {
+		var deleteErr error
+		res, deleteErr = kprx.DeleteRelease(
+			rlsName,
+			helm.DeletePurge(purge),
+		)
+		return deleteErr
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "build helm proxy")
+		return nil, errors.Wrap(err, "delete releases")
 	}
 
-	res, err := kprx.DeleteRelease(
-		rlsName,
-		helm.DeletePurge(purge),
-	)
+	return toReleaseInfo(res.GetRelease()), nil
+}
+
+// RollbackRelease reverts the release to the revision, zero is the previous one.
+func (s Service) RollbackRelease(ctx context.Context, kubeID, rlsName string, revision int32) (*model.ReleaseInfo, error) {
+	if revision < 0 {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "revision %d", revision)
+	}
+
+	kprx, err := s.kubeHelmClient(ctx, kubeID)
 	if err != nil {
-		return nil, errors.Wrap(err, "delete releases")
+		return nil, err
+	}
+
+	var res *services.RollbackReleaseResponse
+	err = s.helmOps.do(ctx, kubeID, HelmOpRollback, rlsName, func() error {
+		var rollbackErr error
+		res, rollbackErr = kprx.RollbackRelease(
+			rlsName,
+			helm.RollbackVersion(revision),
+			helm.RollbackWait(false),
+			helm.RollbackTimeout(releaseInstallTimeout),
+		)
+		return rollbackErr
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "rollback release")
 	}
 
 	return toReleaseInfo(res.GetRelease()), nil
 }
 
+// DeleteReleaseAsync queues release deletion and returns without waiting for tiller.
+func (s Service) DeleteReleaseAsync(ctx context.Context, kubeID, rlsName string, purge bool) (*HelmOperation, error) {
+	kprx, err := s.kubeHelmClient(ctx, kubeID)
+	if err != nil {
+		return nil, err
+	}
+
+	op := s.helmOps.submit(kubeID, HelmOpDelete, rlsName, func() (*model.ReleaseInfo, error) {
+		res, err := kprx.DeleteRelease(
+			rlsName,
+			helm.DeletePurge(purge),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "delete releases")
+		}
+		return toReleaseInfo(res.GetRelease()), nil
+	})
+
+	return &op, nil
+}
+
+// HelmOperations returns queued, running and recently finished release operations of the cluster.
+func (s Service) HelmOperations(ctx context.Context, kubeID string) ([]HelmOperation, error) {
+	if _, err := s.Get(ctx, kubeID); err != nil {
+		return nil, err
+	}
+
+	return s.helmOps.list(kubeID), nil
+}
+
+// HelmOperation returns a status of the release operation.
+func (s Service) HelmOperation(ctx context.Context, kubeID, opID string) (*HelmOperation, error) {
+	op, ok := s.helmOps.get(kubeID, opID)
+	if !ok {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "operation %s", opID)
+	}
+
+	return op, nil
+}
+
+// OnHelmOperationDone registers fn to be called when any release operation finishes.
+func (s Service) OnHelmOperationDone(fn func(HelmOperation)) {
+	if s.helmOps == nil {
+		return
+	}
+	s.helmOps.subscribe(fn)
+}
+
+func (s Service) kubeHelmClient(ctx context.Context, kubeID string) (proxy.Interface, error) {
+	kube, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube")
+	}
+	kprx, err := s.helmClient(kube)
+	if err != nil {
+		return nil, errors.Wrap(err, "build helm proxy")
+	}
+
+	return kprx, nil
+}
+
 func (s Service) helmClient(k *model.Kube) (proxy.Interface, error) {
 	if s.newHelmProxyFn == nil {
 		return nil, ErrNoHelmProxy
@@ -439,6 +835,7 @@ func toReleaseInfo(rls *release.Release) *model.ReleaseInfo {
 		Chart:        rls.GetChart().Metadata.Name,
 		ChartVersion: rls.GetChart().Metadata.Version,
 		Status:       rls.GetInfo().Status.Code.String(),
+		Description:  rls.GetInfo().GetDescription(),
 	}
 }
 
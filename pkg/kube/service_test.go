@@ -24,6 +24,8 @@ import (
 	"github.com/supergiant/control/pkg/runner/ssh"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/sghelm/proxy"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/testutils"
 	"github.com/supergiant/control/pkg/testutils/storage"
 )
@@ -58,14 +60,20 @@ type fakeHelmProxy struct {
 
 	err               error
 	installRlsResp    *services.InstallReleaseResponse
+	updateRlsResp     *services.UpdateReleaseResponse
 	getReleaseResp    *services.GetReleaseContentResponse
 	listReleaseResp   *services.ListReleasesResponse
 	uninstReleaseResp *services.UninstallReleaseResponse
+	rollbackRlsResp   *services.RollbackReleaseResponse
+	historyResp       *services.GetHistoryResponse
 }
 
 func (p *fakeHelmProxy) InstallReleaseFromChart(chart *chart.Chart, namespace string, opts ...helm.InstallOption) (*services.InstallReleaseResponse, error) {
 	return p.installRlsResp, p.err
 }
+func (p *fakeHelmProxy) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, opts ...helm.UpdateOption) (*services.UpdateReleaseResponse, error) {
+	return p.updateRlsResp, p.err
+}
 func (p *fakeHelmProxy) ListReleases(opts ...helm.ReleaseListOption) (*services.ListReleasesResponse, error) {
 	return p.listReleaseResp, p.err
 }
@@ -75,6 +83,12 @@ func (p *fakeHelmProxy) ReleaseContent(rlsName string, opts ...helm.ContentOptio
 func (p *fakeHelmProxy) DeleteRelease(rlsName string, opts ...helm.DeleteOption) (*services.UninstallReleaseResponse, error) {
 	return p.uninstReleaseResp, p.err
 }
+func (p *fakeHelmProxy) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*services.GetHistoryResponse, error) {
+	return p.historyResp, p.err
+}
+func (p *fakeHelmProxy) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*services.RollbackReleaseResponse, error) {
+	return p.rollbackRlsResp, p.err
+}
 
 type mockServerResourceGetter struct {
 	resources []*metav1.APIResourceList
@@ -210,6 +224,13 @@ func TestService_InstallRelease(t *testing.T) {
 			expectedErr: sgerrors.ErrNilEntity,
 		},
 		{ // TC#2
+			rlsInput: &ReleaseInput{
+				Name:    "fake",
+				Timeout: maxReleaseTimeout + 1,
+			},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{ // TC#3
 			rlsInput: &ReleaseInput{
 				Name: "fake",
 			},
@@ -220,7 +241,7 @@ func TestService_InstallRelease(t *testing.T) {
 			},
 			expectedErr: errFake,
 		},
-		{ // TC#3
+		{ // TC#4
 			rlsInput: &ReleaseInput{
 				Name: "fake",
 			},
@@ -232,7 +253,7 @@ func TestService_InstallRelease(t *testing.T) {
 			},
 			expectedErr: errFake,
 		},
-		{ // TC#4
+		{ // TC#5
 			rlsInput: &ReleaseInput{
 				Name: "fake",
 			},
@@ -247,7 +268,7 @@ func TestService_InstallRelease(t *testing.T) {
 			},
 			expectedErr: errFake,
 		},
-		{ // TC#5
+		{ // TC#6
 			rlsInput: &ReleaseInput{
 				Name: "fake",
 			},
@@ -264,9 +285,11 @@ func TestService_InstallRelease(t *testing.T) {
 			},
 			expectedErr: errFake,
 		},
-		{ // TC#6
+		{ // TC#7
 			rlsInput: &ReleaseInput{
-				Name: "fake",
+				Name:    "fake",
+				Wait:    true,
+				Timeout: 480,
 			},
 			svc: Service{
 				chrtGetter: &fakeChartGetter{},
@@ -295,6 +318,108 @@ func TestService_InstallRelease(t *testing.T) {
 	}
 }
 
+func TestService_InstallReleaseDryRun(t *testing.T) {
+	rendered := &release.Release{Name: "fake", Manifest: "kind: Deployment"}
+	svc := Service{
+		chrtGetter: &fakeChartGetter{},
+		storage: &storage.Fake{
+			Item: []byte(`{"id":"kube"}`),
+		},
+		newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+			return &fakeHelmProxy{
+				installRlsResp: &services.InstallReleaseResponse{
+					Release: rendered,
+				},
+			}, nil
+		},
+		helmOps: newHelmQueue(),
+	}
+
+	rls, err := svc.InstallRelease(context.Background(), "kube", &ReleaseInput{Name: "fake", DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, "kind: Deployment", rls.Manifest)
+	require.Empty(t, svc.helmOps.list("kube"), "dry runs are not operations")
+}
+
+func TestService_UpgradeRelease(t *testing.T) {
+	tcs := []struct {
+		svc      Service
+		rlsInput *ReleaseInput
+
+		expectedRes *release.Release
+		expectedErr error
+	}{
+		{ // TC#1
+			expectedErr: sgerrors.ErrNilEntity,
+		},
+		{ // TC#2
+			rlsInput:    &ReleaseInput{Timeout: -1},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{ // TC#3
+			rlsInput: &ReleaseInput{},
+			svc: Service{
+				chrtGetter: fakeChartGetter{
+					err: errFake,
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#4
+			rlsInput: &ReleaseInput{},
+			svc: Service{
+				chrtGetter: &fakeChartGetter{},
+				storage: &storage.Fake{
+					GetErr: errFake,
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#5
+			rlsInput: &ReleaseInput{},
+			svc: Service{
+				chrtGetter: &fakeChartGetter{},
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						err: errFake,
+					}, nil
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#6
+			rlsInput: &ReleaseInput{},
+			svc: Service{
+				chrtGetter: &fakeChartGetter{},
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						updateRlsResp: &services.UpdateReleaseResponse{
+							Release: fakeRls,
+						},
+					}, nil
+				},
+				helmOps: newHelmQueue(),
+			},
+			expectedRes: fakeRls,
+		},
+	}
+
+	for i, tc := range tcs {
+		rls, err := tc.svc.UpgradeRelease(context.Background(), "kube", "fake", tc.rlsInput)
+		require.Equalf(t, tc.expectedErr, errors.Cause(err), "TC#%d: check errors", i+1)
+
+		if err == nil {
+			require.Equalf(t, tc.expectedRes, rls, "TC#%d: check results", i+1)
+		}
+	}
+}
+
 func TestService_ReleaseDetails(t *testing.T) {
 	tcs := []struct {
 		svc Service
@@ -513,6 +638,187 @@ func TestService_DeleteRelease(t *testing.T) {
 	}
 }
 
+func TestService_ReleaseHistory(t *testing.T) {
+	rev := func(version int32, description string) *release.Release {
+		return &release.Release{
+			Name:    fakeRls.Name,
+			Version: version,
+			Info: &release.Info{
+				FirstDeployed: &timestamp.Timestamp{},
+				LastDeployed:  &timestamp.Timestamp{},
+				Status:        &release.Status{Code: release.Status_SUPERSEDED},
+				Description:   description,
+			},
+			Chart: fakeRls.Chart,
+		}
+	}
+
+	tcs := []struct {
+		svc Service
+
+		expectedVersions     []int32
+		expectedDescriptions []string
+		expectedErr          error
+	}{
+		{ // TC#1
+			svc: Service{
+				storage: &storage.Fake{
+					GetErr: errFake,
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#2
+			svc: Service{
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						err: errFake,
+					}, nil
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#3
+			svc: Service{
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						historyResp: &services.GetHistoryResponse{
+							Releases: []*release.Release{
+								rev(1, "Install complete"), nil, rev(3, "Rollback to 1"), rev(2, "Upgrade complete"),
+							},
+						},
+					}, nil
+				},
+			},
+			expectedVersions:     []int32{3, 2, 1},
+			expectedDescriptions: []string{"Rollback to 1", "Upgrade complete", "Install complete"},
+		},
+	}
+
+	for i, tc := range tcs {
+		history, err := tc.svc.ReleaseHistory(context.Background(), "testCluster", "fake", 0)
+		require.Equalf(t, tc.expectedErr, errors.Cause(err), "TC#%d: check errors", i+1)
+
+		if err == nil {
+			versions, descriptions := make([]int32, 0), make([]string, 0)
+			for _, rls := range history {
+				versions = append(versions, rls.Version)
+				descriptions = append(descriptions, rls.Description)
+			}
+			require.Equalf(t, tc.expectedVersions, versions, "TC#%d: check versions", i+1)
+			require.Equalf(t, tc.expectedDescriptions, descriptions, "TC#%d: check descriptions", i+1)
+		}
+	}
+}
+
+func TestService_RollbackRelease(t *testing.T) {
+	tcs := []struct {
+		svc      Service
+		revision int32
+
+		expectedRes *model.ReleaseInfo
+		expectedErr error
+	}{
+		{ // TC#1
+			revision:    -1,
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{ // TC#2
+			svc: Service{
+				storage: &storage.Fake{
+					GetErr: errFake,
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#3
+			svc: Service{
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						err: errFake,
+					}, nil
+				},
+			},
+			expectedErr: errFake,
+		},
+		{ // TC#4
+			revision: 2,
+			svc: Service{
+				storage: &storage.Fake{
+					Item: []byte("{}"),
+				},
+				newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+					return &fakeHelmProxy{
+						rollbackRlsResp: &services.RollbackReleaseResponse{
+							Release: fakeRls,
+						},
+					}, nil
+				},
+			},
+			expectedRes: toReleaseInfo(fakeRls),
+		},
+	}
+
+	for i, tc := range tcs {
+		rls, err := tc.svc.RollbackRelease(context.Background(), "testCluster", "fake", tc.revision)
+		require.Equalf(t, tc.expectedErr, errors.Cause(err), "TC#%d: check errors", i+1)
+
+		if err == nil {
+			require.Equalf(t, tc.expectedRes, rls, "TC#%d: check results", i+1)
+		}
+	}
+}
+
+func TestService_DeleteReleaseAsync(t *testing.T) {
+	svc := Service{
+		storage: &storage.Fake{
+			Item: []byte("{}"),
+		},
+		newHelmProxyFn: func(kube *model.Kube) (proxy.Interface, error) {
+			return &fakeHelmProxy{
+				uninstReleaseResp: &services.UninstallReleaseResponse{
+					Release: fakeRls,
+				},
+			}, nil
+		},
+		helmOps: newHelmQueue(),
+	}
+
+	done := make(chan HelmOperation, 1)
+	svc.OnHelmOperationDone(func(op HelmOperation) {
+		done <- op
+	})
+
+	op, err := svc.DeleteReleaseAsync(context.Background(), "kube", fakeRls.GetName(), true)
+	require.Nil(t, err)
+	require.Equal(t, HelmOpDelete, op.Type)
+
+	finished := <-done
+	require.Equal(t, op.ID, finished.ID)
+	require.Equal(t, HelmOpSucceeded, finished.Status)
+	require.Equal(t, fakeRls.GetName(), finished.Result.Name)
+
+	polled, err := svc.HelmOperation(context.Background(), "kube", op.ID)
+	require.Nil(t, err)
+	require.Equal(t, HelmOpSucceeded, polled.Status)
+
+	_, err = svc.HelmOperation(context.Background(), "kube", "unknown")
+	require.True(t, sgerrors.IsNotFound(err))
+
+	_, err = Service{storage: &storage.Fake{GetErr: errFake}}.
+		DeleteReleaseAsync(context.Background(), "kube", fakeRls.GetName(), true)
+	require.Equal(t, errFake, errors.Cause(err))
+}
+
 func TestService_Delete(t *testing.T) {
 	testCases := []struct {
 		repoErr error
@@ -761,7 +1067,7 @@ func TestService_GetKubeResources(t *testing.T) {
 
 		_, err := svc.GetKubeResources(context.Background(),
 			"kube-name-1234", testCase.resourceName,
-			"namaspace", testCase.resourceName)
+			"namaspace", testCase.resourceName, metav1.ListOptions{})
 
 		if errors.Cause(err) != testCase.expectedErr {
 			t.Errorf("expected error %v actual %v",
@@ -934,3 +1240,72 @@ func TestService_GetCerts(t *testing.T) {
 		}
 	}
 }
+
+func TestKubeServiceTenants(t *testing.T) {
+	service := NewService(DefaultStoragePrefix, tenant.NewStorage(memory.NewInMemoryRepository()), nil)
+	acme := tenant.WithID(context.Background(), "acme")
+	other := tenant.WithID(context.Background(), "other")
+
+	k := &model.Kube{ID: "kube"}
+	require.NoError(t, service.Create(acme, k))
+	require.Equal(t, "acme", k.TenantID)
+
+	_, err := service.Get(other, k.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+	_, err = service.Get(context.Background(), k.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+	require.True(t, sgerrors.IsNotFound(errors.Cause(service.Create(other, k))))
+
+	// background updates keep the kube within its tenant
+	k.Name = "updated"
+	require.NoError(t, service.Create(context.Background(), k))
+
+	got, err := service.Get(acme, k.ID)
+	require.NoError(t, err)
+	require.Equal(t, "updated", got.Name)
+
+	kubes, err := service.ListAll(acme)
+	require.NoError(t, err)
+	require.Len(t, kubes, 1)
+
+	kubes, err = service.ListAll(other)
+	require.NoError(t, err)
+	require.Empty(t, kubes)
+
+	require.NoError(t, service.Create(context.Background(), &model.Kube{ID: "default"}))
+	kubes, err = service.ListAllTenants(context.Background())
+	require.NoError(t, err)
+	require.Len(t, kubes, 2)
+	require.Equal(t, tenant.DefaultID, kubes[0].TenantID)
+	require.Equal(t, "acme", kubes[1].TenantID)
+}
+
+func TestService_Update(t *testing.T) {
+	service := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	require.NoError(t, service.Create(context.Background(), &model.Kube{ID: "kube", Name: "name"}))
+
+	_, err := service.Update(context.Background(), "lost", func(*model.Kube) error { return nil })
+	require.True(t, sgerrors.IsNotFound(err))
+
+	_, err = service.Update(context.Background(), "kube", func(*model.Kube) error { return errFake })
+	require.Equal(t, errFake, errors.Cause(err))
+
+	// the kube saved by another request while the change is applied is read again
+	calls := 0
+	k, err := service.Update(context.Background(), "kube", func(k *model.Kube) error {
+		calls++
+		if calls == 1 {
+			require.NoError(t, service.Create(context.Background(), &model.Kube{ID: "kube", Name: "renamed"}))
+		}
+		k.Region = "fra1"
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, "renamed", k.Name)
+
+	k, err = service.Get(context.Background(), "kube")
+	require.NoError(t, err)
+	require.Equal(t, "renamed", k.Name)
+	require.Equal(t, "fra1", k.Region)
+}
@@ -0,0 +1,493 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	volumeSnapshotsResource        = "volumesnapshots"
+	volumeSnapshotContentsResource = "volumesnapshotcontents"
+	claimsResource                 = "persistentvolumeclaims"
+)
+
+var (
+	ErrSnapshotNotReady = errors.New("snapshot is not ready to use")
+	ErrSnapshotTarget   = errors.New("snapshots are restored on clusters of the same cloud account and region")
+
+	// snapshot crds are installed by the snapshot addon
+	snapshotGroupVersion = schema.GroupVersion{Group: "snapshot.storage.k8s.io", Version: "v1beta1"}
+	coreGroupVersion     = schema.GroupVersion{Version: "v1"}
+)
+
+// VolumeSnapshot is a csi snapshot of a persistent volume claim.
+type VolumeSnapshot struct {
+	Name          string    `json:"name"`
+	Namespace     string    `json:"namespace"`
+	Claim         string    `json:"claim,omitempty"`
+	SnapshotClass string    `json:"snapshotClass,omitempty"`
+	ContentName   string    `json:"contentName,omitempty"`
+	ReadyToUse    bool      `json:"readyToUse"`
+	RestoreSize   string    `json:"restoreSize,omitempty"`
+	CreatedAt     time.Time `json:"createdAt,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// SnapshotRequest selects claims of a namespace to snapshot, the default
+// snapshot class of their csi driver is used when the class is empty.
+type SnapshotRequest struct {
+	Namespace     string   `json:"namespace"`
+	Claims        []string `json:"claims"`
+	SnapshotClass string   `json:"snapshotClass"`
+}
+
+// RestoreRequest describes a claim the snapshot is restored into.
+type RestoreRequest struct {
+	// Claim is a name of the new claim, <snapshot>-restore by default
+	Claim     string `json:"claim"`
+	Namespace string `json:"namespace"`
+	// StorageClass of the new claim, the class of the snapshotted claim by default
+	StorageClass string `json:"storageClass"`
+	// TargetKubeID is a cluster the claim is created on, snapshots are
+	// imported to clusters of the same cloud account and region
+	TargetKubeID string `json:"targetKubeId"`
+}
+
+type snapshotObject struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Spec       snapshotSpec      `json:"spec"`
+	Status     *snapshotStatus   `json:"status,omitempty"`
+}
+
+type snapshotSpec struct {
+	Source struct {
+		PersistentVolumeClaimName string `json:"persistentVolumeClaimName,omitempty"`
+		VolumeSnapshotContentName string `json:"volumeSnapshotContentName,omitempty"`
+	} `json:"source"`
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+type snapshotStatus struct {
+	BoundVolumeSnapshotContentName string             `json:"boundVolumeSnapshotContentName,omitempty"`
+	CreationTime                   *metav1.Time       `json:"creationTime,omitempty"`
+	ReadyToUse                     bool               `json:"readyToUse"`
+	RestoreSize                    *resource.Quantity `json:"restoreSize,omitempty"`
+	Error                          *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type snapshotContentObject struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Metadata   metav1.ObjectMeta     `json:"metadata"`
+	Spec       snapshotContentSpec   `json:"spec"`
+	Status     *snapshotContentState `json:"status,omitempty"`
+}
+
+type snapshotContentSpec struct {
+	Driver         string `json:"driver"`
+	DeletionPolicy string `json:"deletionPolicy"`
+	Source         struct {
+		SnapshotHandle string `json:"snapshotHandle,omitempty"`
+	} `json:"source"`
+	VolumeSnapshotRef       corev1.ObjectReference `json:"volumeSnapshotRef"`
+	VolumeSnapshotClassName string                 `json:"volumeSnapshotClassName,omitempty"`
+}
+
+type snapshotContentState struct {
+	SnapshotHandle string `json:"snapshotHandle,omitempty"`
+}
+
+// claimObject is a persistent volume claim with a data source,
+// the field is missing in the vendored api.
+type claimObject struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Spec       struct {
+		AccessModes      []corev1.PersistentVolumeAccessMode `json:"accessModes"`
+		StorageClassName string                              `json:"storageClassName,omitempty"`
+		Resources        corev1.ResourceRequirements         `json:"resources"`
+		DataSource       *claimDataSource                    `json:"dataSource,omitempty"`
+	} `json:"spec"`
+}
+
+type claimDataSource struct {
+	APIGroup string `json:"apiGroup"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+}
+
+// CreateSnapshots takes snapshots of claims, they are ready to use once the
+// csi driver has cut them.
+func (s Service) CreateSnapshots(ctx context.Context, kname string, req *SnapshotRequest) ([]VolumeSnapshot, error) {
+	if len(req.Claims) == 0 {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, "no claims")
+	}
+	if req.Namespace == "" {
+		req.Namespace = metav1.NamespaceDefault
+	}
+
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.clientForGroupFn(k, snapshotGroupVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube client")
+	}
+
+	suffix := time.Now().UTC().Format("20060102150405")
+	snapshots := make([]VolumeSnapshot, 0, len(req.Claims))
+	for _, claim := range req.Claims {
+		obj := snapshotObject{
+			APIVersion: snapshotGroupVersion.String(),
+			Kind:       "VolumeSnapshot",
+			Metadata: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s", claim, suffix),
+				Namespace: req.Namespace,
+			},
+		}
+		obj.Spec.Source.PersistentVolumeClaimName = claim
+		obj.Spec.VolumeSnapshotClassName = req.SnapshotClass
+
+		if err = create(client, req.Namespace, volumeSnapshotsResource, &obj); err != nil {
+			return snapshots, errors.Wrapf(err, "snapshot claim %s", claim)
+		}
+		snapshots = append(snapshots, obj.toSnapshot())
+	}
+
+	return snapshots, nil
+}
+
+// ListSnapshots returns snapshots of the namespace, snapshots of all
+// namespaces are returned when it's empty.
+func (s Service) ListSnapshots(ctx context.Context, kname, ns string) ([]VolumeSnapshot, error) {
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.clientForGroupFn(k, snapshotGroupVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube client")
+	}
+
+	raw, err := inNamespace(client.Get(), ns).Resource(volumeSnapshotsResource).DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "list snapshots")
+	}
+
+	list := struct {
+		Items []snapshotObject `json:"items"`
+	}{}
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.Wrap(err, "decode snapshots")
+	}
+
+	snapshots := make([]VolumeSnapshot, 0, len(list.Items))
+	for _, obj := range list.Items {
+		snapshots = append(snapshots, obj.toSnapshot())
+	}
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot creates a claim from the snapshot. Snapshots restored to other
+// namespaces or clusters are imported there by the handle of their content first.
+func (s Service) RestoreSnapshot(ctx context.Context, kname, ns, name string, req *RestoreRequest) error {
+	k, err := s.Get(ctx, kname)
+	if err != nil {
+		return err
+	}
+	client, err := s.clientForGroupFn(k, snapshotGroupVersion)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	snapshot := snapshotObject{}
+	if err = get(client, ns, volumeSnapshotsResource, name, &snapshot); err != nil {
+		return errors.Wrapf(err, "get snapshot %s/%s", ns, name)
+	}
+	if snapshot.Status == nil || !snapshot.Status.ReadyToUse || snapshot.Status.RestoreSize == nil {
+		return errors.Wrapf(ErrSnapshotNotReady, "snapshot %s/%s", ns, name)
+	}
+
+	if req.Claim == "" {
+		req.Claim = name + "-restore"
+	}
+	if req.Namespace == "" {
+		req.Namespace = ns
+	}
+	if req.StorageClass == "" {
+		req.StorageClass = s.claimStorageClass(k, ns, snapshot.Spec.Source.PersistentVolumeClaimName)
+	}
+
+	target := k
+	if req.TargetKubeID == "" {
+		req.TargetKubeID = k.ID
+	}
+	if req.TargetKubeID != k.ID {
+		if target, err = s.Get(ctx, req.TargetKubeID); err != nil {
+			return err
+		}
+		if target.Provider != k.Provider || target.AccountName != k.AccountName || target.Region != k.Region {
+			return errors.Wrapf(ErrSnapshotTarget, "cluster %s", target.ID)
+		}
+	}
+
+	source := name
+	if target.ID != k.ID || req.Namespace != ns {
+		if source, err = s.importSnapshot(k, target, snapshot, req.Namespace); err != nil {
+			return errors.Wrapf(err, "import snapshot %s/%s", ns, name)
+		}
+	}
+
+	claim := claimObject{
+		APIVersion: coreGroupVersion.String(),
+		Kind:       "PersistentVolumeClaim",
+		Metadata: metav1.ObjectMeta{
+			Name:      req.Claim,
+			Namespace: req.Namespace,
+		},
+	}
+	claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	claim.Spec.StorageClassName = req.StorageClass
+	claim.Spec.Resources.Requests = corev1.ResourceList{
+		corev1.ResourceStorage: *snapshot.Status.RestoreSize,
+	}
+	claim.Spec.DataSource = &claimDataSource{
+		APIGroup: snapshotGroupVersion.Group,
+		Kind:     "VolumeSnapshot",
+		Name:     source,
+	}
+
+	coreClient, err := s.clientForGroupFn(target, coreGroupVersion)
+	if err != nil {
+		return errors.Wrap(err, "get kube client")
+	}
+
+	return errors.Wrapf(create(coreClient, req.Namespace, claimsResource, &claim),
+		"create claim %s/%s", req.Namespace, req.Claim)
+}
+
+// importSnapshot creates a pre-provisioned snapshot with a handle of the
+// snapshot in the target namespace, the content is retained when it is
+// deleted, so the snapshot of the cloud stays with the source cluster.
+func (s Service) importSnapshot(k, target *model.Kube, snapshot snapshotObject, ns string) (string, error) {
+	client, err := s.clientForGroupFn(k, snapshotGroupVersion)
+	if err != nil {
+		return "", errors.Wrap(err, "get kube client")
+	}
+
+	content := snapshotContentObject{}
+	err = get(client, "", volumeSnapshotContentsResource, snapshot.Status.BoundVolumeSnapshotContentName, &content)
+	if err != nil {
+		return "", errors.Wrap(err, "get snapshot content")
+	}
+	if content.Status == nil || content.Status.SnapshotHandle == "" {
+		return "", ErrSnapshotNotReady
+	}
+
+	name := fmt.Sprintf("%s-%s", snapshot.Metadata.Name, k.ID)
+	imported := snapshotContentObject{
+		APIVersion: snapshotGroupVersion.String(),
+		Kind:       "VolumeSnapshotContent",
+		Metadata: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s-%s", ns, name),
+		},
+		Spec: snapshotContentSpec{
+			Driver:         content.Spec.Driver,
+			DeletionPolicy: "Retain",
+			VolumeSnapshotRef: corev1.ObjectReference{
+				Namespace: ns,
+				Name:      name,
+			},
+			VolumeSnapshotClassName: content.Spec.VolumeSnapshotClassName,
+		},
+	}
+	imported.Spec.Source.SnapshotHandle = content.Status.SnapshotHandle
+
+	obj := snapshotObject{
+		APIVersion: snapshotGroupVersion.String(),
+		Kind:       "VolumeSnapshot",
+		Metadata: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+	}
+	obj.Spec.Source.VolumeSnapshotContentName = imported.Metadata.Name
+	obj.Spec.VolumeSnapshotClassName = snapshot.Spec.VolumeSnapshotClassName
+
+	targetClient, err := s.clientForGroupFn(target, snapshotGroupVersion)
+	if err != nil {
+		return "", errors.Wrap(err, "get kube client")
+	}
+	if err = create(targetClient, "", volumeSnapshotContentsResource, &imported); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return "", errors.Wrap(err, "create snapshot content")
+	}
+	if err = create(targetClient, ns, volumeSnapshotsResource, &obj); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return "", errors.Wrap(err, "create snapshot")
+	}
+
+	return name, nil
+}
+
+// claimStorageClass returns a class of the claim, the default class
+// is used for claims that are gone.
+func (s Service) claimStorageClass(k *model.Kube, ns, name string) string {
+	client, err := s.clientForGroupFn(k, coreGroupVersion)
+	if err != nil || name == "" {
+		return ""
+	}
+
+	claim := corev1.PersistentVolumeClaim{}
+	if err = get(client, ns, claimsResource, name, &claim); err != nil || claim.Spec.StorageClassName == nil {
+		return ""
+	}
+
+	return *claim.Spec.StorageClassName
+}
+
+func (obj snapshotObject) toSnapshot() VolumeSnapshot {
+	snapshot := VolumeSnapshot{
+		Name:          obj.Metadata.Name,
+		Namespace:     obj.Metadata.Namespace,
+		Claim:         obj.Spec.Source.PersistentVolumeClaimName,
+		SnapshotClass: obj.Spec.VolumeSnapshotClassName,
+	}
+	if st := obj.Status; st != nil {
+		snapshot.ContentName = st.BoundVolumeSnapshotContentName
+		snapshot.ReadyToUse = st.ReadyToUse
+		if st.RestoreSize != nil {
+			snapshot.RestoreSize = st.RestoreSize.String()
+		}
+		if st.CreationTime != nil {
+			snapshot.CreatedAt = st.CreationTime.Time
+		}
+		if st.Error != nil {
+			snapshot.Error = st.Error.Message
+		}
+	}
+
+	return snapshot
+}
+
+func get(client rest.Interface, ns, resource, name string, out interface{}) error {
+	raw, err := inNamespace(client.Get(), ns).Resource(resource).Name(name).DoRaw()
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return errors.Wrapf(sgerrors.ErrNotFound, "%s %s", resource, name)
+		}
+		return err
+	}
+
+	return json.Unmarshal(raw, out)
+}
+
+func create(client rest.Interface, ns, resource string, obj interface{}) error {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return inNamespace(client.Post(), ns).Resource(resource).Body(body).Do().Error()
+}
+
+// inNamespace scopes the request to the namespace, requests
+// of cluster resources and all namespaces are left as they are.
+func inNamespace(req *rest.Request, ns string) *rest.Request {
+	if ns == "" {
+		return req
+	}
+	return req.Namespace(ns)
+}
+
+func (h *Handler) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	snapshots, err := h.svc.ListSnapshots(r.Context(), kubeID, r.URL.Query().Get("namespace"))
+	if err != nil {
+		sendSnapshotError(w, kubeID, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(snapshots); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) createSnapshots(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := &SnapshotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	snapshots, err := h.svc.CreateSnapshots(r.Context(), kubeID, req)
+	if err != nil {
+		sendSnapshotError(w, kubeID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(snapshots); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// restoreSnapshot creates a claim from the snapshot, the claim is bound once
+// the volume has been provisioned from the snapshot.
+func (h *Handler) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	req := &RestoreRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+	}
+
+	err := h.svc.RestoreSnapshot(r.Context(), vars["kubeID"], vars["namespace"], vars["name"], req)
+	if err != nil {
+		sendSnapshotError(w, vars["namespace"]+"/"+vars["name"], err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(req); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func sendSnapshotError(w http.ResponseWriter, id string, err error) {
+	switch errors.Cause(err) {
+	case sgerrors.ErrNotFound:
+		message.SendNotFound(w, id, err)
+	case sgerrors.ErrInvalidJson, ErrSnapshotNotReady, ErrSnapshotTarget:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
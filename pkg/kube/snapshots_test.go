@@ -0,0 +1,332 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+)
+
+const (
+	snapshotsPath = "/apis/snapshot.storage.k8s.io/v1beta1/namespaces/default/volumesnapshots"
+	contentsPath  = "/apis/snapshot.storage.k8s.io/v1beta1/volumesnapshotcontents"
+	claimsPath    = "/api/v1/namespaces/default/persistentvolumeclaims"
+)
+
+// fakeAPIServer keeps objects by their paths, lists are served as they are stored.
+type fakeAPIServer struct {
+	*httptest.Server
+	objects map[string]string
+}
+
+func newFakeAPIServer(t *testing.T, objects map[string]string) *fakeAPIServer {
+	f := &fakeAPIServer{objects: objects}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			obj := struct {
+				Metadata metav1.ObjectMeta `json:"metadata"`
+			}{}
+			require.NoError(t, json.Unmarshal(body, &obj))
+			f.objects[r.URL.Path+"/"+obj.Metadata.Name] = string(body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+			return
+		}
+
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			require.NoError(t, json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			}))
+			return
+		}
+		_, _ = w.Write([]byte(obj))
+	}))
+
+	return f
+}
+
+func fakeClusterClients(servers map[string]*fakeAPIServer) func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error) {
+	return func(k *model.Kube, gv schema.GroupVersion) (rest.Interface, error) {
+		cfg := &rest.Config{
+			Host: servers[k.ID].URL,
+			ContentConfig: rest.ContentConfig{
+				NegotiatedSerializer: serializer.DirectCodecFactory{CodecFactory: scheme.Codecs},
+			},
+		}
+		setGroupDefaults(cfg, gv)
+		return rest.RESTClientFor(cfg)
+	}
+}
+
+func kubeStorage(kubes ...*model.Kube) *testutils.MockStorage {
+	repo := new(testutils.MockStorage)
+	for _, k := range kubes {
+		data, _ := json.Marshal(k)
+		repo.On("Get", mock.Anything, mock.Anything, k.ID).Return(data, nil)
+	}
+	repo.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil, sgerrors.ErrNotFound)
+
+	return repo
+}
+
+func TestService_CreateSnapshots(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		req         SnapshotRequest
+		expectedErr error
+	}{
+		{
+			name:        "no claims",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "ok",
+			req:  SnapshotRequest{Claims: []string{"data", "logs"}, SnapshotClass: "csi-aws"},
+		},
+	} {
+		srv := newFakeAPIServer(t, map[string]string{})
+		svc := Service{
+			storage:          kubeStorage(&model.Kube{ID: "kube"}),
+			clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": srv}),
+		}
+
+		snapshots, err := svc.CreateSnapshots(context.Background(), "kube", &tc.req)
+		srv.Close()
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		require.Len(t, snapshots, 2, "TC: %s", tc.name)
+		require.Len(t, srv.objects, 2, "TC: %s", tc.name)
+		for _, s := range snapshots {
+			require.Equal(t, "default", s.Namespace, "TC: %s", tc.name)
+			require.True(t, strings.HasPrefix(s.Name, s.Claim+"-"), "TC: %s", tc.name)
+			require.Contains(t, srv.objects[snapshotsPath+"/"+s.Name], `"volumeSnapshotClassName":"csi-aws"`)
+		}
+	}
+}
+
+func TestService_ListSnapshots(t *testing.T) {
+	srv := newFakeAPIServer(t, map[string]string{
+		snapshotsPath: `{"items": [
+			{"metadata": {"name": "data-1", "namespace": "default"},
+			 "spec": {"source": {"persistentVolumeClaimName": "data"}},
+			 "status": {"readyToUse": true, "restoreSize": "10Gi"}},
+			{"metadata": {"name": "data-2", "namespace": "default"},
+			 "spec": {"source": {"persistentVolumeClaimName": "data"}},
+			 "status": {"readyToUse": false, "error": {"message": "quota"}}}
+		]}`,
+	})
+	defer srv.Close()
+
+	svc := Service{
+		storage:          kubeStorage(&model.Kube{ID: "kube"}),
+		clientForGroupFn: fakeClusterClients(map[string]*fakeAPIServer{"kube": srv}),
+	}
+
+	snapshots, err := svc.ListSnapshots(context.Background(), "kube", "default")
+	require.NoError(t, err)
+	require.Equal(t, []VolumeSnapshot{
+		{Name: "data-1", Namespace: "default", Claim: "data", ReadyToUse: true, RestoreSize: "10Gi"},
+		{Name: "data-2", Namespace: "default", Claim: "data", Error: "quota"},
+	}, snapshots)
+}
+
+func TestService_RestoreSnapshot(t *testing.T) {
+	source := &model.Kube{ID: "kube", Provider: clouds.AWS, AccountName: "aws", Region: "us-east-1"}
+	sameRegion := &model.Kube{ID: "same", Provider: clouds.AWS, AccountName: "aws", Region: "us-east-1"}
+	otherRegion := &model.Kube{ID: "other", Provider: clouds.AWS, AccountName: "aws", Region: "eu-west-1"}
+
+	for _, tc := range []struct {
+		name     string
+		snapshot string
+		req      RestoreRequest
+
+		expectedErr     error
+		expectedClaim   string
+		expectedSource  string
+		expectedImports bool
+	}{
+		{
+			name:        "not found",
+			snapshot:    "missing",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "not ready",
+			snapshot:    "pending",
+			expectedErr: ErrSnapshotNotReady,
+		},
+		{
+			name:        "other region",
+			snapshot:    "ready",
+			req:         RestoreRequest{TargetKubeID: otherRegion.ID},
+			expectedErr: ErrSnapshotTarget,
+		},
+		{
+			name:           "same cluster",
+			snapshot:       "ready",
+			expectedClaim:  "ready-restore",
+			expectedSource: "ready",
+		},
+		{
+			name:            "other cluster",
+			snapshot:        "ready",
+			req:             RestoreRequest{Claim: "data", TargetKubeID: sameRegion.ID},
+			expectedClaim:   "data",
+			expectedSource:  "ready-kube",
+			expectedImports: true,
+		},
+	} {
+		servers := map[string]*fakeAPIServer{
+			source.ID: newFakeAPIServer(t, map[string]string{
+				snapshotsPath + "/pending": `{"metadata": {"name": "pending"}, "status": {"readyToUse": false}}`,
+				snapshotsPath + "/ready": `{"metadata": {"name": "ready", "namespace": "default"},
+					"spec": {"source": {"persistentVolumeClaimName": "db"}},
+					"status": {"readyToUse": true, "restoreSize": "10Gi", "boundVolumeSnapshotContentName": "content-1"}}`,
+				contentsPath + "/content-1": `{"spec": {"driver": "ebs.csi.aws.com"}, "status": {"snapshotHandle": "snap-1"}}`,
+				claimsPath + "/db":          `{"spec": {"storageClassName": "gp2"}}`,
+			}),
+			sameRegion.ID:  newFakeAPIServer(t, map[string]string{}),
+			otherRegion.ID: newFakeAPIServer(t, map[string]string{}),
+		}
+
+		svc := Service{
+			storage:          kubeStorage(source, sameRegion, otherRegion),
+			clientForGroupFn: fakeClusterClients(servers),
+		}
+
+		err := svc.RestoreSnapshot(context.Background(), "kube", "default", tc.snapshot, &tc.req)
+		for _, srv := range servers {
+			srv.Close()
+		}
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if err != nil {
+			continue
+		}
+
+		target := servers[tc.req.TargetKubeID]
+		claim := claimObject{}
+		require.NoError(t, json.Unmarshal([]byte(target.objects[claimsPath+"/"+tc.expectedClaim]), &claim), "TC: %s", tc.name)
+		require.Equal(t, "gp2", claim.Spec.StorageClassName, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedSource, claim.Spec.DataSource.Name, "TC: %s", tc.name)
+
+		content, imported := target.objects[contentsPath+"/default-ready-kube"]
+		require.Equal(t, tc.expectedImports, imported, "TC: %s", tc.name)
+		if imported {
+			require.Contains(t, content, `"snapshotHandle":"snap-1"`, "TC: %s", tc.name)
+			require.Contains(t, content, `"deletionPolicy":"Retain"`, "TC: %s", tc.name)
+			require.Contains(t, target.objects[snapshotsPath+"/ready-kube"], `"volumeSnapshotContentName":"default-ready-kube"`)
+		}
+	}
+}
+
+func TestHandler_restoreSnapshot(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "not ready",
+			svcErr:       ErrSnapshotNotReady,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "error",
+			svcErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "accepted",
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("RestoreSnapshot", mock.Anything, "kube", "default", "data-1", mock.Anything).Return(tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		body, _ := json.Marshal(RestoreRequest{Claim: "data"})
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/snapshots/default/data-1/restore", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
+
+func TestHandler_createSnapshots(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		svcErr       error
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "no claims",
+			body:         "{}",
+			svcErr:       sgerrors.ErrInvalidJson,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "accepted",
+			body:         `{"claims": ["data"]}`,
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("CreateSnapshots", mock.Anything, "kube", mock.Anything).
+			Return([]VolumeSnapshot{{Name: "data-1"}}, tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/snapshots", strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
@@ -0,0 +1,230 @@
+package kube
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+// certificates expiring within the window are listed in the summary
+const defaultCertWindowDays = 30
+
+// ClusterCounts are numbers of clusters grouped by their attributes.
+type ClusterCounts struct {
+	Total      int                     `json:"total"`
+	ByState    map[model.KubeState]int `json:"byState"`
+	ByProvider map[clouds.Name]int     `json:"byProvider"`
+	ByVersion  map[string]int          `json:"byVersion"`
+}
+
+// FailedTask is a task of a cluster that has finished with an error.
+type FailedTask struct {
+	KubeID     string    `json:"kubeId"`
+	KubeName   string    `json:"kubeName"`
+	TaskID     string    `json:"taskId"`
+	Type       string    `json:"type"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// CertExpiry is a certificate of a cluster that expires soon.
+type CertExpiry struct {
+	KubeID   string    `json:"kubeId"`
+	KubeName string    `json:"kubeName"`
+	Name     string    `json:"name"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// CostSummary sums up budgets of clusters, spend is known only for clouds
+// budgets can be read from.
+type CostSummary struct {
+	Tagged       int     `json:"tagged"`
+	Budgeted     int     `json:"budgeted"`
+	Amount       float64 `json:"amount"`
+	CurrentSpend float64 `json:"currentSpend"`
+	// OverBudget are clusters whose spend has crossed a threshold of the budget.
+	OverBudget []string `json:"overBudget"`
+	// Unavailable are clusters whose budget couldn't be read.
+	Unavailable []string `json:"unavailable"`
+}
+
+// Summary aggregates the fleet for the dashboard.
+type Summary struct {
+	Clusters     ClusterCounts `json:"clusters"`
+	Nodes        int           `json:"nodes"`
+	Masters      int           `json:"masters"`
+	FailedTasks  []FailedTask  `json:"failedTasks"`
+	CertExpiries []CertExpiry  `json:"certExpiries"`
+	Cost         CostSummary   `json:"cost"`
+}
+
+// getSummary returns fleet-wide aggregates:
+// GET /summary?certDays=30
+func (h *Handler) getSummary(w http.ResponseWriter, r *http.Request) {
+	days := defaultCertWindowDays
+	if v := r.URL.Query().Get("certDays"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "certDays %q", v))
+			return
+		}
+		days = n
+	}
+
+	summary, err := h.summary(r.Context(), time.Now().Add(time.Duration(days)*24*time.Hour))
+	if err != nil {
+		logrus.Errorf("kube: summary: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(summary); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) summary(ctx context.Context, certDeadline time.Time) (*Summary, error) {
+	kubes, err := h.svc.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	s := &Summary{
+		Clusters: ClusterCounts{
+			Total:      len(kubes),
+			ByState:    make(map[model.KubeState]int),
+			ByProvider: make(map[clouds.Name]int),
+			ByVersion:  make(map[string]int),
+		},
+		FailedTasks:  make([]FailedTask, 0),
+		CertExpiries: make([]CertExpiry, 0),
+		Cost: CostSummary{
+			OverBudget:  make([]string, 0),
+			Unavailable: make([]string, 0),
+		},
+	}
+
+	for i := range kubes {
+		k := &kubes[i]
+		s.Clusters.ByState[k.State]++
+		s.Clusters.ByProvider[k.Provider]++
+		s.Clusters.ByVersion[k.K8SVersion]++
+		s.Masters += len(k.Masters)
+		s.Nodes += len(k.Nodes)
+
+		tasks, err := h.tasksOf(ctx, k)
+		if err != nil {
+			logrus.Warnf("kube %s: summary: %v", k.ID, err)
+		}
+		for _, t := range tasks {
+			if t.Status != statuses.Error {
+				continue
+			}
+			s.FailedTasks = append(s.FailedTasks, FailedTask{
+				KubeID:     k.ID,
+				KubeName:   k.Title(),
+				TaskID:     t.ID,
+				Type:       t.Type,
+				FinishedAt: t.FinishedAt,
+			})
+		}
+
+		for name, cert := range map[string]string{"ca": k.Auth.CACert, "admin": k.Auth.AdminCert} {
+			notAfter, ok := certNotAfter(cert)
+			if ok && notAfter.Before(certDeadline) {
+				s.CertExpiries = append(s.CertExpiries, CertExpiry{
+					KubeID:   k.ID,
+					KubeName: k.Title(),
+					Name:     name,
+					NotAfter: notAfter,
+				})
+			}
+		}
+
+		if len(k.Cost.Tags) > 0 {
+			s.Cost.Tagged++
+		}
+	}
+
+	h.summarizeCost(ctx, kubes, &s.Cost)
+
+	sort.Slice(s.FailedTasks, func(i, j int) bool {
+		return s.FailedTasks[i].FinishedAt.After(s.FailedTasks[j].FinishedAt)
+	})
+	sort.Slice(s.CertExpiries, func(i, j int) bool {
+		return s.CertExpiries[i].NotAfter.Before(s.CertExpiries[j].NotAfter)
+	})
+
+	return s, nil
+}
+
+// summarizeCost reads budgets of clusters that have them concurrently,
+// they are kept by clouds.
+func (h *Handler) summarizeCost(ctx context.Context, kubes []model.Kube, cost *CostSummary) {
+	m := sync.Mutex{}
+	sem := make(chan struct{}, defaultFleetConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range kubes {
+		k := &kubes[i]
+		if k.Cost.Budget.Amount == 0 {
+			continue
+		}
+		cost.Budgeted++
+		cost.Amount += k.Cost.Budget.Amount
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			budget, err := h.budgets.ClusterBudget(ctx, k)
+
+			m.Lock()
+			defer m.Unlock()
+			switch {
+			case err == nil && budget != nil:
+				cost.CurrentSpend += budget.CurrentSpend
+				if len(budget.Exceeded) > 0 {
+					cost.OverBudget = append(cost.OverBudget, k.ID)
+				}
+			case err == nil || sgerrors.IsUnsupportedProvider(err):
+			default:
+				logrus.Warnf("kube %s: %v", k.ID, err)
+				cost.Unavailable = append(cost.Unavailable, k.ID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(cost.OverBudget)
+	sort.Strings(cost.Unavailable)
+}
+
+// certNotAfter returns the expiration of the pem encoded certificate.
+func certNotAfter(data string) (time.Time, bool) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return time.Time{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return cert.NotAfter, true
+}
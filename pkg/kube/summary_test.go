@@ -0,0 +1,157 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/testutils/storage"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+func TestCertNotAfter(t *testing.T) {
+	_, ok := certNotAfter("")
+	require.False(t, ok)
+
+	_, ok = certNotAfter("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n")
+	require.False(t, ok)
+
+	ca, err := pki.NewAgentCAPair()
+	require.NoError(t, err)
+	notAfter, ok := certNotAfter(string(ca.Cert))
+	require.True(t, ok)
+	require.True(t, notAfter.After(time.Now()))
+}
+
+func TestHandler_getSummary(t *testing.T) {
+	ca, err := pki.NewAgentCAPair()
+	require.NoError(t, err)
+	admin, err := pki.NewShortLivedPair(certutil.Config{CommonName: "admin"}, 48*time.Hour, ca)
+	require.NoError(t, err)
+
+	task, err := json.Marshal(&workflows.Task{ID: "task", Type: workflows.MasterTask, Status: statuses.Error})
+	require.NoError(t, err)
+
+	kubes := []model.Kube{
+		{
+			ID:         "prod",
+			Name:       "prod",
+			State:      model.StateOperational,
+			Provider:   clouds.Azure,
+			K8SVersion: "1.14.1",
+			Masters:    map[string]*model.Machine{"m-1": {}},
+			Nodes:      map[string]*model.Machine{"n-1": {}, "n-2": {}},
+			Auth:       model.Auth{CACert: string(ca.Cert), AdminCert: string(admin.Cert)},
+			Cost: profile.CostSettings{
+				Tags:   map[string]string{"costCenter": "analytics"},
+				Budget: profile.BudgetSettings{Amount: 100},
+			},
+		},
+		{
+			ID:         "dev",
+			Name:       "dev",
+			State:      model.StateFailed,
+			Provider:   clouds.AWS,
+			K8SVersion: "1.14.1",
+			Tasks:      map[string][]string{workflows.MasterTask: {"task"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		budgets  *fakeBudgets
+		listErr  error
+		expected int
+
+		certExpiries int
+		spend        float64
+		overBudget   []string
+		unavailable  []string
+	}{
+		{
+			name:     "list error",
+			budgets:  &fakeBudgets{},
+			listErr:  errFake,
+			expected: http.StatusInternalServerError,
+		},
+		{
+			name:     "invalid cert window",
+			query:    "?certDays=soon",
+			budgets:  &fakeBudgets{},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:         "summary",
+			budgets:      &fakeBudgets{budget: NewBudgetStatus("prod", 100, 90, "USD", []float64{80})},
+			expected:     http.StatusOK,
+			certExpiries: 1,
+			spend:        90,
+			overBudget:   []string{"prod"},
+			unavailable:  []string{},
+		},
+		{
+			name:        "budget unavailable",
+			query:       "?certDays=0",
+			budgets:     &fakeBudgets{err: errFake},
+			expected:    http.StatusOK,
+			overBudget:  []string{},
+			unavailable: []string{"prod"},
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceListAll, mock.Anything).Return(kubes, tc.listErr)
+
+		h := &Handler{
+			svc:     svc,
+			repo:    &storage.Fake{Item: task},
+			budgets: tc.budgets,
+		}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary"+tc.query, nil))
+
+		require.Equal(t, tc.expected, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		s := &Summary{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(s), "TC: %s", tc.name)
+		require.Equal(t, 2, s.Clusters.Total, "TC: %s", tc.name)
+		require.Equal(t, map[model.KubeState]int{model.StateOperational: 1, model.StateFailed: 1}, s.Clusters.ByState, "TC: %s", tc.name)
+		require.Equal(t, map[clouds.Name]int{clouds.Azure: 1, clouds.AWS: 1}, s.Clusters.ByProvider, "TC: %s", tc.name)
+		require.Equal(t, map[string]int{"1.14.1": 2}, s.Clusters.ByVersion, "TC: %s", tc.name)
+		require.Equal(t, 1, s.Masters, "TC: %s", tc.name)
+		require.Equal(t, 2, s.Nodes, "TC: %s", tc.name)
+
+		require.Len(t, s.FailedTasks, 1, "TC: %s", tc.name)
+		require.Equal(t, "dev", s.FailedTasks[0].KubeID, "TC: %s", tc.name)
+
+		require.Len(t, s.CertExpiries, tc.certExpiries, "TC: %s", tc.name)
+		if tc.certExpiries > 0 {
+			require.Equal(t, "admin", s.CertExpiries[0].Name, "TC: %s", tc.name)
+		}
+
+		require.Equal(t, 1, s.Cost.Tagged, "TC: %s", tc.name)
+		require.Equal(t, 1, s.Cost.Budgeted, "TC: %s", tc.name)
+		require.Equal(t, 100.0, s.Cost.Amount, "TC: %s", tc.name)
+		require.Equal(t, tc.spend, s.Cost.CurrentSpend, "TC: %s", tc.name)
+		require.Equal(t, tc.overBudget, s.Cost.OverBudget, "TC: %s", tc.name)
+		require.Equal(t, tc.unavailable, s.Cost.Unavailable, "TC: %s", tc.name)
+	}
+}
@@ -1,5 +1,11 @@
 package kube
 
+import (
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
 type ReleaseInput struct {
 	Name         string `json:"name"`
 	Namespace    string `json:"namespace"`
@@ -7,4 +13,24 @@ type ReleaseInput struct {
 	ChartVersion string `json:"chartVersion"`
 	RepoName     string `json:"repoName" valid:"required"`
 	Values       string `json:"values"`
+	// ReuseValues merges values with the ones of the deployed release on
+	// upgrade, otherwise the chart defaults are used.
+	ReuseValues bool `json:"reuseValues"`
+	// DryRun renders manifests of the release without installing it.
+	DryRun bool `json:"dryRun"`
+	// Wait makes tiller wait until resources of the release are ready.
+	Wait bool `json:"wait"`
+	// Timeout is seconds tiller waits for hooks and, with Wait, for the
+	// resources, releaseInstallTimeout is used when it's zero.
+	Timeout int64 `json:"timeout"`
+}
+
+func (r *ReleaseInput) timeout() (int64, error) {
+	switch {
+	case r.Timeout == 0:
+		return releaseInstallTimeout, nil
+	case r.Timeout < 0 || r.Timeout > maxReleaseTimeout:
+		return 0, errors.Wrapf(sgerrors.ErrInvalidJson, "timeout must be within 1..%d seconds", maxReleaseTimeout)
+	}
+	return r.Timeout, nil
 }
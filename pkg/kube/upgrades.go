@@ -0,0 +1,202 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/versions"
+)
+
+// UpgradeKubernetes is a component of upgrades of the cluster itself,
+// upgrades of releases are named after the release.
+const UpgradeKubernetes = "kubernetes"
+
+type versionCatalog interface {
+	Catalog(ctx context.Context) (*versions.Catalog, error)
+}
+
+// ChannelRequest pins a cluster to a release channel.
+type ChannelRequest struct {
+	Channel string `json:"channel"`
+}
+
+// RecommendedUpgrade is a version the release channel of the cluster offers
+// to upgrade kubernetes or a release to.
+type RecommendedUpgrade struct {
+	KubeID    string `json:"kubeId"`
+	KubeName  string `json:"kubeName"`
+	Channel   string `json:"channel"`
+	Component string `json:"component"`
+	Chart     string `json:"chart,omitempty"`
+	Current   string `json:"current"`
+	Target    string `json:"target"`
+}
+
+// UseVersions makes upgrades be proposed from the catalog instead of the default one.
+func (h *Handler) UseVersions(catalog versionCatalog) {
+	h.versions = catalog
+}
+
+// catalogOf returns the default catalog when none is used.
+func catalogOf(ctx context.Context, c versionCatalog) (*versions.Catalog, error) {
+	if c == nil {
+		d := versions.DefaultCatalog()
+		return &d, nil
+	}
+	return c.Catalog(ctx)
+}
+
+// setChannel pins the cluster to a release channel:
+// PUT /kubes/{kubeID}/channel {"channel": "rapid"}
+func (h *Handler) setChannel(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	req := ChannelRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if !versions.ValidChannel(req.Channel) {
+		message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "unknown channel %q", req.Channel))
+		return
+	}
+
+	k, err := h.svc.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if k.ReleaseChannel != req.Channel {
+		logrus.Infof("kube %s: release channel has been changed from %q to %q", kubeID, k.ReleaseChannel, req.Channel)
+	}
+	k.ReleaseChannel = req.Channel
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(k); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// recommendedUpgrades lists patch versions of kubernetes and chart versions
+// of releases that release channels of operational clusters offer.
+func (h *Handler) recommendedUpgrades(ctx context.Context, channel string) ([]RecommendedUpgrade, error) {
+	c, err := catalogOf(ctx, h.versions)
+	if err != nil {
+		return nil, errors.Wrap(err, "get version catalog")
+	}
+	kubes, err := h.svc.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list kubes")
+	}
+
+	pinned := make(map[string]*model.Kube, len(kubes))
+	ids := make([]string, 0, len(kubes))
+	out := make([]RecommendedUpgrade, 0)
+	for i := range kubes {
+		k := &kubes[i]
+		if k.State != model.StateOperational || (channel != "" && channelOf(k) != channel) {
+			continue
+		}
+		pinned[k.ID] = k
+		ids = append(ids, k.ID)
+
+		if v, ok := c.Upgrade(k.Provider, channelOf(k), k.K8SVersion); ok {
+			out = append(out, RecommendedUpgrade{
+				KubeID:    k.ID,
+				KubeName:  k.Title(),
+				Channel:   channelOf(k),
+				Component: UpgradeKubernetes,
+				Current:   k.K8SVersion,
+				Target:    v.Version,
+			})
+		}
+	}
+
+	if len(c.Addons) > 0 && len(ids) > 0 {
+		clusters, err := h.svc.ListFleetReleases(ctx, ReleaseFilter{KubeIDs: ids})
+		if err != nil {
+			return nil, errors.Wrap(err, "list releases")
+		}
+		for _, cr := range clusters {
+			k := pinned[cr.KubeID]
+			if k == nil {
+				continue
+			}
+			if cr.Error != "" {
+				logrus.Debugf("kube %s: recommended upgrades: %s", cr.KubeID, cr.Error)
+			}
+			for _, rls := range cr.Releases {
+				a, ok := c.AddonUpgrade(channelOf(k), rls.Chart, rls.ChartVersion)
+				if !ok {
+					continue
+				}
+				out = append(out, RecommendedUpgrade{
+					KubeID:    k.ID,
+					KubeName:  k.Title(),
+					Channel:   channelOf(k),
+					Component: rls.Name,
+					Chart:     rls.Chart,
+					Current:   rls.ChartVersion,
+					Target:    a.Version,
+				})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].KubeName != out[j].KubeName {
+			return out[i].KubeName < out[j].KubeName
+		}
+		// kubernetes goes before releases of the cluster
+		if (out[i].Component == UpgradeKubernetes) != (out[j].Component == UpgradeKubernetes) {
+			return out[i].Component == UpgradeKubernetes
+		}
+		return out[i].Component < out[j].Component
+	})
+	return out, nil
+}
+
+// listUpgrades returns pending upgrades of the fleet:
+// GET /kubes/upgrades?channel=stable
+func (h *Handler) listUpgrades(w http.ResponseWriter, r *http.Request) {
+	channel := r.URL.Query().Get("channel")
+	if !versions.ValidChannel(channel) {
+		message.SendValidationFailed(w, errors.Wrapf(sgerrors.ErrInvalidJson, "unknown channel %q", channel))
+		return
+	}
+
+	upgrades, err := h.recommendedUpgrades(r.Context(), channel)
+	if err != nil {
+		logrus.Errorf("kube: list recommended upgrades: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(upgrades); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func channelOf(k *model.Kube) string {
+	if k.ReleaseChannel == "" {
+		return versions.ChannelStable
+	}
+	return k.ReleaseChannel
+}
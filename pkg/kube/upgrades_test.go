@@ -0,0 +1,165 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/versions"
+)
+
+type fakeCatalog struct {
+	catalog versions.Catalog
+	err     error
+}
+
+func (c fakeCatalog) Catalog(ctx context.Context) (*versions.Catalog, error) {
+	return &c.catalog, c.err
+}
+
+func TestHandler_setChannel(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		getErr       error
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         `{`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown channel",
+			body:         `{"channel":"beta"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "get error",
+			body:         `{"channel":"rapid"}`,
+			getErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "ok",
+			body:         `{"channel":"rapid"}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{ID: "kube"}, tc.getErr)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kubes/kube/channel", bytes.NewBufferString(tc.body)))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		k := &model.Kube{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(k), "TC: %s", tc.name)
+		require.Equal(t, versions.ChannelRapid, k.ReleaseChannel, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_listUpgrades(t *testing.T) {
+	catalog := versions.Catalog{
+		Versions: []versions.Version{
+			{Version: "1.15.3"},
+			{Version: "1.15.5", Channel: versions.ChannelRapid},
+		},
+		Addons: []versions.Addon{
+			{Chart: "nginx-ingress", Version: "1.24.4", Channel: versions.ChannelRegular},
+		},
+	}
+	kubes := []model.Kube{
+		{ID: "1", Name: "prod", State: model.StateOperational, K8SVersion: "1.15.1"},
+		{ID: "2", Name: "dev", State: model.StateOperational, K8SVersion: "1.15.3", ReleaseChannel: versions.ChannelRapid},
+		{ID: "3", Name: "new", State: model.StateProvisioning, K8SVersion: "1.15.1"},
+	}
+	releases := []ClusterReleases{
+		{
+			KubeID: "1",
+			Releases: []*model.ReleaseInfo{
+				{Name: "ingress", Chart: "nginx-ingress", ChartVersion: "1.20.0"},
+			},
+		},
+		{
+			KubeID: "2",
+			Releases: []*model.ReleaseInfo{
+				{Name: "ingress", Chart: "nginx-ingress", ChartVersion: "1.20.0"},
+				{Name: "monitoring", Chart: "prometheus-operator", ChartVersion: "8.2.0"},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		query      string
+		catalogErr error
+
+		expectedCode     int
+		expectedUpgrades []RecommendedUpgrade
+	}{
+		{
+			name:         "unknown channel",
+			query:        "channel=beta",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "catalog error",
+			catalogErr:   errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "fleet",
+			expectedCode: http.StatusOK,
+			expectedUpgrades: []RecommendedUpgrade{
+				{KubeID: "2", KubeName: "dev", Channel: versions.ChannelRapid, Component: UpgradeKubernetes, Current: "1.15.3", Target: "1.15.5"},
+				{KubeID: "2", KubeName: "dev", Channel: versions.ChannelRapid, Component: "ingress", Chart: "nginx-ingress", Current: "1.20.0", Target: "1.24.4"},
+				{KubeID: "1", KubeName: "prod", Channel: versions.ChannelStable, Component: UpgradeKubernetes, Current: "1.15.1", Target: "1.15.3"},
+			},
+		},
+		{
+			name:         "channel",
+			query:        "channel=stable",
+			expectedCode: http.StatusOK,
+			expectedUpgrades: []RecommendedUpgrade{
+				{KubeID: "1", KubeName: "prod", Channel: versions.ChannelStable, Component: UpgradeKubernetes, Current: "1.15.1", Target: "1.15.3"},
+			},
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceListAll, mock.Anything).Return(kubes, nil)
+		svc.On(serviceFleetReleases, mock.Anything, mock.Anything).Return(releases, nil)
+
+		h := &Handler{svc: svc}
+		h.UseVersions(fakeCatalog{catalog: catalog, err: tc.catalogErr})
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/upgrades?"+tc.query, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		upgrades := make([]RecommendedUpgrade, 0)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&upgrades), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedUpgrades, upgrades, "TC: %s", tc.name)
+	}
+}
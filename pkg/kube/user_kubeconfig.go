@@ -0,0 +1,152 @@
+package kube
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientcmddapi "k8s.io/client-go/tools/clientcmd/api"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	defaultUserCertTTL = 30 * 24 * time.Hour
+	maxUserCertTTL     = 365 * 24 * time.Hour
+
+	// users and groups of kubernetes components
+	systemPrefix = "system:"
+)
+
+// UserKubeConfigRequest describes a kubeconfig of a user authenticated with
+// a client certificate, the api server takes groups of the user from
+// organizations of the certificate. Certificates can't be revoked, so they
+// expire after TTLHours, 30 days by default.
+type UserKubeConfigRequest struct {
+	Groups []string `json:"groups,omitempty"`
+	// Namespace is the default namespace of the context.
+	Namespace string `json:"namespace,omitempty"`
+	TTLHours  int    `json:"ttlHours,omitempty"`
+}
+
+func (r UserKubeConfigRequest) validate(user string) error {
+	if strings.TrimSpace(user) == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "user is required")
+	}
+	if user == KubernetesAdminUser || strings.HasPrefix(user, systemPrefix) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "%q user is reserved", user)
+	}
+	for _, g := range r.Groups {
+		if strings.TrimSpace(g) == "" {
+			return errors.Wrap(sgerrors.ErrInvalidJson, "empty group")
+		}
+		// system:masters bypasses rbac, the admin kubeconfig is there for it
+		if strings.HasPrefix(g, systemPrefix) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "%q group is reserved", g)
+		}
+	}
+	if r.Namespace != "" {
+		if errs := validation.IsDNS1123Label(r.Namespace); len(errs) > 0 {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "namespace %q: %v", r.Namespace, errs)
+		}
+	}
+	if r.TTLHours < 0 || time.Duration(r.TTLHours)*time.Hour > maxUserCertTTL {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "ttl must not exceed %d hours", int(maxUserCertTTL.Hours()))
+	}
+	return nil
+}
+
+func (r UserKubeConfigRequest) ttl() time.Duration {
+	if r.TTLHours == 0 {
+		return defaultUserCertTTL
+	}
+	return time.Duration(r.TTLHours) * time.Hour
+}
+
+// IssueKubeConfig signs a client certificate of the user with the cluster CA
+// and returns a kubeconfig bound to it. Permissions of the user are up to
+// rbac bindings of its name and groups, the certificate isn't stored.
+// Kubeconfigs with service account tokens are given by access grants.
+func (s Service) IssueKubeConfig(ctx context.Context, kubeID, user string, req UserKubeConfigRequest) ([]byte, error) {
+	if err := req.validate(user); err != nil {
+		return nil, err
+	}
+
+	k, err := s.Get(ctx, kubeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s model", kubeID)
+	}
+	// imported clusters may come without the key of their CA
+	if k.Auth.CACert == "" || k.Auth.CAKey == "" {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "ca of kube %s", kubeID)
+	}
+
+	kubeconfig, err := adminKubeConfig(k)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := pki.NewShortLivedPair(certutil.Config{
+		CommonName:   user,
+		Organization: req.Groups,
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, req.ttl(), &pki.PairPEM{
+		Cert: []byte(k.Auth.CACert),
+		Key:  []byte(k.Auth.CAKey),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "sign certificate of %s", user)
+	}
+
+	userContext := user + "@" + k.Name
+	kubeconfig.AuthInfos = map[string]*clientcmddapi.AuthInfo{
+		userContext: {
+			ClientCertificateData: pair.Cert,
+			ClientKeyData:         pair.Key,
+		},
+	}
+	kubeconfig.Contexts = map[string]*clientcmddapi.Context{
+		userContext: {
+			AuthInfo:  userContext,
+			Cluster:   k.Name,
+			Namespace: req.Namespace,
+		},
+	}
+	kubeconfig.CurrentContext = userContext
+
+	return encodeKubeConfig(kubeconfig)
+}
+
+// issueKubeconfig returns a kubeconfig with a new certificate of the user:
+// POST /kubes/{kubeID}/users/{uname}/kubeconfig
+func (h *Handler) issueKubeconfig(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, user := vars["kubeID"], vars["uname"]
+
+	// all fields are optional, so is the body
+	req := UserKubeConfigRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	data, err := h.svc.IssueKubeConfig(r.Context(), kubeID, user, req)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	if _, err = w.Write(data); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
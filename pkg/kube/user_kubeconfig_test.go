@@ -0,0 +1,220 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/pki"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestUserKubeConfigRequest_validate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		user        string
+		req         UserKubeConfigRequest
+		expectedErr error
+	}{
+		{
+			name:        "no user",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "admin",
+			user:        KubernetesAdminUser,
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "system user",
+			user:        "system:kube-scheduler",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "masters group",
+			user:        "jane",
+			req:         UserKubeConfigRequest{Groups: []string{"dev", pki.MastersGroup}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "empty group",
+			user:        "jane",
+			req:         UserKubeConfigRequest{Groups: []string{" "}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "namespace",
+			user:        "jane",
+			req:         UserKubeConfigRequest{Namespace: "Apps"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "ttl",
+			user:        "jane",
+			req:         UserKubeConfigRequest{TTLHours: 24*365 + 1},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "ok",
+			user: "jane",
+			req:  UserKubeConfigRequest{Groups: []string{"dev"}, Namespace: "apps", TTLHours: 24 * 365},
+		},
+	} {
+		err := tc.req.validate(tc.user)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+	}
+}
+
+func TestService_IssueKubeConfig(t *testing.T) {
+	ca, err := pki.NewAgentCAPair()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		kubeID string
+		user   string
+		req    UserKubeConfigRequest
+
+		expectedErr error
+		expectedTTL time.Duration
+	}{
+		{
+			name:        "invalid request",
+			kubeID:      "kube",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "kube not found",
+			kubeID:      "lost",
+			user:        "jane",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "no ca key",
+			kubeID:      "imported",
+			user:        "jane",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "default ttl",
+			kubeID:      "kube",
+			user:        "jane",
+			req:         UserKubeConfigRequest{Groups: []string{"dev", "ops"}},
+			expectedTTL: defaultUserCertTTL,
+		},
+		{
+			name:        "namespace",
+			kubeID:      "kube",
+			user:        "ci",
+			req:         UserKubeConfigRequest{Namespace: "apps", TTLHours: 2},
+			expectedTTL: 2 * time.Hour,
+		},
+	} {
+		svc := Service{
+			storage: kubeStorage(
+				&model.Kube{
+					ID:      "kube",
+					Name:    "prod",
+					APIPort: "443",
+					Masters: map[string]*model.Machine{"m": {PublicIp: "1.2.3.4"}},
+					Auth:    model.Auth{CACert: string(ca.Cert), CAKey: string(ca.Key)},
+				},
+				&model.Kube{
+					ID:      "imported",
+					Masters: map[string]*model.Machine{"m": {PublicIp: "1.2.3.4"}},
+					Auth:    model.Auth{CACert: string(ca.Cert)},
+				},
+			),
+		}
+
+		data, err := svc.IssueKubeConfig(context.Background(), tc.kubeID, tc.user, tc.req)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+		if err != nil {
+			continue
+		}
+
+		kubeconfig, err := clientcmd.Load(data)
+		require.NoError(t, err, "TC: %s", tc.name)
+		userContext := tc.user + "@prod"
+		require.Equal(t, userContext, kubeconfig.CurrentContext, "TC: %s", tc.name)
+		require.Equal(t, tc.req.Namespace, kubeconfig.Contexts[userContext].Namespace, "TC: %s", tc.name)
+		require.Equal(t, "https://1.2.3.4:443", kubeconfig.Clusters["prod"].Server, "TC: %s", tc.name)
+		require.Len(t, kubeconfig.AuthInfos, 1, "TC: %s", tc.name)
+
+		block, _ := pem.Decode(kubeconfig.AuthInfos[userContext].ClientCertificateData)
+		require.NotNil(t, block, "TC: %s", tc.name)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(ca.Cert)
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.user, cert.Subject.CommonName, "TC: %s", tc.name)
+		require.Equal(t, tc.req.Groups, cert.Subject.Organization, "TC: %s", tc.name)
+		require.WithinDuration(t, time.Now().Add(tc.expectedTTL), cert.NotAfter, time.Minute, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_issueKubeconfig(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		svcErr       error
+		expectedReq  UserKubeConfigRequest
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "validation failed",
+			body:         `{"groups":["system:masters"]}`,
+			svcErr:       sgerrors.ErrInvalidJson,
+			expectedReq:  UserKubeConfigRequest{Groups: []string{"system:masters"}},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			svcErr:       sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "ok",
+			body:         `{"groups":["dev"],"ttlHours":8}`,
+			expectedReq:  UserKubeConfigRequest{Groups: []string{"dev"}, TTLHours: 8},
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On("IssueKubeConfig", mock.Anything, "kube", "jane", tc.expectedReq).
+			Return([]byte("kubeconfig"), tc.svcErr)
+
+		h := Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/users/jane/kubeconfig", bytes.NewBufferString(tc.body))
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code == http.StatusOK {
+			require.Equal(t, "kubeconfig", rec.Body.String(), "TC: %s", tc.name)
+		}
+	}
+}
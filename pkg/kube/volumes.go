@@ -0,0 +1,370 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+// Disk is a cloud disk created for the cluster.
+type Disk struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name,omitempty"`
+	Type             string    `json:"type,omitempty"`
+	SizeGB           int64     `json:"sizeGb"`
+	AvailabilityZone string    `json:"availabilityZone,omitempty"`
+	State            string    `json:"state,omitempty"`
+	Attached         bool      `json:"attached"`
+	CreatedAt        time.Time `json:"createdAt,omitempty"`
+}
+
+// VolumeInfo is a persistent volume joined with the disk backing it.
+type VolumeInfo struct {
+	Name          string `json:"name"`
+	Claim         string `json:"claim,omitempty"`
+	StorageClass  string `json:"storageClass,omitempty"`
+	Capacity      string `json:"capacity,omitempty"`
+	Phase         string `json:"phase"`
+	ReclaimPolicy string `json:"reclaimPolicy,omitempty"`
+	DiskID        string `json:"diskId,omitempty"`
+	// Released volumes are not bound to claims anymore, their disks
+	// are kept until the volume is deleted.
+	Released bool  `json:"released"`
+	Disk     *Disk `json:"disk,omitempty"`
+}
+
+// VolumeReport lists persistent volumes of a cluster and the disks that still
+// incur cost, but are not used by the cluster.
+type VolumeReport struct {
+	KubeID    string       `json:"kubeId"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Volumes   []VolumeInfo `json:"volumes"`
+	// OrphanedDisks are detached disks of released volumes or
+	// disks that no volume refers to.
+	OrphanedDisks []Disk `json:"orphanedDisks"`
+	// DisksUnavailable is set when disks of the cloud can't be listed.
+	DisksUnavailable bool `json:"disksUnavailable,omitempty"`
+}
+
+// VolumeCleanupRequest selects orphaned disks to delete, disks are always
+// listed explicitly.
+type VolumeCleanupRequest struct {
+	DiskIDs []string `json:"diskIds"`
+}
+
+type diskLister interface {
+	ClusterDisks(ctx context.Context, k *model.Kube) ([]Disk, error)
+}
+
+type clusterDisksFn func(ctx context.Context, config *steps.Config, clusterName string) ([]Disk, error)
+
+// ClusterDisks returns disks tagged for the cluster, sgerrors.ErrUnsupportedProvider
+// is returned for clouds that can't be queried.
+func (c *CloudInstances) ClusterDisks(ctx context.Context, k *model.Kube) ([]Disk, error) {
+	var list clusterDisksFn
+	if k.Provider == clouds.AWS {
+		list = c.awsDisks
+	}
+	if list == nil || k.ExternallyManaged {
+		return nil, sgerrors.ErrUnsupportedProvider
+	}
+
+	config, err := c.config(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	disks, err := list(ctx, config, k.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %s disks", k.Provider)
+	}
+
+	return disks, nil
+}
+
+// BuildVolumeReport joins volumes with disks, a disk is orphaned when it is
+// detached and isn't used by a bound or pending volume. Disks of released
+// volumes that retain them are kept for their data to be recovered.
+func BuildVolumeReport(k *model.Kube, pvs []corev1.PersistentVolume, disks []Disk) *VolumeReport {
+	report := &VolumeReport{
+		KubeID:        k.ID,
+		CreatedAt:     time.Now(),
+		Volumes:       make([]VolumeInfo, 0, len(pvs)),
+		OrphanedDisks: make([]Disk, 0),
+	}
+
+	byID := make(map[string]Disk, len(disks))
+	for _, d := range disks {
+		byID[d.ID] = d
+	}
+
+	used := make(map[string]bool, len(pvs))
+	for _, pv := range pvs {
+		info := VolumeInfo{
+			Name:          pv.Name,
+			StorageClass:  pv.Spec.StorageClassName,
+			Phase:         string(pv.Status.Phase),
+			ReclaimPolicy: string(pv.Spec.PersistentVolumeReclaimPolicy),
+			DiskID:        volumeDiskID(pv),
+			Released: pv.Status.Phase == corev1.VolumeReleased ||
+				pv.Status.Phase == corev1.VolumeFailed,
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			info.Claim = ref.Namespace + "/" + ref.Name
+		}
+		if size, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+			info.Capacity = size.String()
+		}
+		if d, ok := byID[info.DiskID]; ok {
+			info.Disk = &d
+		}
+		retained := pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimRetain
+		if info.DiskID != "" && (!info.Released || retained) {
+			used[info.DiskID] = true
+		}
+
+		report.Volumes = append(report.Volumes, info)
+	}
+
+	for _, d := range disks {
+		if !d.Attached && !used[d.ID] {
+			report.OrphanedDisks = append(report.OrphanedDisks, d)
+		}
+	}
+
+	return report
+}
+
+// volumeDiskID returns the id of the cloud disk of the volume, ebs volumes
+// are referred as aws://us-east-1a/vol-1 by the in-tree provider.
+func volumeDiskID(pv corev1.PersistentVolume) string {
+	var id string
+	switch src := pv.Spec.PersistentVolumeSource; {
+	case src.AWSElasticBlockStore != nil:
+		id = src.AWSElasticBlockStore.VolumeID
+	case src.GCEPersistentDisk != nil:
+		id = src.GCEPersistentDisk.PDName
+	case src.AzureDisk != nil:
+		id = src.AzureDisk.DiskName
+	case src.CSI != nil:
+		id = src.CSI.VolumeHandle
+	}
+
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+func (h *Handler) volumeReport(r *http.Request, k *model.Kube) (*VolumeReport, error) {
+	pvs, err := h.listK8sVolumes(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "list persistent volumes")
+	}
+
+	disks, err := h.disks.ClusterDisks(r.Context(), k)
+	if err != nil && !sgerrors.IsUnsupportedProvider(err) {
+		return nil, err
+	}
+
+	report := BuildVolumeReport(k, pvs, disks)
+	report.DisksUnavailable = err != nil
+
+	return report, nil
+}
+
+func (h *Handler) getVolumes(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.volumeReport(r, k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// cleanupVolumes runs a workflow that deletes orphaned disks of the cluster.
+func (h *Handler) cleanupVolumes(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.getKubeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	req := VolumeCleanupRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			message.SendInvalidJSON(w, err)
+			return
+		}
+	}
+	if len(req.DiskIDs) == 0 {
+		message.SendValidationFailed(w, errors.Wrap(sgerrors.ErrInvalidJson, "disk ids are required"))
+		return
+	}
+
+	report, err := h.volumeReport(r, k)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if report.DisksUnavailable {
+		message.SendMessage(w, message.New("disks can't be deleted for "+string(k.Provider)+" clusters",
+			sgerrors.ErrUnsupportedProvider.Error(), sgerrors.UnsupportedProvider, ""), http.StatusBadRequest)
+		return
+	}
+
+	orphaned := make(map[string]bool, len(report.OrphanedDisks))
+	for _, d := range report.OrphanedDisks {
+		orphaned[d.ID] = true
+	}
+	// disks in use are never deleted
+	for _, id := range req.DiskIDs {
+		if !orphaned[id] {
+			message.SendNotFound(w, id, errors.Wrapf(sgerrors.ErrNotFound, "orphaned disk %s", id))
+			return
+		}
+	}
+
+	config := &steps.Config{
+		Kube:             *k,
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Masters:          steps.NewMap(k.Masters),
+		VolumeCleanupConfig: steps.VolumeCleanupConfig{
+			DiskIDs: req.DiskIDs,
+		},
+	}
+
+	acc, err := h.accountService.Get(r.Context(), k.AccountName)
+	if err != nil {
+		message.SendUnknownError(w, errors.Wrapf(err, "get cloud account %s", k.AccountName))
+		return
+	}
+	if err = util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, config); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	t, err := workflows.NewTask(workflows.DeleteDisks, h.repo)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	writer, err := h.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if k.Tasks == nil {
+		k.Tasks = make(map[string][]string)
+	}
+	k.Tasks[workflows.VolumesTask] = append(k.Tasks[workflows.VolumesTask], t.ID)
+	if err = h.svc.Create(r.Context(), k); err != nil {
+		message.SendUnknownError(w, errors.Wrapf(err, "update kube %s", k.ID))
+		return
+	}
+
+	go func() {
+		if err := <-t.Run(tenant.Detach(r.Context()), *config, writer); err != nil {
+			logrus.Errorf("delete orphaned disks of cluster %s: %v", k.ID, err)
+		}
+	}()
+
+	workflows.SendAccepted(w, t.ID, t.ID)
+}
+
+func listK8sVolumes(k *model.Kube) ([]corev1.PersistentVolume, error) {
+	cfg, err := NewConfigFor(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes rest config")
+	}
+	c, err := clientcorev1.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "build kubernetes client")
+	}
+
+	list, err := c.PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+func awsClusterDisks(ctx context.Context, config *steps.Config, clusterName string) ([]Disk, error) {
+	client, err := amazon.GetEC2(config.AWSConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "get ec2 client")
+	}
+
+	// volumes of the in-tree provider are tagged like instances of the cluster
+	disks := make([]Disk, 0)
+	err = client.DescribeVolumesPagesWithContext(ctx, &ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:KubernetesCluster"),
+				Values: aws.StringSlice([]string{clusterName}),
+			},
+		},
+	}, func(out *ec2.DescribeVolumesOutput, _ bool) bool {
+		for _, v := range out.Volumes {
+			disks = append(disks, ebsDisk(v))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return disks, nil
+}
+
+func ebsDisk(v *ec2.Volume) Disk {
+	d := Disk{
+		ID:               aws.StringValue(v.VolumeId),
+		Type:             aws.StringValue(v.VolumeType),
+		SizeGB:           aws.Int64Value(v.Size),
+		AvailabilityZone: aws.StringValue(v.AvailabilityZone),
+		State:            aws.StringValue(v.State),
+		Attached:         len(v.Attachments) > 0,
+		CreatedAt:        aws.TimeValue(v.CreateTime),
+	}
+	for _, tag := range v.Tags {
+		if aws.StringValue(tag.Key) == "Name" {
+			d.Name = aws.StringValue(tag.Value)
+		}
+	}
+
+	return d
+}
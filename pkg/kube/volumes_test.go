@@ -0,0 +1,276 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeDisks struct {
+	disks []Disk
+	err   error
+}
+
+func (f *fakeDisks) ClusterDisks(ctx context.Context, k *model.Kube) ([]Disk, error) {
+	return f.disks, f.err
+}
+
+func ebsVolume(name, volumeID string, phase corev1.PersistentVolumePhase) corev1.PersistentVolume {
+	return corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("10Gi"),
+			},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				AWSElasticBlockStore: &corev1.AWSElasticBlockStoreVolumeSource{VolumeID: volumeID},
+			},
+			ClaimRef: &corev1.ObjectReference{Namespace: "default", Name: name},
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: phase},
+	}
+}
+
+func TestBuildVolumeReport(t *testing.T) {
+	pvs := []corev1.PersistentVolume{
+		ebsVolume("bound", "aws://us-east-1a/vol-1", corev1.VolumeBound),
+		ebsVolume("released", "aws://us-east-1a/vol-2", corev1.VolumeReleased),
+		ebsVolume("released-attached", "vol-3", corev1.VolumeReleased),
+		ebsVolume("no-disk", "vol-9", corev1.VolumeBound),
+		ebsVolume("retained", "vol-5", corev1.VolumeReleased),
+		ebsVolume("retained-failed", "vol-6", corev1.VolumeFailed),
+	}
+	pvs[4].Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	pvs[5].Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	disks := []Disk{
+		{ID: "vol-1"},
+		{ID: "vol-2"},
+		{ID: "vol-3", Attached: true},
+		{ID: "vol-4"},
+		{ID: "vol-5"},
+		{ID: "vol-6"},
+	}
+
+	report := BuildVolumeReport(&model.Kube{ID: "kube"}, pvs, disks)
+
+	require.Equal(t, "kube", report.KubeID)
+	require.Len(t, report.Volumes, 6)
+	require.Equal(t, "default/bound", report.Volumes[0].Claim)
+	require.Equal(t, "10Gi", report.Volumes[0].Capacity)
+	require.Equal(t, "vol-1", report.Volumes[0].DiskID)
+	require.NotNil(t, report.Volumes[0].Disk)
+	require.False(t, report.Volumes[0].Released)
+	require.True(t, report.Volumes[1].Released)
+	require.Nil(t, report.Volumes[3].Disk)
+	require.Equal(t, []Disk{{ID: "vol-2"}, {ID: "vol-4"}}, report.OrphanedDisks)
+}
+
+func TestVolumeDiskID(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		source   corev1.PersistentVolumeSource
+		expected string
+	}{
+		{
+			name: "ebs",
+			source: corev1.PersistentVolumeSource{
+				AWSElasticBlockStore: &corev1.AWSElasticBlockStoreVolumeSource{VolumeID: "aws://us-east-1a/vol-1"},
+			},
+			expected: "vol-1",
+		},
+		{
+			name: "gce",
+			source: corev1.PersistentVolumeSource{
+				GCEPersistentDisk: &corev1.GCEPersistentDiskVolumeSource{PDName: "pd-1"},
+			},
+			expected: "pd-1",
+		},
+		{
+			name: "csi",
+			source: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "vol-2"},
+			},
+			expected: "vol-2",
+		},
+		{
+			name: "host path",
+			source: corev1.PersistentVolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: "/data"},
+			},
+		},
+	} {
+		pv := corev1.PersistentVolume{
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: tc.source},
+		}
+		require.Equal(t, tc.expected, volumeDiskID(pv), "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_getVolumes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		kubeErr  error
+		pvsErr   error
+		disksErr error
+
+		expectedCode        int
+		expectedUnavailable bool
+	}{
+		{
+			name:         "not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "list volumes error",
+			pvsErr:       errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "list disks error",
+			disksErr:     errFake,
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:                "unsupported provider",
+			disksErr:            sgerrors.ErrUnsupportedProvider,
+			expectedCode:        http.StatusOK,
+			expectedUnavailable: true,
+		},
+		{
+			name:         "ok",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(&model.Kube{ID: "kube"}, tc.kubeErr)
+
+		h := Handler{
+			svc:   svc,
+			disks: &fakeDisks{disks: []Disk{{ID: "vol-1"}}, err: tc.disksErr},
+			listK8sVolumes: func(*model.Kube) ([]corev1.PersistentVolume, error) {
+				return []corev1.PersistentVolume{ebsVolume("pv", "vol-1", corev1.VolumeBound)}, tc.pvsErr
+			},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/volumes", h.getVolumes)
+
+		req := httptest.NewRequest(http.MethodGet, "/kubes/kube/volumes", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		report := &VolumeReport{}
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(report))
+		require.Len(t, report.Volumes, 1, tc.name)
+		require.Equal(t, tc.expectedUnavailable, report.DisksUnavailable, tc.name)
+	}
+}
+
+func TestHandler_cleanupVolumes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		diskIDs  []string
+		disks    []Disk
+		disksErr error
+
+		expectedCode int
+	}{
+		{
+			name:         "unsupported provider",
+			diskIDs:      []string{"vol-2"},
+			disksErr:     sgerrors.ErrUnsupportedProvider,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "disk in use",
+			diskIDs:      []string{"vol-1"},
+			disks:        []Disk{{ID: "vol-1"}, {ID: "vol-2"}},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "no disks selected",
+			disks:        []Disk{{ID: "vol-1"}, {ID: "vol-2"}},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "selected disks",
+			diskIDs:      []string{"vol-3"},
+			disks:        []Disk{{ID: "vol-1"}, {ID: "vol-2"}, {ID: "vol-3"}},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "attached disk",
+			diskIDs:      []string{"vol-3"},
+			disks:        []Disk{{ID: "vol-1"}, {ID: "vol-2"}, {ID: "vol-3", Attached: true}},
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		workflows.Init()
+		workflows.RegisterWorkFlow(workflows.DeleteDisks, []steps.Step{})
+
+		k := &model.Kube{ID: "kube", Provider: clouds.AWS}
+		svc := new(kubeServiceMock)
+		svc.On(serviceGet, mock.Anything, "kube").Return(k, nil)
+		svc.On(serviceCreate, mock.Anything, mock.Anything).Return(nil)
+
+		accService := new(accServiceMock)
+		accService.On("Get", mock.Anything, mock.Anything).
+			Return(&model.CloudAccount{Provider: clouds.AWS}, nil)
+
+		mockRepo := new(testutils.MockStorage)
+		mockRepo.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+
+		h := Handler{
+			svc:            svc,
+			accountService: accService,
+			repo:           mockRepo,
+			disks:          &fakeDisks{disks: tc.disks, err: tc.disksErr},
+			listK8sVolumes: func(*model.Kube) ([]corev1.PersistentVolume, error) {
+				return []corev1.PersistentVolume{ebsVolume("pv", "vol-1", corev1.VolumeBound)}, nil
+			},
+			getWriter: func(string) (io.WriteCloser, error) {
+				return &bufferCloser{}, nil
+			},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/kubes/{kubeID}/volumes/cleanup", h.cleanupVolumes)
+
+		body, _ := json.Marshal(VolumeCleanupRequest{DiskIDs: tc.diskIDs})
+		req := httptest.NewRequest(http.MethodPost, "/kubes/kube/volumes/cleanup", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if rec.Code != http.StatusAccepted {
+			continue
+		}
+
+		var taskID string
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&taskID))
+		require.Equal(t, []string{taskID}, k.Tasks[workflows.VolumesTask], tc.name)
+	}
+}
@@ -0,0 +1,145 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/supergiant/control/pkg/message"
+)
+
+const (
+	watchPingInterval = 30 * time.Second
+	watchWriteTimeout = 10 * time.Second
+)
+
+// WatchEvent is a change of an object, Type is ADDED, MODIFIED, DELETED or
+// ERROR, the object of an error is a kubernetes status.
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// WatchKubeResources streams changes of the resource objects, the channel is
+// closed when the context is done or the api server ends the watch.
+func (s Service) WatchKubeResources(ctx context.Context, kubeID, resource, ns string,
+	opts metav1.ListOptions) (<-chan WatchEvent, error) {
+	client, err := s.resourceClient(ctx, kubeID, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Watch = true
+	body, err := client.Get().Context(ctx).Resource(resource).Namespace(ns).
+		VersionedParams(&opts, scheme.ParameterCodec).Stream()
+	if err != nil {
+		return nil, resourceError(err, "watch %s", resource)
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+		defer body.Close()
+
+		dec := json.NewDecoder(body)
+		for {
+			e := WatchEvent{}
+			if err := dec.Decode(&e); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					logrus.Debugf("kube %s: watch %s: %v", kubeID, resource, err)
+				}
+				return
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// watchResources relays changes of the resource objects to a websocket:
+// GET /kubes/{kubeID}/resources/{resource}/watch?namespace=default&labelSelector=app=web
+// the api server ends watches after a while, clients reconnect when the socket is closed.
+func (h *Handler) watchResources(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kubeID, rs := vars["kubeID"], vars["resource"]
+
+	opts, err := listOptions(r.URL.Query())
+	if err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	events, err := h.svc.WatchKubeResources(ctx, kubeID, rs, r.URL.Query().Get("namespace"), opts)
+	if err != nil {
+		sendResourceError(w, kubeID, err)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: 10 * time.Second,
+		WriteBufferSize:  1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("kube %s: watch %s: upgrade connection: %v", kubeID, rs, err)
+		return
+	}
+	defer c.Close()
+
+	// the request context isn't cancelled when a hijacked connection is closed,
+	// reading notices that the client has gone
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(watchPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				c.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "watch has ended"),
+					time.Now().Add(watchWriteTimeout))
+				return
+			}
+			c.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+			if err := c.WriteJSON(e); err != nil {
+				return
+			}
+		case <-ping.C:
+			c.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+			if err := c.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestService_WatchKubeResources(t *testing.T) {
+	srv := &fakeAPIServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, configMapsPath, r.URL.Path)
+		require.Equal(t, "true", r.URL.Query().Get("watch"))
+		require.Equal(t, "app=web", r.URL.Query().Get("labelSelector"))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"name":"web"}}}`)
+		fmt.Fprintln(w, `{"type":"DELETED","object":{"metadata":{"name":"web"}}}`)
+	}))
+	defer srv.Close()
+
+	svc, resources := resourceService(t)
+	resources.Close()
+	svc.clientForGroupFn = fakeClusterClients(map[string]*fakeAPIServer{"kube": srv})
+
+	_, err := svc.WatchKubeResources(context.Background(), "kube", "widgets", "default", metav1.ListOptions{})
+	require.Equal(t, sgerrors.ErrNotFound, errors.Cause(err))
+
+	events, err := svc.WatchKubeResources(context.Background(), "kube", "configmaps", "default",
+		metav1.ListOptions{LabelSelector: "app=web"})
+	require.NoError(t, err)
+
+	types := make([]string, 0)
+	for e := range events {
+		require.JSONEq(t, `{"metadata":{"name":"web"}}`, string(e.Object))
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []string{"ADDED", "DELETED"}, types)
+}
+
+func TestHandler_watchResources(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		query    string
+		watchErr error
+
+		expectedCode int
+	}{
+		{
+			name:         "selector",
+			query:        "labelSelector=app%20in%20(web",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			watchErr:     errors.Wrap(sgerrors.ErrNotFound, "resource pods"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "ok",
+			query:        "namespace=default",
+			expectedCode: http.StatusSwitchingProtocols,
+		},
+	} {
+		events := make(chan WatchEvent, 1)
+		events <- WatchEvent{Type: "ADDED", Object: []byte(`{"metadata":{"name":"web"}}`)}
+		close(events)
+
+		svc := new(kubeServiceMock)
+		svc.On(serviceWatchKubeResources, mock.Anything, "kube", "pods", mock.Anything, metav1.ListOptions{}).
+			Return(events, tc.watchErr)
+
+		h := &Handler{svc: svc}
+		router := mux.NewRouter()
+		h.Register(router)
+		srv := httptest.NewServer(router)
+
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/kubes/kube/resources/pods/watch?" + tc.query
+		c, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		require.Equal(t, tc.expectedCode, resp.StatusCode, "TC: %s", tc.name)
+		if err != nil {
+			srv.Close()
+			continue
+		}
+
+		e := WatchEvent{}
+		require.NoError(t, c.ReadJSON(&e), "TC: %s", tc.name)
+		require.Equal(t, "ADDED", e.Type, "TC: %s", tc.name)
+
+		_, _, err = c.ReadMessage()
+		require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "TC: %s", tc.name)
+
+		c.Close()
+		srv.Close()
+	}
+}
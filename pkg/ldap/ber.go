@@ -0,0 +1,181 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// identifier octets of ber encoded values, only tag numbers below 31
+// are used by ldap
+const (
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	// maxPacketSize limits responses of the directory
+	maxPacketSize = 16 << 20
+)
+
+// packet is a ber encoded value, constructed ones have children instead of a value.
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+func (p *packet) isConstructed() bool {
+	return p.tag&constructed != 0
+}
+
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.isConstructed() {
+		buf := &bytes.Buffer{}
+		for _, c := range p.children {
+			buf.Write(c.bytes())
+		}
+		content = buf.Bytes()
+	}
+
+	out := []byte{p.tag}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var octets []byte
+	for ; n > 0; n >>= 8 {
+		octets = append([]byte{byte(n)}, octets...)
+	}
+	return append([]byte{0x80 | byte(len(octets))}, octets...)
+}
+
+// child returns the child at the index, nil if there is no such child.
+func (p *packet) child(i int) *packet {
+	if i < 0 || i >= len(p.children) {
+		return nil
+	}
+	return p.children[i]
+}
+
+func (p *packet) str() string {
+	if p == nil {
+		return ""
+	}
+	return string(p.value)
+}
+
+func (p *packet) int() (int64, error) {
+	if p == nil || p.isConstructed() || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errors.New("ber: invalid integer")
+	}
+
+	// two's complement, big endian
+	n := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+func newConstructed(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag | constructed, children: children}
+}
+
+func newPrimitive(tag byte, value []byte) *packet {
+	return &packet{tag: tag, value: value}
+}
+
+func newString(s string) *packet {
+	return newPrimitive(tagOctetString, []byte(s))
+}
+
+func newBool(b bool) *packet {
+	if b {
+		return newPrimitive(tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(tagBoolean, []byte{0})
+}
+
+func newInt(tag byte, n int64) *packet {
+	// minimal two's complement encoding
+	value := []byte{byte(n)}
+	for n >>= 8; !(n == 0 && value[0]&0x80 == 0) && !(n == -1 && value[0]&0x80 != 0); n >>= 8 {
+		value = append([]byte{byte(n)}, value...)
+	}
+	return newPrimitive(tag, value)
+}
+
+// readPacket reads a value with a definite length from the reader.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("ber: high tag numbers are not supported")
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "ber: read length")
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 {
+			return nil, errors.New("ber: indefinite lengths are not supported")
+		}
+		if n > 4 {
+			return nil, errors.New("ber: length is too long")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, errors.Wrap(err, "ber: read length")
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, errors.Errorf("ber: packet of %d bytes is too large", length)
+	}
+
+	content := make([]byte, length)
+	if _, err = io.ReadFull(r, content); err != nil {
+		return nil, errors.Wrap(err, "ber: read content")
+	}
+
+	p := &packet{tag: tag}
+	if !p.isConstructed() {
+		p.value = content
+		return p, nil
+	}
+
+	cr := bufio.NewReader(bytes.NewReader(content))
+	for {
+		c, err := readPacket(cr)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, c)
+	}
+}
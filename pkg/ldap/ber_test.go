@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInt(t *testing.T) {
+	for _, tc := range []struct {
+		n        int64
+		expected []byte
+	}{
+		{0, []byte{0x02, 0x01, 0x00}},
+		{127, []byte{0x02, 0x01, 0x7f}},
+		{128, []byte{0x02, 0x02, 0x00, 0x80}},
+		{256, []byte{0x02, 0x02, 0x01, 0x00}},
+		{-1, []byte{0x02, 0x01, 0xff}},
+		{-129, []byte{0x02, 0x02, 0xff, 0x7f}},
+	} {
+		p := newInt(tagInteger, tc.n)
+		require.Equal(t, tc.expected, p.bytes(), "TC: %d", tc.n)
+
+		n, err := p.int()
+		require.NoError(t, err, "TC: %d", tc.n)
+		require.Equal(t, tc.n, n, "TC: %d", tc.n)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	msg := newConstructed(tagSequence, newInt(tagInteger, 1), newString(long), newBool(true))
+
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(msg.bytes())))
+	require.NoError(t, err)
+	require.Len(t, p.children, 3)
+	require.Equal(t, long, p.child(1).str())
+	require.Equal(t, msg.bytes(), p.bytes())
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"indefinite length", []byte{0x30, 0x80, 0x00, 0x00}},
+		{"truncated", []byte{0x04, 0x05, 'a'}},
+		{"too large", []byte{0x04, 0x84, 0x7f, 0xff, 0xff, 0xff}},
+		{"high tag number", []byte{0x1f, 0x81, 0x00}},
+	} {
+		_, err = readPacket(bufio.NewReader(bytes.NewReader(tc.data)))
+		require.Error(t, err, "TC: %s", tc.name)
+	}
+}
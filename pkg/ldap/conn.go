@@ -0,0 +1,330 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// protocol operations of ldap messages
+const (
+	opBindRequest      = classApplication | constructed | 0
+	opBindResponse     = classApplication | constructed | 1
+	opUnbindRequest    = classApplication | 2
+	opSearchRequest    = classApplication | constructed | 3
+	opSearchEntry      = classApplication | constructed | 4
+	opSearchDone       = classApplication | constructed | 5
+	opSearchReference  = classApplication | constructed | 19
+	opExtendedRequest  = classApplication | constructed | 23
+	opExtendedResponse = classApplication | constructed | 24
+
+	authSimple          = classContext | 0
+	extendedRequestName = classContext | 0
+
+	scopeWholeSubtree = 2
+	derefNever        = 0
+
+	oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+	DefaultTimeout = 10 * time.Second
+)
+
+// result codes of the directory
+const (
+	resultSuccess            = 0
+	resultSizeLimitExceeded  = 4
+	resultInvalidCredentials = 49
+)
+
+// ResultError is a result of an operation refused by the directory.
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return strings.TrimSpace("ldap: result code " + strconv.FormatInt(e.Code, 10) + " " + e.Message)
+}
+
+func isResult(err error, code int64) bool {
+	e, ok := errors.Cause(err).(*ResultError)
+	return ok && e.Code == code
+}
+
+type entry struct {
+	dn string
+	// attrs are keyed by lower case names, names are case insensitive
+	attrs map[string][]string
+}
+
+func (e *entry) values(name string) []string {
+	return e.attrs[strings.ToLower(name)]
+}
+
+// conn is a connection to the directory, operations are sent one by one.
+type conn struct {
+	c       net.Conn
+	r       *bufio.Reader
+	lastID  int64
+	timeout time.Duration
+}
+
+// dial connects to ldap:// or ldaps:// url, plain connections are upgraded
+// with StartTLS when it is requested.
+func dial(ctx context.Context, rawURL string, startTLS bool, tlsConfig *tls.Config) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse url")
+	}
+
+	host, port := u.Hostname(), u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, errors.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	cfg := tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	d := &net.Dialer{Timeout: DefaultTimeout}
+	nc, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial %s", u.Host)
+	}
+
+	c := newConn(nc)
+	if deadline, ok := ctx.Deadline(); ok {
+		c.timeout = time.Until(deadline)
+	}
+
+	if u.Scheme == "ldaps" {
+		if err = c.upgrade(cfg); err != nil {
+			c.c.Close()
+			return nil, err
+		}
+	} else if startTLS {
+		if err = c.startTLS(cfg); err != nil {
+			c.c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{
+		c:       c,
+		r:       bufio.NewReader(c),
+		timeout: DefaultTimeout,
+	}
+}
+
+func (c *conn) upgrade(cfg *tls.Config) error {
+	tc := tls.Client(c.c, cfg)
+	if err := tc.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if err := tc.Handshake(); err != nil {
+		return errors.Wrap(err, "tls handshake")
+	}
+
+	c.c = tc
+	c.r = bufio.NewReader(tc)
+	return nil
+}
+
+func (c *conn) startTLS(cfg *tls.Config) error {
+	resp, err := c.roundTrip(newConstructed(opExtendedRequest,
+		newPrimitive(extendedRequestName, []byte(oidStartTLS))), opExtendedResponse)
+	if err != nil {
+		return errors.Wrap(err, "start tls")
+	}
+	if err = result(resp); err != nil {
+		return errors.Wrap(err, "start tls")
+	}
+	return c.upgrade(cfg)
+}
+
+func (c *conn) send(op *packet) (int64, error) {
+	c.lastID++
+	msg := newConstructed(tagSequence, newInt(tagInteger, c.lastID), op)
+
+	if err := c.c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	_, err := c.c.Write(msg.bytes())
+	return c.lastID, errors.Wrap(err, "write request")
+}
+
+// receive reads the operation of the next message of the request.
+func (c *conn) receive(id int64) (*packet, error) {
+	for {
+		msg, err := readPacket(c.r)
+		if err != nil {
+			return nil, errors.Wrap(err, "read response")
+		}
+		if msg.tag != tagSequence|constructed || len(msg.children) < 2 {
+			return nil, errors.New("read response: not a message")
+		}
+
+		msgID, err := msg.child(0).int()
+		if err != nil {
+			return nil, errors.Wrap(err, "read response")
+		}
+		// unsolicited notifications have no id, e.g. notices of disconnection
+		if msgID == 0 {
+			if err = result(msg.child(1)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if msgID != id {
+			return nil, errors.Errorf("read response: unexpected message %d", msgID)
+		}
+		return msg.child(1), nil
+	}
+}
+
+func (c *conn) roundTrip(op *packet, expected byte) (*packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.tag != expected {
+		return nil, errors.Errorf("unexpected response %#x", resp.tag)
+	}
+	return resp, nil
+}
+
+// result returns an error of ldap results that are not successful.
+func result(op *packet) error {
+	code, err := op.child(0).int()
+	if err != nil {
+		return errors.Wrap(err, "read result code")
+	}
+	if code == resultSuccess {
+		return nil
+	}
+	return &ResultError{Code: code, Message: op.child(2).str()}
+}
+
+// bind authenticates the connection with a simple bind, empty passwords
+// are refused since directories treat them as anonymous binds.
+func (c *conn) bind(dn, password string) error {
+	if password == "" {
+		return &ResultError{Code: resultInvalidCredentials, Message: "empty password"}
+	}
+
+	resp, err := c.roundTrip(newConstructed(opBindRequest,
+		newInt(tagInteger, 3),
+		newString(dn),
+		newPrimitive(authSimple, []byte(password)),
+	), opBindResponse)
+	if err != nil {
+		return errors.Wrap(err, "bind")
+	}
+	return result(resp)
+}
+
+// search returns entries of the subtree matching the filter.
+func (c *conn) search(base, filter string, attrs []string, sizeLimit int64) ([]*entry, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newConstructed(tagSequence)
+	for _, a := range attrs {
+		list.children = append(list.children, newString(a))
+	}
+	id, err := c.send(newConstructed(opSearchRequest,
+		newString(base),
+		newInt(tagEnumerated, scopeWholeSubtree),
+		newInt(tagEnumerated, derefNever),
+		newInt(tagInteger, sizeLimit),
+		newInt(tagInteger, int64(c.timeout/time.Second)),
+		newBool(false),
+		f,
+		list,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "search")
+	}
+
+	entries := make([]*entry, 0)
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "search")
+		}
+
+		switch op.tag {
+		case opSearchEntry:
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, errors.Wrap(err, "search")
+			}
+			entries = append(entries, e)
+		case opSearchReference:
+			// referrals to other servers are not followed
+		case opSearchDone:
+			if err = result(op); err != nil && !isResult(err, resultSizeLimitExceeded) {
+				return nil, errors.Wrap(err, "search")
+			}
+			return entries, nil
+		default:
+			return nil, errors.Errorf("search: unexpected response %#x", op.tag)
+		}
+	}
+}
+
+func parseEntry(op *packet) (*entry, error) {
+	attrs := op.child(1)
+	if op.child(0) == nil || attrs == nil {
+		return nil, errors.New("invalid entry")
+	}
+
+	e := &entry{
+		dn:    op.child(0).str(),
+		attrs: make(map[string][]string),
+	}
+	for _, a := range attrs.children {
+		name, vals := a.child(0), a.child(1)
+		if name == nil || vals == nil {
+			return nil, errors.New("invalid attribute")
+		}
+
+		key := strings.ToLower(name.str())
+		for _, v := range vals.children {
+			e.attrs[key] = append(e.attrs[key], v.str())
+		}
+	}
+	return e, nil
+}
+
+func (c *conn) close() error {
+	// the directory closes the connection without a response
+	c.send(newPrimitive(opUnbindRequest, nil))
+	return c.c.Close()
+}
@@ -0,0 +1,254 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// context specific tags of filter choices
+const (
+	filterAnd        = classContext | constructed | 0
+	filterOr         = classContext | constructed | 1
+	filterNot        = classContext | constructed | 2
+	filterEquality   = classContext | constructed | 3
+	filterSubstrings = classContext | constructed | 4
+	filterGreater    = classContext | constructed | 5
+	filterLess       = classContext | constructed | 6
+	filterPresent    = classContext | 7
+	filterApprox     = classContext | constructed | 8
+	filterExtensible = classContext | constructed | 9
+
+	substringInitial = classContext | 0
+	substringAny     = classContext | 1
+	substringFinal   = classContext | 2
+
+	extensibleRule  = classContext | 1
+	extensibleType  = classContext | 2
+	extensibleValue = classContext | 3
+	extensibleDN    = classContext | 4
+)
+
+// EscapeFilter escapes a value for use in a filter, values entered by users
+// must be escaped so they can't change the filter.
+func EscapeFilter(s string) string {
+	buf := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			buf.WriteString(`\` + hex.EncodeToString([]byte{c}))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// compileFilter encodes a filter in the string representation of RFC 4515.
+func compileFilter(s string) (*packet, error) {
+	p := &filterParser{s: strings.TrimSpace(s)}
+	f, err := p.filter()
+	if err != nil {
+		return nil, errors.Wrapf(err, "filter %s", s)
+	}
+	if p.pos != len(p.s) {
+		return nil, errors.Errorf("filter %s: unexpected %q", s, p.s[p.pos:])
+	}
+	return f, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) filter() (*packet, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, errors.New("filter must be in parentheses")
+	}
+	p.pos++
+	if p.pos >= len(p.s) {
+		return nil, errors.New("unexpected end")
+	}
+
+	var (
+		f   *packet
+		err error
+	)
+	switch p.s[p.pos] {
+	case '&':
+		p.pos++
+		f, err = p.list(filterAnd)
+	case '|':
+		p.pos++
+		f, err = p.list(filterOr)
+	case '!':
+		p.pos++
+		var inner *packet
+		if inner, err = p.filter(); err == nil {
+			f = newConstructed(filterNot, inner)
+		}
+	default:
+		f, err = p.item()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return nil, errors.New("missing closing parenthesis")
+	}
+	p.pos++
+	return f, nil
+}
+
+func (p *filterParser) list(tag byte) (*packet, error) {
+	f := newConstructed(tag)
+	for p.pos < len(p.s) && p.s[p.pos] == '(' {
+		c, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		f.children = append(f.children, c)
+	}
+	if len(f.children) == 0 {
+		return nil, errors.New("empty filter list")
+	}
+	return f, nil
+}
+
+func (p *filterParser) item() (*packet, error) {
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, errors.New("missing closing parenthesis")
+	}
+	item := p.s[p.pos : p.pos+end]
+	p.pos += end
+
+	i := strings.IndexByte(item, '=')
+	if i <= 0 {
+		return nil, errors.Errorf("invalid item %s", item)
+	}
+	attr, value := item[:i], item[i+1:]
+
+	var tag byte = filterEquality
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = filterGreater, attr[:len(attr)-1]
+	case '<':
+		tag, attr = filterLess, attr[:len(attr)-1]
+	case '~':
+		tag, attr = filterApprox, attr[:len(attr)-1]
+	case ':':
+		return extensibleFilter(attr[:len(attr)-1], value)
+	}
+	if attr == "" {
+		return nil, errors.Errorf("invalid item %s", item)
+	}
+
+	if tag != filterEquality {
+		v, err := unescapeFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		return newConstructed(tag, newString(attr), newPrimitive(tagOctetString, v)), nil
+	}
+	if value == "*" {
+		return newPrimitive(filterPresent, []byte(attr)), nil
+	}
+	if strings.Contains(value, "*") {
+		return substringsFilter(attr, value)
+	}
+
+	v, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(filterEquality, newString(attr), newPrimitive(tagOctetString, v)), nil
+}
+
+func substringsFilter(attr, value string) (*packet, error) {
+	parts := strings.Split(value, "*")
+	substrings := newConstructed(tagSequence)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := unescapeFilter(part)
+		if err != nil {
+			return nil, err
+		}
+
+		var tag byte = substringAny
+		switch i {
+		case 0:
+			tag = substringInitial
+		case len(parts) - 1:
+			tag = substringFinal
+		}
+		substrings.children = append(substrings.children, newPrimitive(tag, v))
+	}
+	return newConstructed(filterSubstrings, newString(attr), substrings), nil
+}
+
+// extensibleFilter encodes attr[:dn][:rule]:=value, e.g. the matching
+// rule of nested groups of active directory.
+func extensibleFilter(desc, value string) (*packet, error) {
+	parts := strings.Split(desc, ":")
+	f := newConstructed(filterExtensible)
+
+	attr, dn, rule := parts[0], false, ""
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn"):
+			dn = true
+		case part != "" && rule == "":
+			rule = part
+		default:
+			return nil, errors.Errorf("invalid extensible match %s", desc)
+		}
+	}
+	if attr == "" && rule == "" {
+		return nil, errors.Errorf("extensible match %s needs an attribute or a rule", desc)
+	}
+
+	v, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	if rule != "" {
+		f.children = append(f.children, newPrimitive(extensibleRule, []byte(rule)))
+	}
+	if attr != "" {
+		f.children = append(f.children, newPrimitive(extensibleType, []byte(attr)))
+	}
+	f.children = append(f.children, newPrimitive(extensibleValue, v))
+	if dn {
+		f.children = append(f.children, newPrimitive(extensibleDN, []byte{0xff}))
+	}
+	return f, nil
+}
+
+func unescapeFilter(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+2 >= len(s) {
+				return nil, errors.Errorf("invalid escape in %s", s)
+			}
+			b, err := hex.DecodeString(s[i+1 : i+3])
+			if err != nil {
+				return nil, errors.Errorf("invalid escape in %s", s)
+			}
+			out = append(out, b...)
+			i += 2
+		case '(', ')', '*':
+			return nil, errors.Errorf("unescaped %c in %s", s[i], s)
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileFilter(t *testing.T) {
+	for _, tc := range []struct {
+		filter      string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			filter:   "(cn=Babs Jensen)",
+			expected: "a3110402636e040b42616273204a656e73656e",
+		},
+		{
+			filter:   "(objectClass=*)",
+			expected: "870b6f626a656374436c617373",
+		},
+		{
+			filter:   "(&(uid=a)(!(cn=b)))",
+			expected: "a015a30804037569640401" + "61" + "a209a3070402636e040162",
+		},
+		{
+			filter:   "(cn=*a*b)",
+			expected: "a40c0402636e3006810161820162",
+		},
+		{
+			filter:   `(cn=\2a\28)`,
+			expected: "a3080402636e04022a28",
+		},
+		{
+			filter:   "(memberOf:1.2.840.113556.1.4.1941:=cn=g)",
+			expected: "a9298117312e322e3834302e3131333535362e312e342e31393431" + "82086d656d6265724f66" + "830463" + "6e3d67",
+		},
+		{
+			filter:   "(uidNumber>=1000)",
+			expected: "a51104097569644e756d626572040431303030",
+		},
+		{filter: "cn=a", expectedErr: true},
+		{filter: "(cn=a", expectedErr: true},
+		{filter: "(cn=a))", expectedErr: true},
+		{filter: "(&)", expectedErr: true},
+		{filter: `(cn=\2)`, expectedErr: true},
+		{filter: "(=a)", expectedErr: true},
+	} {
+		f, err := compileFilter(tc.filter)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.filter, err)
+		if err == nil {
+			require.Equal(t, tc.expected, hex.EncodeToString(f.bytes()), "TC: %s", tc.filter)
+		}
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	require.Equal(t, `\2a\29\28\5c\00a`, EscapeFilter("*)(\\\x00a"))
+
+	// escaped values can't change the filter
+	f, err := compileFilter("(uid=" + EscapeFilter("*)(uid=*") + ")")
+	require.NoError(t, err)
+	require.Equal(t, byte(filterEquality), f.tag)
+	require.Equal(t, "*)(uid=*", f.child(1).str())
+}
@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type Servicer interface {
+	Config(ctx context.Context) (*Config, error)
+	SetConfig(ctx context.Context, c *Config) error
+	Sync(ctx context.Context) (*SyncResult, error)
+}
+
+// Handler configures the directory, it is restricted to the default tenant.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/ldap/config", h.getConfig).Methods(http.MethodGet)
+	r.HandleFunc("/ldap/config", h.setConfig).Methods(http.MethodPut)
+	r.HandleFunc("/ldap/sync", h.sync).Methods(http.MethodPost)
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c, err := h.svc.Config(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	// the bind password is write only
+	c.BindPassword = ""
+	if err = json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) setConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c := new(Config)
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetConfig(r.Context(), c); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson || errors.Cause(err) == tenant.ErrInvalidID {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	c.BindPassword = ""
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// sync updates roles of provisioned users without waiting for the interval.
+func (h *Handler) sync(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	res, err := h.svc.Sync(r.Context())
+	if err != nil {
+		if errors.Cause(err) == ErrDisabled {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "ldap is configured by admins of the default tenant", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/user"
+)
+
+func TestHandler(t *testing.T) {
+	valid, err := json.Marshal(testConfig())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name         string
+		tenantID     string
+		editor       bool
+		method       string
+		url          string
+		body         []byte
+		expectedCode int
+	}{
+		{
+			name:         "set config",
+			tenantID:     tenant.DefaultID,
+			method:       http.MethodPut,
+			url:          "/ldap/config",
+			body:         valid,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "invalid config",
+			tenantID:     tenant.DefaultID,
+			method:       http.MethodPut,
+			url:          "/ldap/config",
+			body:         []byte(`{"enabled":true,"url":"ldap://ldap"}`),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "other tenant",
+			tenantID:     "acme",
+			method:       http.MethodGet,
+			url:          "/ldap/config",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "editor",
+			tenantID:     tenant.DefaultID,
+			editor:       true,
+			method:       http.MethodPost,
+			url:          "/ldap/sync",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "get config",
+			tenantID:     tenant.DefaultID,
+			method:       http.MethodGet,
+			url:          "/ldap/config",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "sync",
+			tenantID:     tenant.DefaultID,
+			method:       http.MethodPost,
+			url:          "/ldap/sync",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(),
+			&fakeUsers{users: map[string]*user.User{}})
+		svc.dial = newFakeDirectory().dial
+		require.NoError(t, svc.SetConfig(context.Background(), testConfig()), "TC: %s", tc.name)
+
+		router := mux.NewRouter()
+		NewHandler(svc).Register(router)
+
+		req := httptest.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), tc.tenantID), !tc.editor))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if tc.expectedCode == http.StatusOK {
+			// the bind password is never returned
+			require.NotContains(t, rec.Body.String(), "bindPassword", "TC: %s", tc.name)
+		}
+	}
+}
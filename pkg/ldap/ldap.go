@@ -0,0 +1,489 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/user"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/ldap/"
+	configKey            = "config"
+
+	// Source marks users provisioned on ldap login.
+	Source = "ldap"
+
+	DefaultUserFilter     = "(uid={login})"
+	DefaultGroupAttribute = "memberOf"
+
+	// syncCheckInterval is how often the sync interval of the config is checked.
+	syncCheckInterval = time.Minute
+)
+
+var (
+	ErrDisabled = errors.New("ldap login is disabled")
+	ErrNoRole   = errors.New("no role is mapped to groups of the user")
+)
+
+// Config configures binds of users to a directory, users are provisioned
+// with a role of their groups on their first login.
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// URL is ldap://host:port or ldaps://host:port.
+	URL string `json:"url"`
+	// StartTLS upgrades ldap:// connections, credentials must not be sent
+	// in plain text to remote directories.
+	StartTLS bool `json:"startTls,omitempty"`
+	// CACertificate verifies the directory, system roots are used when it is empty.
+	CACertificate string `json:"caCertificate,omitempty"`
+
+	// BindDN and BindPassword are of an account that looks up users and
+	// their groups, the lookup is anonymous when they are empty.
+	BindDN       string `json:"bindDn,omitempty"`
+	BindPassword string `json:"bindPassword,omitempty"`
+
+	UserBaseDN string `json:"userBaseDn"`
+	// UserFilter finds an entry of the login, {login} is replaced with
+	// the escaped login, e.g. (sAMAccountName={login}) for active directory.
+	UserFilter string `json:"userFilter,omitempty"`
+
+	// GroupAttribute of user entries holds DNs of their groups.
+	GroupAttribute string `json:"groupAttribute,omitempty"`
+	// GroupBaseDN and GroupFilter look up groups of directories without
+	// the group attribute, {dn} and {login} are replaced in the filter,
+	// e.g. (&(objectClass=groupOfNames)(member={dn})).
+	GroupBaseDN string `json:"groupBaseDn,omitempty"`
+	GroupFilter string `json:"groupFilter,omitempty"`
+
+	// Roles maps DNs of groups to roles, the most privileged role is given.
+	Roles map[string]string `json:"roles,omitempty"`
+	// DefaultRole is given to users without mapped groups, they are
+	// refused when it is empty.
+	DefaultRole string `json:"defaultRole,omitempty"`
+	// TenantID is a tenant of provisioned users.
+	TenantID string `json:"tenantId,omitempty"`
+
+	// SyncInterval is a period of updating roles of provisioned users
+	// from their groups, e.g. 30m. Users removed from the directory or
+	// from mapped groups are removed from control. Roles are not synced
+	// when it is empty.
+	SyncInterval string `json:"syncInterval,omitempty"`
+}
+
+func (c *Config) setDefaults() {
+	if c.UserFilter == "" {
+		c.UserFilter = DefaultUserFilter
+	}
+	if c.GroupAttribute == "" {
+		c.GroupAttribute = DefaultGroupAttribute
+	}
+}
+
+func (c *Config) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid url %s", c.URL)
+	}
+	if u.Scheme == "ldaps" && c.StartTLS {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "start tls is used only with ldap://")
+	}
+	if strings.TrimSpace(c.UserBaseDN) == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "user base dn is required")
+	}
+	if !strings.Contains(c.UserFilter, "{login}") {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "user filter must have {login}")
+	}
+	if _, err = compileFilter(c.userFilter("login")); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+	if c.GroupBaseDN != "" {
+		if _, err = compileFilter(c.groupFilter("dn", "login")); err != nil {
+			return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+		}
+	}
+	if _, err = c.tlsConfig(); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+
+	for group, role := range c.Roles {
+		if !user.ValidRole(role) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown role %s of %s", role, group)
+		}
+	}
+	if c.DefaultRole != "" && !user.ValidRole(c.DefaultRole) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown default role %s", c.DefaultRole)
+	}
+	if _, err = c.syncInterval(); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+
+	return tenant.ValidateID(c.TenantID)
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if c.CACertificate != "" {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM([]byte(c.CACertificate)) {
+			return nil, errors.New("ca certificate is not pem encoded")
+		}
+	}
+	return cfg, nil
+}
+
+func (c *Config) syncInterval() (time.Duration, error) {
+	if c.SyncInterval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.SyncInterval)
+	if err != nil || d < syncCheckInterval {
+		return 0, errors.Errorf("sync interval %s must be at least %s", c.SyncInterval, syncCheckInterval)
+	}
+	return d, nil
+}
+
+func (c *Config) userFilter(login string) string {
+	return strings.Replace(c.UserFilter, "{login}", EscapeFilter(login), -1)
+}
+
+func (c *Config) groupFilter(dn, login string) string {
+	return strings.NewReplacer("{dn}", EscapeFilter(dn), "{login}", EscapeFilter(login)).Replace(c.GroupFilter)
+}
+
+// role maps groups to the most privileged role, DNs are compared
+// case insensitively.
+func (c *Config) role(groups []string) string {
+	mapped := make([]string, 0, len(groups))
+	for dn, role := range c.Roles {
+		for _, g := range groups {
+			if strings.EqualFold(strings.TrimSpace(g), strings.TrimSpace(dn)) {
+				mapped = append(mapped, role)
+			}
+		}
+	}
+
+	if role := user.HighestRole(mapped); role != "" {
+		return role
+	}
+	return c.DefaultRole
+}
+
+type dialer func(ctx context.Context, c *Config) (*conn, error)
+
+func dialConfig(ctx context.Context, c *Config) (*conn, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dial(ctx, c.URL, c.StartTLS, tlsConfig)
+}
+
+type userService interface {
+	GetAll(ctx context.Context) ([]*user.User, error)
+	Provision(ctx context.Context, u *user.User) error
+	Delete(ctx context.Context, login string) error
+}
+
+// SyncResult reports changes of provisioned users.
+type SyncResult struct {
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+}
+
+// Service authenticates users with the directory and keeps roles of
+// provisioned users in sync with their groups.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	users   userService
+	dial    dialer
+
+	m        sync.Mutex
+	lastSync time.Time
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface, users userService) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		users:   users,
+		dial:    dialConfig,
+	}
+}
+
+// Config returns the configuration, ldap login is disabled unless configured.
+func (s *Service) Config(ctx context.Context) (*Config, error) {
+	data, err := s.storage.Get(ctx, s.prefix, configKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return &Config{}, nil
+		}
+		return nil, errors.Wrap(err, "get ldap config")
+	}
+
+	c := new(Config)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal ldap config")
+	}
+	c.setDefaults()
+	return c, nil
+}
+
+// SetConfig validates and stores the configuration, the stored bind password
+// is kept when the new one is empty.
+func (s *Service) SetConfig(ctx context.Context, c *Config) error {
+	c.setDefaults()
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	if c.BindPassword == "" && c.BindDN != "" {
+		current, err := s.Config(ctx)
+		if err != nil {
+			return err
+		}
+		c.BindPassword = current.BindPassword
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal ldap config")
+	}
+	return errors.Wrap(s.storage.Put(ctx, s.prefix, configKey, data), "put ldap config")
+}
+
+// Authenticate binds as the user, the user is provisioned with a role of
+// their groups. Users unknown to the directory get invalid credentials.
+func (s *Service) Authenticate(ctx context.Context, login, password string) (*user.User, error) {
+	c, err := s.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Enabled {
+		return nil, errors.Wrap(sgerrors.ErrInvalidCredentials, ErrDisabled.Error())
+	}
+	if login == "" || password == "" {
+		return nil, sgerrors.ErrInvalidCredentials
+	}
+
+	conn, err := s.connect(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	e, err := c.lookup(conn, login)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return nil, sgerrors.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if err = conn.bind(e.dn, password); err != nil {
+		if isResult(err, resultInvalidCredentials) {
+			return nil, sgerrors.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	// groups are looked up by the service account, users may not see them
+	if c.BindDN != "" {
+		if err = conn.bind(c.BindDN, c.BindPassword); err != nil {
+			return nil, errors.Wrap(err, "bind service account")
+		}
+	}
+	role, err := c.groupRole(conn, e, login)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, errors.Wrap(ErrNoRole, login)
+	}
+
+	u := &user.User{
+		Login:    login,
+		TenantID: c.TenantID,
+		Role:     role,
+		Source:   Source,
+	}
+	if err = s.users.Provision(ctx, u); err != nil {
+		if sgerrors.IsAlreadyExists(err) {
+			return nil, errors.Wrapf(sgerrors.ErrInvalidCredentials, "login %s is used by other users", login)
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Service) connect(ctx context.Context, c *Config) (*conn, error) {
+	conn, err := s.dial(ctx, c)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to ldap")
+	}
+
+	if c.BindDN != "" {
+		if err = conn.bind(c.BindDN, c.BindPassword); err != nil {
+			conn.close()
+			return nil, errors.Wrap(err, "bind service account")
+		}
+	}
+	return conn, nil
+}
+
+// lookup finds the only entry of the login.
+func (c *Config) lookup(conn *conn, login string) (*entry, error) {
+	entries, err := conn.search(c.UserBaseDN, c.userFilter(login), []string{c.GroupAttribute}, 2)
+	if err != nil {
+		return nil, errors.Wrapf(err, "look up %s", login)
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "user %s", login)
+	case 1:
+		return entries[0], nil
+	default:
+		return nil, errors.Errorf("several entries of %s match the user filter", login)
+	}
+}
+
+func (c *Config) groupRole(conn *conn, e *entry, login string) (string, error) {
+	groups := e.values(c.GroupAttribute)
+	if c.GroupBaseDN != "" {
+		// 1.1 requests no attributes, only DNs of groups are used
+		entries, err := conn.search(c.GroupBaseDN, c.groupFilter(e.dn, login), []string{"1.1"}, 0)
+		if err != nil {
+			return "", errors.Wrapf(err, "look up groups of %s", login)
+		}
+		for _, g := range entries {
+			groups = append(groups, g.dn)
+		}
+	}
+	return c.role(groups), nil
+}
+
+// Sync updates roles of provisioned users, users that aren't found in the
+// directory or have no role any more are removed.
+func (s *Service) Sync(ctx context.Context) (*SyncResult, error) {
+	c, err := s.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Enabled {
+		return nil, ErrDisabled
+	}
+
+	// failed syncs are retried with the next interval
+	s.m.Lock()
+	s.lastSync = time.Now()
+	s.m.Unlock()
+
+	// users of the tenant before the configuration was changed are left
+	users, err := s.users.GetAll(tenant.WithID(ctx, c.TenantID))
+	if err != nil {
+		return nil, errors.Wrap(err, "get users")
+	}
+
+	conn, err := s.connect(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	res := &SyncResult{
+		Updated: make([]string, 0),
+		Removed: make([]string, 0),
+	}
+	for _, u := range users {
+		if u.Source != Source {
+			continue
+		}
+
+		role := ""
+		e, err := c.lookup(conn, u.Login)
+		switch {
+		case err == nil:
+			if role, err = c.groupRole(conn, e, u.Login); err != nil {
+				return res, err
+			}
+		case !sgerrors.IsNotFound(err):
+			return res, err
+		}
+
+		if role == "" {
+			if err = s.users.Delete(tenant.WithID(ctx, u.TenantID), u.Login); err != nil {
+				return res, errors.Wrapf(err, "remove %s", u.Login)
+			}
+			res.Removed = append(res.Removed, u.Login)
+			continue
+		}
+		if role == u.Role {
+			continue
+		}
+
+		u.Role = role
+		if err = s.users.Provision(ctx, u); err != nil {
+			return res, errors.Wrapf(err, "update %s", u.Login)
+		}
+		res.Updated = append(res.Updated, u.Login)
+	}
+
+	return res, nil
+}
+
+// Run syncs users with the interval of the configuration.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(syncCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c, err := s.Config(ctx)
+			if err != nil {
+				logrus.Errorf("ldap: get config: %v", err)
+				continue
+			}
+			interval, err := c.syncInterval()
+			if !c.Enabled || err != nil || interval == 0 {
+				continue
+			}
+
+			s.m.Lock()
+			due := time.Since(s.lastSync) >= interval
+			s.m.Unlock()
+			if !due {
+				continue
+			}
+
+			res, err := s.Sync(ctx)
+			if err != nil {
+				logrus.Errorf("ldap: sync users: %v", err)
+				continue
+			}
+			if len(res.Updated) > 0 || len(res.Removed) > 0 {
+				logrus.Infof("ldap: users updated %v removed %v", res.Updated, res.Removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/user"
+)
+
+const (
+	testBindDN   = "cn=control,dc=example,dc=com"
+	testAdmins   = "cn=admins,ou=groups,dc=example,dc=com"
+	testDevs     = "cn=devs,ou=groups,dc=example,dc=com"
+	testSupport  = "cn=support,ou=groups,dc=example,dc=com"
+	testPassword = "secret"
+)
+
+// fakeDirectory serves binds and searches of entries over the ldap protocol.
+type fakeDirectory struct {
+	m         sync.Mutex
+	entries   []*entry
+	passwords map[string]string
+}
+
+func newFakeDirectory() *fakeDirectory {
+	d := &fakeDirectory{
+		passwords: map[string]string{testBindDN: "control"},
+	}
+	for _, g := range []string{testAdmins, testDevs, testSupport} {
+		d.entries = append(d.entries, &entry{dn: g, attrs: map[string][]string{
+			"objectclass": {"groupOfNames"},
+		}})
+	}
+	d.add("uid=alice,ou=people,dc=example,dc=com", "alice", testDevs)
+	d.add("uid=bob,ou=people,dc=example,dc=com", "bob", testAdmins, testDevs)
+	d.add("uid=carol,ou=people,dc=example,dc=com", "carol")
+	return d
+}
+
+func (d *fakeDirectory) add(dn, uid string, groups ...string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.entries = append(d.entries, &entry{dn: dn, attrs: map[string][]string{
+		"objectclass": {"person"},
+		"uid":         {uid},
+		"memberof":    groups,
+	}})
+	d.passwords[dn] = testPassword
+	for _, g := range groups {
+		for _, e := range d.entries {
+			if e.dn == g {
+				e.attrs["member"] = append(e.attrs["member"], dn)
+			}
+		}
+	}
+}
+
+func (d *fakeDirectory) setGroups(uid string, groups ...string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	for _, e := range d.entries {
+		if len(e.values("uid")) > 0 && e.values("uid")[0] == uid {
+			e.attrs["memberof"] = groups
+		}
+	}
+}
+
+func (d *fakeDirectory) dial(ctx context.Context, c *Config) (*conn, error) {
+	client, server := net.Pipe()
+	go d.serve(server)
+	return newConn(client), nil
+}
+
+func (d *fakeDirectory) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	reply := func(id int64, op *packet) bool {
+		_, err := c.Write(newConstructed(tagSequence, newInt(tagInteger, id), op).bytes())
+		return err == nil
+	}
+	done := func(tag byte, code int64) *packet {
+		return newConstructed(tag, newInt(tagEnumerated, code), newString(""), newString(""))
+	}
+
+	for {
+		msg, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		id, _ := msg.child(0).int()
+		op := msg.child(1)
+
+		switch op.tag {
+		case opBindRequest:
+			var code int64 = resultInvalidCredentials
+			d.m.Lock()
+			if pw, ok := d.passwords[op.child(1).str()]; ok && pw == op.child(2).str() {
+				code = resultSuccess
+			}
+			d.m.Unlock()
+			if !reply(id, done(opBindResponse, code)) {
+				return
+			}
+		case opSearchRequest:
+			base, filter := strings.ToLower(op.child(0).str()), op.child(6)
+			attrs := make([]string, 0)
+			for _, a := range op.child(7).children {
+				attrs = append(attrs, a.str())
+			}
+
+			d.m.Lock()
+			for _, e := range d.entries {
+				if !strings.HasSuffix(strings.ToLower(e.dn), base) || !e.matches(filter) {
+					continue
+				}
+				list := newConstructed(tagSequence)
+				for _, a := range attrs {
+					vals := newConstructed(tagSet)
+					for _, v := range e.values(a) {
+						vals.children = append(vals.children, newString(v))
+					}
+					if len(vals.children) > 0 {
+						list.children = append(list.children, newConstructed(tagSequence, newString(a), vals))
+					}
+				}
+				reply(id, newConstructed(opSearchEntry, newString(e.dn), list))
+			}
+			d.m.Unlock()
+			if !reply(id, done(opSearchDone, resultSuccess)) {
+				return
+			}
+		case opUnbindRequest:
+			return
+		}
+	}
+}
+
+func (e *entry) matches(f *packet) bool {
+	switch f.tag {
+	case filterAnd:
+		for _, c := range f.children {
+			if !e.matches(c) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, c := range f.children {
+			if e.matches(c) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !e.matches(f.child(0))
+	case filterPresent:
+		return len(e.values(string(f.value))) > 0
+	case filterEquality:
+		for _, v := range e.values(f.child(0).str()) {
+			if strings.EqualFold(v, f.child(1).str()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type fakeUsers struct {
+	m     sync.Mutex
+	users map[string]*user.User
+}
+
+func (f *fakeUsers) GetAll(ctx context.Context) ([]*user.User, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	list := make([]*user.User, 0, len(f.users))
+	for _, u := range f.users {
+		copied := *u
+		list = append(list, &copied)
+	}
+	return list, nil
+}
+
+func (f *fakeUsers) Provision(ctx context.Context, u *user.User) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if existing, ok := f.users[u.Login]; ok && existing.Source != u.Source {
+		return sgerrors.ErrAlreadyExists
+	}
+	f.users[u.Login] = u
+	return nil
+}
+
+func (f *fakeUsers) Delete(ctx context.Context, login string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	delete(f.users, login)
+	return nil
+}
+
+func testConfig() *Config {
+	return &Config{
+		Enabled:      true,
+		URL:          "ldap://ldap.example.com",
+		BindDN:       testBindDN,
+		BindPassword: "control",
+		UserBaseDN:   "ou=people,dc=example,dc=com",
+		Roles: map[string]string{
+			testAdmins:                user.RoleAdmin,
+			strings.ToUpper(testDevs): user.RoleEditor,
+			testSupport:               user.RoleViewer,
+		},
+	}
+}
+
+func newTestService(t *testing.T, c *Config, d *fakeDirectory, users *fakeUsers) *Service {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), users)
+	svc.dial = d.dial
+	require.NoError(t, svc.SetConfig(context.Background(), c))
+	return svc
+}
+
+func TestService_Authenticate(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		config       func(c *Config)
+		login        string
+		password     string
+		expectedRole string
+		expectedErr  error
+	}{
+		{
+			name:         "editor",
+			login:        "alice",
+			password:     testPassword,
+			expectedRole: user.RoleEditor,
+		},
+		{
+			name:         "most privileged group",
+			login:        "bob",
+			password:     testPassword,
+			expectedRole: user.RoleAdmin,
+		},
+		{
+			name:        "wrong password",
+			login:       "alice",
+			password:    "wrong",
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+		{
+			name:        "empty password",
+			login:       "alice",
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+		{
+			name:        "unknown user",
+			login:       "mallory",
+			password:    testPassword,
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+		{
+			name:        "filter injection",
+			login:       "*",
+			password:    testPassword,
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+		{
+			name:        "no groups",
+			login:       "carol",
+			password:    testPassword,
+			expectedErr: ErrNoRole,
+		},
+		{
+			name:         "default role",
+			config:       func(c *Config) { c.DefaultRole = user.RoleViewer },
+			login:        "carol",
+			password:     testPassword,
+			expectedRole: user.RoleViewer,
+		},
+		{
+			name: "group search",
+			config: func(c *Config) {
+				c.GroupAttribute = "unknown"
+				c.GroupBaseDN = "ou=groups,dc=example,dc=com"
+				c.GroupFilter = "(&(objectClass=groupOfNames)(member={dn}))"
+			},
+			login:        "bob",
+			password:     testPassword,
+			expectedRole: user.RoleAdmin,
+		},
+		{
+			name:        "disabled",
+			config:      func(c *Config) { c.Enabled = false },
+			login:       "alice",
+			password:    testPassword,
+			expectedErr: sgerrors.ErrInvalidCredentials,
+		},
+	} {
+		c := testConfig()
+		if tc.config != nil {
+			tc.config(c)
+		}
+		users := &fakeUsers{users: map[string]*user.User{}}
+		svc := newTestService(t, c, newFakeDirectory(), users)
+
+		u, err := svc.Authenticate(context.Background(), tc.login, tc.password)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if tc.expectedErr != nil {
+			require.Empty(t, users.users, "TC: %s", tc.name)
+			continue
+		}
+
+		require.Equal(t, tc.expectedRole, u.Role, "TC: %s", tc.name)
+		require.Equal(t, Source, u.Source, "TC: %s", tc.name)
+		require.Equal(t, u, users.users[tc.login], "TC: %s", tc.name)
+	}
+}
+
+func TestService_AuthenticateLocalUser(t *testing.T) {
+	users := &fakeUsers{users: map[string]*user.User{
+		"alice": {Login: "alice", Source: "saml"},
+	}}
+	svc := newTestService(t, testConfig(), newFakeDirectory(), users)
+
+	_, err := svc.Authenticate(context.Background(), "alice", testPassword)
+	require.True(t, sgerrors.IsInvalidCredentials(err), "%v", err)
+	require.Equal(t, "saml", users.users["alice"].Source)
+}
+
+func TestService_Sync(t *testing.T) {
+	d := newFakeDirectory()
+	users := &fakeUsers{users: map[string]*user.User{
+		"root": {Login: "root"},
+	}}
+	svc := newTestService(t, testConfig(), d, users)
+
+	for _, login := range []string{"alice", "bob"} {
+		_, err := svc.Authenticate(context.Background(), login, testPassword)
+		require.NoError(t, err)
+	}
+
+	d.setGroups("alice", testSupport)
+	d.setGroups("bob")
+
+	res, err := svc.Sync(context.Background())
+	require.NoError(t, err)
+	sort.Strings(res.Updated)
+	require.Equal(t, []string{"alice"}, res.Updated)
+	require.Equal(t, []string{"bob"}, res.Removed)
+
+	require.Equal(t, user.RoleViewer, users.users["alice"].Role)
+	require.NotContains(t, users.users, "bob")
+	// local users are not synced
+	require.Contains(t, users.users, "root")
+
+	res, err = svc.Sync(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, res.Updated)
+	require.Empty(t, res.Removed)
+}
+
+func TestService_SetConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		config      func(c *Config)
+		expectedErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "disabled",
+			config: func(c *Config) { *c = Config{} },
+		},
+		{
+			name:        "http url",
+			config:      func(c *Config) { c.URL = "http://ldap.example.com" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "start tls with ldaps",
+			config: func(c *Config) {
+				c.URL = "ldaps://ldap.example.com"
+				c.StartTLS = true
+			},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "user filter without login",
+			config:      func(c *Config) { c.UserFilter = "(uid=alice)" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid user filter",
+			config:      func(c *Config) { c.UserFilter = "(uid={login}" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown role",
+			config:      func(c *Config) { c.Roles[testDevs] = "root" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "short sync interval",
+			config:      func(c *Config) { c.SyncInterval = "1s" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+	} {
+		c := testConfig()
+		if tc.config != nil {
+			tc.config(c)
+		}
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), &fakeUsers{})
+
+		err := svc.SetConfig(context.Background(), c)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+	}
+}
+
+func TestService_SetConfigKeepsPassword(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), &fakeUsers{})
+	require.NoError(t, svc.SetConfig(context.Background(), testConfig()))
+
+	c := testConfig()
+	c.BindPassword = ""
+	c.SyncInterval = "1h"
+	require.NoError(t, svc.SetConfig(context.Background(), c))
+
+	stored, err := svc.Config(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "control", stored.BindPassword)
+	require.Equal(t, "1h", stored.SyncInterval)
+}
@@ -0,0 +1,226 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/leader/"
+	DefaultLeaseDuration = 15 * time.Second
+
+	leaseKey = "control"
+)
+
+// Lease is a record of the replica that leads, it must be renewed
+// before it expires or another replica takes over.
+type Lease struct {
+	Holder    string    `json:"holder"`
+	Address   string    `json:"address"`
+	RenewedAt time.Time `json:"renewedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Elector makes sure that only one of control replicas sharing the storage
+// runs workflows and background reconcilers.
+type Elector struct {
+	id       string
+	address  string
+	prefix   string
+	storage  storage.Interface
+	duration time.Duration
+	now      func() time.Time
+
+	m         sync.RWMutex
+	lease     Lease
+	raw       []byte
+	isLeader  bool
+	cancel    func()
+	onElected []func(ctx context.Context)
+}
+
+// NewElector constructs an Elector, id must be unique among replicas and
+// address is an url other replicas forward requests to.
+func NewElector(id, address string, repository storage.Interface, duration time.Duration) *Elector {
+	return &Elector{
+		id:       id,
+		address:  address,
+		prefix:   DefaultStoragePrefix,
+		storage:  repository,
+		duration: duration,
+		now:      time.Now,
+	}
+}
+
+// OnElected registers a job that runs while the replica leads, its context
+// is cancelled when the leadership is lost.
+func (e *Elector) OnElected(job func(ctx context.Context)) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.onElected = append(e.onElected, job)
+}
+
+// IsLeader reports whether the replica leads.
+func (e *Elector) IsLeader() bool {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return e.isLeader
+}
+
+// Lease returns the last seen lease.
+func (e *Elector) Lease() Lease {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return e.lease
+}
+
+// ID returns the id of the replica.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Run blocks and keeps trying to acquire or renew the lease until ctx is cancelled,
+// the lease is released on exit so another replica can take over right away.
+// Storages that can't swap values atomically serve a single replica, it always leads.
+func (e *Elector) Run(ctx context.Context) {
+	if _, ok := e.storage.(storage.Swapper); !ok {
+		logrus.Warn("leader: storage doesn't support leader election, run a single control replica")
+		e.setLeader(ctx, true)
+		<-ctx.Done()
+		e.setLeader(ctx, false)
+		return
+	}
+
+	ticker := time.NewTicker(e.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		e.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	acquired, err := e.acquire(ctx)
+	if err != nil {
+		logrus.Errorf("leader: acquire lease: %v", err)
+		// the lease is kept while it is valid, storage may be back by then
+		acquired = e.IsLeader() && e.now().Before(e.Lease().ExpiresAt)
+	}
+
+	e.setLeader(ctx, acquired)
+}
+
+// acquire creates, renews or takes over an expired lease.
+func (e *Elector) acquire(ctx context.Context) (bool, error) {
+	current, err := e.storage.Get(ctx, e.prefix, leaseKey)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return false, errors.Wrap(err, "storage: get")
+	}
+
+	lease := Lease{}
+	if current != nil {
+		if err = json.Unmarshal(current, &lease); err != nil {
+			return false, errors.Wrap(err, "unmarshal")
+		}
+	}
+
+	now := e.now()
+	if current != nil && lease.Holder != e.id && now.Before(lease.ExpiresAt) {
+		e.observe(lease, current)
+		return false, nil
+	}
+
+	mine := Lease{
+		Holder:    e.id,
+		Address:   e.address,
+		RenewedAt: now,
+		ExpiresAt: now.Add(e.duration),
+	}
+	raw, err := json.Marshal(mine)
+	if err != nil {
+		return false, errors.Wrap(err, "marshal")
+	}
+
+	ok, err := e.storage.(storage.Swapper).CompareAndSwap(ctx, e.prefix, leaseKey, current, raw)
+	if err != nil {
+		return false, errors.Wrap(err, "storage: compare and swap")
+	}
+	if ok {
+		e.observe(mine, raw)
+	}
+
+	return ok, nil
+}
+
+// release expires the lease if the replica holds it.
+func (e *Elector) release() {
+	e.setLeader(context.Background(), false)
+
+	e.m.RLock()
+	lease, current := e.lease, e.raw
+	e.m.RUnlock()
+	if lease.Holder != e.id {
+		return
+	}
+
+	lease.ExpiresAt = e.now()
+	raw, err := json.Marshal(lease)
+	if err != nil {
+		return
+	}
+	if _, err = e.storage.(storage.Swapper).CompareAndSwap(context.Background(),
+		e.prefix, leaseKey, current, raw); err != nil {
+		logrus.Errorf("leader: release lease: %v", err)
+	}
+}
+
+func (e *Elector) observe(lease Lease, raw []byte) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.lease = lease
+	e.raw = raw
+}
+
+// setLeader starts jobs when the replica becomes the leader
+// and stops them when it steps down.
+func (e *Elector) setLeader(ctx context.Context, leader bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if leader == e.isLeader {
+		return
+	}
+	e.isLeader = leader
+
+	if !leader {
+		logrus.Infof("leader: %s stepped down", e.id)
+		e.cancel()
+		return
+	}
+
+	logrus.Infof("leader: %s has been elected", e.id)
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.cancel = cancel
+	for _, job := range e.onElected {
+		go job(leaderCtx)
+	}
+}
@@ -0,0 +1,126 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/testutils/storage"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestElector(id string, repository *memory.InMemoryRepository, c *clock) *Elector {
+	e := NewElector(id, "http://"+id, repository, time.Minute)
+	e.now = c.now
+	return e
+}
+
+func TestElector_tick(t *testing.T) {
+	repository := memory.NewInMemoryRepository()
+	c := &clock{t: time.Now()}
+	first := newTestElector("first", repository, c)
+	second := newTestElector("second", repository, c)
+
+	started := make(chan context.Context, 1)
+	first.OnElected(func(ctx context.Context) {
+		started <- ctx
+	})
+
+	first.tick(context.Background())
+	second.tick(context.Background())
+	require.True(t, first.IsLeader())
+	require.False(t, second.IsLeader())
+	require.Equal(t, "first", second.Lease().Holder)
+	require.Equal(t, "http://first", second.Lease().Address)
+
+	var leaderCtx context.Context
+	select {
+	case leaderCtx = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("job must be started when elected")
+	}
+
+	// renewal keeps the leadership
+	c.t = c.t.Add(30 * time.Second)
+	first.tick(context.Background())
+	c.t = c.t.Add(45 * time.Second)
+	second.tick(context.Background())
+	require.True(t, first.IsLeader())
+	require.False(t, second.IsLeader())
+
+	// expired lease is taken over
+	c.t = c.t.Add(time.Minute)
+	second.tick(context.Background())
+	first.tick(context.Background())
+	require.True(t, second.IsLeader())
+	require.False(t, first.IsLeader())
+	require.Error(t, leaderCtx.Err(), "jobs must be stopped on stepping down")
+}
+
+func TestElector_release(t *testing.T) {
+	repository := memory.NewInMemoryRepository()
+	c := &clock{t: time.Now()}
+	first := newTestElector("first", repository, c)
+	second := newTestElector("second", repository, c)
+
+	first.tick(context.Background())
+	require.True(t, first.IsLeader())
+
+	first.release()
+	require.False(t, first.IsLeader())
+
+	second.tick(context.Background())
+	require.True(t, second.IsLeader(), "released lease must be taken over right away")
+}
+
+func TestElector_tickStorageError(t *testing.T) {
+	repository := memory.NewInMemoryRepository()
+	c := &clock{t: time.Now()}
+	e := newTestElector("first", repository, c)
+	e.tick(context.Background())
+	require.True(t, e.IsLeader())
+
+	// storage failures keep the leadership until the lease expires
+	require.NoError(t, repository.Put(context.Background(), DefaultStoragePrefix, leaseKey, []byte("{")))
+	e.tick(context.Background())
+	require.True(t, e.IsLeader())
+
+	c.t = c.t.Add(2 * time.Minute)
+	e.tick(context.Background())
+	require.False(t, e.IsLeader())
+}
+
+func TestElector_RunWithoutSwapper(t *testing.T) {
+	e := NewElector("first", "", storage.Fake{}, time.Minute)
+	started := make(chan struct{})
+	e.OnElected(func(context.Context) {
+		close(started)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("single replica must lead")
+	}
+
+	cancel()
+	<-done
+	require.False(t, e.IsLeader())
+}
@@ -0,0 +1,94 @@
+package leader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+)
+
+// forwardedHeader marks requests forwarded by a follower, they are not forwarded
+// again if the replica has stepped down meanwhile.
+const forwardedHeader = "X-Supergiant-Forwarded-By"
+
+// Leadership is a view of the election state.
+type Leadership interface {
+	ID() string
+	IsLeader() bool
+	Lease() Lease
+}
+
+// Status describes the replica and the current leader.
+type Status struct {
+	ID            string `json:"id"`
+	IsLeader      bool   `json:"isLeader"`
+	Leader        string `json:"leader"`
+	LeaderAddress string `json:"leaderAddress"`
+}
+
+// Handler reports the election state and forwards requests to the leader.
+type Handler struct {
+	leadership Leadership
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(leadership Leadership) *Handler {
+	return &Handler{
+		leadership: leadership,
+	}
+}
+
+// Register adds the leader status handler to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/leader", h.status).Methods(http.MethodGet)
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	lease := h.leadership.Lease()
+	status := Status{
+		ID:            h.leadership.ID(),
+		IsLeader:      h.leadership.IsLeader(),
+		Leader:        lease.Holder,
+		LeaderAddress: lease.Address,
+	}
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// Forward is a middleware that passes requests changing state to the leader,
+// so workflows are started by the leader only while any replica serves reads.
+func (h *Handler) Forward(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isRead(r.Method) || h.leadership.IsLeader() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		lease := h.leadership.Lease()
+		if r.Header.Get(forwardedHeader) != "" || lease.Address == "" || lease.Holder == h.leadership.ID() {
+			http.Error(w, "leader is not elected, retry later", http.StatusServiceUnavailable)
+			return
+		}
+
+		target, err := url.Parse(lease.Address)
+		if err != nil {
+			logrus.Errorf("leader: parse address %s of %s: %v", lease.Address, lease.Holder, err)
+			http.Error(w, "leader is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		r.Header.Set(forwardedHeader, h.leadership.ID())
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	})
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,111 @@
+package leader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLeadership struct {
+	id       string
+	isLeader bool
+	lease    Lease
+}
+
+func (f fakeLeadership) ID() string {
+	return f.id
+}
+
+func (f fakeLeadership) IsLeader() bool {
+	return f.isLeader
+}
+
+func (f fakeLeadership) Lease() Lease {
+	return f.lease
+}
+
+func TestHandler_status(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(fakeLeadership{
+		id:    "second",
+		lease: Lease{Holder: "first", Address: "http://first"},
+	}).Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leader", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	status := Status{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	require.Equal(t, Status{ID: "second", Leader: "first", LeaderAddress: "http://first"}, status)
+}
+
+func TestHandler_Forward(t *testing.T) {
+	leaderSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "second", r.Header.Get(forwardedHeader))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer leaderSrv.Close()
+
+	for _, tc := range []struct {
+		name         string
+		method       string
+		leadership   fakeLeadership
+		forwarded    bool
+		expectedCode int
+	}{
+		{
+			name:         "read is served locally",
+			method:       http.MethodGet,
+			leadership:   fakeLeadership{id: "second"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "leader serves writes",
+			method:       http.MethodPost,
+			leadership:   fakeLeadership{id: "first", isLeader: true},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "write is forwarded",
+			method: http.MethodPost,
+			leadership: fakeLeadership{
+				id:    "second",
+				lease: Lease{Holder: "first", Address: leaderSrv.URL},
+			},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "no leader",
+			method:       http.MethodDelete,
+			leadership:   fakeLeadership{id: "second"},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "forwarded twice",
+			method: http.MethodPut,
+			leadership: fakeLeadership{
+				id:    "second",
+				lease: Lease{Holder: "first", Address: leaderSrv.URL},
+			},
+			forwarded:    true,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	} {
+		h := NewHandler(tc.leadership).Forward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		req := httptest.NewRequest(tc.method, "/v1/api/kubes", nil)
+		if tc.forwarded {
+			req.Header.Set(forwardedHeader, "third")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
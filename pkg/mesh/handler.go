@@ -0,0 +1,155 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// Servicer is an interface of the mesh service.
+type Servicer interface {
+	Create(ctx context.Context, m *Mesh) error
+	Get(ctx context.Context, id string) (*Mesh, error)
+	List(ctx context.Context) ([]Mesh, error)
+	Sync(ctx context.Context, id string, rotate bool) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Handler is a http handler for wireguard meshes, nodes are configured in
+// the background and the state of the mesh reflects the progress.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds mesh handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/meshes", h.createMesh).Methods(http.MethodPost)
+	r.HandleFunc("/meshes", h.listMeshes).Methods(http.MethodGet)
+	r.HandleFunc("/meshes/{id}", h.getMesh).Methods(http.MethodGet)
+	r.HandleFunc("/meshes/{id}", h.deleteMesh).Methods(http.MethodDelete)
+	r.HandleFunc("/meshes/{id}/sync", h.syncMesh(false)).Methods(http.MethodPost)
+	r.HandleFunc("/meshes/{id}/rotate", h.syncMesh(true)).Methods(http.MethodPost)
+}
+
+func (h *Handler) createMesh(w http.ResponseWriter, r *http.Request) {
+	m := &Mesh{}
+	if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.Create(r.Context(), m); err != nil {
+		logrus.Errorf("mesh: create %s: %v", m.Name, err)
+		sendError(w, err)
+		return
+	}
+
+	ctx := tenant.Detach(r.Context())
+	go func() {
+		if err := h.svc.Sync(ctx, m.ID, false); err != nil {
+			logrus.Errorf("mesh %s: sync: %v", m.ID, err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(m.Redacted()); err != nil {
+		logrus.Errorf("mesh: encode %s: %v", m.ID, err)
+	}
+}
+
+func (h *Handler) listMeshes(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		logrus.Errorf("mesh: list: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	for i := range list {
+		list[i] = list[i].Redacted()
+	}
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getMesh(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(m.Redacted()); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) deleteMesh(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	ctx := tenant.Detach(r.Context())
+	go func() {
+		if err := h.svc.Delete(ctx, m.ID); err != nil {
+			logrus.Errorf("mesh %s: delete: %v", m.ID, err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// syncMesh reconfigures nodes of the mesh, keys of all nodes are replaced when rotate is set.
+func (h *Handler) syncMesh(rotate bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		if m.State == StateDeleting {
+			sendError(w, errors.Wrapf(ErrSyncing, "mesh %s is being deleted", m.ID))
+			return
+		}
+
+		ctx := tenant.Detach(r.Context())
+		go func() {
+			if err := h.svc.Sync(ctx, m.ID, rotate); err != nil {
+				logrus.Errorf("mesh %s: sync: %v", m.ID, err)
+			}
+		}()
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func sendError(w http.ResponseWriter, err error) {
+	switch cause := errors.Cause(err); {
+	case sgerrors.IsNotFound(err):
+		message.SendNotFound(w, "mesh", err)
+	case cause == ErrOverlap || cause == ErrSyncing:
+		message.SendAlreadyExists(w, "mesh", err)
+	case cause == sgerrors.ErrInvalidJson || cause == ErrExhausted:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,92 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestHandler(t *testing.T) {
+	svc, _ := newTestService(fakeKubes{
+		"aws": kubeFixture("aws", clouds.AWS, "aws-1"),
+		"do":  kubeFixture("do", clouds.DigitalOcean, "do-1"),
+	})
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "single cluster",
+			body:         `{"name":"m","clusterIds":["aws"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "overlap",
+			body:         `{"name":"m","cidr":"10.0.0.0/8","clusterIds":["aws","do"]}`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "accepted",
+			body:         `{"name":"m","clusterIds":["aws","do"]}`,
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/meshes", bytes.NewBufferString(tc.body)))
+
+			require.Equal(t, tc.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+
+	list, err := svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	id := list[0].ID
+
+	var m *Mesh
+	for i := 0; i < 100; i++ {
+		if m, err = svc.Get(context.Background(), id); err == nil && m.State == StateReady {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, StateReady, m.State)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/meshes/"+id, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	m = &Mesh{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(m))
+	require.Len(t, m.Members, 2)
+	for _, member := range m.Members {
+		require.NotEmpty(t, member.PublicKey)
+		require.Empty(t, member.PrivateKey, "private keys must not be exposed")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/meshes/missing/rotate", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/meshes/"+id+"/rotate", nil))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+}
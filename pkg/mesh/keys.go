@@ -0,0 +1,26 @@
+package mesh
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// generateKey returns a base64 encoded curve25519 key pair in the format
+// of wg genkey and wg pubkey.
+func generateKey() (string, string, error) {
+	var private, public [32]byte
+	if _, err := rand.Read(private[:]); err != nil {
+		return "", "", err
+	}
+
+	// https://cr.yp.to/ecdh.html
+	private[0] &= 248
+	private[31] &= 127
+	private[31] |= 64
+	curve25519.ScalarBaseMult(&public, &private)
+
+	return base64.StdEncoding.EncodeToString(private[:]),
+		base64.StdEncoding.EncodeToString(public[:]), nil
+}
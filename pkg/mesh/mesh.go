@@ -0,0 +1,630 @@
+package mesh
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/wireguard"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/meshes/"
+
+	// DefaultCIDR is a shared address space range, it doesn't collide
+	// with ranges of cloud networks and kubernetes.
+	DefaultCIDR = "100.64.0.0/16"
+)
+
+type State string
+
+const (
+	StateSyncing  State = "syncing"
+	StateReady    State = "ready"
+	StateFailed   State = "failed"
+	StateDeleting State = "deleting"
+)
+
+var (
+	// ErrSyncing is returned while nodes of the mesh are being configured.
+	ErrSyncing = errors.New("mesh is being synced")
+	// ErrOverlap is returned for a mesh range used by a network of a member cluster.
+	ErrOverlap = errors.New("mesh cidr overlaps with a network of the cluster")
+	// ErrExhausted is returned when the mesh range has no free addresses for nodes.
+	ErrExhausted = errors.New("no free addresses left in the mesh cidr")
+)
+
+// Member is a node of a cluster that is a part of the mesh.
+type Member struct {
+	ClusterID string `json:"clusterId"`
+	NodeName  string `json:"nodeName"`
+	PublicIP  string `json:"publicIp"`
+	// OverlayIP is an address of the node within the mesh
+	OverlayIP    string    `json:"overlayIp"`
+	PublicKey    string    `json:"publicKey"`
+	PrivateKey   string    `json:"privateKey,omitempty"`
+	KeyCreatedAt time.Time `json:"keyCreatedAt"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Mesh connects nodes of clusters with wireguard tunnels, clusters
+// may run in different clouds.
+type Mesh struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CIDR       string    `json:"cidr"`
+	ListenPort int       `json:"listenPort"`
+	ClusterIDs []string  `json:"clusterIds"`
+	Members    []Member  `json:"members"`
+	State      State     `json:"state"`
+	SyncedAt   time.Time `json:"syncedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Redacted returns a copy of the mesh without private keys.
+func (m Mesh) Redacted() Mesh {
+	members := make([]Member, len(m.Members))
+	for i := range m.Members {
+		members[i] = m.Members[i]
+		members[i].PrivateKey = ""
+	}
+	m.Members = members
+	return m
+}
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+type accountGetter interface {
+	Get(ctx context.Context, accountName string) (*model.CloudAccount, error)
+}
+
+// runFn runs the workflow and waits for the result.
+type runFn func(ctx context.Context, workflow string, cfg *steps.Config) error
+
+// Service keeps wireguard configuration of nodes in sync with member clusters.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	kubes    kubeGetter
+	accounts accountGetter
+	run      runFn
+	keyTTL   time.Duration
+
+	m       sync.Mutex
+	syncing map[string]bool
+}
+
+// NewService constructs a Service, tasks are saved to the taskRepo.
+func NewService(prefix string, s storage.Interface, kubes kubeGetter,
+	accounts accountGetter, taskRepo storage.Interface, keyTTL time.Duration) *Service {
+	return &Service{
+		prefix:   prefix,
+		storage:  s,
+		kubes:    kubes,
+		accounts: accounts,
+		run:      taskRunner(taskRepo),
+		keyTTL:   keyTTL,
+		syncing:  make(map[string]bool),
+	}
+}
+
+// Create validates the mesh and saves it, nodes are configured with Sync.
+func (s *Service) Create(ctx context.Context, m *Mesh) error {
+	if m.Name == "" {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "mesh name is required")
+	}
+	if m.CIDR == "" {
+		m.CIDR = DefaultCIDR
+	}
+	if m.ListenPort == 0 {
+		m.ListenPort = wireguard.DefaultListenPort
+	}
+	_, network, err := net.ParseCIDR(m.CIDR)
+	if err != nil {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "mesh cidr: %v", err)
+	}
+
+	m.ClusterIDs = unique(m.ClusterIDs)
+	if len(m.ClusterIDs) < 2 {
+		return errors.Wrap(sgerrors.ErrInvalidJson, "mesh requires at least two clusters")
+	}
+	for _, id := range m.ClusterIDs {
+		k, err := s.kubes.Get(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "get kube %s", id)
+		}
+		if err = validateKube(k, network); err != nil {
+			return err
+		}
+	}
+
+	m.ID = uuid.New()[:8]
+	m.Members = nil
+	m.State = StateSyncing
+	m.CreatedAt = time.Now()
+
+	return s.save(ctx, m)
+}
+
+// Get returns a mesh by its id.
+func (s *Service) Get(ctx context.Context, id string) (*Mesh, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get mesh %s", id)
+	}
+
+	m := new(Mesh)
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "decode mesh %s", id)
+	}
+
+	return m, nil
+}
+
+// List returns all meshes.
+func (s *Service) List(ctx context.Context) ([]Mesh, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list meshes")
+	}
+
+	list := make([]Mesh, 0, len(raw))
+	for _, data := range raw {
+		m := Mesh{}
+		if err = json.Unmarshal(data, &m); err != nil {
+			logrus.Warnf("mesh: skip corrupted record: %v", err)
+			continue
+		}
+		list = append(list, m)
+	}
+
+	return list, nil
+}
+
+// Sync adds nodes that joined member clusters to the mesh, removes gone ones,
+// rotates expired keys and applies the configuration to every node.
+// All keys are rotated when rotate is set.
+func (s *Service) Sync(ctx context.Context, id string, rotate bool) error {
+	if !s.lock(ctx, id) {
+		return errors.Wrapf(ErrSyncing, "mesh %s", id)
+	}
+	defer s.unlock(ctx, id)
+
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if m.State == StateDeleting {
+		return errors.Wrapf(sgerrors.ErrNotFound, "mesh %s is being deleted", id)
+	}
+
+	kubes, err := s.memberKubes(ctx, m)
+	if err != nil {
+		return err
+	}
+	if err = m.reconcile(kubes, rotate, s.keyTTL, time.Now()); err != nil {
+		return err
+	}
+	m.State = StateSyncing
+	if err = s.save(ctx, m); err != nil {
+		return err
+	}
+
+	m.State = StateReady
+	if !s.apply(ctx, m, kubes, false) {
+		m.State = StateFailed
+	}
+	m.SyncedAt = time.Now()
+
+	return s.save(ctx, m)
+}
+
+// Delete removes wireguard interfaces from nodes of the mesh and the mesh
+// itself, the mesh stays in the deleting state when some nodes were not cleaned.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if !s.lock(ctx, id) {
+		return errors.Wrapf(ErrSyncing, "mesh %s", id)
+	}
+	defer s.unlock(ctx, id)
+
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	m.State = StateDeleting
+	if err = s.save(ctx, m); err != nil {
+		return err
+	}
+
+	kubes, err := s.memberKubes(ctx, m)
+	if err != nil {
+		return err
+	}
+	if !s.apply(ctx, m, kubes, true) {
+		if err = s.save(ctx, m); err != nil {
+			return err
+		}
+		return errors.Errorf("mesh %s: some nodes were not cleaned up", id)
+	}
+
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, id), "delete mesh %s", id)
+}
+
+// Run blocks and syncs all meshes every interval until ctx is cancelled,
+// so new nodes join meshes and keys are rotated when they expire.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncAll(ctx)
+		}
+	}
+}
+
+// syncAll syncs meshes of all tenants, every mesh is synced with
+// a context of its tenant.
+func (s *Service) syncAll(ctx context.Context) {
+	ids, err := tenant.All(ctx, s.storage)
+	if err != nil {
+		logrus.Errorf("mesh: list tenants: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		ctx := tenant.WithID(ctx, id)
+		list, err := s.List(ctx)
+		if err != nil {
+			logrus.Errorf("mesh: tenant %s: %v", id, err)
+			continue
+		}
+		for _, m := range list {
+			if m.State == StateDeleting || s.inMaintenance(ctx, &m) {
+				continue
+			}
+			if err = s.Sync(ctx, m.ID, false); err != nil {
+				logrus.Errorf("mesh %s: sync: %v", m.ID, err)
+			}
+		}
+	}
+}
+
+// apply configures wireguard on every member, members that are not
+// reachable keep the error until the next sync.
+func (s *Service) apply(ctx context.Context, m *Mesh, kubes map[string]*model.Kube, remove bool) bool {
+	errs := make([]error, len(m.Members))
+	wg := sync.WaitGroup{}
+	for i := range m.Members {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.configure(ctx, m, &m.Members[i], kubes[m.Members[i].ClusterID], remove)
+		}(i)
+	}
+	wg.Wait()
+
+	ok := true
+	for i, err := range errs {
+		m.Members[i].Error = ""
+		if err != nil {
+			logrus.Errorf("mesh %s: node %s of cluster %s: %v", m.ID,
+				m.Members[i].NodeName, m.Members[i].ClusterID, err)
+			m.Members[i].Error = err.Error()
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (s *Service) configure(ctx context.Context, m *Mesh, member *Member, k *model.Kube, remove bool) error {
+	if k == nil {
+		return errors.Wrapf(sgerrors.ErrNotFound, "kube %s", member.ClusterID)
+	}
+	node := findMachine(k, member.NodeName)
+	if node == nil {
+		return errors.Wrapf(sgerrors.ErrNotFound, "node %s", member.NodeName)
+	}
+
+	cfg := &steps.Config{
+		Provider:         k.Provider,
+		IsMaster:         node.Role == model.RoleMaster,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Node:             *node,
+		WireGuardConfig: steps.WireGuardConfig{
+			Interface:  wireguard.DefaultInterface,
+			ListenPort: m.ListenPort,
+		},
+	}
+	if k.ExternallyManaged {
+		// firewalls of imported clusters are not managed, only nodes are configured
+		cfg.Kube = *k
+	} else {
+		acc, err := s.accounts.Get(ctx, k.AccountName)
+		if err != nil {
+			return errors.Wrapf(err, "get cloud account %s", k.AccountName)
+		}
+		if err = util.FillCloudAccountCredentials(ctx, acc, cfg); err != nil {
+			return errors.Wrapf(err, "cloud account %s", k.AccountName)
+		}
+		if err = util.LoadCloudSpecificDataFromKube(k, cfg); err != nil {
+			return err
+		}
+	}
+
+	if !remove {
+		_, network, _ := net.ParseCIDR(m.CIDR)
+		prefix, _ := network.Mask.Size()
+		cfg.WireGuardConfig.Address = fmt.Sprintf("%s/%d", member.OverlayIP, prefix)
+		cfg.WireGuardConfig.PrivateKey = member.PrivateKey
+		cfg.WireGuardConfig.Peers = m.peersOf(member)
+	}
+
+	return s.run(ctx, workflows.WireGuard, cfg)
+}
+
+// inMaintenance reports whether any cluster of the mesh is in maintenance,
+// nodes of such clusters must not be reconfigured in the background.
+func (s *Service) inMaintenance(ctx context.Context, m *Mesh) bool {
+	for _, id := range m.ClusterIDs {
+		if k, err := s.kubes.Get(ctx, id); err == nil && k.InMaintenance() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) memberKubes(ctx context.Context, m *Mesh) (map[string]*model.Kube, error) {
+	kubes := make(map[string]*model.Kube, len(m.ClusterIDs))
+	for _, id := range m.ClusterIDs {
+		k, err := s.kubes.Get(ctx, id)
+		if sgerrors.IsNotFound(err) {
+			// nodes of deleted clusters leave the mesh
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "get kube %s", id)
+		}
+		kubes[id] = k
+	}
+
+	return kubes, nil
+}
+
+func (s *Service) save(ctx context.Context, m *Mesh) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrapf(err, "encode mesh %s", m.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, m.ID, data), "save mesh %s", m.ID)
+}
+
+// lock marks the mesh of the tenant of ctx as being synced, ids of meshes
+// are unique within a tenant only.
+func (s *Service) lock(ctx context.Context, id string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	key := syncKey(ctx, id)
+	if s.syncing[key] {
+		return false
+	}
+	s.syncing[key] = true
+	return true
+}
+
+func (s *Service) unlock(ctx context.Context, id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.syncing, syncKey(ctx, id))
+}
+
+func syncKey(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
+
+// reconcile updates members of the mesh with active nodes of the clusters,
+// addresses of nodes are kept while they stay in the mesh.
+func (m *Mesh) reconcile(kubes map[string]*model.Kube, rotate bool, keyTTL time.Duration, now time.Time) error {
+	_, network, err := net.ParseCIDR(m.CIDR)
+	if err != nil {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "mesh cidr: %v", err)
+	}
+
+	existing := make(map[string]Member, len(m.Members))
+	used := make(map[string]bool, len(m.Members))
+	for _, member := range m.Members {
+		existing[member.ClusterID+"/"+member.NodeName] = member
+	}
+
+	members := make([]Member, 0, len(m.Members))
+	for _, id := range m.ClusterIDs {
+		k := kubes[id]
+		if k == nil {
+			continue
+		}
+		for _, node := range activeNodes(k) {
+			member, ok := existing[id+"/"+node.Name]
+			if !ok {
+				member = Member{
+					ClusterID: id,
+					NodeName:  node.Name,
+				}
+			}
+			member.PublicIP = node.PublicIp
+			members = append(members, member)
+			if member.OverlayIP != "" {
+				used[member.OverlayIP] = true
+			}
+		}
+	}
+
+	for i := range members {
+		if members[i].OverlayIP == "" {
+			ip, err := nextFree(network, used)
+			if err != nil {
+				return err
+			}
+			members[i].OverlayIP = ip
+			used[ip] = true
+		}
+
+		expired := keyTTL > 0 && now.Sub(members[i].KeyCreatedAt) > keyTTL
+		if members[i].PrivateKey == "" || rotate || expired {
+			priv, pub, err := generateKey()
+			if err != nil {
+				return errors.Wrap(err, "generate wireguard key")
+			}
+			members[i].PrivateKey = priv
+			members[i].PublicKey = pub
+			members[i].KeyCreatedAt = now
+		}
+	}
+	m.Members = members
+
+	return nil
+}
+
+// peersOf returns all other members of the mesh as wireguard peers.
+func (m *Mesh) peersOf(member *Member) []steps.WireGuardPeer {
+	peers := make([]steps.WireGuardPeer, 0, len(m.Members))
+	for _, other := range m.Members {
+		if other.ClusterID == member.ClusterID && other.NodeName == member.NodeName {
+			continue
+		}
+		peers = append(peers, steps.WireGuardPeer{
+			PublicKey:  other.PublicKey,
+			Endpoint:   fmt.Sprintf("%s:%d", other.PublicIP, m.ListenPort),
+			AllowedIPs: []string{other.OverlayIP + "/32"},
+		})
+	}
+
+	return peers
+}
+
+func validateKube(k *model.Kube, network *net.IPNet) error {
+	if k.State != model.StateOperational {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s is %s", k.ID, k.State)
+	}
+
+	ranges := []string{k.Networking.CIDR, k.ServicesCIDR}
+	if k.Provider == clouds.AWS {
+		ranges = append(ranges, k.CloudSpec[clouds.AwsVpcCIDR])
+	}
+	for _, cidr := range ranges {
+		_, other, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(other.IP) || other.Contains(network.IP) {
+			return errors.Wrapf(ErrOverlap, "%s of kube %s", cidr, k.ID)
+		}
+	}
+
+	return nil
+}
+
+func activeNodes(k *model.Kube) []*model.Machine {
+	out := make([]*model.Machine, 0, len(k.Masters)+len(k.Nodes))
+	for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for _, m := range machines {
+			if m != nil && m.State == model.MachineStateActive && m.PublicIp != "" {
+				out = append(out, m)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+func findMachine(k *model.Kube, name string) *model.Machine {
+	for _, machines := range []map[string]*model.Machine{k.Masters, k.Nodes} {
+		for _, m := range machines {
+			if m != nil && m.Name == name {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// nextFree returns the lowest address of the network that is not used,
+// the network address itself is skipped.
+func nextFree(network *net.IPNet, used map[string]bool) (string, error) {
+	ip := network.IP.To4()
+	if ip == nil {
+		return "", errors.Wrap(sgerrors.ErrInvalidJson, "mesh cidr must be ipv4")
+	}
+	ones, bits := network.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	base := binary.BigEndian.Uint32(ip)
+
+	// the last address is a broadcast one
+	for i := uint32(1); i+1 < size; i++ {
+		next := make(net.IP, 4)
+		binary.BigEndian.PutUint32(next, base+i)
+		if !used[next.String()] {
+			return next.String(), nil
+		}
+	}
+
+	return "", errors.Wrapf(ErrExhausted, "%s", network)
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
+
+func taskRunner(repo storage.Interface) runFn {
+	return func(ctx context.Context, workflow string, cfg *steps.Config) error {
+		t, err := workflows.NewTask(workflow, repo)
+		if err != nil {
+			return err
+		}
+		writer, err := util.GetWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return err
+		}
+
+		return <-t.Run(tenant.Detach(ctx), *cfg, writer)
+	}
+}
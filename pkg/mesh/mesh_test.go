@@ -0,0 +1,330 @@
+package mesh
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, id string) (*model.Kube, error) {
+	k, ok := f[id]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+type fakeAccounts struct{}
+
+func (fakeAccounts) Get(ctx context.Context, name string) (*model.CloudAccount, error) {
+	return &model.CloudAccount{
+		Name:     name,
+		Provider: clouds.Name(name),
+	}, nil
+}
+
+// fakeRunner records wireguard configs of nodes and fails on nodes from failOn.
+type fakeRunner struct {
+	m       sync.Mutex
+	configs map[string]steps.WireGuardConfig
+	failOn  map[string]bool
+	// tenants are tenants of contexts of configured nodes
+	tenants map[string]string
+}
+
+func (f *fakeRunner) run(ctx context.Context, workflow string, cfg *steps.Config) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if workflow != workflows.WireGuard {
+		return errors.Errorf("unexpected workflow %s", workflow)
+	}
+	if f.failOn[cfg.Node.Name] {
+		return errors.New("ssh: connection refused")
+	}
+	f.tenants[cfg.Node.Name] = tenant.FromContext(ctx)
+	f.configs[cfg.Node.Name] = cfg.WireGuardConfig
+	return nil
+}
+
+func kubeFixture(id string, provider clouds.Name, nodes ...string) *model.Kube {
+	k := &model.Kube{
+		ID:           id,
+		Provider:     provider,
+		AccountName:  string(provider),
+		State:        model.StateOperational,
+		Networking:   model.Networking{CIDR: "10.0.0.0/16"},
+		ServicesCIDR: "10.3.0.0/16",
+		Masters:      map[string]*model.Machine{},
+		Nodes:        map[string]*model.Machine{},
+	}
+	for i, name := range nodes {
+		k.Nodes[name] = &model.Machine{
+			Name:     name,
+			State:    model.MachineStateActive,
+			PublicIp: net.IPv4(1, 1, 1, byte(i+1)).String(),
+		}
+	}
+	return k
+}
+
+func newTestService(kubes fakeKubes) (*Service, *fakeRunner) {
+	r := &fakeRunner{
+		configs: make(map[string]steps.WireGuardConfig),
+		failOn:  make(map[string]bool),
+		tenants: make(map[string]string),
+	}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes, fakeAccounts{}, nil, time.Hour)
+	svc.run = r.run
+	return svc, r
+}
+
+func TestGenerateKey(t *testing.T) {
+	priv, pub, err := generateKey()
+	require.NoError(t, err)
+
+	rawPriv, err := base64.StdEncoding.DecodeString(priv)
+	require.NoError(t, err)
+	require.Len(t, rawPriv, 32)
+
+	var private, public [32]byte
+	copy(private[:], rawPriv)
+	curve25519.ScalarBaseMult(&public, &private)
+	require.Equal(t, pub, base64.StdEncoding.EncodeToString(public[:]))
+}
+
+func TestNextFree(t *testing.T) {
+	_, network, _ := net.ParseCIDR("100.64.0.0/30")
+
+	ip, err := nextFree(network, map[string]bool{})
+	require.NoError(t, err)
+	require.Equal(t, "100.64.0.1", ip)
+
+	ip, err = nextFree(network, map[string]bool{"100.64.0.1": true})
+	require.NoError(t, err)
+	require.Equal(t, "100.64.0.2", ip)
+
+	_, err = nextFree(network, map[string]bool{"100.64.0.1": true, "100.64.0.2": true})
+	require.Equal(t, ErrExhausted, errors.Cause(err))
+}
+
+func TestService_Create(t *testing.T) {
+	provisioning := kubeFixture("provisioning", clouds.AWS)
+	provisioning.State = model.StateProvisioning
+	overlap := kubeFixture("overlap", clouds.DigitalOcean)
+	overlap.Networking.CIDR = "100.64.128.0/17"
+
+	kubes := fakeKubes{
+		"aws":          kubeFixture("aws", clouds.AWS),
+		"do":           kubeFixture("do", clouds.DigitalOcean),
+		"provisioning": provisioning,
+		"overlap":      overlap,
+	}
+
+	for _, tc := range []struct {
+		name        string
+		mesh        Mesh
+		expectedErr error
+	}{
+		{
+			name:        "no name",
+			mesh:        Mesh{ClusterIDs: []string{"aws", "do"}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid cidr",
+			mesh:        Mesh{Name: "m", CIDR: "100.64.0.0", ClusterIDs: []string{"aws", "do"}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "single cluster",
+			mesh:        Mesh{Name: "m", ClusterIDs: []string{"aws", "aws"}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "not found",
+			mesh:        Mesh{Name: "m", ClusterIDs: []string{"aws", "missing"}},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "not operational",
+			mesh:        Mesh{Name: "m", ClusterIDs: []string{"aws", "provisioning"}},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "overlap",
+			mesh:        Mesh{Name: "m", ClusterIDs: []string{"aws", "overlap"}},
+			expectedErr: ErrOverlap,
+		},
+		{
+			name: "created",
+			mesh: Mesh{Name: "m", ClusterIDs: []string{"aws", "do"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, _ := newTestService(kubes)
+
+			m := tc.mesh
+			err := svc.Create(context.Background(), &m)
+			require.Equal(t, tc.expectedErr, errors.Cause(err))
+			if err != nil {
+				return
+			}
+
+			stored, err := svc.Get(context.Background(), m.ID)
+			require.NoError(t, err)
+			require.Equal(t, DefaultCIDR, stored.CIDR)
+			require.Equal(t, 51820, stored.ListenPort)
+			require.Equal(t, StateSyncing, stored.State)
+		})
+	}
+}
+
+func TestService_Sync(t *testing.T) {
+	kubes := fakeKubes{
+		"aws": kubeFixture("aws", clouds.AWS, "aws-1", "aws-2"),
+		"do":  kubeFixture("do", clouds.DigitalOcean, "do-1"),
+	}
+	svc, r := newTestService(kubes)
+	ctx := context.Background()
+
+	m := &Mesh{Name: "m", ClusterIDs: []string{"aws", "do"}}
+	require.NoError(t, svc.Create(ctx, m))
+	require.NoError(t, svc.Sync(ctx, m.ID, false))
+
+	m, err := svc.Get(ctx, m.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateReady, m.State)
+	require.Len(t, m.Members, 3)
+	require.Len(t, r.configs, 3)
+
+	cfg := r.configs["do-1"]
+	require.Equal(t, "100.64.0.3/16", cfg.Address)
+	require.Len(t, cfg.Peers, 2)
+	require.Equal(t, "1.1.1.1:51820", cfg.Peers[0].Endpoint)
+	require.Equal(t, []string{"100.64.0.1/32"}, cfg.Peers[0].AllowedIPs)
+	require.Equal(t, m.Members[0].PublicKey, cfg.Peers[0].PublicKey)
+	require.NotEmpty(t, cfg.PrivateKey)
+
+	// a node has been deleted and a new one joined
+	delete(kubes["aws"].Nodes, "aws-1")
+	kubes["do"].Nodes["do-2"] = &model.Machine{Name: "do-2", State: model.MachineStateActive, PublicIp: "2.2.2.2"}
+	r.failOn["do-2"] = true
+	keys := map[string]string{}
+	for _, member := range m.Members {
+		keys[member.NodeName] = member.PrivateKey
+	}
+
+	require.NoError(t, svc.Sync(ctx, m.ID, false))
+	m, err = svc.Get(ctx, m.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, m.State)
+	require.Len(t, m.Members, 3)
+	require.Equal(t, "100.64.0.2", m.Members[0].OverlayIP, "address must be kept")
+	require.Equal(t, keys["aws-2"], m.Members[0].PrivateKey, "key must not be rotated")
+	require.Equal(t, "100.64.0.1", m.Members[2].OverlayIP, "free address must be reused")
+	require.NotEmpty(t, m.Members[2].Error)
+
+	delete(r.failOn, "do-2")
+	require.NoError(t, svc.Sync(ctx, m.ID, true))
+	m, err = svc.Get(ctx, m.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateReady, m.State)
+	require.NotEqual(t, keys["aws-2"], m.Members[0].PrivateKey, "key must be rotated")
+	require.Empty(t, m.Members[2].Error)
+}
+
+func TestService_syncAll(t *testing.T) {
+	kubes := fakeKubes{
+		"aws":      kubeFixture("aws", clouds.AWS, "aws-1"),
+		"do":       kubeFixture("do", clouds.DigitalOcean, "do-1"),
+		"acme-aws": kubeFixture("acme-aws", clouds.AWS, "acme-aws-1"),
+		"acme-do":  kubeFixture("acme-do", clouds.DigitalOcean, "acme-do-1"),
+	}
+	svc, r := newTestService(kubes)
+	svc.storage = tenant.NewStorage(memory.NewInMemoryRepository())
+
+	def := &Mesh{Name: "m", ClusterIDs: []string{"aws", "do"}}
+	require.NoError(t, svc.Create(context.Background(), def))
+	acme := &Mesh{Name: "m", ClusterIDs: []string{"acme-aws", "acme-do"}}
+	require.NoError(t, svc.Create(tenant.WithID(context.Background(), "acme"), acme))
+
+	// a mesh of another tenant is being synced
+	require.True(t, svc.lock(tenant.WithID(context.Background(), "other"), def.ID))
+
+	svc.syncAll(context.Background())
+
+	require.Equal(t, map[string]string{
+		"aws-1":      tenant.DefaultID,
+		"do-1":       tenant.DefaultID,
+		"acme-aws-1": "acme",
+		"acme-do-1":  "acme",
+	}, r.tenants)
+	m, err := svc.Get(tenant.WithID(context.Background(), "acme"), acme.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateReady, m.State)
+	require.Len(t, m.Members, 2)
+}
+
+func TestMesh_reconcileExpiredKeys(t *testing.T) {
+	now := time.Now()
+	kubes := map[string]*model.Kube{
+		"do": kubeFixture("do", clouds.DigitalOcean, "fresh", "stale"),
+	}
+	m := &Mesh{
+		CIDR:       DefaultCIDR,
+		ClusterIDs: []string{"do"},
+		Members: []Member{
+			{ClusterID: "do", NodeName: "fresh", OverlayIP: "100.64.0.1", PrivateKey: "a", KeyCreatedAt: now},
+			{ClusterID: "do", NodeName: "stale", OverlayIP: "100.64.0.2", PrivateKey: "b", KeyCreatedAt: now.Add(-2 * time.Hour)},
+		},
+	}
+
+	require.NoError(t, m.reconcile(kubes, false, time.Hour, now))
+	require.Equal(t, "a", m.Members[0].PrivateKey)
+	require.NotEqual(t, "b", m.Members[1].PrivateKey)
+	require.Equal(t, now, m.Members[1].KeyCreatedAt)
+}
+
+func TestService_Delete(t *testing.T) {
+	kubes := fakeKubes{
+		"aws": kubeFixture("aws", clouds.AWS, "aws-1"),
+		"do":  kubeFixture("do", clouds.DigitalOcean, "do-1"),
+	}
+	svc, r := newTestService(kubes)
+	ctx := context.Background()
+
+	m := &Mesh{Name: "m", ClusterIDs: []string{"aws", "do"}}
+	require.NoError(t, svc.Create(ctx, m))
+	require.NoError(t, svc.Sync(ctx, m.ID, false))
+
+	r.failOn["do-1"] = true
+	require.Error(t, svc.Delete(ctx, m.ID))
+	stored, err := svc.Get(ctx, m.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateDeleting, stored.State)
+	require.True(t, sgerrors.IsNotFound(svc.Sync(ctx, m.ID, false)), "deleted mesh must not be synced")
+
+	delete(r.failOn, "do-1")
+	require.NoError(t, svc.Delete(ctx, m.ID))
+	require.Empty(t, r.configs["aws-1"].Peers, "interface must be removed")
+	_, err = svc.Get(ctx, m.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+}
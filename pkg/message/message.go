@@ -42,7 +42,13 @@ func SendMessage(w http.ResponseWriter, msg Message, status int) {
 	w.Write(data)
 }
 
+// SendInvalidJSON answers requests that can't be decoded, bodies cut by
+// the size limit are answered with 413 instead.
 func SendInvalidJSON(w http.ResponseWriter, err error) {
+	if sgerrors.IsRequestTooLarge(err) {
+		SendRequestTooLarge(w, err)
+		return
+	}
 	msg := New("User has sent data in malformed format", err.Error(), sgerrors.InvalidJSON, "")
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -125,3 +131,8 @@ func SendInvalidCredentials(w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusBadRequest)
 	w.Write(data)
 }
+
+func SendRequestTooLarge(w http.ResponseWriter, err error) {
+	SendMessage(w, New("Request is too large", err.Error(), sgerrors.RequestTooLarge, ""),
+		http.StatusRequestEntityTooLarge)
+}
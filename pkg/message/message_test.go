@@ -261,3 +261,24 @@ func TestSendInvalidCredentials(t *testing.T) {
 			errMsg, msg2.DevMessage)
 	}
 }
+
+func TestSendRequestTooLarge(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	SendInvalidJSON(rec, sgerrors.ErrRequestTooLarge)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Wrong code expected %d actual %d",
+			http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	msg := &Message{}
+	if err := json.Unmarshal(rec.Body.Bytes(), msg); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if msg.ErrorCode != sgerrors.RequestTooLarge {
+		t.Errorf("Wrong error code expected %d actual %d",
+			sgerrors.RequestTooLarge, msg.ErrorCode)
+	}
+}
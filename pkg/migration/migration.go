@@ -0,0 +1,157 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/storage"
+)
+
+// VersionField is a json field that holds a schema version of the stored record,
+// records written before versioning was introduced have version 0.
+const VersionField = "schemaVersion"
+
+// Record is a stored entity decoded into generic json values.
+type Record map[string]interface{}
+
+// Migration upgrades a record from the From version to the next one.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(r Record) error
+}
+
+// Migrator brings records of a single entity type to the latest schema version.
+type Migrator struct {
+	keyField   string
+	migrations []Migration
+}
+
+// New constructs a Migrator, keyField is a json field the record is stored by.
+// Migrations must go in order starting from version 0.
+func New(keyField string, migrations ...Migration) *Migrator {
+	for i, m := range migrations {
+		if m.From != i {
+			panic(fmt.Sprintf("migration %q must upgrade version %d", m.Description, i))
+		}
+	}
+
+	return &Migrator{
+		keyField:   keyField,
+		migrations: migrations,
+	}
+}
+
+// Version returns the latest schema version.
+func (m *Migrator) Version() int {
+	return len(m.migrations)
+}
+
+// Upgrade applies missing migrations to the raw record, the record is returned
+// as is if it is already of the latest version.
+func (m *Migrator) Upgrade(raw []byte) ([]byte, bool, error) {
+	r := Record{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, false, errors.Wrap(err, "unmarshal")
+	}
+
+	version, err := r.version()
+	if err != nil {
+		return nil, false, err
+	}
+	if version == m.Version() {
+		return raw, false, nil
+	}
+	if version > m.Version() {
+		return nil, false, errors.Errorf("schema version %d is newer than supported %d", version, m.Version())
+	}
+
+	for _, migration := range m.migrations[version:] {
+		if migration.Apply != nil {
+			if err = migration.Apply(r); err != nil {
+				return nil, false, errors.Wrapf(err, "migrate from version %d: %s",
+					migration.From, migration.Description)
+			}
+		}
+		r[VersionField] = migration.From + 1
+	}
+
+	upgraded, err := json.Marshal(r)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "marshal")
+	}
+
+	return upgraded, true, nil
+}
+
+// Run upgrades all records stored under the prefix and returns the number
+// of records that have been changed.
+func (m *Migrator) Run(ctx context.Context, repository storage.Interface, prefix string) (int, error) {
+	rawRecords, err := repository.GetAll(ctx, prefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "storage: get all")
+	}
+
+	migrated := 0
+	for _, raw := range rawRecords {
+		if len(raw) == 0 {
+			continue
+		}
+
+		upgraded, changed, err := m.Upgrade(raw)
+		if err != nil {
+			return migrated, err
+		}
+		if !changed {
+			continue
+		}
+
+		key, err := m.key(upgraded)
+		if err != nil {
+			return migrated, err
+		}
+		if err = repository.Put(ctx, prefix, key, upgraded); err != nil {
+			return migrated, errors.Wrapf(err, "storage: put %s", key)
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		logrus.Infof("migrated %d record(s) under %s to schema version %d", migrated, prefix, m.Version())
+	}
+
+	return migrated, nil
+}
+
+func (m *Migrator) key(raw []byte) (string, error) {
+	r := Record{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return "", errors.Wrap(err, "unmarshal")
+	}
+
+	key, ok := r[m.keyField].(string)
+	if !ok || key == "" {
+		return "", errors.Errorf("record has no %s field", m.keyField)
+	}
+
+	return key, nil
+}
+
+func (r Record) version() (int, error) {
+	v, ok := r[VersionField]
+	if !ok || v == nil {
+		return 0, nil
+	}
+
+	// json numbers are decoded as float64
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return 0, errors.Errorf("invalid schema version %v", v)
+	}
+
+	return int(f), nil
+}
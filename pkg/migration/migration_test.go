@@ -0,0 +1,149 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type mapStorage map[string][]byte
+
+func (s mapStorage) Put(ctx context.Context, prefix string, key string, value []byte) error {
+	s[prefix+key] = value
+	return nil
+}
+
+func (s mapStorage) Get(ctx context.Context, prefix string, key string) ([]byte, error) {
+	return s[prefix+key], nil
+}
+
+func (s mapStorage) GetAll(ctx context.Context, prefix string) ([][]byte, error) {
+	out := make([][]byte, 0, len(s))
+	for _, v := range s {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (s mapStorage) Delete(ctx context.Context, prefix string, key string) error {
+	delete(s, prefix+key)
+	return nil
+}
+
+func testMigrator() *Migrator {
+	return New("id",
+		Migration{
+			From: 0,
+			Apply: func(r Record) error {
+				r["name"] = r["title"]
+				delete(r, "title")
+				return nil
+			},
+		},
+		Migration{
+			From: 1,
+			Apply: func(r Record) error {
+				if r["name"] == "broken" {
+					return errors.New("broken")
+				}
+				r["replicas"] = 1
+				return nil
+			},
+		},
+	)
+}
+
+func TestNew(t *testing.T) {
+	require.Equal(t, 2, testMigrator().Version())
+	require.Panics(t, func() {
+		New("id", Migration{From: 1})
+	})
+}
+
+func TestMigrator_Upgrade(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		raw             string
+		expectedErr     bool
+		expectedChanged bool
+		expected        map[string]interface{}
+	}{
+		{
+			name:        "invalid json",
+			raw:         "{",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid version",
+			raw:         `{"schemaVersion":"1"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "newer version",
+			raw:         `{"schemaVersion":3}`,
+			expectedErr: true,
+		},
+		{
+			name:        "migration error",
+			raw:         `{"title":"broken"}`,
+			expectedErr: true,
+		},
+		{
+			name:            "unversioned record",
+			raw:             `{"id":"1","title":"kube"}`,
+			expectedChanged: true,
+			expected: map[string]interface{}{
+				"id": "1", "name": "kube", "replicas": 1.0, VersionField: 2.0,
+			},
+		},
+		{
+			name:            "partially migrated",
+			raw:             `{"id":"1","name":"kube","schemaVersion":1}`,
+			expectedChanged: true,
+			expected: map[string]interface{}{
+				"id": "1", "name": "kube", "replicas": 1.0, VersionField: 2.0,
+			},
+		},
+		{
+			name: "latest version",
+			raw:  `{"id":"1","name":"kube","replicas":3,"schemaVersion":2}`,
+			expected: map[string]interface{}{
+				"id": "1", "name": "kube", "replicas": 3.0, VersionField: 2.0,
+			},
+		},
+	} {
+		raw, changed, err := testMigrator().Upgrade([]byte(tc.raw))
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		if err != nil {
+			continue
+		}
+		require.Equal(t, tc.expectedChanged, changed, "TC: %s", tc.name)
+
+		actual := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(raw, &actual), "TC: %s", tc.name)
+		require.Equal(t, tc.expected, actual, "TC: %s", tc.name)
+	}
+}
+
+func TestMigrator_Run(t *testing.T) {
+	repo := mapStorage{
+		"/kubes/1": []byte(`{"id":"1","title":"old"}`),
+		"/kubes/2": []byte(`{"id":"2","name":"new","replicas":3,"schemaVersion":2}`),
+	}
+
+	migrated, err := testMigrator().Run(context.Background(), repo, "/kubes/")
+	require.NoError(t, err)
+	require.Equal(t, 1, migrated)
+	require.JSONEq(t, `{"id":"1","name":"old","replicas":1,"schemaVersion":2}`, string(repo["/kubes/1"]))
+
+	migrated, err = testMigrator().Run(context.Background(), repo, "/kubes/")
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+
+	repo["/kubes/3"] = []byte(`{"title":"no id"}`)
+	_, err = testMigrator().Run(context.Background(), repo, "/kubes/")
+	require.Error(t, err)
+}
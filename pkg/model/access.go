@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// AccessGrant is a service account of an external user, it is bound to
+// the cluster role in the namespaces only.
+type AccessGrant struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Namespaces  []string  `json:"namespaces"`
+	ClusterRole string    `json:"clusterRole"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
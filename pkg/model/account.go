@@ -10,4 +10,9 @@ type CloudAccount struct {
 	Name        string            `json:"name" valid:"required, length(1|32)"`
 	Provider    clouds.Name       `json:"provider" valid:"in(aws|digitalocean|gce|azure)"`
 	Credentials map[string]string `json:"credentials" valid:"optional"`
+	// ProvisioningLimit is how many clusters may be provisioned
+	// with the account at once, zero means no limit.
+	ProvisioningLimit int `json:"provisioningLimit,omitempty" valid:"-"`
+	// SchemaVersion is a version of the stored record, see account.Migrator.
+	SchemaVersion int `json:"schemaVersion" valid:"-"`
 }
@@ -0,0 +1,13 @@
+package model
+
+// FirewallRule allows inbound traffic from the cidrs to machines of the cluster.
+type FirewallRule struct {
+	// Role limits the rule to masters or nodes, empty role applies it to both
+	Role Role `json:"role,omitempty"`
+	// Protocol is tcp or udp
+	Protocol    string   `json:"protocol"`
+	FromPort    int64    `json:"fromPort"`
+	ToPort      int64    `json:"toPort"`
+	CIDRs       []string `json:"cidrs"`
+	Description string   `json:"description"`
+}
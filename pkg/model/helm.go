@@ -48,4 +48,5 @@ type ReleaseInfo struct {
 	Chart        string `json:"chart"`
 	ChartVersion string `json:"chartVersion"`
 	Status       string `json:"status"`
+	Description  string `json:"description,omitempty"`
 }
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/profile"
 )
@@ -17,6 +19,12 @@ const (
 
 // Kube represents a kubernetes cluster.
 type Kube struct {
+	// SchemaVersion is a version of the stored record, see kube.Migrator.
+	SchemaVersion int `json:"schemaVersion" valid:"-"`
+
+	// TenantID is a tenant the kube belongs to, it is set on creation.
+	TenantID string `json:"tenantId" valid:"-"`
+
 	ID           string      `json:"id" valid:"-"`
 	State        KubeState   `json:"state"`
 	Name         string      `json:"name" valid:"required"`
@@ -43,8 +51,63 @@ type Kube struct {
 	Subnets                map[string]string `json:"subnets"`
 
 	CloudSpec profile.CloudSpecificSettings `json:"cloudSpec" valid:"-"`
+	// CloudResources are ids of cloud resources of the cluster, they follow
+	// the cloud spec and machines every time the kube is stored.
+	CloudResources CloudResources `json:"cloudResources" valid:"-"`
 
 	ProfileID string `json:"profileId"`
+	// ReleaseChannel picks kubernetes and addon versions proposed to the
+	// cluster, see versions.ChannelStable, it's stable when empty.
+	ReleaseChannel string `json:"releaseChannel,omitempty" valid:"in(stable|regular|rapid)"`
+
+	// DisplayName is shown to users instead of the name, the name doesn't
+	// change after creation since cloud resources are named and tagged with it.
+	DisplayName string       `json:"displayName,omitempty"`
+	Metadata    KubeMetadata `json:"metadata"`
+
+	// APIHost is a dns name of the api endpoint, kubeconfigs use it
+	// instead of addresses of masters when it's set.
+	APIHost string              `json:"apiHost"`
+	DNS     profile.DNSSettings `json:"dns"`
+
+	Egress profile.EgressSettings `json:"egress"`
+	// EgressIPs are addresses traffic to egress destinations leaves the cloud from.
+	EgressIPs []string `json:"egressIps"`
+
+	// FirewallRules are applied to security groups of the cluster on top of
+	// rules that provisioning requires.
+	FirewallRules []FirewallRule `json:"firewallRules"`
+	// APIServerAllowedCIDRs are clients firewalls of the cloud let to the api server.
+	APIServerAllowedCIDRs []string `json:"apiServerAllowedCidrs"`
+	// Dashboard is a dashboard installed to the cluster.
+	Dashboard profile.DashboardSettings `json:"dashboard"`
+	// VolumeSnapshots is set when the csi snapshot crds are installed.
+	VolumeSnapshots bool `json:"volumeSnapshots"`
+	// Cost are cost center tags and a budget of the cluster.
+	Cost profile.CostSettings `json:"cost"`
+	// Hardening are security settings new machines of the cluster are created with.
+	Hardening profile.HardeningSettings `json:"hardening"`
+	// SpreadMasters is set when masters are created in a spread placement
+	// group of the cloud, names of the groups are kept in the cloud spec.
+	SpreadMasters bool `json:"spreadMasters"`
+	// AccessGrants are namespace scoped service accounts created for external users.
+	AccessGrants []AccessGrant `json:"accessGrants"`
+
+	// Maintenance pauses background jobs of the cluster while operators
+	// work on it manually.
+	Maintenance Maintenance `json:"maintenance"`
+	// AutoUpgrade applies patch releases of the release channel to the
+	// cluster without operators, it's opt-in.
+	AutoUpgrade AutoUpgrade `json:"autoUpgrade"`
+
+	// ExternallyManaged is set for clusters installed on machines that were
+	// created outside of supergiant, their infrastructure is never deleted.
+	ExternallyManaged bool `json:"externallyManaged"`
+	// DeletionProtection blocks deletion of the cluster until it is cleared.
+	DeletionProtection bool `json:"deletionProtection"`
+	// ProtectionClearedBy is a user who has cleared deletion protection,
+	// the cluster must be deleted by another one.
+	ProtectionClearedBy string `json:"protectionClearedBy,omitempty"`
 
 	Masters map[string]*Machine `json:"masters"`
 	Nodes   map[string]*Machine `json:"nodes"`
@@ -62,6 +125,86 @@ type Kube struct {
 	BootstrapPrivateKey []byte `json:"bootstrapPrivateKey"`
 }
 
+// Maintenance mode of a cluster, background jobs skip the cluster and
+// only admins may change it.
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	// By is a user who has enabled maintenance.
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since,omitempty"`
+}
+
+// AutoUpgrade settings of a cluster, upgrades start within the window
+// and are paused after a failed one until users resume them.
+type AutoUpgrade struct {
+	Enabled bool              `json:"enabled"`
+	Window  MaintenanceWindow `json:"window"`
+
+	Paused      bool   `json:"paused"`
+	PauseReason string `json:"pauseReason,omitempty"`
+	// LastVersion is a version of the last upgrade, failed or not.
+	LastVersion string    `json:"lastVersion,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+}
+
+// MaintenanceWindow is a weekly time range in UTC.
+type MaintenanceWindow struct {
+	// Days of the week, every day when empty.
+	Days      []time.Weekday `json:"days"`
+	StartHour int            `json:"startHour"`
+	Hours     int            `json:"hours"`
+}
+
+// Contains tells whether the time is within the window, the window may
+// end on the next day.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), w.StartHour, 0, 0, 0, time.UTC)
+	// the window could have started the day before
+	for _, s := range []time.Time{start, start.AddDate(0, 0, -1)} {
+		if t.Before(s) || !t.Before(s.Add(time.Duration(w.Hours)*time.Hour)) {
+			continue
+		}
+		if len(w.Days) == 0 {
+			return true
+		}
+		for _, d := range w.Days {
+			if d == s.Weekday() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InMaintenance reports whether background jobs must leave the kube alone.
+func (k *Kube) InMaintenance() bool {
+	return k != nil && k.Maintenance.Enabled
+}
+
+// KubeMetadata describes a cluster to its users, provisioning doesn't use it.
+type KubeMetadata struct {
+	Description string `json:"description,omitempty"`
+	// Owner is a team or a person responsible for the cluster.
+	Owner string     `json:"owner,omitempty"`
+	Links []KubeLink `json:"links,omitempty"`
+}
+
+// KubeLink is a link to a dashboard, a runbook or a repository of the cluster.
+type KubeLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Title returns the name of the kube users see.
+func (k *Kube) Title() string {
+	if k.DisplayName != "" {
+		return k.DisplayName
+	}
+	return k.Name
+}
+
 type SSHConfig struct {
 	User                string `json:"user"`
 	Port                string `json:"port"`
@@ -69,6 +212,17 @@ type SSHConfig struct {
 	BootstrapPublicKey  string `json:"bootstrapPublicKey"`
 	PublicKey           string `json:"publicKey"`
 	Timeout             int    `json:"timeout"`
+	// Bastion is a host[:port] that node consoles are opened through,
+	// it accepts the user and the key of nodes.
+	Bastion string `json:"bastion,omitempty"`
+	// Passphrase decrypts BootstrapPrivateKey of imported machines, it's
+	// supplied with the request and never stored. Encrypted keys are only
+	// accepted along with AgentSocket, tasks started after the import are
+	// authenticated by the agent which must hold the decrypted key.
+	Passphrase string `json:"-"`
+	// AgentSocket is a path to the ssh-agent of the control plane, keys
+	// held by it are used for machines imported without a private key.
+	AgentSocket string `json:"agentSocket,omitempty"`
 }
 
 // Auth holds all possible auth parameters.
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow_Contains(t *testing.T) {
+	// saturday
+	day := time.Date(2019, time.October, 5, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		description string
+		window      MaintenanceWindow
+		time        time.Time
+		expected    bool
+	}{
+		{
+			description: "every day",
+			window:      MaintenanceWindow{StartHour: 2, Hours: 4},
+			time:        day.Add(3 * time.Hour),
+			expected:    true,
+		},
+		{
+			description: "before the start",
+			window:      MaintenanceWindow{StartHour: 2, Hours: 4},
+			time:        day.Add(time.Hour),
+		},
+		{
+			description: "after the end",
+			window:      MaintenanceWindow{StartHour: 2, Hours: 4},
+			time:        day.Add(6 * time.Hour),
+		},
+		{
+			description: "day of the week",
+			window:      MaintenanceWindow{Days: []time.Weekday{time.Saturday}, StartHour: 2, Hours: 4},
+			time:        day.Add(3 * time.Hour),
+			expected:    true,
+		},
+		{
+			description: "another day",
+			window:      MaintenanceWindow{Days: []time.Weekday{time.Sunday}, StartHour: 2, Hours: 4},
+			time:        day.Add(3 * time.Hour),
+		},
+		{
+			description: "window of the day before",
+			window:      MaintenanceWindow{Days: []time.Weekday{time.Friday}, StartHour: 22, Hours: 4},
+			time:        day.Add(time.Hour),
+			expected:    true,
+		},
+		{
+			description: "another time zone",
+			window:      MaintenanceWindow{StartHour: 2, Hours: 1},
+			time:        day.Add(2 * time.Hour).In(time.FixedZone("EST", -5*60*60)),
+			expected:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		if actual := tc.window.Contains(tc.time); actual != tc.expected {
+			t.Errorf("%s: expected %v actual %v", tc.description, tc.expected, actual)
+		}
+	}
+}
@@ -35,6 +35,8 @@ type Machine struct {
 	PrivateIp        string       `json:"privateIp"`
 	State            MachineState `json:"state"`
 	Name             string       `json:"name"`
+	// ExternallyManaged machines are not deleted from the cloud
+	ExternallyManaged bool `json:"externallyManaged"`
 }
 
 func (m Machine) String() string {
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+// CloudResources are identifiers of cloud resources provisioning has created
+// for a cluster, empty fields are resources the cluster doesn't have.
+type CloudResources struct {
+	VPCID             string   `json:"vpcId,omitempty"`
+	SubnetIDs         []string `json:"subnetIds,omitempty"`
+	SecurityGroupIDs  []string `json:"securityGroupIds,omitempty"`
+	RouteTableIDs     []string `json:"routeTableIds,omitempty"`
+	InternetGatewayID string   `json:"internetGatewayId,omitempty"`
+	NATGatewayID      string   `json:"natGatewayId,omitempty"`
+	// EgressAllocationID is an elastic ip of the nat gateway.
+	EgressAllocationID string   `json:"egressAllocationId,omitempty"`
+	KeyPairName        string   `json:"keyPairName,omitempty"`
+	InstanceProfiles   []string `json:"instanceProfiles,omitempty"`
+	StackName          string   `json:"stackName,omitempty"`
+	// PlacementGroup is a placement group, a resource policy or an
+	// availability set masters are spread by.
+	PlacementGroup string `json:"placementGroup,omitempty"`
+
+	ResourceGroup  string `json:"resourceGroup,omitempty"`
+	VirtualNetwork string `json:"virtualNetwork,omitempty"`
+
+	// Instances maps names of machines to ids of their cloud instances.
+	Instances map[string]string `json:"instances,omitempty"`
+}
+
+// UpdateCloudResources builds cloud resources of the kube from its cloud
+// spec, subnets and machines.
+func (k *Kube) UpdateCloudResources() {
+	spec := k.CloudSpec
+	r := CloudResources{}
+
+	switch k.Provider {
+	case clouds.AWS:
+		r.VPCID = spec[clouds.AwsVpcID]
+		r.SubnetIDs = sortedValues(k.Subnets, spec[clouds.AwsNATSubnetID])
+		r.SecurityGroupIDs = nonEmpty(spec[clouds.AwsMastersSecGroupID], spec[clouds.AwsNodesSecgroupID])
+		r.RouteTableIDs = nonEmpty(spec[clouds.AwsRouteTableID], spec[clouds.AwsNATRouteTableID])
+		r.InternetGatewayID = spec[clouds.AwsInternetGateWayID]
+		r.NATGatewayID = spec[clouds.AwsNATGatewayID]
+		r.EgressAllocationID = spec[clouds.AwsEgressAllocationID]
+		r.KeyPairName = spec[clouds.AwsKeyPairName]
+		r.InstanceProfiles = nonEmpty(spec[clouds.AwsMasterInstanceProfile], spec[clouds.AwsNodeInstanceProfile])
+		r.StackName = spec[clouds.AwsStackName]
+		r.PlacementGroup = spec[clouds.AwsMastersPlacementGroup]
+	case clouds.GCE:
+		r.PlacementGroup = spec[clouds.GCEMastersPlacementPolicy]
+	case clouds.Azure:
+		r.ResourceGroup = spec[clouds.AzureResourceGroup]
+		r.VirtualNetwork = spec[clouds.AzureVNetName]
+		r.SecurityGroupIDs = nonEmpty(spec[clouds.AzureSecurityGroup])
+		r.PlacementGroup = spec[clouds.AzureMastersAvailabilitySet]
+	}
+
+	for _, machines := range []map[string]*Machine{k.Masters, k.Nodes} {
+		for name, m := range machines {
+			if m == nil || m.ID == "" {
+				continue
+			}
+			if r.Instances == nil {
+				r.Instances = make(map[string]string)
+			}
+			r.Instances[name] = m.ID
+		}
+	}
+
+	k.CloudResources = r
+}
+
+func sortedValues(m map[string]string, extra ...string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	values = append(values, extra...)
+	sort.Strings(values)
+
+	return nonEmpty(values...)
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
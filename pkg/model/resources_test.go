@@ -0,0 +1,91 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/profile"
+)
+
+func TestKube_UpdateCloudResources(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		kube     Kube
+		expected CloudResources
+	}{
+		{
+			name: "digitalocean",
+			kube: Kube{
+				Provider: clouds.DigitalOcean,
+				Masters: map[string]*Machine{
+					"master-1": {ID: "100"},
+				},
+			},
+			expected: CloudResources{
+				Instances: map[string]string{"master-1": "100"},
+			},
+		},
+		{
+			name: "aws",
+			kube: Kube{
+				Provider: clouds.AWS,
+				CloudSpec: profile.CloudSpecificSettings{
+					clouds.AwsVpcID:                 "vpc-1",
+					clouds.AwsMastersSecGroupID:     "sg-1",
+					clouds.AwsNodesSecgroupID:       "sg-2",
+					clouds.AwsRouteTableID:          "rtb-1",
+					clouds.AwsInternetGateWayID:     "igw-1",
+					clouds.AwsKeyPairName:           "key",
+					clouds.AwsMasterInstanceProfile: "master",
+					clouds.AwsNodeInstanceProfile:   "node",
+					clouds.AwsMastersPlacementGroup: "sg-1234-masters",
+				},
+				Subnets: map[string]string{
+					"us-east-1b": "subnet-2",
+					"us-east-1a": "subnet-1",
+				},
+				Masters: map[string]*Machine{
+					"master-1": {ID: "i-1"},
+				},
+				Nodes: map[string]*Machine{
+					"node-1":  {ID: "i-2"},
+					"planned": {},
+					"nil":     nil,
+				},
+			},
+			expected: CloudResources{
+				VPCID:             "vpc-1",
+				SubnetIDs:         []string{"subnet-1", "subnet-2"},
+				SecurityGroupIDs:  []string{"sg-1", "sg-2"},
+				RouteTableIDs:     []string{"rtb-1"},
+				InternetGatewayID: "igw-1",
+				KeyPairName:       "key",
+				InstanceProfiles:  []string{"master", "node"},
+				PlacementGroup:    "sg-1234-masters",
+				Instances: map[string]string{
+					"master-1": "i-1",
+					"node-1":   "i-2",
+				},
+			},
+		},
+		{
+			name: "azure",
+			kube: Kube{
+				Provider: clouds.Azure,
+				CloudSpec: profile.CloudSpecificSettings{
+					clouds.AzureResourceGroup: "sg-kube-1234",
+					clouds.AzureVNetName:      "vnet",
+				},
+			},
+			expected: CloudResources{
+				ResourceGroup:  "sg-kube-1234",
+				VirtualNetwork: "vnet",
+			},
+		},
+	} {
+		tc.kube.UpdateCloudResources()
+		require.Equal(t, tc.expected, tc.kube.CloudResources, "TC: %s", tc.name)
+	}
+}
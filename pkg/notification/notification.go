@@ -0,0 +1,145 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventReleaseFailed    = "release.failed"
+	EventReleasePending   = "release.pending"
+	EventReleaseRecovered = "release.recovered"
+	EventUpgradeCompleted = "upgrade.completed"
+	EventUpgradeFailed    = "upgrade.failed"
+
+	webhookTimeout = time.Second * 10
+)
+
+// Event describes something operators should learn about without watching the UI.
+type Event struct {
+	Type      string            `json:"type"`
+	KubeID    string            `json:"kubeId"`
+	KubeName  string            `json:"kubeName,omitempty"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Publisher delivers events.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// LogPublisher writes events to the application log.
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(ctx context.Context, e Event) error {
+	logrus.WithFields(logrus.Fields{
+		"event":   e.Type,
+		"cluster": e.KubeID,
+	}).Warn(e.Message)
+	return nil
+}
+
+// WebhookPublisher posts events as json to the url.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher constructs a WebhookPublisher.
+func NewWebhookPublisher(url string) *WebhookPublisher {
+	return &WebhookPublisher{
+		url: url,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "marshal event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "build request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "send event")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Multi publishes events to all publishers, a failed one doesn't stop the rest.
+type Multi []Publisher
+
+func (m Multi) Publish(ctx context.Context, e Event) error {
+	var lastErr error
+	for _, p := range m {
+		if err := p.Publish(ctx, e); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// Webhook publishes events to a webhook whose url can be changed at runtime,
+// events are dropped while the url is empty.
+type Webhook struct {
+	m         sync.RWMutex
+	url       string
+	publisher *WebhookPublisher
+}
+
+// NewWebhook constructs a Webhook.
+func NewWebhook(url string) *Webhook {
+	w := &Webhook{}
+	w.SetURL(url)
+	return w
+}
+
+// SetURL changes the url events are posted to.
+func (w *Webhook) SetURL(url string) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if url == w.url {
+		return
+	}
+	w.url = url
+	w.publisher = nil
+	if url != "" {
+		w.publisher = NewWebhookPublisher(url)
+	}
+}
+
+func (w *Webhook) Publish(ctx context.Context, e Event) error {
+	w.m.RLock()
+	p := w.publisher
+	w.m.RUnlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Publish(ctx, e)
+}
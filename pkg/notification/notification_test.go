@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePublisher struct {
+	events []Event
+	err    error
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, e Event) error {
+	f.events = append(f.events, e)
+	return f.err
+}
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		status      int
+		expectedErr bool
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+		},
+		{
+			name:        "server error",
+			status:      http.StatusInternalServerError,
+			expectedErr: true,
+		},
+	} {
+		var received Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(tc.status)
+		}))
+
+		err := NewWebhookPublisher(srv.URL).Publish(context.Background(), Event{
+			Type:   EventReleaseFailed,
+			KubeID: "kube",
+		})
+		srv.Close()
+
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s", tc.name)
+		require.Equal(t, EventReleaseFailed, received.Type, "TC: %s", tc.name)
+		require.Equal(t, "kube", received.KubeID, "TC: %s", tc.name)
+	}
+}
+
+func TestMulti_Publish(t *testing.T) {
+	errFake := errors.New("fake")
+	failed := &fakePublisher{err: errFake}
+	ok := &fakePublisher{}
+
+	err := Multi{failed, ok, LogPublisher{}}.Publish(context.Background(), Event{Type: EventReleasePending})
+
+	require.Equal(t, errFake, err)
+	require.Len(t, failed.events, 1)
+	require.Len(t, ok.events, 1, "failed publisher must not stop the rest")
+}
+
+func TestWebhook_SetURL(t *testing.T) {
+	received := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer srv.Close()
+
+	w := NewWebhook("")
+	require.NoError(t, w.Publish(context.Background(), Event{Type: EventReleaseFailed}))
+	require.Equal(t, 0, received)
+
+	w.SetURL(srv.URL)
+	require.NoError(t, w.Publish(context.Background(), Event{Type: EventReleaseFailed}))
+	require.Equal(t, 1, received)
+
+	w.SetURL("")
+	require.NoError(t, w.Publish(context.Background(), Event{Type: EventReleaseFailed}))
+	require.Equal(t, 1, received)
+}
@@ -0,0 +1,64 @@
+package onboarding
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+// Handler serves policies of cloud accounts to the onboarding wizard.
+type Handler struct{}
+
+// NewHandler constructs a Handler.
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// Register adds onboarding handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/onboarding/{provider}/policy", h.getPolicy).Methods(http.MethodGet)
+}
+
+// getPolicy generates a policy of the provider:
+// GET /onboarding/aws/policy?features=dns,peering
+// GET /onboarding/gce/policy?features=dns&project=my-project
+// GET /onboarding/azure/policy?subscription=<id>
+func (h *Handler) getPolicy(w http.ResponseWriter, r *http.Request) {
+	name := clouds.Name(mux.Vars(r)["provider"])
+	query := r.URL.Query()
+
+	var features []string
+	if raw := query.Get("features"); raw != "" {
+		features = strings.Split(raw, ",")
+	}
+
+	p, err := Generate(name, features, Params{
+		SubscriptionID: query.Get("subscription"),
+		ProjectID:      query.Get("project"),
+	})
+	switch {
+	case err == nil:
+	case errors.Cause(err) == ErrUnknownFeature:
+		message.SendValidationFailed(w, err)
+		return
+	case errors.Cause(err) == sgerrors.ErrUnsupportedProvider:
+		message.SendMessage(w, message.New("Not supported by the provider", err.Error(),
+			sgerrors.UnsupportedProvider, ""), http.StatusBadRequest)
+		return
+	default:
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		logrus.Errorf("onboarding: %s policy: write response: %v", name, err)
+	}
+}
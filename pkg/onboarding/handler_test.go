@@ -0,0 +1,55 @@
+package onboarding
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestHandler_getPolicy(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler().Register(router)
+
+	for _, tc := range []struct {
+		url          string
+		expectedCode int
+	}{
+		{
+			url:          "/onboarding/aws/policy?features=dns,peering",
+			expectedCode: http.StatusOK,
+		},
+		{
+			url:          "/onboarding/gce/policy?project=test",
+			expectedCode: http.StatusOK,
+		},
+		{
+			url:          "/onboarding/aws/policy?features=spot",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			url:          "/onboarding/digitalocean/policy?features=firewall",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			url:          "/onboarding/vsphere/policy",
+			expectedCode: http.StatusBadRequest,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.url, rec.Body.String())
+		if tc.expectedCode != http.StatusOK {
+			continue
+		}
+
+		p := &Policy{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(p), "TC: %s", tc.url)
+		require.NotEqual(t, clouds.Name(""), p.Provider, "TC: %s", tc.url)
+	}
+}
@@ -0,0 +1,431 @@
+package onboarding
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps/provider"
+)
+
+// Features are optional capabilities that need permissions
+// beyond provisioning and deletion of clusters.
+const (
+	FeatureDNS               = "dns"
+	FeatureFirewall          = "firewall"
+	FeatureDisks             = "disks"
+	FeaturePeering           = "peering"
+	FeatureEgress            = "egress"
+	FeatureRestrictAPIServer = "restrictApiServer"
+	FeatureStack             = "stack"
+	FeatureHardening         = "hardening"
+	FeatureSpreadMasters     = "spreadMasters"
+)
+
+// Formats of generated policies.
+const (
+	FormatAWSPolicy       = "aws-iam-policy"
+	FormatAzureRole       = "azure-role-definition"
+	FormatGCloud          = "gcloud"
+	FormatDigitalOceanAPI = "digitalocean-token"
+)
+
+var ErrUnknownFeature = errors.New("unknown feature")
+
+// Policy is a least-privilege definition of credentials of a cloud account,
+// Document is applied as is and Commands are run in the given order.
+type Policy struct {
+	Provider clouds.Name `json:"provider"`
+	Features []string    `json:"features"`
+	Format   string      `json:"format"`
+	Document interface{} `json:"document,omitempty"`
+	Commands []string    `json:"commands,omitempty"`
+}
+
+// Params are placeholders of generated definitions.
+type Params struct {
+	// SubscriptionID is an azure subscription the role is assignable in.
+	SubscriptionID string
+	// ProjectID is a gce project the role and the service account belong to.
+	ProjectID string
+}
+
+// Generate returns a policy that grants what control needs to run the features
+// on the provider, features the provider doesn't have are refused.
+func Generate(name clouds.Name, features []string, params Params) (*Policy, error) {
+	features, err := normalize(name, features)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{
+		Provider: name,
+		Features: features,
+	}
+	switch name {
+	case clouds.AWS:
+		p.Format = FormatAWSPolicy
+		p.Document = awsPolicy(features)
+	case clouds.Azure:
+		p.Format = FormatAzureRole
+		p.Document = azureRole(features, params.SubscriptionID)
+	case clouds.GCE:
+		p.Format = FormatGCloud
+		p.Commands = gcloudCommands(features, params.ProjectID)
+	case clouds.DigitalOcean:
+		// digitalocean tokens aren't scoped beyond read and write
+		p.Format = FormatDigitalOceanAPI
+		p.Document = map[string][]string{"scopes": {"read", "write"}}
+	default:
+		return nil, errors.Wrapf(sgerrors.ErrUnsupportedProvider, "policy: %s", name)
+	}
+
+	return p, nil
+}
+
+// normalize refuses unknown features and features the provider doesn't
+// have, duplicates are dropped and features are sorted.
+func normalize(name clouds.Name, features []string) ([]string, error) {
+	c := provider.CapabilitiesFor(name)
+	if !c.Provisioning {
+		return nil, errors.Wrapf(sgerrors.ErrUnsupportedProvider, "policy: %s", name)
+	}
+
+	supported := map[string]bool{
+		FeatureDNS:               c.DNS,
+		FeatureFirewall:          c.Firewall,
+		FeatureDisks:             c.Disks,
+		FeaturePeering:           c.Peering,
+		FeatureEgress:            c.Egress,
+		FeatureRestrictAPIServer: c.RestrictAPIServer,
+		FeatureStack:             c.Stacks,
+		FeatureHardening:         c.Hardening,
+		FeatureSpreadMasters:     c.SpreadMasters,
+	}
+
+	set := make(map[string]bool, len(features))
+	for _, f := range features {
+		ok, known := supported[f]
+		if !known {
+			return nil, errors.Wrap(ErrUnknownFeature, f)
+		}
+		if !ok {
+			return nil, errors.Wrapf(sgerrors.ErrUnsupportedProvider, "%s: %s", f, name)
+		}
+		set[f] = true
+	}
+
+	out := make([]string, 0, len(set))
+	for f := range set {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func has(features []string, f string) bool {
+	for _, feature := range features {
+		if feature == f {
+			return true
+		}
+	}
+	return false
+}
+
+// AWSPolicyDocument is an iam policy, it is attached to the user
+// the access key of the cloud account belongs to.
+type AWSPolicyDocument struct {
+	Version   string               `json:"Version"`
+	Statement []AWSPolicyStatement `json:"Statement"`
+}
+
+type AWSPolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource string   `json:"Resource"`
+}
+
+func awsPolicy(features []string) *AWSPolicyDocument {
+	statement := func(sid string, actions ...string) AWSPolicyStatement {
+		return AWSPolicyStatement{Sid: sid, Effect: "Allow", Action: actions, Resource: "*"}
+	}
+
+	doc := &AWSPolicyDocument{
+		Version: "2012-10-17",
+		Statement: []AWSPolicyStatement{
+			statement("Discovery",
+				"ec2:DescribeAccountAttributes",
+				"ec2:DescribeAvailabilityZones",
+				"ec2:DescribeImages",
+				"ec2:DescribeInstances",
+				"ec2:DescribeNatGateways",
+				"ec2:DescribeRegions",
+				"ec2:DescribeReservedInstancesOfferings",
+				"ec2:DescribeSubnets",
+				"ec2:DescribeVpcs",
+				"pricing:GetAttributeValues",
+				"pricing:GetProducts",
+				"sts:GetCallerIdentity",
+			),
+			statement("Network",
+				"ec2:AssociateRouteTable",
+				"ec2:AttachInternetGateway",
+				"ec2:AuthorizeSecurityGroupIngress",
+				"ec2:CreateInternetGateway",
+				"ec2:CreateRoute",
+				"ec2:CreateRouteTable",
+				"ec2:CreateSecurityGroup",
+				"ec2:CreateSubnet",
+				"ec2:CreateTags",
+				"ec2:CreateVpc",
+				"ec2:DeleteInternetGateway",
+				"ec2:DeleteRoute",
+				"ec2:DeleteRouteTable",
+				"ec2:DeleteSecurityGroup",
+				"ec2:DeleteSubnet",
+				"ec2:DeleteVpc",
+				"ec2:DetachInternetGateway",
+				"ec2:DisassociateRouteTable",
+			),
+			statement("Machines",
+				"ec2:DeleteKeyPair",
+				"ec2:DescribeKeyPairs",
+				"ec2:ImportKeyPair",
+				"ec2:RunInstances",
+				"ec2:TerminateInstances",
+			),
+			// machines are started with instance profiles of the kubernetes cloud provider
+			statement("InstanceProfiles",
+				"iam:AddRoleToInstanceProfile",
+				"iam:CreateInstanceProfile",
+				"iam:CreateRole",
+				"iam:GetInstanceProfile",
+				"iam:GetRole",
+				"iam:GetRolePolicy",
+				"iam:PassRole",
+				"iam:PutRolePolicy",
+			),
+		},
+	}
+
+	if has(features, FeatureDNS) {
+		doc.Statement = append(doc.Statement, statement("DNS",
+			"route53:ChangeResourceRecordSets",
+			"route53:ListResourceRecordSets",
+		))
+	}
+	if has(features, FeatureFirewall) || has(features, FeatureRestrictAPIServer) {
+		doc.Statement = append(doc.Statement, statement("Firewall",
+			"ec2:AuthorizeSecurityGroupIngress",
+			"ec2:DescribeSecurityGroups",
+			"ec2:RevokeSecurityGroupIngress",
+		))
+	}
+	if has(features, FeatureStack) {
+		// resources of the stack are created with permissions of the account
+		doc.Statement = append(doc.Statement, statement("Stack",
+			"cloudformation:CreateStack",
+			"cloudformation:DeleteStack",
+			"cloudformation:DescribeStacks",
+		))
+	}
+	if has(features, FeatureDisks) {
+		doc.Statement = append(doc.Statement, statement("Disks",
+			"ec2:DeleteVolume",
+			"ec2:DescribeVolumes",
+		))
+	}
+	if has(features, FeaturePeering) {
+		doc.Statement = append(doc.Statement, statement("Peering",
+			"ec2:AcceptVpcPeeringConnection",
+			"ec2:CreateRoute",
+			"ec2:CreateVpcPeeringConnection",
+			"ec2:DeleteRoute",
+			"ec2:DeleteVpcPeeringConnection",
+			"ec2:DescribeVpcPeeringConnections",
+		))
+	}
+	if has(features, FeatureEgress) {
+		doc.Statement = append(doc.Statement, statement("Egress",
+			"ec2:AllocateAddress",
+			"ec2:CreateNatGateway",
+			"ec2:DeleteNatGateway",
+			"ec2:ReleaseAddress",
+		))
+	}
+	if has(features, FeatureHardening) {
+		// volumes are read by the compliance report
+		doc.Statement = append(doc.Statement, statement("Hardening",
+			"ec2:DescribeVolumes",
+			"ec2:ModifyInstanceMetadataOptions",
+		))
+	}
+	if has(features, FeatureSpreadMasters) {
+		doc.Statement = append(doc.Statement, statement("SpreadMasters",
+			"ec2:CreatePlacementGroup",
+			"ec2:DeletePlacementGroup",
+		))
+	}
+
+	return doc
+}
+
+// AzureRoleDefinition is a custom role, the service principal
+// of the cloud account is assigned to it.
+type AzureRoleDefinition struct {
+	Name             string   `json:"Name"`
+	IsCustom         bool     `json:"IsCustom"`
+	Description      string   `json:"Description"`
+	Actions          []string `json:"Actions"`
+	NotActions       []string `json:"NotActions"`
+	AssignableScopes []string `json:"AssignableScopes"`
+}
+
+func azureRole(features []string, subscriptionID string) *AzureRoleDefinition {
+	if subscriptionID == "" {
+		subscriptionID = "<subscription-id>"
+	}
+
+	role := &AzureRoleDefinition{
+		Name:        "Supergiant Control",
+		IsCustom:    true,
+		Description: "Provisioning of kubernetes clusters by supergiant control",
+		Actions: []string{
+			"Microsoft.Resources/subscriptions/resourceGroups/read",
+			"Microsoft.Resources/subscriptions/resourceGroups/write",
+			"Microsoft.Resources/subscriptions/resourceGroups/delete",
+			"Microsoft.Network/virtualNetworks/read",
+			"Microsoft.Network/virtualNetworks/write",
+			"Microsoft.Network/virtualNetworks/subnets/join/action",
+			"Microsoft.Network/networkSecurityGroups/read",
+			"Microsoft.Network/networkSecurityGroups/write",
+			"Microsoft.Network/networkSecurityGroups/join/action",
+			"Microsoft.Network/networkInterfaces/read",
+			"Microsoft.Network/networkInterfaces/write",
+			"Microsoft.Network/networkInterfaces/join/action",
+			"Microsoft.Network/publicIPAddresses/read",
+			"Microsoft.Network/publicIPAddresses/write",
+			"Microsoft.Network/publicIPAddresses/join/action",
+			"Microsoft.Compute/virtualMachines/read",
+			"Microsoft.Compute/virtualMachines/write",
+			"Microsoft.Compute/virtualMachines/delete",
+		},
+		NotActions:       []string{},
+		AssignableScopes: []string{"/subscriptions/" + subscriptionID},
+	}
+
+	if has(features, FeatureDNS) {
+		role.Actions = append(role.Actions,
+			"Microsoft.Network/dnsZones/A/read",
+			"Microsoft.Network/dnsZones/A/write",
+			"Microsoft.Network/dnsZones/A/delete",
+		)
+	}
+	if has(features, FeatureRestrictAPIServer) {
+		role.Actions = append(role.Actions,
+			"Microsoft.Network/networkSecurityGroups/securityRules/read",
+			"Microsoft.Network/networkSecurityGroups/securityRules/write",
+		)
+	}
+	if has(features, FeaturePeering) {
+		role.Actions = append(role.Actions,
+			"Microsoft.Network/virtualNetworks/peer/action",
+			"Microsoft.Network/virtualNetworks/virtualNetworkPeerings/read",
+			"Microsoft.Network/virtualNetworks/virtualNetworkPeerings/write",
+			"Microsoft.Network/virtualNetworks/virtualNetworkPeerings/delete",
+		)
+	}
+	if has(features, FeatureSpreadMasters) {
+		role.Actions = append(role.Actions,
+			"Microsoft.Compute/availabilitySets/read",
+			"Microsoft.Compute/availabilitySets/write",
+		)
+	}
+
+	return role
+}
+
+const (
+	gceRoleID           = "supergiantControl"
+	gceServiceAccountID = "supergiant-control"
+)
+
+func gcePermissions(features []string) []string {
+	permissions := []string{
+		"compute.disks.create",
+		"compute.images.get",
+		"compute.images.getFromFamily",
+		"compute.images.useReadOnly",
+		"compute.instances.create",
+		"compute.instances.delete",
+		"compute.instances.get",
+		"compute.instances.setMetadata",
+		"compute.instances.setTags",
+		"compute.machineTypes.get",
+		"compute.machineTypes.list",
+		"compute.networks.get",
+		"compute.regions.get",
+		"compute.regions.list",
+		"compute.subnetworks.use",
+		"compute.subnetworks.useExternalIp",
+		"compute.zones.get",
+		"compute.zones.list",
+	}
+
+	if has(features, FeatureDNS) {
+		permissions = append(permissions,
+			"dns.changes.create",
+			"dns.changes.get",
+			"dns.resourceRecordSets.create",
+			"dns.resourceRecordSets.delete",
+			"dns.resourceRecordSets.list",
+			"dns.resourceRecordSets.update",
+		)
+	}
+	if has(features, FeatureRestrictAPIServer) {
+		permissions = append(permissions,
+			"compute.firewalls.create",
+			"compute.firewalls.delete",
+			"compute.firewalls.get",
+			"compute.firewalls.update",
+			"compute.networks.updatePolicy",
+		)
+	}
+	if has(features, FeatureSpreadMasters) {
+		// creation of the policy is waited for by its region operation
+		permissions = append(permissions,
+			"compute.regionOperations.get",
+			"compute.resourcePolicies.create",
+			"compute.resourcePolicies.delete",
+			"compute.resourcePolicies.get",
+			"compute.resourcePolicies.use",
+		)
+	}
+
+	sort.Strings(permissions)
+	return permissions
+}
+
+// gcloudCommands create a custom role and a service account with the role,
+// the key of the service account is the credential of the cloud account.
+func gcloudCommands(features []string, projectID string) []string {
+	if projectID == "" {
+		projectID = "<project-id>"
+	}
+	account := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", gceServiceAccountID, projectID)
+
+	return []string{
+		fmt.Sprintf("gcloud iam roles create %s --project=%s --title='Supergiant Control' --permissions=%s",
+			gceRoleID, projectID, strings.Join(gcePermissions(features), ",")),
+		fmt.Sprintf("gcloud iam service-accounts create %s --project=%s --display-name='Supergiant Control'",
+			gceServiceAccountID, projectID),
+		fmt.Sprintf("gcloud projects add-iam-policy-binding %s --member=serviceAccount:%s --role=projects/%s/roles/%s",
+			projectID, account, projectID, gceRoleID),
+		fmt.Sprintf("gcloud iam service-accounts keys create key.json --iam-account=%s", account),
+	}
+}
@@ -0,0 +1,147 @@
+package onboarding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func actions(doc *AWSPolicyDocument) []string {
+	out := make([]string, 0)
+	for _, s := range doc.Statement {
+		out = append(out, s.Action...)
+	}
+	return out
+}
+
+func TestGenerate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		provider    clouds.Name
+		features    []string
+		params      Params
+		expectedErr error
+		check       func(*testing.T, *Policy)
+	}{
+		{
+			name:     "aws base",
+			provider: clouds.AWS,
+			check: func(t *testing.T, p *Policy) {
+				require.Equal(t, FormatAWSPolicy, p.Format)
+				all := actions(p.Document.(*AWSPolicyDocument))
+				require.Contains(t, all, "ec2:RunInstances")
+				require.Contains(t, all, "iam:PassRole")
+				require.NotContains(t, all, "route53:ChangeResourceRecordSets")
+				require.NotContains(t, all, "ec2:CreateNatGateway")
+			},
+		},
+		{
+			name:     "aws features",
+			provider: clouds.AWS,
+			features: []string{FeatureEgress, FeatureDNS, FeatureDNS},
+			check: func(t *testing.T, p *Policy) {
+				require.Equal(t, []string{FeatureDNS, FeatureEgress}, p.Features)
+				all := actions(p.Document.(*AWSPolicyDocument))
+				require.Contains(t, all, "route53:ChangeResourceRecordSets")
+				require.Contains(t, all, "ec2:CreateNatGateway")
+				require.NotContains(t, all, "ec2:CreateVpcPeeringConnection")
+				require.NotContains(t, all, "cloudformation:CreateStack")
+			},
+		},
+		{
+			name:     "aws stack",
+			provider: clouds.AWS,
+			features: []string{FeatureStack},
+			check: func(t *testing.T, p *Policy) {
+				all := actions(p.Document.(*AWSPolicyDocument))
+				require.Contains(t, all, "cloudformation:CreateStack")
+				require.Contains(t, all, "cloudformation:DescribeStacks")
+			},
+		},
+		{
+			name:     "aws hardening",
+			provider: clouds.AWS,
+			features: []string{FeatureHardening},
+			check: func(t *testing.T, p *Policy) {
+				all := actions(p.Document.(*AWSPolicyDocument))
+				require.Contains(t, all, "ec2:ModifyInstanceMetadataOptions")
+				require.NotContains(t, all, "cloudformation:CreateStack")
+			},
+		},
+		{
+			name:     "azure",
+			provider: clouds.Azure,
+			features: []string{FeaturePeering},
+			params:   Params{SubscriptionID: "sub"},
+			check: func(t *testing.T, p *Policy) {
+				role := p.Document.(*AzureRoleDefinition)
+				require.Equal(t, []string{"/subscriptions/sub"}, role.AssignableScopes)
+				require.Contains(t, role.Actions, "Microsoft.Network/virtualNetworks/peer/action")
+				require.NotContains(t, role.Actions, "Microsoft.Network/dnsZones/A/write")
+			},
+		},
+		{
+			name:     "gce",
+			provider: clouds.GCE,
+			features: []string{FeatureDNS},
+			params:   Params{ProjectID: "project"},
+			check: func(t *testing.T, p *Policy) {
+				require.Equal(t, FormatGCloud, p.Format)
+				require.Len(t, p.Commands, 4)
+				require.True(t, strings.Contains(p.Commands[0], "dns.changes.create"))
+				require.False(t, strings.Contains(p.Commands[0], "compute.firewalls.create"))
+				require.True(t, strings.Contains(p.Commands[2], "supergiant-control@project.iam.gserviceaccount.com"))
+			},
+		},
+		{
+			name:     "gce spread masters",
+			provider: clouds.GCE,
+			features: []string{FeatureSpreadMasters},
+			check: func(t *testing.T, p *Policy) {
+				require.True(t, strings.Contains(p.Commands[0], "compute.resourcePolicies.create"))
+				require.False(t, strings.Contains(p.Commands[0], "dns.changes.create"))
+			},
+		},
+		{
+			name:     "digitalocean",
+			provider: clouds.DigitalOcean,
+			check: func(t *testing.T, p *Policy) {
+				require.Equal(t, FormatDigitalOceanAPI, p.Format)
+			},
+		},
+		{
+			name:        "unknown feature",
+			provider:    clouds.AWS,
+			features:    []string{"gpu"},
+			expectedErr: ErrUnknownFeature,
+		},
+		{
+			name:        "feature isn't supported",
+			provider:    clouds.DigitalOcean,
+			features:    []string{FeatureDNS},
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "stacks are aws only",
+			provider:    clouds.GCE,
+			features:    []string{FeatureStack},
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "provider can't be provisioned",
+			provider:    clouds.Packet,
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+	} {
+		p, err := Generate(tc.provider, tc.features, tc.params)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if tc.check != nil {
+			tc.check(t, p)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package peering
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+// Servicer is an interface of the peering service.
+type Servicer interface {
+	Create(ctx context.Context, clusterID, peerClusterID string) (*Peering, error)
+	Get(ctx context.Context, id string) (*Peering, error)
+	List(ctx context.Context) ([]Peering, error)
+	Delete(ctx context.Context, id string) (*Peering, error)
+}
+
+// CreateRequest names clusters whose networks are peered.
+type CreateRequest struct {
+	ClusterID     string `json:"clusterId"`
+	PeerClusterID string `json:"peerClusterId"`
+}
+
+// Handler is a http handler for peerings of cluster networks.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds peering handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/peerings", h.createPeering).Methods(http.MethodPost)
+	r.HandleFunc("/peerings", h.listPeerings).Methods(http.MethodGet)
+	r.HandleFunc("/peerings/{id}", h.getPeering).Methods(http.MethodGet)
+	r.HandleFunc("/peerings/{id}", h.deletePeering).Methods(http.MethodDelete)
+}
+
+func (h *Handler) createPeering(w http.ResponseWriter, r *http.Request) {
+	req := &CreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if req.ClusterID == "" || req.PeerClusterID == "" {
+		message.SendValidationFailed(w, errors.New("clusterId and peerClusterId are required"))
+		return
+	}
+
+	p, err := h.svc.Create(r.Context(), req.ClusterID, req.PeerClusterID)
+	if err != nil {
+		logrus.Errorf("peering: create %s-%s: %v", req.ClusterID, req.PeerClusterID, err)
+		sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		logrus.Errorf("peering: encode %s: %v", p.ID, err)
+	}
+}
+
+func (h *Handler) listPeerings(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		logrus.Errorf("peering: list: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getPeering(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	p, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) deletePeering(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	p, err := h.svc.Delete(r.Context(), id)
+	if err != nil {
+		logrus.Errorf("peering: delete %s: %v", id, err)
+		sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		logrus.Errorf("peering: encode %s: %v", p.ID, err)
+	}
+}
+
+func sendError(w http.ResponseWriter, err error) {
+	switch cause := errors.Cause(err); {
+	case sgerrors.IsNotFound(err):
+		message.SendNotFound(w, "peering", err)
+	case cause == ErrOverlap || cause == ErrPeered || sgerrors.IsAlreadyExists(err):
+		message.SendAlreadyExists(w, "peering", err)
+	case sgerrors.IsUnsupportedProvider(err) || cause == sgerrors.ErrInvalidJson:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,99 @@
+package peering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestHandler(t *testing.T) {
+	svc, r := newTestService(fakeKubes{
+		"a": kubeFixture("a", clouds.Azure, "10.1.0.0/16"),
+		"b": kubeFixture("b", clouds.Azure, "10.1.0.0/24"),
+		"c": kubeFixture("c", clouds.Azure, "10.2.0.0/16"),
+	})
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "no peer",
+			body:         `{"clusterId":"a"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			body:         `{"clusterId":"a","peerClusterId":"d"}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "overlap",
+			body:         `{"clusterId":"a","peerClusterId":"b"}`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "accepted",
+			body:         `{"clusterId":"a","peerClusterId":"c"}`,
+			expectedCode: http.StatusAccepted,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/peerings", bytes.NewBufferString(tc.body))
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+
+	list, err := svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	id := list[0].ID
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/peerings/"+id, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	p := &Peering{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(p))
+	require.Equal(t, "c", p.PeerClusterID)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/peerings/missing", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/peerings/"+id, nil))
+	require.Equal(t, http.StatusConflict, rec.Code, "pending peering can't be deleted")
+
+	r.result <- nil
+	waitState(t, svc, id, StateActive)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/peerings/"+id, nil))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/peerings", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list, 1)
+	require.Equal(t, StateDeleting, list[0].State)
+}
@@ -0,0 +1,373 @@
+package peering
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DefaultStoragePrefix = "/supergiant/peerings/"
+
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateActive   State = "active"
+	StateFailed   State = "failed"
+	StateDeleting State = "deleting"
+)
+
+var (
+	// ErrOverlap is returned for clusters whose networks can't be routed to each other.
+	ErrOverlap = errors.New("networks of the clusters overlap")
+	// ErrPeered is returned when the clusters already have a peering.
+	ErrPeered = errors.New("clusters are already peered")
+)
+
+// Peering is a private connection between networks of two clusters.
+type Peering struct {
+	ID            string      `json:"id"`
+	ClusterID     string      `json:"clusterId"`
+	PeerClusterID string      `json:"peerClusterId"`
+	Provider      clouds.Name `json:"provider"`
+	State         State       `json:"state"`
+	// ConnectionID is an id of the peering in the cloud
+	ConnectionID string    `json:"connectionId,omitempty"`
+	TaskID       string    `json:"taskId,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+type accountGetter interface {
+	Get(ctx context.Context, accountName string) (*model.CloudAccount, error)
+}
+
+// runFn starts a workflow and returns an id of the task and a channel with its result,
+// the peering config is updated by the workflow before the result is sent.
+type runFn func(ctx context.Context, workflow string, cfg *steps.Config) (string, <-chan error, error)
+
+// Service peers networks of managed clusters.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	kubes    kubeGetter
+	accounts accountGetter
+	run      runFn
+}
+
+// NewService constructs a Service, tasks are saved to the taskRepo.
+func NewService(prefix string, s storage.Interface, kubes kubeGetter,
+	accounts accountGetter, taskRepo storage.Interface) *Service {
+	return &Service{
+		prefix:   prefix,
+		storage:  s,
+		kubes:    kubes,
+		accounts: accounts,
+		run:      taskRunner(taskRepo, util.GetWriter),
+	}
+}
+
+// Create validates the clusters and starts peering their networks in the background.
+func (s *Service) Create(ctx context.Context, clusterID, peerClusterID string) (*Peering, error) {
+	if clusterID == peerClusterID {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, "cluster can't be peered with itself")
+	}
+
+	k, err := s.kubes.Get(ctx, clusterID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", clusterID)
+	}
+	peer, err := s.kubes.Get(ctx, peerClusterID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", peerClusterID)
+	}
+	if err = validate(k, peer); err != nil {
+		return nil, err
+	}
+
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.connects(clusterID, peerClusterID) {
+			return nil, errors.Wrapf(ErrPeered, "peering %s", p.ID)
+		}
+	}
+
+	cfg, err := s.configFor(ctx, k, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peering{
+		ID:            uuid.New()[:8],
+		ClusterID:     clusterID,
+		PeerClusterID: peerClusterID,
+		Provider:      k.Provider,
+		State:         StatePending,
+		CreatedAt:     time.Now(),
+	}
+	if err = s.start(ctx, p, workflows.PeerNetworks, cfg); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Get returns a peering by its id.
+func (s *Service) Get(ctx context.Context, id string) (*Peering, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get peering %s", id)
+	}
+
+	p := new(Peering)
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, errors.Wrapf(err, "decode peering %s", id)
+	}
+
+	return p, nil
+}
+
+// List returns all peerings.
+func (s *Service) List(ctx context.Context) ([]Peering, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list peerings")
+	}
+
+	list := make([]Peering, 0, len(raw))
+	for _, data := range raw {
+		p := Peering{}
+		if err = json.Unmarshal(data, &p); err != nil {
+			logrus.Warnf("peering: skip corrupted record: %v", err)
+			continue
+		}
+		list = append(list, p)
+	}
+
+	return list, nil
+}
+
+// Delete starts removing the peering from the cloud, the record is deleted
+// when the task succeeds.
+func (s *Service) Delete(ctx context.Context, id string) (*Peering, error) {
+	p, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.State == StatePending || p.State == StateDeleting {
+		return nil, errors.Wrapf(sgerrors.ErrAlreadyExists, "peering %s is %s", id, p.State)
+	}
+
+	k, err := s.kubes.Get(ctx, p.ClusterID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", p.ClusterID)
+	}
+	peer, err := s.kubes.Get(ctx, p.PeerClusterID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", p.PeerClusterID)
+	}
+
+	cfg, err := s.configFor(ctx, k, peer)
+	if err != nil {
+		return nil, err
+	}
+	cfg.PeeringConfig.ConnectionID = p.ConnectionID
+
+	p.State = StateDeleting
+	p.Error = ""
+	if err = s.start(ctx, p, workflows.UnpeerNetworks, cfg); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// start saves the peering and updates it when the workflow is done.
+func (s *Service) start(ctx context.Context, p *Peering, workflow string, cfg *steps.Config) error {
+	taskID, errCh, err := s.run(tenant.Detach(ctx), workflow, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "run %s", workflow)
+	}
+	p.TaskID = taskID
+	if err = s.save(ctx, p); err != nil {
+		return err
+	}
+
+	done := *p
+	go func() {
+		ctx := tenant.Detach(ctx)
+		err := <-errCh
+
+		// a failed peering keeps its connection, so it can be deleted
+		done.ConnectionID = cfg.PeeringConfig.ConnectionID
+		if err != nil {
+			logrus.Errorf("peering %s: %s: %v", done.ID, workflow, err)
+			done.State = StateFailed
+			done.Error = err.Error()
+		} else if workflow == workflows.UnpeerNetworks {
+			if err = s.storage.Delete(ctx, s.prefix, done.ID); err != nil {
+				logrus.Errorf("peering %s: delete: %v", done.ID, err)
+			}
+			return
+		} else {
+			done.State = StateActive
+		}
+
+		if err = s.save(ctx, &done); err != nil {
+			logrus.Errorf("peering %s: save: %v", done.ID, err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Service) save(ctx context.Context, p *Peering) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrapf(err, "encode peering %s", p.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, p.ID, data), "save peering %s", p.ID)
+}
+
+// configFor builds a config of the cluster with cloud data of the peer
+// in its peering config.
+func (s *Service) configFor(ctx context.Context, k, peer *model.Kube) (*steps.Config, error) {
+	cfg, err := s.clusterConfig(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	peerCfg, err := s.clusterConfig(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.PeeringConfig = steps.PeeringConfig{
+		PeerClusterID: peer.ID,
+		AWSConfig:     peerCfg.AWSConfig,
+		AzureConfig:   peerCfg.AzureConfig,
+	}
+
+	return cfg, nil
+}
+
+func (s *Service) clusterConfig(ctx context.Context, k *model.Kube) (*steps.Config, error) {
+	cfg := &steps.Config{
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+	}
+
+	acc, err := s.accounts.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+	if err = util.FillCloudAccountCredentials(ctx, acc, cfg); err != nil {
+		return nil, errors.Wrapf(err, "cloud account %s", k.AccountName)
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (p Peering) connects(clusterID, peerClusterID string) bool {
+	return (p.ClusterID == clusterID && p.PeerClusterID == peerClusterID) ||
+		(p.ClusterID == peerClusterID && p.PeerClusterID == clusterID)
+}
+
+func validate(k, peer *model.Kube) error {
+	if k.Provider != peer.Provider {
+		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "peering of %s with %s", k.Provider, peer.Provider)
+	}
+	if k.Provider != clouds.AWS && k.Provider != clouds.Azure {
+		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "peering: %s", k.Provider)
+	}
+	for _, c := range []*model.Kube{k, peer} {
+		if c.ExternallyManaged {
+			return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "kube %s is externally managed", c.ID)
+		}
+		if c.State != model.StateOperational {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s is %s", c.ID, c.State)
+		}
+	}
+
+	a, err := networkOf(k)
+	if err != nil {
+		return err
+	}
+	b, err := networkOf(peer)
+	if err != nil {
+		return err
+	}
+	if a.Contains(b.IP) || b.Contains(a.IP) {
+		return errors.Wrapf(ErrOverlap, "%s and %s", a, b)
+	}
+
+	return nil
+}
+
+// networkOf returns a cidr of the cloud network of the cluster.
+func networkOf(k *model.Kube) (*net.IPNet, error) {
+	cidr := k.Networking.CIDR
+	if k.Provider == clouds.AWS {
+		cidr = k.CloudSpec[clouds.AwsVpcCIDR]
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "network of kube %s: %v", k.ID, err)
+	}
+
+	return network, nil
+}
+
+func taskRunner(repo storage.Interface, getWriter func(string) (io.WriteCloser, error)) runFn {
+	return func(ctx context.Context, workflow string, cfg *steps.Config) (string, <-chan error, error) {
+		t, err := workflows.NewTask(workflow, repo)
+		if err != nil {
+			return "", nil, err
+		}
+		writer, err := getWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return "", nil, err
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			err := <-t.Run(ctx, *cfg, writer)
+			// steps fill in the config of the task
+			if t.Config != nil {
+				cfg.PeeringConfig = t.Config.PeeringConfig
+			}
+			result <- err
+		}()
+
+		return t.ID, result, nil
+	}
+}
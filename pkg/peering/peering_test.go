@@ -0,0 +1,216 @@
+package peering
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, id string) (*model.Kube, error) {
+	k, ok := f[id]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+type fakeAccounts struct{}
+
+func (fakeAccounts) Get(ctx context.Context, name string) (*model.CloudAccount, error) {
+	return &model.CloudAccount{
+		Name:     name,
+		Provider: clouds.Name(name),
+	}, nil
+}
+
+// fakeRunner finishes workflows with the result, a peering gets the connection id.
+type fakeRunner struct {
+	result    chan error
+	workflows []string
+	vpcs      []string
+	peers     []steps.PeeringConfig
+}
+
+func (f *fakeRunner) run(ctx context.Context, workflow string, cfg *steps.Config) (string, <-chan error, error) {
+	f.workflows = append(f.workflows, workflow)
+	f.vpcs = append(f.vpcs, cfg.AWSConfig.VPCID)
+	f.peers = append(f.peers, cfg.PeeringConfig)
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := <-f.result
+		if workflow == workflows.PeerNetworks {
+			cfg.PeeringConfig.ConnectionID = "pcx-1"
+		}
+		errCh <- err
+	}()
+	return "task-" + workflow, errCh, nil
+}
+
+func kubeFixture(id string, provider clouds.Name, cidr string) *model.Kube {
+	return &model.Kube{
+		ID:          id,
+		Provider:    provider,
+		AccountName: string(provider),
+		State:       model.StateOperational,
+		Networking:  model.Networking{CIDR: cidr},
+		CloudSpec: map[string]string{
+			clouds.AwsVpcCIDR: cidr,
+			clouds.AwsVpcID:   "vpc-" + id,
+		},
+	}
+}
+
+func newTestService(kubes fakeKubes) (*Service, *fakeRunner) {
+	r := &fakeRunner{result: make(chan error, 1)}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes, fakeAccounts{}, nil)
+	svc.run = r.run
+	return svc, r
+}
+
+func waitState(t *testing.T, svc *Service, id string, state State) *Peering {
+	for i := 0; i < 100; i++ {
+		p, err := svc.Get(context.Background(), id)
+		if err == nil && p.State == state {
+			return p
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("peering %s has not become %s", id, state)
+	return nil
+}
+
+func TestService_CreateValidation(t *testing.T) {
+	external := kubeFixture("external", clouds.AWS, "10.9.0.0/16")
+	external.ExternallyManaged = true
+	provisioning := kubeFixture("provisioning", clouds.AWS, "10.8.0.0/16")
+	provisioning.State = model.StateProvisioning
+
+	kubes := fakeKubes{
+		"a":            kubeFixture("a", clouds.AWS, "10.1.0.0/16"),
+		"b":            kubeFixture("b", clouds.AWS, "10.2.0.0/16"),
+		"overlap":      kubeFixture("overlap", clouds.AWS, "10.1.128.0/17"),
+		"azure":        kubeFixture("azure", clouds.Azure, "10.3.0.0/16"),
+		"do":           kubeFixture("do", clouds.DigitalOcean, "10.4.0.0/16"),
+		"do2":          kubeFixture("do2", clouds.DigitalOcean, "10.5.0.0/16"),
+		"external":     external,
+		"provisioning": provisioning,
+	}
+
+	for _, tc := range []struct {
+		name        string
+		peer        string
+		cluster     string
+		expectedErr error
+	}{
+		{
+			name:        "itself",
+			cluster:     "a",
+			peer:        "a",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "not found",
+			cluster:     "a",
+			peer:        "missing",
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "different providers",
+			cluster:     "a",
+			peer:        "azure",
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "unsupported provider",
+			cluster:     "do",
+			peer:        "do2",
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "externally managed",
+			cluster:     "a",
+			peer:        "external",
+			expectedErr: sgerrors.ErrUnsupportedProvider,
+		},
+		{
+			name:        "not operational",
+			cluster:     "a",
+			peer:        "provisioning",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "overlap",
+			cluster:     "a",
+			peer:        "overlap",
+			expectedErr: ErrOverlap,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, r := newTestService(kubes)
+
+			_, err := svc.Create(context.Background(), tc.cluster, tc.peer)
+			require.Equal(t, tc.expectedErr, errors.Cause(err))
+			require.Empty(t, r.workflows)
+		})
+	}
+}
+
+func TestService_CreateDelete(t *testing.T) {
+	kubes := fakeKubes{
+		"a": kubeFixture("a", clouds.AWS, "10.1.0.0/16"),
+		"b": kubeFixture("b", clouds.AWS, "10.2.0.0/16"),
+	}
+	svc, r := newTestService(kubes)
+	ctx := context.Background()
+
+	p, err := svc.Create(ctx, "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, StatePending, p.State)
+	require.Equal(t, "task-"+workflows.PeerNetworks, p.TaskID)
+	require.Equal(t, "vpc-a", r.vpcs[0])
+	require.Equal(t, "vpc-b", r.peers[0].AWSConfig.VPCID)
+
+	_, err = svc.Delete(ctx, p.ID)
+	require.True(t, sgerrors.IsAlreadyExists(err), "pending peering must not be deleted")
+
+	r.result <- nil
+	p = waitState(t, svc, p.ID, StateActive)
+	require.Equal(t, "pcx-1", p.ConnectionID)
+
+	_, err = svc.Create(ctx, "b", "a")
+	require.Equal(t, ErrPeered, errors.Cause(err))
+
+	p, err = svc.Delete(ctx, p.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateDeleting, p.State)
+	require.Equal(t, workflows.UnpeerNetworks, r.workflows[1])
+	require.Equal(t, "pcx-1", r.peers[1].ConnectionID)
+
+	r.result <- errors.New("throttled")
+	p = waitState(t, svc, p.ID, StateFailed)
+	require.Equal(t, "throttled", p.Error)
+
+	_, err = svc.Delete(ctx, p.ID)
+	require.NoError(t, err)
+	r.result <- nil
+	for i := 0; i < 100; i++ {
+		if _, err = svc.Get(ctx, p.ID); sgerrors.IsNotFound(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, sgerrors.IsNotFound(err), "peering must be removed, got %v", err)
+}
@@ -0,0 +1,133 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type Servicer interface {
+	List(ctx context.Context) ([]*Role, error)
+	Get(ctx context.Context, name string) (*Role, error)
+	Set(ctx context.Context, r *Role) error
+	Delete(ctx context.Context, name string) error
+}
+
+// Handler manages roles, roles are changed by admins of the default tenant.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/permissions", h.current).Methods(http.MethodGet)
+	r.HandleFunc("/roles", h.listRoles).Methods(http.MethodGet)
+	r.HandleFunc("/roles/{name}", h.getRole).Methods(http.MethodGet)
+	r.HandleFunc("/roles/{name}", h.setRole).Methods(http.MethodPut)
+	r.HandleFunc("/roles/{name}", h.deleteRole).Methods(http.MethodDelete)
+}
+
+// isAdmin reports whether roles may be changed with the request token.
+func isAdmin(ctx context.Context) bool {
+	return tenant.FromContext(ctx) == tenant.DefaultID && IsAdmin(ctx)
+}
+
+// current returns permissions of the request token.
+func (h *Handler) current(w http.ResponseWriter, r *http.Request) {
+	set := FromContext(r.Context())
+	if set == nil {
+		set = Set{}
+	}
+	if err := json.NewEncoder(w).Encode(set); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) listRoles(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	role, err := h.svc.Get(r.Context(), name)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, name, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(role); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) setRole(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		http.Error(w, "roles are managed by admins of the default tenant", http.StatusForbidden)
+		return
+	}
+
+	role := new(Role)
+	if err := json.NewDecoder(r.Body).Decode(role); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	role.Name = mux.Vars(r)["name"]
+
+	if err := h.svc.Set(r.Context(), role); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(role); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// deleteRole removes a custom role, built-in roles get their permissions back.
+func (h *Handler) deleteRole(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		http.Error(w, "roles are managed by admins of the default tenant", http.StatusForbidden)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if err := h.svc.Delete(r.Context(), name); err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, name, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
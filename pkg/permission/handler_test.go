@@ -0,0 +1,76 @@
+package permission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func serve(h *Handler, tenantID string, admin bool, method, url string, body []byte, set Set) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	h.Register(router)
+
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	ctx := WithAdmin(WithSet(tenant.WithID(context.Background(), tenantID), set), admin)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req.WithContext(ctx))
+	return rec
+}
+
+func TestHandler_roles(t *testing.T) {
+	h := NewHandler(NewService(DefaultStoragePrefix, memory.NewInMemoryRepository()))
+	body := []byte(`{"permissions":["release:*","kube:read"]}`)
+
+	for _, tc := range []struct {
+		name         string
+		tenantID     string
+		method       string
+		url          string
+		body         []byte
+		expectedCode int
+	}{
+		{"tenant", "acme", http.MethodPut, "/roles/deployer", body, http.StatusForbidden},
+		{"invalid", tenant.DefaultID, http.MethodPut, "/roles/deployer", []byte(`{"permissions":["release"]}`),
+			http.StatusBadRequest},
+		{"set", tenant.DefaultID, http.MethodPut, "/roles/deployer", body, http.StatusOK},
+		{"get", "acme", http.MethodGet, "/roles/deployer", nil, http.StatusOK},
+		{"unknown", "acme", http.MethodGet, "/roles/operator", nil, http.StatusNotFound},
+		{"tenant delete", "acme", http.MethodDelete, "/roles/deployer", nil, http.StatusForbidden},
+		{"delete", tenant.DefaultID, http.MethodDelete, "/roles/deployer", nil, http.StatusAccepted},
+		{"deleted", tenant.DefaultID, http.MethodGet, "/roles/deployer", nil, http.StatusNotFound},
+	} {
+		rec := serve(h, tc.tenantID, true, tc.method, tc.url, tc.body, nil)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+
+	// editors of the default tenant can't grant themselves permissions
+	require.Equal(t, http.StatusForbidden,
+		serve(h, tenant.DefaultID, false, http.MethodPut, "/roles/edit", body, nil).Code)
+	require.Equal(t, http.StatusForbidden,
+		serve(h, tenant.DefaultID, false, http.MethodDelete, "/roles/view", nil, nil).Code)
+
+	rec := serve(h, "acme", false, http.MethodGet, "/roles", nil, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	list := make([]*Role, 0)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list, 3)
+}
+
+func TestHandler_current(t *testing.T) {
+	h := NewHandler(NewService(DefaultStoragePrefix, memory.NewInMemoryRepository()))
+
+	rec := serve(h, "acme", false, http.MethodGet, "/permissions", nil, Set{"kube:read"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	set := Set{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&set))
+	require.Equal(t, Set{"kube:read"}, set)
+}
@@ -0,0 +1,93 @@
+package permission
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Any stands for any resource or verb of a permission, e.g. kube:* or *:read.
+	Any = "*"
+	// All is a permission of any verb on any resource.
+	All = Any + ":" + Any
+
+	VerbRead    = "read"
+	VerbCreate  = "create"
+	VerbUpdate  = "update"
+	VerbDelete  = "delete"
+	VerbInstall = "install"
+)
+
+// Parse splits a permission like kube:delete into its resource and verb.
+func Parse(p string) (string, string, error) {
+	parts := strings.Split(p, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("permission %q must be resource:verb", p)
+	}
+	return parts[0], parts[1], nil
+}
+
+// IsPermission reports whether the access of a token is a permission rather than a role.
+func IsPermission(access string) bool {
+	return strings.Contains(access, ":")
+}
+
+// Set is a list of permissions granted to a token.
+type Set []string
+
+// Allows reports whether any permission of the set matches the required one.
+func (s Set) Allows(required string) bool {
+	resource, verb, err := Parse(required)
+	if err != nil {
+		return false
+	}
+	for _, p := range s {
+		r, v, err := Parse(p)
+		if err != nil {
+			continue
+		}
+		if (r == Any || r == resource) && (v == Any || v == verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the set grants everything of the other one, e.g.
+// tokens can't be created with more permissions than their creator has.
+func (s Set) Covers(other Set) bool {
+	for _, p := range other {
+		if !s.Allows(p) {
+			return false
+		}
+	}
+	return true
+}
+
+type setKey struct{}
+
+type adminKey struct{}
+
+// WithSet returns a context with permissions of the request token.
+func WithSet(ctx context.Context, s Set) context.Context {
+	return context.WithValue(ctx, setKey{}, s)
+}
+
+// FromContext returns permissions of the request token.
+func FromContext(ctx context.Context) Set {
+	s, _ := ctx.Value(setKey{}).(Set)
+	return s
+}
+
+// WithAdmin returns a context telling whether the request token is an admin one.
+func WithAdmin(ctx context.Context, admin bool) context.Context {
+	return context.WithValue(ctx, adminKey{}, admin)
+}
+
+// IsAdmin reports whether the request token is an admin one.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
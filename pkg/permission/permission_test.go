@@ -0,0 +1,64 @@
+package permission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet_Allows(t *testing.T) {
+	for _, tc := range []struct {
+		set      Set
+		required string
+		expected bool
+	}{
+		{Set{All}, "kube:delete", true},
+		{Set{"*:read"}, "kube:read", true},
+		{Set{"*:read"}, "kube:delete", false},
+		{Set{"kube:*"}, "kube:delete", true},
+		{Set{"kube:*"}, "release:install", false},
+		{Set{"release:install", "kube:read"}, "release:install", true},
+		{Set{"kube:read"}, "kube:*", false},
+		{Set{"invalid"}, "kube:read", false},
+		{Set{}, "kube:read", false},
+		{Set{All}, "invalid", false},
+	} {
+		require.Equal(t, tc.expected, tc.set.Allows(tc.required), "TC: %v %s", tc.set, tc.required)
+	}
+}
+
+func TestSet_Covers(t *testing.T) {
+	for _, tc := range []struct {
+		set      Set
+		other    Set
+		expected bool
+	}{
+		{Set{All}, Set{"*:read", "kube:*"}, true},
+		{Set{"kube:*"}, Set{"kube:read", "kube:delete"}, true},
+		{Set{"kube:*"}, Set{"kube:read", "release:read"}, false},
+		{Set{"*:read"}, Set{All}, false},
+		{Set{"kube:read"}, Set{}, true},
+	} {
+		require.Equal(t, tc.expected, tc.set.Covers(tc.other), "TC: %v %v", tc.set, tc.other)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		permission       string
+		expectedResource string
+		expectedVerb     string
+		expectedErr      bool
+	}{
+		{"kube:delete", "kube", "delete", false},
+		{"*:*", "*", "*", false},
+		{"kube", "", "", true},
+		{"kube:", "", "", true},
+		{"a:b:c", "", "", true},
+	} {
+		resource, verb, err := Parse(tc.permission)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s", tc.permission)
+		require.Equal(t, tc.expectedResource, resource, "TC: %s", tc.permission)
+		require.Equal(t, tc.expectedVerb, verb, "TC: %s", tc.permission)
+	}
+}
@@ -0,0 +1,196 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const DefaultStoragePrefix = "/supergiant/role/"
+
+// Role is a named list of permissions, tokens get permissions of roles
+// listed in their accesses.
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	// BuiltIn roles are assigned to users, they are reset to their
+	// permissions when deleted.
+	BuiltIn bool `json:"builtIn,omitempty"`
+}
+
+// operated are resources editors manage and viewers read. Credentials of
+// clusters, users and settings of control itself are left to admins.
+var operated = []string{
+	"kube", "release", "helm", "access", "node", "console", "pod", "snapshot",
+	"task", "firewall", "health", "account", "profile", "approval",
+	"federation", "mesh", "peering", "replacement", "gitops", "portal", "ipam",
+	"agent", "agentca",
+}
+
+// observed are resources users of any role may read, feature flags and
+// versions are changed by admins of the default tenant.
+var observed = []string{"activity", "search", "summary", "leader", "role", "session", "feature", "versions"}
+
+// builtIn are permissions of user roles unless they are changed.
+var builtIn = map[string][]string{
+	"admin": {All},
+	"edit": append(append(withVerb(Any, operated), withVerb(VerbRead, observed)...),
+		"session:"+VerbDelete, "token:"+VerbCreate),
+	"view": append(withVerb(VerbRead, operated), withVerb(VerbRead, observed)...),
+}
+
+func withVerb(verb string, resources []string) []string {
+	permissions := make([]string, 0, len(resources))
+	for _, r := range resources {
+		permissions = append(permissions, r+":"+verb)
+	}
+	return permissions
+}
+
+// Service keeps roles in the storage.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+	}
+}
+
+// List returns built-in and custom roles sorted by name.
+func (s *Service) List(ctx context.Context) ([]*Role, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "get roles")
+	}
+
+	byName := make(map[string]*Role)
+	for name, permissions := range builtIn {
+		byName[name] = &Role{Name: name, Permissions: permissions, BuiltIn: true}
+	}
+	for _, data := range raw {
+		r := new(Role)
+		if err = json.Unmarshal(data, r); err != nil {
+			return nil, errors.Wrap(err, "unmarshal role")
+		}
+		_, r.BuiltIn = builtIn[r.Name]
+		byName[r.Name] = r
+	}
+
+	list := make([]*Role, 0, len(byName))
+	for _, r := range byName {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Get returns a role by name.
+func (s *Service) Get(ctx context.Context, name string) (*Role, error) {
+	data, err := s.storage.Get(ctx, s.prefix, name)
+	if err != nil {
+		if permissions, ok := builtIn[name]; ok && sgerrors.IsNotFound(err) {
+			return &Role{Name: name, Permissions: permissions, BuiltIn: true}, nil
+		}
+		return nil, err
+	}
+
+	r := new(Role)
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal role %s", name)
+	}
+	_, r.BuiltIn = builtIn[name]
+	return r, nil
+}
+
+// Set validates and stores the role.
+func (s *Service) Set(ctx context.Context, r *Role) error {
+	if r.Name == "" || IsPermission(r.Name) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "role name %q", r.Name)
+	}
+	for _, p := range r.Permissions {
+		if _, _, err := Parse(p); err != nil {
+			return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+		}
+	}
+	_, r.BuiltIn = builtIn[r.Name]
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal role")
+	}
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, r.Name, data), "put role %s", r.Name)
+}
+
+// Delete removes a custom role or resets a built-in one.
+func (s *Service) Delete(ctx context.Context, name string) error {
+	if _, err := s.storage.Get(ctx, s.prefix, name); err != nil {
+		return err
+	}
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, name), "delete role %s", name)
+}
+
+// Resolve returns permissions of token accesses, they are permissions or
+// names of roles. Unknown roles grant nothing.
+func (s *Service) Resolve(ctx context.Context, accesses []string) (Set, error) {
+	set := make(Set, 0, len(accesses))
+	for _, a := range accesses {
+		if IsPermission(a) {
+			set = append(set, a)
+			continue
+		}
+
+		r, err := s.Get(ctx, a)
+		if err != nil {
+			if sgerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		set = append(set, r.Permissions...)
+	}
+	return set, nil
+}
+
+// Valid checks that accesses are permissions or known roles.
+func (s *Service) Valid(ctx context.Context, accesses []string) error {
+	for _, a := range accesses {
+		if IsPermission(a) {
+			if _, _, err := Parse(a); err != nil {
+				return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+			}
+			continue
+		}
+		if _, err := s.Get(ctx, a); err != nil {
+			if sgerrors.IsNotFound(err) {
+				return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown role %s", a)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Builtin resolves accesses with the built-in roles only.
+func Builtin(accesses []string) Set {
+	set := make(Set, 0, len(accesses))
+	for _, a := range accesses {
+		if IsPermission(a) {
+			set = append(set, a)
+			continue
+		}
+		set = append(set, builtIn[a]...)
+	}
+	return set
+}
@@ -0,0 +1,122 @@
+package permission
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func TestService_Resolve(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	ctx := context.Background()
+	require.NoError(t, svc.Set(ctx, &Role{Name: "deployer", Permissions: []string{"release:*", "kube:read"}}))
+
+	for _, tc := range []struct {
+		accesses []string
+		expected Set
+	}{
+		{[]string{"view"}, Set(builtIn["view"])},
+		{[]string{"admin", "view"}, append(Set{All}, builtIn["view"]...)},
+		{[]string{"deployer"}, Set{"release:*", "kube:read"}},
+		{[]string{"kubeconfig:read", "unknown"}, Set{"kubeconfig:read"}},
+		{nil, Set{}},
+	} {
+		set, err := svc.Resolve(ctx, tc.accesses)
+		require.NoError(t, err, "TC: %v", tc.accesses)
+		require.Equal(t, tc.expected, set, "TC: %v", tc.accesses)
+	}
+}
+
+func TestService_BuiltIn(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	ctx := context.Background()
+
+	// viewers are not allowed to get kubeconfigs
+	require.NoError(t, svc.Set(ctx, &Role{Name: "view", Permissions: []string{"kube:read", "release:read"}}))
+	set, err := svc.Resolve(ctx, []string{"view"})
+	require.NoError(t, err)
+	require.False(t, set.Allows("kubeconfig:read"))
+
+	r, err := svc.Get(ctx, "view")
+	require.NoError(t, err)
+	require.True(t, r.BuiltIn)
+
+	list, err := svc.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.Equal(t, []string{"kube:read", "release:read"}, list[2].Permissions)
+
+	// deleted built-in roles are reset
+	require.NoError(t, svc.Delete(ctx, "view"))
+	set, err = svc.Resolve(ctx, []string{"view"})
+	require.NoError(t, err)
+	require.Equal(t, Set(builtIn["view"]), set)
+	require.True(t, sgerrors.IsNotFound(svc.Delete(ctx, "view")))
+}
+
+func TestService_Set(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	for _, tc := range []struct {
+		role        *Role
+		expectedErr error
+	}{
+		{&Role{Name: "deployer", Permissions: []string{"release:install"}}, nil},
+		{&Role{Name: "", Permissions: []string{"release:install"}}, sgerrors.ErrInvalidJson},
+		{&Role{Name: "kube:read"}, sgerrors.ErrInvalidJson},
+		{&Role{Name: "deployer", Permissions: []string{"release"}}, sgerrors.ErrInvalidJson},
+	} {
+		err := svc.Set(context.Background(), tc.role)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %+v", tc.role)
+	}
+}
+
+func TestService_Valid(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	require.NoError(t, svc.Valid(context.Background(), []string{"view", "kube:read"}))
+	require.Equal(t, sgerrors.ErrInvalidJson,
+		errors.Cause(svc.Valid(context.Background(), []string{"operator"})))
+	require.Equal(t, sgerrors.ErrInvalidJson,
+		errors.Cause(svc.Valid(context.Background(), []string{"kube:read:all"})))
+}
+
+func TestBuiltin(t *testing.T) {
+	require.Equal(t, append(Set(builtIn["view"]), "kube:delete"), Builtin([]string{"view", "kube:delete", "unknown"}))
+}
+
+func TestBuiltin_Allows(t *testing.T) {
+	for _, tc := range []struct {
+		role       string
+		permission string
+		expected   bool
+	}{
+		{"admin", "role:update", true},
+		{"admin", "kubeconfig:read", true},
+		{"edit", "kube:delete", true},
+		{"edit", "pod:exec", true},
+		{"edit", "release:install", true},
+		{"edit", "session:delete", true},
+		{"edit", "kubeconfig:read", false},
+		{"edit", "cert:read", false},
+		{"edit", "role:update", false},
+		{"edit", "session:update", false},
+		{"edit", "guard:update", false},
+		{"edit", "ldap:read", false},
+		{"edit", "saml:update", false},
+		{"edit", "user:create", false},
+		{"view", "kube:read", true},
+		{"view", "role:read", true},
+		{"view", "kube:update", false},
+		{"view", "kubeconfig:read", false},
+		{"view", "cert:read", false},
+		{"view", "guard:read", false},
+	} {
+		require.Equal(t, tc.expected, Builtin([]string{tc.role}).Allows(tc.permission), "TC: %s %s", tc.role, tc.permission)
+	}
+}
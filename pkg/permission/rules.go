@@ -0,0 +1,115 @@
+package permission
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is trimmed from routes before permissions are looked up.
+const APIPrefix = "/v1/api"
+
+// resources name resources of routes by their longest prefix, the first
+// segment of routes not listed here is their resource.
+var resources = map[string]string{
+	"/kubes":          "kube",
+	"/provision":      "kube",
+	"/accounts":       "account",
+	"/onboarding":     "account",
+	"/cloud_accounts": "account",
+	"/kubeprofiles":   "profile",
+	"/profile":        "profile",
+	"/providers":      "profile",
+	"/tasks":          "task",
+	"/users":          "user",
+	"/sessions":       "session",
+	"/roles":          "role",
+	"/features":       "feature",
+	"/approvals":      "approval",
+	"/federations":    "federation",
+	"/meshes":         "mesh",
+	"/peerings":       "peering",
+	"/permissions":    "role",
+	"/replacements":   "replacement",
+
+	"/kubes/{kubeID}/releases":                    "release",
+	"/kubes/{kubeID}/helm":                        "release",
+	"/kubes/{kubeID}/users/{uname}/kubeconfig":    "kubeconfig",
+	"/kubes/{kubeID}/access/{grantID}/kubeconfig": "kubeconfig",
+	"/kubes/{kubeID}/access":                      "access",
+	"/kubes/{kubeID}/certs":                       "cert",
+	"/kubes/{kubeID}/nodes":                       "node",
+	"/kubes/{kubeID}/machines":                    "node",
+	"/kubes/{kubeID}/orphans":                     "node",
+	"/kubes/{kubeID}/consoles":                    "console",
+	"/kubes/{kubeID}/snapshots":                   "snapshot",
+	"/kubes/{kubeID}/tasks":                       "task",
+	"/kubes/{kubeID}/firewall":                    "firewall",
+	"/kubes/{kubeID}/apiserver/access":            "firewall",
+	"/sessions/tokens":                            "token",
+}
+
+// actions are routes that do more than their method says.
+var actions = map[string]string{
+	http.MethodPost + " /kubes/{kubeID}/releases":                             "release:" + VerbInstall,
+	http.MethodPost + " /kubes/{kubeID}/releases/migrate":                     "release:" + VerbInstall,
+	http.MethodPost + " /kubes/{kubeID}/snapshots/{namespace}/{name}/restore": "snapshot:restore",
+	http.MethodPost + " /kubes/{kubeID}/nodes/{nodename}/agentcert":           "cert:create",
+	http.MethodGet + " /kubes/{kubeID}/nodes/{nodename}/console":              "node:console",
+	http.MethodGet + " /kubes/{kubeID}/pods/{namespace}/{pod}/exec":           "pod:exec",
+	http.MethodPost + " /kubes/{kubeID}/exec":                                 "node:exec",
+	http.MethodPost + " /kubes/{kubeID}/bench":                                "node:exec",
+	http.MethodPost + " /kubes/{kubeID}/restart":                              "kube:update",
+	http.MethodPost + " /kubes/{kubeID}/patch":                                "kube:update",
+	http.MethodPost + " /kubes/{kubeID}/files":                                "kube:update",
+	http.MethodPost + " /kubes/{kubeID}/kubelet":                              "kube:update",
+	http.MethodPost + " /kubes/{kubeID}/volumes/cleanup":                      "kube:update",
+	http.MethodPost + " /approvals/{id}/approve":                              "approval:approve",
+	http.MethodPost + " /approvals/{id}/reject":                               "approval:approve",
+	http.MethodPost + " /federations/{id}/install":                            "federation:update",
+	http.MethodPost + " /federations/{id}/clusters":                           "federation:update",
+	http.MethodPost + " /replacements/{id}/resume":                            "replacement:update",
+	http.MethodPost + " /replacements/{id}/retire":                            "replacement:update",
+	http.MethodPost + " /meshes/{id}/rotate":                                  "mesh:update",
+	http.MethodPost + " /meshes/{id}/sync":                                    "mesh:update",
+	http.MethodPost + " /gitops/{bindingID}/sync":                             "gitops:update",
+	http.MethodPost + " /ldap/sync":                                           "ldap:update",
+	http.MethodPost + " /tasks/{id}/restart":                                  "task:update",
+	http.MethodPost + " /tasks/prune":                                         "task:delete",
+}
+
+// Required returns the permission required by a request of the route, routes
+// are templates like /kubes/{kubeID}/releases.
+func Required(method, route string) string {
+	route = strings.TrimPrefix(route, APIPrefix)
+	if p, ok := actions[method+" "+route]; ok {
+		return p
+	}
+	return resource(route) + ":" + verb(method)
+}
+
+func resource(route string) string {
+	for prefix := route; prefix != ""; prefix = prefix[:strings.LastIndex(prefix, "/")] {
+		if r, ok := resources[prefix]; ok {
+			return r
+		}
+	}
+
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	if segments[0] == "" {
+		return Any
+	}
+	return segments[0]
+}
+
+func verb(method string) string {
+	switch method {
+	case http.MethodPost:
+		return VerbCreate
+	case http.MethodPut, http.MethodPatch:
+		return VerbUpdate
+	case http.MethodDelete:
+		return VerbDelete
+	default:
+		return VerbRead
+	}
+}
@@ -0,0 +1,47 @@
+package permission
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequired(t *testing.T) {
+	for _, tc := range []struct {
+		method   string
+		route    string
+		expected string
+	}{
+		{http.MethodGet, "/v1/api/kubes", "kube:read"},
+		{http.MethodPost, "/v1/api/kubes", "kube:create"},
+		{http.MethodDelete, "/v1/api/kubes/{kubeID}", "kube:delete"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/restart", "kube:update"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/releases", "release:install"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/releases/migrate", "release:install"},
+		{http.MethodPost, "/v1/api/replacements/{id}/retire", "replacement:update"},
+		{http.MethodDelete, "/v1/api/replacements/{id}", "replacement:delete"},
+		{http.MethodDelete, "/v1/api/kubes/{kubeID}/releases/{releaseName}", "release:delete"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/users/{uname}/kubeconfig", "kubeconfig:read"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/users/{uname}/kubeconfig", "kubeconfig:create"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/access/{grantID}/kubeconfig", "kubeconfig:read"},
+		{http.MethodDelete, "/v1/api/kubes/{kubeID}/access/{grantID}", "access:delete"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/nodes", "node:create"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/nodes/{nodename}/agentcert", "cert:create"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/nodes/{nodename}/console", "node:console"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/pods/{namespace}/{pod}/exec", "pod:exec"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/consoles/{sessionID}/recording", "console:read"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/exec", "node:exec"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/bench", "node:exec"},
+		{http.MethodGet, "/v1/api/kubes/{kubeID}/certs", "cert:read"},
+		{http.MethodPost, "/v1/api/kubes/{kubeID}/files", "kube:update"},
+		{http.MethodPut, "/v1/api/accounts/{accountName}", "account:update"},
+		{http.MethodPost, "/v1/api/sessions/tokens", "token:create"},
+		{http.MethodGet, "/v1/api/gitops", "gitops:read"},
+		{http.MethodPost, "/v1/api/provision", "kube:create"},
+		{http.MethodGet, "/kubes", "kube:read"},
+		{http.MethodGet, "/v1/api", "*:read"},
+	} {
+		require.Equal(t, tc.expected, Required(tc.method, tc.route), "TC: %s %s", tc.method, tc.route)
+	}
+}
@@ -0,0 +1,93 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+const agentCAName = "supergiant-agent-ca"
+
+// clockSkew is subtracted from the start of validity, so clocks of nodes
+// that are slightly behind accept a fresh certificate.
+const clockSkew = time.Minute
+
+// NewAgentCAPair creates a self-signed CA that issues certificates
+// of node agents and of the control endpoint they connect to.
+func NewAgentCAPair() (*PairPEM, error) {
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "create private key")
+	}
+
+	cert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: agentCAName}, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create self-signed certificate")
+	}
+
+	return Encode(&Pair{
+		Cert: cert,
+		Key:  key,
+	})
+}
+
+// NewShortLivedPair creates a certificate signed by the CA that expires after ttl,
+// unlike certificates of users it is meant to be renewed by its owner.
+func NewShortLivedPair(cfg certutil.Config, ttl time.Duration, caEncoded *PairPEM) (*PairPEM, error) {
+	if cfg.CommonName == "" {
+		return nil, errors.New("common name is empty")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	ca, err := Decode(caEncoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode ca cert/key")
+	}
+
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "create private key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, errors.Wrap(err, "serial number")
+	}
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   cfg.CommonName,
+			Organization: cfg.Organization,
+		},
+		DNSNames:    cfg.AltNames.DNSNames,
+		IPAddresses: cfg.AltNames.IPs,
+		NotBefore:   now.Add(-clockSkew).UTC(),
+		NotAfter:    now.Add(ttl).UTC(),
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: cfg.Usages,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse certificate")
+	}
+
+	return Encode(&Pair{
+		Cert: cert,
+		Key:  key,
+	})
+}
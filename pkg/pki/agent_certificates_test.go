@@ -0,0 +1,67 @@
+package pki
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestNewShortLivedPair(t *testing.T) {
+	ca, err := NewAgentCAPair()
+	require.NoError(t, err)
+
+	caPair, err := Decode(ca)
+	require.NoError(t, err)
+	require.True(t, caPair.Cert.IsCA)
+
+	for _, tc := range []struct {
+		name        string
+		cfg         certutil.Config
+		ttl         time.Duration
+		ca          *PairPEM
+		expectedErr bool
+	}{
+		{
+			name: "client",
+			cfg: certutil.Config{
+				CommonName: "agent:kube:node",
+				Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			},
+			ttl: time.Hour,
+			ca:  ca,
+		},
+		{
+			name:        "no common name",
+			ttl:         time.Hour,
+			ca:          ca,
+			expectedErr: true,
+		},
+		{
+			name:        "no ttl",
+			cfg:         certutil.Config{CommonName: "agent"},
+			ca:          ca,
+			expectedErr: true,
+		},
+		{
+			name:        "no ca",
+			cfg:         certutil.Config{CommonName: "agent"},
+			ttl:         time.Hour,
+			expectedErr: true,
+		},
+	} {
+		pairPEM, err := NewShortLivedPair(tc.cfg, tc.ttl, tc.ca)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		if tc.expectedErr {
+			continue
+		}
+
+		pair, err := Decode(pairPEM)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.cfg.CommonName, pair.Cert.Subject.CommonName, "TC: %s", tc.name)
+		require.WithinDuration(t, time.Now().Add(tc.ttl), pair.Cert.NotAfter, time.Minute, "TC: %s", tc.name)
+		require.NoError(t, pair.Cert.CheckSignatureFrom(caPair.Cert), "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,262 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/asaskevich/govalidator.v8"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/provisioner"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	// DefaultSkew is how far timestamps of signed requests may be from now.
+	DefaultSkew = 5 * time.Minute
+
+	maxWebhookSize = 1 << 20
+)
+
+// Servicer is an interface of the portal service.
+type Servicer interface {
+	CreateClient(ctx context.Context, c *Client) error
+	GetClient(ctx context.Context, id string) (*Client, error)
+	ListClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id string) error
+	FindRequest(ctx context.Context, clientID, externalID string) (*Request, error)
+	Track(ctx context.Context, r *Request) error
+	ListRequests(ctx context.Context) ([]Request, error)
+}
+
+// Handler accepts signed cluster requests of portals and passes them to
+// the provisioning api on behalf of the tenant of the client.
+type Handler struct {
+	svc       Servicer
+	provision http.Handler
+	skew      time.Duration
+	now       func() time.Time
+}
+
+// NewHandler constructs a Handler, verified requests are served by provision.
+func NewHandler(svc Servicer, provision http.Handler) *Handler {
+	return &Handler{
+		svc:       svc,
+		provision: provision,
+		skew:      DefaultSkew,
+		now:       time.Now,
+	}
+}
+
+// Register adds the webhook to a /webhooks router that doesn't require
+// a token, requests are authenticated with their signature.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/provision", h.provisionCluster).Methods(http.MethodPost)
+}
+
+// RegisterConfig adds client management handlers to the api router.
+func (h *Handler) RegisterConfig(r *mux.Router) {
+	r.HandleFunc("/portal/clients", h.createClient).Methods(http.MethodPost)
+	r.HandleFunc("/portal/clients", h.listClients).Methods(http.MethodGet)
+	r.HandleFunc("/portal/clients/{clientID}", h.deleteClient).Methods(http.MethodDelete)
+	r.HandleFunc("/portal/requests", h.listRequests).Methods(http.MethodGet)
+}
+
+// provisionCluster starts provisioning of the requested cluster and answers
+// with 202 and the request its status callbacks refer to, a repeated request
+// with the same external id is answered with the existing one.
+func (h *Handler) provisionCluster(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	c, err := h.svc.GetClient(r.Context(), r.Header.Get(HeaderClient))
+	if err != nil {
+		if !sgerrors.IsNotFound(err) {
+			logrus.Errorf("portal: get client: %v", err)
+			message.SendUnknownError(w, err)
+			return
+		}
+		// unknown clients get the same answer as wrong signatures
+		c = &Client{}
+	}
+	err = Verify(c.Secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, h.now(), h.skew)
+	if err != nil || c.ID == "" {
+		http.Error(w, ErrSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	req := ClusterRequest{}
+	if err = json.Unmarshal(body, &req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if err = req.validate(); err != nil {
+		message.SendValidationFailed(w, errors.Wrap(sgerrors.ErrInvalidJson, err.Error()))
+		return
+	}
+
+	ctx := tenant.WithID(r.Context(), c.TenantID)
+	existing, err := h.svc.FindRequest(ctx, c.ID, req.ExternalID)
+	switch {
+	case err == nil:
+		if err = json.NewEncoder(w).Encode(existing); err != nil {
+			message.SendUnknownError(w, err)
+		}
+		return
+	case !sgerrors.IsNotFound(err):
+		logrus.Errorf("portal: client %s: find request %s: %v", c.ID, req.ExternalID, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	code, resp, err := h.forward(ctx, req.ProvisionRequest)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if code != http.StatusAccepted {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write(resp.Bytes())
+		return
+	}
+
+	accepted := provisioner.ProvisionResponse{}
+	if err = json.Unmarshal(resp.Bytes(), &accepted); err != nil {
+		message.SendUnknownError(w, errors.Wrap(err, "provisioning response"))
+		return
+	}
+
+	tracked := &Request{
+		ClientID:    c.ID,
+		TenantID:    c.TenantID,
+		ExternalID:  req.ExternalID,
+		CallbackURL: req.CallbackURL,
+		ClusterID:   accepted.ClusterID,
+		ClusterName: req.ClusterName,
+	}
+	// the cluster is being provisioned already, a failed request would be
+	// retried by the portal and provision it twice
+	if err = h.svc.Track(ctx, tracked); err != nil {
+		logrus.Errorf("portal: client %s: track cluster %s: %v", c.ID, accepted.ClusterID, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(tracked); err != nil {
+		logrus.Errorf("portal: client %s: write response: %v", c.ID, err)
+	}
+}
+
+// forward passes the request to the provisioning api and returns its response.
+func (h *Handler) forward(ctx context.Context, req provisioner.ProvisionRequest) (int, *bytes.Buffer, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "marshal provision request")
+	}
+	r, err := http.NewRequest(http.MethodPost, "/provision", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "build provision request")
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	rec := &recorder{header: make(http.Header), code: http.StatusOK}
+	h.provision.ServeHTTP(rec, r.WithContext(ctx))
+	return rec.code, &rec.body, nil
+}
+
+// createClient returns a new client with its secret, the secret isn't shown again.
+func (h *Handler) createClient(w http.ResponseWriter, r *http.Request) {
+	c := &Client{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(c); !ok {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	if err := h.svc.CreateClient(r.Context(), c); err != nil {
+		logrus.Errorf("portal: create client: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		logrus.Errorf("portal: create client: write response: %v", err)
+	}
+}
+
+func (h *Handler) listClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.svc.ListClients(r.Context())
+	if err != nil {
+		logrus.Errorf("portal: list clients: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(clients); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["clientID"]
+
+	if err := h.svc.DeleteClient(r.Context(), id); err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, id, err)
+			return
+		}
+		logrus.Errorf("portal: delete client %s: %v", id, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRequests returns clusters requested by portals with their delivery status.
+func (h *Handler) listRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.svc.ListRequests(r.Context())
+	if err != nil {
+		logrus.Errorf("portal: list requests: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(requests); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// recorder keeps a response of the provisioning api.
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.code = code
+}
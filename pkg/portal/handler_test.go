@@ -0,0 +1,189 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/provisioner"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// fakeProvision accepts requests of the acme tenant and counts them.
+type fakeProvision struct {
+	calls []provisioner.ProvisionRequest
+}
+
+func (f *fakeProvision) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if tenant.FromContext(r.Context()) != "acme" {
+		http.Error(w, "wrong tenant", http.StatusForbidden)
+		return
+	}
+	req := provisioner.ProvisionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CloudAccountName == "missing" {
+		http.NotFound(w, r)
+		return
+	}
+	f.calls = append(f.calls, req)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(provisioner.ProvisionResponse{ClusterID: "1234"})
+}
+
+func TestHandler_provisionCluster(t *testing.T) {
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	body := func(externalID, account string) []byte {
+		req := ClusterRequest{
+			ExternalID:  externalID,
+			CallbackURL: "https://portal.example.com/callbacks",
+		}
+		req.ClusterName = "analytics"
+		req.CloudAccountName = account
+		raw, err := json.Marshal(req)
+		require.NoError(t, err)
+		return raw
+	}
+
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{})
+	c := &Client{Name: "servicenow"}
+	require.NoError(t, svc.CreateClient(tenant.WithID(context.Background(), "acme"), c))
+
+	provision := &fakeProvision{}
+	h := NewHandler(svc, provision)
+	h.now = func() time.Time { return now }
+	router := mux.NewRouter()
+	h.Register(router.PathPrefix("/webhooks").Subrouter())
+
+	for _, tc := range []struct {
+		name      string
+		clientID  string
+		secret    string
+		timestamp time.Time
+		body      []byte
+
+		expectedCode  int
+		expectedCalls int
+	}{
+		{
+			name:         "unknown client",
+			clientID:     "unknown",
+			timestamp:    now,
+			body:         body("RITM0010023", "aws"),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "signature",
+			clientID:     c.ID,
+			secret:       "wrong",
+			timestamp:    now,
+			body:         body("RITM0010023", "aws"),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "replayed",
+			clientID:     c.ID,
+			secret:       c.Secret,
+			timestamp:    now.Add(-time.Hour),
+			body:         body("RITM0010023", "aws"),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "invalid",
+			clientID:     c.ID,
+			secret:       c.Secret,
+			timestamp:    now,
+			body:         body("", "aws"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "provisioning error",
+			clientID:     c.ID,
+			secret:       c.Secret,
+			timestamp:    now,
+			body:         body("RITM0010022", "missing"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:          "accepted",
+			clientID:      c.ID,
+			secret:        c.Secret,
+			timestamp:     now,
+			body:          body("RITM0010023", "aws"),
+			expectedCode:  http.StatusAccepted,
+			expectedCalls: 1,
+		},
+		{
+			name:          "repeated",
+			clientID:      c.ID,
+			secret:        c.Secret,
+			timestamp:     now,
+			body:          body("RITM0010023", "aws"),
+			expectedCode:  http.StatusOK,
+			expectedCalls: 1,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/provision", bytes.NewReader(tc.body))
+		req.Header.Set(HeaderClient, tc.clientID)
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(tc.timestamp.Unix(), 10))
+		req.Header.Set(HeaderSignature, Sign(tc.secret, tc.timestamp.Unix(), tc.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		require.Len(t, provision.calls, tc.expectedCalls, "TC: %s", tc.name)
+		if rec.Code >= http.StatusBadRequest {
+			continue
+		}
+
+		tracked := Request{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&tracked), "TC: %s", tc.name)
+		require.Equal(t, "1234", tracked.ClusterID, "TC: %s", tc.name)
+		require.Equal(t, "acme", tracked.TenantID, "TC: %s", tc.name)
+		require.Equal(t, StatusProvisioning, tracked.Status, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_clients(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{})
+	h := NewHandler(svc, &fakeProvision{})
+	router := mux.NewRouter()
+	h.RegisterConfig(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/portal/clients", bytes.NewBufferString(`{}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/portal/clients",
+		bytes.NewBufferString(`{"name":"backstage"}`)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	c := Client{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&c))
+	require.NotEmpty(t, c.Secret)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/portal/clients", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), c.Secret)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/portal/clients/"+c.ID, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/portal/clients/"+c.ID, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
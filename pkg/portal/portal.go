@@ -0,0 +1,136 @@
+package portal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/provisioner"
+)
+
+const (
+	HeaderClient    = "X-Supergiant-Client"
+	HeaderTimestamp = "X-Supergiant-Timestamp"
+	// HeaderSignature is sha256=<hex hmac of "<timestamp>.<body>">, inbound
+	// requests and callbacks are signed with the secret of the client.
+	HeaderSignature = "X-Supergiant-Signature"
+
+	signaturePrefix = "sha256="
+
+	StatusProvisioning = "provisioning"
+	StatusReady        = "ready"
+	StatusFailed       = "failed"
+)
+
+var (
+	ErrSignature = errors.New("request signature is invalid")
+	ErrExpired   = errors.New("request timestamp is out of the allowed skew")
+)
+
+// Client is an external system, e.g. a ServiceNow or Backstage portal,
+// that requests clusters on behalf of the tenant it belongs to.
+type Client struct {
+	ID       string `json:"id"`
+	Name     string `json:"name" valid:"required"`
+	TenantID string `json:"tenantId"`
+	// Secret is returned once when the client is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ClusterRequest is a body of the inbound webhook, ExternalID is an id
+// of the ticket in the portal, repeated requests with it aren't provisioned
+// again.
+type ClusterRequest struct {
+	provisioner.ProvisionRequest
+	ExternalID  string `json:"externalId"`
+	CallbackURL string `json:"callbackUrl"`
+}
+
+func (r ClusterRequest) validate() error {
+	if r.ExternalID == "" {
+		return errors.New("external id is empty")
+	}
+	u, err := url.Parse(r.CallbackURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("callback url %q must be an absolute http(s) url", r.CallbackURL)
+	}
+	return nil
+}
+
+// Request tracks a cluster requested by a client until its final status
+// is delivered to the callback url.
+type Request struct {
+	ID          string `json:"id"`
+	ClientID    string `json:"clientId"`
+	TenantID    string `json:"tenantId"`
+	ExternalID  string `json:"externalId"`
+	CallbackURL string `json:"callbackUrl"`
+	ClusterID   string `json:"clusterId"`
+	ClusterName string `json:"clusterName"`
+	Status      string `json:"status"`
+	Message     string `json:"message,omitempty"`
+	// Notified is the last status delivered to the callback url.
+	Notified  string    `json:"notified,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// done tells whether the final status has been delivered.
+func (r Request) done() bool {
+	return r.Status != StatusProvisioning && r.Notified == r.Status
+}
+
+// KubeConfigInstructions tells the portal how to get a kubeconfig of a ready
+// cluster, the path is relative to the address the webhook has been sent to.
+type KubeConfigInstructions struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+// Callback is posted to the callback url when the status of the cluster changes.
+type Callback struct {
+	ID          string                  `json:"id"`
+	ExternalID  string                  `json:"externalId"`
+	ClusterID   string                  `json:"clusterId"`
+	ClusterName string                  `json:"clusterName"`
+	Status      string                  `json:"status"`
+	Message     string                  `json:"message,omitempty"`
+	KubeConfig  *KubeConfigInstructions `json:"kubeconfig,omitempty"`
+	SentAt      time.Time               `json:"sentAt"`
+}
+
+// Sign returns a signature of the body sent at the timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and that the timestamp is within skew of now,
+// old requests are refused so that captured ones can't be replayed.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time, skew time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrapf(ErrExpired, "timestamp %q", timestamp)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > skew || d < -skew {
+		return ErrExpired
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) ||
+		!hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrSignature
+	}
+	return nil
+}
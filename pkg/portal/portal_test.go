@@ -0,0 +1,105 @@
+package portal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"externalId":"RITM0010023"}`)
+	signed := Sign("secret", now.Unix(), body)
+
+	for _, tc := range []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+
+		expectedErr error
+	}{
+		{
+			name:      "ok",
+			secret:    "secret",
+			timestamp: strconv.FormatInt(now.Unix(), 10),
+			signature: signed,
+			body:      body,
+		},
+		{
+			name:        "timestamp",
+			secret:      "secret",
+			timestamp:   "yesterday",
+			signature:   signed,
+			body:        body,
+			expectedErr: ErrExpired,
+		},
+		{
+			name:        "old",
+			secret:      "secret",
+			timestamp:   strconv.FormatInt(now.Add(-time.Hour).Unix(), 10),
+			signature:   Sign("secret", now.Add(-time.Hour).Unix(), body),
+			body:        body,
+			expectedErr: ErrExpired,
+		},
+		{
+			name:        "secret",
+			secret:      "other",
+			timestamp:   strconv.FormatInt(now.Unix(), 10),
+			signature:   signed,
+			body:        body,
+			expectedErr: ErrSignature,
+		},
+		{
+			name:        "body",
+			secret:      "secret",
+			timestamp:   strconv.FormatInt(now.Unix(), 10),
+			signature:   signed,
+			body:        []byte(`{"externalId":"RITM0010024"}`),
+			expectedErr: ErrSignature,
+		},
+		{
+			name:        "prefix",
+			secret:      "secret",
+			timestamp:   strconv.FormatInt(now.Unix(), 10),
+			signature:   signed[len(signaturePrefix):],
+			body:        body,
+			expectedErr: ErrSignature,
+		},
+	} {
+		err := Verify(tc.secret, tc.timestamp, tc.signature, tc.body, now, DefaultSkew)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s", tc.name)
+	}
+}
+
+func TestClusterRequest_validate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		req   ClusterRequest
+		valid bool
+	}{
+		{
+			name: "external id",
+			req:  ClusterRequest{CallbackURL: "https://portal.example.com/callbacks"},
+		},
+		{
+			name: "relative callback",
+			req:  ClusterRequest{ExternalID: "RITM0010023", CallbackURL: "/callbacks"},
+		},
+		{
+			name: "callback scheme",
+			req:  ClusterRequest{ExternalID: "RITM0010023", CallbackURL: "ftp://portal.example.com/callbacks"},
+		},
+		{
+			name:  "ok",
+			req:   ClusterRequest{ExternalID: "RITM0010023", CallbackURL: "https://portal.example.com/callbacks"},
+			valid: true,
+		},
+	} {
+		require.Equal(t, tc.valid, tc.req.validate() == nil, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,348 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/portal/"
+	DefaultInterval      = time.Minute
+
+	clientsPrefix  = "clients/"
+	requestsPrefix = "requests/"
+
+	secretSize      = 32
+	callbackTimeout = 10 * time.Second
+	// delivery of a status is given up after this many failed callbacks
+	maxCallbackAttempts = 10
+)
+
+type kubeGetter interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+}
+
+// Service keeps portal clients and clusters they've requested, clients
+// are stored regardless of tenant as webhooks are matched before it's known.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	kubes   kubeGetter
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewService constructs a Service, states of requested clusters are got from kubes.
+func NewService(prefix string, s storage.Interface, kubes kubeGetter) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		kubes:   kubes,
+		client: &http.Client{
+			Timeout: callbackTimeout,
+		},
+		now: time.Now,
+	}
+}
+
+// CreateClient stores a new client of the tenant of ctx with a random secret.
+func (s *Service) CreateClient(ctx context.Context, c *Client) error {
+	if c == nil {
+		return errors.Wrap(sgerrors.ErrNilEntity, "client")
+	}
+
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return errors.Wrap(err, "generate secret")
+	}
+
+	c.ID = uuid.New()[:8]
+	c.TenantID = tenant.FromContext(ctx)
+	c.Secret = hex.EncodeToString(secret)
+	c.CreatedAt = s.now()
+	return s.put(ctx, clientsPrefix, c.ID, c)
+}
+
+// GetClient returns a client with its secret.
+func (s *Service) GetClient(ctx context.Context, id string) (*Client, error) {
+	c := &Client{}
+	if err := s.get(ctx, clientsPrefix, id, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListClients returns clients of the tenant of ctx without secrets.
+func (s *Service) ListClients(ctx context.Context) ([]Client, error) {
+	raws, err := s.storage.GetAll(ctx, s.prefix+clientsPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	clients := make([]Client, 0, len(raws))
+	for _, raw := range raws {
+		c := Client{}
+		if err = json.Unmarshal(raw, &c); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		if c.TenantID != tenant.FromContext(ctx) {
+			continue
+		}
+		c.Secret = ""
+		clients = append(clients, c)
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+// DeleteClient removes a client of the tenant of ctx, clusters it has
+// requested are left but their callbacks are no longer sent.
+func (s *Service) DeleteClient(ctx context.Context, id string) error {
+	c, err := s.GetClient(ctx, id)
+	if err != nil {
+		return err
+	}
+	if c.TenantID != tenant.FromContext(ctx) {
+		return errors.Wrapf(sgerrors.ErrNotFound, "client %s", id)
+	}
+
+	if err = s.storage.Delete(ctx, s.prefix+clientsPrefix, id); err != nil {
+		return errors.Wrap(err, "storage: delete")
+	}
+	return nil
+}
+
+// FindRequest returns a request of the client with the external id.
+func (s *Service) FindRequest(ctx context.Context, clientID, externalID string) (*Request, error) {
+	requests, err := s.listRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range requests {
+		if r.ClientID == clientID && r.ExternalID == externalID {
+			return &r, nil
+		}
+	}
+	return nil, errors.Wrapf(sgerrors.ErrNotFound, "request %s", externalID)
+}
+
+// Track stores a request of a cluster that is being provisioned, its
+// status is delivered to the callback url on the next check.
+func (s *Service) Track(ctx context.Context, r *Request) error {
+	r.ID = uuid.New()[:8]
+	r.Status = StatusProvisioning
+	r.CreatedAt = s.now()
+	r.UpdatedAt = r.CreatedAt
+	return s.put(ctx, requestsPrefix, r.ID, r)
+}
+
+// ListRequests returns requests of clients of the tenant of ctx, the latest first.
+func (s *Service) ListRequests(ctx context.Context) ([]Request, error) {
+	requests, err := s.listRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Request, 0, len(requests))
+	for _, r := range requests {
+		if r.TenantID == tenant.FromContext(ctx) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (s *Service) listRequests(ctx context.Context) ([]Request, error) {
+	raws, err := s.storage.GetAll(ctx, s.prefix+requestsPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	requests := make([]Request, 0, len(raws))
+	for _, raw := range raws {
+		r := Request{}
+		if err = json.Unmarshal(raw, &r); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// Run blocks and delivers status changes of requested clusters every
+// interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.notifyAll(ctx)
+		}
+	}
+}
+
+func (s *Service) notifyAll(ctx context.Context) {
+	requests, err := s.listRequests(ctx)
+	if err != nil {
+		logrus.Errorf("portal: list requests: %v", err)
+		return
+	}
+
+	for i := range requests {
+		r := &requests[i]
+		if r.done() {
+			continue
+		}
+		if err = s.notify(ctx, r); err != nil {
+			logrus.Warnf("portal: request %s of cluster %s: %v", r.ID, r.ClusterName, err)
+		}
+	}
+}
+
+// notify refreshes the status of the cluster and posts it to the callback
+// url when it has changed since the last delivery.
+func (s *Service) notify(ctx context.Context, r *Request) error {
+	status, msg := StatusProvisioning, ""
+	k, err := s.kubes.Get(tenant.WithID(ctx, r.TenantID), r.ClusterID)
+	switch {
+	case sgerrors.IsNotFound(err), err == nil && k == nil:
+		status, msg = StatusFailed, "cluster has been deleted"
+	case err != nil:
+		return errors.Wrap(err, "get kube")
+	case k.State == model.StateOperational:
+		status = StatusReady
+	case k.State == model.StateFailed:
+		status, msg = StatusFailed, "provisioning has failed, see tasks of the cluster"
+	}
+
+	if status != r.Status {
+		r.Status, r.Message = status, msg
+		r.Attempts, r.LastError = 0, ""
+	}
+	if r.Notified == r.Status {
+		return nil
+	}
+
+	err = s.callback(ctx, r)
+	if err != nil {
+		r.Attempts++
+		r.LastError = err.Error()
+		// callbacks of deleted clients can't be signed
+		if r.Attempts >= maxCallbackAttempts || sgerrors.IsNotFound(err) {
+			logrus.Errorf("portal: request %s: give up delivering %s status after %d attempts: %v",
+				r.ID, r.Status, r.Attempts, err)
+			r.Notified = r.Status
+		}
+	} else {
+		r.Notified = r.Status
+		r.Attempts, r.LastError = 0, ""
+	}
+	r.UpdatedAt = s.now()
+
+	if putErr := s.put(ctx, requestsPrefix, r.ID, r); putErr != nil {
+		return putErr
+	}
+	return err
+}
+
+// callback posts the status signed with the secret of the client.
+func (s *Service) callback(ctx context.Context, r *Request) error {
+	c, err := s.GetClient(ctx, r.ClientID)
+	if err != nil {
+		return errors.Wrap(err, "get client")
+	}
+
+	cb := Callback{
+		ID:          r.ID,
+		ExternalID:  r.ExternalID,
+		ClusterID:   r.ClusterID,
+		ClusterName: r.ClusterName,
+		Status:      r.Status,
+		Message:     r.Message,
+		SentAt:      s.now(),
+	}
+	if r.Status == StatusReady {
+		cb.KubeConfig = &KubeConfigInstructions{
+			Method: http.MethodGet,
+			Path:   fmt.Sprintf("/v1/api/kubes/%s/users/%s/kubeconfig", r.ClusterID, kube.KubernetesAdminUser),
+			Description: "the kubeconfig of the cluster admin is returned to users of the tenant, " +
+				"POST /v1/api/kubes/" + r.ClusterID + "/access issues one with limited access instead",
+		}
+	}
+
+	body, err := json.Marshal(cb)
+	if err != nil {
+		return errors.Wrap(err, "marshal callback")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "build request")
+	}
+	ts := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderClient, c.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(c.Secret, ts, body))
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "send callback")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("callback responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Service) get(ctx context.Context, prefix, id string, v interface{}) error {
+	raw, err := s.storage.Get(ctx, s.prefix+prefix, id)
+	if err != nil {
+		return errors.Wrap(err, "storage: get")
+	}
+	if raw == nil {
+		return errors.Wrapf(sgerrors.ErrNotFound, "%s", id)
+	}
+	return errors.Wrap(json.Unmarshal(raw, v), "unmarshal")
+}
+
+func (s *Service) put(ctx context.Context, prefix, id string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+	if err = s.storage.Put(ctx, s.prefix+prefix, id, raw); err != nil {
+		return errors.Wrap(err, "storage: put")
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package portal
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type fakeKubes map[string]*model.Kube
+
+func (f fakeKubes) Get(ctx context.Context, kubeID string) (*model.Kube, error) {
+	k, ok := f[tenant.FromContext(ctx)+"/"+kubeID]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	return k, nil
+}
+
+// callbackServer keeps callbacks with valid signatures and answers with the code.
+type callbackServer struct {
+	*httptest.Server
+	code      int
+	callbacks []Callback
+}
+
+func newCallbackServer(t *testing.T, secret string) *callbackServer {
+	s := &callbackServer{code: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, Verify(secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature),
+			body, time.Now(), DefaultSkew))
+
+		cb := Callback{}
+		require.NoError(t, json.Unmarshal(body, &cb))
+		s.callbacks = append(s.callbacks, cb)
+		w.WriteHeader(s.code)
+	}))
+	return s
+}
+
+func TestService_Clients(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{})
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	c := &Client{Name: "servicenow"}
+	require.NoError(t, svc.CreateClient(ctx, c))
+	require.Equal(t, "acme", c.TenantID)
+	require.Len(t, c.Secret, 2*secretSize)
+	require.NoError(t, svc.CreateClient(context.Background(), &Client{Name: "backstage"}))
+
+	clients, err := svc.ListClients(ctx)
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	require.Equal(t, "servicenow", clients[0].Name)
+	require.Empty(t, clients[0].Secret)
+
+	stored, err := svc.GetClient(context.Background(), c.ID)
+	require.NoError(t, err)
+	require.Equal(t, c.Secret, stored.Secret)
+
+	err = svc.DeleteClient(context.Background(), c.ID)
+	require.True(t, sgerrors.IsNotFound(err), "clients of other tenants must not be deleted")
+	require.NoError(t, svc.DeleteClient(ctx, c.ID))
+	_, err = svc.GetClient(ctx, c.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+}
+
+func TestService_notifyAll(t *testing.T) {
+	kubes := fakeKubes{
+		"acme/1234": {ID: "1234", State: model.StateProvisioning},
+	}
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	c := &Client{Name: "servicenow"}
+	require.NoError(t, svc.CreateClient(ctx, c))
+	callbacks := newCallbackServer(t, c.Secret)
+	defer callbacks.Close()
+
+	r := &Request{
+		ClientID:    c.ID,
+		TenantID:    "acme",
+		ExternalID:  "RITM0010023",
+		CallbackURL: callbacks.URL,
+		ClusterID:   "1234",
+		ClusterName: "analytics",
+	}
+	require.NoError(t, svc.Track(ctx, r))
+
+	// the status is delivered once
+	svc.notifyAll(context.Background())
+	svc.notifyAll(context.Background())
+	require.Len(t, callbacks.callbacks, 1)
+	require.Equal(t, StatusProvisioning, callbacks.callbacks[0].Status)
+	require.Equal(t, "RITM0010023", callbacks.callbacks[0].ExternalID)
+	require.Nil(t, callbacks.callbacks[0].KubeConfig)
+
+	// failed deliveries are retried
+	kubes["acme/1234"].State = model.StateOperational
+	callbacks.code = http.StatusServiceUnavailable
+	svc.notifyAll(context.Background())
+	requests, err := svc.ListRequests(ctx)
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, requests[0].Status)
+	require.Equal(t, StatusProvisioning, requests[0].Notified)
+	require.Equal(t, 1, requests[0].Attempts)
+	require.NotEmpty(t, requests[0].LastError)
+
+	callbacks.code = http.StatusOK
+	svc.notifyAll(context.Background())
+	svc.notifyAll(context.Background())
+	require.Len(t, callbacks.callbacks, 3)
+	ready := callbacks.callbacks[2]
+	require.Equal(t, StatusReady, ready.Status)
+	require.NotNil(t, ready.KubeConfig)
+	require.Equal(t, "/v1/api/kubes/1234/users/kubernetes-admin/kubeconfig", ready.KubeConfig.Path)
+
+	requests, err = svc.ListRequests(ctx)
+	require.NoError(t, err)
+	require.True(t, requests[0].done())
+	require.Zero(t, requests[0].Attempts)
+
+	other, err := svc.ListRequests(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, other)
+}
+
+func TestService_notifyGivesUp(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), fakeKubes{})
+
+	c := &Client{Name: "backstage"}
+	require.NoError(t, svc.CreateClient(context.Background(), c))
+	callbacks := newCallbackServer(t, c.Secret)
+	callbacks.code = http.StatusInternalServerError
+	defer callbacks.Close()
+
+	r := &Request{
+		ClientID:    c.ID,
+		ExternalID:  "42",
+		CallbackURL: callbacks.URL,
+		ClusterID:   "deleted",
+	}
+	require.NoError(t, svc.Track(context.Background(), r))
+
+	for i := 0; i < maxCallbackAttempts+2; i++ {
+		svc.notifyAll(context.Background())
+	}
+	require.Len(t, callbacks.callbacks, maxCallbackAttempts)
+	require.Equal(t, StatusFailed, callbacks.callbacks[0].Status)
+	require.Equal(t, "cluster has been deleted", callbacks.callbacks[0].Message)
+
+	requests, err := svc.ListRequests(context.Background())
+	require.NoError(t, err)
+	require.True(t, requests[0].done())
+	require.NotEmpty(t, requests[0].LastError)
+}
@@ -63,6 +63,10 @@ func (h *Handler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := profile.Kubelet.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err := h.service.Create(r.Context(), profile); err != nil {
 		logrus.Error(err)
@@ -1,6 +1,20 @@
 package profile
 
-import "github.com/supergiant/control/pkg/clouds"
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+var (
+	// kubelet settings are put into a shell script as they are
+	evictionThresholdRe = regexp.MustCompile(`^[a-z.]+<[0-9.]+(%|[A-Za-z]+)?$`)
+	reservedResourceRe  = regexp.MustCompile(`^[a-z0-9./-]+=[0-9.]+[A-Za-z]*$`)
+)
 
 type Profile struct {
 	ID string `json:"id" valid:"required"`
@@ -40,9 +54,155 @@ type Profile struct {
 	CloudSpecificSettings  CloudSpecificSettings `json:"cloudSpecificSettings" valid:"-"`
 	PublicKey              string                `json:"publicKey" valid:"-"`
 	LogBootstrapPrivateKey bool                  `json:"logBootstrapPrivateKey" valid:"-"`
+
+	// Kubelet holds kubelet tuning parameters, they can be changed after
+	// cluster has been provisioned and applied to existing nodes.
+	Kubelet KubeletSettings `json:"kubelet" valid:"-"`
+
+	// GitOps bootstraps Argo CD or Flux once the cluster is up.
+	GitOps GitOpsSettings `json:"gitops" valid:"-"`
+
+	// DNS keeps a stable name of the api endpoint in a zone of the cloud.
+	DNS DNSSettings `json:"dns" valid:"-"`
+
+	// Egress gives the cluster stable egress addresses behind a nat gateway.
+	Egress EgressSettings `json:"egress" valid:"-"`
+
+	// APIServerAllowedCIDRs limits clients of the api server, an empty list
+	// keeps the default exposure of the cloud.
+	APIServerAllowedCIDRs []string `json:"apiServerAllowedCidrs" valid:"-"`
+
+	// Dashboard installs a cluster dashboard that is served through control.
+	Dashboard DashboardSettings `json:"dashboard" valid:"-"`
+
+	// VolumeSnapshots installs the csi snapshot crds and the snapshot controller.
+	VolumeSnapshots bool `json:"volumeSnapshots" valid:"-"`
+
+	// Cost attributes spending of the cluster to a cost center.
+	Cost CostSettings `json:"cost" valid:"-"`
+
+	// Hardening tightens security defaults of machines, it's supported by aws.
+	Hardening HardeningSettings `json:"hardening" valid:"-"`
+
+	// SpreadMasters places masters on distinct hardware, so a single host
+	// or rack failure doesn't take down the control plane.
+	SpreadMasters bool `json:"spreadMasters" valid:"-"`
 }
 
 type NodeProfile map[string]string
+
+// KubeletSettings represents kubelet parameters that affect node capacity.
+// https://kubernetes.io/docs/tasks/administer-cluster/reserve-compute-resources/
+type KubeletSettings struct {
+	MaxPods int `json:"maxPods"`
+	// Comma separated list of eviction thresholds, e.g. memory.available<100Mi
+	EvictionHard string `json:"evictionHard"`
+	// Comma separated list of resources, e.g. cpu=100m,memory=256Mi
+	KubeReserved   string `json:"kubeReserved"`
+	SystemReserved string `json:"systemReserved"`
+}
+
+// Validate checks that settings are lists of thresholds and resources.
+func (s KubeletSettings) Validate() error {
+	if s.MaxPods < 0 {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid max pods %d", s.MaxPods)
+	}
+	if err := validateList("eviction hard", s.EvictionHard, evictionThresholdRe); err != nil {
+		return err
+	}
+	if err := validateList("kube reserved", s.KubeReserved, reservedResourceRe); err != nil {
+		return err
+	}
+	return validateList("system reserved", s.SystemReserved, reservedResourceRe)
+}
+
+func validateList(name, list string, re *regexp.Regexp) error {
+	if list == "" {
+		return nil
+	}
+	for _, item := range strings.Split(list, ",") {
+		if !re.MatchString(item) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid %s %q", name, item)
+		}
+	}
+	return nil
+}
+
+// GitOpsSettings describes a GitOps tool and a repository it should track,
+// application delivery is handed off to the tool after provisioning.
+type GitOpsSettings struct {
+	// Tool is either argocd or flux, nothing is installed when it's empty
+	Tool    string `json:"tool"`
+	RepoURL string `json:"repoUrl"`
+	Branch  string `json:"branch"`
+	// Path is a directory inside the repository with manifests
+	Path string `json:"path"`
+	// Credentials for private https repositories
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DNSSettings describes a zone the api endpoint records of clusters are kept in,
+// the record of a cluster is <cluster name>.<domain>.
+type DNSSettings struct {
+	// Domain of the zone, no records are created when it's empty
+	Domain string `json:"domain"`
+	// ZoneID is an id of the route53 hosted zone, a name of the cloud dns
+	// managed zone or a resource group of the azure dns zone
+	ZoneID string `json:"zoneId"`
+	TTL    int64  `json:"ttl"`
+}
+
+// EgressSettings routes traffic of the cluster to the destinations through a nat
+// gateway, external systems allow its addresses instead of addresses of machines.
+type EgressSettings struct {
+	Enabled bool `json:"enabled"`
+	// Destinations are cidrs of external systems, machines have public
+	// addresses and reach the rest of the internet with them
+	Destinations []string `json:"destinations"`
+}
+
+// DashboardSettings describes a dashboard of the cluster, it isn't exposed
+// outside of the cluster and users reach it with their control sessions.
+type DashboardSettings struct {
+	// Tool is either kubernetes-dashboard or headlamp, nothing is installed when it's empty
+	Tool string `json:"tool"`
+	// ClusterRole is bound to the service account of the dashboard, view by default
+	ClusterRole string `json:"clusterRole"`
+}
+
+// CostSettings are tags applied to cloud resources of the cluster and a budget
+// of them, budgets are created only for azure clusters.
+type CostSettings struct {
+	// Tags are e.g. costCenter=analytics, they are merged with tags of the cluster
+	Tags   map[string]string `json:"tags"`
+	Budget BudgetSettings    `json:"budget"`
+}
+
+// BudgetSettings describe a monthly budget scoped to the resource group of
+// the cluster, no budget is created when the amount is zero.
+type BudgetSettings struct {
+	// Amount is in the billing currency of the subscription
+	Amount float64 `json:"amount"`
+	// Thresholds are percents of the amount actual cost alerts are sent at
+	Thresholds []float64 `json:"thresholds"`
+	// ContactEmails receive alerts, owners of the resource group do when it's empty
+	ContactEmails []string `json:"contactEmails"`
+}
+
+// HardeningSettings are applied to machines when they are created, existing
+// machines are reported by the compliance check.
+type HardeningSettings struct {
+	// MetadataTokensRequired enforces IMDSv2, instance metadata is served
+	// to session token holders only and isn't reachable from pod networks.
+	MetadataTokensRequired bool `json:"metadataTokensRequired"`
+	// EncryptVolumes encrypts root volumes with the default kms key of ebs.
+	EncryptVolumes bool `json:"encryptVolumes"`
+	// RestrictedInstanceProfiles gives nodes a profile that can only describe
+	// instances, images of private registries need pull secrets then.
+	RestrictedInstanceProfiles bool `json:"restrictedInstanceProfiles"`
+}
+
 type CloudSpecificSettings map[string]string
 
 // StaticAuth represents tokens and basic authentication credentials.
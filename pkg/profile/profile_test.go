@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestKubeletSettings_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		settings    KubeletSettings
+		expectedErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "valid",
+			settings: KubeletSettings{
+				MaxPods:        110,
+				EvictionHard:   "memory.available<100Mi,nodefs.available<10%",
+				KubeReserved:   "cpu=100m,memory=256Mi,ephemeral-storage=1Gi",
+				SystemReserved: "cpu=0.5,memory=512Mi",
+			},
+		},
+		{
+			name:        "negative max pods",
+			settings:    KubeletSettings{MaxPods: -1},
+			expectedErr: true,
+		},
+		{
+			name:        "eviction with quotes",
+			settings:    KubeletSettings{EvictionHard: `memory.available<100Mi" && reboot "`},
+			expectedErr: true,
+		},
+		{
+			name:        "eviction with command substitution",
+			settings:    KubeletSettings{EvictionHard: "memory.available<$(reboot)"},
+			expectedErr: true,
+		},
+		{
+			name:        "kube reserved with newline",
+			settings:    KubeletSettings{KubeReserved: "cpu=100m\nEOF\nreboot"},
+			expectedErr: true,
+		},
+		{
+			name:        "system reserved with empty item",
+			settings:    KubeletSettings{SystemReserved: "cpu=100m,,memory=1Gi"},
+			expectedErr: true,
+		},
+		{
+			name:        "system reserved with backtick",
+			settings:    KubeletSettings{SystemReserved: "memory=1Gi`reboot`"},
+			expectedErr: true,
+		},
+	} {
+		err := tc.settings.Validate()
+		if tc.expectedErr {
+			require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err), "TC: %s", tc.name)
+			continue
+		}
+		require.NoError(t, err, "TC: %s", tc.name)
+	}
+}
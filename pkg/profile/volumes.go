@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Keys of node profiles that describe disks of machines.
+const (
+	// VolumeSizeKey is a size of the root volume in gigabytes.
+	VolumeSizeKey = "volumeSize"
+	// VolumeTypeKey is a cloud specific type of the root volume, e.g. gp3 or pd-ssd.
+	VolumeTypeKey = "volumeType"
+	// DataVolumesKey is a comma separated list of size:type:mountPoint
+	// entries, e.g. 100:gp3:/var/lib/docker,500::/data.
+	DataVolumesKey = "dataVolumes"
+)
+
+// DataVolume is a volume attached to a machine in addition to the root one,
+// it's formatted and mounted when the machine is bootstrapped.
+type DataVolume struct {
+	SizeGB int64 `json:"sizeGb"`
+	// Type is empty for the default type of the cloud
+	Type       string `json:"type"`
+	MountPoint string `json:"mountPoint"`
+}
+
+// ParseDataVolumes parses the value of the data volumes key of a node profile.
+func ParseDataVolumes(spec string) ([]DataVolume, error) {
+	volumes := make([]DataVolume, 0)
+	if strings.TrimSpace(spec) == "" {
+		return volumes, nil
+	}
+
+	mountPoints := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			return nil, errors.Errorf("data volume %q must be size:type:mountPoint", entry)
+		}
+
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || size <= 0 {
+			return nil, errors.Errorf("size of data volume %q must be a positive number of gigabytes", entry)
+		}
+
+		mountPoint := parts[2]
+		if !path.IsAbs(mountPoint) || path.Clean(mountPoint) == "/" {
+			return nil, errors.Errorf("mount point of data volume %q must be an absolute path", entry)
+		}
+		mountPoint = path.Clean(mountPoint)
+		if mountPoints[mountPoint] {
+			return nil, errors.Errorf("mount point %s is used by several data volumes", mountPoint)
+		}
+		mountPoints[mountPoint] = true
+
+		volumes = append(volumes, DataVolume{
+			SizeGB:     size,
+			Type:       parts[1],
+			MountPoint: mountPoint,
+		})
+	}
+
+	return volumes, nil
+}
@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDataVolumes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec string
+
+		expected []DataVolume
+		hasErr   bool
+	}{
+		{
+			name:     "empty",
+			expected: []DataVolume{},
+		},
+		{
+			name: "volumes",
+			spec: "100:gp3:/var/lib/docker/, 500::/data",
+			expected: []DataVolume{
+				{SizeGB: 100, Type: "gp3", MountPoint: "/var/lib/docker"},
+				{SizeGB: 500, MountPoint: "/data"},
+			},
+		},
+		{
+			name:   "missing mount point",
+			spec:   "100:gp3",
+			hasErr: true,
+		},
+		{
+			name:   "wrong size",
+			spec:   "0::/data",
+			hasErr: true,
+		},
+		{
+			name:   "relative mount point",
+			spec:   "10::data",
+			hasErr: true,
+		},
+		{
+			name:   "root mount point",
+			spec:   "10::/",
+			hasErr: true,
+		},
+		{
+			name:   "duplicated mount point",
+			spec:   "10::/data,20::/data/",
+			hasErr: true,
+		},
+	} {
+		volumes, err := ParseDataVolumes(tc.spec)
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.expected, volumes, "TC: %s", tc.name)
+	}
+}
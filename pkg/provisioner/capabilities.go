@@ -0,0 +1,59 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps/provider"
+)
+
+// ProviderCapabilities is a row of the capability matrix, Enabled is false
+// for providers that can't be provisioned or are gated by a feature flag.
+type ProviderCapabilities struct {
+	provider.Capabilities
+	Enabled bool `json:"enabled"`
+}
+
+// ListProviders returns capabilities of all providers.
+func (h *Handler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	matrix := make([]ProviderCapabilities, 0, len(provider.Providers))
+	for _, name := range provider.Providers {
+		matrix = append(matrix, h.capabilities(r.Context(), name))
+	}
+
+	if err := json.NewEncoder(w).Encode(matrix); err != nil {
+		logrus.Errorf("list providers: write response: %v", err)
+	}
+}
+
+// GetProvider returns capabilities of the provider.
+func (h *Handler) GetProvider(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+
+	for _, p := range provider.Providers {
+		if string(p) != name {
+			continue
+		}
+		if err := json.NewEncoder(w).Encode(h.capabilities(r.Context(), p)); err != nil {
+			logrus.Errorf("get provider %s: write response: %v", name, err)
+		}
+		return
+	}
+
+	message.SendNotFound(w, name, sgerrors.ErrNotFound)
+}
+
+func (h *Handler) capabilities(ctx context.Context, name clouds.Name) ProviderCapabilities {
+	c := provider.CapabilitiesFor(name)
+	return ProviderCapabilities{
+		Capabilities: c,
+		Enabled:      c.Provisioning && h.providerEnabled(ctx, name),
+	}
+}
@@ -0,0 +1,129 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/workflows/steps/provider"
+)
+
+func TestHandler_ListProviders(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		features fakeFeatures
+		enabled  map[clouds.Name]bool
+	}{
+		{
+			name:     "azure is gated",
+			features: fakeFeatures{},
+			enabled: map[clouds.Name]bool{
+				clouds.AWS:          true,
+				clouds.Azure:        false,
+				clouds.DigitalOcean: true,
+				clouds.GCE:          true,
+				clouds.OpenStack:    false,
+				clouds.Packet:       false,
+			},
+		},
+		{
+			name:     "azure is enabled",
+			features: fakeFeatures{featureflag.ProviderAzure: true},
+			enabled: map[clouds.Name]bool{
+				clouds.AWS:          true,
+				clouds.Azure:        true,
+				clouds.DigitalOcean: true,
+				clouds.GCE:          true,
+				clouds.OpenStack:    false,
+				clouds.Packet:       false,
+			},
+		},
+	} {
+		router := mux.NewRouter()
+		(&Handler{features: tc.features}).Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/providers", nil))
+		require.Equal(t, http.StatusOK, rec.Code, "TC: %s", tc.name)
+
+		matrix := make([]ProviderCapabilities, 0)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&matrix), "TC: %s", tc.name)
+		require.Len(t, matrix, len(provider.Providers), "TC: %s", tc.name)
+		for _, c := range matrix {
+			require.Equal(t, tc.enabled[c.Provider], c.Enabled, "TC: %s: %s", tc.name, c.Provider)
+		}
+	}
+}
+
+func TestHandler_GetProvider(t *testing.T) {
+	router := mux.NewRouter()
+	(&Handler{features: fakeFeatures{}}).Register(router)
+
+	for _, tc := range []struct {
+		provider     string
+		expectedCode int
+		check        func(*testing.T, ProviderCapabilities)
+	}{
+		{
+			provider:     "vsphere",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			provider:     "aws",
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, c ProviderCapabilities) {
+				require.True(t, c.Enabled)
+				require.True(t, c.HAMasters)
+				require.True(t, c.Firewall)
+				require.True(t, c.Egress)
+				require.True(t, c.Peering)
+				require.True(t, c.Stacks)
+				require.False(t, c.Budgets)
+				require.True(t, c.Hardening)
+				require.True(t, c.DataVolumes)
+				require.True(t, c.SpreadMasters)
+			},
+		},
+		{
+			provider:     "digitalocean",
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, c ProviderCapabilities) {
+				require.True(t, c.Provisioning)
+				require.False(t, c.Firewall)
+				require.False(t, c.Egress)
+				require.False(t, c.Peering)
+				require.False(t, c.Stacks)
+				require.False(t, c.Budgets)
+				require.False(t, c.Hardening)
+				require.False(t, c.DataVolumes)
+				require.False(t, c.SpreadMasters)
+			},
+		},
+		{
+			provider:     "packet",
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, c ProviderCapabilities) {
+				require.False(t, c.Provisioning)
+				require.False(t, c.Enabled)
+			},
+		},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/providers/"+tc.provider, nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.provider)
+		if tc.check == nil {
+			continue
+		}
+
+		c := ProviderCapabilities{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&c), "TC: %s", tc.provider)
+		require.Equal(t, clouds.Name(tc.provider), c.Provider)
+		tc.check(t, c)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pborman/uuid"
@@ -13,11 +14,16 @@ import (
 	"gopkg.in/asaskevich/govalidator.v8"
 
 	"github.com/supergiant/control/pkg/account"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/ipam"
 	"github.com/supergiant/control/pkg/message"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/versions"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
@@ -32,17 +38,50 @@ type AccountGetter interface {
 
 type KubeGetter interface {
 	Get(ctx context.Context, name string) (*model.Kube, error)
+	ListAll(ctx context.Context) ([]model.Kube, error)
 }
 
 type ProfileCreater interface {
 	Create(context.Context, *profile.Profile) error
 }
 
+type ProfileService interface {
+	ProfileCreater
+	Get(context.Context, string) (*profile.Profile, error)
+}
+
+// FeatureGate tells whether an experimental capability is enabled.
+type FeatureGate interface {
+	Enabled(ctx context.Context, name string) bool
+}
+
+// NetworkAllocator assigns network ranges that don't overlap with ranges of other clusters.
+type NetworkAllocator interface {
+	Allocate(ctx context.Context, a *ipam.Allocation, vpc bool) error
+	Release(ctx context.Context, clusterName string) error
+}
+
+// VersionCatalog lists kubernetes versions clusters may be provisioned with.
+type VersionCatalog interface {
+	Catalog(ctx context.Context) (*versions.Catalog, error)
+}
+
 type Handler struct {
 	accountGetter  AccountGetter
-	profileService ProfileCreater
+	profileService ProfileService
 	kubeGetter     KubeGetter
 	provisioner    ClusterProvisioner
+	features       FeatureGate
+	// empty network ranges of new clusters are assigned when it is set
+	ipam NetworkAllocator
+	// versions of new clusters are checked against the catalog when it is set
+	versions VersionCatalog
+	// sshAgentSocket is a path to the ssh-agent imported machines are
+	// reached with, their private key is optional when it is set
+	sshAgentSocket string
+
+	validator util.CloudAccountValidator
+	quota     util.QuotaChecker
 }
 
 type ProvisionRequest struct {
@@ -58,22 +97,48 @@ type ProvisionResponse struct {
 
 type ClusterProvisioner interface {
 	ProvisionCluster(context.Context, *profile.Profile, *steps.Config) (map[string][]*workflows.Task, error)
+	ImportCluster(context.Context, *profile.Profile, *steps.Config, []model.Machine) (map[string][]*workflows.Task, error)
 }
 
 func NewHandler(kubeService KubeGetter,
 	cloudAccountService *account.Service,
-	profileSvc ProfileCreater,
-	provisioner ClusterProvisioner) *Handler {
+	profileSvc ProfileService,
+	provisioner ClusterProvisioner,
+	features FeatureGate) *Handler {
 	return &Handler{
 		kubeGetter:     kubeService,
 		profileService: profileSvc,
 		accountGetter:  cloudAccountService,
 		provisioner:    provisioner,
+		features:       features,
+		validator:      util.NewCloudAccountValidator(),
+		quota:          util.NewCloudQuotaChecker(),
 	}
 }
 
+// UseIPAM makes the handler assign network ranges to new clusters.
+func (h *Handler) UseIPAM(allocator NetworkAllocator) {
+	h.ipam = allocator
+}
+
+// UseVersions makes the handler check versions of new clusters against the catalog.
+func (h *Handler) UseVersions(catalog VersionCatalog) {
+	h.versions = catalog
+}
+
+// UseSSHAgent makes the handler reach imported machines with keys of the ssh-agent.
+func (h *Handler) UseSSHAgent(socket string) {
+	h.sshAgentSocket = socket
+}
+
 func (h *Handler) Register(m *mux.Router) {
 	m.HandleFunc("/provision", h.Provision).Methods(http.MethodPost)
+	m.HandleFunc("/kubes/validate", h.Validate).Methods(http.MethodPost)
+	m.HandleFunc("/kubes/import", h.Import).Methods(http.MethodPost)
+	m.HandleFunc("/kubes/spec", h.CreateFromSpec).Methods(http.MethodPost)
+	m.HandleFunc("/kubes/{kubeID}/spec", h.ExportSpec).Methods(http.MethodGet)
+	m.HandleFunc("/providers", h.ListProviders).Methods(http.MethodGet)
+	m.HandleFunc("/providers/{provider}", h.GetProvider).Methods(http.MethodGet)
 }
 
 // TODO(stgleb): Move this to KubeHandler create kube
@@ -87,12 +152,45 @@ func (h *Handler) Provision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.provision(w, r, req)
+}
+
+// provision validates the request and starts provisioning of the cluster.
+func (h *Handler) provision(w http.ResponseWriter, r *http.Request, req *ProvisionRequest) {
 	ok, err := govalidator.ValidateStruct(req)
 	if !ok {
 		logrus.Errorf("Validation error %v", err.Error())
 		message.SendValidationFailed(w, err)
 		return
 	}
+	if err = req.Profile.Kubelet.Validate(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	if !h.providerEnabled(r.Context(), req.Profile.Provider) {
+		http.Error(w, fmt.Sprintf("provider %s is not enabled", req.Profile.Provider), http.StatusForbidden)
+		return
+	}
+
+	report := &ValidationReport{Valid: true}
+	h.validateVersion(r.Context(), req, report)
+	if !report.Valid {
+		message.SendValidationFailed(w, errors.New(report.Findings[0].Message))
+		return
+	}
+
+	if h.ipamEnabled(r.Context()) {
+		if err = h.allocateRanges(r.Context(), req); err != nil {
+			if errors.Cause(err) == ipam.ErrOverlap {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			logrus.Error(errors.Wrap(err, "allocate network ranges"))
+			message.SendUnknownError(w, err)
+			return
+		}
+	}
 
 	if req.Profile.K8SServicesCIDR == "" {
 		req.Profile.K8SServicesCIDR = DefaultK8SServicesCIDR
@@ -138,10 +236,14 @@ func (h *Handler) Provision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), config.Timeout)
+	// provisioning outlives the request
+	ctx, cancel := context.WithTimeout(tenant.Detach(r.Context()), config.Timeout)
+	time.AfterFunc(config.Timeout, cancel)
 	taskMap, err := h.provisioner.ProvisionCluster(ctx, &req.Profile, config)
 
 	if err != nil {
+		cancel()
+		h.releaseRanges(r.Context(), req.ClusterName)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		logrus.Error(errors.Wrap(err, "provisionCluster"))
 		return
@@ -167,12 +269,72 @@ func (h *Handler) Provision(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond to client side that request has been accepted
-	w.WriteHeader(http.StatusAccepted)
+	sendAccepted(w, &resp)
+}
 
-	err = json.NewEncoder(w).Encode(&resp)
+// sendAccepted points the client to the status of the cluster task, the rest
+// of provisioning tasks are its sub-tasks.
+func sendAccepted(w http.ResponseWriter, resp *ProvisionResponse) {
+	if ids := resp.Tasks[workflows.ClusterTask]; len(ids) > 0 {
+		workflows.SendAccepted(w, ids[0], resp)
+		return
+	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		logrus.Error(errors.Wrap(err, "marshal json"))
 	}
 }
+
+// allocateRanges fills empty network ranges of the profile, a range is
+// allocated for the vpc only when the cluster doesn't use an existing one.
+func (h *Handler) allocateRanges(ctx context.Context, req *ProvisionRequest) error {
+	p := &req.Profile
+	if p.CloudSpecificSettings == nil {
+		p.CloudSpecificSettings = make(map[string]string)
+	}
+
+	a := &ipam.Allocation{
+		ClusterName: req.ClusterName,
+		Pods:        p.CIDR,
+		Services:    p.K8SServicesCIDR,
+		VPC:         p.CloudSpecificSettings[clouds.AwsVpcCIDR],
+	}
+	vpc := p.Provider == clouds.AWS && p.CloudSpecificSettings[clouds.AwsVpcID] == ""
+	if err := h.ipam.Allocate(ctx, a, vpc); err != nil {
+		return err
+	}
+
+	p.CIDR = a.Pods
+	p.K8SServicesCIDR = a.Services
+	if vpc {
+		p.CloudSpecificSettings[clouds.AwsVpcCIDR] = a.VPC
+	}
+
+	return nil
+}
+
+func (h *Handler) releaseRanges(ctx context.Context, clusterName string) {
+	if !h.ipamEnabled(ctx) {
+		return
+	}
+	if err := h.ipam.Release(ctx, clusterName); err != nil {
+		logrus.Errorf("release network ranges of %s: %v", clusterName, err)
+	}
+}
+
+// ipamEnabled reports whether network ranges of the tenant are managed by ipam.
+func (h *Handler) ipamEnabled(ctx context.Context) bool {
+	return h.ipam != nil && h.features != nil && h.features.Enabled(ctx, featureflag.IPAM)
+}
+
+// providerEnabled reports whether clusters can be provisioned on the provider,
+// experimental providers are available only when their feature flag is on.
+func (h *Handler) providerEnabled(ctx context.Context, provider clouds.Name) bool {
+	name, gated := featureflag.ProviderFlag(provider)
+	if !gated {
+		return true
+	}
+
+	return h.features != nil && h.features.Enabled(ctx, name)
+}
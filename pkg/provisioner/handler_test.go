@@ -12,18 +12,23 @@ import (
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/supergiant/control/pkg/account"
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/ipam"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/versions"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
 type mockProvisioner struct {
 	provisionCluster func(context.Context, *profile.Profile, *steps.Config) (map[string][]*workflows.Task, error)
+	importCluster    func(context.Context, *profile.Profile, *steps.Config, []model.Machine) (map[string][]*workflows.Task, error)
 	provisionNode    func(context.Context, profile.NodeProfile, *model.Kube, *steps.Config) (*workflows.Task, error)
 }
 
@@ -31,6 +36,10 @@ func (m *mockProvisioner) ProvisionCluster(ctx context.Context, kubeProfile *pro
 	return m.provisionCluster(ctx, kubeProfile, config)
 }
 
+func (m *mockProvisioner) ImportCluster(ctx context.Context, kubeProfile *profile.Profile, config *steps.Config, machines []model.Machine) (map[string][]*workflows.Task, error) {
+	return m.importCluster(ctx, kubeProfile, config, machines)
+}
+
 func (m *mockProvisioner) ProvisionNode(ctx context.Context, nodeProfile profile.NodeProfile, kube *model.Kube, config *steps.Config) (*workflows.Task, error) {
 	return m.provisionNode(ctx, nodeProfile, kube, config)
 }
@@ -44,13 +53,18 @@ func (m *mockAccountGetter) Get(ctx context.Context, id string) (*model.CloudAcc
 }
 
 type mockKubeGetter struct {
-	get func(context.Context, string) (*model.Kube, error)
+	get     func(context.Context, string) (*model.Kube, error)
+	listAll func(context.Context) ([]model.Kube, error)
 }
 
 func (m *mockKubeGetter) Get(ctx context.Context, name string) (*model.Kube, error) {
 	return m.get(ctx, name)
 }
 
+func (m *mockKubeGetter) ListAll(ctx context.Context) ([]model.Kube, error) {
+	return m.listAll(ctx)
+}
+
 type mockProfileCreator struct {
 	mock.Mock
 }
@@ -60,6 +74,15 @@ func (m *mockProfileCreator) Create(ctx context.Context, p *profile.Profile) err
 	return args.Error(0)
 }
 
+func (m *mockProfileCreator) Get(ctx context.Context, id string) (*profile.Profile, error) {
+	args := m.Called(ctx, id)
+	val, ok := args.Get(0).(*profile.Profile)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return val, args.Error(1)
+}
+
 func TestProvisionBadClusterName(t *testing.T) {
 	testCases := []string{"non_Valid`", "_@badClusterName"}
 
@@ -82,6 +105,42 @@ func TestProvisionBadClusterName(t *testing.T) {
 	}
 }
 
+func TestProvisionDisabledProvider(t *testing.T) {
+	provisionRequest := validRequest()
+	provisionRequest.Profile.Provider = clouds.Azure
+
+	bodyBytes, _ := json.Marshal(&provisionRequest)
+	req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyBytes))
+	rec := httptest.NewRecorder()
+
+	handler := Handler{
+		features: fakeFeatures{},
+	}
+	handler.Provision(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Wrong status code expected %d actual %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestProvisionEOLVersion(t *testing.T) {
+	provisionRequest := validRequest()
+
+	bodyBytes, _ := json.Marshal(&provisionRequest)
+	req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyBytes))
+	rec := httptest.NewRecorder()
+
+	handler := Handler{
+		features: fakeFeatures{},
+		versions: &fakeCatalog{catalog: versions.DefaultCatalog()},
+	}
+	handler.Provision(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Wrong status code expected %d actual %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
 func TestProvisionHandler(t *testing.T) {
 	p := &ProvisionRequest{
 		"test",
@@ -222,11 +281,125 @@ func TestProvisionHandler(t *testing.T) {
 	}
 }
 
+type fakeAllocator struct {
+	err      error
+	vpc      bool
+	released string
+}
+
+func (f *fakeAllocator) Allocate(ctx context.Context, a *ipam.Allocation, vpc bool) error {
+	f.vpc = vpc
+	if a.Pods == "" {
+		a.Pods = "10.1.0.0/16"
+	}
+	a.Services = "10.129.0.0/16"
+	a.VPC = "172.17.0.0/16"
+	return f.err
+}
+
+func (f *fakeAllocator) Release(ctx context.Context, clusterName string) error {
+	f.released = clusterName
+	return nil
+}
+
+func TestProvisionIPAM(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		features     fakeFeatures
+		provider     clouds.Name
+		allocateErr  error
+		provisionErr error
+
+		expectedCode     int
+		expectedServices string
+		expectedVPC      string
+		expectedReleased bool
+	}{
+		{
+			name:             "disabled",
+			provider:         clouds.AWS,
+			expectedCode:     http.StatusAccepted,
+			expectedServices: DefaultK8SServicesCIDR,
+		},
+		{
+			name:         "overlap",
+			features:     fakeFeatures{featureflag.IPAM: true},
+			provider:     clouds.AWS,
+			allocateErr:  errors.Wrap(ipam.ErrOverlap, "10.0.0.0/16"),
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:             "provision error",
+			features:         fakeFeatures{featureflag.IPAM: true},
+			provider:         clouds.AWS,
+			provisionErr:     sgerrors.ErrInvalidCredentials,
+			expectedCode:     http.StatusInternalServerError,
+			expectedReleased: true,
+		},
+		{
+			name:             "aws",
+			features:         fakeFeatures{featureflag.IPAM: true},
+			provider:         clouds.AWS,
+			expectedCode:     http.StatusAccepted,
+			expectedServices: "10.129.0.0/16",
+			expectedVPC:      "172.17.0.0/16",
+		},
+		{
+			name:             "digitalocean",
+			features:         fakeFeatures{featureflag.IPAM: true},
+			provider:         clouds.DigitalOcean,
+			expectedCode:     http.StatusAccepted,
+			expectedServices: "10.129.0.0/16",
+		},
+	} {
+		provisionRequest := validRequest()
+		provisionRequest.Profile.Provider = tc.provider
+		body, _ := json.Marshal(&provisionRequest)
+
+		var provisioned *profile.Profile
+		provisioner := &mockProvisioner{
+			provisionCluster: func(ctx context.Context, p *profile.Profile, config *steps.Config) (map[string][]*workflows.Task, error) {
+				provisioned = p
+				config.ClusterID = "1234"
+				return map[string][]*workflows.Task{}, tc.provisionErr
+			},
+		}
+		profileCreator := &mockProfileCreator{}
+		profileCreator.On("Create", mock.Anything, mock.Anything).Return(nil)
+		allocator := &fakeAllocator{err: tc.allocateErr}
+
+		handler := Handler{
+			provisioner: provisioner,
+			accountGetter: &mockAccountGetter{
+				get: func(context.Context, string) (*model.CloudAccount, error) {
+					return &model.CloudAccount{Provider: clouds.DigitalOcean}, nil
+				},
+			},
+			profileService: profileCreator,
+			features:       tc.features,
+		}
+		handler.UseIPAM(allocator)
+
+		req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
+		rec := httptest.NewRecorder()
+		handler.Provision(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedReleased, allocator.released == "test", "TC: %s", tc.name)
+		if tc.expectedCode != http.StatusAccepted {
+			continue
+		}
+		require.Equal(t, "10.0.0.0/16", provisioned.CIDR, "TC: %s: requested ranges must be kept", tc.name)
+		require.Equal(t, tc.expectedServices, provisioned.K8SServicesCIDR, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedVPC, provisioned.CloudSpecificSettings[clouds.AwsVpcCIDR], "TC: %s", tc.name)
+	}
+}
+
 func TestNewHandler(t *testing.T) {
 	accSvc := &account.Service{}
 	kubeSvc := &mockKubeService{}
 	p := &TaskProvisioner{}
-	h := NewHandler(kubeSvc, accSvc, nil, p)
+	h := NewHandler(kubeSvc, accSvc, nil, p, nil)
 
 	if h.accountGetter == nil {
 		t.Errorf("account getter must not be nil")
@@ -242,7 +415,7 @@ func TestHandler_Register(t *testing.T) {
 	r := mux.NewRouter()
 	h.Register(r)
 
-	expectedRouteCount := 1
+	expectedRouteCount := 7
 	actualRouteCount := 0
 	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		if router != r {
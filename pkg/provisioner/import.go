@@ -0,0 +1,191 @@
+package provisioner
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// ImportCluster installs kubernetes on existing machines, e.g. created with terraform.
+// Only kubernetes installation workflows are run, machines are recorded as
+// externally managed so deleting the cluster or a node never touches them.
+// The import is limited by the timeout of the config.
+func (tp *TaskProvisioner) ImportCluster(parentContext context.Context, clusterProfile *profile.Profile,
+	config *steps.Config, machines []model.Machine) (map[string][]*workflows.Task, error) {
+	masterMachines, nodeMachines := splitByRole(machines)
+	if len(masterMachines) == 0 {
+		return nil, errors.Wrap(sgerrors.ErrNotFound, "master machine")
+	}
+
+	taskMap, err := tp.prepareImport(len(masterMachines), len(nodeMachines))
+	if err != nil {
+		return nil, err
+	}
+
+	clusterTask := taskMap[workflows.ClusterTask][0]
+	config.ClusterID = clusterTask.ID[:8]
+	config.Kube.ExternallyManaged = true
+
+	ctx, cancel := context.WithTimeout(parentContext, config.Timeout)
+	tp.cancelMap[config.ClusterID] = cancel
+
+	masters := importedMachines(config.ClusterName, clusterProfile, masterMachines, taskMap[workflows.MasterTask], true)
+	nodes := importedMachines(config.ClusterName, clusterProfile, nodeMachines, taskMap[workflows.NodeTask], false)
+
+	if err := bootstrapCerts(config); err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "bootstrap certs")
+	}
+
+	err = tp.buildInitialCluster(ctx, clusterProfile, masters, nodes,
+		config, grabTaskIds(taskMap))
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "build initial cluster")
+	}
+
+	go tp.monitorClusterState(ctx, config.ClusterID, config.NodeChan(),
+		config.KubeStateChan(), config.ConfigChan())
+	go func() {
+		// monitor saves updates of the import and stops
+		defer cancel()
+		tp.importMachines(ctx, taskMap, masterMachines, nodeMachines, config)
+	}()
+
+	return taskMap, nil
+}
+
+func (tp *TaskProvisioner) prepareImport(masterCount, nodeCount int) (map[string][]*workflows.Task, error) {
+	clusterTask, err := workflows.NewTask(workflows.PostProvision, tp.repository)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s task", workflows.PostProvision)
+	}
+
+	taskMap := map[string][]*workflows.Task{
+		workflows.MasterTask:  make([]*workflows.Task, 0, masterCount),
+		workflows.NodeTask:    make([]*workflows.Task, 0, nodeCount),
+		workflows.ClusterTask: {clusterTask},
+	}
+
+	for i := 0; i < masterCount; i++ {
+		t, err := workflows.NewSubTask(workflows.ImportMaster, clusterTask, tp.repository)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create %s task", workflows.ImportMaster)
+		}
+		taskMap[workflows.MasterTask] = append(taskMap[workflows.MasterTask], t)
+	}
+
+	for i := 0; i < nodeCount; i++ {
+		t, err := workflows.NewSubTask(workflows.ImportNode, clusterTask, tp.repository)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create %s task", workflows.ImportNode)
+		}
+		taskMap[workflows.NodeTask] = append(taskMap[workflows.NodeTask], t)
+	}
+
+	return taskMap, nil
+}
+
+// importMachines bootstraps the first master and then joins the rest of machines.
+func (tp *TaskProvisioner) importMachines(ctx context.Context, taskMap map[string][]*workflows.Task,
+	masters, nodes []model.Machine, config *steps.Config) {
+	config.KubeStateChan() <- model.StateProvisioning
+
+	masterTasks := taskMap[workflows.MasterTask]
+
+	if err := tp.runImportTask(ctx, masterTasks[0], masters[0], true, config); err != nil {
+		config.KubeStateChan() <- model.StateFailed
+		logrus.Errorf("import master bootstrap task %s has finished with error %v", masterTasks[0].ID, err)
+		return
+	}
+
+	if master := config.GetMaster(); master != nil {
+		config.KubeadmConfig.LoadBalancerHost = master.PrivateIp
+		config.KubeadmConfig.IsBootstrap = false
+	}
+
+	for i := 1; i < len(masterTasks); i++ {
+		go func(t *workflows.Task, m model.Machine) {
+			if err := tp.runImportTask(ctx, t, m, true, config); err != nil {
+				logrus.Errorf("import master task %s has finished with error %v", t.ID, err)
+			}
+		}(masterTasks[i], masters[i])
+	}
+
+	for i, t := range taskMap[workflows.NodeTask] {
+		go func(t *workflows.Task, m model.Machine) {
+			if err := tp.runImportTask(ctx, t, m, false, config); err != nil {
+				logrus.Errorf("import node task %s has finished with error %v", t.ID, err)
+			}
+		}(t, nodes[i])
+	}
+
+	tp.waitCluster(ctx, taskMap[workflows.ClusterTask][0], config)
+	logrus.Infof("cluster %s import has finished", config.ClusterID)
+}
+
+func (tp *TaskProvisioner) runImportTask(ctx context.Context, t *workflows.Task, m model.Machine,
+	isMaster bool, config *steps.Config) error {
+	fileName := util.MakeFileName(t.ID)
+	out, err := tp.getWriter(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "get writer for %s", fileName)
+	}
+
+	cfg := *config
+	cfg.IsMaster = isMaster
+	cfg.TaskID = t.ID
+	cfg.Node = m
+
+	return <-t.Run(ctx, cfg, out)
+}
+
+func splitByRole(machines []model.Machine) ([]model.Machine, []model.Machine) {
+	masters := make([]model.Machine, 0, len(machines))
+	nodes := make([]model.Machine, 0, len(machines))
+
+	for _, m := range machines {
+		if m.Role == model.RoleMaster {
+			masters = append(masters, m)
+		} else {
+			nodes = append(nodes, m)
+		}
+	}
+
+	return masters, nodes
+}
+
+// importedMachines fills in planned machines that are saved to the cluster before import starts.
+func importedMachines(clusterName string, clusterProfile *profile.Profile, machines []model.Machine,
+	tasks []*workflows.Task, isMaster bool) map[string]*model.Machine {
+	out := make(map[string]*model.Machine, len(machines))
+
+	for i := range machines {
+		m := &machines[i]
+		if m.Name == "" {
+			m.Name = util.MakeNodeName(clusterName, tasks[i].ID[:4], isMaster)
+		}
+		m.Role = model.RoleNode
+		if isMaster {
+			m.Role = model.RoleMaster
+		}
+		m.TaskID = tasks[i].ID
+		m.Provider = clusterProfile.Provider
+		m.Region = clusterProfile.Region
+		m.State = model.MachineStatePlanned
+		m.ExternallyManaged = true
+
+		machine := *m
+		out[m.Name] = &machine
+	}
+
+	return out
+}
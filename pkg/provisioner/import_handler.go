@@ -0,0 +1,155 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/asaskevich/govalidator.v8"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// ImportRequest describes machines created outside of supergiant that
+// kubernetes should be installed on.
+type ImportRequest struct {
+	ClusterName string          `json:"clusterName" valid:"required,matches(^[A-Za-z0-9-]+$)"`
+	Profile     profile.Profile `json:"profile" valid:"-"`
+	// CloudAccountName is optional, it's needed to add cloud nodes to the cluster later
+	CloudAccountName string `json:"cloudAccountName" valid:"-"`
+
+	// SSH credentials that give access to all machines, the private key
+	// may be omitted when the control plane has an ssh-agent
+	SSHUser       string `json:"sshUser" valid:"required"`
+	SSHPrivateKey string `json:"sshPrivateKey" valid:"-"`
+	// SSHPassphrase decrypts the private key, it isn't stored, so encrypted
+	// keys are accepted only when the control plane has an ssh-agent that
+	// holds them for later tasks
+	SSHPassphrase string `json:"sshPassphrase" valid:"-"`
+
+	Machines []ImportMachine `json:"machines" valid:"required"`
+}
+
+// ImportMachine is an existing machine, e.g. taken from terraform outputs.
+type ImportMachine struct {
+	// ID is an id of the instance in the cloud
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      model.Role `json:"role" valid:"required,in(master|node)"`
+	Size      string     `json:"size"`
+	PublicIP  string     `json:"publicIp" valid:"required,ip"`
+	PrivateIP string     `json:"privateIp" valid:"required,ip"`
+}
+
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	req := &ImportRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		message.SendValidationFailed(w, err)
+		return
+	}
+	if req.SSHPrivateKey == "" && h.sshAgentSocket == "" {
+		message.SendValidationFailed(w, errors.New("ssh private key is required"))
+		return
+	}
+	if h.sshAgentSocket == "" && ssh.IsEncrypted([]byte(req.SSHPrivateKey)) {
+		message.SendValidationFailed(w, errors.New("encrypted ssh private keys require an ssh-agent"))
+		return
+	}
+
+	machines := make([]model.Machine, 0, len(req.Machines))
+	hasMaster := false
+	for _, m := range req.Machines {
+		if ok, err := govalidator.ValidateStruct(m); !ok {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		hasMaster = hasMaster || m.Role == model.RoleMaster
+
+		machines = append(machines, model.Machine{
+			ID:        m.ID,
+			Name:      m.Name,
+			Role:      m.Role,
+			Size:      m.Size,
+			PublicIp:  m.PublicIP,
+			PrivateIp: m.PrivateIP,
+		})
+	}
+	if !hasMaster {
+		message.SendValidationFailed(w, errors.New("at least one master machine is required"))
+		return
+	}
+
+	if req.Profile.K8SServicesCIDR == "" {
+		req.Profile.K8SServicesCIDR = DefaultK8SServicesCIDR
+	}
+
+	config, err := steps.NewConfig(req.ClusterName, req.CloudAccountName, req.Profile)
+	if err != nil {
+		logrus.Errorf("import: new config: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+	config.Kube.SSHConfig.User = req.SSHUser
+	config.Kube.SSHConfig.BootstrapPrivateKey = req.SSHPrivateKey
+	config.Kube.SSHConfig.Passphrase = req.SSHPassphrase
+	config.Kube.SSHConfig.AgentSocket = h.sshAgentSocket
+	config.ClusterCheckConfig.MachineCount = len(machines)
+
+	if req.CloudAccountName != "" {
+		acc, err := h.accountGetter.Get(r.Context(), req.CloudAccountName)
+		if err != nil {
+			if sgerrors.IsNotFound(err) {
+				message.SendNotFound(w, req.CloudAccountName, err)
+				return
+			}
+			message.SendUnknownError(w, err)
+			return
+		}
+
+		if err = util.FillCloudAccountCredentials(r.Context(), acc, config); err != nil {
+			logrus.Errorf("import: fill cloud account: %v", err)
+			message.SendUnknownError(w, err)
+			return
+		}
+	}
+
+	req.Profile.ID = uuid.New()[:8]
+
+	// the provisioner limits the import with the timeout of the config
+	taskMap, err := h.provisioner.ImportCluster(tenant.Detach(r.Context()), &req.Profile, config, machines)
+	if err != nil {
+		logrus.Errorf("import cluster %s: %v", req.ClusterName, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := h.profileService.Create(r.Context(), &req.Profile); err != nil {
+		logrus.Debugf("Error creating profile %s", req.Profile.ID)
+	}
+
+	resp := ProvisionResponse{
+		ClusterID: config.ClusterID,
+		Tasks:     make(map[string][]string, len(taskMap)),
+	}
+	for role, tasks := range taskMap {
+		for _, t := range tasks {
+			resp.Tasks[role] = append(resp.Tasks[role], t.ID)
+		}
+	}
+
+	sendAccepted(w, &resp)
+}
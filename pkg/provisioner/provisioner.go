@@ -16,6 +16,7 @@ import (
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps"
@@ -26,6 +27,7 @@ const keySize = 4096
 type KubeService interface {
 	Create(ctx context.Context, k *model.Kube) error
 	Get(ctx context.Context, name string) (*model.Kube, error)
+	Update(ctx context.Context, name string, change func(*model.Kube) error) (*model.Kube, error)
 }
 
 type TaskProvisioner struct {
@@ -41,6 +43,10 @@ type TaskProvisioner struct {
 	// Cancel map - map of KubeID -> cancel function
 	// that cancels
 	cancelMap map[string]func()
+
+	// node tasks are submitted to the queue when it is set
+	// and run by workers of any control replica
+	queue *workflows.Queue
 }
 
 func NewProvisioner(repository storage.Interface, kubeService KubeService,
@@ -54,6 +60,16 @@ func NewProvisioner(repository storage.Interface, kubeService KubeService,
 	}
 }
 
+// SetSpawnInterval changes the interval between cloud API calls that create instances.
+func (tp *TaskProvisioner) SetSpawnInterval(interval time.Duration) {
+	tp.rateLimiter.SetInterval(interval)
+}
+
+// UseQueue makes the provisioner submit node tasks to workers instead of running them.
+func (tp *TaskProvisioner) UseQueue(queue *workflows.Queue) {
+	tp.queue = queue
+}
+
 // ProvisionCluster runs provisionCluster process among nodes
 // that have been provided for provisionCluster
 func (tp *TaskProvisioner) ProvisionCluster(parentContext context.Context,
@@ -105,7 +121,9 @@ func (tp *TaskProvisioner) ProvisionCluster(parentContext context.Context,
 	return taskMap, nil
 }
 
-func (tp *TaskProvisioner) ProvisionNodes(parentContext context.Context, nodeProfiles []profile.NodeProfile, kube *model.Kube, config *steps.Config) ([]string, error) {
+// ProvisionNodes adds nodes to the cluster, the returned node tasks
+// are sub-tasks of a single group task.
+func (tp *TaskProvisioner) ProvisionNodes(parentContext context.Context, nodeProfiles []profile.NodeProfile, kube *model.Kube, config *steps.Config) ([]*workflows.Task, error) {
 	if len(kube.Masters) != 0 {
 		for key := range kube.Masters {
 			config.AddMaster(kube.Masters[key])
@@ -122,30 +140,30 @@ func (tp *TaskProvisioner) ProvisionNodes(parentContext context.Context, nodePro
 		return nil, errors.Wrap(err, "load cloud specific config")
 	}
 
-	// monitor cluster state in separate goroutine
-	go tp.monitorClusterState(ctx, config.ClusterID,
-		config.NodeChan(), config.KubeStateChan(), config.ConfigChan())
+	// monitor cluster state in separate goroutine, workers
+	// apply state changes of queued tasks themselves
+	if tp.queue == nil {
+		go tp.monitorClusterState(ctx, config.ClusterID,
+			config.NodeChan(), config.KubeStateChan(), config.ConfigChan())
+	}
 
-	tasks := make([]string, 0, len(nodeProfiles))
+	group, err := workflows.NewTaskGroup(tp.repository)
+	if err != nil {
+		return nil, errors.Wrap(err, "create group task")
+	}
+	tasks := make([]*workflows.Task, 0, len(nodeProfiles))
 
 	for _, nodeProfile := range nodeProfiles {
 		// Protect cloud API with rate limiter
 		tp.rateLimiter.Take()
 
 		// Take node workflow for the provider
-		t, err := workflows.NewTask(workflows.ProvisionNode, tp.repository)
+		t, err := workflows.NewSubTask(workflows.ProvisionNode, group, tp.repository)
 		if err != nil {
 			return nil, errors.Wrap(sgerrors.ErrNotFound, "workflow")
 		}
 
-		tasks = append(tasks, t.ID)
-
-		fileName := util.MakeFileName(t.ID)
-		writer, err := tp.getWriter(fileName)
-
-		if err != nil {
-			return nil, errors.Wrap(err, "get writer")
-		}
+		tasks = append(tasks, t)
 
 		err = FillNodeCloudSpecificData(config.Provider, nodeProfile, config)
 
@@ -155,6 +173,22 @@ func (tp *TaskProvisioner) ProvisionNodes(parentContext context.Context, nodePro
 
 		// Put task id to config so that create instance step can use this id when generate node name
 		config.TaskID = t.ID
+
+		if tp.queue != nil {
+			if err = tp.queue.Submit(ctx, t, config); err != nil {
+				return nil, errors.Wrapf(err, "submit task %s", t.ID)
+			}
+			go tp.cancelQueued(ctx, t.ID)
+			continue
+		}
+
+		fileName := util.MakeFileName(t.ID)
+		writer, err := tp.getWriter(fileName)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "get writer")
+		}
+
 		errChan := t.Run(ctx, *config, writer)
 
 		go func(cfg *steps.Config, errChan chan error) {
@@ -170,6 +204,61 @@ func (tp *TaskProvisioner) ProvisionNodes(parentContext context.Context, nodePro
 	return tasks, nil
 }
 
+// cancelQueued cancels the queued task along with the provisioning context.
+func (tp *TaskProvisioner) cancelQueued(ctx context.Context, taskID string) {
+	<-ctx.Done()
+
+	// the task has been completed and removed from the queue
+	if err := tp.queue.Cancel(context.Background(), taskID); err != nil && !sgerrors.IsNotFound(err) {
+		logrus.Errorf("cancel queued task %s: %v", taskID, err)
+	}
+}
+
+// ExecuteTask runs a task claimed from the queue, cluster state changes are
+// applied the same way they are during provisioning.
+func (tp *TaskProvisioner) ExecuteTask(ctx context.Context, t *workflows.Task) error {
+	config := t.Config
+	config.SetNodeChan(make(chan model.Machine, 1))
+	config.SetKubeStateChan(make(chan model.KubeState, 1))
+	config.SetConfigChan(make(chan *steps.Config, 1))
+
+	out, err := tp.getWriter(util.MakeFileName(t.ID))
+	if err != nil {
+		return errors.Wrap(err, "get writer")
+	}
+
+	result := t.Run(ctx, *config, out)
+	for {
+		select {
+		case n := <-config.NodeChan():
+			tp.updateNode(ctx, config.ClusterID, n)
+		case state := <-config.KubeStateChan():
+			tp.updateState(ctx, config.ClusterID, state)
+		case cfg := <-config.ConfigChan():
+			tp.updateConfig(ctx, config.ClusterID, cfg)
+		case err = <-result:
+			// changes sent right before the task has finished
+			tp.drain(ctx, config)
+			return err
+		}
+	}
+}
+
+func (tp *TaskProvisioner) drain(ctx context.Context, config *steps.Config) {
+	for {
+		select {
+		case n := <-config.NodeChan():
+			tp.updateNode(ctx, config.ClusterID, n)
+		case state := <-config.KubeStateChan():
+			tp.updateState(ctx, config.ClusterID, state)
+		case cfg := <-config.ConfigChan():
+			tp.updateConfig(ctx, config.ClusterID, cfg)
+		default:
+			return
+		}
+	}
+}
+
 func (tp *TaskProvisioner) Cancel(clusterID string) error {
 	if cancelFunc := tp.cancelMap[clusterID]; cancelFunc != nil {
 		cancelFunc()
@@ -184,7 +273,7 @@ func (tp *TaskProvisioner) RestartClusterProvisioning(parentCtx context.Context,
 	clusterProfile *profile.Profile,
 	config *steps.Config, taskIdMap map[string][]string) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(),
+	ctx, cancel := context.WithTimeout(tenant.Detach(parentCtx),
 		time.Minute*30)
 	tp.cancelMap[config.ClusterID] = cancel
 	logrus.Debugf("Deserialize tasks")
@@ -209,6 +298,21 @@ func (tp *TaskProvisioner) RestartClusterProvisioning(parentCtx context.Context,
 func (tp *TaskProvisioner) provision(ctx context.Context,
 	taskMap map[string][]*workflows.Task, clusterProfile *profile.Profile,
 	config *steps.Config) {
+	// clusters of one account are provisioned in turns when the account is limited
+	if tp.queue != nil {
+		release, err := tp.queue.Hold(ctx, tenant.FromContext(ctx),
+			config.CloudAccountName, config.ClusterID, config.ClusterID)
+		if err != nil {
+			logrus.Errorf("cluster %s: wait for account %s: %v",
+				config.ClusterID, config.CloudAccountName, err)
+			if ctx.Err() == nil {
+				config.KubeStateChan() <- model.StateFailed
+			}
+			return
+		}
+		defer release()
+	}
+
 	preProvisionTask := taskMap[workflows.PreProvisionTask]
 
 	if preProvisionTask != nil && len(preProvisionTask) > 0 {
@@ -265,6 +369,13 @@ func (tp *TaskProvisioner) prepare(name clouds.Name, masterCount, nodeCount int)
 		err              error
 	)
 
+	// the rest of provisioning tasks are sub-tasks of the cluster task
+	clusterTask, err = workflows.NewTask(workflows.PostProvision, tp.repository)
+	if err != nil {
+		logrus.Errorf("Failed to set up task for %s workflow", workflows.PostProvision)
+		return nil
+	}
+
 	masterTasks := make([]*workflows.Task, 0, masterCount)
 	nodeTasks := make([]*workflows.Task, 0, nodeCount)
 	//some clouds (e.g. AWS) requires running tasks before provisioning nodes (creating a VPC, Subnets, SecGroups, etc)
@@ -272,7 +383,7 @@ func (tp *TaskProvisioner) prepare(name clouds.Name, masterCount, nodeCount int)
 	case clouds.Azure:
 		fallthrough
 	case clouds.AWS:
-		preProvisionTask, err = workflows.NewTask(workflows.PreProvision, tp.repository)
+		preProvisionTask, err = workflows.NewSubTask(workflows.PreProvision, clusterTask, tp.repository)
 		if err != nil {
 			// We can't go further without pre provision task
 			logrus.Errorf("create pre provision task has finished with %v", err)
@@ -284,7 +395,7 @@ func (tp *TaskProvisioner) prepare(name clouds.Name, masterCount, nodeCount int)
 	}
 
 	for i := 0; i < masterCount; i++ {
-		t, err := workflows.NewTask(workflows.ProvisionMaster, tp.repository)
+		t, err := workflows.NewSubTask(workflows.ProvisionMaster, clusterTask, tp.repository)
 		if err != nil {
 			logrus.Errorf("Failed to set up task for %s workflow", workflows.ProvisionMaster)
 			continue
@@ -293,7 +404,7 @@ func (tp *TaskProvisioner) prepare(name clouds.Name, masterCount, nodeCount int)
 	}
 
 	for i := 0; i < nodeCount; i++ {
-		t, err := workflows.NewTask(workflows.ProvisionNode, tp.repository)
+		t, err := workflows.NewSubTask(workflows.ProvisionNode, clusterTask, tp.repository)
 		if err != nil {
 			logrus.Errorf("Failed to set up task for %s workflow", workflows.ProvisionNode)
 			continue
@@ -301,12 +412,6 @@ func (tp *TaskProvisioner) prepare(name clouds.Name, masterCount, nodeCount int)
 		nodeTasks = append(nodeTasks, t)
 	}
 
-	clusterTask, err = workflows.NewTask(workflows.PostProvision, tp.repository)
-	if err != nil {
-		logrus.Errorf("Failed to set up task for %s workflow", workflows.PostProvision)
-		return nil
-	}
-
 	taskMap := map[string][]*workflows.Task{
 		workflows.MasterTask:  masterTasks,
 		workflows.NodeTask:    nodeTasks,
@@ -537,11 +642,22 @@ func (tp *TaskProvisioner) buildInitialCluster(ctx context.Context,
 		},
 
 		CloudSpec: profile.CloudSpecificSettings,
+		APIHost:   config.DNSConfig.Name,
+		DNS:       profile.DNS,
+		Egress:    profile.Egress,
 		Masters:   masters,
 		Nodes:     nodes,
 		Tasks:     taskIds,
 
-		SSHConfig: config.Kube.SSHConfig,
+		SSHConfig:         config.Kube.SSHConfig,
+		ExternallyManaged: config.Kube.ExternallyManaged,
+
+		APIServerAllowedCIDRs: profile.APIServerAllowedCIDRs,
+		Dashboard:             profile.Dashboard,
+		VolumeSnapshots:       profile.VolumeSnapshots,
+		Cost:                  profile.Cost,
+		Hardening:             profile.Hardening,
+		SpreadMasters:         profile.SpreadMasters,
 	}
 
 	return tp.kubeService.Create(ctx, cluster)
@@ -552,6 +668,7 @@ func (t *TaskProvisioner) updateCloudSpecificData(k *model.Kube, config *steps.C
 		config.ClusterID)
 
 	cloudSpecificSettings := make(map[string]string)
+	k.EgressIPs = config.EgressConfig.IPs
 
 	// Save cloudSpecificData in kube
 	switch config.Provider {
@@ -582,9 +699,26 @@ func (t *TaskProvisioner) updateCloudSpecificData(k *model.Kube, config *steps.C
 			config.AWSConfig.NodesInstanceProfile
 		cloudSpecificSettings[clouds.AwsImageID] =
 			config.AWSConfig.ImageID
+		cloudSpecificSettings[clouds.AwsNATGatewayID] =
+			config.AWSConfig.NATGatewayID
+		cloudSpecificSettings[clouds.AwsNATSubnetID] =
+			config.AWSConfig.NATSubnetID
+		cloudSpecificSettings[clouds.AwsNATRouteTableID] =
+			config.AWSConfig.NATRouteTableID
+		cloudSpecificSettings[clouds.AwsEgressAllocationID] =
+			config.AWSConfig.EgressAllocationID
+		cloudSpecificSettings[clouds.AwsStackName] =
+			config.AWSConfig.StackName
+		cloudSpecificSettings[clouds.AwsMastersPlacementGroup] =
+			config.AWSConfig.MastersPlacementGroup
 	case clouds.GCE:
-		// GCE is the most simple :-)
+		cloudSpecificSettings[clouds.GCEMastersPlacementPolicy] = config.GCEConfig.MastersPlacementPolicy
 	case clouds.DigitalOcean:
+	case clouds.Azure:
+		cloudSpecificSettings[clouds.AzureResourceGroup] = config.AzureConfig.ResourceGroupName
+		cloudSpecificSettings[clouds.AzureVNetName] = config.AzureConfig.VirtualNetworkName
+		cloudSpecificSettings[clouds.AzureSecurityGroup] = config.AzureConfig.SecurityGroupName
+		cloudSpecificSettings[clouds.AzureMastersAvailabilitySet] = config.AzureConfig.MastersAvailabilitySet
 	}
 
 	k.CloudSpec = cloudSpecificSettings
@@ -640,63 +774,94 @@ func (tp *TaskProvisioner) monitorClusterState(ctx context.Context,
 	for {
 		select {
 		case n := <-nodeChan:
-			k, err := tp.kubeService.Get(ctx, clusterID)
+			tp.updateNode(ctx, clusterID, n)
+		case state := <-kubeStateChan:
+			tp.updateState(ctx, clusterID, state)
+		case config := <-configChan:
+			tp.updateConfig(ctx, clusterID, config)
+		case <-ctx.Done():
+			// updates sent before the end are saved, e.g. the final state
+			tp.drainClusterState(tenant.Detach(ctx), clusterID, nodeChan, kubeStateChan, configChan)
+			return
+		}
+	}
+}
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
+// drainClusterState saves updates that are left in channels of the cluster.
+func (tp *TaskProvisioner) drainClusterState(ctx context.Context,
+	clusterID string, nodeChan chan model.Machine, kubeStateChan chan model.KubeState,
+	configChan chan *steps.Config) {
+	for {
+		select {
+		case n := <-nodeChan:
+			tp.updateNode(ctx, clusterID, n)
+		case state := <-kubeStateChan:
+			tp.updateState(ctx, clusterID, state)
+		case config := <-configChan:
+			tp.updateConfig(ctx, clusterID, config)
+		default:
+			return
+		}
+	}
+}
 
-			if n.Role == model.RoleMaster {
-				k.Masters[n.Name] = &n
-			} else {
-				k.Nodes[n.Name] = &n
+// updateNode saves the machine to the latest version of the kube, nodes
+// of the same cluster are provisioned and saved concurrently.
+func (tp *TaskProvisioner) updateNode(ctx context.Context, clusterID string, n model.Machine) {
+	_, err := tp.kubeService.Update(ctx, clusterID, func(k *model.Kube) error {
+		if n.Role == model.RoleMaster {
+			if k.Masters == nil {
+				k.Masters = make(map[string]*model.Machine)
+			}
+			k.Masters[n.Name] = &n
+		} else {
+			if k.Nodes == nil {
+				k.Nodes = make(map[string]*model.Machine)
 			}
+			k.Nodes[n.Name] = &n
+		}
+		return nil
+	})
 
-			err = tp.kubeService.Create(ctx, k)
+	if err != nil {
+		logrus.Errorf("cluster monitor: update kube state caused %v", err)
+	}
+}
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
-		case state := <-kubeStateChan:
-			logrus.Debugf("monitor: get kube %s", clusterID)
-			k, err := tp.kubeService.Get(ctx, clusterID)
+func (tp *TaskProvisioner) updateState(ctx context.Context, clusterID string, state model.KubeState) {
+	logrus.Debugf("monitor: get kube %s", clusterID)
+	k, err := tp.kubeService.Get(ctx, clusterID)
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
+	if err != nil {
+		logrus.Errorf("cluster monitor: update kube state caused %v", err)
+		return
+	}
 
-			k.State = state
-			logrus.Debugf("monitor: update kube %s with state %s",
-				k.ID, state)
-			err = tp.kubeService.Create(ctx, k)
+	k.State = state
+	logrus.Debugf("monitor: update kube %s with state %s",
+		k.ID, state)
+	err = tp.kubeService.Create(ctx, k)
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
-		case config := <-configChan:
-			logrus.Debugf("update kube %s with config %v", clusterID, config)
-			k, err := tp.kubeService.Get(ctx, clusterID)
+	if err != nil {
+		logrus.Errorf("cluster monitor: update kube state caused %v", err)
+	}
+}
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
+func (tp *TaskProvisioner) updateConfig(ctx context.Context, clusterID string, config *steps.Config) {
+	logrus.Debugf("update kube %s with config %v", clusterID, config)
+	k, err := tp.kubeService.Get(ctx, clusterID)
 
-			tp.updateCloudSpecificData(k, config)
+	if err != nil {
+		logrus.Errorf("cluster monitor: update kube state caused %v", err)
+		return
+	}
 
-			err = tp.kubeService.Create(ctx, k)
+	tp.updateCloudSpecificData(k, config)
 
-			if err != nil {
-				logrus.Errorf("cluster monitor: update kube state caused %v", err)
-				continue
-			}
-		case <-ctx.Done():
-			return
-		}
+	err = tp.kubeService.Create(ctx, k)
+
+	if err != nil {
+		logrus.Errorf("cluster monitor: update kube state caused %v", err)
 	}
 }
 
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"io"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -10,11 +11,14 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/kube"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
 	"github.com/supergiant/control/pkg/testutils"
 	"github.com/supergiant/control/pkg/workflows"
 	"github.com/supergiant/control/pkg/workflows/steps"
@@ -50,6 +54,32 @@ func (m *mockKubeService) Get(ctx context.Context, kname string) (*model.Kube, e
 	return m.data[kname], m.getError
 }
 
+func (m *mockKubeService) Update(ctx context.Context, kname string, change func(*model.Kube) error) (*model.Kube, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	k := m.data[kname]
+	if m.getError != nil {
+		return nil, m.getError
+	}
+	if k == nil {
+		return nil, sgerrors.ErrNotFound
+	}
+	if err := change(k); err != nil {
+		return nil, err
+	}
+	return k, m.createErr
+}
+
+func (m *mockKubeService) ListAll(ctx context.Context) ([]model.Kube, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	kubes := make([]model.Kube, 0, len(m.data))
+	for _, k := range m.data {
+		kubes = append(kubes, *k)
+	}
+	return kubes, m.getError
+}
+
 type mockStep struct {
 }
 
@@ -100,6 +130,9 @@ func TestProvisionCluster(t *testing.T) {
 	repository.On("Put", mock.Anything,
 		mock.Anything, mock.Anything,
 		mock.Anything).Return(nil)
+	// sub-tasks look up the cluster task they belong to
+	repository.On("Get", mock.Anything,
+		mock.Anything, mock.Anything).Return(nil, sgerrors.ErrNotFound)
 
 	bc := &bufferCloser{
 		ioutil.Discard,
@@ -118,6 +151,7 @@ func TestProvisionCluster(t *testing.T) {
 		},
 		NewRateLimiter(time.Nanosecond * 1),
 		make(map[string]func()),
+		nil,
 	}
 
 	workflows.Init()
@@ -199,7 +233,7 @@ func TestProvisionNodes(t *testing.T) {
 		mock.Anything, mock.Anything, mock.Anything).
 		Return(nil)
 	repository.On("Get", mock.Anything, mock.Anything,
-		mock.Anything).Return()
+		mock.Anything).Return(nil, sgerrors.ErrNotFound)
 	bc := &bufferCloser{
 		ioutil.Discard,
 		nil,
@@ -235,6 +269,7 @@ func TestProvisionNodes(t *testing.T) {
 		},
 		NewRateLimiter(time.Nanosecond * 1),
 		make(map[string]func()),
+		nil,
 	}
 
 	workflows.Init()
@@ -330,6 +365,7 @@ func TestRestartProvisionClusterSuccess(t *testing.T) {
 		},
 		NewRateLimiter(time.Nanosecond * 1),
 		make(map[string]func()),
+		nil,
 	}
 
 	workflows.Init()
@@ -403,6 +439,7 @@ func TestRestartProvisionClusterError(t *testing.T) {
 		},
 		NewRateLimiter(time.Nanosecond * 1),
 		make(map[string]func()),
+		nil,
 	}
 
 	workflows.Init()
@@ -666,6 +703,31 @@ func TestMonitorCluster(t *testing.T) {
 	}
 }
 
+func TestMonitorClusterDrain(t *testing.T) {
+	kube := &model.Kube{
+		ID:      "1234",
+		Name:    "test",
+		State:   model.StateProvisioning,
+		Masters: make(map[string]*model.Machine),
+		Nodes:   make(map[string]*model.Machine),
+	}
+	p := &TaskProvisioner{
+		kubeService: &mockKubeService{
+			data: map[string]*model.Kube{kube.ID: kube},
+		},
+	}
+	cfg, err := steps.NewConfig("test", "", profile.Profile{})
+	require.NoError(t, err)
+
+	// the final state is sent right before the import is canceled
+	cfg.KubeStateChan() <- model.StateOperational
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.monitorClusterState(ctx, kube.ID, cfg.NodeChan(), cfg.KubeStateChan(), cfg.ConfigChan())
+
+	require.Equal(t, model.StateOperational, kube.State)
+}
+
 func TestTaskProvisioner_Cancel(t *testing.T) {
 	clusterID := "1234"
 	called := false
@@ -736,3 +798,83 @@ func TestBuildInitialCluster(t *testing.T) {
 		}
 	}
 }
+
+type reportingStep struct {
+	mockStep
+}
+
+func (s *reportingStep) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	config.NodeChan() <- model.Machine{Name: "node-1", Role: model.RoleNode}
+	config.KubeStateChan() <- model.StateOperational
+	return nil
+}
+
+func TestExecuteTask(t *testing.T) {
+	repository := &testutils.MockStorage{}
+	repository.On("Put", mock.Anything,
+		mock.Anything, mock.Anything,
+		mock.Anything).Return(nil)
+
+	svc := &mockKubeService{
+		data: map[string]*model.Kube{
+			"kube": {
+				ID:      "kube",
+				Masters: map[string]*model.Machine{},
+				Nodes:   map[string]*model.Machine{},
+			},
+		},
+	}
+
+	workflows.RegisterWorkFlow("reporting", []steps.Step{&reportingStep{}})
+	task, err := workflows.NewTask("reporting", repository)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	task.Config = &steps.Config{ClusterID: "kube"}
+
+	p := NewProvisioner(repository, svc, time.Nanosecond)
+	p.getWriter = func(string) (io.WriteCloser, error) {
+		return &bufferCloser{ioutil.Discard, nil}, nil
+	}
+
+	if err = p.ExecuteTask(context.Background(), task); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	k := svc.data["kube"]
+	if k.Nodes["node-1"] == nil {
+		t.Errorf("Node reported by the task must be added to the kube")
+	}
+
+	if k.State != model.StateOperational {
+		t.Errorf("Wrong kube state expected %s actual %s",
+			model.StateOperational, k.State)
+	}
+}
+
+func TestTaskProvisioner_updateNode(t *testing.T) {
+	svc := kube.NewService(kube.DefaultStoragePrefix, memory.NewInMemoryRepository(), nil)
+	require.NoError(t, svc.Create(context.Background(), &model.Kube{ID: "kube"}))
+	tp := NewProvisioner(nil, svc, time.Second)
+
+	// machines created at the same time must not overwrite each other
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"master-1", "node-1", "node-2", "node-3"} {
+		role := model.RoleNode
+		if strings.HasPrefix(name, "master") {
+			role = model.RoleMaster
+		}
+		wg.Add(1)
+		go func(n model.Machine) {
+			defer wg.Done()
+			tp.updateNode(context.Background(), "kube", n)
+		}(model.Machine{Name: name, Role: role})
+	}
+	wg.Wait()
+
+	k, err := svc.Get(context.Background(), "kube")
+	require.NoError(t, err)
+	require.Len(t, k.Masters, 1)
+	require.Len(t, k.Nodes, 3)
+	require.Equal(t, model.RoleNode, k.Nodes["node-2"].Role)
+}
@@ -0,0 +1,189 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+const (
+	SpecAPIVersion = "supergiant.io/v1"
+	SpecKind       = "Cluster"
+
+	// maxSpecSize limits size of an uploaded cluster spec
+	maxSpecSize = 1 << 20
+)
+
+// ClusterSpec is a declarative definition of a cluster that can be kept in git, e.g.
+//
+//	apiVersion: supergiant.io/v1
+//	kind: Cluster
+//	name: staging
+//	cloudAccountName: aws-dev
+//	profile:
+//	  provider: aws
+//	  region: us-west-2
+//	  K8SVersion: 1.14.1
+//	  masterProfiles:
+//	  - size: m4.large
+//	  nodesProfiles:
+//	  - size: m4.large
+type ClusterSpec struct {
+	APIVersion       string          `json:"apiVersion"`
+	Kind             string          `json:"kind"`
+	Name             string          `json:"name"`
+	CloudAccountName string          `json:"cloudAccountName"`
+	Profile          profile.Profile `json:"profile"`
+}
+
+// ExportSpec returns the cluster spec as yaml, credentials are not exported.
+func (h *Handler) ExportSpec(w http.ResponseWriter, r *http.Request) {
+	kubeID := mux.Vars(r)["kubeID"]
+
+	k, err := h.kubeGetter.Get(r.Context(), kubeID)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, kubeID, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	if k == nil {
+		message.SendNotFound(w, kubeID, sgerrors.ErrNotFound)
+		return
+	}
+
+	p, err := h.profileService.Get(r.Context(), k.ProfileID)
+	if err != nil || p == nil {
+		logrus.Debugf("export spec: profile %s of kube %s not found, use kube: %v", k.ProfileID, kubeID, err)
+		p = profileFromKube(k)
+	}
+
+	raw, err := yaml.Marshal(specFor(k, *p))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	if _, err = w.Write(raw); err != nil {
+		logrus.Errorf("export spec of kube %s: write response: %v", kubeID, err)
+	}
+}
+
+// CreateFromSpec provisions a new cluster from the yaml spec.
+func (h *Handler) CreateFromSpec(w http.ResponseWriter, r *http.Request) {
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSpecSize))
+	if err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	spec := &ClusterSpec{}
+	if err = yaml.Unmarshal(raw, spec); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if spec.APIVersion != SpecAPIVersion || spec.Kind != SpecKind {
+		message.SendValidationFailed(w, errors.Errorf("unsupported spec %s %s, expected %s %s",
+			spec.APIVersion, spec.Kind, SpecAPIVersion, SpecKind))
+		return
+	}
+
+	h.provision(w, r, &ProvisionRequest{
+		ClusterName:      spec.Name,
+		CloudAccountName: spec.CloudAccountName,
+		Profile:          spec.Profile,
+	})
+}
+
+func specFor(k *model.Kube, p profile.Profile) ClusterSpec {
+	// ids and credentials are generated for a new cluster
+	p.ID = ""
+	p.User = ""
+	p.Password = ""
+	p.StaticAuth = profile.StaticAuth{}
+	p.GitOps.Password = ""
+	if p.CloudSpecificSettings != nil {
+		settings := make(profile.CloudSpecificSettings, len(p.CloudSpecificSettings))
+		for key, v := range p.CloudSpecificSettings {
+			if key != clouds.AwsSshBootstrapPrivateKey {
+				settings[key] = v
+			}
+		}
+		p.CloudSpecificSettings = settings
+	}
+
+	return ClusterSpec{
+		APIVersion:       SpecAPIVersion,
+		Kind:             SpecKind,
+		Name:             k.Name,
+		CloudAccountName: k.AccountName,
+		Profile:          p,
+	}
+}
+
+// profileFromKube restores a profile of clusters that have no profile saved.
+func profileFromKube(k *model.Kube) *profile.Profile {
+	p := &profile.Profile{
+		Provider:        k.Provider,
+		Region:          k.Region,
+		Zone:            k.Zone,
+		Arch:            k.Arch,
+		OperatingSystem: k.OperatingSystem,
+		UbuntuVersion:   k.OperatingSystemVersion,
+		DockerVersion:   k.DockerVersion,
+		K8SVersion:      k.K8SVersion,
+		K8SServicesCIDR: k.ServicesCIDR,
+		FlannelVersion:  k.Networking.Version,
+		NetworkType:     k.Networking.Type,
+		CIDR:            k.Networking.CIDR,
+		HelmVersion:     k.HelmVersion,
+		RBACEnabled:     k.RBACEnabled,
+		MasterProfiles:  make([]profile.NodeProfile, 0, len(k.Masters)),
+		NodesProfiles:   make([]profile.NodeProfile, 0, len(k.Nodes)),
+	}
+
+	// cloud spec of a kube mostly holds resources created during provisioning,
+	// a new cluster must get its own ones
+	if az := k.CloudSpec[clouds.AwsAZ]; az != "" {
+		p.CloudSpecificSettings = profile.CloudSpecificSettings{
+			clouds.AwsAZ: az,
+		}
+	}
+
+	for _, m := range sortedMachines(k.Masters) {
+		p.MasterProfiles = append(p.MasterProfiles, profile.NodeProfile{"size": m.Size})
+	}
+	for _, m := range sortedMachines(k.Nodes) {
+		p.NodesProfiles = append(p.NodesProfiles, profile.NodeProfile{"size": m.Size})
+	}
+
+	return p
+}
+
+func sortedMachines(machines map[string]*model.Machine) []*model.Machine {
+	out := make([]*model.Machine, 0, len(machines))
+	for _, m := range machines {
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
@@ -0,0 +1,165 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestHandler_ExportSpec(t *testing.T) {
+	kube := &model.Kube{
+		ID:          "kube",
+		Name:        "staging",
+		AccountName: "aws-dev",
+		ProfileID:   "profile",
+		Provider:    clouds.AWS,
+		Region:      "us-west-2",
+		K8SVersion:  "1.14.1",
+		CloudSpec: profile.CloudSpecificSettings{
+			clouds.AwsAZ:                     "us-west-2a",
+			clouds.AwsVpcID:                  "vpc-1",
+			clouds.AwsSshBootstrapPrivateKey: "private",
+		},
+		Masters: map[string]*model.Machine{
+			"master": {Name: "master", Size: "m4.large"},
+		},
+		Nodes: map[string]*model.Machine{
+			"node-b": {Name: "node-b", Size: "m4.xlarge"},
+			"node-a": {Name: "node-a", Size: "m4.large"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name         string
+		kubeErr      error
+		profile      *profile.Profile
+		profileErr   error
+		expectedCode int
+		check        func(*testing.T, ClusterSpec)
+	}{
+		{
+			name:         "kube not found",
+			kubeErr:      sgerrors.ErrNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "stored profile",
+			profile: &profile.Profile{
+				ID:         "profile",
+				Provider:   clouds.AWS,
+				K8SVersion: "1.14.1",
+				Password:   "secret",
+				GitOps:     profile.GitOpsSettings{Tool: "flux", Password: "token"},
+				CloudSpecificSettings: profile.CloudSpecificSettings{
+					clouds.AwsAZ:                     "us-west-2b",
+					clouds.AwsSshBootstrapPrivateKey: "private",
+				},
+				MasterProfiles: []profile.NodeProfile{{"size": "m4.large"}},
+			},
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, spec ClusterSpec) {
+				require.Equal(t, "staging", spec.Name)
+				require.Equal(t, "aws-dev", spec.CloudAccountName)
+				require.Empty(t, spec.Profile.ID)
+				require.Empty(t, spec.Profile.Password)
+				require.Empty(t, spec.Profile.GitOps.Password)
+				require.Equal(t, "flux", spec.Profile.GitOps.Tool)
+				require.Equal(t, profile.CloudSpecificSettings{clouds.AwsAZ: "us-west-2b"},
+					spec.Profile.CloudSpecificSettings)
+			},
+		},
+		{
+			name:         "profile from kube",
+			profileErr:   sgerrors.ErrNotFound,
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, spec ClusterSpec) {
+				require.Equal(t, clouds.AWS, spec.Profile.Provider)
+				require.Equal(t, "1.14.1", spec.Profile.K8SVersion)
+				require.Equal(t, profile.CloudSpecificSettings{clouds.AwsAZ: "us-west-2a"},
+					spec.Profile.CloudSpecificSettings)
+				require.Equal(t, []profile.NodeProfile{{"size": "m4.large"}}, spec.Profile.MasterProfiles)
+				require.Equal(t, []profile.NodeProfile{{"size": "m4.large"}, {"size": "m4.xlarge"}},
+					spec.Profile.NodesProfiles)
+			},
+		},
+	} {
+		profileSvc := &mockProfileCreator{}
+		profileSvc.On("Get", mock.Anything, "profile").Return(tc.profile, tc.profileErr)
+
+		h := &Handler{
+			kubeGetter: &mockKubeGetter{
+				get: func(context.Context, string) (*model.Kube, error) {
+					return kube, tc.kubeErr
+				},
+			},
+			profileService: profileSvc,
+		}
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kubes/kube/spec", nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+
+		if tc.check != nil {
+			spec := ClusterSpec{}
+			require.NoError(t, yaml.Unmarshal(rec.Body.Bytes(), &spec), "TC: %s", tc.name)
+			require.Equal(t, SpecAPIVersion, spec.APIVersion)
+			require.Equal(t, SpecKind, spec.Kind)
+			tc.check(t, spec)
+		}
+	}
+}
+
+func TestHandler_CreateFromSpec(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid yaml",
+			body:         "name: [",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "wrong kind",
+			body:         "apiVersion: supergiant.io/v1\nkind: Profile\nname: test",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid cluster name",
+			body:         "apiVersion: supergiant.io/v1\nkind: Cluster\nname: bad_name",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "account not found",
+			body:         "apiVersion: supergiant.io/v1\nkind: Cluster\nname: test\ncloudAccountName: acc\n",
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		h := &Handler{
+			accountGetter: &mockAccountGetter{
+				get: func(context.Context, string) (*model.CloudAccount, error) {
+					return nil, sgerrors.ErrNotFound
+				},
+			},
+		}
+
+		rec := httptest.NewRecorder()
+		h.CreateFromSpec(rec, httptest.NewRequest(http.MethodPost, "/kubes/spec", strings.NewReader(tc.body)))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+	}
+}
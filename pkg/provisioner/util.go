@@ -35,12 +35,21 @@ func (r *RateLimiter) Take() {
 	<-r.bucket.C
 }
 
+// SetInterval changes the interval, callers blocked in Take get the
+// next tick according to the new interval.
+func (r *RateLimiter) SetInterval(interval time.Duration) {
+	r.bucket.Reset(interval)
+}
+
 // Fill cloud account specific data gets data from the map and puts to particular cloud provider config
 func FillNodeCloudSpecificData(provider clouds.Name, nodeProfile profile.NodeProfile, config *steps.Config) error {
 	switch provider {
 	case clouds.AWS:
+		// profiles without disks take default ones, not disks of the previous profile
+		config.AWSConfig.VolumeType, config.AWSConfig.DataVolumes = "", ""
 		return util.BindParams(nodeProfile, &config.AWSConfig)
 	case clouds.GCE:
+		config.GCEConfig.VolumeSize, config.GCEConfig.VolumeType, config.GCEConfig.DataVolumes = "", "", ""
 		return util.BindParams(nodeProfile, &config.GCEConfig)
 	case clouds.DigitalOcean:
 		return util.BindParams(nodeProfile, &config.DigitalOceanConfig)
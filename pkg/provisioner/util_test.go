@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/ssh"
@@ -45,6 +46,23 @@ ftubvUfbIYGZDXxwqpBifsVm22U3lTggt1MSzSFzUaS6RkvOw+wW2g==
 	expectedPublicKey = `ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDB2ckfv5rVySSq7p9ziEt+waU28aFGo9VNGr9gottC7dew2N+ggLj7DzUUAEI2809qPBxNFN9C/rC2aP+brS8jcvInbcMxOHK/QzxzOSDjQQOfq5tQ451HshkCqRFtz5cIRgrn/yLaPZ+4dr+gspsgu8qvTGZIb8zCyjVPZsfhg70Z8Ql+1kn+1KTljOlvQ6jlxZvZX3o68kMb8wRvkFc8ps4xTyeCfHaCqz6OHWnV9DCtvQYmMmADzezJKOvwAeR6Uf1A1Lwe+B8eUvxtfaeYUZ5pWtHFFfOykmd03Xk0pRYAwtSC9ZWeje6WooyTMf56ErpIUK4qgXmJzG2oHHjD`
 )
 
+func TestRateLimiter_SetInterval(t *testing.T) {
+	r := NewRateLimiter(time.Hour)
+	r.SetInterval(time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		r.Take()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("rate limiter must use the new interval")
+	}
+}
+
 func TestNodesFromProfile(t *testing.T) {
 	region := "fra1"
 
@@ -153,3 +171,31 @@ func TestGrabTaskIds(t *testing.T) {
 			len(masterTasks)+len(nodeTasks)+1, len(taskIds))
 	}
 }
+
+func TestFillNodeCloudSpecificDataDisks(t *testing.T) {
+	config := &steps.Config{}
+
+	err := FillNodeCloudSpecificData(clouds.AWS, profile.NodeProfile{
+		"size":                 "m5.large",
+		profile.VolumeTypeKey:  "gp3",
+		profile.DataVolumesKey: "100::/data",
+	}, config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if config.AWSConfig.VolumeType != "gp3" || config.AWSConfig.DataVolumes != "100::/data" {
+		t.Errorf("disks of the profile are not bound %+v", config.AWSConfig)
+	}
+
+	err = FillNodeCloudSpecificData(clouds.AWS, profile.NodeProfile{
+		"size": "m5.xlarge",
+	}, config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if config.AWSConfig.VolumeType != "" || config.AWSConfig.DataVolumes != "" {
+		t.Errorf("disks of the previous profile must be reset %+v", config.AWSConfig)
+	}
+}
@@ -0,0 +1,417 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/asaskevich/govalidator.v8"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/versions"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/provider"
+)
+
+const (
+	CheckSchema      = "schema"
+	CheckCredentials = "credentials"
+	CheckQuota       = "quota"
+	CheckCIDR        = "cidr"
+	CheckName        = "name"
+	CheckVersion     = "version"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a single problem of a provision request.
+type Finding struct {
+	Check    string `json:"check"`
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport is a result of a dry validation, the request
+// can be provisioned when it's valid, warnings don't block it.
+type ValidationReport struct {
+	Valid    bool      `json:"valid"`
+	Findings []Finding `json:"findings"`
+}
+
+func (r *ValidationReport) add(check, field, severity, format string, args ...interface{}) {
+	if severity == SeverityError {
+		r.Valid = false
+	}
+	r.Findings = append(r.Findings, Finding{
+		Check:    check,
+		Field:    field,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate runs all checks of the provision request without creating anything.
+func (h *Handler) Validate(w http.ResponseWriter, r *http.Request) {
+	req := &ProvisionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	report := h.validate(r.Context(), req)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logrus.Errorf("provisioner: validate: write response: %v", err)
+	}
+}
+
+func (h *Handler) validate(ctx context.Context, req *ProvisionRequest) *ValidationReport {
+	report := &ValidationReport{
+		Valid:    true,
+		Findings: make([]Finding, 0),
+	}
+
+	validateSchema(req, report)
+	if !h.providerEnabled(ctx, req.Profile.Provider) {
+		report.add(CheckSchema, "profile.provider", SeverityError,
+			"provider %s is not enabled", req.Profile.Provider)
+	}
+	h.validateVersion(ctx, req, report)
+	validateCIDRs(req, h.ipamEnabled(ctx), report)
+	validateEgress(req, report)
+	validateCost(req, report)
+	validateHardening(req, report)
+	validateDisks(req, report)
+	validateSpreadMasters(req, report)
+	validateAPIServerAccess(req, report)
+	validateDashboard(req, report)
+	h.validateName(ctx, req, report)
+	h.validateAccount(ctx, req, report)
+
+	return report
+}
+
+func validateSchema(req *ProvisionRequest, report *ValidationReport) {
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		if errs, ok := err.(govalidator.Errors); ok {
+			for _, e := range errs.Errors() {
+				field := ""
+				if fieldErr, ok := e.(govalidator.Error); ok {
+					field = fieldErr.Name
+				}
+				report.add(CheckSchema, field, SeverityError, "%v", e)
+			}
+		} else {
+			report.add(CheckSchema, "", SeverityError, "%v", err)
+		}
+	}
+
+	if req.ClusterName == "" {
+		report.add(CheckSchema, "clusterName", SeverityError, "cluster name is required")
+	}
+	if req.CloudAccountName == "" {
+		report.add(CheckSchema, "cloudAccountName", SeverityError, "cloud account name is required")
+	}
+
+	p := req.Profile
+	if len(p.MasterProfiles) == 0 {
+		report.add(CheckSchema, "profile.masterProfiles", SeverityError, "at least one master is required")
+	} else if len(p.MasterProfiles)%2 == 0 {
+		report.add(CheckSchema, "profile.masterProfiles", SeverityWarning,
+			"even number of masters doesn't improve etcd fault tolerance")
+	}
+	if p.Region == "" && p.Provider != clouds.GCE {
+		report.add(CheckSchema, "profile.region", SeverityError, "region is required")
+	}
+	if p.K8SVersion == "" {
+		report.add(CheckSchema, "profile.K8SVersion", SeverityError, "kubernetes version is required")
+	}
+	if p.Provider == "" {
+		report.add(CheckSchema, "profile.provider", SeverityError, "provider is required")
+	}
+}
+
+// validateCIDRs checks ranges of the request, allocated tells that
+// empty ranges are assigned by ipam.
+func validateCIDRs(req *ProvisionRequest, allocated bool, report *ValidationReport) {
+	servicesCIDR := req.Profile.K8SServicesCIDR
+	if servicesCIDR == "" && !allocated {
+		servicesCIDR = DefaultK8SServicesCIDR
+	}
+
+	cidrs := []struct {
+		field string
+		value string
+	}{
+		{"profile.cidr", req.Profile.CIDR},
+		{"profile.k8sServicesCIDR", servicesCIDR},
+		{"profile.cloudSpecificSettings." + clouds.AwsVpcCIDR, req.Profile.CloudSpecificSettings[clouds.AwsVpcCIDR]},
+	}
+
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		if c.value == "" {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(c.value)
+		if err != nil {
+			report.add(CheckCIDR, c.field, SeverityError, "invalid cidr %s", c.value)
+			continue
+		}
+		nets[i] = ipNet
+	}
+
+	if req.Profile.CIDR == "" && !allocated {
+		report.add(CheckCIDR, "profile.cidr", SeverityError, "pod network cidr is required")
+	}
+
+	for i := range nets {
+		for j := i + 1; j < len(nets); j++ {
+			if nets[i] == nil || nets[j] == nil {
+				continue
+			}
+			if nets[i].Contains(nets[j].IP) || nets[j].Contains(nets[i].IP) {
+				report.add(CheckCIDR, cidrs[j].field, SeverityError, "%s overlaps with %s",
+					cidrs[j].value, cidrs[i].value)
+			}
+		}
+	}
+}
+
+// validateEgress checks destinations of the nat gateway, only aws clusters have one.
+func validateEgress(req *ProvisionRequest, report *ValidationReport) {
+	egress := req.Profile.Egress
+	if !egress.Enabled {
+		return
+	}
+
+	if !provider.EgressSupported(req.Profile.Provider) {
+		report.add(CheckSchema, "profile.egress", SeverityError,
+			"egress addresses are not supported by %s", req.Profile.Provider)
+	}
+	if len(egress.Destinations) == 0 {
+		report.add(CheckSchema, "profile.egress.destinations", SeverityError,
+			"at least one destination is required")
+	}
+	for _, dst := range egress.Destinations {
+		if _, _, err := net.ParseCIDR(dst); err != nil {
+			report.add(CheckCIDR, "profile.egress.destinations", SeverityError, "invalid cidr %s", dst)
+		}
+	}
+}
+
+// validateCost checks cost center tags and the budget, only azure clusters
+// have a budget.
+func validateCost(req *ProvisionRequest, report *ValidationReport) {
+	cost := req.Profile.Cost
+	for name := range cost.Tags {
+		if name == "" || strings.ContainsAny(name, `<>%&\?/`) {
+			report.add(CheckSchema, "profile.cost.tags", SeverityError, "invalid tag name %q", name)
+		}
+	}
+
+	budget := cost.Budget
+	if budget.Amount == 0 {
+		return
+	}
+	if !provider.BudgetsSupported(req.Profile.Provider) {
+		report.add(CheckSchema, "profile.cost.budget", SeverityError,
+			"budgets are not supported by %s", req.Profile.Provider)
+	}
+	if budget.Amount < 0 {
+		report.add(CheckSchema, "profile.cost.budget.amount", SeverityError, "amount must be positive")
+	}
+	for _, t := range budget.Thresholds {
+		if t <= 0 || t > 1000 {
+			report.add(CheckSchema, "profile.cost.budget.thresholds", SeverityError,
+				"threshold %v is not in (0, 1000] percent", t)
+		}
+	}
+}
+
+// validateHardening checks that machines of the provider can be hardened.
+func validateHardening(req *ProvisionRequest, report *ValidationReport) {
+	h := req.Profile.Hardening
+	if !h.MetadataTokensRequired && !h.EncryptVolumes && !h.RestrictedInstanceProfiles {
+		return
+	}
+	if !provider.HardeningSupported(req.Profile.Provider) {
+		report.add(CheckSchema, "profile.hardening", SeverityError,
+			"hardening is not supported by %s", req.Profile.Provider)
+	}
+}
+
+func validateSpreadMasters(req *ProvisionRequest, report *ValidationReport) {
+	if !req.Profile.SpreadMasters {
+		return
+	}
+	if !provider.SpreadMastersSupported(req.Profile.Provider) {
+		report.add(CheckSchema, "profile.spreadMasters", SeverityError,
+			"spreading masters is not supported by %s", req.Profile.Provider)
+	}
+}
+
+// validateDisks checks root disks and data volumes of master and node profiles.
+func validateDisks(req *ProvisionRequest, report *ValidationReport) {
+	check := func(field string, p profile.NodeProfile) {
+		if size, ok := p[profile.VolumeSizeKey]; ok && size != "" {
+			if n, err := strconv.Atoi(size); err != nil || n <= 0 {
+				report.add(CheckSchema, field+"."+profile.VolumeSizeKey, SeverityError,
+					"volume size %q must be a positive number of gigabytes", size)
+			}
+		}
+
+		if p[profile.VolumeTypeKey] == "" && p[profile.DataVolumesKey] == "" {
+			return
+		}
+		if !provider.DataVolumesSupported(req.Profile.Provider) {
+			report.add(CheckSchema, field, SeverityError,
+				"volume types and data volumes are not supported by %s", req.Profile.Provider)
+			return
+		}
+		if _, err := profile.ParseDataVolumes(p[profile.DataVolumesKey]); err != nil {
+			report.add(CheckSchema, field+"."+profile.DataVolumesKey, SeverityError, "%v", err)
+		}
+	}
+
+	for i, p := range req.Profile.MasterProfiles {
+		check(fmt.Sprintf("profile.masterProfiles[%d]", i), p)
+	}
+	for i, p := range req.Profile.NodesProfiles {
+		check(fmt.Sprintf("profile.nodesProfiles[%d]", i), p)
+	}
+}
+
+// validateAPIServerAccess checks the allow-list of the api server.
+func validateAPIServerAccess(req *ProvisionRequest, report *ValidationReport) {
+	for _, cidr := range req.Profile.APIServerAllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			report.add(CheckCIDR, "profile.apiServerAllowedCidrs", SeverityError, "invalid cidr %s", cidr)
+		}
+	}
+}
+
+// validateDashboard checks that the dashboard tool is known.
+func validateDashboard(req *ProvisionRequest, report *ValidationReport) {
+	tool := req.Profile.Dashboard.Tool
+	if tool == "" {
+		return
+	}
+	if steps.NewDashboardConfig(req.Profile.Dashboard).Service == "" {
+		report.add(CheckSchema, "profile.dashboard.tool", SeverityError,
+			"unknown dashboard %s, use %s or %s", tool, steps.DashboardKubernetes, steps.DashboardHeadlamp)
+	}
+}
+
+func (h *Handler) validateName(ctx context.Context, req *ProvisionRequest, report *ValidationReport) {
+	if req.ClusterName == "" {
+		return
+	}
+
+	kubes, err := h.kubeGetter.ListAll(ctx)
+	if err != nil {
+		report.add(CheckName, "clusterName", SeverityWarning, "can't check uniqueness: %v", err)
+		return
+	}
+
+	for _, k := range kubes {
+		// renamed clusters are shown with their display names
+		if k.Name == req.ClusterName || k.DisplayName == req.ClusterName {
+			report.add(CheckName, "clusterName", SeverityError, "cluster %s already exists", req.ClusterName)
+			return
+		}
+	}
+}
+
+func (h *Handler) validateAccount(ctx context.Context, req *ProvisionRequest, report *ValidationReport) {
+	if req.CloudAccountName == "" {
+		return
+	}
+
+	acc, err := h.accountGetter.Get(ctx, req.CloudAccountName)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			report.add(CheckCredentials, "cloudAccountName", SeverityError,
+				"cloud account %s not found", req.CloudAccountName)
+			return
+		}
+		report.add(CheckCredentials, "cloudAccountName", SeverityWarning, "can't get cloud account: %v", err)
+		return
+	}
+
+	if req.Profile.Provider != "" && acc.Provider != req.Profile.Provider {
+		report.add(CheckCredentials, "profile.provider", SeverityError,
+			"cloud account %s belongs to %s", acc.Name, acc.Provider)
+		return
+	}
+
+	if err = h.validator.ValidateCredentials(acc); err != nil {
+		report.add(CheckCredentials, "cloudAccountName", SeverityError, "invalid credentials: %v", err)
+		return
+	}
+
+	machines := len(req.Profile.MasterProfiles) + len(req.Profile.NodesProfiles)
+	available, err := h.quota.AvailableMachines(ctx, acc, req.Profile.Region)
+	if err != nil {
+		if err == sgerrors.ErrUnsupportedProvider {
+			report.add(CheckQuota, "", SeverityWarning, "quota check is not supported for %s", acc.Provider)
+		} else {
+			report.add(CheckQuota, "", SeverityWarning, "can't check quota: %v", err)
+		}
+		return
+	}
+	if machines > available {
+		report.add(CheckQuota, "profile", SeverityError,
+			"%d machines requested, but only %d can be created", machines, available)
+	}
+}
+
+// validateVersion blocks kubernetes versions past their end of life unless
+// the tenant allows them, versions missing from the catalog are untested.
+func (h *Handler) validateVersion(ctx context.Context, req *ProvisionRequest, report *ValidationReport) {
+	p := req.Profile
+	if h.versions == nil || p.K8SVersion == "" {
+		return
+	}
+
+	catalog, err := h.versions.Catalog(ctx)
+	if err != nil {
+		logrus.Warnf("provisioner: get version catalog: %v", err)
+		report.add(CheckVersion, "profile.K8SVersion", SeverityWarning,
+			"kubernetes version %s can't be checked", p.K8SVersion)
+		return
+	}
+
+	v, ok := catalog.Find(p.Provider, p.K8SVersion)
+	if !ok {
+		report.add(CheckVersion, "profile.K8SVersion", SeverityWarning,
+			"kubernetes version %s is not in the catalog of %s", p.K8SVersion, p.Provider)
+		return
+	}
+
+	switch v.StatusAt(time.Now()) {
+	case versions.StatusEOL:
+		severity := SeverityError
+		if h.features != nil && h.features.Enabled(ctx, featureflag.AllowEOLVersions) {
+			severity = SeverityWarning
+		}
+		report.add(CheckVersion, "profile.K8SVersion", severity,
+			"kubernetes version %s has reached end of life on %s", p.K8SVersion, v.EOL.Format("2006-01-02"))
+	case versions.StatusEOLSoon:
+		report.add(CheckVersion, "profile.K8SVersion", SeverityWarning,
+			"kubernetes version %s reaches end of life on %s", p.K8SVersion, v.EOL.Format("2006-01-02"))
+	}
+}
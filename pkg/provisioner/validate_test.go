@@ -0,0 +1,420 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/featureflag"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/versions"
+)
+
+type fakeValidator struct {
+	err error
+}
+
+func (f *fakeValidator) ValidateCredentials(*model.CloudAccount) error {
+	return f.err
+}
+
+type fakeQuota struct {
+	available int
+	err       error
+}
+
+func (f *fakeQuota) AvailableMachines(context.Context, *model.CloudAccount, string) (int, error) {
+	return f.available, f.err
+}
+
+type fakeFeatures map[string]bool
+
+func (f fakeFeatures) Enabled(_ context.Context, name string) bool {
+	return f[name]
+}
+
+type fakeCatalog struct {
+	catalog versions.Catalog
+	err     error
+}
+
+func (f *fakeCatalog) Catalog(context.Context) (*versions.Catalog, error) {
+	return &f.catalog, f.err
+}
+
+func validRequest() ProvisionRequest {
+	return ProvisionRequest{
+		ClusterName:      "test",
+		CloudAccountName: "acc",
+		Profile: profile.Profile{
+			Provider:       clouds.DigitalOcean,
+			Region:         "fra1",
+			K8SVersion:     "1.14.1",
+			CIDR:           "10.0.0.0/16",
+			MasterProfiles: []profile.NodeProfile{{"size": "s-2vcpu-4gb"}},
+			NodesProfiles:  []profile.NodeProfile{{"size": "s-2vcpu-4gb"}},
+		},
+	}
+}
+
+func TestHandler_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		body           string
+		modify         func(*ProvisionRequest)
+		kubes          []model.Kube
+		accountErr     error
+		credsErr       error
+		quota          fakeQuota
+		features       fakeFeatures
+		versions       VersionCatalog
+		expectedCode   int
+		expectedValid  bool
+		expectedChecks []string
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:          "valid",
+			quota:         fakeQuota{available: 10},
+			expectedCode:  http.StatusOK,
+			expectedValid: true,
+		},
+		{
+			name: "schema",
+			modify: func(req *ProvisionRequest) {
+				req.ClusterName = "bad_name"
+				req.Profile.MasterProfiles = nil
+				req.Profile.K8SVersion = ""
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckSchema, CheckSchema},
+		},
+		{
+			name: "even masters is a warning",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.MasterProfiles = append(req.Profile.MasterProfiles, profile.NodeProfile{})
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckSchema},
+		},
+		{
+			name: "overlapping cidrs",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.K8SServicesCIDR = "10.0.1.0/24"
+				req.Profile.CloudSpecificSettings = profile.CloudSpecificSettings{
+					clouds.AwsVpcCIDR: "invalid",
+				}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCIDR, CheckCIDR},
+		},
+		{
+			name: "egress",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Egress = profile.EgressSettings{
+					Enabled:      true,
+					Destinations: []string{"203.0.113.0/24", "invalid"},
+				}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckCIDR},
+		},
+		{
+			name: "budget isn't supported",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Cost = profile.CostSettings{
+					Tags: map[string]string{"costCenter": "ml", "team/name": "data"},
+					Budget: profile.BudgetSettings{
+						Amount:     100,
+						Thresholds: []float64{80, 0},
+					},
+				}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckSchema, CheckSchema},
+		},
+		{
+			name: "azure budget",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.Azure
+				req.Profile.Cost = profile.CostSettings{
+					Tags:   map[string]string{"costCenter": "ml"},
+					Budget: profile.BudgetSettings{Amount: 100, Thresholds: []float64{80, 100}},
+				}
+			},
+			features:       fakeFeatures{featureflag.ProviderAzure: true},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name: "hardening isn't supported",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.Azure
+				req.Profile.Hardening = profile.HardeningSettings{MetadataTokensRequired: true}
+			},
+			features:       fakeFeatures{featureflag.ProviderAzure: true},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckCredentials},
+		},
+		{
+			name: "wrong data volumes",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.AWS
+				req.Profile.NodesProfiles = []profile.NodeProfile{{
+					profile.VolumeSizeKey:  "50",
+					profile.DataVolumesKey: "100:gp3:data",
+				}}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckCredentials},
+		},
+		{
+			name: "data volumes",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.AWS
+				req.Profile.NodesProfiles = []profile.NodeProfile{{
+					profile.VolumeSizeKey:  "50",
+					profile.VolumeTypeKey:  "gp3",
+					profile.DataVolumesKey: "100:gp3:/var/lib/docker",
+				}}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name: "data volumes aren't supported",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.Azure
+				req.Profile.NodesProfiles = []profile.NodeProfile{{
+					profile.DataVolumesKey: "100::/data",
+				}}
+			},
+			features:       fakeFeatures{featureflag.ProviderAzure: true},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckCredentials},
+		},
+		{
+			name: "spread masters aren't supported",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.SpreadMasters = true
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema},
+		},
+		{
+			name: "spread masters",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.AWS
+				req.Profile.SpreadMasters = true
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name: "api server allow-list",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.APIServerAllowedCIDRs = []string{"203.0.113.0/24", "203.0.113.1"}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCIDR},
+		},
+		{
+			name: "unknown dashboard",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Dashboard = profile.DashboardSettings{Tool: "octant"}
+			},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema},
+		},
+		{
+			name:           "name is taken",
+			kubes:          []model.Kube{{Name: "test"}},
+			quota:          fakeQuota{available: 10},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckName},
+		},
+		{
+			name:           "account not found",
+			accountErr:     sgerrors.ErrNotFound,
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name: "provider mismatch",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.AWS
+			},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name: "experimental provider is disabled",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.Azure
+			},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckSchema, CheckCredentials},
+		},
+		{
+			name: "experimental provider is enabled",
+			modify: func(req *ProvisionRequest) {
+				req.Profile.Provider = clouds.Azure
+			},
+			features:       fakeFeatures{featureflag.ProviderAzure: true},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name:           "invalid credentials",
+			credsErr:       errors.New("unauthorized"),
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckCredentials},
+		},
+		{
+			name:           "quota exceeded",
+			quota:          fakeQuota{available: 1},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckQuota},
+		},
+		{
+			name:           "quota is not supported",
+			quota:          fakeQuota{err: sgerrors.ErrUnsupportedProvider},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckQuota},
+		},
+		{
+			name:          "supported version",
+			quota:         fakeQuota{available: 10},
+			versions:      &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{{Version: "1.14.1"}}}},
+			expectedCode:  http.StatusOK,
+			expectedValid: true,
+		},
+		{
+			name:           "version isn't in the catalog",
+			quota:          fakeQuota{available: 10},
+			versions:       &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{{Version: "1.15.3"}}}},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckVersion},
+		},
+		{
+			name:  "version isn't supported on the provider",
+			quota: fakeQuota{available: 10},
+			versions: &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{
+				{Version: "1.14.1", Providers: []clouds.Name{clouds.AWS}},
+			}}},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckVersion},
+		},
+		{
+			name:           "catalog error",
+			quota:          fakeQuota{available: 10},
+			versions:       &fakeCatalog{err: errors.New("storage")},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckVersion},
+		},
+		{
+			name:  "version reaches end of life",
+			quota: fakeQuota{available: 10},
+			versions: &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{
+				{Version: "1.14.1", EOL: time.Now().Add(24 * time.Hour)},
+			}}},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckVersion},
+		},
+		{
+			name:  "end of life version",
+			quota: fakeQuota{available: 10},
+			versions: &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{
+				{Version: "1.14.1", EOL: time.Now().Add(-time.Hour)},
+			}}},
+			expectedCode:   http.StatusOK,
+			expectedChecks: []string{CheckVersion},
+		},
+		{
+			name:     "end of life version is allowed",
+			quota:    fakeQuota{available: 10},
+			features: fakeFeatures{featureflag.AllowEOLVersions: true},
+			versions: &fakeCatalog{catalog: versions.Catalog{Versions: []versions.Version{
+				{Version: "1.14.1", EOL: time.Now().Add(-time.Hour)},
+			}}},
+			expectedCode:   http.StatusOK,
+			expectedValid:  true,
+			expectedChecks: []string{CheckVersion},
+		},
+	} {
+		body := []byte(tc.body)
+		if tc.body == "" {
+			req := validRequest()
+			if tc.modify != nil {
+				tc.modify(&req)
+			}
+			body, _ = json.Marshal(req)
+		}
+
+		quota := tc.quota
+		h := &Handler{
+			kubeGetter: &mockKubeGetter{
+				listAll: func(context.Context) ([]model.Kube, error) {
+					return tc.kubes, nil
+				},
+			},
+			accountGetter: &mockAccountGetter{
+				get: func(context.Context, string) (*model.CloudAccount, error) {
+					return &model.CloudAccount{Name: "acc", Provider: clouds.DigitalOcean}, tc.accountErr
+				},
+			},
+			validator: &fakeValidator{err: tc.credsErr},
+			quota:     &quota,
+			features:  tc.features,
+			versions:  tc.versions,
+		}
+
+		rec := httptest.NewRecorder()
+		h.Validate(rec, httptest.NewRequest(http.MethodPost, "/kubes/validate", bytes.NewReader(body)))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		report := &ValidationReport{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(report), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedValid, report.Valid, "TC: %s: %+v", tc.name, report.Findings)
+
+		checks := make([]string, 0, len(report.Findings))
+		for _, f := range report.Findings {
+			checks = append(checks, f.Check)
+		}
+		require.ElementsMatch(t, tc.expectedChecks, checks, "TC: %s: %+v", tc.name, report.Findings)
+	}
+}
@@ -0,0 +1,154 @@
+package replacement
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// Servicer is an interface of the replacement service.
+type Servicer interface {
+	Create(ctx context.Context, req *Request) (*Replacement, error)
+	Get(ctx context.Context, id string) (*Replacement, error)
+	List(ctx context.Context) ([]Replacement, error)
+	Delete(ctx context.Context, id string) error
+	Advance(ctx context.Context, id string) (*Replacement, error)
+	Resume(ctx context.Context, id string) (*Replacement, error)
+	EndSoak(ctx context.Context, id string) (*Replacement, error)
+}
+
+// Handler is a http handler for replacements of clusters, stages are run
+// in the background and the replacement reflects the progress.
+type Handler struct {
+	svc Servicer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// Register adds replacement handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/replacements", h.createReplacement).Methods(http.MethodPost)
+	r.HandleFunc("/replacements", h.listReplacements).Methods(http.MethodGet)
+	r.HandleFunc("/replacements/{id}", h.getReplacement).Methods(http.MethodGet)
+	r.HandleFunc("/replacements/{id}", h.deleteReplacement).Methods(http.MethodDelete)
+	r.HandleFunc("/replacements/{id}/resume", h.resumeReplacement).Methods(http.MethodPost)
+	r.HandleFunc("/replacements/{id}/retire", h.retireSource).Methods(http.MethodPost)
+}
+
+func (h *Handler) createReplacement(w http.ResponseWriter, r *http.Request) {
+	req := &Request{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	rp, err := h.svc.Create(r.Context(), req)
+	if err != nil {
+		logrus.Errorf("replacement: create for %s: %v", req.SourceID, err)
+		sendError(w, err)
+		return
+	}
+
+	h.advance(r.Context(), rp.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(rp); err != nil {
+		logrus.Errorf("replacement: encode %s: %v", rp.ID, err)
+	}
+}
+
+func (h *Handler) listReplacements(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.List(r.Context())
+	if err != nil {
+		logrus.Errorf("replacement: list: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getReplacement(w http.ResponseWriter, r *http.Request) {
+	rp, err := h.svc.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(rp); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// deleteReplacement forgets a finished or failed replacement.
+func (h *Handler) deleteReplacement(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resumeReplacement runs the failed stage again.
+func (h *Handler) resumeReplacement(w http.ResponseWriter, r *http.Request) {
+	h.change(w, r, h.svc.Resume)
+}
+
+// retireSource ends the soak period, the source cluster is retired right away.
+func (h *Handler) retireSource(w http.ResponseWriter, r *http.Request) {
+	h.change(w, r, h.svc.EndSoak)
+}
+
+func (h *Handler) change(w http.ResponseWriter, r *http.Request,
+	fn func(ctx context.Context, id string) (*Replacement, error)) {
+	rp, err := fn(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	h.advance(r.Context(), rp.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(rp); err != nil {
+		logrus.Errorf("replacement: encode %s: %v", rp.ID, err)
+	}
+}
+
+func (h *Handler) advance(ctx context.Context, id string) {
+	ctx = tenant.Detach(ctx)
+	go func() {
+		if _, err := h.svc.Advance(ctx, id); err != nil && errors.Cause(err) != ErrBusy {
+			logrus.Errorf("replacement %s: %v", id, err)
+		}
+	}()
+}
+
+func sendError(w http.ResponseWriter, err error) {
+	switch cause := errors.Cause(err); {
+	case sgerrors.IsNotFound(err):
+		message.SendNotFound(w, "replacement", err)
+	case cause == ErrBusy || cause == ErrState || sgerrors.IsAlreadyExists(err):
+		message.SendAlreadyExists(w, "replacement", err)
+	case cause == sgerrors.ErrInvalidJson:
+		message.SendValidationFailed(w, err)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
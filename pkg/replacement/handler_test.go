@@ -0,0 +1,110 @@
+package replacement
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+)
+
+func TestHandler(t *testing.T) {
+	svc, kubes, _, _ := newTestService()
+	router := mux.NewRouter()
+	NewHandler(svc).Register(router)
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, url, bytes.NewBufferString(body)))
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "no dns zone",
+			body:         `{"sourceId":"imported","dnsName":"api"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			body:         `{"sourceId":"missing"}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "accepted",
+			body:         `{"sourceId":"source","dnsName":"api","soak":"1h"}`,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "replaced already",
+			body:         `{"sourceId":"source"}`,
+			expectedCode: http.StatusConflict,
+		},
+	} {
+		rec := serve(http.MethodPost, "/replacements", tc.body)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+
+	list, err := svc.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	id := list[0].ID
+
+	// provisioning is started in the background
+	var r *Replacement
+	for i := 0; i < 100; i++ {
+		if r, err = svc.Get(context.Background(), id); err == nil && r.TargetID != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, "target", r.TargetID)
+	kubes.setState("target", model.StateOperational)
+
+	rec := serve(http.MethodPost, "/replacements/"+id+"/resume", "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	for i := 0; i < 100; i++ {
+		if r, err = svc.Advance(context.Background(), id); err == nil && r.current().Name == StageSoak {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, StageSoak, r.current().Name)
+
+	rec = serve(http.MethodPost, "/replacements/"+id+"/retire", "")
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	for i := 0; i < 100; i++ {
+		if r, err = svc.Get(context.Background(), id); err == nil && r.State == StateDone {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, StateDone, r.State)
+
+	rec = serve(http.MethodGet, "/replacements/"+id, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(r))
+	require.Equal(t, StageDone, r.stage(StageRetire).State)
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/replacements/missing", "").Code)
+	require.Equal(t, http.StatusAccepted, serve(http.MethodDelete, "/replacements/"+id, "").Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/replacements/"+id, "").Code)
+}
@@ -0,0 +1,866 @@
+package replacement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/approval"
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/replacements/"
+
+	// DefaultSoak is a time the source cluster is kept after traffic
+	// has been moved to the target one.
+	DefaultSoak = 24 * time.Hour
+	// DefaultInterval is a period replacements are advanced with.
+	DefaultInterval = 30 * time.Second
+)
+
+type State string
+
+const (
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+type StageState string
+
+const (
+	StagePending StageState = "pending"
+	StageRunning StageState = "running"
+	StageDone    StageState = "done"
+	StageSkipped StageState = "skipped"
+	StageFailed  StageState = "failed"
+)
+
+// Stages of a replacement in the order they are run.
+const (
+	StageProvision = "provision"
+	StageVolumes   = "volumes"
+	StageReleases  = "releases"
+	StageDNS       = "dns"
+	StageSoak      = "soak"
+	StageRetire    = "retire"
+)
+
+var stageNames = []string{StageProvision, StageVolumes, StageReleases, StageDNS, StageSoak, StageRetire}
+
+var (
+	// ErrBusy is returned while the replacement is being advanced.
+	ErrBusy = errors.New("replacement is being updated")
+	// ErrState is returned for actions the replacement isn't ready for.
+	ErrState = errors.New("replacement is in another state")
+)
+
+// Request describes a replacement of the source cluster.
+type Request struct {
+	SourceID string `json:"sourceId"`
+	// TargetName is a name of the new cluster, <source>-<id> by default
+	TargetName string `json:"targetName"`
+	// Releases selects releases migrated to the target cluster, all by default
+	Releases kube.MigrationRequest `json:"releases"`
+	// Volumes are claims restored on the target cluster from snapshots,
+	// claims keep their names so migrated releases bind them
+	Volumes []kube.SnapshotRequest `json:"volumes"`
+	// DNSName is a record in the dns zone of the cluster, e.g. api, that is
+	// pointed to masters of the target cluster
+	DNSName string `json:"dnsName"`
+	// Soak is a time the source cluster is kept after the dns flip
+	Soak string `json:"soak"`
+	// KeepSource leaves the source cluster running after the soak
+	KeepSource bool `json:"keepSource"`
+}
+
+// Volume is a snapshot of a claim of the source cluster.
+type Volume struct {
+	kube.VolumeSnapshot
+	Restored bool `json:"restored"`
+}
+
+// Stage is a step of the replacement, tasks are workflows it has started.
+type Stage struct {
+	Name     string                `json:"name"`
+	State    StageState            `json:"state"`
+	Tasks    []string              `json:"tasks,omitempty"`
+	Volumes  []Volume              `json:"volumes,omitempty"`
+	Releases []kube.ReleaseOutcome `json:"releases,omitempty"`
+	// Approval is a request to delete the source cluster held for a user.
+	Approval   string    `json:"approval,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+}
+
+// Replacement moves workloads of a cluster to a new one provisioned from
+// the same profile and retires the old cluster, stages run one by one and
+// the replacement stops at the first failed stage.
+type Replacement struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenantId"`
+	SourceID  string    `json:"sourceId"`
+	TargetID  string    `json:"targetId"`
+	Request   Request   `json:"request"`
+	State     State     `json:"state"`
+	Stages    []Stage   `json:"stages"`
+	SoakUntil time.Time `json:"soakUntil,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (r *Replacement) stage(name string) *Stage {
+	for i := range r.Stages {
+		if r.Stages[i].Name == name {
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+// current returns the first stage that isn't finished.
+func (r *Replacement) current() *Stage {
+	for i := range r.Stages {
+		switch r.Stages[i].State {
+		case StagePending, StageRunning, StageFailed:
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+type KubeService interface {
+	Get(ctx context.Context, kubeID string) (*model.Kube, error)
+	Create(ctx context.Context, k *model.Kube) error
+	Delete(ctx context.Context, kubeID string) error
+	MigrateReleases(ctx context.Context, kubeID string, req *kube.MigrationRequest) (*kube.MigrationReport, error)
+	CreateSnapshots(ctx context.Context, kubeID string, req *kube.SnapshotRequest) ([]kube.VolumeSnapshot, error)
+	RestoreSnapshot(ctx context.Context, kubeID, ns, name string, req *kube.RestoreRequest) error
+}
+
+type ProfileService interface {
+	Get(ctx context.Context, id string) (*profile.Profile, error)
+	Create(ctx context.Context, p *profile.Profile) error
+}
+
+type AccountGetter interface {
+	Get(ctx context.Context, name string) (*model.CloudAccount, error)
+}
+
+type ClusterProvisioner interface {
+	ProvisionCluster(ctx context.Context, p *profile.Profile, cfg *steps.Config) (map[string][]*workflows.Task, error)
+}
+
+// Approvals holds deletions of clusters that must be approved by a user.
+type Approvals interface {
+	Policy(ctx context.Context) (*approval.Policy, error)
+	Request(ctx context.Context, a *approval.Approval) (*approval.Approval, error)
+	Get(ctx context.Context, id string) (*approval.Approval, error)
+}
+
+// runFn runs the workflow, waits for the result and returns the task id.
+type runFn func(ctx context.Context, workflow string, cfg *steps.Config) (string, error)
+
+// Service orchestrates blue/green replacements of clusters.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+
+	kubes       KubeService
+	profiles    ProfileService
+	accounts    AccountGetter
+	provisioner ClusterProvisioner
+	approvals   Approvals
+	run         runFn
+	now         func() time.Time
+
+	m    sync.Mutex
+	busy map[string]bool
+}
+
+// NewService constructs a Service, replacements of all tenants are kept
+// in the storage and tasks are saved to the taskRepo.
+func NewService(prefix string, s storage.Interface, kubes KubeService, profiles ProfileService,
+	accounts AccountGetter, provisioner ClusterProvisioner, taskRepo storage.Interface) *Service {
+	return &Service{
+		prefix:      prefix,
+		storage:     s,
+		kubes:       kubes,
+		profiles:    profiles,
+		accounts:    accounts,
+		provisioner: provisioner,
+		run:         taskRunner(taskRepo),
+		now:         time.Now,
+		busy:        make(map[string]bool),
+	}
+}
+
+// SetApprovals makes source clusters be retired through approvals when the
+// policy of the tenant requires them.
+func (s *Service) SetApprovals(a Approvals) {
+	s.approvals = a
+}
+
+// Create validates the request and saves the replacement, stages are run with Advance.
+func (s *Service) Create(ctx context.Context, req *Request) (*Replacement, error) {
+	if req.SourceID == "" {
+		return nil, errors.Wrap(sgerrors.ErrInvalidJson, "source cluster is required")
+	}
+	if _, err := parseSoak(req.Soak); err != nil {
+		return nil, err
+	}
+
+	source, err := s.kubes.Get(ctx, req.SourceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get kube %s", req.SourceID)
+	}
+	if source.State != model.StateOperational {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s is %s", source.ID, source.State)
+	}
+	if source.ExternallyManaged || source.ProfileID == "" {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s has no profile to provision a replacement from", source.ID)
+	}
+	if req.DNSName != "" && source.DNS.Domain == "" {
+		return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "kube %s has no dns zone", source.ID)
+	}
+
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		if r.SourceID == source.ID && r.State != StateDone {
+			// failed replacements are resumed or deleted
+			return nil, errors.Wrapf(sgerrors.ErrAlreadyExists, "replacement %s of kube %s", r.ID, source.ID)
+		}
+	}
+
+	r := &Replacement{
+		ID:        uuid.New()[:8],
+		TenantID:  tenant.FromContext(ctx),
+		SourceID:  source.ID,
+		Request:   *req,
+		State:     StateRunning,
+		Stages:    make([]Stage, 0, len(stageNames)),
+		CreatedAt: s.now(),
+	}
+	if r.Request.TargetName == "" {
+		r.Request.TargetName = fmt.Sprintf("%s-%s", source.Name, r.ID[:4])
+	}
+	for _, name := range stageNames {
+		r.Stages = append(r.Stages, Stage{Name: name, State: StagePending})
+	}
+
+	return r, s.save(ctx, r)
+}
+
+// Get returns a replacement of the tenant.
+func (s *Service) Get(ctx context.Context, id string) (*Replacement, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get replacement %s", id)
+	}
+	if data == nil {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "replacement %s", id)
+	}
+
+	r := new(Replacement)
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrapf(err, "decode replacement %s", id)
+	}
+	if r.TenantID != tenant.FromContext(ctx) {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "replacement %s", id)
+	}
+
+	return r, nil
+}
+
+// List returns replacements of the tenant, the latest go first.
+func (s *Service) List(ctx context.Context) ([]Replacement, error) {
+	list, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Replacement, 0, len(list))
+	for _, r := range list {
+		if r.TenantID == tenant.FromContext(ctx) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) listAll(ctx context.Context) ([]Replacement, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "list replacements")
+	}
+
+	list := make([]Replacement, 0, len(raw))
+	for _, data := range raw {
+		r := Replacement{}
+		if err = json.Unmarshal(data, &r); err != nil {
+			logrus.Warnf("replacement: skip corrupted record: %v", err)
+			continue
+		}
+		list = append(list, r)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Resume runs the failed stage of the replacement again.
+func (s *Service) Resume(ctx context.Context, id string) (*Replacement, error) {
+	return s.update(ctx, id, func(r *Replacement) error {
+		st := r.current()
+		if r.State != StateFailed || st == nil {
+			return errors.Wrapf(ErrState, "replacement %s is %s", id, r.State)
+		}
+		st.State = StagePending
+		st.Error = ""
+		r.State = StateRunning
+		return nil
+	})
+}
+
+// EndSoak retires the source cluster without waiting for the soak period to pass.
+func (s *Service) EndSoak(ctx context.Context, id string) (*Replacement, error) {
+	return s.update(ctx, id, func(r *Replacement) error {
+		st := r.current()
+		if r.State != StateRunning || st == nil || st.Name != StageSoak || st.State != StageRunning {
+			return errors.Wrapf(ErrState, "replacement %s is not soaking", id)
+		}
+		r.SoakUntil = s.now()
+		return nil
+	})
+}
+
+// Delete forgets a replacement that isn't running, clusters are left as they are.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if !s.lock(id) {
+		return errors.Wrapf(ErrBusy, "replacement %s", id)
+	}
+	defer s.unlock(id)
+
+	r, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.State == StateRunning {
+		return errors.Wrapf(ErrState, "replacement %s is running", id)
+	}
+
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, id), "delete replacement %s", id)
+}
+
+func (s *Service) update(ctx context.Context, id string, fn func(r *Replacement) error) (*Replacement, error) {
+	if !s.lock(id) {
+		return nil, errors.Wrapf(ErrBusy, "replacement %s", id)
+	}
+	defer s.unlock(id)
+
+	r, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = fn(r); err != nil {
+		return nil, err
+	}
+	return r, s.save(ctx, r)
+}
+
+// Run advances running replacements of all tenants until the context is done.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.advanceAll(ctx)
+		}
+	}
+}
+
+func (s *Service) advanceAll(ctx context.Context) {
+	list, err := s.listAll(ctx)
+	if err != nil {
+		logrus.Errorf("replacement: %v", err)
+		return
+	}
+
+	for _, r := range list {
+		if r.State != StateRunning {
+			continue
+		}
+		if s.inMaintenance(tenant.WithID(ctx, r.TenantID), r.SourceID, r.TargetID) {
+			continue
+		}
+		_, err := s.Advance(tenant.WithID(ctx, r.TenantID), r.ID)
+		if err != nil && errors.Cause(err) != ErrBusy {
+			logrus.Errorf("replacement %s: %v", r.ID, err)
+		}
+	}
+}
+
+// inMaintenance reports whether any of the clusters is in maintenance,
+// replacements of such clusters wait until the maintenance ends.
+func (s *Service) inMaintenance(ctx context.Context, kubeIDs ...string) bool {
+	for _, id := range kubeIDs {
+		if id == "" {
+			continue
+		}
+		if k, err := s.kubes.Get(ctx, id); err == nil && k.InMaintenance() {
+			return true
+		}
+	}
+	return false
+}
+
+// Advance runs stages of the replacement until one of them has to wait,
+// e.g. for the target cluster to be provisioned or for the soak to pass.
+func (s *Service) Advance(ctx context.Context, id string) (*Replacement, error) {
+	if !s.lock(id) {
+		return nil, errors.Wrapf(ErrBusy, "replacement %s", id)
+	}
+	defer s.unlock(id)
+
+	r, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for r.State == StateRunning {
+		st := r.current()
+		if st == nil {
+			r.State = StateDone
+			break
+		}
+		if st.State == StagePending {
+			st.State = StageRunning
+			st.StartedAt = s.now()
+		}
+
+		done, err := s.runStage(ctx, r, st)
+		if err != nil {
+			logrus.Errorf("replacement %s: %s: %v", r.ID, st.Name, err)
+			st.State = StageFailed
+			st.Error = err.Error()
+			r.State = StateFailed
+		} else if done {
+			if st.State == StageRunning {
+				st.State = StageDone
+			}
+			st.FinishedAt = s.now()
+		}
+		if err = s.save(ctx, r); err != nil {
+			return nil, err
+		}
+		if !done {
+			break
+		}
+	}
+
+	return r, s.save(ctx, r)
+}
+
+// runStage reports whether the stage has finished, stages are called again
+// until they finish, so they keep their progress in the replacement.
+func (s *Service) runStage(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	switch st.Name {
+	case StageProvision:
+		return s.provision(ctx, r, st)
+	case StageVolumes:
+		return s.restoreVolumes(ctx, r, st)
+	case StageReleases:
+		return s.migrateReleases(ctx, r, st)
+	case StageDNS:
+		return s.flipDNS(ctx, r, st)
+	case StageSoak:
+		return s.soak(r)
+	case StageRetire:
+		return s.retire(ctx, r, st)
+	}
+	return false, errors.Errorf("unknown stage %s", st.Name)
+}
+
+// provision starts provisioning of the target cluster from the profile
+// of the source one and waits for the cluster to become operational.
+func (s *Service) provision(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	if r.TargetID != "" {
+		target, err := s.kubes.Get(ctx, r.TargetID)
+		if err != nil {
+			return false, errors.Wrapf(err, "get kube %s", r.TargetID)
+		}
+		switch target.State {
+		case model.StateOperational:
+			return true, nil
+		case model.StateFailed, model.StateDeleting:
+			return false, errors.Errorf("kube %s is %s", target.ID, target.State)
+		}
+		return false, nil
+	}
+
+	source, err := s.kubes.Get(ctx, r.SourceID)
+	if err != nil {
+		return false, errors.Wrapf(err, "get kube %s", r.SourceID)
+	}
+	p, err := s.profiles.Get(ctx, source.ProfileID)
+	if err != nil {
+		return false, errors.Wrapf(err, "get profile %s", source.ProfileID)
+	}
+
+	cfg, err := steps.NewConfig(r.Request.TargetName, source.AccountName, *p)
+	if err != nil {
+		return false, errors.Wrap(err, "new config")
+	}
+	acc, err := s.accounts.Get(ctx, source.AccountName)
+	if err != nil {
+		return false, errors.Wrapf(err, "get cloud account %s", source.AccountName)
+	}
+	if err = util.FillCloudAccountCredentials(ctx, acc, cfg); err != nil {
+		return false, errors.Wrapf(err, "cloud account %s", source.AccountName)
+	}
+
+	p.ID = uuid.New()[:8]
+	// provisioning outlives the replacement run
+	provisionCtx, cancel := context.WithTimeout(tenant.WithID(context.Background(), r.TenantID), cfg.Timeout)
+	time.AfterFunc(cfg.Timeout, cancel)
+	taskMap, err := s.provisioner.ProvisionCluster(provisionCtx, p, cfg)
+	if err != nil {
+		cancel()
+		return false, errors.Wrap(err, "provision cluster")
+	}
+	if err = s.profiles.Create(ctx, p); err != nil {
+		logrus.Warnf("replacement %s: create profile %s: %v", r.ID, p.ID, err)
+	}
+
+	r.TargetID = cfg.ClusterID
+	r.Request.Releases.TargetID = cfg.ClusterID
+	for _, tasks := range taskMap {
+		for _, t := range tasks {
+			st.Tasks = append(st.Tasks, t.ID)
+		}
+	}
+	sort.Strings(st.Tasks)
+
+	return false, nil
+}
+
+// restoreVolumes snapshots claims of the source cluster and creates claims
+// with the same names on the target one once the snapshots are ready.
+func (s *Service) restoreVolumes(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	if len(r.Request.Volumes) == 0 {
+		st.State = StageSkipped
+		return true, nil
+	}
+
+	if len(st.Volumes) == 0 {
+		for i := range r.Request.Volumes {
+			snapshots, err := s.kubes.CreateSnapshots(ctx, r.SourceID, &r.Request.Volumes[i])
+			if err != nil {
+				return false, errors.Wrap(err, "create snapshots")
+			}
+			for _, snapshot := range snapshots {
+				if snapshot.Error != "" {
+					return false, errors.Errorf("snapshot claim %s/%s: %s",
+						snapshot.Namespace, snapshot.Claim, snapshot.Error)
+				}
+				st.Volumes = append(st.Volumes, Volume{VolumeSnapshot: snapshot})
+			}
+		}
+		return false, nil
+	}
+
+	done := true
+	for i := range st.Volumes {
+		v := &st.Volumes[i]
+		if v.Restored {
+			continue
+		}
+		err := s.kubes.RestoreSnapshot(ctx, r.SourceID, v.Namespace, v.Name, &kube.RestoreRequest{
+			Claim:        v.Claim,
+			Namespace:    v.Namespace,
+			TargetKubeID: r.TargetID,
+		})
+		if errors.Cause(err) == kube.ErrSnapshotNotReady {
+			done = false
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "restore claim %s/%s", v.Namespace, v.Claim)
+		}
+		v.Restored = true
+	}
+
+	return done, nil
+}
+
+// migrateReleases installs releases of the source cluster on the target one,
+// it can be run again after a failure, installed releases are skipped.
+func (s *Service) migrateReleases(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	req := r.Request.Releases
+	req.TargetID = r.TargetID
+
+	report, err := s.kubes.MigrateReleases(ctx, r.SourceID, &req)
+	if err != nil {
+		return false, errors.Wrap(err, "migrate releases")
+	}
+	st.Releases = report.Releases
+
+	failed := 0
+	for _, out := range report.Releases {
+		if out.Status == kube.MigrationFailed || out.Status == kube.MigrationSkipped {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return false, errors.Errorf("%d of %d releases were not migrated", failed, len(report.Releases))
+	}
+	return true, nil
+}
+
+// flipDNS points the record to public addresses of masters of the target cluster.
+func (s *Service) flipDNS(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	if r.Request.DNSName == "" {
+		st.State = StageSkipped
+		return true, nil
+	}
+
+	cfg, _, err := s.clusterConfig(ctx, r.TargetID)
+	if err != nil {
+		return false, err
+	}
+	cfg.DNSConfig = steps.NewDNSConfig(r.Request.DNSName, cfg.Kube.DNS)
+
+	taskID, err := s.run(ctx, workflows.UpdateDNS, cfg)
+	if taskID != "" {
+		st.Tasks = append(st.Tasks, taskID)
+	}
+	return err == nil, errors.Wrapf(err, "update record %s", cfg.DNSConfig.Name)
+}
+
+// soak waits for the soak period to pass, it starts when the stage is run first.
+func (s *Service) soak(r *Replacement) (bool, error) {
+	if r.SoakUntil.IsZero() {
+		d, err := parseSoak(r.Request.Soak)
+		if err != nil {
+			return false, err
+		}
+		r.SoakUntil = s.now().Add(d)
+	}
+	return !s.now().Before(r.SoakUntil), nil
+}
+
+// retire deletes the source cluster like users do, protected clusters are not
+// deleted and deletions gated for users wait for their approval.
+func (s *Service) retire(ctx context.Context, r *Replacement, st *Stage) (bool, error) {
+	if r.Request.KeepSource {
+		st.State = StageSkipped
+		return true, nil
+	}
+
+	cfg, source, err := s.clusterConfig(ctx, r.SourceID)
+	if sgerrors.IsNotFound(errors.Cause(err)) {
+		// the cluster has been deleted already
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if source.DeletionProtection {
+		return false, errors.Errorf("kube %s is protected from deletion", source.ID)
+	}
+	if held, err := s.holdDeletion(ctx, r, st, source); held || err != nil {
+		return false, err
+	}
+
+	if !source.ExternallyManaged {
+		source.State = model.StateDeleting
+		if err = s.kubes.Create(ctx, source); err != nil {
+			return false, errors.Wrapf(err, "update kube %s", source.ID)
+		}
+
+		cfg.Nodes = steps.NewMap(source.Nodes)
+		taskID, err := s.run(ctx, workflows.DeleteCluster, cfg)
+		if taskID != "" {
+			st.Tasks = append(st.Tasks, taskID)
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "delete kube %s", source.ID)
+		}
+	}
+
+	return true, errors.Wrapf(s.kubes.Delete(ctx, source.ID), "delete kube %s", source.ID)
+}
+
+// holdDeletion requests approval of the deletion of the source when the policy
+// of the tenant requires it or its protection has been cleared, the approved
+// call is replayed as DELETE /kubes/{kubeID} of the approver. The stage waits
+// for the source to be gone then.
+func (s *Service) holdDeletion(ctx context.Context, r *Replacement, st *Stage, source *model.Kube) (bool, error) {
+	if st.Approval == "" {
+		required := source.ProtectionClearedBy != ""
+		if !required && s.approvals != nil {
+			p, err := s.approvals.Policy(ctx)
+			if err != nil {
+				return false, errors.Wrap(err, "get approval policy")
+			}
+			required = p.Requires(approval.ActionDeleteCluster)
+		}
+		if !required {
+			return false, nil
+		}
+		if s.approvals == nil {
+			return false, errors.Errorf("kube %s must be deleted by a user, its protection has been cleared by %s",
+				source.ID, source.ProtectionClearedBy)
+		}
+
+		uri := permission.APIPrefix + "/kubes/" + source.ID
+		if source.ProtectionClearedBy != "" {
+			// the approver confirms the deletion instead of typing the name
+			uri += "?" + url.Values{
+				"name":   {source.Name},
+				"reason": {"replaced by " + r.TargetID},
+			}.Encode()
+		}
+		a, err := s.approvals.Request(ctx, &approval.Approval{
+			Action:      approval.ActionDeleteCluster,
+			KubeID:      source.ID,
+			Target:      source.ID,
+			Method:      http.MethodDelete,
+			URI:         uri,
+			RequestedBy: "replacement/" + r.ID,
+		})
+		if err != nil {
+			return false, errors.Wrapf(err, "request deletion of kube %s", source.ID)
+		}
+		st.Approval = a.ID
+		return true, nil
+	}
+
+	a, err := s.approvals.Get(ctx, st.Approval)
+	if err != nil {
+		return false, err
+	}
+	switch a.State {
+	case approval.StateRejected:
+		// resumed replacements request the deletion again
+		st.Approval = ""
+		return false, errors.Errorf("deletion of kube %s has been rejected by %s: %s", source.ID, a.DecidedBy, a.Reason)
+	case approval.StateFailed:
+		st.Approval = ""
+		return false, errors.Errorf("deletion of kube %s has failed: %s", source.ID, a.Error)
+	}
+	return true, nil
+}
+
+// clusterConfig returns a config with masters and credentials of the cluster.
+func (s *Service) clusterConfig(ctx context.Context, kubeID string) (*steps.Config, *model.Kube, error) {
+	k, err := s.kubes.Get(ctx, kubeID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get kube %s", kubeID)
+	}
+
+	cfg := &steps.Config{
+		Kube:             *k,
+		Provider:         k.Provider,
+		ClusterID:        k.ID,
+		ClusterName:      k.Name,
+		CloudAccountName: k.AccountName,
+		Masters:          steps.NewMap(k.Masters),
+	}
+	if k.ExternallyManaged {
+		return cfg, k, nil
+	}
+
+	acc, err := s.accounts.Get(ctx, k.AccountName)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get cloud account %s", k.AccountName)
+	}
+	if err = util.FillCloudAccountCredentials(ctx, acc, cfg); err != nil {
+		return nil, nil, errors.Wrapf(err, "cloud account %s", k.AccountName)
+	}
+	if err = util.LoadCloudSpecificDataFromKube(k, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, k, nil
+}
+
+func (s *Service) save(ctx context.Context, r *Replacement) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrapf(err, "encode replacement %s", r.ID)
+	}
+
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, r.ID, data), "save replacement %s", r.ID)
+}
+
+func (s *Service) lock(id string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+func (s *Service) unlock(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.busy, id)
+}
+
+func parseSoak(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultSoak, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errors.Wrapf(sgerrors.ErrInvalidJson, "soak %q", value)
+	}
+	return d, nil
+}
+
+func taskRunner(repo storage.Interface) runFn {
+	return func(ctx context.Context, workflow string, cfg *steps.Config) (string, error) {
+		t, err := workflows.NewTask(workflow, repo)
+		if err != nil {
+			return "", err
+		}
+		writer, err := util.GetWriter(util.MakeFileName(t.ID))
+		if err != nil {
+			return t.ID, err
+		}
+
+		return t.ID, <-t.Run(tenant.Detach(ctx), *cfg, writer)
+	}
+}
@@ -0,0 +1,473 @@
+package replacement
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/approval"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/kube"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/workflows"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeKubes struct {
+	m     sync.Mutex
+	kubes map[string]*model.Kube
+
+	// restores fail as not ready while notReady is positive
+	notReady int
+	restored []string
+	outcomes []kube.ReleaseOutcome
+	deleted  []string
+}
+
+func (f *fakeKubes) Get(ctx context.Context, id string) (*model.Kube, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	k, ok := f.kubes[id]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	out := *k
+	return &out, nil
+}
+
+func (f *fakeKubes) Create(ctx context.Context, k *model.Kube) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.kubes[k.ID] = k
+	return nil
+}
+
+func (f *fakeKubes) Delete(ctx context.Context, id string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	delete(f.kubes, id)
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeKubes) setState(id string, state model.KubeState) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.kubes[id].State = state
+}
+
+func (f *fakeKubes) MigrateReleases(ctx context.Context, id string, req *kube.MigrationRequest) (*kube.MigrationReport, error) {
+	if req.TargetID == "" || req.TargetID == id {
+		return nil, kube.ErrMigrationTarget
+	}
+	return &kube.MigrationReport{SourceID: id, TargetID: req.TargetID, Releases: f.outcomes}, nil
+}
+
+func (f *fakeKubes) CreateSnapshots(ctx context.Context, id string, req *kube.SnapshotRequest) ([]kube.VolumeSnapshot, error) {
+	out := make([]kube.VolumeSnapshot, 0, len(req.Claims))
+	for _, claim := range req.Claims {
+		out = append(out, kube.VolumeSnapshot{
+			Name:      claim + "-snapshot",
+			Namespace: req.Namespace,
+			Claim:     claim,
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeKubes) RestoreSnapshot(ctx context.Context, id, ns, name string, req *kube.RestoreRequest) error {
+	if f.notReady > 0 {
+		f.notReady--
+		return errors.Wrapf(kube.ErrSnapshotNotReady, "snapshot %s/%s", ns, name)
+	}
+	f.restored = append(f.restored, req.TargetKubeID+":"+req.Namespace+"/"+req.Claim)
+	return nil
+}
+
+type fakeProfiles map[string]*profile.Profile
+
+func (f fakeProfiles) Get(ctx context.Context, id string) (*profile.Profile, error) {
+	p, ok := f[id]
+	if !ok {
+		return nil, sgerrors.ErrNotFound
+	}
+	out := *p
+	return &out, nil
+}
+
+func (f fakeProfiles) Create(ctx context.Context, p *profile.Profile) error {
+	f[p.ID] = p
+	return nil
+}
+
+type fakeAccounts struct{}
+
+func (fakeAccounts) Get(ctx context.Context, name string) (*model.CloudAccount, error) {
+	return &model.CloudAccount{
+		Name:     name,
+		Provider: clouds.AWS,
+	}, nil
+}
+
+// fakeProvisioner saves the target cluster in the provisioning state.
+type fakeProvisioner struct {
+	kubes *fakeKubes
+}
+
+func (f *fakeProvisioner) ProvisionCluster(ctx context.Context, p *profile.Profile, cfg *steps.Config) (map[string][]*workflows.Task, error) {
+	cfg.ClusterID = "target"
+	f.kubes.Create(ctx, &model.Kube{
+		ID:       cfg.ClusterID,
+		Name:     cfg.ClusterName,
+		TenantID: tenant.FromContext(ctx),
+		State:    model.StateProvisioning,
+		DNS:      p.DNS,
+		Masters: map[string]*model.Machine{
+			"m": {Name: "m", PublicIp: "2.2.2.2", State: model.MachineStateActive},
+		},
+	})
+	return map[string][]*workflows.Task{
+		workflows.ClusterTask: {{ID: "cluster-task"}},
+		workflows.MasterTask:  {{ID: "master-task"}},
+	}, nil
+}
+
+// fakeRunner records workflows and configs they were run with.
+type fakeRunner struct {
+	m         sync.Mutex
+	workflows []string
+	configs   []steps.Config
+	err       error
+}
+
+func (f *fakeRunner) run(ctx context.Context, workflow string, cfg *steps.Config) (string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.workflows = append(f.workflows, workflow)
+	f.configs = append(f.configs, *cfg)
+	return workflow + "-task", f.err
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTestService() (*Service, *fakeKubes, *fakeRunner, *clock) {
+	kubes := &fakeKubes{
+		kubes: map[string]*model.Kube{
+			"source": {
+				ID:          "source",
+				Name:        "prod",
+				State:       model.StateOperational,
+				Provider:    clouds.AWS,
+				AccountName: "aws",
+				ProfileID:   "profile",
+				DNS:         profile.DNSSettings{Domain: "example.com", ZoneID: "zone"},
+			},
+			"imported": {
+				ID:                "imported",
+				State:             model.StateOperational,
+				ExternallyManaged: true,
+			},
+		},
+	}
+	profiles := fakeProfiles{
+		"profile": {
+			ID:       "profile",
+			Provider: clouds.AWS,
+			Region:   "us-east-1",
+			DNS:      profile.DNSSettings{Domain: "example.com", ZoneID: "zone"},
+		},
+	}
+	runner := &fakeRunner{}
+	c := &clock{t: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)}
+
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(), kubes, profiles,
+		fakeAccounts{}, &fakeProvisioner{kubes: kubes}, memory.NewInMemoryRepository())
+	svc.run = runner.run
+	svc.now = c.now
+
+	return svc, kubes, runner, c
+}
+
+func TestService_Create(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		req         Request
+		expectedErr error
+	}{
+		{
+			name:        "no source",
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown source",
+			req:         Request{SourceID: "missing"},
+			expectedErr: sgerrors.ErrNotFound,
+		},
+		{
+			name:        "imported source",
+			req:         Request{SourceID: "imported"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid soak",
+			req:         Request{SourceID: "source", Soak: "day"},
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name: "valid",
+			req:  Request{SourceID: "source", DNSName: "api", Soak: "1h"},
+		},
+	} {
+		svc, _, _, _ := newTestService()
+
+		r, err := svc.Create(context.Background(), &tc.req)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if err != nil {
+			continue
+		}
+		require.Equal(t, StateRunning, r.State, "TC: %s", tc.name)
+		require.Len(t, r.Stages, len(stageNames), "TC: %s", tc.name)
+		require.Equal(t, "prod-"+r.ID[:4], r.Request.TargetName, "TC: %s", tc.name)
+
+		// a cluster is replaced once at a time
+		_, err = svc.Create(context.Background(), &tc.req)
+		require.True(t, sgerrors.IsAlreadyExists(err), "TC: %s: %v", tc.name, err)
+	}
+}
+
+func TestService_Advance(t *testing.T) {
+	svc, kubes, runner, c := newTestService()
+	kubes.notReady = 1
+	kubes.outcomes = []kube.ReleaseOutcome{{Name: "web", Status: kube.MigrationInstalled}}
+	ctx := context.Background()
+
+	r, err := svc.Create(ctx, &Request{
+		SourceID: "source",
+		Volumes:  []kube.SnapshotRequest{{Namespace: "default", Claims: []string{"data"}}},
+		DNSName:  "api",
+		Soak:     "1h",
+	})
+	require.NoError(t, err)
+
+	// provisioning of the target has started
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, "target", r.TargetID)
+	require.Equal(t, []string{"cluster-task", "master-task"}, r.stage(StageProvision).Tasks)
+	require.Equal(t, StageRunning, r.stage(StageProvision).State)
+
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StageRunning, r.stage(StageProvision).State)
+
+	// claims are snapshotted once the target is operational
+	kubes.setState("target", model.StateOperational)
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StageDone, r.stage(StageProvision).State)
+	require.Len(t, r.stage(StageVolumes).Volumes, 1)
+
+	// the snapshot isn't ready yet
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StageRunning, r.stage(StageVolumes).State)
+	require.Empty(t, kubes.restored)
+
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"target:default/data"}, kubes.restored)
+	require.Equal(t, StageDone, r.stage(StageVolumes).State)
+	require.Equal(t, kubes.outcomes, r.stage(StageReleases).Releases)
+	require.Equal(t, StageDone, r.stage(StageDNS).State)
+	require.Equal(t, []string{workflows.UpdateDNS + "-task"}, r.stage(StageDNS).Tasks)
+	require.Equal(t, StageRunning, r.stage(StageSoak).State)
+	require.Equal(t, c.t.Add(time.Hour), r.SoakUntil)
+
+	require.Equal(t, []string{workflows.UpdateDNS}, runner.workflows)
+	require.Equal(t, "api.example.com", runner.configs[0].DNSConfig.Name)
+	require.Equal(t, "target", runner.configs[0].ClusterID)
+	require.Len(t, runner.configs[0].GetMasters(), 1)
+
+	// the source is retired after the soak
+	c.t = c.t.Add(30 * time.Minute)
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateRunning, r.State)
+
+	c.t = c.t.Add(30 * time.Minute)
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateDone, r.State)
+	require.Equal(t, []string{workflows.UpdateDNS, workflows.DeleteCluster}, runner.workflows)
+	require.Equal(t, []string{"source"}, kubes.deleted)
+}
+
+func TestService_Resume(t *testing.T) {
+	svc, kubes, runner, _ := newTestService()
+	kubes.kubes["target"] = &model.Kube{ID: "target", State: model.StateOperational}
+	kubes.outcomes = []kube.ReleaseOutcome{
+		{Name: "db", Status: kube.MigrationFailed, Error: "timed out"},
+		{Name: "web", Status: kube.MigrationSkipped},
+	}
+	ctx := context.Background()
+
+	r, err := svc.Create(ctx, &Request{SourceID: "source", Soak: "0s", KeepSource: true})
+	require.NoError(t, err)
+	// the target has been provisioned before
+	r.TargetID = "target"
+	require.NoError(t, svc.save(ctx, r))
+
+	_, err = svc.EndSoak(ctx, r.ID)
+	require.Equal(t, ErrState, errors.Cause(err))
+
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, r.State)
+	require.Equal(t, StageFailed, r.stage(StageReleases).State)
+	require.Equal(t, "2 of 2 releases were not migrated", r.stage(StageReleases).Error)
+
+	// failed replacements aren't advanced until they are resumed
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateFailed, r.State)
+
+	kubes.outcomes = []kube.ReleaseOutcome{
+		{Name: "db", Status: kube.MigrationInstalled},
+		{Name: "web", Status: kube.MigrationExists},
+	}
+	r, err = svc.Resume(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateRunning, r.State)
+	require.Empty(t, r.stage(StageReleases).Error)
+
+	r, err = svc.Advance(ctx, r.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateDone, r.State)
+	require.Equal(t, StageSkipped, r.stage(StageVolumes).State)
+	require.Equal(t, StageSkipped, r.stage(StageDNS).State)
+	require.Equal(t, StageSkipped, r.stage(StageRetire).State)
+	require.Empty(t, runner.workflows)
+	require.Empty(t, kubes.deleted)
+
+	_, err = svc.Resume(ctx, r.ID)
+	require.Equal(t, ErrState, errors.Cause(err))
+	require.NoError(t, svc.Delete(ctx, r.ID))
+}
+
+func TestService_RetireApproval(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		policy          *approval.Policy
+		clearedBy       string
+		reject          bool
+		expectedURI     string
+		expectedDeleted []string
+	}{
+		{
+			name:            "not gated",
+			expectedDeleted: []string{"source"},
+		},
+		{
+			name:        "policy",
+			policy:      &approval.Policy{Enabled: true, Actions: []string{approval.ActionDeleteCluster}},
+			expectedURI: "/v1/api/kubes/source",
+		},
+		{
+			name:        "protection cleared",
+			clearedBy:   "alice",
+			expectedURI: "/v1/api/kubes/source?name=prod&reason=replaced+by+target",
+		},
+		{
+			name:        "rejected",
+			policy:      &approval.Policy{Enabled: true, Actions: []string{approval.ActionDeleteCluster}},
+			reject:      true,
+			expectedURI: "/v1/api/kubes/source",
+		},
+	} {
+		svc, kubes, _, _ := newTestService()
+		approvals := approval.NewService(approval.DefaultStoragePrefix, memory.NewInMemoryRepository())
+		svc.SetApprovals(approvals)
+		ctx := context.Background()
+		if tc.policy != nil {
+			require.NoError(t, approvals.SetPolicy(ctx, tc.policy), "TC: %s", tc.name)
+		}
+		kubes.kubes["source"].ProtectionClearedBy = tc.clearedBy
+		kubes.kubes["target"] = &model.Kube{ID: "target", State: model.StateOperational}
+
+		r, err := svc.Create(ctx, &Request{SourceID: "source", Soak: "0s"})
+		require.NoError(t, err, "TC: %s", tc.name)
+		r.TargetID = "target"
+		require.NoError(t, svc.save(ctx, r), "TC: %s", tc.name)
+
+		r, err = svc.Advance(ctx, r.ID)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedDeleted, kubes.deleted, "TC: %s", tc.name)
+		if tc.expectedURI == "" {
+			require.Equal(t, StateDone, r.State, "TC: %s", tc.name)
+			continue
+		}
+
+		// the deletion waits for another user
+		require.Equal(t, StateRunning, r.State, "TC: %s", tc.name)
+		a, err := approvals.Get(ctx, r.stage(StageRetire).Approval)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, approval.ActionDeleteCluster, a.Action, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedURI, a.URI, "TC: %s", tc.name)
+
+		if tc.reject {
+			_, err = approvals.Reject(ctx, a.ID, "bob", "not yet")
+			require.NoError(t, err, "TC: %s", tc.name)
+			r, err = svc.Advance(ctx, r.ID)
+			require.NoError(t, err, "TC: %s", tc.name)
+			require.Equal(t, StateFailed, r.State, "TC: %s", tc.name)
+			require.Contains(t, r.stage(StageRetire).Error, "rejected by bob", "TC: %s", tc.name)
+			require.Empty(t, r.stage(StageRetire).Approval, "TC: %s", tc.name)
+			continue
+		}
+
+		// the approved call is replayed by the approval handler
+		a, err = approvals.Approve(ctx, a.ID, "bob")
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.NoError(t, approvals.Done(ctx, a, http.StatusAccepted, ""), "TC: %s", tc.name)
+		r, err = svc.Advance(ctx, r.ID)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, StateRunning, r.State, "TC: %s", tc.name)
+
+		require.NoError(t, kubes.Delete(ctx, "source"), "TC: %s", tc.name)
+		r, err = svc.Advance(ctx, r.ID)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, StateDone, r.State, "TC: %s", tc.name)
+	}
+}
+
+func TestService_Tenants(t *testing.T) {
+	svc, _, _, _ := newTestService()
+
+	r, err := svc.Create(context.Background(), &Request{SourceID: "source"})
+	require.NoError(t, err)
+
+	other := tenant.WithID(context.Background(), "acme")
+	_, err = svc.Get(other, r.ID)
+	require.True(t, sgerrors.IsNotFound(err))
+	list, err := svc.List(other)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	// running replacements are not deleted
+	require.Equal(t, ErrState, errors.Cause(svc.Delete(context.Background(), r.ID)))
+}
@@ -0,0 +1,78 @@
+package ssh
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var ErrAgentNoIdentities = errors.New("ssh-agent: no identities")
+
+// agentAuth authenticates with keys held by the ssh-agent listening on
+// socket. The agent is dialed by the first handshake that needs it and
+// the connection is kept until Close, so handshakes retried by a single
+// connect share it.
+type agentAuth struct {
+	socket string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	client agent.Agent
+}
+
+func newAgentAuth(socket string) *agentAuth {
+	return &agentAuth{socket: socket}
+}
+
+// Method returns ssh.AuthMethod that signs with keys of the agent,
+// private keys never leave it.
+func (a *agentAuth) Method() ssh.AuthMethod {
+	return ssh.PublicKeysCallback(a.signers)
+}
+
+func (a *agentAuth) signers() ([]ssh.Signer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client == nil {
+		conn, err := net.Dial("unix", a.socket)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ssh-agent: dial %s", a.socket)
+		}
+		a.conn = conn
+		a.client = agent.NewClient(conn)
+	}
+
+	signers, err := a.client.Signers()
+	if err != nil {
+		return nil, errors.Wrap(err, "ssh-agent: list keys")
+	}
+	if len(signers) == 0 {
+		return nil, ErrAgentNoIdentities
+	}
+
+	return signers, nil
+}
+
+// Close closes the connection to the agent, the next handshake dials it again.
+// It's a no-op for configs without the agent.
+func (a *agentAuth) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn = nil
+	a.client = nil
+
+	return err
+}
@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serveAgent serves keyring on a unix socket in a temp dir until the returned
+// func is called.
+func serveAgent(t *testing.T, keyring agent.Agent) (string, func()) {
+	dir, err := ioutil.TempDir("", "ssh-agent")
+	if err != nil {
+		t.Fatalf("temp dir %v", err)
+	}
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("listen %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgentAuthSign(t *testing.T) {
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(encryptedKey), []byte("secret"))
+	if err != nil {
+		t.Fatalf("parse key %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("signer %v", err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("add key %v", err)
+	}
+	socket, stop := serveAgent(t, keyring)
+	defer stop()
+
+	auth := newAgentAuth(socket)
+	signers, err := auth.signers()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(signers) != 1 {
+		t.Fatalf("wrong signer count expected 1 actual %d", len(signers))
+	}
+
+	data := []byte("data")
+	sig, err := signers[0].Sign(rand.Reader, data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := signer.PublicKey().Verify(data, sig); err != nil {
+		t.Errorf("signature verification failed %v", err)
+	}
+
+	if err := auth.Close(); err != nil {
+		t.Errorf("unexpected close error %v", err)
+	}
+	if auth.conn != nil {
+		t.Error("connection to the agent is kept after close")
+	}
+
+	// the agent is dialed again after close
+	if _, err := auth.signers(); err != nil {
+		t.Errorf("unexpected error after close %v", err)
+	}
+	auth.Close()
+}
+
+func TestAgentAuthNoIdentities(t *testing.T) {
+	socket, stop := serveAgent(t, agent.NewKeyring())
+	defer stop()
+
+	auth := newAgentAuth(socket)
+	defer auth.Close()
+
+	if _, err := auth.signers(); err != ErrAgentNoIdentities {
+		t.Errorf("wrong error expected %v actual %v", ErrAgentNoIdentities, err)
+	}
+}
+
+func TestAgentAuthDialError(t *testing.T) {
+	auth := newAgentAuth(filepath.Join(os.TempDir(), "no-such-agent.sock"))
+	if _, err := auth.signers(); err == nil {
+		t.Error("error expected")
+	}
+
+	var noAgent *agentAuth
+	if err := noAgent.Close(); err != nil {
+		t.Errorf("unexpected close error %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Dial connects to the host of the config, the connection is tunneled
+// through the bastion when the config has one.
+func Dial(ctx context.Context, config Config) (*ssh.Client, error) {
+	if strings.TrimSpace(config.Host) == "" {
+		return nil, ErrHostNotSpecified
+	}
+	sshConfig, agent, err := getSshConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	// handshakes with the bastion and the host are over when Dial returns
+	defer agent.Close()
+
+	port := config.Port
+	if port == "" {
+		port = DefaultPort
+	}
+	addr := net.JoinHostPort(config.Host, port)
+
+	if config.Bastion == "" {
+		return dialContext(ctx, addr, sshConfig)
+	}
+
+	bastionAddr := config.Bastion
+	if _, _, err = net.SplitHostPort(bastionAddr); err != nil {
+		bastionAddr = net.JoinHostPort(bastionAddr, DefaultPort)
+	}
+	bastion, err := dialContext(ctx, bastionAddr, sshConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bastion %s", bastionAddr)
+	}
+
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		bastion.Close()
+		return nil, errors.Wrapf(err, "dial %s through bastion", addr)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		bastion.Close()
+		return nil, errors.Wrapf(err, "connect to %s through bastion", addr)
+	}
+
+	client := ssh.NewClient(c, chans, reqs)
+	go func() {
+		client.Wait()
+		bastion.Close()
+	}()
+	return client, nil
+}
+
+func dialContext(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial %s", addr)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "connect to %s", addr)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
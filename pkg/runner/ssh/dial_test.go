@@ -0,0 +1,184 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T) ([]byte, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), signer
+}
+
+// testServer answers commands with "ok" and forwards tcp connections
+// as a bastion does, the number of forwarded connections is counted.
+func testServer(t *testing.T, client ssh.PublicKey, forwarded *int32) net.Listener {
+	_, host := testKey(t)
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(client.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(host)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(nc, cfg, forwarded)
+		}
+	}()
+	return l
+}
+
+func serveTestConn(nc net.Conn, cfg *ssh.ServerConfig, forwarded *int32) {
+	_, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nch := range chans {
+		switch nch.ChannelType() {
+		case "session":
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				for req := range reqs {
+					if req.Type != "exec" {
+						req.Reply(false, nil)
+						continue
+					}
+					req.Reply(true, nil)
+					ch.Write([]byte("ok"))
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					ch.Close()
+				}
+			}()
+		case "direct-tcpip":
+			target := struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}{}
+			if err := ssh.Unmarshal(nch.ExtraData(), &target); err != nil {
+				nch.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+			if err != nil {
+				nch.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			atomic.AddInt32(forwarded, 1)
+			go ssh.DiscardRequests(reqs)
+			go func() {
+				io.Copy(ch, conn)
+				ch.Close()
+			}()
+			go func() {
+				io.Copy(conn, ch)
+				conn.Close()
+			}()
+		default:
+			nch.Reject(ssh.UnknownChannelType, nch.ChannelType())
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	key, signer := testKey(t)
+	otherKey, _ := testKey(t)
+
+	var forwarded int32
+	node := testServer(t, signer.PublicKey(), &forwarded)
+	defer node.Close()
+	bastion := testServer(t, signer.PublicKey(), &forwarded)
+	defer bastion.Close()
+
+	nodeHost, nodePort, err := net.SplitHostPort(node.Addr().String())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name              string
+		config            Config
+		expectedErr       bool
+		expectedForwarded int32
+	}{
+		{
+			name:        "no host",
+			config:      Config{User: "root", Key: key},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown key",
+			config:      Config{Host: nodeHost, Port: nodePort, User: "root", Key: otherKey},
+			expectedErr: true,
+		},
+		{
+			name:        "bastion is down",
+			config:      Config{Host: nodeHost, Port: nodePort, User: "root", Key: key, Bastion: "127.0.0.1:1"},
+			expectedErr: true,
+		},
+		{
+			name:   "direct",
+			config: Config{Host: nodeHost, Port: nodePort, User: "root", Key: key},
+		},
+		{
+			name: "bastion",
+			config: Config{Host: nodeHost, Port: nodePort, User: "root", Key: key,
+				Bastion: bastion.Addr().String()},
+			expectedForwarded: 1,
+		},
+	} {
+		atomic.StoreInt32(&forwarded, 0)
+
+		client, err := Dial(context.Background(), tc.config)
+		if tc.expectedErr {
+			require.Error(t, err, "TC: %s", tc.name)
+			continue
+		}
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		session, err := client.NewSession()
+		require.NoError(t, err, "TC: %s", tc.name)
+		out, err := session.Output("hostname")
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, "ok", string(out), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedForwarded, atomic.LoadInt32(&forwarded), "TC: %s", tc.name)
+		client.Close()
+	}
+}
@@ -22,13 +22,23 @@ type Config struct {
 	User    string `json:"user"`
 	Timeout int    `json:"timeout"`
 	Key     []byte `json:"key"`
+	// Passphrase decrypts Key if it is passphrase-protected. It is supplied
+	// at runtime and never serialized.
+	Passphrase string `json:"-"`
+	// AgentSocket is a path to the local ssh-agent socket, when set
+	// keys held by the agent are used for authentication as well.
+	AgentSocket string `json:"agentSocket,omitempty"`
+	// Bastion is a host[:port] the host is reached through by Dial,
+	// the same user and key are used for it.
+	Bastion string `json:"bastion,omitempty"`
 }
 
 // Runner is implementation of runner interface for ssh
 type Runner struct {
-	host    string
-	port    string
-	sshConf *ssh.ClientConfig
+	host string
+	port string
+	// config is kept to build the client config for every connection.
+	config Config
 }
 
 // NewRunner creates ssh runner object. It requires two io.Writer
@@ -38,12 +48,12 @@ func NewRunner(config Config) (runner.Runner, error) {
 	if strings.TrimSpace(config.Host) == "" {
 		return nil, ErrHostNotSpecified
 	}
-	sshConfig, err := getSshConfig(config)
-	if err != nil {
+	// keys are checked here, the agent isn't dialed until a handshake
+	if _, _, err := getSshConfig(config); err != nil {
 		return nil, err
 	}
 
-	r := &Runner{host: config.Host, port: config.Port, sshConf: sshConfig}
+	r := &Runner{host: config.Host, port: config.Port, config: config}
 	if r.port == "" {
 		r.port = DefaultPort
 	}
@@ -51,7 +61,7 @@ func NewRunner(config Config) (runner.Runner, error) {
 	return r, nil
 }
 
-//TODO(stgleb): Add  more context like env variables?
+// TODO(stgleb): Add  more context like env variables?
 // Run executes a single command on ssh session.
 //
 // The returned error is nil if the command runs, has no problems
@@ -62,12 +72,17 @@ func (r *Runner) Run(cmd *runner.Command) (err error) {
 		return nil
 	}
 
-	c, err := connectionWithBackOff(cmd.Ctx, r.host, r.port, r.sshConf,
-		time.Second*10, 5)
+	var c *ssh.Client
+	if r.config.Bastion != "" {
+		c, err = Dial(cmd.Ctx, r.config)
+	} else {
+		c, err = r.connect(cmd.Ctx)
+	}
 
 	if err != nil {
 		return errors.Wrap(err, "ssh: establishing connection")
 	}
+	defer c.Close()
 
 	session, err := c.NewSession()
 	if err != nil {
@@ -97,3 +112,15 @@ func (r *Runner) Run(cmd *runner.Command) (err error) {
 	// We can close session multiple times
 	return session.Close()
 }
+
+// connect establishes a connection to the host, the connection to the
+// ssh-agent used by its handshakes is closed once it's done.
+func (r *Runner) connect(ctx context.Context) (*ssh.Client, error) {
+	sshConfig, agent, err := getSshConfig(r.config)
+	if err != nil {
+		return nil, err
+	}
+	defer agent.Close()
+
+	return connectionWithBackOff(ctx, r.host, r.port, sshConfig, time.Second*10, 5)
+}
@@ -1,6 +1,10 @@
 package ssh
 
 import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -59,3 +63,26 @@ func TestRunner_New(t *testing.T) {
 		}
 	}
 }
+
+func TestRunner_RunBastion(t *testing.T) {
+	key, signer := testKey(t)
+
+	var forwarded int32
+	node := testServer(t, signer.PublicKey(), &forwarded)
+	defer node.Close()
+	bastion := testServer(t, signer.PublicKey(), &forwarded)
+	defer bastion.Close()
+
+	host, port, err := net.SplitHostPort(node.Addr().String())
+	require.NoError(t, err)
+
+	r, err := NewRunner(Config{Host: host, Port: port, User: "root", Key: key, Timeout: 5,
+		Bastion: bastion.Addr().String()})
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	err = r.Run(&runner.Command{Ctx: context.Background(), Script: "hostname", Out: out, Err: &bytes.Buffer{}})
+	require.NoError(t, err)
+	require.Equal(t, "ok", out.String())
+	require.Equal(t, int32(1), atomic.LoadInt32(&forwarded))
+}
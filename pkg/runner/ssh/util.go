@@ -16,25 +16,25 @@ var (
 	ErrHostNotSpecified = errors.New("host not specified")
 )
 
-func getSshConfig(config Config) (*ssh.ClientConfig, error) {
+// getSshConfig returns the client config and the ssh-agent it authenticates
+// with, callers close the agent once their handshakes are done.
+func getSshConfig(config Config) (*ssh.ClientConfig, *agentAuth, error) {
 	if config.User == "" {
-		return nil, ErrUserNotSpecified
+		return nil, nil, ErrUserNotSpecified
 	}
 
 	if config.Host == "" {
-		return nil, ErrHostNotSpecified
+		return nil, nil, ErrHostNotSpecified
 	}
 
-	key, err := ssh.ParsePrivateKey(config.Key)
+	auth, agent, err := authMethods(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	return &ssh.ClientConfig{
-		User: config.User,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(key),
-		},
+		User:    config.User,
+		Auth:    auth,
 		Timeout: time.Duration(config.Timeout) * time.Second,
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			logrus.Debugf("hostname %s,addr %s key %s", hostname, remote.String(), string(key.Type()))
@@ -44,7 +44,52 @@ func getSshConfig(config Config) (*ssh.ClientConfig, error) {
 			logrus.Debug(message)
 			return nil
 		},
-	}, nil
+	}, agent, nil
+}
+
+func authMethods(config Config) ([]ssh.AuthMethod, *agentAuth, error) {
+	auth := make([]ssh.AuthMethod, 0, 2)
+
+	// NOTE: key may be omitted only when ssh-agent is used, the passphrase
+	// of encrypted keys isn't stored so the agent holds them after import
+	skipKey := config.AgentSocket != "" &&
+		(len(config.Key) == 0 || config.Passphrase == "" && IsEncrypted(config.Key))
+	if !skipKey {
+		key, err := parsePrivateKey(config.Key, config.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(key))
+	}
+
+	var agent *agentAuth
+	if config.AgentSocket != "" {
+		agent = newAgentAuth(config.AgentSocket)
+		auth = append(auth, agent.Method())
+	}
+
+	return auth, agent, nil
+}
+
+// IsEncrypted reports whether the private key is protected with a passphrase,
+// both PEM keys and keys of the OpenSSH format are recognized.
+func IsEncrypted(key []byte) bool {
+	_, err := ssh.ParseRawPrivateKey(key)
+	_, ok := err.(*ssh.PassphraseMissingError)
+	return ok
+}
+
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	if passphrase == "" {
+		return ssh.ParsePrivateKey(key)
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt private key")
+	}
+
+	return signer, nil
 }
 
 func connectionWithBackOff(ctx context.Context, host, port string, config *ssh.ClientConfig, timeout time.Duration, attemptCount int) (*ssh.Client, error) {
@@ -0,0 +1,182 @@
+package runtimeconfig
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/config/"
+	DefaultStorageKey    = "runtime"
+)
+
+// Settings are parts of the control configuration that are applied without
+// restart, fields missing in the source keep values the control was started with.
+type Settings struct {
+	LogLevel string `json:"logLevel,omitempty"`
+	// SpawnInterval is a minimal interval between cloud API calls that create
+	// instances, e.g. "5s".
+	SpawnInterval string `json:"spawnInterval,omitempty"`
+	// FleetConcurrency is a number of clusters queried at the same time.
+	FleetConcurrency int `json:"fleetConcurrency,omitempty"`
+	// NotificationWebhookURL receives events as json, events are
+	// written to the log when it is empty.
+	NotificationWebhookURL string `json:"notificationWebhookUrl,omitempty"`
+}
+
+// Validate checks settings can be applied.
+func (s Settings) Validate() error {
+	if _, err := logrus.ParseLevel(s.LogLevel); err != nil {
+		return errors.Wrap(err, "logLevel")
+	}
+	if d, err := time.ParseDuration(s.SpawnInterval); err != nil || d <= 0 {
+		return errors.Errorf("spawnInterval must be a positive duration, got %q", s.SpawnInterval)
+	}
+	if s.FleetConcurrency < 0 {
+		return errors.New("fleetConcurrency must not be negative")
+	}
+	return nil
+}
+
+// SpawnDuration returns the spawn interval of valid settings.
+func (s Settings) SpawnDuration() time.Duration {
+	d, _ := time.ParseDuration(s.SpawnInterval)
+	return d
+}
+
+// Source reads raw settings, nil means there are no settings to apply.
+type Source func(ctx context.Context) ([]byte, error)
+
+// FileSource reads settings from a yaml or json file, a missing file
+// is treated as an empty one.
+func FileSource(path string) Source {
+	return func(context.Context) ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return data, err
+	}
+}
+
+// StorageSource reads settings from the storage key, so all control
+// instances that share the storage pick up the same settings.
+func StorageSource(repository storage.Interface, prefix, key string) Source {
+	return func(ctx context.Context) ([]byte, error) {
+		data, err := repository.Get(ctx, prefix, key)
+		if sgerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return data, err
+	}
+}
+
+// Applier makes the control use new settings.
+type Applier func(Settings) error
+
+// Watcher polls the source and applies settings when they change.
+type Watcher struct {
+	source   Source
+	defaults Settings
+
+	m        sync.Mutex
+	appliers []Applier
+	raw      []byte
+	current  Settings
+}
+
+// NewWatcher constructs a Watcher, defaults are settings the control
+// has been started with.
+func NewWatcher(source Source, defaults Settings) *Watcher {
+	return &Watcher{
+		source:   source,
+		defaults: defaults,
+		current:  defaults,
+	}
+}
+
+// OnChange registers an applier that is called every time settings change.
+func (w *Watcher) OnChange(a Applier) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.appliers = append(w.appliers, a)
+}
+
+// Current returns settings in effect.
+func (w *Watcher) Current() Settings {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.current
+}
+
+// Reload reads the source and applies settings if they have changed, invalid
+// settings are rejected as a whole and the current ones stay in effect.
+func (w *Watcher) Reload(ctx context.Context) (bool, error) {
+	raw, err := w.source(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "read settings")
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if bytes.Equal(raw, w.raw) {
+		return false, nil
+	}
+
+	settings := w.defaults
+	if len(raw) > 0 {
+		if err = yaml.Unmarshal(raw, &settings); err != nil {
+			return false, errors.Wrap(err, "unmarshal settings")
+		}
+	}
+	if err = settings.Validate(); err != nil {
+		return false, err
+	}
+	w.raw = raw
+	if settings == w.current {
+		return false, nil
+	}
+
+	var lastErr error
+	for _, apply := range w.appliers {
+		if err = apply(settings); err != nil {
+			lastErr = err
+		}
+	}
+	w.current = settings
+	logrus.Infof("runtimeconfig: settings have been applied, log level %s, spawn interval %s",
+		settings.LogLevel, settings.SpawnInterval)
+
+	return true, lastErr
+}
+
+// Run blocks and reloads settings every interval until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Reload(ctx); err != nil {
+				logrus.Errorf("runtimeconfig: reload: %v", err)
+			}
+		}
+	}
+}
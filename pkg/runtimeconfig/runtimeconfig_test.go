@@ -0,0 +1,151 @@
+package runtimeconfig
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+var defaults = Settings{
+	LogLevel:      "info",
+	SpawnInterval: "5s",
+}
+
+func TestSettings_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		modify      func(*Settings)
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:        "log level",
+			modify:      func(s *Settings) { s.LogLevel = "loud" },
+			expectedErr: true,
+		},
+		{
+			name:        "spawn interval",
+			modify:      func(s *Settings) { s.SpawnInterval = "0s" },
+			expectedErr: true,
+		},
+		{
+			name:        "fleet concurrency",
+			modify:      func(s *Settings) { s.FleetConcurrency = -1 },
+			expectedErr: true,
+		},
+	} {
+		s := defaults
+		if tc.modify != nil {
+			tc.modify(&s)
+		}
+		require.Equal(t, tc.expectedErr, s.Validate() != nil, "TC: %s", tc.name)
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	raw := []byte(nil)
+	w := NewWatcher(func(context.Context) ([]byte, error) {
+		return raw, nil
+	}, defaults)
+
+	applied := make([]Settings, 0)
+	w.OnChange(func(s Settings) error {
+		applied = append(applied, s)
+		return nil
+	})
+
+	changed, err := w.Reload(context.Background())
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	raw = []byte("logLevel: debug\nfleetConcurrency: 2\n")
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, Settings{LogLevel: "debug", SpawnInterval: "5s", FleetConcurrency: 2}, w.Current())
+
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	raw = []byte("logLevel: loud\n")
+	_, err = w.Reload(context.Background())
+	require.Error(t, err)
+	require.Equal(t, "debug", w.Current().LogLevel, "invalid settings must not be applied")
+
+	raw = []byte("{")
+	_, err = w.Reload(context.Background())
+	require.Error(t, err)
+
+	// removed settings fall back to defaults
+	raw = []byte(`{"spawnInterval": "1s"}`)
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, Settings{LogLevel: "info", SpawnInterval: "1s"}, w.Current())
+
+	require.Len(t, applied, 2)
+}
+
+func TestWatcher_ReloadApplierError(t *testing.T) {
+	errFake := errors.New("fake")
+	w := NewWatcher(func(context.Context) ([]byte, error) {
+		return []byte("logLevel: warning"), nil
+	}, defaults)
+
+	calls := 0
+	w.OnChange(func(Settings) error {
+		calls++
+		return errFake
+	})
+	w.OnChange(func(Settings) error {
+		calls++
+		return nil
+	})
+
+	changed, err := w.Reload(context.Background())
+	require.True(t, changed)
+	require.Equal(t, errFake, err)
+	require.Equal(t, 2, calls, "failed applier must not stop the rest")
+	require.Equal(t, "warning", w.Current().LogLevel)
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runtimeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	raw, err := FileSource(path)(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, raw)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("logLevel: debug"), 0600))
+	raw, err = FileSource(path)(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "logLevel: debug", string(raw))
+}
+
+func TestStorageSource(t *testing.T) {
+	repository := memory.NewInMemoryRepository()
+	source := StorageSource(repository, DefaultStoragePrefix, DefaultStorageKey)
+
+	raw, err := source(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, raw)
+
+	require.NoError(t, repository.Put(context.Background(), DefaultStoragePrefix,
+		DefaultStorageKey, []byte("logLevel: debug")))
+	raw, err = source(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "logLevel: debug", string(raw))
+}
@@ -0,0 +1,464 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+
+	// hashes of signatures and digests
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	nsDSig   = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14 = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	nsXML    = "http://www.w3.org/XML/1998/namespace"
+
+	algExcC14N   = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+var (
+	ErrUnsigned         = errors.New("element is not signed")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// sha1 is not accepted, it lets signed documents be forged.
+var (
+	signatureHashes = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+	}
+	digestHashes = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+	}
+)
+
+// element is a node of a parsed document, prefixes of names are kept
+// since signed parts of the document are canonicalized with them.
+type element struct {
+	parent *element
+	prefix string
+	local  string
+	// ns are namespaces declared on the element by prefix, "" is the default one
+	ns    map[string]string
+	attrs []xml.Attr
+	// children are *element, xml.CharData and xml.ProcInst
+	children []interface{}
+}
+
+// parseDocument reads a document, documents with DTDs are refused.
+func parseDocument(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, cur *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parse xml")
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{
+				parent: cur,
+				prefix: t.Name.Space,
+				local:  t.Name.Local,
+				ns:     make(map[string]string),
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.ns[""] = a.Value
+				case a.Name.Space == "xmlns":
+					e.ns[a.Name.Local] = a.Value
+				default:
+					e.attrs = append(e.attrs, a)
+				}
+			}
+
+			if cur != nil {
+				cur.children = append(cur.children, e)
+			} else if root != nil {
+				return nil, errors.New("parse xml: several root elements")
+			} else {
+				root = e
+			}
+			cur = e
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.local {
+				return nil, errors.Errorf("parse xml: unexpected end of %s", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			}
+		case xml.ProcInst:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			}
+		case xml.Directive:
+			return nil, errors.New("parse xml: directives are not allowed")
+		}
+	}
+
+	if root == nil || cur != nil {
+		return nil, errors.New("parse xml: incomplete document")
+	}
+	return root, nil
+}
+
+// lookup returns a namespace the prefix is bound to in the scope of the element.
+func (e *element) lookup(prefix string) string {
+	if prefix == "xml" {
+		return nsXML
+	}
+	for n := e; n != nil; n = n.parent {
+		if uri, ok := n.ns[prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+func (e *element) is(space, local string) bool {
+	return e.local == local && e.lookup(e.prefix) == space
+}
+
+func (e *element) elements(space, local string) []*element {
+	list := make([]*element, 0)
+	for _, c := range e.children {
+		if child, ok := c.(*element); ok && child.is(space, local) {
+			list = append(list, child)
+		}
+	}
+	return list
+}
+
+func (e *element) child(space, local string) *element {
+	if list := e.elements(space, local); len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// attr returns a value of the unqualified attribute.
+func (e *element) attr(local string) string {
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) text() string {
+	buf := &bytes.Buffer{}
+	for _, c := range e.children {
+		if data, ok := c.(xml.CharData); ok {
+			buf.Write(data)
+		}
+	}
+	return buf.String()
+}
+
+// verifySignature checks the enveloped signature of the element with the
+// certificate and returns the signed content, it is the only part of the
+// document that may be trusted.
+func verifySignature(e *element, cert *x509.Certificate) ([]byte, error) {
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate key is not rsa")
+	}
+
+	sigs := e.elements(nsDSig, "Signature")
+	if len(sigs) == 0 {
+		return nil, ErrUnsigned
+	}
+	if len(sigs) > 1 {
+		return nil, errors.Wrap(ErrInvalidSignature, "several signatures")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "no signed info")
+	}
+
+	method := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if method == nil || method.attr("Algorithm") != algExcC14N {
+		return nil, errors.Wrap(ErrInvalidSignature, "unsupported canonicalization")
+	}
+	signedInfoPrefixes := inclusivePrefixes(method)
+
+	sigMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if sigMethod == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "no signature method")
+	}
+	sigHash, ok := signatureHashes[sigMethod.attr("Algorithm")]
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidSignature, "unsupported signature method %s",
+			sigMethod.attr("Algorithm"))
+	}
+
+	refs := signedInfo.elements(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return nil, errors.Wrap(ErrInvalidSignature, "signature must have one reference")
+	}
+	id := e.attr("ID")
+	if id == "" || refs[0].attr("URI") != "#"+id {
+		return nil, errors.Wrap(ErrInvalidSignature, "signature doesn't reference the element")
+	}
+
+	content, err := referencedContent(e, sig, refs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	digestMethod := refs[0].child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "no digest method")
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidSignature, "unsupported digest method %s",
+			digestMethod.attr("Algorithm"))
+	}
+	digestValue := refs[0].child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "no digest value")
+	}
+	expected, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "decode digest value")
+	}
+	if subtle.ConstantTimeCompare(digest(digestHash, content), expected) != 1 {
+		return nil, errors.Wrap(ErrInvalidSignature, "digest mismatch")
+	}
+
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "no signature value")
+	}
+	signature, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "decode signature value")
+	}
+
+	hashed := digest(sigHash, canonicalize(signedInfo, signedInfoPrefixes, nil))
+	if err = rsa.VerifyPKCS1v15(pub, sigHash, hashed, signature); err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+
+	return content, nil
+}
+
+// referencedContent applies transforms of the reference to the element,
+// only the enveloped signature and exclusive canonicalization are supported.
+func referencedContent(e, sig, ref *element) ([]byte, error) {
+	var (
+		enveloped bool
+		c14n      *element
+	)
+
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.elements(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				c14n = t
+			default:
+				return nil, errors.Wrapf(ErrInvalidSignature, "unsupported transform %s", t.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || c14n == nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "signature must be enveloped and canonicalized")
+	}
+
+	return canonicalize(e, inclusivePrefixes(c14n), sig), nil
+}
+
+func inclusivePrefixes(method *element) []string {
+	list := method.child(nsExcC14, "InclusiveNamespaces")
+	if list == nil {
+		return nil
+	}
+
+	prefixes := strings.Fields(list.attr("PrefixList"))
+	for i, p := range prefixes {
+		if p == "#default" {
+			prefixes[i] = ""
+		}
+	}
+	return prefixes
+}
+
+func digest(h crypto.Hash, data []byte) []byte {
+	hash := h.New()
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// canonicalize renders the element with exclusive xml canonicalization
+// without comments, skip is left out of the output.
+func canonicalize(e *element, inclusive []string, skip *element) []byte {
+	c := canonicalizer{
+		buf:       &bytes.Buffer{},
+		inclusive: inclusive,
+		skip:      skip,
+	}
+	c.element(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       *bytes.Buffer
+	inclusive []string
+	skip      *element
+}
+
+type nsDecl struct {
+	prefix string
+	uri    string
+}
+
+type canonicalAttr struct {
+	space string
+	name  string
+	value string
+}
+
+func (c *canonicalizer) element(e *element, rendered map[string]string) {
+	// namespaces visibly utilized by the element and its attributes, and
+	// the inclusive ones are rendered unless an output ancestor has them
+	used := map[string]bool{e.prefix: true}
+	for _, a := range e.attrs {
+		if a.Name.Space != "" {
+			used[a.Name.Space] = true
+		}
+	}
+	for _, p := range c.inclusive {
+		used[p] = true
+	}
+
+	scope := make(map[string]string, len(rendered))
+	for p, uri := range rendered {
+		scope[p] = uri
+	}
+
+	decls := make([]nsDecl, 0, len(used))
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri := e.lookup(p)
+		current, ok := rendered[p]
+		if (ok && current == uri) || (!ok && uri == "") {
+			continue
+		}
+		decls = append(decls, nsDecl{p, uri})
+		scope[p] = uri
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		return decls[i].prefix < decls[j].prefix
+	})
+
+	attrs := make([]canonicalAttr, 0, len(e.attrs))
+	for _, a := range e.attrs {
+		attr := canonicalAttr{name: a.Name.Local, value: a.Value}
+		if a.Name.Space != "" {
+			attr.space = e.lookup(a.Name.Space)
+			attr.name = a.Name.Space + ":" + a.Name.Local
+		}
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return localName(attrs[i].name) < localName(attrs[j].name)
+	})
+
+	name := qualifiedName(e.prefix, e.local)
+	c.buf.WriteString("<" + name)
+	for _, d := range decls {
+		if d.prefix == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + d.prefix + `="`)
+		}
+		c.buf.WriteString(escapeAttr(d.uri) + `"`)
+	}
+	for _, a := range attrs {
+		c.buf.WriteString(" " + a.name + `="` + escapeAttr(a.value) + `"`)
+	}
+	c.buf.WriteString(">")
+
+	for _, child := range e.children {
+		switch t := child.(type) {
+		case *element:
+			if t != c.skip {
+				c.element(t, scope)
+			}
+		case xml.CharData:
+			c.buf.WriteString(escapeText(string(t)))
+		case xml.ProcInst:
+			c.buf.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				c.buf.WriteString(" " + string(t.Inst))
+			}
+			c.buf.WriteString("?>")
+		}
+	}
+
+	c.buf.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,242 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const signatureTemplate = `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+	`<ds:SignedInfo>` +
+	`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+	`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+	`<ds:Reference URI="#{id}">` +
+	`<ds:Transforms>` +
+	`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+	`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+	`</ds:Transforms>` +
+	`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+	`<ds:DigestValue>{digest}</ds:DigestValue>` +
+	`</ds:Reference>` +
+	`</ds:SignedInfo>` +
+	`<ds:SignatureValue>{signature}</ds:SignatureValue>` +
+	`</ds:Signature>`
+
+type testIdP struct {
+	key     *rsa.PrivateKey
+	cert    *x509.Certificate
+	certPEM string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testIdP{
+		key:     key,
+		cert:    cert,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// sign puts a signature of the element with the id in place of the marker.
+func (idp *testIdP) sign(t *testing.T, doc, marker, id string) string {
+	doc = strings.Replace(doc, marker, strings.Replace(signatureTemplate, "{id}", id, 1), 1)
+
+	e := findByID(t, doc, id)
+	sum := sha256.Sum256(canonicalize(e, nil, e.child(nsDSig, "Signature")))
+	doc = strings.Replace(doc, "{digest}", base64.StdEncoding.EncodeToString(sum[:]), 1)
+
+	signedInfo := findByID(t, doc, id).child(nsDSig, "Signature").child(nsDSig, "SignedInfo")
+	sum = sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	require.NoError(t, err)
+
+	return strings.Replace(doc, "{signature}", base64.StdEncoding.EncodeToString(value), 1)
+}
+
+func findByID(t *testing.T, doc, id string) *element {
+	root, err := parseDocument([]byte(doc))
+	require.NoError(t, err)
+
+	var find func(e *element) *element
+	find = func(e *element) *element {
+		if e.attr("ID") == id {
+			return e
+		}
+		for _, c := range e.children {
+			if child, ok := c.(*element); ok {
+				if found := find(child); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+
+	e := find(root)
+	require.NotNil(t, e, "no element %s", id)
+	return e
+}
+
+func TestParseDocument(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		doc         string
+		expectedErr bool
+	}{
+		{
+			name: "document",
+			doc:  `<?xml version="1.0"?><a xmlns="urn:a"><b/></a>`,
+		},
+		{
+			name:        "dtd",
+			doc:         `<!DOCTYPE a [<!ENTITY e "e">]><a>&e;</a>`,
+			expectedErr: true,
+		},
+		{
+			name:        "several roots",
+			doc:         `<a/><b/>`,
+			expectedErr: true,
+		},
+		{
+			name:        "unclosed",
+			doc:         `<a><b></b>`,
+			expectedErr: true,
+		},
+	} {
+		_, err := parseDocument([]byte(tc.doc))
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		doc       string
+		id        string
+		inclusive []string
+		expected  string
+	}{
+		{
+			name: "document",
+			doc: `<a:root xmlns:b="urn:b" b:y="2" z="1" xmlns:a="urn:a" xmlns:unused="urn:c">` +
+				`<!-- comment --><a:child xmlns:a="urn:a" ID="c">t&amp;&lt;"</a:child><c/></a:root>`,
+			expected: `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" b:y="2">` +
+				`<a:child ID="c">t&amp;&lt;"</a:child><c></c></a:root>`,
+		},
+		{
+			name:     "subtree gets used namespaces of ancestors",
+			doc:      `<a:root xmlns:a="urn:a" xmlns:b="urn:b"><a:child ID="c" attr="x&#10;"/></a:root>`,
+			id:       "c",
+			expected: `<a:child xmlns:a="urn:a" ID="c" attr="x&#xA;"></a:child>`,
+		},
+		{
+			name:      "inclusive namespaces",
+			doc:       `<a:root xmlns:a="urn:a" xmlns:b="urn:b"><a:child ID="c"/></a:root>`,
+			id:        "c",
+			inclusive: []string{"b"},
+			expected:  `<a:child xmlns:a="urn:a" xmlns:b="urn:b" ID="c"></a:child>`,
+		},
+		{
+			name:     "default namespace",
+			doc:      `<root xmlns="urn:a"><child ID="c" xmlns=""/></root>`,
+			expected: `<root xmlns="urn:a"><child xmlns="" ID="c"></child></root>`,
+		},
+	} {
+		var e *element
+		if tc.id != "" {
+			e = findByID(t, tc.doc, tc.id)
+		} else {
+			root, err := parseDocument([]byte(tc.doc))
+			require.NoError(t, err, "TC: %s", tc.name)
+			e = root
+		}
+
+		require.Equal(t, tc.expected, string(canonicalize(e, tc.inclusive, nil)), "TC: %s", tc.name)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	idp := newTestIdP(t)
+	other := newTestIdP(t)
+
+	doc := `<r:root xmlns:r="urn:r" ID="root"><!--signature--><r:value>alice</r:value></r:root>`
+	signed := idp.sign(t, doc, "<!--signature-->", "root")
+
+	for _, tc := range []struct {
+		name        string
+		doc         string
+		cert        *x509.Certificate
+		expectedErr error
+	}{
+		{
+			name: "signed",
+			doc:  signed,
+			cert: idp.cert,
+		},
+		{
+			name:        "unsigned",
+			doc:         doc,
+			cert:        idp.cert,
+			expectedErr: ErrUnsigned,
+		},
+		{
+			name:        "tampered",
+			doc:         strings.Replace(signed, "alice", "mallory", 1),
+			cert:        idp.cert,
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "other certificate",
+			doc:         signed,
+			cert:        other.cert,
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "sha1",
+			doc:         strings.Replace(signed, "xmldsig-more#rsa-sha256", "xmldsig#rsa-sha1", 1),
+			cert:        idp.cert,
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "reference to other element",
+			doc:         strings.Replace(signed, `ID="root"`, `ID="other"`, 1),
+			cert:        idp.cert,
+			expectedErr: ErrInvalidSignature,
+		},
+	} {
+		root, err := parseDocument([]byte(tc.doc))
+		require.NoError(t, err, "TC: %s", tc.name)
+
+		content, err := verifySignature(root, tc.cert)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if tc.expectedErr == nil {
+			require.Equal(t, `<r:root xmlns:r="urn:r" ID="root"><r:value>alice</r:value></r:root>`,
+				string(content), "TC: %s", tc.name)
+		}
+	}
+}
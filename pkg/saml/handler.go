@@ -0,0 +1,202 @@
+package saml
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/user"
+)
+
+type Servicer interface {
+	Config(ctx context.Context) (*Config, error)
+	SetConfig(ctx context.Context, c *Config) error
+	LoginURL(ctx context.Context, relayState string) (string, error)
+	Metadata(ctx context.Context) ([]byte, error)
+	Authenticate(ctx context.Context, encoded string) (*Identity, error)
+}
+
+type userProvisioner interface {
+	Provision(ctx context.Context, u *user.User) error
+}
+
+type tokenIssuer interface {
+	IssueWithAccesses(userID, tenantID string, accesses []string) (string, error)
+}
+
+// Handler logs users in with the identity provider, users get a token
+// of control in the fragment of the page they are redirected to.
+type Handler struct {
+	svc    Servicer
+	users  userProvisioner
+	tokens tokenIssuer
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer, users userProvisioner, tokens tokenIssuer) *Handler {
+	return &Handler{
+		svc:    svc,
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+// Register adds login handlers to a router that doesn't require a token.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/saml/metadata", h.metadata).Methods(http.MethodGet)
+	r.HandleFunc("/saml/login", h.login).Methods(http.MethodGet)
+	r.HandleFunc("/saml/acs", h.acs).Methods(http.MethodPost)
+}
+
+// RegisterConfig adds configuration handlers to the api router.
+func (h *Handler) RegisterConfig(r *mux.Router) {
+	r.HandleFunc("/saml/config", h.getConfig).Methods(http.MethodGet)
+	r.HandleFunc("/saml/config", h.setConfig).Methods(http.MethodPut)
+}
+
+func (h *Handler) metadata(w http.ResponseWriter, r *http.Request) {
+	data, err := h.svc.Metadata(r.Context())
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	if _, err = w.Write(data); err != nil {
+		logrus.Errorf("saml: write metadata: %v", err)
+	}
+}
+
+// login redirects the user to the identity provider, the user returns to
+// the page of control: GET /saml/login?redirect=/clusters
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	u, err := h.svc.LoginURL(r.Context(), localPath(r.URL.Query().Get("redirect")))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// acs consumes the response posted by the identity provider, the user
+// is provisioned with the mapped role.
+func (h *Handler) acs(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	id, err := h.svc.Authenticate(r.Context(), r.PostForm.Get("SAMLResponse"))
+	if err != nil {
+		logrus.Warnf("saml: login refused: %v", err)
+		sendError(w, err)
+		return
+	}
+
+	err = h.users.Provision(r.Context(), &user.User{
+		Login:    id.Login,
+		TenantID: id.TenantID,
+		Role:     id.Role,
+		Source:   Source,
+	})
+	if err != nil {
+		if sgerrors.IsAlreadyExists(err) {
+			http.Error(w, "login is used by a local user", http.StatusForbidden)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	token, err := h.tokens.IssueWithAccesses(id.Login, id.TenantID, user.Accesses(id.Role))
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	// fragments are not sent to servers, so the token is not logged by proxies
+	target := localPath(r.PostForm.Get("RelayState")) + "#token=" + url.QueryEscape(token)
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c, err := h.svc.Config(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) setConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c := new(Config)
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetConfig(r.Context(), c); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson || errors.Cause(err) == tenant.ErrInvalidID {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "saml is configured by admins of the default tenant", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// localPath keeps redirects within control, other values lead to the root.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, "\\") {
+		return "/"
+	}
+	if i := strings.IndexByte(p, '#'); i >= 0 {
+		p = p[:i]
+	}
+	return p
+}
+
+func sendError(w http.ResponseWriter, err error) {
+	switch errors.Cause(err) {
+	case ErrDisabled:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrAssertion, ErrInvalidSignature, ErrUnsigned, ErrNoRole:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,164 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/user"
+)
+
+type fakeUsers struct {
+	provisioned *user.User
+	err         error
+}
+
+func (f *fakeUsers) Provision(ctx context.Context, u *user.User) error {
+	f.provisioned = u
+	return f.err
+}
+
+type fakeTokens struct{}
+
+func (fakeTokens) IssueWithAccesses(userID, tenantID string, accesses []string) (string, error) {
+	return userID + "|" + strings.Join(accesses, ","), nil
+}
+
+func TestHandler_acs(t *testing.T) {
+	idp := newTestIdP(t)
+	response := encode(idp.sign(t, validAssertion().response(), assertionMarker, "_assertion"))
+
+	for _, tc := range []struct {
+		name             string
+		response         string
+		relayState       string
+		provisionErr     error
+		expectedCode     int
+		expectedLocation string
+	}{
+		{
+			name:             "login",
+			response:         response,
+			relayState:       "/clusters",
+			expectedCode:     http.StatusSeeOther,
+			expectedLocation: "/clusters#token=" + url.QueryEscape("alice@example.com|edit,view"),
+		},
+		{
+			name:             "foreign relay state",
+			response:         response,
+			relayState:       "https://evil.example.com",
+			expectedCode:     http.StatusSeeOther,
+			expectedLocation: "/#token=" + url.QueryEscape("alice@example.com|edit,view"),
+		},
+		{
+			name:         "invalid response",
+			response:     encode(validAssertion().response()),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "local user",
+			response:     response,
+			provisionErr: sgerrors.ErrAlreadyExists,
+			expectedCode: http.StatusForbidden,
+		},
+	} {
+		users := &fakeUsers{err: tc.provisionErr}
+		router := mux.NewRouter()
+		NewHandler(newTestService(t, testConfig(idp)), users, fakeTokens{}).Register(router)
+
+		form := url.Values{}
+		form.Set("SAMLResponse", tc.response)
+		form.Set("RelayState", tc.relayState)
+		req := httptest.NewRequest(http.MethodPost, "/saml/acs", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if tc.expectedCode != http.StatusSeeOther {
+			continue
+		}
+		require.Equal(t, tc.expectedLocation, rec.Header().Get("Location"), "TC: %s", tc.name)
+		require.Equal(t, Source, users.provisioned.Source, "TC: %s", tc.name)
+		require.Equal(t, user.RoleEditor, users.provisioned.Role, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_setConfig(t *testing.T) {
+	idp := newTestIdP(t)
+	valid, err := json.Marshal(testConfig(idp))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name         string
+		tenantID     string
+		editor       bool
+		body         []byte
+		expectedCode int
+	}{
+		{
+			name:         "default tenant",
+			tenantID:     tenant.DefaultID,
+			body:         valid,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "other tenant",
+			tenantID:     "acme",
+			body:         valid,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "editor",
+			tenantID:     tenant.DefaultID,
+			editor:       true,
+			body:         valid,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid config",
+			tenantID:     tenant.DefaultID,
+			body:         []byte(`{"enabled":true}`),
+			expectedCode: http.StatusBadRequest,
+		},
+	} {
+		router := mux.NewRouter()
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+		NewHandler(svc, &fakeUsers{}, fakeTokens{}).RegisterConfig(router)
+
+		req := httptest.NewRequest(http.MethodPut, "/saml/config", bytes.NewReader(tc.body))
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), tc.tenantID), !tc.editor))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	for _, tc := range []struct {
+		path     string
+		expected string
+	}{
+		{"/clusters/kube", "/clusters/kube"},
+		{"/clusters#token=x", "/clusters"},
+		{"", "/"},
+		{"https://evil.example.com", "/"},
+		{"//evil.example.com", "/"},
+		{"/\\evil.example.com", "/"},
+	} {
+		require.Equal(t, tc.expected, localPath(tc.path), "TC: %s", tc.path)
+	}
+}
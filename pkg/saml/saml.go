@@ -0,0 +1,552 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/user"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/saml/"
+	configKey            = "config"
+
+	// Source marks users provisioned on saml login.
+	Source = "saml"
+
+	// ClockSkew is tolerated between control and the identity provider.
+	ClockSkew = 3 * time.Minute
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingPOST   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+var (
+	ErrDisabled  = errors.New("saml login is disabled")
+	ErrAssertion = errors.New("invalid assertion")
+	ErrNoRole    = errors.New("no role is mapped to the user")
+)
+
+// Config configures control as a service provider of a SAML 2.0 identity
+// provider, users are provisioned on their first login.
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// EntityID identifies control at the identity provider, assertions
+	// must be restricted to it as an audience.
+	EntityID string `json:"entityId"`
+	// ACSURL is where the identity provider posts responses, it is
+	// https://<control address>/saml/acs.
+	ACSURL string `json:"acsUrl"`
+
+	IdPEntityID string `json:"idpEntityId"`
+	IdPSSOURL   string `json:"idpSsoUrl"`
+	// IdPCertificate verifies signatures of responses, it is PEM encoded.
+	IdPCertificate string `json:"idpCertificate"`
+
+	// LoginAttribute is used as a login instead of the name id when it is set.
+	LoginAttribute string `json:"loginAttribute,omitempty"`
+	// RoleAttribute holds e.g. groups of the user, its values are mapped
+	// to roles with Roles and the most privileged role is given.
+	RoleAttribute string            `json:"roleAttribute,omitempty"`
+	Roles         map[string]string `json:"roles,omitempty"`
+	// DefaultRole is given to users without mapped values, they are
+	// refused when it is empty.
+	DefaultRole string `json:"defaultRole,omitempty"`
+	// TenantID is a tenant of provisioned users.
+	TenantID string `json:"tenantId,omitempty"`
+}
+
+func (c *Config) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	for name, value := range map[string]string{
+		"entity id":     c.EntityID,
+		"acs url":       c.ACSURL,
+		"idp sso url":   c.IdPSSOURL,
+		"idp entity id": c.IdPEntityID,
+	} {
+		if strings.TrimSpace(value) == "" {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "%s is required", name)
+		}
+	}
+	for _, u := range []string{c.ACSURL, c.IdPSSOURL} {
+		if parsed, err := url.Parse(u); err != nil || !parsed.IsAbs() {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "invalid url %s", u)
+		}
+	}
+	if _, err := c.certificate(); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+
+	for value, role := range c.Roles {
+		if !user.ValidRole(role) {
+			return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown role %s of %s", role, value)
+		}
+	}
+	if c.DefaultRole != "" && !user.ValidRole(c.DefaultRole) {
+		return errors.Wrapf(sgerrors.ErrInvalidJson, "unknown default role %s", c.DefaultRole)
+	}
+
+	return tenant.ValidateID(c.TenantID)
+}
+
+func (c *Config) certificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(c.IdPCertificate))
+	if block == nil {
+		return nil, errors.New("idp certificate is not pem encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	return cert, errors.Wrap(err, "parse idp certificate")
+}
+
+// role maps values of the role attribute to the most privileged role.
+func (c *Config) role(values []string) string {
+	mapped := make([]string, 0, len(values))
+	for _, v := range values {
+		if role, ok := c.Roles[v]; ok {
+			mapped = append(mapped, role)
+		}
+	}
+
+	if role := user.HighestRole(mapped); role != "" {
+		return role
+	}
+	return c.DefaultRole
+}
+
+// Identity is a user asserted by the identity provider.
+type Identity struct {
+	Login    string `json:"login"`
+	Role     string `json:"role"`
+	TenantID string `json:"tenantId"`
+}
+
+// Service keeps the configuration and checks responses of the identity provider.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	now     func() time.Time
+
+	// seen are ids of accepted assertions until they expire,
+	// so a captured response can't be replayed
+	m    sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// Config returns the configuration, saml login is disabled unless configured.
+func (s *Service) Config(ctx context.Context) (*Config, error) {
+	data, err := s.storage.Get(ctx, s.prefix, configKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return &Config{}, nil
+		}
+		return nil, errors.Wrap(err, "get saml config")
+	}
+
+	c := new(Config)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal saml config")
+	}
+	return c, nil
+}
+
+// SetConfig validates and stores the configuration.
+func (s *Service) SetConfig(ctx context.Context, c *Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal saml config")
+	}
+	return errors.Wrap(s.storage.Put(ctx, s.prefix, configKey, data), "put saml config")
+}
+
+func (s *Service) enabledConfig(ctx context.Context) (*Config, error) {
+	c, err := s.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Enabled {
+		return nil, ErrDisabled
+	}
+	return c, nil
+}
+
+type authnRequest struct {
+	XMLName      xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID           string       `xml:"ID,attr"`
+	Version      string       `xml:"Version,attr"`
+	IssueInstant string       `xml:"IssueInstant,attr"`
+	Destination  string       `xml:"Destination,attr"`
+	ACSURL       string       `xml:"AssertionConsumerServiceURL,attr"`
+	Binding      string       `xml:"ProtocolBinding,attr"`
+	Issuer       string       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy nameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	AllowCreate bool `xml:"AllowCreate,attr"`
+}
+
+// LoginURL returns an address of the identity provider the user is redirected
+// to, the relay state is posted back with the response.
+func (s *Service) LoginURL(ctx context.Context, relayState string) (string, error) {
+	c, err := s.enabledConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := xml.Marshal(authnRequest{
+		ID:           "_" + uuid.New(),
+		Version:      "2.0",
+		IssueInstant: s.now().UTC().Format(time.RFC3339),
+		Destination:  c.IdPSSOURL,
+		ACSURL:       c.ACSURL,
+		Binding:      bindingPOST,
+		Issuer:       c.EntityID,
+		NameIDPolicy: nameIDPolicy{AllowCreate: true},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "marshal authn request")
+	}
+
+	// requests are deflated with the redirect binding
+	buf := &bytes.Buffer{}
+	w, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(req); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(c.IdPSSOURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parse idp sso url")
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+type entityDescriptor struct {
+	XMLName  xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string       `xml:"entityID,attr"`
+	SP       spDescriptor `xml:"SPSSODescriptor"`
+}
+
+type spDescriptor struct {
+	AuthnRequestsSigned  bool     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned bool     `xml:"WantAssertionsSigned,attr"`
+	Protocols            string   `xml:"protocolSupportEnumeration,attr"`
+	ACS                  endpoint `xml:"AssertionConsumerService"`
+}
+
+type endpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+	Index    int    `xml:"index,attr"`
+}
+
+// Metadata describes control as a service provider to the identity provider.
+func (s *Service) Metadata(ctx context.Context) ([]byte, error) {
+	c, err := s.enabledConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := xml.MarshalIndent(entityDescriptor{
+		EntityID: c.EntityID,
+		SP: spDescriptor{
+			WantAssertionsSigned: true,
+			Protocols:            nsProtocol,
+			ACS: endpoint{
+				Binding:  bindingPOST,
+				Location: c.ACSURL,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal metadata")
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type response struct {
+	XMLName    xml.Name    `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Assertions []assertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+}
+
+type assertion struct {
+	XMLName    xml.Name    `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID         string      `xml:"ID,attr"`
+	Issuer     string      `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject    subject     `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *conditions `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Statements []statement `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+type subject struct {
+	NameID        string         `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	Confirmations []confirmation `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+}
+
+type confirmation struct {
+	Method string           `xml:"Method,attr"`
+	Data   confirmationData `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+}
+
+type confirmationData struct {
+	Recipient    string    `xml:"Recipient,attr"`
+	NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+}
+
+type conditions struct {
+	NotBefore    time.Time     `xml:"NotBefore,attr"`
+	NotOnOrAfter time.Time     `xml:"NotOnOrAfter,attr"`
+	Audiences    []restriction `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+}
+
+type restriction struct {
+	Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+}
+
+type statement struct {
+	Attributes []attribute `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+}
+
+type attribute struct {
+	Name   string   `xml:"Name,attr"`
+	Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+}
+
+func (a *assertion) values(name string) []string {
+	values := make([]string, 0)
+	for _, s := range a.Statements {
+		for _, attr := range s.Attributes {
+			if attr.Name == name {
+				for _, v := range attr.Values {
+					values = append(values, strings.TrimSpace(v))
+				}
+			}
+		}
+	}
+	return values
+}
+
+// Authenticate checks the base64 encoded response posted by the identity
+// provider and returns the asserted user.
+func (s *Service) Authenticate(ctx context.Context, encoded string) (*Identity, error) {
+	c, err := s.enabledConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := c.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, errors.Wrap(ErrAssertion, "decode response")
+	}
+	a, err := signedAssertion(data, cert)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.check(c, a); err != nil {
+		return nil, err
+	}
+
+	login := strings.TrimSpace(a.Subject.NameID)
+	if c.LoginAttribute != "" {
+		login = ""
+		if values := a.values(c.LoginAttribute); len(values) > 0 {
+			login = values[0]
+		}
+	}
+	if login == "" {
+		return nil, errors.Wrap(ErrAssertion, "no login")
+	}
+
+	role := c.role(a.values(c.RoleAttribute))
+	if role == "" {
+		return nil, errors.Wrap(ErrNoRole, login)
+	}
+
+	return &Identity{
+		Login:    login,
+		Role:     role,
+		TenantID: c.TenantID,
+	}, nil
+}
+
+// signedAssertion returns the assertion covered by a signature of the response
+// or of the assertion itself, the rest of the document is not trusted.
+func signedAssertion(data []byte, cert *x509.Certificate) (*assertion, error) {
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, errors.Wrap(ErrAssertion, err.Error())
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, errors.Wrap(ErrAssertion, "not a response")
+	}
+
+	// failed responses are usually not signed
+	if status := root.child(nsProtocol, "Status"); status != nil {
+		if code := status.child(nsProtocol, "StatusCode"); code == nil || code.attr("Value") != statusSuccess {
+			value := ""
+			if code != nil {
+				value = code.attr("Value")
+			}
+			return nil, errors.Wrapf(ErrAssertion, "status %s", value)
+		}
+	}
+	if len(root.elements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.Wrap(ErrAssertion, "encrypted assertions are not supported")
+	}
+
+	content, err := verifySignature(root, cert)
+	if err == nil {
+		r := response{}
+		if err = xml.Unmarshal(content, &r); err != nil {
+			return nil, errors.Wrap(ErrAssertion, err.Error())
+		}
+		if len(r.Assertions) != 1 {
+			return nil, errors.Wrap(ErrAssertion, "response must have one assertion")
+		}
+		return &r.Assertions[0], nil
+	}
+	if errors.Cause(err) != ErrUnsigned {
+		return nil, err
+	}
+
+	list := root.elements(nsAssertion, "Assertion")
+	if len(list) != 1 {
+		return nil, errors.Wrap(ErrAssertion, "response must have one assertion")
+	}
+	if content, err = verifySignature(list[0], cert); err != nil {
+		return nil, err
+	}
+
+	a := &assertion{}
+	if err = xml.Unmarshal(content, a); err != nil {
+		return nil, errors.Wrap(ErrAssertion, err.Error())
+	}
+	return a, nil
+}
+
+// check validates the issuer, conditions and the bearer confirmation of the
+// assertion, accepted assertions can't be used again.
+func (s *Service) check(c *Config, a *assertion) error {
+	now := s.now()
+
+	if strings.TrimSpace(a.Issuer) != c.IdPEntityID {
+		return errors.Wrapf(ErrAssertion, "unknown issuer %s", a.Issuer)
+	}
+
+	if a.Conditions == nil {
+		return errors.Wrap(ErrAssertion, "no conditions")
+	}
+	if !a.Conditions.NotBefore.IsZero() && now.Add(ClockSkew).Before(a.Conditions.NotBefore) {
+		return errors.Wrap(ErrAssertion, "assertion is not valid yet")
+	}
+	if !a.Conditions.NotOnOrAfter.IsZero() && !now.Add(-ClockSkew).Before(a.Conditions.NotOnOrAfter) {
+		return errors.Wrap(ErrAssertion, "assertion has expired")
+	}
+	if len(a.Conditions.Audiences) == 0 {
+		return errors.Wrap(ErrAssertion, "no audience restriction")
+	}
+	// every restriction must be satisfied
+	for _, r := range a.Conditions.Audiences {
+		if !contains(r.Audiences, c.EntityID) {
+			return errors.Wrap(ErrAssertion, "control is not an audience")
+		}
+	}
+
+	var expires time.Time
+	for _, conf := range a.Subject.Confirmations {
+		if conf.Method != methodBearer || conf.Data.Recipient != c.ACSURL {
+			continue
+		}
+		if !now.Add(-ClockSkew).Before(conf.Data.NotOnOrAfter) {
+			continue
+		}
+		expires = conf.Data.NotOnOrAfter
+		break
+	}
+	if expires.IsZero() {
+		return errors.Wrap(ErrAssertion, "no valid bearer confirmation")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	for id, exp := range s.seen {
+		if now.After(exp.Add(ClockSkew)) {
+			delete(s.seen, id)
+		}
+	}
+	if a.ID == "" {
+		return errors.Wrap(ErrAssertion, "no id")
+	}
+	if _, ok := s.seen[a.ID]; ok {
+		return errors.Wrap(ErrAssertion, "assertion has already been used")
+	}
+	s.seen[a.ID] = expires
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.TrimSpace(v) == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,351 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/user"
+)
+
+const (
+	responseMarker  = "<!--response signature-->"
+	assertionMarker = "<!--assertion signature-->"
+)
+
+var testNow = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testConfig(idp *testIdP) *Config {
+	return &Config{
+		Enabled:        true,
+		EntityID:       "https://control.example.com",
+		ACSURL:         "https://control.example.com/saml/acs",
+		IdPEntityID:    "https://idp.example.com",
+		IdPSSOURL:      "https://idp.example.com/sso",
+		IdPCertificate: idp.certPEM,
+		RoleAttribute:  "groups",
+		Roles: map[string]string{
+			"ops":     user.RoleAdmin,
+			"devs":    user.RoleEditor,
+			"support": user.RoleViewer,
+		},
+	}
+}
+
+func newTestService(t *testing.T, c *Config) *Service {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	svc.now = func() time.Time {
+		return testNow
+	}
+	require.NoError(t, svc.SetConfig(context.Background(), c))
+	return svc
+}
+
+type testAssertion struct {
+	id        string
+	issuer    string
+	nameID    string
+	audience  string
+	recipient string
+	notBefore time.Time
+	expires   time.Time
+	groups    []string
+	status    string
+}
+
+func validAssertion() testAssertion {
+	return testAssertion{
+		id:        "_assertion",
+		issuer:    "https://idp.example.com",
+		nameID:    "alice@example.com",
+		audience:  "https://control.example.com",
+		recipient: "https://control.example.com/saml/acs",
+		notBefore: testNow.Add(-time.Minute),
+		expires:   testNow.Add(5 * time.Minute),
+		groups:    []string{"devs"},
+		status:    statusSuccess,
+	}
+}
+
+func (a testAssertion) response() string {
+	values := ""
+	for _, g := range a.groups {
+		values += "<saml:AttributeValue>" + g + "</saml:AttributeValue>"
+	}
+
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="_response" Version="2.0">`+
+		`<saml:Issuer>%s</saml:Issuer>%s`+
+		`<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>`+
+		`<saml:Assertion ID="%s" Version="2.0">`+
+		`<saml:Issuer>%s</saml:Issuer>%s`+
+		`<saml:Subject><saml:NameID>%s</saml:NameID>`+
+		`<saml:SubjectConfirmation Method="%s"><saml:SubjectConfirmationData Recipient="%s" NotOnOrAfter="%s"/></saml:SubjectConfirmation>`+
+		`</saml:Subject>`+
+		`<saml:Conditions NotBefore="%s" NotOnOrAfter="%s">`+
+		`<saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>`+
+		`</saml:Conditions>`+
+		`<saml:AttributeStatement><saml:Attribute Name="groups">%s</saml:Attribute></saml:AttributeStatement>`+
+		`</saml:Assertion></samlp:Response>`,
+		nsProtocol, nsAssertion, a.issuer, responseMarker, a.status,
+		a.id, a.issuer, assertionMarker, a.nameID,
+		methodBearer, a.recipient, a.expires.Format(time.RFC3339),
+		a.notBefore.Format(time.RFC3339), a.expires.Format(time.RFC3339),
+		a.audience, values)
+}
+
+func encode(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func TestService_Authenticate(t *testing.T) {
+	idp := newTestIdP(t)
+
+	signAssertion := func(a testAssertion) string {
+		return encode(idp.sign(t, a.response(), assertionMarker, a.id))
+	}
+	with := func(change func(a *testAssertion)) testAssertion {
+		a := validAssertion()
+		change(&a)
+		return a
+	}
+
+	for _, tc := range []struct {
+		name        string
+		config      func(c *Config)
+		response    string
+		expected    *Identity
+		expectedErr error
+	}{
+		{
+			name:     "signed assertion",
+			response: signAssertion(validAssertion()),
+			expected: &Identity{Login: "alice@example.com", Role: user.RoleEditor},
+		},
+		{
+			name:     "signed response",
+			response: encode(idp.sign(t, validAssertion().response(), responseMarker, "_response")),
+			expected: &Identity{Login: "alice@example.com", Role: user.RoleEditor},
+		},
+		{
+			name: "most privileged role",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.groups = []string{"support", "ops", "unknown"}
+			})),
+			expected: &Identity{Login: "alice@example.com", Role: user.RoleAdmin},
+		},
+		{
+			name: "default role",
+			config: func(c *Config) {
+				c.DefaultRole = user.RoleViewer
+				c.TenantID = "acme"
+			},
+			response: signAssertion(with(func(a *testAssertion) {
+				a.groups = nil
+			})),
+			expected: &Identity{Login: "alice@example.com", Role: user.RoleViewer, TenantID: "acme"},
+		},
+		{
+			name: "no role",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.groups = []string{"unknown"}
+			})),
+			expectedErr: ErrNoRole,
+		},
+		{
+			name: "login attribute",
+			config: func(c *Config) {
+				c.LoginAttribute = "groups"
+				c.DefaultRole = user.RoleViewer
+			},
+			response: signAssertion(with(func(a *testAssertion) {
+				a.groups = []string{"alice"}
+			})),
+			expected: &Identity{Login: "alice", Role: user.RoleViewer},
+		},
+		{
+			name:        "unsigned",
+			response:    encode(validAssertion().response()),
+			expectedErr: ErrUnsigned,
+		},
+		{
+			name:        "tampered",
+			response:    encode(strings.Replace(idp.sign(t, validAssertion().response(), assertionMarker, "_assertion"), "devs", "ops", 1)),
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			// signatures of the response cover the whole assertion
+			name: "assertion added to signed response",
+			response: encode(strings.Replace(idp.sign(t, validAssertion().response(), responseMarker, "_response"),
+				"</samlp:Response>", `<saml:Assertion ID="_other"/></samlp:Response>`, 1)),
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name: "unknown issuer",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.issuer = "https://evil.example.com"
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name: "expired",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.expires = testNow.Add(-ClockSkew - time.Second)
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name: "not valid yet",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.notBefore = testNow.Add(ClockSkew + time.Minute)
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name: "other audience",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.audience = "https://other.example.com"
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name: "other recipient",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.recipient = "https://other.example.com/saml/acs"
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name: "failed status",
+			response: signAssertion(with(func(a *testAssertion) {
+				a.status = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+			})),
+			expectedErr: ErrAssertion,
+		},
+		{
+			name:        "disabled",
+			config:      func(c *Config) { c.Enabled = false },
+			response:    signAssertion(validAssertion()),
+			expectedErr: ErrDisabled,
+		},
+	} {
+		c := testConfig(idp)
+		if tc.config != nil {
+			tc.config(c)
+		}
+		svc := newTestService(t, c)
+
+		id, err := svc.Authenticate(context.Background(), tc.response)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.expected, id, "TC: %s", tc.name)
+	}
+}
+
+func TestService_AuthenticateReplay(t *testing.T) {
+	idp := newTestIdP(t)
+	svc := newTestService(t, testConfig(idp))
+	response := encode(idp.sign(t, validAssertion().response(), assertionMarker, "_assertion"))
+
+	_, err := svc.Authenticate(context.Background(), response)
+	require.NoError(t, err)
+
+	_, err = svc.Authenticate(context.Background(), response)
+	require.Equal(t, ErrAssertion, errors.Cause(err))
+}
+
+func TestService_SetConfig(t *testing.T) {
+	idp := newTestIdP(t)
+
+	for _, tc := range []struct {
+		name        string
+		config      func(c *Config)
+		expectedErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "disabled without settings",
+			config: func(c *Config) { *c = Config{} },
+		},
+		{
+			name:        "no entity id",
+			config:      func(c *Config) { c.EntityID = "" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "relative acs url",
+			config:      func(c *Config) { c.ACSURL = "/saml/acs" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "invalid certificate",
+			config:      func(c *Config) { c.IdPCertificate = "certificate" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+		{
+			name:        "unknown role",
+			config:      func(c *Config) { c.Roles["devs"] = "root" },
+			expectedErr: sgerrors.ErrInvalidJson,
+		},
+	} {
+		c := testConfig(idp)
+		if tc.config != nil {
+			tc.config(c)
+		}
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+		err := svc.SetConfig(context.Background(), c)
+		require.Equal(t, tc.expectedErr, errors.Cause(err), "TC: %s: %v", tc.name, err)
+		if tc.expectedErr != nil {
+			continue
+		}
+
+		stored, err := svc.Config(context.Background())
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, c, stored, "TC: %s", tc.name)
+	}
+}
+
+func TestService_LoginURL(t *testing.T) {
+	svc := newTestService(t, testConfig(newTestIdP(t)))
+
+	u, err := svc.LoginURL(context.Background(), "/clusters")
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	require.Equal(t, "idp.example.com", parsed.Host)
+	require.Equal(t, "/clusters", parsed.Query().Get("RelayState"))
+
+	deflated, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	req, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+	require.Contains(t, string(req), `AssertionConsumerServiceURL="https://control.example.com/saml/acs"`)
+	require.Contains(t, string(req), "<Issuer xmlns=\""+nsAssertion+"\">https://control.example.com</Issuer>")
+}
+
+func TestService_Metadata(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	_, err := svc.Metadata(context.Background())
+	require.Equal(t, ErrDisabled, err)
+
+	svc = newTestService(t, testConfig(newTestIdP(t)))
+	data, err := svc.Metadata(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, string(data), `entityID="https://control.example.com"`)
+	require.Contains(t, string(data), `Location="https://control.example.com/saml/acs"`)
+}
@@ -0,0 +1,281 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+type Servicer interface {
+	Config(ctx context.Context) (*Config, error)
+	SetConfig(ctx context.Context, c *Config) error
+	CreateToken(ctx context.Context, userID, tenantID, name string, accesses []string, ttl time.Duration) (*Session, string, error)
+	Get(ctx context.Context, id string) (*Session, error)
+	List(ctx context.Context, userID string) ([]*Session, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAll(ctx context.Context, userID, kind, except string) (int, error)
+}
+
+// Roles resolves roles and permissions that are given to tokens.
+type Roles interface {
+	Resolve(ctx context.Context, accesses []string) (permission.Set, error)
+	Valid(ctx context.Context, accesses []string) error
+}
+
+// TokenRequest creates an api token, the token has accesses of the current
+// session unless they are limited. Accesses are roles or permissions like
+// kube:read, so automation tokens can be scoped to what they do.
+type TokenRequest struct {
+	Name     string   `json:"name"`
+	Accesses []string `json:"accesses,omitempty"`
+	// TTL is e.g. 720h, the longest lifetime of tokens is used when it is empty.
+	TTL string `json:"ttl,omitempty"`
+}
+
+type TokenResponse struct {
+	Session *Session `json:"session"`
+	Token   string   `json:"token"`
+}
+
+// Handler lets users see and revoke their sessions, users of the default
+// tenant manage sessions of everyone.
+type Handler struct {
+	svc   Servicer
+	roles Roles
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer, roles Roles) *Handler {
+	return &Handler{
+		svc:   svc,
+		roles: roles,
+	}
+}
+
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/sessions/config", h.getConfig).Methods(http.MethodGet)
+	r.HandleFunc("/sessions/config", h.setConfig).Methods(http.MethodPut)
+	r.HandleFunc("/sessions/tokens", h.createToken).Methods(http.MethodPost)
+	r.HandleFunc("/sessions", h.list).Methods(http.MethodGet)
+	r.HandleFunc("/sessions", h.revokeAll).Methods(http.MethodDelete)
+	r.HandleFunc("/sessions/{id}", h.revoke).Methods(http.MethodDelete)
+}
+
+func isAdmin(ctx context.Context) bool {
+	return tenant.FromContext(ctx) == tenant.DefaultID && api.IsAdmin(ctx)
+}
+
+// targetUser returns the user of the request or a user given by the admin
+// with the user parameter, "*" stands for all users.
+func targetUser(r *http.Request) (string, bool) {
+	userID := r.URL.Query().Get("user")
+	if userID == "" {
+		return api.UserFromContext(r.Context()), true
+	}
+	if !isAdmin(r.Context()) {
+		return "", false
+	}
+	if userID == "*" {
+		return "", true
+	}
+	return userID, true
+}
+
+// list returns active sessions: GET /sessions?user=login
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	userID, ok := targetUser(r)
+	if !ok {
+		http.Error(w, "sessions of other users are managed by the default tenant", http.StatusForbidden)
+		return
+	}
+
+	list, err := h.svc.List(r.Context(), userID)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	current := api.SessionFromContext(r.Context())
+	for _, sess := range list {
+		sess.Current = sess.ID == current
+	}
+	if err = json.NewEncoder(w).Encode(list); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	sess, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, id, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+	// sessions of other users are not disclosed
+	if sess.UserID != api.UserFromContext(r.Context()) && !isAdmin(r.Context()) {
+		message.SendNotFound(w, id, sgerrors.ErrNotFound)
+		return
+	}
+
+	if err = h.svc.Revoke(r.Context(), id); err != nil && !sgerrors.IsNotFound(err) {
+		message.SendUnknownError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// revokeAll ends sessions in bulk: DELETE /sessions?user=login&kind=token&others=true,
+// the current session is kept with others.
+func (h *Handler) revokeAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := targetUser(r)
+	if !ok {
+		http.Error(w, "sessions of other users are managed by the default tenant", http.StatusForbidden)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != KindLogin && kind != KindToken {
+		http.Error(w, "unknown kind "+kind, http.StatusBadRequest)
+		return
+	}
+	except := ""
+	if r.URL.Query().Get("others") == "true" {
+		except = api.SessionFromContext(r.Context())
+	}
+
+	revoked, err := h.svc.RevokeAll(r.Context(), userID, kind, except)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	resp := struct {
+		Revoked int `json:"revoked"`
+	}{revoked}
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) createToken(w http.ResponseWriter, r *http.Request) {
+	req := &TokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+	if req.Name == "" {
+		message.SendValidationFailed(w, errors.New("token name is required"))
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			message.SendValidationFailed(w, errors.Wrap(err, "ttl"))
+			return
+		}
+	}
+
+	accesses := req.Accesses
+	if len(accesses) == 0 {
+		// tokens issued without a session have accesses of editors
+		accesses = []string{"edit", "view"}
+		if id := api.SessionFromContext(r.Context()); id != "" {
+			current, err := h.svc.Get(r.Context(), id)
+			if err != nil {
+				message.SendUnknownError(w, err)
+				return
+			}
+			accesses = current.Accesses
+		}
+	}
+	if err := h.roles.Valid(r.Context(), accesses); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	// tokens can't have more permissions than the token that creates them
+	requested, err := h.roles.Resolve(r.Context(), accesses)
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+	if !permission.FromContext(r.Context()).Covers(requested) {
+		http.Error(w, "token can't have more permissions than the session", http.StatusForbidden)
+		return
+	}
+
+	sess, token, err := h.svc.CreateToken(r.Context(), api.UserFromContext(r.Context()),
+		tenant.FromContext(r.Context()), req.Name, accesses, ttl)
+	if err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(TokenResponse{Session: sess, Token: token}); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	c, err := h.svc.Config(r.Context())
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+func (h *Handler) setConfig(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		http.Error(w, "sessions are configured by admins of the default tenant", http.StatusForbidden)
+		return
+	}
+
+	c := new(Config)
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetConfig(r.Context(), c); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
@@ -0,0 +1,206 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/api"
+	"github.com/supergiant/control/pkg/jwt"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// serve passes requests through the auth middleware with sessions, like the api does.
+func serve(svc *Service, token, method, url string, body []byte) *httptest.ResponseRecorder {
+	roles := permission.NewService(permission.DefaultStoragePrefix, memory.NewInMemoryRepository())
+	md := api.Middleware{
+		TokenService: jwt.NewTokenService(60, []byte("secret")),
+		Sessions:     svc,
+		Roles:        roles,
+	}
+	router := mux.NewRouter()
+	NewHandler(svc, roles).Register(router)
+	router.Use(md.AuthMiddleware)
+
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_sessions(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	alice, err := svc.IssueWithAccesses("alice", "acme", []string{"edit", "view"})
+	require.NoError(t, err)
+	other, err := svc.IssueWithAccesses("alice", "acme", []string{"edit", "view"})
+	require.NoError(t, err)
+	bob, err := svc.IssueWithAccesses("bob", "acme", []string{"edit", "view"})
+	require.NoError(t, err)
+	admin, err := svc.IssueWithAccesses("root", tenant.DefaultID, []string{"admin", "edit", "view"})
+	require.NoError(t, err)
+
+	rec := serve(svc, alice, http.MethodGet, "/sessions", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	list := make([]*Session, 0)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list, 2)
+	for _, sess := range list {
+		require.Equal(t, sess.ID == sessionID(t, alice), sess.Current)
+	}
+
+	// sessions of other users are managed by the default tenant
+	rec = serve(svc, alice, http.MethodGet, "/sessions?user=bob", nil)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = serve(svc, alice, http.MethodDelete, "/sessions/"+sessionID(t, bob), nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(svc, admin, http.MethodGet, "/sessions?user=*", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	require.Len(t, list, 4)
+
+	// other sessions of the user are revoked
+	rec = serve(svc, alice, http.MethodDelete, "/sessions?others=true", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, http.StatusForbidden, serve(svc, other, http.MethodGet, "/sessions", nil).Code)
+	require.Equal(t, http.StatusOK, serve(svc, alice, http.MethodGet, "/sessions", nil).Code)
+
+	rec = serve(svc, admin, http.MethodDelete, "/sessions/"+sessionID(t, bob), nil)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, http.StatusForbidden, serve(svc, bob, http.MethodGet, "/sessions", nil).Code)
+}
+
+func TestHandler_createToken(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	viewer, err := svc.IssueWithAccesses("viewer", "acme", []string{"view"})
+	require.NoError(t, err)
+	editor, err := svc.IssueWithAccesses("editor", "acme", []string{"edit", "view"})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name             string
+		token            string
+		body             string
+		expectedCode     int
+		expectedAccesses []string
+	}{
+		{
+			name:             "editor",
+			token:            editor,
+			body:             `{"name":"ci","ttl":"720h"}`,
+			expectedCode:     http.StatusCreated,
+			expectedAccesses: []string{"edit", "view"},
+		},
+		{
+			name:             "limited accesses",
+			token:            editor,
+			body:             `{"name":"monitoring","accesses":["view"]}`,
+			expectedCode:     http.StatusCreated,
+			expectedAccesses: []string{"view"},
+		},
+		{
+			name:             "permissions",
+			token:            editor,
+			body:             `{"name":"automation","accesses":["session:read","kube:read"]}`,
+			expectedCode:     http.StatusCreated,
+			expectedAccesses: []string{"session:read", "kube:read"},
+		},
+		{
+			name:         "unknown role",
+			token:        editor,
+			body:         `{"name":"automation","accesses":["operator"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "no name",
+			token:        editor,
+			body:         `{}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "too long",
+			token:        editor,
+			body:         `{"name":"ci","ttl":"100000h"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			// viewers can't change anything, including their tokens
+			name:         "viewer",
+			token:        viewer,
+			body:         `{"name":"ci"}`,
+			expectedCode: http.StatusForbidden,
+		},
+	} {
+		rec := serve(svc, tc.token, http.MethodPost, "/sessions/tokens", []byte(tc.body))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.name, rec.Body.String())
+		if tc.expectedCode != http.StatusCreated {
+			continue
+		}
+
+		resp := TokenResponse{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp), "TC: %s", tc.name)
+		require.Equal(t, KindToken, resp.Session.Kind, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedAccesses, resp.Session.Accesses, "TC: %s", tc.name)
+		require.Equal(t, http.StatusOK, serve(svc, resp.Token, http.MethodGet, "/sessions", nil).Code,
+			"TC: %s", tc.name)
+	}
+}
+
+func TestHandler_createScopedToken(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	_, scoped, err := svc.CreateToken(context.Background(), "ci", "acme", "ci",
+		[]string{"token:create", "kube:read"}, 0)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		body         string
+		expectedCode int
+	}{
+		{`{"name":"copy"}`, http.StatusCreated},
+		{`{"name":"reader","accesses":["kube:read"]}`, http.StatusCreated},
+		{`{"name":"deleter","accesses":["kube:delete"]}`, http.StatusForbidden},
+		{`{"name":"viewer","accesses":["view"]}`, http.StatusForbidden},
+		{`{"name":"any","accesses":["kube:*"]}`, http.StatusForbidden},
+	} {
+		rec := serve(svc, scoped, http.MethodPost, "/sessions/tokens", []byte(tc.body))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s: %s", tc.body, rec.Body.String())
+	}
+
+	// the token has no permission to read sessions
+	require.Equal(t, http.StatusForbidden, serve(svc, scoped, http.MethodGet, "/sessions", nil).Code)
+}
+
+func TestHandler_config(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	user, err := svc.IssueWithAccesses("user", "acme", []string{"edit", "view"})
+	require.NoError(t, err)
+	admin, err := svc.IssueWithAccesses("root", tenant.DefaultID, []string{"admin", "edit", "view"})
+	require.NoError(t, err)
+
+	editor, err := svc.IssueWithAccesses("editor", tenant.DefaultID, []string{"edit", "view"})
+	require.NoError(t, err)
+
+	body := []byte(`{"lifetime":"8h","idleTimeout":"30m"}`)
+	require.Equal(t, http.StatusForbidden, serve(svc, user, http.MethodPut, "/sessions/config", body).Code)
+	require.Equal(t, http.StatusForbidden, serve(svc, editor, http.MethodPut, "/sessions/config", body).Code)
+	require.Equal(t, http.StatusBadRequest,
+		serve(svc, admin, http.MethodPut, "/sessions/config", []byte(`{"lifetime":"8"}`)).Code)
+
+	rec := serve(svc, admin, http.MethodPut, "/sessions/config", body)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = serve(svc, user, http.MethodGet, "/sessions/config", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	c := &Config{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(c))
+	require.Equal(t, &Config{Lifetime: "8h", IdleTimeout: "30m"}, c)
+}
@@ -0,0 +1,392 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/session/"
+	configPrefix         = "/supergiant/session-config/"
+	configKey            = "config"
+
+	// KindLogin sessions are started by logins of users.
+	KindLogin = "login"
+	// KindToken sessions are api tokens created by users for automation.
+	KindToken = "token"
+
+	DefaultLifetime      = 24 * time.Hour
+	DefaultTokenLifetime = 90 * 24 * time.Hour
+	DefaultPruneInterval = time.Hour
+
+	// touchInterval limits writes of the last use of sessions.
+	touchInterval = time.Minute
+)
+
+var (
+	ErrRevoked = errors.New("session is revoked")
+	ErrExpired = errors.New("session has expired")
+)
+
+// Session is a login of a user or an api token, tokens of the session
+// are accepted until it expires or is revoked.
+type Session struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Name describes api tokens.
+	Name       string    `json:"name,omitempty"`
+	UserID     string    `json:"userId"`
+	TenantID   string    `json:"tenantId"`
+	Accesses   []string  `json:"accesses"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+
+	// Current marks the session of the request in listings.
+	Current bool `json:"current,omitempty"`
+}
+
+// Config limits sessions, durations are e.g. 8h or 30m.
+type Config struct {
+	// Lifetime of login sessions, shorter lifetimes apply to started sessions.
+	Lifetime string `json:"lifetime,omitempty"`
+	// IdleTimeout ends login sessions that are not used, it is disabled when empty.
+	IdleTimeout string `json:"idleTimeout,omitempty"`
+	// TokenLifetime is the longest lifetime of api tokens.
+	TokenLifetime string `json:"tokenLifetime,omitempty"`
+}
+
+type limits struct {
+	lifetime      time.Duration
+	idleTimeout   time.Duration
+	tokenLifetime time.Duration
+}
+
+func (c *Config) limits() (*limits, error) {
+	l := &limits{
+		lifetime:      DefaultLifetime,
+		tokenLifetime: DefaultTokenLifetime,
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"lifetime", c.Lifetime, &l.lifetime},
+		{"idle timeout", c.IdleTimeout, &l.idleTimeout},
+		{"token lifetime", c.TokenLifetime, &l.tokenLifetime},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < touchInterval {
+			return nil, errors.Wrapf(sgerrors.ErrInvalidJson, "%s %s must be at least %s",
+				d.name, d.value, touchInterval)
+		}
+		*d.to = parsed
+	}
+	return l, nil
+}
+
+type signer interface {
+	IssueForSession(userID, tenantID, sessionID string, accesses []string, expiresAt time.Time) (string, error)
+}
+
+// Service keeps sessions in the storage, so they can be revoked on any replica.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+	signer  signer
+	now     func() time.Time
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface, signer signer) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+		signer:  signer,
+		now:     time.Now,
+	}
+}
+
+// Config returns limits of sessions.
+func (s *Service) Config(ctx context.Context) (*Config, error) {
+	data, err := s.storage.Get(ctx, configPrefix, configKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return &Config{}, nil
+		}
+		return nil, errors.Wrap(err, "get session config")
+	}
+
+	c := new(Config)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal session config")
+	}
+	return c, nil
+}
+
+// SetConfig validates and stores limits of sessions.
+func (s *Service) SetConfig(ctx context.Context, c *Config) error {
+	if _, err := c.limits(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal session config")
+	}
+	return errors.Wrap(s.storage.Put(ctx, configPrefix, configKey, data), "put session config")
+}
+
+func (s *Service) limits(ctx context.Context) (*limits, error) {
+	c, err := s.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.limits()
+}
+
+// IssueWithAccesses starts a login session of the user and returns its token.
+func (s *Service) IssueWithAccesses(userID, tenantID string, accesses []string) (string, error) {
+	ctx := context.Background()
+
+	l, err := s.limits(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	_, token, err := s.create(ctx, &Session{
+		Kind:      KindLogin,
+		UserID:    userID,
+		TenantID:  tenantID,
+		Accesses:  accesses,
+		CreatedAt: now,
+		ExpiresAt: now.Add(l.lifetime),
+	})
+	return token, err
+}
+
+// CreateToken creates an api token of the user, the token is returned only once.
+func (s *Service) CreateToken(ctx context.Context, userID, tenantID, name string, accesses []string, ttl time.Duration) (*Session, string, error) {
+	l, err := s.limits(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if ttl == 0 {
+		ttl = l.tokenLifetime
+	}
+	if ttl < 0 || ttl > l.tokenLifetime {
+		return nil, "", errors.Wrapf(sgerrors.ErrInvalidJson, "token lifetime must be up to %s", l.tokenLifetime)
+	}
+
+	now := s.now()
+	return s.create(ctx, &Session{
+		Kind:      KindToken,
+		Name:      name,
+		UserID:    userID,
+		TenantID:  tenantID,
+		Accesses:  accesses,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+}
+
+func (s *Service) create(ctx context.Context, sess *Session) (*Session, string, error) {
+	sess.ID = uuid.New()
+	sess.LastUsedAt = sess.CreatedAt
+
+	if err := s.put(ctx, sess); err != nil {
+		return nil, "", err
+	}
+	token, err := s.signer.IssueForSession(sess.UserID, sess.TenantID, sess.ID, sess.Accesses, sess.ExpiresAt)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "issue token")
+	}
+	return sess, token, nil
+}
+
+func (s *Service) put(ctx context.Context, sess *Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return errors.Wrap(err, "marshal session")
+	}
+	return errors.Wrapf(s.storage.Put(ctx, s.prefix, sess.ID, data), "put session %s", sess.ID)
+}
+
+// Get returns a session by id.
+func (s *Service) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.storage.Get(ctx, s.prefix, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := new(Session)
+	if err = json.Unmarshal(data, sess); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal session %s", id)
+	}
+	return sess, nil
+}
+
+// Check accepts tokens of active sessions, the last use of the session is updated.
+func (s *Service) Check(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			return ErrRevoked
+		}
+		return err
+	}
+	l, err := s.limits(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if s.expired(sess, l, now) {
+		if err = s.storage.Delete(ctx, s.prefix, id); err != nil {
+			logrus.Warnf("session: delete expired %s: %v", id, err)
+		}
+		return ErrExpired
+	}
+
+	if now.Sub(sess.LastUsedAt) >= touchInterval {
+		sess.LastUsedAt = now
+		if err = s.put(ctx, sess); err != nil {
+			logrus.Warnf("session: update last use of %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) expired(sess *Session, l *limits, now time.Time) bool {
+	if !now.Before(sess.ExpiresAt) {
+		return true
+	}
+	if sess.Kind != KindLogin {
+		return false
+	}
+	if !now.Before(sess.CreatedAt.Add(l.lifetime)) {
+		return true
+	}
+	return l.idleTimeout > 0 && now.Sub(sess.LastUsedAt) >= l.idleTimeout
+}
+
+// List returns active sessions of the user, sessions of all users are
+// returned for the empty id.
+func (s *Service) List(ctx context.Context, userID string) ([]*Session, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "get sessions")
+	}
+	l, err := s.limits(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	list := make([]*Session, 0)
+	for _, data := range raw {
+		sess := new(Session)
+		if err = json.Unmarshal(data, sess); err != nil {
+			return nil, errors.Wrap(err, "unmarshal session")
+		}
+		if (userID == "" || sess.UserID == userID) && !s.expired(sess, l, now) {
+			list = append(list, sess)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Revoke ends the session, its tokens are refused from now on.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return errors.Wrapf(s.storage.Delete(ctx, s.prefix, id), "delete session %s", id)
+}
+
+// RevokeAll ends sessions of the user of the kind, all kinds are revoked for
+// the empty one. The session with the except id is kept, e.g. the current one.
+func (s *Service) RevokeAll(ctx context.Context, userID, kind, except string) (int, error) {
+	list, err := s.List(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, sess := range list {
+		if sess.ID == except || (kind != "" && sess.Kind != kind) {
+			continue
+		}
+		if err = s.storage.Delete(ctx, s.prefix, sess.ID); err != nil {
+			return revoked, errors.Wrapf(err, "delete session %s", sess.ID)
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// Prune removes expired sessions.
+func (s *Service) Prune(ctx context.Context) (int, error) {
+	raw, err := s.storage.GetAll(ctx, s.prefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "get sessions")
+	}
+	l, err := s.limits(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	pruned := 0
+	for _, data := range raw {
+		sess := new(Session)
+		if err = json.Unmarshal(data, sess); err != nil {
+			logrus.Warnf("session: prune: %v", err)
+			continue
+		}
+		if !s.expired(sess, l, now) {
+			continue
+		}
+		if err = s.storage.Delete(ctx, s.prefix, sess.ID); err != nil {
+			return pruned, errors.Wrapf(err, "delete session %s", sess.ID)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// Run prunes expired sessions with the interval.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Prune(ctx); err != nil {
+				logrus.Errorf("session: prune: %v", err)
+			}
+		}
+	}
+}
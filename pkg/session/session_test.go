@@ -0,0 +1,196 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/jwt"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestService(t *testing.T, c *Config) (*Service, *clock) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository(),
+		jwt.NewTokenService(60, []byte("secret")))
+	clk := &clock{now: time.Now()}
+	svc.now = clk.Now
+
+	if c != nil {
+		require.NoError(t, svc.SetConfig(context.Background(), c))
+	}
+	return svc, clk
+}
+
+func sessionID(t *testing.T, token string) string {
+	claims, err := jwt.NewTokenService(60, []byte("secret")).Validate(token)
+	require.NoError(t, err)
+	return claims["session_id"].(string)
+}
+
+func TestService_Check(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		config      *Config
+		kind        string
+		uses        []time.Duration
+		expectedErr error
+	}{
+		{
+			name: "active login",
+			kind: KindLogin,
+			uses: []time.Duration{time.Hour, 23 * time.Hour},
+		},
+		{
+			name:        "expired login",
+			kind:        KindLogin,
+			uses:        []time.Duration{24 * time.Hour},
+			expectedErr: ErrExpired,
+		},
+		{
+			name:        "idle login",
+			config:      &Config{IdleTimeout: "30m"},
+			kind:        KindLogin,
+			uses:        []time.Duration{20 * time.Minute, 40 * time.Minute, 80 * time.Minute},
+			expectedErr: ErrExpired,
+		},
+		{
+			name:   "used login",
+			config: &Config{IdleTimeout: "30m"},
+			kind:   KindLogin,
+			uses:   []time.Duration{20 * time.Minute, 40 * time.Minute, 60 * time.Minute},
+		},
+		{
+			name:   "idle token",
+			config: &Config{IdleTimeout: "30m"},
+			kind:   KindToken,
+			uses:   []time.Duration{48 * time.Hour},
+		},
+	} {
+		svc, clk := newTestService(t, tc.config)
+		start := clk.now
+
+		var id string
+		if tc.kind == KindLogin {
+			token, err := svc.IssueWithAccesses("user", "acme", []string{"view"})
+			require.NoError(t, err, "TC: %s", tc.name)
+			id = sessionID(t, token)
+		} else {
+			sess, _, err := svc.CreateToken(context.Background(), "user", "acme", "ci", []string{"view"}, 0)
+			require.NoError(t, err, "TC: %s", tc.name)
+			id = sess.ID
+		}
+
+		var err error
+		for _, use := range tc.uses {
+			clk.now = start.Add(use)
+			if err = svc.Check(context.Background(), id); err != nil {
+				break
+			}
+		}
+		require.Equal(t, tc.expectedErr, err, "TC: %s", tc.name)
+	}
+}
+
+func TestService_ShorterLifetime(t *testing.T) {
+	svc, clk := newTestService(t, nil)
+
+	token, err := svc.IssueWithAccesses("user", "", []string{"view"})
+	require.NoError(t, err)
+	id := sessionID(t, token)
+
+	// started sessions are limited by the new lifetime
+	require.NoError(t, svc.SetConfig(context.Background(), &Config{Lifetime: "1h"}))
+	clk.now = clk.now.Add(2 * time.Hour)
+	require.Equal(t, ErrExpired, svc.Check(context.Background(), id))
+
+	// expired sessions are removed
+	require.Equal(t, ErrRevoked, svc.Check(context.Background(), id))
+}
+
+func TestService_Revoke(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	ctx := context.Background()
+
+	ids := make([]string, 0)
+	for _, userID := range []string{"alice", "alice", "bob"} {
+		token, err := svc.IssueWithAccesses(userID, "", []string{"edit", "view"})
+		require.NoError(t, err)
+		ids = append(ids, sessionID(t, token))
+	}
+	apiToken, _, err := svc.CreateToken(ctx, "alice", "", "ci", []string{"view"}, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Revoke(ctx, ids[0]))
+	require.Equal(t, ErrRevoked, svc.Check(ctx, ids[0]))
+	require.True(t, sgerrors.IsNotFound(svc.Revoke(ctx, ids[0])))
+
+	list, err := svc.List(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	// api tokens are kept when logins are revoked
+	revoked, err := svc.RevokeAll(ctx, "alice", KindLogin, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, revoked)
+	require.NoError(t, svc.Check(ctx, apiToken.ID))
+	require.NoError(t, svc.Check(ctx, ids[2]))
+
+	revoked, err = svc.RevokeAll(ctx, "", "", ids[2])
+	require.NoError(t, err)
+	require.Equal(t, 1, revoked)
+	require.Equal(t, ErrRevoked, svc.Check(ctx, apiToken.ID))
+	require.NoError(t, svc.Check(ctx, ids[2]))
+}
+
+func TestService_CreateToken(t *testing.T) {
+	svc, clk := newTestService(t, &Config{TokenLifetime: "720h"})
+
+	sess, token, err := svc.CreateToken(context.Background(), "user", "acme", "ci", []string{"view"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, sess.ID, sessionID(t, token))
+	require.Equal(t, clk.now.Add(720*time.Hour), sess.ExpiresAt)
+
+	_, _, err = svc.CreateToken(context.Background(), "user", "acme", "ci", []string{"view"}, 1000*time.Hour)
+	require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err))
+}
+
+func TestService_Prune(t *testing.T) {
+	svc, clk := newTestService(t, nil)
+
+	_, err := svc.IssueWithAccesses("user", "", []string{"view"})
+	require.NoError(t, err)
+	_, _, err = svc.CreateToken(context.Background(), "user", "", "ci", []string{"view"}, 0)
+	require.NoError(t, err)
+
+	clk.now = clk.now.Add(25 * time.Hour)
+	pruned, err := svc.Prune(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+}
+
+func TestConfig_limits(t *testing.T) {
+	for _, tc := range []struct {
+		config      Config
+		expectedErr bool
+	}{
+		{config: Config{}},
+		{config: Config{Lifetime: "8h", IdleTimeout: "15m", TokenLifetime: "2160h"}},
+		{config: Config{Lifetime: "8"}, expectedErr: true},
+		{config: Config{IdleTimeout: "10s"}, expectedErr: true},
+	} {
+		_, err := tc.config.limits()
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %+v", tc.config)
+	}
+}
@@ -31,6 +31,7 @@ var (
 	ErrTokenExpired        = New("token has been expire", TokenExpired)
 	ErrNilEntity           = New("nil entity", NilEntity)
 	ErrTimeoutExceeded     = New("timeout exceeded", TimeoutExceeded)
+	ErrRequestTooLarge     = New("request body is too large", RequestTooLarge)
 )
 
 func IsNotFound(err error) bool {
@@ -49,6 +50,10 @@ func IsTimeoutExceeded(err error) bool {
 	return errors.Cause(err) == ErrTimeoutExceeded
 }
 
+func IsRequestTooLarge(err error) bool {
+	return errors.Cause(err) == ErrRequestTooLarge
+}
+
 func IsUnknownProvider(err error) bool {
 	return errors.Cause(err) == ErrUnknownProvider
 }
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/pkg/errors"
 	apiv1 "k8s.io/api/core/v1"
@@ -50,9 +51,14 @@ type Proxy struct {
 	coreClient      corev1.CoreV1Interface
 	restConf        *rest.Config
 	tillerNamespace string
+
+	// persistent proxy keeps the tunnel open between calls
+	persistent bool
+	m          sync.Mutex
+	tun        *tunnel
 }
 
-// New creates a new helm client.
+// New creates a new helm client, it sets up a tunnel to tiller for every call.
 func New(client corev1.CoreV1Interface, restConf *rest.Config, tillerNamespace string) (*Proxy, error) {
 	return &Proxy{
 		coreClient:      client,
@@ -61,110 +67,135 @@ func New(client corev1.CoreV1Interface, restConf *rest.Config, tillerNamespace s
 	}, nil
 }
 
+// NewPersistent creates a helm client that reuses the tunnel to tiller
+// until it breaks or the proxy is closed.
+func NewPersistent(client corev1.CoreV1Interface, restConf *rest.Config, tillerNamespace string) (*Proxy, error) {
+	p, err := New(client, restConf, tillerNamespace)
+	if err != nil {
+		return nil, err
+	}
+	p.persistent = true
+
+	return p, nil
+}
+
+// Close stops the persistent tunnel.
+func (p *Proxy) Close() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.tun != nil {
+		p.tun.close()
+		p.tun = nil
+	}
+}
+
 func (p *Proxy) ListReleases(opts ...helm.ReleaseListOption) (*rls.ListReleasesResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).ListReleases(opts...)
 }
 func (p *Proxy) InstallRelease(chStr, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).InstallRelease(chStr, namespace, opts...)
 }
 func (p *Proxy) InstallReleaseFromChart(chart *chart.Chart, namespace string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).InstallReleaseFromChart(chart, namespace, opts...)
 }
 func (p *Proxy) DeleteRelease(rlsName string, opts ...helm.DeleteOption) (*rls.UninstallReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).DeleteRelease(rlsName, opts...)
 }
 func (p *Proxy) ReleaseStatus(rlsName string, opts ...helm.StatusOption) (*rls.GetReleaseStatusResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).ReleaseStatus(rlsName, opts...)
 }
 func (p *Proxy) UpdateRelease(rlsName, chStr string, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).UpdateRelease(rlsName, chStr, opts...)
 }
 func (p *Proxy) UpdateReleaseFromChart(rlsName string, chart *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).UpdateReleaseFromChart(rlsName, chart, opts...)
 }
 func (p *Proxy) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*rls.RollbackReleaseResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).RollbackRelease(rlsName, opts...)
 }
 func (p *Proxy) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*rls.GetReleaseContentResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
+	defer p.release(tun)
+
 	return p.helmClient(tun.Local).ReleaseContent(rlsName, opts...)
 }
 func (p *Proxy) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*rls.GetHistoryResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).ReleaseHistory(rlsName, opts...)
 }
 func (p *Proxy) GetVersion(opts ...helm.VersionOption) (*rls.GetVersionResponse, error) {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return nil, err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).GetVersion(opts...)
 }
 
 func (p *Proxy) PingTiller() error {
-	tun, err := p.createTunnel()
+	tun, err := p.tunnel()
 	if err != nil {
 		return err
 	}
-	defer tun.close()
+	defer p.release(tun)
 
 	return p.helmClient(tun.Local).PingTiller()
 }
@@ -173,6 +204,39 @@ func (p *Proxy) helmClient(port int) helm.Interface {
 	return helm.NewClient(helm.Host(fmt.Sprintf("127.0.0.1:%d", port)), helm.ConnectTimeout(TillerConnectionTimeout))
 }
 
+// tunnel returns the open tunnel of persistent proxy or creates a new one.
+func (p *Proxy) tunnel() (*tunnel, error) {
+	if !p.persistent {
+		return p.createTunnel()
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.tun != nil && p.tun.alive() {
+		return p.tun, nil
+	}
+	if p.tun != nil {
+		p.tun.close()
+	}
+
+	tun, err := p.createTunnel()
+	if err != nil {
+		p.tun = nil
+		return nil, err
+	}
+	p.tun = tun
+
+	return tun, nil
+}
+
+// release closes the tunnel unless it's kept by the persistent proxy.
+func (p *Proxy) release(tun *tunnel) {
+	if !p.persistent {
+		tun.close()
+	}
+}
+
 // createTunnel creates a tunnel to tiller (like 'kubectl proxy').
 func (p *Proxy) createTunnel() (*tunnel, error) {
 	podMeta, err := getTillerPodName(p.coreClient.Pods(p.tillerNamespace))
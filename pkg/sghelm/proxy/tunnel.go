@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
@@ -28,6 +29,8 @@ type tunnel struct {
 	Out       io.Writer
 	stopChan  chan struct{}
 	readyChan chan struct{}
+	doneChan  chan struct{}
+	closeOnce sync.Once
 	config    *rest.Config
 	client    rest.Interface
 }
@@ -41,13 +44,26 @@ func newTunnel(client rest.Interface, config *rest.Config, namespace, podName st
 		Remote:    remote,
 		stopChan:  make(chan struct{}, 1),
 		readyChan: make(chan struct{}, 1),
+		doneChan:  make(chan struct{}),
 		Out:       ioutil.Discard,
 	}
 }
 
 // close disconnects a tunnel connection
 func (t *tunnel) close() {
-	close(t.stopChan)
+	t.closeOnce.Do(func() {
+		close(t.stopChan)
+	})
+}
+
+// alive reports whether port forwarding is still running.
+func (t *tunnel) alive() bool {
+	select {
+	case <-t.doneChan:
+		return false
+	default:
+		return true
+	}
 }
 
 // forwardPort opens a tunnel to a kubernetes pod
@@ -82,6 +98,7 @@ func (t *tunnel) forwardPort() error {
 	errChan := make(chan error, 1)
 	go func() {
 		errChan <- pf.ForwardPorts()
+		close(t.doneChan)
 	}()
 
 	select {
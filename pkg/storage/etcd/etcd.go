@@ -2,6 +2,11 @@ package etcd
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/pkg/errors"
@@ -9,18 +14,129 @@ import (
 	"github.com/supergiant/control/pkg/sgerrors"
 )
 
+// DefaultDialTimeout is how long a client waits for an endpoint
+// before it fails over to the next one.
+const DefaultDialTimeout = 5 * time.Second
+
+// Config holds connection settings of an etcd cluster.
+type Config struct {
+	// Endpoints of cluster members, the client switches to another
+	// one when the current endpoint becomes unavailable.
+	Endpoints []string
+
+	// CertFile and KeyFile are a client certificate and its key,
+	// CAFile is used to verify server certificates.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	Username string
+	Password string
+
+	DialTimeout time.Duration
+}
+
 type ETCDRepository struct {
 	cfg clientv3.Config
 }
 
+// NewETCDRepository connects to an open etcd cluster, uri is a comma
+// separated list of endpoints.
 func NewETCDRepository(uri string) *ETCDRepository {
 	return &ETCDRepository{
 		cfg: clientv3.Config{
-			Endpoints: []string{uri},
+			Endpoints:   ParseEndpoints(uri),
+			DialTimeout: DefaultDialTimeout,
 		},
 	}
 }
 
+// NewSecureETCDRepository connects to an etcd cluster that requires
+// client certificates or user authentication.
+func NewSecureETCDRepository(cfg Config) (*ETCDRepository, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, clientv3.ErrNoAvailableEndpoints
+	}
+	if (cfg.Username == "") != (cfg.Password == "") {
+		return nil, errors.New("both username and password must be set")
+	}
+
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "tls config")
+	}
+
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+
+	return &ETCDRepository{
+		cfg: clientv3.Config{
+			Endpoints:   cfg.Endpoints,
+			DialTimeout: cfg.DialTimeout,
+			TLS:         tlsCfg,
+			Username:    cfg.Username,
+			Password:    cfg.Password,
+		},
+	}, nil
+}
+
+// ParseEndpoints splits a comma separated list of endpoints.
+func ParseEndpoints(uri string) []string {
+	endpoints := make([]string, 0)
+	for _, e := range strings.Split(uri, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	return endpoints
+}
+
+// tlsConfig returns nil if the cluster doesn't use tls.
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("both certificate and key files must be set")
+	}
+
+	secure := cfg.CertFile != "" || cfg.CAFile != ""
+	for _, e := range cfg.Endpoints {
+		if strings.HasPrefix(e, "https://") {
+			secure = true
+		}
+	}
+	if !secure {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}
+
 func (e *ETCDRepository) Get(ctx context.Context, prefix string, key string) ([]byte, error) {
 	cl, err := e.GetClient()
 	if err != nil {
@@ -51,11 +167,31 @@ func (e *ETCDRepository) Put(ctx context.Context, prefix string, key string, val
 	return errors.Wrap(err, "failed to write to the etcd")
 }
 
+func (e *ETCDRepository) CompareAndSwap(ctx context.Context, prefix string, key string, old, value []byte) (bool, error) {
+	cl, err := e.GetClient()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to connect to the etcd")
+	}
+	defer cl.Close()
+
+	cmp := clientv3.Compare(clientv3.Value(prefix+key), "=", string(old))
+	if old == nil {
+		cmp = clientv3.Compare(clientv3.CreateRevision(prefix+key), "=", 0)
+	}
+
+	resp, err := cl.Txn(ctx).If(cmp).Then(clientv3.OpPut(prefix+key, string(value))).Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to write to the etcd")
+	}
+	return resp.Succeeded, nil
+}
+
 func (e *ETCDRepository) Delete(ctx context.Context, prefix string, key string) error {
 	cl, err := e.GetClient()
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to the etcd")
 	}
+	defer cl.Close()
 	_, err = cl.Delete(ctx, prefix+key, clientv3.WithPrefix())
 	return errors.Wrap(err, "failed to read from the etcd")
 }
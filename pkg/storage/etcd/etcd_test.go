@@ -0,0 +1,123 @@
+package etcd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "etcd"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestParseEndpoints(t *testing.T) {
+	require.Equal(t, []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"},
+		ParseEndpoints(" http://10.0.0.1:2379,,http://10.0.0.2:2379 "))
+	require.Empty(t, ParseEndpoints(""))
+}
+
+func TestNewSecureETCDRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir)
+	endpoints := []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"}
+
+	for _, tc := range []struct {
+		name        string
+		cfg         Config
+		expectedErr bool
+		expectedTLS bool
+	}{
+		{
+			name:        "no endpoints",
+			expectedErr: true,
+		},
+		{
+			name:        "password without username",
+			cfg:         Config{Endpoints: endpoints, Password: "secret"},
+			expectedErr: true,
+		},
+		{
+			name:        "certificate without key",
+			cfg:         Config{Endpoints: endpoints, CertFile: certFile},
+			expectedErr: true,
+		},
+		{
+			name:        "missing ca file",
+			cfg:         Config{Endpoints: endpoints, CAFile: filepath.Join(dir, "missing")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid ca file",
+			cfg:         Config{Endpoints: endpoints, CAFile: keyFile},
+			expectedErr: true,
+		},
+		{
+			name: "plain http",
+			cfg:  Config{Endpoints: []string{"http://10.0.0.1:2379"}, Username: "root", Password: "secret"},
+		},
+		{
+			name:        "https endpoints",
+			cfg:         Config{Endpoints: endpoints},
+			expectedTLS: true,
+		},
+		{
+			name: "client certificate",
+			cfg: Config{
+				Endpoints: endpoints,
+				CertFile:  certFile,
+				KeyFile:   keyFile,
+				CAFile:    certFile,
+			},
+			expectedTLS: true,
+		},
+	} {
+		repo, err := NewSecureETCDRepository(tc.cfg)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		if err != nil {
+			continue
+		}
+
+		require.Equal(t, tc.cfg.Endpoints, repo.cfg.Endpoints, "TC: %s", tc.name)
+		require.Equal(t, DefaultDialTimeout, repo.cfg.DialTimeout, "TC: %s", tc.name)
+		require.Equal(t, tc.cfg.Username, repo.cfg.Username, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedTLS, repo.cfg.TLS != nil, "TC: %s", tc.name)
+		if tc.cfg.CertFile != "" {
+			require.Len(t, repo.cfg.TLS.Certificates, 1, "TC: %s", tc.name)
+			require.NotNil(t, repo.cfg.TLS.RootCAs, "TC: %s", tc.name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"bytes"
 	"context"
 	"strings"
 	"sync"
@@ -40,6 +41,19 @@ func (i *InMemoryRepository) Put(ctx context.Context, prefix string, key string,
 	return nil
 }
 
+func (i *InMemoryRepository) CompareAndSwap(ctx context.Context, prefix string, key string, old, value []byte) (bool, error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	current, ok := i.data[prefix+key]
+	if old == nil && ok || old != nil && (!ok || !bytes.Equal(current, old)) {
+		return false, nil
+	}
+
+	i.data[prefix+key] = value
+	return true, nil
+}
+
 func (i *InMemoryRepository) Delete(ctx context.Context, prefix string, key string) error {
 	i.m.Lock()
 	defer i.m.Unlock()
@@ -52,10 +66,10 @@ func (i *InMemoryRepository) GetAll(ctx context.Context, prefix string) ([][]byt
 	i.m.RLock()
 	defer i.m.RUnlock()
 
-	allKeys := make([][]byte, len(i.data))
+	allKeys := make([][]byte, 0, len(i.data))
 
 	for key := range i.data {
-		if strings.Contains(key, prefix) {
+		if strings.HasPrefix(key, prefix) {
 			allKeys = append(allKeys, i.data[key])
 		}
 	}
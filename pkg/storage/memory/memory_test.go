@@ -84,3 +84,31 @@ func TestInMemoryRepository_GetAll(t *testing.T) {
 		}
 	}
 }
+
+func TestInMemoryRepository_CompareAndSwap(t *testing.T) {
+	repo := NewInMemoryRepository()
+
+	for _, tc := range []struct {
+		name     string
+		old      []byte
+		value    []byte
+		expected bool
+	}{
+		{"create", nil, []byte(`one`), true},
+		{"create existing", nil, []byte(`two`), false},
+		{"stale value", []byte(`two`), []byte(`three`), false},
+		{"swap", []byte(`one`), []byte(`two`), true},
+	} {
+		ok, err := repo.CompareAndSwap(context.Background(), "prefix", "key", tc.old, tc.value)
+		if err != nil {
+			t.Errorf("TC: %s: unexpected error %v", tc.name, err)
+		}
+		if ok != tc.expected {
+			t.Errorf("TC: %s: expected swapped %v actual %v", tc.name, tc.expected, ok)
+		}
+	}
+
+	if value, _ := repo.Get(context.Background(), "prefix", "key"); string(value) != "two" {
+		t.Errorf("Wrong value expected two actual %s", value)
+	}
+}
@@ -25,14 +25,25 @@ type Interface interface {
 	Delete(ctx context.Context, prefix string, key string) error
 }
 
-func GetStorage(storageType, uri string) (Interface, error) {
+// Swapper is implemented by storages that can replace a value atomically, it is
+// required to run several control replicas against the same storage.
+type Swapper interface {
+	// CompareAndSwap puts the value only if the stored one equals old,
+	// nil old means the key must not exist.
+	CompareAndSwap(ctx context.Context, prefix string, key string, old, value []byte) (bool, error)
+}
+
+// GetStorage returns a storage of the type, etcdCfg is used only by the etcd
+// storage and its endpoints are taken from the uri.
+func GetStorage(storageType, uri string, etcdCfg etcd.Config) (Interface, error) {
 	switch storageType {
 	case memoryStorageType:
 		return memory.NewInMemoryRepository(), nil
 	case fileStorageType:
 		return file.NewFileRepository(uri)
 	case etcdStorageType:
-		return etcd.NewETCDRepository(uri), nil
+		etcdCfg.Endpoints = etcd.ParseEndpoints(uri)
+		return etcd.NewSecureETCDRepository(etcdCfg)
 	}
 
 	return nil, errors.New("wrong storage type" + storageType)
@@ -33,7 +33,7 @@ func TestGetStorage(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		storage, err := GetStorage(testCase.storageType, testCase.uri)
+		storage, err := GetStorage(testCase.storageType, testCase.uri, etcd.Config{})
 
 		if err != nil {
 			t.Errorf("unexpected error %v", err)
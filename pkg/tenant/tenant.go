@@ -0,0 +1,193 @@
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+// DefaultID is a tenant of users created without one, its records
+// are stored without a tenant prefix as they were before tenants.
+const DefaultID = ""
+
+const (
+	storagePrefix = "/tenants/"
+	// registryPrefix keeps ids of tenants that have records, it isn't
+	// namespaced so jobs of the control plane can list all of them.
+	registryPrefix = "/supergiant/tenants/"
+)
+
+var (
+	ErrInvalidID  = errors.New("tenant id must consist of lower case letters, digits and dashes")
+	ErrInvalidKey = errors.New("storage key must not be empty or contain slashes")
+
+	idRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+type contextKey struct{}
+
+// ValidateID checks the tenant id can be used as a part of storage keys.
+func ValidateID(id string) error {
+	if id != DefaultID && !idRegexp.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// WithID returns a copy of ctx that carries the tenant id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant id of ctx or DefaultID.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Detach returns a background context with the tenant of ctx, it is used
+// for work that outlives the request, e.g. cluster provisioning.
+func Detach(ctx context.Context) context.Context {
+	return WithID(context.Background(), FromContext(ctx))
+}
+
+// Prefix returns a storage prefix of the tenant.
+func Prefix(id, prefix string) string {
+	if id == DefaultID {
+		return prefix
+	}
+	return storagePrefix + id + prefix
+}
+
+// All returns tenants that have records in the storage, background jobs run
+// with a context of every one of them. Storages that aren't namespaced keep
+// records of all tenants together, so only the default tenant is returned.
+func All(ctx context.Context, s storage.Interface) ([]string, error) {
+	if ts, ok := s.(*Storage); ok {
+		return ts.Tenants(ctx)
+	}
+	return []string{DefaultID}, nil
+}
+
+// Storage namespaces keys of the underlying storage with the tenant of the context,
+// so records of one tenant can't be reached with ids crafted by another.
+type Storage struct {
+	repository storage.Interface
+
+	m sync.Mutex
+	// registered tenants aren't put to the registry again
+	registered map[string]bool
+}
+
+// NewStorage wraps the repository.
+func NewStorage(repository storage.Interface) *Storage {
+	return &Storage{
+		repository: repository,
+		registered: make(map[string]bool),
+	}
+}
+
+// Tenants returns the default tenant and all tenants that have put records.
+func (s *Storage) Tenants(ctx context.Context) ([]string, error) {
+	raw, err := s.repository.GetAll(ctx, registryPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: list tenants")
+	}
+
+	ids := make([]string, 0, len(raw)+1)
+	for _, id := range raw {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	return append([]string{DefaultID}, ids...), nil
+}
+
+func (s *Storage) GetAll(ctx context.Context, prefix string) ([][]byte, error) {
+	return s.repository.GetAll(ctx, Prefix(FromContext(ctx), prefix))
+}
+
+func (s *Storage) Get(ctx context.Context, prefix string, key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, sgerrors.ErrNotFound
+	}
+	return s.repository.Get(ctx, Prefix(FromContext(ctx), prefix), key)
+}
+
+func (s *Storage) Put(ctx context.Context, prefix string, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := s.register(ctx, FromContext(ctx)); err != nil {
+		return err
+	}
+	return s.repository.Put(ctx, Prefix(FromContext(ctx), prefix), key, value)
+}
+
+// Delete removes a single record, etcd storage treats the key as a prefix so
+// keys are validated to keep the deletion within one record.
+func (s *Storage) Delete(ctx context.Context, prefix string, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.repository.Delete(ctx, Prefix(FromContext(ctx), prefix), key)
+}
+
+// CompareAndSwap swaps the record of the tenant, values of storages that
+// can't swap them atomically are compared and put one after another.
+func (s *Storage) CompareAndSwap(ctx context.Context, prefix string, key string, old, value []byte) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, err
+	}
+	if err := s.register(ctx, FromContext(ctx)); err != nil {
+		return false, err
+	}
+	prefix = Prefix(FromContext(ctx), prefix)
+
+	if swapper, ok := s.repository.(storage.Swapper); ok {
+		return swapper.CompareAndSwap(ctx, prefix, key, old, value)
+	}
+
+	current, err := s.repository.Get(ctx, prefix, key)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return false, err
+	}
+	if current == nil && old != nil || current != nil && !bytes.Equal(current, old) {
+		return false, nil
+	}
+	return true, s.repository.Put(ctx, prefix, key, value)
+}
+
+// register adds the tenant to the registry before its first record is put.
+func (s *Storage) register(ctx context.Context, id string) error {
+	if id == DefaultID {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.registered[id] {
+		return nil
+	}
+	if err := s.repository.Put(ctx, registryPrefix, id, []byte(id)); err != nil {
+		return errors.Wrapf(err, "storage: register tenant %s", id)
+	}
+	s.registered[id] = true
+
+	return nil
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.Contains(key, "/") {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/storage/memory"
+)
+
+func TestValidateID(t *testing.T) {
+	for _, id := range []string{DefaultID, "acme", "team-1"} {
+		require.NoError(t, ValidateID(id), id)
+	}
+	for _, id := range []string{"Acme", "-acme", "acme/other", "../acme"} {
+		require.Equal(t, ErrInvalidID, ValidateID(id), id)
+	}
+}
+
+func TestContext(t *testing.T) {
+	require.Equal(t, DefaultID, FromContext(context.Background()))
+
+	ctx, cancel := context.WithCancel(WithID(context.Background(), "acme"))
+	cancel()
+	require.Equal(t, "acme", FromContext(ctx))
+
+	detached := Detach(ctx)
+	require.NoError(t, detached.Err())
+	require.Equal(t, "acme", FromContext(detached))
+}
+
+func TestStorage(t *testing.T) {
+	s := NewStorage(memory.NewInMemoryRepository())
+	acme := WithID(context.Background(), "acme")
+	other := WithID(context.Background(), "other")
+
+	require.NoError(t, s.Put(context.Background(), "/kubes/", "default", []byte("default")))
+	require.NoError(t, s.Put(acme, "/kubes/", "acme", []byte("acme")))
+	require.NoError(t, s.Put(other, "/kubes/", "other", []byte("other")))
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"default", context.Background(), "default"},
+		{"acme", acme, "acme"},
+		{"other", other, "other"},
+	} {
+		all, err := s.GetAll(tc.ctx, "/kubes/")
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, [][]byte{[]byte(tc.expected)}, all, "TC: %s", tc.name)
+
+		raw, err := s.Get(tc.ctx, "/kubes/", tc.expected)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expected, string(raw), "TC: %s", tc.name)
+	}
+
+	_, err := s.Get(acme, "/kubes/", "other")
+	require.True(t, sgerrors.IsNotFound(err))
+
+	// crafted keys must not reach records of other tenants
+	_, err = s.Get(context.Background(), "/kubes/", "../tenants/acme/kubes/acme")
+	require.True(t, sgerrors.IsNotFound(err))
+	require.Equal(t, ErrInvalidKey, s.Put(acme, "/kubes/", "a/b", nil))
+	require.Equal(t, ErrInvalidKey, s.Delete(acme, "/kubes/", ""))
+
+	require.NoError(t, s.Delete(other, "/kubes/", "acme"))
+	_, err = s.Get(acme, "/kubes/", "acme")
+	require.NoError(t, err)
+}
+
+func TestStorage_Tenants(t *testing.T) {
+	repo := memory.NewInMemoryRepository()
+	s := NewStorage(repo)
+
+	require.NoError(t, s.Put(context.Background(), "/kubes/", "default", []byte("default")))
+	require.NoError(t, s.Put(WithID(context.Background(), "other"), "/kubes/", "b", nil))
+	require.NoError(t, s.Put(WithID(context.Background(), "acme"), "/kubes/", "a", nil))
+	require.NoError(t, s.Put(WithID(context.Background(), "acme"), "/kubes/", "b", nil))
+
+	ids, err := s.Tenants(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultID, "acme", "other"}, ids)
+
+	// tenants are read from the registry by other replicas
+	ids, err = All(context.Background(), NewStorage(repo))
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultID, "acme", "other"}, ids)
+
+	ids, err = All(context.Background(), repo)
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultID}, ids)
+}
+
+func TestStorage_CompareAndSwap(t *testing.T) {
+	for _, repo := range []storage.Interface{memory.NewInMemoryRepository(), &putter{memory.NewInMemoryRepository()}} {
+		s := NewStorage(repo)
+		acme := WithID(context.Background(), "acme")
+
+		ok, err := s.CompareAndSwap(acme, "/kubes/", "kube", nil, []byte("v1"))
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = s.CompareAndSwap(acme, "/kubes/", "kube", nil, []byte("v2"))
+		require.NoError(t, err)
+		require.False(t, ok)
+		ok, err = s.CompareAndSwap(acme, "/kubes/", "kube", []byte("v0"), []byte("v2"))
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ok, err = s.CompareAndSwap(acme, "/kubes/", "kube", []byte("v1"), []byte("v2"))
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		raw, err := repo.Get(context.Background(), "/tenants/acme/kubes/", "kube")
+		require.NoError(t, err)
+		require.Equal(t, "v2", string(raw))
+
+		_, err = s.CompareAndSwap(acme, "/kubes/", "a/b", nil, nil)
+		require.Equal(t, ErrInvalidKey, err)
+	}
+}
+
+// putter hides CompareAndSwap of the repository.
+type putter struct {
+	storage.Interface
+}
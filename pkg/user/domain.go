@@ -4,13 +4,91 @@ import (
 	"encoding/json"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/supergiant/control/pkg/migration"
+	"github.com/supergiant/control/pkg/tenant"
 )
 
 // User is the representation of supergiant user
 type User struct {
+	SchemaVersion int `json:"schemaVersion" valid:"-"`
+
 	Login             string `json:"login" valid:"required, length(1|32)"`
 	EncryptedPassword []byte `json:"encrypted_password" valid:"-"`
 	Password          string `json:"password" valid:"required, length(8|24), printableascii"`
+	// TenantID isolates clusters, cloud accounts and profiles of the user
+	// from other tenants, users without it belong to the default tenant.
+	TenantID string `json:"tenantId" valid:"-"`
+	// Role limits what the user may do, users without it are editors.
+	Role string `json:"role,omitempty" valid:"-"`
+	// Source is an identity provider of users provisioned on login,
+	// they have no password.
+	Source string `json:"source,omitempty" valid:"-"`
+}
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "edit"
+	RoleViewer = "view"
+)
+
+// roles are ordered by privilege.
+var roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// ValidRole reports whether the role is known.
+func ValidRole(role string) bool {
+	return rank(role) >= 0
+}
+
+// HighestRole returns the most privileged known role of the list.
+func HighestRole(list []string) string {
+	highest := ""
+	for _, r := range list {
+		if rank(r) > rank(highest) {
+			highest = r
+		}
+	}
+	return highest
+}
+
+// Accesses returns accesses of tokens issued to users of the role.
+func Accesses(role string) []string {
+	switch role {
+	case RoleAdmin:
+		return []string{RoleAdmin, RoleEditor, RoleViewer}
+	case RoleViewer:
+		return []string{RoleViewer}
+	default:
+		return []string{RoleEditor, RoleViewer}
+	}
+}
+
+// Migrator upgrades stored users to the latest schema version.
+var Migrator = migration.New("login",
+	migration.Migration{
+		From:        0,
+		Description: "make local users of the default tenant without a role admins",
+		Apply: func(r migration.Record) error {
+			// users were not limited before roles were introduced, the root
+			// user has to keep managing users and settings
+			tenantID, _ := r["tenantId"].(string)
+			role, _ := r["role"].(string)
+			source, _ := r["source"].(string)
+			if tenantID == tenant.DefaultID && role == "" && source == "" {
+				r["role"] = RoleAdmin
+			}
+			return nil
+		},
+	},
+)
+
+func rank(role string) int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
 }
 
 func (u *User) encryptPassword() error {
@@ -14,3 +14,54 @@ func TestEncryptPassword(t *testing.T) {
 		t.Errorf("Error must be nil actual %v", err)
 	}
 }
+
+func TestHighestRole(t *testing.T) {
+	for _, tc := range []struct {
+		roles    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"unknown"}, ""},
+		{[]string{RoleViewer, "unknown"}, RoleViewer},
+		{[]string{RoleViewer, RoleAdmin, RoleEditor}, RoleAdmin},
+	} {
+		if actual := HighestRole(tc.roles); actual != tc.expected {
+			t.Errorf("Wrong role of %v expected %s actual %s", tc.roles, tc.expected, actual)
+		}
+	}
+}
+
+func TestAccesses(t *testing.T) {
+	if a := Accesses(""); len(a) != 2 || a[0] != RoleEditor {
+		t.Errorf("Users without a role must be editors, actual %v", a)
+	}
+	if a := Accesses(RoleViewer); len(a) != 1 || a[0] != RoleViewer {
+		t.Errorf("Viewers must only view, actual %v", a)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{"root user", `{"login":"root"}`, RoleAdmin},
+		{"viewer", `{"login":"viewer","role":"view"}`, RoleViewer},
+		{"directory user", `{"login":"ldap","source":"ldap"}`, ""},
+		{"other tenant", `{"login":"root","tenantId":"acme"}`, ""},
+		{"created with the latest schema", `{"login":"editor","schemaVersion":1}`, ""},
+	} {
+		raw, _, err := Migrator.Upgrade([]byte(tc.raw))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		u, err := FromJSON(raw)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if u.Role != tc.expected {
+			t.Errorf("%s: wrong role expected %q actual %q", tc.name, tc.expected, u.Role)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,21 +9,54 @@ import (
 	"gopkg.in/asaskevich/govalidator.v8"
 
 	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
 )
 
 type TokenIssuer interface {
-	Issue(string) (string, error)
+	IssueWithAccesses(userID, tenantID string, accesses []string) (string, error)
+}
+
+// Directory authenticates users whose passwords are not stored by control,
+// the user is provisioned when the credentials are valid.
+type Directory interface {
+	Authenticate(ctx context.Context, login, password string) (*User, error)
+}
+
+// Roles resolves permissions of roles, they may be changed by admins.
+type Roles interface {
+	Resolve(ctx context.Context, accesses []string) (permission.Set, error)
+}
+
+// Limiter locks out logins after repeated failures.
+type Limiter interface {
+	Allow(ctx context.Context, login string) error
+	Failed(ctx context.Context, login string)
+	Succeeded(ctx context.Context, login string)
 }
 
 type Handler struct {
 	userService  *Service
 	tokenService TokenIssuer
+	directory    Directory
+	limiter      Limiter
+	roles        Roles
 }
 
 type AuthRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// TenantID is a tenant of the user, logins of other tenants may repeat.
+	TenantID string `json:"tenantId,omitempty"`
+}
+
+// limiterKey counts failures of the same login in different tenants apart.
+func (ar AuthRequest) limiterKey() string {
+	if ar.TenantID == tenant.DefaultID {
+		return ar.Login
+	}
+	return ar.TenantID + "/" + ar.Login
 }
 
 func NewHandler(userService *Service, tokenService TokenIssuer) *Handler {
@@ -32,6 +66,22 @@ func NewHandler(userService *Service, tokenService TokenIssuer) *Handler {
 	}
 }
 
+// SetLimiter makes failed logins be counted by the limiter.
+func (h *Handler) SetLimiter(l Limiter) {
+	h.limiter = l
+}
+
+// SetRoles makes permissions of roles be resolved with their changes,
+// built-in permissions are used when it is not set.
+func (h *Handler) SetRoles(r Roles) {
+	h.roles = r
+}
+
+// SetDirectory makes logins unknown to control be checked by the directory.
+func (h *Handler) SetDirectory(d Directory) {
+	h.directory = d
+}
+
 func enableCors(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 }
@@ -48,15 +98,35 @@ func (h *Handler) Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.Authenticate(r.Context(), ar.Login, ar.Password); err != nil {
+	if err := tenant.ValidateID(ar.TenantID); err != nil {
+		http.Error(w, sgerrors.ErrInvalidCredentials.Error(), http.StatusForbidden)
+		return
+	}
+
+	if h.limiter != nil {
+		if err := h.limiter.Allow(r.Context(), ar.limiterKey()); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	usr, err := h.authenticate(tenant.WithID(r.Context(), ar.TenantID), ar.Login, ar.Password)
+	if err != nil {
 		if sgerrors.IsInvalidCredentials(err) {
+			if h.limiter != nil {
+				h.limiter.Failed(r.Context(), ar.limiterKey())
+			}
 			http.Error(w, sgerrors.ErrInvalidCredentials.Error(), http.StatusForbidden)
+			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if h.limiter != nil {
+		h.limiter.Succeeded(r.Context(), ar.limiterKey())
+	}
 
-	if token, err := h.tokenService.Issue(ar.Login); err == nil {
+	if token, err := h.tokenService.IssueWithAccesses(usr.Login, usr.TenantID, Accesses(usr.Role)); err == nil {
 		w.Header().Set("Authorization", token)
 		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
 		return
@@ -66,6 +136,32 @@ func (h *Handler) Authenticate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// authenticate checks the password of a local user, other logins are
+// checked by the directory when it is set.
+func (h *Handler) authenticate(ctx context.Context, login, password string) (*User, error) {
+	if h.directory != nil {
+		usr, err := h.userService.Get(ctx, login)
+		if err != nil && !sgerrors.IsNotFound(err) {
+			return nil, err
+		}
+		if usr == nil || usr.Source != "" {
+			return h.directory.Authenticate(ctx, login, password)
+		}
+	}
+
+	if err := h.userService.Authenticate(ctx, login, password); err != nil {
+		return nil, err
+	}
+	return h.userService.Get(ctx, login)
+}
+
+func (h *Handler) permissions(ctx context.Context, accesses []string) (permission.Set, error) {
+	if h.roles == nil {
+		return permission.Builtin(accesses), nil
+	}
+	return h.roles.Resolve(ctx, accesses)
+}
+
 func (h *Handler) RegisterRootUser(w http.ResponseWriter, r *http.Request) {
 	var user User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
@@ -86,6 +182,13 @@ func (h *Handler) RegisterRootUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if coldstart {
+		// the root user manages other users and settings of the installation
+		if user.Role != "" && user.Role != RoleAdmin {
+			message.SendValidationFailed(w, fmt.Errorf("root user must have the %s role", RoleAdmin))
+			return
+		}
+		user.Role = RoleAdmin
+		user.TenantID = tenant.DefaultID
 		if err := h.userService.Create(r.Context(), &user); err != nil {
 			message.SendUnknownError(w, err)
 			return
@@ -132,6 +235,31 @@ func (h *Handler) Create(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// users of the default tenant may create users of any tenant,
+	// others are limited to their own one
+	if creator := tenant.FromContext(r.Context()); creator != tenant.DefaultID {
+		user.TenantID = creator
+	}
+	if err := tenant.ValidateID(user.TenantID); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if user.Role != "" && !ValidRole(user.Role) {
+		http.Error(rw, fmt.Sprintf("unknown role %s", user.Role), http.StatusBadRequest)
+		return
+	}
+	// users can't have more permissions than the token that creates them
+	granted, err := h.permissions(r.Context(), Accesses(user.Role))
+	if err != nil {
+		message.SendUnknownError(rw, err)
+		return
+	}
+	if !permission.FromContext(r.Context()).Covers(granted) {
+		http.Error(rw, "user can't have more permissions than the creator", http.StatusForbidden)
+		return
+	}
+
 	if err := h.userService.Create(r.Context(), &user); err != nil {
 		if sgerrors.IsAlreadyExists(err) {
 			msg := message.New(fmt.Sprintf("login %s is already occupied", user.Login), "", sgerrors.EntityAlreadyExists, "")
@@ -2,9 +2,11 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -12,7 +14,10 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/supergiant/control/pkg/jwt"
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/testutils"
 )
 
@@ -20,8 +25,8 @@ type mockTokenIssuer struct {
 	mock.Mock
 }
 
-func (m *mockTokenIssuer) Issue(userId string) (string, error) {
-	args := m.Called(userId)
+func (m *mockTokenIssuer) IssueWithAccesses(userId, tenantId string, accesses []string) (string, error) {
+	args := m.Called(userId, tenantId, accesses)
 	val, ok := args.Get(0).(string)
 	if !ok {
 		return "", args.Error(1)
@@ -78,7 +83,7 @@ func TestEndpoint_Authenticate(t *testing.T) {
 		storage := new(testutils.MockStorage)
 
 		ts := &mockTokenIssuer{}
-		ts.On("Issue", mock.Anything).
+		ts.On("IssueWithAccesses", mock.Anything, mock.Anything, mock.Anything).
 			Return("test", testCase.tokenIssueError)
 		userEndpoint := NewHandler(NewService(DefaultStoragePrefix, storage), ts)
 		handler := http.HandlerFunc(userEndpoint.Authenticate)
@@ -100,6 +105,129 @@ func TestEndpoint_Authenticate(t *testing.T) {
 	}
 }
 
+type fakeDirectory struct {
+	users map[string]*User
+}
+
+func (f *fakeDirectory) Authenticate(ctx context.Context, login, password string) (*User, error) {
+	u, ok := f.users[login]
+	if !ok || password != "directory" {
+		return nil, sgerrors.ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+func TestEndpoint_AuthenticateDirectory(t *testing.T) {
+	local := &User{Login: "local", Password: "local"}
+	require.NoError(t, local.encryptPassword())
+	provisioned := &User{Login: "viewer", Role: RoleViewer, Source: "ldap"}
+
+	tt := []struct {
+		name             string
+		ar               []byte
+		expectedCode     int
+		expectedAccesses []string
+	}{
+		{
+			name:             "local user",
+			ar:               []byte(`{"login":"local","password":"local"}`),
+			expectedCode:     http.StatusOK,
+			expectedAccesses: []string{RoleEditor, RoleViewer},
+		},
+		{
+			name:         "local user is not checked by the directory",
+			ar:           []byte(`{"login":"local","password":"directory"}`),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:             "directory user",
+			ar:               []byte(`{"login":"viewer","password":"directory"}`),
+			expectedCode:     http.StatusOK,
+			expectedAccesses: []string{RoleViewer},
+		},
+		{
+			name:         "wrong password",
+			ar:           []byte(`{"login":"viewer","password":"local"}`),
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, testCase := range tt {
+		storage := new(testutils.MockStorage)
+		storage.On("Get", mock.Anything, mock.Anything, "local").Return(userToJSON(local), nil)
+		storage.On("Get", mock.Anything, mock.Anything, "viewer").Return(userToJSON(provisioned), nil)
+
+		ts := &mockTokenIssuer{}
+		ts.On("IssueWithAccesses", mock.Anything, mock.Anything, testCase.expectedAccesses).
+			Return("test", nil)
+		userEndpoint := NewHandler(NewService(DefaultStoragePrefix, storage), ts)
+		userEndpoint.SetDirectory(&fakeDirectory{users: map[string]*User{"viewer": provisioned}})
+
+		req, err := http.NewRequest("", "", bytes.NewReader(testCase.ar))
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Authenticate).ServeHTTP(rec, req)
+
+		require.Equal(t, testCase.expectedCode, rec.Code, "TC: %s", testCase.name)
+		if testCase.expectedCode == http.StatusOK {
+			ts.AssertExpectations(t)
+		}
+	}
+}
+
+type fakeLimiter struct {
+	locked    map[string]bool
+	failed    []string
+	succeeded []string
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, login string) error {
+	if f.locked[login] {
+		return errors.New("locked")
+	}
+	return nil
+}
+
+func (f *fakeLimiter) Failed(ctx context.Context, login string) {
+	f.failed = append(f.failed, login)
+}
+
+func (f *fakeLimiter) Succeeded(ctx context.Context, login string) {
+	f.succeeded = append(f.succeeded, login)
+}
+
+func TestEndpoint_AuthenticateLimiter(t *testing.T) {
+	usr := &User{Login: "user", Password: "password"}
+	require.NoError(t, usr.encryptPassword())
+
+	storage := new(testutils.MockStorage)
+	storage.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(userToJSON(usr), nil)
+	ts := &mockTokenIssuer{}
+	ts.On("IssueWithAccesses", mock.Anything, mock.Anything, mock.Anything).Return("test", nil)
+
+	limiter := &fakeLimiter{locked: map[string]bool{"locked": true}}
+	userEndpoint := NewHandler(NewService(DefaultStoragePrefix, storage), ts)
+	userEndpoint.SetLimiter(limiter)
+
+	for _, testCase := range []struct {
+		ar           string
+		expectedCode int
+	}{
+		{`{"login":"user","password":"wrong"}`, http.StatusForbidden},
+		{`{"login":"user","password":"password"}`, http.StatusOK},
+		{`{"login":"locked","password":"password"}`, http.StatusTooManyRequests},
+	} {
+		req, err := http.NewRequest("", "", strings.NewReader(testCase.ar))
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Authenticate).ServeHTTP(rec, req)
+
+		require.Equal(t, testCase.expectedCode, rec.Code, testCase.ar)
+	}
+	require.Equal(t, []string{"user"}, limiter.failed)
+	require.Equal(t, []string{"user"}, limiter.succeeded)
+}
+
 func userToJSON(user *User) (data []byte) {
 	data, _ = json.Marshal(user)
 	return
@@ -153,9 +281,154 @@ func TestEndpoint_Create(t *testing.T) {
 
 		req, err := http.NewRequest("", "", bytes.NewReader(testCase.user))
 		require.NoError(t, err)
+		req = req.WithContext(permission.WithSet(req.Context(), permission.Set{permission.All}))
 
 		rec := httptest.NewRecorder()
 		handler.ServeHTTP(rec, req)
 		require.Equal(t, testCase.expectedCode, rec.Code)
 	}
 }
+
+func TestEndpoint_CreateRole(t *testing.T) {
+	admin := permission.Builtin([]string{RoleAdmin})
+	editor := permission.Builtin(Accesses(RoleEditor))
+	viewer := permission.Builtin(Accesses(RoleViewer))
+
+	for _, testCase := range []struct {
+		name         string
+		creator      permission.Set
+		role         string
+		expectedCode int
+	}{
+		{"unknown role", admin, "root", http.StatusBadRequest},
+		{"admin creates admin", admin, RoleAdmin, http.StatusOK},
+		{"editor creates viewer", editor, RoleViewer, http.StatusOK},
+		{"editor creates editor", editor, "", http.StatusOK},
+		{"editor creates admin", editor, RoleAdmin, http.StatusForbidden},
+		{"viewer creates editor", viewer, RoleEditor, http.StatusForbidden},
+		{"no permissions", nil, RoleViewer, http.StatusForbidden},
+	} {
+		storage := new(testutils.MockStorage)
+		storage.On("Get", mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, sgerrors.ErrNotFound)
+		storage.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(nil)
+		userEndpoint := NewHandler(NewService(DefaultStoragePrefix, storage),
+			jwt.NewTokenService(64, []byte("secret")))
+
+		body, err := json.Marshal(&User{Login: "login", Password: "password", Role: testCase.role})
+		require.NoError(t, err)
+		req, err := http.NewRequest("", "", bytes.NewReader(body))
+		require.NoError(t, err)
+		req = req.WithContext(permission.WithSet(req.Context(), testCase.creator))
+
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Create).ServeHTTP(rec, req)
+		require.Equal(t, testCase.expectedCode, rec.Code, "TC: %s: %s", testCase.name, rec.Body.String())
+	}
+}
+
+func TestEndpoint_CreateTenant(t *testing.T) {
+	tt := []struct {
+		name           string
+		creatorTenant  string
+		user           []byte
+		expectedCode   int
+		expectedTenant string
+	}{
+		{
+			name:           "default tenant chooses tenant",
+			user:           []byte(`{"login":"login","password":"password","tenantId":"acme"}`),
+			expectedCode:   http.StatusOK,
+			expectedTenant: "acme",
+		},
+		{
+			name:         "invalid tenant",
+			user:         []byte(`{"login":"login","password":"password","tenantId":"../acme"}`),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:           "tenant is inherited",
+			creatorTenant:  "acme",
+			user:           []byte(`{"login":"login","password":"password","tenantId":"other"}`),
+			expectedCode:   http.StatusOK,
+			expectedTenant: "acme",
+		},
+	}
+
+	for _, testCase := range tt {
+		storage := new(testutils.MockStorage)
+		userEndpoint := NewHandler(NewService(DefaultStoragePrefix, storage),
+			jwt.NewTokenService(64, []byte("secret")))
+
+		var stored []byte
+		storage.On("Get", mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, sgerrors.ErrNotFound)
+		storage.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				stored = args.Get(3).([]byte)
+			}).
+			Return(nil)
+
+		req, err := http.NewRequest("", "", bytes.NewReader(testCase.user))
+		require.NoError(t, err)
+		req = req.WithContext(permission.WithSet(tenant.WithID(req.Context(), testCase.creatorTenant),
+			permission.Set{permission.All}))
+
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Create).ServeHTTP(rec, req)
+		require.Equal(t, testCase.expectedCode, rec.Code, "TC: %s", testCase.name)
+
+		if testCase.expectedTenant != "" {
+			u, err := FromJSON(stored)
+			require.NoError(t, err, "TC: %s", testCase.name)
+			require.Equal(t, testCase.expectedTenant, u.TenantID, "TC: %s", testCase.name)
+		}
+	}
+}
+
+func TestEndpoint_RegisterRootUser(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		role         string
+		expectedCode int
+	}{
+		{"no role", "", http.StatusOK},
+		{"admin", RoleAdmin, http.StatusOK},
+		{"editor", RoleEditor, http.StatusBadRequest},
+	} {
+		svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+		ts := &mockTokenIssuer{}
+		ts.On("IssueWithAccesses", "root", tenant.DefaultID, mock.Anything).Return("token", nil)
+		userEndpoint := NewHandler(svc, ts)
+
+		body, err := json.Marshal(&User{Login: "root", Password: "password", Role: testCase.role})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.RegisterRootUser).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodPost, "/root", bytes.NewReader(body)))
+		require.Equal(t, testCase.expectedCode, rec.Code, "TC: %s: %s", testCase.name, rec.Body.String())
+		if testCase.expectedCode != http.StatusOK {
+			continue
+		}
+
+		rec = httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Authenticate).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth",
+			strings.NewReader(`{"login":"root","password":"password"}`)))
+		require.Equal(t, http.StatusOK, rec.Code, "TC: %s", testCase.name)
+
+		// the root user creates other users
+		accesses := ts.Calls[0].Arguments.Get(2).([]string)
+		granted := permission.Builtin(accesses)
+		require.True(t, granted.Allows(permission.Required(http.MethodPost, permission.APIPrefix+"/users")),
+			"TC: %s: %v", testCase.name, accesses)
+
+		body, err = json.Marshal(&User{Login: "admin", Password: "password", Role: RoleAdmin})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		req = req.WithContext(permission.WithSet(req.Context(), granted))
+		rec = httptest.NewRecorder()
+		http.HandlerFunc(userEndpoint.Create).ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, "TC: %s: %s", testCase.name, rec.Body.String())
+	}
+}
@@ -7,11 +7,14 @@ import (
 
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 )
 
 const DefaultStoragePrefix = "/supergiant/user/"
 
-// Service contains business logic related to users
+// Service contains business logic related to users, logins are unique
+// within a tenant. Users of other tenants are kept under the prefix of
+// their tenant, so that they can't take over logins of the default one.
 type Service struct {
 	storagePrefix string
 	repository    storage.Interface
@@ -25,7 +28,12 @@ func NewService(storagePrefix string, repository storage.Interface) *Service {
 	}
 }
 
-// Create is used to register new user
+// prefix returns the storage prefix of users of the tenant.
+func (s *Service) prefix(tenantID string) string {
+	return tenant.Prefix(tenantID, s.storagePrefix)
+}
+
+// Create is used to register new user in the tenant of the user
 func (s *Service) Create(ctx context.Context, user *User) error {
 	if user == nil {
 		return sgerrors.ErrNilValue
@@ -34,23 +42,47 @@ func (s *Service) Create(ctx context.Context, user *User) error {
 	if err != nil {
 		return err
 	}
+	user.SchemaVersion = Migrator.Version()
 
-	if _, err := s.repository.Get(ctx, s.storagePrefix, user.Login); err != nil {
-		if !sgerrors.IsNotFound(err) {
-			return sgerrors.ErrAlreadyExists
-		}
+	_, err = s.repository.Get(ctx, s.prefix(user.TenantID), user.Login)
+	if err == nil {
+		return sgerrors.ErrAlreadyExists
 	}
-	err = s.repository.Put(ctx, s.storagePrefix, user.Login, user.ToJSON())
-	return err
+	if !sgerrors.IsNotFound(err) {
+		return err
+	}
+	return s.repository.Put(ctx, s.prefix(user.TenantID), user.Login, user.ToJSON())
 }
 
-// Authenticate checks if password stored in db is the same as in request
+// Provision creates or updates a user authenticated by an identity provider,
+// users of other sources can't be taken over with the same login.
+func (s *Service) Provision(ctx context.Context, user *User) error {
+	if user == nil || user.Source == "" {
+		return sgerrors.ErrNilValue
+	}
+
+	existing, err := s.Get(tenant.WithID(ctx, user.TenantID), user.Login)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && existing.Source != user.Source {
+		return sgerrors.ErrAlreadyExists
+	}
+
+	user.Password = ""
+	user.EncryptedPassword = nil
+	user.SchemaVersion = Migrator.Version()
+	return s.repository.Put(ctx, s.prefix(user.TenantID), user.Login, user.ToJSON())
+}
+
+// Authenticate checks if password stored in db is the same as in request,
+// the user is looked up in the tenant of ctx.
 func (s *Service) Authenticate(ctx context.Context, username, password string) error {
 	if username == "" || password == "" {
 		return sgerrors.ErrInvalidCredentials
 	}
 
-	rawJSON, err := s.repository.Get(ctx, s.storagePrefix, username)
+	rawJSON, err := s.repository.Get(ctx, s.prefix(tenant.FromContext(ctx)), username)
 	if err != nil {
 		//If user doesn't exists we still want Forbidden instead of Not Found
 		if sgerrors.IsNotFound(err) {
@@ -69,8 +101,27 @@ func (s *Service) Authenticate(ctx context.Context, username, password string) e
 	return nil
 }
 
+// Get returns a user of the tenant of ctx by login.
+func (s *Service) Get(ctx context.Context, login string) (*User, error) {
+	rawJSON, err := s.repository.Get(ctx, s.prefix(tenant.FromContext(ctx)), login)
+	if err != nil {
+		return nil, err
+	}
+	if rawJSON == nil {
+		return nil, sgerrors.ErrNotFound
+	}
+
+	return FromJSON(rawJSON)
+}
+
+// Delete removes the user, tokens issued to the user are valid until they expire.
+func (s *Service) Delete(ctx context.Context, login string) error {
+	return s.repository.Delete(ctx, s.prefix(tenant.FromContext(ctx)), login)
+}
+
+// GetAll returns users of the tenant of ctx.
 func (s *Service) GetAll(ctx context.Context) ([]*User, error) {
-	res, err := s.repository.GetAll(ctx, s.storagePrefix)
+	res, err := s.repository.GetAll(ctx, s.prefix(tenant.FromContext(ctx)))
 	if err != nil {
 		return nil, err
 	}
@@ -86,9 +137,10 @@ func (s *Service) GetAll(ctx context.Context) ([]*User, error) {
 	return usrs, nil
 }
 
-//IsColdStart tells if any users are registered.
+// IsColdStart tells if any users are registered, the root user belongs
+// to the default tenant.
 func (s *Service) IsColdStart(ctx context.Context) (bool, error) {
-	users, err := s.GetAll(ctx)
+	users, err := s.GetAll(tenant.WithID(ctx, tenant.DefaultID))
 	if err != nil {
 		return false, err
 	}
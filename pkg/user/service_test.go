@@ -10,6 +10,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/testutils"
 )
 
@@ -45,7 +47,7 @@ func TestService_Create(t *testing.T) {
 				Login:    "user",
 				Password: "1234",
 			},
-			getError:     errors.New("test"),
+			getError:     nil,
 			serviceError: sgerrors.ErrAlreadyExists,
 		},
 		{
@@ -53,7 +55,15 @@ func TestService_Create(t *testing.T) {
 				Login:    "user",
 				Password: "1234",
 			},
-			getError:     nil,
+			getError:     err,
+			serviceError: err,
+		},
+		{
+			user: &User{
+				Login:    "user",
+				Password: "1234",
+			},
+			getError:     sgerrors.ErrNotFound,
 			putError:     err,
 			serviceError: err,
 		},
@@ -62,6 +72,7 @@ func TestService_Create(t *testing.T) {
 				Login:    "user",
 				Password: "1234",
 			},
+			getError: sgerrors.ErrNotFound,
 		},
 	}
 
@@ -78,13 +89,32 @@ func TestService_Create(t *testing.T) {
 
 		err := service.Create(context.Background(), testCase.user)
 
-		if err != nil && err != testCase.serviceError {
+		if err != testCase.serviceError {
 			t.Errorf("Service has returned wrong error expected %v actual %v",
 				testCase.serviceError, err)
 		}
 	}
 }
 
+func TestService_CreateTenant(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	require.NoError(t, svc.Create(context.Background(), &User{Login: "root", Password: "password"}))
+	require.Equal(t, sgerrors.ErrAlreadyExists,
+		svc.Create(context.Background(), &User{Login: "root", Password: "other"}))
+
+	// the same login in another tenant is another user
+	require.NoError(t, svc.Create(context.Background(), &User{Login: "root", Password: "other", TenantID: "acme"}))
+	require.NoError(t, svc.Authenticate(context.Background(), "root", "password"))
+	require.Equal(t, sgerrors.ErrInvalidCredentials, svc.Authenticate(context.Background(), "root", "other"))
+	require.NoError(t, svc.Authenticate(tenant.WithID(context.Background(), "acme"), "root", "other"))
+
+	users, err := svc.GetAll(tenant.WithID(context.Background(), "acme"))
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "acme", users[0].TenantID)
+}
+
 func TestService_Authenticate(t *testing.T) {
 	err := errors.New("unknown error")
 	testCases := []struct {
@@ -261,3 +291,54 @@ func TestService_IsColdStart(t *testing.T) {
 		require.Equal(t, tc.expectedValue, value)
 	}
 }
+
+func TestService_Provision(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		existing    *User
+		user        *User
+		expectedErr error
+	}{
+		{
+			name:        "no source",
+			user:        &User{Login: "user"},
+			expectedErr: sgerrors.ErrNilValue,
+		},
+		{
+			name: "new user",
+			user: &User{Login: "user", Source: "saml", Role: RoleViewer},
+		},
+		{
+			name:     "same source",
+			existing: &User{Login: "user", Source: "saml", Role: RoleViewer},
+			user:     &User{Login: "user", Source: "saml", Role: RoleAdmin},
+		},
+		{
+			name:        "local user",
+			existing:    &User{Login: "user", EncryptedPassword: []byte("hash")},
+			user:        &User{Login: "user", Source: "saml"},
+			expectedErr: sgerrors.ErrAlreadyExists,
+		},
+	} {
+		storage := &testutils.MockStorage{}
+		if tc.existing != nil {
+			storage.On("Get", mock.Anything, "prefix", "user").Return(tc.existing.ToJSON(), nil)
+		} else {
+			storage.On("Get", mock.Anything, "prefix", "user").Return(nil, sgerrors.ErrNotFound)
+		}
+		storage.On("Put", mock.Anything, "prefix", "user", mock.Anything).Return(nil)
+		service := NewService("prefix", storage)
+
+		err := service.Provision(context.Background(), tc.user)
+		require.Equal(t, tc.expectedErr, err, "TC: %s", tc.name)
+		if tc.expectedErr != nil {
+			storage.AssertNotCalled(t, "Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			continue
+		}
+
+		stored := &User{}
+		require.NoError(t, json.Unmarshal(storage.Calls[1].Arguments.Get(3).([]byte), stored), "TC: %s", tc.name)
+		require.Equal(t, tc.user.Role, stored.Role, "TC: %s", tc.name)
+		require.Empty(t, stored.EncryptedPassword, "TC: %s", tc.name)
+	}
+}
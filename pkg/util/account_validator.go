@@ -17,6 +17,7 @@ import (
 	"google.golang.org/api/dns/v1"
 
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 	"github.com/supergiant/control/pkg/clouds/digitaloceansdk"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/sgerrors"
@@ -73,7 +74,7 @@ func validateDigitalOceanCredentials(creds map[string]string) error {
 	ts := &digitaloceansdk.TokenSource{
 		AccessToken: config.AccessToken,
 	}
-	oauthClient := oauth2.NewClient(oauth2.NoContext, ts)
+	oauthClient := oauth2.NewClient(apicalls.ClientContext(oauth2.NoContext), ts)
 	client := godo.NewClient(oauthClient)
 
 	_, _, err = client.Droplets.List(context.Background(), new(godo.ListOptions))
@@ -102,7 +103,7 @@ func validateAWSCredentials(creds map[string]string) error {
 		return err
 	}
 
-	ec2Client := ec2.New(sess)
+	ec2Client := ec2.New(apicalls.InstrumentAWS(sess))
 
 	_, err = ec2Client.DescribeKeyPairs(new(ec2.DescribeKeyPairsInput))
 	return err
@@ -123,7 +124,7 @@ func validateGCECredentials(creds map[string]string) error {
 		TokenURL:   creds[clouds.GCETokenURI],
 	}
 
-	client := conf.Client(context.Background())
+	client := conf.Client(apicalls.ClientContext(context.Background()))
 
 	computeService, err := compute.New(client)
 	if err != nil {
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/digitalocean/godo"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+	"github.com/supergiant/control/pkg/clouds/digitaloceansdk"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+// QuotaChecker reports how many machines can still be created with a cloud account.
+type QuotaChecker interface {
+	AvailableMachines(ctx context.Context, cloudAccount *model.CloudAccount, region string) (int, error)
+}
+
+type CloudQuotaChecker struct {
+	digitalOcean func(context.Context, map[string]string, string) (int, error)
+	aws          func(context.Context, map[string]string, string) (int, error)
+}
+
+func NewCloudQuotaChecker() *CloudQuotaChecker {
+	return &CloudQuotaChecker{
+		digitalOcean: availableDroplets,
+		aws:          availableEC2Instances,
+	}
+}
+
+// AvailableMachines returns sgerrors.ErrUnsupportedProvider for clouds
+// that don't expose instance limits.
+func (c *CloudQuotaChecker) AvailableMachines(ctx context.Context, cloudAccount *model.CloudAccount, region string) (int, error) {
+	ctx = apicalls.WithAccount(ctx, cloudAccount.Name)
+	switch cloudAccount.Provider {
+	case clouds.DigitalOcean:
+		return c.digitalOcean(ctx, cloudAccount.Credentials, region)
+	case clouds.AWS:
+		return c.aws(ctx, cloudAccount.Credentials, region)
+	}
+
+	return 0, sgerrors.ErrUnsupportedProvider
+}
+
+// availableDroplets compares account droplet limit with droplets in all regions,
+// the limit on digitalocean is per account.
+func availableDroplets(ctx context.Context, creds map[string]string, _ string) (int, error) {
+	config := &steps.DOConfig{}
+	if err := BindParams(creds, config); err != nil {
+		return 0, err
+	}
+
+	ts := &digitaloceansdk.TokenSource{
+		AccessToken: config.AccessToken,
+	}
+	client := godo.NewClient(oauth2.NewClient(apicalls.ClientContext(ctx), ts))
+
+	acc, _, err := client.Account.Get(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "get account")
+	}
+
+	count := 0
+	opts := &godo.ListOptions{PerPage: 200}
+	for {
+		droplets, resp, err := client.Droplets.List(ctx, opts)
+		if err != nil {
+			return 0, errors.Wrap(err, "list droplets")
+		}
+		count += len(droplets)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return 0, errors.Wrap(err, "list droplets")
+		}
+		opts.Page = page + 1
+	}
+
+	return acc.DropletLimit - count, nil
+}
+
+// availableEC2Instances compares max-instances attribute of the account
+// with running instances in the region.
+func availableEC2Instances(ctx context.Context, creds map[string]string, region string) (int, error) {
+	config := &steps.AWSConfig{}
+	if err := BindParams(creds, config); err != nil {
+		return 0, err
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Region:      aws.String(region),
+			Credentials: credentials.NewStaticCredentials(config.KeyID, config.Secret, ""),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	client := ec2.New(apicalls.InstrumentAWS(sess))
+
+	attrs, err := client.DescribeAccountAttributesWithContext(ctx, &ec2.DescribeAccountAttributesInput{
+		AttributeNames: aws.StringSlice([]string{"max-instances"}),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "describe account attributes")
+	}
+
+	limit := 0
+	for _, attr := range attrs.AccountAttributes {
+		for _, v := range attr.AttributeValues {
+			if limit, err = strconv.Atoi(aws.StringValue(v.AttributeValue)); err != nil {
+				return 0, errors.Wrap(err, "parse max-instances")
+			}
+		}
+	}
+
+	count := 0
+	err = client.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{"pending", "running"}),
+			},
+		},
+	}, func(out *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, r := range out.Reservations {
+			count += len(r.Instances)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "describe instances")
+	}
+
+	return limit - count, nil
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/sgerrors"
+)
+
+func TestAvailableMachines(t *testing.T) {
+	available := func(n int) func(context.Context, map[string]string, string) (int, error) {
+		return func(context.Context, map[string]string, string) (int, error) {
+			return n, nil
+		}
+	}
+	checker := &CloudQuotaChecker{
+		digitalOcean: available(10),
+		aws:          available(20),
+	}
+
+	for _, tc := range []struct {
+		provider      clouds.Name
+		expected      int
+		expectedError error
+	}{
+		{
+			provider: clouds.DigitalOcean,
+			expected: 10,
+		},
+		{
+			provider: clouds.AWS,
+			expected: 20,
+		},
+		{
+			provider:      clouds.GCE,
+			expectedError: sgerrors.ErrUnsupportedProvider,
+		},
+	} {
+		n, err := checker.AvailableMachines(context.Background(), &model.CloudAccount{Provider: tc.provider}, "region")
+		require.Equal(t, tc.expectedError, err, "TC: %s", tc.provider)
+		require.Equal(t, tc.expected, n, "TC: %s", tc.provider)
+	}
+}
@@ -140,6 +140,10 @@ func LoadCloudSpecificDataFromKube(k *model.Kube, config *steps.Config) error {
 		return sgerrors.ErrNilEntity
 	}
 	config.Kube = *k
+	config.DNSConfig = steps.NewDNSConfig(k.Name, k.DNS)
+	config.EgressConfig = steps.NewEgressConfig(k)
+	config.CostConfig = steps.NewCostConfig(k.Cost)
+	config.HardeningConfig = steps.NewHardeningConfig(k.Hardening)
 
 	// TODO: Is it ok?
 	if k.CloudSpec == nil {
@@ -162,16 +166,27 @@ func LoadCloudSpecificDataFromKube(k *model.Kube, config *steps.Config) error {
 		config.AWSConfig.MastersInstanceProfile = k.CloudSpec[clouds.AwsMasterInstanceProfile]
 		config.AWSConfig.NodesInstanceProfile = k.CloudSpec[clouds.AwsNodeInstanceProfile]
 		config.AWSConfig.ImageID = k.CloudSpec[clouds.AwsImageID]
+		config.AWSConfig.NATGatewayID = k.CloudSpec[clouds.AwsNATGatewayID]
+		config.AWSConfig.NATSubnetID = k.CloudSpec[clouds.AwsNATSubnetID]
+		config.AWSConfig.NATRouteTableID = k.CloudSpec[clouds.AwsNATRouteTableID]
+		config.AWSConfig.EgressAllocationID = k.CloudSpec[clouds.AwsEgressAllocationID]
+		config.AWSConfig.StackName = k.CloudSpec[clouds.AwsStackName]
+		config.AWSConfig.MastersPlacementGroup = k.CloudSpec[clouds.AwsMastersPlacementGroup]
 		config.Kube.SSHConfig.BootstrapPrivateKey = k.CloudSpec[clouds.AwsSshBootstrapPrivateKey]
 		config.Kube.SSHConfig.PublicKey = k.CloudSpec[clouds.AwsUserProvidedSshPublicKey]
 
 	case clouds.GCE:
 		config.GCEConfig.Region = k.Region
+		config.GCEConfig.MastersPlacementPolicy = k.CloudSpec[clouds.GCEMastersPlacementPolicy]
 
 	case clouds.DigitalOcean:
 
 	case clouds.Azure:
 		config.AzureConfig.Location = k.Region
+		config.AzureConfig.ResourceGroupName = k.CloudSpec[clouds.AzureResourceGroup]
+		config.AzureConfig.VirtualNetworkName = k.CloudSpec[clouds.AzureVNetName]
+		config.AzureConfig.SecurityGroupName = k.CloudSpec[clouds.AzureSecurityGroup]
+		config.AzureConfig.MastersAvailabilitySet = k.CloudSpec[clouds.AzureMastersAvailabilitySet]
 
 	default:
 		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "Load cloud specific data from kube %s", k.ID)
@@ -0,0 +1,137 @@
+package versions
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+const (
+	StatusSupported = "supported"
+	// StatusEOLSoon versions reach their end of life within eolWarning.
+	StatusEOLSoon = "eolSoon"
+	StatusEOL     = "eol"
+)
+
+// provisioning warns about versions that reach end of life this soon
+const eolWarning = 90 * 24 * time.Hour
+
+// Version is a kubernetes version clusters can be provisioned with.
+type Version struct {
+	Version string `json:"version"`
+	// EOL is a day the version stops getting fixes, it's zero if unknown.
+	EOL time.Time `json:"eol,omitempty"`
+	// Providers the version is supported on, it's supported on all of them when empty.
+	Providers []clouds.Name `json:"providers,omitempty"`
+	// Channel is the least stable channel the version has been promoted to,
+	// it's stable when empty.
+	Channel string `json:"channel,omitempty"`
+	// Status is calculated when the catalog is read.
+	Status string `json:"status,omitempty"`
+}
+
+// SupportedOn tells whether the version may be provisioned on the provider.
+func (v Version) SupportedOn(provider clouds.Name) bool {
+	if len(v.Providers) == 0 {
+		return true
+	}
+	for _, p := range v.Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusAt returns the support status of the version at the time.
+func (v Version) StatusAt(now time.Time) string {
+	switch {
+	case v.EOL.IsZero():
+		return StatusSupported
+	case !now.Before(v.EOL):
+		return StatusEOL
+	case now.Add(eolWarning).After(v.EOL):
+		return StatusEOLSoon
+	}
+	return StatusSupported
+}
+
+// Catalog lists kubernetes versions of the installation.
+type Catalog struct {
+	Versions []Version `json:"versions"`
+	// Addons are chart versions releases are upgraded to.
+	Addons []Addon `json:"addons,omitempty"`
+}
+
+func (c Catalog) validate() error {
+	seen := make(map[string]bool, len(c.Versions))
+	for _, v := range c.Versions {
+		if _, err := semver.NewVersion(v.Version); err != nil {
+			return errors.Wrapf(err, "version %q", v.Version)
+		}
+		if !ValidChannel(v.Channel) {
+			return errors.Errorf("version %s: unknown channel %q", v.Version, v.Channel)
+		}
+		if seen[v.Version] {
+			return errors.Errorf("version %s is listed twice", v.Version)
+		}
+		seen[v.Version] = true
+	}
+	return validateAddons(c.Addons)
+}
+
+// Find returns the version supported on the provider.
+func (c Catalog) Find(provider clouds.Name, version string) (*Version, bool) {
+	for _, v := range c.Versions {
+		if v.Version == version && v.SupportedOn(provider) {
+			return &v, true
+		}
+	}
+	return nil, false
+}
+
+// For returns versions supported on the provider with their status at the
+// time, the latest version first. Empty provider returns all of them.
+func (c Catalog) For(provider clouds.Name, now time.Time) []Version {
+	out := make([]Version, 0, len(c.Versions))
+	for _, v := range c.Versions {
+		if provider != "" && !v.SupportedOn(provider) {
+			continue
+		}
+		v.Status = v.StatusAt(now)
+		out = append(out, v)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, errA := semver.NewVersion(out[i].Version)
+		b, errB := semver.NewVersion(out[j].Version)
+		if errA != nil || errB != nil {
+			return out[i].Version > out[j].Version
+		}
+		return a.GreaterThan(b)
+	})
+	return out
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// DefaultCatalog lists versions provisioning has been tested with and end of
+// life dates of their minor releases upstream.
+func DefaultCatalog() Catalog {
+	return Catalog{
+		Versions: []Version{
+			{Version: "1.11.1", EOL: date(2019, time.May, 1)},
+			{Version: "1.12.7", EOL: date(2019, time.July, 8)},
+			{Version: "1.13.4", EOL: date(2019, time.October, 15)},
+			{Version: "1.14.1", EOL: date(2019, time.December, 11)},
+			{Version: "1.15.3", EOL: date(2020, time.May, 6)},
+			{Version: "1.16.2", EOL: date(2020, time.September, 2)},
+		},
+	}
+}
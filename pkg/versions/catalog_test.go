@@ -0,0 +1,71 @@
+package versions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestVersion_StatusAt(t *testing.T) {
+	now := date(2019, time.October, 1)
+
+	require.Equal(t, StatusSupported, Version{Version: "1.14.1"}.StatusAt(now))
+	require.Equal(t, StatusSupported, Version{Version: "1.16.2", EOL: date(2020, time.September, 2)}.StatusAt(now))
+	require.Equal(t, StatusEOLSoon, Version{Version: "1.14.1", EOL: date(2019, time.December, 11)}.StatusAt(now))
+	require.Equal(t, StatusEOL, Version{Version: "1.13.4", EOL: now}.StatusAt(now))
+}
+
+func TestCatalog_Find(t *testing.T) {
+	c := Catalog{
+		Versions: []Version{
+			{Version: "1.14.1"},
+			{Version: "1.16.2", Providers: []clouds.Name{clouds.AWS}},
+		},
+	}
+
+	v, ok := c.Find(clouds.GCE, "1.14.1")
+	require.True(t, ok)
+	require.Equal(t, "1.14.1", v.Version)
+
+	_, ok = c.Find(clouds.GCE, "1.16.2")
+	require.False(t, ok)
+
+	_, ok = c.Find(clouds.AWS, "1.16.2")
+	require.True(t, ok)
+
+	_, ok = c.Find(clouds.AWS, "1.15.3")
+	require.False(t, ok)
+}
+
+func TestCatalog_For(t *testing.T) {
+	c := Catalog{
+		Versions: []Version{
+			{Version: "1.9.2", EOL: date(2018, time.September, 29)},
+			{Version: "1.14.1"},
+			{Version: "1.16.2", Providers: []clouds.Name{clouds.AWS}},
+		},
+	}
+	now := date(2019, time.October, 1)
+
+	all := c.For("", now)
+	require.Len(t, all, 3)
+	require.Equal(t, "1.16.2", all[0].Version)
+	require.Equal(t, "1.9.2", all[2].Version)
+	require.Equal(t, StatusEOL, all[2].Status)
+
+	gce := c.For(clouds.GCE, now)
+	require.Len(t, gce, 2)
+	require.Equal(t, "1.14.1", gce[0].Version)
+	require.Equal(t, StatusSupported, gce[0].Status)
+
+	require.Empty(t, c.Versions[0].Status, "the catalog isn't changed")
+}
+
+func TestCatalog_validate(t *testing.T) {
+	require.NoError(t, DefaultCatalog().validate())
+	require.Error(t, Catalog{Versions: []Version{{Version: "latest"}}}.validate())
+	require.Error(t, Catalog{Versions: []Version{{Version: "1.14.1"}, {Version: "1.14.1"}}}.validate())
+}
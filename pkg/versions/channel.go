@@ -0,0 +1,124 @@
+package versions
+
+import (
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+// Versions reach the rapid channel first and are promoted to regular and
+// stable ones when they have proven to work.
+const (
+	ChannelStable  = "stable"
+	ChannelRegular = "regular"
+	ChannelRapid   = "rapid"
+)
+
+var channelRanks = map[string]int{
+	ChannelStable:  0,
+	ChannelRegular: 1,
+	ChannelRapid:   2,
+}
+
+// ValidChannel tells whether clusters may be pinned to the channel,
+// empty one is the stable channel.
+func ValidChannel(channel string) bool {
+	_, ok := channelRanks[channel]
+	return ok || channel == ""
+}
+
+// onChannel tells whether a version promoted to the channel is offered to
+// clusters pinned to another one.
+func onChannel(versionChannel, clusterChannel string) bool {
+	return channelRanks[versionChannel] <= channelRanks[clusterChannel]
+}
+
+// Addon is a version of a chart clusters are offered to upgrade their
+// releases to.
+type Addon struct {
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// Upgrade returns the latest patch release of the current minor version
+// available on the channel, it's false when the cluster is up to date.
+func (c Catalog) Upgrade(provider clouds.Name, channel, current string) (*Version, bool) {
+	cur, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, false
+	}
+
+	var latest *Version
+	var latestVer *semver.Version
+	for i := range c.Versions {
+		v := &c.Versions[i]
+		if !v.SupportedOn(provider) || !onChannel(v.Channel, channel) {
+			continue
+		}
+		ver, err := semver.NewVersion(v.Version)
+		if err != nil || ver.Major() != cur.Major() || ver.Minor() != cur.Minor() || !ver.GreaterThan(cur) {
+			continue
+		}
+		if latestVer == nil || ver.GreaterThan(latestVer) {
+			latest, latestVer = v, ver
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	out := *latest
+	return &out, true
+}
+
+// AddonUpgrade returns the latest version of the chart available on the
+// channel, it's false when the release is up to date or the chart isn't
+// in the catalog.
+func (c Catalog) AddonUpgrade(channel, chart, current string) (*Addon, bool) {
+	cur, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, false
+	}
+
+	var latest *Addon
+	var latestVer *semver.Version
+	for i := range c.Addons {
+		a := &c.Addons[i]
+		if a.Chart != chart || !onChannel(a.Channel, channel) {
+			continue
+		}
+		ver, err := semver.NewVersion(a.Version)
+		if err != nil || !ver.GreaterThan(cur) {
+			continue
+		}
+		if latestVer == nil || ver.GreaterThan(latestVer) {
+			latest, latestVer = a, ver
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	out := *latest
+	return &out, true
+}
+
+func validateAddons(addons []Addon) error {
+	seen := make(map[string]bool, len(addons))
+	for _, a := range addons {
+		if a.Chart == "" {
+			return errors.New("addon chart is empty")
+		}
+		if _, err := semver.NewVersion(a.Version); err != nil {
+			return errors.Wrapf(err, "addon %s version %q", a.Chart, a.Version)
+		}
+		if !ValidChannel(a.Channel) {
+			return errors.Errorf("addon %s %s: unknown channel %q", a.Chart, a.Version, a.Channel)
+		}
+		if seen[a.Chart+"@"+a.Version] {
+			return errors.Errorf("addon %s %s is listed twice", a.Chart, a.Version)
+		}
+		seen[a.Chart+"@"+a.Version] = true
+	}
+	return nil
+}
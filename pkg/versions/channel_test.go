@@ -0,0 +1,117 @@
+package versions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+func TestCatalog_Upgrade(t *testing.T) {
+	c := Catalog{
+		Versions: []Version{
+			{Version: "1.15.3"},
+			{Version: "1.15.5", Channel: ChannelRegular},
+			{Version: "1.15.7", Channel: ChannelRapid},
+			{Version: "1.15.9", Channel: ChannelRapid, Providers: []clouds.Name{clouds.AWS}},
+			{Version: "1.16.2"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		provider clouds.Name
+		channel  string
+		current  string
+		expected string
+	}{
+		{
+			name:     "stable",
+			channel:  ChannelStable,
+			current:  "1.15.1",
+			expected: "1.15.3",
+		},
+		{
+			name:     "empty channel",
+			current:  "1.15.1",
+			expected: "1.15.3",
+		},
+		{
+			name:     "regular",
+			channel:  ChannelRegular,
+			current:  "1.15.1",
+			expected: "1.15.5",
+		},
+		{
+			name:     "rapid",
+			provider: clouds.GCE,
+			channel:  ChannelRapid,
+			current:  "1.15.3",
+			expected: "1.15.7",
+		},
+		{
+			name:     "rapid on provider",
+			provider: clouds.AWS,
+			channel:  ChannelRapid,
+			current:  "1.15.3",
+			expected: "1.15.9",
+		},
+		{
+			name:    "up to date",
+			channel: ChannelStable,
+			current: "1.15.3",
+		},
+		{
+			name:    "minor versions aren't proposed",
+			channel: ChannelStable,
+			current: "1.14.1",
+		},
+		{
+			name:    "invalid current",
+			current: "latest",
+		},
+	} {
+		v, ok := c.Upgrade(tc.provider, tc.channel, tc.current)
+		require.Equal(t, tc.expected != "", ok, "TC: %s", tc.name)
+		if ok {
+			require.Equal(t, tc.expected, v.Version, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestCatalog_AddonUpgrade(t *testing.T) {
+	c := Catalog{
+		Addons: []Addon{
+			{Chart: "nginx-ingress", Version: "1.24.4"},
+			{Chart: "nginx-ingress", Version: "1.26.0", Channel: ChannelRapid},
+			{Chart: "prometheus-operator", Version: "8.2.0"},
+		},
+	}
+
+	a, ok := c.AddonUpgrade(ChannelStable, "nginx-ingress", "1.20.0")
+	require.True(t, ok)
+	require.Equal(t, "1.24.4", a.Version)
+
+	a, ok = c.AddonUpgrade(ChannelRapid, "nginx-ingress", "1.20.0")
+	require.True(t, ok)
+	require.Equal(t, "1.26.0", a.Version)
+
+	_, ok = c.AddonUpgrade(ChannelRegular, "nginx-ingress", "1.24.4")
+	require.False(t, ok)
+
+	_, ok = c.AddonUpgrade(ChannelRapid, "cert-manager", "0.11.0")
+	require.False(t, ok)
+}
+
+func TestCatalog_validateChannels(t *testing.T) {
+	require.Error(t, Catalog{Versions: []Version{{Version: "1.16.2", Channel: "beta"}}}.validate())
+	require.Error(t, Catalog{Addons: []Addon{{Version: "1.0.0"}}}.validate())
+	require.Error(t, Catalog{Addons: []Addon{{Chart: "nginx", Version: "next"}}}.validate())
+	require.Error(t, Catalog{Addons: []Addon{{Chart: "nginx", Version: "1.0.0", Channel: "beta"}}}.validate())
+	require.Error(t, Catalog{Addons: []Addon{{Chart: "nginx", Version: "1.0.0"}, {Chart: "nginx", Version: "1.0.0"}}}.validate())
+	require.NoError(t, Catalog{
+		Versions: []Version{{Version: "1.16.2", Channel: ChannelRegular}},
+		Addons:   []Addon{{Chart: "nginx", Version: "1.0.0", Channel: ChannelRapid}},
+	}.validate())
+}
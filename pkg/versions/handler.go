@@ -0,0 +1,113 @@
+package versions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/message"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+// Servicer is an interface of the version catalog service.
+type Servicer interface {
+	Catalog(ctx context.Context) (*Catalog, error)
+	SetCatalog(ctx context.Context, c Catalog) error
+	Reset(ctx context.Context) error
+}
+
+// Handler is a http handler for the version catalog.
+type Handler struct {
+	svc Servicer
+	now func() time.Time
+}
+
+// NewHandler constructs a Handler.
+func NewHandler(svc Servicer) *Handler {
+	return &Handler{
+		svc: svc,
+		now: time.Now,
+	}
+}
+
+// Register adds version catalog handlers to a router.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/versions", h.listVersions).Methods(http.MethodGet)
+	r.HandleFunc("/versions", h.setCatalog).Methods(http.MethodPut)
+	r.HandleFunc("/versions", h.resetCatalog).Methods(http.MethodDelete)
+}
+
+// listVersions returns versions profile forms offer:
+// GET /versions?provider=aws
+func (h *Handler) listVersions(w http.ResponseWriter, r *http.Request) {
+	c, err := h.svc.Catalog(r.Context())
+	if err != nil {
+		logrus.Errorf("versions: get catalog: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	provider := clouds.Name(r.URL.Query().Get("provider"))
+	if err = json.NewEncoder(w).Encode(c.For(provider, h.now())); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// setCatalog replaces the catalog, it's allowed to admins of the default tenant only.
+func (h *Handler) setCatalog(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	c := Catalog{}
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := h.svc.SetCatalog(r.Context(), c); err != nil {
+		if errors.Cause(err) == sgerrors.ErrInvalidJson {
+			message.SendValidationFailed(w, err)
+			return
+		}
+		logrus.Errorf("versions: set catalog: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	logrus.Infof("versions: catalog has been set to %d versions", len(c.Versions))
+	if err := json.NewEncoder(w).Encode(c.For("", h.now())); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// resetCatalog restores the default catalog.
+func (h *Handler) resetCatalog(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	if err := h.svc.Reset(r.Context()); err != nil {
+		logrus.Errorf("versions: reset catalog: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "versions are managed by admins of the default tenant", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package versions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func newTestHandler() (*mux.Router, *Service) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+	h := NewHandler(svc)
+	h.now = func() time.Time {
+		return date(2019, time.October, 1)
+	}
+
+	router := mux.NewRouter()
+	h.Register(router)
+	return router, svc
+}
+
+func TestHandler_listVersions(t *testing.T) {
+	router, svc := newTestHandler()
+	require.NoError(t, svc.SetCatalog(context.Background(), Catalog{
+		Versions: []Version{
+			{Version: "1.13.4", EOL: date(2019, time.October, 15)},
+			{Version: "1.16.2", Providers: []clouds.Name{clouds.AWS}},
+		},
+	}))
+
+	for _, tc := range []struct {
+		name             string
+		provider         string
+		expectedVersions []Version
+	}{
+		{
+			name: "all",
+			expectedVersions: []Version{
+				{Version: "1.16.2", Providers: []clouds.Name{clouds.AWS}, Status: StatusSupported},
+				{Version: "1.13.4", EOL: date(2019, time.October, 15), Status: StatusEOLSoon},
+			},
+		},
+		{
+			name:     "provider",
+			provider: string(clouds.GCE),
+			expectedVersions: []Version{
+				{Version: "1.13.4", EOL: date(2019, time.October, 15), Status: StatusEOLSoon},
+			},
+		},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/versions?provider="+tc.provider, nil))
+		require.Equal(t, http.StatusOK, rec.Code, "TC: %s", tc.name)
+
+		versions := make([]Version, 0)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&versions), "TC: %s", tc.name)
+		require.Equal(t, tc.expectedVersions, versions, "TC: %s", tc.name)
+	}
+}
+
+func TestHandler_setCatalog(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		tenantID     string
+		editor       bool
+		body         string
+		expectedCode int
+	}{
+		{
+			name:         "other tenant",
+			tenantID:     "acme",
+			body:         `{"versions":[{"version":"1.16.2"}]}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "editor",
+			tenantID:     tenant.DefaultID,
+			editor:       true,
+			body:         `{"versions":[{"version":"1.16.2"}]}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid json",
+			tenantID:     tenant.DefaultID,
+			body:         `{`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid version",
+			tenantID:     tenant.DefaultID,
+			body:         `{"versions":[{"version":"latest"}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "ok",
+			tenantID:     tenant.DefaultID,
+			body:         `{"versions":[{"version":"1.16.2"}]}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		router, svc := newTestHandler()
+
+		req := httptest.NewRequest(http.MethodPut, "/versions", bytes.NewBufferString(tc.body))
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), tc.tenantID), !tc.editor))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+
+		c, err := svc.Catalog(req.Context())
+		require.NoError(t, err, "TC: %s", tc.name)
+		if tc.expectedCode == http.StatusOK {
+			require.Equal(t, Catalog{Versions: []Version{{Version: "1.16.2"}}}, *c, "TC: %s", tc.name)
+		} else {
+			require.Equal(t, DefaultCatalog(), *c, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestHandler_resetCatalog(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		tenantID        string
+		editor          bool
+		expectedCode    int
+		expectedCatalog Catalog
+	}{
+		{
+			name:            "other tenant",
+			tenantID:        "acme",
+			expectedCode:    http.StatusForbidden,
+			expectedCatalog: Catalog{Versions: []Version{{Version: "1.16.2"}}},
+		},
+		{
+			name:            "editor",
+			tenantID:        tenant.DefaultID,
+			editor:          true,
+			expectedCode:    http.StatusForbidden,
+			expectedCatalog: Catalog{Versions: []Version{{Version: "1.16.2"}}},
+		},
+		{
+			name:            "ok",
+			tenantID:        tenant.DefaultID,
+			expectedCode:    http.StatusNoContent,
+			expectedCatalog: DefaultCatalog(),
+		},
+	} {
+		router, svc := newTestHandler()
+
+		req := httptest.NewRequest(http.MethodDelete, "/versions", nil)
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), tc.tenantID), !tc.editor))
+		require.NoError(t, svc.SetCatalog(req.Context(), Catalog{Versions: []Version{{Version: "1.16.2"}}}))
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.name)
+
+		c, err := svc.Catalog(req.Context())
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedCatalog, *c, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,78 @@
+package versions
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+)
+
+const (
+	DefaultStoragePrefix = "/supergiant/versions/"
+
+	catalogKey = "catalog"
+)
+
+// Service keeps the version catalog of the installation in storage,
+// the default catalog is used until it's changed.
+type Service struct {
+	prefix  string
+	storage storage.Interface
+}
+
+// NewService constructs a Service.
+func NewService(prefix string, s storage.Interface) *Service {
+	return &Service{
+		prefix:  prefix,
+		storage: s,
+	}
+}
+
+// Catalog returns the catalog of kubernetes versions.
+func (s *Service) Catalog(ctx context.Context) (*Catalog, error) {
+	raw, err := s.storage.Get(ctx, s.prefix, catalogKey)
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			c := DefaultCatalog()
+			return &c, nil
+		}
+		return nil, errors.Wrap(err, "storage: get")
+	}
+
+	c := &Catalog{}
+	if err = json.Unmarshal(raw, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+	return c, nil
+}
+
+// SetCatalog replaces the catalog of kubernetes versions.
+func (s *Service) SetCatalog(ctx context.Context, c Catalog) error {
+	if err := c.validate(); err != nil {
+		return errors.Wrap(sgerrors.ErrInvalidJson, err.Error())
+	}
+	for i := range c.Versions {
+		c.Versions[i].Status = ""
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+	if err = s.storage.Put(ctx, s.prefix, catalogKey, raw); err != nil {
+		return errors.Wrap(err, "storage: put")
+	}
+	return nil
+}
+
+// Reset restores the default catalog.
+func (s *Service) Reset(ctx context.Context) error {
+	err := s.storage.Delete(ctx, s.prefix, catalogKey)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return errors.Wrap(err, "storage: delete")
+	}
+	return nil
+}
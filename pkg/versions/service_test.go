@@ -0,0 +1,49 @@
+package versions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/testutils/storage"
+)
+
+func TestService_Catalog(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, memory.NewInMemoryRepository())
+
+	c, err := svc.Catalog(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, DefaultCatalog(), *c)
+
+	custom := Catalog{Versions: []Version{{Version: "1.16.2", Status: StatusEOL}}}
+	require.NoError(t, svc.SetCatalog(context.Background(), custom))
+
+	c, err = svc.Catalog(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Catalog{Versions: []Version{{Version: "1.16.2"}}}, *c)
+
+	err = svc.SetCatalog(context.Background(), Catalog{Versions: []Version{{Version: "next"}}})
+	require.Equal(t, sgerrors.ErrInvalidJson, errors.Cause(err))
+
+	require.NoError(t, svc.Reset(context.Background()))
+	c, err = svc.Catalog(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, DefaultCatalog(), *c)
+}
+
+func TestService_CatalogErrors(t *testing.T) {
+	svc := NewService(DefaultStoragePrefix, &storage.Fake{GetErr: errors.New("get")})
+	_, err := svc.Catalog(context.Background())
+	require.Error(t, err)
+
+	svc = NewService(DefaultStoragePrefix, &storage.Fake{Item: []byte("{")})
+	_, err = svc.Catalog(context.Background())
+	require.Error(t, err)
+
+	svc = NewService(DefaultStoragePrefix, &storage.Fake{PutErr: errors.New("put")})
+	require.Error(t, svc.SetCatalog(context.Background(), DefaultCatalog()))
+}
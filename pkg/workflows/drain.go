@@ -0,0 +1,85 @@
+package workflows
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+// ErrInterrupted is returned by tasks stopped at a step boundary by shutdown.
+var ErrInterrupted = errors.New("task has been interrupted by shutdown")
+
+// shutdown is shared by all tasks of the process.
+var shutdown = newDrainer()
+
+type drainer struct {
+	once    sync.Once
+	drain   chan struct{}
+	running sync.WaitGroup
+}
+
+func newDrainer() *drainer {
+	return &drainer{
+		drain: make(chan struct{}),
+	}
+}
+
+func (d *drainer) draining() bool {
+	select {
+	case <-d.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain makes running tasks stop before their next step, the progress is kept
+// in storage so tasks can be resumed by another control replica.
+func Drain() {
+	shutdown.once.Do(func() {
+		close(shutdown.drain)
+	})
+}
+
+// WaitStopped blocks until all running tasks have stopped or ctx is done.
+func WaitStopped(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		shutdown.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Interrupted returns tasks stopped by shutdown that haven't been resumed yet.
+func Interrupted(ctx context.Context, repository storage.Interface) ([]*Task, error) {
+	rawTasks, err := repository.GetAll(ctx, Prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	tasks := make([]*Task, 0)
+	for _, raw := range rawTasks {
+		t, err := DeserializeTask(raw, repository)
+		if err != nil {
+			logrus.Warnf("skip broken task record: %v", err)
+			continue
+		}
+		if t.Status == statuses.Interrupted && t.Config != nil {
+			tasks = append(tasks, t)
+		}
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,67 @@
+package workflows
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/statuses"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type drainingStep struct {
+	MockStep
+}
+
+func (s *drainingStep) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	Drain()
+	return s.MockStep.Run(ctx, out, config)
+}
+
+func TestDrain(t *testing.T) {
+	defer func(d *drainer) { shutdown = d }(shutdown)
+	shutdown = newDrainer()
+
+	s := &MockRepository{
+		storage: make(map[string][]byte),
+	}
+	last := &MockStep{name: "step2"}
+
+	workflowMap = make(map[string]Workflow)
+	RegisterWorkFlow("mock", []steps.Step{&drainingStep{MockStep{name: "step1"}}, last})
+	task, err := NewTask("mock", s)
+	require.NoError(t, err)
+
+	err = <-task.Run(context.Background(), steps.Config{ClusterID: "kube"}, &bufferCloser{})
+	require.Equal(t, ErrInterrupted, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, WaitStopped(ctx))
+
+	require.Equal(t, 0, last.counter, "the step after drain must not be started")
+	require.Equal(t, statuses.Success, task.StepStatuses[0].Status)
+	require.Equal(t, statuses.Todo, task.StepStatuses[1].Status)
+
+	interrupted, err := Interrupted(context.Background(), s)
+	require.NoError(t, err)
+	require.Len(t, interrupted, 1)
+	require.Equal(t, task.ID, interrupted[0].ID)
+	require.Equal(t, "kube", interrupted[0].Config.ClusterID)
+}
+
+func TestWaitStopped(t *testing.T) {
+	defer func(d *drainer) { shutdown = d }(shutdown)
+	shutdown = newDrainer()
+	shutdown.running.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, WaitStopped(ctx))
+
+	shutdown.running.Done()
+	require.NoError(t, WaitStopped(context.Background()))
+}
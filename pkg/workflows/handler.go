@@ -2,6 +2,7 @@ package workflows
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
@@ -14,12 +15,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/hpcloud/tail"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/supergiant/control/pkg/message"
 	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/runner"
 	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
@@ -35,6 +41,7 @@ type TaskHandler struct {
 	cloudAccGetter cloudAccountGetter
 	repository     storage.Interface
 	getWriter      func(string) (io.WriteCloser, error)
+	pruner         *Pruner
 }
 
 type RunTaskRequest struct {
@@ -52,11 +59,16 @@ type TaskResponse struct {
 	ID string `json:"id"`
 }
 
+type PruneResponse struct {
+	Removed []string `json:"removed"`
+}
+
 func NewTaskHandler(repository storage.Interface, runnerFactory func(config ssh.Config) (runner.Runner, error), getter cloudAccountGetter) *TaskHandler {
 	return &TaskHandler{
 		runnerFactory:  runnerFactory,
 		repository:     repository,
 		cloudAccGetter: getter,
+		pruner:         NewPruner(repository),
 		getWriter: func(name string) (io.WriteCloser, error) {
 			// TODO(stgleb): Add log directory to params of supergiant
 			return os.OpenFile(path.Join("/tmp", name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
@@ -84,7 +96,13 @@ func NewTaskHandler(repository storage.Interface, runnerFactory func(config ssh.
 }
 
 func (h *TaskHandler) Register(m *mux.Router) {
+	m.HandleFunc("/tasks", h.PurgeTasks).Methods(http.MethodDelete)
+	m.HandleFunc("/tasks/retention", h.GetRetention).Methods(http.MethodGet)
+	m.HandleFunc("/tasks/retention", h.SetRetention).Methods(http.MethodPut)
+	m.HandleFunc("/tasks/prune", h.PruneTasks).Methods(http.MethodPost)
 	m.HandleFunc("/tasks/{id}", h.GetTask).Methods(http.MethodGet)
+	m.HandleFunc("/tasks/{id}/tree", h.GetTaskTree).Methods(http.MethodGet)
+	m.HandleFunc("/tasks/{id}/status", h.GetTaskStatus).Methods(http.MethodGet)
 	m.HandleFunc("/tasks/{id}/restart",
 		h.RestartTask).Methods(http.MethodPost)
 	m.HandleFunc("/tasks/{id}/logs", h.StreamLogs).Methods(http.MethodGet)
@@ -100,14 +118,80 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := h.repository.Get(r.Context(), Prefix, id)
-
+	task, err := h.tenantTask(r.Context(), id)
+	if sgerrors.IsNotFound(err) {
+		message.SendNotFound(w, id, err)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Write(data)
+	if err = json.NewEncoder(w).Encode(task); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// tenantTask returns the task if it belongs to the tenant of the request,
+// tasks of other tenants are not found as they carry their cloud settings.
+func (h *TaskHandler) tenantTask(ctx context.Context, id string) (*Task, error) {
+	task, err := getTask(ctx, h.repository, id)
+	if err != nil {
+		return nil, err
+	}
+	if task.TenantID != tenant.FromContext(ctx) {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "task %s", id)
+	}
+
+	return task, nil
+}
+
+// GetTaskTree returns the task with all of its sub-tasks and their aggregate status.
+func (h *TaskHandler) GetTaskTree(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tree, err := BuildTree(r.Context(), h.repository, id)
+	if err == nil && tree.Task.TenantID != tenant.FromContext(r.Context()) {
+		err = errors.Wrapf(sgerrors.ErrNotFound, "task %s", id)
+	}
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, id, err)
+			return
+		}
+		logrus.Errorf("build tree of task %s: %v", id, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(tree); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// GetTaskStatus returns a status of the operation the task has been started by,
+// it is a Location of responses to long running requests.
+func (h *TaskHandler) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tree, err := BuildTree(r.Context(), h.repository, id)
+	if err == nil && tree.Task.TenantID != tenant.FromContext(r.Context()) {
+		err = errors.Wrapf(sgerrors.ErrNotFound, "task %s", id)
+	}
+	if err != nil {
+		if sgerrors.IsNotFound(err) {
+			message.SendNotFound(w, id, err)
+			return
+		}
+		logrus.Errorf("build tree of task %s: %v", id, err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(NewTaskStatus(tree)); err != nil {
+		message.SendUnknownError(w, err)
+	}
 }
 
 func (h *TaskHandler) RestartTask(w http.ResponseWriter, r *http.Request) {
@@ -120,11 +204,15 @@ func (h *TaskHandler) RestartTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logrus.Debugf("get task %s", id)
-	data, err := h.repository.Get(r.Context(), Prefix, id)
+	if _, err := h.tenantTask(r.Context(), id); err != nil {
+		logrus.Debugf("task %s not found: %v", id, err)
+		http.NotFound(w, r)
+		return
+	}
 
+	data, err := h.repository.Get(r.Context(), Prefix, id)
 	if err != nil {
-		logrus.Debugf("task %s not found", id)
-		http.NotFound(w, r)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -146,7 +234,75 @@ func (h *TaskHandler) RestartTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	task.Run(context.Background(), *task.Config, writer)
-	w.WriteHeader(http.StatusAccepted)
+	SendAccepted(w, task.ID, nil)
+}
+
+func (h *TaskHandler) GetRetention(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.pruner.Policy(r.Context())
+
+	if err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(policy); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// SetRetention changes the retention policy of tasks of all tenants, it's
+// allowed to admins of the default tenant only.
+func (h *TaskHandler) SetRetention(w http.ResponseWriter, r *http.Request) {
+	if tenant.FromContext(r.Context()) != tenant.DefaultID || !permission.IsAdmin(r.Context()) {
+		http.Error(w, "task retention is configured by admins of the default tenant", http.StatusForbidden)
+		return
+	}
+
+	policy := RetentionPolicy{}
+
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		message.SendInvalidJSON(w, err)
+		return
+	}
+
+	if err := policy.validate(); err != nil {
+		message.SendValidationFailed(w, err)
+		return
+	}
+
+	if err := h.pruner.SetPolicy(r.Context(), policy); err != nil {
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		message.SendUnknownError(w, err)
+	}
+}
+
+// PruneTasks applies the retention policy immediately.
+func (h *TaskHandler) PruneTasks(w http.ResponseWriter, r *http.Request) {
+	removed, err := h.pruner.Prune(r.Context())
+	h.sendRemoved(w, removed, err)
+}
+
+// PurgeTasks removes finished tasks of the tenant and their logs regardless of
+// the retention policy, use kubeID query parameter to purge tasks of a single cluster.
+func (h *TaskHandler) PurgeTasks(w http.ResponseWriter, r *http.Request) {
+	removed, err := h.pruner.Purge(r.Context(), r.URL.Query().Get("kubeID"))
+	h.sendRemoved(w, removed, err)
+}
+
+func (h *TaskHandler) sendRemoved(w http.ResponseWriter, removed []string, err error) {
+	if err != nil {
+		logrus.Errorf("remove tasks: %v", err)
+		message.SendUnknownError(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(PruneResponse{Removed: removed}); err != nil {
+		message.SendUnknownError(w, err)
+	}
 }
 
 // NOTE(stgleb): This is made for testing purposes and example, remove when UI is done.
@@ -208,6 +364,11 @@ func (h *TaskHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := h.tenantTask(r.Context(), id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
 	var upgrader = websocket.Upgrader{
 		HandshakeTimeout: time.Second * 10,
 		WriteBufferSize:  1024,
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hpcloud/tail"
@@ -16,9 +18,12 @@ import (
 
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/permission"
 	"github.com/supergiant/control/pkg/runner"
 	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/testutils"
+	"github.com/supergiant/control/pkg/workflows/statuses"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
@@ -78,6 +83,37 @@ func TestWorkflowHandlerGetWorkflow(t *testing.T) {
 	}
 }
 
+func TestWorkflowHandlerGetWorkflowOfOtherTenant(t *testing.T) {
+	data, _ := json.Marshal(&Task{ID: "abcd", TenantID: "acme"})
+	h := TaskHandler{
+		repository: &MockRepository{
+			map[string][]byte{Prefix + "abcd": data},
+		},
+	}
+
+	router := mux.NewRouter()
+	h.Register(router)
+
+	for _, path := range []string{"/tasks/abcd", "/tasks/abcd/tree", "/tasks/abcd/status",
+		"/tasks/abcd/logs"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: wrong status code expected %d actual %d",
+				path, http.StatusNotFound, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/tasks/abcd", nil)
+	router.ServeHTTP(rec, req.WithContext(tenant.WithID(req.Context(), "acme")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("wrong status code of own task expected %d actual %d",
+			http.StatusOK, rec.Code)
+	}
+}
+
 func TestTaskHandlerRestartTask(t *testing.T) {
 	Init()
 	repository := &MockRepository{
@@ -236,8 +272,12 @@ func TestTaskHandler_StreamLogs(t *testing.T) {
 		rec := httptest.NewRecorder()
 		req, _ := http.NewRequest(http.MethodGet, "/tasks/abcd/logs", nil)
 
+		data, _ := json.Marshal(&Task{ID: "abcd"})
 		router := mux.NewRouter()
 		handler := TaskHandler{
+			repository: &MockRepository{
+				map[string][]byte{Prefix + "abcd": data},
+			},
 			getTail: func(s string) (*tail.Tail, error) {
 				return testCase.t, testCase.getTailErr
 			},
@@ -260,3 +300,86 @@ func TestNewTaskHandler(t *testing.T) {
 		t.Errorf("Handler must not be nil")
 	}
 }
+
+func TestTaskHandler_SetRetention(t *testing.T) {
+	for _, testCase := range []struct {
+		description  string
+		tenantID     string
+		editor       bool
+		body         string
+		expectedCode int
+	}{
+		{
+			description:  "other tenant",
+			tenantID:     "acme",
+			body:         `{"keepPerCluster":10}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			description:  "editor",
+			editor:       true,
+			body:         `{"keepPerCluster":10}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			description:  "invalid json",
+			body:         "{",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "negative limit",
+			body:         `{"keepPerCluster":-1}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "success",
+			body:         `{"keepPerCluster":10,"maxAgeHours":720}`,
+			expectedCode: http.StatusOK,
+		},
+	} {
+		repository := &MockRepository{make(map[string][]byte)}
+		h := NewTaskHandler(repository, nil, nil)
+
+		router := mux.NewRouter()
+		h.Register(router)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/tasks/retention", strings.NewReader(testCase.body))
+		req = req.WithContext(permission.WithAdmin(tenant.WithID(req.Context(), testCase.tenantID), !testCase.editor))
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: wrong status code expected %d actual %d",
+				testCase.description, testCase.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestTaskHandler_PurgeTasks(t *testing.T) {
+	repository := &MockRepository{make(map[string][]byte)}
+	putTask(t, repository, "a1", "a", statuses.Success, time.Hour)
+	putTask(t, repository, "b1", "b", statuses.Error, time.Hour)
+
+	h := NewTaskHandler(repository, nil, nil)
+	h.pruner.removeLog = func(string) error { return nil }
+
+	router := mux.NewRouter()
+	h.Register(router)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/tasks?kubeID=a", nil)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wrong status code expected %d actual %d", http.StatusOK, rec.Code)
+	}
+
+	resp := PruneResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(resp.Removed) != 1 || resp.Removed[0] != "a1" {
+		t.Errorf("wrong removed tasks %v", resp.Removed)
+	}
+}
@@ -0,0 +1,13 @@
+package workflows
+
+import (
+	"github.com/supergiant/control/pkg/migration"
+)
+
+// Migrator upgrades stored tasks to the latest schema version.
+var Migrator = migration.New("id",
+	migration.Migration{
+		From:        0,
+		Description: "start versioning task records",
+	},
+)
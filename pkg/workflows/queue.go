@@ -0,0 +1,291 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const QueuePrefix = "/supergiant/queue/"
+
+var (
+	ErrQueueUnsupported = errors.New("storage can't be used for the task queue")
+	ErrClaimLost        = errors.New("task has been claimed by another worker")
+	ErrTaskCancelled    = errors.New("task has been cancelled")
+)
+
+// Claim is a queued task, a worker holds it while the lease is renewed by
+// heartbeats, a claim with an expired lease is picked up by another worker.
+type Claim struct {
+	TaskID     string    `json:"taskId"`
+	TenantID   string    `json:"tenantId,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	ClusterID  string    `json:"clusterId,omitempty"`
+	Worker     string    `json:"worker,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Cancelled  bool      `json:"cancelled,omitempty"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+
+	// raw is the stored record the claim has been read from
+	raw []byte
+}
+
+func (c *Claim) claimable(now time.Time) bool {
+	return !c.Cancelled && (c.Worker == "" || now.After(c.ExpiresAt))
+}
+
+// Queue keeps tasks waiting for workers in storage, records are changed with
+// compare and swap so a task is never run by two workers at once.
+type Queue struct {
+	prefix  string
+	storage storage.Interface
+	swapper storage.Swapper
+	limits  AccountLimits
+	now     func() time.Time
+}
+
+// NewQueue constructs a Queue, the storage must support compare and swap.
+func NewQueue(repository storage.Interface) (*Queue, error) {
+	swapper, ok := repository.(storage.Swapper)
+	if !ok {
+		return nil, ErrQueueUnsupported
+	}
+
+	return &Queue{
+		prefix:  QueuePrefix,
+		storage: repository,
+		swapper: swapper,
+		now:     time.Now,
+	}, nil
+}
+
+// Submit stores the task with its config and puts it to the queue, the task
+// runs in the tenant of ctx.
+func (q *Queue) Submit(ctx context.Context, t *Task, config *steps.Config) error {
+	t.Config = config
+	t.TenantID = tenant.FromContext(ctx)
+	if err := t.sync(ctx); err != nil {
+		return errors.Wrap(err, "sync task")
+	}
+
+	return q.Resume(ctx, t)
+}
+
+// Resume puts a stored task to the queue, e.g. one interrupted by shutdown
+// of a replica that has run it without the queue.
+func (q *Queue) Resume(ctx context.Context, t *Task) error {
+	c := &Claim{
+		TaskID:     t.ID,
+		TenantID:   t.TenantID,
+		EnqueuedAt: q.now(),
+	}
+	if t.Config != nil {
+		c.Account = t.Config.CloudAccountName
+		c.ClusterID = t.Config.ClusterID
+	}
+	ok, err := q.swap(ctx, c, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sgerrors.ErrAlreadyExists
+	}
+
+	return nil
+}
+
+// Claim takes the oldest claimable task for the worker, nil is returned
+// if there is nothing to do.
+func (q *Queue) Claim(ctx context.Context, worker string, lease time.Duration) (*Claim, error) {
+	claims, err := q.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := q.now()
+	for _, c := range claims {
+		if !c.claimable(now) {
+			continue
+		}
+
+		// the task waits while the account provisions other clusters
+		err = q.Acquire(ctx, c.TenantID, c.Account, c.ClusterID, c.TaskID, lease)
+		if err == ErrLimitReached {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "acquire slot of account %s", c.Account)
+		}
+
+		old := c.raw
+		c.Worker = worker
+		c.Attempts++
+		c.ExpiresAt = now.Add(lease)
+
+		ok, err := q.swap(ctx, c, old)
+		if err != nil {
+			return nil, err
+		}
+		// another worker has been faster
+		if !ok {
+			continue
+		}
+
+		return c, nil
+	}
+
+	return nil, nil
+}
+
+// Heartbeat renews the lease, ErrClaimLost and ErrTaskCancelled
+// tell the worker to stop the task.
+func (q *Queue) Heartbeat(ctx context.Context, c *Claim, lease time.Duration) error {
+	current, err := q.get(ctx, c.TaskID)
+	if err != nil {
+		return err
+	}
+	if current.Worker != c.Worker {
+		return ErrClaimLost
+	}
+	if current.Cancelled {
+		return ErrTaskCancelled
+	}
+
+	if err = q.Acquire(ctx, c.TenantID, c.Account, c.ClusterID, c.TaskID, lease); err != nil && err != ErrLimitReached {
+		return errors.Wrap(err, "renew slot")
+	}
+
+	current.ExpiresAt = q.now().Add(lease)
+	ok, err := q.swap(ctx, current, current.raw)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrClaimLost
+	}
+
+	c.ExpiresAt = current.ExpiresAt
+	c.raw = current.raw
+	return nil
+}
+
+// Release returns the claim to the queue, so another worker
+// can take it without waiting for the lease to expire.
+func (q *Queue) Release(ctx context.Context, c *Claim) error {
+	current, err := q.get(ctx, c.TaskID)
+	if err != nil {
+		return err
+	}
+	if current.Worker != c.Worker {
+		return ErrClaimLost
+	}
+
+	// handover is not a failed attempt
+	current.Worker = ""
+	current.Attempts--
+	current.ExpiresAt = time.Time{}
+	if _, err = q.swap(ctx, current, current.raw); err != nil {
+		return err
+	}
+
+	return q.ReleaseSlot(ctx, c.TenantID, c.Account, c.ClusterID, c.TaskID)
+}
+
+// Complete removes the task from the queue.
+func (q *Queue) Complete(ctx context.Context, c *Claim) error {
+	if err := q.storage.Delete(ctx, q.prefix, c.TaskID); err != nil {
+		return errors.Wrap(err, "storage: delete")
+	}
+
+	return q.ReleaseSlot(ctx, c.TenantID, c.Account, c.ClusterID, c.TaskID)
+}
+
+// Cancel marks the queued task as cancelled, the worker running
+// it stops on the next heartbeat.
+func (q *Queue) Cancel(ctx context.Context, taskID string) error {
+	for {
+		current, err := q.get(ctx, taskID)
+		if err != nil {
+			return err
+		}
+
+		current.Cancelled = true
+		ok, err := q.swap(ctx, current, current.raw)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// List returns queued tasks in order they have been submitted.
+func (q *Queue) List(ctx context.Context) ([]*Claim, error) {
+	return q.list(ctx)
+}
+
+func (q *Queue) list(ctx context.Context) ([]*Claim, error) {
+	rawClaims, err := q.storage.GetAll(ctx, q.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	claims := make([]*Claim, 0, len(rawClaims))
+	for _, raw := range rawClaims {
+		c := &Claim{}
+		if err = json.Unmarshal(raw, c); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		c.raw = raw
+		claims = append(claims, c)
+	}
+
+	sort.Slice(claims, func(i, j int) bool {
+		return claims[i].EnqueuedAt.Before(claims[j].EnqueuedAt)
+	})
+	return claims, nil
+}
+
+func (q *Queue) get(ctx context.Context, taskID string) (*Claim, error) {
+	raw, err := q.storage.Get(ctx, q.prefix, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Claim{}
+	if err = json.Unmarshal(raw, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+	c.raw = raw
+
+	return c, nil
+}
+
+// swap writes the claim if the stored one is still old,
+// the claim keeps the written record on success.
+func (q *Queue) swap(ctx context.Context, c *Claim, old []byte) (bool, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return false, errors.Wrap(err, "marshal")
+	}
+
+	ok, err := q.swapper.CompareAndSwap(ctx, q.prefix, c.TaskID, old, raw)
+	if err != nil {
+		return false, errors.Wrap(err, "storage: compare and swap")
+	}
+	if ok {
+		c.raw = raw
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,131 @@
+package workflows
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage/memory"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/testutils/storage"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *memory.InMemoryRepository, *time.Time) {
+	repository := memory.NewInMemoryRepository()
+	q, err := NewQueue(repository)
+	require.NoError(t, err)
+
+	now := time.Now()
+	q.now = func() time.Time {
+		return now
+	}
+
+	return q, repository, &now
+}
+
+func submit(t *testing.T, ctx context.Context, q *Queue, repository *memory.InMemoryRepository) *Task {
+	task := newTask(ProvisionNode, Workflow{}, repository)
+	require.NoError(t, q.Submit(ctx, task, &steps.Config{ClusterID: "kube"}))
+	return task
+}
+
+func TestNewQueue(t *testing.T) {
+	_, err := NewQueue(storage.Fake{})
+	require.Equal(t, ErrQueueUnsupported, err)
+}
+
+func TestQueue_Submit(t *testing.T) {
+	q, repository, _ := newTestQueue(t)
+	task := submit(t, tenant.WithID(context.Background(), "acme"), q, repository)
+
+	data, err := repository.Get(context.Background(), Prefix, task.ID)
+	require.NoError(t, err)
+	stored, err := DeserializeTask(data, repository)
+	require.NoError(t, err)
+	require.Equal(t, "kube", stored.Config.ClusterID)
+
+	claims, err := q.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, claims, 1)
+	require.Equal(t, task.ID, claims[0].TaskID)
+	require.Equal(t, "acme", claims[0].TenantID)
+
+	require.Equal(t, sgerrors.ErrAlreadyExists, q.Submit(context.Background(), task, task.Config))
+}
+
+func TestQueue_Claim(t *testing.T) {
+	q, repository, now := newTestQueue(t)
+	first := submit(t, context.Background(), q, repository)
+	*now = now.Add(time.Second)
+	second := submit(t, context.Background(), q, repository)
+
+	c, err := q.Claim(context.Background(), "w1", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, c.TaskID, "tasks must be claimed in order")
+	require.Equal(t, 1, c.Attempts)
+
+	c, err = q.Claim(context.Background(), "w2", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, second.ID, c.TaskID)
+
+	c, err = q.Claim(context.Background(), "w3", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, c, "claimed tasks must not be claimed again")
+
+	// tasks of a crashed worker are picked up after the lease expires
+	*now = now.Add(2 * time.Minute)
+	c, err = q.Claim(context.Background(), "w3", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, c.TaskID)
+	require.Equal(t, 2, c.Attempts)
+}
+
+func TestQueue_Heartbeat(t *testing.T) {
+	q, repository, now := newTestQueue(t)
+	submit(t, context.Background(), q, repository)
+
+	c, err := q.Claim(context.Background(), "w1", time.Minute)
+	require.NoError(t, err)
+
+	*now = now.Add(50 * time.Second)
+	require.NoError(t, q.Heartbeat(context.Background(), c, time.Minute))
+
+	*now = now.Add(50 * time.Second)
+	other, err := q.Claim(context.Background(), "w2", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, other, "renewed claim must not be taken over")
+
+	*now = now.Add(2 * time.Minute)
+	other, err = q.Claim(context.Background(), "w2", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	require.Equal(t, ErrClaimLost, q.Heartbeat(context.Background(), c, time.Minute))
+
+	require.NoError(t, q.Cancel(context.Background(), other.TaskID))
+	require.Equal(t, ErrTaskCancelled, q.Heartbeat(context.Background(), other, time.Minute))
+}
+
+func TestQueue_ReleaseComplete(t *testing.T) {
+	q, repository, _ := newTestQueue(t)
+	submit(t, context.Background(), q, repository)
+
+	c, err := q.Claim(context.Background(), "w1", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Release(context.Background(), c))
+
+	c, err = q.Claim(context.Background(), "w2", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, c, "released task must be claimed right away")
+	require.Equal(t, 1, c.Attempts, "handover must not count as an attempt")
+
+	require.NoError(t, q.Complete(context.Background(), c))
+	claims, err := q.List(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, claims)
+
+	require.True(t, sgerrors.IsNotFound(q.Cancel(context.Background(), c.TaskID)))
+}
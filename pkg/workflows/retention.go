@@ -0,0 +1,239 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+const (
+	RetentionPrefix = "/supergiant/retention/"
+	retentionKey    = "tasks"
+)
+
+// RetentionPolicy limits the history of finished tasks, zero values
+// disable the corresponding limit. Running tasks are never pruned.
+type RetentionPolicy struct {
+	// KeepPerCluster is a number of the latest finished tasks kept for a cluster.
+	KeepPerCluster int `json:"keepPerCluster"`
+	// MaxAgeHours is how long a finished task is kept.
+	MaxAgeHours int `json:"maxAgeHours"`
+}
+
+func (p RetentionPolicy) validate() error {
+	if p.KeepPerCluster < 0 || p.MaxAgeHours < 0 {
+		return errors.New("retention limits must not be negative")
+	}
+	return nil
+}
+
+// Pruner removes finished tasks and their logs from storage.
+type Pruner struct {
+	repository storage.Interface
+	removeLog  func(id string) error
+	now        func() time.Time
+}
+
+// NewPruner constructs a Pruner.
+func NewPruner(repository storage.Interface) *Pruner {
+	return &Pruner{
+		repository: repository,
+		removeLog: func(id string) error {
+			err := os.Remove(path.Join("/tmp", util.MakeFileName(id)))
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		},
+		now: time.Now,
+	}
+}
+
+// Policy returns the stored retention policy, tasks are kept
+// forever if it hasn't been configured.
+func (p *Pruner) Policy(ctx context.Context) (*RetentionPolicy, error) {
+	raw, err := p.repository.Get(ctx, RetentionPrefix, retentionKey)
+	if err != nil && !sgerrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "storage: get")
+	}
+
+	policy := &RetentionPolicy{}
+	if len(raw) == 0 {
+		return policy, nil
+	}
+	if err = json.Unmarshal(raw, policy); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	return policy, nil
+}
+
+// SetPolicy saves the retention policy, it is applied on the next prune.
+func (p *Pruner) SetPolicy(ctx context.Context, policy RetentionPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	if err = p.repository.Put(ctx, RetentionPrefix, retentionKey, raw); err != nil {
+		return errors.Wrap(err, "storage: put")
+	}
+
+	return nil
+}
+
+// Run blocks and prunes tasks every interval until ctx is cancelled.
+func (p *Pruner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := p.Prune(ctx)
+			if err != nil {
+				logrus.Errorf("tasks: prune: %v", err)
+				continue
+			}
+			if len(removed) > 0 {
+				logrus.Infof("tasks: pruned %d finished task(s)", len(removed))
+			}
+		}
+	}
+}
+
+// Prune applies the retention policy and returns ids of removed tasks.
+func (p *Pruner) Prune(ctx context.Context) ([]string, error) {
+	policy, err := p.Policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if policy.KeepPerCluster == 0 && policy.MaxAgeHours == 0 {
+		return []string{}, nil
+	}
+
+	byCluster, err := p.finishedTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := p.now().Add(-time.Duration(policy.MaxAgeHours) * time.Hour)
+	expired := make([]*Task, 0)
+	for _, tasks := range byCluster {
+		for i, t := range tasks {
+			if policy.KeepPerCluster > 0 && i >= policy.KeepPerCluster {
+				expired = append(expired, t)
+				continue
+			}
+			// tasks created before timestamps were tracked have zero time
+			// and are limited only by the number of kept tasks
+			if policy.MaxAgeHours > 0 && !finishedAt(t).IsZero() && finishedAt(t).Before(deadline) {
+				expired = append(expired, t)
+			}
+		}
+	}
+
+	return p.remove(ctx, expired)
+}
+
+// Purge removes all finished tasks of the tenant and the cluster regardless
+// of the policy, finished tasks of all clusters of the tenant are removed
+// if clusterID is empty.
+func (p *Pruner) Purge(ctx context.Context, clusterID string) ([]string, error) {
+	byCluster, err := p.finishedTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	expired := make([]*Task, 0)
+	for id, tasks := range byCluster {
+		if clusterID != "" && id != clusterID {
+			continue
+		}
+		for _, t := range tasks {
+			if t.TenantID == tenantID {
+				expired = append(expired, t)
+			}
+		}
+	}
+
+	return p.remove(ctx, expired)
+}
+
+// finishedTasks groups finished tasks by cluster, the latest go first.
+func (p *Pruner) finishedTasks(ctx context.Context) (map[string][]*Task, error) {
+	rawTasks, err := p.repository.GetAll(ctx, Prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	byCluster := make(map[string][]*Task)
+	for _, raw := range rawTasks {
+		t := &Task{}
+		if err = json.Unmarshal(raw, t); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		if !isFinished(t.Status) {
+			continue
+		}
+
+		clusterID := ""
+		if t.Config != nil {
+			clusterID = t.Config.ClusterID
+		}
+		byCluster[clusterID] = append(byCluster[clusterID], t)
+	}
+
+	for _, tasks := range byCluster {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return finishedAt(tasks[i]).After(finishedAt(tasks[j]))
+		})
+	}
+
+	return byCluster, nil
+}
+
+func (p *Pruner) remove(ctx context.Context, tasks []*Task) ([]string, error) {
+	removed := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		if err := p.repository.Delete(ctx, Prefix, t.ID); err != nil {
+			return removed, errors.Wrapf(err, "storage: delete task %s", t.ID)
+		}
+		if err := p.removeLog(t.ID); err != nil {
+			logrus.Warnf("tasks: remove log of task %s: %v", t.ID, err)
+		}
+		removed = append(removed, t.ID)
+	}
+
+	return removed, nil
+}
+
+func isFinished(status statuses.Status) bool {
+	return status == statuses.Success || status == statuses.Error || status == statuses.Cancelled
+}
+
+func finishedAt(t *Task) time.Time {
+	if t.FinishedAt.IsZero() {
+		return t.CreatedAt
+	}
+	return t.FinishedAt
+}
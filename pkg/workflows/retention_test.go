@@ -0,0 +1,139 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+var now = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func putTask(t *testing.T, repo *MockRepository, id, clusterID string, status statuses.Status, age time.Duration) {
+	task := &Task{
+		ID:     id,
+		Status: status,
+		Config: &steps.Config{
+			ClusterID: clusterID,
+		},
+		CreatedAt: now.Add(-age - time.Minute),
+	}
+	if isFinished(status) {
+		task.FinishedAt = now.Add(-age)
+	}
+
+	data, err := json.Marshal(task)
+	require.NoError(t, err)
+	require.NoError(t, repo.Put(context.Background(), Prefix, id, data))
+}
+
+func newTestPruner(t *testing.T) (*Pruner, *MockRepository, *[]string) {
+	repo := &MockRepository{storage: map[string][]byte{}}
+	logs := make([]string, 0)
+
+	putTask(t, repo, "a1", "a", statuses.Success, time.Hour)
+	putTask(t, repo, "a2", "a", statuses.Error, 2*time.Hour)
+	putTask(t, repo, "a3", "a", statuses.Success, 48*time.Hour)
+	putTask(t, repo, "a4", "a", statuses.Executing, 72*time.Hour)
+	putTask(t, repo, "b1", "b", statuses.Cancelled, 72*time.Hour)
+
+	p := NewPruner(repo)
+	p.now = func() time.Time { return now }
+	p.removeLog = func(id string) error {
+		logs = append(logs, id)
+		return nil
+	}
+
+	return p, repo, &logs
+}
+
+func TestPruner_Policy(t *testing.T) {
+	p, _, _ := newTestPruner(t)
+
+	policy, err := p.Policy(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RetentionPolicy{}, *policy)
+
+	require.Error(t, p.SetPolicy(context.Background(), RetentionPolicy{KeepPerCluster: -1}))
+
+	expected := RetentionPolicy{KeepPerCluster: 5, MaxAgeHours: 24}
+	require.NoError(t, p.SetPolicy(context.Background(), expected))
+
+	policy, err = p.Policy(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, *policy)
+}
+
+func TestPruner_Prune(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{
+			name:     "no policy",
+			expected: []string{},
+		},
+		{
+			name:     "keep per cluster",
+			policy:   RetentionPolicy{KeepPerCluster: 1},
+			expected: []string{"a2", "a3"},
+		},
+		{
+			name:     "max age",
+			policy:   RetentionPolicy{MaxAgeHours: 24},
+			expected: []string{"a3", "b1"},
+		},
+		{
+			name:     "both limits",
+			policy:   RetentionPolicy{KeepPerCluster: 2, MaxAgeHours: 24},
+			expected: []string{"a3", "b1"},
+		},
+	} {
+		p, repo, logs := newTestPruner(t)
+		require.NoError(t, p.SetPolicy(context.Background(), tc.policy), "TC: %s", tc.name)
+
+		removed, err := p.Prune(context.Background())
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.ElementsMatch(t, tc.expected, removed, "TC: %s", tc.name)
+		require.ElementsMatch(t, tc.expected, *logs, "TC: %s", tc.name)
+
+		for _, id := range tc.expected {
+			_, ok := repo.storage[Prefix+id]
+			require.False(t, ok, "TC: %s: task %s must be removed", tc.name, id)
+		}
+		_, ok := repo.storage[Prefix+"a4"]
+		require.True(t, ok, "TC: %s: running task must be kept", tc.name)
+	}
+}
+
+func TestPruner_Purge(t *testing.T) {
+	p, repo, _ := newTestPruner(t)
+
+	data, err := json.Marshal(&Task{
+		ID:       "c1",
+		TenantID: "acme",
+		Status:   statuses.Success,
+		Config:   &steps.Config{ClusterID: "b"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, repo.Put(context.Background(), Prefix, "c1", data))
+
+	removed, err := p.Purge(context.Background(), "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b1"}, removed)
+
+	removed, err = p.Purge(context.Background(), "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a1", "a2", "a3"}, removed)
+
+	removed, err = p.Purge(tenant.WithID(context.Background(), "acme"), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c1"}, removed)
+}
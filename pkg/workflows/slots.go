@@ -0,0 +1,199 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const SlotsPrefix = "/supergiant/slots/"
+
+// ErrLimitReached is returned when the cloud account already
+// provisions as many clusters as it is allowed to.
+var ErrLimitReached = errors.New("cloud account provisioning limit has been reached")
+
+// errUnchanged tells updateSlots there is nothing to write
+var errUnchanged = errors.New("slots are unchanged")
+
+// AccountLimits tells how many clusters of a cloud account
+// may be provisioned at once, zero means no limit.
+type AccountLimits interface {
+	ProvisioningLimit(ctx context.Context, account string) (int, error)
+}
+
+// accountSlots is a stored record of clusters an account provisions, a cluster
+// keeps its slot while any of its holders renews the lease.
+type accountSlots struct {
+	// Clusters maps cluster id to holders and their lease expiration
+	Clusters map[string]map[string]time.Time `json:"clusters"`
+}
+
+func (s *accountSlots) expire(now time.Time) {
+	for clusterID, holders := range s.Clusters {
+		for holder, expiresAt := range holders {
+			if now.After(expiresAt) {
+				delete(holders, holder)
+			}
+		}
+		if len(holders) == 0 {
+			delete(s.Clusters, clusterID)
+		}
+	}
+}
+
+// SetLimits makes the queue keep provisioning limits of cloud accounts.
+func (q *Queue) SetLimits(limits AccountLimits) {
+	q.limits = limits
+}
+
+// Acquire takes a slot of the account for the cluster or renews the one the holder
+// already has, tasks of a cluster that has a slot are never limited.
+func (q *Queue) Acquire(ctx context.Context, tenantID, account, clusterID, holder string, lease time.Duration) error {
+	limit, err := q.limit(ctx, tenantID, account)
+	if err != nil || limit == 0 {
+		return err
+	}
+
+	return q.updateSlots(ctx, tenantID, account, func(s *accountSlots) error {
+		holders, ok := s.Clusters[clusterID]
+		if !ok {
+			if len(s.Clusters) >= limit {
+				return ErrLimitReached
+			}
+			holders = make(map[string]time.Time)
+			s.Clusters[clusterID] = holders
+		}
+		holders[holder] = q.now().Add(lease)
+		return nil
+	})
+}
+
+// ReleaseSlot frees the slot of the holder.
+func (q *Queue) ReleaseSlot(ctx context.Context, tenantID, account, clusterID, holder string) error {
+	if q.limits == nil || account == "" {
+		return nil
+	}
+
+	return q.updateSlots(ctx, tenantID, account, func(s *accountSlots) error {
+		if _, ok := s.Clusters[clusterID][holder]; !ok {
+			return errUnchanged
+		}
+		delete(s.Clusters[clusterID], holder)
+		if len(s.Clusters[clusterID]) == 0 {
+			delete(s.Clusters, clusterID)
+		}
+		return nil
+	})
+}
+
+// Hold blocks until the cluster gets a slot of the account and renews it
+// until the returned func is called or ctx is done.
+func (q *Queue) Hold(ctx context.Context, tenantID, account, clusterID, holder string) (func(), error) {
+	lease := DefaultTaskLease
+	for {
+		err := q.Acquire(ctx, tenantID, account, clusterID, holder, lease)
+		if err == nil {
+			break
+		}
+		if err != ErrLimitReached {
+			return nil, err
+		}
+
+		logrus.Debugf("cluster %s waits for a slot of account %s", clusterID, account)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	holdCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-holdCtx.Done():
+				return
+			case <-ticker.C:
+				if err := q.Acquire(holdCtx, tenantID, account, clusterID, holder, lease); err != nil {
+					logrus.Errorf("renew slot of cluster %s: %v", clusterID, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := q.ReleaseSlot(context.Background(), tenantID, account, clusterID, holder); err != nil {
+			logrus.Errorf("release slot of cluster %s: %v", clusterID, err)
+		}
+	}, nil
+}
+
+func (q *Queue) limit(ctx context.Context, tenantID, account string) (int, error) {
+	if q.limits == nil || account == "" {
+		return 0, nil
+	}
+
+	limit, err := q.limits.ProvisioningLimit(tenant.WithID(ctx, tenantID), account)
+	// tasks of removed accounts are not limited
+	if sgerrors.IsNotFound(err) {
+		return 0, nil
+	}
+
+	return limit, err
+}
+
+// updateSlots applies the change to slots of the account, the record
+// is swapped again if it has been changed by another replica.
+func (q *Queue) updateSlots(ctx context.Context, tenantID, account string, change func(*accountSlots) error) error {
+	key := path.Join(tenantID, account)
+	for {
+		old, err := q.storage.Get(ctx, SlotsPrefix, key)
+		if err != nil && !sgerrors.IsNotFound(err) {
+			return errors.Wrap(err, "storage: get")
+		}
+
+		s := &accountSlots{}
+		if old != nil {
+			if err = json.Unmarshal(old, s); err != nil {
+				return errors.Wrap(err, "unmarshal")
+			}
+		}
+		if s.Clusters == nil {
+			s.Clusters = make(map[string]map[string]time.Time)
+		}
+		s.expire(q.now())
+
+		if err = change(s); err == errUnchanged {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		raw, err := json.Marshal(s)
+		if err != nil {
+			return errors.Wrap(err, "marshal")
+		}
+
+		ok, err := q.swapper.CompareAndSwap(ctx, SlotsPrefix, key, old, raw)
+		if err != nil {
+			return errors.Wrap(err, "storage: compare and swap")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
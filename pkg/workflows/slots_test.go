@@ -0,0 +1,104 @@
+package workflows
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/tenant"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeLimits map[string]int
+
+func (l fakeLimits) ProvisioningLimit(ctx context.Context, account string) (int, error) {
+	limit, ok := l[tenant.FromContext(ctx)+"/"+account]
+	if !ok {
+		return 0, sgerrors.ErrNotFound
+	}
+	return limit, nil
+}
+
+func TestQueue_Acquire(t *testing.T) {
+	q, _, now := newTestQueue(t)
+	q.SetLimits(fakeLimits{"acme/aws": 1})
+	ctx := context.Background()
+
+	require.NoError(t, q.Acquire(ctx, "acme", "aws", "k1", "t1", time.Minute))
+	require.NoError(t, q.Acquire(ctx, "acme", "aws", "k1", "t2", time.Minute),
+		"tasks of a cluster that has a slot must not be limited")
+	require.Equal(t, ErrLimitReached, q.Acquire(ctx, "acme", "aws", "k2", "t3", time.Minute))
+
+	require.NoError(t, q.Acquire(ctx, "other", "aws", "k2", "t3", time.Minute),
+		"accounts of other tenants must not be limited")
+	require.NoError(t, q.Acquire(ctx, "acme", "gce", "k2", "t3", time.Minute),
+		"accounts without a limit must not be limited")
+
+	require.NoError(t, q.ReleaseSlot(ctx, "acme", "aws", "k1", "t1"))
+	require.Equal(t, ErrLimitReached, q.Acquire(ctx, "acme", "aws", "k2", "t3", time.Minute),
+		"the cluster keeps the slot while it has holders")
+	require.NoError(t, q.ReleaseSlot(ctx, "acme", "aws", "k1", "t2"))
+	require.NoError(t, q.Acquire(ctx, "acme", "aws", "k2", "t3", time.Minute))
+
+	// slots of crashed replicas expire
+	*now = now.Add(2 * time.Minute)
+	require.NoError(t, q.Acquire(ctx, "acme", "aws", "k3", "t4", time.Minute))
+}
+
+func TestQueue_ClaimLimited(t *testing.T) {
+	q, repository, now := newTestQueue(t)
+	q.SetLimits(fakeLimits{"/aws": 1})
+	ctx := context.Background()
+
+	var tasks []*Task
+	for _, clusterID := range []string{"k1", "k1", "k2"} {
+		*now = now.Add(time.Second)
+		task := newTask(ProvisionNode, Workflow{}, repository)
+		require.NoError(t, q.Submit(ctx, task, &steps.Config{
+			ClusterID:        clusterID,
+			CloudAccountName: "aws",
+		}))
+		tasks = append(tasks, task)
+	}
+
+	first, err := q.Claim(ctx, "w1", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, tasks[0].ID, first.TaskID)
+
+	second, err := q.Claim(ctx, "w1", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, tasks[1].ID, second.TaskID, "tasks of the same cluster must not be limited")
+
+	c, err := q.Claim(ctx, "w1", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, c, "task of another cluster must wait for the account")
+
+	require.NoError(t, q.Complete(ctx, first))
+	require.NoError(t, q.Complete(ctx, second))
+
+	c, err = q.Claim(ctx, "w1", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	require.Equal(t, tasks[2].ID, c.TaskID)
+}
+
+func TestQueue_Hold(t *testing.T) {
+	q, _, _ := newTestQueue(t)
+	q.SetLimits(fakeLimits{"/aws": 1})
+
+	release, err := q.Hold(context.Background(), "", "aws", "k1", "k1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = q.Hold(ctx, "", "aws", "k2", "k2")
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	release()
+	release, err = q.Hold(context.Background(), "", "aws", "k2", "k2")
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,83 @@
+package workflows
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/permission"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+// TaskStatus is a status of a long operation, clients poll it at the Location
+// of the 202 response until the operation is done.
+type TaskStatus struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Status AggregateStatus `json:"status"`
+	Done   bool            `json:"done"`
+	// Error is a message of the first failed step.
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+	Tasks      []*TaskStatus `json:"tasks,omitempty"`
+}
+
+// NewTaskStatus summarizes the task with its sub-tasks.
+func NewTaskStatus(tree *TaskTree) *TaskStatus {
+	s := &TaskStatus{
+		ID:        tree.ID,
+		Type:      tree.Type,
+		Status:    tree.AggregateStatus,
+		Done:      isDone(tree.AggregateStatus),
+		CreatedAt: tree.CreatedAt,
+	}
+
+	finishedAt := tree.FinishedAt
+	for _, step := range tree.StepStatuses {
+		if step.Status == statuses.Error && s.Error == "" {
+			s.Error = step.ErrMsg
+		}
+	}
+	for _, child := range tree.Children {
+		sub := NewTaskStatus(child)
+		s.Tasks = append(s.Tasks, sub)
+		if s.Error == "" {
+			s.Error = sub.Error
+		}
+		if sub.FinishedAt != nil && sub.FinishedAt.After(finishedAt) {
+			finishedAt = *sub.FinishedAt
+		}
+	}
+
+	if s.Done && !finishedAt.IsZero() {
+		s.FinishedAt = &finishedAt
+	}
+
+	return s
+}
+
+// TaskLocation is a url of the task status.
+func TaskLocation(id string) string {
+	return path.Join(permission.APIPrefix, "tasks", id, "status")
+}
+
+// SendAccepted answers a request that has started a long operation tracked
+// by the task, the body is optional.
+func SendAccepted(w http.ResponseWriter, taskID string, body interface{}) {
+	w.Header().Set("Location", TaskLocation(taskID))
+	w.WriteHeader(http.StatusAccepted)
+	if body == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.Errorf("task %s: write response: %v", taskID, err)
+	}
+}
+
+func isDone(status AggregateStatus) bool {
+	return status == AggregateSucceeded || status == AggregateFailed || status == AggregatePartial
+}
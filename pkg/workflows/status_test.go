@@ -0,0 +1,109 @@
+package workflows
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+func TestNewTaskStatus(t *testing.T) {
+	now := time.Now().UTC()
+	tree := &TaskTree{
+		Task:            &Task{ID: "cluster", Type: ClusterTask, Status: statuses.Error, CreatedAt: now},
+		AggregateStatus: AggregatePartial,
+		Children: []*TaskTree{
+			{
+				Task:            &Task{ID: "master", Type: MasterTask, FinishedAt: now.Add(time.Minute)},
+				AggregateStatus: AggregateSucceeded,
+			},
+			{
+				Task: &Task{
+					ID:         "node",
+					Type:       NodeTask,
+					FinishedAt: now.Add(2 * time.Minute),
+					StepStatuses: []StepStatus{
+						{Status: statuses.Success, StepName: "ssh"},
+						{Status: statuses.Error, StepName: "kubelet", ErrMsg: "kubelet failed"},
+					},
+				},
+				AggregateStatus: AggregateFailed,
+			},
+		},
+	}
+
+	s := NewTaskStatus(tree)
+	require.Equal(t, "cluster", s.ID)
+	require.Equal(t, AggregatePartial, s.Status)
+	require.True(t, s.Done)
+	require.Equal(t, "kubelet failed", s.Error)
+	require.Len(t, s.Tasks, 2)
+	require.NotNil(t, s.FinishedAt)
+	require.Equal(t, now.Add(2*time.Minute), *s.FinishedAt)
+
+	tree.AggregateStatus = AggregateRunning
+	s = NewTaskStatus(tree)
+	require.False(t, s.Done)
+	require.Nil(t, s.FinishedAt)
+}
+
+func TestSendAccepted(t *testing.T) {
+	rec := httptest.NewRecorder()
+	SendAccepted(rec, "task", TaskResponse{ID: "task"})
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, "/v1/api/tasks/task/status", rec.Header().Get("Location"))
+
+	resp := TaskResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, "task", resp.ID)
+}
+
+func TestTaskHandler_GetTaskStatus(t *testing.T) {
+	repo := &MockRepository{storage: map[string][]byte{}}
+	storeTask(t, repo, &Task{ID: "group", Type: GroupTask})
+	storeTask(t, repo, &Task{ID: "first", Type: NodeTask, Status: statuses.Success, ParentID: "group"})
+	storeTask(t, repo, &Task{ID: "second", Type: NodeTask, Status: statuses.Executing, ParentID: "group"})
+
+	router := mux.NewRouter()
+	(&TaskHandler{repository: repo}).Register(router)
+
+	for _, tc := range []struct {
+		id             string
+		expectedCode   int
+		expectedStatus AggregateStatus
+	}{
+		{
+			id:           "missing",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			id:             "group",
+			expectedCode:   http.StatusOK,
+			expectedStatus: AggregateRunning,
+		},
+		{
+			id:             "first",
+			expectedCode:   http.StatusOK,
+			expectedStatus: AggregateSucceeded,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks/"+tc.id+"/status", nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.id)
+		if tc.expectedCode != http.StatusOK {
+			continue
+		}
+
+		s := &TaskStatus{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(s))
+		require.Equal(t, tc.expectedStatus, s.Status, "TC: %s", tc.id)
+		require.Equal(t, tc.expectedStatus == AggregateSucceeded, s.Done, "TC: %s", tc.id)
+	}
+}
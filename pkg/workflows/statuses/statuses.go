@@ -8,4 +8,7 @@ const (
 	Success   Status = "success"
 	Error     Status = "error"
 	Cancelled Status = "cancelled"
+	// Interrupted tasks have been stopped at a step boundary
+	// by shutdown and are resumed by another replica.
+	Interrupted Status = "interrupted"
 )
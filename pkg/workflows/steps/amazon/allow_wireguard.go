@@ -0,0 +1,89 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const AllowWireGuardStepName = "aws_allow_wireguard"
+
+// AllowWireGuard opens the wireguard port of cluster security groups, peers
+// of the mesh may run in other clouds so the port is open to any address.
+type AllowWireGuard struct {
+	getSvc func(steps.AWSConfig) (peeringSvc, error)
+}
+
+func InitAllowWireGuard(fn GetEC2Fn) {
+	steps.RegisterStep(AllowWireGuardStepName, NewAllowWireGuard(fn))
+}
+
+func NewAllowWireGuard(fn GetEC2Fn) *AllowWireGuard {
+	return &AllowWireGuard{
+		getSvc: peeringSvcFn(fn),
+	}
+}
+
+func (s *AllowWireGuard) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	port := cfg.WireGuardConfig.ListenPort
+	if port == 0 {
+		return errors.Errorf("%s: wireguard port is not set", AllowWireGuardStepName)
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, AllowWireGuardStepName)
+	}
+
+	for _, groupID := range []string{cfg.AWSConfig.MastersSecurityGroupID, cfg.AWSConfig.NodesSecurityGroupID} {
+		if groupID == "" {
+			continue
+		}
+
+		log.Infof("[%s] - allow udp port %d in security group %s", s.Name(), port, groupID)
+		_, err = svc.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: aws.String(groupID),
+			IpPermissions: []*ec2.IpPermission{
+				{
+					IpProtocol: aws.String("udp"),
+					FromPort:   aws.Int64(int64(port)),
+					ToPort:     aws.Int64(int64(port)),
+					IpRanges: []*ec2.IpRange{
+						{
+							CidrIp:      aws.String("0.0.0.0/0"),
+							Description: aws.String("wireguard mesh"),
+						},
+					},
+				},
+			},
+		})
+		if err != nil && !hasCode(err, "InvalidPermission.Duplicate") {
+			return errors.Wrapf(err, "authorize wireguard ingress to %s", groupID)
+		}
+	}
+
+	return nil
+}
+
+func (*AllowWireGuard) Name() string {
+	return AllowWireGuardStepName
+}
+
+func (*AllowWireGuard) Depends() []string {
+	return nil
+}
+
+func (*AllowWireGuard) Description() string {
+	return "Allow wireguard traffic to cluster machines"
+}
+
+func (*AllowWireGuard) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestAllowWireGuard_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		port       int
+		ingressErr error
+
+		hasErr bool
+		calls  int
+	}{
+		{
+			name:   "no port",
+			hasErr: true,
+		},
+		{
+			name:       "error",
+			port:       51820,
+			ingressErr: errors.New("limit"),
+			hasErr:     true,
+			calls:      1,
+		},
+		{
+			name:       "duplicate",
+			port:       51820,
+			ingressErr: awserr.New("InvalidPermission.Duplicate", "", nil),
+			calls:      2,
+		},
+		{
+			name:  "allowed",
+			port:  51820,
+			calls: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("AuthorizeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, tc.ingressErr)
+			step := &AllowWireGuard{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+			}
+
+			cfg := &steps.Config{
+				AWSConfig: steps.AWSConfig{
+					MastersSecurityGroupID: "sg-m",
+					NodesSecurityGroupID:   "sg-n",
+				},
+				WireGuardConfig: steps.WireGuardConfig{
+					ListenPort: tc.port,
+				},
+			}
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "AuthorizeSecurityGroupIngressWithContext", tc.calls)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package amazon
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -8,8 +10,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/sirupsen/logrus"
 
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+	"github.com/supergiant/control/pkg/clouds/awssdk"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
@@ -27,7 +32,24 @@ func GetEC2(cfg steps.AWSConfig) (ec2iface.EC2API, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ec2.New(sess), nil
+	return ec2.New(apicalls.InstrumentAWS(sess)), nil
+}
+
+type GetInstanceMetadataFn func(steps.AWSConfig) (*awssdk.InstanceMetadata, error)
+
+// GetInstanceMetadata returns a client of the instance metadata options of ec2.
+func GetInstanceMetadata(cfg steps.AWSConfig) (*awssdk.InstanceMetadata, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Region:      aws.String(cfg.Region),
+			Credentials: credentials.NewStaticCredentials(cfg.KeyID, cfg.Secret, ""),
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return awssdk.NewInstanceMetadata(ec2.New(apicalls.InstrumentAWS(sess)).Client), nil
 }
 
 type GetIAMFn func(steps.AWSConfig) (iamiface.IAMAPI, error)
@@ -43,5 +65,26 @@ func GetIAM(cfg steps.AWSConfig) (iamiface.IAMAPI, error) {
 	if err != nil {
 		return nil, err
 	}
-	return iam.New(sess), nil
+	return iam.New(apicalls.InstrumentAWS(sess)), nil
+}
+
+type GetAccountIDFn func(context.Context, steps.AWSConfig) (string, error)
+
+// GetAccountID returns the id of aws account the credentials belong to.
+func GetAccountID(ctx context.Context, cfg steps.AWSConfig) (string, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Region:      aws.String(cfg.Region),
+			Credentials: credentials.NewStaticCredentials(cfg.KeyID, cfg.Secret, ""),
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+	out, err := sts.New(apicalls.InstrumentAWS(sess)).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Account), nil
 }
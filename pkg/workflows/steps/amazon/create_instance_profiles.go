@@ -17,7 +17,11 @@ import (
 )
 
 const (
-	roleMaster = "master"
+	roleMaster         = "master"
+	roleRestrictedNode = "node-restricted"
+
+	// RestrictedNodeInstanceProfile is given to nodes of hardened clusters.
+	RestrictedNodeInstanceProfile = "kubernetes-" + roleRestrictedNode
 
 	assumePolicy = `{
   "Version": "2012-10-17",
@@ -119,6 +123,21 @@ const (
           } 
       ]
 }`
+
+	// the kubelet cloud provider looks up its own instance only
+	restrictedNodeIAMPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": [
+        "ec2:DescribeInstances",
+        "ec2:DescribeRegions"
+      ],
+      "Resource": "*"
+    }
+  ]
+}`
 )
 
 var (
@@ -156,7 +175,11 @@ func (s StepCreateInstanceProfiles) Run(ctx context.Context, w io.Writer, cfg *s
 	}
 	logrus.Infof("%s: set up %s instance profile", s.Name(), cfg.AWSConfig.MastersInstanceProfile)
 
-	cfg.AWSConfig.NodesInstanceProfile, err = ensureIAMProfile(ctx, iamS, cfg.ClusterID, string(model.RoleNode))
+	nodeRole := string(model.RoleNode)
+	if cfg.HardeningConfig.RestrictedInstanceProfiles {
+		nodeRole = roleRestrictedNode
+	}
+	cfg.AWSConfig.NodesInstanceProfile, err = ensureIAMProfile(ctx, iamS, cfg.ClusterID, nodeRole)
 	if err != nil {
 		return errors.Wrapf(err, "%s: failed to authorize in AWS: %v", s.Name(), err)
 	}
@@ -296,8 +319,11 @@ func isNotFoundErr(err error) bool {
 }
 
 func policyFor(role string) string {
-	if role == roleMaster {
+	switch role {
+	case roleMaster:
 		return masterIAMPolicy
+	case roleRestrictedNode:
+		return restrictedNodeIAMPolicy
 	}
 	return nodeIAMPolicy
 }
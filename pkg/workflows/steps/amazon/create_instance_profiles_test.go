@@ -125,6 +125,24 @@ func TestCreateInstanceProfiles_Run(t *testing.T) {
 				ClusterID: "42",
 			},
 		},
+		{
+			name: "restricted node profile",
+			iamClientGetter: func(config steps.AWSConfig) (iamiface.IAMAPI, error) {
+				return &fakeIAMClient{
+					getInstanceProfile: &iam.GetInstanceProfileOutput{
+						InstanceProfile: &iam.InstanceProfile{
+							Roles: []*iam.Role{{RoleName: aws.String("someRole")}},
+						},
+					},
+				}, nil
+			},
+			cfg: steps.Config{
+				ClusterID: "42",
+				HardeningConfig: steps.HardeningConfig{
+					RestrictedInstanceProfiles: true,
+				},
+			},
+		},
 	} {
 		step := NewCreateInstanceProfiles(tc.iamClientGetter)
 		err := step.Run(context.Background(), ioutil.Discard, &tc.cfg)
@@ -137,9 +155,13 @@ func TestCreateInstanceProfiles_Run(t *testing.T) {
 				tc.cfg.AWSConfig.MastersInstanceProfile,
 				"TC: %s", tc.name)
 
+			nodeProfile := buildIAMName(tc.cfg.ClusterID, string(model.RoleNode))
+			if tc.cfg.HardeningConfig.RestrictedInstanceProfiles {
+				nodeProfile = RestrictedNodeInstanceProfile
+			}
 			require.Equalf(
 				t,
-				buildIAMName(tc.cfg.ClusterID, string(model.RoleNode)),
+				nodeProfile,
 				tc.cfg.AWSConfig.NodesInstanceProfile,
 				"TC: %s", tc.name)
 		}
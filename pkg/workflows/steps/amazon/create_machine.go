@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -13,13 +14,20 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/awssdk"
 	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
 const (
 	StepNameCreateEC2Instance = "aws_create_instance"
+
+	defaultVolumeType = "gp2"
+	// data volumes are attached as /dev/sdf to /dev/sdp
+	firstDataDevice = 'f'
+	lastDataDevice  = 'p'
 )
 
 type instanceService interface {
@@ -28,8 +36,13 @@ type instanceService interface {
 	WaitUntilInstanceRunningWithContext(aws.Context, *ec2.DescribeInstancesInput, ...request.WaiterOption) error
 }
 
+type metadataService interface {
+	ModifyMetadataOptions(ctx context.Context, id string, opts awssdk.MetadataOptions) error
+}
+
 type StepCreateInstance struct {
-	getSvc func(steps.AWSConfig) (instanceService, error)
+	getSvc      func(steps.AWSConfig) (instanceService, error)
+	getMetadata func(steps.AWSConfig) (metadataService, error)
 }
 
 //InitCreateMachine adds the step to the registry
@@ -48,6 +61,9 @@ func NewCreateInstance(ec2fn GetEC2Fn) *StepCreateInstance {
 
 			return EC2, nil
 		},
+		getMetadata: func(config steps.AWSConfig) (metadataService, error) {
+			return GetInstanceMetadata(config)
+		},
 	}
 }
 
@@ -61,6 +77,14 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 		return errors.Wrap(ErrAuthorization, err.Error())
 	}
 
+	dataVolumes, err := profile.ParseDataVolumes(cfg.AWSConfig.DataVolumes)
+	if err != nil {
+		return errors.Wrap(err, "parse data volumes")
+	}
+	if len(dataVolumes) > lastDataDevice-firstDataDevice+1 {
+		return errors.Errorf("at most %d data volumes can be attached", lastDataDevice-firstDataDevice+1)
+	}
+
 	role := model.RoleMaster
 	if !cfg.IsMaster {
 		role = model.RoleNode
@@ -95,6 +119,10 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 
 	isEbs := false
 	volumeSize, err := strconv.Atoi(cfg.AWSConfig.VolumeSize)
+	volumeType := cfg.AWSConfig.VolumeType
+	if volumeType == "" {
+		volumeType = defaultVolumeType
+	}
 
 	runInstanceInput := &ec2.RunInstancesInput{
 		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
@@ -102,8 +130,10 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 				DeviceName: aws.String("/dev/xvda"),
 				Ebs: &ec2.EbsBlockDevice{
 					DeleteOnTermination: aws.Bool(true),
-					VolumeType:          aws.String("gp2"),
+					VolumeType:          aws.String(volumeType),
 					VolumeSize:          aws.Int64(int64(volumeSize)),
+					// the default kms key of ebs is used
+					Encrypted: aws.Bool(cfg.HardeningConfig.EncryptVolumes),
 				},
 			},
 		},
@@ -145,6 +175,21 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 			},
 		},
 	}
+	// a single rack failure takes down at most one master
+	if cfg.IsMaster && cfg.AWSConfig.MastersPlacementGroup != "" {
+		runInstanceInput.Placement.GroupName = aws.String(cfg.AWSConfig.MastersPlacementGroup)
+	}
+	for i, v := range dataVolumes {
+		runInstanceInput.BlockDeviceMappings = append(runInstanceInput.BlockDeviceMappings, &ec2.BlockDeviceMapping{
+			DeviceName: aws.String(dataDeviceName(i)),
+			Ebs: &ec2.EbsBlockDevice{
+				DeleteOnTermination: aws.Bool(true),
+				VolumeType:          aws.String(dataVolumeType(v)),
+				VolumeSize:          aws.Int64(v.SizeGB),
+				Encrypted:           aws.Bool(cfg.HardeningConfig.EncryptVolumes),
+			},
+		})
+	}
 	if cfg.AWSConfig.HasPublicAddr {
 		runInstanceInput.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{
 			{
@@ -188,6 +233,15 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 
 	instance := res.Instances[0]
 
+	if cfg.HardeningConfig.MetadataTokensRequired {
+		log.Infof("[%s] - require metadata tokens for instance %s", s.Name(), aws.StringValue(instance.InstanceId))
+		if err = s.requireMetadataTokens(ctx, cfg, aws.StringValue(instance.InstanceId)); err != nil {
+			cfg.Node.State = model.MachineStateError
+			cfg.NodeChan() <- cfg.Node
+			return errors.Wrap(ErrCreateInstance, err.Error())
+		}
+	}
+
 	if cfg.AWSConfig.HasPublicAddr {
 		log.Infof("[%s] - waiting to obtain public IP...", s.Name())
 
@@ -235,6 +289,18 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 		}
 	}
 
+	cfg.DataVolumesConfig.Volumes = nil
+	if len(dataVolumes) > 0 {
+		volumes, err := s.findDataVolumes(ctx, ec2Svc, aws.StringValue(instance.InstanceId), dataVolumes)
+		if err != nil {
+			cfg.Node.State = model.MachineStateError
+			cfg.NodeChan() <- cfg.Node
+			log.Errorf("[%s] - failed to find data volumes of node %s: %v", s.Name(), nodeName, err)
+			return errors.Wrap(ErrCreateInstance, err.Error())
+		}
+		cfg.DataVolumesConfig.Volumes = volumes
+	}
+
 	cfg.Node.Region = cfg.AWSConfig.Region
 	cfg.Node.CreatedAt = instance.LaunchTime.Unix()
 	cfg.Node.ID = *instance.InstanceId
@@ -254,6 +320,79 @@ func (s *StepCreateInstance) Run(ctx context.Context, w io.Writer, cfg *steps.Co
 	return nil
 }
 
+// requireMetadataTokens enforces IMDSv2 on the instance, the hop limit keeps
+// tokens on the machine, so pods outside of the host network don't get them.
+func (s *StepCreateInstance) requireMetadataTokens(ctx context.Context, cfg *steps.Config, id string) error {
+	svc, err := s.getMetadata(cfg.AWSConfig)
+	if err != nil {
+		return err
+	}
+
+	return svc.ModifyMetadataOptions(ctx, id, awssdk.MetadataOptions{
+		HTTPTokens: awssdk.MetadataTokensRequired,
+		HopLimit:   1,
+	})
+}
+
+// findDataVolumes waits until volumes are attached to the instance, nitro instances
+// expose them as nvme devices with ids of volumes in serial numbers, not with names of mappings.
+func (s *StepCreateInstance) findDataVolumes(ctx context.Context, svc instanceService,
+	id string, dataVolumes []profile.DataVolume) ([]steps.DataVolumeConfig, error) {
+	lookup := &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(id)},
+	}
+	if err := svc.WaitUntilInstanceRunningWithContext(ctx, lookup); err != nil {
+		return nil, errors.Wrapf(err, "wait instance %s running", id)
+	}
+
+	out, err := svc.DescribeInstancesWithContext(ctx, lookup)
+	if err != nil {
+		return nil, errors.Wrapf(err, "describe instance %s", id)
+	}
+
+	volumeIDs := make(map[string]string)
+	for _, r := range out.Reservations {
+		for _, i := range r.Instances {
+			for _, b := range i.BlockDeviceMappings {
+				if b.Ebs != nil {
+					volumeIDs[aws.StringValue(b.DeviceName)] = aws.StringValue(b.Ebs.VolumeId)
+				}
+			}
+		}
+	}
+
+	volumes := make([]steps.DataVolumeConfig, 0, len(dataVolumes))
+	for i, v := range dataVolumes {
+		name := dataDeviceName(i)
+		volumeID, ok := volumeIDs[name]
+		if !ok {
+			return nil, errors.Errorf("volume %s isn't attached to instance %s", name, id)
+		}
+
+		volumes = append(volumes, steps.DataVolumeConfig{
+			Devices: []string{
+				"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_" + strings.Replace(volumeID, "-", "", 1),
+				strings.Replace(name, "/dev/sd", "/dev/xvd", 1),
+				name,
+			},
+			MountPoint: v.MountPoint,
+		})
+	}
+
+	return volumes, nil
+}
+
+func dataDeviceName(index int) string {
+	return "/dev/sd" + string(rune(firstDataDevice+index))
+}
+
+func dataVolumeType(v profile.DataVolume) string {
+	if v.Type == "" {
+		return defaultVolumeType
+	}
+	return v.Type
+}
+
 func (s *StepCreateInstance) Rollback(ctx context.Context, w io.Writer, cfg *steps.Config) error {
 	return nil
 }
@@ -14,7 +14,9 @@ import (
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	"github.com/supergiant/control/pkg/clouds/awssdk"
 	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
@@ -53,17 +55,32 @@ func (m *mockEC2) WaitUntilInstanceRunningWithContext(ctx aws.Context,
 	return val
 }
 
+type fakeMetadataSvc struct {
+	modified string
+	opts     awssdk.MetadataOptions
+	err      error
+}
+
+func (f *fakeMetadataSvc) ModifyMetadataOptions(ctx context.Context, id string, opts awssdk.MetadataOptions) error {
+	f.modified, f.opts = id, opts
+	return f.err
+}
+
 func TestStepCreateInstance_Run(t *testing.T) {
 	testCases := []struct {
 		description       string
 		isMaster          bool
+		hardening         steps.HardeningConfig
+		dataVolumes       string
 		getSvcErr         error
 		runInstanceErr    error
 		runInstanceResp   *ec2.Reservation
 		waitErr           error
 		describeErr       error
 		describeInstances *ec2.DescribeInstancesOutput
+		modifyErr         error
 		errMsg            string
+		expectedVolumes   []steps.DataVolumeConfig
 	}{
 		{
 			description: "get service error",
@@ -134,6 +151,136 @@ func TestStepCreateInstance_Run(t *testing.T) {
 			},
 			errMsg: "no public IP",
 		},
+		{
+			description: "require metadata tokens error",
+			hardening: steps.HardeningConfig{
+				MetadataTokensRequired: true,
+			},
+			runInstanceResp: &ec2.Reservation{
+				Instances: []*ec2.Instance{
+					{
+						InstanceId: aws.String("1234"),
+					},
+				},
+			},
+			modifyErr: errors.New("message5"),
+			errMsg:    "message5",
+		},
+		{
+			description: "success hardened",
+			hardening: steps.HardeningConfig{
+				MetadataTokensRequired: true,
+				EncryptVolumes:         true,
+			},
+			runInstanceResp: &ec2.Reservation{
+				Instances: []*ec2.Instance{
+					{
+						InstanceId: aws.String("1234"),
+						LaunchTime: &time.Time{},
+					},
+				},
+			},
+			describeInstances: &ec2.DescribeInstancesOutput{
+				Reservations: []*ec2.Reservation{
+					{
+						Instances: []*ec2.Instance{
+							{
+								InstanceId:       aws.String("1234"),
+								PublicIpAddress:  aws.String("10.20.30.40"),
+								PrivateIpAddress: aws.String("172.16.0.1"),
+								LaunchTime:       &time.Time{},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "wrong data volumes",
+			dataVolumes: "100:gp3",
+			errMsg:      "size:type:mountPoint",
+		},
+		{
+			description: "data volume isn't attached",
+			dataVolumes: "100:gp3:/var/lib/docker",
+			runInstanceResp: &ec2.Reservation{
+				Instances: []*ec2.Instance{
+					{
+						InstanceId: aws.String("1234"),
+						LaunchTime: &time.Time{},
+					},
+				},
+			},
+			describeInstances: &ec2.DescribeInstancesOutput{
+				Reservations: []*ec2.Reservation{
+					{
+						Instances: []*ec2.Instance{
+							{
+								InstanceId:       aws.String("1234"),
+								PublicIpAddress:  aws.String("10.20.30.40"),
+								PrivateIpAddress: aws.String("172.16.0.1"),
+								LaunchTime:       &time.Time{},
+							},
+						},
+					},
+				},
+			},
+			errMsg: "/dev/sdf isn't attached",
+		},
+		{
+			description: "success data volumes",
+			dataVolumes: "100:gp3:/var/lib/docker,500::/data",
+			runInstanceResp: &ec2.Reservation{
+				Instances: []*ec2.Instance{
+					{
+						InstanceId: aws.String("1234"),
+						LaunchTime: &time.Time{},
+					},
+				},
+			},
+			describeInstances: &ec2.DescribeInstancesOutput{
+				Reservations: []*ec2.Reservation{
+					{
+						Instances: []*ec2.Instance{
+							{
+								InstanceId:       aws.String("1234"),
+								PublicIpAddress:  aws.String("10.20.30.40"),
+								PrivateIpAddress: aws.String("172.16.0.1"),
+								LaunchTime:       &time.Time{},
+								BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+									{
+										DeviceName: aws.String("/dev/sdf"),
+										Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-1")},
+									},
+									{
+										DeviceName: aws.String("/dev/sdg"),
+										Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-2")},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedVolumes: []steps.DataVolumeConfig{
+				{
+					Devices: []string{
+						"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol1",
+						"/dev/xvdf",
+						"/dev/sdf",
+					},
+					MountPoint: "/var/lib/docker",
+				},
+				{
+					Devices: []string{
+						"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol2",
+						"/dev/xvdg",
+						"/dev/sdg",
+					},
+					MountPoint: "/data",
+				},
+			},
+		},
 		{
 			description: "success",
 			runInstanceResp: &ec2.Reservation{
@@ -199,6 +346,9 @@ func TestStepCreateInstance_Run(t *testing.T) {
 		config.TaskID = uuid.New()
 		config.ClusterID = uuid.New()
 		config.IsMaster = testCase.isMaster
+		config.HardeningConfig = testCase.hardening
+		config.AWSConfig.DataVolumes = testCase.dataVolumes
+		config.AWSConfig.MastersPlacementGroup = "masters"
 
 		ec2Svc := &mockEC2{}
 		ec2Svc.On("RunInstancesWithContext",
@@ -210,10 +360,14 @@ func TestStepCreateInstance_Run(t *testing.T) {
 		ec2Svc.On("WaitUntilInstanceRunningWithContext",
 			mock.Anything, mock.Anything, mock.Anything).Return(testCase.waitErr)
 
+		metadataSvc := &fakeMetadataSvc{err: testCase.modifyErr}
 		step := &StepCreateInstance{
 			getSvc: func(steps.AWSConfig) (instanceService, error) {
 				return ec2Svc, testCase.getSvcErr
 			},
+			getMetadata: func(steps.AWSConfig) (metadataService, error) {
+				return metadataSvc, nil
+			},
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -237,6 +391,35 @@ func TestStepCreateInstance_Run(t *testing.T) {
 			t.Errorf("Error message '%s' does not contain '%s'",
 				err.Error(), testCase.errMsg)
 		}
+
+		if testCase.hardening.MetadataTokensRequired {
+			require.Equal(t, "1234", metadataSvc.modified, testCase.description)
+			require.Equal(t, awssdk.MetadataTokensRequired, metadataSvc.opts.HTTPTokens, testCase.description)
+			require.Equal(t, int64(1), metadataSvc.opts.HopLimit, testCase.description)
+		} else {
+			require.Empty(t, metadataSvc.modified, testCase.description)
+		}
+		if testCase.runInstanceResp != nil {
+			in := ec2Svc.Calls[0].Arguments.Get(1).(*ec2.RunInstancesInput)
+			require.Equal(t, testCase.hardening.EncryptVolumes,
+				aws.BoolValue(in.BlockDeviceMappings[0].Ebs.Encrypted), testCase.description)
+			require.Equal(t, "gp2", aws.StringValue(in.BlockDeviceMappings[0].Ebs.VolumeType), testCase.description)
+			if testCase.isMaster {
+				require.Equal(t, "masters", aws.StringValue(in.Placement.GroupName), testCase.description)
+			} else {
+				require.Nil(t, in.Placement.GroupName, testCase.description)
+			}
+		}
+		if testCase.expectedVolumes != nil {
+			in := ec2Svc.Calls[0].Arguments.Get(1).(*ec2.RunInstancesInput)
+			require.Len(t, in.BlockDeviceMappings, 3, testCase.description)
+			require.Equal(t, "gp3", aws.StringValue(in.BlockDeviceMappings[1].Ebs.VolumeType), testCase.description)
+			require.Equal(t, int64(500), aws.Int64Value(in.BlockDeviceMappings[2].Ebs.VolumeSize), testCase.description)
+			require.Equal(t, "/dev/sdg", aws.StringValue(in.BlockDeviceMappings[2].DeviceName), testCase.description)
+		}
+		if testCase.errMsg == "" {
+			require.Equal(t, testCase.expectedVolumes, config.DataVolumesConfig.Volumes, testCase.description)
+		}
 	}
 }
 
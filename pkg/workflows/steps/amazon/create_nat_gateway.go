@@ -0,0 +1,250 @@
+package amazon
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateNATGatewayStepName = "aws_create_nat_gateway"
+
+type natSvc interface {
+	AllocateAddressWithContext(aws.Context, *ec2.AllocateAddressInput, ...request.Option) (*ec2.AllocateAddressOutput, error)
+	ReleaseAddressWithContext(aws.Context, *ec2.ReleaseAddressInput, ...request.Option) (*ec2.ReleaseAddressOutput, error)
+	DescribeSubnetsWithContext(aws.Context, *ec2.DescribeSubnetsInput, ...request.Option) (*ec2.DescribeSubnetsOutput, error)
+	CreateSubnetWithContext(aws.Context, *ec2.CreateSubnetInput, ...request.Option) (*ec2.CreateSubnetOutput, error)
+	DeleteSubnetWithContext(aws.Context, *ec2.DeleteSubnetInput, ...request.Option) (*ec2.DeleteSubnetOutput, error)
+	CreateRouteTableWithContext(aws.Context, *ec2.CreateRouteTableInput, ...request.Option) (*ec2.CreateRouteTableOutput, error)
+	DeleteRouteTableWithContext(aws.Context, *ec2.DeleteRouteTableInput, ...request.Option) (*ec2.DeleteRouteTableOutput, error)
+	AssociateRouteTableWithContext(aws.Context, *ec2.AssociateRouteTableInput, ...request.Option) (*ec2.AssociateRouteTableOutput, error)
+	CreateRouteWithContext(aws.Context, *ec2.CreateRouteInput, ...request.Option) (*ec2.CreateRouteOutput, error)
+	CreateNatGatewayWithContext(aws.Context, *ec2.CreateNatGatewayInput, ...request.Option) (*ec2.CreateNatGatewayOutput, error)
+	WaitUntilNatGatewayAvailableWithContext(aws.Context, *ec2.DescribeNatGatewaysInput, ...request.WaiterOption) error
+	DescribeNatGatewaysWithContext(aws.Context, *ec2.DescribeNatGatewaysInput, ...request.Option) (*ec2.DescribeNatGatewaysOutput, error)
+	DeleteNatGatewayWithContext(aws.Context, *ec2.DeleteNatGatewayInput, ...request.Option) (*ec2.DeleteNatGatewayOutput, error)
+}
+
+// CreateNATGateway gives the cluster a stable egress address. The gateway lives
+// in its own subnet that is routed to the internet gateway, route table of
+// the cluster sends traffic to egress destinations through the gateway.
+type CreateNATGateway struct {
+	getSvc func(steps.AWSConfig) (natSvc, error)
+}
+
+func InitCreateNATGateway(fn GetEC2Fn) {
+	steps.RegisterStep(CreateNATGatewayStepName, NewCreateNATGateway(fn))
+}
+
+func NewCreateNATGateway(fn GetEC2Fn) *CreateNATGateway {
+	return &CreateNATGateway{
+		getSvc: natSvcFn(fn),
+	}
+}
+
+func natSvcFn(fn GetEC2Fn) func(steps.AWSConfig) (natSvc, error) {
+	return func(cfg steps.AWSConfig) (natSvc, error) {
+		EC2, err := fn(cfg)
+		if err != nil {
+			return nil, errors.Wrap(ErrAuthorization, err.Error())
+		}
+
+		return EC2, nil
+	}
+}
+
+func (s *CreateNATGateway) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	if !cfg.EgressConfig.Enabled {
+		return nil
+	}
+	if len(cfg.EgressConfig.Destinations) == 0 {
+		return errors.Errorf("%s: egress destinations are not set", CreateNATGatewayStepName)
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, CreateNATGatewayStepName)
+	}
+
+	if cfg.AWSConfig.EgressAllocationID == "" {
+		addr, err := svc.AllocateAddressWithContext(ctx, &ec2.AllocateAddressInput{
+			Domain: aws.String(ec2.DomainTypeVpc),
+		})
+		if err != nil {
+			return errors.Wrap(err, "allocate egress address")
+		}
+		cfg.AWSConfig.EgressAllocationID = aws.StringValue(addr.AllocationId)
+		cfg.EgressConfig.IPs = []string{aws.StringValue(addr.PublicIp)}
+		log.Infof("[%s] - allocated egress address %s", s.Name(), aws.StringValue(addr.PublicIp))
+	}
+
+	if cfg.AWSConfig.NATSubnetID == "" {
+		if err = s.createSubnet(ctx, svc, cfg); err != nil {
+			return errors.Wrap(err, CreateNATGatewayStepName)
+		}
+	}
+
+	if cfg.AWSConfig.NATGatewayID == "" {
+		out, err := svc.CreateNatGatewayWithContext(ctx, &ec2.CreateNatGatewayInput{
+			AllocationId: aws.String(cfg.AWSConfig.EgressAllocationID),
+			SubnetId:     aws.String(cfg.AWSConfig.NATSubnetID),
+		})
+		if err != nil {
+			return errors.Wrap(err, "create nat gateway")
+		}
+		cfg.AWSConfig.NATGatewayID = aws.StringValue(out.NatGateway.NatGatewayId)
+	}
+
+	log.Infof("[%s] - wait for nat gateway %s", s.Name(), cfg.AWSConfig.NATGatewayID)
+	err = svc.WaitUntilNatGatewayAvailableWithContext(ctx, &ec2.DescribeNatGatewaysInput{
+		NatGatewayIds: []*string{aws.String(cfg.AWSConfig.NATGatewayID)},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "wait for nat gateway %s", cfg.AWSConfig.NATGatewayID)
+	}
+
+	for _, dst := range cfg.EgressConfig.Destinations {
+		log.Infof("[%s] - route %s through %s", s.Name(), dst, cfg.AWSConfig.NATGatewayID)
+		_, err = svc.CreateRouteWithContext(ctx, &ec2.CreateRouteInput{
+			RouteTableId:         aws.String(cfg.AWSConfig.RouteTableID),
+			DestinationCidrBlock: aws.String(dst),
+			NatGatewayId:         aws.String(cfg.AWSConfig.NATGatewayID),
+		})
+		if err != nil && !hasCode(err, "RouteAlreadyExists") {
+			return errors.Wrapf(err, "create route to %s", dst)
+		}
+	}
+
+	return nil
+}
+
+// createSubnet creates a subnet of the gateway with a route table that sends
+// its traffic to the internet gateway, the route table of the cluster can't
+// be used since it routes egress destinations back to the gateway.
+func (s *CreateNATGateway) createSubnet(ctx context.Context, svc natSvc, cfg *steps.Config) error {
+	subnetCIDR, err := freeSubnet(ctx, svc, cfg.AWSConfig)
+	if err != nil {
+		return err
+	}
+
+	subnet, err := svc.CreateSubnetWithContext(ctx, &ec2.CreateSubnetInput{
+		VpcId:            aws.String(cfg.AWSConfig.VPCID),
+		AvailabilityZone: aws.String(natZone(cfg.AWSConfig)),
+		CidrBlock:        aws.String(subnetCIDR),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "create subnet %s", subnetCIDR)
+	}
+	cfg.AWSConfig.NATSubnetID = aws.StringValue(subnet.Subnet.SubnetId)
+
+	table, err := svc.CreateRouteTableWithContext(ctx, &ec2.CreateRouteTableInput{
+		VpcId: aws.String(cfg.AWSConfig.VPCID),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create route table")
+	}
+	cfg.AWSConfig.NATRouteTableID = aws.StringValue(table.RouteTable.RouteTableId)
+
+	_, err = svc.CreateRouteWithContext(ctx, &ec2.CreateRouteInput{
+		RouteTableId:         aws.String(cfg.AWSConfig.NATRouteTableID),
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		GatewayId:            aws.String(cfg.AWSConfig.InternetGatewayID),
+	})
+	if err != nil {
+		return errors.Wrap(err, "route nat subnet to internet gateway")
+	}
+
+	_, err = svc.AssociateRouteTableWithContext(ctx, &ec2.AssociateRouteTableInput{
+		RouteTableId: aws.String(cfg.AWSConfig.NATRouteTableID),
+		SubnetId:     aws.String(cfg.AWSConfig.NATSubnetID),
+	})
+	return errors.Wrap(err, "associate route table of nat subnet")
+}
+
+// freeSubnet finds a range of the vpc that is not taken by subnets of the cluster.
+func freeSubnet(ctx context.Context, svc natSvc, cfg steps.AWSConfig) (string, error) {
+	_, vpcNet, err := net.ParseCIDR(cfg.VPCCIDR)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse vpc cidr %s", cfg.VPCCIDR)
+	}
+
+	out, err := svc.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(cfg.VPCID)},
+			},
+		},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "describe subnets of %s", cfg.VPCID)
+	}
+
+	used := make([]*net.IPNet, 0, len(out.Subnets))
+	for _, subnet := range out.Subnets {
+		if _, n, err := net.ParseCIDR(aws.StringValue(subnet.CidrBlock)); err == nil {
+			used = append(used, n)
+		}
+	}
+
+	// subnets of machines are picked at random, the last ranges are tried first
+	for i := 255; i >= 0; i-- {
+		candidate, err := cidr.Subnet(vpcNet, 8, i)
+		if err != nil {
+			return "", errors.Wrapf(err, "split vpc cidr %s", cfg.VPCCIDR)
+		}
+
+		free := true
+		for _, n := range used {
+			if n.Contains(candidate.IP) || candidate.Contains(n.IP) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate.String(), nil
+		}
+	}
+
+	return "", errors.Errorf("no free range in vpc %s", cfg.VPCCIDR)
+}
+
+func natZone(cfg steps.AWSConfig) string {
+	if _, ok := cfg.Subnets[cfg.AvailabilityZone]; ok || len(cfg.Subnets) == 0 {
+		return cfg.AvailabilityZone
+	}
+
+	zones := make([]string, 0, len(cfg.Subnets))
+	for zone := range cfg.Subnets {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	return zones[0]
+}
+
+func (*CreateNATGateway) Name() string {
+	return CreateNATGatewayStepName
+}
+
+func (*CreateNATGateway) Depends() []string {
+	return []string{StepCreateInternetGateway, StepCreateRouteTable}
+}
+
+func (*CreateNATGateway) Description() string {
+	return "Create nat gateway with a stable egress address"
+}
+
+func (*CreateNATGateway) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,213 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type mockNATSvc struct {
+	mock.Mock
+}
+
+func (m *mockNATSvc) AllocateAddressWithContext(ctx aws.Context, in *ec2.AllocateAddressInput, opts ...request.Option) (*ec2.AllocateAddressOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.AllocateAddressOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) ReleaseAddressWithContext(ctx aws.Context, in *ec2.ReleaseAddressInput, opts ...request.Option) (*ec2.ReleaseAddressOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.ReleaseAddressOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) DescribeSubnetsWithContext(ctx aws.Context, in *ec2.DescribeSubnetsInput, opts ...request.Option) (*ec2.DescribeSubnetsOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DescribeSubnetsOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) CreateSubnetWithContext(ctx aws.Context, in *ec2.CreateSubnetInput, opts ...request.Option) (*ec2.CreateSubnetOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateSubnetOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) DeleteSubnetWithContext(ctx aws.Context, in *ec2.DeleteSubnetInput, opts ...request.Option) (*ec2.DeleteSubnetOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteSubnetOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) CreateRouteTableWithContext(ctx aws.Context, in *ec2.CreateRouteTableInput, opts ...request.Option) (*ec2.CreateRouteTableOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateRouteTableOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) DeleteRouteTableWithContext(ctx aws.Context, in *ec2.DeleteRouteTableInput, opts ...request.Option) (*ec2.DeleteRouteTableOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteRouteTableOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) AssociateRouteTableWithContext(ctx aws.Context, in *ec2.AssociateRouteTableInput, opts ...request.Option) (*ec2.AssociateRouteTableOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.AssociateRouteTableOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) CreateRouteWithContext(ctx aws.Context, in *ec2.CreateRouteInput, opts ...request.Option) (*ec2.CreateRouteOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateRouteOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) CreateNatGatewayWithContext(ctx aws.Context, in *ec2.CreateNatGatewayInput, opts ...request.Option) (*ec2.CreateNatGatewayOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateNatGatewayOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) WaitUntilNatGatewayAvailableWithContext(ctx aws.Context, in *ec2.DescribeNatGatewaysInput, opts ...request.WaiterOption) error {
+	args := m.Called(ctx, in)
+	return args.Error(0)
+}
+
+func (m *mockNATSvc) DescribeNatGatewaysWithContext(ctx aws.Context, in *ec2.DescribeNatGatewaysInput, opts ...request.Option) (*ec2.DescribeNatGatewaysOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DescribeNatGatewaysOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockNATSvc) DeleteNatGatewayWithContext(ctx aws.Context, in *ec2.DeleteNatGatewayInput, opts ...request.Option) (*ec2.DeleteNatGatewayOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteNatGatewayOutput)
+	return val, args.Error(1)
+}
+
+func natConfig(enabled bool, destinations ...string) *steps.Config {
+	return &steps.Config{
+		AWSConfig: steps.AWSConfig{
+			VPCID:             "vpc-1",
+			VPCCIDR:           "10.2.0.0/16",
+			AvailabilityZone:  "us-east-1b",
+			RouteTableID:      "rtb-cluster",
+			InternetGatewayID: "igw-1",
+			Subnets:           map[string]string{"us-east-1a": "subnet-a"},
+		},
+		EgressConfig: steps.EgressConfig{
+			Enabled:      enabled,
+			Destinations: destinations,
+		},
+	}
+}
+
+func TestCreateNATGateway_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		cfg          *steps.Config
+		allocateErr  error
+		routeErr     error
+		hasErr       bool
+		allocations  int
+		routes       int
+		expectedCIDR string
+	}{
+		{
+			name: "disabled",
+			cfg:  natConfig(false),
+		},
+		{
+			name:   "no destinations",
+			cfg:    natConfig(true),
+			hasErr: true,
+		},
+		{
+			name:        "allocate error",
+			cfg:         natConfig(true, "203.0.113.0/24"),
+			allocateErr: errors.New("limit"),
+			hasErr:      true,
+			allocations: 1,
+		},
+		{
+			name:         "existing route",
+			cfg:          natConfig(true, "203.0.113.0/24"),
+			routeErr:     awserr.New("RouteAlreadyExists", "", nil),
+			allocations:  1,
+			routes:       2,
+			expectedCIDR: "10.2.254.0/24",
+		},
+		{
+			name:         "created",
+			cfg:          natConfig(true, "203.0.113.0/24", "198.51.100.7/32"),
+			allocations:  1,
+			routes:       3,
+			expectedCIDR: "10.2.254.0/24",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockNATSvc{}
+			svc.On("AllocateAddressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AllocateAddressOutput{
+					AllocationId: aws.String("eipalloc-1"),
+					PublicIp:     aws.String("1.2.3.4"),
+				}, tc.allocateErr)
+			svc.On("DescribeSubnetsWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DescribeSubnetsOutput{
+					Subnets: []*ec2.Subnet{{CidrBlock: aws.String("10.2.255.0/24")}},
+				}, nil)
+			svc.On("CreateSubnetWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateSubnetOutput{Subnet: &ec2.Subnet{SubnetId: aws.String("subnet-nat")}}, nil)
+			svc.On("CreateRouteTableWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateRouteTableOutput{RouteTable: &ec2.RouteTable{RouteTableId: aws.String("rtb-nat")}}, nil)
+			svc.On("AssociateRouteTableWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AssociateRouteTableOutput{}, nil)
+			svc.On("CreateRouteWithContext", mock.Anything, mock.MatchedBy(func(in *ec2.CreateRouteInput) bool {
+				return in.NatGatewayId == nil
+			})).Return(&ec2.CreateRouteOutput{}, nil)
+			svc.On("CreateRouteWithContext", mock.Anything, mock.MatchedBy(func(in *ec2.CreateRouteInput) bool {
+				return in.NatGatewayId != nil
+			})).Return(&ec2.CreateRouteOutput{}, tc.routeErr)
+			svc.On("CreateNatGatewayWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateNatGatewayOutput{NatGateway: &ec2.NatGateway{NatGatewayId: aws.String("nat-1")}}, nil)
+			svc.On("WaitUntilNatGatewayAvailableWithContext", mock.Anything, mock.Anything).
+				Return(nil)
+
+			step := &CreateNATGateway{
+				getSvc: func(steps.AWSConfig) (natSvc, error) {
+					return svc, nil
+				},
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, tc.cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "AllocateAddressWithContext", tc.allocations)
+			svc.AssertNumberOfCalls(t, "CreateRouteWithContext", tc.routes)
+			if tc.expectedCIDR == "" {
+				return
+			}
+
+			svc.AssertCalled(t, "CreateSubnetWithContext", mock.Anything, &ec2.CreateSubnetInput{
+				VpcId:            aws.String("vpc-1"),
+				AvailabilityZone: aws.String("us-east-1a"),
+				CidrBlock:        aws.String(tc.expectedCIDR),
+			})
+			require.Equal(t, []string{"1.2.3.4"}, tc.cfg.EgressConfig.IPs)
+			require.Equal(t, "nat-1", tc.cfg.AWSConfig.NATGatewayID)
+			require.Equal(t, "rtb-nat", tc.cfg.AWSConfig.NATRouteTableID)
+		})
+	}
+}
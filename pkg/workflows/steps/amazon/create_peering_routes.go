@@ -0,0 +1,109 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreatePeeringRoutesStepName = "aws_create_peering_routes"
+
+// CreatePeeringRoutes routes traffic of both vpcs through the peering connection
+// and lets machines of each cluster accept traffic from the other vpc.
+type CreatePeeringRoutes struct {
+	getSvc func(steps.AWSConfig) (peeringSvc, error)
+}
+
+func InitCreatePeeringRoutes(fn GetEC2Fn) {
+	steps.RegisterStep(CreatePeeringRoutesStepName, NewCreatePeeringRoutes(fn))
+}
+
+func NewCreatePeeringRoutes(fn GetEC2Fn) *CreatePeeringRoutes {
+	return &CreatePeeringRoutes{
+		getSvc: peeringSvcFn(fn),
+	}
+}
+
+func (s *CreatePeeringRoutes) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	if cfg.PeeringConfig.ConnectionID == "" {
+		return errors.Wrap(ErrPeering, "peering connection has not been created")
+	}
+
+	sides := []struct {
+		network steps.AWSConfig
+		peer    steps.AWSConfig
+	}{
+		{cfg.AWSConfig, cfg.PeeringConfig.AWSConfig},
+		{cfg.PeeringConfig.AWSConfig, cfg.AWSConfig},
+	}
+	for _, side := range sides {
+		svc, err := s.getSvc(side.network)
+		if err != nil {
+			return errors.Wrap(err, CreatePeeringRoutesStepName)
+		}
+
+		log.Infof("[%s] - route %s from %s through %s", s.Name(), side.peer.VPCCIDR,
+			side.network.RouteTableID, cfg.PeeringConfig.ConnectionID)
+		_, err = svc.CreateRouteWithContext(ctx, &ec2.CreateRouteInput{
+			RouteTableId:           aws.String(side.network.RouteTableID),
+			DestinationCidrBlock:   aws.String(side.peer.VPCCIDR),
+			VpcPeeringConnectionId: aws.String(cfg.PeeringConfig.ConnectionID),
+		})
+		if err != nil && !hasCode(err, "RouteAlreadyExists") {
+			return errors.Wrapf(err, "create route in %s", side.network.RouteTableID)
+		}
+
+		for _, groupID := range []string{side.network.MastersSecurityGroupID, side.network.NodesSecurityGroupID} {
+			if groupID == "" {
+				continue
+			}
+			_, err = svc.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: peerPermissions(side.peer.VPCCIDR),
+			})
+			if err != nil && !hasCode(err, "InvalidPermission.Duplicate") {
+				return errors.Wrapf(err, "authorize ingress to %s", groupID)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (*CreatePeeringRoutes) Name() string {
+	return CreatePeeringRoutesStepName
+}
+
+func (*CreatePeeringRoutes) Depends() []string {
+	return []string{CreateVPCPeeringStepName}
+}
+
+func (*CreatePeeringRoutes) Description() string {
+	return "Create routes and security group rules of vpc peering"
+}
+
+func (*CreatePeeringRoutes) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// peerPermissions allow all traffic from the peer vpc.
+func peerPermissions(cidr string) []*ec2.IpPermission {
+	return []*ec2.IpPermission{
+		{
+			IpProtocol: aws.String("-1"),
+			IpRanges: []*ec2.IpRange{
+				{
+					CidrIp:      aws.String(cidr),
+					Description: aws.String("peered cluster"),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestCreatePeeringRoutes_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		connectionID string
+		routeErr     error
+		ingressErr   error
+
+		hasErr       bool
+		routes       int
+		ingressRules int
+	}{
+		{
+			name:   "no connection",
+			hasErr: true,
+		},
+		{
+			name:         "route error",
+			connectionID: "pcx-1",
+			routeErr:     errors.New("limit"),
+			hasErr:       true,
+			routes:       1,
+		},
+		{
+			name:         "existing route",
+			connectionID: "pcx-1",
+			routeErr:     awserr.New("RouteAlreadyExists", "", nil),
+			routes:       2,
+			ingressRules: 2,
+		},
+		{
+			name:         "duplicate rule",
+			connectionID: "pcx-1",
+			ingressErr:   awserr.New("InvalidPermission.Duplicate", "", nil),
+			routes:       2,
+			ingressRules: 2,
+		},
+		{
+			name:         "created",
+			connectionID: "pcx-1",
+			routes:       2,
+			ingressRules: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("CreateRouteWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateRouteOutput{}, tc.routeErr)
+			svc.On("AuthorizeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, tc.ingressErr)
+			step := &CreatePeeringRoutes{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, peeringConfig(tc.connectionID))
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "CreateRouteWithContext", tc.routes)
+			// only groups that are known are updated
+			svc.AssertNumberOfCalls(t, "AuthorizeSecurityGroupIngressWithContext", tc.ingressRules)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreatePlacementGroupStepName = "aws_create_placement_group"
+
+type placementGroupSvc interface {
+	CreatePlacementGroupWithContext(aws.Context, *ec2.CreatePlacementGroupInput, ...request.Option) (*ec2.CreatePlacementGroupOutput, error)
+	DeletePlacementGroupWithContext(aws.Context, *ec2.DeletePlacementGroupInput, ...request.Option) (*ec2.DeletePlacementGroupOutput, error)
+}
+
+// CreatePlacementGroup creates a spread placement group masters are launched in,
+// every instance of the group runs on a distinct rack.
+type CreatePlacementGroup struct {
+	getSvc func(steps.AWSConfig) (placementGroupSvc, error)
+}
+
+func InitCreatePlacementGroup(fn GetEC2Fn) {
+	steps.RegisterStep(CreatePlacementGroupStepName, NewCreatePlacementGroup(fn))
+}
+
+func NewCreatePlacementGroup(fn GetEC2Fn) *CreatePlacementGroup {
+	return &CreatePlacementGroup{
+		getSvc: placementGroupSvcFn(fn),
+	}
+}
+
+func placementGroupSvcFn(fn GetEC2Fn) func(steps.AWSConfig) (placementGroupSvc, error) {
+	return func(cfg steps.AWSConfig) (placementGroupSvc, error) {
+		EC2, err := fn(cfg)
+		if err != nil {
+			return nil, errors.Wrap(ErrAuthorization, err.Error())
+		}
+
+		return EC2, nil
+	}
+}
+
+// MastersPlacementGroupName is unique in the region, names of groups
+// are scoped to an account.
+func MastersPlacementGroupName(clusterID string) string {
+	return "sg-" + clusterID + "-masters"
+}
+
+func (s *CreatePlacementGroup) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	if !cfg.SpreadMasters || cfg.AWSConfig.MastersPlacementGroup != "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, CreatePlacementGroupStepName)
+	}
+
+	name := MastersPlacementGroupName(cfg.ClusterID)
+	log.Infof("[%s] - create spread placement group %s", s.Name(), name)
+	_, err = svc.CreatePlacementGroupWithContext(ctx, &ec2.CreatePlacementGroupInput{
+		GroupName: aws.String(name),
+		Strategy:  aws.String(ec2.PlacementStrategySpread),
+	})
+	if err != nil && !hasCode(err, "InvalidPlacementGroup.Duplicate") {
+		return errors.Wrapf(err, "create placement group %s", name)
+	}
+	cfg.AWSConfig.MastersPlacementGroup = name
+
+	return nil
+}
+
+func (*CreatePlacementGroup) Name() string {
+	return CreatePlacementGroupStepName
+}
+
+func (*CreatePlacementGroup) Depends() []string {
+	return nil
+}
+
+func (*CreatePlacementGroup) Description() string {
+	return "Create spread placement group of masters"
+}
+
+func (*CreatePlacementGroup) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type mockPlacementGroupSvc struct {
+	mock.Mock
+}
+
+func (m *mockPlacementGroupSvc) CreatePlacementGroupWithContext(ctx aws.Context, in *ec2.CreatePlacementGroupInput, opts ...request.Option) (*ec2.CreatePlacementGroupOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreatePlacementGroupOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPlacementGroupSvc) DeletePlacementGroupWithContext(ctx aws.Context, in *ec2.DeletePlacementGroupInput, opts ...request.Option) (*ec2.DeletePlacementGroupOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeletePlacementGroupOutput)
+	return val, args.Error(1)
+}
+
+func TestCreatePlacementGroup_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		spread    bool
+		existing  string
+		createErr error
+
+		expectedGroup string
+		hasErr        bool
+		creates       int
+	}{
+		{
+			name: "masters aren't spread",
+		},
+		{
+			name:          "group exists",
+			spread:        true,
+			existing:      "group",
+			expectedGroup: "group",
+		},
+		{
+			name:      "create error",
+			spread:    true,
+			createErr: errors.New("denied"),
+			hasErr:    true,
+			creates:   1,
+		},
+		{
+			name:          "duplicate",
+			spread:        true,
+			createErr:     awserr.New("InvalidPlacementGroup.Duplicate", "", nil),
+			expectedGroup: "sg-1234-masters",
+			creates:       1,
+		},
+		{
+			name:          "created",
+			spread:        true,
+			expectedGroup: "sg-1234-masters",
+			creates:       1,
+		},
+	} {
+		svc := &mockPlacementGroupSvc{}
+		svc.On("CreatePlacementGroupWithContext", mock.Anything, mock.Anything).
+			Return(&ec2.CreatePlacementGroupOutput{}, tc.createErr)
+
+		step := &CreatePlacementGroup{
+			getSvc: func(steps.AWSConfig) (placementGroupSvc, error) {
+				return svc, nil
+			},
+		}
+		cfg := &steps.Config{
+			ClusterID:     "1234",
+			SpreadMasters: tc.spread,
+			AWSConfig: steps.AWSConfig{
+				MastersPlacementGroup: tc.existing,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.expectedGroup, cfg.AWSConfig.MastersPlacementGroup, "TC: %s", tc.name)
+		svc.AssertNumberOfCalls(t, "CreatePlacementGroupWithContext", tc.creates)
+		if tc.creates > 0 {
+			in := svc.Calls[0].Arguments.Get(1).(*ec2.CreatePlacementGroupInput)
+			require.Equal(t, ec2.PlacementStrategySpread, aws.StringValue(in.Strategy), "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestInitCreatePlacementGroup(t *testing.T) {
+	InitCreatePlacementGroup(GetEC2)
+
+	require.NotNil(t, steps.GetStep(CreatePlacementGroupStepName))
+}
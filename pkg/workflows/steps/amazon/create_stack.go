@@ -0,0 +1,349 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/account"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateStackStepName = "aws_create_stack"
+
+var stackPollInterval = time.Second * 10
+
+// StackService creates and deletes cloudformation stacks.
+type StackService interface {
+	CreateStack(ctx context.Context, name, template string, tags map[string]string) (string, error)
+	DescribeStack(ctx context.Context, name string) (*awssdk.Stack, error)
+	DeleteStack(ctx context.Context, name string) error
+}
+
+type GetCloudFormationFn func(steps.AWSConfig) (StackService, error)
+
+func GetCloudFormation(cfg steps.AWSConfig) (StackService, error) {
+	cf, err := awssdk.NewCloudFormation(cfg.KeyID, cfg.Secret, "", cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// StackProvisioning tells whether networking of new clusters of the
+// account is created as a cloudformation stack instead of separate steps.
+func StackProvisioning(cfg steps.AWSConfig) bool {
+	return cfg.Provisioning == clouds.AWSProvisioningStack
+}
+
+// CreateStackStep creates vpc, internet gateway, subnets, route table and
+// security groups of the cluster as one cloudformation stack, so they are
+// created and deleted at once and can be inspected in the aws console.
+type CreateStackStep struct {
+	getSvc            GetCloudFormationFn
+	accountGetter     accountGetter
+	zoneGetterFactory func(context.Context, accountGetter, *steps.Config) (account.ZonesGetter, error)
+	findOutboundIP    func() (string, error)
+}
+
+func InitCreateStack(fn GetCloudFormationFn, accSvc *account.Service) {
+	steps.RegisterStep(CreateStackStepName, NewCreateStackStep(fn, accSvc))
+}
+
+func NewCreateStackStep(fn GetCloudFormationFn, getter accountGetter) *CreateStackStep {
+	return &CreateStackStep{
+		getSvc:            fn,
+		accountGetter:     getter,
+		zoneGetterFactory: newZonesGetter,
+		findOutboundIP:    findOutBoundIP,
+	}
+}
+
+func (s *CreateStackStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	if cfg.AWSConfig.VPCID != "" && cfg.AWSConfig.StackName == "" {
+		return errors.Wrapf(ErrCreateStack, "vpc %s: stack creates a vpc of the cluster",
+			cfg.AWSConfig.VPCID)
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(ErrAuthorization, err.Error())
+	}
+
+	zoneGetter, err := s.zoneGetterFactory(ctx, s.accountGetter, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "%s: get zones", CreateStackStepName)
+	}
+	zones, err := zoneGetter.GetZones(ctx, *cfg)
+	if err != nil {
+		return errors.Wrapf(err, "%s: get zones of region %s", CreateStackStepName, cfg.AWSConfig.Region)
+	}
+
+	supergiantIP, err := FindOutboundIP(ctx, s.findOutboundIP)
+	if err != nil {
+		return errors.Wrapf(err, "%s: find outbound ip", CreateStackStepName)
+	}
+
+	body, err := stackTemplate(cfg, zones, supergiantIP)
+	if err != nil {
+		return errors.Wrap(ErrCreateStack, err.Error())
+	}
+
+	name := stackName(cfg)
+	if cfg.AWSConfig.StackName == "" {
+		log.Infof("[%s] - create stack %s", s.Name(), name)
+		_, err = svc.CreateStack(ctx, name, body, map[string]string{
+			"KubernetesCluster": cfg.ClusterName,
+			clouds.ClusterIDTag: cfg.ClusterID,
+		})
+		if err != nil {
+			return errors.Wrap(ErrCreateStack, err.Error())
+		}
+		cfg.AWSConfig.StackName = name
+	}
+
+	log.Infof("[%s] - wait for stack %s", s.Name(), name)
+	stack, err := waitForStack(ctx, svc, name)
+	if errors.Cause(err) == awssdk.ErrStackNotFound {
+		// failed stacks are deleted with everything created
+		cfg.AWSConfig.StackName = ""
+		return errors.Wrapf(ErrCreateStack, "stack %s has been rolled back", name)
+	}
+	if err != nil {
+		return errors.Wrap(ErrCreateStack, err.Error())
+	}
+	if stack.Status != awssdk.StackCreateComplete {
+		return errors.Wrapf(ErrCreateStack, "stack %s is %s: %s", name, stack.Status, stack.Reason)
+	}
+
+	cfg.AWSConfig.VPCID = stack.Outputs["VPCID"]
+	cfg.AWSConfig.InternetGatewayID = stack.Outputs["InternetGatewayID"]
+	cfg.AWSConfig.RouteTableID = stack.Outputs["RouteTableID"]
+	cfg.AWSConfig.MastersSecurityGroupID = stack.Outputs["MastersSecurityGroupID"]
+	cfg.AWSConfig.NodesSecurityGroupID = stack.Outputs["NodesSecurityGroupID"]
+	cfg.AWSConfig.Subnets = make(map[string]string, len(zones))
+	for i, zone := range zones {
+		cfg.AWSConfig.Subnets[zone] = stack.Outputs[fmt.Sprintf("Subnet%d", i)]
+	}
+	log.Infof("[%s] - stack %s has been created with vpc %s", s.Name(), name, cfg.AWSConfig.VPCID)
+
+	return nil
+}
+
+func (*CreateStackStep) Name() string {
+	return CreateStackStepName
+}
+
+func (*CreateStackStep) Description() string {
+	return "Create networking of the cluster as a cloudformation stack"
+}
+
+func (*CreateStackStep) Depends() []string {
+	return nil
+}
+
+func (*CreateStackStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// waitForStack polls the stack until the current operation is finished.
+func waitForStack(ctx context.Context, svc StackService, name string) (*awssdk.Stack, error) {
+	for {
+		stack, err := svc.DescribeStack(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !stack.InProgress() {
+			return stack, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(stackPollInterval):
+		}
+	}
+}
+
+func stackName(cfg *steps.Config) string {
+	return fmt.Sprintf("sg-%s", cfg.ClusterID)
+}
+
+type stackResource struct {
+	Type       string                 `json:"Type"`
+	DependsOn  string                 `json:"DependsOn,omitempty"`
+	Properties map[string]interface{} `json:"Properties"`
+}
+
+type stackOutput struct {
+	Value interface{} `json:"Value"`
+}
+
+type stackBody struct {
+	Version     string                   `json:"AWSTemplateFormatVersion"`
+	Description string                   `json:"Description"`
+	Resources   map[string]stackResource `json:"Resources"`
+	Outputs     map[string]stackOutput   `json:"Outputs"`
+}
+
+func ref(name string) map[string]string {
+	return map[string]string{"Ref": name}
+}
+
+func nameTag(value string) []map[string]string {
+	return []map[string]string{{"Key": "Name", "Value": value}}
+}
+
+func ingress(protocol string, port int, cidrIP string) map[string]interface{} {
+	return map[string]interface{}{
+		"IpProtocol": protocol,
+		"FromPort":   port,
+		"ToPort":     port,
+		"CidrIp":     cidrIP,
+	}
+}
+
+// stackTemplate builds the same networking as the separate aws steps do:
+// a subnet per zone routed through the internet gateway, ssh open to all
+// machines, traffic allowed between masters and nodes, api reachable
+// from supergiant.
+func stackTemplate(cfg *steps.Config, zones []string, supergiantIP string) (string, error) {
+	_, vpcCIDR, err := net.ParseCIDR(cfg.AWSConfig.VPCCIDR)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse vpc cidr %s", cfg.AWSConfig.VPCCIDR)
+	}
+
+	t := stackBody{
+		Version:     "2010-09-09",
+		Description: fmt.Sprintf("Networking of kubernetes cluster %s", cfg.ClusterName),
+		Resources: map[string]stackResource{
+			"VPC": {
+				Type: "AWS::EC2::VPC",
+				Properties: map[string]interface{}{
+					"CidrBlock":          vpcCIDR.String(),
+					"EnableDnsSupport":   true,
+					"EnableDnsHostnames": true,
+					"Tags":               nameTag(fmt.Sprintf("vpc-%s", cfg.ClusterID)),
+				},
+			},
+			"InternetGateway": {
+				Type: "AWS::EC2::InternetGateway",
+				Properties: map[string]interface{}{
+					"Tags": nameTag(fmt.Sprintf("inet-gateway-%s", cfg.ClusterID)),
+				},
+			},
+			"GatewayAttachment": {
+				Type: "AWS::EC2::VPCGatewayAttachment",
+				Properties: map[string]interface{}{
+					"VpcId":             ref("VPC"),
+					"InternetGatewayId": ref("InternetGateway"),
+				},
+			},
+			"RouteTable": {
+				Type: "AWS::EC2::RouteTable",
+				Properties: map[string]interface{}{
+					"VpcId": ref("VPC"),
+					"Tags":  nameTag(fmt.Sprintf("route-table-%s", cfg.ClusterID)),
+				},
+			},
+			"DefaultRoute": {
+				Type:      "AWS::EC2::Route",
+				DependsOn: "GatewayAttachment",
+				Properties: map[string]interface{}{
+					"RouteTableId":         ref("RouteTable"),
+					"DestinationCidrBlock": "0.0.0.0/0",
+					"GatewayId":            ref("InternetGateway"),
+				},
+			},
+			"MastersSecurityGroup": {
+				Type: "AWS::EC2::SecurityGroup",
+				Properties: map[string]interface{}{
+					"GroupName":        fmt.Sprintf("%s-masters-secgroup", cfg.ClusterID),
+					"GroupDescription": "Security group for Kubernetes masters for cluster " + cfg.ClusterID,
+					"VpcId":            ref("VPC"),
+					"SecurityGroupIngress": []map[string]interface{}{
+						ingress("tcp", 22, "0.0.0.0/0"),
+						ingress("tcp", 443, supergiantIP+"/32"),
+						ingress("tcp", 8080, supergiantIP+"/32"),
+					},
+				},
+			},
+			"NodesSecurityGroup": {
+				Type: "AWS::EC2::SecurityGroup",
+				Properties: map[string]interface{}{
+					"GroupName":        fmt.Sprintf("%s-nodes-secgroup", cfg.ClusterID),
+					"GroupDescription": "Security group for Kubernetes nodes for cluster " + cfg.ClusterID,
+					"VpcId":            ref("VPC"),
+					"SecurityGroupIngress": []map[string]interface{}{
+						ingress("tcp", 22, "0.0.0.0/0"),
+					},
+				},
+			},
+		},
+		Outputs: map[string]stackOutput{
+			"VPCID":                  {Value: ref("VPC")},
+			"InternetGatewayID":      {Value: ref("InternetGateway")},
+			"RouteTableID":           {Value: ref("RouteTable")},
+			"MastersSecurityGroupID": {Value: ref("MastersSecurityGroup")},
+			"NodesSecurityGroupID":   {Value: ref("NodesSecurityGroup")},
+		},
+	}
+
+	// rules between groups are separate resources, groups can't refer
+	// to each other
+	for _, to := range []string{"Masters", "Nodes"} {
+		for _, from := range []string{"Masters", "Nodes"} {
+			t.Resources[to+"From"+from] = stackResource{
+				Type: "AWS::EC2::SecurityGroupIngress",
+				Properties: map[string]interface{}{
+					"GroupId":               ref(to + "SecurityGroup"),
+					"SourceSecurityGroupId": ref(from + "SecurityGroup"),
+					"IpProtocol":            "-1",
+				},
+			}
+		}
+	}
+
+	for i, zone := range zones {
+		subnetCIDR, err := cidr.Subnet(vpcCIDR, 8, i)
+		if err != nil {
+			return "", errors.Wrapf(err, "subnet cidr of zone %s", zone)
+		}
+
+		subnet := fmt.Sprintf("Subnet%d", i)
+		t.Resources[subnet] = stackResource{
+			Type: "AWS::EC2::Subnet",
+			Properties: map[string]interface{}{
+				"VpcId":            ref("VPC"),
+				"AvailabilityZone": zone,
+				"CidrBlock":        subnetCIDR.String(),
+				"Tags":             nameTag(fmt.Sprintf("subnet-%s-%s", cfg.ClusterID, zone)),
+			},
+		}
+		t.Resources[subnet+"RouteTableAssociation"] = stackResource{
+			Type: "AWS::EC2::SubnetRouteTableAssociation",
+			Properties: map[string]interface{}{
+				"SubnetId":     ref(subnet),
+				"RouteTableId": ref("RouteTable"),
+			},
+		}
+		t.Outputs[subnet] = stackOutput{Value: ref(subnet)}
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
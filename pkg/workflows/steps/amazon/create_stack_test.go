@@ -0,0 +1,177 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/account"
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeStackSvc struct {
+	createErr error
+	deleteErr error
+	// stacks are returned by consecutive describe calls
+	stacks      []*awssdk.Stack
+	describeErr error
+
+	created  string
+	template string
+	deleted  string
+}
+
+func (f *fakeStackSvc) CreateStack(ctx context.Context, name, template string, tags map[string]string) (string, error) {
+	f.created, f.template = name, template
+	return name, f.createErr
+}
+
+func (f *fakeStackSvc) DescribeStack(ctx context.Context, name string) (*awssdk.Stack, error) {
+	if len(f.stacks) == 0 {
+		return nil, f.describeErr
+	}
+	stack := f.stacks[0]
+	f.stacks = f.stacks[1:]
+	return stack, nil
+}
+
+func (f *fakeStackSvc) DeleteStack(ctx context.Context, name string) error {
+	f.deleted = name
+	return f.deleteErr
+}
+
+func TestStackTemplate(t *testing.T) {
+	cfg := &steps.Config{
+		ClusterID:   "1234",
+		ClusterName: "kube",
+		AWSConfig: steps.AWSConfig{
+			VPCCIDR: "10.2.0.0/16",
+		},
+	}
+
+	body, err := stackTemplate(cfg, []string{"us-east-1a", "us-east-1b"}, "1.1.1.1")
+	require.Nil(t, err)
+
+	tmpl := stackBody{}
+	require.Nil(t, json.Unmarshal([]byte(body), &tmpl))
+	require.Equal(t, "10.2.0.0/16", tmpl.Resources["VPC"].Properties["CidrBlock"])
+	require.Equal(t, "10.2.1.0/24", tmpl.Resources["Subnet1"].Properties["CidrBlock"])
+	require.Equal(t, "us-east-1b", tmpl.Resources["Subnet1"].Properties["AvailabilityZone"])
+	require.Contains(t, tmpl.Resources, "Subnet1RouteTableAssociation")
+	require.Contains(t, tmpl.Resources, "NodesFromMasters")
+	require.Equal(t, "1234-masters-secgroup", tmpl.Resources["MastersSecurityGroup"].Properties["GroupName"])
+	require.Contains(t, body, "1.1.1.1/32")
+	require.Contains(t, tmpl.Outputs, "Subnet0")
+	require.Contains(t, tmpl.Outputs, "NodesSecurityGroupID")
+
+	cfg.AWSConfig.VPCCIDR = "invalid"
+	_, err = stackTemplate(cfg, nil, "1.1.1.1")
+	require.NotNil(t, err)
+}
+
+func TestCreateStackStep_Run(t *testing.T) {
+	stackPollInterval = 0
+
+	complete := &awssdk.Stack{
+		Status: awssdk.StackCreateComplete,
+		Outputs: map[string]string{
+			"VPCID":                  "vpc-1",
+			"MastersSecurityGroupID": "sg-1",
+			"NodesSecurityGroupID":   "sg-2",
+			"Subnet0":                "subnet-1",
+		},
+	}
+
+	testCases := []struct {
+		description string
+		vpcID       string
+		getSvcErr   error
+		svc         *fakeStackSvc
+		stackName   string
+		errMsg      string
+	}{
+		{
+			description: "preexisting vpc",
+			vpcID:       "vpc-0",
+			svc:         &fakeStackSvc{},
+			errMsg:      "vpc-0",
+		},
+		{
+			description: "get service error",
+			getSvcErr:   errors.New("message1"),
+			svc:         &fakeStackSvc{},
+			errMsg:      "message1",
+		},
+		{
+			description: "create error",
+			svc:         &fakeStackSvc{createErr: errors.New("message2")},
+			errMsg:      "message2",
+		},
+		{
+			description: "rolled back",
+			svc: &fakeStackSvc{
+				stacks:      []*awssdk.Stack{{Status: "CREATE_IN_PROGRESS"}},
+				describeErr: awssdk.ErrStackNotFound,
+			},
+			errMsg: "rolled back",
+		},
+		{
+			description: "failed",
+			svc: &fakeStackSvc{
+				stacks: []*awssdk.Stack{{Status: "CREATE_FAILED", Reason: "message3"}},
+			},
+			stackName: "sg-1234",
+			errMsg:    "message3",
+		},
+		{
+			description: "success",
+			svc: &fakeStackSvc{
+				stacks: []*awssdk.Stack{{Status: "CREATE_IN_PROGRESS"}, complete},
+			},
+			stackName: "sg-1234",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		step := &CreateStackStep{
+			getSvc: func(steps.AWSConfig) (StackService, error) {
+				return testCase.svc, testCase.getSvcErr
+			},
+			zoneGetterFactory: func(context.Context, accountGetter, *steps.Config) (account.ZonesGetter, error) {
+				return &mockZoneGetter{zones: []string{"us-east-1a"}}, nil
+			},
+			findOutboundIP: func() (string, error) {
+				return "1.1.1.1", nil
+			},
+		}
+
+		cfg := &steps.Config{
+			ClusterID: "1234",
+			AWSConfig: steps.AWSConfig{
+				VPCID:   testCase.vpcID,
+				VPCCIDR: "10.2.0.0/16",
+			},
+		}
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, testCase.stackName, cfg.AWSConfig.StackName, testCase.description)
+
+		if testCase.errMsg != "" {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+			continue
+		}
+
+		require.Nil(t, err, testCase.description)
+		require.Equal(t, "sg-1234", testCase.svc.created)
+		require.Equal(t, "vpc-1", cfg.AWSConfig.VPCID)
+		require.Equal(t, "sg-2", cfg.AWSConfig.NodesSecurityGroupID)
+		require.Equal(t, map[string]string{"us-east-1a": "subnet-1"}, cfg.AWSConfig.Subnets)
+	}
+}
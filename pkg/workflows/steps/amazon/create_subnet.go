@@ -47,21 +47,23 @@ func NewCreateSubnetStep(fn GetEC2Fn, getter accountGetter) *CreateSubnetsStep {
 
 			return client, nil
 		},
-		zoneGetterFactory: func(ctx context.Context, accountGetter accountGetter,
-			cfg *steps.Config) (account.ZonesGetter, error) {
-			acc, err := accountGetter.Get(ctx, cfg.CloudAccountName)
-
-			if err != nil {
-				logrus.Errorf("Get cloud account %s caused error %v",
-					cfg.CloudAccountName, err)
-				return nil, errors.Wrapf(err, "Get cloud account")
-			}
+		zoneGetterFactory: newZonesGetter,
+	}
+}
 
-			zoneGetter, err := account.NewZonesGetter(acc, cfg)
+func newZonesGetter(ctx context.Context, accountGetter accountGetter,
+	cfg *steps.Config) (account.ZonesGetter, error) {
+	acc, err := accountGetter.Get(ctx, cfg.CloudAccountName)
 
-			return zoneGetter, err
-		},
+	if err != nil {
+		logrus.Errorf("Get cloud account %s caused error %v",
+			cfg.CloudAccountName, err)
+		return nil, errors.Wrapf(err, "Get cloud account")
 	}
+
+	zoneGetter, err := account.NewZonesGetter(acc, cfg)
+
+	return zoneGetter, err
 }
 
 func InitCreateSubnet(fn GetEC2Fn, accSvc *account.Service) {
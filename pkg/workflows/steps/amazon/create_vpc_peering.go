@@ -0,0 +1,170 @@
+package amazon
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateVPCPeeringStepName = "aws_create_vpc_peering"
+
+var ErrPeering = errors.New("aws: vpc peering")
+
+type peeringSvc interface {
+	CreateVpcPeeringConnectionWithContext(aws.Context, *ec2.CreateVpcPeeringConnectionInput, ...request.Option) (*ec2.CreateVpcPeeringConnectionOutput, error)
+	WaitUntilVpcPeeringConnectionExistsWithContext(aws.Context, *ec2.DescribeVpcPeeringConnectionsInput, ...request.WaiterOption) error
+	AcceptVpcPeeringConnectionWithContext(aws.Context, *ec2.AcceptVpcPeeringConnectionInput, ...request.Option) (*ec2.AcceptVpcPeeringConnectionOutput, error)
+	DeleteVpcPeeringConnectionWithContext(aws.Context, *ec2.DeleteVpcPeeringConnectionInput, ...request.Option) (*ec2.DeleteVpcPeeringConnectionOutput, error)
+	CreateTagsWithContext(aws.Context, *ec2.CreateTagsInput, ...request.Option) (*ec2.CreateTagsOutput, error)
+	CreateRouteWithContext(aws.Context, *ec2.CreateRouteInput, ...request.Option) (*ec2.CreateRouteOutput, error)
+	DeleteRouteWithContext(aws.Context, *ec2.DeleteRouteInput, ...request.Option) (*ec2.DeleteRouteOutput, error)
+	AuthorizeSecurityGroupIngressWithContext(aws.Context, *ec2.AuthorizeSecurityGroupIngressInput, ...request.Option) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupIngressWithContext(aws.Context, *ec2.RevokeSecurityGroupIngressInput, ...request.Option) (*ec2.RevokeSecurityGroupIngressOutput, error)
+}
+
+// CreateVPCPeering requests a peering connection from the vpc of the cluster
+// to the vpc of the peer cluster and accepts it with credentials of the peer.
+type CreateVPCPeering struct {
+	getSvc       func(steps.AWSConfig) (peeringSvc, error)
+	getAccountID GetAccountIDFn
+}
+
+func InitCreateVPCPeering(fn GetEC2Fn, accountFn GetAccountIDFn) {
+	steps.RegisterStep(CreateVPCPeeringStepName, NewCreateVPCPeering(fn, accountFn))
+}
+
+func NewCreateVPCPeering(fn GetEC2Fn, accountFn GetAccountIDFn) *CreateVPCPeering {
+	return &CreateVPCPeering{
+		getSvc:       peeringSvcFn(fn),
+		getAccountID: accountFn,
+	}
+}
+
+func peeringSvcFn(fn GetEC2Fn) func(steps.AWSConfig) (peeringSvc, error) {
+	return func(cfg steps.AWSConfig) (peeringSvc, error) {
+		EC2, err := fn(cfg)
+		if err != nil {
+			return nil, errors.Wrap(ErrAuthorization, err.Error())
+		}
+
+		return EC2, nil
+	}
+}
+
+func (s *CreateVPCPeering) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	peer := cfg.PeeringConfig.AWSConfig
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, CreateVPCPeeringStepName)
+	}
+	peerSvc, err := s.getSvc(peer)
+	if err != nil {
+		return errors.Wrap(err, CreateVPCPeeringStepName)
+	}
+
+	// connection is kept in the config, so a resumed task doesn't request another one
+	if cfg.PeeringConfig.ConnectionID == "" {
+		// clusters may belong to different aws accounts
+		peerOwner, err := s.getAccountID(ctx, peer)
+		if err != nil {
+			return errors.Wrap(ErrAuthorization, err.Error())
+		}
+
+		log.Infof("[%s] - request peering of vpc %s with %s", s.Name(), cfg.AWSConfig.VPCID, peer.VPCID)
+		out, err := svc.CreateVpcPeeringConnectionWithContext(ctx, &ec2.CreateVpcPeeringConnectionInput{
+			VpcId:       aws.String(cfg.AWSConfig.VPCID),
+			PeerVpcId:   aws.String(peer.VPCID),
+			PeerOwnerId: aws.String(peerOwner),
+			PeerRegion:  aws.String(peer.Region),
+		})
+		if err != nil {
+			return errors.Wrap(ErrPeering, err.Error())
+		}
+		cfg.PeeringConfig.ConnectionID = aws.StringValue(out.VpcPeeringConnection.VpcPeeringConnectionId)
+
+		_, err = svc.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+			Resources: aws.StringSlice([]string{cfg.PeeringConfig.ConnectionID}),
+			Tags: []*ec2.Tag{
+				{
+					Key:   aws.String(clouds.ClusterIDTag),
+					Value: aws.String(cfg.ClusterID),
+				},
+				{
+					Key:   aws.String("Name"),
+					Value: aws.String(fmt.Sprintf("peering-%s-%s", cfg.ClusterID, cfg.PeeringConfig.PeerClusterID)),
+				},
+			},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "tag peering connection %s", cfg.PeeringConfig.ConnectionID)
+		}
+	}
+
+	// the connection becomes visible in the peer region with a delay
+	describe := &ec2.DescribeVpcPeeringConnectionsInput{
+		VpcPeeringConnectionIds: aws.StringSlice([]string{cfg.PeeringConfig.ConnectionID}),
+	}
+	if err = peerSvc.WaitUntilVpcPeeringConnectionExistsWithContext(ctx, describe); err != nil {
+		return errors.Wrapf(err, "wait for peering connection %s", cfg.PeeringConfig.ConnectionID)
+	}
+
+	_, err = peerSvc.AcceptVpcPeeringConnectionWithContext(ctx, &ec2.AcceptVpcPeeringConnectionInput{
+		VpcPeeringConnectionId: aws.String(cfg.PeeringConfig.ConnectionID),
+	})
+	if err != nil {
+		return errors.Wrap(ErrPeering, err.Error())
+	}
+	log.Infof("[%s] - peering connection %s has been accepted", s.Name(), cfg.PeeringConfig.ConnectionID)
+
+	return nil
+}
+
+func (*CreateVPCPeering) Name() string {
+	return CreateVPCPeeringStepName
+}
+
+func (*CreateVPCPeering) Depends() []string {
+	return nil
+}
+
+func (*CreateVPCPeering) Description() string {
+	return "Create vpc peering connection"
+}
+
+func (s *CreateVPCPeering) Rollback(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	if cfg.PeeringConfig.ConnectionID == "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, CreateVPCPeeringStepName)
+	}
+
+	_, err = svc.DeleteVpcPeeringConnectionWithContext(ctx, &ec2.DeleteVpcPeeringConnectionInput{
+		VpcPeeringConnectionId: aws.String(cfg.PeeringConfig.ConnectionID),
+	})
+	if err != nil && !hasCode(err, "InvalidVpcPeeringConnectionID.NotFound") {
+		return err
+	}
+	cfg.PeeringConfig.ConnectionID = ""
+
+	return nil
+}
+
+func hasCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
@@ -0,0 +1,221 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type mockPeeringSvc struct {
+	mock.Mock
+}
+
+func (m *mockPeeringSvc) CreateVpcPeeringConnectionWithContext(ctx aws.Context, in *ec2.CreateVpcPeeringConnectionInput, opts ...request.Option) (*ec2.CreateVpcPeeringConnectionOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateVpcPeeringConnectionOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) WaitUntilVpcPeeringConnectionExistsWithContext(ctx aws.Context, in *ec2.DescribeVpcPeeringConnectionsInput, opts ...request.WaiterOption) error {
+	args := m.Called(ctx, in)
+	return args.Error(0)
+}
+
+func (m *mockPeeringSvc) AcceptVpcPeeringConnectionWithContext(ctx aws.Context, in *ec2.AcceptVpcPeeringConnectionInput, opts ...request.Option) (*ec2.AcceptVpcPeeringConnectionOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.AcceptVpcPeeringConnectionOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) DeleteVpcPeeringConnectionWithContext(ctx aws.Context, in *ec2.DeleteVpcPeeringConnectionInput, opts ...request.Option) (*ec2.DeleteVpcPeeringConnectionOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteVpcPeeringConnectionOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) CreateTagsWithContext(ctx aws.Context, in *ec2.CreateTagsInput, opts ...request.Option) (*ec2.CreateTagsOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateTagsOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) CreateRouteWithContext(ctx aws.Context, in *ec2.CreateRouteInput, opts ...request.Option) (*ec2.CreateRouteOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.CreateRouteOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) DeleteRouteWithContext(ctx aws.Context, in *ec2.DeleteRouteInput, opts ...request.Option) (*ec2.DeleteRouteOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteRouteOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) AuthorizeSecurityGroupIngressWithContext(ctx aws.Context, in *ec2.AuthorizeSecurityGroupIngressInput, opts ...request.Option) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.AuthorizeSecurityGroupIngressOutput)
+	return val, args.Error(1)
+}
+
+func (m *mockPeeringSvc) RevokeSecurityGroupIngressWithContext(ctx aws.Context, in *ec2.RevokeSecurityGroupIngressInput, opts ...request.Option) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.RevokeSecurityGroupIngressOutput)
+	return val, args.Error(1)
+}
+
+func peeringConfig(connectionID string) *steps.Config {
+	return &steps.Config{
+		ClusterID: "a",
+		AWSConfig: steps.AWSConfig{
+			Region:                 "us-east-1",
+			VPCID:                  "vpc-a",
+			VPCCIDR:                "10.1.0.0/16",
+			RouteTableID:           "rtb-a",
+			MastersSecurityGroupID: "sg-am",
+			NodesSecurityGroupID:   "sg-an",
+		},
+		PeeringConfig: steps.PeeringConfig{
+			PeerClusterID: "b",
+			ConnectionID:  connectionID,
+			AWSConfig: steps.AWSConfig{
+				Region:       "us-west-2",
+				VPCID:        "vpc-b",
+				VPCCIDR:      "10.2.0.0/16",
+				RouteTableID: "rtb-b",
+			},
+		},
+	}
+}
+
+func TestCreateVPCPeering_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		connectionID string
+		accountErr   error
+		createErr    error
+		acceptErr    error
+
+		expectedErr  error
+		expectedConn string
+	}{
+		{
+			name:        "account error",
+			accountErr:  errors.New("denied"),
+			expectedErr: ErrAuthorization,
+		},
+		{
+			name:        "create error",
+			createErr:   errors.New("limit"),
+			expectedErr: ErrPeering,
+		},
+		{
+			name:         "accept error",
+			acceptErr:    errors.New("expired"),
+			expectedErr:  ErrPeering,
+			expectedConn: "pcx-1",
+		},
+		{
+			name:         "created",
+			expectedConn: "pcx-1",
+		},
+		{
+			name:         "resumed",
+			connectionID: "pcx-0",
+			expectedConn: "pcx-0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("CreateVpcPeeringConnectionWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateVpcPeeringConnectionOutput{
+					VpcPeeringConnection: &ec2.VpcPeeringConnection{
+						VpcPeeringConnectionId: aws.String("pcx-1"),
+					},
+				}, tc.createErr)
+			svc.On("CreateTagsWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.CreateTagsOutput{}, nil)
+			svc.On("WaitUntilVpcPeeringConnectionExistsWithContext", mock.Anything, mock.Anything).
+				Return(nil)
+			svc.On("AcceptVpcPeeringConnectionWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AcceptVpcPeeringConnectionOutput{}, tc.acceptErr)
+
+			var owner string
+			step := &CreateVPCPeering{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+				getAccountID: func(_ context.Context, cfg steps.AWSConfig) (string, error) {
+					owner = cfg.VPCID
+					return "123", tc.accountErr
+				},
+			}
+
+			cfg := peeringConfig(tc.connectionID)
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.expectedErr, errors.Cause(err))
+			require.Equal(t, tc.expectedConn, cfg.PeeringConfig.ConnectionID)
+			if tc.connectionID != "" {
+				svc.AssertNotCalled(t, "CreateVpcPeeringConnectionWithContext", mock.Anything, mock.Anything)
+			} else {
+				require.Equal(t, "vpc-b", owner, "owner must be taken from the peer account")
+			}
+		})
+	}
+}
+
+func TestCreateVPCPeering_Rollback(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		deleteErr error
+		hasErr    bool
+	}{
+		{
+			name: "deleted",
+		},
+		{
+			name:      "not found",
+			deleteErr: awserr.New("InvalidVpcPeeringConnectionID.NotFound", "", nil),
+		},
+		{
+			name:      "error",
+			deleteErr: errors.New("throttled"),
+			hasErr:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("DeleteVpcPeeringConnectionWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteVpcPeeringConnectionOutput{}, tc.deleteErr)
+			step := &CreateVPCPeering{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+			}
+
+			cfg := peeringConfig("pcx-1")
+			err := step.Rollback(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			if !tc.hasErr {
+				require.Empty(t, cfg.PeeringConfig.ConnectionID)
+			}
+		})
+	}
+}
+
+func TestInitCreateVPCPeering(t *testing.T) {
+	InitCreateVPCPeering(GetEC2, GetAccountID)
+
+	require.NotNil(t, steps.GetStep(CreateVPCPeeringStepName))
+}
@@ -0,0 +1,145 @@
+package amazon
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeleteNATGatewayStepName = "aws_delete_nat_gateway"
+
+var (
+	natGatewayPollInterval = time.Second * 10
+	natGatewayAttemptCount = 30
+)
+
+// DeleteNATGateway removes the nat gateway, its subnet and releases the egress
+// address, routes of the cluster go away with its route table.
+type DeleteNATGateway struct {
+	getSvc func(steps.AWSConfig) (natSvc, error)
+}
+
+func InitDeleteNATGateway(fn GetEC2Fn) {
+	steps.RegisterStep(DeleteNATGatewayStepName, NewDeleteNATGateway(fn))
+}
+
+func NewDeleteNATGateway(fn GetEC2Fn) *DeleteNATGateway {
+	return &DeleteNATGateway{
+		getSvc: natSvcFn(fn),
+	}
+}
+
+func (s *DeleteNATGateway) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	nat := cfg.AWSConfig
+	if nat.NATGatewayID == "" && nat.NATSubnetID == "" &&
+		nat.NATRouteTableID == "" && nat.EgressAllocationID == "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, DeleteNATGatewayStepName)
+	}
+
+	if nat.NATGatewayID != "" {
+		log.Infof("[%s] - delete nat gateway %s", s.Name(), nat.NATGatewayID)
+		if err = deleteNATGateway(ctx, svc, nat.NATGatewayID); err != nil {
+			return errors.Wrap(err, DeleteNATGatewayStepName)
+		}
+		cfg.AWSConfig.NATGatewayID = ""
+	}
+
+	// the association of the route table is removed with the subnet
+	if nat.NATSubnetID != "" {
+		_, err = svc.DeleteSubnetWithContext(ctx, &ec2.DeleteSubnetInput{
+			SubnetId: aws.String(nat.NATSubnetID),
+		})
+		if err != nil && !hasCode(err, "InvalidSubnetID.NotFound") {
+			return errors.Wrapf(err, "%s delete subnet %s", DeleteNATGatewayStepName, nat.NATSubnetID)
+		}
+		cfg.AWSConfig.NATSubnetID = ""
+	}
+
+	if nat.NATRouteTableID != "" {
+		_, err = svc.DeleteRouteTableWithContext(ctx, &ec2.DeleteRouteTableInput{
+			RouteTableId: aws.String(nat.NATRouteTableID),
+		})
+		if err != nil && !hasCode(err, "InvalidRouteTableID.NotFound") {
+			return errors.Wrapf(err, "%s delete route table %s", DeleteNATGatewayStepName, nat.NATRouteTableID)
+		}
+		cfg.AWSConfig.NATRouteTableID = ""
+	}
+
+	if nat.EgressAllocationID != "" {
+		log.Infof("[%s] - release egress address %v", s.Name(), cfg.EgressConfig.IPs)
+		_, err = svc.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{
+			AllocationId: aws.String(nat.EgressAllocationID),
+		})
+		if err != nil && !hasCode(err, "InvalidAllocationID.NotFound") {
+			return errors.Wrapf(err, "%s release address %s", DeleteNATGatewayStepName, nat.EgressAllocationID)
+		}
+		cfg.AWSConfig.EgressAllocationID = ""
+		cfg.EgressConfig.IPs = nil
+	}
+
+	return nil
+}
+
+// deleteNATGateway waits until the gateway is gone, its network
+// interface keeps the subnet and the address busy until then.
+func deleteNATGateway(ctx context.Context, svc natSvc, id string) error {
+	_, err := svc.DeleteNatGatewayWithContext(ctx, &ec2.DeleteNatGatewayInput{
+		NatGatewayId: aws.String(id),
+	})
+	if err != nil {
+		if hasCode(err, "NatGatewayNotFound") {
+			return nil
+		}
+		return errors.Wrapf(err, "delete nat gateway %s", id)
+	}
+
+	for i := 0; i < natGatewayAttemptCount; i++ {
+		out, err := svc.DescribeNatGatewaysWithContext(ctx, &ec2.DescribeNatGatewaysInput{
+			NatGatewayIds: []*string{aws.String(id)},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "describe nat gateway %s", id)
+		}
+		if len(out.NatGateways) == 0 ||
+			aws.StringValue(out.NatGateways[0].State) == ec2.NatGatewayStateDeleted {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(natGatewayPollInterval):
+		}
+	}
+
+	return errors.Errorf("nat gateway %s has not been deleted", id)
+}
+
+func (*DeleteNATGateway) Name() string {
+	return DeleteNATGatewayStepName
+}
+
+func (*DeleteNATGateway) Depends() []string {
+	return nil
+}
+
+func (*DeleteNATGateway) Description() string {
+	return "Delete nat gateway and release egress address"
+}
+
+func (*DeleteNATGateway) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
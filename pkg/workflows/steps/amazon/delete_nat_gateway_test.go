@@ -0,0 +1,105 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestDeleteNATGateway_Run(t *testing.T) {
+	natGatewayPollInterval = time.Nanosecond
+	natGatewayAttemptCount = 2
+
+	for _, tc := range []struct {
+		name      string
+		gatewayID string
+		deleteErr error
+		state     string
+		hasErr    bool
+		describes int
+		releases  int
+	}{
+		{
+			name: "nothing to delete",
+		},
+		{
+			name:      "delete error",
+			gatewayID: "nat-1",
+			deleteErr: errors.New("denied"),
+			hasErr:    true,
+		},
+		{
+			name:      "not deleted in time",
+			gatewayID: "nat-1",
+			state:     ec2.NatGatewayStateDeleting,
+			hasErr:    true,
+			describes: 2,
+		},
+		{
+			name:      "missing gateway",
+			gatewayID: "nat-1",
+			deleteErr: awserr.New("NatGatewayNotFound", "", nil),
+			releases:  1,
+		},
+		{
+			name:      "deleted",
+			gatewayID: "nat-1",
+			state:     ec2.NatGatewayStateDeleted,
+			describes: 1,
+			releases:  1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockNATSvc{}
+			svc.On("DeleteNatGatewayWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteNatGatewayOutput{}, tc.deleteErr)
+			svc.On("DescribeNatGatewaysWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DescribeNatGatewaysOutput{
+					NatGateways: []*ec2.NatGateway{{State: aws.String(tc.state)}},
+				}, nil)
+			svc.On("DeleteSubnetWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteSubnetOutput{}, nil)
+			svc.On("DeleteRouteTableWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteRouteTableOutput{}, nil)
+			svc.On("ReleaseAddressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.ReleaseAddressOutput{}, nil)
+
+			step := &DeleteNATGateway{
+				getSvc: func(steps.AWSConfig) (natSvc, error) {
+					return svc, nil
+				},
+			}
+
+			cfg := &steps.Config{}
+			if tc.gatewayID != "" {
+				cfg.AWSConfig = steps.AWSConfig{
+					NATGatewayID:       tc.gatewayID,
+					NATSubnetID:        "subnet-nat",
+					NATRouteTableID:    "rtb-nat",
+					EgressAllocationID: "eipalloc-1",
+				}
+				cfg.EgressConfig.IPs = []string{"1.2.3.4"}
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "DescribeNatGatewaysWithContext", tc.describes)
+			svc.AssertNumberOfCalls(t, "ReleaseAddressWithContext", tc.releases)
+			if tc.releases > 0 {
+				require.Empty(t, cfg.AWSConfig.EgressAllocationID)
+				require.Empty(t, cfg.EgressConfig.IPs)
+			}
+		})
+	}
+}
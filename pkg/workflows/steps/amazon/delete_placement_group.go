@@ -0,0 +1,88 @@
+package amazon
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeletePlacementGroupStepName = "aws_delete_placement_group"
+
+var (
+	placementGroupPollInterval = time.Second * 10
+	placementGroupAttemptCount = 30
+)
+
+// DeletePlacementGroup removes the placement group of masters, it can't be
+// deleted until terminated masters have left it.
+type DeletePlacementGroup struct {
+	getSvc func(steps.AWSConfig) (placementGroupSvc, error)
+}
+
+func InitDeletePlacementGroup(fn GetEC2Fn) {
+	steps.RegisterStep(DeletePlacementGroupStepName, NewDeletePlacementGroup(fn))
+}
+
+func NewDeletePlacementGroup(fn GetEC2Fn) *DeletePlacementGroup {
+	return &DeletePlacementGroup{
+		getSvc: placementGroupSvcFn(fn),
+	}
+}
+
+func (s *DeletePlacementGroup) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	name := cfg.AWSConfig.MastersPlacementGroup
+	if name == "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, DeletePlacementGroupStepName)
+	}
+
+	log.Infof("[%s] - delete placement group %s", s.Name(), name)
+	for i := 0; i < placementGroupAttemptCount; i++ {
+		_, err = svc.DeletePlacementGroupWithContext(ctx, &ec2.DeletePlacementGroupInput{
+			GroupName: aws.String(name),
+		})
+		if err == nil || hasCode(err, "InvalidPlacementGroup.Unknown") {
+			cfg.AWSConfig.MastersPlacementGroup = ""
+			return nil
+		}
+		if !hasCode(err, "InvalidPlacementGroup.InUse") {
+			return errors.Wrapf(err, "delete placement group %s", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(placementGroupPollInterval):
+		}
+	}
+
+	return errors.Errorf("placement group %s is still in use", name)
+}
+
+func (*DeletePlacementGroup) Name() string {
+	return DeletePlacementGroupStepName
+}
+
+func (*DeletePlacementGroup) Depends() []string {
+	return nil
+}
+
+func (*DeletePlacementGroup) Description() string {
+	return "Delete spread placement group of masters"
+}
+
+func (*DeletePlacementGroup) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestDeletePlacementGroup_Run(t *testing.T) {
+	placementGroupPollInterval = time.Nanosecond
+	placementGroupAttemptCount = 2
+
+	for _, tc := range []struct {
+		name      string
+		group     string
+		deleteErr error
+
+		expectedGroup string
+		hasErr        bool
+		deletes       int
+	}{
+		{
+			name: "nothing to delete",
+		},
+		{
+			name:          "delete error",
+			group:         "group",
+			deleteErr:     errors.New("denied"),
+			expectedGroup: "group",
+			hasErr:        true,
+			deletes:       1,
+		},
+		{
+			name:          "still in use",
+			group:         "group",
+			deleteErr:     awserr.New("InvalidPlacementGroup.InUse", "", nil),
+			expectedGroup: "group",
+			hasErr:        true,
+			deletes:       2,
+		},
+		{
+			name:      "missing group",
+			group:     "group",
+			deleteErr: awserr.New("InvalidPlacementGroup.Unknown", "", nil),
+			deletes:   1,
+		},
+		{
+			name:    "deleted",
+			group:   "group",
+			deletes: 1,
+		},
+	} {
+		svc := &mockPlacementGroupSvc{}
+		svc.On("DeletePlacementGroupWithContext", mock.Anything, mock.Anything).
+			Return(&ec2.DeletePlacementGroupOutput{}, tc.deleteErr)
+
+		step := &DeletePlacementGroup{
+			getSvc: func(steps.AWSConfig) (placementGroupSvc, error) {
+				return svc, nil
+			},
+		}
+		cfg := &steps.Config{
+			AWSConfig: steps.AWSConfig{
+				MastersPlacementGroup: tc.group,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.expectedGroup, cfg.AWSConfig.MastersPlacementGroup, "TC: %s", tc.name)
+		svc.AssertNumberOfCalls(t, "DeletePlacementGroupWithContext", tc.deletes)
+	}
+}
+
+func TestInitDeletePlacementGroup(t *testing.T) {
+	InitDeletePlacementGroup(GetEC2)
+
+	require.NotNil(t, steps.GetStep(DeletePlacementGroupStepName))
+}
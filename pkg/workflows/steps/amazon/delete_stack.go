@@ -0,0 +1,81 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeleteStackStepName = "aws_delete_stack"
+
+// DeleteStackStep deletes the cloudformation stack of the cluster with all
+// networking it has, machines must be deleted before.
+type DeleteStackStep struct {
+	getSvc GetCloudFormationFn
+}
+
+func InitDeleteStack(fn GetCloudFormationFn) {
+	steps.RegisterStep(DeleteStackStepName, NewDeleteStackStep(fn))
+}
+
+func NewDeleteStackStep(fn GetCloudFormationFn) *DeleteStackStep {
+	return &DeleteStackStep{
+		getSvc: fn,
+	}
+}
+
+func (s *DeleteStackStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	name := cfg.AWSConfig.StackName
+	if name == "" {
+		logrus.Debug("Skip deleting empty stack")
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(ErrAuthorization, err.Error())
+	}
+
+	log.Infof("[%s] - delete stack %s", s.Name(), name)
+	if err = svc.DeleteStack(ctx, name); err != nil {
+		return errors.Wrap(ErrDeleteStack, err.Error())
+	}
+
+	stack, err := waitForStack(ctx, svc, name)
+	if err != nil && errors.Cause(err) != awssdk.ErrStackNotFound {
+		return errors.Wrap(ErrDeleteStack, err.Error())
+	}
+	// deleted stacks are not found by name
+	if err == nil && stack.Status != awssdk.StackDeleteComplete {
+		return errors.Wrapf(ErrDeleteStack, "stack %s is %s: %s", name, stack.Status, stack.Reason)
+	}
+
+	cfg.AWSConfig.StackName = ""
+	log.Infof("[%s] - stack %s has been deleted", s.Name(), name)
+
+	return nil
+}
+
+func (*DeleteStackStep) Name() string {
+	return DeleteStackStepName
+}
+
+func (*DeleteStackStep) Description() string {
+	return "Delete cloudformation stack of the cluster"
+}
+
+func (*DeleteStackStep) Depends() []string {
+	return nil
+}
+
+func (*DeleteStackStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestDeleteStackStep_Run(t *testing.T) {
+	stackPollInterval = 0
+
+	testCases := []struct {
+		description string
+		stackName   string
+		getSvcErr   error
+		svc         *fakeStackSvc
+		deleted     string
+		errMsg      string
+	}{
+		{
+			description: "no stack",
+			svc:         &fakeStackSvc{},
+		},
+		{
+			description: "get service error",
+			stackName:   "sg-1234",
+			getSvcErr:   errors.New("message1"),
+			svc:         &fakeStackSvc{},
+			errMsg:      "message1",
+		},
+		{
+			description: "delete error",
+			stackName:   "sg-1234",
+			svc:         &fakeStackSvc{deleteErr: errors.New("message2")},
+			deleted:     "sg-1234",
+			errMsg:      "message2",
+		},
+		{
+			description: "delete failed",
+			stackName:   "sg-1234",
+			svc: &fakeStackSvc{
+				stacks: []*awssdk.Stack{{Status: "DELETE_FAILED", Reason: "message3"}},
+			},
+			deleted: "sg-1234",
+			errMsg:  "message3",
+		},
+		{
+			description: "describe error",
+			stackName:   "sg-1234",
+			svc:         &fakeStackSvc{describeErr: errors.New("message4")},
+			deleted:     "sg-1234",
+			errMsg:      "message4",
+		},
+		{
+			description: "success",
+			stackName:   "sg-1234",
+			svc: &fakeStackSvc{
+				stacks:      []*awssdk.Stack{{Status: "DELETE_IN_PROGRESS"}},
+				describeErr: errors.Wrap(awssdk.ErrStackNotFound, "sg-1234"),
+			},
+			deleted: "sg-1234",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		step := NewDeleteStackStep(func(steps.AWSConfig) (StackService, error) {
+			return testCase.svc, testCase.getSvcErr
+		})
+
+		cfg := &steps.Config{
+			AWSConfig: steps.AWSConfig{
+				StackName: testCase.stackName,
+			},
+		}
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, testCase.deleted, testCase.svc.deleted, testCase.description)
+
+		if testCase.errMsg != "" {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+			continue
+		}
+
+		require.Nil(t, err, testCase.description)
+		require.Empty(t, cfg.AWSConfig.StackName, testCase.description)
+	}
+}
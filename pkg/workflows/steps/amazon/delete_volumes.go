@@ -0,0 +1,83 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeleteVolumesStepName = "aws_delete_volumes"
+
+type volumeSvc interface {
+	DeleteVolumeWithContext(aws.Context, *ec2.DeleteVolumeInput, ...request.Option) (*ec2.DeleteVolumeOutput, error)
+}
+
+// DeleteVolumes removes orphaned ebs volumes of the cluster, the volumes
+// have been checked to be detached before the workflow has started.
+type DeleteVolumes struct {
+	getSvc func(steps.AWSConfig) (volumeSvc, error)
+}
+
+func InitDeleteVolumes(fn GetEC2Fn) {
+	steps.RegisterStep(DeleteVolumesStepName, NewDeleteVolumes(fn))
+}
+
+func NewDeleteVolumes(fn GetEC2Fn) *DeleteVolumes {
+	return &DeleteVolumes{
+		getSvc: func(cfg steps.AWSConfig) (volumeSvc, error) {
+			EC2, err := fn(cfg)
+			if err != nil {
+				return nil, errors.Wrap(ErrAuthorization, err.Error())
+			}
+
+			return EC2, nil
+		},
+	}
+}
+
+func (s *DeleteVolumes) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	if len(cfg.VolumeCleanupConfig.DiskIDs) == 0 {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, DeleteVolumesStepName)
+	}
+
+	for _, id := range cfg.VolumeCleanupConfig.DiskIDs {
+		log.Infof("[%s] - delete volume %s", s.Name(), id)
+		_, err = svc.DeleteVolumeWithContext(ctx, &ec2.DeleteVolumeInput{
+			VolumeId: aws.String(id),
+		})
+		if err != nil && !hasCode(err, "InvalidVolume.NotFound") {
+			return errors.Wrapf(err, "%s delete volume %s", DeleteVolumesStepName, id)
+		}
+	}
+
+	return nil
+}
+
+func (*DeleteVolumes) Name() string {
+	return DeleteVolumesStepName
+}
+
+func (*DeleteVolumes) Depends() []string {
+	return nil
+}
+
+func (*DeleteVolumes) Description() string {
+	return "Delete orphaned ebs volumes of the cluster"
+}
+
+func (*DeleteVolumes) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type mockVolumeSvc struct {
+	mock.Mock
+}
+
+func (m *mockVolumeSvc) DeleteVolumeWithContext(ctx aws.Context, in *ec2.DeleteVolumeInput, opts ...request.Option) (*ec2.DeleteVolumeOutput, error) {
+	args := m.Called(ctx, in)
+	val, _ := args.Get(0).(*ec2.DeleteVolumeOutput)
+	return val, args.Error(1)
+}
+
+func TestDeleteVolumes_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		diskIDs   []string
+		svcErr    error
+		deleteErr error
+		hasErr    bool
+		deletes   int
+	}{
+		{
+			name: "nothing to delete",
+		},
+		{
+			name:    "svc error",
+			diskIDs: []string{"vol-1"},
+			svcErr:  errors.New("creds"),
+			hasErr:  true,
+		},
+		{
+			name:    "delete",
+			diskIDs: []string{"vol-1", "vol-2"},
+			deletes: 2,
+		},
+		{
+			name:      "already deleted",
+			diskIDs:   []string{"vol-1", "vol-2"},
+			deleteErr: awserr.New("InvalidVolume.NotFound", "", nil),
+			deletes:   2,
+		},
+		{
+			name:      "in use",
+			diskIDs:   []string{"vol-1", "vol-2"},
+			deleteErr: awserr.New("VolumeInUse", "", nil),
+			hasErr:    true,
+			deletes:   1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockVolumeSvc{}
+			svc.On("DeleteVolumeWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteVolumeOutput{}, tc.deleteErr)
+			step := &DeleteVolumes{
+				getSvc: func(steps.AWSConfig) (volumeSvc, error) {
+					return svc, tc.svcErr
+				},
+			}
+
+			cfg := &steps.Config{
+				VolumeCleanupConfig: steps.VolumeCleanupConfig{DiskIDs: tc.diskIDs},
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "DeleteVolumeWithContext", tc.deletes)
+		})
+	}
+}
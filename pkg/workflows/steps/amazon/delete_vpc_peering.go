@@ -0,0 +1,104 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeleteVPCPeeringStepName = "aws_delete_vpc_peering"
+
+// DeleteVPCPeering removes routes and rules of the peering and the connection,
+// resources that are already gone are skipped.
+type DeleteVPCPeering struct {
+	getSvc func(steps.AWSConfig) (peeringSvc, error)
+}
+
+func InitDeleteVPCPeering(fn GetEC2Fn) {
+	steps.RegisterStep(DeleteVPCPeeringStepName, NewDeleteVPCPeering(fn))
+}
+
+func NewDeleteVPCPeering(fn GetEC2Fn) *DeleteVPCPeering {
+	return &DeleteVPCPeering{
+		getSvc: peeringSvcFn(fn),
+	}
+}
+
+func (s *DeleteVPCPeering) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	if cfg.PeeringConfig.ConnectionID == "" {
+		log.Infof("[%s] - skip deleting empty peering connection", s.Name())
+		return nil
+	}
+
+	sides := []struct {
+		network steps.AWSConfig
+		peer    steps.AWSConfig
+	}{
+		{cfg.AWSConfig, cfg.PeeringConfig.AWSConfig},
+		{cfg.PeeringConfig.AWSConfig, cfg.AWSConfig},
+	}
+	for _, side := range sides {
+		svc, err := s.getSvc(side.network)
+		if err != nil {
+			return errors.Wrap(err, DeleteVPCPeeringStepName)
+		}
+
+		_, err = svc.DeleteRouteWithContext(ctx, &ec2.DeleteRouteInput{
+			RouteTableId:         aws.String(side.network.RouteTableID),
+			DestinationCidrBlock: aws.String(side.peer.VPCCIDR),
+		})
+		if err != nil && !hasCode(err, "InvalidRoute.NotFound") {
+			return errors.Wrapf(err, "delete route from %s", side.network.RouteTableID)
+		}
+
+		for _, groupID := range []string{side.network.MastersSecurityGroupID, side.network.NodesSecurityGroupID} {
+			if groupID == "" {
+				continue
+			}
+			_, err = svc.RevokeSecurityGroupIngressWithContext(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: peerPermissions(side.peer.VPCCIDR),
+			})
+			if err != nil && !hasCode(err, "InvalidPermission.NotFound") {
+				return errors.Wrapf(err, "revoke ingress to %s", groupID)
+			}
+		}
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, DeleteVPCPeeringStepName)
+	}
+	log.Infof("[%s] - delete peering connection %s", s.Name(), cfg.PeeringConfig.ConnectionID)
+	_, err = svc.DeleteVpcPeeringConnectionWithContext(ctx, &ec2.DeleteVpcPeeringConnectionInput{
+		VpcPeeringConnectionId: aws.String(cfg.PeeringConfig.ConnectionID),
+	})
+	if err != nil && !hasCode(err, "InvalidVpcPeeringConnectionID.NotFound") {
+		return errors.Wrap(ErrPeering, err.Error())
+	}
+
+	return nil
+}
+
+func (*DeleteVPCPeering) Name() string {
+	return DeleteVPCPeeringStepName
+}
+
+func (*DeleteVPCPeering) Depends() []string {
+	return nil
+}
+
+func (*DeleteVPCPeering) Description() string {
+	return "Delete vpc peering connection"
+}
+
+func (*DeleteVPCPeering) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestDeleteVPCPeering_Run(t *testing.T) {
+	notFound := awserr.New("InvalidRoute.NotFound", "", nil)
+
+	for _, tc := range []struct {
+		name         string
+		connectionID string
+		routeErr     error
+		revokeErr    error
+		deleteErr    error
+
+		expectedErr error
+		deleted     bool
+	}{
+		{
+			name: "no connection",
+		},
+		{
+			name:         "route error",
+			connectionID: "pcx-1",
+			routeErr:     errors.New("throttled"),
+			expectedErr:  errors.New("throttled"),
+		},
+		{
+			name:         "resources are gone",
+			connectionID: "pcx-1",
+			routeErr:     notFound,
+			revokeErr:    awserr.New("InvalidPermission.NotFound", "", nil),
+			deleteErr:    awserr.New("InvalidVpcPeeringConnectionID.NotFound", "", nil),
+			deleted:      true,
+		},
+		{
+			name:         "delete error",
+			connectionID: "pcx-1",
+			deleteErr:    errors.New("throttled"),
+			expectedErr:  ErrPeering,
+			deleted:      true,
+		},
+		{
+			name:         "deleted",
+			connectionID: "pcx-1",
+			deleted:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("DeleteRouteWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteRouteOutput{}, tc.routeErr)
+			svc.On("RevokeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.RevokeSecurityGroupIngressOutput{}, tc.revokeErr)
+			svc.On("DeleteVpcPeeringConnectionWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.DeleteVpcPeeringConnectionOutput{}, tc.deleteErr)
+			step := &DeleteVPCPeering{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, peeringConfig(tc.connectionID))
+
+			if tc.expectedErr != nil {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.deleted {
+				svc.AssertCalled(t, "DeleteVpcPeeringConnectionWithContext", mock.Anything, mock.Anything)
+			} else {
+				svc.AssertNotCalled(t, "DeleteVpcPeeringConnectionWithContext", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestInitDeleteVPCPeering(t *testing.T) {
+	InitDeleteVPCPeering(GetEC2)
+
+	require.NotNil(t, steps.GetStep(DeleteVPCPeeringStepName))
+}
@@ -12,4 +12,6 @@ var (
 	ErrNoPublicIP     = errors.New("aws: no public IP assigned")
 	ErrDeleteCluster  = errors.New("aws: delete cluster")
 	ErrDeleteNode     = errors.New("aws: delete node")
+	ErrCreateStack    = errors.New("aws: create stack")
+	ErrDeleteStack    = errors.New("aws: delete stack")
 )
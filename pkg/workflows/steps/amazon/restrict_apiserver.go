@@ -0,0 +1,82 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	RestrictAPIServerStepName = "aws_restrict_apiserver"
+
+	apiServerPort = 443
+)
+
+// RestrictAPIServer lets allowed cidrs to the api server port of masters,
+// control is allowed by the security group since it has been created.
+type RestrictAPIServer struct {
+	getSvc func(steps.AWSConfig) (peeringSvc, error)
+}
+
+func InitRestrictAPIServer(fn GetEC2Fn) {
+	steps.RegisterStep(RestrictAPIServerStepName, NewRestrictAPIServer(fn))
+}
+
+func NewRestrictAPIServer(fn GetEC2Fn) *RestrictAPIServer {
+	return &RestrictAPIServer{
+		getSvc: peeringSvcFn(fn),
+	}
+}
+
+func (s *RestrictAPIServer) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	access := cfg.APIServerAccess
+	if len(access.AllowedCIDRs) == 0 && len(access.Applied) == 0 {
+		return nil
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, RestrictAPIServerStepName)
+	}
+
+	return errors.Wrap(syncIngress(ctx, util.GetLogger(w), svc, cfg.AWSConfig,
+		apiServerRules(access.AllowedCIDRs), apiServerRules(access.Applied)), RestrictAPIServerStepName)
+}
+
+func apiServerRules(cidrs []string) []model.FirewallRule {
+	if len(cidrs) == 0 {
+		return nil
+	}
+
+	return []model.FirewallRule{
+		{
+			Role:        model.RoleMaster,
+			Protocol:    "tcp",
+			FromPort:    apiServerPort,
+			ToPort:      apiServerPort,
+			CIDRs:       cidrs,
+			Description: "api server clients",
+		},
+	}
+}
+
+func (*RestrictAPIServer) Name() string {
+	return RestrictAPIServerStepName
+}
+
+func (*RestrictAPIServer) Depends() []string {
+	return []string{StepCreateSecurityGroups}
+}
+
+func (*RestrictAPIServer) Description() string {
+	return "Allow clients of the api server in the masters security group"
+}
+
+func (*RestrictAPIServer) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
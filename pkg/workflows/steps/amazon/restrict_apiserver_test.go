@@ -0,0 +1,90 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestRestrictAPIServer_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		access     steps.APIServerAccess
+		svcErr     error
+		authErr    error
+		hasErr     bool
+		revokes    int
+		authorizes int
+	}{
+		{
+			name: "no allow-list",
+		},
+		{
+			name: "svc error",
+			access: steps.APIServerAccess{
+				AllowedCIDRs: []string{"203.0.113.0/24"},
+			},
+			svcErr: errors.New("creds"),
+			hasErr: true,
+		},
+		{
+			name: "allow",
+			access: steps.APIServerAccess{
+				AllowedCIDRs: []string{"203.0.113.0/24", "198.51.100.0/24"},
+			},
+			authorizes: 2,
+		},
+		{
+			name: "replace",
+			access: steps.APIServerAccess{
+				AllowedCIDRs: []string{"203.0.113.0/24"},
+				Applied:      []string{"203.0.113.0/24", "198.51.100.0/24"},
+			},
+			revokes:    1,
+			authorizes: 1,
+		},
+		{
+			name: "authorize error",
+			access: steps.APIServerAccess{
+				AllowedCIDRs: []string{"203.0.113.0/24"},
+			},
+			authErr:    errors.New("limit"),
+			hasErr:     true,
+			authorizes: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("RevokeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil)
+			svc.On("AuthorizeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, tc.authErr)
+			step := &RestrictAPIServer{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, tc.svcErr
+				},
+			}
+
+			cfg := &steps.Config{
+				AWSConfig: steps.AWSConfig{
+					MastersSecurityGroupID: "sg-masters",
+					NodesSecurityGroupID:   "sg-nodes",
+				},
+				APIServerAccess: tc.access,
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "RevokeSecurityGroupIngressWithContext", tc.revokes)
+			svc.AssertNumberOfCalls(t, "AuthorizeSecurityGroupIngressWithContext", tc.authorizes)
+		})
+	}
+}
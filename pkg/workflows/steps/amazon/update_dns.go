@@ -0,0 +1,83 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/awssdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const UpdateDNSStepName = "aws_update_dns"
+
+// RecordService manages A records of a hosted zone.
+type RecordService interface {
+	UpsertA(ctx context.Context, zoneID, name string, ttl int64, addrs []string) error
+	DeleteA(ctx context.Context, zoneID, name string) error
+}
+
+type GetRoute53Fn func(steps.AWSConfig) (RecordService, error)
+
+func GetRoute53(cfg steps.AWSConfig) (RecordService, error) {
+	r53, err := awssdk.NewRoute53(cfg.KeyID, cfg.Secret, "")
+	if err != nil {
+		return nil, err
+	}
+	return r53, nil
+}
+
+// UpdateDNS points the route53 record of the api endpoint to masters
+// of the cluster, the record is removed when there are no masters.
+type UpdateDNS struct {
+	getSvc GetRoute53Fn
+}
+
+func InitUpdateDNS(fn GetRoute53Fn) {
+	steps.RegisterStep(UpdateDNSStepName, NewUpdateDNS(fn))
+}
+
+func NewUpdateDNS(fn GetRoute53Fn) *UpdateDNS {
+	return &UpdateDNS{
+		getSvc: fn,
+	}
+}
+
+func (s *UpdateDNS) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	dns := cfg.DNSConfig
+	if dns.ZoneID == "" {
+		return errors.Errorf("%s: hosted zone of %s is not set", UpdateDNSStepName, dns.Domain)
+	}
+
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(ErrAuthorization, err.Error())
+	}
+
+	if len(dns.Addresses) == 0 {
+		log.Infof("[%s] - delete record %s", s.Name(), dns.Name)
+		return errors.Wrap(svc.DeleteA(ctx, dns.ZoneID, dns.Name), UpdateDNSStepName)
+	}
+
+	log.Infof("[%s] - point %s to %v", s.Name(), dns.Name, dns.Addresses)
+	return errors.Wrap(svc.UpsertA(ctx, dns.ZoneID, dns.Name, dns.TTL, dns.Addresses), UpdateDNSStepName)
+}
+
+func (s *UpdateDNS) Name() string {
+	return UpdateDNSStepName
+}
+
+func (s *UpdateDNS) Description() string {
+	return "AWS: update route53 record of the api endpoint"
+}
+
+func (s *UpdateDNS) Depends() []string {
+	return nil
+}
+
+func (s *UpdateDNS) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type mockRecordSvc struct {
+	mock.Mock
+}
+
+func (m *mockRecordSvc) UpsertA(ctx context.Context, zoneID, name string, ttl int64, addrs []string) error {
+	args := m.Called(ctx, zoneID, name, ttl, addrs)
+	return args.Error(0)
+}
+
+func (m *mockRecordSvc) DeleteA(ctx context.Context, zoneID, name string) error {
+	args := m.Called(ctx, zoneID, name)
+	return args.Error(0)
+}
+
+func TestUpdateDNS_Run(t *testing.T) {
+	testCases := []struct {
+		description string
+		zoneID      string
+		addrs       []string
+		getSvcErr   error
+		changeErr   error
+		method      string
+		errMsg      string
+	}{
+		{
+			description: "no zone",
+			errMsg:      "hosted zone",
+		},
+		{
+			description: "get service error",
+			zoneID:      "Z1",
+			getSvcErr:   errors.New("message1"),
+			errMsg:      "message1",
+		},
+		{
+			description: "upsert error",
+			zoneID:      "Z1",
+			addrs:       []string{"1.1.1.1"},
+			changeErr:   errors.New("message2"),
+			method:      "UpsertA",
+			errMsg:      "message2",
+		},
+		{
+			description: "upsert",
+			zoneID:      "Z1",
+			addrs:       []string{"1.1.1.1"},
+			method:      "UpsertA",
+		},
+		{
+			description: "delete",
+			zoneID:      "Z1",
+			method:      "DeleteA",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+		svc := &mockRecordSvc{}
+		svc.On("UpsertA", mock.Anything, testCase.zoneID, "kube.example.com",
+			int64(steps.DefaultDNSTTL), testCase.addrs).Return(testCase.changeErr)
+		svc.On("DeleteA", mock.Anything, testCase.zoneID, "kube.example.com").Return(testCase.changeErr)
+
+		step := NewUpdateDNS(func(steps.AWSConfig) (RecordService, error) {
+			return svc, testCase.getSvcErr
+		})
+
+		config := &steps.Config{
+			DNSConfig: steps.DNSConfig{
+				Name:      "kube.example.com",
+				Domain:    "example.com",
+				ZoneID:    testCase.zoneID,
+				TTL:       steps.DefaultDNSTTL,
+				Addresses: testCase.addrs,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, config)
+		if testCase.errMsg == "" {
+			require.Nil(t, err, testCase.description)
+		} else {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+		}
+		if testCase.method != "" {
+			svc.AssertNumberOfCalls(t, testCase.method, 1)
+		}
+	}
+}
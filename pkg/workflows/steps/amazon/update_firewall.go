@@ -0,0 +1,155 @@
+package amazon
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const UpdateFirewallStepName = "aws_update_firewall"
+
+// UpdateFirewall syncs firewall rules of the cluster with its security groups.
+// Rules are expanded to single cidrs, so ranges that stay in the new rules are
+// kept while ranges of removed rules are revoked.
+type UpdateFirewall struct {
+	getSvc func(steps.AWSConfig) (peeringSvc, error)
+}
+
+// permission is an ingress rule of a security group for a single cidr.
+type permission struct {
+	groupID  string
+	protocol string
+	from     int64
+	to       int64
+	cidr     string
+}
+
+func InitUpdateFirewall(fn GetEC2Fn) {
+	steps.RegisterStep(UpdateFirewallStepName, NewUpdateFirewall(fn))
+}
+
+func NewUpdateFirewall(fn GetEC2Fn) *UpdateFirewall {
+	return &UpdateFirewall{
+		getSvc: peeringSvcFn(fn),
+	}
+}
+
+func (s *UpdateFirewall) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	svc, err := s.getSvc(cfg.AWSConfig)
+	if err != nil {
+		return errors.Wrap(err, UpdateFirewallStepName)
+	}
+
+	return syncIngress(ctx, util.GetLogger(w), svc, cfg.AWSConfig,
+		cfg.FirewallConfig.Rules, cfg.FirewallConfig.Applied)
+}
+
+// syncIngress revokes ranges of applied rules that are missing in the new rules
+// and authorizes the new ones.
+func syncIngress(ctx context.Context, log logrus.FieldLogger, svc peeringSvc, cfg steps.AWSConfig,
+	rules, applied []model.FirewallRule) error {
+	descriptions := make(map[permission]string)
+	desired := make(map[permission]bool)
+	for _, rule := range rules {
+		for _, p := range permissions(cfg, rule) {
+			desired[p] = true
+			descriptions[p] = rule.Description
+		}
+	}
+
+	for _, rule := range applied {
+		for _, p := range permissions(cfg, rule) {
+			if desired[p] {
+				continue
+			}
+
+			log.Infof("revoke %s %d-%d from %s in %s", p.protocol, p.from, p.to, p.cidr, p.groupID)
+			_, err := svc.RevokeSecurityGroupIngressWithContext(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(p.groupID),
+				IpPermissions: []*ec2.IpPermission{p.ipPermission("")},
+			})
+			if err != nil && !hasCode(err, "InvalidPermission.NotFound") {
+				return errors.Wrapf(err, "revoke ingress from %s", p.groupID)
+			}
+		}
+	}
+
+	// all rules are authorized, so a partially applied change is completed
+	for p := range desired {
+		log.Infof("allow %s %d-%d from %s in %s", p.protocol, p.from, p.to, p.cidr, p.groupID)
+		_, err := svc.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(p.groupID),
+			IpPermissions: []*ec2.IpPermission{p.ipPermission(descriptions[p])},
+		})
+		if err != nil && !hasCode(err, "InvalidPermission.Duplicate") {
+			return errors.Wrapf(err, "authorize ingress to %s", p.groupID)
+		}
+	}
+
+	return nil
+}
+
+func permissions(cfg steps.AWSConfig, rule model.FirewallRule) []permission {
+	groups := make([]string, 0, 2)
+	if rule.Role != model.RoleNode && cfg.MastersSecurityGroupID != "" {
+		groups = append(groups, cfg.MastersSecurityGroupID)
+	}
+	if rule.Role != model.RoleMaster && cfg.NodesSecurityGroupID != "" {
+		groups = append(groups, cfg.NodesSecurityGroupID)
+	}
+
+	out := make([]permission, 0, len(groups)*len(rule.CIDRs))
+	for _, groupID := range groups {
+		for _, cidr := range rule.CIDRs {
+			out = append(out, permission{
+				groupID:  groupID,
+				protocol: rule.Protocol,
+				from:     rule.FromPort,
+				to:       rule.ToPort,
+				cidr:     cidr,
+			})
+		}
+	}
+
+	return out
+}
+
+func (p permission) ipPermission(description string) *ec2.IpPermission {
+	ipRange := &ec2.IpRange{
+		CidrIp: aws.String(p.cidr),
+	}
+	if description != "" {
+		ipRange.Description = aws.String(description)
+	}
+
+	return &ec2.IpPermission{
+		IpProtocol: aws.String(p.protocol),
+		FromPort:   aws.Int64(p.from),
+		ToPort:     aws.Int64(p.to),
+		IpRanges:   []*ec2.IpRange{ipRange},
+	}
+}
+
+func (*UpdateFirewall) Name() string {
+	return UpdateFirewallStepName
+}
+
+func (*UpdateFirewall) Depends() []string {
+	return nil
+}
+
+func (*UpdateFirewall) Description() string {
+	return "Update firewall rules of cluster security groups"
+}
+
+func (*UpdateFirewall) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
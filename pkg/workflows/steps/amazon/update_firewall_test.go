@@ -0,0 +1,108 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestUpdateFirewall_Run(t *testing.T) {
+	apiServer := model.FirewallRule{
+		Role:     model.RoleMaster,
+		Protocol: "tcp",
+		FromPort: 443,
+		ToPort:   443,
+		CIDRs:    []string{"203.0.113.0/24", "198.51.100.0/24"},
+	}
+	nodePorts := model.FirewallRule{
+		Protocol: "tcp",
+		FromPort: 30000,
+		ToPort:   32767,
+		CIDRs:    []string{"10.0.0.0/8"},
+	}
+	narrowed := apiServer
+	narrowed.CIDRs = []string{"203.0.113.0/24"}
+
+	for _, tc := range []struct {
+		name       string
+		rules      []model.FirewallRule
+		applied    []model.FirewallRule
+		revokeErr  error
+		authErr    error
+		hasErr     bool
+		revokes    int
+		authorizes int
+	}{
+		{
+			name:       "add rules",
+			rules:      []model.FirewallRule{apiServer, nodePorts},
+			authorizes: 4,
+		},
+		{
+			name:       "narrow cidrs",
+			rules:      []model.FirewallRule{narrowed},
+			applied:    []model.FirewallRule{apiServer, nodePorts},
+			revokes:    3,
+			authorizes: 1,
+		},
+		{
+			name:      "remove all",
+			applied:   []model.FirewallRule{nodePorts},
+			revokeErr: awserr.New("InvalidPermission.NotFound", "", nil),
+			revokes:   2,
+		},
+		{
+			name:      "revoke error",
+			applied:   []model.FirewallRule{nodePorts},
+			revokeErr: errors.New("denied"),
+			hasErr:    true,
+			revokes:   1,
+		},
+		{
+			name:       "duplicate",
+			rules:      []model.FirewallRule{narrowed},
+			applied:    []model.FirewallRule{narrowed},
+			authErr:    awserr.New("InvalidPermission.Duplicate", "", nil),
+			authorizes: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockPeeringSvc{}
+			svc.On("RevokeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.RevokeSecurityGroupIngressOutput{}, tc.revokeErr)
+			svc.On("AuthorizeSecurityGroupIngressWithContext", mock.Anything, mock.Anything).
+				Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, tc.authErr)
+			step := &UpdateFirewall{
+				getSvc: func(steps.AWSConfig) (peeringSvc, error) {
+					return svc, nil
+				},
+			}
+
+			cfg := &steps.Config{
+				AWSConfig: steps.AWSConfig{
+					MastersSecurityGroupID: "sg-masters",
+					NodesSecurityGroupID:   "sg-nodes",
+				},
+				FirewallConfig: steps.FirewallConfig{
+					Rules:   tc.rules,
+					Applied: tc.applied,
+				},
+			}
+
+			err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+
+			require.Equal(t, tc.hasErr, err != nil, "unexpected error %v", err)
+			svc.AssertNumberOfCalls(t, "RevokeSecurityGroupIngressWithContext", tc.revokes)
+			svc.AssertNumberOfCalls(t, "AuthorizeSecurityGroupIngressWithContext", tc.authorizes)
+		})
+	}
+}
@@ -81,3 +81,8 @@ func findOutBoundIP() (string, error) {
 
 	return publicIP, err
 }
+
+// OutboundIP returns the address control reaches clouds from.
+func OutboundIP(ctx context.Context) (string, error) {
+	return FindOutboundIP(ctx, findOutBoundIP)
+}
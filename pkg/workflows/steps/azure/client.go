@@ -27,6 +27,18 @@ func toResourceGroupName(clusterID, clusterName string) string {
 	return fmt.Sprintf("sg-%s-%s", clusterName, clusterID)
 }
 
+// resourceTags are cost center tags of the cluster, azure doesn't allow
+// slashes in names of tags, so the cluster id tag of other clouds is skipped.
+func resourceTags(cfg *steps.Config) map[string]*string {
+	tags := make(map[string]*string, len(cfg.CostConfig.Tags)+1)
+	for k, v := range cfg.CostConfig.Tags {
+		tags[k] = toStrPtr(v)
+	}
+	tags["KubernetesCluster"] = toStrPtr(cfg.ClusterName)
+
+	return tags
+}
+
 func toStrPtr(s string) *string {
 	return &s
 }
@@ -35,8 +47,18 @@ func toBoolPtr(b bool) *bool {
 	return &b
 }
 
+func toInt32Ptr(i int32) *int32 {
+	return &i
+}
+
 func Init() {
 	steps.RegisterStep(CreateMachineStepName, &CreateMachineStep{})
 	steps.RegisterStep(CreateGroupStepName, &CreateGroupStep{})
 	steps.RegisterStep(CreateVNetStepName, &CreateVnetStep{})
+	steps.RegisterStep(CreateVNetPeeringStepName, &CreateVNetPeeringStep{})
+	steps.RegisterStep(DeleteVNetPeeringStepName, &DeleteVNetPeeringStep{})
+	steps.RegisterStep(UpdateDNSStepName, &UpdateDNSStep{})
+	steps.RegisterStep(RestrictAPIServerStepName, &RestrictAPIServerStep{})
+	steps.RegisterStep(CreateBudgetStepName, &CreateBudgetStep{})
+	steps.RegisterStep(CreateAvailabilitySetStepName, &CreateAvailabilitySetStep{})
 }
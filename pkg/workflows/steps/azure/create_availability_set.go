@@ -0,0 +1,74 @@
+package azure
+
+import (
+	"context"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/2018-03-01/compute/mgmt/compute"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateAvailabilitySetStepName = "CreateAvailabilitySet"
+
+// CreateAvailabilitySetStep creates an availability set of masters, masters
+// of the set are spread across fault domains of the datacenter. The set is
+// removed together with the resource group.
+type CreateAvailabilitySetStep struct {
+}
+
+func (s *CreateAvailabilitySetStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	if !cfg.SpreadMasters || cfg.AzureConfig.MastersAvailabilitySet != "" {
+		return nil
+	}
+
+	client, err := azuresdk.New(cfg.AzureConfig).AvailabilitySetsClient()
+	if err != nil {
+		return err
+	}
+
+	name := cfg.AzureConfig.ResourceGroupName + "-masters"
+	log.Infof("[%s] - create availability set %s", s.Name(), name)
+	set, err := client.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, name, compute.AvailabilitySet{
+		Name:     toStrPtr(name),
+		Location: toStrPtr(cfg.AzureConfig.Location),
+		Tags:     resourceTags(cfg),
+		// managed disks of machines require the aligned sku
+		Sku: &compute.Sku{
+			Name: toStrPtr("Aligned"),
+		},
+		AvailabilitySetProperties: &compute.AvailabilitySetProperties{
+			// every region supports at least two fault domains
+			PlatformFaultDomainCount:  toInt32Ptr(2),
+			PlatformUpdateDomainCount: toInt32Ptr(5),
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "create availability set %s", name)
+	}
+
+	cfg.AzureConfig.MastersAvailabilitySet = *set.ID
+
+	return nil
+}
+
+func (s *CreateAvailabilitySetStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *CreateAvailabilitySetStep) Name() string {
+	return CreateAvailabilitySetStepName
+}
+
+func (s *CreateAvailabilitySetStep) Depends() []string {
+	return nil
+}
+
+func (s *CreateAvailabilitySetStep) Description() string {
+	return "Azure: Create availability set of masters"
+}
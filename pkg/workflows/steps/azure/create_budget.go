@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateBudgetStepName = "CreateBudget"
+
+// CreateBudgetStep sets a monthly budget of the resource group of the cluster,
+// the budget is named after the group and is removed together with it.
+type CreateBudgetStep struct {
+}
+
+func (s *CreateBudgetStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	cost := cfg.CostConfig
+	if cost.BudgetAmount == 0 {
+		return nil
+	}
+
+	client, err := azuresdk.New(cfg.AzureConfig).BudgetsClient()
+	if err != nil {
+		return err
+	}
+
+	group := cfg.AzureConfig.ResourceGroupName
+	log.Infof("[%s] - set budget %v of resource group %s", s.Name(), cost.BudgetAmount, group)
+	err = client.CreateOrUpdate(ctx, group, azuresdk.Budget{
+		Name:          group,
+		Amount:        cost.BudgetAmount,
+		Thresholds:    cost.Thresholds,
+		ContactEmails: cost.ContactEmails,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "create budget of resource group %s", group)
+	}
+
+	return nil
+}
+
+func (s *CreateBudgetStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *CreateBudgetStep) Name() string {
+	return CreateBudgetStepName
+}
+
+func (s *CreateBudgetStep) Depends() []string {
+	return nil
+}
+
+func (s *CreateBudgetStep) Description() string {
+	return "Azure: Create budget of the ResourceGroup"
+}
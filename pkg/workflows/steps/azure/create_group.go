@@ -32,7 +32,7 @@ func (s *CreateGroupStep) Run(ctx context.Context, w io.Writer, cfg *steps.Confi
 	result, err := groupsClient.CreateOrUpdate(ctx, groupName, resources.Group{
 		Name:     toStrPtr(groupName),
 		Location: toStrPtr(cfg.AzureConfig.Location),
-		Tags:     map[string]*string{},
+		Tags:     resourceTags(cfg),
 	})
 
 	if err != nil {
@@ -51,14 +51,22 @@ func (*CreateMachineStep) Run(ctx context.Context, w io.Writer, cfg *steps.Confi
 		State:    model.MachineStatePlanned,
 	}
 
-	nicFuture, err := nics.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, vmName, network.Interface{
+	nic := network.Interface{
 		Name:     toStrPtr(nicName),
 		Location: toStrPtr(cfg.AzureConfig.Location),
+		Tags:     resourceTags(cfg),
 		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
 			IPConfigurations: &[]network.InterfaceIPConfiguration{},
 			Primary:          toBoolPtr(true),
 		},
-	})
+	}
+	if cfg.IsMaster && cfg.AzureConfig.SecurityGroupName != "" {
+		nic.NetworkSecurityGroup = &network.SecurityGroup{
+			ID: toStrPtr(securityGroupID(cfg.AzureConfig)),
+		}
+	}
+
+	nicFuture, err := nics.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, vmName, nic)
 
 	if err != nil {
 		return err
@@ -69,8 +77,16 @@ func (*CreateMachineStep) Run(ctx context.Context, w io.Writer, cfg *steps.Confi
 		return err
 	}
 
+	var availabilitySet *compute.SubResource
+	if cfg.IsMaster && cfg.AzureConfig.MastersAvailabilitySet != "" {
+		availabilitySet = &compute.SubResource{
+			ID: toStrPtr(cfg.AzureConfig.MastersAvailabilitySet),
+		}
+	}
+
 	future, err := vms.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, vmName, compute.VirtualMachine{
 		Location: toStrPtr(cfg.AzureConfig.Location),
+		Tags:     resourceTags(cfg),
 		VirtualMachineProperties: &compute.VirtualMachineProperties{
 			HardwareProfile: &compute.HardwareProfile{
 				VMSize: compute.VirtualMachineSizeTypes(cfg.AzureConfig.Size),
@@ -91,6 +107,7 @@ func (*CreateMachineStep) Run(ctx context.Context, w io.Writer, cfg *steps.Confi
 					},
 				},
 			},
+			AvailabilitySet: availabilitySet,
 			NetworkProfile: &compute.NetworkProfile{
 				NetworkInterfaces: &[]compute.NetworkInterfaceReference{
 					{
@@ -31,6 +31,7 @@ func (s *CreateVnetStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config
 
 		future, err := cl.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, vnetName, network.VirtualNetwork{
 			Location: toStrPtr(cfg.AzureConfig.Location),
+			Tags:     resourceTags(cfg),
 			Name:     toStrPtr(vnetName),
 			VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
 				AddressSpace: &network.AddressSpace{
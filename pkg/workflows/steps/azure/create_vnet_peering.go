@@ -0,0 +1,89 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2017-10-01/network"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const CreateVNetPeeringStepName = "create_vnet_peering"
+
+// CreateVNetPeeringStep peers virtual networks of two clusters, azure requires
+// a peering in each of the networks for traffic to flow.
+type CreateVNetPeeringStep struct {
+}
+
+func (s *CreateVNetPeeringStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	peer := cfg.PeeringConfig.AzureConfig
+
+	sides := []struct {
+		network steps.AzureConfig
+		remote  steps.AzureConfig
+		name    string
+	}{
+		{cfg.AzureConfig, peer, peeringName(cfg.PeeringConfig.PeerClusterID)},
+		{peer, cfg.AzureConfig, peeringName(cfg.ClusterID)},
+	}
+	for _, side := range sides {
+		cl, err := azuresdk.New(side.network).PeeringsClient()
+		if err != nil {
+			return errors.Wrap(err, CreateVNetPeeringStepName)
+		}
+
+		log.Infof("[%s] - peer virtual network %s with %s", s.Name(),
+			side.network.VirtualNetworkName, side.remote.VirtualNetworkName)
+		future, err := cl.CreateOrUpdate(ctx, side.network.ResourceGroupName, side.network.VirtualNetworkName,
+			side.name, network.VirtualNetworkPeering{
+				Name: toStrPtr(side.name),
+				VirtualNetworkPeeringPropertiesFormat: &network.VirtualNetworkPeeringPropertiesFormat{
+					AllowVirtualNetworkAccess: toBoolPtr(true),
+					AllowForwardedTraffic:     toBoolPtr(true),
+					RemoteVirtualNetwork: &network.SubResource{
+						ID: toStrPtr(vnetID(side.remote)),
+					},
+				},
+			})
+		if err != nil {
+			return errors.Wrapf(err, "create peering %s", side.name)
+		}
+		if err = future.WaitForCompletionRef(ctx, cl.Client); err != nil {
+			return errors.Wrapf(err, "create peering %s", side.name)
+		}
+	}
+	cfg.PeeringConfig.ConnectionID = peeringName(cfg.PeeringConfig.PeerClusterID)
+
+	return nil
+}
+
+func (*CreateVNetPeeringStep) Name() string {
+	return CreateVNetPeeringStepName
+}
+
+func (*CreateVNetPeeringStep) Description() string {
+	return "Azure: Create virtual network peering"
+}
+
+func (*CreateVNetPeeringStep) Depends() []string {
+	return nil
+}
+
+func (*CreateVNetPeeringStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func peeringName(clusterID string) string {
+	return fmt.Sprintf("sg-peering-%s", clusterID)
+}
+
+func vnetID(cfg steps.AzureConfig) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s",
+		cfg.SubscriptionID, cfg.ResourceGroupName, cfg.VirtualNetworkName)
+}
@@ -0,0 +1,70 @@
+package azure
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const DeleteVNetPeeringStepName = "delete_vnet_peering"
+
+// DeleteVNetPeeringStep removes peerings from both virtual networks.
+type DeleteVNetPeeringStep struct {
+}
+
+func (s *DeleteVNetPeeringStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	peer := cfg.PeeringConfig.AzureConfig
+
+	sides := []struct {
+		network steps.AzureConfig
+		name    string
+	}{
+		{cfg.AzureConfig, peeringName(cfg.PeeringConfig.PeerClusterID)},
+		{peer, peeringName(cfg.ClusterID)},
+	}
+	for _, side := range sides {
+		cl, err := azuresdk.New(side.network).PeeringsClient()
+		if err != nil {
+			return errors.Wrap(err, DeleteVNetPeeringStepName)
+		}
+
+		log.Infof("[%s] - delete peering %s of virtual network %s", s.Name(),
+			side.name, side.network.VirtualNetworkName)
+		future, err := cl.Delete(ctx, side.network.ResourceGroupName, side.network.VirtualNetworkName, side.name)
+		if err != nil {
+			if derr, ok := err.(autorest.DetailedError); ok && derr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return errors.Wrapf(err, "delete peering %s", side.name)
+		}
+		if err = future.WaitForCompletionRef(ctx, cl.Client); err != nil {
+			return errors.Wrapf(err, "delete peering %s", side.name)
+		}
+	}
+
+	return nil
+}
+
+func (*DeleteVNetPeeringStep) Name() string {
+	return DeleteVNetPeeringStepName
+}
+
+func (*DeleteVNetPeeringStep) Description() string {
+	return "Azure: Delete virtual network peering"
+}
+
+func (*DeleteVNetPeeringStep) Depends() []string {
+	return nil
+}
+
+func (*DeleteVNetPeeringStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2017-10-01/network"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	RestrictAPIServerStepName = "azure_restrict_apiserver"
+
+	apiServerPort = "443"
+	anyAddress    = "*"
+)
+
+// RestrictAPIServerStep creates a network security group of masters that
+// allows api server clients, other inbound traffic is left open.
+type RestrictAPIServerStep struct {
+}
+
+func (s *RestrictAPIServerStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	access := cfg.APIServerAccess
+	if len(access.AllowedCIDRs) == 0 && len(access.Applied) == 0 {
+		return nil
+	}
+	log := util.GetLogger(w)
+	sdk := azuresdk.New(cfg.AzureConfig)
+
+	sgs, err := sdk.SecurityGroupsClient()
+	if err != nil {
+		return errors.Wrap(err, RestrictAPIServerStepName)
+	}
+
+	name := fmt.Sprintf("sg-%s-apiserver", cfg.ClusterID)
+	clients := allowedPrefixes(access)
+	log.Infof("[%s] - allow %v to the api server", RestrictAPIServerStepName, clients)
+
+	future, err := sgs.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, name, network.SecurityGroup{
+		Location: toStrPtr(cfg.AzureConfig.Location),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				securityRule("apiserver-clients", 100, network.SecurityRuleAccessAllow,
+					network.SecurityRuleProtocolTCP, apiServerPort, clients),
+				securityRule("apiserver-deny", 110, network.SecurityRuleAccessDeny,
+					network.SecurityRuleProtocolTCP, apiServerPort, []string{anyAddress}),
+				securityRule("allow-inbound", 120, network.SecurityRuleAccessAllow,
+					network.SecurityRuleProtocolAsterisk, anyAddress, []string{anyAddress}),
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "%s create security group %s", RestrictAPIServerStepName, name)
+	}
+	sg, err := future.Result(sgs)
+	if err != nil {
+		return errors.Wrapf(err, "%s create security group %s", RestrictAPIServerStepName, name)
+	}
+	cfg.AzureConfig.SecurityGroupName = name
+
+	nics, err := sdk.NetworkInterfaceClient()
+	if err != nil {
+		return errors.Wrap(err, RestrictAPIServerStepName)
+	}
+
+	// interfaces of masters are named after machines
+	for _, master := range cfg.GetMasters() {
+		nic, err := nics.Get(ctx, cfg.AzureConfig.ResourceGroupName, master.Name, "")
+		if err != nil {
+			return errors.Wrapf(err, "%s get interface %s", RestrictAPIServerStepName, master.Name)
+		}
+		if nic.InterfacePropertiesFormat == nil || nic.NetworkSecurityGroup != nil {
+			continue
+		}
+
+		nic.NetworkSecurityGroup = &network.SecurityGroup{ID: sg.ID}
+		nicFuture, err := nics.CreateOrUpdate(ctx, cfg.AzureConfig.ResourceGroupName, master.Name, nic)
+		if err != nil {
+			return errors.Wrapf(err, "%s update interface %s", RestrictAPIServerStepName, master.Name)
+		}
+		if _, err = nicFuture.Result(nics); err != nil {
+			return errors.Wrapf(err, "%s update interface %s", RestrictAPIServerStepName, master.Name)
+		}
+	}
+
+	return nil
+}
+
+func (*RestrictAPIServerStep) Name() string {
+	return RestrictAPIServerStepName
+}
+
+func (*RestrictAPIServerStep) Description() string {
+	return "Azure: allow clients of the api server"
+}
+
+func (*RestrictAPIServerStep) Depends() []string {
+	return nil
+}
+
+func (*RestrictAPIServerStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// securityGroupID returns an id of the security group of masters.
+func securityGroupID(cfg steps.AzureConfig) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkSecurityGroups/%s",
+		cfg.SubscriptionID, cfg.ResourceGroupName, cfg.SecurityGroupName)
+}
+
+func allowedPrefixes(access steps.APIServerAccess) []string {
+	if len(access.AllowedCIDRs) == 0 {
+		return []string{anyAddress}
+	}
+
+	prefixes := append([]string{}, access.AllowedCIDRs...)
+	if access.ControlCIDR != "" {
+		prefixes = append(prefixes, access.ControlCIDR)
+	}
+	return prefixes
+}
+
+func securityRule(name string, priority int32, access network.SecurityRuleAccess,
+	protocol network.SecurityRuleProtocol, port string, sources []string) network.SecurityRule {
+	return network.SecurityRule{
+		Name: toStrPtr(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                 protocol,
+			SourcePortRange:          toStrPtr(anyAddress),
+			SourceAddressPrefixes:    &sources,
+			DestinationPortRange:     toStrPtr(port),
+			DestinationAddressPrefix: toStrPtr(anyAddress),
+			Access:                   access,
+			Priority:                 &priority,
+			Direction:                network.SecurityRuleDirectionInbound,
+		},
+	}
+}
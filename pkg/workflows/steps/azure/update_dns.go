@@ -0,0 +1,113 @@
+package azure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds/azuresdk"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	UpdateDNSStepName = "azure_update_dns"
+
+	dnsAPIVersion = "2018-05-01"
+	recordSetPath = "/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}" +
+		"/providers/Microsoft.Network/dnsZones/{zoneName}/A/{relativeRecordSetName}"
+)
+
+type aRecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type recordSetProperties struct {
+	TTL      int64     `json:"TTL"`
+	ARecords []aRecord `json:"ARecords"`
+}
+
+type recordSet struct {
+	Properties recordSetProperties `json:"properties"`
+}
+
+// UpdateDNSStep points the azure dns record of the api endpoint to masters
+// of the cluster, the record is removed when there are no masters. The dns
+// package is not a part of the vendored sdk, so the record set api is called directly.
+type UpdateDNSStep struct {
+}
+
+func (s *UpdateDNSStep) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+	dns := cfg.DNSConfig
+	if dns.ZoneID == "" {
+		return errors.Errorf("%s: resource group of the %s zone is not set", UpdateDNSStepName, dns.Domain)
+	}
+
+	client, err := BaseClientFor(azuresdk.New(cfg.AzureConfig), cfg.AzureConfig.SubscriptionID)
+	if err != nil {
+		return errors.Wrap(err, UpdateDNSStepName)
+	}
+
+	pathParameters := map[string]interface{}{
+		"subscriptionId":        autorest.Encode("path", client.SubscriptionID),
+		"resourceGroupName":     autorest.Encode("path", dns.ZoneID),
+		"zoneName":              autorest.Encode("path", dns.Domain),
+		"relativeRecordSetName": autorest.Encode("path", strings.TrimSuffix(dns.Name, "."+dns.Domain)),
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithBaseURL(client.BaseURI),
+		autorest.WithPathParameters(recordSetPath, pathParameters),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": dnsAPIVersion}),
+	}
+	codes := []int{http.StatusOK, http.StatusCreated}
+
+	if len(dns.Addresses) == 0 {
+		log.Infof("[%s] - delete record %s", s.Name(), dns.Name)
+		decorators = append(decorators, autorest.AsDelete())
+		codes = append(codes, http.StatusNoContent)
+	} else {
+		set := recordSet{Properties: recordSetProperties{TTL: dns.TTL}}
+		for _, addr := range dns.Addresses {
+			set.Properties.ARecords = append(set.Properties.ARecords, aRecord{IPv4Address: addr})
+		}
+
+		log.Infof("[%s] - point %s to %v", s.Name(), dns.Name, dns.Addresses)
+		decorators = append(decorators, autorest.AsPut(),
+			autorest.AsContentType("application/json; charset=utf-8"), autorest.WithJSON(set))
+	}
+
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx), decorators...)
+	if err != nil {
+		return errors.Wrapf(err, "%s prepare request", UpdateDNSStepName)
+	}
+
+	resp, err := autorest.SendWithSender(client, req)
+	if err != nil {
+		return errors.Wrapf(err, "%s record %s", UpdateDNSStepName, dns.Name)
+	}
+
+	err = autorest.Respond(resp, azure.WithErrorUnlessStatusCode(codes...), autorest.ByClosing())
+	return errors.Wrapf(err, "%s record %s", UpdateDNSStepName, dns.Name)
+}
+
+func (*UpdateDNSStep) Name() string {
+	return UpdateDNSStepName
+}
+
+func (*UpdateDNSStep) Description() string {
+	return "Azure: Update dns record of the api endpoint"
+}
+
+func (*UpdateDNSStep) Depends() []string {
+	return nil
+}
+
+func (*UpdateDNSStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
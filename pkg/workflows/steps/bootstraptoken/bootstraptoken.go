@@ -0,0 +1,192 @@
+package bootstraptoken
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/bootstrap"
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/runner/ssh"
+	"github.com/supergiant/control/pkg/sgerrors"
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	StepName       = "bootstraptoken"
+	ExpireStepName = "bootstraptoken_expire"
+)
+
+type tokenData struct {
+	Create      bool
+	Token       string
+	ID          string
+	TTL         string
+	Description string
+}
+
+// Step mints a short-lived bootstrap token for a machine that joins
+// the cluster, ExpireStep deletes it once the machine has joined.
+type Step struct {
+	script        *template.Template
+	generateToken func() (string, error)
+	getRunner     func(string, *steps.Config) (runner.Runner, error)
+}
+
+type ExpireStep struct {
+	*Step
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	s := New(tpl)
+	steps.RegisterStep(StepName, s)
+	steps.RegisterStep(ExpireStepName, &ExpireStep{s})
+}
+
+func New(script *template.Template) *Step {
+	return &Step{
+		script:        script,
+		generateToken: bootstrap.GenerateBootstrapToken,
+		getRunner: func(masterIp string, config *steps.Config) (runner.Runner, error) {
+			user := config.Kube.SSHConfig.User
+			if config.Provider == clouds.AWS {
+				// default user of ubuntu images on aws
+				user = "ubuntu"
+			}
+
+			sshRunner, err := ssh.NewRunner(ssh.Config{
+				Host:        masterIp,
+				Port:        config.Kube.SSHConfig.Port,
+				User:        user,
+				Timeout:     10,
+				Key:         []byte(config.Kube.SSHConfig.BootstrapPrivateKey),
+				Passphrase:  config.Kube.SSHConfig.Passphrase,
+				AgentSocket: config.Kube.SSHConfig.AgentSocket,
+			})
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "create ssh runner")
+			}
+
+			return sshRunner, nil
+		},
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	t, err := s.generateToken()
+	if err != nil {
+		return errors.Wrap(err, "generate bootstrap token")
+	}
+
+	// kubeadm init creates the token of the bootstrap master with the ttl
+	if config.IsMaster && config.KubeadmConfig.IsBootstrap {
+		config.KubeadmConfig.Token = t
+		return nil
+	}
+
+	r, err := s.masterRunner(config)
+	if err != nil {
+		return err
+	}
+
+	err = steps.RunTemplate(ctx, s.script, r, out, tokenData{
+		Create:      true,
+		Token:       t,
+		TTL:         ttl(config),
+		Description: fmt.Sprintf("join %s", config.Node.Name),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create bootstrap token")
+	}
+
+	config.KubeadmConfig.Token = t
+
+	return nil
+}
+
+func (s *Step) masterRunner(config *steps.Config) (runner.Runner, error) {
+	master := config.GetMaster()
+	if master == nil {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "master node not found")
+	}
+
+	r, err := s.getRunner(master.PublicIp, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "get runner")
+	}
+
+	return r, nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "mint a bootstrap token for the machine"
+}
+
+func (s *Step) Depends() []string {
+	return nil
+}
+
+// Run deletes the token, a token that can't be deleted expires with its ttl
+// so the machine that has already joined the cluster is not failed.
+func (s *ExpireStep) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	t := config.KubeadmConfig.Token
+	if t == "" {
+		return nil
+	}
+	config.KubeadmConfig.Token = ""
+
+	r := config.Runner
+	if !config.IsMaster || !config.KubeadmConfig.IsBootstrap {
+		var err error
+		if r, err = s.masterRunner(config); err != nil {
+			logrus.Warnf("bootstrap token of %s expires in %s: %v", config.Node.Name, ttl(config), err)
+			return nil
+		}
+	}
+
+	err := steps.RunTemplate(ctx, s.script, r, out, tokenData{
+		ID: strings.Split(t, ".")[0],
+	})
+	if err != nil {
+		logrus.Warnf("bootstrap token of %s expires in %s: %v", config.Node.Name, ttl(config), err)
+	}
+
+	return nil
+}
+
+func (s *ExpireStep) Name() string {
+	return ExpireStepName
+}
+
+func (s *ExpireStep) Description() string {
+	return "delete the bootstrap token of the machine"
+}
+
+func ttl(config *steps.Config) string {
+	if config.KubeadmConfig.TokenTTL == "" {
+		return steps.DefaultBootstrapTokenTTL
+	}
+	return config.KubeadmConfig.TokenTTL
+}
@@ -0,0 +1,200 @@
+package bootstraptoken
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const testToken = "abcdef.0123456789abcdef"
+
+type fakeRunner struct {
+	errMsg string
+	calls  int
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	f.calls++
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func newTestStep(t *testing.T, master *fakeRunner, genErr error) *Step {
+	err := templatemanager.Init("../../../../templates")
+	require.NoError(t, err)
+
+	tpl, err := templatemanager.GetTemplate(StepName)
+	require.NoError(t, err)
+
+	s := New(tpl)
+	s.generateToken = func() (string, error) {
+		return testToken, genErr
+	}
+	s.getRunner = func(string, *steps.Config) (runner.Runner, error) {
+		return master, nil
+	}
+
+	return s
+}
+
+func newTestConfig(t *testing.T, isMaster, isBootstrap, hasMaster bool) *steps.Config {
+	cfg, err := steps.NewConfig("test", "", profile.Profile{})
+	require.NoError(t, err)
+	cfg.IsMaster = isMaster
+	cfg.KubeadmConfig.IsBootstrap = isBootstrap
+	cfg.Node = model.Machine{Name: "node-1"}
+	if hasMaster {
+		cfg.AddMaster(&model.Machine{
+			State:    model.MachineStateActive,
+			PublicIp: "10.20.30.40",
+		})
+	}
+	return cfg
+}
+
+func TestStep_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		isMaster    bool
+		isBootstrap bool
+		hasMaster   bool
+		genErr      error
+		runErr      string
+		expectedErr bool
+		masterCalls int
+		contains    []string
+	}{
+		{
+			name:        "bootstrap master",
+			isMaster:    true,
+			isBootstrap: true,
+		},
+		{
+			name:        "node",
+			hasMaster:   true,
+			masterCalls: 1,
+			contains: []string{
+				"kubeadm token create " + testToken,
+				"--ttl " + steps.DefaultBootstrapTokenTTL,
+				`--description "join node-1"`,
+				"> /dev/null",
+			},
+		},
+		{
+			name:        "master joins",
+			isMaster:    true,
+			hasMaster:   true,
+			masterCalls: 1,
+			contains:    []string{"kubeadm token create " + testToken},
+		},
+		{
+			name:        "no master",
+			expectedErr: true,
+		},
+		{
+			name:        "generate error",
+			hasMaster:   true,
+			genErr:      errors.New("rand"),
+			expectedErr: true,
+		},
+		{
+			name:        "runner error",
+			hasMaster:   true,
+			runErr:      "error",
+			expectedErr: true,
+			masterCalls: 1,
+		},
+	} {
+		master := &fakeRunner{errMsg: tc.runErr}
+		cfg := newTestConfig(t, tc.isMaster, tc.isBootstrap, tc.hasMaster)
+		cfg.Runner = &fakeRunner{}
+
+		output := new(bytes.Buffer)
+		err := newTestStep(t, master, tc.genErr).Run(context.Background(), output, cfg)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.masterCalls, master.calls, "TC: %s", tc.name)
+
+		if tc.expectedErr {
+			require.Empty(t, cfg.KubeadmConfig.Token, "TC: %s", tc.name)
+			continue
+		}
+		require.Equal(t, testToken, cfg.KubeadmConfig.Token, "TC: %s", tc.name)
+		for _, s := range tc.contains {
+			require.Contains(t, output.String(), s, "TC: %s", tc.name)
+		}
+	}
+}
+
+func TestExpireStep_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		isBootstrap bool
+		hasMaster   bool
+		token       string
+		runErr      string
+		localCalls  int
+		masterCalls int
+	}{
+		{
+			name:      "no token",
+			hasMaster: true,
+		},
+		{
+			name:        "bootstrap master",
+			isBootstrap: true,
+			token:       testToken,
+			localCalls:  1,
+		},
+		{
+			name:        "joined master",
+			hasMaster:   true,
+			token:       testToken,
+			masterCalls: 1,
+		},
+		{
+			name:  "no master",
+			token: testToken,
+		},
+		{
+			name:        "runner error",
+			hasMaster:   true,
+			token:       testToken,
+			runErr:      "error",
+			masterCalls: 1,
+		},
+	} {
+		master := &fakeRunner{errMsg: tc.runErr}
+		local := &fakeRunner{}
+		cfg := newTestConfig(t, true, tc.isBootstrap, tc.hasMaster)
+		cfg.Runner = local
+		cfg.KubeadmConfig.Token = tc.token
+
+		output := new(bytes.Buffer)
+		s := &ExpireStep{newTestStep(t, master, nil)}
+		err := s.Run(context.Background(), output, cfg)
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Empty(t, cfg.KubeadmConfig.Token, "TC: %s", tc.name)
+		require.Equal(t, tc.localCalls, local.calls, "TC: %s", tc.name)
+		require.Equal(t, tc.masterCalls, master.calls, "TC: %s", tc.name)
+
+		if tc.localCalls+tc.masterCalls > 0 && tc.runErr == "" {
+			require.Contains(t, output.String(), "kubeadm token delete abcdef", "TC: %s", tc.name)
+			require.NotContains(t, output.String(), testToken, "TC: %s", tc.name)
+		}
+	}
+}
@@ -2,12 +2,11 @@ package steps
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/pkg/errors"
-
-	"github.com/supergiant/control/pkg/bootstrap"
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/model"
 	"github.com/supergiant/control/pkg/profile"
@@ -71,6 +70,11 @@ type GCEConfig struct {
 	AvailabilityZone string `json:"availabilityZone"`
 	Size             string `json:"size"`
 	InstanceGroup    string `json:"instanceGroup"`
+	VolumeSize       string `json:"volumeSize"`
+	VolumeType       string `json:"volumeType"`
+	DataVolumes      string `json:"dataVolumes"`
+	// MastersPlacementPolicy is a url of the spread resource policy of masters
+	MastersPlacementPolicy string `json:"mastersPlacementPolicy"`
 }
 
 type AzureConfig struct {
@@ -84,6 +88,9 @@ type AzureConfig struct {
 	User               string `json:"user"`
 	Password           string `json:"password"`
 	Size               string `json:"size"`
+	SecurityGroupName  string `json:"securityGroupName"`
+	// MastersAvailabilitySet spreads masters over fault domains
+	MastersAvailabilitySet string `json:"mastersAvailabilitySet"`
 }
 
 type PacketConfig struct{}
@@ -105,10 +112,22 @@ type AWSConfig struct {
 	MastersInstanceProfile string `json:"mastersInstanceProfile"`
 	NodesInstanceProfile   string `json:"nodesInstanceProfile"`
 	VolumeSize             string `json:"volumeSize"`
+	VolumeType             string `json:"volumeType"`
+	DataVolumes            string `json:"dataVolumes"`
 	EbsOptimized           string `json:"ebsOptimized"`
 	ImageID                string `json:"image"`
 	InstanceType           string `json:"size"`
 	HasPublicAddr          bool   `json:"hasPublicAddr"`
+	NATGatewayID           string `json:"natGatewayId"`
+	NATSubnetID            string `json:"natSubnetId"`
+	NATRouteTableID        string `json:"natRouteTableId"`
+	EgressAllocationID     string `json:"egressAllocationId"`
+	// MastersPlacementGroup is a spread placement group of masters
+	MastersPlacementGroup string `json:"mastersPlacementGroup"`
+	// Provisioning is set in credentials of accounts that create
+	// networking of clusters as a cloudformation stack.
+	Provisioning string `json:"provisioning"`
+	StackName    string `json:"stackName"`
 	// Map of availability zone to subnet
 	Subnets map[string]string `json:"subnets"`
 	// Map az to route table association
@@ -158,24 +177,225 @@ type PrometheusConfig struct {
 	RBACEnabled bool   `json:"rbacEnabled"`
 }
 
+type GitOpsConfig struct {
+	Tool     string `json:"tool"`
+	RepoURL  string `json:"repoUrl"`
+	Branch   string `json:"branch"`
+	Path     string `json:"path"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 type KubeadmConfig struct {
 	K8SVersion       string `json:"K8SVersion"`
 	IsMaster         bool   `json:"isMaster"`
 	IsBootstrap      bool   `json:"isBootstrap"`
 	CIDR             string `json:"cidr"`
-	Token            string `json:"token"`
 	LoadBalancerHost string `json:"loadBalancerHost"`
+	// APIHost is added to certificates of the api server
+	APIHost string `json:"apiHost"`
+
+	// Token is never stored with tasks, the bootstrap token step mints
+	// a short-lived one for every machine that joins the cluster
+	Token    string `json:"-"`
+	TokenTTL string `json:"tokenTtl"`
+}
+
+// DefaultBootstrapTokenTTL is long enough for a machine to join the cluster.
+const DefaultBootstrapTokenTTL = "30m"
+
+// DefaultDNSTTL is short, so clients follow replaced masters quickly.
+const DefaultDNSTTL = 60
+
+// DNSConfig describes a record of the api endpoint of the cluster.
+type DNSConfig struct {
+	// Name is a fully qualified name of the record
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+	ZoneID string `json:"zoneId"`
+	TTL    int64  `json:"ttl"`
+	// Addresses of masters, an empty list removes the record
+	Addresses []string `json:"addresses"`
+}
+
+// EgressConfig describes a nat gateway of the cluster.
+type EgressConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Destinations []string `json:"destinations"`
+	// IPs are addresses of the nat gateway
+	IPs []string `json:"ips"`
+}
+
+// CostConfig attributes spending of the cluster, a budget is created
+// when the amount isn't zero.
+type CostConfig struct {
+	Tags          map[string]string `json:"tags"`
+	BudgetAmount  float64           `json:"budgetAmount"`
+	Thresholds    []float64         `json:"thresholds"`
+	ContactEmails []string          `json:"contactEmails"`
+}
+
+// HardeningConfig are security settings machines are created with.
+type HardeningConfig struct {
+	MetadataTokensRequired     bool `json:"metadataTokensRequired"`
+	EncryptVolumes             bool `json:"encryptVolumes"`
+	RestrictedInstanceProfiles bool `json:"restrictedInstanceProfiles"`
+}
+
+// DataVolumesConfig lists volumes the machine has been created with,
+// they are formatted and mounted by the data volumes step.
+type DataVolumesConfig struct {
+	Volumes []DataVolumeConfig `json:"volumes"`
+}
+
+type DataVolumeConfig struct {
+	// Devices are paths the volume may appear at on the machine,
+	// the first existing one is used.
+	Devices    []string `json:"devices"`
+	MountPoint string   `json:"mountPoint"`
+}
+
+// FirewallConfig replaces firewall rules of the cluster, the applied rules
+// that are missing in the new ones are removed.
+type FirewallConfig struct {
+	Rules   []model.FirewallRule `json:"rules"`
+	Applied []model.FirewallRule `json:"applied"`
+}
+
+// VolumeCleanupConfig lists orphaned cloud disks of the cluster to delete.
+type VolumeCleanupConfig struct {
+	DiskIDs []string `json:"diskIds"`
+}
+
+// APIServerAccess limits clients of the api server of the cluster.
+type APIServerAccess struct {
+	// AllowedCIDRs are cidrs of clients, an empty list keeps the default exposure
+	AllowedCIDRs []string `json:"allowedCidrs"`
+	// Applied are cidrs firewalls of the cloud allow at the moment
+	Applied []string `json:"applied"`
+	// ControlCIDR is the outbound address of control, it always reaches the api server
+	ControlCIDR string `json:"controlCidr"`
+}
+
+const (
+	DashboardKubernetes = "kubernetes-dashboard"
+	DashboardHeadlamp   = "headlamp"
+)
+
+// DashboardConfig describes a dashboard and a service that serves it,
+// control reaches the service through the service proxy of the api server.
+type DashboardConfig struct {
+	Tool           string `json:"tool"`
+	Namespace      string `json:"namespace"`
+	Service        string `json:"service"`
+	Scheme         string `json:"scheme"`
+	Port           int    `json:"port"`
+	ServiceAccount string `json:"serviceAccount"`
+	ClusterRole    string `json:"clusterRole"`
+}
+
+// ProxyPath returns a path of the dashboard in the api server.
+func (c DashboardConfig) ProxyPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/services/%s:%s:%d/proxy/",
+		c.Namespace, c.Scheme, c.Service, c.Port)
+}
+
+type KubeletConfig struct {
+	MaxPods        int    `json:"maxPods"`
+	EvictionHard   string `json:"evictionHard"`
+	KubeReserved   string `json:"kubeReserved"`
+	SystemReserved string `json:"systemReserved"`
+}
+
+type PatchConfig struct {
+	// Install security updates only instead of upgrading all packages
+	SecurityOnly bool `json:"securityOnly"`
+	// Upgrade docker and containerd to the latest patch release
+	UpgradeRuntime bool `json:"upgradeRuntime"`
+}
+
+type UpgradeConfig struct {
+	// Kubernetes version machines are upgraded to
+	K8SVersion string `json:"k8sVersion"`
+	// Apply upgrades the control plane, it is set for the first master only
+	Apply bool `json:"apply"`
+}
+
+// PeeringConfig describes the network of a cluster that is peered with
+// the cluster of the config.
+type PeeringConfig struct {
+	PeerClusterID string `json:"peerClusterId"`
+	// Cloud side id of the peering, e.g. an id of aws vpc peering connection
+	ConnectionID string      `json:"connectionId"`
+	AWSConfig    AWSConfig   `json:"awsConfig"`
+	AzureConfig  AzureConfig `json:"azureConfig"`
+}
+
+// WireGuardConfig is a configuration of the wireguard interface of a node,
+// an empty list of peers removes the interface.
+type WireGuardConfig struct {
+	Interface  string          `json:"interface"`
+	ListenPort int             `json:"listenPort"`
+	Address    string          `json:"address"`
+	PrivateKey string          `json:"privateKey"`
+	Peers      []WireGuardPeer `json:"peers"`
+}
+
+type WireGuardPeer struct {
+	PublicKey  string   `json:"publicKey"`
+	Endpoint   string   `json:"endpoint"`
+	AllowedIPs []string `json:"allowedIps"`
+}
+
+// SubmarinerConfig configures multi-cluster service discovery of a cluster.
+type SubmarinerConfig struct {
+	Version     string `json:"version"`
+	ClusterID   string `json:"clusterId"`
+	CableDriver string `json:"cableDriver"`
+	Globalnet   bool   `json:"globalnet"`
+	// BrokerInfo is a base64 encoded file written by the broker deployment,
+	// it holds credentials clusters join the broker with.
+	BrokerInfo string `json:"brokerInfo"`
+}
+
+type EtcdMaintenanceConfig struct {
+	// Etcd storage size limit, an alert is raised when database size
+	// is above AlertThreshold percents of it.
+	QuotaBytes     int64 `json:"quotaBytes"`
+	AlertThreshold int   `json:"alertThreshold"`
+	// Database size measured after defragmentation
+	DBSize int64 `json:"dbSize"`
+}
+
+// NodeFile is a file written to nodes, Content is base64 encoded.
+type NodeFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Mode    string `json:"mode"`
+	SHA256  string `json:"sha256"`
+}
+
+type FilesConfig struct {
+	Files []NodeFile `json:"files"`
+	// Replaced files are copied next to them with the suffix
+	BackupSuffix string `json:"backupSuffix"`
+	// Systemd units restarted when any of the files has changed on the node
+	Restart []string `json:"restart"`
 }
 
 type DrainConfig struct {
 	PrivateIP string `json:"privateIp"`
 }
 
+// Map keeps machines of a cluster, copies of a config share the machines
+// and the lock they are guarded with.
 type Map struct {
+	m        *sync.RWMutex
 	internal map[string]*model.Machine
 }
 
 func (m *Map) UnmarshalJSON(b []byte) error {
+	m.m = &sync.RWMutex{}
 	return json.Unmarshal(b, &m.internal)
 }
 
@@ -185,10 +405,20 @@ func (m *Map) MarshalJSON() ([]byte, error) {
 
 func NewMap(m map[string]*model.Machine) Map {
 	return Map{
+		m:        &sync.RWMutex{},
 		internal: m,
 	}
 }
 
+// mu returns the lock of machines, maps that haven't been made with NewMap
+// have no machines to share.
+func (m *Map) mu() *sync.RWMutex {
+	if m.m == nil {
+		return &sync.RWMutex{}
+	}
+	return m.m
+}
+
 type Config struct {
 	Kube model.Kube `json:"kube"`
 
@@ -212,8 +442,30 @@ type Config struct {
 	PostStartConfig    PostStartConfig    `json:"postStartConfig"`
 	TillerConfig       TillerConfig       `json:"tillerConfig"`
 	PrometheusConfig   PrometheusConfig   `json:"prometheusConfig"`
+	GitOpsConfig       GitOpsConfig       `json:"gitopsConfig"`
 	DrainConfig        DrainConfig        `json:"drainConfig"`
 	KubeadmConfig      KubeadmConfig      `json:"kubeadmConfig"`
+	KubeletConfig      KubeletConfig      `json:"kubeletConfig"`
+	PatchConfig        PatchConfig        `json:"patchConfig"`
+	UpgradeConfig      UpgradeConfig      `json:"upgradeConfig"`
+	DNSConfig          DNSConfig          `json:"dnsConfig"`
+	EgressConfig       EgressConfig       `json:"egressConfig"`
+	CostConfig         CostConfig         `json:"costConfig"`
+	HardeningConfig    HardeningConfig    `json:"hardeningConfig"`
+	DataVolumesConfig  DataVolumesConfig  `json:"dataVolumesConfig"`
+	FirewallConfig     FirewallConfig     `json:"firewallConfig"`
+	APIServerAccess    APIServerAccess    `json:"apiServerAccess"`
+	DashboardConfig    DashboardConfig    `json:"dashboardConfig"`
+	VolumeSnapshots    bool               `json:"volumeSnapshots"`
+	SpreadMasters      bool               `json:"spreadMasters"`
+
+	VolumeCleanupConfig VolumeCleanupConfig `json:"volumeCleanupConfig"`
+
+	EtcdMaintenanceConfig EtcdMaintenanceConfig `json:"etcdMaintenanceConfig"`
+	FilesConfig           FilesConfig           `json:"filesConfig"`
+	PeeringConfig         PeeringConfig         `json:"peeringConfig"`
+	WireGuardConfig       WireGuardConfig       `json:"wireguardConfig"`
+	SubmarinerConfig      SubmarinerConfig      `json:"submarinerConfig"`
 
 	ClusterCheckConfig ClusterCheckConfig `json:"clusterCheckConfig"`
 
@@ -225,11 +477,8 @@ type Config struct {
 
 	repository storage.Interface `json:"-"`
 
-	m1      sync.RWMutex
 	Masters Map `json:"masters"`
-
-	m2    sync.RWMutex
-	Nodes Map `json:"nodes"`
+	Nodes   Map `json:"nodes"`
 
 	nodeChan      chan model.Machine
 	kubeStateChan chan model.KubeState
@@ -238,11 +487,7 @@ type Config struct {
 
 // NewConfig builds instance of config for provisioning
 func NewConfig(clusterName, cloudAccountName string, profile profile.Profile) (*Config, error) {
-	token, err := bootstrap.GenerateBootstrapToken()
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "bootstrap token")
-	}
+	dns := NewDNSConfig(clusterName, profile.DNS)
 
 	return &Config{
 		Kube: model.Kube{
@@ -323,9 +568,25 @@ func NewConfig(clusterName, cloudAccountName string, profile profile.Profile) (*
 		KubeadmConfig: KubeadmConfig{
 			K8SVersion:  profile.K8SVersion,
 			IsBootstrap: true,
-			Token:       token,
+			TokenTTL:    DefaultBootstrapTokenTTL,
 			CIDR:        profile.CIDR,
+			APIHost:     dns.Name,
+		},
+		KubeletConfig: NewKubeletConfig(profile.Kubelet),
+		GitOpsConfig:  NewGitOpsConfig(profile.GitOps),
+		DNSConfig:     dns,
+		EgressConfig: EgressConfig{
+			Enabled:      profile.Egress.Enabled,
+			Destinations: profile.Egress.Destinations,
+		},
+		APIServerAccess: APIServerAccess{
+			AllowedCIDRs: profile.APIServerAllowedCIDRs,
 		},
+		DashboardConfig: NewDashboardConfig(profile.Dashboard),
+		VolumeSnapshots: profile.VolumeSnapshots,
+		CostConfig:      NewCostConfig(profile.Cost),
+		HardeningConfig: NewHardeningConfig(profile.Hardening),
+		SpreadMasters:   profile.SpreadMasters,
 
 		Masters: Map{
 			internal: make(map[string]*model.Machine, len(profile.MasterProfiles)),
@@ -343,11 +604,7 @@ func NewConfig(clusterName, cloudAccountName string, profile profile.Profile) (*
 }
 
 func NewConfigFromKube(profile *profile.Profile, k *model.Kube) (*Config, error) {
-	token, err := bootstrap.GenerateBootstrapToken()
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "bootstrap token")
-	}
+	dns := NewDNSConfig(k.Name, k.DNS)
 
 	cfg := &Config{
 		ClusterID:   k.ID,
@@ -429,9 +686,23 @@ func NewConfigFromKube(profile *profile.Profile, k *model.Kube) (*Config, error)
 		KubeadmConfig: KubeadmConfig{
 			K8SVersion:  profile.K8SVersion,
 			IsBootstrap: true,
-			Token:       token,
+			TokenTTL:    DefaultBootstrapTokenTTL,
 			CIDR:        profile.CIDR,
+			APIHost:     dns.Name,
+		},
+		KubeletConfig: NewKubeletConfig(profile.Kubelet),
+		GitOpsConfig:  NewGitOpsConfig(profile.GitOps),
+		DNSConfig:     dns,
+		EgressConfig:  NewEgressConfig(k),
+		APIServerAccess: APIServerAccess{
+			AllowedCIDRs: k.APIServerAllowedCIDRs,
+			Applied:      k.APIServerAllowedCIDRs,
 		},
+		DashboardConfig: NewDashboardConfig(k.Dashboard),
+		VolumeSnapshots: k.VolumeSnapshots,
+		CostConfig:      NewCostConfig(k.Cost),
+		HardeningConfig: NewHardeningConfig(k.Hardening),
+		SpreadMasters:   k.SpreadMasters,
 		Masters: Map{
 			internal: make(map[string]*model.Machine, len(k.Masters)),
 		},
@@ -459,18 +730,127 @@ func NewConfigFromKube(profile *profile.Profile, k *model.Kube) (*Config, error)
 	return cfg, nil
 }
 
+// NewKubeletConfig converts profile kubelet settings to kubelet step config
+func NewKubeletConfig(settings profile.KubeletSettings) KubeletConfig {
+	return KubeletConfig{
+		MaxPods:        settings.MaxPods,
+		EvictionHard:   settings.EvictionHard,
+		KubeReserved:   settings.KubeReserved,
+		SystemReserved: settings.SystemReserved,
+	}
+}
+
+// NewDashboardConfig returns a service of the dashboard tool, only the tool
+// is set for unknown ones.
+func NewDashboardConfig(settings profile.DashboardSettings) DashboardConfig {
+	cfg := DashboardConfig{
+		Tool:        settings.Tool,
+		ClusterRole: settings.ClusterRole,
+	}
+	if cfg.ClusterRole == "" {
+		cfg.ClusterRole = "view"
+	}
+
+	switch settings.Tool {
+	case DashboardKubernetes:
+		cfg.Namespace = "kubernetes-dashboard"
+		cfg.Service = "kubernetes-dashboard"
+		cfg.Scheme = "https"
+		cfg.Port = 443
+		cfg.ServiceAccount = "kubernetes-dashboard"
+	case DashboardHeadlamp:
+		cfg.Namespace = "kube-system"
+		cfg.Service = "headlamp"
+		cfg.Scheme = "http"
+		cfg.Port = 80
+		cfg.ServiceAccount = "headlamp"
+	default:
+		return DashboardConfig{Tool: settings.Tool}
+	}
+
+	return cfg
+}
+
+// NewGitOpsConfig fills defaults that are not set in the profile.
+func NewGitOpsConfig(settings profile.GitOpsSettings) GitOpsConfig {
+	cfg := GitOpsConfig{
+		Tool:     settings.Tool,
+		RepoURL:  settings.RepoURL,
+		Branch:   settings.Branch,
+		Path:     settings.Path,
+		Username: settings.Username,
+		Password: settings.Password,
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = "master"
+	}
+	if cfg.Path == "" {
+		cfg.Path = "."
+	}
+
+	return cfg
+}
+
+// NewDNSConfig names the api endpoint record of the cluster in the zone,
+// the name is empty when the zone is not configured.
+func NewDNSConfig(clusterName string, settings profile.DNSSettings) DNSConfig {
+	cfg := DNSConfig{
+		Domain: strings.TrimSuffix(settings.Domain, "."),
+		ZoneID: settings.ZoneID,
+		TTL:    settings.TTL,
+	}
+	if cfg.Domain != "" {
+		cfg.Name = strings.ToLower(clusterName) + "." + cfg.Domain
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultDNSTTL
+	}
+
+	return cfg
+}
+
+// NewEgressConfig takes the nat gateway settings and addresses of the cluster.
+func NewEgressConfig(k *model.Kube) EgressConfig {
+	return EgressConfig{
+		Enabled:      k.Egress.Enabled,
+		Destinations: k.Egress.Destinations,
+		IPs:          k.EgressIPs,
+	}
+}
+
+// NewCostConfig takes cost center tags and the budget of the cluster.
+func NewCostConfig(s profile.CostSettings) CostConfig {
+	return CostConfig{
+		Tags:          s.Tags,
+		BudgetAmount:  s.Budget.Amount,
+		Thresholds:    s.Budget.Thresholds,
+		ContactEmails: s.Budget.ContactEmails,
+	}
+}
+
+// NewHardeningConfig takes security settings of machines of the cluster.
+func NewHardeningConfig(s profile.HardeningSettings) HardeningConfig {
+	return HardeningConfig{
+		MetadataTokensRequired:     s.MetadataTokensRequired,
+		EncryptVolumes:             s.EncryptVolumes,
+		RestrictedInstanceProfiles: s.RestrictedInstanceProfiles,
+	}
+}
+
 // AddMaster to map of master, map is used because it is reference and can be shared among
 // goroutines that run multiple tasks of cluster deployment
 func (c *Config) AddMaster(n *model.Machine) {
-	c.m1.Lock()
-	defer c.m1.Unlock()
+	mu := c.Masters.mu()
+	mu.Lock()
+	defer mu.Unlock()
 	c.Masters.internal[n.ID] = n
 }
 
 // AddNode to map of nodes in cluster
 func (c *Config) AddNode(n *model.Machine) {
-	c.m2.Lock()
-	defer c.m2.Unlock()
+	mu := c.Nodes.mu()
+	mu.Lock()
+	defer mu.Unlock()
 	c.Nodes.internal[n.ID] = n
 }
 
@@ -481,8 +861,9 @@ func (c *Config) GetMaster() *model.Machine {
 		return &c.Node
 	}
 
-	c.m1.RLock()
-	defer c.m1.RUnlock()
+	mu := c.Masters.mu()
+	mu.RLock()
+	defer mu.RUnlock()
 
 	if len(c.Masters.internal) == 0 {
 		return nil
@@ -499,8 +880,9 @@ func (c *Config) GetMaster() *model.Machine {
 }
 
 func (c *Config) GetMasters() map[string]*model.Machine {
-	c.m1.RLock()
-	defer c.m1.RUnlock()
+	mu := c.Masters.mu()
+	mu.RLock()
+	defer mu.RUnlock()
 
 	m := make(map[string]*model.Machine, len(c.Masters.internal))
 
@@ -512,8 +894,9 @@ func (c *Config) GetMasters() map[string]*model.Machine {
 }
 
 func (c *Config) GetNodes() map[string]*model.Machine {
-	c.m2.RLock()
-	defer c.m2.RUnlock()
+	mu := c.Nodes.mu()
+	mu.RLock()
+	defer mu.RUnlock()
 
 	m := make(map[string]*model.Machine, len(c.Nodes.internal))
 
@@ -526,8 +909,9 @@ func (c *Config) GetNodes() map[string]*model.Machine {
 
 // GetMaster returns first master in master map or nil
 func (c *Config) GetNode() *model.Machine {
-	c.m2.RLock()
-	defer c.m2.RUnlock()
+	mu := c.Nodes.mu()
+	mu.RLock()
+	defer mu.RUnlock()
 
 	if len(c.Nodes.internal) == 0 {
 		return nil
@@ -45,6 +45,23 @@ func TestMarshalConfig(t *testing.T) {
 	}
 }
 
+func TestConfigCopy(t *testing.T) {
+	cfg := &Config{
+		Masters: NewMap(map[string]*model.Machine{}),
+	}
+
+	taskConfig := *cfg
+	taskConfig.AddMaster(&model.Machine{ID: "1", Name: "master-1"})
+
+	if cfg.Masters.m != taskConfig.Masters.m {
+		t.Errorf("Copies of the config must share the lock of masters")
+	}
+
+	if len(cfg.GetMasters()) != 1 {
+		t.Errorf("Master added to the copy not found in masters %v", cfg.GetMasters())
+	}
+}
+
 func TestNewConfig(t *testing.T) {
 	clusterName := "testCluster"
 	cloudAccountName := "cloudAccountName"
@@ -284,6 +301,51 @@ func TestToCloudProviderOpt(t *testing.T) {
 	}
 }
 
+func TestNewDNSConfig(t *testing.T) {
+	for _, tc := range []struct {
+		settings profile.DNSSettings
+		name     string
+		ttl      int64
+	}{
+		{profile.DNSSettings{}, "", DefaultDNSTTL},
+		{profile.DNSSettings{Domain: "example.com."}, "kube.example.com", DefaultDNSTTL},
+		{profile.DNSSettings{Domain: "example.com", TTL: 300}, "kube.example.com", 300},
+	} {
+		cfg := NewDNSConfig("Kube", tc.settings)
+		if cfg.Name != tc.name || cfg.TTL != tc.ttl {
+			t.Errorf("NewDNSConfig(%v) = %s %d, expected %s %d",
+				tc.settings, cfg.Name, cfg.TTL, tc.name, tc.ttl)
+		}
+	}
+}
+
+func TestNewDashboardConfig(t *testing.T) {
+	for _, tc := range []struct {
+		settings profile.DashboardSettings
+		role     string
+		path     string
+	}{
+		{profile.DashboardSettings{}, "", "/api/v1/namespaces//services/::0/proxy/"},
+		{profile.DashboardSettings{Tool: "octant"}, "", "/api/v1/namespaces//services/::0/proxy/"},
+		{
+			profile.DashboardSettings{Tool: DashboardKubernetes},
+			"view",
+			"/api/v1/namespaces/kubernetes-dashboard/services/https:kubernetes-dashboard:443/proxy/",
+		},
+		{
+			profile.DashboardSettings{Tool: DashboardHeadlamp, ClusterRole: "edit"},
+			"edit",
+			"/api/v1/namespaces/kube-system/services/http:headlamp:80/proxy/",
+		},
+	} {
+		cfg := NewDashboardConfig(tc.settings)
+		if cfg.ClusterRole != tc.role || cfg.ProxyPath() != tc.path {
+			t.Errorf("NewDashboardConfig(%v) = %s %s, expected %s %s",
+				tc.settings, cfg.ClusterRole, cfg.ProxyPath(), tc.role, tc.path)
+		}
+	}
+}
+
 func TestNewConfigFromKube(t *testing.T) {
 	expectedMasterCount := 3
 	expectedNodeCount := 5
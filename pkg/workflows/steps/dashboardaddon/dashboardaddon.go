@@ -0,0 +1,77 @@
+package dashboardaddon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/tiller"
+)
+
+const StepName = "dashboardaddon"
+
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(script *template.Template) *Step {
+	t := &Step{
+		script: script,
+	}
+
+	return t
+}
+
+func (s *Step) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	dashboard := cfg.DashboardConfig
+	if dashboard.Tool == "" {
+		log.Infof("[%s] - dashboard is not set, skip", s.Name())
+		return nil
+	}
+	if dashboard.Service == "" {
+		return errors.Errorf("unknown dashboard %s", dashboard.Tool)
+	}
+
+	log.Infof("[%s] - installing %s", s.Name(), dashboard.Tool)
+
+	err := steps.RunTemplate(ctx, s.script, cfg.Runner, w, dashboard)
+	if err != nil {
+		return errors.Wrap(err, "install dashboard addon step")
+	}
+
+	return nil
+}
+
+func (*Step) Name() string {
+	return StepName
+}
+
+func (*Step) Description() string {
+	return "Install a dashboard that is served through control"
+}
+
+func (*Step) Depends() []string {
+	return []string{tiller.StepName}
+}
+
+func (*Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
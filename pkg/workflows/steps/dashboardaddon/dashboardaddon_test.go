@@ -0,0 +1,100 @@
+package dashboardaddon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/profile"
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestStep_Run(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	require.NoError(t, err)
+
+	tpl, err := templatemanager.GetTemplate(StepName)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		settings    profile.DashboardSettings
+		runErr      string
+		expectedErr bool
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:        "not configured",
+			notContains: []string{"kubectl"},
+		},
+		{
+			name:        "unknown tool",
+			settings:    profile.DashboardSettings{Tool: "octant"},
+			expectedErr: true,
+		},
+		{
+			name:     "kubernetes dashboard",
+			settings: profile.DashboardSettings{Tool: steps.DashboardKubernetes},
+			contains: []string{
+				"dashboard/v2.0.0/aio/deploy/recommended.yaml",
+				"--enable-skip-login",
+				"--clusterrole=view",
+				"--serviceaccount=kubernetes-dashboard:kubernetes-dashboard",
+			},
+			notContains: []string{"headlamp"},
+		},
+		{
+			name:     "headlamp",
+			settings: profile.DashboardSettings{Tool: steps.DashboardHeadlamp, ClusterRole: "edit"},
+			contains: []string{
+				"kubernetes-headlamp.yaml",
+				"--clusterrole=edit",
+				"--serviceaccount=kube-system:headlamp",
+				"deployment/headlamp",
+			},
+			notContains: []string{"--enable-skip-login"},
+		},
+		{
+			name:        "runner error",
+			settings:    profile.DashboardSettings{Tool: steps.DashboardHeadlamp},
+			runErr:      "error",
+			expectedErr: true,
+		},
+	} {
+		cfg, err := steps.NewConfig("", "", profile.Profile{Dashboard: tc.settings})
+		require.NoError(t, err, "TC: %s", tc.name)
+		cfg.Runner = &fakeRunner{errMsg: tc.runErr}
+
+		output := new(bytes.Buffer)
+		err = New(tpl).Run(context.Background(), output, cfg)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+
+		for _, s := range tc.contains {
+			require.Contains(t, output.String(), s, "TC: %s", tc.name)
+		}
+		for _, s := range tc.notContains {
+			require.NotContains(t, output.String(), s, "TC: %s", tc.name)
+		}
+	}
+}
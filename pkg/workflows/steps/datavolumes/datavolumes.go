@@ -0,0 +1,68 @@
+package datavolumes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const StepName = "datavolumes"
+
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(script *template.Template) *Step {
+	return &Step{
+		script: script,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	if len(cfg.DataVolumesConfig.Volumes) == 0 {
+		log.Infof("[%s] - machine has no data volumes, skip", s.Name())
+		return nil
+	}
+
+	err := steps.RunTemplate(ctx, s.script, cfg.Runner, w, cfg.DataVolumesConfig)
+	if err != nil {
+		return errors.Wrap(err, "mount data volumes step")
+	}
+
+	return nil
+}
+
+func (*Step) Name() string {
+	return StepName
+}
+
+func (*Step) Description() string {
+	return "Format and mount data volumes"
+}
+
+func (*Step) Depends() []string {
+	return nil
+}
+
+func (*Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package datavolumes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestStep_Run(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	require.NoError(t, err)
+
+	tpl, err := templatemanager.GetTemplate(StepName)
+	require.NoError(t, err)
+
+	volumes := []steps.DataVolumeConfig{
+		{
+			Devices:    []string{"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol1", "/dev/xvdf"},
+			MountPoint: "/var/lib/docker",
+		},
+		{
+			Devices:    []string{"/dev/disk/by-id/google-data-1"},
+			MountPoint: "/data",
+		},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		volumes     []steps.DataVolumeConfig
+		runErr      string
+		expectedErr bool
+		contains    []string
+	}{
+		{
+			name: "no volumes",
+		},
+		{
+			name:    "volumes",
+			volumes: volumes,
+			contains: []string{
+				"for d in /dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol1 /dev/xvdf ; do",
+				"sudo mkdir -p /var/lib/docker",
+				"for d in /dev/disk/by-id/google-data-1 ; do",
+				"${UUID} /data ext4",
+			},
+		},
+		{
+			name:        "runner error",
+			volumes:     volumes,
+			runErr:      "error",
+			expectedErr: true,
+		},
+	} {
+		cfg := &steps.Config{
+			DataVolumesConfig: steps.DataVolumesConfig{Volumes: tc.volumes},
+			Runner:            &fakeRunner{errMsg: tc.runErr},
+		}
+
+		output := new(bytes.Buffer)
+		err = New(tpl).Run(context.Background(), output, cfg)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+
+		for _, s := range tc.contains {
+			require.Contains(t, output.String(), s, "TC: %s", tc.name)
+		}
+		if len(tc.volumes) == 0 {
+			require.NotContains(t, output.String(), "mkfs", "TC: %s", tc.name)
+		}
+	}
+}
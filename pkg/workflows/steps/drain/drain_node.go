@@ -48,11 +48,13 @@ func New(script *template.Template) *Step {
 			}
 
 			cfg := ssh.Config{
-				Host:    masterIp,
-				Port:    config.Kube.SSHConfig.Port,
-				User:    config.Kube.SSHConfig.User,
-				Timeout: 10,
-				Key:     []byte(config.Kube.SSHConfig.BootstrapPrivateKey),
+				Host:        masterIp,
+				Port:        config.Kube.SSHConfig.Port,
+				User:        config.Kube.SSHConfig.User,
+				Timeout:     10,
+				Key:         []byte(config.Kube.SSHConfig.BootstrapPrivateKey),
+				Passphrase:  config.Kube.SSHConfig.Passphrase,
+				AgentSocket: config.Kube.SSHConfig.AgentSocket,
 			}
 
 			sshRunner, err := ssh.NewRunner(cfg)
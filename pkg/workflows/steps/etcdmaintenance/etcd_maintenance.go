@@ -0,0 +1,130 @@
+package etcdmaintenance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+const (
+	StepName = "etcd_maintenance"
+
+	// DefaultQuotaBytes is etcd default storage size limit, 2GB
+	DefaultQuotaBytes = 2 * 1024 * 1024 * 1024
+	// DefaultAlertThreshold is a percentage of quota that triggers an alert
+	DefaultAlertThreshold = 80
+
+	dbSizePrefix = "etcd db size: "
+)
+
+// Step compacts and defragments etcd member that runs on master node
+// and checks how close the database size is to the quota.
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(tpl *template.Template) *Step {
+	return &Step{
+		script: tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	buf := &bytes.Buffer{}
+
+	err := steps.RunTemplate(ctx, s.script, config.Runner, io.MultiWriter(out, buf),
+		struct{ DBSizePrefix string }{dbSizePrefix})
+	if err != nil {
+		return errors.Wrap(err, "etcd maintenance step")
+	}
+
+	dbSize, err := parseDBSize(buf)
+	if err != nil {
+		return errors.Wrap(err, "etcd maintenance step")
+	}
+	config.EtcdMaintenanceConfig.DBSize = dbSize
+
+	if quotaExceeded(config.EtcdMaintenanceConfig) {
+		msg := fmt.Sprintf("etcd member on %s: database size %d bytes is above %d%% of quota %d bytes",
+			config.Node.Name, dbSize, config.EtcdMaintenanceConfig.AlertThreshold,
+			config.EtcdMaintenanceConfig.QuotaBytes)
+		logrus.Warnf("cluster %s: %s", config.ClusterID, msg)
+		fmt.Fprintf(out, "WARNING: %s\n", msg)
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "Compact and defragment etcd member"
+}
+
+func (s *Step) Depends() []string {
+	return []string{ssh.StepName}
+}
+
+func parseDBSize(r io.Reader) (int64, error) {
+	var dbSize int64 = -1
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, dbSizePrefix) {
+			continue
+		}
+
+		size, err := strconv.ParseInt(strings.TrimPrefix(line, dbSizePrefix), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parse %q", line)
+		}
+		dbSize = size
+	}
+
+	if dbSize < 0 {
+		return 0, errors.New("etcd db size not found in output")
+	}
+
+	return dbSize, nil
+}
+
+func quotaExceeded(cfg steps.EtcdMaintenanceConfig) bool {
+	quota, threshold := cfg.QuotaBytes, int64(cfg.AlertThreshold)
+	if quota <= 0 {
+		quota = DefaultQuotaBytes
+	}
+	if threshold <= 0 {
+		threshold = DefaultAlertThreshold
+	}
+
+	return cfg.DBSize*100 >= quota*threshold
+}
@@ -0,0 +1,159 @@
+package etcdmaintenance
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	output string
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script+f.output))
+	return err
+}
+
+func TestEtcdMaintenance(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	testCases := []struct {
+		description string
+		output      string
+		cfg         steps.EtcdMaintenanceConfig
+
+		expectedErr    bool
+		expectedSize   int64
+		expectedAlerts bool
+	}{
+		{
+			description: "db size not found",
+			output:      "\n",
+			expectedErr: true,
+		},
+		{
+			description:  "below threshold",
+			output:       "\n" + dbSizePrefix + "1024\n",
+			expectedSize: 1024,
+		},
+		{
+			description: "above threshold",
+			output:      "\n" + dbSizePrefix + "900\n",
+			cfg: steps.EtcdMaintenanceConfig{
+				QuotaBytes:     1000,
+				AlertThreshold: 80,
+			},
+			expectedSize:   900,
+			expectedAlerts: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+		out := &bytes.Buffer{}
+		cfg := &steps.Config{
+			Runner:                &fakeRunner{output: tc.output},
+			EtcdMaintenanceConfig: tc.cfg,
+		}
+
+		err := New(tpl).Run(context.Background(), out, cfg)
+		if tc.expectedErr != (err != nil) {
+			t.Errorf("unexpected error %v", err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if !strings.Contains(out.String(), "defrag") {
+			t.Errorf("defrag command not found in %s", out.String())
+		}
+
+		if cfg.EtcdMaintenanceConfig.DBSize != tc.expectedSize {
+			t.Errorf("wrong db size expected %d actual %d",
+				tc.expectedSize, cfg.EtcdMaintenanceConfig.DBSize)
+		}
+
+		if alerted := strings.Contains(out.String(), "WARNING"); alerted != tc.expectedAlerts {
+			t.Errorf("wrong alert state expected %v actual %v", tc.expectedAlerts, alerted)
+		}
+	}
+}
+
+func TestEtcdMaintenanceError(t *testing.T) {
+	errMsg := "error has occurred"
+	tpl, _ := template.New(StepName).Parse("")
+	cfg := &steps.Config{
+		Runner: &fakeRunner{errMsg: errMsg},
+	}
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, cfg)
+	if err == nil || !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %v", errMsg, err)
+	}
+}
+
+func TestStepName(t *testing.T) {
+	s := Step{}
+
+	if s.Name() != StepName {
+		t.Errorf("Unexpected step name expected %s actual %s", StepName, s.Name())
+	}
+}
+
+func TestStep_Rollback(t *testing.T) {
+	s := Step{}
+	err := s.Rollback(context.Background(), ioutil.Discard, &steps.Config{})
+
+	if err != nil {
+		t.Errorf("unexpected error while rollback %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	templatemanager.SetTemplate(StepName, &template.Template{})
+	Init()
+	templatemanager.DeleteTemplate(StepName)
+
+	s := steps.GetStep(StepName)
+
+	if s == nil {
+		t.Error("Step not found")
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("recover output must not be nil")
+		}
+	}()
+
+	templatemanager.DeleteTemplate(StepName)
+	Init()
+}
@@ -0,0 +1,68 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+const StepName = "files"
+
+// Step writes files to a node, files are checked against their checksums
+// and the replaced ones are backed up.
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(tpl *template.Template) *Step {
+	return &Step{
+		script: tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	// runners of the agent aren't stored with tasks, restarted ones have none
+	if config.Runner == nil {
+		return errors.New("distribute files step: no runner")
+	}
+
+	err := steps.RunTemplate(ctx, s.script, config.Runner, out, config.FilesConfig)
+	if err != nil {
+		return errors.Wrap(err, "distribute files step")
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "Write files to the node"
+}
+
+func (s *Step) Depends() []string {
+	return []string{ssh.StepName}
+}
@@ -0,0 +1,157 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestFiles(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	testCases := []struct {
+		cfg         steps.FilesConfig
+		expected    []string
+		notExpected []string
+	}{
+		{
+			cfg: steps.FilesConfig{
+				Files: []steps.NodeFile{
+					{
+						Path:    "/etc/docker/daemon.json",
+						Content: "e30K",
+						Mode:    "0644",
+						SHA256:  "ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356",
+					},
+				},
+				BackupSuffix: ".sg-backup-1557187200",
+			},
+			expected: []string{
+				"echo 'e30K' | base64 -d",
+				"ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356  ${TMP}",
+				"'/etc/docker/daemon.json.sg-backup-1557187200'",
+				"install -m 0644 ${TMP} '/etc/docker/daemon.json'",
+			},
+			notExpected: []string{"systemctl restart"},
+		},
+		{
+			cfg: steps.FilesConfig{
+				Files: []steps.NodeFile{
+					{Path: "/etc/sysctl.d/90-sg.conf", Content: "", Mode: "0600"},
+				},
+				Restart: []string{"docker", "kubelet"},
+			},
+			expected: []string{"systemctl restart docker", "systemctl restart kubelet"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		output := new(bytes.Buffer)
+		cfg := &steps.Config{
+			Runner:      &fakeRunner{},
+			FilesConfig: testCase.cfg,
+		}
+
+		task := New(tpl)
+		err = task.Run(context.Background(), output, cfg)
+
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		for _, s := range testCase.expected {
+			if !strings.Contains(output.String(), s) {
+				t.Errorf("%s not found in %s", s, output.String())
+			}
+		}
+
+		for _, s := range testCase.notExpected {
+			if strings.Contains(output.String(), s) {
+				t.Errorf("unexpected %s in %s", s, output.String())
+			}
+		}
+	}
+}
+
+func TestFilesError(t *testing.T) {
+	errMsg := "error has occurred"
+
+	r := &fakeRunner{
+		errMsg: errMsg,
+	}
+
+	tpl, _ := template.New(StepName).Parse("")
+	cfg := &steps.Config{
+		Runner: r,
+	}
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, cfg)
+
+	if err == nil {
+		t.Errorf("Error must not be nil")
+		return
+	}
+
+	if !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %s", errMsg, err.Error())
+	}
+}
+
+func TestStepName(t *testing.T) {
+	s := Step{}
+
+	if s.Name() != StepName {
+		t.Errorf("Unexpected step name expected %s actual %s", StepName, s.Name())
+	}
+}
+
+func TestDepends(t *testing.T) {
+	s := Step{}
+
+	if len(s.Depends()) != 1 || s.Depends()[0] != ssh.StepName {
+		t.Errorf("Wrong dependency list %v expected %v", s.Depends(), []string{ssh.StepName})
+	}
+}
+
+func TestFilesNoRunner(t *testing.T) {
+	tpl, _ := template.New(StepName).Parse("")
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, &steps.Config{})
+	if err == nil {
+		t.Errorf("Error must not be nil")
+	}
+}
@@ -2,12 +2,14 @@ package gce
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"golang.org/x/oauth2/jwt"
 	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/dns/v1"
 
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
@@ -18,6 +20,9 @@ type computeService struct {
 	getInstance         func(context.Context, steps.GCEConfig, string) (*compute.Instance, error)
 	setInstanceMetadata func(context.Context, steps.GCEConfig, string, *compute.Metadata) (*compute.Operation, error)
 	deleteInstance      func(string, string, string) (*compute.Operation, error)
+
+	// insertPlacedInstance inserts an instance with resource policies
+	insertPlacedInstance func(context.Context, steps.GCEConfig, *compute.Instance, []string) (*compute.Operation, error)
 }
 
 func Init() {
@@ -28,9 +33,24 @@ func Init() {
 	steps.RegisterStep(CreateInstanceStepName, createInstance)
 	steps.RegisterStep(DeleteClusterStepName, deleteCluster)
 	steps.RegisterStep(DeleteNodeStepName, deleteNode)
+	steps.RegisterStep(UpdateDNSStepName, NewUpdateDNSStep())
+	steps.RegisterStep(RestrictAPIServerStepName, NewRestrictAPIServerStep())
+	steps.RegisterStep(DeleteFirewallStepName, NewDeleteFirewallStep())
+	steps.RegisterStep(CreatePlacementPolicyStepName, NewCreatePlacementPolicyStep())
+	steps.RegisterStep(DeletePlacementPolicyStepName, NewDeletePlacementPolicyStep())
 }
 
 func GetClient(ctx context.Context, email, privateKey, tokenUri string) (*compute.Service, error) {
+	computeService, err := compute.New(getHTTPClient(ctx, email, privateKey, tokenUri))
+	if err != nil {
+		return nil, err
+	}
+	return computeService, nil
+}
+
+// getHTTPClient authorizes requests of the service account, it's used for
+// compute apis the vendored client doesn't have.
+func getHTTPClient(ctx context.Context, email, privateKey, tokenUri string) *http.Client {
 	clientScopes := []string{
 		compute.ComputeScope,
 		compute.CloudPlatformScope,
@@ -45,10 +65,5 @@ func GetClient(ctx context.Context, email, privateKey, tokenUri string) (*comput
 		TokenURL:   tokenUri,
 	}
 
-	client := conf.Client(ctx)
-	computeService, err := compute.New(client)
-	if err != nil {
-		return nil, err
-	}
-	return computeService, nil
+	return conf.Client(apicalls.ClientContext(ctx))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,12 +14,17 @@ import (
 
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/profile"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows/steps"
 )
 
-const CreateInstanceStepName = "gce_create_instance"
+const (
+	CreateInstanceStepName = "gce_create_instance"
+
+	defaultDiskType = "pd-standard"
+)
 
 type CreateInstanceStep struct {
 	// Client creates the client for the provider.
@@ -54,6 +60,7 @@ func NewCreateInstanceStep(period, timeout time.Duration) (*CreateInstanceStep,
 					return client.Instances.Insert(config.ProjectID,
 						config.AvailabilityZone, instance).Do()
 				},
+				insertPlacedInstance: insertPlacedInstance,
 				getInstance: func(ctx context.Context,
 					config steps.GCEConfig, name string) (*compute.Instance, error) {
 					return client.Instances.Get(config.ProjectID,
@@ -80,6 +87,11 @@ func (s *CreateInstanceStep) Run(ctx context.Context, output io.Writer,
 		return errors.Wrapf(err, "%s getting service caused", CreateInstanceStepName)
 	}
 
+	dataVolumes, err := profile.ParseDataVolumes(config.GCEConfig.DataVolumes)
+	if err != nil {
+		return errors.Wrapf(err, "%s parse data volumes", CreateInstanceStepName)
+	}
+
 	image, err := svc.getFromFamily(ctx, config.GCEConfig)
 
 	if err != nil {
@@ -129,7 +141,7 @@ func (s *CreateInstanceStep) Run(ctx context.Context, output io.Writer,
 		MachineType:  instType.SelfLink,
 		CanIpForward: true,
 		Tags: &compute.Tags{
-			Items: []string{"https-server", "kubernetes"},
+			Items: instanceTags(config),
 		},
 		Metadata: &compute.Metadata{
 			Items: []*compute.MetadataItems{
@@ -151,6 +163,7 @@ func (s *CreateInstanceStep) Run(ctx context.Context, output io.Writer,
 				InitializeParams: &compute.AttachedDiskInitializeParams{
 					DiskName:    name + "-root-pd",
 					SourceImage: image.SelfLink,
+					DiskType:    diskTypeURL(prefix, config.GCEConfig.AvailabilityZone, config.GCEConfig.VolumeType),
 				},
 			},
 		},
@@ -176,8 +189,38 @@ func (s *CreateInstanceStep) Run(ctx context.Context, output io.Writer,
 		},
 	}
 
+	// the size of the image is used when it isn't set
+	if size, _ := strconv.ParseInt(config.GCEConfig.VolumeSize, 10, 64); size > 0 {
+		instance.Disks[0].InitializeParams.DiskSizeGb = size
+	}
+
+	config.DataVolumesConfig.Volumes = nil
+	for i, v := range dataVolumes {
+		deviceName := fmt.Sprintf("data-%d", i)
+		instance.Disks = append(instance.Disks, &compute.AttachedDisk{
+			AutoDelete: true,
+			Type:       "PERSISTENT",
+			DeviceName: deviceName,
+			InitializeParams: &compute.AttachedDiskInitializeParams{
+				DiskName:   fmt.Sprintf("%s-%s-pd", name, deviceName),
+				DiskSizeGb: v.SizeGB,
+				DiskType:   diskTypeURL(prefix, config.GCEConfig.AvailabilityZone, v.Type),
+			},
+		})
+		// guest environment links disks by their device names
+		config.DataVolumesConfig.Volumes = append(config.DataVolumesConfig.Volumes, steps.DataVolumeConfig{
+			Devices:    []string{"/dev/disk/by-id/google-" + deviceName},
+			MountPoint: v.MountPoint,
+		})
+	}
+
 	// create the instance.
-	_, err = svc.insertInstance(ctx, config.GCEConfig, instance)
+	if config.IsMaster && config.GCEConfig.MastersPlacementPolicy != "" {
+		_, err = svc.insertPlacedInstance(ctx, config.GCEConfig, instance,
+			[]string{config.GCEConfig.MastersPlacementPolicy})
+	} else {
+		_, err = svc.insertInstance(ctx, config.GCEConfig, instance)
+	}
 
 	if err != nil {
 		logrus.Errorf("inserting instance caused %v", err)
@@ -257,6 +300,13 @@ func (s *CreateInstanceStep) Run(ctx context.Context, output io.Writer,
 	return nil
 }
 
+func diskTypeURL(prefix, zone, diskType string) string {
+	if diskType == "" {
+		diskType = defaultDiskType
+	}
+	return prefix + "/zones/" + zone + "/diskTypes/" + diskType
+}
+
 func (s *CreateInstanceStep) Name() string {
 	return CreateInstanceStepName
 }
@@ -35,13 +35,23 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 
 		setMetadataErr error
 
-		errMsg string
+		volumeSize      string
+		dataVolumes     string
+		placementPolicy string
+
+		errMsg        string
+		expectedDisks []string
 	}{
 		{
 			description: "get service error",
 			getSvcErr:   errors.New("message1"),
 			errMsg:      "message1",
 		},
+		{
+			description: "wrong data volumes",
+			dataVolumes: "0::/data",
+			errMsg:      "positive number",
+		},
 		{
 			description: "get image error",
 			getImageErr: errors.New("message2"),
@@ -105,6 +115,56 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 			},
 			errMsg: sgerrors.ErrTimeoutExceeded.Error(),
 		},
+		{
+			description: "success data volumes",
+			image: &compute.Image{
+				Id: 1234,
+			},
+			machineType: &compute.MachineType{
+				SelfLink: "https://itsme.com",
+			},
+			instance: &compute.Instance{
+				Status:   "RUNNING",
+				Metadata: &compute.Metadata{},
+				NetworkInterfaces: []*compute.NetworkInterface{
+					{
+						NetworkIP: "10.20.30.40",
+						AccessConfigs: []*compute.AccessConfig{
+							{
+								NatIP: "11.22.33.44",
+							},
+						},
+					},
+				},
+			},
+			volumeSize:    "50",
+			dataVolumes:   "100:pd-ssd:/var/lib/docker",
+			expectedDisks: []string{"pd-standard", "pd-ssd"},
+		},
+		{
+			description: "success spread masters",
+			image: &compute.Image{
+				Id: 1234,
+			},
+			machineType: &compute.MachineType{
+				SelfLink: "https://itsme.com",
+			},
+			instance: &compute.Instance{
+				Status:   "RUNNING",
+				Metadata: &compute.Metadata{},
+				NetworkInterfaces: []*compute.NetworkInterface{
+					{
+						NetworkIP: "10.20.30.40",
+						AccessConfigs: []*compute.AccessConfig{
+							{
+								NatIP: "11.22.33.44",
+							},
+						},
+					},
+				},
+			},
+			placementPolicy: "projects/p/regions/us-east1/resourcePolicies/masters",
+		},
 		{
 			description: "success",
 			image: &compute.Image{
@@ -132,6 +192,8 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 
 	for _, testCase := range testCases {
 		t.Log(testCase.description)
+		var inserted *compute.Instance
+		var policies []string
 
 		step := &CreateInstanceStep{
 			checkPeriod:     time.Nanosecond,
@@ -145,7 +207,13 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 					getMachineTypes: func(context.Context, steps.GCEConfig) (*compute.MachineType, error) {
 						return testCase.machineType, testCase.getMachineTypeErr
 					},
-					insertInstance: func(context.Context, steps.GCEConfig, *compute.Instance) (*compute.Operation, error) {
+					insertInstance: func(_ context.Context, _ steps.GCEConfig, instance *compute.Instance) (*compute.Operation, error) {
+						inserted = instance
+						return nil, testCase.insertErr
+					},
+					insertPlacedInstance: func(_ context.Context, _ steps.GCEConfig, instance *compute.Instance, p []string) (*compute.Operation, error) {
+						inserted = instance
+						policies = p
 						return nil, testCase.insertErr
 					},
 					getInstance: func(context.Context, steps.GCEConfig, string) (*compute.Instance, error) {
@@ -159,6 +227,7 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 		}
 
 		for _, role := range []bool{true, false} {
+			policies = nil
 			config, err := steps.NewConfig("", "", profile.Profile{})
 
 			if err != nil {
@@ -169,6 +238,10 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 			config.ClusterName = util.RandomString(8)
 			config.ClusterID = uuid.New()[:8]
 			config.IsMaster = role
+			config.GCEConfig.AvailabilityZone = "us-east1-b"
+			config.GCEConfig.VolumeSize = testCase.volumeSize
+			config.GCEConfig.DataVolumes = testCase.dataVolumes
+			config.GCEConfig.MastersPlacementPolicy = testCase.placementPolicy
 
 			ctx, cancel := context.WithCancel(context.Background())
 
@@ -192,6 +265,34 @@ func TestCreateInstanceStep_Run(t *testing.T) {
 				t.Errorf("Error message %s does not contain %s",
 					err.Error(), testCase.errMsg)
 			}
+
+			if testCase.placementPolicy != "" {
+				if role && (len(policies) != 1 || policies[0] != testCase.placementPolicy) {
+					t.Errorf("master must be placed with policy %s actual %v", testCase.placementPolicy, policies)
+				}
+				if !role && policies != nil {
+					t.Errorf("node must not be placed with policies %v", policies)
+				}
+			}
+
+			if testCase.expectedDisks == nil {
+				continue
+			}
+			if len(inserted.Disks) != len(testCase.expectedDisks) {
+				t.Fatalf("expected %d disks actual %d", len(testCase.expectedDisks), len(inserted.Disks))
+			}
+			for i, d := range inserted.Disks {
+				if !strings.HasSuffix(d.InitializeParams.DiskType, "/zones/us-east1-b/diskTypes/"+testCase.expectedDisks[i]) {
+					t.Errorf("wrong type of disk %d %s", i, d.InitializeParams.DiskType)
+				}
+			}
+			if inserted.Disks[0].InitializeParams.DiskSizeGb != 50 {
+				t.Errorf("wrong size of the root disk %d", inserted.Disks[0].InitializeParams.DiskSizeGb)
+			}
+			if len(config.DataVolumesConfig.Volumes) != 1 ||
+				config.DataVolumesConfig.Volumes[0].Devices[0] != "/dev/disk/by-id/google-data-0" {
+				t.Errorf("wrong data volumes %v", config.DataVolumesConfig.Volumes)
+			}
 		}
 	}
 }
@@ -0,0 +1,279 @@
+package gce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	CreatePlacementPolicyStepName = "gce_create_placement_policy"
+	DeletePlacementPolicyStepName = "gce_delete_placement_policy"
+
+	// masters are spread over availability domains of the zone round-robin
+	spreadDomainCount = 3
+)
+
+var (
+	placementPolicyPollInterval = time.Second * 10
+	placementPolicyAttemptCount = 30
+)
+
+// resourcePolicy and resource policy calls are missing in the vendored compute client.
+type resourcePolicy struct {
+	Name                 string                `json:"name"`
+	Description          string                `json:"description,omitempty"`
+	GroupPlacementPolicy *groupPlacementPolicy `json:"groupPlacementPolicy"`
+}
+
+type groupPlacementPolicy struct {
+	AvailabilityDomainCount int64 `json:"availabilityDomainCount"`
+}
+
+type placementService struct {
+	insertPolicy func(ctx context.Context, region string, policy *resourcePolicy) error
+	deletePolicy func(ctx context.Context, policyURL string) error
+}
+
+func newPlacementService(ctx context.Context, config steps.GCEConfig) (*placementService, error) {
+	httpClient := getHTTPClient(ctx, config.ClientEmail, config.PrivateKey, config.TokenURI)
+	client, err := compute.New(httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &placementService{
+		insertPolicy: func(ctx context.Context, region string, policy *resourcePolicy) error {
+			op, err := doCompute(ctx, httpClient, http.MethodPost,
+				fmt.Sprintf("%s%s/regions/%s/resourcePolicies", client.BasePath, config.ProjectID, region), policy)
+			if err != nil {
+				return err
+			}
+
+			// instances can't refer to the policy until it's created
+			for op.Status != "DONE" {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Second):
+				}
+				op, err = client.RegionOperations.Get(config.ProjectID, region, op.Name).Context(ctx).Do()
+				if err != nil {
+					return err
+				}
+			}
+			if op.Error != nil && len(op.Error.Errors) > 0 {
+				return errors.New(op.Error.Errors[0].Message)
+			}
+			return nil
+		},
+		deletePolicy: func(ctx context.Context, policyURL string) error {
+			_, err := doCompute(ctx, httpClient, http.MethodDelete, policyURL, nil)
+			return err
+		},
+	}, nil
+}
+
+// insertPlacedInstance creates an instance with resource policies, the field
+// isn't known to compute.Instance of the vendored client.
+func insertPlacedInstance(ctx context.Context, config steps.GCEConfig,
+	instance *compute.Instance, policies []string) (*compute.Operation, error) {
+	httpClient := getHTTPClient(ctx, config.ClientEmail, config.PrivateKey, config.TokenURI)
+	client, err := compute.New(httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(instance)
+	if err != nil {
+		return nil, err
+	}
+	body := make(map[string]interface{})
+	if err = json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	body["resourcePolicies"] = policies
+
+	return doCompute(ctx, httpClient, http.MethodPost,
+		fmt.Sprintf("%s%s/zones/%s/instances", client.BasePath, config.ProjectID, config.AvailabilityZone), body)
+}
+
+func doCompute(ctx context.Context, client *http.Client, method, url string, body interface{}) (*compute.Operation, error) {
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err = googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	op := &compute.Operation{}
+	if err = json.NewDecoder(resp.Body).Decode(op); err != nil {
+		return nil, errors.Wrap(err, "decode operation")
+	}
+	return op, nil
+}
+
+// zoneRegion returns a region of the zone, e.g. us-east1 of us-east1-b.
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// MastersPlacementPolicyName is unique in the region of the project.
+func MastersPlacementPolicyName(clusterID string) string {
+	return "sg-" + strings.ToLower(clusterID) + "-masters"
+}
+
+// CreatePlacementPolicyStep creates a spread placement policy of masters,
+// masters in distinct availability domains don't share hosts and power.
+type CreatePlacementPolicyStep struct {
+	getSvc func(context.Context, steps.GCEConfig) (*placementService, error)
+}
+
+func NewCreatePlacementPolicyStep() *CreatePlacementPolicyStep {
+	return &CreatePlacementPolicyStep{
+		getSvc: newPlacementService,
+	}
+}
+
+func (s *CreatePlacementPolicyStep) Run(ctx context.Context, w io.Writer, config *steps.Config) error {
+	log := util.GetLogger(w)
+	if !config.SpreadMasters || config.GCEConfig.MastersPlacementPolicy != "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(ctx, config.GCEConfig)
+	if err != nil {
+		return errors.Wrapf(err, "%s get service", CreatePlacementPolicyStepName)
+	}
+
+	region := zoneRegion(config.GCEConfig.AvailabilityZone)
+	name := MastersPlacementPolicyName(config.ClusterID)
+	log.Infof("[%s] - create spread placement policy %s in %s", s.Name(), name, region)
+	err = svc.insertPolicy(ctx, region, &resourcePolicy{
+		Name:        name,
+		Description: "Masters of cluster " + config.ClusterName,
+		GroupPlacementPolicy: &groupPlacementPolicy{
+			AvailabilityDomainCount: spreadDomainCount,
+		},
+	})
+	if err != nil {
+		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != http.StatusConflict {
+			return errors.Wrapf(err, "%s create policy %s", CreatePlacementPolicyStepName, name)
+		}
+	}
+
+	config.GCEConfig.MastersPlacementPolicy = fmt.Sprintf("projects/%s/regions/%s/resourcePolicies/%s",
+		config.GCEConfig.ProjectID, region, name)
+	return nil
+}
+
+func (s *CreatePlacementPolicyStep) Name() string {
+	return CreatePlacementPolicyStepName
+}
+
+func (s *CreatePlacementPolicyStep) Depends() []string {
+	return nil
+}
+
+func (s *CreatePlacementPolicyStep) Description() string {
+	return "Create spread placement policy of masters"
+}
+
+func (s *CreatePlacementPolicyStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// DeletePlacementPolicyStep deletes the placement policy of masters once
+// deleted masters don't use it.
+type DeletePlacementPolicyStep struct {
+	getSvc func(context.Context, steps.GCEConfig) (*placementService, error)
+}
+
+func NewDeletePlacementPolicyStep() *DeletePlacementPolicyStep {
+	return &DeletePlacementPolicyStep{
+		getSvc: newPlacementService,
+	}
+}
+
+func (s *DeletePlacementPolicyStep) Run(ctx context.Context, w io.Writer, config *steps.Config) error {
+	log := util.GetLogger(w)
+	policy := config.GCEConfig.MastersPlacementPolicy
+	if policy == "" {
+		return nil
+	}
+
+	svc, err := s.getSvc(ctx, config.GCEConfig)
+	if err != nil {
+		return errors.Wrapf(err, "%s get service", DeletePlacementPolicyStepName)
+	}
+
+	log.Infof("[%s] - delete placement policy %s", s.Name(), policy)
+	for i := 0; i < placementPolicyAttemptCount; i++ {
+		err = svc.deletePolicy(ctx, "https://www.googleapis.com/compute/v1/"+policy)
+		if err == nil || isNotFound(err) {
+			config.GCEConfig.MastersPlacementPolicy = ""
+			return nil
+		}
+		// the policy is in use until masters are deleted
+		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != http.StatusBadRequest {
+			return errors.Wrapf(err, "%s delete policy %s", DeletePlacementPolicyStepName, policy)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(placementPolicyPollInterval):
+		}
+	}
+
+	return errors.Errorf("%s: policy %s is still in use", DeletePlacementPolicyStepName, policy)
+}
+
+func (s *DeletePlacementPolicyStep) Name() string {
+	return DeletePlacementPolicyStepName
+}
+
+func (s *DeletePlacementPolicyStep) Depends() []string {
+	return nil
+}
+
+func (s *DeletePlacementPolicyStep) Description() string {
+	return "Delete spread placement policy of masters"
+}
+
+func (s *DeletePlacementPolicyStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,187 @@
+package gce
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestZoneRegion(t *testing.T) {
+	require.Equal(t, "us-east1", zoneRegion("us-east1-b"))
+	require.Equal(t, "europe-west4", zoneRegion("europe-west4-a"))
+	require.Equal(t, "zone", zoneRegion("zone"))
+}
+
+func TestCreatePlacementPolicyStep_Run(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		spread    bool
+		existing  string
+		getSvcErr error
+		insertErr error
+
+		inserted       bool
+		expectedPolicy string
+		hasErr         bool
+	}{
+		{
+			name: "spread is disabled",
+		},
+		{
+			name:           "policy exists",
+			spread:         true,
+			existing:       "projects/p/regions/us-east1/resourcePolicies/existing",
+			expectedPolicy: "projects/p/regions/us-east1/resourcePolicies/existing",
+		},
+		{
+			name:      "get service error",
+			spread:    true,
+			getSvcErr: errors.New("error"),
+			hasErr:    true,
+		},
+		{
+			name:      "insert error",
+			spread:    true,
+			insertErr: errors.New("error"),
+			inserted:  true,
+			hasErr:    true,
+		},
+		{
+			name:           "already created",
+			spread:         true,
+			insertErr:      &googleapi.Error{Code: http.StatusConflict},
+			inserted:       true,
+			expectedPolicy: "projects/p/regions/us-east1/resourcePolicies/sg-1234-masters",
+		},
+		{
+			name:           "success",
+			spread:         true,
+			inserted:       true,
+			expectedPolicy: "projects/p/regions/us-east1/resourcePolicies/sg-1234-masters",
+		},
+	} {
+		var inserted *resourcePolicy
+		var region string
+		step := &CreatePlacementPolicyStep{
+			getSvc: func(context.Context, steps.GCEConfig) (*placementService, error) {
+				return &placementService{
+					insertPolicy: func(_ context.Context, r string, p *resourcePolicy) error {
+						inserted, region = p, r
+						return tc.insertErr
+					},
+				}, tc.getSvcErr
+			},
+		}
+
+		cfg := &steps.Config{
+			ClusterID:     "1234",
+			SpreadMasters: tc.spread,
+			GCEConfig: steps.GCEConfig{
+				ProjectID:              "p",
+				AvailabilityZone:       "us-east1-b",
+				MastersPlacementPolicy: tc.existing,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.inserted, inserted != nil, "TC: %s", tc.name)
+		if inserted != nil {
+			require.Equal(t, "us-east1", region, "TC: %s", tc.name)
+			require.Equal(t, "sg-1234-masters", inserted.Name, "TC: %s", tc.name)
+			require.Equal(t, int64(spreadDomainCount), inserted.GroupPlacementPolicy.AvailabilityDomainCount, "TC: %s", tc.name)
+		}
+		require.Equal(t, tc.expectedPolicy, cfg.GCEConfig.MastersPlacementPolicy, "TC: %s", tc.name)
+	}
+}
+
+func TestDeletePlacementPolicyStep_Run(t *testing.T) {
+	placementPolicyPollInterval = time.Nanosecond
+	placementPolicyAttemptCount = 2
+
+	inUse := &googleapi.Error{Code: http.StatusBadRequest}
+	for _, tc := range []struct {
+		name      string
+		policy    string
+		getSvcErr error
+		deleteErr []error
+
+		expectedCalls  int
+		expectedPolicy string
+		hasErr         bool
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:           "get service error",
+			policy:         "projects/p/regions/r/resourcePolicies/masters",
+			getSvcErr:      errors.New("error"),
+			expectedPolicy: "projects/p/regions/r/resourcePolicies/masters",
+			hasErr:         true,
+		},
+		{
+			name:           "delete error",
+			policy:         "projects/p/regions/r/resourcePolicies/masters",
+			deleteErr:      []error{errors.New("error")},
+			expectedCalls:  1,
+			expectedPolicy: "projects/p/regions/r/resourcePolicies/masters",
+			hasErr:         true,
+		},
+		{
+			name:           "still in use",
+			policy:         "projects/p/regions/r/resourcePolicies/masters",
+			deleteErr:      []error{inUse, inUse},
+			expectedCalls:  2,
+			expectedPolicy: "projects/p/regions/r/resourcePolicies/masters",
+			hasErr:         true,
+		},
+		{
+			name:          "not found",
+			policy:        "projects/p/regions/r/resourcePolicies/masters",
+			deleteErr:     []error{&googleapi.Error{Code: http.StatusNotFound}},
+			expectedCalls: 1,
+		},
+		{
+			name:          "deleted after masters",
+			policy:        "projects/p/regions/r/resourcePolicies/masters",
+			deleteErr:     []error{inUse, nil},
+			expectedCalls: 2,
+		},
+	} {
+		var calls int
+		step := &DeletePlacementPolicyStep{
+			getSvc: func(context.Context, steps.GCEConfig) (*placementService, error) {
+				return &placementService{
+					deletePolicy: func(_ context.Context, url string) error {
+						require.Equal(t, "https://www.googleapis.com/compute/v1/"+tc.policy, url, "TC: %s", tc.name)
+						calls++
+						if calls > len(tc.deleteErr) {
+							return nil
+						}
+						return tc.deleteErr[calls-1]
+					},
+				}, tc.getSvcErr
+			},
+		}
+
+		cfg := &steps.Config{
+			GCEConfig: steps.GCEConfig{
+				MastersPlacementPolicy: tc.policy,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, cfg)
+		require.Equal(t, tc.hasErr, err != nil, "TC: %s: %v", tc.name, err)
+		require.Equal(t, tc.expectedCalls, calls, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedPolicy, cfg.GCEConfig.MastersPlacementPolicy, "TC: %s", tc.name)
+	}
+}
@@ -0,0 +1,256 @@
+package gce
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	RestrictAPIServerStepName = "gce_restrict_apiserver"
+	DeleteFirewallStepName    = "gce_delete_firewall"
+
+	// httpsTag opens 443 with the default firewall rule of a project
+	httpsTag      = "https-server"
+	apiServerPort = "443"
+	anyAddress    = "0.0.0.0/0"
+)
+
+type firewallService struct {
+	getFirewall    func(ctx context.Context, name string) (*compute.Firewall, error)
+	insertFirewall func(ctx context.Context, fw *compute.Firewall) error
+	updateFirewall func(ctx context.Context, fw *compute.Firewall) error
+	deleteFirewall func(ctx context.Context, name string) error
+	getInstance    func(ctx context.Context, zone, name string) (*compute.Instance, error)
+	setTags        func(ctx context.Context, zone, name string, tags *compute.Tags) error
+}
+
+func newFirewallService(ctx context.Context, config steps.GCEConfig) (*firewallService, error) {
+	client, err := GetClient(ctx, config.ClientEmail, config.PrivateKey, config.TokenURI)
+	if err != nil {
+		return nil, err
+	}
+
+	return &firewallService{
+		getFirewall: func(ctx context.Context, name string) (*compute.Firewall, error) {
+			fw, err := client.Firewalls.Get(config.ProjectID, name).Context(ctx).Do()
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return fw, err
+		},
+		insertFirewall: func(ctx context.Context, fw *compute.Firewall) error {
+			_, err := client.Firewalls.Insert(config.ProjectID, fw).Context(ctx).Do()
+			return err
+		},
+		updateFirewall: func(ctx context.Context, fw *compute.Firewall) error {
+			_, err := client.Firewalls.Update(config.ProjectID, fw.Name, fw).Context(ctx).Do()
+			return err
+		},
+		deleteFirewall: func(ctx context.Context, name string) error {
+			_, err := client.Firewalls.Delete(config.ProjectID, name).Context(ctx).Do()
+			if isNotFound(err) {
+				return nil
+			}
+			return err
+		},
+		getInstance: func(ctx context.Context, zone, name string) (*compute.Instance, error) {
+			return client.Instances.Get(config.ProjectID, zone, name).Context(ctx).Do()
+		},
+		setTags: func(ctx context.Context, zone, name string, tags *compute.Tags) error {
+			_, err := client.Instances.SetTags(config.ProjectID, zone, name, tags).Context(ctx).Do()
+			return err
+		},
+	}, nil
+}
+
+// RestrictAPIServerStep replaces the project wide https rule of masters
+// with a firewall rule of the cluster that allows api server clients.
+type RestrictAPIServerStep struct {
+	getSvc func(context.Context, steps.GCEConfig) (*firewallService, error)
+}
+
+func NewRestrictAPIServerStep() *RestrictAPIServerStep {
+	return &RestrictAPIServerStep{
+		getSvc: newFirewallService,
+	}
+}
+
+func (s *RestrictAPIServerStep) Run(ctx context.Context, output io.Writer, config *steps.Config) error {
+	access := config.APIServerAccess
+	if len(access.AllowedCIDRs) == 0 && len(access.Applied) == 0 {
+		return nil
+	}
+	log := util.GetLogger(output)
+
+	svc, err := s.getSvc(ctx, config.GCEConfig)
+	if err != nil {
+		return errors.Wrapf(err, "%s get service", RestrictAPIServerStepName)
+	}
+
+	fw := &compute.Firewall{
+		Name:        apiServerTag(config.ClusterID),
+		Description: "Api server clients of the cluster " + config.ClusterName,
+		Direction:   "INGRESS",
+		Allowed: []*compute.FirewallAllowed{
+			{
+				IPProtocol: "tcp",
+				Ports:      []string{apiServerPort},
+			},
+		},
+		SourceRanges: sourceRanges(access),
+		TargetTags:   []string{apiServerTag(config.ClusterID)},
+	}
+
+	current, err := svc.getFirewall(ctx, fw.Name)
+	if err != nil {
+		return errors.Wrapf(err, "%s get firewall %s", RestrictAPIServerStepName, fw.Name)
+	}
+
+	log.Infof("[%s] - allow %v to the api server", s.Name(), fw.SourceRanges)
+	if current == nil {
+		err = svc.insertFirewall(ctx, fw)
+	} else {
+		// network of a rule can't be changed
+		fw.Network = current.Network
+		err = svc.updateFirewall(ctx, fw)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s save firewall %s", RestrictAPIServerStepName, fw.Name)
+	}
+
+	// masters that have been created with the https tag are retagged
+	for _, master := range config.GetMasters() {
+		instance, err := svc.getInstance(ctx, master.Region, master.Name)
+		if err != nil {
+			return errors.Wrapf(err, "%s get instance %s", RestrictAPIServerStepName, master.Name)
+		}
+		if instance.Tags == nil || !replaceTag(instance.Tags, httpsTag, fw.Name) {
+			continue
+		}
+
+		if err = svc.setTags(ctx, master.Region, master.Name, instance.Tags); err != nil {
+			return errors.Wrapf(err, "%s set tags of %s", RestrictAPIServerStepName, master.Name)
+		}
+	}
+
+	return nil
+}
+
+func (s *RestrictAPIServerStep) Name() string {
+	return RestrictAPIServerStepName
+}
+
+func (s *RestrictAPIServerStep) Depends() []string {
+	return nil
+}
+
+func (s *RestrictAPIServerStep) Description() string {
+	return "Google compute engine: allow clients of the api server"
+}
+
+func (s *RestrictAPIServerStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// DeleteFirewallStep removes the api server firewall rule of the cluster.
+type DeleteFirewallStep struct {
+	getSvc func(context.Context, steps.GCEConfig) (*firewallService, error)
+}
+
+func NewDeleteFirewallStep() *DeleteFirewallStep {
+	return &DeleteFirewallStep{
+		getSvc: newFirewallService,
+	}
+}
+
+func (s *DeleteFirewallStep) Run(ctx context.Context, output io.Writer, config *steps.Config) error {
+	if len(config.APIServerAccess.Applied) == 0 && len(config.APIServerAccess.AllowedCIDRs) == 0 {
+		return nil
+	}
+
+	svc, err := s.getSvc(ctx, config.GCEConfig)
+	if err != nil {
+		return errors.Wrapf(err, "%s get service", DeleteFirewallStepName)
+	}
+
+	name := apiServerTag(config.ClusterID)
+	if err = svc.deleteFirewall(ctx, name); err != nil {
+		return errors.Wrapf(err, "%s delete firewall %s", DeleteFirewallStepName, name)
+	}
+
+	return nil
+}
+
+func (s *DeleteFirewallStep) Name() string {
+	return DeleteFirewallStepName
+}
+
+func (s *DeleteFirewallStep) Depends() []string {
+	return nil
+}
+
+func (s *DeleteFirewallStep) Description() string {
+	return "Google compute engine: delete the api server firewall rule"
+}
+
+func (s *DeleteFirewallStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// instanceTags returns network tags of a new machine, masters of clusters with
+// an allow-list are not exposed with the https tag.
+func instanceTags(config *steps.Config) []string {
+	if config.IsMaster && len(config.APIServerAccess.AllowedCIDRs) > 0 {
+		return []string{apiServerTag(config.ClusterID), "kubernetes"}
+	}
+	return []string{httpsTag, "kubernetes"}
+}
+
+func apiServerTag(clusterID string) string {
+	return "sg-" + strings.ToLower(clusterID) + "-apiserver"
+}
+
+func sourceRanges(access steps.APIServerAccess) []string {
+	if len(access.AllowedCIDRs) == 0 {
+		return []string{anyAddress}
+	}
+
+	ranges := append([]string{}, access.AllowedCIDRs...)
+	if access.ControlCIDR != "" {
+		ranges = append(ranges, access.ControlCIDR)
+	}
+	return ranges
+}
+
+func replaceTag(tags *compute.Tags, old, tag string) bool {
+	found := false
+	items := make([]string, 0, len(tags.Items))
+	for _, item := range tags.Items {
+		if item == tag {
+			return false
+		}
+		if item == old {
+			found = true
+			item = tag
+		}
+		items = append(items, item)
+	}
+	if found {
+		tags.Items = items
+	}
+	return found
+}
+
+func isNotFound(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && gerr.Code == http.StatusNotFound
+}
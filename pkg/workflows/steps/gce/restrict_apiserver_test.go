@@ -0,0 +1,145 @@
+package gce
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestRestrictAPIServerStep_Run(t *testing.T) {
+	testCases := []struct {
+		description string
+		access      steps.APIServerAccess
+		current     *compute.Firewall
+		tags        []string
+		getSvcErr   error
+		saveErr     error
+		inserted    bool
+		updated     bool
+		ranges      []string
+		retagged    bool
+		errMsg      string
+	}{
+		{
+			description: "no allow-list",
+		},
+		{
+			description: "get service error",
+			access:      steps.APIServerAccess{AllowedCIDRs: []string{"203.0.113.0/24"}},
+			getSvcErr:   errors.New("error1"),
+			errMsg:      "error1",
+		},
+		{
+			description: "create",
+			access: steps.APIServerAccess{
+				AllowedCIDRs: []string{"203.0.113.0/24"},
+				ControlCIDR:  "198.51.100.1/32",
+			},
+			tags:     []string{"sg-kube-apiserver", "kubernetes"},
+			inserted: true,
+			ranges:   []string{"203.0.113.0/24", "198.51.100.1/32"},
+		},
+		{
+			description: "retag masters",
+			access:      steps.APIServerAccess{AllowedCIDRs: []string{"203.0.113.0/24"}},
+			tags:        []string{httpsTag, "kubernetes"},
+			inserted:    true,
+			ranges:      []string{"203.0.113.0/24"},
+			retagged:    true,
+		},
+		{
+			description: "open",
+			access:      steps.APIServerAccess{Applied: []string{"203.0.113.0/24"}},
+			current:     &compute.Firewall{Network: "default"},
+			tags:        []string{"sg-kube-apiserver", "kubernetes"},
+			updated:     true,
+			ranges:      []string{anyAddress},
+		},
+		{
+			description: "save error",
+			access:      steps.APIServerAccess{AllowedCIDRs: []string{"203.0.113.0/24"}},
+			saveErr:     errors.New("error2"),
+			inserted:    true,
+			ranges:      []string{"203.0.113.0/24"},
+			errMsg:      "error2",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		var saved *compute.Firewall
+		inserted, updated, retagged := false, false, false
+		step := &RestrictAPIServerStep{
+			getSvc: func(context.Context, steps.GCEConfig) (*firewallService, error) {
+				return &firewallService{
+					getFirewall: func(_ context.Context, name string) (*compute.Firewall, error) {
+						require.Equal(t, "sg-kube-apiserver", name)
+						return testCase.current, nil
+					},
+					insertFirewall: func(_ context.Context, fw *compute.Firewall) error {
+						saved, inserted = fw, true
+						return testCase.saveErr
+					},
+					updateFirewall: func(_ context.Context, fw *compute.Firewall) error {
+						saved, updated = fw, true
+						return testCase.saveErr
+					},
+					getInstance: func(_ context.Context, zone, name string) (*compute.Instance, error) {
+						return &compute.Instance{Tags: &compute.Tags{Items: testCase.tags}}, nil
+					},
+					setTags: func(_ context.Context, zone, name string, tags *compute.Tags) error {
+						require.Equal(t, []string{"sg-kube-apiserver", "kubernetes"}, tags.Items)
+						retagged = true
+						return nil
+					},
+				}, testCase.getSvcErr
+			},
+		}
+
+		config := &steps.Config{
+			ClusterID: "kube",
+			Masters: steps.NewMap(map[string]*model.Machine{
+				"master-1": {Name: "master-1", Region: "us-east1-b"},
+			}),
+			APIServerAccess: testCase.access,
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, config)
+		if testCase.errMsg == "" {
+			require.Nil(t, err, testCase.description)
+		} else {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+		}
+
+		require.Equal(t, testCase.inserted, inserted, testCase.description)
+		require.Equal(t, testCase.updated, updated, testCase.description)
+		require.Equal(t, testCase.retagged, retagged, testCase.description)
+		if saved != nil {
+			require.Equal(t, testCase.ranges, saved.SourceRanges, testCase.description)
+			require.Equal(t, []string{"sg-kube-apiserver"}, saved.TargetTags, testCase.description)
+		}
+		if testCase.current != nil {
+			require.Equal(t, testCase.current.Network, saved.Network, testCase.description)
+		}
+	}
+}
+
+func TestInstanceTags(t *testing.T) {
+	config := &steps.Config{ClusterID: "KUBE"}
+	require.Equal(t, []string{httpsTag, "kubernetes"}, instanceTags(config))
+
+	config.IsMaster = true
+	require.Equal(t, []string{httpsTag, "kubernetes"}, instanceTags(config))
+
+	config.APIServerAccess.AllowedCIDRs = []string{"203.0.113.0/24"}
+	require.Equal(t, []string{"sg-kube-apiserver", "kubernetes"}, instanceTags(config))
+}
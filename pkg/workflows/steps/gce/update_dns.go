@@ -0,0 +1,124 @@
+package gce
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/jwt"
+	"google.golang.org/api/dns/v1"
+
+	"github.com/supergiant/control/pkg/clouds/apicalls"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const UpdateDNSStepName = "gce_update_dns"
+
+type dnsService struct {
+	getRecord func(ctx context.Context, zone, name string) (*dns.ResourceRecordSet, error)
+	change    func(ctx context.Context, zone string, change *dns.Change) error
+}
+
+// UpdateDNSStep points the cloud dns record of the api endpoint to masters
+// of the cluster, the record is removed when there are no masters.
+type UpdateDNSStep struct {
+	getDNSSvc func(context.Context, steps.GCEConfig) (*dnsService, error)
+}
+
+func NewUpdateDNSStep() *UpdateDNSStep {
+	return &UpdateDNSStep{
+		getDNSSvc: func(ctx context.Context, config steps.GCEConfig) (*dnsService, error) {
+			conf := jwt.Config{
+				Email:      config.ClientEmail,
+				PrivateKey: []byte(config.PrivateKey),
+				Scopes:     []string{dns.NdevClouddnsReadwriteScope},
+				TokenURL:   config.TokenURI,
+			}
+			client, err := dns.New(conf.Client(apicalls.ClientContext(ctx)))
+			if err != nil {
+				return nil, err
+			}
+
+			return &dnsService{
+				getRecord: func(ctx context.Context, zone, name string) (*dns.ResourceRecordSet, error) {
+					resp, err := client.ResourceRecordSets.List(config.ProjectID, zone).
+						Name(name).Type("A").Context(ctx).Do()
+					if err != nil {
+						return nil, err
+					}
+					if len(resp.Rrsets) == 0 {
+						return nil, nil
+					}
+					return resp.Rrsets[0], nil
+				},
+				change: func(ctx context.Context, zone string, change *dns.Change) error {
+					_, err := client.Changes.Create(config.ProjectID, zone, change).Context(ctx).Do()
+					return err
+				},
+			}, nil
+		},
+	}
+}
+
+func (s *UpdateDNSStep) Run(ctx context.Context, output io.Writer, config *steps.Config) error {
+	log := util.GetLogger(output)
+	cfg := config.DNSConfig
+	if cfg.ZoneID == "" {
+		return errors.Errorf("%s: managed zone of %s is not set", UpdateDNSStepName, cfg.Domain)
+	}
+	name := strings.TrimSuffix(cfg.Name, ".") + "."
+
+	svc, err := s.getDNSSvc(ctx, config.GCEConfig)
+	if err != nil {
+		return errors.Wrapf(err, "%s get service", UpdateDNSStepName)
+	}
+
+	current, err := svc.getRecord(ctx, cfg.ZoneID, name)
+	if err != nil {
+		return errors.Wrapf(err, "%s get record %s", UpdateDNSStepName, name)
+	}
+
+	// cloud dns replaces records by deleting the current one in the same change
+	change := &dns.Change{}
+	if current != nil {
+		change.Deletions = []*dns.ResourceRecordSet{current}
+	}
+	if len(cfg.Addresses) > 0 {
+		change.Additions = []*dns.ResourceRecordSet{
+			{
+				Name:    name,
+				Type:    "A",
+				Ttl:     cfg.TTL,
+				Rrdatas: cfg.Addresses,
+			},
+		}
+	}
+	if len(change.Additions) == 0 && len(change.Deletions) == 0 {
+		return nil
+	}
+
+	log.Infof("[%s] - point %s to %v", s.Name(), name, cfg.Addresses)
+	if err = svc.change(ctx, cfg.ZoneID, change); err != nil {
+		return errors.Wrapf(err, "%s change record %s", UpdateDNSStepName, name)
+	}
+
+	return nil
+}
+
+func (s *UpdateDNSStep) Name() string {
+	return UpdateDNSStepName
+}
+
+func (s *UpdateDNSStep) Depends() []string {
+	return nil
+}
+
+func (s *UpdateDNSStep) Description() string {
+	return "Google compute engine: update cloud dns record of the api endpoint"
+}
+
+func (s *UpdateDNSStep) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
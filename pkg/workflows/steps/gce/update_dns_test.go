@@ -0,0 +1,125 @@
+package gce
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/dns/v1"
+
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestUpdateDNSStep_Run(t *testing.T) {
+	existing := &dns.ResourceRecordSet{
+		Name:    "kube.example.com.",
+		Type:    "A",
+		Rrdatas: []string{"1.1.1.1"},
+	}
+
+	testCases := []struct {
+		description string
+		zoneID      string
+		addrs       []string
+		current     *dns.ResourceRecordSet
+		getSvcErr   error
+		getErr      error
+		changeErr   error
+		additions   int
+		deletions   int
+		changed     bool
+		errMsg      string
+	}{
+		{
+			description: "no zone",
+			errMsg:      "managed zone",
+		},
+		{
+			description: "get service error",
+			zoneID:      "zone",
+			getSvcErr:   errors.New("error1"),
+			errMsg:      "error1",
+		},
+		{
+			description: "get record error",
+			zoneID:      "zone",
+			getErr:      errors.New("error2"),
+			errMsg:      "error2",
+		},
+		{
+			description: "nothing to delete",
+			zoneID:      "zone",
+		},
+		{
+			description: "create",
+			zoneID:      "zone",
+			addrs:       []string{"2.2.2.2"},
+			additions:   1,
+			changed:     true,
+		},
+		{
+			description: "replace",
+			zoneID:      "zone",
+			addrs:       []string{"2.2.2.2"},
+			current:     existing,
+			additions:   1,
+			deletions:   1,
+			changed:     true,
+		},
+		{
+			description: "delete error",
+			zoneID:      "zone",
+			current:     existing,
+			changeErr:   errors.New("error3"),
+			deletions:   1,
+			changed:     true,
+			errMsg:      "error3",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log(testCase.description)
+
+		var change *dns.Change
+		step := &UpdateDNSStep{
+			getDNSSvc: func(context.Context, steps.GCEConfig) (*dnsService, error) {
+				return &dnsService{
+					getRecord: func(_ context.Context, zone, name string) (*dns.ResourceRecordSet, error) {
+						require.Equal(t, "kube.example.com.", name)
+						return testCase.current, testCase.getErr
+					},
+					change: func(_ context.Context, zone string, c *dns.Change) error {
+						change = c
+						return testCase.changeErr
+					},
+				}, testCase.getSvcErr
+			},
+		}
+
+		config := &steps.Config{
+			DNSConfig: steps.DNSConfig{
+				Name:      "kube.example.com",
+				Domain:    "example.com",
+				ZoneID:    testCase.zoneID,
+				TTL:       steps.DefaultDNSTTL,
+				Addresses: testCase.addrs,
+			},
+		}
+
+		err := step.Run(context.Background(), &bytes.Buffer{}, config)
+		if testCase.errMsg == "" {
+			require.Nil(t, err, testCase.description)
+		} else {
+			require.NotNil(t, err, testCase.description)
+			require.Contains(t, err.Error(), testCase.errMsg, testCase.description)
+		}
+
+		require.Equal(t, testCase.changed, change != nil, testCase.description)
+		if change != nil {
+			require.Len(t, change.Additions, testCase.additions, testCase.description)
+			require.Len(t, change.Deletions, testCase.deletions, testCase.description)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gitopsaddon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/tiller"
+)
+
+const (
+	StepName = "gitopsaddon"
+
+	ToolArgoCD = "argocd"
+	ToolFlux   = "flux"
+)
+
+type Step struct {
+	script *template.Template
+}
+
+// templateConfig adds values that are computed from the gitops config.
+type templateConfig struct {
+	steps.GitOpsConfig
+	// GitURL is a repository url flux clones from, credentials are
+	// substituted by flux from the environment.
+	GitURL string
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(script *template.Template) *Step {
+	t := &Step{
+		script: script,
+	}
+
+	return t
+}
+
+func (s *Step) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	gitops := cfg.GitOpsConfig
+	if gitops.Tool == "" {
+		log.Infof("[%s] - gitops tool is not set, skip", s.Name())
+		return nil
+	}
+	if gitops.Tool != ToolArgoCD && gitops.Tool != ToolFlux {
+		return errors.Errorf("unknown gitops tool %s", gitops.Tool)
+	}
+	if gitops.RepoURL == "" {
+		return errors.New("gitops repository url is not set")
+	}
+
+	gitURL, err := fluxURL(gitops)
+	if err != nil {
+		return errors.Wrap(err, "parse repository url")
+	}
+
+	log.Infof("[%s] - bootstrapping %s with %s", s.Name(), gitops.Tool, gitops.RepoURL)
+
+	err = steps.RunTemplate(ctx, s.script, cfg.Runner, w, templateConfig{
+		GitOpsConfig: gitops,
+		GitURL:       gitURL,
+	})
+	if err != nil {
+		return errors.Wrap(err, "bootstrap gitops addon step")
+	}
+
+	return nil
+}
+
+func (*Step) Name() string {
+	return StepName
+}
+
+func (*Step) Description() string {
+	return "Install Argo CD or Flux and point it to a repository"
+}
+
+func (*Step) Depends() []string {
+	return []string{tiller.StepName}
+}
+
+func (*Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// fluxURL adds credential placeholders to https urls, flux replaces them
+// with values of the GIT_AUTHUSER and GIT_AUTHKEY environment variables.
+func fluxURL(cfg steps.GitOpsConfig) (string, error) {
+	// ssh urls like git@host:org/repo.git are not parsed by net/url
+	if cfg.Username == "" || !strings.HasPrefix(cfg.RepoURL, "http") {
+		return cfg.RepoURL, nil
+	}
+
+	u, err := url.Parse(cfg.RepoURL)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s://$(GIT_AUTHUSER):$(GIT_AUTHKEY)@%s%s", u.Scheme, u.Host, u.Path), nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	tm "github.com/supergiant/control/pkg/templatemanager"
 	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/bootstraptoken"
 	"github.com/supergiant/control/pkg/workflows/steps/docker"
 )
 
@@ -46,6 +47,15 @@ func (t *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) err
 
 	config.KubeadmConfig.IsMaster = config.IsMaster
 
+	// tokens are not stored with tasks, a restarted task mints another one
+	if config.KubeadmConfig.Token == "" {
+		if s := steps.GetStep(bootstraptoken.StepName); s != nil {
+			if err := s.Run(ctx, out, config); err != nil {
+				return errors.Wrap(err, "kubeadm step")
+			}
+		}
+	}
+
 	err := steps.RunTemplate(ctx, t.script, config.Runner, out, config.KubeadmConfig)
 
 	if err != nil {
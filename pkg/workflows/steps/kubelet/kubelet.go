@@ -46,7 +46,13 @@ func New(script *template.Template) *Step {
 }
 
 func (t *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
-	err := steps.RunTemplate(ctx, t.script, config.Runner, out, struct{Provider clouds.Name}{config.Provider})
+	err := steps.RunTemplate(ctx, t.script, config.Runner, out, struct {
+		Provider clouds.Name
+		steps.KubeletConfig
+	}{
+		config.Provider,
+		config.KubeletConfig,
+	})
 
 	if err != nil {
 		return errors.Wrap(err, "install kubelet step")
@@ -61,6 +61,56 @@ func TestStartKubelet(t *testing.T) {
 	}
 }
 
+func TestStartKubeletWithSettings(t *testing.T) {
+	r := &fakeRunner{}
+	err := templatemanager.Init("../../../../templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	output := new(bytes.Buffer)
+
+	cfg := &steps.Config{
+		Runner: r,
+		KubeletConfig: steps.KubeletConfig{
+			MaxPods:        64,
+			EvictionHard:   "memory.available<100Mi",
+			SystemReserved: "cpu=100m,memory=256Mi",
+		},
+	}
+
+	task := &Step{
+		tpl,
+	}
+
+	err = task.Run(context.Background(), output, cfg)
+
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	for _, arg := range []string{
+		"--max-pods=64",
+		"--eviction-hard=memory.available<100Mi",
+		"--system-reserved=cpu=100m,memory=256Mi",
+	} {
+		if !strings.Contains(output.String(), arg) {
+			t.Errorf("kubelet arg %s not found in %s", arg, output.String())
+		}
+	}
+
+	if strings.Contains(output.String(), "--kube-reserved") {
+		t.Errorf("unexpected --kube-reserved in %s", output.String())
+	}
+}
+
 func TestStartKubeletError(t *testing.T) {
 	errMsg := "error has occurred"
 
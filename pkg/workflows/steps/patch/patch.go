@@ -0,0 +1,62 @@
+package patch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/drain"
+)
+
+const StepName = "patch"
+
+// Step applies OS updates and container runtime patch upgrades to a node
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(tpl *template.Template) *Step {
+	return &Step{
+		script: tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	err := steps.RunTemplate(ctx, s.script, config.Runner, out, config.PatchConfig)
+	if err != nil {
+		return errors.Wrap(err, "patch node step")
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "Apply OS and container runtime updates"
+}
+
+func (s *Step) Depends() []string {
+	return []string{drain.StepName}
+}
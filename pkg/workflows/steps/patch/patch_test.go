@@ -0,0 +1,173 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/drain"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestPatch(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	testCases := []struct {
+		cfg         steps.PatchConfig
+		expected    []string
+		notExpected []string
+	}{
+		{
+			cfg:         steps.PatchConfig{},
+			expected:    []string{"apt-get -y", "upgrade"},
+			notExpected: []string{"unattended-upgrade", "docker-ce"},
+		},
+		{
+			cfg: steps.PatchConfig{
+				SecurityOnly:   true,
+				UpgradeRuntime: true,
+			},
+			expected: []string{"unattended-upgrade", "--only-upgrade", "docker-ce"},
+			// failed runtime upgrades fail the task
+			notExpected: []string{"|| true"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		output := new(bytes.Buffer)
+		cfg := &steps.Config{
+			Runner:      &fakeRunner{},
+			PatchConfig: testCase.cfg,
+		}
+
+		task := New(tpl)
+		err = task.Run(context.Background(), output, cfg)
+
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		for _, s := range testCase.expected {
+			if !strings.Contains(output.String(), s) {
+				t.Errorf("%s not found in %s", s, output.String())
+			}
+		}
+
+		for _, s := range testCase.notExpected {
+			if strings.Contains(output.String(), s) {
+				t.Errorf("unexpected %s in %s", s, output.String())
+			}
+		}
+	}
+}
+
+func TestPatchError(t *testing.T) {
+	errMsg := "error has occurred"
+
+	r := &fakeRunner{
+		errMsg: errMsg,
+	}
+
+	tpl, _ := template.New(StepName).Parse("")
+	cfg := &steps.Config{
+		Runner: r,
+	}
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, cfg)
+
+	if err == nil {
+		t.Errorf("Error must not be nil")
+		return
+	}
+
+	if !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %s", errMsg, err.Error())
+	}
+}
+
+func TestStepName(t *testing.T) {
+	s := Step{}
+
+	if s.Name() != StepName {
+		t.Errorf("Unexpected step name expected %s actual %s", StepName, s.Name())
+	}
+}
+
+func TestDepends(t *testing.T) {
+	s := Step{}
+
+	if len(s.Depends()) != 1 || s.Depends()[0] != drain.StepName {
+		t.Errorf("Wrong dependency list %v expected %v", s.Depends(), []string{drain.StepName})
+	}
+}
+
+func TestStep_Rollback(t *testing.T) {
+	s := Step{}
+	err := s.Rollback(context.Background(), ioutil.Discard, &steps.Config{})
+
+	if err != nil {
+		t.Errorf("unexpected error while rollback %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	templatemanager.SetTemplate(StepName, &template.Template{})
+	Init()
+	templatemanager.DeleteTemplate(StepName)
+
+	s := steps.GetStep(StepName)
+
+	if s == nil {
+		t.Error("Step not found")
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("recover output must not be nil")
+		}
+	}()
+
+	templatemanager.DeleteTemplate(StepName)
+	Init()
+}
+
+func TestStep_Description(t *testing.T) {
+	s := &Step{}
+
+	if desc := s.Description(); desc == "" {
+		t.Errorf("Description must not be empty")
+	}
+}
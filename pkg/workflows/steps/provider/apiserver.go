@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+	"github.com/supergiant/control/pkg/workflows/steps/azure"
+	"github.com/supergiant/control/pkg/workflows/steps/gce"
+)
+
+const RestrictAPIServerStep = "restrictAPIServer"
+
+// StepRestrictAPIServer limits clients of the api server to the allow-list
+// of the cluster, control keeps access to the api server of its clusters.
+type StepRestrictAPIServer struct {
+}
+
+func (s StepRestrictAPIServer) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	step := restrictAPIServerStepFor(cfg.Provider)
+	if step == nil {
+		if len(cfg.APIServerAccess.AllowedCIDRs) > 0 {
+			util.GetLogger(out).Infof("[%s] - api server allow-lists are not supported by %s, skip",
+				RestrictAPIServerStep, cfg.Provider)
+		}
+		return nil
+	}
+
+	// aws security groups allow control since they have been created
+	if cfg.Provider != clouds.AWS && cfg.APIServerAccess.ControlCIDR == "" &&
+		len(cfg.APIServerAccess.AllowedCIDRs) > 0 {
+		ip, err := amazon.OutboundIP(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "%s: find control address", RestrictAPIServerStep)
+		}
+		cfg.APIServerAccess.ControlCIDR = ip + "/32"
+	}
+
+	return errors.Wrap(step.Run(ctx, out, cfg), RestrictAPIServerStep)
+}
+
+func (s StepRestrictAPIServer) Name() string {
+	return RestrictAPIServerStep
+}
+
+func (s StepRestrictAPIServer) Description() string {
+	return RestrictAPIServerStep
+}
+
+func (s StepRestrictAPIServer) Depends() []string {
+	return nil
+}
+
+func (s StepRestrictAPIServer) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// RestrictAPIServerSupported tells whether access to api servers of clusters
+// of the provider can be limited to control.
+func RestrictAPIServerSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS || provider == clouds.GCE || provider == clouds.Azure
+}
+
+func restrictAPIServerStepFor(provider clouds.Name) steps.Step {
+	switch provider {
+	case clouds.AWS:
+		return steps.GetStep(amazon.RestrictAPIServerStepName)
+	case clouds.GCE:
+		return steps.GetStep(gce.RestrictAPIServerStepName)
+	case clouds.Azure:
+		return steps.GetStep(azure.RestrictAPIServerStepName)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"github.com/supergiant/control/pkg/clouds"
+)
+
+// Providers are all clouds known to control, some of them can't be provisioned yet.
+var Providers = []clouds.Name{
+	clouds.AWS,
+	clouds.Azure,
+	clouds.DigitalOcean,
+	clouds.GCE,
+	clouds.OpenStack,
+	clouds.Packet,
+}
+
+// Capabilities describe what clusters of a provider support, they are built
+// from the steps the provider has, so the ui doesn't offer options that fail.
+type Capabilities struct {
+	Provider clouds.Name `json:"provider"`
+	// Provisioning tells whether machines of the provider can be created.
+	Provisioning  bool `json:"provisioning"`
+	DeleteMachine bool `json:"deleteMachine"`
+	HAMasters     bool `json:"haMasters"`
+	// Stacks tells whether networking of clusters can be created as
+	// a stack of the cloud, it's selected per account.
+	Stacks bool `json:"stacks"`
+
+	SpotInstances   bool `json:"spotInstances"`
+	LoadBalancers   bool `json:"loadBalancers"`
+	PrivateClusters bool `json:"privateClusters"`
+	// GPUTypes are machine types with gpu drivers installed by provisioning.
+	GPUTypes []string `json:"gpuTypes"`
+
+	DNS               bool `json:"dns"`
+	RestrictAPIServer bool `json:"restrictApiServer"`
+	Firewall          bool `json:"firewall"`
+	Disks             bool `json:"disks"`
+	Peering           bool `json:"peering"`
+	Egress            bool `json:"egress"`
+	Budgets           bool `json:"budgets"`
+	Hardening         bool `json:"hardening"`
+	// DataVolumes tells whether node profiles may set root disks and attach data volumes.
+	DataVolumes bool `json:"dataVolumes"`
+	// SpreadMasters tells whether masters can be placed on distinct hardware.
+	SpreadMasters bool `json:"spreadMasters"`
+}
+
+// CapabilitiesFor returns capabilities of the provider.
+func CapabilitiesFor(provider clouds.Name) Capabilities {
+	_, createErr := createMachineStepFor(provider)
+	_, deleteErr := deleteMachineStepFor(provider)
+	_, peeringErr := PeeringStepsFor(provider)
+
+	return Capabilities{
+		Provider:      provider,
+		Provisioning:  createErr == nil,
+		DeleteMachine: deleteErr == nil,
+		// masters are created by the same step as nodes and join the first one
+		HAMasters: createErr == nil,
+		// aws accounts may create networking as a cloudformation stack
+		Stacks: provider == clouds.AWS,
+
+		// machines are created on demand without load balancer integration,
+		// public addresses and gpu drivers
+		SpotInstances:   false,
+		LoadBalancers:   false,
+		PrivateClusters: false,
+		GPUTypes:        []string{},
+
+		DNS:               DNSSupported(provider),
+		RestrictAPIServer: RestrictAPIServerSupported(provider),
+		Firewall:          FirewallSupported(provider),
+		Disks:             DisksSupported(provider),
+		Peering:           peeringErr == nil,
+		Egress:            EgressSupported(provider),
+		Budgets:           BudgetsSupported(provider),
+		Hardening:         HardeningSupported(provider),
+		DataVolumes:       DataVolumesSupported(provider),
+		SpreadMasters:     SpreadMastersSupported(provider),
+	}
+}
+
+// EgressSupported tells whether clusters of the provider can send traffic
+// from static addresses, only aws clusters have a nat gateway.
+func EgressSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS
+}
+
+// BudgetsSupported tells whether a budget of the cluster can be created,
+// only resource groups of azure clusters have one.
+func BudgetsSupported(provider clouds.Name) bool {
+	return provider == clouds.Azure
+}
+
+// HardeningSupported tells whether machines of the provider can be created
+// with IMDSv2, encrypted volumes and restricted instance profiles.
+func HardeningSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS
+}
+
+// DataVolumesSupported tells whether machines of the provider are created with
+// disks of node profiles, droplets and azure vms keep disks of their sizes.
+func DataVolumesSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS || provider == clouds.GCE
+}
+
+// SpreadMastersSupported tells whether masters of the provider are spread by
+// a placement group, a spread policy or an availability set.
+func SpreadMastersSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS || provider == clouds.GCE || provider == clouds.Azure
+}
@@ -26,7 +26,7 @@ func (s StepCleanUp) Run(ctx context.Context, out io.Writer, cfg *steps.Config)
 		return errors.New("invalid config")
 	}
 
-	steps, err := cleanUpStepsFor(cfg.Provider)
+	steps, err := cleanUpStepsFor(cfg)
 	if err != nil {
 		return errors.Wrap(err, CleanUpStep)
 	}
@@ -55,12 +55,24 @@ func (s StepCleanUp) Rollback(context.Context, io.Writer, *steps.Config) error {
 	return nil
 }
 
-func cleanUpStepsFor(provider clouds.Name) ([]steps.Step, error) {
+func cleanUpStepsFor(cfg *steps.Config) ([]steps.Step, error) {
 	// TODO: use provider interface
-	switch provider {
+	switch cfg.Provider {
 	case clouds.AWS:
+		// clusters keep the stack they were created with
+		if cfg.AWSConfig.StackName != "" {
+			return []steps.Step{
+				steps.GetStep(amazon.DeleteClusterMachinesStepName),
+				steps.GetStep(amazon.DeletePlacementGroupStepName),
+				steps.GetStep(amazon.DeleteNATGatewayStepName),
+				steps.GetStep(amazon.DeleteStackStepName),
+				steps.GetStep(amazon.DeleteKeyPairStepName),
+			}, nil
+		}
 		return []steps.Step{
 			steps.GetStep(amazon.DeleteClusterMachinesStepName),
+			steps.GetStep(amazon.DeletePlacementGroupStepName),
+			steps.GetStep(amazon.DeleteNATGatewayStepName),
 			steps.GetStep(amazon.DeleteSecurityGroupsStepName),
 			steps.GetStep(amazon.DisassociateRouteTableStepName),
 			steps.GetStep(amazon.DeleteSubnetsStepName),
@@ -77,11 +89,13 @@ func cleanUpStepsFor(provider clouds.Name) ([]steps.Step, error) {
 	case clouds.GCE:
 		return []steps.Step{
 			steps.GetStep(gce.DeleteNodeStepName),
+			steps.GetStep(gce.DeleteFirewallStepName),
+			steps.GetStep(gce.DeletePlacementPolicyStepName),
 		}, nil
 	case clouds.Azure:
 		return []steps.Step{
 			//TODO DELETION
 		}, nil
 	}
-	return nil, errors.New(fmt.Sprintf("unknown provider: %s", provider))
+	return nil, errors.New(fmt.Sprintf("unknown provider: %s", cfg.Provider))
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/workflows/steps"
@@ -26,6 +27,11 @@ func (s StepDeleteMachine) Run(ctx context.Context, out io.Writer, cfg *steps.Co
 		return errors.New("invalid config")
 	}
 
+	if cfg.Node.ExternallyManaged {
+		logrus.Infof("%s: machine %s is managed externally, skip", DeleteMachineStep, cfg.Node.Name)
+		return nil
+	}
+
 	step, err := deleteMachineStepFor(cfg.Provider)
 	if err != nil {
 		return err
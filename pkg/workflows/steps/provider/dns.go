@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+	"github.com/supergiant/control/pkg/workflows/steps/azure"
+	"github.com/supergiant/control/pkg/workflows/steps/gce"
+)
+
+const (
+	UpdateDNSStep = "updateDNS"
+	DeleteDNSStep = "deleteDNS"
+)
+
+// StepUpdateDNS points the api endpoint record of the cluster to public
+// addresses of current masters, it runs after masters have been replaced.
+type StepUpdateDNS struct {
+}
+
+func (s StepUpdateDNS) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+	if cfg.DNSConfig.Name == "" {
+		return nil
+	}
+
+	addrs := make([]string, 0, len(cfg.GetMasters()))
+	for _, m := range cfg.GetMasters() {
+		if m.PublicIp != "" {
+			addrs = append(addrs, m.PublicIp)
+		}
+	}
+	sort.Strings(addrs)
+	cfg.DNSConfig.Addresses = addrs
+
+	step := dnsStepFor(cfg.Provider)
+	if step == nil {
+		util.GetLogger(out).Infof("[%s] - dns records are not supported by %s, skip", UpdateDNSStep, cfg.Provider)
+		return nil
+	}
+
+	return errors.Wrap(step.Run(ctx, out, cfg), UpdateDNSStep)
+}
+
+func (s StepUpdateDNS) Name() string {
+	return UpdateDNSStep
+}
+
+func (s StepUpdateDNS) Description() string {
+	return UpdateDNSStep
+}
+
+func (s StepUpdateDNS) Depends() []string {
+	return nil
+}
+
+func (s StepUpdateDNS) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// StepDeleteDNS removes the api endpoint record of the cluster, failures
+// don't block deletion of the cluster.
+type StepDeleteDNS struct {
+}
+
+func (s StepDeleteDNS) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+	if cfg.DNSConfig.Name == "" {
+		return nil
+	}
+
+	step := dnsStepFor(cfg.Provider)
+	if step == nil {
+		return nil
+	}
+
+	cfg.DNSConfig.Addresses = nil
+	if err := step.Run(ctx, out, cfg); err != nil {
+		util.GetLogger(out).Errorf("[%s] - delete record %s: %v", DeleteDNSStep, cfg.DNSConfig.Name, err)
+	}
+
+	return nil
+}
+
+func (s StepDeleteDNS) Name() string {
+	return DeleteDNSStep
+}
+
+func (s StepDeleteDNS) Description() string {
+	return DeleteDNSStep
+}
+
+func (s StepDeleteDNS) Depends() []string {
+	return nil
+}
+
+func (s StepDeleteDNS) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// DNSSupported tells whether records of clusters of the provider can be managed.
+func DNSSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS || provider == clouds.GCE || provider == clouds.Azure
+}
+
+func dnsStepFor(provider clouds.Name) steps.Step {
+	switch provider {
+	case clouds.AWS:
+		return steps.GetStep(amazon.UpdateDNSStepName)
+	case clouds.GCE:
+		return steps.GetStep(gce.UpdateDNSStepName)
+	case clouds.Azure:
+		return steps.GetStep(azure.UpdateDNSStepName)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+const UpdateFirewallStep = "updateFirewall"
+
+// StepUpdateFirewall applies firewall rules of the cluster to the firewall
+// of the cloud, only aws machines are behind a firewall managed by control.
+type StepUpdateFirewall struct {
+}
+
+func (s StepUpdateFirewall) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	if !FirewallSupported(cfg.Provider) {
+		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "%s: %s", UpdateFirewallStep, cfg.Provider)
+	}
+
+	return runAll(ctx, out, cfg, []steps.Step{steps.GetStep(amazon.UpdateFirewallStepName)})
+}
+
+func (s StepUpdateFirewall) Name() string {
+	return UpdateFirewallStep
+}
+
+func (s StepUpdateFirewall) Description() string {
+	return UpdateFirewallStep
+}
+
+func (s StepUpdateFirewall) Depends() []string {
+	return nil
+}
+
+func (s StepUpdateFirewall) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// FirewallSupported tells whether firewall rules of clusters of the provider can be managed.
+func FirewallSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS
+}
@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+	"github.com/supergiant/control/pkg/workflows/steps/azure"
+)
+
+const (
+	PeerNetworksStep   = "peerNetworks"
+	UnpeerNetworksStep = "unpeerNetworks"
+)
+
+// StepPeerNetworks connects the network of the cluster with the network
+// of the peer cluster described by the peering config.
+type StepPeerNetworks struct {
+}
+
+func (s StepPeerNetworks) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	peer, err := PeeringStepsFor(cfg.Provider)
+	if err != nil {
+		return errors.Wrap(err, PeerNetworksStep)
+	}
+
+	return runAll(ctx, out, cfg, peer)
+}
+
+func (s StepPeerNetworks) Name() string {
+	return PeerNetworksStep
+}
+
+func (s StepPeerNetworks) Description() string {
+	return PeerNetworksStep
+}
+
+func (s StepPeerNetworks) Depends() []string {
+	return nil
+}
+
+func (s StepPeerNetworks) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// StepUnpeerNetworks removes the peering created by StepPeerNetworks.
+type StepUnpeerNetworks struct {
+}
+
+func (s StepUnpeerNetworks) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	var unpeer []steps.Step
+	switch cfg.Provider {
+	case clouds.AWS:
+		unpeer = []steps.Step{steps.GetStep(amazon.DeleteVPCPeeringStepName)}
+	case clouds.Azure:
+		unpeer = []steps.Step{steps.GetStep(azure.DeleteVNetPeeringStepName)}
+	default:
+		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "%s: %s", UnpeerNetworksStep, cfg.Provider)
+	}
+
+	return runAll(ctx, out, cfg, unpeer)
+}
+
+func (s StepUnpeerNetworks) Name() string {
+	return UnpeerNetworksStep
+}
+
+func (s StepUnpeerNetworks) Description() string {
+	return UnpeerNetworksStep
+}
+
+func (s StepUnpeerNetworks) Depends() []string {
+	return nil
+}
+
+func (s StepUnpeerNetworks) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// PeeringStepsFor returns steps that peer networks of the provider,
+// sgerrors.ErrUnsupportedProvider is returned for clouds without peering.
+func PeeringStepsFor(provider clouds.Name) ([]steps.Step, error) {
+	switch provider {
+	case clouds.AWS:
+		return []steps.Step{
+			steps.GetStep(amazon.CreateVPCPeeringStepName),
+			steps.GetStep(amazon.CreatePeeringRoutesStepName),
+		}, nil
+	case clouds.Azure:
+		return []steps.Step{
+			steps.GetStep(azure.CreateVNetPeeringStepName),
+		}, nil
+	}
+	return nil, errors.Wrapf(sgerrors.ErrUnsupportedProvider, "peering: %s", provider)
+}
+
+func runAll(ctx context.Context, out io.Writer, cfg *steps.Config, all []steps.Step) error {
+	for _, s := range all {
+		if err := s.Run(ctx, out, cfg); err != nil {
+			return errors.Wrap(err, s.Name())
+		}
+	}
+	return nil
+}
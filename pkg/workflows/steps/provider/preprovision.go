@@ -11,6 +11,7 @@ import (
 	"github.com/supergiant/control/pkg/clouds"
 	"github.com/supergiant/control/pkg/workflows/steps"
 	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+	"github.com/supergiant/control/pkg/workflows/steps/gce"
 )
 
 const (
@@ -25,7 +26,7 @@ func (s StepPreProvision) Run(ctx context.Context, out io.Writer, cfg *steps.Con
 		return errors.New("invalid config")
 	}
 
-	steps, err := prepProvisionStepFor(cfg.Provider)
+	steps, err := prepProvisionStepFor(cfg)
 	if err != nil {
 		return errors.Wrap(err, PreProvisionStep)
 	}
@@ -54,30 +55,47 @@ func (s StepPreProvision) Rollback(context.Context, io.Writer, *steps.Config) er
 	return nil
 }
 
-func prepProvisionStepFor(provider clouds.Name) ([]steps.Step, error) {
+func prepProvisionStepFor(cfg *steps.Config) ([]steps.Step, error) {
 	// TODO: use provider interface
-	switch provider {
+	switch cfg.Provider {
 	case clouds.AWS:
+		if amazon.StackProvisioning(cfg.AWSConfig) {
+			// networking is created at once as a cloudformation stack
+			return []steps.Step{
+				steps.GetStep(amazon.StepFindAMI),
+				steps.GetStep(amazon.StepNameCreateInstanceProfiles),
+				steps.GetStep(amazon.StepImportKeyPair),
+				steps.GetStep(amazon.CreatePlacementGroupStepName),
+				steps.GetStep(amazon.CreateStackStepName),
+				steps.GetStep(amazon.CreateNATGatewayStepName),
+			}, nil
+		}
 		return []steps.Step{
 			steps.GetStep(amazon.StepFindAMI),
 			steps.GetStep(amazon.StepCreateVPC),
 			steps.GetStep(amazon.StepCreateSecurityGroups),
 			steps.GetStep(amazon.StepNameCreateInstanceProfiles),
 			steps.GetStep(amazon.StepImportKeyPair),
+			steps.GetStep(amazon.CreatePlacementGroupStepName),
 			steps.GetStep(amazon.StepCreateInternetGateway),
 			steps.GetStep(amazon.StepCreateSubnets),
 			steps.GetStep(amazon.StepCreateRouteTable),
 			steps.GetStep(amazon.StepAssociateRouteTable),
+			steps.GetStep(amazon.CreateNATGatewayStepName),
 		}, nil
 	case clouds.DigitalOcean:
 		return []steps.Step{}, nil
 	case clouds.GCE:
-		return []steps.Step{}, nil
+		return []steps.Step{
+			steps.GetStep(gce.CreatePlacementPolicyStepName),
+		}, nil
 	case clouds.Azure:
 		return []steps.Step{
 			steps.GetStep(azure.CreateGroupStepName),
 			steps.GetStep(azure.CreateVNetStepName),
+			steps.GetStep(azure.CreateBudgetStepName),
+			steps.GetStep(azure.CreateAvailabilitySetStepName),
 		}, nil
 	}
-	return nil, errors.New(fmt.Sprintf("unknown provider: %s", provider))
+	return nil, errors.New(fmt.Sprintf("unknown provider: %s", cfg.Provider))
 }
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/model"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+const (
+	RegisterMachineStep = "registerMachine"
+)
+
+// StepRegisterMachine is used instead of StepCreateMachine for machines
+// that already exist, the machine is taken from the config node.
+type StepRegisterMachine struct {
+}
+
+func (s StepRegisterMachine) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	if cfg.Node.PublicIp == "" {
+		return errors.Errorf("%s: public ip of machine %s is not set", RegisterMachineStep, cfg.Node.Name)
+	}
+
+	cfg.Node.Role = model.RoleNode
+	if cfg.IsMaster {
+		cfg.Node.Role = model.RoleMaster
+	}
+	cfg.Node.TaskID = cfg.TaskID
+	cfg.Node.State = model.MachineStateProvisioning
+	cfg.Node.ExternallyManaged = true
+
+	// Update node state in cluster
+	cfg.NodeChan() <- cfg.Node
+
+	if cfg.IsMaster {
+		cfg.AddMaster(&cfg.Node)
+	} else {
+		cfg.AddNode(&cfg.Node)
+	}
+
+	logrus.Infof("Node has been registered %v", cfg.Node)
+
+	return nil
+}
+
+func (s StepRegisterMachine) Name() string {
+	return RegisterMachineStep
+}
+
+func (s StepRegisterMachine) Description() string {
+	return RegisterMachineStep
+}
+
+func (s StepRegisterMachine) Depends() []string {
+	return nil
+}
+
+func (s StepRegisterMachine) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+const DeleteDisksStep = "deleteDisks"
+
+// StepDeleteDisks deletes orphaned cloud disks of the cluster.
+type StepDeleteDisks struct {
+}
+
+func (s StepDeleteDisks) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	if !DisksSupported(cfg.Provider) {
+		return errors.Wrapf(sgerrors.ErrUnsupportedProvider, "%s: %s", DeleteDisksStep, cfg.Provider)
+	}
+
+	return runAll(ctx, out, cfg, []steps.Step{steps.GetStep(amazon.DeleteVolumesStepName)})
+}
+
+func (s StepDeleteDisks) Name() string {
+	return DeleteDisksStep
+}
+
+func (s StepDeleteDisks) Description() string {
+	return DeleteDisksStep
+}
+
+func (s StepDeleteDisks) Depends() []string {
+	return nil
+}
+
+func (s StepDeleteDisks) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+// DisksSupported tells whether cloud disks of clusters of the provider can be listed and deleted.
+func DisksSupported(provider clouds.Name) bool {
+	return provider == clouds.AWS
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/clouds"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/amazon"
+)
+
+const AllowWireGuardStep = "allowWireGuard"
+
+// StepAllowWireGuard opens the wireguard port in firewalls of the cloud,
+// clouds whose machines are not behind a firewall managed by control are skipped.
+type StepAllowWireGuard struct {
+}
+
+func (s StepAllowWireGuard) Run(ctx context.Context, out io.Writer, cfg *steps.Config) error {
+	if cfg == nil {
+		return errors.New("invalid config")
+	}
+
+	if cfg.Provider != clouds.AWS {
+		return nil
+	}
+
+	return steps.GetStep(amazon.AllowWireGuardStepName).Run(ctx, out, cfg)
+}
+
+func (s StepAllowWireGuard) Name() string {
+	return AllowWireGuardStep
+}
+
+func (s StepAllowWireGuard) Description() string {
+	return AllowWireGuardStep
+}
+
+func (s StepAllowWireGuard) Depends() []string {
+	return nil
+}
+
+func (s StepAllowWireGuard) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
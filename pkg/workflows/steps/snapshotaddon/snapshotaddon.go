@@ -0,0 +1,73 @@
+package snapshotaddon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/poststart"
+)
+
+const StepName = "snapshotaddon"
+
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(script *template.Template) *Step {
+	t := &Step{
+		script: script,
+	}
+
+	return t
+}
+
+func (s *Step) Run(ctx context.Context, w io.Writer, cfg *steps.Config) error {
+	log := util.GetLogger(w)
+
+	if !cfg.VolumeSnapshots {
+		log.Infof("[%s] - volume snapshots are not enabled, skip", s.Name())
+		return nil
+	}
+
+	log.Infof("[%s] - installing csi snapshot controller", s.Name())
+
+	err := steps.RunTemplate(ctx, s.script, cfg.Runner, w, cfg)
+	if err != nil {
+		return errors.Wrap(err, "install snapshot addon step")
+	}
+
+	return nil
+}
+
+func (*Step) Name() string {
+	return StepName
+}
+
+func (*Step) Description() string {
+	return "Install csi snapshot crds and the snapshot controller"
+}
+
+func (*Step) Depends() []string {
+	return []string{poststart.StepName}
+}
+
+func (*Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
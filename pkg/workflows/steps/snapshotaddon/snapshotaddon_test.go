@@ -0,0 +1,79 @@
+package snapshotaddon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestStep_Run(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	require.NoError(t, err)
+
+	tpl, err := templatemanager.GetTemplate(StepName)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		enabled     bool
+		runErr      string
+		expectedErr bool
+		contains    []string
+	}{
+		{
+			name: "not enabled",
+		},
+		{
+			name:    "enabled",
+			enabled: true,
+			contains: []string{
+				"snapshot.storage.k8s.io_${crd}.yaml",
+				"setup-snapshot-controller.yaml",
+			},
+		},
+		{
+			name:        "runner error",
+			enabled:     true,
+			runErr:      "error",
+			expectedErr: true,
+		},
+	} {
+		cfg := &steps.Config{
+			VolumeSnapshots: tc.enabled,
+			Runner:          &fakeRunner{errMsg: tc.runErr},
+		}
+
+		output := new(bytes.Buffer)
+		err = New(tpl).Run(context.Background(), output, cfg)
+		require.Equal(t, tc.expectedErr, err != nil, "TC: %s: %v", tc.name, err)
+
+		for _, s := range tc.contains {
+			require.Contains(t, output.String(), s, "TC: %s", tc.name)
+		}
+		if !tc.enabled {
+			require.NotContains(t, output.String(), "kubectl", "TC: %s", tc.name)
+		}
+	}
+}
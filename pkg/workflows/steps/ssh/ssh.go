@@ -22,7 +22,8 @@ func Init() {
 func (s *Step) Run(ctx context.Context, writer io.Writer, config *steps.Config) error {
 	var err error
 
-	if config.Provider == clouds.AWS {
+	// NOTE: user of imported machines is provided explicitly
+	if config.Provider == clouds.AWS && !config.Node.ExternallyManaged {
 		//on aws default user name on ubuntu images are not root but ubuntu
 		//https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/AccessingInstancesLinux.html
 		// TODO: this should be set by provisioner
@@ -34,7 +35,9 @@ func (s *Step) Run(ctx context.Context, writer io.Writer, config *steps.Config)
 		User:    config.Kube.SSHConfig.User,
 		Timeout: config.Kube.SSHConfig.Timeout,
 		// TODO(stgleb): Use secure storage for private keys instead carrying them in plain text
-		Key: []byte(config.Kube.SSHConfig.BootstrapPrivateKey),
+		Key:         []byte(config.Kube.SSHConfig.BootstrapPrivateKey),
+		Passphrase:  config.Kube.SSHConfig.Passphrase,
+		AgentSocket: config.Kube.SSHConfig.AgentSocket,
 	}
 
 	config.Runner, err = ssh.NewRunner(cfg)
@@ -0,0 +1,149 @@
+package submariner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/util"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+const (
+	BrokerStepName = "submariner_broker"
+	JoinStepName   = "submariner_join"
+	LeaveStepName  = "submariner_leave"
+
+	DefaultVersion = "v0.14.6"
+
+	CableDriverWireGuard = "wireguard"
+	CableDriverVXLAN     = "vxlan"
+
+	// NATTPort is an udp port gateways of clusters tunnel traffic over.
+	NATTPort = 4500
+
+	brokerInfoPrefix = "broker info: "
+)
+
+// templateConfig adds values that are not a part of the submariner config.
+type templateConfig struct {
+	steps.SubmarinerConfig
+	BrokerInfoPrefix string
+}
+
+// Step runs a submariner script on a master node of the cluster.
+type Step struct {
+	name        string
+	description string
+	script      *template.Template
+}
+
+func Init() {
+	for name, description := range map[string]string{
+		BrokerStepName: "Deploy submariner broker",
+		JoinStepName:   "Join cluster to submariner broker",
+		LeaveStepName:  "Remove submariner from cluster",
+	} {
+		tpl, err := tm.GetTemplate(name)
+		if err != nil {
+			panic(fmt.Sprintf("template %s not found", name))
+		}
+
+		steps.RegisterStep(name, New(name, description, tpl))
+	}
+}
+
+func New(name, description string, tpl *template.Template) *Step {
+	return &Step{
+		name:        name,
+		description: description,
+		script:      tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	log := util.GetLogger(out)
+	cfg := config.SubmarinerConfig
+	if cfg.Version == "" {
+		cfg.Version = DefaultVersion
+	}
+	if cfg.CableDriver == "" {
+		cfg.CableDriver = CableDriverWireGuard
+	}
+	if s.name == JoinStepName && cfg.BrokerInfo == "" {
+		return errors.Errorf("%s: broker info is not set", s.name)
+	}
+
+	log.Infof("[%s] - cluster %s", s.name, config.ClusterID)
+	// output of the broker deployment holds credentials, it is logged after they are cut out
+	var w io.Writer = out
+	buf := &bytes.Buffer{}
+	if s.name == BrokerStepName {
+		w = buf
+	}
+	err := steps.RunTemplate(ctx, s.script, config.Runner, w, templateConfig{
+		SubmarinerConfig: cfg,
+		BrokerInfoPrefix: brokerInfoPrefix,
+	})
+	// the script may still write to the buffer when ctx is done
+	if s.name == BrokerStepName && ctx.Err() == nil {
+		info, parseErr := parseBrokerInfo(buf, out)
+		if err == nil {
+			err = parseErr
+		}
+		config.SubmarinerConfig.BrokerInfo = info
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s step", s.name)
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return s.name
+}
+
+func (s *Step) Description() string {
+	return s.description
+}
+
+func (s *Step) Depends() []string {
+	return []string{ssh.StepName}
+}
+
+// parseBrokerInfo returns broker info from the output, the rest of output is copied to out.
+func parseBrokerInfo(r io.Reader, out io.Writer) (string, error) {
+	info := ""
+	scanner := bufio.NewScanner(r)
+	// broker info is a single long line
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, brokerInfoPrefix) {
+			info = strings.TrimPrefix(line, brokerInfoPrefix)
+			continue
+		}
+		fmt.Fprintln(out, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if info == "" {
+		return "", errors.New("broker info not found in output")
+	}
+	return info, nil
+}
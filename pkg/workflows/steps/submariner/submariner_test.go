@@ -0,0 +1,158 @@
+package submariner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	output string
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script+f.output))
+	return err
+}
+
+func TestSubmariner(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		description string
+		step        string
+		output      string
+		cfg         steps.SubmarinerConfig
+
+		expectedErr  bool
+		expectedInfo string
+		expected     []string
+		notExpected  []string
+	}{
+		{
+			description: "broker info not found",
+			step:        BrokerStepName,
+			output:      "\n",
+			expectedErr: true,
+		},
+		{
+			description:  "broker",
+			step:         BrokerStepName,
+			output:       "\n" + brokerInfoPrefix + "c2VjcmV0\n",
+			cfg:          steps.SubmarinerConfig{Globalnet: true},
+			expectedInfo: "c2VjcmV0",
+			expected:     []string{"subctl deploy-broker", "--globalnet", DefaultVersion},
+			notExpected:  []string{"c2VjcmV0"},
+		},
+		{
+			description: "join without broker",
+			step:        JoinStepName,
+			expectedErr: true,
+		},
+		{
+			description:  "join",
+			step:         JoinStepName,
+			cfg:          steps.SubmarinerConfig{ClusterID: "sg-1", BrokerInfo: "c2VjcmV0"},
+			expectedInfo: "c2VjcmV0",
+			expected:     []string{"subctl join", "--clusterid sg-1", "--cable-driver wireguard", "echo 'c2VjcmV0'"},
+		},
+		{
+			description: "leave",
+			step:        LeaveStepName,
+			expected:    []string{"subctl uninstall"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+		tpl, _ := templatemanager.GetTemplate(tc.step)
+		if tpl == nil {
+			t.Fatalf("template %s not found", tc.step)
+		}
+
+		out := &bytes.Buffer{}
+		cfg := &steps.Config{
+			Runner:           &fakeRunner{output: tc.output},
+			SubmarinerConfig: tc.cfg,
+		}
+
+		err := New(tc.step, "", tpl).Run(context.Background(), out, cfg)
+		if tc.expectedErr != (err != nil) {
+			t.Errorf("unexpected error %v", err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if cfg.SubmarinerConfig.BrokerInfo != tc.expectedInfo {
+			t.Errorf("wrong broker info expected %s actual %s", tc.expectedInfo, cfg.SubmarinerConfig.BrokerInfo)
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s not found in %s", s, out.String())
+			}
+		}
+		for _, s := range tc.notExpected {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("unexpected %s in %s", s, out.String())
+			}
+		}
+	}
+}
+
+func TestSubmarinerError(t *testing.T) {
+	errMsg := "error has occurred"
+	tpl, _ := template.New(LeaveStepName).Parse("")
+	cfg := &steps.Config{
+		Runner: &fakeRunner{errMsg: errMsg},
+	}
+
+	err := New(LeaveStepName, "", tpl).Run(context.Background(), ioutil.Discard, cfg)
+	if err == nil || !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %v", errMsg, err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	for _, name := range []string{BrokerStepName, JoinStepName, LeaveStepName} {
+		templatemanager.SetTemplate(name, &template.Template{})
+	}
+	Init()
+	for _, name := range []string{BrokerStepName, JoinStepName, LeaveStepName} {
+		templatemanager.DeleteTemplate(name)
+
+		if s := steps.GetStep(name); s == nil || s.Name() != name {
+			t.Errorf("Step %s not found", name)
+		}
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("recover output must not be nil")
+		}
+	}()
+
+	templatemanager.DeleteTemplate(BrokerStepName)
+	Init()
+}
@@ -0,0 +1,69 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+const StepName = "upgrade"
+
+// Step upgrades kubeadm, kubelet and kubectl of a machine to a patch release
+// of kubernetes, the first master upgrades the control plane.
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(tpl *template.Template) *Step {
+	return &Step{
+		script: tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	err := steps.RunTemplate(ctx, s.script, config.Runner, out, struct {
+		IsMaster bool
+		steps.UpgradeConfig
+	}{
+		config.IsMaster,
+		config.UpgradeConfig,
+	})
+	if err != nil {
+		return errors.Wrap(err, "upgrade kubernetes step")
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "Upgrade kubernetes to a patch release"
+}
+
+func (s *Step) Depends() []string {
+	return []string{ssh.StepName}
+}
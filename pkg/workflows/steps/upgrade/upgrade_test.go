@@ -0,0 +1,185 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestUpgrade(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	testCases := []struct {
+		isMaster    bool
+		cfg         steps.UpgradeConfig
+		expected    []string
+		notExpected []string
+	}{
+		{
+			isMaster: true,
+			cfg: steps.UpgradeConfig{
+				K8SVersion: "1.15.5",
+				Apply:      true,
+			},
+			expected:    []string{"kubeadm=1.15.5-00", "kubeadm upgrade apply v1.15.5", "kubelet=1.15.5-00"},
+			notExpected: []string{"upgrade node"},
+		},
+		{
+			isMaster: true,
+			cfg: steps.UpgradeConfig{
+				K8SVersion: "1.15.5",
+			},
+			expected:    []string{"upgrade node experimental-control-plane"},
+			notExpected: []string{"upgrade apply", "--kubelet-version"},
+		},
+		{
+			cfg: steps.UpgradeConfig{
+				K8SVersion: "1.15.5",
+			},
+			expected:    []string{"--kubelet-version v1.15.5", "kubectl=1.15.5-00"},
+			notExpected: []string{"upgrade apply", "experimental-control-plane"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		output := new(bytes.Buffer)
+		cfg := &steps.Config{
+			Runner:        &fakeRunner{},
+			IsMaster:      testCase.isMaster,
+			UpgradeConfig: testCase.cfg,
+		}
+
+		task := New(tpl)
+		err = task.Run(context.Background(), output, cfg)
+
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		for _, s := range testCase.expected {
+			if !strings.Contains(output.String(), s) {
+				t.Errorf("%s not found in %s", s, output.String())
+			}
+		}
+
+		for _, s := range testCase.notExpected {
+			if strings.Contains(output.String(), s) {
+				t.Errorf("unexpected %s in %s", s, output.String())
+			}
+		}
+	}
+}
+
+func TestUpgradeError(t *testing.T) {
+	errMsg := "error has occurred"
+
+	r := &fakeRunner{
+		errMsg: errMsg,
+	}
+
+	tpl, _ := template.New(StepName).Parse("")
+	cfg := &steps.Config{
+		Runner: r,
+	}
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, cfg)
+
+	if err == nil {
+		t.Errorf("Error must not be nil")
+		return
+	}
+
+	if !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %s", errMsg, err.Error())
+	}
+}
+
+func TestStepName(t *testing.T) {
+	s := Step{}
+
+	if s.Name() != StepName {
+		t.Errorf("Unexpected step name expected %s actual %s", StepName, s.Name())
+	}
+}
+
+func TestDepends(t *testing.T) {
+	s := Step{}
+
+	if len(s.Depends()) != 1 || s.Depends()[0] != ssh.StepName {
+		t.Errorf("Wrong dependency list %v expected %v", s.Depends(), []string{ssh.StepName})
+	}
+}
+
+func TestStep_Rollback(t *testing.T) {
+	s := Step{}
+	err := s.Rollback(context.Background(), ioutil.Discard, &steps.Config{})
+
+	if err != nil {
+		t.Errorf("unexpected error while rollback %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	templatemanager.SetTemplate(StepName, &template.Template{})
+	Init()
+	templatemanager.DeleteTemplate(StepName)
+
+	s := steps.GetStep(StepName)
+
+	if s == nil {
+		t.Error("Step not found")
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("recover output must not be nil")
+		}
+	}()
+
+	templatemanager.DeleteTemplate(StepName)
+	Init()
+}
+
+func TestStep_Description(t *testing.T) {
+	s := &Step{}
+
+	if desc := s.Description(); desc == "" {
+		t.Errorf("Description must not be empty")
+	}
+}
@@ -0,0 +1,76 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	tm "github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+	"github.com/supergiant/control/pkg/workflows/steps/ssh"
+)
+
+const (
+	StepName = "wireguard"
+
+	DefaultInterface  = "wg0"
+	DefaultListenPort = 51820
+)
+
+// Step writes wireguard configuration of the node and brings the interface
+// up, the interface is removed when the node has no peers.
+type Step struct {
+	script *template.Template
+}
+
+func Init() {
+	tpl, err := tm.GetTemplate(StepName)
+
+	if err != nil {
+		panic(fmt.Sprintf("template %s not found", StepName))
+	}
+
+	steps.RegisterStep(StepName, New(tpl))
+}
+
+func New(tpl *template.Template) *Step {
+	return &Step{
+		script: tpl,
+	}
+}
+
+func (s *Step) Run(ctx context.Context, out io.Writer, config *steps.Config) error {
+	cfg := config.WireGuardConfig
+	if cfg.Interface == "" {
+		cfg.Interface = DefaultInterface
+	}
+	if cfg.ListenPort == 0 {
+		cfg.ListenPort = DefaultListenPort
+	}
+
+	err := steps.RunTemplate(ctx, s.script, config.Runner, out, cfg)
+	if err != nil {
+		return errors.Wrap(err, "configure wireguard step")
+	}
+
+	return nil
+}
+
+func (s *Step) Rollback(context.Context, io.Writer, *steps.Config) error {
+	return nil
+}
+
+func (s *Step) Name() string {
+	return StepName
+}
+
+func (s *Step) Description() string {
+	return "Configure wireguard interface"
+}
+
+func (s *Step) Depends() []string {
+	return []string{ssh.StepName}
+}
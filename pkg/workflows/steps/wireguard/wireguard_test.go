@@ -0,0 +1,151 @@
+package wireguard
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/runner"
+	"github.com/supergiant/control/pkg/templatemanager"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+type fakeRunner struct {
+	errMsg string
+}
+
+func (f *fakeRunner) Run(command *runner.Command) error {
+	if len(f.errMsg) > 0 {
+		return errors.New(f.errMsg)
+	}
+
+	_, err := io.Copy(command.Out, strings.NewReader(command.Script))
+	return err
+}
+
+func TestWireGuard(t *testing.T) {
+	err := templatemanager.Init("../../../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, _ := templatemanager.GetTemplate(StepName)
+	if tpl == nil {
+		t.Fatal("template not found")
+	}
+
+	testCases := []struct {
+		description string
+		cfg         steps.WireGuardConfig
+
+		expected    []string
+		notExpected []string
+	}{
+		{
+			description: "peers",
+			cfg: steps.WireGuardConfig{
+				Address:    "100.64.0.1/16",
+				PrivateKey: "private",
+				Peers: []steps.WireGuardPeer{
+					{
+						PublicKey:  "public",
+						Endpoint:   "1.2.3.4:51820",
+						AllowedIPs: []string{"100.64.0.2/32", "10.0.0.2/32"},
+					},
+				},
+			},
+			expected: []string{
+				"/etc/wireguard/wg0.conf",
+				"ListenPort = 51820",
+				"PrivateKey = private",
+				"PublicKey = public",
+				"Endpoint = 1.2.3.4:51820",
+				"AllowedIPs = 100.64.0.2/32, 10.0.0.2/32",
+				"wg syncconf wg0",
+			},
+		},
+		{
+			description: "no peers",
+			cfg: steps.WireGuardConfig{
+				Interface: "wg1",
+			},
+			expected:    []string{"rm -f ${WG_CONF}", "/etc/wireguard/wg1.conf"},
+			notExpected: []string{"[Interface]"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log(tc.description)
+		out := &bytes.Buffer{}
+		cfg := &steps.Config{
+			Runner:          &fakeRunner{},
+			WireGuardConfig: tc.cfg,
+		}
+
+		if err := New(tpl).Run(context.Background(), out, cfg); err != nil {
+			t.Errorf("unexpected error %v", err)
+			continue
+		}
+
+		for _, s := range tc.expected {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s not found in %s", s, out.String())
+			}
+		}
+		for _, s := range tc.notExpected {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("unexpected %s in %s", s, out.String())
+			}
+		}
+	}
+}
+
+func TestWireGuardError(t *testing.T) {
+	errMsg := "error has occurred"
+	tpl, _ := template.New(StepName).Parse("")
+	cfg := &steps.Config{
+		Runner: &fakeRunner{errMsg: errMsg},
+	}
+
+	err := New(tpl).Run(context.Background(), ioutil.Discard, cfg)
+	if err == nil || !strings.Contains(err.Error(), errMsg) {
+		t.Errorf("Error message expected to contain %s actual %v", errMsg, err)
+	}
+}
+
+func TestStepName(t *testing.T) {
+	s := Step{}
+
+	if s.Name() != StepName {
+		t.Errorf("Unexpected step name expected %s actual %s", StepName, s.Name())
+	}
+}
+
+func TestInit(t *testing.T) {
+	templatemanager.SetTemplate(StepName, &template.Template{})
+	Init()
+	templatemanager.DeleteTemplate(StepName)
+
+	s := steps.GetStep(StepName)
+
+	if s == nil {
+		t.Error("Step not found")
+	}
+}
+
+func TestInitPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("recover output must not be nil")
+		}
+	}()
+
+	templatemanager.DeleteTemplate(StepName)
+	Init()
+}
@@ -6,13 +6,16 @@ import (
 	"encoding/json"
 	"io"
 	"runtime/debug"
+	"time"
 
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/supergiant/control/pkg/clouds/apicalls"
 	"github.com/supergiant/control/pkg/sgerrors"
 	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
 	"github.com/supergiant/control/pkg/util"
 	"github.com/supergiant/control/pkg/workflows/statuses"
 	"github.com/supergiant/control/pkg/workflows/steps"
@@ -25,17 +28,39 @@ const (
 	NodeTask         = "node"
 	ClusterTask      = "cluster"
 	PreProvisionTask = "preprovision"
+	KubeletTask      = "kubelet"
+	PatchTask        = "patch"
+	UpgradeTask      = "upgrade"
+	MaintenanceTask  = "maintenance"
+	FirewallTask     = "firewall"
+	APIServerTask    = "apiserver"
+	VolumesTask      = "volumes"
+	FilesTask        = "files"
+	// GroupTask has no steps, it groups sub-tasks.
+	GroupTask = "group"
 )
 
 // Task is an entity that has it own state that can be tracked
 // and written to persistent storage through repository, it executes
 // particular workflow of steps.
 type Task struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	ID           string          `json:"id"`
 	Type         string          `json:"type"`
 	Config       *steps.Config   `json:"config"`
 	Status       statuses.Status `json:"status"`
 	StepStatuses []StepStatus    `json:"stepsStatuses"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	// FinishedAt is a time the task has got to a final status,
+	// it is zero while the task is running.
+	FinishedAt time.Time `json:"finishedAt"`
+	// TenantID is a tenant the task is resumed in by another replica.
+	TenantID string `json:"tenantId,omitempty"`
+	// ParentID is a task the task is a sub-task of.
+	ParentID string `json:"parentId,omitempty"`
+	// DependsOn are tasks that must succeed before the task starts its steps.
+	DependsOn []string `json:"dependsOn,omitempty"`
 
 	workflow   Workflow
 	repository storage.Interface
@@ -72,9 +97,10 @@ func NewTask(taskType string, repository storage.Interface) (*Task, error) {
 
 func newTask(workflowType string, workflow Workflow, repository storage.Interface) *Task {
 	return &Task{
-		ID:     uuid.New(),
-		Type:   workflowType,
-		Status: statuses.Todo,
+		ID:        uuid.New(),
+		Type:      workflowType,
+		Status:    statuses.Todo,
+		CreatedAt: time.Now(),
 
 		workflow:   workflow,
 		repository: repository,
@@ -90,24 +116,53 @@ func (t *Task) Run(ctx context.Context, config steps.Config, out io.WriteCloser)
 		return errChan
 	}
 
+	if t.Type == GroupTask {
+		errChan <- ErrGroupTask
+		return errChan
+	}
+
+	d := shutdown
+	d.running.Add(1)
+
 	go func() {
+		defer d.running.Done()
 		defer func() {
 			if r := recover(); r != nil {
 				t.Status = statuses.Error
+				t.FinishedAt = time.Now()
 				if err := t.sync(ctx); err != nil {
 					logrus.Errorf("sync error %v for task %s", err, t.ID)
 				}
 				debug.PrintStack()
+				t.notifyParent()
 				errChan <- errors.Errorf("provisioning failed, unexpected panic: %v ", r)
 			}
 		}()
 
 		t.Config = &config
+		t.TenantID = tenant.FromContext(ctx)
+		t.FinishedAt = time.Time{}
 
 		// Save task state before first step
 		if err := t.sync(ctx); err != nil {
 			logrus.Errorf("Error saving task state %v", err)
 		}
+		t.notifyParent()
+
+		if err := t.awaitDependencies(ctx); err != nil {
+			if ctx.Err() == context.Canceled {
+				t.Status = statuses.Cancelled
+			} else {
+				t.Status = statuses.Error
+			}
+			t.FinishedAt = time.Now()
+			if err := t.sync(context.Background()); err != nil {
+				logrus.Errorf("failed to sync task %s to db: %v", t.ID, err)
+			}
+			t.notifyParent()
+			errChan <- err
+			return
+		}
 
 		startIndex := 0
 		// Skip successfully finished steps in case of restart
@@ -125,18 +180,30 @@ func (t *Task) Run(ctx context.Context, config steps.Config, out io.WriteCloser)
 		err := t.startFrom(ctx, t.ID, out, startIndex)
 
 		if err != nil {
-			if ctx.Err() == context.Canceled {
+			if err == ErrInterrupted {
+				t.Status = statuses.Interrupted
+				// Save progress for a replica that resumes the task
+				if err := t.sync(context.Background()); err != nil {
+					logrus.Errorf("failed to sync task %s to db: %v", t.ID, err)
+				}
+				t.notifyParent()
+				errChan <- err
+			} else if ctx.Err() == context.Canceled {
 				t.Status = statuses.Cancelled
+				t.FinishedAt = time.Now()
 				// Save task in cancelled state
 				if err := t.sync(context.Background()); err != nil {
 					logrus.Errorf("failed to sync task %s to db: %v", t.ID, err)
 				}
+				t.notifyParent()
 				errChan <- ctx.Err()
 			} else {
 				t.Status = statuses.Error
+				t.FinishedAt = time.Now()
 				if err := t.sync(ctx); err != nil {
 					logrus.Errorf("failed to sync task %s to db: %v", t.ID, err)
 				}
+				t.notifyParent()
 				errChan <- err
 			}
 
@@ -145,12 +212,14 @@ func (t *Task) Run(ctx context.Context, config steps.Config, out io.WriteCloser)
 
 		// Set task state to success and save this state
 		t.Status = statuses.Success
+		t.FinishedAt = time.Now()
 
 		if err := t.sync(ctx); err != nil {
 			logrus.Errorf("failed to sync task %s to db: %v", t.ID, err)
 		}
 
 		logrus.Infof("Task %s has finished successfully", t.ID)
+		t.notifyParent()
 		// Notify provisioner that task output closed with error
 		if err := out.Close(); err != nil {
 			errChan <- err
@@ -161,11 +230,26 @@ func (t *Task) Run(ctx context.Context, config steps.Config, out io.WriteCloser)
 	return errChan
 }
 
+// notifyParent updates the group task the task belongs to, failures
+// are only logged since they don't affect the task itself.
+func (t *Task) notifyParent() {
+	if err := t.updateParent(context.Background()); err != nil {
+		logrus.Errorf("failed to update parent %s of task %s: %v", t.ParentID, t.ID, err)
+	}
+}
+
 // start task execution from particular step
 func (w *Task) startFrom(ctx context.Context, id string, out io.Writer, i int) error {
 	// Start workflow from the last failed step
 	wsLog := util.GetLogger(out)
 	for index := i; index < len(w.StepStatuses); index++ {
+		// Steps are never interrupted in the middle, the one in progress
+		// is completed before shutdown
+		if shutdown.draining() {
+			wsLog.Infof("interrupted before step #%d by shutdown", index)
+			return ErrInterrupted
+		}
+
 		step := w.workflow[index]
 
 		wsLog.Infof("[%s] - started", step.Name())
@@ -179,7 +263,9 @@ func (w *Task) startFrom(ctx context.Context, id string, out io.Writer, i int) e
 			logrus.Errorf("sync error %v", err)
 		}
 
-		if err := step.Run(ctx, out, w.Config); err != nil {
+		// cloud calls of the step are counted against its account
+		stepCtx := apicalls.WithStep(apicalls.WithAccount(ctx, w.Config.CloudAccountName), step.Name())
+		if err := step.Run(stepCtx, out, w.Config); err != nil {
 			// Mark step status as error
 			w.StepStatuses[index].Status = statuses.Error
 			w.Status = statuses.Error
@@ -191,7 +277,7 @@ func (w *Task) startFrom(ctx context.Context, id string, out io.Writer, i int) e
 				logrus.Errorf("sync error %v for step %s", err2, step.Name())
 			}
 
-			if err3 := step.Rollback(ctx, out, w.Config); err3 != nil {
+			if err3 := step.Rollback(stepCtx, out, w.Config); err3 != nil {
 				logrus.Errorf("rollback: step %s : %v", step.Name(), err3)
 			}
 
@@ -213,6 +299,7 @@ func (w *Task) startFrom(ctx context.Context, id string, out io.Writer, i int) e
 
 // synchronize state of workflow to storage
 func (w *Task) sync(ctx context.Context) error {
+	w.SchemaVersion = Migrator.Version()
 	data, err := json.Marshal(w)
 	buf := &bytes.Buffer{}
 
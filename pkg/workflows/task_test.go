@@ -41,10 +41,19 @@ func (f *MockRepository) Get(ctx context.Context, prefix string, key string) ([]
 }
 
 func (f *MockRepository) GetAll(ctx context.Context, prefix string) ([][]byte, error) {
-	return nil, nil
+	result := make([][]byte, 0)
+	for key, value := range f.storage {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, value)
+		}
+	}
+
+	return result, nil
 }
 
 func (f *MockRepository) Delete(ctx context.Context, prefix string, key string) error {
+	delete(f.storage, prefix+key)
+
 	return nil
 }
 
@@ -0,0 +1,289 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+)
+
+// AggregateStatus summarizes a task together with all of its sub-tasks.
+type AggregateStatus string
+
+const (
+	AggregatePending   AggregateStatus = "pending"
+	AggregateRunning   AggregateStatus = "running"
+	AggregateSucceeded AggregateStatus = "succeeded"
+	AggregateFailed    AggregateStatus = "failed"
+	// AggregatePartial means some of the sub-tasks have failed
+	// and the others have succeeded.
+	AggregatePartial AggregateStatus = "partial"
+)
+
+// ErrDependencyFailed is returned by tasks whose dependency hasn't succeeded.
+var ErrDependencyFailed = errors.New("task dependency has failed")
+
+// ErrGroupTask is returned when a group task is run, it has no steps
+// and its status follows sub-tasks.
+var ErrGroupTask = errors.New("group task can't be run")
+
+// dependencyInterval is how often a task checks whether its dependencies have finished.
+var dependencyInterval = 5 * time.Second
+
+// parents serializes updates of group tasks made by their sub-tasks.
+var parents sync.Mutex
+
+// TaskTree is a task with its sub-tasks and the aggregate status of all of them.
+type TaskTree struct {
+	*Task
+	AggregateStatus AggregateStatus `json:"aggregateStatus"`
+	Children        []*TaskTree     `json:"children,omitempty"`
+}
+
+// NewTaskGroup creates a task that has no steps of its own and groups
+// sub-tasks, e.g. of a batch operation, its status follows the sub-tasks.
+func NewTaskGroup(repository storage.Interface) (*Task, error) {
+	t := newTask(GroupTask, nil, repository)
+	return t, t.sync(context.Background())
+}
+
+// NewSubTask creates a task of the parent, the task doesn't start
+// its steps until all of dependsOn tasks have succeeded.
+func NewSubTask(taskType string, parent *Task, repository storage.Interface, dependsOn ...*Task) (*Task, error) {
+	t, err := NewTask(taskType, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	t.ParentID = parent.ID
+	for _, dep := range dependsOn {
+		t.DependsOn = append(t.DependsOn, dep.ID)
+	}
+
+	return t, t.sync(context.Background())
+}
+
+// Children returns sub-tasks of the task ordered by creation time.
+func Children(ctx context.Context, repository storage.Interface, id string) ([]*Task, error) {
+	byParent, err := tasksByParent(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return byParent[id], nil
+}
+
+// BuildTree returns the task with all of its sub-tasks.
+func BuildTree(ctx context.Context, repository storage.Interface, id string) (*TaskTree, error) {
+	root, err := getTask(ctx, repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	byParent, err := tasksByParent(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTree(root, byParent, map[string]bool{}), nil
+}
+
+func buildTree(t *Task, byParent map[string][]*Task, visited map[string]bool) *TaskTree {
+	visited[t.ID] = true
+	tree := &TaskTree{Task: t}
+
+	members := make([]AggregateStatus, 0, len(byParent[t.ID])+1)
+	// group tasks have no steps, only sub-tasks are taken into account
+	if t.Type != GroupTask {
+		members = append(members, leafStatus(t.Status))
+	}
+	for _, child := range byParent[t.ID] {
+		if visited[child.ID] {
+			continue
+		}
+		sub := buildTree(child, byParent, visited)
+		tree.Children = append(tree.Children, sub)
+		members = append(members, sub.AggregateStatus)
+	}
+	tree.AggregateStatus = aggregate(members)
+
+	return tree
+}
+
+func tasksByParent(ctx context.Context, repository storage.Interface) (map[string][]*Task, error) {
+	rawTasks, err := repository.GetAll(ctx, Prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "storage: get all")
+	}
+
+	byParent := make(map[string][]*Task)
+	for _, raw := range rawTasks {
+		t := &Task{}
+		if err = json.Unmarshal(raw, t); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+		if t.ParentID != "" {
+			byParent[t.ParentID] = append(byParent[t.ParentID], t)
+		}
+	}
+
+	for _, tasks := range byParent {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+		})
+	}
+
+	return byParent, nil
+}
+
+func leafStatus(status statuses.Status) AggregateStatus {
+	switch status {
+	case statuses.Success:
+		return AggregateSucceeded
+	case statuses.Error, statuses.Cancelled:
+		return AggregateFailed
+	case statuses.Todo, "":
+		return AggregatePending
+	default:
+		return AggregateRunning
+	}
+}
+
+func aggregate(members []AggregateStatus) AggregateStatus {
+	var pending, running, succeeded, failed int
+	for _, s := range members {
+		switch s {
+		case AggregatePending:
+			pending++
+		case AggregateRunning:
+			running++
+		case AggregateSucceeded:
+			succeeded++
+		case AggregateFailed:
+			failed++
+		}
+	}
+
+	switch {
+	case pending == len(members):
+		return AggregatePending
+	case pending+running > 0:
+		return AggregateRunning
+	case succeeded == len(members):
+		return AggregateSucceeded
+	case failed == len(members):
+		return AggregateFailed
+	default:
+		return AggregatePartial
+	}
+}
+
+// awaitDependencies blocks until all dependencies of the task have succeeded.
+func (t *Task) awaitDependencies(ctx context.Context) error {
+	for _, id := range t.DependsOn {
+		for {
+			status, err := t.dependencyStatus(ctx, id)
+			if err != nil {
+				return err
+			}
+			if status == statuses.Success {
+				break
+			}
+			if isFinished(status) {
+				return errors.Wrapf(ErrDependencyFailed, "task %s is in %s status", id, status)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(dependencyInterval):
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Task) dependencyStatus(ctx context.Context, id string) (statuses.Status, error) {
+	dep, err := getTask(ctx, t.repository, id)
+	if sgerrors.IsNotFound(err) {
+		return "", errors.Wrapf(ErrDependencyFailed, "task %s not found", id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return dep.Status, nil
+}
+
+func getTask(ctx context.Context, repository storage.Interface, id string) (*Task, error) {
+	raw, err := repository.Get(ctx, Prefix, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "storage: get task %s", id)
+	}
+	if len(raw) == 0 {
+		return nil, errors.Wrapf(sgerrors.ErrNotFound, "task %s", id)
+	}
+
+	task := &Task{}
+	if err = json.Unmarshal(raw, task); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal task %s", id)
+	}
+
+	return task, nil
+}
+
+// updateParent brings statuses of group tasks the task belongs to
+// in line with all of their sub-tasks.
+func (t *Task) updateParent(ctx context.Context) error {
+	parents.Lock()
+	defer parents.Unlock()
+
+	for id := t.ParentID; id != ""; {
+		// sub-tasks of tasks with steps don't change the parent
+		parent, err := getTask(ctx, t.repository, id)
+		if sgerrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil || parent.Type != GroupTask {
+			return err
+		}
+
+		tree, err := BuildTree(ctx, t.repository, id)
+		if err != nil {
+			return err
+		}
+
+		parent = tree.Task
+		parent.repository = t.repository
+		switch tree.AggregateStatus {
+		case AggregatePending:
+			parent.Status = statuses.Todo
+		case AggregateRunning:
+			parent.Status = statuses.Executing
+		case AggregateSucceeded:
+			parent.Status = statuses.Success
+		default:
+			parent.Status = statuses.Error
+		}
+
+		parent.FinishedAt = time.Time{}
+		if isFinished(parent.Status) {
+			parent.FinishedAt = time.Now()
+		}
+
+		if err = parent.sync(ctx); err != nil {
+			return err
+		}
+		id = parent.ParentID
+	}
+
+	return nil
+}
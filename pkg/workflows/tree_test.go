@@ -0,0 +1,190 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/sgerrors"
+	"github.com/supergiant/control/pkg/workflows/statuses"
+	"github.com/supergiant/control/pkg/workflows/steps"
+)
+
+func TestAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		members  []AggregateStatus
+		expected AggregateStatus
+	}{
+		{
+			name:     "no members",
+			expected: AggregatePending,
+		},
+		{
+			name:     "not started",
+			members:  []AggregateStatus{AggregatePending, AggregatePending},
+			expected: AggregatePending,
+		},
+		{
+			name:     "started",
+			members:  []AggregateStatus{AggregateSucceeded, AggregatePending},
+			expected: AggregateRunning,
+		},
+		{
+			name:     "running",
+			members:  []AggregateStatus{AggregateFailed, AggregateRunning},
+			expected: AggregateRunning,
+		},
+		{
+			name:     "succeeded",
+			members:  []AggregateStatus{AggregateSucceeded, AggregateSucceeded},
+			expected: AggregateSucceeded,
+		},
+		{
+			name:     "failed",
+			members:  []AggregateStatus{AggregateFailed, AggregateFailed},
+			expected: AggregateFailed,
+		},
+		{
+			name:     "partial",
+			members:  []AggregateStatus{AggregateSucceeded, AggregateFailed},
+			expected: AggregatePartial,
+		},
+		{
+			name:     "partial sub-tree",
+			members:  []AggregateStatus{AggregatePartial, AggregateSucceeded},
+			expected: AggregatePartial,
+		},
+	} {
+		require.Equal(t, tc.expected, aggregate(tc.members), "TC: %s", tc.name)
+	}
+}
+
+func storeTask(t *testing.T, repo *MockRepository, task *Task) {
+	raw, err := json.Marshal(task)
+	require.NoError(t, err)
+	repo.storage[Prefix+task.ID] = raw
+}
+
+func TestBuildTree(t *testing.T) {
+	repo := &MockRepository{storage: map[string][]byte{}}
+	now := time.Now()
+	for _, task := range []*Task{
+		{ID: "group", Type: GroupTask},
+		{ID: "cluster", Type: ClusterTask, Status: statuses.Success, ParentID: "group", CreatedAt: now},
+		{ID: "master", Type: MasterTask, Status: statuses.Success, ParentID: "cluster", CreatedAt: now},
+		{ID: "node", Type: NodeTask, Status: statuses.Error, ParentID: "cluster", CreatedAt: now.Add(time.Second)},
+		{ID: "other", Type: ClusterTask, Status: statuses.Success, ParentID: "group", CreatedAt: now.Add(time.Second)},
+	} {
+		storeTask(t, repo, task)
+	}
+
+	tree, err := BuildTree(context.Background(), repo, "group")
+	require.NoError(t, err)
+	require.Equal(t, AggregatePartial, tree.AggregateStatus)
+	require.Len(t, tree.Children, 2)
+
+	cluster := tree.Children[0]
+	require.Equal(t, "cluster", cluster.ID)
+	require.Equal(t, AggregatePartial, cluster.AggregateStatus)
+	require.Equal(t, "master", cluster.Children[0].ID)
+	require.Equal(t, AggregateFailed, cluster.Children[1].AggregateStatus)
+	require.Equal(t, AggregateSucceeded, tree.Children[1].AggregateStatus)
+
+	children, err := Children(context.Background(), repo, "cluster")
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+
+	_, err = BuildTree(context.Background(), repo, "missing")
+	require.True(t, sgerrors.IsNotFound(err))
+}
+
+func TestTaskRunDependencies(t *testing.T) {
+	repo := &MockRepository{storage: map[string][]byte{}}
+	workflowMap = make(map[string]Workflow)
+	RegisterWorkFlow("ok", []steps.Step{&MockStep{name: "ok"}})
+	RegisterWorkFlow("fail", []steps.Step{&MockStep{name: "fail", errs: []error{errors.New("failed")}}})
+
+	group, err := NewTaskGroup(repo)
+	require.NoError(t, err)
+	require.Equal(t, ErrGroupTask, <-group.Run(context.Background(), steps.Config{}, &bufferCloser{}))
+
+	first, err := NewSubTask("fail", group, repo)
+	require.NoError(t, err)
+	second, err := NewSubTask("ok", group, repo, first)
+	require.NoError(t, err)
+	require.Equal(t, []string{first.ID}, second.DependsOn)
+
+	require.Error(t, <-first.Run(context.Background(), steps.Config{}, &bufferCloser{}))
+
+	err = <-second.Run(context.Background(), steps.Config{}, &bufferCloser{})
+	require.Equal(t, ErrDependencyFailed, pkgerrors.Cause(err))
+	require.Equal(t, statuses.Error, second.Status)
+
+	stored, err := getTask(context.Background(), repo, group.ID)
+	require.NoError(t, err)
+	require.Equal(t, statuses.Error, stored.Status)
+	require.False(t, stored.FinishedAt.IsZero())
+
+	third, err := NewSubTask("ok", group, repo)
+	require.NoError(t, err)
+	fourth, err := NewSubTask("ok", group, repo, third)
+	require.NoError(t, err)
+
+	// the dependency hasn't finished yet
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, <-fourth.Run(ctx, steps.Config{}, &bufferCloser{}))
+	require.Equal(t, statuses.Cancelled, fourth.Status)
+
+	require.NoError(t, <-third.Run(context.Background(), steps.Config{}, &bufferCloser{}))
+	require.NoError(t, <-fourth.Run(context.Background(), steps.Config{}, &bufferCloser{}))
+
+	tree, err := BuildTree(context.Background(), repo, group.ID)
+	require.NoError(t, err)
+	require.Equal(t, AggregatePartial, tree.AggregateStatus)
+}
+
+func TestTaskHandler_GetTaskTree(t *testing.T) {
+	repo := &MockRepository{storage: map[string][]byte{}}
+	storeTask(t, repo, &Task{ID: "parent", Type: ClusterTask, Status: statuses.Success})
+	storeTask(t, repo, &Task{ID: "child", Type: NodeTask, Status: statuses.Executing, ParentID: "parent"})
+
+	router := mux.NewRouter()
+	(&TaskHandler{repository: repo}).Register(router)
+
+	for _, tc := range []struct {
+		id           string
+		expectedCode int
+	}{
+		{
+			id:           "missing",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			id:           "parent",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks/"+tc.id+"/tree", nil))
+		require.Equal(t, tc.expectedCode, rec.Code, "TC: %s", tc.id)
+		if tc.expectedCode != http.StatusOK {
+			continue
+		}
+
+		tree := &TaskTree{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(tree))
+		require.Equal(t, AggregateRunning, tree.AggregateStatus)
+		require.Equal(t, "child", tree.Children[0].ID)
+		require.Equal(t, "parent", tree.Children[0].ParentID)
+	}
+}
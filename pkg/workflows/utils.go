@@ -8,8 +8,14 @@ import (
 )
 
 func DeserializeTask(data []byte, repository storage.Interface) (*Task, error) {
+	data, _, err := Migrator.Upgrade(data)
+
+	if err != nil {
+		return nil, err
+	}
+
 	task := &Task{}
-	err := json.Unmarshal(data, task)
+	err = json.Unmarshal(data, task)
 
 	if err != nil {
 		return nil, err
@@ -24,11 +30,13 @@ func DeserializeTask(data []byte, repository storage.Interface) (*Task, error) {
 	// TODO(stgleb): Move ssh runner creation to task Restart method
 	if task.Config != nil && task.Config.Node.PublicIp != "" {
 		cfg := ssh.Config{
-			Host:    task.Config.Node.PublicIp,
-			Port:    task.Config.Kube.SSHConfig.Port,
-			User:    task.Config.Kube.SSHConfig.User,
-			Timeout: task.Config.Kube.SSHConfig.Timeout,
-			Key:     []byte(task.Config.Kube.SSHConfig.BootstrapPrivateKey),
+			Host:        task.Config.Node.PublicIp,
+			Port:        task.Config.Kube.SSHConfig.Port,
+			User:        task.Config.Kube.SSHConfig.User,
+			Timeout:     task.Config.Kube.SSHConfig.Timeout,
+			Key:         []byte(task.Config.Kube.SSHConfig.BootstrapPrivateKey),
+			Passphrase:  task.Config.Kube.SSHConfig.Passphrase,
+			AgentSocket: task.Config.Kube.SSHConfig.AgentSocket,
 		}
 
 		task.Config.Runner, err = ssh.NewRunner(cfg)
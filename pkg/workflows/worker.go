@@ -0,0 +1,175 @@
+package workflows
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supergiant/control/pkg/storage"
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+const (
+	DefaultTaskLease = 30 * time.Second
+
+	// a task that crashes workers is given up after this number of claims
+	maxAttempts  = 3
+	pollInterval = time.Second
+)
+
+// Executor runs a task claimed from the queue and returns its result.
+type Executor func(ctx context.Context, t *Task) error
+
+// Worker claims tasks from the queue and runs them, workers of all control
+// replicas share the queue so provisioning can be scaled horizontally.
+type Worker struct {
+	id         string
+	queue      *Queue
+	repository storage.Interface
+	execute    Executor
+	slots      int
+	lease      time.Duration
+}
+
+// NewWorker constructs a Worker that runs up to slots tasks at once.
+func NewWorker(id string, queue *Queue, repository storage.Interface,
+	slots int, lease time.Duration, execute Executor) *Worker {
+	return &Worker{
+		id:         id,
+		queue:      queue,
+		repository: repository,
+		execute:    execute,
+		slots:      slots,
+		lease:      lease,
+	}
+}
+
+// Run blocks and processes tasks until ctx is cancelled, tasks that are
+// still running are returned to the queue for other workers.
+func (w *Worker) Run(ctx context.Context) {
+	slots := make(chan struct{}, w.slots)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	// claims of running tasks are released before Run returns
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// no new tasks are taken during shutdown
+		for len(slots) < cap(slots) && !shutdown.draining() {
+			c, err := w.queue.Claim(ctx, w.id, w.lease)
+			if err != nil {
+				logrus.Errorf("worker %s: claim task: %v", w.id, err)
+				break
+			}
+			if c == nil {
+				break
+			}
+
+			slots <- struct{}{}
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				defer func() { <-slots }()
+				w.process(ctx, c)
+			}()
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, c *Claim) {
+	taskCtx, cancel := context.WithCancel(tenant.WithID(ctx, c.TenantID))
+	defer cancel()
+
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.heartbeat(taskCtx, c, cancel)
+	}()
+
+	err := w.run(taskCtx, c)
+	cancel()
+	<-heartbeatDone
+
+	switch {
+	case ctx.Err() != nil || err == ErrInterrupted:
+		// the worker is stopping, the task is resumed by another one
+		if err := w.queue.Release(context.Background(), c); err != nil {
+			logrus.Errorf("worker %s: release task %s: %v", w.id, c.TaskID, err)
+		}
+		return
+	case err == ErrClaimLost:
+		return
+	case err != nil:
+		logrus.Errorf("worker %s: task %s has finished with error %v", w.id, c.TaskID, err)
+	default:
+		logrus.Infof("worker %s: task %s has finished", w.id, c.TaskID)
+	}
+
+	if err = w.queue.Complete(context.Background(), c); err != nil {
+		logrus.Errorf("worker %s: complete task %s: %v", w.id, c.TaskID, err)
+	}
+}
+
+func (w *Worker) run(ctx context.Context, c *Claim) error {
+	if c.Attempts > maxAttempts {
+		return errors.Errorf("task has been claimed %d times, giving up", c.Attempts)
+	}
+
+	data, err := w.repository.Get(ctx, Prefix, c.TaskID)
+	if err != nil {
+		return errors.Wrap(err, "get task")
+	}
+
+	t, err := DeserializeTask(data, w.repository)
+	if err != nil {
+		return errors.Wrap(err, "deserialize task")
+	}
+	if t.Config == nil {
+		return errors.New("task has no config")
+	}
+
+	err = w.execute(ctx, t)
+	if ctx.Err() != nil {
+		// the claim has been lost or cancelled while the task was running
+		if current, getErr := w.queue.get(context.Background(), c.TaskID); getErr == nil && current.Worker != c.Worker {
+			return ErrClaimLost
+		}
+	}
+
+	return err
+}
+
+// heartbeat renews the lease until ctx is done, the task is stopped
+// when the claim is lost or the task is cancelled.
+func (w *Worker) heartbeat(ctx context.Context, c *Claim, stop func()) {
+	ticker := time.NewTicker(w.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.queue.Heartbeat(ctx, c, w.lease)
+			if err == ErrClaimLost || err == ErrTaskCancelled {
+				logrus.Warnf("worker %s: stop task %s: %v", w.id, c.TaskID, err)
+				stop()
+				return
+			}
+			if err != nil {
+				logrus.Errorf("worker %s: heartbeat task %s: %v", w.id, c.TaskID, err)
+			}
+		}
+	}
+}
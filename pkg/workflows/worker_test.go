@@ -0,0 +1,102 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/supergiant/control/pkg/tenant"
+)
+
+func TestWorker_Run(t *testing.T) {
+	q, repository, _ := newTestQueue(t)
+	task := submit(t, tenant.WithID(context.Background(), "acme"), q, repository)
+
+	executed := make(chan string, 1)
+	w := NewWorker("w1", q, repository, 1, time.Minute, func(ctx context.Context, t *Task) error {
+		executed <- tenant.FromContext(ctx) + "/" + t.Config.ClusterID
+		return errors.New("failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case got := <-executed:
+		require.Equal(t, "acme/kube", got, "task must run in its tenant with the stored config")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("task %s hasn't been executed", task.ID)
+	}
+
+	// failed tasks are completed, their status is kept by the task
+	for i := 0; i < 50; i++ {
+		claims, err := q.List(context.Background())
+		require.NoError(t, err)
+		if len(claims) == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("executed task must be removed from the queue")
+}
+
+func TestWorker_process(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		attempts       int
+		stopWorker     bool
+		expectedRun    bool
+		expectedQueued bool
+	}{
+		{
+			name:        "completed",
+			expectedRun: true,
+		},
+		{
+			name:     "too many attempts",
+			attempts: maxAttempts,
+		},
+		{
+			name:           "worker is stopping",
+			stopWorker:     true,
+			expectedRun:    true,
+			expectedQueued: true,
+		},
+	} {
+		q, repository, now := newTestQueue(t)
+		submit(t, context.Background(), q, repository)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		run := false
+		w := NewWorker("w1", q, repository, 1, time.Minute, func(context.Context, *Task) error {
+			run = true
+			if tc.stopWorker {
+				cancel()
+			}
+			return nil
+		})
+
+		// previous claims expire as if workers have crashed
+		for i := 0; i <= tc.attempts; i++ {
+			*now = now.Add(time.Second)
+			c, err := q.Claim(context.Background(), "w1", 0)
+			require.NoError(t, err, "TC: %s", tc.name)
+			if i == tc.attempts {
+				w.process(ctx, c)
+			}
+		}
+		cancel()
+
+		require.Equal(t, tc.expectedRun, run, "TC: %s", tc.name)
+		claims, err := q.List(context.Background())
+		require.NoError(t, err, "TC: %s", tc.name)
+		require.Equal(t, tc.expectedQueued, len(claims) == 1, "TC: %s", tc.name)
+		if tc.expectedQueued {
+			require.Empty(t, claims[0].Worker, "TC: %s", tc.name)
+		}
+	}
+}
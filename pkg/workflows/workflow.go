@@ -6,20 +6,32 @@ import (
 	"github.com/supergiant/control/pkg/workflows/statuses"
 	"github.com/supergiant/control/pkg/workflows/steps"
 	"github.com/supergiant/control/pkg/workflows/steps/authorizedKeys"
+	"github.com/supergiant/control/pkg/workflows/steps/bootstraptoken"
 	"github.com/supergiant/control/pkg/workflows/steps/certificates"
 	"github.com/supergiant/control/pkg/workflows/steps/clustercheck"
+	"github.com/supergiant/control/pkg/workflows/steps/dashboardaddon"
+	"github.com/supergiant/control/pkg/workflows/steps/datavolumes"
 	"github.com/supergiant/control/pkg/workflows/steps/docker"
 	"github.com/supergiant/control/pkg/workflows/steps/downloadk8sbinary"
 	"github.com/supergiant/control/pkg/workflows/steps/drain"
+	"github.com/supergiant/control/pkg/workflows/steps/etcdmaintenance"
+	"github.com/supergiant/control/pkg/workflows/steps/files"
+	"github.com/supergiant/control/pkg/workflows/steps/gitopsaddon"
 	"github.com/supergiant/control/pkg/workflows/steps/kubeadm"
 	"github.com/supergiant/control/pkg/workflows/steps/kubelet"
 	"github.com/supergiant/control/pkg/workflows/steps/network"
+	"github.com/supergiant/control/pkg/workflows/steps/patch"
 	"github.com/supergiant/control/pkg/workflows/steps/poststart"
 	"github.com/supergiant/control/pkg/workflows/steps/prometheus"
 	"github.com/supergiant/control/pkg/workflows/steps/provider"
+	"github.com/supergiant/control/pkg/workflows/steps/snapshotaddon"
 	"github.com/supergiant/control/pkg/workflows/steps/ssh"
 	"github.com/supergiant/control/pkg/workflows/steps/storageclass"
+	"github.com/supergiant/control/pkg/workflows/steps/submariner"
 	"github.com/supergiant/control/pkg/workflows/steps/tiller"
+	"github.com/supergiant/control/pkg/workflows/steps/uncordon"
+	"github.com/supergiant/control/pkg/workflows/steps/upgrade"
+	"github.com/supergiant/control/pkg/workflows/steps/wireguard"
 )
 
 // StepStatus aggregates data that is needed to track progress
@@ -42,6 +54,30 @@ const (
 	ProvisionNode   = "ProvisionNode"
 	DeleteNode      = "DeleteNode"
 	DeleteCluster   = "DeleteCluster"
+	UpdateKubelet   = "UpdateKubelet"
+	PatchNode       = "PatchNode"
+	UpgradeMaster   = "UpgradeMaster"
+	UpgradeNode     = "UpgradeNode"
+	EtcdMaintenance = "EtcdMaintenance"
+	ImportMaster    = "ImportMaster"
+	ImportNode      = "ImportNode"
+	DeleteOrphan    = "DeleteOrphan"
+	PeerNetworks    = "PeerNetworks"
+	UnpeerNetworks  = "UnpeerNetworks"
+	WireGuard       = "WireGuard"
+	UpdateFirewall  = "UpdateFirewall"
+	UpdateDNS       = "UpdateDNS"
+
+	SubmarinerBroker = "SubmarinerBroker"
+	SubmarinerJoin   = "SubmarinerJoin"
+	SubmarinerLeave  = "SubmarinerLeave"
+
+	UpdateAPIServerAccess = "UpdateAPIServerAccess"
+	DeleteDisks           = "DeleteDisks"
+	DistributeFiles       = "DistributeFiles"
+	// DistributeFilesAgent writes files through the node agent, its tasks
+	// get their runners from the caller.
+	DistributeFilesAgent = "DistributeFilesAgent"
 )
 
 type WorkflowSet struct {
@@ -62,50 +98,138 @@ func Init() {
 
 	preProvision := []steps.Step{
 		provider.StepPreProvision{},
+		provider.StepRestrictAPIServer{},
 	}
 
 	masterWorkflow := []steps.Step{
 		provider.StepCreateMachine{},
 		steps.GetStep(ssh.StepName),
 		steps.GetStep(authorizedKeys.StepName),
+		// data volumes are mounted before docker, e.g. at /var/lib/docker
+		steps.GetStep(datavolumes.StepName),
 		steps.GetStep(downloadk8sbinary.StepName),
 		steps.GetStep(docker.StepName),
 		steps.GetStep(certificates.StepName),
+		steps.GetStep(bootstraptoken.StepName),
 		steps.GetStep(kubeadm.StepName),
 		steps.GetStep(kubelet.StepName),
 		steps.GetStep(poststart.StepName),
+		steps.GetStep(bootstraptoken.ExpireStepName),
 	}
 
 	nodeWorkflow := []steps.Step{
 		provider.StepCreateMachine{},
 		steps.GetStep(ssh.StepName),
 		steps.GetStep(authorizedKeys.StepName),
+		steps.GetStep(datavolumes.StepName),
+		steps.GetStep(downloadk8sbinary.StepName),
+		steps.GetStep(docker.StepName),
+		steps.GetStep(certificates.StepName),
+		steps.GetStep(bootstraptoken.StepName),
+		steps.GetStep(kubeadm.StepName),
+		steps.GetStep(kubelet.StepName),
+		steps.GetStep(poststart.StepName),
+		steps.GetStep(bootstraptoken.ExpireStepName),
+	}
+
+	// Import workflows install kubernetes on existing machines
+	importMasterWorkflow := []steps.Step{
+		provider.StepRegisterMachine{},
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(downloadk8sbinary.StepName),
+		steps.GetStep(docker.StepName),
+		steps.GetStep(certificates.StepName),
+		steps.GetStep(bootstraptoken.StepName),
+		steps.GetStep(kubeadm.StepName),
+		steps.GetStep(kubelet.StepName),
+		steps.GetStep(poststart.StepName),
+		steps.GetStep(bootstraptoken.ExpireStepName),
+	}
+
+	importNodeWorkflow := []steps.Step{
+		provider.StepRegisterMachine{},
+		steps.GetStep(ssh.StepName),
 		steps.GetStep(downloadk8sbinary.StepName),
 		steps.GetStep(docker.StepName),
 		steps.GetStep(certificates.StepName),
+		steps.GetStep(bootstraptoken.StepName),
 		steps.GetStep(kubeadm.StepName),
 		steps.GetStep(kubelet.StepName),
 		steps.GetStep(poststart.StepName),
+		steps.GetStep(bootstraptoken.ExpireStepName),
 	}
 
 	postProvision := []steps.Step{
+		provider.StepUpdateDNS{},
 		steps.GetStep(ssh.StepName),
 		steps.GetStep(network.StepName),
 		steps.GetStep(clustercheck.StepName),
 		steps.GetStep(storageclass.StepName),
 		steps.GetStep(tiller.StepName),
 		steps.GetStep(prometheus.StepName),
+		steps.GetStep(gitopsaddon.StepName),
+		steps.GetStep(dashboardaddon.StepName),
+		steps.GetStep(snapshotaddon.StepName),
 	}
 
+	// nodes are drained through the eviction api before their machines are deleted
 	deleteMachineWorkflow := []steps.Step{
-		steps.GetStep(drain.StepName),
+		provider.StepDeleteMachine{},
+	}
+
+	// instances that have never joined the cluster have nothing to drain
+	deleteOrphanWorkflow := []steps.Step{
 		provider.StepDeleteMachine{},
 	}
 
 	deleteClusterWorkflow := []steps.Step{
+		provider.StepDeleteDNS{},
 		provider.StepCleanUp{},
 	}
 
+	updateKubeletWorkflow := []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(kubelet.StepName),
+	}
+
+	patchNodeWorkflow := []steps.Step{
+		steps.GetStep(drain.StepName),
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(patch.StepName),
+		steps.GetStep(uncordon.StepName),
+	}
+
+	// masters aren't drained, drain runs kubectl on a master
+	upgradeMasterWorkflow := []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(upgrade.StepName),
+	}
+
+	upgradeNodeWorkflow := []steps.Step{
+		steps.GetStep(drain.StepName),
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(upgrade.StepName),
+		steps.GetStep(uncordon.StepName),
+	}
+
+	wireGuardWorkflow := []steps.Step{
+		provider.StepAllowWireGuard{},
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(wireguard.StepName),
+	}
+
+	submarinerJoinWorkflow := []steps.Step{
+		// gateways tunnel traffic over the nat-t port, it is opened like the wireguard one
+		provider.StepAllowWireGuard{},
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(submariner.JoinStepName),
+	}
+
+	etcdMaintenanceWorkflow := []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(etcdmaintenance.StepName),
+	}
+
 	m.Lock()
 	defer m.Unlock()
 
@@ -115,6 +239,37 @@ func Init() {
 	workflowMap[DeleteNode] = deleteMachineWorkflow
 	workflowMap[DeleteCluster] = deleteClusterWorkflow
 	workflowMap[PostProvision] = postProvision
+	workflowMap[UpdateKubelet] = updateKubeletWorkflow
+	workflowMap[PatchNode] = patchNodeWorkflow
+	workflowMap[UpgradeMaster] = upgradeMasterWorkflow
+	workflowMap[UpgradeNode] = upgradeNodeWorkflow
+	workflowMap[EtcdMaintenance] = etcdMaintenanceWorkflow
+	workflowMap[DistributeFiles] = []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(files.StepName),
+	}
+	workflowMap[DistributeFilesAgent] = []steps.Step{
+		steps.GetStep(files.StepName),
+	}
+	workflowMap[ImportMaster] = importMasterWorkflow
+	workflowMap[ImportNode] = importNodeWorkflow
+	workflowMap[DeleteOrphan] = deleteOrphanWorkflow
+	workflowMap[PeerNetworks] = []steps.Step{provider.StepPeerNetworks{}}
+	workflowMap[UnpeerNetworks] = []steps.Step{provider.StepUnpeerNetworks{}}
+	workflowMap[WireGuard] = wireGuardWorkflow
+	workflowMap[UpdateFirewall] = []steps.Step{provider.StepUpdateFirewall{}}
+	workflowMap[UpdateDNS] = []steps.Step{provider.StepUpdateDNS{}}
+	workflowMap[UpdateAPIServerAccess] = []steps.Step{provider.StepRestrictAPIServer{}}
+	workflowMap[DeleteDisks] = []steps.Step{provider.StepDeleteDisks{}}
+	workflowMap[SubmarinerBroker] = []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(submariner.BrokerStepName),
+	}
+	workflowMap[SubmarinerJoin] = submarinerJoinWorkflow
+	workflowMap[SubmarinerLeave] = []steps.Step{
+		steps.GetStep(ssh.StepName),
+		steps.GetStep(submariner.LeaveStepName),
+	}
 }
 
 func RegisterWorkFlow(workflowName string, workflow Workflow) {
@@ -0,0 +1,6 @@
+{{ if .Create }}
+sudo kubeadm token create {{ .Token }} --ttl {{ .TTL }} \
+--description "{{ .Description }}" > /dev/null
+{{ else }}
+sudo kubeadm token delete {{ .ID }} || true
+{{ end }}
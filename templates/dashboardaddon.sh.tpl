@@ -0,0 +1,23 @@
+{{ if eq .Tool "kubernetes-dashboard" }}
+echo "Installing Kubernetes Dashboard"
+sudo kubectl apply -f https://raw.githubusercontent.com/kubernetes/dashboard/v2.0.0/aio/deploy/recommended.yaml
+# control is the auth proxy of the dashboard, users skip the login
+# and get permissions of the service account of the dashboard
+sudo kubectl -n {{ .Namespace }} patch deployment kubernetes-dashboard --type json \
+    -p '[{"op": "add", "path": "/spec/template/spec/containers/0/args/-", "value": "--enable-skip-login"}]'
+{{ end }}
+
+{{ if eq .Tool "headlamp" }}
+echo "Installing Headlamp"
+sudo kubectl apply -f https://raw.githubusercontent.com/kinvolk/headlamp/main/kubernetes-headlamp.yaml
+sudo kubectl -n {{ .Namespace }} create serviceaccount {{ .ServiceAccount }} --dry-run -o yaml | sudo kubectl apply -f -
+sudo kubectl -n {{ .Namespace }} set serviceaccount deployment headlamp {{ .ServiceAccount }}
+{{ end }}
+
+sudo kubectl create clusterrolebinding supergiant-dashboard \
+    --clusterrole={{ .ClusterRole }} \
+    --serviceaccount={{ .Namespace }}:{{ .ServiceAccount }} \
+    --dry-run -o yaml | sudo kubectl apply -f -
+
+# the service is not exposed, control reaches it through the api server
+sudo kubectl -n {{ .Namespace }} rollout status deployment/{{ .Service }} --timeout=600s
@@ -0,0 +1,33 @@
+{{ range $volume := .Volumes }}
+DEVICE=""
+# volumes show up some time after the machine has booted
+for i in $(seq 1 60); do
+    for d in {{ range $volume.Devices }}{{ . }} {{ end }}; do
+        if [ -b "$d" ]; then
+            DEVICE=$(readlink -f $d)
+            break 2
+        fi
+    done
+    sleep 5
+done
+
+if [ -z "${DEVICE}" ]; then
+    echo "data volume of {{ $volume.MountPoint }} not found"
+    exit 1
+fi
+
+# volumes are formatted once, a filesystem is kept when the step is rerun
+if ! sudo blkid ${DEVICE}; then
+    echo "Formatting ${DEVICE}"
+    sudo mkfs.ext4 -F ${DEVICE}
+fi
+
+sudo mkdir -p {{ $volume.MountPoint }}
+UUID=$(sudo blkid -s UUID -o value ${DEVICE})
+if ! grep -q "UUID=${UUID}" /etc/fstab; then
+    echo "UUID=${UUID} {{ $volume.MountPoint }} ext4 defaults,nofail 0 2" | sudo tee -a /etc/fstab
+fi
+if ! mountpoint -q {{ $volume.MountPoint }}; then
+    sudo mount {{ $volume.MountPoint }}
+fi
+{{ end }}
@@ -0,0 +1,25 @@
+#!/bin/sh
+set -e
+
+ETCD_POD=etcd-$(hostname | tr '[:upper:]' '[:lower:]')
+
+etcdctl() {
+    sudo kubectl -n kube-system exec ${ETCD_POD} -- sh -c "ETCDCTL_API=3 etcdctl \
+    --endpoints=https://127.0.0.1:2379 \
+    --cacert=/etc/kubernetes/pki/etcd/ca.crt \
+    --cert=/etc/kubernetes/pki/etcd/healthcheck-client.crt \
+    --key=/etc/kubernetes/pki/etcd/healthcheck-client.key $*"
+}
+
+# do not touch unhealthy member
+etcdctl endpoint health
+
+REVISION=$(etcdctl endpoint status --write-out=json | grep -o '"revision":[0-9]*' | grep -o '[0-9]*$')
+# compaction is cluster wide, it fails when revision has been compacted by another member already
+etcdctl compact ${REVISION} || true
+etcdctl defrag
+
+etcdctl endpoint health
+
+DB_SIZE=$(etcdctl endpoint status --write-out=json | grep -o '"dbSize":[0-9]*' | grep -o '[0-9]*$')
+echo "{{ .DBSizePrefix }}${DB_SIZE}"
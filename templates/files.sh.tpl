@@ -0,0 +1,33 @@
+#!/bin/sh
+set -e
+
+CHANGED=0
+{{ range .Files }}
+TMP=$(mktemp)
+echo '{{ .Content }}' | base64 -d > ${TMP}
+if ! echo "{{ .SHA256 }}  ${TMP}" | sha256sum -c --status; then
+    rm -f ${TMP}
+    echo "checksum of {{ .Path }} does not match"
+    exit 1
+fi
+
+if sudo cmp -s ${TMP} '{{ .Path }}'; then
+    echo "{{ .Path }} is up to date"
+else
+    if sudo test -f '{{ .Path }}'; then
+        sudo cp -p '{{ .Path }}' '{{ .Path }}{{ $.BackupSuffix }}'
+        echo "{{ .Path }} is backed up to {{ .Path }}{{ $.BackupSuffix }}"
+    fi
+    sudo mkdir -p "$(dirname '{{ .Path }}')"
+    sudo install -m {{ .Mode }} ${TMP} '{{ .Path }}'
+    echo "{{ .Path }} is written"
+    CHANGED=1
+fi
+rm -f ${TMP}
+{{ end }}
+{{ range .Restart }}
+if [ ${CHANGED} -eq 1 ]; then
+    sudo systemctl restart {{ . }}
+    echo "{{ . }} is restarted"
+fi
+{{ end }}
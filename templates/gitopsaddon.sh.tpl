@@ -0,0 +1,69 @@
+{{ if eq .Tool "argocd" }}
+echo "Installing Argo CD"
+sudo kubectl create namespace argocd --dry-run -o yaml | sudo kubectl apply -f -
+sudo kubectl apply -n argocd -f https://raw.githubusercontent.com/argoproj/argo-cd/stable/manifests/install.yaml
+sudo kubectl -n argocd rollout status deployment/argocd-server --timeout=600s
+
+{{ if .Username }}
+sudo kubectl -n argocd create secret generic gitops-repo-credentials \
+    --from-literal=username='{{ .Username }}' \
+    --from-literal=password='{{ .Password }}' \
+    --dry-run -o yaml | sudo kubectl apply -f -
+sudo bash -c "cat > argocd-cm.yaml <<EOF
+data:
+  repositories: |
+    - url: {{ .RepoURL }}
+      usernameSecret:
+        name: gitops-repo-credentials
+        key: username
+      passwordSecret:
+        name: gitops-repo-credentials
+        key: password
+EOF"
+sudo kubectl -n argocd patch configmap argocd-cm --type merge --patch "$(sudo cat argocd-cm.yaml)"
+{{ end }}
+
+sudo bash -c "cat > argocd-bootstrap.yaml <<EOF
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: bootstrap
+  namespace: argocd
+spec:
+  project: default
+  source:
+    repoURL: {{ .RepoURL }}
+    targetRevision: {{ .Branch }}
+    path: {{ .Path }}
+  destination:
+    server: https://kubernetes.default.svc
+    namespace: default
+  syncPolicy:
+    automated:
+      prune: true
+      selfHeal: true
+EOF"
+echo "Creating bootstrap application for {{ .RepoURL }}"
+sudo kubectl apply -f argocd-bootstrap.yaml
+{{ else if eq .Tool "flux" }}
+echo "Installing Flux"
+sudo kubectl create namespace flux --dry-run -o yaml | sudo kubectl apply -f -
+
+{{ if .Username }}
+sudo kubectl -n flux create secret generic flux-git-auth \
+    --from-literal=GIT_AUTHUSER='{{ .Username }}' \
+    --from-literal=GIT_AUTHKEY='{{ .Password }}' \
+    --dry-run -o yaml | sudo kubectl apply -f -
+{{ end }}
+
+sudo /usr/bin/helm repo add fluxcd https://charts.fluxcd.io
+sudo /usr/bin/helm upgrade --install flux fluxcd/flux \
+    --namespace flux \
+    --set git.url='{{ .GitURL }}' \
+    --set git.branch={{ .Branch }} \
+    --set git.path={{ .Path }} \
+    {{- if .Username }}
+    --set env.secretName=flux-git-auth \
+    {{- end }}
+    --wait
+{{ end }}
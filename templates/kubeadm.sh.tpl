@@ -16,8 +16,9 @@ sudo systemctl restart kubelet
 sudo kubeadm config images pull
 
 {{ if .IsBootstrap }}
-sudo kubeadm init --token={{ .Token }} --pod-network-cidr={{ .CIDR }} \
---kubernetes-version {{ .K8SVersion }} --apiserver-bind-port=443 --apiserver-cert-extra-sans {{ .LoadBalancerHost }}
+sudo kubeadm init --token={{ .Token }} --token-ttl {{ .TokenTTL }} --skip-token-print \
+--pod-network-cidr={{ .CIDR }} \
+--kubernetes-version {{ .K8SVersion }} --apiserver-bind-port=443 --apiserver-cert-extra-sans {{ .LoadBalancerHost }}{{ if .APIHost }},{{ .APIHost }}{{ end }}
 sudo kubeadm config view > kubeadm-config.yaml
 sed -i 's/controlPlaneEndpoint: ""/controlPlaneEndpoint: "{{ .LoadBalancerHost }}:443"/g' kubeadm-config.yaml
 sudo kubeadm config upload from-file --config=kubeadm-config.yaml
@@ -1,5 +1,5 @@
 sudo bash -c "cat > /etc/default/kubelet <<EOF
-KUBELET_EXTRA_ARGS=--tls-cert-file=/etc/kubernetes/pki/kubelet.crt --tls-private-key-file=/etc/kubernetes/pki/kubelet.key {{ if eq .Provider "openstack" }}--cloud-provider={{ .Provider }} {{ end }}
+KUBELET_EXTRA_ARGS=--tls-cert-file=/etc/kubernetes/pki/kubelet.crt --tls-private-key-file=/etc/kubernetes/pki/kubelet.key {{ if eq .Provider "openstack" }}--cloud-provider={{ .Provider }} {{ end }}{{ if .MaxPods }}--max-pods={{ .MaxPods }} {{ end }}{{ if .EvictionHard }}--eviction-hard={{ .EvictionHard }} {{ end }}{{ if .KubeReserved }}--kube-reserved={{ .KubeReserved }} {{ end }}{{ if .SystemReserved }}--system-reserved={{ .SystemReserved }} {{ end }}
 EOF"
 
 sudo systemctl daemon-reload
@@ -0,0 +1,21 @@
+#!/bin/sh
+set -e
+
+export DEBIAN_FRONTEND=noninteractive
+
+sudo apt-get update
+{{ if .SecurityOnly }}
+sudo apt-get install -y unattended-upgrades
+sudo unattended-upgrade -v
+{{ else }}
+sudo -E apt-get -y -o Dpkg::Options::="--force-confdef" -o Dpkg::Options::="--force-confold" upgrade
+{{ end }}
+{{ if .UpgradeRuntime }}
+sudo -E apt-get install -y --only-upgrade -o Dpkg::Options::="--force-confold" docker-ce containerd.io
+sudo systemctl restart docker
+{{ end }}
+sudo systemctl restart kubelet
+
+if [ -f /var/run/reboot-required ]; then
+    echo "reboot required to complete patching"
+fi
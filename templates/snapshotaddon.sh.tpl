@@ -0,0 +1,13 @@
+echo "Installing CSI snapshot controller"
+SNAPSHOTTER_URL=https://raw.githubusercontent.com/kubernetes-csi/external-snapshotter/v2.1.1
+
+for crd in volumesnapshotclasses volumesnapshotcontents volumesnapshots; do
+    sudo kubectl apply -f ${SNAPSHOTTER_URL}/config/crd/snapshot.storage.k8s.io_${crd}.yaml
+done
+sudo kubectl wait --for condition=established --timeout=60s crd/volumesnapshots.snapshot.storage.k8s.io
+
+# snapshots are taken by csi drivers of storage classes, the controller
+# binds them to their contents
+sudo kubectl apply -f ${SNAPSHOTTER_URL}/deploy/kubernetes/snapshot-controller/rbac-snapshot-controller.yaml
+sudo kubectl apply -f ${SNAPSHOTTER_URL}/deploy/kubernetes/snapshot-controller/setup-snapshot-controller.yaml
+sudo kubectl -n default rollout status statefulset/snapshot-controller --timeout=600s
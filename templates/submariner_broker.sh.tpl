@@ -0,0 +1,19 @@
+#!/bin/bash
+set -e
+
+SUBCTL_VERSION={{ .Version }}
+if ! /usr/local/bin/subctl version 2>/dev/null | grep -q ${SUBCTL_VERSION}; then
+    curl -sL https://github.com/submariner-io/releases/releases/download/${SUBCTL_VERSION}/subctl-${SUBCTL_VERSION}-linux-amd64.tar.xz | tar -xJ -C /tmp
+    sudo install -m 0755 /tmp/subctl-${SUBCTL_VERSION}/subctl-${SUBCTL_VERSION}-linux-amd64 /usr/local/bin/subctl
+fi
+
+cd $(mktemp -d)
+sudo /usr/local/bin/subctl deploy-broker \
+    --kubeconfig /etc/kubernetes/admin.conf \
+    {{- if .Globalnet }}
+    --globalnet \
+    {{- end }}
+    --components service-discovery,connectivity
+
+echo "{{ .BrokerInfoPrefix }}$(sudo base64 -w0 broker-info.subm)"
+sudo rm -f broker-info.subm
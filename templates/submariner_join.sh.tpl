@@ -0,0 +1,22 @@
+#!/bin/bash
+set -e
+
+SUBCTL_VERSION={{ .Version }}
+if ! /usr/local/bin/subctl version 2>/dev/null | grep -q ${SUBCTL_VERSION}; then
+    curl -sL https://github.com/submariner-io/releases/releases/download/${SUBCTL_VERSION}/subctl-${SUBCTL_VERSION}-linux-amd64.tar.xz | tar -xJ -C /tmp
+    sudo install -m 0755 /tmp/subctl-${SUBCTL_VERSION}/subctl-${SUBCTL_VERSION}-linux-amd64 /usr/local/bin/subctl
+fi
+
+# tunnels of the cluster end on a worker node
+if [ -z "$(sudo kubectl get nodes -l submariner.io/gateway=true -o name)" ]; then
+    GATEWAY=$(sudo kubectl get nodes -l '!node-role.kubernetes.io/master' -o name | head -n 1)
+    sudo kubectl label ${GATEWAY} submariner.io/gateway=true --overwrite
+fi
+
+cd $(mktemp -d)
+echo '{{ .BrokerInfo }}' | base64 -d | sudo tee broker-info.subm > /dev/null
+sudo /usr/local/bin/subctl join broker-info.subm \
+    --kubeconfig /etc/kubernetes/admin.conf \
+    --clusterid {{ .ClusterID }} \
+    --cable-driver {{ .CableDriver }}
+sudo rm -f broker-info.subm
@@ -0,0 +1,7 @@
+#!/bin/bash
+set -e
+
+if [ -x /usr/local/bin/subctl ]; then
+    sudo /usr/local/bin/subctl uninstall --yes --kubeconfig /etc/kubernetes/admin.conf
+fi
+sudo kubectl label nodes --all submariner.io/gateway- || true
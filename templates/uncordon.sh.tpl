@@ -0,0 +1 @@
+sudo kubectl uncordon {{ .NodeName }}
@@ -0,0 +1,22 @@
+#!/bin/sh
+set -e
+
+export DEBIAN_FRONTEND=noninteractive
+
+sudo apt-get update
+sudo apt-mark unhold kubeadm kubelet kubectl
+sudo apt-get install -y --allow-downgrades kubeadm={{ .K8SVersion }}-00
+
+{{ if .Apply }}
+sudo kubeadm upgrade apply v{{ .K8SVersion }} --yes
+{{ else if .IsMaster }}
+sudo kubeadm upgrade node || sudo kubeadm upgrade node experimental-control-plane
+{{ else }}
+sudo kubeadm upgrade node || sudo kubeadm upgrade node config --kubelet-version v{{ .K8SVersion }}
+{{ end }}
+
+sudo apt-get install -y kubelet={{ .K8SVersion }}-00 kubectl={{ .K8SVersion }}-00
+sudo apt-mark hold kubeadm kubelet kubectl
+
+sudo systemctl daemon-reload
+sudo systemctl restart kubelet
@@ -0,0 +1,47 @@
+#!/bin/bash
+set -e
+
+WG_CONF=/etc/wireguard/{{ .Interface }}.conf
+
+{{ if .Peers }}
+if ! command -v wg >/dev/null 2>&1; then
+    sudo apt-get update
+    if ! apt-cache show wireguard >/dev/null 2>&1; then
+        sudo apt-get install -y software-properties-common
+        sudo add-apt-repository -y ppa:wireguard/wireguard
+        sudo apt-get update
+    fi
+    sudo apt-get install -y wireguard
+fi
+
+sudo mkdir -p /etc/wireguard
+sudo chmod 700 /etc/wireguard
+sudo tee ${WG_CONF} > /dev/null <<EOF
+[Interface]
+Address = {{ .Address }}
+ListenPort = {{ .ListenPort }}
+PrivateKey = {{ .PrivateKey }}
+{{ range .Peers }}
+[Peer]
+PublicKey = {{ .PublicKey }}
+Endpoint = {{ .Endpoint }}
+AllowedIPs = {{ stringsJoin .AllowedIPs ", " }}
+PersistentKeepalive = 25
+{{ end }}
+EOF
+sudo chmod 600 ${WG_CONF}
+
+sudo systemctl enable wg-quick@{{ .Interface }}
+if ip link show {{ .Interface }} >/dev/null 2>&1; then
+    # rotated keys and new peers are applied without dropping established tunnels
+    sudo bash -c "wg syncconf {{ .Interface }} <(wg-quick strip {{ .Interface }})"
+else
+    sudo systemctl start wg-quick@{{ .Interface }}
+fi
+{{ else }}
+if [ -f ${WG_CONF} ]; then
+    sudo systemctl disable wg-quick@{{ .Interface }} || true
+    sudo systemctl stop wg-quick@{{ .Interface }} || true
+    sudo rm -f ${WG_CONF}
+fi
+{{ end }}
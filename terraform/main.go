@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+
+	"github.com/supergiant/control/terraform/supergiant"
+)
+
+func main() {
+	plugin.Serve(&plugin.ServeOpts{ProviderFunc: supergiant.Provider})
+}
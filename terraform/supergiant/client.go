@@ -0,0 +1,290 @@
+package supergiant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/v1/api"
+
+// pollInterval is a time between checks of long running operations.
+var pollInterval = time.Second * 15
+
+// Client talks to the REST API of supergiant control.
+type Client struct {
+	address string
+	token   string
+	http    *http.Client
+}
+
+// apiError is returned when the API answers with an unexpected status.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("supergiant: status %d: %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// NewClient returns a client of the API served at the address, requests are
+// authorized with the API token.
+func NewClient(address, token string) *Client {
+	return &Client{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: time.Minute * 10},
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.address+apiPrefix+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &apiError{Status: resp.StatusCode, Message: errorMessage(resp.Body)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %v", method, path, err)
+	}
+	return nil
+}
+
+// errorMessage reads a message of the API, handlers either send a JSON
+// message or plain text.
+func errorMessage(r io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(r, 1<<16))
+	msg := struct {
+		UserMessage string `json:"userMessage"`
+		DevMessage  string `json:"devMessage"`
+	}{}
+	if err := json.Unmarshal(data, &msg); err == nil && msg.UserMessage != "" {
+		if msg.DevMessage == "" {
+			return msg.UserMessage
+		}
+		return msg.UserMessage + ": " + msg.DevMessage
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Kube is a part of the cluster model the provider relies on.
+type Kube struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	State       string              `json:"state"`
+	Provider    string              `json:"provider"`
+	AccountName string              `json:"accountName"`
+	Region      string              `json:"region"`
+	K8SVersion  string              `json:"K8SVersion"`
+	Masters     map[string]*Machine `json:"masters"`
+	Nodes       map[string]*Machine `json:"nodes"`
+}
+
+// Machine is a node of the cluster.
+type Machine struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskId"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+}
+
+type provisionRequest struct {
+	ClusterName      string          `json:"clusterName"`
+	Profile          json.RawMessage `json:"profile"`
+	CloudAccountName string          `json:"cloudAccountName"`
+}
+
+type provisionResponse struct {
+	ClusterID string `json:"clusterId"`
+}
+
+// Provision starts provisioning of the cluster described by the profile.
+func (c *Client) Provision(ctx context.Context, name, account string, profile json.RawMessage) (string, error) {
+	resp := &provisionResponse{}
+	err := c.do(ctx, http.MethodPost, "/provision", &provisionRequest{
+		ClusterName:      name,
+		Profile:          profile,
+		CloudAccountName: account,
+	}, resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.ClusterID, nil
+}
+
+func (c *Client) GetKube(ctx context.Context, kubeID string) (*Kube, error) {
+	k := &Kube{}
+	if err := c.do(ctx, http.MethodGet, "/kubes/"+url.PathEscape(kubeID), nil, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (c *Client) DeleteKube(ctx context.Context, kubeID string) error {
+	return c.do(ctx, http.MethodDelete, "/kubes/"+url.PathEscape(kubeID), nil, nil)
+}
+
+// AddNodes starts workflows of the nodes and returns IDs of their tasks.
+func (c *Client) AddNodes(ctx context.Context, kubeID string, nodes []map[string]string) ([]string, error) {
+	taskIDs := make([]string, 0, len(nodes))
+	err := c.do(ctx, http.MethodPost, "/kubes/"+url.PathEscape(kubeID)+"/machines", nodes, &taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	return taskIDs, nil
+}
+
+type taskResponse struct {
+	ID string `json:"id"`
+}
+
+// DeleteNode starts deletion of the node and returns ID of its task.
+func (c *Client) DeleteNode(ctx context.Context, kubeID, name string) (string, error) {
+	t := &taskResponse{}
+	err := c.do(ctx, http.MethodDelete,
+		"/kubes/"+url.PathEscape(kubeID)+"/machines/"+url.PathEscape(name), nil, t)
+	if err != nil {
+		return "", err
+	}
+	return t.ID, nil
+}
+
+// Task is a part of the workflow task the provider relies on.
+type Task struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func (c *Client) GetTask(ctx context.Context, taskID string) (*Task, error) {
+	t := &Task{}
+	if err := c.do(ctx, http.MethodGet, "/tasks/"+url.PathEscape(taskID), nil, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WaitTask blocks until the task is finished and fails unless it succeeded.
+func (c *Client) WaitTask(ctx context.Context, taskID string) error {
+	for {
+		t, err := c.GetTask(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		switch t.Status {
+		case "success":
+			return nil
+		case "error", "cancelled":
+			return fmt.Errorf("task %s %s: %s", t.Type, t.ID, t.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("task %s: %v", taskID, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// ReleaseInput describes a helm release to install or upgrade.
+type ReleaseInput struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	ChartName    string `json:"chartName"`
+	ChartVersion string `json:"chartVersion"`
+	RepoName     string `json:"repoName"`
+	Values       string `json:"values"`
+	Wait         bool   `json:"wait"`
+	Timeout      int64  `json:"timeout"`
+}
+
+// Release is a helm release deployed to the cluster.
+type Release struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Version      int32  `json:"version"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chartVersion"`
+	Status       string `json:"status"`
+}
+
+func releasesPath(kubeID string) string {
+	return "/kubes/" + url.PathEscape(kubeID) + "/releases"
+}
+
+// InstallRelease installs the release and waits for the result, slow
+// charts are handled by the client timeout rather than by helm operations.
+func (c *Client) InstallRelease(ctx context.Context, kubeID string, inp *ReleaseInput) (*Release, error) {
+	rls := &Release{}
+	if err := c.do(ctx, http.MethodPost, releasesPath(kubeID)+"?wait=true", inp, rls); err != nil {
+		return nil, err
+	}
+	return rls, nil
+}
+
+func (c *Client) UpgradeRelease(ctx context.Context, kubeID string, inp *ReleaseInput) (*Release, error) {
+	rls := &Release{}
+	err := c.do(ctx, http.MethodPut,
+		releasesPath(kubeID)+"/"+url.PathEscape(inp.Name)+"?wait=true", inp, rls)
+	if err != nil {
+		return nil, err
+	}
+	return rls, nil
+}
+
+// GetRelease finds the release among the ones of the cluster, details of
+// a missing release aren't told apart from other helm errors by the API.
+func (c *Client) GetRelease(ctx context.Context, kubeID, name string) (*Release, error) {
+	releases := make([]*Release, 0)
+	if err := c.do(ctx, http.MethodGet, releasesPath(kubeID), nil, &releases); err != nil {
+		return nil, err
+	}
+	for _, rls := range releases {
+		if rls.Name == name {
+			return rls, nil
+		}
+	}
+	return nil, &apiError{Status: http.StatusNotFound, Message: "release " + name + " not found"}
+}
+
+func (c *Client) DeleteRelease(ctx context.Context, kubeID, name string) error {
+	return c.do(ctx, http.MethodDelete,
+		releasesPath(kubeID)+"/"+url.PathEscape(name)+"?wait=true&purge=true", nil, nil)
+}
@@ -0,0 +1,40 @@
+package supergiant
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Provider manages clusters, their nodes and helm releases through the API
+// of supergiant control.
+func Provider() *schema.Provider {
+	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"address": {
+				Type:        schema.TypeString,
+				Required:    true,
+				DefaultFunc: schema.EnvDefaultFunc("SUPERGIANT_ADDRESS", nil),
+				Description: "Address of supergiant control, e.g. https://supergiant.example.com",
+			},
+			"token": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("SUPERGIANT_TOKEN", nil),
+				Description: "API token issued by POST /v1/api/sessions/tokens",
+			},
+		},
+		ResourcesMap: map[string]*schema.Resource{
+			"supergiant_cluster":  resourceCluster(),
+			"supergiant_nodepool": resourceNodePool(),
+			"supergiant_release":  resourceRelease(),
+		},
+		ConfigureContextFunc: configure,
+	}
+}
+
+func configure(_ context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	return NewClient(d.Get("address").(string), d.Get("token").(string)), nil
+}
@@ -0,0 +1,353 @@
+package supergiant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+const testToken = "secret"
+
+// fakeAPI serves the part of the API used by the provider, workflows are
+// finished on the next read of the cluster.
+type fakeAPI struct {
+	sync.Mutex
+
+	kubes    map[string]*Kube
+	failed   bool
+	releases map[string]*Release
+	tasks    int
+	requests []string
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		kubes:    make(map[string]*Kube),
+		releases: make(map[string]*Release),
+	}
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		http.Error(w, "invalid credentials", http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	f.requests = append(f.requests, r.Method+" "+path)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && path == "/provision":
+		req := &provisionRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		f.kubes["k1"] = &Kube{
+			ID:          "k1",
+			Name:        req.ClusterName,
+			AccountName: req.CloudAccountName,
+			State:       "provisioning",
+			Masters:     map[string]*Machine{"m1": {Name: "m1"}},
+			Nodes:       map[string]*Machine{},
+		}
+		json.NewEncoder(w).Encode(&provisionResponse{ClusterID: "k1"})
+	case parts[0] == "tasks":
+		json.NewEncoder(w).Encode(&Task{ID: parts[1], Status: "success"})
+	case parts[0] == "kubes" && len(parts) == 2:
+		k, ok := f.kubes[parts[1]]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"userMessage":"No such %s","devMessage":"not found"}`, parts[1])
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.kubes, k.ID)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if k.State == "provisioning" {
+			k.State = stateOperational
+			if f.failed {
+				k.State = stateFailed
+			}
+		}
+		json.NewEncoder(w).Encode(k)
+	case parts[0] == "kubes" && parts[2] == "machines" && r.Method == http.MethodPost:
+		profiles := make([]map[string]string, 0)
+		json.NewDecoder(r.Body).Decode(&profiles)
+		taskIDs := make([]string, 0, len(profiles))
+		for range profiles {
+			f.tasks++
+			id := fmt.Sprintf("t%d", f.tasks)
+			name := fmt.Sprintf("node-%d", f.tasks)
+			f.kubes[parts[1]].Nodes[name] = &Machine{Name: name, TaskID: id}
+			taskIDs = append(taskIDs, id)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(taskIDs)
+	case parts[0] == "kubes" && parts[2] == "machines" && r.Method == http.MethodDelete:
+		delete(f.kubes[parts[1]].Nodes, parts[3])
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(&taskResponse{ID: "d-" + parts[3]})
+	case parts[0] == "kubes" && parts[2] == "releases" && len(parts) == 3 && r.Method == http.MethodGet:
+		releases := make([]*Release, 0)
+		for _, rls := range f.releases {
+			releases = append(releases, rls)
+		}
+		json.NewEncoder(w).Encode(releases)
+	case parts[0] == "kubes" && parts[2] == "releases" && r.Method == http.MethodDelete:
+		delete(f.releases, parts[3])
+		json.NewEncoder(w).Encode(&Release{Name: parts[3]})
+	case parts[0] == "kubes" && parts[2] == "releases":
+		inp := &ReleaseInput{}
+		json.NewDecoder(r.Body).Decode(inp)
+		rls := &Release{
+			Name:         inp.Name,
+			Namespace:    inp.Namespace,
+			Chart:        inp.ChartName,
+			ChartVersion: inp.ChartVersion,
+			Version:      1,
+			Status:       "DEPLOYED",
+		}
+		if old, ok := f.releases[inp.Name]; ok {
+			rls.Version = old.Version + 1
+		}
+		f.releases[inp.Name] = rls
+		json.NewEncoder(w).Encode(rls)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func testClient(t *testing.T) (*Client, *fakeAPI) {
+	pollInterval = time.Millisecond
+	api := newFakeAPI()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL+"/", testToken), api
+}
+
+// updateData applies the configuration to the state of the resource as
+// terraform does on plan.
+func updateData(t *testing.T, r *schema.Resource, d *schema.ResourceData, meta interface{},
+	raw map[string]interface{}) *schema.ResourceData {
+	state := d.State()
+	diff, err := r.Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = schema.InternalMap(r.Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestProvider(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, _ := testClient(t)
+
+	_, err := c.GetKube(context.Background(), "missing")
+	if !isNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "No such missing: not found") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	c.token = "wrong"
+	_, err = c.GetKube(context.Background(), "k1")
+	if apiErr, ok := err.(*apiError); !ok || apiErr.Status != http.StatusForbidden ||
+		apiErr.Message != "invalid credentials" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		failed bool
+		state  string
+		err    string
+	}{
+		{
+			name:  "operational",
+			state: stateOperational,
+		},
+		{
+			name:   "failed",
+			failed: true,
+			err:    "provisioning of cluster k1 has failed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, api := testClient(t)
+			api.failed = tc.failed
+			r := resourceCluster()
+			d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+				"name":               "prod",
+				"cloud_account_name": "aws",
+				"profile":            `{"region": "us-east-1"}`,
+			})
+
+			diags := r.CreateContext(context.Background(), d, c)
+			if tc.err != "" {
+				if !diags.HasError() || !strings.Contains(diags[0].Summary, tc.err) {
+					t.Fatalf("expected %q, got %v", tc.err, diags)
+				}
+				if d.Id() != "k1" {
+					t.Errorf("failed cluster must be kept in state to be tainted, id %q", d.Id())
+				}
+				return
+			}
+			if diags.HasError() {
+				t.Fatal(diags)
+			}
+			if d.Id() != "k1" || d.Get("state") != tc.state {
+				t.Errorf("unexpected cluster %q in state %v", d.Id(), d.Get("state"))
+			}
+			if masters := stringList(d.Get("masters")); !reflect.DeepEqual(masters, []string{"m1"}) {
+				t.Errorf("unexpected masters %v", masters)
+			}
+
+			if diags = r.DeleteContext(context.Background(), d, c); diags.HasError() {
+				t.Fatal(diags)
+			}
+			if diags = r.ReadContext(context.Background(), d, c); diags.HasError() || d.Id() != "" {
+				t.Errorf("deleted cluster must be removed from state, id %q %v", d.Id(), diags)
+			}
+		})
+	}
+}
+
+func TestNodePool(t *testing.T) {
+	c, api := testClient(t)
+	api.kubes["k1"] = &Kube{
+		ID:    "k1",
+		State: stateOperational,
+		Nodes: map[string]*Machine{"manual": {Name: "manual", TaskID: "t0"}},
+	}
+	r := resourceNodePool()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"kube_id":      "k1",
+		"node_profile": map[string]interface{}{"size": "m5.large"},
+		"node_count":   2,
+	})
+
+	if diags := r.CreateContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if nodes := stringList(d.Get("nodes")); !reflect.DeepEqual(nodes, []string{"node-1", "node-2"}) {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+
+	d = updateData(t, r, d, c, map[string]interface{}{
+		"kube_id":      "k1",
+		"node_profile": map[string]interface{}{"size": "m5.large"},
+		"node_count":   1,
+	})
+	if diags := r.UpdateContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if nodes := stringList(d.Get("nodes")); !reflect.DeepEqual(nodes, []string{"node-1"}) {
+		t.Errorf("the newest node must be deleted, got %v", nodes)
+	}
+	if tasks := stringList(d.Get("task_ids")); !reflect.DeepEqual(tasks, []string{"t1"}) {
+		t.Errorf("unexpected tasks %v", tasks)
+	}
+
+	if diags := r.DeleteContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if _, ok := api.kubes["k1"].Nodes["manual"]; !ok || len(api.kubes["k1"].Nodes) != 1 {
+		t.Errorf("only nodes of the pool must be deleted, left %v", api.kubes["k1"].Nodes)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	c, api := testClient(t)
+	r := resourceRelease()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"kube_id":       "k1",
+		"name":          "ingress",
+		"namespace":     "kube-system",
+		"repo_name":     "stable",
+		"chart_name":    "nginx-ingress",
+		"chart_version": "1.0.0",
+	})
+
+	if diags := r.CreateContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if d.Id() != "k1/ingress" || d.Get("version") != 1 || d.Get("status") != "DEPLOYED" {
+		t.Errorf("unexpected release %q version %v status %v", d.Id(), d.Get("version"), d.Get("status"))
+	}
+	if api.requests[0] != "POST /kubes/k1/releases" {
+		t.Errorf("unexpected request %s", api.requests[0])
+	}
+
+	d = updateData(t, r, d, c, map[string]interface{}{
+		"kube_id":       "k1",
+		"name":          "ingress",
+		"namespace":     "kube-system",
+		"repo_name":     "stable",
+		"chart_name":    "nginx-ingress",
+		"chart_version": "1.1.0",
+	})
+	if diags := r.UpdateContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if d.Get("version") != 2 || d.Get("chart_version") != "1.1.0" {
+		t.Errorf("expected upgraded release, version %v chart %v", d.Get("version"), d.Get("chart_version"))
+	}
+
+	if diags := r.DeleteContext(context.Background(), d, c); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if diags := r.ReadContext(context.Background(), d, c); diags.HasError() || d.Id() != "" {
+		t.Errorf("deleted release must be removed from state, id %q %v", d.Id(), diags)
+	}
+}
+
+func TestImportRelease(t *testing.T) {
+	for _, tc := range []struct {
+		id   string
+		kube string
+		name string
+		err  bool
+	}{
+		{id: "k1/ingress", kube: "k1", name: "ingress"},
+		{id: "ingress", err: true},
+		{id: "k1/", err: true},
+	} {
+		r := resourceRelease()
+		d := r.Data(nil)
+		d.SetId(tc.id)
+
+		_, err := importRelease(context.Background(), d, nil)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: unexpected error %v", tc.id, err)
+			continue
+		}
+		if !tc.err && (d.Get("kube_id") != tc.kube || d.Get("name") != tc.name) {
+			t.Errorf("%s: unexpected kube %v release %v", tc.id, d.Get("kube_id"), d.Get("name"))
+		}
+	}
+}
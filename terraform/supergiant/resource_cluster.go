@@ -0,0 +1,168 @@
+package supergiant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	stateOperational = "operational"
+	stateFailed      = "failed"
+)
+
+func resourceCluster() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: createCluster,
+		ReadContext:   readCluster,
+		DeleteContext: deleteCluster,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(time.Hour),
+			Delete: schema.DefaultTimeout(time.Minute * 30),
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringMatch(clusterName, "must contain letters, digits and dashes only"),
+			},
+			"cloud_account_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"profile": {
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateFunc:     validation.StringIsJSON,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+				Description:      "JSON profile of the cluster as accepted by POST /v1/api/provision",
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"provider_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"region": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"k8s_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"masters": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func createCluster(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+
+	kubeID, err := c.Provision(ctx, d.Get("name").(string), d.Get("cloud_account_name").(string),
+		json.RawMessage(d.Get("profile").(string)))
+	if err != nil {
+		return diag.Errorf("provision cluster: %v", err)
+	}
+	// the cluster exists from now on, failed provisioning taints it
+	d.SetId(kubeID)
+
+	if err = waitCluster(ctx, c, kubeID, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return diag.FromErr(err)
+	}
+	return readCluster(ctx, d, meta)
+}
+
+func waitCluster(ctx context.Context, c *Client, kubeID string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		k, err := c.GetKube(ctx, kubeID)
+		if err != nil {
+			return fmt.Errorf("get cluster %s: %v", kubeID, err)
+		}
+		switch k.State {
+		case stateOperational:
+			return nil
+		case stateFailed:
+			return fmt.Errorf("provisioning of cluster %s has failed, see its tasks for details", kubeID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for cluster %s: %v", kubeID, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func readCluster(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+
+	k, err := c.GetKube(ctx, d.Id())
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("get cluster %s: %v", d.Id(), err)
+	}
+
+	d.Set("name", k.Name)
+	d.Set("cloud_account_name", k.AccountName)
+	d.Set("state", k.State)
+	d.Set("provider_name", k.Provider)
+	d.Set("region", k.Region)
+	d.Set("k8s_version", k.K8SVersion)
+	d.Set("masters", machineNames(k.Masters, nil))
+	return nil
+}
+
+func deleteCluster(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+
+	if err := c.DeleteKube(ctx, d.Id()); err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return diag.Errorf("delete cluster %s: %v", d.Id(), err)
+	}
+
+	// machines are deleted in background, the cluster is gone after them
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	for {
+		_, err := c.GetKube(ctx, d.Id())
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return diag.Errorf("get cluster %s: %v", d.Id(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return diag.Errorf("wait for deletion of cluster %s: %v", d.Id(), ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package supergiant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var clusterName = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// resourceNodePool manages a set of nodes of the cluster created from the
+// same profile, nodes of the pool are told apart by tasks that created them.
+func resourceNodePool() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: createNodePool,
+		ReadContext:   readNodePool,
+		UpdateContext: updateNodePool,
+		DeleteContext: deleteNodePool,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(time.Minute * 30),
+			Update: schema.DefaultTimeout(time.Minute * 30),
+			Delete: schema.DefaultTimeout(time.Minute * 30),
+		},
+		Schema: map[string]*schema.Schema{
+			"kube_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"node_profile": {
+				Type:        schema.TypeMap,
+				Required:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Cloud specific settings of nodes, e.g. size and image",
+			},
+			"node_count": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"task_ids": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"nodes": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func createNodePool(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	taskIDs, err := addNodes(ctx, c, d, d.Get("node_count").(int))
+	if err != nil {
+		return diag.Errorf("add nodes to cluster %s: %v", kubeID, err)
+	}
+	d.SetId(kubeID + "/" + taskIDs[0])
+	d.Set("task_ids", taskIDs)
+
+	if err = waitTasks(ctx, c, taskIDs, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return diag.FromErr(err)
+	}
+	return readNodePool(ctx, d, meta)
+}
+
+func readNodePool(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+
+	k, err := c.GetKube(ctx, d.Get("kube_id").(string))
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("get cluster %s: %v", d.Get("kube_id"), err)
+	}
+
+	nodes := machineNames(k.Nodes, poolTasks(d))
+	if len(nodes) == 0 {
+		d.SetId("")
+		return nil
+	}
+	d.Set("nodes", nodes)
+	d.Set("node_count", len(nodes))
+	return nil
+}
+
+func updateNodePool(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	if !d.HasChange("node_count") {
+		return readNodePool(ctx, d, meta)
+	}
+	old, _ := d.GetChange("node_count")
+	current, want := old.(int), d.Get("node_count").(int)
+
+	if want > current {
+		taskIDs, err := addNodes(ctx, c, d, want-current)
+		if err != nil {
+			return diag.Errorf("add nodes to cluster %s: %v", kubeID, err)
+		}
+		d.Set("task_ids", append(stringList(d.Get("task_ids")), taskIDs...))
+
+		if err = waitTasks(ctx, c, taskIDs, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return diag.FromErr(err)
+		}
+		return readNodePool(ctx, d, meta)
+	}
+
+	k, err := c.GetKube(ctx, kubeID)
+	if err != nil {
+		return diag.Errorf("get cluster %s: %v", kubeID, err)
+	}
+	// the newest nodes are removed first
+	nodes := machineNames(k.Nodes, poolTasks(d))
+	if want > len(nodes) {
+		want = len(nodes)
+	}
+	if err = deleteNodes(ctx, c, kubeID, nodes[want:], d.Timeout(schema.TimeoutUpdate)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	deleted := make(map[string]bool)
+	for _, name := range nodes[want:] {
+		deleted[k.Nodes[name].TaskID] = true
+	}
+	taskIDs := make([]string, 0, want)
+	for _, id := range stringList(d.Get("task_ids")) {
+		if !deleted[id] {
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	d.Set("task_ids", taskIDs)
+	return readNodePool(ctx, d, meta)
+}
+
+func deleteNodePool(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	k, err := c.GetKube(ctx, kubeID)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("get cluster %s: %v", kubeID, err)
+	}
+
+	err = deleteNodes(ctx, c, kubeID, machineNames(k.Nodes, poolTasks(d)), d.Timeout(schema.TimeoutDelete))
+	return diag.FromErr(err)
+}
+
+func addNodes(ctx context.Context, c *Client, d *schema.ResourceData, count int) ([]string, error) {
+	nodeProfile := make(map[string]string)
+	for k, v := range d.Get("node_profile").(map[string]interface{}) {
+		nodeProfile[k] = v.(string)
+	}
+
+	profiles := make([]map[string]string, 0, count)
+	for i := 0; i < count; i++ {
+		profiles = append(profiles, nodeProfile)
+	}
+
+	taskIDs, err := c.AddNodes(ctx, d.Get("kube_id").(string), profiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(taskIDs) == 0 {
+		return nil, fmt.Errorf("no tasks have been started")
+	}
+	return taskIDs, nil
+}
+
+func deleteNodes(ctx context.Context, c *Client, kubeID string, names []string, timeout time.Duration) error {
+	taskIDs := make([]string, 0, len(names))
+	for _, name := range names {
+		taskID, err := c.DeleteNode(ctx, kubeID, name)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("delete node %s of cluster %s: %v", name, kubeID, err)
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return waitTasks(ctx, c, taskIDs, timeout)
+}
+
+func waitTasks(ctx context.Context, c *Client, taskIDs []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var failed []string
+	for _, id := range taskIDs {
+		if err := c.WaitTask(ctx, id); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// poolTasks maps tasks of the pool to their order of creation.
+func poolTasks(d *schema.ResourceData) map[string]int {
+	tasks := make(map[string]int)
+	for i, id := range stringList(d.Get("task_ids")) {
+		tasks[id] = i
+	}
+	return tasks
+}
+
+// machineNames returns names of the machines created by the tasks in order
+// of the tasks, names of all machines are sorted when tasks are nil.
+func machineNames(machines map[string]*Machine, tasks map[string]int) []string {
+	names := make([]string, 0, len(machines))
+	for name, m := range machines {
+		if _, ok := tasks[m.TaskID]; ok || tasks == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, tj := tasks[machines[names[i]].TaskID], tasks[machines[names[j]].TaskID]
+		if ti != tj {
+			return ti < tj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func stringList(v interface{}) []string {
+	items := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, item.(string))
+	}
+	return list
+}
@@ -0,0 +1,162 @@
+package supergiant
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceRelease() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: createRelease,
+		ReadContext:   readRelease,
+		UpdateContext: updateRelease,
+		DeleteContext: deleteRelease,
+		Importer: &schema.ResourceImporter{
+			StateContext: importRelease,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(time.Minute * 10),
+			Update: schema.DefaultTimeout(time.Minute * 10),
+			Delete: schema.DefaultTimeout(time.Minute * 10),
+		},
+		Schema: map[string]*schema.Schema{
+			"kube_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"namespace": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"repo_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"chart_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"chart_version": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"values": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "YAML values of the chart",
+			},
+			"wait": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Wait until resources of the release are ready",
+			},
+			"version": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func releaseInput(d *schema.ResourceData) *ReleaseInput {
+	return &ReleaseInput{
+		Name:         d.Get("name").(string),
+		Namespace:    d.Get("namespace").(string),
+		RepoName:     d.Get("repo_name").(string),
+		ChartName:    d.Get("chart_name").(string),
+		ChartVersion: d.Get("chart_version").(string),
+		Values:       d.Get("values").(string),
+		Wait:         d.Get("wait").(bool),
+	}
+}
+
+func createRelease(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	rls, err := c.InstallRelease(ctx, kubeID, releaseInput(d))
+	if err != nil {
+		return diag.Errorf("install release %s to cluster %s: %v", d.Get("name"), kubeID, err)
+	}
+	d.SetId(kubeID + "/" + rls.Name)
+
+	return readRelease(ctx, d, meta)
+}
+
+func readRelease(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	rls, err := c.GetRelease(ctx, kubeID, d.Get("name").(string))
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("get release %s of cluster %s: %v", d.Get("name"), kubeID, err)
+	}
+
+	d.Set("namespace", rls.Namespace)
+	d.Set("chart_name", rls.Chart)
+	d.Set("chart_version", rls.ChartVersion)
+	d.Set("version", rls.Version)
+	d.Set("status", rls.Status)
+	return nil
+}
+
+func updateRelease(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+	if _, err := c.UpgradeRelease(ctx, kubeID, releaseInput(d)); err != nil {
+		return diag.Errorf("upgrade release %s of cluster %s: %v", d.Get("name"), kubeID, err)
+	}
+
+	return readRelease(ctx, d, meta)
+}
+
+func deleteRelease(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*Client)
+	kubeID := d.Get("kube_id").(string)
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	err := c.DeleteRelease(ctx, kubeID, d.Get("name").(string))
+	if err != nil && !isNotFound(err) {
+		return diag.Errorf("delete release %s of cluster %s: %v", d.Get("name"), kubeID, err)
+	}
+	return nil
+}
+
+// importRelease takes IDs of releases in the form of <kube id>/<release name>.
+func importRelease(_ context.Context, d *schema.ResourceData, _ interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("release id %q must look like <kube id>/<release name>", d.Id())
+	}
+	d.Set("kube_id", parts[0])
+	d.Set("name", parts[1])
+	return []*schema.ResourceData{d}, nil
+}